@@ -14,11 +14,15 @@
 package agentclient
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 
+	"github.com/uber/kraken/agent/agentmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/httputil"
@@ -26,13 +30,17 @@ import (
 
 // Client errors.
 var (
-	ErrTagNotFound = errors.New("tag not found")
+	ErrTagNotFound      = errors.New("tag not found")
+	ErrPrefetchNotFound = errors.New("prefetch not found")
 )
 
 // Client defines a client for accessing the agent server.
 type Client interface {
 	GetTag(tag string) (core.Digest, error)
 	Download(namespace string, d core.Digest) (io.ReadCloser, error)
+	Seed(namespace string, d core.Digest) error
+	Prefetch(req agentmodels.PrefetchRequest) (*agentmodels.PrefetchStatus, error)
+	GetPrefetch(image string) (*agentmodels.PrefetchStatus, error)
 }
 
 // HTTPClient provides a wrapper for HTTP operations on an agent.
@@ -79,3 +87,56 @@ func (c *HTTPClient) Download(namespace string, d core.Digest) (io.ReadCloser, e
 	}
 	return resp.Body, nil
 }
+
+// Seed registers the blob of d, which must already be in the cache of the
+// agent, for seeding without downloading it.
+func (c *HTTPClient) Seed(namespace string, d core.Digest) error {
+	_, err := httputil.Post(
+		fmt.Sprintf(
+			"http://%s/namespace/%s/blobs/%s/seed",
+			c.addr, url.PathEscape(namespace), d))
+	return err
+}
+
+// Prefetch starts downloading the blobs of an image into the cache of the
+// agent. Returns ErrTagNotFound if the image does not exist.
+func (c *HTTPClient) Prefetch(req agentmodels.PrefetchRequest) (*agentmodels.PrefetchStatus, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal: %s", err)
+	}
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/prefetch", c.addr),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendAcceptedCodes(http.StatusAccepted))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+	var status agentmodels.PrefetchStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return &status, nil
+}
+
+// GetPrefetch returns the status of the last prefetch of image. Returns
+// ErrPrefetchNotFound if image was not prefetched recently.
+func (c *HTTPClient) GetPrefetch(image string) (*agentmodels.PrefetchStatus, error) {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/prefetch/%s", c.addr, url.PathEscape(image)))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, ErrPrefetchNotFound
+		}
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+	var status agentmodels.PrefetchStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return &status, nil
+}
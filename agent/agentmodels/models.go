@@ -0,0 +1,56 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentmodels
+
+import (
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// PrefetchRequest is the body of prefetch requests.
+type PrefetchRequest struct {
+	// Image is the reference of the image to prefetch, e.g. "repo:tag".
+	Image string `json:"image"`
+
+	// Platform selects the image of manifest lists, e.g. "linux/arm64/v8".
+	// Defaults to the platform of the agent.
+	Platform string `json:"platform,omitempty"`
+}
+
+// Prefetch states.
+const (
+	PrefetchRunning = "running"
+	PrefetchDone    = "done"
+	PrefetchFailed  = "failed"
+)
+
+// PrefetchStatus reports the progress of a prefetch.
+type PrefetchStatus struct {
+	Image    string      `json:"image"`
+	Platform string      `json:"platform"`
+	Digest   core.Digest `json:"digest"`
+	State    string      `json:"state"`
+	Error    string      `json:"error,omitempty"`
+
+	// Blobs and Bytes are the totals of the config and layers of the image,
+	// which are only known once its manifest is downloaded.
+	Blobs           int   `json:"blobs"`
+	DownloadedBlobs int   `json:"downloaded_blobs"`
+	Bytes           int64 `json:"bytes"`
+	DownloadedBytes int64 `json:"downloaded_bytes"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,463 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/filters"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ContainerdConfig defines the containerd content store served on the gRPC
+// socket of the agent, which containerd uses as a content proxy plugin.
+type ContainerdConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Namespace is the namespace blobs requested by containerd are downloaded
+	// from. Containerd does not say which repo a blob belongs to, so the
+	// namespace must select a backend which stores blobs by digest.
+	Namespace string `yaml:"namespace"`
+
+	// IngestDir is where content written by containerd, e.g. blobs of images
+	// pulled from registries other than Kraken, is staged until committed.
+	// Defaults to the temp dir.
+	IngestDir string `yaml:"ingest_dir"`
+}
+
+func (c ContainerdConfig) applyDefaults() ContainerdConfig {
+	if c.IngestDir == "" {
+		c.IngestDir = os.TempDir()
+	}
+	return c
+}
+
+// contentStore implements the containerd content store on top of the cache
+// of the agent. Blobs which are not cached are downloaded through p2p when
+// containerd asks for them, so containerd does not fetch them from
+// registries. Kraken owns the lifetime of cached blobs, so deletes from
+// containerd, e.g. by its garbage collection, are ignored.
+type contentStore struct {
+	config ContainerdConfig
+	cads   *store.CADownloadStore
+	sched  scheduler.ReloadableScheduler
+
+	mu      sync.Mutex
+	ingests map[string]*contentWriter
+}
+
+func newContentStore(
+	config ContainerdConfig,
+	cads *store.CADownloadStore,
+	sched scheduler.ReloadableScheduler) *contentStore {
+
+	return &contentStore{
+		config:  config.applyDefaults(),
+		cads:    cads,
+		sched:   sched,
+		ingests: make(map[string]*contentWriter),
+	}
+}
+
+var _ content.Store = (*contentStore)(nil)
+
+func parseContentDigest(dgst digest.Digest) (core.Digest, error) {
+	d, err := core.ParseSHA256Digest(dgst.String())
+	if err != nil {
+		return core.Digest{}, errors.Wrapf(errdefs.ErrNotFound, "content %v: %s", dgst, err)
+	}
+	return d, nil
+}
+
+// download downloads d into the cache, unless ctx is done first.
+func (s *contentStore) download(ctx context.Context, d core.Digest) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.sched.Download(s.config.Namespace, d)
+	}()
+	select {
+	case err := <-errc:
+		if err == scheduler.ErrTorrentNotFound {
+			return errors.Wrapf(errdefs.ErrNotFound, "content %v", d)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "download %s", d)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stat stats d in the cache, downloading it first if it is not cached.
+func (s *contentStore) stat(ctx context.Context, d core.Digest) (os.FileInfo, error) {
+	info, err := s.cads.Cache().GetFileStat(d.Hex())
+	if err == nil {
+		return info, nil
+	}
+	if !os.IsNotExist(err) && !s.cads.InDownloadError(err) {
+		return nil, errors.Wrap(err, "store")
+	}
+	if err := s.download(ctx, d); err != nil {
+		return nil, err
+	}
+	return s.cads.Cache().GetFileStat(d.Hex())
+}
+
+func toContentInfo(d core.Digest, info os.FileInfo) content.Info {
+	return content.Info{
+		Digest:    digest.Digest(d.String()),
+		Size:      info.Size(),
+		CreatedAt: info.ModTime(),
+		UpdatedAt: info.ModTime(),
+	}
+}
+
+// Info returns the info of dgst. Containerd calls Info before fetching a blob
+// from a registry, and skips the fetch if the blob exists.
+func (s *contentStore) Info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	d, err := parseContentDigest(dgst)
+	if err != nil {
+		return content.Info{}, err
+	}
+	info, err := s.stat(ctx, d)
+	if err != nil {
+		return content.Info{}, err
+	}
+	return toContentInfo(d, info), nil
+}
+
+// Update does not update anything, since containerd keeps the labels of
+// proxied content itself.
+func (s *contentStore) Update(
+	ctx context.Context, info content.Info, fieldpaths ...string) (content.Info, error) {
+
+	return s.Info(ctx, info.Digest)
+}
+
+func (s *contentStore) Walk(ctx context.Context, fn content.WalkFunc, fs ...string) error {
+	filter, err := filters.ParseAll(fs...)
+	if err != nil {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "parse filters: %s", err)
+	}
+	names, err := s.cads.Cache().ListNames()
+	if err != nil {
+		return errors.Wrap(err, "list cache")
+	}
+	for _, name := range names {
+		d, err := core.NewSHA256DigestFromHex(name)
+		if err != nil {
+			continue
+		}
+		fi, err := s.cads.Cache().GetFileStat(name)
+		if err != nil {
+			// Blob was deleted or evicted since listing.
+			continue
+		}
+		info := toContentInfo(d, fi)
+		if !filter.Match(adaptContentInfo(info)) {
+			continue
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete is a no-op, see contentStore.
+func (s *contentStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	return nil
+}
+
+func (s *contentStore) ReaderAt(ctx context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	d, err := parseContentDigest(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	// The blob may have been evicted since containerd last saw it.
+	if _, err := s.stat(ctx, d); err != nil {
+		return nil, err
+	}
+	r, err := s.cads.Cache().GetFileReader(d.Hex())
+	if err != nil {
+		return nil, errors.Wrap(err, "store")
+	}
+	return r, nil
+}
+
+func (s *contentStore) Status(ctx context.Context, ref string) (content.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.ingests[ref]
+	if !ok {
+		return content.Status{}, errors.Wrapf(errdefs.ErrNotFound, "ingest %s", ref)
+	}
+	return w.Status()
+}
+
+func (s *contentStore) ListStatuses(ctx context.Context, fs ...string) ([]content.Status, error) {
+	filter, err := filters.ParseAll(fs...)
+	if err != nil {
+		return nil, errors.Wrapf(errdefs.ErrInvalidArgument, "parse filters: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var statuses []content.Status
+	for _, w := range s.ingests {
+		status, err := w.Status()
+		if err != nil {
+			return nil, err
+		}
+		if filter.Match(adaptContentStatus(status)) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+func (s *contentStore) Abort(ctx context.Context, ref string) error {
+	s.mu.Lock()
+	w, ok := s.ingests[ref]
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.Wrapf(errdefs.ErrNotFound, "ingest %s", ref)
+	}
+	return w.Close()
+}
+
+// Writer stages content written by containerd in the ingest dir. Ingests
+// cannot be resumed once their writer is closed.
+func (s *contentStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	var wOpts content.WriterOpts
+	for _, opt := range opts {
+		if err := opt(&wOpts); err != nil {
+			return nil, err
+		}
+	}
+	if wOpts.Ref == "" {
+		return nil, errors.Wrap(errdefs.ErrInvalidArgument, "ref must not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.ingests[wOpts.Ref]; ok {
+		return nil, errors.Wrapf(errdefs.ErrUnavailable, "ref %s locked", wOpts.Ref)
+	}
+	f, err := os.CreateTemp(s.config.IngestDir, "kraken-ingest-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create ingest file")
+	}
+	now := time.Now()
+	w := &contentWriter{
+		store:     s,
+		ref:       wOpts.Ref,
+		f:         f,
+		digester:  digest.Canonical.Digester(),
+		total:     wOpts.Desc.Size,
+		startedAt: now,
+		updatedAt: now,
+	}
+	s.ingests[wOpts.Ref] = w
+	return w, nil
+}
+
+// contentWriter writes a blob into an ingest file, and imports it into the
+// cache on commit.
+type contentWriter struct {
+	store *contentStore
+	ref   string
+
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	f         *os.File
+	digester  digest.Digester
+	offset    int64
+	total     int64
+	startedAt time.Time
+	updatedAt time.Time
+}
+
+func (w *contentWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.f.Write(p)
+	w.digester.Hash().Write(p[:n])
+	w.offset += int64(n)
+	w.updatedAt = time.Now()
+	return n, err
+}
+
+func (w *contentWriter) Digest() digest.Digest {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.digester.Digest()
+}
+
+func (w *contentWriter) Status() (content.Status, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return content.Status{
+		Ref:       w.ref,
+		Offset:    w.offset,
+		Total:     w.total,
+		StartedAt: w.startedAt,
+		UpdatedAt: w.updatedAt,
+	}, nil
+}
+
+// Truncate only supports truncating to 0, i.e. restarting the ingest.
+func (w *contentWriter) Truncate(size int64) error {
+	if size != 0 {
+		return errors.Wrap(errdefs.ErrInvalidArgument, "truncate: unsupported size")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.digester = digest.Canonical.Digester()
+	w.offset = 0
+	w.updatedAt = time.Now()
+	return nil
+}
+
+func (w *contentWriter) Commit(
+	ctx context.Context, size int64, expected digest.Digest, opts ...content.Opt) error {
+
+	defer closers.Close(w)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if size > 0 && size != w.offset {
+		return errors.Wrapf(
+			errdefs.ErrFailedPrecondition, "unexpected commit size %d, expected %d", w.offset, size)
+	}
+	dgst := w.digester.Digest()
+	if expected != "" && expected != dgst {
+		return errors.Wrapf(
+			errdefs.ErrFailedPrecondition, "unexpected commit digest %s, expected %s", dgst, expected)
+	}
+	d, err := core.ParseSHA256Digest(dgst.String())
+	if err != nil {
+		return errors.Wrap(err, "parse digest")
+	}
+	if _, err := w.store.cads.Cache().GetFileStat(d.Hex()); err == nil {
+		return errors.Wrapf(errdefs.ErrAlreadyExists, "content %v", dgst)
+	}
+	if err := w.importToCache(d); err != nil {
+		return errors.Wrapf(err, "import %s", d)
+	}
+	return nil
+}
+
+// importToCache copies the ingest file into the cache through a download
+// file, so it is encrypted or compressed like any other blob.
+func (w *contentWriter) importToCache(d core.Digest) error {
+	cads := w.store.cads
+	if err := cads.CreateDownloadFile(d.Hex(), w.offset); err != nil {
+		if os.IsExist(err) {
+			return errors.Wrapf(errdefs.ErrAlreadyExists, "content %v", d)
+		}
+		return errors.Wrap(err, "create download file")
+	}
+	dst, err := cads.GetDownloadFileReadWriter(d.Hex())
+	if err != nil {
+		return errors.Wrap(err, "get download file")
+	}
+	defer closers.Close(dst)
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, w.f); err != nil {
+		return errors.Wrap(err, "copy")
+	}
+	if err := cads.MoveDownloadFileToCache(d.Hex()); err != nil && !os.IsExist(err) {
+		return errors.Wrap(err, "move download file to cache")
+	}
+	return nil
+}
+
+// Close removes the ingest. Containerd closes writers after committing them,
+// so Close may be called more than once.
+func (w *contentWriter) Close() (err error) {
+	w.closeOnce.Do(func() {
+		w.store.mu.Lock()
+		delete(w.store.ingests, w.ref)
+		w.store.mu.Unlock()
+
+		if rerr := os.Remove(w.f.Name()); rerr != nil && !os.IsNotExist(rerr) {
+			log.With("ref", w.ref).Errorf("Error removing ingest file: %s", rerr)
+		}
+		err = w.f.Close()
+	})
+	return err
+}
+
+func adaptContentInfo(info content.Info) filters.Adaptor {
+	return filters.AdapterFunc(func(fieldpath []string) (string, bool) {
+		if len(fieldpath) == 0 {
+			return "", false
+		}
+		switch fieldpath[0] {
+		case "digest":
+			return info.Digest.String(), true
+		case "size":
+			return strconv.FormatInt(info.Size, 10), true
+		}
+		return "", false
+	})
+}
+
+func adaptContentStatus(status content.Status) filters.Adaptor {
+	return filters.AdapterFunc(func(fieldpath []string) (string, bool) {
+		if len(fieldpath) == 0 {
+			return "", false
+		}
+		switch fieldpath[0] {
+		case "ref":
+			return status.Ref, true
+		}
+		return "", false
+	})
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+const _contentNamespace = "docker-images"
+
+func (m *serverMocks) newContentStore(t *testing.T) *contentStore {
+	return newContentStore(ContainerdConfig{
+		Enabled:   true,
+		Namespace: _contentNamespace,
+		IngestDir: t.TempDir(),
+	}, m.cads, m.sched)
+}
+
+func TestContentStoreInfoCached(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	cs := mocks.newContentStore(t)
+
+	info, err := cs.Info(context.Background(), digest.Digest(blob.Digest.String()))
+	require.NoError(err)
+	require.Equal(blob.Digest.String(), info.Digest.String())
+	require.Equal(int64(len(blob.Content)), info.Size)
+}
+
+func TestContentStoreInfoDownloadsBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	mocks.sched.EXPECT().Download(_contentNamespace, blob.Digest).DoAndReturn(
+		func(string, core.Digest) error {
+			return store.RunDownload(mocks.cads, blob.Digest, blob.Content)
+		})
+
+	cs := mocks.newContentStore(t)
+
+	info, err := cs.Info(context.Background(), digest.Digest(blob.Digest.String()))
+	require.NoError(err)
+	require.Equal(int64(len(blob.Content)), info.Size)
+}
+
+func TestContentStoreInfoNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	d := core.DigestFixture()
+
+	mocks.sched.EXPECT().Download(_contentNamespace, d).Return(scheduler.ErrTorrentNotFound)
+
+	cs := mocks.newContentStore(t)
+
+	_, err := cs.Info(context.Background(), digest.Digest(d.String()))
+	require.True(errdefs.IsNotFound(err))
+
+	_, err = cs.Info(context.Background(), digest.Digest("sha512:abc"))
+	require.True(errdefs.IsNotFound(err))
+}
+
+func TestContentStoreReaderAt(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	cs := mocks.newContentStore(t)
+
+	r, err := cs.ReaderAt(context.Background(), ocispec.Descriptor{
+		Digest: digest.Digest(blob.Digest.String()),
+		Size:   int64(len(blob.Content)),
+	})
+	require.NoError(err)
+	defer r.Close()
+	require.Equal(int64(len(blob.Content)), r.Size())
+	b, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+}
+
+func TestContentStoreWriterImportsIntoCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	dgst := digest.Digest(blob.Digest.String())
+
+	cs := mocks.newContentStore(t)
+	ctx := context.Background()
+
+	w, err := cs.Writer(ctx, content.WithRef("layer"), content.WithDescriptor(ocispec.Descriptor{
+		Size: int64(len(blob.Content)),
+	}))
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = cs.Writer(ctx, content.WithRef("layer"))
+	require.True(errdefs.IsUnavailable(err))
+
+	_, err = w.Write(blob.Content)
+	require.NoError(err)
+
+	status, err := cs.Status(ctx, "layer")
+	require.NoError(err)
+	require.Equal(int64(len(blob.Content)), status.Offset)
+	require.Equal(int64(len(blob.Content)), status.Total)
+
+	require.NoError(w.Commit(ctx, int64(len(blob.Content)), dgst))
+
+	_, err = cs.Status(ctx, "layer")
+	require.True(errdefs.IsNotFound(err))
+
+	info, err := cs.Info(ctx, dgst)
+	require.NoError(err)
+	require.Equal(int64(len(blob.Content)), info.Size)
+}
+
+func TestContentStoreWriterCommitDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	cs := mocks.newContentStore(t)
+	ctx := context.Background()
+
+	w, err := cs.Writer(ctx, content.WithRef("layer"))
+	require.NoError(err)
+	defer w.Close()
+
+	_, err = w.Write(core.NewBlobFixture().Content)
+	require.NoError(err)
+
+	err = w.Commit(ctx, 0, digest.Digest(core.DigestFixture().String()))
+	require.True(errdefs.IsFailedPrecondition(err))
+}
+
+func TestContentStoreDeleteIsNoop(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	cs := mocks.newContentStore(t)
+
+	require.NoError(cs.Delete(context.Background(), digest.Digest(blob.Digest.String())))
+
+	_, err := mocks.cads.Cache().GetFileStat(blob.Digest.Hex())
+	require.NoError(err)
+}
+
+func TestContentStoreWalk(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	var digests []string
+	for i := 0; i < 3; i++ {
+		blob := core.NewBlobFixture()
+		require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+		digests = append(digests, blob.Digest.String())
+	}
+
+	cs := mocks.newContentStore(t)
+
+	var walked []string
+	require.NoError(cs.Walk(context.Background(), func(info content.Info) error {
+		walked = append(walked, info.Digest.String())
+		return nil
+	}))
+	require.ElementsMatch(digests, walked)
+
+	walked = nil
+	require.NoError(cs.Walk(context.Background(), func(info content.Info) error {
+		walked = append(walked, info.Digest.String())
+		return nil
+	}, `digest=="`+digests[0]+`"`))
+	require.Equal(digests[:1], walked)
+}
+
+func TestGRPCServerContainerdRequiresNamespace(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	s := New(Config{GRPC: GRPCConfig{Containerd: ContainerdConfig{Enabled: true}}},
+		tally.NoopScope, mocks.cads, mocks.sched, mocks.tags, mocks.ac, mocks.mc, mocks.containerRuntime)
+	_, err := s.GRPCServer()
+	require.Error(t, err)
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/uber/kraken/core"
+	pb "github.com/uber/kraken/gen/go/proto/agent"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/log"
+
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	"github.com/containerd/containerd/services/content/contentserver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCConfig defines the gRPC API of the agent.
+type GRPCConfig struct {
+	// Net and Addr are the network and address the gRPC server listens on,
+	// e.g. "unix" and "/var/run/kraken/agent.sock". The gRPC server is
+	// disabled if Addr is empty.
+	Net  string `yaml:"net"`
+	Addr string `yaml:"addr"`
+
+	// ProgressInterval is how often Download streams the progress of a blob.
+	ProgressInterval time.Duration `yaml:"progress_interval"`
+
+	Containerd ContainerdConfig `yaml:"containerd"`
+}
+
+func (c GRPCConfig) applyDefaults() GRPCConfig {
+	if c.Net == "" {
+		c.Net = "unix"
+	}
+	if c.ProgressInterval == 0 {
+		c.ProgressInterval = time.Second
+	}
+	return c
+}
+
+// Listen listens on the address of the gRPC server, replacing any stale unix
+// socket left behind by a previous agent.
+func (c GRPCConfig) Listen() (net.Listener, error) {
+	c = c.applyDefaults()
+	if c.Net == "unix" {
+		if err := os.Remove(c.Addr); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("remove stale socket: %s", err)
+		}
+	}
+	return net.Listen(c.Net, c.Addr)
+}
+
+// grpcServer adapts Server to the Agent gRPC service.
+type grpcServer struct {
+	pb.UnimplementedAgentServer
+
+	config GRPCConfig
+	cads   *store.CADownloadStore
+	sched  scheduler.ReloadableScheduler
+}
+
+// GRPCServer returns a gRPC server serving the Agent service, and the
+// containerd content service if enabled.
+func (s *Server) GRPCServer() (*grpc.Server, error) {
+	config := s.config.GRPC.applyDefaults()
+	if config.Containerd.Enabled && config.Containerd.Namespace == "" {
+		return nil, errors.New("containerd content store requires a namespace")
+	}
+	gs := grpc.NewServer()
+	pb.RegisterAgentServer(gs, &grpcServer{
+		config: config,
+		cads:   s.cads,
+		sched:  s.sched,
+	})
+	if config.Containerd.Enabled {
+		cs := newContentStore(config.Containerd, s.cads, s.sched)
+		contentapi.RegisterContentServer(gs, contentserver.New(cs))
+	}
+	return gs, nil
+}
+
+func parseGRPCDigest(raw string) (core.Digest, error) {
+	d, err := core.ParseSHA256Digest(raw)
+	if err != nil {
+		return core.Digest{}, status.Errorf(codes.InvalidArgument, "parse digest: %s", err)
+	}
+	return d, nil
+}
+
+// toDownloadStatus converts scheduler download errors into gRPC statuses.
+func toDownloadStatus(err error) error {
+	switch err {
+	case scheduler.ErrTorrentNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case scheduler.ErrDownloadQueueFull:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case scheduler.ErrSchedulerStopped:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Errorf(codes.Internal, "download torrent: %s", err)
+}
+
+// cachePath returns the path of cached blob name, or an empty path if the
+// cache is encrypted at rest.
+func (s *grpcServer) cachePath(name string) (string, error) {
+	path, err := s.cads.Cache().GetFilePath(name)
+	if err == store.ErrFileEncrypted {
+		return "", nil
+	}
+	return path, err
+}
+
+// progress returns the progress of a blob being downloaded. Returns false if
+// the download file does not exist yet, e.g. while its metainfo is fetched.
+func (s *grpcServer) progress(name string) (*pb.DownloadResponse, bool) {
+	info, err := s.cads.Download().GetFileStat(name)
+	if err != nil {
+		return nil, false
+	}
+	downloaded, err := s.cads.Download().GetFileAllocatedBytes(name)
+	if err != nil {
+		return nil, false
+	}
+	if downloaded > info.Size() {
+		// Allocation is rounded up to whole blocks.
+		downloaded = info.Size()
+	}
+	return &pb.DownloadResponse{DownloadedBytes: downloaded, TotalBytes: info.Size()}, true
+}
+
+// download downloads d, streaming its progress until the download completes
+// or the call ends. The download is not tied to the call, so it keeps going
+// if the deadline of the call is exceeded, and a retry picks it up.
+func (s *grpcServer) download(
+	stream pb.Agent_DownloadServer, namespace string, d core.Digest, p scheduler.Priority) error {
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.sched.DownloadWithPriority(namespace, d, p)
+	}()
+	ticker := time.NewTicker(s.config.ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return toDownloadStatus(err)
+			}
+			return nil
+		case <-ticker.C:
+			if resp, ok := s.progress(d.Hex()); ok {
+				if err := stream.Send(resp); err != nil {
+					return err
+				}
+			}
+		case <-stream.Context().Done():
+			err := stream.Context().Err()
+			log.With("digest", d).Infof("gRPC download call ended before download: %s", err)
+			return status.FromContextError(err).Err()
+		}
+	}
+}
+
+func (s *grpcServer) Download(req *pb.DownloadRequest, stream pb.Agent_DownloadServer) error {
+	if req.Namespace == "" {
+		return status.Error(codes.InvalidArgument, "namespace is required")
+	}
+	d, err := parseGRPCDigest(req.Digest)
+	if err != nil {
+		return err
+	}
+	priority := scheduler.PriorityInteractive
+	if req.Priority != "" {
+		priority, err = scheduler.ParsePriority(req.Priority)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "parse priority: %s", err)
+		}
+	}
+	if _, err := s.cads.Cache().GetFileStat(d.Hex()); err != nil {
+		if !os.IsNotExist(err) && !s.cads.InDownloadError(err) {
+			return status.Errorf(codes.Internal, "store: %s", err)
+		}
+		if err := s.download(stream, req.Namespace, d, priority); err != nil {
+			return err
+		}
+	}
+
+	info, err := s.cads.Cache().GetFileStat(d.Hex())
+	if err != nil {
+		return status.Errorf(codes.Internal, "store: %s", err)
+	}
+	path, err := s.cachePath(d.Hex())
+	if err != nil {
+		return status.Errorf(codes.Internal, "store: %s", err)
+	}
+	return stream.Send(&pb.DownloadResponse{
+		DownloadedBytes: info.Size(),
+		TotalBytes:      info.Size(),
+		Path:            path,
+	})
+}
+
+func (s *grpcServer) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatResponse, error) {
+	d, err := parseGRPCDigest(req.Digest)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.cads.Cache().GetFileStat(d.Hex())
+	if err != nil {
+		if os.IsNotExist(err) || s.cads.InDownloadError(err) {
+			return nil, status.Error(codes.NotFound, "blob not in cache")
+		}
+		return nil, status.Errorf(codes.Internal, "store: %s", err)
+	}
+	path, err := s.cachePath(d.Hex())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "store: %s", err)
+	}
+	return &pb.StatResponse{Size: info.Size(), Path: path}, nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	d, err := parseGRPCDigest(req.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sched.RemoveTorrent(d); err != nil {
+		return nil, status.Errorf(codes.Internal, "remove torrent: %s", err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *grpcServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	names, err := s.cads.Cache().ListNames()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "store: %s", err)
+	}
+	resp := &pb.ListResponse{}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		d, err := core.NewSHA256DigestFromHex(name)
+		if err != nil {
+			continue
+		}
+		info, err := s.cads.Cache().GetFileStat(name)
+		if err != nil {
+			// Blob was deleted or evicted since listing.
+			continue
+		}
+		resp.Blobs = append(resp.Blobs, &pb.BlobInfo{Digest: d.String(), Size: info.Size()})
+	}
+	return resp, nil
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	pb "github.com/uber/kraken/gen/go/proto/agent"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (m *serverMocks) startGRPCServer(t *testing.T, c Config) pb.AgentClient {
+	dir, err := os.MkdirTemp("", "agentserver_test")
+	require.NoError(t, err)
+	m.cleanup.Add(func() { os.RemoveAll(dir) })
+
+	c.GRPC.Addr = filepath.Join(dir, "agent.sock")
+	l, err := c.GRPC.Listen()
+	require.NoError(t, err)
+	s := New(c, tally.NoopScope, m.cads, m.sched, m.tags, m.ac, m.mc, m.containerRuntime)
+	gs, err := s.GRPCServer()
+	require.NoError(t, err)
+	go gs.Serve(l) //nolint:errcheck
+	m.cleanup.Add(gs.Stop)
+
+	conn, err := grpc.Dial("unix://"+c.GRPC.Addr, grpc.WithInsecure())
+	require.NoError(t, err)
+	m.cleanup.Add(func() { conn.Close() })
+	return pb.NewAgentClient(conn)
+}
+
+// recvAll receives messages from stream until it ends.
+func recvAll(stream pb.Agent_DownloadClient) ([]*pb.DownloadResponse, error) {
+	var resps []*pb.DownloadResponse
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return resps, nil
+		}
+		if err != nil {
+			return resps, err
+		}
+		resps = append(resps, resp)
+	}
+}
+
+func requireCachedPath(t *testing.T, resp *pb.DownloadResponse, content []byte) {
+	require.Equal(t, int64(len(content)), resp.DownloadedBytes)
+	require.Equal(t, int64(len(content)), resp.TotalBytes)
+	b, err := os.ReadFile(resp.Path)
+	require.NoError(t, err)
+	require.Equal(t, content, b)
+}
+
+func TestGRPCDownload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	mocks.sched.EXPECT().
+		DownloadWithPriority(namespace, blob.Digest, scheduler.PriorityInteractive).
+		DoAndReturn(func(string, core.Digest, scheduler.Priority) error {
+			return store.RunDownload(mocks.cads, blob.Digest, blob.Content)
+		})
+
+	c := mocks.startGRPCServer(t, Config{})
+
+	stream, err := c.Download(context.Background(), &pb.DownloadRequest{
+		Namespace: namespace,
+		Digest:    blob.Digest.String(),
+	})
+	require.NoError(err)
+	resps, err := recvAll(stream)
+	require.NoError(err)
+	require.NotEmpty(resps)
+	requireCachedPath(t, resps[len(resps)-1], blob.Content)
+}
+
+func TestGRPCDownloadCached(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	c := mocks.startGRPCServer(t, Config{})
+
+	stream, err := c.Download(context.Background(), &pb.DownloadRequest{
+		Namespace: namespace,
+		Digest:    blob.Digest.String(),
+	})
+	require.NoError(err)
+	resps, err := recvAll(stream)
+	require.NoError(err)
+	require.Len(resps, 1)
+	requireCachedPath(t, resps[0], blob.Content)
+}
+
+func TestGRPCDownloadStreamsProgress(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(1<<20, 1<<10)
+	release := make(chan struct{})
+
+	mocks.sched.EXPECT().
+		DownloadWithPriority(namespace, blob.Digest, scheduler.PriorityPreheat).
+		DoAndReturn(func(string, core.Digest, scheduler.Priority) error {
+			if err := mocks.cads.CreateDownloadFile(blob.Digest.Hex(), int64(len(blob.Content))); err != nil {
+				return err
+			}
+			<-release
+			w, err := mocks.cads.GetDownloadFileReadWriter(blob.Digest.Hex())
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(blob.Content); err != nil {
+				return err
+			}
+			w.Close()
+			return mocks.cads.MoveDownloadFileToCache(blob.Digest.Hex())
+		})
+
+	c := mocks.startGRPCServer(t, Config{GRPC: GRPCConfig{ProgressInterval: 10 * time.Millisecond}})
+
+	stream, err := c.Download(context.Background(), &pb.DownloadRequest{
+		Namespace: namespace,
+		Digest:    blob.Digest.String(),
+		Priority:  "preheat",
+	})
+	require.NoError(err)
+
+	progress, err := stream.Recv()
+	require.NoError(err)
+	require.Equal(int64(len(blob.Content)), progress.TotalBytes)
+	require.True(progress.DownloadedBytes < progress.TotalBytes)
+	require.Empty(progress.Path)
+
+	close(release)
+
+	resps, err := recvAll(stream)
+	require.NoError(err)
+	require.NotEmpty(resps)
+	requireCachedPath(t, resps[len(resps)-1], blob.Content)
+}
+
+func TestGRPCDownloadErrors(t *testing.T) {
+	d := core.DigestFixture()
+
+	tests := []struct {
+		desc     string
+		req      *pb.DownloadRequest
+		schedErr error
+		code     codes.Code
+	}{
+		{"missing namespace", &pb.DownloadRequest{Digest: d.String()}, nil, codes.InvalidArgument},
+		{"invalid digest", &pb.DownloadRequest{Namespace: "ns", Digest: "foo"}, nil, codes.InvalidArgument},
+		{
+			"invalid priority",
+			&pb.DownloadRequest{Namespace: "ns", Digest: d.String(), Priority: "urgent"},
+			nil,
+			codes.InvalidArgument,
+		},
+		{
+			"not found",
+			&pb.DownloadRequest{Namespace: "ns", Digest: d.String()},
+			scheduler.ErrTorrentNotFound,
+			codes.NotFound,
+		},
+		{
+			"queue full",
+			&pb.DownloadRequest{Namespace: "ns", Digest: d.String()},
+			scheduler.ErrDownloadQueueFull,
+			codes.ResourceExhausted,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			if test.schedErr != nil {
+				mocks.sched.EXPECT().
+					DownloadWithPriority(test.req.Namespace, d, scheduler.PriorityInteractive).
+					Return(test.schedErr)
+			}
+
+			c := mocks.startGRPCServer(t, Config{})
+
+			stream, err := c.Download(context.Background(), test.req)
+			require.NoError(err)
+			_, err = recvAll(stream)
+			require.Equal(test.code, status.Code(err))
+		})
+	}
+}
+
+func TestGRPCDownloadDeadlineExceeded(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+	release := make(chan struct{})
+	defer close(release)
+
+	mocks.sched.EXPECT().
+		DownloadWithPriority(namespace, d, scheduler.PriorityInteractive).
+		DoAndReturn(func(string, core.Digest, scheduler.Priority) error {
+			<-release
+			return nil
+		})
+
+	c := mocks.startGRPCServer(t, Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stream, err := c.Download(ctx, &pb.DownloadRequest{Namespace: namespace, Digest: d.String()})
+	require.NoError(err)
+	_, err = recvAll(stream)
+	require.Equal(codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestGRPCStat(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	c := mocks.startGRPCServer(t, Config{})
+
+	resp, err := c.Stat(context.Background(), &pb.StatRequest{Digest: blob.Digest.String()})
+	require.NoError(err)
+	require.Equal(int64(len(blob.Content)), resp.Size)
+	b, err := os.ReadFile(resp.Path)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+
+	_, err = c.Stat(context.Background(), &pb.StatRequest{Digest: core.DigestFixture().String()})
+	require.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestGRPCDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	d := core.DigestFixture()
+
+	mocks.sched.EXPECT().RemoveTorrent(d).Return(nil)
+
+	c := mocks.startGRPCServer(t, Config{})
+
+	_, err := c.Delete(context.Background(), &pb.DeleteRequest{Digest: d.String()})
+	require.NoError(err)
+}
+
+func TestGRPCList(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	var expected []*pb.BlobInfo
+	for i := 0; i < 3; i++ {
+		blob := core.NewBlobFixture()
+		require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+		expected = append(expected, &pb.BlobInfo{
+			Digest: blob.Digest.String(),
+			Size:   int64(len(blob.Content)),
+		})
+	}
+	// Blobs still downloading are not listed.
+	require.NoError(mocks.cads.CreateDownloadFile(core.DigestFixture().Hex(), 1))
+
+	c := mocks.startGRPCServer(t, Config{})
+
+	resp, err := c.List(context.Background(), &pb.ListRequest{})
+	require.NoError(err)
+	require.Len(resp.Blobs, len(expected))
+	for _, info := range expected {
+		var found bool
+		for _, b := range resp.Blobs {
+			found = found || (b.Digest == info.Digest && b.Size == info.Size)
+		}
+		require.True(found, "blob %s not listed", info.Digest)
+	}
+}
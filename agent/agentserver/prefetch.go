@@ -0,0 +1,274 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/uber/kraken/agent/agentmodels"
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// PrefetchConfig defines prefetching of images into the cache of the agent.
+type PrefetchConfig struct {
+	// Concurrency is how many blobs of an image are downloaded at once.
+	Concurrency int `yaml:"concurrency"`
+
+	// Retention is how long the statuses of finished prefetches are kept.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func (c PrefetchConfig) applyDefaults() PrefetchConfig {
+	if c.Concurrency == 0 {
+		c.Concurrency = 4
+	}
+	if c.Retention == 0 {
+		c.Retention = time.Hour
+	}
+	return c
+}
+
+// prefetcher downloads the blobs of images in the background and tracks their
+// progress by image.
+type prefetcher struct {
+	config   PrefetchConfig
+	clk      clock.Clock
+	cads     *store.CADownloadStore
+	sched    scheduler.ReloadableScheduler
+	platform dockerutil.Platform
+
+	mu         sync.Mutex
+	prefetches map[string]*agentmodels.PrefetchStatus
+}
+
+func newPrefetcher(
+	config PrefetchConfig,
+	clk clock.Clock,
+	cads *store.CADownloadStore,
+	sched scheduler.ReloadableScheduler) *prefetcher {
+
+	return &prefetcher{
+		config:     config.applyDefaults(),
+		clk:        clk,
+		cads:       cads,
+		sched:      sched,
+		platform:   dockerutil.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH},
+		prefetches: make(map[string]*agentmodels.PrefetchStatus),
+	}
+}
+
+// start starts prefetching manifest d of image from namespace repo, unless a
+// prefetch of image is already running. Returns the status of the prefetch.
+func (p *prefetcher) start(
+	image, repo string, d core.Digest, platform dockerutil.Platform) agentmodels.PrefetchStatus {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clk.Now()
+	for k, status := range p.prefetches {
+		if status.State != agentmodels.PrefetchRunning && now.Sub(status.FinishedAt) > p.config.Retention {
+			delete(p.prefetches, k)
+		}
+	}
+	if status, ok := p.prefetches[image]; ok && status.State == agentmodels.PrefetchRunning {
+		return *status
+	}
+	status := &agentmodels.PrefetchStatus{
+		Image:     image,
+		Platform:  platform.String(),
+		Digest:    d,
+		State:     agentmodels.PrefetchRunning,
+		StartedAt: now,
+	}
+	p.prefetches[image] = status
+	go p.run(status, repo, platform)
+	return *status
+}
+
+// get returns the status of the last prefetch of image.
+func (p *prefetcher) get(image string) (agentmodels.PrefetchStatus, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status, ok := p.prefetches[image]
+	if !ok {
+		return agentmodels.PrefetchStatus{}, false
+	}
+	return *status, true
+}
+
+func (p *prefetcher) run(status *agentmodels.PrefetchStatus, repo string, platform dockerutil.Platform) {
+	err := p.prefetch(status, repo, platform)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status.FinishedAt = p.clk.Now()
+	if err != nil {
+		log.With("image", status.Image).Errorf("Error prefetching image: %s", err)
+		status.State = agentmodels.PrefetchFailed
+		status.Error = err.Error()
+		return
+	}
+	status.State = agentmodels.PrefetchDone
+}
+
+func (p *prefetcher) prefetch(status *agentmodels.PrefetchStatus, repo string, platform dockerutil.Platform) error {
+	m, err := p.manifest(repo, status.Digest, platform)
+	if err != nil {
+		return err
+	}
+	refs := m.References()
+
+	p.mu.Lock()
+	status.Blobs = len(refs)
+	for _, desc := range refs {
+		status.Bytes += desc.Size
+	}
+	p.mu.Unlock()
+
+	var g errgroup.Group
+	g.SetLimit(p.config.Concurrency)
+	for _, desc := range refs {
+		desc := desc
+		g.Go(func() error {
+			d, err := core.ParseSHA256Digest(string(desc.Digest))
+			if err != nil {
+				return fmt.Errorf("parse digest: %s", err)
+			}
+			if err := p.download(repo, d); err != nil {
+				return fmt.Errorf("download %s: %s", d, err)
+			}
+			p.mu.Lock()
+			status.DownloadedBlobs++
+			status.DownloadedBytes += desc.Size
+			p.mu.Unlock()
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// manifest downloads and parses manifest d, resolving manifest lists to the
+// manifest of platform.
+func (p *prefetcher) manifest(
+	repo string, d core.Digest, platform dockerutil.Platform) (distribution.Manifest, error) {
+
+	if err := p.download(repo, d); err != nil {
+		return nil, fmt.Errorf("download manifest: %s", err)
+	}
+	f, err := p.cads.Cache().GetFileReader(d.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("store: %s", err)
+	}
+	defer closers.Close(f)
+	m, _, err := dockerutil.ParseManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse manifest: %s", err)
+	}
+	list, ok := m.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		return m, nil
+	}
+	for _, desc := range list.Manifests {
+		if platform.Match(desc.Platform) {
+			child, err := core.ParseSHA256Digest(string(desc.Digest))
+			if err != nil {
+				return nil, fmt.Errorf("parse digest: %s", err)
+			}
+			return p.manifest(repo, child, platform)
+		}
+	}
+	return nil, fmt.Errorf("no manifest for platform %s", platform)
+}
+
+// download downloads blob d into the cache, unless it is already cached.
+func (p *prefetcher) download(namespace string, d core.Digest) error {
+	if _, err := p.cads.Cache().GetFileStat(d.Hex()); err == nil {
+		return nil
+	}
+	return p.sched.DownloadWithPriority(namespace, d, scheduler.PriorityPreheat)
+}
+
+// prefetchHandler starts downloading the blobs of an image into the cache, so
+// the image can later be pulled without waiting on downloads. Progress can be
+// polled with getPrefetchHandler.
+func (s *Server) prefetchHandler(w http.ResponseWriter, r *http.Request) error {
+	var req agentmodels.PrefetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("json decode: %s", err).Status(http.StatusBadRequest)
+	}
+	i := strings.LastIndex(req.Image, ":")
+	if i <= 0 || i == len(req.Image)-1 || strings.Contains(req.Image[i+1:], "/") {
+		return handler.Errorf("expected image repo:tag, got %q", req.Image).Status(http.StatusBadRequest)
+	}
+	repo := req.Image[:i]
+	platform := s.prefetcher.platform
+	if req.Platform != "" {
+		var err error
+		platform, err = dockerutil.ParsePlatform(req.Platform)
+		if err != nil {
+			return handler.Errorf("parse platform: %s", err).Status(http.StatusBadRequest)
+		}
+	}
+	d, err := s.tags.Get(req.Image)
+	if err != nil {
+		if err == tagclient.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("get tag: %s", err)
+	}
+	status := s.prefetcher.start(req.Image, repo, d, platform)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		return fmt.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// getPrefetchHandler returns the status of the last prefetch of an image.
+func (s *Server) getPrefetchHandler(w http.ResponseWriter, r *http.Request) error {
+	image, err := httputil.ParseParam(r, "image")
+	if err != nil {
+		return err
+	}
+	status, ok := s.prefetcher.get(image)
+	if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		return fmt.Errorf("json encode: %s", err)
+	}
+	return nil
+}
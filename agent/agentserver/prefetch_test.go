@@ -0,0 +1,222 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/agent/agentclient"
+	"github.com/uber/kraken/agent/agentmodels"
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// expectDownloads makes the scheduler download blobs into the cache.
+func (m *serverMocks) expectDownloads(namespace string, blobs map[core.Digest][]byte) {
+	for d, content := range blobs {
+		d, content := d, content
+		m.sched.EXPECT().
+			DownloadWithPriority(namespace, d, scheduler.PriorityPreheat).
+			DoAndReturn(func(string, core.Digest, scheduler.Priority) error {
+				return store.RunDownload(m.cads, d, content)
+			})
+	}
+}
+
+// imageFixture returns the manifest and the config and layers of an image.
+func imageFixture() (core.Digest, map[core.Digest][]byte) {
+	blobs := make(map[core.Digest][]byte)
+	var digests core.DigestList
+	for i := 0; i < 3; i++ {
+		blob := core.NewBlobFixture()
+		blobs[blob.Digest] = blob.Content
+		digests = append(digests, blob.Digest)
+	}
+	manifest, raw := dockerutil.ManifestFixture(digests[0], digests[1], digests[2])
+	blobs[manifest] = raw
+	return manifest, blobs
+}
+
+func waitForPrefetch(t *testing.T, c *agentclient.HTTPClient, image string) *agentmodels.PrefetchStatus {
+	var status *agentmodels.PrefetchStatus
+	require.Eventually(t, func() bool {
+		var err error
+		status, err = c.GetPrefetch(image)
+		require.NoError(t, err)
+		return status.State != agentmodels.PrefetchRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	return status
+}
+
+func TestPrefetch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	image := "repo/image:v1"
+	manifest, blobs := imageFixture()
+
+	mocks.tags.EXPECT().Get(image).Return(manifest, nil)
+	mocks.expectDownloads("repo/image", blobs)
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	status, err := c.Prefetch(agentmodels.PrefetchRequest{Image: image})
+	require.NoError(err)
+	require.Equal(image, status.Image)
+	require.Equal(manifest, status.Digest)
+
+	status = waitForPrefetch(t, c, image)
+	require.Equal(agentmodels.PrefetchDone, status.State)
+	require.Equal(3, status.Blobs)
+	require.Equal(3, status.DownloadedBlobs)
+	require.Equal(status.Bytes, status.DownloadedBytes)
+	require.NotZero(status.Bytes)
+
+	for d := range blobs {
+		_, err := mocks.cads.Cache().GetFileStat(d.Hex())
+		require.NoError(err)
+	}
+}
+
+func TestPrefetchSkipsCachedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	image := "repo/image:v1"
+	manifest, blobs := imageFixture()
+	for d, content := range blobs {
+		require.NoError(store.RunDownload(mocks.cads, d, content))
+	}
+
+	mocks.tags.EXPECT().Get(image).Return(manifest, nil)
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	_, err := c.Prefetch(agentmodels.PrefetchRequest{Image: image})
+	require.NoError(err)
+	require.Equal(agentmodels.PrefetchDone, waitForPrefetch(t, c, image).State)
+}
+
+func TestPrefetchManifestList(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	image := "repo/image:v1"
+	amd64, _ := imageFixture()
+	arm64, blobs := imageFixture()
+	list, raw := dockerutil.ManifestListFixture(
+		[]string{"linux/amd64", "linux/arm64/v8"}, core.DigestList{amd64, arm64})
+	blobs[list] = raw
+
+	mocks.tags.EXPECT().Get(image).Return(list, nil)
+	mocks.expectDownloads("repo/image", blobs)
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	status, err := c.Prefetch(agentmodels.PrefetchRequest{Image: image, Platform: "linux/arm64"})
+	require.NoError(err)
+	require.Equal("linux/arm64", status.Platform)
+
+	status = waitForPrefetch(t, c, image)
+	require.Equal(agentmodels.PrefetchDone, status.State)
+	require.Equal(3, status.DownloadedBlobs)
+}
+
+func TestPrefetchDownloadError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	image := "repo/image:v1"
+	manifest, blobs := imageFixture()
+
+	mocks.tags.EXPECT().Get(image).Return(manifest, nil)
+	mocks.expectDownloads("repo/image", map[core.Digest][]byte{manifest: blobs[manifest]})
+	mocks.sched.EXPECT().
+		DownloadWithPriority("repo/image", gomock.Any(), scheduler.PriorityPreheat).
+		Return(errors.New("some error")).
+		Times(3)
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	_, err := c.Prefetch(agentmodels.PrefetchRequest{Image: image})
+	require.NoError(err)
+
+	status := waitForPrefetch(t, c, image)
+	require.Equal(agentmodels.PrefetchFailed, status.State)
+	require.Contains(status.Error, "some error")
+	require.Equal(0, status.DownloadedBlobs)
+}
+
+func TestPrefetchTagNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.tags.EXPECT().Get("repo/image:v1").Return(core.Digest{}, tagclient.ErrTagNotFound)
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	_, err := c.Prefetch(agentmodels.PrefetchRequest{Image: "repo/image:v1"})
+	require.Equal(agentclient.ErrTagNotFound, err)
+
+	_, err = c.GetPrefetch("repo/image:v1")
+	require.Equal(agentclient.ErrPrefetchNotFound, err)
+}
+
+func TestPrefetchBadRequest(t *testing.T) {
+	for _, req := range []agentmodels.PrefetchRequest{
+		{Image: "repo/image"},
+		{Image: "repo/image:"},
+		{Image: "registry:5000/repo/image"},
+		{Image: "repo/image:v1", Platform: "linux"},
+	} {
+		t.Run(fmt.Sprintf("%+v", req), func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			_, addr := mocks.startServer(Config{})
+			c := agentclient.New(addr)
+
+			_, err := c.Prefetch(req)
+			require.True(httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
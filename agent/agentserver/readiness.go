@@ -0,0 +1,220 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/utils/log"
+)
+
+// DeepReadinessConfig defines deep readiness checks, which validate the pull
+// path of the agent end to end instead of only checking that its dependencies
+// are up.
+type DeepReadinessConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Timeout is how long readiness checks wait for deep checks. Deep checks
+	// still running after Timeout fail readiness, and are not started again
+	// until they finish.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// CacheTTL is how long results of deep checks are reused for, successful
+	// or not, so frequent readiness probes do not load trackers and origins.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// ProbeNamespace and ProbeDigest identify a small blob whose metainfo is
+	// fetched from origins through trackers. Origins are not checked if unset.
+	ProbeNamespace string `yaml:"probe_namespace"`
+	ProbeDigest    string `yaml:"probe_digest"`
+}
+
+func (c DeepReadinessConfig) applyDefaults() DeepReadinessConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.CacheTTL == 0 {
+		c.CacheTTL = 30 * time.Second
+	}
+	return c
+}
+
+// _storeProbeData is written to the download dir to check it is writable.
+var _storeProbeData = []byte("kraken readiness probe")
+
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+// deepReadiness runs deep readiness checks in the background, at most one
+// round at a time, and caches their results.
+type deepReadiness struct {
+	config DeepReadinessConfig
+	clk    clock.Clock
+	checks []readinessCheck
+
+	mu        sync.Mutex // Protects the following fields:
+	result    error
+	checkedAt time.Time
+	pending   map[string]bool
+	done      chan struct{} // Closed when the running round finishes, nil if idle.
+}
+
+func newDeepReadiness(
+	config DeepReadinessConfig,
+	clk clock.Clock,
+	cads *store.CADownloadStore,
+	ac announceclient.Client,
+	mc metainfoclient.Client) *deepReadiness {
+
+	config = config.applyDefaults()
+
+	r := &deepReadiness{config: config, clk: clk}
+	r.checks = append(r.checks,
+		readinessCheck{"tracker", func() error { return checkAnnounce(ac) }},
+		readinessCheck{"store", func() error { return checkStore(cads) }})
+	if config.ProbeDigest != "" {
+		r.checks = append(r.checks, readinessCheck{"origin", func() error {
+			return checkOrigin(mc, config.ProbeNamespace, config.ProbeDigest)
+		}})
+	}
+	return r
+}
+
+// check returns the result of the last round of checks if it is still cached,
+// otherwise it waits for a new round up to the configured timeout.
+func (r *deepReadiness) check() error {
+	r.mu.Lock()
+	if !r.checkedAt.IsZero() && r.clk.Now().Sub(r.checkedAt) < r.config.CacheTTL {
+		defer r.mu.Unlock()
+		return r.result
+	}
+	if r.done == nil {
+		r.done = make(chan struct{})
+		r.pending = make(map[string]bool)
+		for _, c := range r.checks {
+			r.pending[c.name] = true
+		}
+		go r.run(r.done)
+	}
+	done := r.done
+	r.mu.Unlock()
+
+	select {
+	case <-done:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.result
+	case <-r.clk.After(r.config.Timeout):
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		var names []string
+		for name := range r.pending {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("deep checks timed out: %s", strings.Join(names, ", "))
+	}
+}
+
+func (r *deepReadiness) run(done chan struct{}) {
+	errs := make([]error, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			if err := c.check(); err != nil {
+				errs[i] = fmt.Errorf("%s: %s", c.name, err)
+			}
+			r.mu.Lock()
+			delete(r.pending, c.name)
+			r.mu.Unlock()
+		}(i, c)
+	}
+	wg.Wait()
+
+	result := errors.Join(errs...)
+	if result != nil {
+		log.Errorf("Deep readiness checks failed: %s", result)
+	}
+
+	r.mu.Lock()
+	r.result = result
+	r.checkedAt = r.clk.Now()
+	r.done = nil
+	r.mu.Unlock()
+	close(done)
+}
+
+// checkAnnounce announces a torrent which does not exist to the tracker
+// responsible for it. The announce expires from the tracker like any other.
+func checkAnnounce(ac announceclient.Client) error {
+	h := core.NewInfoHashFromBytes([]byte(backend.ReadinessCheckName))
+	_, _, err := ac.Announce(
+		backend.ReadinessCheckNamespace, backend.ReadinessCheckDigest, h, false, announceclient.V2)
+	if err != nil {
+		return fmt.Errorf("announce: %s", err)
+	}
+	return nil
+}
+
+// checkStore writes a file to the download dir of cads and deletes it.
+func checkStore(cads *store.CADownloadStore) error {
+	name := backend.ReadinessCheckName
+	if err := cads.CreateDownloadFile(name, int64(len(_storeProbeData))); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("create download file: %s", err)
+	}
+	defer func() {
+		if err := cads.Download().DeleteFile(name); err != nil {
+			log.Errorf("Error deleting readiness probe file: %s", err)
+		}
+	}()
+	f, err := cads.GetDownloadFileReadWriter(name)
+	if err != nil {
+		return fmt.Errorf("get download file: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(_storeProbeData, 0); err != nil {
+		return fmt.Errorf("write download file: %s", err)
+	}
+	return nil
+}
+
+// checkOrigin fetches the metainfo of the probe blob, which trackers get from
+// origins.
+func checkOrigin(mc metainfoclient.Client, namespace, digest string) error {
+	d, err := core.ParseSHA256Digest(digest)
+	if err != nil {
+		return fmt.Errorf("parse probe digest: %s", err)
+	}
+	if _, err := mc.Download(namespace, d); err != nil {
+		return fmt.Errorf("download metainfo: %s", err)
+	}
+	return nil
+}
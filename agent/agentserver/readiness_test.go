@@ -0,0 +1,138 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/store"
+	mockannounceclient "github.com/uber/kraken/mocks/tracker/announceclient"
+	mockmetainfoclient "github.com/uber/kraken/mocks/tracker/metainfoclient"
+)
+
+type deepReadinessMocks struct {
+	clk  *clock.Mock
+	cads *store.CADownloadStore
+	ac   *mockannounceclient.MockClient
+	mc   *mockmetainfoclient.MockClient
+}
+
+func newDeepReadinessMocks(t *testing.T) *deepReadinessMocks {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	t.Cleanup(cleanup)
+
+	return &deepReadinessMocks{
+		clk:  clock.NewMock(),
+		cads: cads,
+		ac:   mockannounceclient.NewMockClient(ctrl),
+		mc:   mockmetainfoclient.NewMockClient(ctrl),
+	}
+}
+
+func (m *deepReadinessMocks) new(config DeepReadinessConfig) *deepReadiness {
+	return newDeepReadiness(config, m.clk, m.cads, m.ac, m.mc)
+}
+
+func TestDeepReadinessSuccess(t *testing.T) {
+	require := require.New(t)
+
+	mocks := newDeepReadinessMocks(t)
+	probe := core.DigestFixture()
+	r := mocks.new(DeepReadinessConfig{ProbeNamespace: "probe-ns", ProbeDigest: probe.String()})
+
+	mocks.ac.EXPECT().
+		Announce(gomock.Any(), gomock.Any(), gomock.Any(), false, gomock.Any()).
+		Return(nil, time.Second, nil)
+	mocks.mc.EXPECT().Download("probe-ns", probe).Return(core.MetaInfoFixture(), nil)
+
+	require.NoError(r.check())
+
+	// The probe file is deleted.
+	_, err := mocks.cads.Any().GetFileStat(backend.ReadinessCheckName)
+	require.Error(err)
+}
+
+func TestDeepReadinessSkipsOriginWithoutProbe(t *testing.T) {
+	require := require.New(t)
+
+	mocks := newDeepReadinessMocks(t)
+	r := mocks.new(DeepReadinessConfig{})
+
+	mocks.ac.EXPECT().
+		Announce(gomock.Any(), gomock.Any(), gomock.Any(), false, gomock.Any()).
+		Return(nil, time.Second, nil)
+
+	require.NoError(r.check())
+}
+
+func TestDeepReadinessCachesResults(t *testing.T) {
+	require := require.New(t)
+
+	mocks := newDeepReadinessMocks(t)
+	r := mocks.new(DeepReadinessConfig{CacheTTL: time.Minute})
+
+	gomock.InOrder(
+		mocks.ac.EXPECT().
+			Announce(gomock.Any(), gomock.Any(), gomock.Any(), false, gomock.Any()).
+			Return(nil, time.Duration(0), errors.New("some error")).Call,
+		mocks.ac.EXPECT().
+			Announce(gomock.Any(), gomock.Any(), gomock.Any(), false, gomock.Any()).
+			Return(nil, time.Second, nil).Call,
+	)
+
+	require.EqualError(r.check(), "tracker: announce: some error")
+
+	// Failures are cached too.
+	mocks.clk.Add(30 * time.Second)
+	require.EqualError(r.check(), "tracker: announce: some error")
+
+	mocks.clk.Add(31 * time.Second)
+	require.NoError(r.check())
+}
+
+func TestDeepReadinessTimeout(t *testing.T) {
+	require := require.New(t)
+
+	mocks := newDeepReadinessMocks(t)
+	r := mocks.new(DeepReadinessConfig{Timeout: 100 * time.Millisecond})
+	r.clk = clock.New()
+
+	unblock := make(chan struct{})
+	mocks.ac.EXPECT().
+		Announce(gomock.Any(), gomock.Any(), gomock.Any(), false, gomock.Any()).
+		DoAndReturn(func(string, core.Digest, core.InfoHash, bool, int) ([]*core.PeerInfo, time.Duration, error) {
+			<-unblock
+			return nil, time.Second, nil
+		}).
+		Times(1)
+
+	require.EqualError(r.check(), "deep checks timed out: tracker")
+
+	// Checks are not started again while the announce is still running.
+	errc := make(chan error)
+	go func() { errc <- r.check() }()
+	close(unblock)
+	require.NoError(<-errc)
+}
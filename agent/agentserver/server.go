@@ -31,11 +31,14 @@ import (
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/metainfoclient"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/go-chi/chi"
 	"github.com/uber-go/tally"
 )
@@ -44,6 +47,12 @@ import (
 type Config struct {
 	// How long a successful readiness check is valid for. If 0, disable caching successful readiness.
 	readinessCacheTTL time.Duration `yaml:"readiness_cache_ttl"`
+
+	DeepReadiness DeepReadinessConfig `yaml:"deep_readiness"`
+
+	Prefetch PrefetchConfig `yaml:"prefetch"`
+
+	GRPC GRPCConfig `yaml:"grpc"`
 }
 
 // Server defines the agent HTTP server.
@@ -56,6 +65,10 @@ type Server struct {
 	ac               announceclient.Client
 	containerRuntime containerruntime.Factory
 	lastReady        time.Time
+	prefetcher       *prefetcher
+
+	// deepReadiness is nil if deep readiness checks are disabled.
+	deepReadiness *deepReadiness
 }
 
 // New creates a new Server.
@@ -66,12 +79,18 @@ func New(
 	sched scheduler.ReloadableScheduler,
 	tags tagclient.Client,
 	ac announceclient.Client,
+	mc metainfoclient.Client,
 	containerRuntime containerruntime.Factory) *Server {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "agentserver",
 	})
 
+	var dr *deepReadiness
+	if config.DeepReadiness.Enabled {
+		dr = newDeepReadiness(config.DeepReadiness, clock.New(), cads, ac, mc)
+	}
+
 	return &Server{
 		config:           config,
 		stats:            stats,
@@ -80,6 +99,8 @@ func New(
 		tags:             tags,
 		ac:               ac,
 		containerRuntime: containerRuntime,
+		prefetcher:       newPrefetcher(config.Prefetch, clock.New(), cads, sched),
+		deepReadiness:    dr,
 	}
 }
 
@@ -96,16 +117,23 @@ func (s *Server) Handler() http.Handler {
 	r.Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
 
 	r.Get("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.downloadBlobHandler))
+	r.Post("/namespace/{namespace}/blobs/{digest}/seed", handler.Wrap(s.seedBlobHandler))
 
 	r.Delete("/blobs/{digest}", handler.Wrap(s.deleteBlobHandler))
 
 	// Preheat/preload endpoints.
 	r.Get("/preload/tags/{tag}", handler.Wrap(s.preloadTagHandler))
+	r.Post("/prefetch", handler.Wrap(s.prefetchHandler))
+	r.Get("/prefetch/{image}", handler.Wrap(s.getPrefetchHandler))
 
 	// Dangerous endpoint for running experiments.
 	r.Patch("/x/config/scheduler", handler.Wrap(s.patchSchedulerConfigHandler))
 
 	r.Get("/x/blacklist", handler.Wrap(s.getBlacklistHandler))
+	r.Get("/x/reputation", handler.Wrap(s.getReputationHandler))
+
+	r.Get("/x/bandwidth/namespaces", handler.Wrap(s.getNamespaceBandwidthHandler))
+	r.Put("/x/bandwidth/namespaces", handler.Wrap(s.putNamespaceBandwidthHandler))
 
 	// Serves /debug/pprof endpoints.
 	r.Mount("/", http.DefaultServeMux)
@@ -132,7 +160,8 @@ func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-// downloadBlobHandler downloads a blob through p2p.
+// downloadBlobHandler downloads a blob through p2p. The optional priority query
+// argument sets the priority class of the download, defaulting to interactive.
 func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) error {
 	namespace, err := httputil.ParseParam(r, "namespace")
 	if err != nil {
@@ -142,13 +171,20 @@ func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return err
 	}
+	priority, err := scheduler.ParsePriority(httputil.GetQueryArg(r, "priority", "interactive"))
+	if err != nil {
+		return handler.Errorf("parse priority: %s", err).Status(http.StatusBadRequest)
+	}
 	f, err := s.cads.Cache().GetFileReader(d.Hex())
 	if err != nil {
 		if os.IsNotExist(err) || s.cads.InDownloadError(err) {
-			if err := s.sched.Download(namespace, d); err != nil {
+			if err := s.sched.DownloadWithPriority(namespace, d, priority); err != nil {
 				if err == scheduler.ErrTorrentNotFound {
 					return handler.ErrorStatus(http.StatusNotFound)
 				}
+				if err == scheduler.ErrDownloadQueueFull {
+					return handler.ErrorStatus(http.StatusTooManyRequests)
+				}
 				return handler.Errorf("download torrent: %s", err)
 			}
 			f, err = s.cads.Cache().GetFileReader(d.Hex())
@@ -165,6 +201,35 @@ func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) err
 	return nil
 }
 
+// seedBlobHandler begins seeding a blob which is already in the cache, e.g.
+// because the cache was restored from a snapshot, without downloading it.
+func (s *Server) seedBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := parseDigest(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.cads.Cache().GetFileStat(d.Hex()); err != nil {
+		if os.IsNotExist(err) {
+			return handler.Errorf("blob not in cache").Status(http.StatusNotFound)
+		}
+		return handler.Errorf("store: %s", err)
+	}
+	if err := s.sched.Seed(namespace, d); err != nil {
+		switch err {
+		case scheduler.ErrTorrentNotFound:
+			return handler.Errorf("metainfo not found").Status(http.StatusNotFound)
+		case scheduler.ErrTorrentIncomplete:
+			return handler.Errorf("blob not in cache").Status(http.StatusNotFound)
+		}
+		return handler.Errorf("seed torrent: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) deleteBlobHandler(w http.ResponseWriter, r *http.Request) error {
 	d, err := parseDigest(r)
 	if err != nil {
@@ -228,7 +293,7 @@ func (s *Server) readinessCheckHandler(w http.ResponseWriter, r *http.Request) e
 		}
 	}
 
-	var schedErr, buildIndexErr, trackerErr error
+	var schedErr, buildIndexErr, trackerErr, deepErr error
 	var wg sync.WaitGroup
 
 	wg.Add(3)
@@ -244,11 +309,18 @@ func (s *Server) readinessCheckHandler(w http.ResponseWriter, r *http.Request) e
 		trackerErr = s.ac.CheckReadiness()
 		wg.Done()
 	}()
+	if s.deepReadiness != nil {
+		wg.Add(1)
+		go func() {
+			deepErr = s.deepReadiness.check()
+			wg.Done()
+		}()
+	}
 	wg.Wait()
 
 	// TODO(akalpakchiev): Replace with errors.Join once upgraded to Go 1.20+.
 	errMsgs := []string{}
-	for _, err := range []error{schedErr, buildIndexErr, trackerErr} {
+	for _, err := range []error{schedErr, buildIndexErr, trackerErr, deepErr} {
 		if err != nil {
 			errMsgs = append(errMsgs, err.Error())
 		}
@@ -276,6 +348,17 @@ func (s *Server) patchSchedulerConfigHandler(w http.ResponseWriter, r *http.Requ
 	return nil
 }
 
+func (s *Server) getReputationHandler(w http.ResponseWriter, r *http.Request) error {
+	reputation, err := s.sched.ReputationSnapshot()
+	if err != nil {
+		return handler.Errorf("reputation snapshot: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(&reputation); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) getBlacklistHandler(w http.ResponseWriter, r *http.Request) error {
 	blacklist, err := s.sched.BlacklistSnapshot()
 	if err != nil {
@@ -287,6 +370,27 @@ func (s *Server) getBlacklistHandler(w http.ResponseWriter, r *http.Request) err
 	return nil
 }
 
+func (s *Server) getNamespaceBandwidthHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.sched.NamespaceBandwidth()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// putNamespaceBandwidthHandler replaces the bandwidth shares of namespaces
+// with the shares in request body, without restarting the scheduler.
+func (s *Server) putNamespaceBandwidthHandler(w http.ResponseWriter, r *http.Request) error {
+	defer closers.Close(r.Body)
+	var configs []conn.NamespaceBandwidthConfig
+	if err := json.NewDecoder(r.Body).Decode(&configs); err != nil {
+		return handler.Errorf("json decode: %s", err).Status(http.StatusBadRequest)
+	}
+	if err := s.sched.SetNamespaceBandwidth(configs); err != nil {
+		return handler.Errorf("set namespace bandwidth: %s", err).Status(http.StatusBadRequest)
+	}
+	return nil
+}
+
 func parseDigest(r *http.Request) (core.Digest, error) {
 	raw, err := httputil.ParseParam(r, "digest")
 	if err != nil {
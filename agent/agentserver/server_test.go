@@ -30,6 +30,7 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
 	mockcontainerruntime "github.com/uber/kraken/mocks/lib/containerruntime"
@@ -37,6 +38,8 @@ import (
 	mockdockerdaemon "github.com/uber/kraken/mocks/lib/containerruntime/dockerdaemon"
 	mockscheduler "github.com/uber/kraken/mocks/lib/torrent/scheduler"
 	mockannounceclient "github.com/uber/kraken/mocks/tracker/announceclient"
+	mockmetainfoclient "github.com/uber/kraken/mocks/tracker/metainfoclient"
+	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/testutil"
 
@@ -52,6 +55,7 @@ type serverMocks struct {
 	dockerCli        *mockdockerdaemon.MockDockerClient
 	containerdCli    *mockcontainerd.MockClient
 	ac               *mockannounceclient.MockClient
+	mc               *mockmetainfoclient.MockClient
 	containerRuntime *mockcontainerruntime.MockFactory
 	cleanup          *testutil.Cleanup
 }
@@ -72,15 +76,16 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 	dockerCli := mockdockerdaemon.NewMockDockerClient(ctrl)
 	containerdCli := mockcontainerd.NewMockClient(ctrl)
 	ac := mockannounceclient.NewMockClient(ctrl)
+	mc := mockmetainfoclient.NewMockClient(ctrl)
 	containerruntime := mockcontainerruntime.NewMockFactory(ctrl)
 	return &serverMocks{
-		cads, sched, tags, dockerCli, containerdCli, ac,
+		cads, sched, tags, dockerCli, containerdCli, ac, mc,
 		containerruntime, &cleanup,
 	}, cleanup.Run
 }
 
 func (m *serverMocks) startServer(c Config) (*Server, string) {
-	s := New(c, tally.NoopScope, m.cads, m.sched, m.tags, m.ac, m.containerRuntime)
+	s := New(c, tally.NoopScope, m.cads, m.sched, m.tags, m.ac, m.mc, m.containerRuntime)
 	addr, stop := testutil.StartServer(s.Handler())
 	m.cleanup.Add(stop)
 	return s, addr
@@ -131,8 +136,9 @@ func TestDownload(t *testing.T) {
 	namespace := core.TagFixture()
 	blob := core.NewBlobFixture()
 
-	mocks.sched.EXPECT().Download(namespace, blob.Digest).DoAndReturn(
-		func(namespace string, d core.Digest) error {
+	mocks.sched.EXPECT().DownloadWithPriority(
+		namespace, blob.Digest, scheduler.PriorityInteractive).DoAndReturn(
+		func(namespace string, d core.Digest, p scheduler.Priority) error {
 			return store.RunDownload(mocks.cads, d, blob.Content)
 		})
 
@@ -155,7 +161,8 @@ func TestDownloadNotFound(t *testing.T) {
 	namespace := core.TagFixture()
 	blob := core.NewBlobFixture()
 
-	mocks.sched.EXPECT().Download(namespace, blob.Digest).Return(scheduler.ErrTorrentNotFound)
+	mocks.sched.EXPECT().DownloadWithPriority(
+		namespace, blob.Digest, scheduler.PriorityInteractive).Return(scheduler.ErrTorrentNotFound)
 
 	_, addr := mocks.startServer(Config{})
 	c := agentclient.New(addr)
@@ -174,7 +181,8 @@ func TestDownloadUnknownError(t *testing.T) {
 	namespace := core.TagFixture()
 	blob := core.NewBlobFixture()
 
-	mocks.sched.EXPECT().Download(namespace, blob.Digest).Return(fmt.Errorf("test error"))
+	mocks.sched.EXPECT().DownloadWithPriority(
+		namespace, blob.Digest, scheduler.PriorityInteractive).Return(fmt.Errorf("test error"))
 
 	_, addr := mocks.startServer(Config{})
 	c := agentclient.New(addr)
@@ -184,6 +192,72 @@ func TestDownloadUnknownError(t *testing.T) {
 	require.True(httputil.IsStatus(err, 500))
 }
 
+func TestDownloadWithPriority(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	mocks.sched.EXPECT().DownloadWithPriority(
+		namespace, blob.Digest, scheduler.PriorityPreheat).DoAndReturn(
+		func(namespace string, d core.Digest, p scheduler.Priority) error {
+			return store.RunDownload(mocks.cads, d, blob.Content)
+		})
+
+	_, addr := mocks.startServer(Config{})
+
+	resp, err := httputil.Get(fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s?priority=preheat",
+		addr, url.PathEscape(namespace), blob.Digest))
+	require.NoError(err)
+	defer resp.Body.Close()
+	result, err := io.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal(string(blob.Content), string(result))
+}
+
+func TestDownloadQueueFull(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	mocks.sched.EXPECT().DownloadWithPriority(
+		namespace, blob.Digest, scheduler.PriorityReplication).Return(scheduler.ErrDownloadQueueFull)
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Get(fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s?priority=replication",
+		addr, url.PathEscape(namespace), blob.Digest))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, 429))
+}
+
+func TestDownloadInvalidPriority(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Get(fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s?priority=urgent",
+		addr, url.PathEscape(namespace), blob.Digest))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, 400))
+}
+
 func TestHealthHandler(t *testing.T) {
 	tests := []struct {
 		desc     string
@@ -380,6 +454,34 @@ func TestReadinessCheckHandlerCache(t *testing.T) {
 	}
 }
 
+func TestReadinessCheckHandlerDeep(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	probe := core.DigestFixture()
+
+	mocks.sched.EXPECT().Probe().Return(nil)
+	mocks.tags.EXPECT().CheckReadiness().Return(nil)
+	mocks.ac.EXPECT().CheckReadiness().Return(nil)
+	mocks.ac.EXPECT().
+		Announce(gomock.Any(), gomock.Any(), gomock.Any(), false, announceclient.V2).
+		Return(nil, time.Second, nil)
+	mocks.mc.EXPECT().Download("probe-ns", probe).Return(nil, errors.New("some error"))
+
+	_, addr := mocks.startServer(Config{
+		DeepReadiness: DeepReadinessConfig{
+			Enabled:        true,
+			ProbeNamespace: "probe-ns",
+			ProbeDigest:    probe.String(),
+		},
+	})
+	_, err := httputil.Get(fmt.Sprintf("http://%s/readiness", addr))
+	require.EqualError(err, fmt.Sprintf(
+		"GET http://%s/readiness 503: agent not ready: origin: download metainfo: some error", addr))
+}
+
 func TestPatchSchedulerConfigHandler(t *testing.T) {
 	require := require.New(t)
 
@@ -425,6 +527,69 @@ func TestGetBlacklistHandler(t *testing.T) {
 	require.Equal(blacklist, result)
 }
 
+func TestGetReputationHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	reputation := []connstate.PeerReputation{{
+		PeerID:    core.PeerIDFixture(),
+		Penalty:   100,
+		UpdatedAt: time.Now().UTC().Truncate(time.Second),
+		Banned:    true,
+	}}
+	mocks.sched.EXPECT().ReputationSnapshot().Return(reputation, nil)
+
+	_, addr := mocks.startServer(Config{})
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/reputation", addr))
+	require.NoError(err)
+
+	var result []connstate.PeerReputation
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(reputation, result)
+}
+
+func TestNamespaceBandwidthHandlers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	_, addr := mocks.startServer(Config{})
+
+	configs := []conn.NamespaceBandwidthConfig{
+		{Namespace: "prod/.*", Share: 0.8},
+		{Namespace: "batch/.*", Share: 0.2},
+	}
+	b, err := json.Marshal(configs)
+	require.NoError(err)
+
+	mocks.sched.EXPECT().SetNamespaceBandwidth(configs).Return(nil)
+
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/x/bandwidth/namespaces", addr),
+		httputil.SendBody(bytes.NewReader(b)))
+	require.NoError(err)
+
+	mocks.sched.EXPECT().SetNamespaceBandwidth(configs).Return(errors.New("some error"))
+
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/x/bandwidth/namespaces", addr),
+		httputil.SendBody(bytes.NewReader(b)))
+	require.True(httputil.IsStatus(err, 400))
+
+	mocks.sched.EXPECT().NamespaceBandwidth().Return(configs)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/bandwidth/namespaces", addr))
+	require.NoError(err)
+
+	var result []conn.NamespaceBandwidthConfig
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(configs, result)
+}
+
 func TestDeleteBlobHandler(t *testing.T) {
 	require := require.New(t)
 
@@ -441,6 +606,63 @@ func TestDeleteBlobHandler(t *testing.T) {
 	require.NoError(err)
 }
 
+func TestSeedBlobHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	mocks.sched.EXPECT().Seed(namespace, blob.Digest).Return(nil)
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	require.NoError(c.Seed(namespace, blob.Digest))
+}
+
+func TestSeedBlobHandlerNotInCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	err := c.Seed(namespace, d)
+	require.Error(err)
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestSeedBlobHandlerMetaInfoNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	mocks.sched.EXPECT().Seed(namespace, blob.Digest).Return(scheduler.ErrTorrentNotFound)
+
+	_, addr := mocks.startServer(Config{})
+	c := agentclient.New(addr)
+
+	err := c.Seed(namespace, blob.Digest)
+	require.Error(err)
+	require.True(httputil.IsNotFound(err))
+}
+
 func TestPreloadHandler(t *testing.T) {
 	tag := url.PathEscape("repo1:tag1")
 	tests := []struct {
@@ -33,6 +33,7 @@ import (
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/metainfoclient"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/log"
@@ -43,6 +44,7 @@ import (
 // Flags defines agent CLI flags.
 type Flags struct {
 	PeerIP            string
+	PeerAltIP         string
 	PeerPort          int
 	AgentServerPort   int
 	AgentRegistryPort int
@@ -57,6 +59,9 @@ func ParseFlags() *Flags {
 	var flags Flags
 	flag.StringVar(
 		&flags.PeerIP, "peer-ip", "", "ip which peer will announce itself as")
+	flag.StringVar(
+		&flags.PeerAltIP, "peer-alt-ip", "",
+		"optional ip of the other ip family which dual-stack peer will also announce itself as")
 	flag.IntVar(
 		&flags.PeerPort, "peer-port", 0, "port which peer will announce itself as")
 	flag.IntVar(
@@ -169,13 +174,27 @@ func Run(flags *Flags, opts ...Option) {
 	if err != nil {
 		log.Fatalf("Failed to create peer context: %s", err)
 	}
+	if flags.PeerAltIP != "" {
+		if err := pctx.SetAltIP(flags.PeerAltIP); err != nil {
+			log.Fatalf("Failed to set peer alt ip: %s", err)
+		}
+	}
+	if len(config.Locality) > 0 || flags.Zone != "" {
+		pctx.Labels = make(map[string]string)
+		for k, v := range config.Locality {
+			pctx.Labels[k] = v
+		}
+		if _, ok := pctx.Labels["zone"]; !ok && flags.Zone != "" {
+			pctx.Labels["zone"] = flags.Zone
+		}
+	}
 
 	cads, err := store.NewCADownloadStore(config.CADownloadStore, stats)
 	if err != nil {
 		log.Fatalf("Failed to create local store: %s", err)
 	}
 
-	netevents, err := networkevent.NewProducer(config.NetworkEvent)
+	netevents, err := networkevent.NewProducer(config.NetworkEvent, stats)
 	if err != nil {
 		log.Fatalf("Failed to create network event producer: %s", err)
 	}
@@ -224,8 +243,11 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Failed to create container runtime factory: %s", err)
 	}
 
+	metaInfoClient := metainfoclient.New(trackers, tls)
+
 	agentServer := agentserver.New(
-		config.AgentServer, stats, cads, sched, tagClient, announceClient, containerRuntimeFactory)
+		config.AgentServer, stats, cads, sched, tagClient, announceClient, metaInfoClient,
+		containerRuntimeFactory)
 	addr := fmt.Sprintf(":%d", flags.AgentServerPort)
 	log.Infof("Starting agent server on %s", addr)
 	heartbeatTicker := &timeTicker{inner: time.NewTicker(10 * time.Second)}
@@ -247,6 +269,24 @@ func Run(flags *Flags, opts ...Option) {
 		}
 	}()
 
+	if config.AgentServer.GRPC.Addr != "" {
+		grpcServer, err := agentServer.GRPCServer()
+		if err != nil {
+			log.Fatalf("Failed to create agent gRPC server: %s", err)
+		}
+		l, err := config.AgentServer.GRPC.Listen()
+		if err != nil {
+			log.Fatalf("Failed to listen for agent gRPC server: %s", err)
+		}
+		log.Infof("Starting agent gRPC server on %s", l.Addr())
+		go func() {
+			if err := grpcServer.Serve(l); err != nil {
+				stopHeartbeat()
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	log.Info("Starting registry...")
 	go func() {
 		if err := registry.ListenAndServe(); err != nil {
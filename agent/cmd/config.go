@@ -48,6 +48,11 @@ type Config struct {
 	AllowedCidrs     []string                       `yaml:"allowed_cidrs"`
 	ContainerRuntime containerruntime.Config        `yaml:"container_runtime"`
 
+	// Locality labels the network location of the agent, e.g. its region,
+	// zone and rack, which trackers use to hand out nearby peers. The zone
+	// label defaults to the zone flag.
+	Locality map[string]string `yaml:"locality"`
+
 	// Deprecated
 	DockerDaemon dockerdaemon.Config `yaml:"docker_daemon"`
 }
@@ -17,6 +17,7 @@ import (
 	"flag"
 
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagpolicy"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
@@ -24,6 +25,7 @@ import (
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/tagevent"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
@@ -145,6 +147,7 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating backend manager: %s", err)
 	}
 	defer closers.Close(backends)
+	go backends.WatchCredentials(nil)
 
 	tls, err := config.TLS.BuildClient()
 	if err != nil {
@@ -157,7 +160,7 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originClient := blobclient.NewClusterClient(r)
+	originClient := blobclient.NewClusterClient(r, blobclient.WithBalancer(config.OriginBalancer))
 
 	localOriginDNS, err := config.Origin.StableAddr()
 	if err != nil {
@@ -209,6 +212,19 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating write-back manager: %s", err)
 	}
 
+	tagEventSinks, err := tagevent.NewSinks(config.TagEvents)
+	if err != nil {
+		log.Fatalf("Error creating tag event sinks: %s", err)
+	}
+	tagEventManager, err := persistedretry.NewManager(
+		config.EventDelivery,
+		stats,
+		tagevent.NewStore(localDB),
+		tagevent.NewExecutor(stats, tagEventSinks))
+	if err != nil {
+		log.Fatalf("Error creating tag event manager: %s", err)
+	}
+
 	tagStore := tagstore.New(config.TagStore, ss, backends, writeBackManager)
 
 	depResolver, err := tagtype.NewMap(config.TagTypes, originClient)
@@ -216,6 +232,11 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating tag type manager: %s", err)
 	}
 
+	policies, err := tagpolicy.New(config.TagPolicies)
+	if err != nil {
+		log.Fatalf("Error creating tag policies: %s", err)
+	}
+
 	server := tagserver.New(
 		config.TagServer,
 		stats,
@@ -227,7 +248,13 @@ func Run(flags *Flags, opts ...Option) {
 		remotes,
 		tagReplicationManager,
 		tagclient.NewProvider(tls),
-		depResolver)
+		depResolver,
+		policies,
+		tagevent.NewEmitter(tagEventSinks, flags.KrakenCluster, tagEventManager),
+		tagreplication.NewBackfillStore(localDB))
+	go server.MarkReachable(nil)
+	go server.IndexTags(nil)
+	server.ResumeBackfills()
 	go func() {
 		log.Fatal(server.ListenAndServe())
 	}()
@@ -14,17 +14,20 @@
 package cmd
 
 import (
+	"github.com/uber/kraken/build-index/tagpolicy"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/tagevent"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/httputil"
 
 	"go.uber.org/zap"
@@ -41,7 +44,11 @@ type Config struct {
 	Remotes        tagreplication.RemotesConfig `yaml:"remotes"`
 	TagReplication persistedretry.Config        `yaml:"tag_replication"`
 	TagTypes       []tagtype.Config             `yaml:"tag_types"`
+	TagPolicies    []tagpolicy.Config           `yaml:"tag_policies"`
+	TagEvents      tagevent.Config              `yaml:"tag_events"`
+	EventDelivery  persistedretry.Config        `yaml:"event_delivery"`
 	Origin         upstream.ActiveConfig        `yaml:"origin"`
+	OriginBalancer blobclient.BalancerConfig    `yaml:"origin_balancer"`
 	LocalDB        localdb.Config               `yaml:"localdb"`
 	Cluster        upstream.ActiveConfig        `yaml:"cluster"`
 	TagStore       tagstore.Config              `yaml:"tag_store"`
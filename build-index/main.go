@@ -17,14 +17,20 @@ import (
 	"github.com/uber/kraken/build-index/cmd"
 
 	// Import all backend client packages to register them with backend manager.
+	_ "github.com/uber/kraken/lib/backend/azureblob"
 	_ "github.com/uber/kraken/lib/backend/gcsbackend"
 	_ "github.com/uber/kraken/lib/backend/hdfsbackend"
 	_ "github.com/uber/kraken/lib/backend/httpbackend"
+	_ "github.com/uber/kraken/lib/backend/migratingbackend"
+	_ "github.com/uber/kraken/lib/backend/pluginbackend"
 	_ "github.com/uber/kraken/lib/backend/registrybackend"
+	_ "github.com/uber/kraken/lib/backend/replicatedbackend"
 	_ "github.com/uber/kraken/lib/backend/s3backend"
+	_ "github.com/uber/kraken/lib/backend/sftpbackend"
 	_ "github.com/uber/kraken/lib/backend/shadowbackend"
 	_ "github.com/uber/kraken/lib/backend/sqlbackend"
 	_ "github.com/uber/kraken/lib/backend/testfs"
+	_ "github.com/uber/kraken/lib/backend/webdavbackend"
 )
 
 func main() {
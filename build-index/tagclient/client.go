@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagpolicy"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/utils/closers"
@@ -34,6 +35,7 @@ import (
 // Client errors.
 var (
 	ErrTagNotFound = errors.New("tag not found")
+	ErrTagDeleted  = errors.New("tag deleted")
 )
 
 // Client wraps tagserver endpoints.
@@ -41,18 +43,26 @@ type Client interface {
 	CheckReadiness() error
 	Put(tag string, d core.Digest) error
 	PutAndReplicate(tag string, d core.Digest) error
+	ReplicatePut(tag string, d core.Digest, createdAt time.Time) error
+	CheckPolicy(tag string, d core.Digest) error
 	Get(tag string) (core.Digest, error)
 	Has(tag string) (bool, error)
+	Delete(tag string) error
+	ReplicateDelete(tag string, d core.Digest, deletedAt time.Time) error
+	History(tag string) ([]tagmodels.Version, error)
+	Rollback(tag string, d core.Digest) error
 	List(prefix string) ([]string, error)
 	ListWithPagination(prefix string, filter ListFilter) (tagmodels.ListResponse, error)
 	ListRepository(repo string) ([]string, error)
 	ListRepositoryWithPagination(repo string, filter ListFilter) (tagmodels.ListResponse, error)
 	Replicate(tag string) error
 	Origin() (string, error)
+	Reachable() (*tagmodels.ReachableResponse, error)
 
 	DuplicateReplicate(
 		tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error
 	DuplicatePut(tag string, d core.Digest, delay time.Duration) error
+	DuplicateDelete(tag string, deletedAt time.Time) error
 }
 
 type singleClient struct {
@@ -60,10 +70,20 @@ type singleClient struct {
 	tls  *tls.Config
 }
 
+// _listPageSize is the number of names requested per page by List and
+// ListRepository. Listing in pages bounds each request, where listing
+// everything at once times out on namespaces with millions of tags.
+const _listPageSize = 1000
+
 // ListFilter contains filter request for list with pagination operations.
 type ListFilter struct {
 	Offset string
 	Limit  int
+
+	// Regex and Sort require the tag index to be enabled on the server. See
+	// tagmodels for sort orders.
+	Regex string
+	Sort  string
 }
 
 // NewSingleClient returns a Client scoped to a single tagserver instance.
@@ -79,19 +99,65 @@ func (c *singleClient) CheckReadiness() error {
 	return err
 }
 
+// policyViolation converts responses rejecting tag for violating its policy
+// into *tagpolicy.Violation.
+func policyViolation(tag string, err error) error {
+	serr, ok := err.(httputil.StatusError)
+	if !ok {
+		return err
+	}
+	reason := serr.Header.Get(tagpolicy.ViolationHeader)
+	if reason == "" {
+		return err
+	}
+	return &tagpolicy.Violation{Reason: reason, Tag: tag, Message: serr.ResponseDump}
+}
+
+// Put puts tag. Returns *tagpolicy.Violation if the put violates the policy
+// of tag.
 func (c *singleClient) Put(tag string, d core.Digest) error {
 	_, err := httputil.Put(
 		fmt.Sprintf("http://%s/tags/%s/digest/%s", c.addr, url.PathEscape(tag), d.String()),
 		httputil.SendTimeout(30*time.Second),
 		httputil.SendTLS(c.tls))
-	return err
+	return policyViolation(tag, err)
 }
 
+// PutAndReplicate puts and replicates tag. Returns *tagpolicy.Violation if the
+// put violates the policy of tag.
 func (c *singleClient) PutAndReplicate(tag string, d core.Digest) error {
 	_, err := httputil.Put(
 		fmt.Sprintf("http://%s/tags/%s/digest/%s?replicate=true", c.addr, url.PathEscape(tag), d.String()),
 		httputil.SendTimeout(30*time.Second),
 		httputil.SendTLS(c.tls))
+	return policyViolation(tag, err)
+}
+
+// CheckPolicy returns *tagpolicy.Violation if putting tag to d would violate
+// the policy of tag.
+func (c *singleClient) CheckPolicy(tag string, d core.Digest) error {
+	_, err := httputil.Get(
+		fmt.Sprintf("http://%s/policies/tags/%s/digest/%s", c.addr, url.PathEscape(tag), d.String()),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls))
+	return policyViolation(tag, err)
+}
+
+// ReplicatePut puts and replicates tag on behalf of another cluster, where the
+// replication was created at createdAt. Returns ErrTagDeleted if the tag was
+// deleted after createdAt, or *tagpolicy.Violation if the put violates the
+// policy of tag.
+func (c *singleClient) ReplicatePut(tag string, d core.Digest, createdAt time.Time) error {
+	_, err := httputil.Put(
+		fmt.Sprintf(
+			"http://%s/tags/%s/digest/%s?replicate=true&created_at=%s",
+			c.addr, url.PathEscape(tag), d.String(),
+			url.QueryEscape(createdAt.UTC().Format(time.RFC3339Nano))),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls))
+	if err = policyViolation(tag, err); httputil.IsConflict(err) {
+		return ErrTagDeleted
+	}
 	return err
 }
 
@@ -132,6 +198,63 @@ func (c *singleClient) Has(tag string) (bool, error) {
 	return true, nil
 }
 
+func (c *singleClient) Delete(tag string) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls))
+	if httputil.IsNotFound(err) {
+		return ErrTagNotFound
+	}
+	return err
+}
+
+// ReplicateDelete deletes and replicates the deletion of tag, which pointed
+// to d, on behalf of another cluster where it was deleted at deletedAt.
+func (c *singleClient) ReplicateDelete(tag string, d core.Digest, deletedAt time.Time) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf(
+			"http://%s/tags/%s/digest/%s?deleted_at=%s",
+			c.addr, url.PathEscape(tag), d.String(),
+			url.QueryEscape(deletedAt.UTC().Format(time.RFC3339Nano))),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
+// History returns the digests tag pointed to before, newest first.
+func (c *singleClient) History(tag string) ([]tagmodels.Version, error) {
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/history/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+	var history tagmodels.HistoryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return history.Versions, nil
+}
+
+// Rollback moves tag back to d, which tag must have pointed to before.
+// Returns ErrTagNotFound if d is not in the history of tag.
+func (c *singleClient) Rollback(tag string, d core.Digest) error {
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/rollback/tags/%s/digest/%s", c.addr, url.PathEscape(tag), d.String()),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls))
+	if httputil.IsNotFound(err) {
+		return ErrTagNotFound
+	}
+	return err
+}
+
 func (c *singleClient) doListPaginated(urlFormat string, pathSub string,
 	filter ListFilter) (tagmodels.ListResponse, error) {
 
@@ -143,6 +266,12 @@ func (c *singleClient) doListPaginated(urlFormat string, pathSub string,
 	if filter.Limit != 0 {
 		reqVal.Add(tagmodels.LimitQ, strconv.Itoa(filter.Limit))
 	}
+	if filter.Regex != "" {
+		reqVal.Add(tagmodels.RegexQ, filter.Regex)
+	}
+	if filter.Sort != "" {
+		reqVal.Add(tagmodels.SortQ, filter.Sort)
+	}
 
 	// Fetch list response from server.
 	serverUrl := url.URL{
@@ -175,7 +304,7 @@ func (c *singleClient) doList(pathSub string,
 
 	offset := ""
 	for ok := true; ok; ok = (offset != "") {
-		filter := ListFilter{Offset: offset}
+		filter := ListFilter{Offset: offset, Limit: _listPageSize}
 		resp, err := fn(pathSub, filter)
 		if err != nil {
 			return nil, err
@@ -276,6 +405,25 @@ func (c *singleClient) DuplicatePut(tag string, d core.Digest, delay time.Durati
 	return err
 }
 
+// DuplicateDeleteRequest defines a DuplicateDelete request body.
+type DuplicateDeleteRequest struct {
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (c *singleClient) DuplicateDelete(tag string, deletedAt time.Time) error {
+	b, err := json.Marshal(DuplicateDeleteRequest{deletedAt})
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	_, err = httputil.Delete(
+		fmt.Sprintf("http://%s/internal/duplicate/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendRetry(),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
 func (c *singleClient) Origin() (string, error) {
 	resp, err := httputil.Get(
 		fmt.Sprintf("http://%s/origin", c.addr),
@@ -292,6 +440,22 @@ func (c *singleClient) Origin() (string, error) {
 	return string(b), nil
 }
 
+func (c *singleClient) Reachable() (*tagmodels.ReachableResponse, error) {
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/gc/reachable", c.addr),
+		httputil.SendTimeout(5*time.Minute),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+	var reachable tagmodels.ReachableResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reachable); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return &reachable, nil
+}
+
 type clusterClient struct {
 	hosts healthcheck.List
 	tls   *tls.Config
@@ -355,6 +519,14 @@ func (cc *clusterClient) PutAndReplicate(tag string, d core.Digest) error {
 	return cc.do(func(c Client) error { return c.PutAndReplicate(tag, d) })
 }
 
+func (cc *clusterClient) CheckPolicy(tag string, d core.Digest) error {
+	return cc.do(func(c Client) error { return c.CheckPolicy(tag, d) })
+}
+
+func (cc *clusterClient) ReplicatePut(tag string, d core.Digest, createdAt time.Time) error {
+	return cc.do(func(c Client) error { return c.ReplicatePut(tag, d, createdAt) })
+}
+
 func (cc *clusterClient) Get(tag string) (d core.Digest, err error) {
 	err = cc.do(func(c Client) error {
 		d, err = c.Get(tag)
@@ -371,6 +543,14 @@ func (cc *clusterClient) Has(tag string) (ok bool, err error) {
 	return
 }
 
+func (cc *clusterClient) Delete(tag string) error {
+	return cc.do(func(c Client) error { return c.Delete(tag) })
+}
+
+func (cc *clusterClient) ReplicateDelete(tag string, d core.Digest, deletedAt time.Time) error {
+	return cc.do(func(c Client) error { return c.ReplicateDelete(tag, d, deletedAt) })
+}
+
 func (cc *clusterClient) List(prefix string) (tags []string, err error) {
 	err = cc.do(func(c Client) error {
 		tags, err = c.List(prefix)
@@ -419,6 +599,26 @@ func (cc *clusterClient) Origin() (origin string, err error) {
 	return
 }
 
+func (cc *clusterClient) History(tag string) (versions []tagmodels.Version, err error) {
+	err = cc.do(func(c Client) error {
+		versions, err = c.History(tag)
+		return err
+	})
+	return
+}
+
+func (cc *clusterClient) Rollback(tag string, d core.Digest) error {
+	return cc.do(func(c Client) error { return c.Rollback(tag, d) })
+}
+
+func (cc *clusterClient) Reachable() (reachable *tagmodels.ReachableResponse, err error) {
+	err = cc.do(func(c Client) error {
+		reachable, err = c.Reachable()
+		return err
+	})
+	return
+}
+
 func (cc *clusterClient) DuplicateReplicate(
 	tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
 
@@ -428,3 +628,7 @@ func (cc *clusterClient) DuplicateReplicate(
 func (cc *clusterClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
 	return errors.New("duplicate put not supported on cluster client")
 }
+
+func (cc *clusterClient) DuplicateDelete(tag string, deletedAt time.Time) error {
+	return errors.New("duplicate delete not supported on cluster client")
+}
@@ -17,12 +17,26 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"time"
+
+	"github.com/uber/kraken/core"
 )
 
 const (
 	// Filters.
 	LimitQ  string = "limit"
 	OffsetQ string = "offset"
+	RegexQ  string = "regex"
+	SortQ   string = "sort"
+)
+
+// Sort orders of listings.
+const (
+	// SortByName lists names in lexicographic order.
+	SortByName string = "name"
+
+	// SortByModTime lists the most recently modified names first.
+	SortByModTime string = "mtime"
 )
 
 // List Response with pagination. Models tagserver reponse to list and
@@ -57,3 +71,36 @@ func (resp ListResponse) GetOffset() (string, error) {
 	}
 	return offset, nil
 }
+
+// BackfillRequest starts replicating the existing tags of Prefix which match
+// Pattern to the remote build-index Destination. Models tagserver request to
+// backfill remotes.
+type BackfillRequest struct {
+	Destination string `json:"destination"`
+	Prefix      string `json:"prefix"`
+	Pattern     string `json:"pattern"`
+}
+
+// Version is a digest a tag pointed to until it was moved or deleted.
+type Version struct {
+	Digest     core.Digest `json:"digest"`
+	ReplacedAt time.Time   `json:"replaced_at"`
+}
+
+// HistoryResponse is the history of a tag, newest first. Models tagserver
+// response to tag history.
+type HistoryResponse struct {
+	Tag      string    `json:"tag"`
+	Versions []Version `json:"versions"`
+}
+
+// ReachableResponse is the set of digests reachable from live tags, i.e. the
+// digests tags point to and their dependencies. Models tagserver response to
+// garbage collection marks.
+type ReachableResponse struct {
+	// MarkedAt is when the mark started. Tags put after MarkedAt may be
+	// missing from the set.
+	MarkedAt time.Time       `json:"marked_at"`
+	Tags     int             `json:"tags"`
+	Digests  core.DigestList `json:"digests"`
+}
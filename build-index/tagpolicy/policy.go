@@ -0,0 +1,179 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/uber/kraken/core"
+)
+
+// ViolationHeader is the response header carrying the Reason of a Violation,
+// so clients can tell policy violations apart from other errors.
+const ViolationHeader = "Kraken-Tag-Policy-Violation"
+
+// Violation reasons.
+const (
+	// ReasonImmutable is returned when putting an immutable tag which already
+	// points to a different digest.
+	ReasonImmutable = "immutable"
+
+	// ReasonFormat is returned when putting a tag whose name does not have the
+	// required format.
+	ReasonFormat = "format"
+)
+
+// _semver matches semantic versions, optionally prefixed with "v". Build
+// metadata is not matched since "+" is not valid in docker tags.
+var _semver = regexp.MustCompile(
+	`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(-(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(\.(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*)?$`)
+
+// Config defines the policy of tags matching Namespace.
+type Config struct {
+	// Namespace is a regexp matched against tag names, e.g. "repo:version".
+	Namespace string `yaml:"namespace"`
+
+	// Immutable rejects puts which move an existing tag to a different digest.
+	Immutable bool `yaml:"immutable"`
+
+	// Mutable are regexps of tag versions, i.e. the part of tag names after
+	// the last ":", which remain mutable and exempt from Semver, e.g. "^latest$".
+	Mutable []string `yaml:"mutable"`
+
+	// Semver requires tag versions to be semantic versions, e.g. "1.2.3" or
+	// "v1.2.3-rc.1".
+	Semver bool `yaml:"semver"`
+}
+
+// Violation is returned for puts which violate the policy of a tag.
+type Violation struct {
+	Reason  string
+	Tag     string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("tag %s violates policy: %s", v.Tag, v.Message)
+}
+
+type policy struct {
+	namespace *regexp.Regexp
+	immutable bool
+	mutable   []*regexp.Regexp
+	semver    bool
+}
+
+func (p *policy) isMutable(version string) bool {
+	for _, re := range p.mutable {
+		if re.MatchString(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policies maps tag namespaces to policies. Tags use the policy of the first
+// matching namespace, and tags matching no namespace are unrestricted.
+type Policies struct {
+	policies []*policy
+}
+
+// New creates new Policies.
+func New(configs []Config) (*Policies, error) {
+	var policies []*policy
+	for _, config := range configs {
+		ns, err := regexp.Compile(config.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace regexp: %s", err)
+		}
+		p := &policy{namespace: ns, immutable: config.Immutable, semver: config.Semver}
+		for _, m := range config.Mutable {
+			re, err := regexp.Compile(m)
+			if err != nil {
+				return nil, fmt.Errorf("mutable regexp: %s", err)
+			}
+			p.mutable = append(p.mutable, re)
+		}
+		policies = append(policies, p)
+	}
+	return &Policies{policies}, nil
+}
+
+func (p *Policies) match(tag string) *policy {
+	for _, policy := range p.policies {
+		if policy.namespace.MatchString(tag) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// version returns the part of tag after the last ":".
+func version(tag string) string {
+	return tag[strings.LastIndex(tag, ":")+1:]
+}
+
+// Validate returns a *Violation if the name of tag does not have the format
+// required by its policy.
+func (p *Policies) Validate(tag string) error {
+	policy := p.match(tag)
+	if policy == nil || !policy.semver {
+		return nil
+	}
+	v := version(tag)
+	if policy.isMutable(v) || _semver.MatchString(v) {
+		return nil
+	}
+	return &Violation{
+		Reason:  ReasonFormat,
+		Tag:     tag,
+		Message: fmt.Sprintf("version %q is not a semantic version", v),
+	}
+}
+
+// Immutable returns true if tag may not be moved to a different digest once
+// put.
+func (p *Policies) Immutable(tag string) bool {
+	policy := p.match(tag)
+	return policy != nil && policy.immutable && !policy.isMutable(version(tag))
+}
+
+// Check returns a *Violation if tag, which currently points to current, may not
+// be put to d. current is only called for immutable tags, and returns false if
+// tag does not exist.
+func (p *Policies) Check(
+	tag string, d core.Digest, current func() (core.Digest, bool, error)) error {
+
+	if err := p.Validate(tag); err != nil {
+		return err
+	}
+	if !p.Immutable(tag) {
+		return nil
+	}
+	cur, ok, err := current()
+	if err != nil {
+		return fmt.Errorf("current digest: %s", err)
+	}
+	if ok && cur != d {
+		return &Violation{
+			Reason:  ReasonImmutable,
+			Tag:     tag,
+			Message: fmt.Sprintf("tag is immutable and already points to %s", cur),
+		}
+	}
+	return nil
+}
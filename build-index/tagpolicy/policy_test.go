@@ -0,0 +1,102 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagpolicy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testConfigs() []Config {
+	return []Config{
+		{Namespace: "^prod/.*", Immutable: true, Mutable: []string{"^latest$"}, Semver: true},
+		{Namespace: "^release/.*", Immutable: true},
+	}
+}
+
+func currentFixture(d core.Digest, ok bool) func() (core.Digest, bool, error) {
+	return func() (core.Digest, bool, error) { return d, ok, nil }
+}
+
+func requireViolation(t *testing.T, reason string, err error) {
+	t.Helper()
+	v, ok := err.(*Violation)
+	require.True(t, ok, "expected *Violation, got %v", err)
+	require.Equal(t, reason, v.Reason)
+}
+
+func TestValidateSemver(t *testing.T) {
+	p, err := New(testConfigs())
+	require.NoError(t, err)
+
+	for _, tag := range []string{
+		"prod/repo:1.2.3",
+		"prod/repo:v1.2.3",
+		"prod/repo:1.0.0-rc.1",
+		"prod/repo:latest",
+		"release/repo:anything",
+		"dev/repo:anything",
+	} {
+		require.NoError(t, p.Validate(tag), tag)
+	}
+	for _, tag := range []string{
+		"prod/repo:1.2",
+		"prod/repo:01.2.3",
+		"prod/repo:stable",
+	} {
+		requireViolation(t, ReasonFormat, p.Validate(tag))
+	}
+}
+
+func TestCheckImmutable(t *testing.T) {
+	require := require.New(t)
+
+	p, err := New(testConfigs())
+	require.NoError(err)
+
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	// New tags and puts of the same digest are allowed.
+	require.NoError(p.Check("release/repo:a", d1, currentFixture(core.Digest{}, false)))
+	require.NoError(p.Check("release/repo:a", d1, currentFixture(d1, true)))
+
+	requireViolation(t, ReasonImmutable, p.Check("release/repo:a", d2, currentFixture(d1, true)))
+
+	// Mutable tags and tags without policy may move.
+	require.NoError(p.Check("prod/repo:latest", d2, currentFixture(d1, true)))
+	require.NoError(p.Check("dev/repo:a", d2, currentFixture(d1, true)))
+}
+
+func TestCheckSkipsLookupOfMutableTags(t *testing.T) {
+	p, err := New(testConfigs())
+	require.NoError(t, err)
+
+	current := func() (core.Digest, bool, error) {
+		return core.Digest{}, false, errors.New("unexpected lookup")
+	}
+	require.NoError(t, p.Check("dev/repo:a", core.DigestFixture(), current))
+}
+
+func TestNewInvalidRegexp(t *testing.T) {
+	_, err := New([]Config{{Namespace: "("}})
+	require.Error(t, err)
+
+	_, err = New([]Config{{Namespace: ".*", Mutable: []string{"("}}})
+	require.Error(t, err)
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// _backfillListPageSize is the number of tags listed per backend request while
+// backfilling, and how often backfill progress is saved.
+const _backfillListPageSize = 1000
+
+type backfillOutcome int
+
+const (
+	backfillReplicated backfillOutcome = iota
+	backfillDeferred
+	backfillSkipped
+	backfillFailed
+)
+
+// backfiller tracks the backfills running on this build-index.
+type backfiller struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func newBackfiller() *backfiller {
+	return &backfiller{running: make(map[string]bool)}
+}
+
+func backfillKey(b *tagreplication.Backfill) string {
+	return b.Destination + " " + b.Prefix
+}
+
+// start returns false if b is already running.
+func (f *backfiller) start(b *tagreplication.Backfill) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.running[backfillKey(b)] {
+		return false
+	}
+	f.running[backfillKey(b)] = true
+	return true
+}
+
+func (f *backfiller) stop(b *tagreplication.Backfill) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.running, backfillKey(b))
+}
+
+// backfillHandler starts replicating the existing tags of a prefix to a remote.
+// Backfills which failed or were interrupted resume where they stopped, and
+// finished backfills start over. Response model tagreplication.Backfill.
+func (s *Server) backfillHandler(w http.ResponseWriter, r *http.Request) error {
+	var req tagmodels.BackfillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("json decode: %s", err).Status(http.StatusBadRequest)
+	}
+	if !s.remotes.Has(req.Destination) {
+		return handler.Errorf(
+			"remote %s not configured", req.Destination).Status(http.StatusBadRequest)
+	}
+	if _, err := regexp.Compile(req.Pattern); err != nil {
+		return handler.Errorf("pattern: %s", err).Status(http.StatusBadRequest)
+	}
+
+	b, err := s.backfills.Get(req.Destination, req.Prefix)
+	if err == tagreplication.ErrBackfillNotFound ||
+		(err == nil && b.Status == tagreplication.BackfillDone) {
+		b = tagreplication.NewBackfill(req.Destination, req.Prefix, req.Pattern)
+	} else if err != nil {
+		return handler.Errorf("backfill store: %s", err)
+	}
+	if !s.backfiller.start(b) {
+		return handler.Errorf("backfill already running").Status(http.StatusConflict)
+	}
+	b.Pattern = req.Pattern
+	b.Status = tagreplication.BackfillRunning
+	b.Error = ""
+	b.UpdatedAt = time.Now()
+	if err := s.backfills.Put(b); err != nil {
+		s.backfiller.stop(b)
+		return handler.Errorf("backfill store: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(b); err != nil {
+		log.Errorf("Error encoding backfill: %s", err)
+	}
+	go s.runBackfill(b)
+	return nil
+}
+
+// listBackfillsHandler returns all backfills. Response model
+// []tagreplication.Backfill.
+func (s *Server) listBackfillsHandler(w http.ResponseWriter, r *http.Request) error {
+	backfills, err := s.backfills.List()
+	if err != nil {
+		return handler.Errorf("backfill store: %s", err)
+	}
+	if backfills == nil {
+		backfills = []*tagreplication.Backfill{}
+	}
+	if err := json.NewEncoder(w).Encode(backfills); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// ResumeBackfills resumes the backfills interrupted by a restart of this
+// build-index.
+func (s *Server) ResumeBackfills() {
+	backfills, err := s.backfills.List()
+	if err != nil {
+		log.Errorf("Error listing backfills: %s", err)
+		return
+	}
+	for _, b := range backfills {
+		if b.Status != tagreplication.BackfillRunning {
+			continue
+		}
+		if !s.remotes.Has(b.Destination) {
+			b.Status = tagreplication.BackfillFailed
+			b.Error = "remote no longer configured"
+			b.UpdatedAt = time.Now()
+			if err := s.backfills.Put(b); err != nil {
+				log.Errorf("Error saving backfill: %s", err)
+			}
+			continue
+		}
+		if s.backfiller.start(b) {
+			go s.runBackfill(b)
+		}
+	}
+}
+
+func (s *Server) runBackfill(b *tagreplication.Backfill) {
+	defer s.backfiller.stop(b)
+
+	log.With("destination", b.Destination, "prefix", b.Prefix).Info("Starting backfill")
+
+	if err := s.backfill(b); err != nil {
+		s.stats.Counter("backfill_failures").Inc(1)
+		log.With("destination", b.Destination, "prefix", b.Prefix).Errorf("Backfill failed: %s", err)
+		b.Status = tagreplication.BackfillFailed
+		b.Error = err.Error()
+	} else {
+		log.With(
+			"destination", b.Destination,
+			"prefix", b.Prefix,
+			"replicated", b.Replicated,
+			"deferred", b.Deferred,
+			"skipped", b.Skipped,
+			"failed", b.Failed).Info("Backfill done")
+		b.Status = tagreplication.BackfillDone
+	}
+	b.UpdatedAt = time.Now()
+	if err := s.backfills.Put(b); err != nil {
+		log.Errorf("Error saving backfill: %s", err)
+	}
+}
+
+// backfill replicates every tag of b one page at a time, saving progress after
+// each page, such that a backfill resumes from the last unfinished page.
+func (s *Server) backfill(b *tagreplication.Backfill) error {
+	pattern, err := regexp.Compile(b.Pattern)
+	if err != nil {
+		return fmt.Errorf("pattern: %s", err)
+	}
+	client, err := s.backends.GetClient(b.Prefix)
+	if err != nil {
+		return fmt.Errorf("backend manager: %s", err)
+	}
+	limit := rate.Inf
+	if s.config.Backfill.MaxTagsPerSecond > 0 {
+		limit = rate.Limit(s.config.Backfill.MaxTagsPerSecond)
+	}
+	limiter := rate.NewLimiter(limit, 1)
+
+	for {
+		result, err := client.List(
+			b.Prefix,
+			backend.ListWithPagination(),
+			backend.ListWithMaxKeys(_backfillListPageSize),
+			backend.ListWithContinuationToken(b.ContinuationToken))
+		if err != nil {
+			return fmt.Errorf("list: %s", err)
+		}
+
+		var mu sync.Mutex
+		var g errgroup.Group
+		g.SetLimit(s.config.Backfill.Concurrency)
+		for _, tag := range result.Names {
+			tag := tag
+			if err := limiter.Wait(context.Background()); err != nil {
+				return fmt.Errorf("rate limit: %s", err)
+			}
+			g.Go(func() error {
+				outcome := s.backfillTag(b.Destination, pattern, tag)
+				mu.Lock()
+				defer mu.Unlock()
+				switch outcome {
+				case backfillReplicated:
+					b.Replicated++
+				case backfillDeferred:
+					b.Deferred++
+				case backfillSkipped:
+					b.Skipped++
+				case backfillFailed:
+					b.Failed++
+				}
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+
+		b.ContinuationToken = result.ContinuationToken
+		if b.ContinuationToken == "" {
+			return nil
+		}
+		b.UpdatedAt = time.Now()
+		if err := s.backfills.Put(b); err != nil {
+			return fmt.Errorf("save progress: %s", err)
+		}
+	}
+}
+
+// backfillTag replicates tag to destination if it matches pattern and is
+// configured to replicate to destination.
+func (s *Server) backfillTag(
+	destination string, pattern *regexp.Regexp, tag string) backfillOutcome {
+
+	if !pattern.MatchString(tag) || !s.remotes.Valid(tag, destination) {
+		return backfillSkipped
+	}
+	d, err := s.store.Get(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			// Deleted since it was listed.
+			return backfillSkipped
+		}
+		log.With("tag", tag).Errorf("Error getting backfilled tag: %s", err)
+		return backfillFailed
+	}
+	deps, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		log.With("tag", tag, "digest", d.String()).Errorf(
+			"Error resolving dependencies of backfilled tag: %s", err)
+		return backfillFailed
+	}
+	task := tagreplication.NewTask(tag, d, deps, destination, 0)
+	if err := s.tagReplicationManager.SyncExec(task); err != nil {
+		// Leave the tag to the retries of the replication manager instead of
+		// stalling the backfill on it.
+		if err := s.tagReplicationManager.Add(task); err != nil {
+			log.With("tag", tag, "destination", destination).Errorf(
+				"Error adding backfill replication task: %s", err)
+			return backfillFailed
+		}
+		return backfillDeferred
+	}
+	return backfillReplicated
+}
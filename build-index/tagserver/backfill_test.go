@@ -0,0 +1,179 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func postBackfill(addr string, req tagmodels.BackfillRequest) (*http.Response, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return httputil.Post(
+		fmt.Sprintf("http://%s/remotes/backfills", addr),
+		httputil.SendBody(bytes.NewReader(b)))
+}
+
+func listBackfills(addr string) ([]*tagreplication.Backfill, error) {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/remotes/backfills", addr))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var backfills []*tagreplication.Backfill
+	if err := json.NewDecoder(resp.Body).Decode(&backfills); err != nil {
+		return nil, err
+	}
+	return backfills, nil
+}
+
+func TestBackfill(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	server := mocks.server()
+
+	a := core.DigestFixture()
+	b := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().List("repo", gomock.Any()).Return(&backend.ListResult{
+		Names:             []string{"repo:a", "repo:c"},
+		ContinuationToken: "next",
+	}, nil)
+	mocks.backendClient.EXPECT().List("repo", gomock.Any()).Return(&backend.ListResult{
+		Names: []string{"repo:b"},
+	}, nil)
+
+	mocks.store.EXPECT().Get("repo:a").Return(a, nil)
+	mocks.store.EXPECT().Get("repo:b").Return(b, nil)
+	mocks.depResolver.EXPECT().Resolve("repo:a", a).Return(core.DigestList{a}, nil)
+	mocks.depResolver.EXPECT().Resolve("repo:b", b).Return(core.DigestList{b}, nil)
+
+	taskA := tagreplication.NewTask("repo:a", a, core.DigestList{a}, _testRemote, 0)
+	taskB := tagreplication.NewTask("repo:b", b, core.DigestList{b}, _testRemote, 0)
+	mocks.tagReplicationManager.EXPECT().SyncExec(tagreplication.MatchTask(taskA)).Return(nil)
+	mocks.tagReplicationManager.EXPECT().SyncExec(
+		tagreplication.MatchTask(taskB)).Return(errors.New("some error"))
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(taskB)).Return(nil)
+
+	backfill := tagreplication.NewBackfill(_testRemote, "repo", "^repo:[ab]$")
+	require.NoError(mocks.backfills.Put(backfill))
+
+	require.NoError(server.backfill(backfill))
+	require.Equal(1, backfill.Replicated)
+	require.Equal(1, backfill.Deferred)
+	require.Equal(1, backfill.Skipped)
+	require.Equal(0, backfill.Failed)
+
+	// Progress is saved after each page.
+	saved, err := mocks.backfills.Get(_testRemote, "repo")
+	require.NoError(err)
+	require.Equal("next", saved.ContinuationToken)
+	require.Equal(1, saved.Replicated)
+}
+
+func TestBackfillHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	mocks.backendClient.EXPECT().List("repo", gomock.Any()).Return(&backend.ListResult{}, nil)
+
+	_, err := postBackfill(addr, tagmodels.BackfillRequest{
+		Destination: _testRemote,
+		Prefix:      "repo",
+	})
+	require.NoError(err)
+
+	require.Eventually(func() bool {
+		backfills, err := listBackfills(addr)
+		require.NoError(err)
+		require.Len(backfills, 1)
+		return backfills[0].Status == tagreplication.BackfillDone
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBackfillHandlerBadRequests(t *testing.T) {
+	tests := []struct {
+		desc string
+		req  tagmodels.BackfillRequest
+	}{
+		{"unknown remote", tagmodels.BackfillRequest{Destination: "unknown", Prefix: "repo"}},
+		{"invalid pattern", tagmodels.BackfillRequest{Destination: _testRemote, Pattern: "("}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := postBackfill(addr, test.req)
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
+
+func TestResumeBackfills(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	running := tagreplication.NewBackfill(_testRemote, "repo", "")
+	running.ContinuationToken = "next"
+	require.NoError(mocks.backfills.Put(running))
+
+	removed := tagreplication.NewBackfill("removed-remote", "repo", "")
+	require.NoError(mocks.backfills.Put(removed))
+
+	mocks.backendClient.EXPECT().List("repo", gomock.Any()).Return(&backend.ListResult{}, nil)
+
+	mocks.server().ResumeBackfills()
+
+	require.Eventually(func() bool {
+		b, err := mocks.backfills.Get(_testRemote, "repo")
+		require.NoError(err)
+		return b.Status == tagreplication.BackfillDone
+	}, 5*time.Second, 10*time.Millisecond)
+
+	b, err := mocks.backfills.Get("removed-remote", "repo")
+	require.NoError(err)
+	require.Equal(tagreplication.BackfillFailed, b.Status)
+}
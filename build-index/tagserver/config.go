@@ -14,6 +14,7 @@
 package tagserver
 
 import (
+	"strings"
 	"time"
 
 	"github.com/uber/kraken/utils/listener"
@@ -24,6 +25,85 @@ type Config struct {
 	Listener                  listener.Config `yaml:"listener"`
 	DuplicateReplicateStagger time.Duration   `yaml:"duplicate_replicate_stagger"`
 	DuplicatePutStagger       time.Duration   `yaml:"duplicate_put_stagger"`
+	GC                        GCConfig        `yaml:"gc"`
+	Index                     IndexConfig     `yaml:"index"`
+	Backfill                  BackfillConfig  `yaml:"backfill"`
+}
+
+// GCConfig defines how the set of digests reachable from live tags is marked
+// for origin garbage collection.
+type GCConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is how often the reachable set is marked.
+	Interval time.Duration `yaml:"interval"`
+
+	// Prefixes are the tag name prefixes listed to find live tags. Every tag
+	// referencing blobs which origins collect must be covered.
+	Prefixes []string `yaml:"prefixes"`
+}
+
+func (c GCConfig) applyDefaults() GCConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Hour
+	}
+	if len(c.Prefixes) == 0 {
+		c.Prefixes = []string{""}
+	}
+	return c
+}
+
+// IndexConfig defines the in-memory tag index, which serves filtered and
+// sorted tag listings without listing the storage backend.
+type IndexConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// RefreshInterval is how often the index is rebuilt from the storage
+	// backend, e.g. to pick up tags written by other clusters.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// Prefixes are the tag name prefixes indexed. Listings of other prefixes
+	// are served by the storage backend.
+	Prefixes []string `yaml:"prefixes"`
+}
+
+func (c IndexConfig) applyDefaults() IndexConfig {
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = time.Hour
+	}
+	if len(c.Prefixes) == 0 {
+		c.Prefixes = []string{""}
+	}
+	return c
+}
+
+// covers returns true if every tag starting with prefix is indexed.
+func (c IndexConfig) covers(prefix string) bool {
+	for _, p := range c.Prefixes {
+		if strings.HasPrefix(prefix, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// BackfillConfig defines how the existing tags of a prefix are replicated to a
+// remote on request, e.g. after the remote was added.
+type BackfillConfig struct {
+	// Concurrency is the number of tags a backfill replicates at once.
+	Concurrency int `yaml:"concurrency"`
+
+	// MaxTagsPerSecond limits the rate at which a backfill replicates tags,
+	// such that it leaves bandwidth to replications of new tags. Unlimited if
+	// 0.
+	MaxTagsPerSecond float64 `yaml:"max_tags_per_second"`
+}
+
+func (c BackfillConfig) applyDefaults() BackfillConfig {
+	if c.Concurrency == 0 {
+		c.Concurrency = 4
+	}
+	return c
 }
 
 func (c Config) applyDefaults() Config {
@@ -33,5 +113,8 @@ func (c Config) applyDefaults() Config {
 	if c.DuplicatePutStagger == 0 {
 		c.DuplicatePutStagger = 20 * time.Minute
 	}
+	c.GC = c.GC.applyDefaults()
+	c.Index = c.Index.applyDefaults()
+	c.Backfill = c.Backfill.applyDefaults()
 	return c
 }
@@ -0,0 +1,172 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// _gcListPageSize is the number of tags listed per backend request while
+// marking.
+const _gcListPageSize = 1000
+
+// marker holds the last set of digests marked reachable from live tags.
+type marker struct {
+	mu        sync.Mutex
+	reachable *tagmodels.ReachableResponse
+}
+
+func (m *marker) get() *tagmodels.ReachableResponse {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reachable
+}
+
+func (m *marker) set(r *tagmodels.ReachableResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reachable = r
+}
+
+// MarkReachable periodically marks the digests reachable from live tags, which
+// origins fetch to collect unreachable blobs, until stop is closed. Noop if
+// garbage collection is disabled.
+func (s *Server) MarkReachable(stop <-chan struct{}) {
+	if !s.config.GC.Enabled {
+		return
+	}
+	for {
+		if err := s.markReachable(); err != nil {
+			log.Errorf("Error marking reachable digests: %s", err)
+			s.stats.Counter("gc_mark_failures").Inc(1)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(s.config.GC.Interval):
+		}
+	}
+}
+
+// markReachable lists every live tag and resolves the digests it depends on.
+// A partial set would let origins collect live blobs, so the previous set is
+// kept if any tag fails to resolve.
+func (s *Server) markReachable() error {
+	start := time.Now()
+	reachable := make(map[core.Digest]bool)
+	// Many tags point to the same digest, e.g. "latest" and a version, so
+	// dependencies are resolved once per digest.
+	resolved := make(map[core.Digest]bool)
+	var tags int
+	for _, prefix := range s.config.GC.Prefixes {
+		err := s.listTags(prefix, func(tag string) error {
+			d, err := s.store.Get(tag)
+			if err != nil {
+				if err == tagstore.ErrTagNotFound {
+					// Deleted since it was listed.
+					return nil
+				}
+				return fmt.Errorf("get tag %s: %s", tag, err)
+			}
+			tags++
+			reachable[d] = true
+			if resolved[d] {
+				return nil
+			}
+			deps, err := s.depResolver.Resolve(tag, d)
+			if err != nil {
+				return fmt.Errorf("resolve dependencies of tag %s: %s", tag, err)
+			}
+			for _, dep := range deps {
+				reachable[dep] = true
+			}
+			resolved[d] = true
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("prefix %q: %s", prefix, err)
+		}
+	}
+	digests := make(core.DigestList, 0, len(reachable))
+	for d := range reachable {
+		digests = append(digests, d)
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].String() < digests[j].String() })
+
+	s.marker.set(&tagmodels.ReachableResponse{
+		MarkedAt: start,
+		Tags:     tags,
+		Digests:  digests,
+	})
+	s.stats.Gauge("gc_reachable_digests").Update(float64(len(digests)))
+	s.stats.Timer("gc_mark").Record(time.Since(start))
+	log.With("tags", tags, "digests", len(digests)).Info("Marked digests reachable from live tags")
+	return nil
+}
+
+// listTags calls f for every tag starting with prefix in the storage backend.
+func (s *Server) listTags(prefix string, f func(tag string) error) error {
+	client, err := s.backends.GetClient(prefix)
+	if err != nil {
+		return fmt.Errorf("backend manager: %s", err)
+	}
+	var token string
+	for {
+		result, err := client.List(
+			prefix,
+			backend.ListWithPagination(),
+			backend.ListWithMaxKeys(_gcListPageSize),
+			backend.ListWithContinuationToken(token))
+		if err != nil {
+			return fmt.Errorf("list: %s", err)
+		}
+		for _, tag := range result.Names {
+			if err := f(tag); err != nil {
+				return err
+			}
+		}
+		if result.ContinuationToken == "" {
+			return nil
+		}
+		token = result.ContinuationToken
+	}
+}
+
+// getReachableHandler returns the last set of digests marked reachable from
+// live tags. Response model tagmodels.ReachableResponse.
+func (s *Server) getReachableHandler(w http.ResponseWriter, r *http.Request) error {
+	if !s.config.GC.Enabled {
+		return handler.Errorf("gc disabled").Status(http.StatusNotFound)
+	}
+	reachable := s.marker.get()
+	if reachable == nil {
+		return handler.Errorf("reachable digests not marked yet").Status(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(reachable); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func sortedDigests(l ...core.Digest) core.DigestList {
+	sort.Slice(l, func(i, j int) bool { return l[i].String() < l[j].String() })
+	return l
+}
+
+func TestMarkReachable(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.GC.Enabled = true
+	server := mocks.server()
+
+	addr, stop := testutil.StartServer(server.Handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	manifest1 := core.DigestFixture()
+	manifest2 := core.DigestFixture()
+	layer1 := core.DigestFixture()
+	layer2 := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().List("", gomock.Any()).Return(&backend.ListResult{
+		Names:             []string{"repo:a", "repo:latest"},
+		ContinuationToken: "next",
+	}, nil)
+	mocks.backendClient.EXPECT().List("", gomock.Any()).Return(&backend.ListResult{
+		Names: []string{"repo:b"},
+	}, nil)
+
+	mocks.store.EXPECT().Get("repo:a").Return(manifest1, nil)
+	mocks.store.EXPECT().Get("repo:latest").Return(manifest1, nil)
+	mocks.store.EXPECT().Get("repo:b").Return(manifest2, nil)
+
+	// Tags pointing to the same digest are only resolved once.
+	mocks.depResolver.EXPECT().Resolve(gomock.Any(), manifest1).Return(
+		core.DigestList{layer1, manifest1}, nil)
+	mocks.depResolver.EXPECT().Resolve("repo:b", manifest2).Return(
+		core.DigestList{layer1, layer2, manifest2}, nil)
+
+	require.NoError(server.markReachable())
+
+	reachable, err := client.Reachable()
+	require.NoError(err)
+	require.Equal(3, reachable.Tags)
+	require.Equal(sortedDigests(manifest1, manifest2, layer1, layer2), reachable.Digests)
+	require.False(reachable.MarkedAt.IsZero())
+}
+
+func TestMarkReachableKeepsPreviousSetOnError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.GC.Enabled = true
+	server := mocks.server()
+
+	addr, stop := testutil.StartServer(server.Handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	manifest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().List("", gomock.Any()).Return(&backend.ListResult{
+		Names: []string{"repo:a"},
+	}, nil).Times(2)
+	mocks.store.EXPECT().Get("repo:a").Return(manifest, nil).Times(2)
+
+	gomock.InOrder(
+		mocks.depResolver.EXPECT().Resolve("repo:a", manifest).Return(
+			core.DigestList{manifest}, nil),
+		mocks.depResolver.EXPECT().Resolve("repo:a", manifest).Return(
+			nil, errors.New("some error")),
+	)
+
+	require.NoError(server.markReachable())
+	require.Error(server.markReachable())
+
+	reachable, err := client.Reachable()
+	require.NoError(err)
+	require.Equal(core.DigestList{manifest}, reachable.Digests)
+}
+
+func TestGetReachable(t *testing.T) {
+	tests := []struct {
+		desc    string
+		enabled bool
+		status  int
+	}{
+		{"disabled", false, 404},
+		{"not marked yet", true, 503},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			mocks.config.GC.Enabled = test.enabled
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := newClusterClient(addr).Reachable()
+			require.True(t, httputil.IsStatus(err, test.status))
+		})
+	}
+}
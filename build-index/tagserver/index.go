@@ -0,0 +1,349 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+var errInvalidIndexToken = errors.New("invalid continuation token")
+
+// indexEntry is an indexed tag.
+type indexEntry struct {
+	// modTime is when the tag was last put on this build-index. Zero for
+	// tags only seen in the storage backend.
+	modTime time.Time
+
+	// listed is set once the tag was seen in the storage backend. Tags put on
+	// this build-index are kept by refreshes until then, since they may not
+	// be written back yet.
+	listed bool
+}
+
+// tagIndex indexes tag names in memory, so listings can be filtered, sorted
+// and paginated without listing the storage backend.
+type tagIndex struct {
+	mu      sync.RWMutex
+	ready   bool
+	entries map[string]indexEntry
+
+	// deleted holds tags deleted on this build-index. Storage backend
+	// listings may lag behind deletions, so deleted tags may still be listed
+	// there.
+	deleted map[string]bool
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		entries: make(map[string]indexEntry),
+		deleted: make(map[string]bool),
+	}
+}
+
+func (i *tagIndex) isReady() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.ready
+}
+
+func (i *tagIndex) size() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.entries)
+}
+
+// put records that tag was put at t.
+func (i *tagIndex) put(tag string, t time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	e := i.entries[tag]
+	e.modTime = t
+	i.entries[tag] = e
+	delete(i.deleted, tag)
+}
+
+// remove records that tag was deleted.
+func (i *tagIndex) remove(tag string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.entries, tag)
+	i.deleted[tag] = true
+}
+
+// replace replaces the indexed tags with the tags listed in the storage
+// backend, keeping the tags put on this build-index which were not listed yet.
+func (i *tagIndex) replace(listed []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entries := make(map[string]indexEntry, len(listed))
+	for _, tag := range listed {
+		if i.deleted[tag] {
+			continue
+		}
+		entries[tag] = indexEntry{modTime: i.entries[tag].modTime, listed: true}
+	}
+	for tag, e := range i.entries {
+		if _, ok := entries[tag]; !ok && !e.listed {
+			entries[tag] = e
+		}
+	}
+	i.entries = entries
+	i.ready = true
+}
+
+// indexedTag is a tag returned by an index query.
+type indexedTag struct {
+	name    string
+	modTime time.Time
+}
+
+// indexQuery selects and orders indexed tags.
+type indexQuery struct {
+	prefix string
+
+	// strip removes prefix from returned names. Regexps match stripped names.
+	strip bool
+
+	regexp *regexp.Regexp
+	sortBy string
+
+	// limit is the maximum number of tags returned. 0 returns all tags.
+	limit int
+
+	// token continues the listing after the last tag of a previous page.
+	token string
+}
+
+func (q indexQuery) less(a, b indexedTag) bool {
+	if q.sortBy == tagmodels.SortByModTime && !a.modTime.Equal(b.modTime) {
+		return a.modTime.After(b.modTime)
+	}
+	return a.name < b.name
+}
+
+// encodeToken encodes the position of t as an opaque continuation token.
+func (q indexQuery) encodeToken(t indexedTag) string {
+	s := t.name
+	if q.sortBy == tagmodels.SortByModTime {
+		s = t.modTime.Format(time.RFC3339Nano) + " " + t.name
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func (q indexQuery) decodeToken(token string) (indexedTag, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return indexedTag{}, errInvalidIndexToken
+	}
+	s := string(b)
+	if q.sortBy != tagmodels.SortByModTime {
+		return indexedTag{name: s}, nil
+	}
+	parts := strings.SplitN(s, " ", 2)
+	if len(parts) != 2 {
+		return indexedTag{}, errInvalidIndexToken
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return indexedTag{}, errInvalidIndexToken
+	}
+	return indexedTag{name: parts[1], modTime: t}, nil
+}
+
+// query returns a page of the tags selected by q, and the token of the next
+// page if any.
+func (i *tagIndex) query(q indexQuery) ([]indexedTag, string, error) {
+	var after *indexedTag
+	if q.token != "" {
+		t, err := q.decodeToken(q.token)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &t
+	}
+
+	var tags []indexedTag
+	i.mu.RLock()
+	for tag, e := range i.entries {
+		if !strings.HasPrefix(tag, q.prefix) {
+			continue
+		}
+		name := tag
+		if q.strip {
+			name = tag[len(q.prefix):]
+		}
+		if q.regexp != nil && !q.regexp.MatchString(name) {
+			continue
+		}
+		t := indexedTag{name, e.modTime}
+		if after != nil && !q.less(*after, t) {
+			continue
+		}
+		tags = append(tags, t)
+	}
+	i.mu.RUnlock()
+
+	sort.Slice(tags, func(a, b int) bool { return q.less(tags[a], tags[b]) })
+
+	var next string
+	if q.limit > 0 && len(tags) > q.limit {
+		tags = tags[:q.limit]
+		next = q.encodeToken(tags[len(tags)-1])
+	}
+	return tags, next, nil
+}
+
+// indexTag records that tag was just put, if the tag index is enabled.
+func (s *Server) indexTag(tag string) {
+	if s.config.Index.Enabled {
+		s.index.put(tag, time.Now())
+	}
+}
+
+// unindexTag records that tag was just deleted, if the tag index is enabled.
+func (s *Server) unindexTag(tag string) {
+	if s.config.Index.Enabled {
+		s.index.remove(tag)
+	}
+}
+
+// IndexTags periodically rebuilds the tag index from the storage backend until
+// stop is closed. Noop if the index is disabled. Listings are served by the
+// storage backend until the first build finishes.
+func (s *Server) IndexTags(stop <-chan struct{}) {
+	if !s.config.Index.Enabled {
+		return
+	}
+	for {
+		if err := s.refreshIndex(); err != nil {
+			log.Errorf("Error refreshing tag index: %s", err)
+			s.stats.Counter("tag_index_refresh_failures").Inc(1)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(s.config.Index.RefreshInterval):
+		}
+	}
+}
+
+func (s *Server) refreshIndex() error {
+	start := time.Now()
+	var tags []string
+	for _, prefix := range s.config.Index.Prefixes {
+		err := s.listTags(prefix, func(tag string) error {
+			tags = append(tags, tag)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("prefix %q: %s", prefix, err)
+		}
+	}
+	s.index.replace(tags)
+	s.stats.Gauge("tag_index_size").Update(float64(s.index.size()))
+	s.stats.Timer("tag_index_refresh").Record(time.Since(start))
+	log.With("tags", len(tags)).Info("Refreshed tag index")
+	return nil
+}
+
+// indexed returns true if listings of prefix are served by the tag index.
+// Listings which filter or sort names require the index.
+func (s *Server) indexed(prefix string, r *http.Request) (bool, error) {
+	q := r.URL.Query()
+	required := q.Has(tagmodels.RegexQ) || q.Has(tagmodels.SortQ)
+	if !s.config.Index.Enabled || !s.config.Index.covers(prefix) {
+		if required {
+			return false, handler.Errorf(
+				"filtering and sorting require the tag index").Status(http.StatusBadRequest)
+		}
+		return false, nil
+	}
+	if !s.index.isReady() {
+		if required {
+			return false, handler.Errorf(
+				"tag index is not built yet").Status(http.StatusServiceUnavailable)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// listFromIndex lists the tags starting with prefix from the tag index.
+// Response model tagmodels.ListResponse.
+func (s *Server) listFromIndex(
+	w http.ResponseWriter, r *http.Request, prefix string, strip bool) error {
+
+	q := indexQuery{prefix: prefix, strip: strip, sortBy: tagmodels.SortByName}
+	for k, v := range r.URL.Query() {
+		if len(v) != 1 {
+			return handler.Errorf(
+				"invalid query %s:%s", k, v).Status(http.StatusBadRequest)
+		}
+		switch k {
+		case tagmodels.LimitQ:
+			limit, err := strconv.Atoi(v[0])
+			if err != nil || limit <= 0 {
+				return handler.Errorf("invalid limit %s", v[0]).Status(http.StatusBadRequest)
+			}
+			q.limit = limit
+		case tagmodels.OffsetQ:
+			q.token = v[0]
+		case tagmodels.RegexQ:
+			re, err := regexp.Compile(v[0])
+			if err != nil {
+				return handler.Errorf("invalid regex: %s", err).Status(http.StatusBadRequest)
+			}
+			q.regexp = re
+		case tagmodels.SortQ:
+			if v[0] != tagmodels.SortByName && v[0] != tagmodels.SortByModTime {
+				return handler.Errorf("invalid sort %s", v[0]).Status(http.StatusBadRequest)
+			}
+			q.sortBy = v[0]
+		default:
+			return handler.Errorf("invalid query %s", k).Status(http.StatusBadRequest)
+		}
+	}
+	tags, next, err := s.index.query(q)
+	if err == errInvalidIndexToken {
+		return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+	} else if err != nil {
+		return handler.Errorf("query index: %s", err)
+	}
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.name
+	}
+	resp, err := buildPaginationResponse(r.URL, next, names)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
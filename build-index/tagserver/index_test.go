@@ -0,0 +1,185 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func TestTagIndexReplaceKeepsUnlistedPuts(t *testing.T) {
+	require := require.New(t)
+
+	index := newTagIndex()
+	require.False(index.isReady())
+
+	now := time.Now()
+	index.put("repo:new", now)
+	index.replace([]string{"repo:a"})
+	require.True(index.isReady())
+
+	tags, _, err := index.query(indexQuery{prefix: "repo:"})
+	require.NoError(err)
+	require.Equal([]indexedTag{{"repo:a", time.Time{}}, {"repo:new", now}}, tags)
+
+	// Once listed, tags missing from the backend are dropped.
+	index.replace([]string{"repo:new"})
+	index.replace([]string{"repo:a"})
+
+	tags, _, err = index.query(indexQuery{prefix: "repo:"})
+	require.NoError(err)
+	require.Equal([]indexedTag{{"repo:a", time.Time{}}}, tags)
+}
+
+func TestTagIndexRemoveSurvivesReplace(t *testing.T) {
+	require := require.New(t)
+
+	index := newTagIndex()
+	index.replace([]string{"repo:a", "repo:b"})
+
+	// Backend listings may lag behind deletions.
+	index.remove("repo:a")
+	index.replace([]string{"repo:a", "repo:b"})
+
+	tags, _, err := index.query(indexQuery{prefix: "repo:"})
+	require.NoError(err)
+	require.Equal([]indexedTag{{"repo:b", time.Time{}}}, tags)
+
+	// Putting a deleted tag indexes it again.
+	now := time.Now()
+	index.put("repo:a", now)
+	index.replace([]string{"repo:a", "repo:b"})
+
+	tags, _, err = index.query(indexQuery{prefix: "repo:"})
+	require.NoError(err)
+	require.Equal([]indexedTag{{"repo:a", now}, {"repo:b", time.Time{}}}, tags)
+}
+
+func TestListFromIndex(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Index.Enabled = true
+	server := mocks.server()
+
+	addr, stop := testutil.StartServer(server.Handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	mocks.backendClient.EXPECT().List("", gomock.Any()).Return(&backend.ListResult{
+		Names: []string{"repo:a", "repo:b", "repo:v1", "other:c"},
+	}, nil)
+	require.NoError(server.refreshIndex())
+
+	now := time.Now()
+	server.index.put("repo:b", now)
+	server.index.put("repo:v1", now.Add(time.Second))
+
+	resp, err := client.ListWithPagination("repo", tagclient.ListFilter{Regex: "^repo:v"})
+	require.NoError(err)
+	require.Equal([]string{"repo:v1"}, resp.Result)
+
+	resp, err = client.ListRepositoryWithPagination("repo", tagclient.ListFilter{
+		Sort: tagmodels.SortByModTime,
+	})
+	require.NoError(err)
+	require.Equal([]string{"v1", "b", "a"}, resp.Result)
+
+	// Pages keep the filter and sort of the first page.
+	filter := tagclient.ListFilter{Limit: 1, Regex: "^[ab]$", Sort: tagmodels.SortByModTime}
+	var names []string
+	for {
+		resp, err := client.ListRepositoryWithPagination("repo", filter)
+		require.NoError(err)
+		names = append(names, resp.Result...)
+		filter.Offset, err = resp.GetOffset()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(err)
+	}
+	require.Equal([]string{"b", "a"}, names)
+
+	// Unfiltered listings are served by the index too.
+	tags, err := client.List("")
+	require.NoError(err)
+	require.Equal([]string{"other:c", "repo:a", "repo:b", "repo:v1"}, tags)
+}
+
+func TestListFromIndexInvalidQuery(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.Index.Enabled = true
+	server := mocks.server()
+
+	addr, stop := testutil.StartServer(server.Handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	mocks.backendClient.EXPECT().List("", gomock.Any()).Return(&backend.ListResult{}, nil)
+	require.NoError(server.refreshIndex())
+
+	for _, filter := range []tagclient.ListFilter{
+		{Regex: "("},
+		{Sort: "size"},
+		{Offset: "!"},
+	} {
+		_, err := client.ListWithPagination("repo", filter)
+		require.True(httputil.IsStatus(err, http.StatusBadRequest), "filter %+v", filter)
+	}
+}
+
+func TestListFilterRequiresIndex(t *testing.T) {
+	tests := []struct {
+		desc    string
+		enabled bool
+		status  int
+	}{
+		{"disabled", false, http.StatusBadRequest},
+		{"not built yet", true, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			mocks.config.Index.Enabled = test.enabled
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := newClusterClient(addr).ListWithPagination(
+				"repo", tagclient.ListFilter{Sort: tagmodels.SortByName})
+			require.True(t, httputil.IsStatus(err, test.status))
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagpolicy"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/core"
@@ -34,6 +35,7 @@ import (
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/tagevent"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/handler"
@@ -61,8 +63,24 @@ type Server struct {
 	tagReplicationManager persistedretry.Manager
 	provider              tagclient.Provider
 
+	// For replicating existing tags to remotes.
+	backfills  *tagreplication.BackfillStore
+	backfiller *backfiller
+
 	// For checking if a tag has all dependent blobs.
 	depResolver tagtype.DependencyResolver
+
+	// For rejecting puts which violate tag policies.
+	policies *tagpolicy.Policies
+
+	// For notifying sinks of tag changes.
+	events *tagevent.Emitter
+
+	// For garbage collection of blobs unreachable from live tags.
+	marker *marker
+
+	// For filtered and sorted tag listings.
+	index *tagIndex
 }
 
 // New creates a new Server.
@@ -78,6 +96,9 @@ func New(
 	tagReplicationManager persistedretry.Manager,
 	provider tagclient.Provider,
 	depResolver tagtype.DependencyResolver,
+	policies *tagpolicy.Policies,
+	events *tagevent.Emitter,
+	backfills *tagreplication.BackfillStore,
 ) *Server {
 	config = config.applyDefaults()
 
@@ -97,6 +118,12 @@ func New(
 		tagReplicationManager: tagReplicationManager,
 		provider:              provider,
 		depResolver:           depResolver,
+		policies:              policies,
+		events:                events,
+		backfills:             backfills,
+		backfiller:            newBackfiller(),
+		marker:                &marker{},
+		index:                 newTagIndex(),
 	}
 }
 
@@ -113,15 +140,26 @@ func (s *Server) Handler() http.Handler {
 	r.Put("/tags/{tag}/digest/{digest}", handler.Wrap(s.putTagHandler))
 	r.Head("/tags/{tag}", handler.Wrap(s.hasTagHandler))
 	r.Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
+	r.Delete("/tags/{tag}", handler.Wrap(s.deleteTagHandler))
+	r.Delete("/tags/{tag}/digest/{digest}", handler.Wrap(s.replicateDeleteTagHandler))
 
 	r.Get("/repositories/{repo}/tags", handler.Wrap(s.listRepositoryHandler))
 
 	r.Get("/list/*", handler.Wrap(s.listHandler))
 
 	r.Post("/remotes/tags/{tag}", handler.Wrap(s.replicateTagHandler))
+	r.Post("/remotes/backfills", handler.Wrap(s.backfillHandler))
+	r.Get("/remotes/backfills", handler.Wrap(s.listBackfillsHandler))
 
 	r.Get("/origin", handler.Wrap(s.getOriginHandler))
 
+	r.Get("/policies/tags/{tag}/digest/{digest}", handler.Wrap(s.checkPolicyHandler))
+
+	r.Get("/history/tags/{tag}", handler.Wrap(s.historyHandler))
+	r.Post("/rollback/tags/{tag}/digest/{digest}", handler.Wrap(s.rollbackHandler))
+
+	r.Get("/gc/reachable", handler.Wrap(s.getReachableHandler))
+
 	r.Post(
 		"/internal/duplicate/remotes/tags/{tag}/digest/{digest}",
 		handler.Wrap(s.duplicateReplicateTagHandler))
@@ -130,6 +168,10 @@ func (s *Server) Handler() http.Handler {
 		"/internal/duplicate/tags/{tag}/digest/{digest}",
 		handler.Wrap(s.duplicatePutTagHandler))
 
+	r.Delete(
+		"/internal/duplicate/tags/{tag}",
+		handler.Wrap(s.duplicateDeleteTagHandler))
+
 	r.Mount("/debug", chimiddleware.Profiler())
 
 	return r
@@ -183,6 +225,42 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 		return fmt.Errorf("parse query arg `replicate`: %w", err)
 	}
 
+	// Puts replicated from remote build-indexes carry when the replication
+	// was created, so that deletions made since then are not undone.
+	var createdAt time.Time
+	if v := httputil.GetQueryArg(r, "created_at", ""); v != "" {
+		createdAt, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return handler.Errorf(
+				"parse query arg `created_at`: %s", err).Status(http.StatusBadRequest)
+		}
+		deletedAt, err := s.store.DeletedAt(tag)
+		if err != nil {
+			return handler.Errorf("storage: %s", err)
+		}
+		if deletedAt.After(createdAt) {
+			log.With("tag", tag, "digest", d.String(), "deleted_at", deletedAt, "created_at", createdAt).Info("Rejecting put of tag deleted since replication")
+			return handler.Errorf("tag deleted at %s", deletedAt.Format(time.RFC3339Nano)).Status(http.StatusConflict)
+		}
+	}
+
+	if err := s.checkPolicy(tag, d); err != nil {
+		return err
+	}
+
+	var event tagevent.EventType
+	if s.events.Enabled(tag) {
+		prev, err := s.store.Get(tag)
+		switch {
+		case err == tagstore.ErrTagNotFound:
+			event = tagevent.Created
+		case err != nil:
+			return handler.Errorf("storage: %s", err)
+		case prev != d:
+			event = tagevent.Updated
+		}
+	}
+
 	log.With("tag", tag, "digest", d.String(), "replicate", replicate).Info("Putting tag")
 
 	deps, err := s.depResolver.Resolve(tag, d)
@@ -202,16 +280,61 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 
 	if replicate {
 		log.With("tag", tag, "digest", d.String()).Info("Starting tag replication")
-		if err := s.replicateTag(tag, d, deps); err != nil {
+		if err := s.replicateTag(tag, d, deps, createdAt); err != nil {
 			log.With("tag", tag, "digest", d.String(), "error", err).Error("Failed to replicate tag")
 			return err
 		}
 		log.With("tag", tag, "digest", d.String()).Info("Successfully replicated tag")
 	}
+	if event != "" {
+		s.emit(event, tag, d, !createdAt.IsZero())
+	}
 	w.WriteHeader(http.StatusOK)
 	return nil
 }
 
+// checkPolicyHandler checks whether putting a tag would violate its policy,
+// without putting it.
+func (s *Server) checkPolicyHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	return s.checkPolicy(tag, d)
+}
+
+// checkPolicy returns a handler error if putting tag to d violates the policy
+// of tag. Violations carry their reason in the tagpolicy.ViolationHeader.
+func (s *Server) checkPolicy(tag string, d core.Digest) error {
+	err := s.policies.Check(tag, d, func() (core.Digest, bool, error) {
+		cur, err := s.store.Get(tag)
+		if err == tagstore.ErrTagNotFound {
+			return core.Digest{}, false, nil
+		} else if err != nil {
+			return core.Digest{}, false, err
+		}
+		return cur, true, nil
+	})
+	if v, ok := err.(*tagpolicy.Violation); ok {
+		log.With("tag", tag, "digest", d.String(), "reason", v.Reason).Info("Rejecting tag policy violation")
+		s.stats.Tagged(map[string]string{"reason": v.Reason}).Counter("policy_violations").Inc(1)
+		status := http.StatusBadRequest
+		if v.Reason == tagpolicy.ReasonImmutable {
+			status = http.StatusConflict
+		}
+		return handler.Errorf("%s", v.Message).
+			Status(status).
+			Header(tagpolicy.ViolationHeader, v.Reason)
+	} else if err != nil {
+		return handler.Errorf("check tag policy: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
@@ -234,6 +357,7 @@ func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request)
 		log.With("tag", tag, "digest", d.String(), "delay", delay, "error", err).Error("Failed to store tag from duplicate put")
 		return handler.Errorf("storage: %s", err)
 	}
+	s.indexTag(tag)
 
 	log.With("tag", tag, "digest", d.String(), "delay", delay).Info("Successfully stored tag from duplicate put")
 
@@ -288,11 +412,182 @@ func (s *Server) hasTagHandler(w http.ResponseWriter, r *http.Request) error {
 		log.With("tag", tag).Errorf("Failed to check tag existence: %s", err)
 		return err
 	}
+	// Backends may still serve deleted tags for a while, as may tombstones
+	// uploaded by older build-indexes.
+	deletedAt, err := s.store.DeletedAt(tag)
+	if err != nil {
+		return handler.Errorf("storage: %s", err)
+	}
+	if !deletedAt.IsZero() {
+		log.With("tag", tag).Debug("Tag was deleted")
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
 
 	log.With("tag", tag).Debug("Tag exists in backend")
 	return nil
 }
 
+// deleteTagHandler deletes a tag and replicates the deletion to remote
+// build-indexes.
+func (s *Server) deleteTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+
+	d, err := s.store.Get(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+
+	log.With("tag", tag, "digest", d.String()).Info("Deleting tag")
+
+	deletedAt := time.Now()
+	if err := s.deleteTag(tag, deletedAt); err != nil {
+		return err
+	}
+	s.emit(tagevent.Deleted, tag, d, false)
+	return s.replicateDelete(tag, d, deletedAt)
+}
+
+// replicateDeleteTagHandler applies the deletion of a tag replicated from a
+// remote build-index. Deletions older than the tag's current tombstone are
+// no-ops, which also stops replication loops between build-indexes.
+func (s *Server) replicateDeleteTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	deletedAt, err := time.Parse(time.RFC3339Nano, httputil.GetQueryArg(r, "deleted_at", ""))
+	if err != nil {
+		return handler.Errorf(
+			"parse query arg `deleted_at`: %s", err).Status(http.StatusBadRequest)
+	}
+
+	prev, err := s.store.DeletedAt(tag)
+	if err != nil {
+		return handler.Errorf("storage: %s", err)
+	}
+	if !prev.Before(deletedAt) {
+		log.With("tag", tag, "deleted_at", deletedAt).Debug("Tag deletion already applied")
+		return nil
+	}
+
+	log.With("tag", tag, "digest", d.String(), "deleted_at", deletedAt).Info("Applying replicated tag deletion")
+
+	if err := s.deleteTag(tag, deletedAt); err != nil {
+		return err
+	}
+	s.emit(tagevent.Deleted, tag, d, true)
+	return s.replicateDelete(tag, d, deletedAt)
+}
+
+func (s *Server) duplicateDeleteTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+
+	var req tagclient.DuplicateDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("decode body: %s", err)
+	}
+
+	log.With("tag", tag, "deleted_at", req.DeletedAt).Debug("Received duplicate delete request from neighbor")
+
+	if err := s.store.Delete(tag, req.DeletedAt); err != nil {
+		return handler.Errorf("storage: %s", err)
+	}
+	s.unindexTag(tag)
+	return nil
+}
+
+// historyHandler returns the digests a tag pointed to before. Response model
+// tagmodels.HistoryResponse.
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	versions, err := s.store.History(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+	if versions == nil {
+		versions = []tagmodels.Version{}
+	}
+	resp := tagmodels.HistoryResponse{Tag: tag, Versions: versions}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// rollbackHandler moves a tag back to a digest from its history. The rollback
+// is duplicated to neighbors and replicated to remotes like a put, and is
+// itself recorded in the history of the tag.
+func (s *Server) rollbackHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+
+	versions, err := s.store.History(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+	var found bool
+	for _, v := range versions {
+		if v.Digest == d {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return handler.Errorf(
+			"digest %s not in history of tag", d).Status(http.StatusNotFound)
+	}
+
+	event := tagevent.Updated
+	if s.events.Enabled(tag) {
+		if _, err := s.store.Get(tag); err == tagstore.ErrTagNotFound {
+			event = tagevent.Created
+		}
+	}
+
+	log.With("tag", tag, "digest", d.String()).Info("Rolling back tag")
+
+	deps, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		return fmt.Errorf("resolve dependencies: %w", err)
+	}
+	if err := s.putTag(tag, d, deps); err != nil {
+		return err
+	}
+	if err := s.replicateTag(tag, d, deps, time.Time{}); err != nil {
+		return err
+	}
+	s.emit(event, tag, d, false)
+	return nil
+}
+
 // listHandler handles list images request. Response model
 // tagmodels.ListResponse.
 func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
@@ -300,6 +595,12 @@ func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 
 	log.With("prefix", prefix).Debug("Listing tags with prefix")
 
+	if ok, err := s.indexed(prefix, r); err != nil {
+		return err
+	} else if ok {
+		return s.listFromIndex(w, r, prefix, false)
+	}
+
 	client, err := s.backends.GetClient(prefix)
 	if err != nil {
 		log.With("prefix", prefix, "error", err).Error("Failed to get backend client for list")
@@ -341,6 +642,13 @@ func (s *Server) listRepositoryHandler(w http.ResponseWriter, r *http.Request) e
 
 	log.With("repository", repo).Debug("Listing repository tags")
 
+	// Tags of repo are named "<repo>:<tag>".
+	if ok, err := s.indexed(repo+":", r); err != nil {
+		return err
+	} else if ok {
+		return s.listFromIndex(w, r, repo+":", true)
+	}
+
 	client, err := s.backends.GetClient(repo)
 	if err != nil {
 		log.With("repository", repo).Errorf("Failed to get backend client for repository list: %s", err)
@@ -409,7 +717,7 @@ func (s *Server) replicateTagHandler(w http.ResponseWriter, r *http.Request) err
 
 	log.With("tag", tag, "digest", d.String(), "dependency_count", len(deps)).Debug("Resolved dependencies for replication")
 
-	if err := s.replicateTag(tag, d, deps); err != nil {
+	if err := s.replicateTag(tag, d, deps, time.Time{}); err != nil {
 		log.With("tag", tag, "digest", d.String()).Errorf("Failed to replicate tag: %s", err)
 		return err
 	}
@@ -477,6 +785,7 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 	if err := s.store.Put(tag, d, 0); err != nil {
 		return fmt.Errorf("storage: %w", err)
 	}
+	s.indexTag(tag)
 
 	log.With("tag", tag, "digest", d.String()).Info("Tag stored locally")
 
@@ -507,7 +816,58 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 	return nil
 }
 
-func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) error {
+// deleteTag writes a tombstone for tag locally and on all neighbors.
+func (s *Server) deleteTag(tag string, deletedAt time.Time) error {
+	if err := s.store.Delete(tag, deletedAt); err != nil {
+		return handler.Errorf("storage: %s", err)
+	}
+	s.unindexTag(tag)
+
+	neighbors := s.neighbors.Resolve()
+	var successes int
+	for addr := range neighbors {
+		client := s.provider.Provide(addr)
+		if err := client.DuplicateDelete(tag, deletedAt); err != nil {
+			log.With("tag", tag, "neighbor", addr, "error", err).Error("Failed to duplicate delete to neighbor")
+		} else {
+			successes++
+		}
+	}
+	if len(neighbors) != 0 && successes == 0 {
+		s.stats.Counter("duplicate_delete_failures").Inc(1)
+		log.With("tag", tag, "neighbor_count", len(neighbors)).Error("All neighbor deletions failed")
+	}
+	return nil
+}
+
+// emit notifies sinks of a change of tag. Since the change was already made,
+// failures are only logged.
+func (s *Server) emit(typ tagevent.EventType, tag string, d core.Digest, replicated bool) {
+	if err := s.events.Emit(typ, tag, d, replicated); err != nil {
+		s.stats.Counter("emit_event_failures").Inc(1)
+		log.With("tag", tag, "digest", d.String(), "type", typ).Errorf("Failed to emit tag event: %s", err)
+	}
+}
+
+// replicateDelete adds tasks which replicate the tombstone of tag to remote
+// build-indexes.
+func (s *Server) replicateDelete(tag string, d core.Digest, deletedAt time.Time) error {
+	for _, dest := range s.remotes.Match(tag) {
+		task := tagreplication.NewTombstoneTask(tag, d, dest, deletedAt)
+		if err := s.tagReplicationManager.Add(task); err != nil {
+			return handler.Errorf("add replicate delete task: %s", err)
+		}
+		log.With("tag", tag, "destination", dest).Debug("Added remote tombstone replication task")
+	}
+	return nil
+}
+
+// replicateTag adds tasks which replicate tag to remote build-indexes. If set,
+// createdAt is when the replication was originally created on a remote
+// build-index.
+func (s *Server) replicateTag(
+	tag string, d core.Digest, deps core.DigestList, createdAt time.Time) error {
+
 	destinations := s.remotes.Match(tag)
 
 	log.With("tag", tag, "digest", d.String(), "destination_count", len(destinations)).Debug("Checking remote destinations for tag replication")
@@ -521,6 +881,9 @@ func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) e
 
 	for _, dest := range destinations {
 		task := tagreplication.NewTask(tag, d, deps, dest, 0)
+		if !createdAt.IsZero() {
+			task.CreatedAt = createdAt
+		}
 		if err := s.tagReplicationManager.Add(task); err != nil {
 			return fmt.Errorf("add replicate task: %w", err)
 		}
@@ -600,12 +963,10 @@ func buildPaginationResponse(u *url.URL, continuationToken string,
 			return nil, handler.Errorf(
 				"invalid url string: %s", err).Status(http.StatusBadRequest)
 		}
-		v := url.Values{}
-		if limit := u.Query().Get(tagmodels.LimitQ); limit != "" {
-			v.Add(tagmodels.LimitQ, limit)
-		}
+		// Keep the limit, filter and sort of the query.
+		v := u.Query()
 		// ContinuationToken cannot be empty here.
-		v.Add(tagmodels.OffsetQ, continuationToken)
+		v.Set(tagmodels.OffsetQ, continuationToken)
 		nextUrl.RawQuery = v.Encode()
 		nextUrlString = nextUrl.String()
 	}
@@ -28,13 +28,17 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagpolicy"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/persistedretry/tagevent"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/localdb"
 	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
 	mocktagstore "github.com/uber/kraken/mocks/build-index/tagstore"
 	mocktagtype "github.com/uber/kraken/mocks/build-index/tagtype"
@@ -50,6 +54,7 @@ const (
 	_testOrigin    = "some-dns-record"
 	_testRemote    = "remote-build-index"
 	_testNeighbor  = "local-build-index:3000"
+	_testCluster   = "test-cluster"
 )
 
 type serverMocks struct {
@@ -64,6 +69,10 @@ type serverMocks struct {
 	originClient          *mockblobclient.MockClusterClient
 	store                 *mocktagstore.MockStore
 	neighbors             hostlist.List
+	policies              []tagpolicy.Config
+	eventSinks            []tagevent.SinkConfig
+	tagEventManager       *mockpersistedretry.MockManager
+	backfills             *tagreplication.BackfillStore
 }
 
 func newServerMocks(t *testing.T) (*serverMocks, func()) {
@@ -74,6 +83,7 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 	cleanup.Add(ctrl.Finish)
 
 	tagReplicationManager := mockpersistedretry.NewMockManager(ctrl)
+	tagEventManager := mockpersistedretry.NewMockManager(ctrl)
 
 	backends := backend.ManagerFixture()
 	backendClient := mockbackend.NewMockClient(ctrl)
@@ -94,6 +104,9 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 
 	store := mocktagstore.NewMockStore(ctrl)
 
+	db, dbCleanup := localdb.Fixture(t)
+	cleanup.Add(dbCleanup)
+
 	return &serverMocks{
 		ctrl:                  ctrl,
 		config:                Config{DuplicateReplicateStagger: 20 * time.Minute},
@@ -106,6 +119,8 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 		depResolver:           depResolver,
 		store:                 store,
 		neighbors:             hostlist.Fixture(_testNeighbor),
+		tagEventManager:       tagEventManager,
+		backfills:             tagreplication.NewBackfillStore(db),
 	}, cleanup.Run
 }
 
@@ -113,7 +128,15 @@ func (m *serverMocks) client() *mocktagclient.MockClient {
 	return mocktagclient.NewMockClient(m.ctrl)
 }
 
-func (m *serverMocks) handler() http.Handler {
+func (m *serverMocks) server() *Server {
+	policies, err := tagpolicy.New(m.policies)
+	if err != nil {
+		panic(err)
+	}
+	sinks, err := tagevent.NewSinks(tagevent.Config{Sinks: m.eventSinks})
+	if err != nil {
+		panic(err)
+	}
 	return New(
 		m.config,
 		tally.NoopScope,
@@ -125,7 +148,14 @@ func (m *serverMocks) handler() http.Handler {
 		m.remotes,
 		m.tagReplicationManager,
 		m.provider,
-		m.depResolver).Handler()
+		m.depResolver,
+		policies,
+		tagevent.NewEmitter(sinks, _testCluster, m.tagEventManager),
+		m.backfills)
+}
+
+func (m *serverMocks) handler() http.Handler {
+	return m.server().Handler()
 }
 
 func newClusterClient(addr string) tagclient.Client {
@@ -237,6 +267,163 @@ func TestPut(t *testing.T) {
 	require.NoError(client.Put(tag, digest))
 }
 
+func TestPutEmitsEvents(t *testing.T) {
+	tests := []struct {
+		desc     string
+		prev     core.Digest
+		prevErr  error
+		expected tagevent.EventType
+	}{
+		{"created", core.Digest{}, tagstore.ErrTagNotFound, tagevent.Created},
+		{"updated", core.DigestFixture(), nil, tagevent.Updated},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			mocks.eventSinks = []tagevent.SinkConfig{{
+				Name:    "cd",
+				Webhook: &tagevent.WebhookConfig{URL: "http://localhost:8080"},
+			}}
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			client := newClusterClient(addr)
+
+			tag := core.TagFixture()
+			digest := core.DigestFixture()
+			neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+			mocks.store.EXPECT().Get(tag).Return(test.prev, test.prevErr)
+			mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+			mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+			mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+			mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+			neighborClient.EXPECT().DuplicatePut(
+				tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
+			mocks.tagEventManager.EXPECT().Add(gomock.Any()).DoAndReturn(
+				func(task *tagevent.Task) error {
+					require.Equal("cd", task.Sink)
+					require.Equal(test.expected, task.Type)
+					require.Equal(tag, task.Tag)
+					require.Equal(digest, task.Digest)
+					require.Equal(_testCluster, task.Cluster)
+					require.False(task.Replicated)
+					return nil
+				})
+
+			require.NoError(client.Put(tag, digest))
+		})
+	}
+}
+
+func TestPutUnchangedTagEmitsNoEvent(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.eventSinks = []tagevent.SinkConfig{{
+		Name:    "cd",
+		Webhook: &tagevent.WebhookConfig{URL: "http://localhost:8080"},
+	}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
+
+	require.NoError(client.Put(tag, digest))
+}
+
+func TestPutImmutableTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.policies = []tagpolicy.Config{{Namespace: ".*", Immutable: true}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(core.DigestFixture(), nil)
+
+	err := client.PutAndReplicate(tag, digest)
+	v, ok := err.(*tagpolicy.Violation)
+	require.True(ok, "expected *tagpolicy.Violation, got %v", err)
+	require.Equal(tagpolicy.ReasonImmutable, v.Reason)
+	require.Equal(tag, v.Tag)
+}
+
+func TestPutInvalidTagFormat(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.policies = []tagpolicy.Config{{Namespace: ".*", Semver: true}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	err := client.Put(core.TagFixture(), core.DigestFixture())
+	v, ok := err.(*tagpolicy.Violation)
+	require.True(ok, "expected *tagpolicy.Violation, got %v", err)
+	require.Equal(tagpolicy.ReasonFormat, v.Reason)
+}
+
+func TestCheckPolicy(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.policies = []tagpolicy.Config{{Namespace: ".*", Immutable: true}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	// Checks do not put the tag.
+	mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+	require.NoError(client.CheckPolicy(tag, digest))
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+	require.NoError(client.CheckPolicy(tag, digest))
+
+	mocks.store.EXPECT().Get(tag).Return(core.DigestFixture(), nil)
+	_, ok := client.CheckPolicy(tag, digest).(*tagpolicy.Violation)
+	require.True(ok)
+}
+
 func TestPutInvalidParam(t *testing.T) {
 	tag := core.TagFixture()
 	digest := core.DigestFixture()
@@ -388,12 +575,34 @@ func TestHas(t *testing.T) {
 	digest := core.DigestFixture()
 
 	mocks.backendClient.EXPECT().Stat(tag, tag).Return(core.NewBlobInfo(int64(len(digest.String()))), nil)
+	mocks.store.EXPECT().DeletedAt(tag).Return(time.Time{}, nil)
 
 	ok, err := client.Has(tag)
 	require.NoError(err)
 	require.True(ok)
 }
 
+func TestHasDeleted(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.backendClient.EXPECT().Stat(tag, tag).Return(core.NewBlobInfo(64), nil)
+	mocks.store.EXPECT().DeletedAt(tag).Return(time.Now(), nil)
+
+	ok, err := client.Has(tag)
+	require.NoError(err)
+	require.False(ok)
+}
+
 func TestHasNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -434,13 +643,14 @@ func TestListRepository(t *testing.T) {
 		names = append(names, fmt.Sprintf("%s:%s", repo, tags[i]))
 	}
 
-	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags").Return(&backend.ListResult{
+	// Func values are deeply equal if both are nil; otherwise they are not deeply
+	// equal. So gomock.Any().
+	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags",
+		gomock.Any()).Return(&backend.ListResult{
 		Names:             names[:maxKeys],
 		ContinuationToken: "first",
 	}, nil)
 
-	// Func values are deeply equal if both are nil; otherwise they are not deeply
-	// equal. So gomock.Any().
 	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags",
 		gomock.Any()).Return(&backend.ListResult{
 		Names:             names[maxKeys : maxKeys*2],
@@ -475,7 +685,8 @@ func TestList(t *testing.T) {
 		names = append(names, fmt.Sprintf("00%s", strconv.Itoa(i)))
 	}
 
-	mocks.backendClient.EXPECT().List(prefix).Return(&backend.ListResult{
+	mocks.backendClient.EXPECT().List(prefix,
+		gomock.Any()).Return(&backend.ListResult{
 		Names:             names[:maxKeys],
 		ContinuationToken: "first",
 	}, nil)
@@ -509,7 +720,7 @@ func TestListEmptyPrefix(t *testing.T) {
 
 	names := []string{"a", "b", "c"}
 
-	mocks.backendClient.EXPECT().List("").Return(&backend.ListResult{
+	mocks.backendClient.EXPECT().List("", gomock.Any()).Return(&backend.ListResult{
 		Names: names,
 	}, nil)
 
@@ -518,6 +729,43 @@ func TestListEmptyPrefix(t *testing.T) {
 	require.Equal(names, result)
 }
 
+func TestListRequestsPages(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	var requests []*backend.ListOptions
+	mocks.backendClient.EXPECT().List("prefix", gomock.Any()).DoAndReturn(
+		func(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+			options := backend.DefaultListOptions()
+			for _, opt := range opts {
+				opt(options)
+			}
+			requests = append(requests, options)
+			if options.ContinuationToken == "" {
+				return &backend.ListResult{Names: []string{"a"}, ContinuationToken: "a"}, nil
+			}
+			return &backend.ListResult{Names: []string{"b"}}, nil
+		}).Times(2)
+
+	result, err := client.List("prefix")
+	require.NoError(err)
+	require.Equal([]string{"a", "b"}, result)
+
+	require.Len(requests, 2)
+	for i, token := range []string{"", "a"} {
+		require.True(requests[i].Paginated)
+		require.Equal(1000, requests[i].MaxKeys)
+		require.Equal(token, requests[i].ContinuationToken)
+	}
+}
+
 func TestPutAndReplicate(t *testing.T) {
 	require := require.New(t)
 
@@ -552,6 +800,285 @@ func TestPutAndReplicate(t *testing.T) {
 	require.NoError(client.PutAndReplicate(tag, digest))
 }
 
+func TestHistory(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	versions := []tagmodels.Version{{
+		Digest:     core.DigestFixture(),
+		ReplacedAt: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+	}}
+
+	mocks.store.EXPECT().History(tag).Return(versions, nil)
+
+	result, err := client.History(tag)
+	require.NoError(err)
+	require.Equal(versions, result)
+}
+
+func TestHistoryNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().History(tag).Return(nil, tagstore.ErrTagNotFound)
+
+	_, err := client.History(tag)
+	require.Equal(tagclient.ErrTagNotFound, err)
+}
+
+func TestRollback(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deps := core.DigestList{digest}
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+	task := tagreplication.NewTask(tag, digest, deps, _testRemote, 0)
+	replicaClient := mocks.client()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().History(tag).Return(
+			[]tagmodels.Version{{Digest: digest, ReplacedAt: time.Now()}}, nil),
+		mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil),
+		mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil),
+		mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient),
+		neighborClient.EXPECT().DuplicatePut(
+			tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil),
+		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
+		replicaClient.EXPECT().DuplicateReplicate(
+			tag, digest, deps, mocks.config.DuplicateReplicateStagger).Return(nil),
+	)
+
+	require.NoError(client.Rollback(tag, digest))
+}
+
+func TestRollbackDigestNotInHistory(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().History(tag).Return(
+		[]tagmodels.Version{{Digest: core.DigestFixture(), ReplacedAt: time.Now()}}, nil)
+
+	require.Equal(tagclient.ErrTagNotFound, client.Rollback(tag, core.DigestFixture()))
+}
+
+func TestReplicatePutRejectedAfterDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	createdAt := time.Now().UTC()
+
+	mocks.store.EXPECT().DeletedAt(tag).Return(createdAt.Add(time.Second), nil)
+
+	require.Equal(tagclient.ErrTagDeleted, client.ReplicatePut(tag, digest, createdAt))
+}
+
+func TestDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocks.client()
+
+	var deletedAt time.Time
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(digest, nil),
+		mocks.store.EXPECT().Delete(tag, gomock.Any()).DoAndReturn(
+			func(tag string, t time.Time) error {
+				deletedAt = t
+				return nil
+			}),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient),
+		neighborClient.EXPECT().DuplicateDelete(tag, gomock.Any()).Return(nil),
+		mocks.tagReplicationManager.EXPECT().Add(gomock.Any()).DoAndReturn(
+			func(task *tagreplication.Task) error {
+				require.True(task.Tombstone())
+				require.Equal(tag, task.Tag)
+				require.Equal(digest, task.Digest)
+				require.Equal(_testRemote, task.Destination)
+				require.True(deletedAt.Equal(task.DeletedAt))
+				return nil
+			}),
+	)
+
+	require.NoError(client.Delete(tag))
+}
+
+func TestDeleteEmitsEvent(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.eventSinks = []tagevent.SinkConfig{{
+		Name:  "kafka",
+		Kafka: &tagevent.KafkaConfig{RESTProxy: "http://localhost:8082", Topic: "tags"},
+	}}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocks.client()
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+	mocks.store.EXPECT().Delete(tag, gomock.Any()).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().DuplicateDelete(tag, gomock.Any()).Return(nil)
+	mocks.tagEventManager.EXPECT().Add(gomock.Any()).DoAndReturn(
+		func(task *tagevent.Task) error {
+			require.Equal(tagevent.Deleted, task.Type)
+			require.Equal(tag, task.Tag)
+			require.Equal(digest, task.Digest)
+			return nil
+		})
+	mocks.tagReplicationManager.EXPECT().Add(gomock.Any()).Return(nil)
+
+	require.NoError(client.Delete(tag))
+}
+
+func TestDeleteNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+
+	require.Equal(tagclient.ErrTagNotFound, client.Delete(tag))
+}
+
+func TestReplicateDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deletedAt := time.Now().UTC()
+	neighborClient := mocks.client()
+	task := tagreplication.NewTombstoneTask(tag, digest, _testRemote, deletedAt)
+
+	gomock.InOrder(
+		mocks.store.EXPECT().DeletedAt(tag).Return(time.Time{}, nil),
+		mocks.store.EXPECT().Delete(tag, deletedAt).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient),
+		neighborClient.EXPECT().DuplicateDelete(tag, deletedAt).Return(nil),
+		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
+	)
+
+	require.NoError(client.ReplicateDelete(tag, digest, deletedAt))
+}
+
+func TestReplicateDeleteAlreadyApplied(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deletedAt := time.Now().UTC()
+
+	// The tombstone is not replicated any further.
+	mocks.store.EXPECT().DeletedAt(tag).Return(deletedAt, nil)
+
+	require.NoError(client.ReplicateDelete(tag, digest, deletedAt))
+}
+
+func TestDuplicateDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	tag := core.TagFixture()
+	deletedAt := time.Now().UTC()
+
+	mocks.store.EXPECT().Delete(tag, deletedAt).Return(nil)
+
+	require.NoError(client.DuplicateDelete(tag, deletedAt))
+}
+
 func TestReplicate(t *testing.T) {
 	require := require.New(t)
 
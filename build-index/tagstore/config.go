@@ -16,4 +16,19 @@ package tagstore
 // Config defines tag store configuration.
 type Config struct {
 	WriteThrough bool `yaml:"write_through"`
+
+	// RecordHistory enables writing the history of tags after their digest.
+	// Build-indexes without history support fail to read such tags, so it
+	// must only be enabled once all build-indexes are upgraded.
+	RecordHistory bool `yaml:"record_history"`
+
+	// HistoryLimit is the number of previous digests kept per tag.
+	HistoryLimit int `yaml:"history_limit"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.HistoryLimit == 0 {
+		c.HistoryLimit = 10
+	}
+	return c
 }
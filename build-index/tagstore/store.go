@@ -17,10 +17,14 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
@@ -37,17 +41,135 @@ var (
 	ErrTagNotFound = errors.New("tag not found")
 )
 
+// _tombstonePrefix marks tag content which records a deletion instead of a
+// digest. Tombstones are kept on disk in place of deleted tags so that
+// deletions can be ordered against puts which are replicated late from other
+// clusters. Deleted tags are removed from the backend, though tombstones
+// uploaded by older build-indexes may still be found there.
+const _tombstonePrefix = "tombstone:"
+
+// _numLocks is the number of locks which serialize changes to tags.
+const _numLocks = 64
+
 // FileStore defines operations required for storing tags on disk.
 type FileStore interface {
 	CreateCacheFile(name string, r io.Reader) error
 	SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error)
+	DeleteCacheFileMetadata(name string, md metadata.Metadata) error
 	GetCacheFileReader(name string) (store.FileReader, error)
+	ReplaceCacheFile(name string, r io.Reader) error
 }
 
 // Store defines tag storage operations.
 type Store interface {
 	Put(tag string, d core.Digest, writeBackDelay time.Duration) error
 	Get(tag string) (core.Digest, error)
+
+	// Delete removes tag from the backend and replaces it on disk with a
+	// tombstone recording deletedAt. Tags which already hold a newer tombstone
+	// are left untouched.
+	Delete(tag string, deletedAt time.Time) error
+
+	// DeletedAt returns when tag was deleted, or the zero time if tag has
+	// no tombstone.
+	DeletedAt(tag string) (time.Time, error)
+
+	// History returns the digests tag pointed to before, newest first.
+	History(tag string) ([]tagmodels.Version, error)
+}
+
+func formatVersion(v tagmodels.Version) string {
+	return fmt.Sprintf("%s %s", v.Digest, v.ReplacedAt.UTC().Format(time.RFC3339Nano))
+}
+
+func parseVersion(s string) (tagmodels.Version, error) {
+	parts := strings.Split(s, " ")
+	if len(parts) != 2 {
+		return tagmodels.Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	d, err := core.ParseSHA256Digest(parts[0])
+	if err != nil {
+		return tagmodels.Version{}, fmt.Errorf("parse digest: %s", err)
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return tagmodels.Version{}, fmt.Errorf("parse time: %s", err)
+	}
+	return tagmodels.Version{Digest: d, ReplacedAt: t}, nil
+}
+
+// entry is the content of a tag: either the digest the tag points to, or a
+// tombstone recording when the tag was deleted, followed by the history of
+// the tag, one version per line.
+type entry struct {
+	digest    core.Digest
+	deletedAt time.Time
+	history   []tagmodels.Version
+}
+
+func (e entry) tombstone() bool {
+	return !e.deletedAt.IsZero()
+}
+
+func (e entry) String() string {
+	if e.tombstone() {
+		return _tombstonePrefix + e.deletedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return e.digest.String()
+}
+
+// content returns the full content of e, including its history.
+func (e entry) content() string {
+	lines := []string{e.String()}
+	for _, v := range e.history {
+		lines = append(lines, formatVersion(v))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replace returns the entry which replaces e, recording the digest of e in
+// history, bounded by limit.
+func (e entry) replace(next entry, limit int) entry {
+	next.history = e.history
+	if !e.tombstone() {
+		// Tombstones are not versions, the deleted digest was recorded
+		// when the tag was deleted.
+		v := tagmodels.Version{Digest: e.digest, ReplacedAt: time.Now()}
+		if !next.deletedAt.IsZero() {
+			v.ReplacedAt = next.deletedAt
+		}
+		next.history = append([]tagmodels.Version{v}, e.history...)
+	}
+	if len(next.history) > limit {
+		next.history = next.history[:limit]
+	}
+	return next
+}
+
+func parseEntry(s string) (entry, error) {
+	lines := strings.Split(s, "\n")
+	var e entry
+	if strings.HasPrefix(lines[0], _tombstonePrefix) {
+		t, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(lines[0], _tombstonePrefix))
+		if err != nil {
+			return entry{}, fmt.Errorf("parse tombstone: %s", err)
+		}
+		e.deletedAt = t
+	} else {
+		d, err := core.ParseSHA256Digest(lines[0])
+		if err != nil {
+			return entry{}, err
+		}
+		e.digest = d
+	}
+	for _, line := range lines[1:] {
+		v, err := parseVersion(line)
+		if err != nil {
+			return entry{}, fmt.Errorf("parse history: %s", err)
+		}
+		e.history = append(e.history, v)
+	}
+	return e, nil
 }
 
 // tagStore encapsulates two-level tag storage:
@@ -62,6 +184,10 @@ type tagStore struct {
 	// writeBackStrategy determines how tags are written to backend storage.
 	// Set at initialization based on WriteThrough config.
 	writeBackStrategy func(task persistedretry.Task) error
+
+	// locks serialize changes of the same tag, such that no version is lost
+	// from its history.
+	locks [_numLocks]sync.Mutex
 }
 
 // New creates a new Store.
@@ -71,6 +197,7 @@ func New(
 	backends *backend.Manager,
 	writeBackManager persistedretry.Manager,
 ) Store {
+	config = config.applyDefaults()
 	s := &tagStore{
 		config:           config,
 		fs:               fs,
@@ -89,7 +216,28 @@ func New(
 }
 
 func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration) error {
-	if err := s.writeTagToDisk(tag, d); err != nil {
+	l := s.lock(tag)
+	l.Lock()
+	defer l.Unlock()
+
+	e, err := s.resolve(tag)
+	if err != nil && err != ErrTagNotFound {
+		return fmt.Errorf("resolve tag: %s", err)
+	}
+	if err == nil && (e.tombstone() || e.digest != d) {
+		// Write-back skips tags which already exist in the backend, so
+		// moving a tag, or re-creating a tag whose tombstone was uploaded
+		// by an older build-index, must overwrite it in place.
+		log.With("tag", tag, "digest", d.String(), "previous", e.String()).Info("Overwriting tag")
+		return s.overwrite(tag, e.replace(entry{digest: d}, s.config.HistoryLimit))
+	}
+
+	// Unchanged tags found in the backend keep their history on disk.
+	content := d.String()
+	if err == nil {
+		content = s.content(e)
+	}
+	if err := s.writeTagToDisk(tag, content); err != nil {
 		return fmt.Errorf("write tag to disk: %s", err)
 	}
 	if _, err := s.fs.SetCacheFileMetadata(tag, metadata.NewPersist(true)); err != nil {
@@ -100,18 +248,122 @@ func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration)
 	return s.writeBackStrategy(task)
 }
 
-func (s *tagStore) Get(tag string) (d core.Digest, err error) {
-	for _, resolve := range []func(tag string) (core.Digest, error){
+func (s *tagStore) Get(tag string) (core.Digest, error) {
+	e, err := s.resolve(tag)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	if e.tombstone() {
+		return core.Digest{}, ErrTagNotFound
+	}
+	return e.digest, nil
+}
+
+func (s *tagStore) Delete(tag string, deletedAt time.Time) error {
+	if deletedAt.IsZero() {
+		return errors.New("deletion time must be set")
+	}
+	l := s.lock(tag)
+	l.Lock()
+	defer l.Unlock()
+
+	e, err := s.resolve(tag)
+	if err != nil && err != ErrTagNotFound {
+		return fmt.Errorf("resolve tag: %s", err)
+	}
+	if err == nil && e.tombstone() && !e.deletedAt.Before(deletedAt) {
+		// Keep the newer deletion.
+		return nil
+	}
+	log.With("tag", tag, "deleted_at", deletedAt).Info("Deleting tag")
+	next := entry{deletedAt: deletedAt}
+	if err == nil {
+		next = e.replace(next, s.config.HistoryLimit)
+	}
+	// Clearing persist drops a write-back of tag which is still pending.
+	if err := s.fs.DeleteCacheFileMetadata(tag, &metadata.Persist{}); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete persist metadata: %s", err)
+	}
+	backendClient, err := s.backends.GetClient(tag)
+	if err != nil {
+		return fmt.Errorf("backend manager: %s", err)
+	}
+	if err := backendClient.Delete(tag, tag); err != nil && err != backenderrors.ErrBlobNotFound {
+		return fmt.Errorf("backend delete: %s", err)
+	}
+	if err := s.fs.ReplaceCacheFile(tag, strings.NewReader(s.content(next))); err != nil {
+		return fmt.Errorf("write tombstone to disk: %s", err)
+	}
+	return nil
+}
+
+func (s *tagStore) DeletedAt(tag string) (time.Time, error) {
+	e, err := s.resolve(tag)
+	if err != nil {
+		if err == ErrTagNotFound {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return e.deletedAt, nil
+}
+
+func (s *tagStore) History(tag string) ([]tagmodels.Version, error) {
+	e, err := s.resolve(tag)
+	if err != nil {
+		return nil, err
+	}
+	return e.history, nil
+}
+
+func (s *tagStore) lock(tag string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	return &s.locks[h.Sum32()%_numLocks]
+}
+
+func (s *tagStore) resolve(tag string) (e entry, err error) {
+	for _, resolve := range []func(tag string) (entry, error){
 		s.resolveFromDisk,
 		s.resolveFromBackend,
 	} {
-		d, err = resolve(tag)
+		e, err = resolve(tag)
 		if err == ErrTagNotFound {
 			continue
 		}
 		break
 	}
-	return d, err
+	return e, err
+}
+
+// overwrite replaces the content of tag on disk and uploads it to the backend
+// synchronously, bypassing write-back. The file on disk is replaced in place,
+// so concurrent reads never miss it and fall back to the stale backend copy.
+func (s *tagStore) overwrite(tag string, e entry) error {
+	// Clearing persist drops a write-back of tag which is still pending.
+	if err := s.fs.DeleteCacheFileMetadata(tag, &metadata.Persist{}); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete persist metadata: %s", err)
+	}
+	if err := s.fs.ReplaceCacheFile(tag, strings.NewReader(s.content(e))); err != nil {
+		return fmt.Errorf("write tag to disk: %s", err)
+	}
+	backendClient, err := s.backends.GetClient(tag)
+	if err != nil {
+		return fmt.Errorf("backend manager: %s", err)
+	}
+	if err := backendClient.Upload(tag, tag, strings.NewReader(s.content(e))); err != nil {
+		return fmt.Errorf("backend upload: %s", err)
+	}
+	return nil
+}
+
+// content returns the content of e to write, which only includes the history
+// of e if recording history is enabled.
+func (s *tagStore) content(e entry) string {
+	if !s.config.RecordHistory {
+		return e.String()
+	}
+	return e.content()
 }
 
 // writeThroughStrategy writes tags synchronously to backend storage.
@@ -130,65 +382,65 @@ func (s *tagStore) asyncWriteBackStrategy(task persistedretry.Task) error {
 	return nil
 }
 
-func (s *tagStore) writeTagToDisk(tag string, d core.Digest) error {
-	buf := bytes.NewBufferString(d.String())
+func (s *tagStore) writeTagToDisk(tag string, content string) error {
+	buf := bytes.NewBufferString(content)
 	if err := s.fs.CreateCacheFile(tag, buf); err != nil && !os.IsExist(err) {
 		return err
 	}
 	return nil
 }
 
-func (s *tagStore) resolveFromDisk(tag string) (core.Digest, error) {
+func (s *tagStore) resolveFromDisk(tag string) (entry, error) {
 	log.With("tag", tag).Debug("Attempting to resolve tag from disk cache")
 
 	f, err := s.fs.GetCacheFileReader(tag)
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.With("tag", tag).Debug("Tag not found in disk cache")
-			return core.Digest{}, ErrTagNotFound
+			return entry{}, ErrTagNotFound
 		}
 		log.With("tag", tag).Errorf("Failed to read tag from disk cache: %s", err)
-		return core.Digest{}, fmt.Errorf("fs: %s", err)
+		return entry{}, fmt.Errorf("fs: %s", err)
 	}
 	defer closers.Close(f)
 	var b bytes.Buffer
 	if _, err := io.Copy(&b, f); err != nil {
 		log.With("tag", tag).Errorf("Failed to copy tag data from disk: %s", err)
-		return core.Digest{}, fmt.Errorf("copy from fs: %s", err)
+		return entry{}, fmt.Errorf("copy from fs: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
+	e, err := parseEntry(b.String())
 	if err != nil {
 		log.With("tag", tag).Errorf("Failed to parse digest from disk cache: %s", err)
-		return core.Digest{}, fmt.Errorf("parse fs digest: %s", err)
+		return entry{}, fmt.Errorf("parse fs digest: %s", err)
 	}
 
-	log.With("tag", tag, "digest", d.String()).Debug("Successfully resolved tag from disk cache")
-	return d, nil
+	log.With("tag", tag, "entry", e.String()).Debug("Successfully resolved tag from disk cache")
+	return e, nil
 }
 
-func (s *tagStore) resolveFromBackend(tag string) (core.Digest, error) {
+func (s *tagStore) resolveFromBackend(tag string) (entry, error) {
 	log.With("tag", tag).Debug("Attempting to resolve tag from backend")
 
 	backendClient, err := s.backends.GetClient(tag)
 	if err != nil {
 		log.With("tag", tag).Errorf("Failed to get backend client: %s", err)
-		return core.Digest{}, fmt.Errorf("backend manager: %s", err)
+		return entry{}, fmt.Errorf("backend manager: %s", err)
 	}
 	var b bytes.Buffer
 	if err := backendClient.Download(tag, tag, &b); err != nil {
 		if err == backenderrors.ErrBlobNotFound {
 			log.With("tag", tag).Debug("Tag not found in backend")
-			return core.Digest{}, ErrTagNotFound
+			return entry{}, ErrTagNotFound
 		}
 		log.With("tag", tag).Errorf("Failed to download tag from backend: %s", err)
-		return core.Digest{}, fmt.Errorf("backend client: %s", err)
+		return entry{}, fmt.Errorf("backend client: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
+	e, err := parseEntry(b.String())
 	if err != nil {
 		log.With("tag", tag).Errorf("Failed to parse digest from backend: %s", err)
-		return core.Digest{}, fmt.Errorf("parse backend digest: %s", err)
+		return entry{}, fmt.Errorf("parse backend digest: %s", err)
 	}
 
-	log.With("tag", tag, "digest", d.String()).Info("Successfully resolved tag from backend")
-	return d, nil
+	log.With("tag", tag, "entry", e.String()).Info("Successfully resolved tag from backend")
+	return e, nil
 }
@@ -16,7 +16,10 @@ package tagstore_test
 import (
 	"fmt"
 	"io"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/core"
@@ -24,6 +27,7 @@ import (
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
 	mockbackend "github.com/uber/kraken/mocks/lib/backend"
 	mockpersistedretry "github.com/uber/kraken/mocks/lib/persistedretry"
 	"github.com/uber/kraken/utils/mockutil"
@@ -77,6 +81,7 @@ func TestPutAndGetFromDisk(t *testing.T) {
 	tag := core.TagFixture()
 	digest := core.DigestFixture()
 
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
 	mocks.writeBackManager.EXPECT().Add(
 		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
 
@@ -98,6 +103,7 @@ func TestPutAndGetFromDiskWriteThrough(t *testing.T) {
 	tag := core.TagFixture()
 	digest := core.DigestFixture()
 
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
 	mocks.writeBackManager.EXPECT().SyncExec(
 		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
 
@@ -167,3 +173,268 @@ func TestGetFromBackendInvalidValue(t *testing.T) {
 	_, err := store.Get(tag)
 	require.Error(err)
 }
+
+func TestDeleteWritesTombstone(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deletedAt := time.Now()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+
+	require.NoError(store.Put(tag, digest, 0))
+
+	mocks.backendClient.EXPECT().Delete(tag, tag).Return(nil)
+
+	require.NoError(store.Delete(tag, deletedAt))
+
+	_, err := store.Get(tag)
+	require.Equal(ErrTagNotFound, err)
+
+	// The pending write-back of the deleted tag is dropped.
+	require.True(os.IsNotExist(mocks.ss.GetCacheFileMetadata(tag, &metadata.Persist{})))
+
+	result, err := store.DeletedAt(tag)
+	require.NoError(err)
+	require.True(deletedAt.Equal(result))
+}
+
+func TestDeleteKeepsNewerTombstone(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	deletedAt := time.Now()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.backendClient.EXPECT().Delete(tag, tag).Return(backenderrors.ErrBlobNotFound)
+
+	require.NoError(store.Delete(tag, deletedAt))
+
+	// An older deletion arriving late does not replace the tombstone.
+	require.NoError(store.Delete(tag, deletedAt.Add(-time.Minute)))
+
+	result, err := store.DeletedAt(tag)
+	require.NoError(err)
+	require.True(deletedAt.Equal(result))
+}
+
+func TestPutOverwritesTombstone(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.backendClient.EXPECT().Delete(tag, tag).Return(backenderrors.ErrBlobNotFound)
+
+	require.NoError(store.Delete(tag, time.Now()))
+
+	// Re-creating the tag uploads it synchronously instead of through
+	// write-back, which would skip tombstones uploaded by older build-indexes.
+	mocks.backendClient.EXPECT().Upload(
+		tag, tag, mockutil.MatchReader([]byte(digest.String()))).Return(nil)
+
+	require.NoError(store.Put(tag, digest, 0))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+
+	deletedAt, err := store.DeletedAt(tag)
+	require.NoError(err)
+	require.True(deletedAt.IsZero())
+}
+
+func TestDeletedAtNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	deletedAt, err := store.DeletedAt(tag)
+	require.NoError(err)
+	require.True(deletedAt.IsZero())
+}
+
+func TestPutMovesTagAndRecordsHistory(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{RecordHistory: true})
+
+	tag := core.TagFixture()
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+
+	require.NoError(store.Put(tag, d1, 0))
+
+	// Moving a tag uploads it synchronously, since write-back skips tags
+	// which already exist in the backend.
+	mocks.backendClient.EXPECT().Upload(tag, tag, gomock.Any()).DoAndReturn(
+		func(namespace, name string, src io.Reader) error {
+			b, err := io.ReadAll(src)
+			require.NoError(err)
+			lines := strings.Split(string(b), "\n")
+			require.Len(lines, 2)
+			require.Equal(d2.String(), lines[0])
+			require.True(strings.HasPrefix(lines[1], d1.String()))
+			return nil
+		})
+
+	require.NoError(store.Put(tag, d2, 0))
+
+	// The moved tag is already in the backend, so it is no longer waiting for
+	// write-back.
+	require.True(os.IsNotExist(mocks.ss.GetCacheFileMetadata(tag, &metadata.Persist{})))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(d2, result)
+
+	history, err := store.History(tag)
+	require.NoError(err)
+	require.Len(history, 1)
+	require.Equal(d1, history[0].Digest)
+	require.False(history[0].ReplacedAt.IsZero())
+}
+
+func TestHistoryNotRecordedByDefault(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+
+	require.NoError(store.Put(tag, d1, 0))
+
+	// Older build-indexes only read a bare digest.
+	mocks.backendClient.EXPECT().Upload(
+		tag, tag, mockutil.MatchReader([]byte(d2.String()))).Return(nil)
+
+	require.NoError(store.Put(tag, d2, 0))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(d2, result)
+
+	history, err := store.History(tag)
+	require.NoError(err)
+	require.Empty(history)
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{RecordHistory: true, HistoryLimit: 2})
+
+	tag := core.TagFixture()
+	digests := []core.Digest{
+		core.DigestFixture(), core.DigestFixture(), core.DigestFixture(), core.DigestFixture(),
+	}
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	mocks.backendClient.EXPECT().Upload(tag, tag, gomock.Any()).Return(nil).Times(3)
+
+	for _, d := range digests {
+		require.NoError(store.Put(tag, d, 0))
+	}
+
+	history, err := store.History(tag)
+	require.NoError(err)
+	require.Len(history, 2)
+	require.Equal(digests[2], history[0].Digest)
+	require.Equal(digests[1], history[1].Digest)
+}
+
+func TestHistorySurvivesDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{RecordHistory: true})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deletedAt := time.Now()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	mocks.backendClient.EXPECT().Delete(tag, tag).Return(nil)
+
+	require.NoError(store.Put(tag, digest, 0))
+	require.NoError(store.Delete(tag, deletedAt))
+
+	history, err := store.History(tag)
+	require.NoError(err)
+	require.Len(history, 1)
+	require.Equal(digest, history[0].Digest)
+	require.True(deletedAt.Equal(history[0].ReplacedAt))
+}
+
+func TestHistoryFromBackend(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	current := core.DigestFixture()
+	previous := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			_, err := fmt.Fprintf(dst, "%s\n%s 2019-01-01T00:00:00Z", current, previous)
+			return err
+		})
+
+	history, err := store.History(tag)
+	require.NoError(err)
+	require.Len(history, 1)
+	require.Equal(previous, history[0].Digest)
+	require.Equal(2019, history[0].ReplacedAt.Year())
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/cenkalti/backoff"
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/origin/blobclient"
@@ -30,21 +31,120 @@ import (
 type dockerResolver struct {
 	originClient  blobclient.ClusterClient
 	backoffConfig httputil.ExponentialBackOffConfig
+	platforms     []dockerutil.Platform
+
+	// artifacts allows OCI artifacts, e.g. Helm charts or SBOMs pushed with
+	// ORAS, which are resolved to their blobs like images to their layers.
+	artifacts bool
 }
 
 // Resolve returns all layers + manifest of given tag as its dependencies.
+// Manifest lists and OCI image indexes are expanded into the manifests and
+// layers of each platform they reference, restricted to the configured
+// platforms if any.
 func (r *dockerResolver) Resolve(tag string, d core.Digest) (core.DigestList, error) {
 	m, err := r.downloadManifest(tag, d)
 	if err != nil {
 		return nil, fmt.Errorf("download manifest: %w", err)
 	}
-	deps, err := dockerutil.GetManifestReferences(m)
+	deps, err := r.expand(tag, d, m, map[core.Digest]bool{d: true})
 	if err != nil {
-		return nil, fmt.Errorf("get manifest references: %w", err)
+		return nil, err
+	}
+	return dedupe(deps), nil
+}
+
+// expand returns the dependencies of manifest m with digest d, followed by d.
+// seen holds the manifests already expanded, so nested indexes referencing
+// the same manifest are only downloaded once.
+func (r *dockerResolver) expand(
+	tag string, d core.Digest, m distribution.Manifest, seen map[core.Digest]bool) (core.DigestList, error) {
+
+	list, ok := m.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		deps, err := r.references(d, m)
+		if err != nil {
+			return nil, err
+		}
+		return append(deps, d), nil
+	}
+	var deps core.DigestList
+	for _, desc := range list.Manifests {
+		if !r.matchPlatform(desc.Platform) {
+			continue
+		}
+		child, err := core.ParseSHA256Digest(string(desc.Digest))
+		if err != nil {
+			return nil, fmt.Errorf("parse digest: %w", err)
+		}
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		cm, err := r.downloadManifest(tag, child)
+		if err != nil {
+			return nil, fmt.Errorf("download manifest %s: %w", child, err)
+		}
+		childDeps, err := r.expand(tag, child, cm, seen)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, childDeps...)
 	}
 	return append(deps, d), nil
 }
 
+// references returns the blobs referenced by image or artifact manifest m.
+func (r *dockerResolver) references(d core.Digest, m distribution.Manifest) (core.DigestList, error) {
+	artifactType, err := dockerutil.GetArtifactType(m)
+	if err != nil {
+		return nil, fmt.Errorf("get artifact type: %w", err)
+	}
+	if artifactType == "" {
+		deps, err := dockerutil.GetManifestReferences(m)
+		if err != nil {
+			return nil, fmt.Errorf("get manifest references: %w", err)
+		}
+		return deps, nil
+	}
+	if !r.artifacts {
+		return nil, fmt.Errorf("manifest %s is an artifact of type %s", d, artifactType)
+	}
+	deps, err := dockerutil.GetArtifactReferences(m)
+	if err != nil {
+		return nil, fmt.Errorf("get artifact references: %w", err)
+	}
+	return deps, nil
+}
+
+// matchPlatform returns true if manifests of p should be resolved. Manifests
+// without a platform, such as nested indexes, always match.
+func (r *dockerResolver) matchPlatform(p manifestlist.PlatformSpec) bool {
+	if len(r.platforms) == 0 || (p.OS == "" && p.Architecture == "") {
+		return true
+	}
+	for _, rp := range r.platforms {
+		if rp.Match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupe removes duplicate digests from l, such as layers shared by the
+// manifests of multiple platforms, preserving order.
+func dedupe(l core.DigestList) core.DigestList {
+	seen := make(map[core.Digest]bool, len(l))
+	var result core.DigestList
+	for _, d := range l {
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
 func (r *dockerResolver) downloadManifest(tag string, d core.Digest) (distribution.Manifest, error) {
 	buf := &bytes.Buffer{}
 	attempt := 0
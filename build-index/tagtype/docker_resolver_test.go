@@ -240,3 +240,169 @@ func TestDockerResolver_Resolve_WithRetries(t *testing.T) {
 	require.NotNil(deps)
 	require.Equal(core.DigestList(append(layers, manifest)), deps)
 }
+
+func TestDockerResolver_Resolve_ManifestList(t *testing.T) {
+	require, _, resolver, mockOrigin := setupDockerResolverTest(t)
+
+	tag := "repo/image:v1.0"
+	amd64Layers := core.DigestListFixture(3)
+	amd64, amd64Bytes := dockerutil.ManifestFixture(amd64Layers[0], amd64Layers[1], amd64Layers[2])
+	arm64Layers := core.DigestListFixture(3)
+	arm64, arm64Bytes := dockerutil.ManifestFixture(arm64Layers[0], arm64Layers[1], arm64Layers[2])
+	list, listBytes := dockerutil.ManifestListFixture(
+		[]string{"linux/amd64", "linux/arm64/v8"}, core.DigestList{amd64, arm64})
+
+	mockOrigin.EXPECT().DownloadBlob(tag, list, mockutil.MatchWriter(listBytes)).Return(nil)
+	mockOrigin.EXPECT().DownloadBlob(tag, amd64, mockutil.MatchWriter(amd64Bytes)).Return(nil)
+	mockOrigin.EXPECT().DownloadBlob(tag, arm64, mockutil.MatchWriter(arm64Bytes)).Return(nil)
+
+	deps, err := resolver.Resolve(tag, list)
+	require.NoError(err)
+
+	var expected core.DigestList
+	expected = append(expected, amd64Layers...)
+	expected = append(expected, amd64)
+	expected = append(expected, arm64Layers...)
+	expected = append(expected, arm64, list)
+	require.Equal(expected, deps)
+}
+
+func TestDockerResolver_Resolve_OCIIndexRestrictedToPlatforms(t *testing.T) {
+	tests := []struct {
+		desc      string
+		platforms []string
+		expected  []int
+	}{
+		{"no platforms", nil, []int{0, 1, 2}},
+		{"os and arch", []string{"linux/amd64"}, []int{0}},
+		{"any variant", []string{"linux/arm"}, []int{1, 2}},
+		{"variant", []string{"linux/arm/v7"}, []int{2}},
+		{"multiple", []string{"linux/amd64", "linux/arm/v6"}, []int{0, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require, _, resolver, mockOrigin := setupDockerResolverTest(t)
+
+			for _, s := range test.platforms {
+				p, err := dockerutil.ParsePlatform(s)
+				require.NoError(err)
+				resolver.platforms = append(resolver.platforms, p)
+			}
+
+			tag := "repo/image:v1.0"
+			var manifests core.DigestList
+			var layers []core.DigestList
+			var raw [][]byte
+			for i := 0; i < 3; i++ {
+				l := core.DigestListFixture(3)
+				d, b := dockerutil.OCIManifestFixture(l[0], l[1], l[2])
+				manifests = append(manifests, d)
+				layers = append(layers, l)
+				raw = append(raw, b)
+			}
+			index, indexBytes := dockerutil.OCIIndexFixture(
+				[]string{"linux/amd64", "linux/arm/v6", "linux/arm/v7"}, manifests)
+
+			mockOrigin.EXPECT().DownloadBlob(tag, index, mockutil.MatchWriter(indexBytes)).Return(nil)
+
+			var expected core.DigestList
+			for _, i := range test.expected {
+				mockOrigin.EXPECT().
+					DownloadBlob(tag, manifests[i], mockutil.MatchWriter(raw[i])).
+					Return(nil)
+				expected = append(expected, layers[i]...)
+				expected = append(expected, manifests[i])
+			}
+			expected = append(expected, index)
+
+			deps, err := resolver.Resolve(tag, index)
+			require.NoError(err)
+			require.Equal(expected, deps)
+		})
+	}
+}
+
+func TestDockerResolver_Resolve_NestedIndexDedupesDependencies(t *testing.T) {
+	require, _, resolver, mockOrigin := setupDockerResolverTest(t)
+
+	tag := "repo/image:v1.0"
+	shared := core.DigestFixture()
+	layers := core.DigestListFixture(2)
+	amd64, amd64Bytes := dockerutil.OCIManifestFixture(shared, layers[0], layers[1])
+	arm64Layers := core.DigestListFixture(1)
+	arm64, arm64Bytes := dockerutil.OCIManifestFixture(shared, layers[0], arm64Layers[0])
+
+	// The nested index has no platform, and references amd64 again.
+	nested, nestedBytes := dockerutil.OCIIndexFixture(
+		[]string{"linux/arm64", "linux/amd64"}, core.DigestList{arm64, amd64})
+	index, indexBytes := dockerutil.OCIIndexFixture([]string{"linux/amd64", "/"}, core.DigestList{amd64, nested})
+
+	mockOrigin.EXPECT().DownloadBlob(tag, index, mockutil.MatchWriter(indexBytes)).Return(nil)
+	mockOrigin.EXPECT().DownloadBlob(tag, amd64, mockutil.MatchWriter(amd64Bytes)).Return(nil)
+	mockOrigin.EXPECT().DownloadBlob(tag, nested, mockutil.MatchWriter(nestedBytes)).Return(nil)
+	mockOrigin.EXPECT().DownloadBlob(tag, arm64, mockutil.MatchWriter(arm64Bytes)).Return(nil)
+
+	deps, err := resolver.Resolve(tag, index)
+	require.NoError(err)
+	require.Equal(core.DigestList{
+		shared, layers[0], layers[1], amd64, arm64Layers[0], arm64, nested, index,
+	}, deps)
+}
+
+func TestDockerResolver_Resolve_ManifestListChildDownloadError(t *testing.T) {
+	require, _, resolver, mockOrigin := setupDockerResolverTest(t)
+
+	tag := "repo/image:v1.0"
+	child := core.DigestFixture()
+	list, listBytes := dockerutil.ManifestListFixture([]string{"linux/amd64"}, core.DigestList{child})
+
+	mockOrigin.EXPECT().DownloadBlob(tag, list, mockutil.MatchWriter(listBytes)).Return(nil)
+	mockOrigin.EXPECT().
+		DownloadBlob(tag, child, gomock.Any()).
+		Return(httputil.StatusError{Status: 401})
+
+	deps, err := resolver.Resolve(tag, list)
+	require.Error(err)
+	require.Nil(deps)
+	require.Contains(err.Error(), child.String())
+}
+
+func TestDockerResolver_Resolve_Artifacts(t *testing.T) {
+	tests := []struct {
+		desc    string
+		fixture func(string, ...core.Digest) (core.Digest, []byte)
+	}{
+		{"image manifest", dockerutil.ArtifactFixture},
+		{"artifact manifest", dockerutil.ArtifactManifestFixture},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require, _, resolver, mockOrigin := setupDockerResolverTest(t)
+			resolver.artifacts = true
+
+			tag := "charts/app:1.0.0"
+			blobs := core.DigestListFixture(2)
+			manifest, b := test.fixture("application/vnd.cncf.helm.config.v1+json", blobs...)
+
+			mockOrigin.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+			deps, err := resolver.Resolve(tag, manifest)
+			require.NoError(err)
+			require.Equal(core.DigestList(append(blobs, manifest)), deps)
+		})
+	}
+}
+
+func TestDockerResolver_Resolve_ArtifactsNotAllowed(t *testing.T) {
+	require, _, resolver, mockOrigin := setupDockerResolverTest(t)
+
+	tag := "charts/app:1.0.0"
+	manifest, b := dockerutil.ArtifactFixture("application/vnd.cncf.helm.config.v1+json", core.DigestFixture())
+
+	mockOrigin.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+	deps, err := resolver.Resolve(tag, manifest)
+	require.Error(err)
+	require.Nil(deps)
+	require.Contains(err.Error(), "application/vnd.cncf.helm.config.v1+json")
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/dockerutil"
 	"github.com/uber/kraken/utils/httputil"
 )
 
@@ -38,6 +39,11 @@ const (
 type Config struct {
 	Namespace string `yaml:"namespace"`
 	Type      string `yaml:"type"`
+
+	// Platforms restricts the manifests of manifest lists resolved by docker
+	// and oci resolvers, e.g. "linux/amd64" or "linux/arm64/v8". Manifests of all
+	// platforms are resolved if empty.
+	Platforms []string `yaml:"platforms"`
 }
 
 // DependencyResolver returns a list of blob dependencies for a tag->digest mapping.
@@ -68,16 +74,12 @@ func NewMap(configs []Config, originClient blobclient.ClusterClient) (*Map, erro
 		}
 		var sr *subResolver
 		switch config.Type {
-		case "docker":
-			backoffConfig := httputil.ExponentialBackOffConfig{
-				Enabled:             true,
-				InitialInterval:     defaultInitialInterval,
-				RandomizationFactor: defaultRandomizationFactor,
-				Multiplier:          defaultMultiplier,
-				MaxInterval:         defaultMaxInterval,
-				MaxRetries:          defaultMaxRetries,
+		case "docker", "oci":
+			r, err := newDockerResolver(config, originClient)
+			if err != nil {
+				return nil, err
 			}
-			sr = &subResolver{re, &dockerResolver{originClient, backoffConfig}}
+			sr = &subResolver{re, r}
 		case "default":
 			sr = &subResolver{re, &defaultResolver{}}
 		default:
@@ -88,6 +90,28 @@ func NewMap(configs []Config, originClient blobclient.ClusterClient) (*Map, erro
 	return &Map{subResolvers}, nil
 }
 
+// newDockerResolver creates a dockerResolver for config, which also resolves
+// OCI artifacts if config is of type oci.
+func newDockerResolver(config Config, originClient blobclient.ClusterClient) (*dockerResolver, error) {
+	backoffConfig := httputil.ExponentialBackOffConfig{
+		Enabled:             true,
+		InitialInterval:     defaultInitialInterval,
+		RandomizationFactor: defaultRandomizationFactor,
+		Multiplier:          defaultMultiplier,
+		MaxInterval:         defaultMaxInterval,
+		MaxRetries:          defaultMaxRetries,
+	}
+	var platforms []dockerutil.Platform
+	for _, s := range config.Platforms {
+		p, err := dockerutil.ParsePlatform(s)
+		if err != nil {
+			return nil, fmt.Errorf("platform: %s", err)
+		}
+		platforms = append(platforms, p)
+	}
+	return &dockerResolver{originClient, backoffConfig, platforms, config.Type == "oci"}, nil
+}
+
 // Resolve executes the sub resolver configured for tag.
 func (m *Map) Resolve(tag string, d core.Digest) (core.DigestList, error) {
 	for _, sr := range m.subResolvers {
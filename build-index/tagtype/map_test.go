@@ -54,6 +54,31 @@ func TestMapResolveDocker(t *testing.T) {
 	require.Equal(core.DigestList(append(layers, manifest)), deps)
 }
 
+func TestMapResolveOCI(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+	conf := []Config{
+		{Namespace: "namespace-foo/.*", Type: "oci"},
+	}
+	m, err := NewMap(conf, originClient)
+	require.NoError(err)
+
+	tag := "namespace-foo/sbom:0001"
+	blobs := core.DigestListFixture(1)
+	manifest, b := dockerutil.ArtifactFixture("application/spdx+json", blobs...)
+
+	originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+	deps, err := m.Resolve(tag, manifest)
+	require.NoError(err)
+	require.Equal(core.DigestList{blobs[0], manifest}, deps)
+}
+
 func TestMapResolveDefault(t *testing.T) {
 	require := require.New(t)
 
@@ -98,3 +123,13 @@ func TestMapGetResolverNamespaceError(t *testing.T) {
 	require.Error(err)
 	require.Equal(errNamespaceNotFound, err)
 }
+
+func TestMapInvalidPlatform(t *testing.T) {
+	require := require.New(t)
+
+	conf := []Config{
+		{Namespace: "namespace-foo/.*", Type: "docker", Platforms: []string{"linux"}},
+	}
+	_, err := NewMap(conf, nil)
+	require.Error(err)
+}
@@ -13,7 +13,10 @@
 // limitations under the License.
 package core
 
-import "errors"
+import (
+	"errors"
+	"net"
+)
 
 // PeerContext defines the context a peer runs within, namely the fields which
 // are used to identify each peer.
@@ -26,6 +29,10 @@ type PeerContext struct {
 	IP   string `json:"ip"`
 	Port int    `json:"port"`
 
+	// AltIP is an optional ip of the other ip family than IP, which dual-stack
+	// peers announce so that peers of either family can connect to them.
+	AltIP string `json:"alt_ip,omitempty"`
+
 	// PeerID the peer will identify itself as.
 	PeerID PeerID `json:"peer_id"`
 
@@ -37,6 +44,10 @@ type PeerContext struct {
 
 	// Origin indicates whether the peer is an origin server or not.
 	Origin bool `json:"origin"`
+
+	// Labels describe the network location of the peer, e.g. its region, zone
+	// and rack, so trackers may hand out nearby peers.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // NewPeerContext creates a new PeerContext.
@@ -62,3 +73,42 @@ func NewPeerContext(
 		Origin:  origin,
 	}, nil
 }
+
+// SetAltIP sets the ip of the other ip family which pctx announces.
+func (pctx *PeerContext) SetAltIP(ip string) error {
+	alt := net.ParseIP(ip)
+	if alt == nil {
+		return errors.New("invalid alt ip")
+	}
+	if primary := net.ParseIP(pctx.IP); primary != nil && isIPv4(primary) == isIPv4(alt) {
+		return errors.New("alt ip must be of a different ip family than ip")
+	}
+	pctx.AltIP = ip
+	return nil
+}
+
+// hasIPFamily returns whether pctx has an ip in the same family as ip.
+// Unparsable ips, such as hostnames, are assumed to be reachable.
+func (pctx PeerContext) hasIPFamily(ip string) bool {
+	target := net.ParseIP(ip)
+	if target == nil {
+		return true
+	}
+	for _, s := range []string{pctx.IP, pctx.AltIP} {
+		own := net.ParseIP(s)
+		if own == nil {
+			if s != "" {
+				return true
+			}
+			continue
+		}
+		if isIPv4(own) == isIPv4(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
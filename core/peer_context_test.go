@@ -65,3 +65,15 @@ func TestNewOriginPeerContextErrors(t *testing.T) {
 		require.Error(err)
 	})
 }
+
+func TestPeerContextSetAltIP(t *testing.T) {
+	require := require.New(t)
+
+	p := PeerContextFixture()
+	p.IP = "10.0.0.1"
+
+	require.Error(p.SetAltIP("10.0.0.2"))
+	require.Error(p.SetAltIP("invalid"))
+	require.NoError(p.SetAltIP("fd00::1"))
+	require.Equal("fd00::1", p.AltIP)
+}
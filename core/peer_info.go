@@ -13,7 +13,11 @@
 // limitations under the License.
 package core
 
-import "sort"
+import (
+	"net"
+	"sort"
+	"strconv"
+)
 
 // PeerInfo defines peer metadata scoped to a torrent.
 type PeerInfo struct {
@@ -22,6 +26,14 @@ type PeerInfo struct {
 	Port     int    `json:"port"`
 	Origin   bool   `json:"origin"`
 	Complete bool   `json:"complete"`
+
+	// AltIP is an optional ip of the other ip family than IP, announced by
+	// dual-stack peers.
+	AltIP string `json:"alt_ip,omitempty"`
+
+	// Labels describe the network location of the peer. Only set on announce,
+	// i.e. peer stores need not persist labels.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // NewPeerInfo creates a new PeerInfo.
@@ -43,7 +55,25 @@ func NewPeerInfo(
 
 // PeerInfoFromContext derives PeerInfo from a PeerContext.
 func PeerInfoFromContext(pctx PeerContext, complete bool) *PeerInfo {
-	return NewPeerInfo(pctx.PeerID, pctx.IP, pctx.Port, pctx.Origin, complete)
+	p := NewPeerInfo(pctx.PeerID, pctx.IP, pctx.Port, pctx.Origin, complete)
+	p.AltIP = pctx.AltIP
+	p.Labels = pctx.Labels
+	return p
+}
+
+// Addr returns the "ip:port" address of p. IPv6 ips are bracketed.
+func (p *PeerInfo) Addr() string {
+	return net.JoinHostPort(p.IP, strconv.Itoa(p.Port))
+}
+
+// DialAddr returns the address which the local peer pctx should connect to p
+// on. If p is dual-stack and pctx has no ip in the family of p.IP, the address
+// of p.AltIP is returned.
+func (p *PeerInfo) DialAddr(pctx PeerContext) string {
+	if p.AltIP != "" && !pctx.hasIPFamily(p.IP) && pctx.hasIPFamily(p.AltIP) {
+		return net.JoinHostPort(p.AltIP, strconv.Itoa(p.Port))
+	}
+	return p.Addr()
 }
 
 // PeerInfos groups PeerInfo structs for sorting.
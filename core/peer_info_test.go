@@ -30,3 +30,42 @@ func TestSortedByPeerID(t *testing.T) {
 	require.True(sorted[0].PeerID.LessThan(sorted[1].PeerID))
 	require.True(sorted[1].PeerID.LessThan(sorted[2].PeerID))
 }
+
+func TestPeerInfoAddr(t *testing.T) {
+	require := require.New(t)
+
+	p := PeerInfoFixture()
+	p.IP = "10.0.0.1"
+	p.Port = 8080
+	require.Equal("10.0.0.1:8080", p.Addr())
+
+	p.IP = "fd00::1"
+	require.Equal("[fd00::1]:8080", p.Addr())
+}
+
+func TestPeerInfoDialAddr(t *testing.T) {
+	p := PeerInfoFixture()
+	p.IP = "10.0.0.1"
+	p.AltIP = "fd00::1"
+	p.Port = 8080
+
+	tests := []struct {
+		desc     string
+		ip       string
+		altIP    string
+		expected string
+	}{
+		{"ipv4 peer", "10.0.0.2", "", "10.0.0.1:8080"},
+		{"ipv6 peer", "fd00::2", "", "[fd00::1]:8080"},
+		{"dual-stack peer", "fd00::2", "10.0.0.2", "10.0.0.1:8080"},
+		{"hostname", "localhost", "", "10.0.0.1:8080"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			pctx := PeerContextFixture()
+			pctx.IP = test.ip
+			pctx.AltIP = test.altIP
+			require.Equal(t, test.expected, p.DialAddr(pctx))
+		})
+	}
+}
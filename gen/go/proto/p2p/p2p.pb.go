@@ -31,6 +31,8 @@ It has these top-level messages:
 	CancelPieceMessage
 	ErrorMessage
 	CompleteMessage
+	PexPeer
+	PexMessage
 	Message
 */
 package p2p
@@ -58,13 +60,16 @@ type ErrorMessage_ErrorCode int32
 
 const (
 	ErrorMessage_PIECE_REQUEST_FAILED ErrorMessage_ErrorCode = 0
+	ErrorMessage_PIECE_CORRUPT        ErrorMessage_ErrorCode = 1
 )
 
 var ErrorMessage_ErrorCode_name = map[int32]string{
 	0: "PIECE_REQUEST_FAILED",
+	1: "PIECE_CORRUPT",
 }
 var ErrorMessage_ErrorCode_value = map[string]int32{
 	"PIECE_REQUEST_FAILED": 0,
+	"PIECE_CORRUPT":        1,
 }
 
 func (x ErrorMessage_ErrorCode) String() string {
@@ -82,6 +87,7 @@ const (
 	Message_CANCEL_PIECE  Message_Type = 4
 	Message_ERROR         Message_Type = 5
 	Message_COMPLETE      Message_Type = 6
+	Message_PEX           Message_Type = 7
 )
 
 var Message_Type_name = map[int32]string{
@@ -92,6 +98,7 @@ var Message_Type_name = map[int32]string{
 	4: "CANCEL_PIECE",
 	5: "ERROR",
 	6: "COMPLETE",
+	7: "PEX",
 }
 var Message_Type_value = map[string]int32{
 	"BITFIELD":      0,
@@ -101,12 +108,13 @@ var Message_Type_value = map[string]int32{
 	"CANCEL_PIECE":  4,
 	"ERROR":         5,
 	"COMPLETE":      6,
+	"PEX":           7,
 }
 
 func (x Message_Type) String() string {
 	return proto.EnumName(Message_Type_name, int32(x))
 }
-func (Message_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{7, 0} }
+func (Message_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{9, 0} }
 
 // Binary set of all pieces that peer has downloaded so far. Also serves as a
 // handshaking message, which each peer sends once at the beginning of the
@@ -212,6 +220,39 @@ func (m *CompleteMessage) String() string            { return proto.CompactTextS
 func (*CompleteMessage) ProtoMessage()               {}
 func (*CompleteMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
+// Identifies a peer gossiped in a PexMessage.
+type PexPeer struct {
+	PeerID   string `protobuf:"bytes,1,opt,name=peerID" json:"peerID,omitempty"`
+	Ip       string `protobuf:"bytes,2,opt,name=ip" json:"ip,omitempty"`
+	Port     int32  `protobuf:"varint,3,opt,name=port" json:"port,omitempty"`
+	Origin   bool   `protobuf:"varint,4,opt,name=origin" json:"origin,omitempty"`
+	Complete bool   `protobuf:"varint,5,opt,name=complete" json:"complete,omitempty"`
+	AltIP    string `protobuf:"bytes,6,opt,name=altIP" json:"altIP,omitempty"`
+}
+
+func (m *PexPeer) Reset()                    { *m = PexPeer{} }
+func (m *PexPeer) String() string            { return proto.CompactTextString(m) }
+func (*PexPeer) ProtoMessage()               {}
+func (*PexPeer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+// Gossips peers which the sender is connected to for the torrent of the
+// connection, so the receiver may connect to them without announcing.
+type PexMessage struct {
+	Peers []*PexPeer `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *PexMessage) Reset()                    { *m = PexMessage{} }
+func (m *PexMessage) String() string            { return proto.CompactTextString(m) }
+func (*PexMessage) ProtoMessage()               {}
+func (*PexMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *PexMessage) GetPeers() []*PexPeer {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
 type Message struct {
 	Version       string                `protobuf:"bytes,1,opt,name=version" json:"version,omitempty"`
 	Type          Message_Type          `protobuf:"varint,2,opt,name=type,enum=p2p.Message_Type" json:"type,omitempty"`
@@ -222,12 +263,13 @@ type Message struct {
 	CancelPiece   *CancelPieceMessage   `protobuf:"bytes,7,opt,name=cancelPiece" json:"cancelPiece,omitempty"`
 	Error         *ErrorMessage         `protobuf:"bytes,8,opt,name=error" json:"error,omitempty"`
 	Complete      *CompleteMessage      `protobuf:"bytes,9,opt,name=complete" json:"complete,omitempty"`
+	Pex           *PexMessage           `protobuf:"bytes,10,opt,name=pex" json:"pex,omitempty"`
 }
 
 func (m *Message) Reset()                    { *m = Message{} }
 func (m *Message) String() string            { return proto.CompactTextString(m) }
 func (*Message) ProtoMessage()               {}
-func (*Message) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*Message) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *Message) GetBitfield() *BitfieldMessage {
 	if m != nil {
@@ -278,6 +320,13 @@ func (m *Message) GetComplete() *CompleteMessage {
 	return nil
 }
 
+func (m *Message) GetPex() *PexMessage {
+	if m != nil {
+		return m.Pex
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*BitfieldMessage)(nil), "p2p.BitfieldMessage")
 	proto.RegisterType((*PieceRequestMessage)(nil), "p2p.PieceRequestMessage")
@@ -286,6 +335,8 @@ func init() {
 	proto.RegisterType((*CancelPieceMessage)(nil), "p2p.CancelPieceMessage")
 	proto.RegisterType((*ErrorMessage)(nil), "p2p.ErrorMessage")
 	proto.RegisterType((*CompleteMessage)(nil), "p2p.CompleteMessage")
+	proto.RegisterType((*PexPeer)(nil), "p2p.PexPeer")
+	proto.RegisterType((*PexMessage)(nil), "p2p.PexMessage")
 	proto.RegisterType((*Message)(nil), "p2p.Message")
 	proto.RegisterEnum("p2p.ErrorMessage_ErrorCode", ErrorMessage_ErrorCode_name, ErrorMessage_ErrorCode_value)
 	proto.RegisterEnum("p2p.Message_Type", Message_Type_name, Message_Type_value)
@@ -294,46 +345,53 @@ func init() {
 func init() { proto.RegisterFile("proto/p2p/p2p.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 647 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x54, 0x4f, 0x6f, 0xd3, 0x4e,
-	0x10, 0x6d, 0x12, 0x3b, 0x7f, 0x26, 0x69, 0xeb, 0x6c, 0xa3, 0xdf, 0xcf, 0x14, 0x0e, 0x95, 0x45,
-	0x45, 0x85, 0xa0, 0xad, 0xcc, 0x05, 0x10, 0x12, 0x4a, 0x1c, 0x57, 0x44, 0x4a, 0x9b, 0xb0, 0xa4,
-	0x07, 0xc4, 0xa1, 0x72, 0x9d, 0x49, 0x6b, 0x91, 0x7a, 0x8d, 0xed, 0x56, 0xcd, 0xd7, 0xe0, 0x43,
-	0x21, 0xf1, 0xad, 0xd0, 0x4e, 0xec, 0xc4, 0x6e, 0x02, 0xe2, 0xc0, 0x21, 0x92, 0xdf, 0xf3, 0x7b,
-	0xb3, 0xb3, 0x33, 0x2f, 0x86, 0x9d, 0x20, 0x14, 0xb1, 0x38, 0x0a, 0xcc, 0x40, 0xfe, 0x0e, 0x09,
-	0xb1, 0x52, 0x60, 0x06, 0xc6, 0x8f, 0x22, 0x6c, 0x77, 0xbc, 0x78, 0xe2, 0xe1, 0x74, 0x7c, 0x8a,
-	0x51, 0xe4, 0x5c, 0x21, 0xdb, 0x85, 0xaa, 0xe7, 0x4f, 0xc4, 0x07, 0x27, 0xba, 0xd6, 0x8b, 0x7b,
-	0x85, 0x83, 0x1a, 0x5f, 0x60, 0xc6, 0x40, 0xf1, 0x9d, 0x1b, 0xd4, 0x4b, 0xc4, 0xd3, 0x33, 0xfb,
-	0x0f, 0xca, 0x01, 0x62, 0xd8, 0xeb, 0xea, 0x0a, 0xb1, 0x09, 0x62, 0x4f, 0x61, 0xf3, 0x32, 0x29,
-	0xdd, 0x99, 0xc5, 0x18, 0xe9, 0xea, 0x5e, 0xe1, 0xa0, 0xc1, 0xf3, 0x24, 0x7b, 0x02, 0x35, 0x59,
-	0x25, 0x0a, 0x1c, 0x17, 0xf5, 0x32, 0x15, 0x58, 0x12, 0xec, 0x02, 0x76, 0x42, 0xbc, 0x11, 0x31,
-	0x76, 0x72, 0x95, 0x2a, 0x7b, 0xa5, 0x83, 0xba, 0xf9, 0xf2, 0x50, 0xde, 0xe6, 0x41, 0xfb, 0x87,
-	0x7c, 0x55, 0x6f, 0xfb, 0x71, 0x38, 0xe3, 0xeb, 0x2a, 0xed, 0x9e, 0x80, 0xfe, 0x3b, 0x03, 0xd3,
-	0xa0, 0xf4, 0x15, 0x67, 0x7a, 0x81, 0x9a, 0x92, 0x8f, 0xac, 0x05, 0xea, 0x9d, 0x33, 0xbd, 0x45,
-	0x9a, 0x4b, 0x83, 0xcf, 0xc1, 0xdb, 0xe2, 0xeb, 0x82, 0xf1, 0x05, 0x76, 0x86, 0x1e, 0xba, 0xc8,
-	0xf1, 0xdb, 0x2d, 0x46, 0x71, 0x3a, 0xcb, 0x16, 0xa8, 0x9e, 0x3f, 0xc6, 0x7b, 0x32, 0xa8, 0x7c,
-	0x0e, 0xe4, 0xc4, 0xc4, 0x64, 0x12, 0x61, 0x4c, 0x73, 0x54, 0x79, 0x82, 0x24, 0x3f, 0x45, 0xff,
-	0x2a, 0xbe, 0xa6, 0x49, 0xaa, 0x3c, 0x41, 0x46, 0x94, 0x14, 0x1f, 0x3a, 0xb3, 0xa9, 0x70, 0xc6,
-	0xff, 0xb4, 0xb8, 0xe4, 0xc7, 0xde, 0x15, 0x46, 0x31, 0xed, 0xa7, 0xc6, 0x13, 0x64, 0xbc, 0x80,
-	0x56, 0xdb, 0xf7, 0xc5, 0xad, 0xef, 0x22, 0x1d, 0xfe, 0xc7, 0x53, 0x8d, 0xe7, 0xc0, 0x2c, 0xc7,
-	0x77, 0x71, 0xfa, 0x17, 0xda, 0xef, 0x05, 0x68, 0xd8, 0x61, 0x28, 0xc2, 0x8c, 0x0c, 0x25, 0x4e,
-	0xe2, 0x36, 0x07, 0x4b, 0x73, 0x29, 0x7b, 0xbd, 0x23, 0x50, 0x5c, 0x31, 0x46, 0xba, 0xc4, 0x96,
-	0xf9, 0x98, 0x22, 0x90, 0x2d, 0x36, 0x07, 0x96, 0x18, 0x23, 0x27, 0xa1, 0xb1, 0x0f, 0xb5, 0x05,
-	0xc5, 0x74, 0x68, 0x0d, 0x7b, 0xb6, 0x65, 0x5f, 0x70, 0xfb, 0xe3, 0xb9, 0xfd, 0x69, 0x74, 0x71,
-	0xd2, 0xee, 0xf5, 0xed, 0xae, 0xb6, 0x61, 0x34, 0x61, 0xdb, 0x12, 0x37, 0xc1, 0x14, 0xe3, 0xb4,
-	0x7b, 0xe3, 0xa7, 0x02, 0x95, 0xb4, 0x45, 0x1d, 0x2a, 0x77, 0x18, 0x46, 0x9e, 0xf0, 0x93, 0x3c,
-	0xa4, 0x90, 0xed, 0x83, 0x12, 0xcf, 0x82, 0x79, 0x24, 0xb6, 0xcc, 0x26, 0x35, 0x94, 0xf6, 0x32,
-	0x9a, 0x05, 0xc8, 0xe9, 0x35, 0x3b, 0x86, 0x6a, 0x1a, 0x7c, 0xba, 0x50, 0xdd, 0x6c, 0xad, 0x8b,
-	0x2f, 0x5f, 0xa8, 0xd8, 0x3b, 0x68, 0x04, 0x99, 0x48, 0xd1, 0x8d, 0xeb, 0xa6, 0x4e, 0xae, 0x35,
-	0x59, 0xe3, 0x39, 0xf5, 0xc2, 0x9d, 0x64, 0x86, 0x96, 0x9b, 0x73, 0xe7, 0xc3, 0xc4, 0x73, 0x6a,
-	0xf6, 0x1e, 0x36, 0x9d, 0xec, 0xf2, 0xe9, 0x9f, 0x59, 0x37, 0x1f, 0x91, 0x7d, 0x5d, 0x2c, 0x78,
-	0x5e, 0xcf, 0xde, 0x40, 0xdd, 0x5d, 0xe6, 0x41, 0xaf, 0x90, 0xfd, 0x7f, 0xb2, 0xaf, 0xe6, 0x84,
-	0x67, 0xb5, 0xec, 0x59, 0x9a, 0x86, 0x2a, 0x99, 0x9a, 0x2b, 0x2b, 0x4e, 0x03, 0x72, 0x0c, 0x55,
-	0x37, 0x59, 0x99, 0x5e, 0xcb, 0x8c, 0xf4, 0xc1, 0x1e, 0xf9, 0x42, 0x65, 0xdc, 0x83, 0x22, 0x57,
-	0xc2, 0x1a, 0x50, 0xed, 0xf4, 0x46, 0x27, 0x3d, 0xbb, 0xdf, 0xd5, 0x36, 0x58, 0x13, 0x36, 0x73,
-	0xa1, 0xd0, 0x0a, 0x4b, 0x6a, 0xd8, 0xfe, 0xdc, 0x1f, 0xb4, 0xbb, 0x5a, 0x51, 0x52, 0xed, 0xb3,
-	0xb3, 0xc1, 0xb9, 0x24, 0xe5, 0x2b, 0xad, 0xc4, 0x34, 0x68, 0x58, 0xed, 0x33, 0xcb, 0xee, 0x27,
-	0x8c, 0xc2, 0x6a, 0xa0, 0xda, 0x9c, 0x0f, 0xb8, 0xa6, 0xca, 0x33, 0xac, 0xc1, 0xe9, 0xb0, 0x6f,
-	0x8f, 0x6c, 0xad, 0x7c, 0x59, 0xa6, 0x8f, 0xee, 0xab, 0x5f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xfd,
-	0x11, 0xd8, 0xe6, 0x8b, 0x05, 0x00, 0x00,
+	// 756 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xad, 0x55, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0x71, 0x7e, 0x27, 0x69, 0xeb, 0x6c, 0x23, 0x30, 0x85, 0x43, 0xb1, 0x40, 0x54, 0x08,
+	0xda, 0x2a, 0x5c, 0x0a, 0x42, 0x42, 0x89, 0xeb, 0x8a, 0x48, 0x69, 0x63, 0x96, 0x44, 0x02, 0x71,
+	0xa8, 0xdc, 0x64, 0x93, 0x5a, 0xb8, 0xb6, 0xb1, 0xdd, 0xaa, 0x39, 0xf2, 0x04, 0x3c, 0x05, 0xaf,
+	0xc2, 0x23, 0x71, 0x66, 0x77, 0x6c, 0x27, 0x76, 0x53, 0x10, 0x07, 0x0e, 0x91, 0xf6, 0x9b, 0xf9,
+	0x66, 0x76, 0x66, 0xf6, 0x1b, 0x07, 0x36, 0xfd, 0xc0, 0x8b, 0xbc, 0x3d, 0xbf, 0xed, 0x8b, 0xdf,
+	0x2e, 0x22, 0x22, 0xf3, 0xa3, 0xf6, 0xb3, 0x00, 0x1b, 0x5d, 0x3b, 0x9a, 0xda, 0xcc, 0x99, 0x1c,
+	0xb3, 0x30, 0xb4, 0x66, 0x8c, 0x6c, 0x41, 0xd5, 0x76, 0xa7, 0xde, 0x3b, 0x2b, 0x3c, 0x57, 0x0b,
+	0xdb, 0xd2, 0x4e, 0x8d, 0x2e, 0x30, 0x21, 0x50, 0x74, 0xad, 0x0b, 0xa6, 0xca, 0x68, 0xc7, 0x33,
+	0xb9, 0x0b, 0x65, 0x9f, 0xb1, 0xa0, 0x77, 0xa8, 0x16, 0xd1, 0x9a, 0x20, 0xf2, 0x18, 0xd6, 0xce,
+	0x92, 0xd4, 0xdd, 0x79, 0xc4, 0x42, 0xb5, 0xc4, 0xdd, 0x0d, 0x9a, 0x37, 0x92, 0x87, 0x50, 0x13,
+	0x59, 0x42, 0xdf, 0x1a, 0x33, 0xb5, 0x8c, 0x09, 0x96, 0x06, 0x72, 0x0a, 0x9b, 0x01, 0xbb, 0xf0,
+	0x22, 0xd6, 0xcd, 0x65, 0xaa, 0x6c, 0xcb, 0x3b, 0xf5, 0xf6, 0x8b, 0x5d, 0xd1, 0xcd, 0x8d, 0xf2,
+	0x77, 0xe9, 0x2a, 0xdf, 0x70, 0xa3, 0x60, 0x4e, 0x6f, 0xcb, 0xb4, 0x75, 0x04, 0xea, 0x9f, 0x02,
+	0x88, 0x02, 0xf2, 0x17, 0x36, 0x57, 0x25, 0x2c, 0x4a, 0x1c, 0x49, 0x0b, 0x4a, 0x57, 0x96, 0x73,
+	0xc9, 0x70, 0x2e, 0x0d, 0x1a, 0x83, 0xd7, 0x85, 0x03, 0x49, 0xfb, 0x0c, 0x9b, 0xa6, 0xcd, 0xc6,
+	0x8c, 0xb2, 0xaf, 0x97, 0x2c, 0x8c, 0xd2, 0x59, 0xf2, 0x00, 0xdb, 0x9d, 0xb0, 0x6b, 0x0c, 0x28,
+	0xd1, 0x18, 0x88, 0x89, 0x79, 0xd3, 0x69, 0xc8, 0x22, 0x9c, 0x63, 0x89, 0x26, 0x48, 0xd8, 0x1d,
+	0xe6, 0xce, 0xa2, 0x73, 0x9c, 0x24, 0xb7, 0xc7, 0x48, 0x0b, 0x93, 0xe4, 0xa6, 0x35, 0x77, 0x3c,
+	0x6b, 0xf2, 0x5f, 0x93, 0x0b, 0xfb, 0xc4, 0x9e, 0xf1, 0x9a, 0xf1, 0x7d, 0xf8, 0xf3, 0xc5, 0x48,
+	0x7b, 0x0e, 0xad, 0x8e, 0xeb, 0x7a, 0x97, 0x2e, 0xbf, 0x57, 0x5c, 0xfe, 0xd7, 0x5b, 0xb5, 0x67,
+	0x40, 0x74, 0x8b, 0x53, 0x9d, 0x7f, 0xe0, 0xfe, 0x90, 0xa0, 0x61, 0x04, 0x81, 0x17, 0x64, 0x68,
+	0x4c, 0xe0, 0x44, 0x6e, 0x31, 0x58, 0x06, 0xcb, 0xd9, 0xf6, 0xf6, 0xa0, 0x38, 0xf6, 0x26, 0x0c,
+	0x9b, 0x58, 0x6f, 0x3f, 0x40, 0x09, 0x64, 0x93, 0xc5, 0x40, 0xe7, 0x14, 0x8a, 0x44, 0xed, 0x00,
+	0x6a, 0x0b, 0x13, 0x51, 0xa1, 0x65, 0xf6, 0x0c, 0xdd, 0x38, 0xa5, 0xc6, 0xfb, 0x91, 0xf1, 0x61,
+	0x78, 0x7a, 0xd4, 0xe9, 0xf5, 0x8d, 0x43, 0xe5, 0x0e, 0x69, 0xc2, 0x5a, 0xec, 0xd1, 0x07, 0x94,
+	0x8e, 0xcc, 0xa1, 0x22, 0x69, 0x4d, 0xd8, 0xd0, 0xbd, 0x0b, 0xdf, 0x61, 0x51, 0xda, 0x90, 0xf6,
+	0x5d, 0x82, 0x8a, 0xc9, 0xae, 0x4d, 0xae, 0xf0, 0x8c, 0xee, 0xa5, 0x9c, 0xee, 0xd7, 0xa1, 0x60,
+	0xfb, 0x49, 0x2b, 0xfc, 0x24, 0x76, 0xc6, 0xf7, 0x82, 0xf4, 0x39, 0xf0, 0x8c, 0x8f, 0x14, 0xd8,
+	0x33, 0xdb, 0xc5, 0x3e, 0xaa, 0x34, 0x41, 0x62, 0xf7, 0xc6, 0xc9, 0x95, 0xf8, 0x1c, 0x55, 0xba,
+	0xc0, 0x62, 0x1e, 0x96, 0x13, 0xf5, 0xcc, 0x64, 0x4b, 0x62, 0xa0, 0xed, 0x03, 0xf0, 0x82, 0xd2,
+	0x49, 0x6a, 0x50, 0x12, 0x55, 0x84, 0xfc, 0x7a, 0xb1, 0x21, 0x0d, 0x1c, 0x4f, 0x52, 0x30, 0x8d,
+	0x5d, 0xda, 0xaf, 0x22, 0x54, 0x52, 0xbe, 0x0a, 0x95, 0x2b, 0x6e, 0xb3, 0x3d, 0x37, 0x69, 0x22,
+	0x85, 0xe4, 0x09, 0x14, 0xa3, 0xb9, 0x1f, 0x2b, 0x7d, 0xbd, 0xdd, 0xc4, 0x44, 0xe9, 0x88, 0x87,
+	0xdc, 0x41, 0xd1, 0x4d, 0xf6, 0xa1, 0x9a, 0xee, 0x33, 0x36, 0x58, 0x6f, 0xb7, 0x6e, 0xdb, 0x4a,
+	0xba, 0x60, 0x91, 0x37, 0xd0, 0xf0, 0x33, 0x9b, 0x82, 0x03, 0xa8, 0xb7, 0xd5, 0xb8, 0xd2, 0xd5,
+	0x15, 0xa2, 0x39, 0xf6, 0x22, 0x3a, 0x59, 0x05, 0x1c, 0x52, 0x2e, 0x3a, 0xbf, 0x23, 0x34, 0xc7,
+	0x26, 0x6f, 0x61, 0xcd, 0xca, 0x6a, 0x1a, 0x47, 0x59, 0x6f, 0xdf, 0xc7, 0xf0, 0xdb, 0xd4, 0x4e,
+	0xf3, 0x7c, 0xf2, 0x0a, 0xea, 0xe3, 0xa5, 0xcc, 0xf9, 0x77, 0x48, 0x84, 0xdf, 0xc3, 0xf0, 0x55,
+	0xf9, 0xd3, 0x2c, 0x97, 0x3c, 0x4d, 0x45, 0x5e, 0xc5, 0xa0, 0xe6, 0x8a, 0x72, 0x53, 0xdd, 0xef,
+	0x67, 0x34, 0x50, 0xcb, 0x8c, 0xf4, 0x86, 0x16, 0x33, 0xca, 0x78, 0x04, 0xb2, 0xcf, 0xf7, 0x04,
+	0x90, 0xbc, 0x91, 0xbe, 0x79, 0xca, 0x13, 0x3e, 0xed, 0x9b, 0x04, 0x45, 0xf1, 0x6c, 0xa4, 0x01,
+	0xd5, 0x6e, 0x6f, 0x78, 0xd4, 0x33, 0xfa, 0x39, 0xd5, 0x27, 0xfb, 0xa0, 0x48, 0x4b, 0x93, 0xd9,
+	0xf9, 0xd4, 0x1f, 0x74, 0x0e, 0x95, 0x82, 0x30, 0x75, 0x4e, 0x4e, 0x06, 0x23, 0x61, 0x14, 0x2e,
+	0x45, 0xe6, 0xdf, 0xc6, 0x86, 0xde, 0x39, 0xd1, 0x8d, 0x7e, 0x62, 0x29, 0x92, 0x1a, 0x94, 0x0c,
+	0x4a, 0x07, 0x54, 0x29, 0x89, 0x3b, 0xf4, 0xc1, 0xb1, 0xd9, 0x37, 0x86, 0x86, 0x52, 0x26, 0x15,
+	0x90, 0x4d, 0xe3, 0xa3, 0x52, 0x39, 0x2b, 0xe3, 0x1f, 0xcf, 0xcb, 0xdf, 0x0a, 0x34, 0xb2, 0xed,
+	0x8f, 0x06, 0x00, 0x00,
 }
@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package azureblob
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/andres-erbsen/clock"
+)
+
+const (
+	_imdsEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	_storageScope = "https://storage.azure.com/"
+
+	// Tokens are refreshed this long before they expire.
+	_tokenRefreshMargin = 5 * time.Minute
+)
+
+// credential authorizes requests to the blob service.
+type credential interface {
+	// authorize adds authorization to a request for u, either as query
+	// parameters of u or as headers.
+	authorize(u *url.URL, headers map[string]string) error
+}
+
+func newCredential(auth AuthConfig) (credential, error) {
+	a := auth.Azure
+	switch {
+	case a.SASToken != "" && a.ManagedIdentity:
+		return nil, errors.New("sas_token and managed_identity are mutually exclusive")
+	case a.SASToken != "":
+		return newSASCredential(a.SASToken)
+	case a.ManagedIdentity:
+		return newManagedIdentityCredential(_imdsEndpoint, a.ClientID, clock.New()), nil
+	default:
+		return nil, errors.New("one of sas_token or managed_identity required")
+	}
+}
+
+// sasCredential authorizes requests with a shared access signature.
+type sasCredential struct {
+	query url.Values
+}
+
+func newSASCredential(token string) (*sasCredential, error) {
+	query, err := url.ParseQuery(strings.TrimPrefix(token, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("parse sas token: %s", err)
+	}
+	return &sasCredential{query}, nil
+}
+
+func (c *sasCredential) authorize(u *url.URL, headers map[string]string) error {
+	q := u.Query()
+	for k, v := range c.query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return nil
+}
+
+// managedIdentityCredential authorizes requests with OAuth tokens of the
+// host's managed identity, fetched from the instance metadata service.
+type managedIdentityCredential struct {
+	endpoint string
+	clientID string
+	clk      clock.Clock
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newManagedIdentityCredential(
+	endpoint, clientID string, clk clock.Clock) *managedIdentityCredential {
+
+	return &managedIdentityCredential{endpoint: endpoint, clientID: clientID, clk: clk}
+}
+
+func (c *managedIdentityCredential) authorize(u *url.URL, headers map[string]string) error {
+	token, err := c.getToken()
+	if err != nil {
+		return fmt.Errorf("get managed identity token: %s", err)
+	}
+	headers["Authorization"] = "Bearer " + token
+	return nil
+}
+
+func (c *managedIdentityCredential) getToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && c.clk.Now().Add(_tokenRefreshMargin).Before(c.expires) {
+		return c.token, nil
+	}
+
+	q := url.Values{}
+	q.Set("api-version", "2018-02-01")
+	q.Set("resource", _storageScope)
+	if c.clientID != "" {
+		q.Set("client_id", c.clientID)
+	}
+	resp, err := httputil.Get(
+		c.endpoint+"?"+q.Encode(),
+		httputil.SendHeaders(map[string]string{"Metadata": "true"}),
+		httputil.SendTimeout(10*time.Second))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode token: %s", err)
+	}
+	expiresOn, err := strconv.ParseInt(body.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("parse expires_on: %s", err)
+	}
+	c.token = body.AccessToken
+	c.expires = time.Unix(expiresOn, 0)
+	return c.token, nil
+}
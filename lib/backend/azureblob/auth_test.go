@@ -0,0 +1,72 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package azureblob
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSASCredential(t *testing.T) {
+	require := require.New(t)
+
+	cred, err := newSASCredential("?sv=2020-10-02&sig=secret")
+	require.NoError(err)
+
+	u, err := url.Parse("https://account.blob.core.windows.net/c/blob?comp=block")
+	require.NoError(err)
+	require.NoError(cred.authorize(u, map[string]string{}))
+	require.Equal("block", u.Query().Get("comp"))
+	require.Equal("secret", u.Query().Get("sig"))
+}
+
+func TestManagedIdentityCredentialCachesToken(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		require.Equal("true", r.Header.Get("Metadata"))
+		require.Equal(_storageScope, r.URL.Query().Get("resource"))
+		require.Equal("client", r.URL.Query().Get("client_id"))
+		fmt.Fprintf(w, `{"access_token": "token%d", "expires_on": "%d"}`,
+			calls, clk.Now().Add(time.Hour).Unix())
+	}))
+	defer server.Close()
+
+	cred := newManagedIdentityCredential(server.URL, "client", clk)
+
+	headers := map[string]string{}
+	require.NoError(cred.authorize(&url.URL{}, headers))
+	require.Equal("Bearer token1", headers["Authorization"])
+
+	clk.Add(30 * time.Minute)
+	require.NoError(cred.authorize(&url.URL{}, headers))
+	require.Equal("Bearer token1", headers["Authorization"])
+
+	// Refreshed shortly before expiry.
+	clk.Add(26 * time.Minute)
+	require.NoError(cred.authorize(&url.URL{}, headers))
+	require.Equal("Bearer token2", headers["Authorization"])
+}
@@ -0,0 +1,485 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package azureblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v2"
+)
+
+const _azureblob = "azureblob"
+
+// _apiVersion is the version of the blob service REST API used.
+const _apiVersion = "2020-10-02"
+
+// _maxBlocks is the maximum number of blocks of a block blob.
+const _maxBlocks = 50000
+
+func init() {
+	backend.Register(_azureblob, &factory{})
+}
+
+type factory struct{}
+
+func (f *factory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal azureblob config")
+	}
+	authConfBytes, err := yaml.Marshal(masterAuthConfig[_azureblob])
+	if err != nil {
+		return nil, errors.New("marshal azureblob auth config")
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal azureblob config")
+	}
+	var userAuth UserAuthConfig
+	if err := yaml.Unmarshal(authConfBytes, &userAuth); err != nil {
+		return nil, errors.New("unmarshal azureblob auth config")
+	}
+
+	return NewClient(config, userAuth, stats)
+}
+
+// Client implements a backend.Client for Azure Blob Storage. Blobs are stored
+// as block blobs.
+type Client struct {
+	config Config
+	pather namepath.Pather
+	stats  tally.Scope
+	cred   credential
+
+	blocks sync.Pool
+}
+
+// NewClient creates a new Client for Azure Blob Storage.
+func NewClient(config Config, userAuth UserAuthConfig, stats tally.Scope) (*Client, error) {
+	config.applyDefaults()
+	if config.Username == "" {
+		return nil, errors.New("invalid config: username required")
+	}
+	if config.Endpoint == "" {
+		return nil, errors.New("invalid config: account or endpoint required")
+	}
+	if config.Container == "" {
+		return nil, errors.New("invalid config: container required")
+	}
+	if !path.IsAbs(config.RootDirectory) {
+		return nil, errors.New("invalid config: root_directory must be absolute path")
+	}
+
+	pather, err := namepath.New(config.RootDirectory, config.NamePath)
+	if err != nil {
+		return nil, fmt.Errorf("namepath: %s", err)
+	}
+
+	auth, ok := userAuth[config.Username]
+	if !ok {
+		return nil, errors.New("auth not configured for username")
+	}
+	cred, err := newCredential(auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth config: %s", err)
+	}
+
+	c := &Client{config: config, pather: pather, stats: stats, cred: cred}
+	c.blocks.New = func() interface{} {
+		b := make([]byte, config.UploadBlockSize)
+		return &b
+	}
+	return c, nil
+}
+
+// blobURL returns the URL of the blob at path p with query parameters q.
+func (c *Client) blobURL(p string, q url.Values) (*url.URL, error) {
+	u, err := url.Parse(c.config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %s", err)
+	}
+	u.Path = path.Join("/", u.Path, c.config.Container, p)
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// send sends an authorized request to the blob service.
+func (c *Client) send(
+	method string, u *url.URL, headers map[string]string, options ...httputil.SendOption) (*http.Response, error) {
+
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["x-ms-version"] = _apiVersion
+	if err := c.cred.authorize(u, headers); err != nil {
+		return nil, err
+	}
+	options = append(options,
+		httputil.SendHeaders(headers),
+		httputil.SendTimeout(c.config.Timeout))
+	return httputil.Send(method, u.String(), options...)
+}
+
+// Stat returns blob info for name.
+func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("blob path: %s", err)
+	}
+	u, err := c.blobURL(p, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send("HEAD", u, nil)
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, backenderrors.ErrBlobNotFound
+		}
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse content length: %s", err)
+	}
+	return core.NewBlobInfo(size), nil
+}
+
+// Download downloads the content from a configured container and writes the
+// data to dst.
+func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	u, err := c.blobURL(p, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send("GET", u, nil)
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer closers.Close(resp.Body)
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return fmt.Errorf("copy: %s", err)
+	}
+	return nil
+}
+
+// DownloadRange downloads length bytes of name starting at offset using the
+// x-ms-range header of Get Blob.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	u, err := c.blobURL(p, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(
+		"GET", u,
+		map[string]string{"x-ms-range": backend.RangeHeader(offset, length)},
+		httputil.SendAcceptedCodes(http.StatusPartialContent))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer closers.Close(resp.Body)
+
+	if err := backend.CopyRange(dst, resp.Body, 0, length); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	return nil
+}
+
+// Upload uploads src to a configured container. Blobs larger than a single
+// block are staged as multiple blocks in parallel and then committed.
+func (c *Client) Upload(namespace, name string, src io.Reader) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+
+	first := c.blocks.Get().(*[]byte)
+	n, err := io.ReadFull(src, *first)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		defer c.blocks.Put(first)
+		return c.putBlob(p, (*first)[:n])
+	} else if err != nil {
+		c.blocks.Put(first)
+		return fmt.Errorf("read block: %s", err)
+	}
+	return c.putBlocks(p, first, src)
+}
+
+// UploadStream uploads src to a configured container. Blocks are read from
+// src as they are staged, so the length of src need not be known upfront.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Upload(namespace, name, src)
+}
+
+// Delete deletes name from the configured container.
+func (c *Client) Delete(namespace, name string) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	u, err := c.blobURL(p, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send("DELETE", u, nil, httputil.SendAcceptedCodes(http.StatusAccepted))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+// putBlob uploads b as a blob in a single request.
+func (c *Client) putBlob(p string, b []byte) error {
+	u, err := c.blobURL(p, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send("PUT", u,
+		map[string]string{"x-ms-blob-type": "BlockBlob"},
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	if err != nil {
+		return err
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+// putBlocks stages first and the rest of src as blocks of p, then commits the
+// block list. At most UploadConcurrency blocks are buffered at once.
+func (c *Client) putBlocks(p string, first *[]byte, src io.Reader) error {
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(c.config.UploadConcurrency)
+
+	var ids []string
+	var readErr error
+	buf, n := first, len(*first)
+	for {
+		if len(ids) == _maxBlocks {
+			c.blocks.Put(buf)
+			readErr = errors.New("upload exceeds maximum number of blocks")
+			break
+		}
+		id := blockID(len(ids))
+		ids = append(ids, id)
+		b, size := buf, n
+		g.Go(func() error {
+			defer c.blocks.Put(b)
+			return c.putBlock(p, id, (*b)[:size])
+		})
+		if ctx.Err() != nil {
+			break
+		}
+
+		next := c.blocks.Get().(*[]byte)
+		m, err := io.ReadFull(src, *next)
+		if err == io.EOF {
+			c.blocks.Put(next)
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			c.blocks.Put(next)
+			readErr = fmt.Errorf("read block: %s", err)
+			break
+		}
+		buf, n = next, m
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if readErr != nil {
+		return readErr
+	}
+	return c.putBlockList(p, ids)
+}
+
+// blockID returns the id of the i-th block. All block ids of a blob must have
+// the same length.
+func blockID(i int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", i)))
+}
+
+func (c *Client) putBlock(p, id string, b []byte) error {
+	u, err := c.blobURL(p, url.Values{"comp": {"block"}, "blockid": {id}})
+	if err != nil {
+		return err
+	}
+	resp, err := c.send("PUT", u, nil,
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	if err != nil {
+		return fmt.Errorf("put block %s: %s", id, err)
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+type blockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+func (c *Client) putBlockList(p string, ids []string) error {
+	body, err := xml.Marshal(blockList{Latest: ids})
+	if err != nil {
+		return fmt.Errorf("marshal block list: %s", err)
+	}
+	u, err := c.blobURL(p, url.Values{"comp": {"blocklist"}})
+	if err != nil {
+		return err
+	}
+	resp, err := c.send("PUT", u, nil,
+		httputil.SendBody(bytes.NewReader(append([]byte(xml.Header), body...))),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	if err != nil {
+		return fmt.Errorf("put block list: %s", err)
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+type enumerationResults struct {
+	Blobs struct {
+		Blob []struct {
+			Name string `xml:"Name"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// List lists names that start with prefix.
+func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	options := backend.DefaultListOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	maxKeys := c.config.ListMaxKeys
+	marker := ""
+	if options.Paginated {
+		maxKeys = options.MaxKeys
+		marker = options.ContinuationToken
+	}
+
+	// Blob names do not have a leading slash, so it is stripped from the
+	// prefix and added back to each listed name.
+	absPrefix := path.Join(c.pather.BasePath(), prefix)[1:]
+
+	var names []string
+	for {
+		q := url.Values{
+			"restype":    {"container"},
+			"comp":       {"list"},
+			"prefix":     {absPrefix},
+			"maxresults": {strconv.Itoa(maxKeys)},
+		}
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		u, err := c.blobURL("", q)
+		if err != nil {
+			return nil, err
+		}
+		page, err := c.listPage(u)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range page.Blobs.Blob {
+			name, err := c.pather.NameFromBlobPath(path.Join("/", b.Name))
+			if err != nil {
+				log.With("blob", b.Name).Errorf("Error converting blob path into name: %s", err)
+				continue
+			}
+			names = append(names, name)
+		}
+		marker = page.NextMarker
+		if options.Paginated || marker == "" {
+			break
+		}
+	}
+
+	result := &backend.ListResult{Names: names}
+	if options.Paginated {
+		result.ContinuationToken = marker
+	}
+	return result, nil
+}
+
+func (c *Client) listPage(u *url.URL) (*enumerationResults, error) {
+	resp, err := c.send("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+
+	var page enumerationResults
+	if err := xml.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("decode list results: %s", err)
+	}
+	return &page, nil
+}
+
+// Close closes the client and releases any held resources.
+func (c *Client) Close() error {
+	return nil
+}
@@ -0,0 +1,338 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package azureblob
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const _container = "test-container"
+
+// fakeBlobService implements the subset of the blob service REST API used by
+// Client, authorized by a SAS token.
+type fakeBlobService struct {
+	sync.Mutex
+	blobs  map[string][]byte
+	staged map[string][]byte
+	puts   int
+}
+
+func newFakeBlobService() *fakeBlobService {
+	return &fakeBlobService{
+		blobs:  make(map[string][]byte),
+		staged: make(map[string][]byte),
+	}
+}
+
+func (s *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.URL.Query().Get("sig") != "secret" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+_container), "/")
+	q := r.URL.Query()
+
+	switch {
+	case r.Method == "GET" && q.Get("comp") == "list":
+		s.list(w, q.Get("prefix"), q.Get("maxresults"), q.Get("marker"))
+	case r.Method == "HEAD" || r.Method == "GET":
+		b, ok := s.blobs[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if rng := r.Header.Get("x-ms-range"); rng != "" && r.Method == "GET" {
+			var start, end int
+			fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			if start >= len(b) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			if end >= len(b) {
+				end = len(b) - 1
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(b[start : end+1])
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if r.Method == "GET" {
+			w.Write(b)
+		}
+	case r.Method == "DELETE":
+		if _, ok := s.blobs[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "PUT" && q.Get("comp") == "block":
+		b, _ := io.ReadAll(r.Body)
+		s.staged[name+"/"+q.Get("blockid")] = b
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT" && q.Get("comp") == "blocklist":
+		var l blockList
+		if err := xml.NewDecoder(r.Body).Decode(&l); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var blob []byte
+		for _, id := range l.Latest {
+			b, ok := s.staged[name+"/"+id]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blob = append(blob, b...)
+		}
+		s.blobs[name] = blob
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT" && r.Header.Get("x-ms-blob-type") == "BlockBlob":
+		b, _ := io.ReadAll(r.Body)
+		s.blobs[name] = b
+		s.puts++
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *fakeBlobService) list(w http.ResponseWriter, prefix, maxresults, marker string) {
+	var names []string
+	for name := range s.blobs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	start, _ := strconv.Atoi(marker)
+	max, _ := strconv.Atoi(maxresults)
+	end := start + max
+	if end > len(names) {
+		end = len(names)
+	}
+	var result enumerationResults
+	for _, name := range names[start:end] {
+		result.Blobs.Blob = append(result.Blobs.Blob, struct {
+			Name string `xml:"Name"`
+		}{name})
+	}
+	if end < len(names) {
+		result.NextMarker = strconv.Itoa(end)
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestClient(t *testing.T, config Config) (*Client, *fakeBlobService) {
+	s := newFakeBlobService()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	config.Username = "test-user"
+	config.Endpoint = server.URL
+	config.Container = _container
+	config.RootDirectory = "/root"
+	config.NamePath = "identity"
+
+	var auth AuthConfig
+	auth.Azure.SASToken = "?sv=2020-10-02&sig=secret"
+
+	c, err := NewClient(config, UserAuthConfig{"test-user": auth}, tally.NoopScope)
+	require.NoError(t, err)
+	return c, s
+}
+
+func TestClientFactory(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Username:      "test-user",
+		Account:       "test-account",
+		Container:     _container,
+		NamePath:      "identity",
+		RootDirectory: "/root",
+	}
+	var auth AuthConfig
+	auth.Azure.SASToken = "sig=secret"
+	masterAuth := backend.AuthConfig{_azureblob: UserAuthConfig{"test-user": auth}}
+	f := factory{}
+	_, err := f.Create(config, masterAuth, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+}
+
+func TestNewClientInvalidAuth(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Username:      "test-user",
+		Account:       "test-account",
+		Container:     _container,
+		NamePath:      "identity",
+		RootDirectory: "/root",
+	}
+	var auth AuthConfig
+	_, err := NewClient(config, UserAuthConfig{"test-user": auth}, tally.NoopScope)
+	require.Error(err)
+
+	auth.Azure.SASToken = "sig=secret"
+	auth.Azure.ManagedIdentity = true
+	_, err = NewClient(config, UserAuthConfig{"test-user": auth}, tally.NoopScope)
+	require.Error(err)
+}
+
+func TestClientUploadSingleBlob(t *testing.T) {
+	require := require.New(t)
+
+	client, s := newTestClient(t, Config{})
+
+	data := randutil.Text(32)
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+	require.Equal(1, s.puts)
+
+	info, err := client.Stat(core.NamespaceFixture(), "test")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(32), info)
+
+	var b bytes.Buffer
+	require.NoError(client.Download(core.NamespaceFixture(), "test", &b))
+	require.Equal(data, b.Bytes())
+}
+
+func TestClientUploadBlocks(t *testing.T) {
+	require := require.New(t)
+
+	client, s := newTestClient(t, Config{UploadBlockSize: 10, UploadConcurrency: 2})
+
+	data := randutil.Text(95)
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", io.MultiReader(bytes.NewReader(data))))
+	require.Equal(0, s.puts)
+	require.Len(s.staged, 10)
+
+	var b bytes.Buffer
+	require.NoError(client.Download(core.NamespaceFixture(), "test", &b))
+	require.Equal(data, b.Bytes())
+}
+
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	client, _ := newTestClient(t, Config{})
+
+	data := randutil.Text(64)
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 16, 8, &b))
+	require.Equal(data[16:24], b.Bytes())
+
+	err := client.DownloadRange(core.NamespaceFixture(), "test", 60, 8, &b)
+	require.True(errors.Is(err, backend.ErrShortRange))
+
+	require.Error(client.DownloadRange(core.NamespaceFixture(), "test", 64, 8, &b))
+
+	require.Equal(backenderrors.ErrBlobNotFound,
+		client.DownloadRange(core.NamespaceFixture(), "missing", 0, 8, &b))
+}
+
+func TestClientNotFound(t *testing.T) {
+	require := require.New(t)
+
+	client, _ := newTestClient(t, Config{})
+
+	_, err := client.Stat(core.NamespaceFixture(), "test")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	var b bytes.Buffer
+	require.Equal(backenderrors.ErrBlobNotFound, client.Download(core.NamespaceFixture(), "test", &b))
+}
+
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	client, _ := newTestClient(t, Config{})
+
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(randutil.Text(32))))
+	require.NoError(client.Delete(core.NamespaceFixture(), "test"))
+
+	_, err := client.Stat(core.NamespaceFixture(), "test")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	require.Equal(backenderrors.ErrBlobNotFound, client.Delete(core.NamespaceFixture(), "test"))
+}
+
+func TestClientList(t *testing.T) {
+	require := require.New(t)
+
+	client, _ := newTestClient(t, Config{ListMaxKeys: 2})
+
+	var expected []string
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("test/%d", i)
+		require.NoError(client.Upload(core.NamespaceFixture(), name, bytes.NewReader(randutil.Text(8))))
+		expected = append(expected, name)
+	}
+	require.NoError(client.Upload(core.NamespaceFixture(), "other", bytes.NewReader(randutil.Text(8))))
+
+	result, err := client.List("test")
+	require.NoError(err)
+	require.Equal(expected, result.Names)
+	require.Equal("", result.ContinuationToken)
+}
+
+func TestClientListPaginated(t *testing.T) {
+	require := require.New(t)
+
+	client, _ := newTestClient(t, Config{})
+
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("test/%d", i)
+		require.NoError(client.Upload(core.NamespaceFixture(), name, bytes.NewReader(randutil.Text(8))))
+	}
+
+	result, err := client.List("test", backend.ListWithPagination(), backend.ListWithMaxKeys(2))
+	require.NoError(err)
+	require.Equal([]string{"test/0", "test/1"}, result.Names)
+	require.NotEmpty(result.ContinuationToken)
+
+	result, err = client.List("test",
+		backend.ListWithPagination(),
+		backend.ListWithMaxKeys(2),
+		backend.ListWithContinuationToken(result.ContinuationToken))
+	require.NoError(err)
+	require.Equal([]string{"test/2"}, result.Names)
+	require.Equal("", result.ContinuationToken)
+}
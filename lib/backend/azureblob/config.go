@@ -0,0 +1,83 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package azureblob
+
+import (
+	"time"
+
+	"github.com/uber/kraken/lib/backend"
+)
+
+// Config defines Azure Blob Storage connection specific parameters.
+type Config struct {
+	Username  string `yaml:"username"`  // Username for selecting credentials.
+	Account   string `yaml:"account"`   // Storage account name.
+	Container string `yaml:"container"` // Blob container.
+
+	// Endpoint overrides the blob service endpoint of the storage account.
+	// Defaults to https://<account>.blob.core.windows.net.
+	Endpoint string `yaml:"endpoint"`
+
+	RootDirectory     string `yaml:"root_directory"`     // Root directory for docker images
+	UploadBlockSize   int64  `yaml:"upload_block_size"`  // Size of blocks staged during upload
+	UploadConcurrency int    `yaml:"upload_concurrency"` // # of blocks staged in parallel
+
+	// Timeout bounds each request made to the blob service.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// ListMaxKeys sets the max keys returned per page.
+	ListMaxKeys int `yaml:"list_max_keys"`
+
+	// NamePath identifies which namepath.Pather to use.
+	NamePath string `yaml:"name_path"`
+}
+
+// UserAuthConfig defines authentication configuration overlayed by Langley.
+// Each key is the username of the credentials.
+type UserAuthConfig map[string]AuthConfig
+
+// AuthConfig matches Langley format. Exactly one of SASToken or
+// ManagedIdentity must be set.
+type AuthConfig struct {
+	Azure struct {
+		// SASToken is a shared access signature query string granting
+		// access to the container.
+		SASToken string `yaml:"sas_token"`
+
+		// ManagedIdentity authenticates with the managed identity of the
+		// host, via the instance metadata service.
+		ManagedIdentity bool `yaml:"managed_identity"`
+
+		// ClientID selects a user-assigned managed identity. Optional.
+		ClientID string `yaml:"client_id"`
+	} `yaml:"azure"`
+}
+
+func (c *Config) applyDefaults() {
+	if c.Endpoint == "" && c.Account != "" {
+		c.Endpoint = "https://" + c.Account + ".blob.core.windows.net"
+	}
+	if c.UploadBlockSize == 0 {
+		c.UploadBlockSize = backend.DefaultPartSize
+	}
+	if c.UploadConcurrency == 0 {
+		c.UploadConcurrency = backend.DefaultConcurrency
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 15 * time.Minute
+	}
+	if c.ListMaxKeys == 0 {
+		c.ListMaxKeys = backend.DefaultListMaxKeys
+	}
+}
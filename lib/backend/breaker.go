@@ -0,0 +1,162 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker of a backend is open.
+var ErrCircuitOpen = errors.New("backend circuit breaker open")
+
+// circuitBreakerClient stops calling the wrapped Client after consecutive
+// failures, until a trial operation succeeds.
+type circuitBreakerClient struct {
+	Client
+	config CircuitBreakerConfig
+	clk    clock.Clock
+	opened tally.Counter
+	reject tally.Counter
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// WithCircuitBreaker returns a Middleware which opens the circuit after
+// config.FailureThreshold consecutive failures. While open, operations fail
+// with ErrCircuitOpen. After config.ResetTimeout, a single trial operation is
+// let through, which closes the circuit on success.
+func WithCircuitBreaker(config CircuitBreakerConfig, clk clock.Clock, stats tally.Scope) Middleware {
+	config.applyDefaults()
+	return func(c Client) Client {
+		return &circuitBreakerClient{
+			Client: c,
+			config: config,
+			clk:    clk,
+			opened: stats.Counter("backend_circuit_opened"),
+			reject: stats.Counter("backend_circuit_rejected"),
+		}
+	}
+}
+
+// allow returns whether an operation may be attempted.
+func (c *circuitBreakerClient) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures < c.config.FailureThreshold {
+		return true
+	}
+	if c.trial || c.clk.Now().Sub(c.openedAt) < c.config.ResetTimeout {
+		c.reject.Inc(1)
+		return false
+	}
+	c.trial = true
+	return true
+}
+
+// done records the result of an allowed operation.
+func (c *circuitBreakerClient) done(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trial = false
+	if err == nil || err == backenderrors.ErrBlobNotFound {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.failures >= c.config.FailureThreshold {
+		if c.failures == c.config.FailureThreshold {
+			c.opened.Inc(1)
+		}
+		c.openedAt = c.clk.Now()
+	}
+}
+
+func (c *circuitBreakerClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	if !c.allow() {
+		return nil, ErrCircuitOpen
+	}
+	info, err := c.Client.Stat(namespace, name)
+	c.done(err)
+	return info, err
+}
+
+func (c *circuitBreakerClient) Upload(namespace, name string, src io.Reader) error {
+	if !c.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.Client.Upload(namespace, name, src)
+	c.done(err)
+	return err
+}
+
+func (c *circuitBreakerClient) UploadStream(namespace, name string, src io.Reader) error {
+	if !c.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.Client.UploadStream(namespace, name, src)
+	c.done(err)
+	return err
+}
+
+func (c *circuitBreakerClient) Download(namespace, name string, dst io.Writer) error {
+	if !c.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.Client.Download(namespace, name, dst)
+	c.done(err)
+	return err
+}
+
+func (c *circuitBreakerClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if !c.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.Client.DownloadRange(namespace, name, offset, length, dst)
+	c.done(err)
+	return err
+}
+
+func (c *circuitBreakerClient) Delete(namespace, name string) error {
+	if !c.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.Client.Delete(namespace, name)
+	c.done(err)
+	return err
+}
+
+func (c *circuitBreakerClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	if !c.allow() {
+		return nil, ErrCircuitOpen
+	}
+	result, err := c.Client.List(prefix, opts...)
+	c.done(err)
+	return result, err
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
+	"github.com/uber-go/tally"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig defines caching of backend responses.
+type CacheConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// TTL is how long successful responses are cached.
+	TTL time.Duration `yaml:"ttl"`
+
+	// NegativeTTL is how long ErrBlobNotFound responses are cached. Not found
+	// responses are not cached if zero.
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+
+	// MaxEntries bounds the number of cached responses.
+	MaxEntries int `yaml:"max_entries"`
+
+	// Downloads enables caching of Download content, which is intended for
+	// tag backends where blobs are small and read on every pull. Blobs larger
+	// than MaxDownloadSize are never cached.
+	Downloads       bool              `yaml:"downloads"`
+	MaxDownloadSize datasize.ByteSize `yaml:"max_download_size"`
+}
+
+func (c *CacheConfig) applyDefaults() {
+	if c.TTL == 0 {
+		c.TTL = 30 * time.Second
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 10000
+	}
+	if c.MaxDownloadSize == 0 {
+		c.MaxDownloadSize = 64 * datasize.KB
+	}
+}
+
+type cacheEntry struct {
+	key     string
+	info    *core.BlobInfo
+	data    []byte
+	err     error
+	expires time.Time
+}
+
+// responseCache is an LRU cache of responses with per-entry expiration.
+type responseCache struct {
+	clk        clock.Clock
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newResponseCache(maxEntries int, clk clock.Clock) *responseCache {
+	return &responseCache{
+		clk:        clk,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (c *responseCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if c.clk.Now().After(entry.expires) {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry, true
+}
+
+func (c *responseCache) add(entry *cacheEntry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.expires = c.clk.Now().Add(ttl)
+	if e, ok := c.entries[entry.key]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *responseCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// cachingClient caches Stat, and optionally Download, responses of the wrapped
+// Client. Concurrent requests for the same name share a single backend call.
+type cachingClient struct {
+	Client
+	config CacheConfig
+	stats  tally.Scope
+	stat   *responseCache
+	dl     *responseCache
+	group  singleflight.Group
+}
+
+// errTooLarge signals that a download exceeded the cacheable size.
+var errTooLarge = errors.New("download too large to cache")
+
+// WithCache returns a Middleware which caches responses according to config.
+// Uploads invalidate the cached responses of the uploaded name, however other
+// processes may observe stale responses for up to config.TTL.
+func WithCache(config CacheConfig, clk clock.Clock, stats tally.Scope) Middleware {
+	config.applyDefaults()
+	return func(c Client) Client {
+		return &cachingClient{
+			Client: c,
+			config: config,
+			stats:  stats.SubScope("backend_cache"),
+			stat:   newResponseCache(config.MaxEntries, clk),
+			dl:     newResponseCache(config.MaxEntries, clk),
+		}
+	}
+}
+
+func cacheKey(namespace, name string) string {
+	return namespace + "\x00" + name
+}
+
+// ttl returns how long a response with err should be cached, or zero if it
+// should not be cached.
+func (c *cachingClient) ttl(err error) time.Duration {
+	switch err {
+	case nil:
+		return c.config.TTL
+	case backenderrors.ErrBlobNotFound:
+		return c.config.NegativeTTL
+	default:
+		return 0
+	}
+}
+
+func (c *cachingClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	key := cacheKey(namespace, name)
+	if entry, ok := c.stat.get(key); ok {
+		c.stats.Counter("stat_hit").Inc(1)
+		return entry.info, entry.err
+	}
+	c.stats.Counter("stat_miss").Inc(1)
+
+	v, err, _ := c.group.Do("stat\x00"+key, func() (interface{}, error) {
+		info, err := c.Client.Stat(namespace, name)
+		if ttl := c.ttl(err); ttl > 0 {
+			c.stat.add(&cacheEntry{key: key, info: info, err: err}, ttl)
+		}
+		return info, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*core.BlobInfo), nil
+}
+
+// limitedBuffer is a bytes.Buffer which fails writes beyond max bytes.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		b.exceeded = true
+		return 0, errTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+func (c *cachingClient) Download(namespace, name string, dst io.Writer) error {
+	if !c.config.Downloads {
+		return c.Client.Download(namespace, name, dst)
+	}
+	key := cacheKey(namespace, name)
+	if entry, ok := c.dl.get(key); ok {
+		c.stats.Counter("download_hit").Inc(1)
+		if entry.err != nil {
+			return entry.err
+		}
+		_, err := dst.Write(entry.data)
+		return err
+	}
+	c.stats.Counter("download_miss").Inc(1)
+
+	v, err, _ := c.group.Do("download\x00"+key, func() (interface{}, error) {
+		buf := &limitedBuffer{max: int(c.config.MaxDownloadSize)}
+		err := c.Client.Download(namespace, name, buf)
+		if buf.exceeded {
+			// Backends may wrap the write error, so check the buffer instead.
+			return nil, errTooLarge
+		}
+		if ttl := c.ttl(err); ttl > 0 {
+			c.dl.add(&cacheEntry{key: key, data: buf.Bytes(), err: err}, ttl)
+		}
+		return buf.Bytes(), err
+	})
+	if err == errTooLarge {
+		return c.Client.Download(namespace, name, dst)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(v.([]byte))
+	return err
+}
+
+func (c *cachingClient) Upload(namespace, name string, src io.Reader) error {
+	return c.invalidate(namespace, name, func() error {
+		return c.Client.Upload(namespace, name, src)
+	})
+}
+
+func (c *cachingClient) UploadStream(namespace, name string, src io.Reader) error {
+	return c.invalidate(namespace, name, func() error {
+		return c.Client.UploadStream(namespace, name, src)
+	})
+}
+
+func (c *cachingClient) Delete(namespace, name string) error {
+	return c.invalidate(namespace, name, func() error {
+		return c.Client.Delete(namespace, name)
+	})
+}
+
+// invalidate runs write, removing cached responses for name around it.
+func (c *cachingClient) invalidate(namespace, name string, write func() error) error {
+	key := cacheKey(namespace, name)
+	c.stat.remove(key)
+	c.dl.remove(key)
+	err := write()
+	// Responses cached while the write was in flight may be stale.
+	c.stat.remove(key)
+	c.dl.remove(key)
+	return err
+}
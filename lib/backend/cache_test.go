@@ -0,0 +1,214 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	. "github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStat(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clk := clock.NewMock()
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithCache(CacheConfig{TTL: time.Minute}, clk, tally.NoopScope))
+
+	mockClient.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(1), nil)
+	for i := 0; i < 3; i++ {
+		info, err := c.Stat("ns", "name")
+		require.NoError(err)
+		require.Equal(core.NewBlobInfo(1), info)
+	}
+
+	clk.Add(time.Minute + time.Second)
+
+	mockClient.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(2), nil)
+	info, err := c.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(2), info)
+}
+
+func TestCacheStatErrors(t *testing.T) {
+	tests := []struct {
+		desc        string
+		negativeTTL time.Duration
+		err         error
+		calls       int
+	}{
+		{"not found without negative caching", 0, backenderrors.ErrBlobNotFound, 2},
+		{"not found with negative caching", time.Minute, backenderrors.ErrBlobNotFound, 1},
+		{"other errors are never cached", time.Minute, errors.New("some error"), 2},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockClient := mockbackend.NewMockClient(ctrl)
+			c := Chain(mockClient, WithCache(
+				CacheConfig{NegativeTTL: test.negativeTTL}, clock.NewMock(), tally.NoopScope))
+
+			mockClient.EXPECT().Stat("ns", "name").Return(nil, test.err).Times(test.calls)
+			for i := 0; i < 2; i++ {
+				_, err := c.Stat("ns", "name")
+				require.Equal(test.err, err)
+			}
+		})
+	}
+}
+
+func TestCacheStatSingleflight(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithCache(CacheConfig{}, clock.NewMock(), tally.NoopScope))
+
+	release := make(chan struct{})
+	mockClient.EXPECT().Stat("ns", "name").DoAndReturn(func(namespace, name string) (*core.BlobInfo, error) {
+		<-release
+		return core.NewBlobInfo(1), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := c.Stat("ns", "name")
+			require.NoError(err)
+			require.Equal(core.NewBlobInfo(1), info)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+func TestCacheUploadInvalidates(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithCache(
+		CacheConfig{NegativeTTL: time.Minute}, clock.NewMock(), tally.NoopScope))
+
+	mockClient.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound)
+	_, err := c.Stat("ns", "name")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	mockClient.EXPECT().Upload("ns", "name", gomock.Any()).Return(nil)
+	require.NoError(c.Upload("ns", "name", bytes.NewReader([]byte("data"))))
+
+	mockClient.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(4), nil)
+	info, err := c.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(4), info)
+}
+
+func TestCacheUploadStreamInvalidates(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithCache(
+		CacheConfig{NegativeTTL: time.Minute}, clock.NewMock(), tally.NoopScope))
+
+	mockClient.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound)
+	_, err := c.Stat("ns", "name")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	mockClient.EXPECT().UploadStream("ns", "name", gomock.Any()).Return(nil)
+	require.NoError(c.UploadStream("ns", "name", bytes.NewReader([]byte("data"))))
+
+	mockClient.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(4), nil)
+	info, err := c.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(4), info)
+}
+
+func TestCacheDownload(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithCache(
+		CacheConfig{Downloads: true, MaxDownloadSize: 8 * datasize.B}, clock.NewMock(), tally.NoopScope))
+
+	write := func(data string) func(string, string, io.Writer) error {
+		return func(namespace, name string, dst io.Writer) error {
+			_, err := dst.Write([]byte(data))
+			return err
+		}
+	}
+
+	mockClient.EXPECT().Download("ns", "small", gomock.Any()).DoAndReturn(write("small"))
+	for i := 0; i < 2; i++ {
+		var b bytes.Buffer
+		require.NoError(c.Download("ns", "small", &b))
+		require.Equal("small", b.String())
+	}
+
+	// Blobs above the size limit are downloaded directly, every time.
+	mockClient.EXPECT().Download("ns", "large", gomock.Any()).DoAndReturn(write("too large to cache")).Times(4)
+	for i := 0; i < 2; i++ {
+		var b bytes.Buffer
+		require.NoError(c.Download("ns", "large", &b))
+		require.Equal("too large to cache", b.String())
+	}
+}
+
+func TestCacheDownloadDisabled(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithCache(CacheConfig{}, clock.NewMock(), tally.NoopScope))
+
+	mockClient.EXPECT().Download("ns", "name", gomock.Any()).Return(nil).Times(2)
+	for i := 0; i < 2; i++ {
+		require.NoError(c.Download("ns", "name", io.Discard))
+	}
+}
@@ -43,6 +43,33 @@ func getFactory(name string) (ClientFactory, error) {
 	return factory, nil
 }
 
+// NewClient creates a backend client from a config map with exactly one key,
+// naming the registered backend, mapped to that backend's config. Composite
+// backends use it to create the clients they wrap.
+func NewClient(
+	backendConfig map[string]interface{},
+	auth AuthConfig,
+	stats tally.Scope,
+	logger *zap.SugaredLogger) (Client, error) {
+
+	if len(backendConfig) != 1 {
+		return nil, fmt.Errorf("no backend or more than one backend configured")
+	}
+	var name string
+	var config interface{}
+	for name, config = range backendConfig { // Pull the only key/value out of map
+	}
+	factory, err := getFactory(name)
+	if err != nil {
+		return nil, fmt.Errorf("get backend client factory: %s", err)
+	}
+	c, err := factory.Create(config, auth, stats, logger)
+	if err != nil {
+		return nil, fmt.Errorf("create backend client: %s", err)
+	}
+	return c, nil
+}
+
 // Client defines an interface for accessing blobs on a remote storage backend.
 //
 // Implementations of Client must be thread-safe, since they are cached and
@@ -59,10 +86,28 @@ type Client interface {
 	// Upload uploads src into name.
 	Upload(namespace, name string, src io.Reader) error
 
+	// UploadStream uploads src into name without knowing its length upfront.
+	// src is read exactly once and is never rewound, so producers such as
+	// proxied pushes need not spool it to disk first. Implementations without
+	// native support for streaming may use FallbackUploadStream.
+	UploadStream(namespace, name string, src io.Reader) error
+
 	// Download downloads name into dst. All implementations should return
 	// backenderrors.ErrBlobNotFound when the blob was not found.
 	Download(namespace, name string, dst io.Writer) error
 
+	// DownloadRange downloads length bytes of name, starting at offset, into
+	// dst. An error is returned if the blob ends before offset+length, wrapping
+	// ErrShortRange where the backend can tell. All implementations should
+	// return backenderrors.ErrBlobNotFound when the blob was not found.
+	// Implementations without native support for ranges may use
+	// FallbackDownloadRange.
+	DownloadRange(namespace, name string, offset, length int64, dst io.Writer) error
+
+	// Delete deletes name. Deleting a blob which does not exist either
+	// succeeds or returns backenderrors.ErrBlobNotFound.
+	Delete(namespace, name string) error
+
 	// List lists entries whose names start with prefix.
 	List(prefix string, opts ...ListOption) (*ListResult, error)
 
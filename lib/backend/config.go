@@ -26,8 +26,18 @@ type Config struct {
 
 	// If enabled, throttles upload / download bandwidth.
 	Bandwidth bandwidth.Config `yaml:"bandwidth"`
+	// Retry, rate limit and circuit breaker wrappers for the backend client.
+	Middleware MiddlewareConfig `yaml:"middleware"`
 	// Whether the service readiness endpoint will check the backend's readiness.
 	MustReady bool `yaml:"must_ready"`
+	// Retention policy origins enforce on cached blobs of the namespace.
+	Retention RetentionConfig `yaml:"retention"`
+	// Replicas is the number of origins which cache each blob of the
+	// namespace. Defaults to the max replica count of the origin hash ring.
+	Replicas int `yaml:"replicas"`
+	// Auth of this namespace only, taking precedence over auth shared by all
+	// backends.
+	Auth AuthConfig `yaml:"auth"`
 }
 
 func (c Config) applyDefaults() Config {
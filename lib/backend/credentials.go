@@ -0,0 +1,77 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CredentialsConfig defines where backend credentials are reloaded from.
+type CredentialsConfig struct {
+	// File is a yaml file of Credentials. Credentials are not reloaded if
+	// File is empty and no CredentialsProvider is supplied to the Manager.
+	File string `yaml:"file"`
+
+	// ReloadInterval is how often credentials are reloaded.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+func (c CredentialsConfig) applyDefaults() CredentialsConfig {
+	if c.ReloadInterval == 0 {
+		c.ReloadInterval = time.Minute
+	}
+	return c
+}
+
+// Credentials are backend credentials which may change while running, e.g.
+// rotated S3 keys, HDFS tokens or registry passwords.
+type Credentials struct {
+	// Auth is shared by all backends.
+	Auth AuthConfig `yaml:"auth"`
+
+	// Namespaces maps the namespace regular expression of a backend config to
+	// credentials for that backend only.
+	Namespaces map[string]AuthConfig `yaml:"namespaces"`
+}
+
+// CredentialsProvider loads the current backend credentials.
+type CredentialsProvider interface {
+	Credentials() (Credentials, error)
+}
+
+type fileCredentialsProvider struct {
+	path string
+}
+
+// NewFileCredentialsProvider returns a CredentialsProvider which reads
+// Credentials from the yaml file at path on every load.
+func NewFileCredentialsProvider(path string) CredentialsProvider {
+	return &fileCredentialsProvider{path}
+}
+
+func (p *fileCredentialsProvider) Credentials() (Credentials, error) {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("read file: %s", err)
+	}
+	var creds Credentials
+	if err := yaml.Unmarshal(b, &creds); err != nil {
+		return Credentials{}, fmt.Errorf("unmarshal: %s", err)
+	}
+	return creds, nil
+}
@@ -174,6 +174,25 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return err
 }
 
+// DownloadRange downloads length bytes of name starting at offset from a
+// configured bucket using a ranged object reader.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	n, err := c.gcs.DownloadRange(path, offset, length, dst)
+	if err != nil {
+		return err
+	}
+	return backend.CheckRangeLength(length, n)
+}
+
 // Upload uploads src to a configured bucket.
 func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	path, err := c.pather.BlobPath(name)
@@ -185,6 +204,22 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return err
 }
 
+// UploadStream uploads src to a configured bucket. Objects are written with
+// resumable uploads, one chunk at a time, so the length of src need not be
+// known upfront.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Upload(namespace, name, src)
+}
+
+// Delete deletes name from the configured bucket.
+func (c *Client) Delete(namespace, name string) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	return c.gcs.Delete(path)
+}
+
 // List lists names that start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	options := backend.DefaultListOptions()
@@ -277,6 +312,23 @@ func (g *GCSImpl) Download(objectName string, w io.Writer) (int64, error) {
 	return r, nil
 }
 
+func (g *GCSImpl) DownloadRange(objectName string, offset, length int64, w io.Writer) (int64, error) {
+	rc, err := g.bucket.Object(objectName).NewRangeReader(g.ctx, offset, length)
+	if err != nil {
+		if isObjectNotFound(err) {
+			return 0, backenderrors.ErrBlobNotFound
+		}
+		return 0, err
+	}
+	defer closers.Close(rc)
+
+	n, err := io.CopyN(w, rc, length)
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	return n, nil
+}
+
 func (g *GCSImpl) Upload(objectName string, r io.Reader) (int64, error) {
 	wc := g.bucket.Object(objectName).NewWriter(g.ctx)
 	wc.ChunkSize = int(g.config.UploadChunkSize)
@@ -293,6 +345,14 @@ func (g *GCSImpl) Upload(objectName string, r io.Reader) (int64, error) {
 	return w, nil
 }
 
+func (g *GCSImpl) Delete(objectName string) error {
+	err := g.bucket.Object(objectName).Delete(g.ctx)
+	if isObjectNotFound(err) {
+		return backenderrors.ErrBlobNotFound
+	}
+	return err
+}
+
 func (g *GCSImpl) GetObjectIterator(prefix string) iterator.Pageable {
 	var query storage.Query
 
@@ -15,6 +15,7 @@ package gcsbackend
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -131,6 +132,32 @@ func TestClientDownload(t *testing.T) {
 	require.Equal(data, []byte(w))
 }
 
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+	defer closers.Close(client)
+	data := randutil.Text(16)
+
+	mocks.gcs.EXPECT().DownloadRange(
+		"/root/test", int64(32), int64(16), mockutil.MatchWriter(data),
+	).Return(int64(len(data)), nil)
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 32, 16, &b))
+	require.Equal(data, b.Bytes())
+
+	mocks.gcs.EXPECT().DownloadRange(
+		"/root/test", int64(40), int64(16), mockutil.MatchWriter(data[:8]),
+	).Return(int64(8), nil)
+
+	err := client.DownloadRange(core.NamespaceFixture(), "test", 40, 16, &b)
+	require.True(errors.Is(err, backend.ErrShortRange))
+}
+
 func TestClientUpload(t *testing.T) {
 	require := require.New(t)
 
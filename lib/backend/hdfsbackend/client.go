@@ -28,6 +28,7 @@ import (
 	"github.com/uber/kraken/lib/backend/namepath"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/rwutil"
 
 	uuid "github.com/satori/go.uuid"
 	"go.uber.org/zap"
@@ -115,6 +116,25 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return c.webhdfs.Open(path, dst)
 }
 
+// DownloadRange downloads length bytes of name starting at offset into dst.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	w := rwutil.NewCountingWriter(dst)
+	if err := c.webhdfs.OpenRange(path, offset, length, w); err != nil {
+		return err
+	}
+	// WebHDFS truncates ranges which extend past the end of the file.
+	return backend.CheckRangeLength(length, w.N())
+}
+
 // Upload uploads src to name.
 func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	uploadPath := path.Join(c.config.RootDirectory, c.config.UploadDirectory, uuid.NewV4().String())
@@ -131,6 +151,21 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return c.webhdfs.Rename(uploadPath, blobPath)
 }
 
+// Delete deletes name.
+func (c *Client) Delete(namespace, name string) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	return c.webhdfs.Delete(path)
+}
+
+// UploadStream uploads src to name. WebHDFS replays uploads which fail at the
+// data node, so src is spooled to disk rather than buffered in memory.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return backend.FallbackUploadStream(c, namespace, name, src)
+}
+
 var (
 	_ignoreRegex = regexp.MustCompile(
 		"^.+/repositories/.+/(_layers|_uploads|_manifests/(revisions|tags/.+/index)).*")
@@ -21,6 +21,7 @@ import (
 
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/hdfsbackend/webhdfs"
 	mockwebhdfs "github.com/uber/kraken/mocks/lib/backend/hdfsbackend/webhdfs"
 	"github.com/uber/kraken/utils/closers"
@@ -103,6 +104,30 @@ func TestClientDownload(t *testing.T) {
 	require.Equal(data, b.Bytes())
 }
 
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	data := randutil.Text(32)
+
+	mocks.webhdfs.EXPECT().OpenRange("/root/test", int64(4), int64(32), mockutil.MatchWriter(data)).Return(nil)
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 4, 32, &b))
+	require.Equal(data, b.Bytes())
+
+	require.Error(client.DownloadRange(core.NamespaceFixture(), "test", -1, 32, &b))
+
+	mocks.webhdfs.EXPECT().OpenRange("/root/test", int64(40), int64(32), mockutil.MatchWriter(data[:8])).Return(nil)
+
+	err := client.DownloadRange(core.NamespaceFixture(), "test", 40, 32, &b)
+	require.True(errors.Is(err, backend.ErrShortRange))
+}
+
 func TestClientUpload(t *testing.T) {
 	require := require.New(t)
 
@@ -123,6 +148,19 @@ func TestClientUpload(t *testing.T) {
 	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
 }
 
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	mocks.webhdfs.EXPECT().Delete("/root/test").Return(nil)
+
+	require.NoError(client.Delete(core.NamespaceFixture(), "test"))
+}
+
 func TestClientList(t *testing.T) {
 	// Tests against the following directory structure:
 	//
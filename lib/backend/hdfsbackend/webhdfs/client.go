@@ -38,7 +38,9 @@ type Client interface {
 	Create(path string, src io.Reader) error
 	Rename(from, to string) error
 	Mkdirs(path string) error
+	Delete(path string) error
 	Open(path string, dst io.Writer) error
+	OpenRange(path string, offset, length int64, dst io.Writer) error
 	GetFileStatus(path string) (FileStatus, error)
 	ListFileStatus(path string) ([]FileStatus, error)
 }
@@ -59,6 +61,8 @@ type client struct {
 	config    Config
 	namenodes []string
 	username  string
+	scheme    string
+	transport http.RoundTripper
 }
 
 // NewClient creates a new Client.
@@ -67,7 +71,28 @@ func NewClient(config Config, namenodes []string, username string) (Client, erro
 	if len(namenodes) == 0 {
 		return nil, errors.New("namenodes required")
 	}
-	return &client{config, namenodes, username}, nil
+	c := &client{config: config, namenodes: namenodes, username: username, scheme: "http"}
+	if config.EncryptDataTransfer {
+		tlsConfig, err := config.TLS.BuildClient()
+		if err != nil {
+			return nil, fmt.Errorf("build tls config: %s", err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		c.scheme = "https"
+		c.transport = transport
+	}
+	if config.Kerberos.Enabled {
+		if err := config.Kerberos.validate(); err != nil {
+			return nil, fmt.Errorf("invalid kerberos config: %s", err)
+		}
+		transport, err := newSPNEGOTransport(config.Kerberos, namenodes, c.transport)
+		if err != nil {
+			return nil, fmt.Errorf("kerberos: %s", err)
+		}
+		c.transport = transport
+	}
+	return c, nil
 }
 
 // nameNodeBackOff returns the backoff used on all http requests to namenodes.
@@ -140,7 +165,8 @@ func (c *client) Create(path string, src io.Reader) error {
 	var nnErr error
 	for _, nn := range c.namenodes {
 		nameresp, nnErr = httputil.Put(
-			getURL(nn, path, v),
+			c.getURL(nn, path, v),
+			httputil.SendTransport(c.transport),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())),
 			httputil.SendRedirect(func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
@@ -162,6 +188,7 @@ func (c *client) Create(path string, src io.Reader) error {
 
 		dataresp, nnErr = httputil.Put(
 			loc[0],
+			httputil.SendTransport(c.transport),
 			httputil.SendBody(readSeeker),
 			httputil.SendAcceptedCodes(http.StatusCreated))
 		if nnErr != nil {
@@ -190,7 +217,8 @@ func (c *client) Rename(from, to string) error {
 	var nnErr error
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Put(
-			getURL(nn, from, v),
+			c.getURL(nn, from, v),
+			httputil.SendTransport(c.transport),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
@@ -212,7 +240,8 @@ func (c *client) Mkdirs(path string) error {
 	var nnErr error
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Put(
-			getURL(nn, path, v),
+			c.getURL(nn, path, v),
+			httputil.SendTransport(c.transport),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
@@ -225,11 +254,56 @@ func (c *client) Mkdirs(path string) error {
 	return allNameNodesFailedError{nnErr}
 }
 
+// Delete deletes the file at path. Returns backenderrors.ErrBlobNotFound if
+// path does not exist.
+func (c *client) Delete(path string) error {
+	v := c.values()
+	v.Set("op", "DELETE")
+
+	var resp *http.Response
+	var nnErr error
+	for _, nn := range c.namenodes {
+		resp, nnErr = httputil.Delete(
+			c.getURL(nn, path, v),
+			httputil.SendTransport(c.transport),
+			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
+		if nnErr != nil {
+			if retryable(nnErr) {
+				continue
+			}
+			return nnErr
+		}
+		defer closers.Close(resp.Body)
+		var br booleanResponse
+		if err := json.NewDecoder(resp.Body).Decode(&br); err != nil {
+			return fmt.Errorf("decode body: %s", err)
+		}
+		if !br.Boolean {
+			return backenderrors.ErrBlobNotFound
+		}
+		return nil
+	}
+	return allNameNodesFailedError{nnErr}
+}
+
 func (c *client) Open(path string, dst io.Writer) error {
 	v := c.values()
 	v.Set("op", "OPEN")
 	v.Set("buffersize", strconv.FormatInt(int64(c.config.BufferSize), 10))
+	return c.open(path, v, dst)
+}
+
+// OpenRange reads length bytes of path starting at offset into dst.
+func (c *client) OpenRange(path string, offset, length int64, dst io.Writer) error {
+	v := c.values()
+	v.Set("op", "OPEN")
+	v.Set("buffersize", strconv.FormatInt(int64(c.config.BufferSize), 10))
+	v.Set("offset", strconv.FormatInt(offset, 10))
+	v.Set("length", strconv.FormatInt(length, 10))
+	return c.open(path, v, dst)
+}
 
+func (c *client) open(path string, v url.Values, dst io.Writer) error {
 	var resp *http.Response
 	var nnErr error
 	for _, nn := range c.namenodes {
@@ -238,7 +312,8 @@ func (c *client) Open(path string, dst io.Writer) error {
 		// error. By retrying the request, we hope to eventually get redirected
 		// to a valid datanode.
 		resp, nnErr = httputil.Get(
-			getURL(nn, path, v),
+			c.getURL(nn, path, v),
+			httputil.SendTransport(c.transport),
 			httputil.SendRetry(
 				httputil.RetryBackoff(c.nameNodeBackOff()),
 				httputil.RetryCodes(http.StatusBadRequest)))
@@ -271,7 +346,8 @@ func (c *client) GetFileStatus(path string) (FileStatus, error) {
 	var nnErr error
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Get(
-			getURL(nn, path, v),
+			c.getURL(nn, path, v),
+			httputil.SendTransport(c.transport),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
@@ -300,7 +376,8 @@ func (c *client) ListFileStatus(path string) ([]FileStatus, error) {
 	var nnErr error
 	for _, nn := range c.namenodes {
 		resp, nnErr = httputil.Get(
-			getURL(nn, path, v),
+			c.getURL(nn, path, v),
+			httputil.SendTransport(c.transport),
 			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
 		if nnErr != nil {
 			if retryable(nnErr) {
@@ -320,13 +397,14 @@ func (c *client) ListFileStatus(path string) ([]FileStatus, error) {
 
 func (c *client) values() url.Values {
 	v := url.Values{}
-	if c.username != "" {
+	// Kerberized clusters identify the user by the authenticated principal.
+	if c.username != "" && !c.config.Kerberos.Enabled {
 		v.Set("user.name", c.username)
 	}
 	return v
 }
 
-func getURL(namenode, p string, v url.Values) string {
+func (c *client) getURL(namenode, p string, v url.Values) string {
 	endpoint := path.Join("/webhdfs/v1", p)
-	return fmt.Sprintf("http://%s%s?%s", namenode, endpoint, v.Encode())
+	return fmt.Sprintf("%s://%s%s?%s", c.scheme, namenode, endpoint, v.Encode())
 }
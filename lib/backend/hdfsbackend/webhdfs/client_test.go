@@ -37,7 +37,7 @@ import (
 const _testFile = "/root/test"
 
 type testServer struct {
-	getName, getData, putName, putData http.HandlerFunc
+	getName, getData, putName, putData, deleteName http.HandlerFunc
 }
 
 func (s *testServer) handler() http.Handler {
@@ -46,6 +46,7 @@ func (s *testServer) handler() http.Handler {
 	r.Get("/datanode/webhdfs/v1*", s.getData)
 	r.Put("/webhdfs/v1*", s.putName)
 	r.Put("/datanode/webhdfs/v1*", s.putData)
+	r.Delete("/webhdfs/v1*", s.deleteName)
 	return r
 }
 
@@ -109,6 +110,30 @@ func TestClientOpen(t *testing.T) {
 	require.Equal(data, b.Bytes())
 }
 
+func TestClientOpenRange(t *testing.T) {
+	require := require.New(t)
+
+	data := randutil.Text(64)
+
+	server := &testServer{
+		getName: redirectToDataNode,
+		getData: func(w http.ResponseWriter, r *http.Request) {
+			require.Equal("OPEN", r.URL.Query().Get("op"))
+			require.Equal("16", r.URL.Query().Get("offset"))
+			require.Equal("8", r.URL.Query().Get("length"))
+			w.Write(data[16:24])
+		},
+	}
+	addr, stop := testutil.StartServer(server.handler())
+	defer stop()
+
+	client := newClient(addr)
+
+	var b bytes.Buffer
+	require.NoError(client.OpenRange(_testFile, 16, 8, &b))
+	require.Equal(data[16:24], b.Bytes())
+}
+
 func TestClientOpenRetriesNextNameNode(t *testing.T) {
 	require := require.New(t)
 
@@ -296,6 +321,38 @@ func TestClientMkdirs(t *testing.T) {
 	require.True(called)
 }
 
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	server := &testServer{
+		deleteName: func(w http.ResponseWriter, r *http.Request) {
+			require.Equal("/webhdfs/v1"+_testFile, r.URL.Path)
+			require.Equal("DELETE", r.URL.Query().Get("op"))
+			w.Write([]byte(`{"boolean": true}`))
+		},
+	}
+	addr, stop := testutil.StartServer(server.handler())
+	defer stop()
+
+	client := newClient(addr)
+
+	require.NoError(client.Delete(_testFile))
+}
+
+func TestClientDeleteErrBlobNotFound(t *testing.T) {
+	require := require.New(t)
+
+	server := &testServer{
+		deleteName: writeResponse(http.StatusOK, []byte(`{"boolean": false}`)),
+	}
+	addr, stop := testutil.StartServer(server.handler())
+	defer stop()
+
+	client := newClient(addr)
+
+	require.Equal(backenderrors.ErrBlobNotFound, client.Delete(_testFile))
+}
+
 func TestClientGetFileStatus(t *testing.T) {
 	require := require.New(t)
 
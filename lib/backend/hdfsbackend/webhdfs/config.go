@@ -13,7 +13,11 @@
 // limitations under the License.
 package webhdfs
 
-import "github.com/c2h5oh/datasize"
+import (
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/c2h5oh/datasize"
+)
 
 // Config defines Client configuration.
 type Config struct {
@@ -23,6 +27,17 @@ type Config struct {
 	// BufferGuard protects upload from draining the src reader into an oversized
 	// buffer when io.Seeker is not implemented.
 	BufferGuard datasize.ByteSize `yaml:"buffer_guard"`
+
+	// Kerberos enables SPNEGO authentication for kerberized clusters.
+	Kerberos KerberosConfig `yaml:"kerberos"`
+
+	// EncryptDataTransfer talks to namenodes and datanodes over HTTPS
+	// (swebhdfs), encrypting all data in transit.
+	EncryptDataTransfer bool `yaml:"encrypt_data_transfer"`
+
+	// TLS configures the CAs and client certificate used when
+	// EncryptDataTransfer is enabled.
+	TLS httputil.TLSConfig `yaml:"tls"`
 }
 
 func (c *Config) applyDefaults() {
@@ -32,4 +47,7 @@ func (c *Config) applyDefaults() {
 	if c.BufferGuard == 0 {
 		c.BufferGuard = 10 * datasize.MB
 	}
+	if c.Kerberos.Enabled {
+		c.Kerberos.applyDefaults()
+	}
 }
@@ -29,3 +29,7 @@ type listStatusResponse struct {
 		FileStatus []FileStatus `json:"FileStatus"`
 	} `json:"FileStatuses"`
 }
+
+type booleanResponse struct {
+	Boolean bool `json:"boolean"`
+}
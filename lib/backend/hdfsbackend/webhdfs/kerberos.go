@@ -0,0 +1,160 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webhdfs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// KerberosConfig defines SPNEGO authentication against kerberized namenodes.
+type KerberosConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Krb5Conf is the path of the krb5.conf describing realms and KDCs.
+	Krb5Conf string `yaml:"krb5_conf"`
+
+	// Principal and Keytab authenticate the client with a keytab. Principal
+	// may include the realm, e.g. "kraken@EXAMPLE.COM", else Realm is used.
+	Principal string `yaml:"principal"`
+	Realm     string `yaml:"realm"`
+	Keytab    string `yaml:"keytab"`
+
+	// TicketCache is the path of a credentials cache, e.g. one renewed by
+	// kinit, used instead of Keytab.
+	TicketCache string `yaml:"ticket_cache"`
+
+	// ServicePrincipal is the principal of the namenode HTTP service, where
+	// "_HOST" is replaced by the namenode hostname. Defaults to "HTTP/_HOST".
+	ServicePrincipal string `yaml:"service_principal"`
+
+	// DisablePAFXFAST disables FAST pre-authentication, which Active
+	// Directory KDCs do not support.
+	DisablePAFXFAST bool `yaml:"disable_pa_fx_fast"`
+}
+
+func (c *KerberosConfig) applyDefaults() {
+	if c.Krb5Conf == "" {
+		c.Krb5Conf = "/etc/krb5.conf"
+	}
+	if c.ServicePrincipal == "" {
+		c.ServicePrincipal = "HTTP/_HOST"
+	}
+	if i := strings.LastIndex(c.Principal, "@"); i >= 0 && c.Realm == "" {
+		c.Principal, c.Realm = c.Principal[:i], c.Principal[i+1:]
+	}
+}
+
+func (c KerberosConfig) validate() error {
+	if c.Keytab != "" && c.TicketCache != "" {
+		return errors.New("keytab and ticket_cache are mutually exclusive")
+	}
+	if c.Keytab == "" && c.TicketCache == "" {
+		return errors.New("keytab or ticket_cache required")
+	}
+	if c.Keytab != "" && (c.Principal == "" || c.Realm == "") {
+		return errors.New("keytab requires principal and realm")
+	}
+	return nil
+}
+
+// servicePrincipal returns the service principal of host.
+func (c KerberosConfig) servicePrincipal(host string) string {
+	return strings.Replace(c.ServicePrincipal, "_HOST", strings.ToLower(host), -1)
+}
+
+// newKerberosClient creates a Kerberos client from the credentials in config.
+// Logging into the KDC is deferred until the first request.
+func newKerberosClient(config KerberosConfig) (*krbclient.Client, error) {
+	krb5conf, err := krbconfig.Load(config.Krb5Conf)
+	if err != nil {
+		return nil, fmt.Errorf("load krb5 conf: %s", err)
+	}
+	settings := krbclient.DisablePAFXFAST(config.DisablePAFXFAST)
+	if config.Keytab != "" {
+		kt, err := keytab.Load(config.Keytab)
+		if err != nil {
+			return nil, fmt.Errorf("load keytab: %s", err)
+		}
+		return krbclient.NewWithKeytab(config.Principal, config.Realm, kt, krb5conf, settings), nil
+	}
+	ccache, err := credentials.LoadCCache(config.TicketCache)
+	if err != nil {
+		return nil, fmt.Errorf("load ticket cache: %s", err)
+	}
+	cl, err := krbclient.NewFromCCache(ccache, krb5conf, settings)
+	if err != nil {
+		return nil, fmt.Errorf("new client from ticket cache: %s", err)
+	}
+	return cl, nil
+}
+
+// spnegoTransport authenticates requests to namenodes using SPNEGO. Requests
+// to other hosts, i.e. datanodes, are authorized by the delegation token the
+// namenode includes in redirects and are sent as is.
+type spnegoTransport struct {
+	config       KerberosConfig
+	namenodes    map[string]bool
+	authenticate func(r *http.Request, spn string) error
+	next         http.RoundTripper
+}
+
+func newSPNEGOTransport(
+	config KerberosConfig, namenodes []string, next http.RoundTripper) (*spnegoTransport, error) {
+
+	cl, err := newKerberosClient(config)
+	if err != nil {
+		return nil, err
+	}
+	authenticate := func(r *http.Request, spn string) error {
+		return spnego.SetSPNEGOHeader(cl, r, spn)
+	}
+	return newSPNEGOTransportWithAuth(config, namenodes, authenticate, next), nil
+}
+
+func newSPNEGOTransportWithAuth(
+	config KerberosConfig,
+	namenodes []string,
+	authenticate func(r *http.Request, spn string) error,
+	next http.RoundTripper) *spnegoTransport {
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	m := make(map[string]bool)
+	for _, nn := range namenodes {
+		m[nn] = true
+	}
+	return &spnegoTransport{config, m, authenticate, next}
+}
+
+func (t *spnegoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.namenodes[req.URL.Host] {
+		return t.next.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the original request.
+	r := req.Clone(req.Context())
+	if err := t.authenticate(r, t.config.servicePrincipal(r.URL.Hostname())); err != nil {
+		return nil, fmt.Errorf("spnego: %s", err)
+	}
+	return t.next.RoundTrip(r)
+}
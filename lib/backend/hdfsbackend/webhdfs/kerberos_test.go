@@ -0,0 +1,110 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webhdfs
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKerberosConfigDefaults(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Kerberos: KerberosConfig{
+		Enabled:   true,
+		Principal: "kraken@EXAMPLE.COM",
+		Keytab:    "/etc/kraken/kraken.keytab",
+	}}
+	config.applyDefaults()
+	require.Equal("kraken", config.Kerberos.Principal)
+	require.Equal("EXAMPLE.COM", config.Kerberos.Realm)
+	require.Equal("/etc/krb5.conf", config.Kerberos.Krb5Conf)
+	require.Equal("HTTP/namenode1.example.com", config.Kerberos.servicePrincipal("NameNode1.example.com"))
+	require.NoError(config.Kerberos.validate())
+}
+
+func TestNewClientInvalidKerberosConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config KerberosConfig
+	}{
+		{"no credentials", KerberosConfig{Enabled: true}},
+		{"keytab and ticket cache", KerberosConfig{
+			Enabled:     true,
+			Principal:   "kraken@EXAMPLE.COM",
+			Keytab:      "/etc/kraken/kraken.keytab",
+			TicketCache: "/tmp/krb5cc_0",
+		}},
+		{"keytab without principal", KerberosConfig{Enabled: true, Keytab: "/etc/kraken/kraken.keytab"}},
+		{"missing krb5 conf", KerberosConfig{
+			Enabled:     true,
+			Krb5Conf:    "/does/not/exist",
+			TicketCache: "/tmp/krb5cc_0",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewClient(Config{Kerberos: test.config}, []string{"dummy-addr"}, "")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSPNEGOTransportOnlyAuthenticatesNameNodes(t *testing.T) {
+	require := require.New(t)
+
+	data := randutil.Text(64)
+
+	datanode, stopDataNode := testutil.StartServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			require.Empty(r.Header.Get("Authorization"))
+			writeResponse(http.StatusOK, data)(w, r)
+		}))
+	defer stopDataNode()
+
+	namenode, stopNameNode := testutil.StartServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Negotiate HTTP/127.0.0.1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			require.Empty(r.URL.Query().Get("user.name"))
+			http.Redirect(w, r, "http://"+datanode+r.URL.Path, http.StatusTemporaryRedirect)
+		}))
+	defer stopNameNode()
+
+	config := Config{Kerberos: KerberosConfig{Enabled: true}}
+	config.applyDefaults()
+	auth := func(r *http.Request, spn string) error {
+		r.Header.Set("Authorization", "Negotiate "+spn)
+		return nil
+	}
+	client := &client{
+		config:    config,
+		namenodes: []string{namenode},
+		username:  "kraken",
+		scheme:    "http",
+		transport: newSPNEGOTransportWithAuth(config.Kerberos, []string{namenode}, auth, nil),
+	}
+
+	var b bytes.Buffer
+	require.NoError(client.Open(_testFile, &b))
+	require.Equal(data, b.Bytes())
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/uber/kraken/utils/closers"
@@ -61,8 +62,10 @@ func (f *factory) Create(
 type Config struct {
 	UploadURL       string                            `yaml:"upload_url"`   // http upload post url
 	DownloadURL     string                            `yaml:"download_url"` // http download get url
+	DeleteURL       string                            `yaml:"delete_url"`   // http delete url
 	DownloadTimeout time.Duration                     `yaml:"download_timeout"`
 	DownloadBackOff httputil.ExponentialBackOffConfig `yaml:"download_backoff"`
+	UploadTimeout   time.Duration                     `yaml:"upload_timeout"`
 }
 
 // Client implements downloading/uploading object from/to S3
@@ -75,6 +78,9 @@ func (c Config) applyDefaults() Config {
 	if c.DownloadTimeout == 0 {
 		c.DownloadTimeout = 180 * time.Second
 	}
+	if c.UploadTimeout == 0 {
+		c.UploadTimeout = 180 * time.Second
+	}
 	return c
 }
 
@@ -114,9 +120,83 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return nil
 }
 
-// Upload is not supported.
+// DownloadRange downloads length bytes of name starting at offset using an
+// HTTP Range request. Servers which ignore the Range header reply with the
+// whole blob, which is skipped to the range.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if _, err := fmt.Fprintf(&b, c.config.DownloadURL, name); err != nil {
+		return fmt.Errorf("format url: %s", err)
+	}
+	resp, err := httputil.Get(
+		b.String(),
+		httputil.SendHeaders(map[string]string{"Range": backend.RangeHeader(offset, length)}),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusPartialContent),
+		httputil.SendTimeout(c.config.DownloadTimeout),
+		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer closers.Close(resp.Body)
+	if resp.StatusCode == http.StatusPartialContent {
+		offset = 0
+	}
+	if err := backend.CopyRange(dst, resp.Body, offset, length); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	return nil
+}
+
+// Upload posts src to the configured upload url.
 func (c *Client) Upload(namespace, name string, src io.Reader) error {
-	return errors.New("not supported")
+	if c.config.UploadURL == "" {
+		return errors.New("not supported")
+	}
+	var b bytes.Buffer
+	if _, err := fmt.Fprintf(&b, c.config.UploadURL, name); err != nil {
+		return fmt.Errorf("format url: %s", err)
+	}
+	_, err := httputil.Post(
+		b.String(),
+		httputil.SendBody(src),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusCreated, http.StatusNoContent),
+		httputil.SendTimeout(c.config.UploadTimeout))
+	return err
+}
+
+// UploadStream posts src to the configured upload url using chunked transfer
+// encoding, so the length of src need not be known upfront.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	// Hide any concrete type of src, which would otherwise be used to set
+	// Content-Length.
+	return c.Upload(namespace, name, struct{ io.Reader }{src})
+}
+
+// Delete sends a DELETE request to the configured delete url.
+func (c *Client) Delete(namespace, name string) error {
+	if c.config.DeleteURL == "" {
+		return errors.New("not supported")
+	}
+	var b bytes.Buffer
+	if _, err := fmt.Fprintf(&b, c.config.DeleteURL, name); err != nil {
+		return fmt.Errorf("format url: %s", err)
+	}
+	_, err := httputil.Delete(
+		b.String(),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusAccepted, http.StatusNoContent),
+		httputil.SendTimeout(c.config.UploadTimeout))
+	if httputil.IsNotFound(err) {
+		return backenderrors.ErrBlobNotFound
+	}
+	return err
 }
 
 // List is not supported.
@@ -18,6 +18,7 @@ import (
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
@@ -85,6 +86,41 @@ func TestHttpDownloadFileNotFound(t *testing.T) {
 	require.Equal(backenderrors.ErrBlobNotFound, client.Download(core.NamespaceFixture(), "data", &b))
 }
 
+func TestHttpDownloadRange(t *testing.T) {
+	blob := randutil.Blob(32 * memsize.KB)
+
+	tests := []struct {
+		desc    string
+		handler http.HandlerFunc
+	}{
+		{"server supports ranges", func(w http.ResponseWriter, req *http.Request) {
+			http.ServeContent(w, req, "data", time.Time{}, bytes.NewReader(blob))
+		}},
+		{"server ignores ranges", func(w http.ResponseWriter, req *http.Request) {
+			w.Write(blob)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			r := chi.NewRouter()
+			r.Get("/data/{blob}", test.handler)
+			addr, stop := testutil.StartServer(r)
+			defer stop()
+
+			config := Config{DownloadURL: "http://" + addr + "/data/%s"}
+			client, err := NewClient(config, tally.NoopScope)
+			require.NoError(err)
+			defer closers.Close(client)
+
+			var b bytes.Buffer
+			require.NoError(client.DownloadRange(core.NamespaceFixture(), "data", 1024, 512, &b))
+			require.Equal(blob[1024:1536], b.Bytes())
+		})
+	}
+}
+
 func TestDownloadMalformedURLThrowsError(t *testing.T) {
 	require := require.New(t)
 
@@ -100,3 +136,90 @@ func TestDownloadMalformedURLThrowsError(t *testing.T) {
 	var b bytes.Buffer
 	require.Error(client.Download(core.NamespaceFixture(), "data", &b))
 }
+
+func TestHttpUpload(t *testing.T) {
+	blob := randutil.Blob(32 * memsize.KB)
+
+	tests := []struct {
+		desc        string
+		upload      func(c *Client, src io.Reader) error
+		wantChunked bool
+	}{
+		{"upload", func(c *Client, src io.Reader) error {
+			return c.Upload(core.NamespaceFixture(), "data", src)
+		}, false},
+		{"upload stream", func(c *Client, src io.Reader) error {
+			return c.UploadStream(core.NamespaceFixture(), "data", src)
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			var received []byte
+			var chunked bool
+			r := chi.NewRouter()
+			r.Post("/data/{blob}", func(w http.ResponseWriter, req *http.Request) {
+				chunked = len(req.TransferEncoding) > 0 && req.TransferEncoding[0] == "chunked"
+				b, err := io.ReadAll(req.Body)
+				require.NoError(err)
+				received = b
+				w.WriteHeader(http.StatusCreated)
+			})
+			addr, stop := testutil.StartServer(r)
+			defer stop()
+
+			config := Config{UploadURL: "http://" + addr + "/data/%s"}
+			client, err := NewClient(config, tally.NoopScope)
+			require.NoError(err)
+			defer closers.Close(client)
+
+			require.NoError(test.upload(client, bytes.NewReader(blob)))
+			require.Equal(blob, received)
+			require.Equal(test.wantChunked, chunked)
+		})
+	}
+}
+
+func TestHttpUploadNotConfigured(t *testing.T) {
+	require := require.New(t)
+
+	client, err := NewClient(Config{}, tally.NoopScope)
+	require.NoError(err)
+	defer closers.Close(client)
+
+	require.Error(client.Upload(core.NamespaceFixture(), "data", bytes.NewReader(nil)))
+}
+
+func TestHttpDelete(t *testing.T) {
+	require := require.New(t)
+
+	var deleted string
+	r := chi.NewRouter()
+	r.Delete("/data/{blob}", func(w http.ResponseWriter, req *http.Request) {
+		deleted = chi.URLParam(req, "blob")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	config := Config{DeleteURL: "http://" + addr + "/data/%s"}
+	client, err := NewClient(config, tally.NoopScope)
+	require.NoError(err)
+	defer closers.Close(client)
+
+	require.NoError(client.Delete(core.NamespaceFixture(), "data"))
+	require.Equal("data", deleted)
+
+	require.Equal(backenderrors.ErrBlobNotFound, client.Delete(core.NamespaceFixture(), "missing/blob"))
+}
+
+func TestHttpDeleteNotConfigured(t *testing.T) {
+	require := require.New(t)
+
+	client, err := NewClient(Config{}, tally.NoopScope)
+	require.NoError(err)
+	defer closers.Close(client)
+
+	require.Error(client.Delete(core.NamespaceFixture(), "data"))
+}
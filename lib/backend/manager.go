@@ -16,13 +16,17 @@ package backend
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"sync"
+	"time"
 
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/utils/bandwidth"
 	"github.com/uber/kraken/utils/log"
 
 	"github.com/uber-go/tally"
+	"go.uber.org/zap"
 )
 
 // Manager errors.
@@ -32,8 +36,23 @@ var (
 
 type backend struct {
 	regexp    *regexp.Regexp
-	client    Client
 	mustReady bool
+	retention RetentionConfig
+	replicas  int
+
+	// config and auth the client was created from. config is empty for
+	// registered clients, which are never recreated.
+	config Config
+	auth   AuthConfig
+
+	// bandwidth limits this backend alone, if configured.
+	bandwidth *bandwidth.Limiter
+
+	// client wraps reloadable with bandwidth limits and middlewares.
+	// reloadable is nil for registered clients, and if no credentials
+	// provider is configured.
+	client     Client
+	reloadable *reloadableClient
 }
 
 func newBackend(namespace string, c Client, mustReady bool) (*backend, error) {
@@ -41,85 +60,337 @@ func newBackend(namespace string, c Client, mustReady bool) (*backend, error) {
 	if err != nil {
 		return nil, fmt.Errorf("regexp: %s", err)
 	}
-	return &backend{
+	b := &backend{
 		regexp:    re,
-		client:    c,
 		mustReady: mustReady,
-	}, nil
+		client:    c,
+	}
+	if throttled, ok := c.(*ThrottledClient); ok {
+		b.bandwidth = throttled.bandwidth
+	}
+	return b, nil
 }
 
 // Manager manages backend clients for namespace regular expressions.
 type Manager struct {
+	// mu guards the clients of backends, which are replaced when credentials
+	// are reloaded.
+	mu       sync.RWMutex
 	backends []*backend
+	global   *bandwidth.Limiter
+
+	stats  tally.Scope
+	logger *zap.SugaredLogger
+
+	auth           AuthConfig
+	credentials    CredentialsProvider
+	reloadInterval time.Duration
+
+	// reloadMu serializes credential reloads.
+	reloadMu sync.Mutex
 }
 
 // ManagerConfig is config for backend manager.
 type ManagerConfig struct {
 	Log log.Config `yaml:"log"`
+
+	// Bandwidth limits the combined traffic of all backends, in addition to
+	// any limits configured per backend.
+	Bandwidth bandwidth.Config `yaml:"bandwidth"`
+
+	// Credentials are reloaded from a file without restarting.
+	Credentials CredentialsConfig `yaml:"credentials"`
+}
+
+// ManagerOption allows setting optional Manager parameters.
+type ManagerOption func(*Manager)
+
+// WithCredentialsProvider configures a Manager to load credentials from p,
+// e.g. a secrets provider, instead of the configured credentials file.
+func WithCredentialsProvider(p CredentialsProvider) ManagerOption {
+	return func(m *Manager) { m.credentials = p }
 }
 
 // NewManager creates a new backend Manager.
-func NewManager(managerConfig ManagerConfig, configs []Config, auth AuthConfig, stats tally.Scope) (*Manager, error) {
+func NewManager(
+	managerConfig ManagerConfig,
+	configs []Config,
+	auth AuthConfig,
+	stats tally.Scope,
+	opts ...ManagerOption) (*Manager, error) {
+
+	managerConfig.Credentials = managerConfig.Credentials.applyDefaults()
+
 	logger, err := log.New(managerConfig.Log, nil)
 	if err != nil {
 		return nil, fmt.Errorf("log: %s", err)
 	}
-	slogger := logger.Sugar()
 
-	var backends []*backend
-	for _, config := range configs {
-		config = config.applyDefaults()
-		var c Client
-
-		if len(config.Backend) != 1 {
-			return nil, fmt.Errorf("no backend or more than one backend configured")
-		}
-		var backendName string
-		var backendConfig interface{}
-		for backendName, backendConfig = range config.Backend { // Pull the only key/value out of map
-		}
-		factory, err := getFactory(backendName)
+	var global *bandwidth.Limiter
+	if managerConfig.Bandwidth.Enable {
+		global, err = bandwidth.NewLimiter(managerConfig.Bandwidth)
 		if err != nil {
-			return nil, fmt.Errorf("get backend client factory: %s", err)
+			return nil, fmt.Errorf("global bandwidth: %s", err)
 		}
-		c, err = factory.Create(backendConfig, auth, stats, slogger)
+	}
+
+	m := &Manager{
+		global:         global,
+		stats:          stats,
+		logger:         logger.Sugar(),
+		auth:           auth,
+		reloadInterval: managerConfig.Credentials.ReloadInterval,
+	}
+	if managerConfig.Credentials.File != "" {
+		m.credentials = NewFileCredentialsProvider(managerConfig.Credentials.File)
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	var creds Credentials
+	if m.credentials != nil {
+		creds, err = m.credentials.Credentials()
 		if err != nil {
-			return nil, fmt.Errorf("create backend client: %s", err)
+			return nil, fmt.Errorf("load credentials: %s", err)
 		}
+	}
 
+	for _, config := range configs {
+		config = config.applyDefaults()
+		if err := config.Retention.validate(); err != nil {
+			return nil, fmt.Errorf("retention for namespace %s: %s", config.Namespace, err)
+		}
+		if config.Replicas < 0 {
+			return nil, fmt.Errorf("replicas for namespace %s must not be negative", config.Namespace)
+		}
+		var l *bandwidth.Limiter
 		if config.Bandwidth.Enable {
-			l, err := bandwidth.NewLimiter(config.Bandwidth)
+			l, err = bandwidth.NewLimiter(config.Bandwidth)
 			if err != nil {
 				return nil, fmt.Errorf("bandwidth: %s", err)
 			}
-			c = throttle(c, l)
 		}
-		b, err := newBackend(config.Namespace, c, config.MustReady)
+		re, err := regexp.Compile(config.Namespace)
 		if err != nil {
-			return nil, fmt.Errorf("new backend for namespace %s: %s", config.Namespace, err)
+			return nil, fmt.Errorf("new backend for namespace %s: regexp: %s", config.Namespace, err)
+		}
+		b := &backend{
+			regexp:    re,
+			mustReady: config.MustReady,
+			retention: config.Retention,
+			replicas:  config.Replicas,
+			config:    config,
+			auth:      m.authFor(config, creds),
+			bandwidth: l,
+		}
+		c, err := NewClient(b.config.Backend, b.auth, m.stats, m.logger)
+		if err != nil {
+			return nil, err
+		}
+		if m.credentials != nil {
+			// Only clients whose credentials may be reloaded are indirected.
+			b.reloadable = newReloadableClient(c)
+			c = b.reloadable
+		}
+		b.client = m.wrapClient(b.config, c, b.bandwidth)
+		m.backends = append(m.backends, b)
+	}
+	return m, nil
+}
+
+// wrapClient wraps c with bandwidth limits and the middlewares of config.
+func (m *Manager) wrapClient(config Config, c Client, l *bandwidth.Limiter) Client {
+	var backendName string
+	for backendName = range config.Backend { // NewClient checked there is exactly one.
+	}
+	if l != nil || m.global != nil {
+		c = throttle(c, l, m.global)
+	}
+	return Chain(c, config.Middleware.Build(m.stats.Tagged(map[string]string{
+		"backend": backendName,
+	}))...)
+}
+
+// authFor returns the credentials for a backend configured with config. Later
+// sources take precedence for each backend type: auth shared by all backends,
+// auth of the namespace in config, then shared and namespace credentials
+// loaded from the credentials provider.
+func (m *Manager) authFor(config Config, creds Credentials) AuthConfig {
+	auth := AuthConfig{}
+	for _, a := range []AuthConfig{m.auth, config.Auth, creds.Auth, creds.Namespaces[config.Namespace]} {
+		for k, v := range a {
+			auth[k] = v
+		}
+	}
+	return auth
+}
+
+// ReloadCredentials reloads credentials from the credentials provider, if
+// any, and recreates the clients of backends whose credentials changed.
+// Either all changed clients are replaced or none are. Bandwidth limits and
+// middlewares are kept, and replaced clients are closed once idle.
+func (m *Manager) ReloadCredentials() error {
+	if m.credentials == nil {
+		return nil
+	}
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	creds, err := m.credentials.Credentials()
+	if err != nil {
+		return fmt.Errorf("load credentials: %s", err)
+	}
+
+	type update struct {
+		b      *backend
+		auth   AuthConfig
+		client Client
+	}
+	var updates []update
+	for _, b := range m.backends {
+		if b.reloadable == nil {
+			continue
+		}
+		auth := m.authFor(b.config, creds)
+		if reflect.DeepEqual(auth, b.auth) {
+			continue
+		}
+		c, err := NewClient(b.config.Backend, auth, m.stats, m.logger)
+		if err != nil {
+			for _, u := range updates {
+				closeClient(u.client)
+			}
+			return fmt.Errorf("namespace %s: %s", b.regexp.String(), err)
+		}
+		updates = append(updates, update{b, auth, c})
+	}
+
+	for _, u := range updates {
+		u.b.reloadable.swap(u.client)
+		u.b.auth = u.auth
+		log.With("namespace", u.b.regexp.String()).Info("Reloaded backend credentials")
+	}
+	return nil
+}
+
+// WatchCredentials reloads credentials every reload interval until stop is
+// closed. Returns immediately if no credentials provider is configured.
+func (m *Manager) WatchCredentials(stop <-chan struct{}) {
+	if m.credentials == nil {
+		return
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(m.reloadInterval):
+			if err := m.ReloadCredentials(); err != nil {
+				log.Errorf("Error reloading backend credentials: %s", err)
+			}
 		}
-		backends = append(backends, b)
 	}
-	return &Manager{backends}, nil
+}
+
+func closeClient(c Client) {
+	if err := c.Close(); err != nil {
+		log.Errorf("Error closing backend client: %s", err)
+	}
 }
 
 // AdjustBandwidth adjusts bandwidth limits across all throttled clients to the
 // originally configured bandwidth divided by denominator.
 func (m *Manager) AdjustBandwidth(denominator int) error {
 	for _, b := range m.backends {
-		tc, ok := b.client.(*ThrottledClient)
-		if !ok {
+		if b.bandwidth == nil {
 			continue
 		}
-		if err := tc.adjustBandwidth(denominator); err != nil {
+		if err := b.bandwidth.Adjust(denominator); err != nil {
 			return err
 		}
 		log.With(
 			"namespace", b.regexp.String(),
-			"ingress", tc.IngressLimit(),
-			"egress", tc.EgressLimit(),
+			"ingress", b.bandwidth.IngressLimit(),
+			"egress", b.bandwidth.EgressLimit(),
 			"denominator", denominator).Info("Adjusted backend bandwidth")
 	}
+	if m.global != nil {
+		if err := m.global.Adjust(denominator); err != nil {
+			return err
+		}
+		log.With(
+			"ingress", m.global.IngressLimit(),
+			"egress", m.global.EgressLimit(),
+			"denominator", denominator).Info("Adjusted global backend bandwidth")
+	}
+	return nil
+}
+
+// BandwidthLimit describes the bandwidth limits of a backend.
+type BandwidthLimit struct {
+	// Namespace is empty for the global limits shared by all backends.
+	Namespace string `json:"namespace"`
+
+	// Configured bits per second.
+	EgressBitsPerSec  uint64 `json:"egress_bits_per_sec"`
+	IngressBitsPerSec uint64 `json:"ingress_bits_per_sec"`
+
+	// Current limits in tokens per second, after adjusting for cluster size.
+	EgressLimit  int64 `json:"egress_limit"`
+	IngressLimit int64 `json:"ingress_limit"`
+}
+
+func newBandwidthLimit(namespace string, l *bandwidth.Limiter) BandwidthLimit {
+	return BandwidthLimit{
+		Namespace:         namespace,
+		EgressBitsPerSec:  l.EgressBitsPerSec(),
+		IngressBitsPerSec: l.IngressBitsPerSec(),
+		EgressLimit:       l.EgressLimit(),
+		IngressLimit:      l.IngressLimit(),
+	}
+}
+
+// BandwidthLimits returns the global limits, if enabled, followed by the
+// limits of every backend with limits of its own.
+func (m *Manager) BandwidthLimits() []BandwidthLimit {
+	var limits []BandwidthLimit
+	if m.global != nil {
+		limits = append(limits, newBandwidthLimit("", m.global))
+	}
+	for _, b := range m.backends {
+		if b.bandwidth == nil {
+			continue
+		}
+		limits = append(limits, newBandwidthLimit(b.regexp.String(), b.bandwidth))
+	}
+	return limits
+}
+
+// SetBandwidth replaces the configured limits of the backend registered under
+// namespace, or the global limits if namespace is empty. Returns
+// ErrNamespaceNotFound if no such limits are configured.
+func (m *Manager) SetBandwidth(namespace string, egressBitsPerSec, ingressBitsPerSec uint64) error {
+	var l *bandwidth.Limiter
+	if namespace == "" {
+		l = m.global
+	} else {
+		for _, b := range m.backends {
+			if b.regexp.String() == namespace && b.bandwidth != nil {
+				l = b.bandwidth
+				break
+			}
+		}
+	}
+	if l == nil {
+		return ErrNamespaceNotFound
+	}
+	if err := l.SetLimits(egressBitsPerSec, ingressBitsPerSec); err != nil {
+		return err
+	}
+	log.With(
+		"namespace", namespace,
+		"egress_bits_per_sec", egressBitsPerSec,
+		"ingress_bits_per_sec", ingressBitsPerSec).Info("Set backend bandwidth")
 	return nil
 }
 
@@ -136,7 +407,9 @@ func (m *Manager) Register(namespace string, c Client, mustReady bool) error {
 	if err != nil {
 		return fmt.Errorf("new backend: %s", err)
 	}
+	m.mu.Lock()
 	m.backends = append(m.backends, b)
+	m.mu.Unlock()
 	return nil
 }
 
@@ -146,6 +419,8 @@ func (m *Manager) GetClient(namespace string) (Client, error) {
 	if namespace == NoopNamespace {
 		return NoopClient{}, nil
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for _, b := range m.backends {
 		if b.regexp.MatchString(namespace) {
 			return b.client, nil
@@ -154,10 +429,81 @@ func (m *Manager) GetClient(namespace string) (Client, error) {
 	return nil, ErrNamespaceNotFound
 }
 
+// GetRetention returns the retention policy of the backend matching namespace.
+// Returns a zero RetentionConfig if no backends match namespace.
+func (m *Manager) GetRetention(namespace string) RetentionConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, b := range m.backends {
+		if b.regexp.MatchString(namespace) {
+			return b.retention
+		}
+	}
+	return RetentionConfig{}
+}
+
+// SetRetention replaces the retention policy of the backend registered under
+// namespace. Like Register, SetRetention should be primarily used for testing
+// purposes. Returns ErrNamespaceNotFound if no such backend is registered.
+func (m *Manager) SetRetention(namespace string, retention RetentionConfig) error {
+	if err := retention.validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.backends {
+		if b.regexp.String() == namespace {
+			b.retention = retention
+			return nil
+		}
+	}
+	return ErrNamespaceNotFound
+}
+
+// GetReplicas returns the number of origins which cache each blob of the
+// backend matching namespace. Returns 0 if no backends match namespace or the
+// backend does not configure replicas, in which case the default replica count
+// of the origin hash ring applies.
+func (m *Manager) GetReplicas(namespace string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, b := range m.backends {
+		if b.regexp.MatchString(namespace) {
+			return b.replicas
+		}
+	}
+	return 0
+}
+
+// SetReplicas replaces the replica count of the backend registered under
+// namespace. Like Register, SetReplicas should be primarily used for testing
+// purposes. Returns ErrNamespaceNotFound if no such backend is registered.
+func (m *Manager) SetReplicas(namespace string, replicas int) error {
+	if replicas < 0 {
+		return errors.New("replicas must not be negative")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.backends {
+		if b.regexp.String() == namespace {
+			b.replicas = replicas
+			return nil
+		}
+	}
+	return ErrNamespaceNotFound
+}
+
 // CheckReadiness returns whether the backends are ready (available).
 // A backend must be explicitly configured as required for readiness to be checked.
 func (m *Manager) CheckReadiness() error {
-	for _, b := range m.backends {
+	m.mu.RLock()
+	backends := make([]backend, len(m.backends))
+	for i, b := range m.backends {
+		backends[i] = *b
+	}
+	m.mu.RUnlock()
+
+	for _, b := range backends {
 		if !b.mustReady {
 			continue
 		}
@@ -170,6 +516,9 @@ func (m *Manager) CheckReadiness() error {
 }
 
 func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	totalErrors := make([]error, 0)
 	for _, b := range m.backends {
 		if err := b.client.Close(); err != nil {
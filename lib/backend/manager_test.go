@@ -15,7 +15,10 @@ package backend_test
 
 import (
 	"errors"
+	"io"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
@@ -25,10 +28,12 @@ import (
 	"github.com/uber/kraken/lib/backend/testfs"
 	mockbackend "github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/utils/bandwidth"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/stringset"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 )
 
@@ -166,6 +171,321 @@ func TestManagerBandwidth(t *testing.T) {
 	checkBandwidth(5, 25)
 }
 
+func TestManagerGlobalBandwidth(t *testing.T) {
+	require := require.New(t)
+
+	m, err := NewManager(
+		ManagerConfig{
+			Bandwidth: bandwidth.Config{
+				EgressBitsPerSec:  100,
+				IngressBitsPerSec: 200,
+				TokenSize:         1,
+				Enable:            true,
+			},
+		},
+		[]Config{{
+			Namespace: "foo/.*",
+			Bandwidth: bandwidth.Config{
+				EgressBitsPerSec:  10,
+				IngressBitsPerSec: 50,
+				TokenSize:         1,
+				Enable:            true,
+			},
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}, {
+			Namespace: ".*",
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	checkBandwidth := func(namespace string, egress, ingress int64) {
+		c, err := m.GetClient(namespace)
+		require.NoError(err)
+		tc, ok := c.(*ThrottledClient)
+		require.True(ok)
+		require.Equal(egress, tc.EgressLimit())
+		require.Equal(ingress, tc.IngressLimit())
+	}
+
+	// Backends without limits of their own are still throttled globally.
+	checkBandwidth("foo/bar", 10, 50)
+	checkBandwidth("bar", 100, 200)
+
+	require.NoError(m.AdjustBandwidth(2))
+	checkBandwidth("foo/bar", 5, 25)
+	checkBandwidth("bar", 50, 100)
+
+	require.NoError(m.SetBandwidth("", 400, 800))
+	require.NoError(m.SetBandwidth("foo/.*", 40, 80))
+	checkBandwidth("foo/bar", 20, 40)
+	checkBandwidth("bar", 200, 400)
+
+	require.Equal(ErrNamespaceNotFound, m.SetBandwidth(".*", 1, 1))
+
+	require.Equal([]BandwidthLimit{{
+		Namespace:         "",
+		EgressBitsPerSec:  400,
+		IngressBitsPerSec: 800,
+		EgressLimit:       200,
+		IngressLimit:      400,
+	}, {
+		Namespace:         "foo/.*",
+		EgressBitsPerSec:  40,
+		IngressBitsPerSec: 80,
+		EgressLimit:       20,
+		IngressLimit:      40,
+	}}, m.BandwidthLimits())
+}
+
+func TestManagerMiddleware(t *testing.T) {
+	require := require.New(t)
+
+	m, err := NewManager(
+		ManagerConfig{},
+		[]Config{{
+			Namespace: ".*",
+			Bandwidth: bandwidth.Config{
+				EgressBitsPerSec:  10,
+				IngressBitsPerSec: 50,
+				TokenSize:         1,
+				Enable:            true,
+			},
+			Middleware: MiddlewareConfig{
+				Retry:          httputil.ExponentialBackOffConfig{Enabled: true},
+				CircuitBreaker: CircuitBreakerConfig{Enable: true},
+			},
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	c, err := m.GetClient("foo")
+	require.NoError(err)
+	_, ok := c.(*ThrottledClient)
+	require.False(ok)
+
+	// Bandwidth of the wrapped throttled client is still adjusted.
+	require.NoError(m.AdjustBandwidth(2))
+}
+
+func TestManagerRetention(t *testing.T) {
+	require := require.New(t)
+
+	m, err := NewManager(
+		ManagerConfig{},
+		[]Config{{
+			Namespace: "foo/.*",
+			Retention: RetentionConfig{MaxAge: time.Hour, MaxVersions: 3},
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}, {
+			Namespace: ".*",
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	require.Equal(RetentionConfig{MaxAge: time.Hour, MaxVersions: 3}, m.GetRetention("foo/bar"))
+	require.True(m.GetRetention("foo/bar").Enabled())
+	require.False(m.GetRetention("bar").Enabled())
+
+	require.NoError(m.SetRetention(".*", RetentionConfig{MaxVersions: 1}))
+	require.Equal(RetentionConfig{MaxVersions: 1}, m.GetRetention("bar"))
+
+	require.Equal(ErrNamespaceNotFound, m.SetRetention("baz", RetentionConfig{MaxVersions: 1}))
+	require.Error(m.SetRetention(".*", RetentionConfig{MaxAge: -time.Hour}))
+}
+
+func TestManagerReplicas(t *testing.T) {
+	require := require.New(t)
+
+	m, err := NewManager(
+		ManagerConfig{},
+		[]Config{{
+			Namespace: "library/.*",
+			Replicas:  5,
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}, {
+			Namespace: ".*",
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	require.Equal(5, m.GetReplicas("library/ubuntu"))
+	require.Equal(0, m.GetReplicas("datasets/foo"))
+
+	require.NoError(m.SetReplicas(".*", 2))
+	require.Equal(2, m.GetReplicas("datasets/foo"))
+
+	require.Equal(ErrNamespaceNotFound, m.SetReplicas("baz", 1))
+	require.Error(m.SetReplicas(".*", -1))
+
+	_, err = NewManager(
+		ManagerConfig{},
+		[]Config{{
+			Namespace: ".*",
+			Replicas:  -1,
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}}, AuthConfig{}, tally.NoopScope)
+	require.Error(err)
+}
+
+type credentialsProvider struct {
+	creds Credentials
+	err   error
+}
+
+func (p *credentialsProvider) Credentials() (Credentials, error) {
+	return p.creds, p.err
+}
+
+// reloadClient is a client created by reloadClientFactory. Downloads signal
+// started and block until unblock is closed.
+type reloadClient struct {
+	NoopClient
+	token   interface{}
+	started chan struct{}
+	unblock chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *reloadClient) Download(namespace, name string, dst io.Writer) error {
+	c.started <- struct{}{}
+	<-c.unblock
+	return nil
+}
+
+func (c *reloadClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *reloadClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// reloadClientFactory records the clients it creates.
+type reloadClientFactory struct {
+	mu      sync.Mutex
+	clients []*reloadClient
+}
+
+func (f *reloadClientFactory) Create(
+	config interface{}, auth AuthConfig, stats tally.Scope, logger *zap.SugaredLogger) (Client, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var token interface{}
+	if a, ok := auth["reload"].(map[string]interface{}); ok {
+		token = a["token"]
+	}
+	c := &reloadClient{
+		token:   token,
+		started: make(chan struct{}, 1),
+		unblock: make(chan struct{}),
+	}
+	f.clients = append(f.clients, c)
+	return c, nil
+}
+
+func (f *reloadClientFactory) get(i int) *reloadClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.clients[i]
+}
+
+func (f *reloadClientFactory) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.clients)
+}
+
+func TestManagerReloadCredentials(t *testing.T) {
+	require := require.New(t)
+
+	factory := &reloadClientFactory{}
+	Register("reload", factory)
+
+	p := &credentialsProvider{}
+
+	m, err := NewManager(
+		ManagerConfig{},
+		[]Config{{
+			Namespace: "foo/.*",
+			Backend:   map[string]interface{}{"reload": nil},
+			Middleware: MiddlewareConfig{
+				Cache: CacheConfig{Enable: true, TTL: time.Hour},
+			},
+		}, {
+			Namespace: ".*",
+			Backend:   map[string]interface{}{"reload": nil},
+		}}, AuthConfig{}, tally.NoopScope, WithCredentialsProvider(p))
+	require.NoError(err)
+	require.Equal(2, factory.len())
+	foo, other := factory.get(0), factory.get(1)
+
+	getClient := func(namespace string) Client {
+		c, err := m.GetClient(namespace)
+		require.NoError(err)
+		return c
+	}
+	fooClient := getClient("foo/bar")
+
+	// Unchanged credentials keep the existing clients.
+	require.NoError(m.ReloadCredentials())
+	require.Equal(2, factory.len())
+
+	// A download is in progress when credentials change.
+	done := make(chan error)
+	go func() { done <- fooClient.Download("foo/bar", "blob", io.Discard) }()
+	<-foo.started
+
+	// Only the backend whose credentials changed is recreated, behind the same
+	// middlewares.
+	p.creds = Credentials{Namespaces: map[string]AuthConfig{
+		"foo/.*": {"reload": map[string]interface{}{"token": "a"}},
+	}}
+	require.NoError(m.ReloadCredentials())
+	require.Equal(3, factory.len())
+	require.Equal("a", factory.get(2).token)
+	require.True(fooClient == getClient("foo/bar"))
+
+	// The replaced client is closed only once the download finishes.
+	require.False(foo.isClosed())
+	close(foo.unblock)
+	require.NoError(<-done)
+	require.True(foo.isClosed())
+	require.False(other.isClosed())
+
+	// Clients are kept if credentials fail to load.
+	p.err = errors.New("some error")
+	require.Error(m.ReloadCredentials())
+	require.Equal(3, factory.len())
+
+	require.NoError(m.Close())
+	require.True(factory.get(2).isClosed())
+	require.True(other.isClosed())
+}
+
 func TestManagerCheckReadiness(t *testing.T) {
 	n1 := "foo/*"
 	n2 := "bar/*"
@@ -0,0 +1,113 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// MiddlewareConfig defines the wrappers applied to a backend Client. All
+// wrappers are disabled by default.
+type MiddlewareConfig struct {
+	// Cache caches Stat and, optionally, Download responses.
+	Cache CacheConfig `yaml:"cache"`
+
+	// Retry retries failed operations with exponential backoff.
+	Retry httputil.ExponentialBackOffConfig `yaml:"retry"`
+
+	// RateLimit limits the number of operations per second.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	// CircuitBreaker fails operations fast while the backend is unhealthy.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+}
+
+// RateLimitConfig defines the operation rate limit of a backend.
+type RateLimitConfig struct {
+	Enable bool    `yaml:"enable"`
+	QPS    float64 `yaml:"qps"`
+	Burst  int     `yaml:"burst"`
+}
+
+func (c *RateLimitConfig) applyDefaults() {
+	if c.QPS == 0 {
+		c.QPS = 100
+	}
+	if c.Burst == 0 {
+		c.Burst = int(c.QPS)
+		if c.Burst < 1 {
+			c.Burst = 1
+		}
+	}
+}
+
+// CircuitBreakerConfig defines when a backend is considered unhealthy.
+type CircuitBreakerConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// FailureThreshold is the number of consecutive failures which opens the
+	// circuit.
+	FailureThreshold int `yaml:"failure_threshold"`
+
+	// ResetTimeout is how long the circuit stays open before a single trial
+	// operation is let through.
+	ResetTimeout time.Duration `yaml:"reset_timeout"`
+}
+
+func (c *CircuitBreakerConfig) applyDefaults() {
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = 5
+	}
+	if c.ResetTimeout == 0 {
+		c.ResetTimeout = 30 * time.Second
+	}
+}
+
+// Middleware wraps a Client with additional behavior.
+type Middleware func(Client) Client
+
+// Chain wraps c with middlewares, such that the first middleware is the
+// outermost.
+func Chain(c Client, middlewares ...Middleware) Client {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		c = middlewares[i](c)
+	}
+	return c
+}
+
+// Build returns the middlewares enabled in c. The cache is outermost so hits
+// never reach the backend. Retries come next so that each attempt is rate
+// limited and observed by the circuit breaker, while an open circuit is never
+// retried.
+func (c MiddlewareConfig) Build(stats tally.Scope) []Middleware {
+	var middlewares []Middleware
+	if c.Cache.Enable {
+		middlewares = append(middlewares, WithCache(c.Cache, clock.New(), stats))
+	}
+	if c.Retry.Enabled {
+		middlewares = append(middlewares, WithRetry(c.Retry, stats))
+	}
+	if c.CircuitBreaker.Enable {
+		middlewares = append(middlewares, WithCircuitBreaker(c.CircuitBreaker, clock.New(), stats))
+	}
+	if c.RateLimit.Enable {
+		middlewares = append(middlewares, WithRateLimit(c.RateLimit))
+	}
+	return middlewares
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	. "github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func retryConfigFixture() httputil.ExponentialBackOffConfig {
+	return httputil.ExponentialBackOffConfig{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		MaxRetries:      3,
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	require := require.New(t)
+
+	var order []string
+	record := func(name string) Middleware {
+		return func(c Client) Client {
+			order = append(order, name)
+			return c
+		}
+	}
+	Chain(&NoopClient{}, record("outer"), record("inner"))
+
+	// Inner middlewares wrap the client first.
+	require.Equal([]string{"inner", "outer"}, order)
+}
+
+func TestRetryClientRetriesTransientErrors(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithRetry(retryConfigFixture(), tally.NoopScope))
+
+	gomock.InOrder(
+		mockClient.EXPECT().Stat("ns", "name").Return(nil, errors.New("some error")),
+		mockClient.EXPECT().Stat("ns", "name").Return(nil, errors.New("some error")),
+		mockClient.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(1), nil),
+	)
+
+	info, err := c.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(1), info)
+}
+
+func TestRetryClientGivesUp(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithRetry(retryConfigFixture(), tally.NoopScope))
+
+	mockClient.EXPECT().List("prefix").Return(nil, errors.New("some error")).Times(4)
+
+	_, err := c.List("prefix")
+	require.Error(err)
+}
+
+func TestRetryClientDoesNotRetryPermanentErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, permanent := range []error{
+		backenderrors.ErrBlobNotFound,
+		ErrCircuitOpen,
+		httputil.StatusError{Status: 403},
+	} {
+		t.Run(permanent.Error(), func(t *testing.T) {
+			mockClient := mockbackend.NewMockClient(ctrl)
+			c := Chain(mockClient, WithRetry(retryConfigFixture(), tally.NoopScope))
+
+			mockClient.EXPECT().Stat("ns", "name").Return(nil, permanent)
+
+			_, err := c.Stat("ns", "name")
+			require.Equal(t, permanent, err)
+		})
+	}
+}
+
+func TestRetryClientUploadRewindsSource(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithRetry(retryConfigFixture(), tally.NoopScope))
+
+	data := []byte("some data")
+	var uploaded [][]byte
+	upload := func(namespace, name string, src io.Reader) {
+		b, err := io.ReadAll(src)
+		require.NoError(err)
+		uploaded = append(uploaded, b)
+	}
+	gomock.InOrder(
+		mockClient.EXPECT().Upload("ns", "name", gomock.Any()).Do(upload).Return(errors.New("some error")),
+		mockClient.EXPECT().Upload("ns", "name", gomock.Any()).Do(upload).Return(nil),
+	)
+
+	require.NoError(c.Upload("ns", "name", bytes.NewReader(data)))
+	require.Equal([][]byte{data, data}, uploaded)
+}
+
+func TestRetryClientUploadDoesNotRetryStreams(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithRetry(retryConfigFixture(), tally.NoopScope))
+
+	mockClient.EXPECT().Upload("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+	require.Error(c.Upload("ns", "name", io.LimitReader(bytes.NewReader([]byte("data")), 4)))
+}
+
+func TestRetryClientDoesNotRetryUploadStream(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithRetry(retryConfigFixture(), tally.NoopScope))
+
+	mockClient.EXPECT().UploadStream("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+	require.Error(c.UploadStream("ns", "name", bytes.NewReader([]byte("data"))))
+}
+
+func TestRetryClientDownloadDoesNotRetryPartialWrites(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithRetry(retryConfigFixture(), tally.NoopScope))
+
+	mockClient.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			dst.Write([]byte("partial"))
+			return errors.New("some error")
+		})
+
+	var b bytes.Buffer
+	require.Error(c.Download("ns", "name", &b))
+	require.Equal("partial", b.String())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clk := clock.NewMock()
+	mockClient := mockbackend.NewMockClient(ctrl)
+	config := CircuitBreakerConfig{FailureThreshold: 2, ResetTimeout: time.Minute}
+	c := Chain(mockClient, WithCircuitBreaker(config, clk, tally.NoopScope))
+
+	// Not found does not count as a failure.
+	mockClient.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound).Times(3)
+	for i := 0; i < 3; i++ {
+		_, err := c.Stat("ns", "name")
+		require.Equal(backenderrors.ErrBlobNotFound, err)
+	}
+
+	mockClient.EXPECT().Stat("ns", "name").Return(nil, errors.New("some error")).Times(2)
+	for i := 0; i < 2; i++ {
+		_, err := c.Stat("ns", "name")
+		require.Error(err)
+	}
+
+	// Open: the client is not called.
+	_, err := c.Stat("ns", "name")
+	require.Equal(ErrCircuitOpen, err)
+
+	// Failed trial keeps the circuit open.
+	clk.Add(time.Minute)
+	mockClient.EXPECT().Stat("ns", "name").Return(nil, errors.New("some error"))
+	_, err = c.Stat("ns", "name")
+	require.Error(err)
+	require.NotEqual(ErrCircuitOpen, err)
+
+	_, err = c.Stat("ns", "name")
+	require.Equal(ErrCircuitOpen, err)
+
+	// Successful trial closes the circuit.
+	clk.Add(time.Minute)
+	mockClient.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(1), nil).Times(2)
+	for i := 0; i < 2; i++ {
+		_, err := c.Stat("ns", "name")
+		require.NoError(err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mockbackend.NewMockClient(ctrl)
+	c := Chain(mockClient, WithRateLimit(RateLimitConfig{QPS: 20, Burst: 1}))
+
+	mockClient.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(1), nil).Times(3)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := c.Stat("ns", "name")
+		require.NoError(err)
+	}
+	require.True(time.Since(start) >= 90*time.Millisecond)
+}
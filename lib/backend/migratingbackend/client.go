@@ -0,0 +1,272 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migratingbackend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/mirror"
+	"github.com/uber/kraken/localdb"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+const _migrating = "migrating"
+
+// _copyTarget names the new backend in copy tasks.
+const _copyTarget = "new"
+
+func init() {
+	backend.Register(_migrating, &factory{})
+}
+
+type factory struct{}
+
+func (f *factory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, logger *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal migrating config")
+	}
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal migrating config")
+	}
+	return NewClient(config, masterAuthConfig, stats, logger)
+}
+
+// Client implements a backend.Client which migrates blobs from an old backend
+// to a new backend on read. Uploads go to the new backend. Reads try the new
+// backend first and fall back to the old backend on ErrBlobNotFound, in which
+// case the blob is copied into the new backend in the background.
+type Client struct {
+	newBackend backend.Client
+	oldBackend backend.Client
+	copies     persistedretry.Manager
+	db         *sqlx.DB
+	stats      tally.Scope
+	closeOnce  sync.Once
+}
+
+// NewClient creates a new Client.
+func NewClient(
+	config Config,
+	masterAuthConfig backend.AuthConfig,
+	stats tally.Scope,
+	logger *zap.SugaredLogger) (*Client, error) {
+
+	if config.Database.Source == "" {
+		return nil, errors.New("invalid config: database source required")
+	}
+	newClient, err := backend.NewClient(config.New, masterAuthConfig, stats, logger)
+	if err != nil {
+		return nil, fmt.Errorf("new backend: %s", err)
+	}
+	oldClient, err := backend.NewClient(config.Old, masterAuthConfig, stats, logger)
+	if err != nil {
+		newClient.Close()
+		return nil, fmt.Errorf("old backend: %s", err)
+	}
+	db, err := localdb.New(config.Database)
+	if err != nil {
+		newClient.Close()
+		oldClient.Close()
+		return nil, fmt.Errorf("localdb: %s", err)
+	}
+	client, err := newMigratingClient(config, newClient, oldClient, db, stats)
+	if err != nil {
+		newClient.Close()
+		oldClient.Close()
+		db.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func newMigratingClient(
+	config Config,
+	newClient backend.Client,
+	oldClient backend.Client,
+	db *sqlx.DB,
+	stats tally.Scope) (*Client, error) {
+
+	stats = stats.Tagged(map[string]string{
+		"module": "migratingbackend",
+	})
+
+	executor := mirror.NewExecutor(stats, oldClient, map[string]backend.Client{
+		_copyTarget: newClient,
+	})
+	copies, err := persistedretry.NewManager(config.Retry, stats, mirror.NewStore(db), executor)
+	if err != nil {
+		return nil, fmt.Errorf("copy retry manager: %s", err)
+	}
+	return &Client{
+		newBackend: newClient,
+		oldBackend: oldClient,
+		copies:     copies,
+		db:         db,
+		stats:      stats,
+	}, nil
+}
+
+// Stat returns blob info for name from the new backend, or from the old
+// backend if the new backend does not have name.
+func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
+	info, err := c.newBackend.Stat(namespace, name)
+	if err != backenderrors.ErrBlobNotFound {
+		return info, err
+	}
+	return c.oldBackend.Stat(namespace, name)
+}
+
+// Download downloads name into dst from the new backend, or from the old
+// backend if the new backend does not have name. Blobs read from the old
+// backend are copied into the new backend in the background.
+func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	err := c.newBackend.Download(namespace, name, dst)
+	if err != backenderrors.ErrBlobNotFound {
+		return err
+	}
+	if err := c.oldBackend.Download(namespace, name, dst); err != nil {
+		return err
+	}
+	c.copyFromOld(namespace, name)
+	return nil
+}
+
+// copyFromOld schedules copying name, which was read from the old backend,
+// into the new backend.
+func (c *Client) copyFromOld(namespace, name string) {
+	c.stats.Counter("old_backend_hits").Inc(1)
+	if err := c.copies.Add(mirror.NewTask(namespace, name, _copyTarget)); err != nil {
+		// The read itself succeeded, and the next read will retry the copy.
+		log.With("namespace", namespace, "name", name).Errorf("Error adding copy to new backend: %s", err)
+	}
+}
+
+// DownloadRange downloads a range of name into dst like Download.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	err := c.newBackend.DownloadRange(namespace, name, offset, length, dst)
+	if err != backenderrors.ErrBlobNotFound {
+		return err
+	}
+	if err := c.oldBackend.DownloadRange(namespace, name, offset, length, dst); err != nil {
+		return err
+	}
+	c.copyFromOld(namespace, name)
+	return nil
+}
+
+// Upload uploads src into name on the new backend.
+func (c *Client) Upload(namespace, name string, src io.Reader) error {
+	return c.newBackend.Upload(namespace, name, src)
+}
+
+// UploadStream uploads src into name on the new backend.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.newBackend.UploadStream(namespace, name, src)
+}
+
+// Delete deletes name from both backends, so it is not read from the old
+// backend once deleted from the new one.
+func (c *Client) Delete(namespace, name string) error {
+	if err := c.newBackend.Delete(namespace, name); err != nil && err != backenderrors.ErrBlobNotFound {
+		return fmt.Errorf("new backend: %s", err)
+	}
+	if err := c.oldBackend.Delete(namespace, name); err != nil && err != backenderrors.ErrBlobNotFound {
+		return fmt.Errorf("old backend: %s", err)
+	}
+	return nil
+}
+
+// List lists the union of names with prefix in both backends. Continuation
+// tokens are specific to each backend, so both backends are listed in full
+// and paginated results are sliced in name order, with the last returned name
+// as continuation token.
+func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	options := backend.DefaultListOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	newResult, err := c.newBackend.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("new backend: %s", err)
+	}
+	oldResult, err := c.oldBackend.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("old backend: %s", err)
+	}
+	names := merge(newResult.Names, oldResult.Names)
+
+	if !options.Paginated {
+		return &backend.ListResult{Names: names}, nil
+	}
+	start := sort.SearchStrings(names, options.ContinuationToken)
+	if start < len(names) && names[start] == options.ContinuationToken {
+		start++
+	}
+	end := start + options.MaxKeys
+	if end >= len(names) {
+		return &backend.ListResult{Names: names[start:]}, nil
+	}
+	return &backend.ListResult{
+		Names:             names[start:end],
+		ContinuationToken: names[end-1],
+	}, nil
+}
+
+// merge returns the sorted, de-duplicated union of a and b.
+func merge(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var names []string
+	for _, l := range [][]string{a, b} {
+		for _, name := range l {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops copies and closes both backends. Pending copies resume when a
+// Client is next created with the same database.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.copies.Close()
+		c.newBackend.Close()
+		c.oldBackend.Close()
+		c.db.Close()
+	})
+	return nil
+}
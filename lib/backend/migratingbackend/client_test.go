@@ -0,0 +1,198 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migratingbackend
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/localdb"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+type clientMocks struct {
+	new *mockbackend.MockClient
+	old *mockbackend.MockClient
+}
+
+func newClientMocks(t *testing.T) (*Client, *clientMocks, func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	ctrl := gomock.NewController(t)
+	cleanup.Add(ctrl.Finish)
+
+	db, c := localdb.Fixture(t)
+	cleanup.Add(c)
+
+	mocks := &clientMocks{
+		new: mockbackend.NewMockClient(ctrl),
+		old: mockbackend.NewMockClient(ctrl),
+	}
+	client, err := newMigratingClient(Config{
+		Retry: persistedretry.Config{
+			PollRetriesInterval: 100 * time.Millisecond,
+			RetryInterval:       100 * time.Millisecond,
+		},
+	}, mocks.new, mocks.old, db, tally.NoopScope)
+	require.NoError(t, err)
+
+	return client, mocks, func() {
+		// Stop copies before tearing down the mocks and database.
+		client.copies.Close()
+		cleanup.Run()
+	}
+}
+
+func writeContent(content []byte) func(string, string, io.Writer) error {
+	return func(namespace, name string, dst io.Writer) error {
+		_, err := dst.Write(content)
+		return err
+	}
+}
+
+func TestClientDownloadFromNew(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.new.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(writeContent([]byte("data")))
+
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", "name", &b))
+	require.Equal("data", b.String())
+}
+
+func TestClientDownloadFallsBackToOldAndCopies(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+
+	done := make(chan struct{})
+
+	mocks.new.EXPECT().Download("ns", name, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.old.EXPECT().Download("ns", name, gomock.Any()).DoAndReturn(writeContent(blob.Content)).Times(2)
+	mocks.new.EXPECT().Stat("ns", name).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.new.EXPECT().Upload("ns", name, mockutil.MatchReader(blob.Content)).Do(
+		func(string, string, io.Reader) { close(done) }).Return(nil)
+
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", name, &b))
+	require.Equal(blob.Content, b.Bytes())
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for copy to new backend")
+	}
+}
+
+func TestClientDownloadNotFoundInEither(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.new.EXPECT().Download("ns", "name", gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.old.EXPECT().Download("ns", "name", gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	require.Equal(backenderrors.ErrBlobNotFound, client.Download("ns", "name", &bytes.Buffer{}))
+}
+
+func TestClientDownloadNewErrorDoesNotFallBack(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.new.EXPECT().Download("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+	require.Error(client.Download("ns", "name", &bytes.Buffer{}))
+}
+
+func TestClientStatFallsBackToOld(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	info := core.NewBlobInfo(10)
+
+	mocks.new.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.old.EXPECT().Stat("ns", "name").Return(info, nil)
+
+	result, err := client.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(info, result)
+}
+
+func TestClientUploadTargetsNew(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.new.EXPECT().Upload("ns", "name", mockutil.MatchReader([]byte("data"))).Return(nil)
+
+	require.NoError(client.Upload("ns", "name", bytes.NewReader([]byte("data"))))
+}
+
+func TestClientListMergesBackends(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.new.EXPECT().List("prefix").Return(&backend.ListResult{Names: []string{"c", "a"}}, nil).Times(3)
+	mocks.old.EXPECT().List("prefix").Return(&backend.ListResult{Names: []string{"b", "a", "d"}}, nil).Times(3)
+
+	result, err := client.List("prefix")
+	require.NoError(err)
+	require.Equal([]string{"a", "b", "c", "d"}, result.Names)
+
+	result, err = client.List("prefix", backend.ListWithPagination(), backend.ListWithMaxKeys(3))
+	require.NoError(err)
+	require.Equal([]string{"a", "b", "c"}, result.Names)
+	require.Equal("c", result.ContinuationToken)
+
+	result, err = client.List("prefix",
+		backend.ListWithPagination(),
+		backend.ListWithMaxKeys(3),
+		backend.ListWithContinuationToken(result.ContinuationToken))
+	require.NoError(err)
+	require.Equal([]string{"d"}, result.Names)
+	require.Empty(result.ContinuationToken)
+}
+
+func TestNewClientRequiresDatabase(t *testing.T) {
+	_, err := NewClient(Config{}, nil, tally.NoopScope, nil)
+	require.Error(t, err)
+}
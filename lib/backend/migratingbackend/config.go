@@ -0,0 +1,37 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migratingbackend
+
+import (
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/localdb"
+)
+
+// Config defines a migration from an old backend to a new backend.
+type Config struct {
+	// New is the backend being migrated to. It receives all uploads and is
+	// read first. It is configured like any other backend, e.g. {s3: {...}}.
+	New map[string]interface{} `yaml:"new"`
+
+	// Old is the backend being migrated from. It is only read for blobs
+	// which New does not have yet.
+	Old map[string]interface{} `yaml:"old"`
+
+	// Database persists copies from Old to New which have yet to succeed, so
+	// they survive restarts.
+	Database localdb.Config `yaml:"database"`
+
+	// Retry configures the execution and retry of copies.
+	Retry persistedretry.Config `yaml:"retry"`
+}
@@ -28,8 +28,16 @@ const (
 	Identity          = "identity"
 )
 
-// New creates a Pather scoped to root.
+// New creates a Pather scoped to root. id is either a built-in Pather
+// identifier or a template (see TemplatePather).
 func New(root, id string) (Pather, error) {
+	if IsTemplate(id) {
+		p, err := NewTemplatePather(root, id)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
 	switch id {
 	case DockerTag:
 		return DockerTagPather{root}, nil
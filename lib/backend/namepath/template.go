@@ -0,0 +1,283 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package namepath
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Template variables. _digest is an alias of _name which reads better in
+// templates for content-addressable blobs.
+const (
+	_prefix = "prefix"
+	_name   = "name"
+	_digest = "digest"
+	_repo   = "repo"
+	_tag    = "tag"
+)
+
+// templatePart is either a literal or a variable of a parsed template.
+type templatePart struct {
+	literal string
+
+	// variable is empty for literals.
+	variable string
+
+	// sliced parts render variable[start:end].
+	sliced     bool
+	start, end int
+}
+
+// TemplatePather generates paths from a user defined template, e.g.
+// "{prefix}/{digest:0:2}/{digest}". Supported variables are:
+//
+//	{prefix}         the root directory
+//	{name}           the full name, also available as {digest}
+//	{name:i:j}       the substring name[i:j]
+//	{repo}, {tag}    the repo and tag of a "repo:tag" name
+//
+// A template must reference either the full name or both repo and tag, such
+// that names can be parsed back from paths. The built-in pathers are
+// equivalent to the following templates:
+//
+//	identity:            {prefix}/{name}
+//	sharded_docker_blob: {prefix}/docker/registry/v2/blobs/sha256/{name:0:2}/{name}/data
+//	docker_tag:          {prefix}/docker/registry/v2/repositories/{repo}/_manifests/tags/{tag}/current/link
+type TemplatePather struct {
+	root     string
+	template string
+	parts    []templatePart
+	tagged   bool
+
+	// re matches rendered paths, capturing groupVars.
+	re        *regexp.Regexp
+	groupVars []string
+}
+
+// IsTemplate returns whether id is a template rather than a built-in Pather
+// identifier.
+func IsTemplate(id string) bool {
+	return strings.Contains(id, "{")
+}
+
+// NewTemplatePather parses and validates template and returns a Pather
+// scoped to root.
+func NewTemplatePather(root, template string) (*TemplatePather, error) {
+	parts, err := parseTemplate(template)
+	if err != nil {
+		return nil, fmt.Errorf("parse template %q: %s", template, err)
+	}
+	p := &TemplatePather{root: strings.TrimSuffix(root, "/"), template: template, parts: parts}
+
+	vars := make(map[string]bool)
+	for _, part := range parts {
+		if part.variable != "" && !part.sliced {
+			vars[part.variable] = true
+		}
+	}
+	switch {
+	case vars[_name]:
+		if vars[_repo] || vars[_tag] {
+			return nil, fmt.Errorf("template %q: name cannot be combined with repo and tag", template)
+		}
+	case vars[_repo] && vars[_tag]:
+		p.tagged = true
+	default:
+		return nil, fmt.Errorf(
+			"template %q: must reference {name}, {digest} or both {repo} and {tag}", template)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, part := range parts {
+		switch {
+		case part.variable == "":
+			expr.WriteString(regexp.QuoteMeta(part.literal))
+		case part.variable == _prefix:
+			expr.WriteString(regexp.QuoteMeta(p.root))
+		case part.sliced:
+			fmt.Fprintf(&expr, ".{%d}", part.end-part.start)
+		case part.variable == _tag:
+			expr.WriteString("([^/]+)")
+			p.groupVars = append(p.groupVars, part.variable)
+		default:
+			expr.WriteString("(.+)")
+			p.groupVars = append(p.groupVars, part.variable)
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("template %q: compile regexp: %s", template, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// parseTemplate splits template into literals and validated variables.
+func parseTemplate(template string) ([]templatePart, error) {
+	var parts []templatePart
+	for rest := template; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open == -1 {
+			parts = append(parts, templatePart{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, errors.New("unexpected '}'")
+		}
+		if open > 0 {
+			parts = append(parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end == -1 || rest[open+1+end] != '}' {
+			return nil, errors.New("unterminated '{'")
+		}
+		part, err := parseVariable(rest[open+1 : open+1+end])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		rest = rest[open+1+end+1:]
+	}
+	if len(parts) == 0 {
+		return nil, errors.New("empty template")
+	}
+	return parts, nil
+}
+
+// parseVariable parses the contents of a "{...}" expression.
+func parseVariable(expr string) (templatePart, error) {
+	tokens := strings.Split(expr, ":")
+	name := tokens[0]
+	if name == _digest {
+		name = _name
+	}
+	switch name {
+	case _prefix, _name, _repo, _tag:
+	default:
+		return templatePart{}, fmt.Errorf("unknown variable %q", tokens[0])
+	}
+	part := templatePart{variable: name}
+	switch len(tokens) {
+	case 1:
+		return part, nil
+	case 3:
+		if name != _name {
+			return templatePart{}, fmt.Errorf("variable %q cannot be sliced", tokens[0])
+		}
+		start, err := strconv.Atoi(tokens[1])
+		if err != nil {
+			return templatePart{}, fmt.Errorf("invalid slice start in %q", expr)
+		}
+		end, err := strconv.Atoi(tokens[2])
+		if err != nil {
+			return templatePart{}, fmt.Errorf("invalid slice end in %q", expr)
+		}
+		if start < 0 || end <= start {
+			return templatePart{}, fmt.Errorf("invalid slice bounds in %q", expr)
+		}
+		part.sliced, part.start, part.end = true, start, end
+		return part, nil
+	default:
+		return templatePart{}, fmt.Errorf("malformed variable %q", expr)
+	}
+}
+
+// BasePath returns the longest directory shared by all paths the template
+// generates.
+func (p *TemplatePather) BasePath() string {
+	var prefix strings.Builder
+	for _, part := range p.parts {
+		if part.variable == "" {
+			prefix.WriteString(part.literal)
+		} else if part.variable == _prefix {
+			prefix.WriteString(p.root)
+		} else {
+			break
+		}
+	}
+	base := prefix.String()
+	switch i := strings.LastIndex(base, "/"); i {
+	case -1:
+		return ""
+	case 0:
+		return "/"
+	default:
+		return base[:i]
+	}
+}
+
+// BlobPath renders the template for name.
+func (p *TemplatePather) BlobPath(name string) (string, error) {
+	var repo, tag string
+	if p.tagged {
+		tokens := strings.Split(name, ":")
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return "", errors.New("name must be in format 'repo:tag'")
+		}
+		repo, tag = tokens[0], tokens[1]
+	}
+	var b strings.Builder
+	for _, part := range p.parts {
+		switch {
+		case part.variable == "":
+			b.WriteString(part.literal)
+		case part.variable == _prefix:
+			b.WriteString(p.root)
+		case part.variable == _repo:
+			b.WriteString(repo)
+		case part.variable == _tag:
+			b.WriteString(tag)
+		case part.sliced:
+			if len(name) < part.end {
+				return "", fmt.Errorf("name is too short, must be >= %d characters", part.end)
+			}
+			b.WriteString(name[part.start:part.end])
+		default:
+			if name == "" {
+				return "", errors.New("name must be non-empty")
+			}
+			b.WriteString(name)
+		}
+	}
+	return path.Clean(b.String()), nil
+}
+
+// NameFromBlobPath parses bp back into the name it was rendered from.
+func (p *TemplatePather) NameFromBlobPath(bp string) (string, error) {
+	matches := p.re.FindStringSubmatch(bp)
+	if matches == nil {
+		return "", fmt.Errorf("path does not match template %q", p.template)
+	}
+	// Repeated variables must match, which is verified below.
+	groups := make(map[string]string)
+	for i, v := range p.groupVars {
+		groups[v] = matches[i+1]
+	}
+	name := groups[_name]
+	if p.tagged {
+		name = groups[_repo] + ":" + groups[_tag]
+	}
+	// Verify that repeated and sliced variables are consistent with name.
+	if rendered, err := p.BlobPath(name); err != nil || rendered != bp {
+		return "", fmt.Errorf("path does not match template %q", p.template)
+	}
+	return name, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package namepath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const _testDigest = "ff85ceb9734a3c2fbb886e0f7cfc66b046eeeae953d8cb430dc5a7ace544b0e9"
+
+func TestTemplateMatchesBuiltinPathers(t *testing.T) {
+	tests := []struct {
+		builtin  string
+		template string
+		name     string
+	}{
+		{Identity, "{prefix}/{name}", "foo/bar"},
+		{
+			ShardedDockerBlob,
+			"{prefix}/docker/registry/v2/blobs/sha256/{name:0:2}/{name}/data",
+			_testDigest,
+		}, {
+			DockerTag,
+			"{prefix}/docker/registry/v2/repositories/{repo}/_manifests/tags/{tag}/current/link",
+			"namespace/repo-bar:latest",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.builtin, func(t *testing.T) {
+			require := require.New(t)
+
+			builtin, err := New("/root", test.builtin)
+			require.NoError(err)
+			template, err := New("/root", test.template)
+			require.NoError(err)
+
+			// Templates may derive a deeper, but never a shallower, base path.
+			require.True(strings.HasPrefix(template.BasePath(), builtin.BasePath()))
+
+			expected, err := builtin.BlobPath(test.name)
+			require.NoError(err)
+			p, err := template.BlobPath(test.name)
+			require.NoError(err)
+			require.Equal(expected, p)
+
+			name, err := template.NameFromBlobPath(p)
+			require.NoError(err)
+			require.Equal(test.name, name)
+		})
+	}
+}
+
+func TestTemplatePatherCustomLayout(t *testing.T) {
+	require := require.New(t)
+
+	p, err := New("/bucket/", "{prefix}/{digest:0:2}/{digest:2:4}/{digest}")
+	require.NoError(err)
+	require.Equal("/bucket", p.BasePath())
+
+	bp, err := p.BlobPath(_testDigest)
+	require.NoError(err)
+	require.Equal("/bucket/ff/85/"+_testDigest, bp)
+
+	name, err := p.NameFromBlobPath(bp)
+	require.NoError(err)
+	require.Equal(_testDigest, name)
+
+	// Shards which are inconsistent with the name are rejected.
+	_, err = p.NameFromBlobPath("/bucket/aa/85/" + _testDigest)
+	require.Error(err)
+	_, err = p.NameFromBlobPath("/other/ff/85/" + _testDigest)
+	require.Error(err)
+
+	_, err = p.BlobPath("ff8")
+	require.Error(err)
+}
+
+func TestTemplatePatherInvalidTemplates(t *testing.T) {
+	for _, template := range []string{
+		"{prefix}/{unknown}",
+		"{prefix}/{digest",
+		"{prefix}/digest}",
+		"{prefix}/{digest:2:1}/{digest}",
+		"{prefix}/{digest:a:2}/{digest}",
+		"{prefix}/{digest:0}/{digest}",
+		"{prefix}/{repo:0:2}/{repo}/{tag}",
+		"{prefix}/{digest:0:2}",
+		"{prefix}/{repo}",
+		"{prefix}/{repo}/{tag}/{name}",
+	} {
+		t.Run(template, func(t *testing.T) {
+			_, err := New("/root", template)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestTemplatePatherTagErrors(t *testing.T) {
+	p, err := New("/root", "{prefix}/{repo}/tags/{tag}")
+	require.NoError(t, err)
+
+	for _, name := range []string{_testDigest, ":", "repo:", ":tag"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := p.BlobPath(name)
+			require.Error(t, err)
+		})
+	}
+}
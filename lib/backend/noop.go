@@ -39,11 +39,28 @@ func (c NoopClient) Upload(namespace, name string, src io.Reader) error {
 	return nil
 }
 
+// UploadStream always returns nil.
+func (c NoopClient) UploadStream(namespace, name string, src io.Reader) error {
+	return nil
+}
+
 // Download always returns ErrBlobNotFound.
 func (c NoopClient) Download(namespace, name string, dst io.Writer) error {
 	return backenderrors.ErrBlobNotFound
 }
 
+// DownloadRange always returns ErrBlobNotFound.
+func (c NoopClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return backenderrors.ErrBlobNotFound
+}
+
+// Delete always returns nil.
+func (c NoopClient) Delete(namespace, name string) error {
+	return nil
+}
+
 // List always returns nil.
 func (c NoopClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
 	return nil, nil
@@ -0,0 +1,249 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pluginbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	pb "github.com/uber/kraken/gen/go/proto/backendplugin"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/log"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+)
+
+const _plugin = "plugin"
+
+func init() {
+	backend.Register(_plugin, &factory{})
+}
+
+type factory struct{}
+
+func (f *factory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal plugin config")
+	}
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal plugin config")
+	}
+	return NewClient(config, stats)
+}
+
+// Client implements a backend.Client which proxies calls to a plugin serving
+// the backendplugin gRPC protocol.
+type Client struct {
+	config Config
+	stats  tally.Scope
+	conn   *grpc.ClientConn
+	api    pb.BackendClient
+
+	// cmd is the launched plugin process, nil when dialing Address.
+	cmd       *exec.Cmd
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewClient creates a new Client, launching the plugin if a command is
+// configured.
+func NewClient(config Config, stats tally.Scope) (*Client, error) {
+	config.applyDefaults()
+	if (config.Address == "") == (config.Command == "") {
+		return nil, errors.New("invalid config: exactly one of address and command required")
+	}
+
+	var cmd *exec.Cmd
+	target := config.Address
+	if config.Command != "" {
+		var err error
+		cmd, target, err = launch(config)
+		if err != nil {
+			return nil, fmt.Errorf("launch plugin %s: %s", config.Command, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.StartTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, target, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		if cmd != nil {
+			cmd.Process.Kill() //nolint:errcheck
+			cmd.Wait()         //nolint:errcheck
+		}
+		return nil, fmt.Errorf("dial plugin %s: %s", target, err)
+	}
+	return &Client{
+		config: config,
+		stats:  stats,
+		conn:   conn,
+		api:    pb.NewBackendClient(conn),
+		cmd:    cmd,
+	}, nil
+}
+
+// toBackendError converts plugin errors into backend errors.
+func toBackendError(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return backenderrors.ErrBlobNotFound
+	}
+	return err
+}
+
+// Stat returns blob info for name.
+func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	resp, err := c.api.Stat(ctx, &pb.StatRequest{Namespace: namespace, Name: name})
+	if err != nil {
+		return nil, toBackendError(err)
+	}
+	return core.NewBlobInfo(resp.Size), nil
+}
+
+// Download downloads the content of name into dst.
+func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.api.Download(ctx, &pb.DownloadRequest{Namespace: namespace, Name: name})
+	if err != nil {
+		return toBackendError(err)
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return toBackendError(err)
+		}
+		if _, err := dst.Write(chunk.Data); err != nil {
+			return fmt.Errorf("write chunk: %s", err)
+		}
+	}
+}
+
+// DownloadRange downloads a range of name into dst. The plugin protocol has
+// no ranged reads, so the stream is cancelled once the range is written.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return backend.FallbackDownloadRange(c, namespace, name, offset, length, dst)
+}
+
+// UploadStream uploads src to name. src is streamed to the plugin in chunks,
+// so its length need not be known upfront.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Upload(namespace, name, src)
+}
+
+// Upload uploads src to name.
+func (c *Client) Upload(namespace, name string, src io.Reader) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.api.Upload(ctx)
+	if err != nil {
+		return err
+	}
+	req := &pb.UploadRequest{Namespace: namespace, Name: name}
+	buf := make([]byte, int(c.config.ChunkSize))
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 || req.Name != "" {
+			req.Data = buf[:n]
+			if err := stream.Send(req); err != nil {
+				// The reason the plugin aborted the stream is returned by
+				// CloseAndRecv.
+				if err == io.EOF {
+					break
+				}
+				return fmt.Errorf("send chunk: %s", err)
+			}
+			req = &pb.UploadRequest{}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read src: %s", err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete is not supported, since the plugin protocol has no deletes.
+func (c *Client) Delete(namespace, name string) error {
+	return errors.New("not supported")
+}
+
+// List lists names which start with prefix.
+func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	options := backend.DefaultListOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	resp, err := c.api.List(ctx, &pb.ListRequest{
+		Prefix:            prefix,
+		Paginated:         options.Paginated,
+		MaxKeys:           int32(options.MaxKeys),
+		ContinuationToken: options.ContinuationToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &backend.ListResult{
+		Names:             resp.Names,
+		ContinuationToken: resp.ContinuationToken,
+	}, nil
+}
+
+// Close closes the connection to the plugin and stops the plugin if it was
+// launched by the client.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.conn.Close()
+		if c.cmd != nil {
+			if err := c.cmd.Process.Kill(); err != nil {
+				log.With("command", c.config.Command).Errorf("Error killing plugin: %s", err)
+			}
+			c.cmd.Wait() //nolint:errcheck
+		}
+	})
+	return c.closeErr
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pluginbackend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	pb "github.com/uber/kraken/gen/go/proto/backendplugin"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"google.golang.org/grpc"
+)
+
+const _helperPluginEnv = "KRAKEN_TEST_HELPER_PLUGIN"
+
+func TestMain(m *testing.M) {
+	// The test binary doubles as a plugin when launched by TestClientLaunch.
+	if os.Getenv(_helperPluginEnv) == "1" {
+		if err := Serve(backend.NoopClient{}); err != nil {
+			os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type clientMocks struct {
+	backend *mockbackend.MockClient
+	addr    string
+}
+
+func newClientMocks(t *testing.T) (*clientMocks, func()) {
+	ctrl := gomock.NewController(t)
+	mockBackend := mockbackend.NewMockClient(ctrl)
+
+	dir, err := os.MkdirTemp("", "pluginbackend_test")
+	require.NoError(t, err)
+	sock := filepath.Join(dir, "plugin.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+
+	s := grpc.NewServer()
+	pb.RegisterBackendServer(s, NewServer(mockBackend))
+	go s.Serve(l) //nolint:errcheck
+
+	return &clientMocks{mockBackend, "unix://" + sock}, func() {
+		s.Stop()
+		os.RemoveAll(dir)
+		ctrl.Finish()
+	}
+}
+
+func (m *clientMocks) new(t *testing.T, config Config) *Client {
+	config.Address = m.addr
+	c, err := NewClient(config, tally.NoopScope)
+	require.NoError(t, err)
+	return c
+}
+
+func TestNewClientInvalidConfig(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewClient(Config{}, tally.NoopScope)
+	require.Error(err)
+
+	_, err = NewClient(Config{Address: "unix:///plugin.sock", Command: "plugin"}, tally.NoopScope)
+	require.Error(err)
+}
+
+func TestClientStat(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new(t, Config{})
+	defer client.Close()
+
+	mocks.backend.EXPECT().Stat("ns", "blob").Return(core.NewBlobInfo(42), nil)
+	mocks.backend.EXPECT().Stat("ns", "missing").Return(nil, backenderrors.ErrBlobNotFound)
+
+	info, err := client.Stat("ns", "blob")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(42), info)
+
+	_, err = client.Stat("ns", "missing")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+}
+
+func TestClientDownload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new(t, Config{})
+	defer client.Close()
+
+	data := randutil.Text(_downloadChunkSize + 100)
+
+	mocks.backend.EXPECT().Download("ns", "blob", gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			_, err := dst.Write(data)
+			return err
+		})
+	mocks.backend.EXPECT().Download("ns", "missing", gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", "blob", &b))
+	require.Equal(data, b.Bytes())
+
+	require.Equal(backenderrors.ErrBlobNotFound, client.Download("ns", "missing", &b))
+}
+
+func TestClientUpload(t *testing.T) {
+	for _, size := range []uint64{0, 7, 8, 100} {
+		t.Run(fmt.Sprintf("%d bytes", size), func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newClientMocks(t)
+			defer cleanup()
+
+			client := mocks.new(t, Config{ChunkSize: 8})
+			defer client.Close()
+
+			data := randutil.Text(size)
+
+			var uploaded []byte
+			mocks.backend.EXPECT().Upload("ns", "blob", gomock.Any()).DoAndReturn(
+				func(namespace, name string, src io.Reader) (err error) {
+					uploaded, err = io.ReadAll(src)
+					return err
+				})
+
+			require.NoError(client.Upload("ns", "blob", bytes.NewReader(data)))
+			require.Equal(string(data), string(uploaded))
+		})
+	}
+}
+
+func TestClientList(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new(t, Config{})
+	defer client.Close()
+
+	options := backend.DefaultListOptions()
+	mocks.backend.EXPECT().List("prefix", gomock.Any()).DoAndReturn(
+		func(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+			for _, opt := range opts {
+				opt(options)
+			}
+			return &backend.ListResult{Names: []string{"a", "b"}, ContinuationToken: "next"}, nil
+		})
+
+	result, err := client.List(
+		"prefix",
+		backend.ListWithPagination(),
+		backend.ListWithMaxKeys(2),
+		backend.ListWithContinuationToken("token"))
+	require.NoError(err)
+	require.Equal([]string{"a", "b"}, result.Names)
+	require.Equal("next", result.ContinuationToken)
+	require.Equal(&backend.ListOptions{
+		Paginated:         true,
+		MaxKeys:           2,
+		ContinuationToken: "token",
+	}, options)
+}
+
+func TestClientLaunch(t *testing.T) {
+	require := require.New(t)
+
+	client, err := NewClient(Config{
+		Command: os.Args[0],
+		Env:     map[string]string{_helperPluginEnv: "1"},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	_, err = client.Stat("ns", "blob")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+	require.NoError(client.Upload("ns", "blob", bytes.NewReader(randutil.Text(32))))
+
+	require.NoError(client.Close())
+	require.NoError(client.Close())
+}
+
+func TestServeRequiresMagicCookie(t *testing.T) {
+	require.Error(t, Serve(backend.NoopClient{}))
+}
+
+func TestParseHandshake(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		valid    bool
+	}{
+		{"1|unix|/tmp/plugin.sock\n", "unix:///tmp/plugin.sock", true},
+		{"1|tcp|127.0.0.1:9000\n", "127.0.0.1:9000", true},
+		{"2|unix|/tmp/plugin.sock\n", "", false},
+		{"1|udp|127.0.0.1:9000\n", "", false},
+		{"garbage\n", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			target, err := parseHandshake(test.line)
+			if test.valid {
+				require.NoError(t, err)
+				require.Equal(t, test.expected, target)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
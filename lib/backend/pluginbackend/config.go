@@ -0,0 +1,55 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pluginbackend
+
+import (
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// Config defines how to reach a backend plugin. Exactly one of Address and
+// Command must be set.
+type Config struct {
+	// Address dials an already running plugin, e.g. "unix:///run/plugin.sock"
+	// or "localhost:9000".
+	Address string `yaml:"address"`
+
+	// Command launches the plugin binary, which must complete the handshake
+	// performed by Serve. The plugin is killed when the client is closed.
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+
+	// StartTimeout bounds launching the plugin and connecting to it.
+	StartTimeout time.Duration `yaml:"start_timeout"`
+
+	// Timeout bounds Stat and List calls. Downloads and uploads are not bounded.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// ChunkSize is the size of upload messages sent to the plugin.
+	ChunkSize datasize.ByteSize `yaml:"chunk_size"`
+}
+
+func (c *Config) applyDefaults() {
+	if c.StartTimeout == 0 {
+		c.StartTimeout = 10 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 60 * time.Second
+	}
+	if c.ChunkSize == 0 {
+		c.ChunkSize = 1 * datasize.MB
+	}
+}
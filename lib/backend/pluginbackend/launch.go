@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pluginbackend
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Launched plugins are handed _magicCookieKey=_magicCookieValue in their
+// environment, which Serve checks to guard against running plugins by hand.
+// Once listening, a plugin writes a single "<version>|<network>|<address>"
+// handshake line to stdout.
+const (
+	_magicCookieKey   = "KRAKEN_BACKEND_PLUGIN"
+	_magicCookieValue = "d7c5b43b8a2f4e1e9f6c0b3a5e8d2f71"
+	_protocolVersion  = "1"
+)
+
+// parseHandshake parses the handshake line written by a plugin into a gRPC
+// dial target.
+func parseHandshake(line string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed handshake %q", line)
+	}
+	if parts[0] != _protocolVersion {
+		return "", fmt.Errorf("unsupported protocol version %s", parts[0])
+	}
+	switch parts[1] {
+	case "unix":
+		return "unix://" + parts[2], nil
+	case "tcp":
+		return parts[2], nil
+	default:
+		return "", fmt.Errorf("unsupported network %s", parts[1])
+	}
+}
+
+func formatHandshake(network, addr string) string {
+	return fmt.Sprintf("%s|%s|%s\n", _protocolVersion, network, addr)
+}
+
+// launch starts the plugin described by config and returns the process along
+// with the dial target from its handshake.
+func launch(config Config) (*exec.Cmd, string, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = append(os.Environ(), _magicCookieKey+"="+_magicCookieValue)
+	for k, v := range config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, "", fmt.Errorf("stdout pipe: %s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("start: %s", err)
+	}
+
+	type result struct {
+		line string
+		err  error
+	}
+	handshake := make(chan result, 1)
+	go func() {
+		r := bufio.NewReader(stdout)
+		line, err := r.ReadString('\n')
+		handshake <- result{line, err}
+		// Keep draining so the plugin never blocks writing to stdout.
+		io.Copy(io.Discard, r) //nolint:errcheck
+	}()
+
+	var target string
+	select {
+	case res := <-handshake:
+		if res.err != nil {
+			err = fmt.Errorf("read handshake: %s", res.err)
+		} else {
+			target, err = parseHandshake(res.line)
+		}
+	case <-time.After(config.StartTimeout):
+		err = errors.New("timed out waiting for handshake")
+	}
+	if err != nil {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+		return nil, "", err
+	}
+	return cmd, target, nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pluginbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	pb "github.com/uber/kraken/gen/go/proto/backendplugin"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// _downloadChunkSize is the size of download messages sent by the server.
+const _downloadChunkSize = 1 << 20
+
+// server adapts a backend.Client to the Backend gRPC service.
+type server struct {
+	pb.UnimplementedBackendServer
+
+	client backend.Client
+}
+
+// NewServer returns a gRPC Backend service which serves client. Plugins which
+// manage their own listener register it on their gRPC server.
+func NewServer(client backend.Client) pb.BackendServer {
+	return &server{client: client}
+}
+
+// Serve serves client as a plugin launched by Kraken. It listens on a unix
+// socket, completes the handshake over stdout, and blocks until the process
+// is killed.
+func Serve(client backend.Client) error {
+	if os.Getenv(_magicCookieKey) != _magicCookieValue {
+		return errors.New("this binary is a kraken backend plugin and must be launched by kraken")
+	}
+	dir, err := os.MkdirTemp("", "kraken-plugin")
+	if err != nil {
+		return fmt.Errorf("create socket dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "plugin.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		return fmt.Errorf("listen: %s", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterBackendServer(s, NewServer(client))
+
+	if _, err := os.Stdout.WriteString(formatHandshake("unix", sock)); err != nil {
+		return fmt.Errorf("write handshake: %s", err)
+	}
+	return s.Serve(l)
+}
+
+// toStatus converts backend errors into gRPC statuses.
+func toStatus(err error) error {
+	if err == backenderrors.ErrBlobNotFound {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func (s *server) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatResponse, error) {
+	info, err := s.client.Stat(req.Namespace, req.Name)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.StatResponse{Size: info.Size}, nil
+}
+
+// chunkWriter writes data to a Download stream.
+type chunkWriter struct {
+	stream pb.Backend_DownloadServer
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		end := n + _downloadChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := w.stream.Send(&pb.Chunk{Data: p[n:end]}); err != nil {
+			return n, err
+		}
+		n = end
+	}
+	return len(p), nil
+}
+
+func (s *server) Download(req *pb.DownloadRequest, stream pb.Backend_DownloadServer) error {
+	if err := s.client.Download(req.Namespace, req.Name, chunkWriter{stream}); err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
+
+// chunkReader reads data from an Upload stream.
+type chunkReader struct {
+	stream pb.Backend_UploadServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = req.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (s *server) Upload(stream pb.Backend_UploadServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Name == "" {
+		return status.Error(codes.InvalidArgument, "first upload message must set name")
+	}
+	src := &chunkReader{stream: stream, buf: first.Data}
+	if err := s.client.Upload(first.Namespace, first.Name, src); err != nil {
+		return toStatus(err)
+	}
+	// Drain any data the client did not read.
+	if _, err := io.Copy(io.Discard, src); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&pb.UploadResponse{})
+}
+
+func (s *server) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	opts := []backend.ListOption{
+		backend.ListWithMaxKeys(int(req.MaxKeys)),
+		backend.ListWithContinuationToken(req.ContinuationToken),
+	}
+	if req.Paginated {
+		opts = append(opts, backend.ListWithPagination())
+	}
+	result, err := s.client.List(req.Prefix, opts...)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if result == nil {
+		return &pb.ListResponse{}, nil
+	}
+	return &pb.ListResponse{
+		Names:             result.Names,
+		ContinuationToken: result.ContinuationToken,
+	}, nil
+}
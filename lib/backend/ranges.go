@@ -0,0 +1,129 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errRangeComplete aborts a download once a rangeWriter has all of its range.
+var errRangeComplete = errors.New("range complete")
+
+// ErrShortRange is returned by DownloadRange when the blob ends before the end
+// of the requested range.
+var ErrShortRange = errors.New("range extends past end of blob")
+
+// CheckRangeLength returns an error wrapping ErrShortRange if only n bytes of
+// a range of length bytes were downloaded.
+func CheckRangeLength(length, n int64) error {
+	if n < length {
+		return fmt.Errorf("%w: got %d of %d bytes", ErrShortRange, n, length)
+	}
+	return nil
+}
+
+// ValidateRange returns an error if offset and length do not describe a
+// non-empty byte range.
+func ValidateRange(offset, length int64) error {
+	if offset < 0 {
+		return fmt.Errorf("invalid range: negative offset %d", offset)
+	}
+	if length <= 0 {
+		return fmt.Errorf("invalid range: non-positive length %d", length)
+	}
+	return nil
+}
+
+// RangeHeader returns the value of an HTTP Range header for offset and length.
+func RangeHeader(offset, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// rangeWriter forwards the bytes in [offset, offset+length) of the stream
+// written to it into dst, and discards the rest.
+type rangeWriter struct {
+	dst       io.Writer
+	skip      int64
+	remaining int64
+}
+
+func newRangeWriter(dst io.Writer, offset, length int64) *rangeWriter {
+	return &rangeWriter{dst, offset, length}
+}
+
+func (w *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if w.remaining == 0 {
+		return 0, errRangeComplete
+	}
+	if w.skip > 0 {
+		if int64(len(p)) <= w.skip {
+			w.skip -= int64(len(p))
+			return n, nil
+		}
+		p = p[w.skip:]
+		w.skip = 0
+	}
+	if int64(len(p)) > w.remaining {
+		p = p[:w.remaining]
+	}
+	written, err := w.dst.Write(p)
+	w.remaining -= int64(written)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// FallbackDownloadRange implements Client.DownloadRange for clients which can
+// only download whole blobs. Bytes before offset are read and discarded, and
+// the download is aborted once the range has been written to dst.
+func FallbackDownloadRange(
+	c Client, namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := ValidateRange(offset, length); err != nil {
+		return err
+	}
+	w := newRangeWriter(dst, offset, length)
+	err := c.Download(namespace, name, w)
+	if w.remaining == 0 {
+		// Clients wrap writer errors, so a download aborted by errRangeComplete
+		// is detected by the range having been written in full.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return CheckRangeLength(length, length-w.remaining)
+}
+
+// CopyRange copies the bytes in [offset, offset+length) of src into dst. It is
+// useful for sources which ignore range requests, e.g. HTTP servers replying
+// 200 with the whole blob to a Range request. Returns ErrShortRange if src
+// ends before the end of the range.
+func CopyRange(dst io.Writer, src io.Reader, offset, length int64) error {
+	if _, err := io.CopyN(io.Discard, src, offset); err != nil {
+		if err == io.EOF {
+			return CheckRangeLength(length, 0)
+		}
+		return err
+	}
+	n, err := io.CopyN(dst, src, length)
+	if err == io.EOF {
+		return CheckRangeLength(length, n)
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	. "github.com/uber/kraken/lib/backend"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// writeChunks writes data into dst in chunks of size n, wrapping write errors
+// like backends do.
+func writeChunks(data []byte, n int) func(string, string, io.Writer) error {
+	return func(namespace, name string, dst io.Writer) error {
+		for len(data) > 0 {
+			k := n
+			if k > len(data) {
+				k = len(data)
+			}
+			if _, err := dst.Write(data[:k]); err != nil {
+				return fmt.Errorf("copy: %s", err)
+			}
+			data = data[k:]
+		}
+		return nil
+	}
+}
+
+func TestFallbackDownloadRange(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+
+	tests := []struct {
+		desc     string
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{"prefix", 0, 4, "0123"},
+		{"middle", 5, 7, "56789ab"},
+		{"suffix", 16, 4, "ghij"},
+	}
+	for _, test := range tests {
+		for _, chunk := range []int{1, 3, 64} {
+			t.Run(fmt.Sprintf("%s chunk %d", test.desc, chunk), func(t *testing.T) {
+				require := require.New(t)
+
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				client := mockbackend.NewMockClient(ctrl)
+				client.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(writeChunks(data, chunk))
+
+				var b bytes.Buffer
+				require.NoError(FallbackDownloadRange(client, "ns", "name", test.offset, test.length, &b))
+				require.Equal(test.expected, b.String())
+			})
+		}
+	}
+}
+
+func TestFallbackDownloadRangeShortRange(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+
+	tests := []struct {
+		desc   string
+		offset int64
+		length int64
+	}{
+		{"past end", 18, 10},
+		{"offset past end", 30, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := mockbackend.NewMockClient(ctrl)
+			client.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(writeChunks(data, 3))
+
+			err := FallbackDownloadRange(client, "ns", "name", test.offset, test.length, &bytes.Buffer{})
+			require.True(errors.Is(err, ErrShortRange))
+		})
+	}
+}
+
+func TestFallbackDownloadRangeInvalidRange(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := mockbackend.NewMockClient(ctrl)
+
+	require.Error(FallbackDownloadRange(client, "ns", "name", -1, 4, &bytes.Buffer{}))
+	require.Error(FallbackDownloadRange(client, "ns", "name", 0, 0, &bytes.Buffer{}))
+}
+
+func TestCopyRange(t *testing.T) {
+	require := require.New(t)
+
+	var b bytes.Buffer
+	require.NoError(CopyRange(&b, bytes.NewReader([]byte("0123456789")), 2, 3))
+	require.Equal("234", b.String())
+
+	b.Reset()
+	err := CopyRange(&b, bytes.NewReader([]byte("0123456789")), 8, 3)
+	require.True(errors.Is(err, ErrShortRange))
+
+	err = CopyRange(&b, bytes.NewReader([]byte("0123456789")), 20, 3)
+	require.True(errors.Is(err, ErrShortRange))
+}
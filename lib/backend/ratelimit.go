@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"io"
+
+	"github.com/uber/kraken/core"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitedClient limits the rate of operations on the wrapped Client.
+type rateLimitedClient struct {
+	Client
+	limiter *rate.Limiter
+}
+
+// WithRateLimit returns a Middleware which limits operations to config.QPS.
+func WithRateLimit(config RateLimitConfig) Middleware {
+	config.applyDefaults()
+	return func(c Client) Client {
+		return &rateLimitedClient{c, rate.NewLimiter(rate.Limit(config.QPS), config.Burst)}
+	}
+}
+
+func (c *rateLimitedClient) wait() error {
+	return c.limiter.Wait(context.Background())
+}
+
+func (c *rateLimitedClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	return c.Client.Stat(namespace, name)
+}
+
+func (c *rateLimitedClient) Upload(namespace, name string, src io.Reader) error {
+	if err := c.wait(); err != nil {
+		return err
+	}
+	return c.Client.Upload(namespace, name, src)
+}
+
+func (c *rateLimitedClient) UploadStream(namespace, name string, src io.Reader) error {
+	if err := c.wait(); err != nil {
+		return err
+	}
+	return c.Client.UploadStream(namespace, name, src)
+}
+
+func (c *rateLimitedClient) Download(namespace, name string, dst io.Writer) error {
+	if err := c.wait(); err != nil {
+		return err
+	}
+	return c.Client.Download(namespace, name, dst)
+}
+
+func (c *rateLimitedClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := c.wait(); err != nil {
+		return err
+	}
+	return c.Client.DownloadRange(namespace, name, offset, length, dst)
+}
+
+func (c *rateLimitedClient) Delete(namespace, name string) error {
+	if err := c.wait(); err != nil {
+		return err
+	}
+	return c.Client.Delete(namespace, name)
+}
+
+func (c *rateLimitedClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	return c.Client.List(prefix, opts...)
+}
@@ -111,6 +111,27 @@ func (c *BlobClient) Download(namespace, name string, dst io.Writer) error {
 	return err
 }
 
+// DownloadRange downloads length bytes of name starting at offset from
+// registry using an HTTP Range request.
+func (c *BlobClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
+	opts, err := c.authenticator.Authenticate(namespace)
+	if err != nil {
+		return fmt.Errorf("get security opt: %s", err)
+	}
+
+	err = c.downloadRangeHelper(namespace, name, _layerquery, offset, length, dst, opts)
+	if err != nil && err == backenderrors.ErrBlobNotFound {
+		// Docker registry does not support querying manifests with blob path.
+		err = c.downloadRangeHelper(namespace, name, _manifestquery, offset, length, dst, opts)
+	}
+	return err
+}
+
 func (c *BlobClient) statHelper(namespace, name, query string, opts []httputil.SendOption) (*core.BlobInfo, error) {
 	URL := fmt.Sprintf(query, c.config.Address, namespace, name)
 	resp, err := httputil.Head(
@@ -155,11 +176,53 @@ func (c *BlobClient) downloadHelper(namespace, name, query string, dst io.Writer
 	return nil
 }
 
+func (c *BlobClient) downloadRangeHelper(
+	namespace, name, query string, offset, length int64, dst io.Writer, opts []httputil.SendOption) error {
+
+	URL := fmt.Sprintf(query, c.config.Address, namespace, name)
+	resp, err := httputil.Get(
+		URL,
+		append(
+			opts,
+			httputil.SendHeaders(map[string]string{"Range": backend.RangeHeader(offset, length)}),
+			httputil.SendAcceptedCodes(http.StatusOK, http.StatusPartialContent),
+			httputil.SendTimeout(c.config.Timeout),
+		)...,
+	)
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return fmt.Errorf("get blob: %s", err)
+	}
+	defer closers.Close(resp.Body)
+
+	// Registries may ignore the Range header, e.g. for manifests, and reply
+	// with the whole blob.
+	if resp.StatusCode == http.StatusPartialContent {
+		offset = 0
+	}
+	if err := backend.CopyRange(dst, resp.Body, offset, length); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	return nil
+}
+
 // Upload is not supported as users can push directly to registry.
 func (c *BlobClient) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// UploadStream is not supported as users can push directly to registry.
+func (c *BlobClient) UploadStream(namespace, name string, src io.Reader) error {
+	return errors.New("not supported")
+}
+
+// Delete is not supported as users can delete directly from registry.
+func (c *BlobClient) Delete(namespace, name string) error {
+	return errors.New("not supported")
+}
+
 // List is not supported for blobs.
 func (c *BlobClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
@@ -17,6 +17,8 @@ import (
 	"time"
 
 	"github.com/uber/kraken/lib/backend/registrybackend/security"
+
+	"github.com/c2h5oh/datasize"
 )
 
 // Config defines the registry address, timeout and security options.
@@ -24,6 +26,10 @@ type Config struct {
 	Address  string          `yaml:"address"`
 	Timeout  time.Duration   `yaml:"timeout"`
 	Security security.Config `yaml:"security"`
+
+	// ChunkSize is the size of chunks blobs are uploaded in by oci_blob. Blobs
+	// are uploaded monolithically if zero.
+	ChunkSize datasize.ByteSize `yaml:"chunk_size"`
 }
 
 // Set default configuration
@@ -0,0 +1,206 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registrybackend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
+	"go.uber.org/zap"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const _ociblob = "oci_blob"
+
+func init() {
+	backend.Register(_ociblob, &ociBlobClientFactory{})
+}
+
+type ociBlobClientFactory struct{}
+
+func (f *ociBlobClientFactory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal oci blob config")
+	}
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal oci blob config")
+	}
+	return NewOCIBlobClient(config, stats)
+}
+
+const _uploadquery = "http://%s/v2/%s/blobs/uploads/"
+
+// OCIBlobClient stats, downloads and uploads blobs to a registry which speaks
+// the OCI Distribution API, allowing the registry to be used as the storage of
+// record for blobs. Namespaces are mapped to registry repositories.
+type OCIBlobClient struct {
+	*BlobClient
+}
+
+// NewOCIBlobClient creates a new OCIBlobClient.
+func NewOCIBlobClient(config Config, stats tally.Scope) (*OCIBlobClient, error) {
+	c, err := NewBlobClient(config, stats)
+	if err != nil {
+		return nil, err
+	}
+	return &OCIBlobClient{c}, nil
+}
+
+// Upload pushes src as blob name to the namespace repository. Blobs which the
+// registry already has are skipped. If ChunkSize is set, the blob is uploaded
+// in chunks, else in a single request.
+func (c *OCIBlobClient) Upload(namespace, name string, src io.Reader) error {
+	d, err := core.NewSHA256DigestFromHex(name)
+	if err != nil {
+		return fmt.Errorf("invalid digest: %s", err)
+	}
+
+	opts, err := c.authenticator.Authenticate(namespace)
+	if err != nil {
+		return fmt.Errorf("get security opt: %s", err)
+	}
+
+	if _, err := c.statHelper(namespace, name, _layerquery, opts); err == nil {
+		return nil
+	} else if err != backenderrors.ErrBlobNotFound {
+		return err
+	}
+
+	location, err := c.startUpload(namespace, opts)
+	if err != nil {
+		return err
+	}
+	if c.config.ChunkSize > 0 {
+		if location, err = c.uploadChunks(location, src, opts); err != nil {
+			return err
+		}
+		src = nil
+	}
+	return c.finishUpload(location, d, src, opts)
+}
+
+// startUpload starts an upload session and returns its location.
+func (c *OCIBlobClient) startUpload(namespace string, opts []httputil.SendOption) (*url.URL, error) {
+	URL := fmt.Sprintf(_uploadquery, c.config.Address, namespace)
+	resp, err := httputil.Post(
+		URL,
+		append(
+			opts,
+			httputil.SendAcceptedCodes(http.StatusAccepted),
+			httputil.SendTimeout(c.config.Timeout),
+		)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("start upload: %s", err)
+	}
+	defer closers.Close(resp.Body)
+
+	return uploadLocation(URL, resp)
+}
+
+// uploadChunks uploads src in chunks of ChunkSize to location, and returns the
+// location of the next request of the upload session.
+func (c *OCIBlobClient) uploadChunks(
+	location *url.URL, src io.Reader, opts []httputil.SendOption) (*url.URL, error) {
+
+	buf := make([]byte, c.config.ChunkSize.Bytes())
+	var offset int64
+	for {
+		n, err := io.ReadFull(src, buf)
+		if err == io.EOF {
+			return location, nil
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("read chunk: %s", err)
+		}
+		resp, err := httputil.Patch(
+			location.String(),
+			append(
+				opts,
+				httputil.SendBody(bytes.NewReader(buf[:n])),
+				httputil.SendHeaders(map[string]string{
+					"Content-Type":  "application/octet-stream",
+					"Content-Range": fmt.Sprintf("%d-%d", offset, offset+int64(n)-1),
+				}),
+				httputil.SendAcceptedCodes(http.StatusAccepted),
+				httputil.SendTimeout(c.config.Timeout),
+			)...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("upload chunk at offset %d: %s", offset, err)
+		}
+		closers.Close(resp.Body)
+		if location, err = uploadLocation(location.String(), resp); err != nil {
+			return nil, err
+		}
+		offset += int64(n)
+	}
+}
+
+// finishUpload completes the upload session at location with the remaining
+// content in src, which may be nil.
+func (c *OCIBlobClient) finishUpload(
+	location *url.URL, d core.Digest, src io.Reader, opts []httputil.SendOption) error {
+
+	q := location.Query()
+	q.Set("digest", d.String())
+	location.RawQuery = q.Encode()
+
+	opts = append(
+		opts,
+		httputil.SendHeaders(map[string]string{"Content-Type": "application/octet-stream"}),
+		httputil.SendAcceptedCodes(http.StatusCreated),
+		httputil.SendTimeout(c.config.Timeout),
+	)
+	if src != nil {
+		opts = append(opts, httputil.SendBody(src))
+	}
+	resp, err := httputil.Put(location.String(), opts...)
+	if err != nil {
+		return fmt.Errorf("finish upload: %s", err)
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+// uploadLocation resolves the Location header of an upload session response,
+// which may be relative, against the URL of the request.
+func uploadLocation(requestURL string, resp *http.Response) (*url.URL, error) {
+	header := resp.Header.Get("Location")
+	if header == "" {
+		return nil, errors.New("upload response missing location")
+	}
+	base, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse request url: %s", err)
+	}
+	loc, err := url.Parse(header)
+	if err != nil {
+		return nil, fmt.Errorf("parse location: %s", err)
+	}
+	return base.ResolveReference(loc), nil
+}
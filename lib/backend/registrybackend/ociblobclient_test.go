@@ -0,0 +1,196 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registrybackend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/testutil"
+	"go.uber.org/zap"
+)
+
+// testRegistry is a minimal in-memory registry implementing the blob upload
+// endpoints of the OCI Distribution API.
+type testRegistry struct {
+	sync.Mutex
+	namespace string
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	nextID    int
+	patches   int
+}
+
+func newTestRegistry(namespace string) *testRegistry {
+	return &testRegistry{
+		namespace: namespace,
+		blobs:     make(map[string][]byte),
+		uploads:   make(map[string][]byte),
+	}
+}
+
+func (r *testRegistry) handler() http.Handler {
+	router := chi.NewRouter()
+	prefix := fmt.Sprintf("/v2/%s", r.namespace)
+	router.Head(prefix+"/blobs/{digest}", func(w http.ResponseWriter, req *http.Request) {
+		r.Lock()
+		defer r.Unlock()
+		b, ok := r.blobs[chi.URLParam(req, "digest")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
+	})
+	router.Get(prefix+"/blobs/{digest}", func(w http.ResponseWriter, req *http.Request) {
+		r.Lock()
+		defer r.Unlock()
+		b, ok := r.blobs[chi.URLParam(req, "digest")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	})
+	router.Post(prefix+"/blobs/uploads/", func(w http.ResponseWriter, req *http.Request) {
+		r.Lock()
+		defer r.Unlock()
+		r.nextID++
+		id := fmt.Sprintf("%d", r.nextID)
+		r.uploads[id] = nil
+		w.Header().Set("Location", fmt.Sprintf("%s/blobs/uploads/%s?_state=0", prefix, id))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	router.Patch(prefix+"/blobs/uploads/{id}", func(w http.ResponseWriter, req *http.Request) {
+		r.Lock()
+		defer r.Unlock()
+		id := chi.URLParam(req, "id")
+		b, _ := io.ReadAll(req.Body)
+		expected := fmt.Sprintf("%d-%d", len(r.uploads[id]), len(r.uploads[id])+len(b)-1)
+		if req.Header.Get("Content-Range") != expected {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		r.uploads[id] = append(r.uploads[id], b...)
+		r.patches++
+		w.Header().Set("Location", fmt.Sprintf("%s/blobs/uploads/%s?_state=%d", prefix, id, r.patches))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	router.Put(prefix+"/blobs/uploads/{id}", func(w http.ResponseWriter, req *http.Request) {
+		r.Lock()
+		defer r.Unlock()
+		id := chi.URLParam(req, "id")
+		b, _ := io.ReadAll(req.Body)
+		content := append(r.uploads[id], b...)
+		d, err := core.NewDigester().FromBytes(content)
+		if err != nil || d.String() != req.URL.Query().Get("digest") || req.URL.Query().Get("_state") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(r.uploads, id)
+		r.blobs[d.String()] = content
+		w.WriteHeader(http.StatusCreated)
+	})
+	return router
+}
+
+func TestOCIBlobClientFactory(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{}
+	f := ociBlobClientFactory{}
+	_, err := f.Create(config, nil, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+}
+
+func TestOCIBlobUpload(t *testing.T) {
+	tests := []struct {
+		desc      string
+		chunkSize uint64
+		patches   int
+	}{
+		{"monolithic", 0, 0},
+		{"chunked", 10, 4},
+		{"single chunk", 64, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			namespace := core.NamespaceFixture()
+			registry := newTestRegistry(namespace)
+			addr, stop := testutil.StartServer(registry.handler())
+			defer stop()
+
+			config := newTestConfig(addr)
+			config.ChunkSize = datasize.ByteSize(test.chunkSize)
+			client, err := NewOCIBlobClient(config, tally.NoopScope)
+			require.NoError(err)
+			defer closers.Close(client)
+
+			blob := core.SizedBlobFixture(35, 8)
+			require.NoError(client.Upload(namespace, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+			require.Equal(test.patches, registry.patches)
+			require.Empty(registry.uploads)
+
+			info, err := client.Stat(namespace, blob.Digest.Hex())
+			require.NoError(err)
+			require.Equal(blob.Length(), info.Size)
+
+			var b bytes.Buffer
+			require.NoError(client.Download(namespace, blob.Digest.Hex(), &b))
+			require.Equal(blob.Content, b.Bytes())
+		})
+	}
+}
+
+func TestOCIBlobUploadSkipsExistingBlob(t *testing.T) {
+	require := require.New(t)
+
+	namespace := core.NamespaceFixture()
+	registry := newTestRegistry(namespace)
+	addr, stop := testutil.StartServer(registry.handler())
+	defer stop()
+
+	client, err := NewOCIBlobClient(newTestConfig(addr), tally.NoopScope)
+	require.NoError(err)
+	defer closers.Close(client)
+
+	blob := core.NewBlobFixture()
+	registry.blobs[blob.Digest.String()] = blob.Content
+
+	require.NoError(client.Upload(namespace, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	require.Equal(0, registry.nextID)
+}
+
+func TestOCIBlobUploadInvalidName(t *testing.T) {
+	require := require.New(t)
+
+	client, err := NewOCIBlobClient(newTestConfig("localhost:0"), tally.NoopScope)
+	require.NoError(err)
+	defer closers.Close(client)
+
+	require.Error(client.Upload(core.NamespaceFixture(), "foo", strings.NewReader("bar")))
+}
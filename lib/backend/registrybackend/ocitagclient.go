@@ -0,0 +1,152 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registrybackend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/httputil"
+	"go.uber.org/zap"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const _ocitag = "oci_tag"
+
+func init() {
+	backend.Register(_ocitag, &ociTagClientFactory{})
+}
+
+type ociTagClientFactory struct{}
+
+func (f *ociTagClientFactory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal oci tag config")
+	}
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal oci tag config")
+	}
+	return NewOCITagClient(config, stats)
+}
+
+// OCITagClient stats, downloads and uploads tags to a registry which speaks
+// the OCI Distribution API. Tags resolve to the digest of their manifest.
+type OCITagClient struct {
+	*TagClient
+}
+
+// NewOCITagClient creates a new OCITagClient.
+func NewOCITagClient(config Config, stats tally.Scope) (*OCITagClient, error) {
+	c, err := NewTagClient(config, stats)
+	if err != nil {
+		return nil, err
+	}
+	return &OCITagClient{c}, nil
+}
+
+// Upload tags the manifest whose digest is read from src as name, which must
+// be repo:tag. The manifest must already be pushed to the repo, either as a
+// manifest or as a blob.
+func (c *OCITagClient) Upload(namespace, name string, src io.Reader) error {
+	tokens := strings.Split(name, ":")
+	if len(tokens) != 2 {
+		return fmt.Errorf("invalid name %s: must be repo:tag", name)
+	}
+	repo, tag := tokens[0], tokens[1]
+
+	b, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("read digest: %s", err)
+	}
+	d, err := core.ParseSHA256Digest(string(b))
+	if err != nil {
+		return fmt.Errorf("parse digest: %s", err)
+	}
+
+	opts, err := c.authenticator.Authenticate(repo)
+	if err != nil {
+		return fmt.Errorf("get security opt: %s", err)
+	}
+
+	manifest, err := c.getManifest(repo, d, opts)
+	if err != nil {
+		return err
+	}
+	m, _, err := dockerutil.ParseManifest(bytes.NewReader(manifest))
+	if err != nil {
+		return fmt.Errorf("parse manifest: %s", err)
+	}
+	mediaType, _, err := m.Payload()
+	if err != nil {
+		return fmt.Errorf("manifest payload: %s", err)
+	}
+
+	resp, err := httputil.Put(
+		fmt.Sprintf(_tagquery, c.config.Address, repo, tag),
+		append(
+			opts,
+			httputil.SendBody(bytes.NewReader(manifest)),
+			httputil.SendHeaders(map[string]string{"Content-Type": mediaType}),
+			httputil.SendAcceptedCodes(http.StatusCreated),
+		)...,
+	)
+	if err != nil {
+		return fmt.Errorf("put manifest: %s", err)
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+// getManifest returns the raw manifest d from repo. Manifests uploaded through
+// OCIBlobClient are stored as blobs, so blobs are checked as a fallback.
+func (c *OCITagClient) getManifest(repo string, d core.Digest, opts []httputil.SendOption) ([]byte, error) {
+	for _, query := range []string{_manifestquery, _layerquery} {
+		resp, err := httputil.Get(
+			fmt.Sprintf(query, c.config.Address, repo, d.Hex()),
+			append(
+				opts,
+				httputil.SendHeaders(map[string]string{"Accept": dockerutil.GetSupportedManifestTypes()}),
+				httputil.SendAcceptedCodes(http.StatusOK),
+				httputil.SendTimeout(c.config.Timeout),
+			)...,
+		)
+		if err != nil {
+			if httputil.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("get manifest: %s", err)
+		}
+		defer closers.Close(resp.Body)
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read manifest: %s", err)
+		}
+		return b, nil
+	}
+	return nil, backenderrors.ErrBlobNotFound
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registrybackend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func TestOCITagUploadManifestStoredAsBlob(t *testing.T) {
+	require := require.New(t)
+
+	digest, manifest := dockerutil.ManifestFixture(
+		core.DigestFixture(), core.DigestFixture(), core.DigestFixture())
+
+	tag := core.TagFixture()
+	namespace := strings.Split(tag, ":")[0]
+
+	var putTag, putType string
+	var putBody []byte
+
+	r := chi.NewRouter()
+	r.Get(fmt.Sprintf("/v2/%s/manifests/{ref}", namespace), func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Get(fmt.Sprintf("/v2/%s/blobs/{digest}", namespace), func(w http.ResponseWriter, req *http.Request) {
+		if chi.URLParam(req, "digest") != digest.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(manifest)
+	})
+	r.Put(fmt.Sprintf("/v2/%s/manifests/{ref}", namespace), func(w http.ResponseWriter, req *http.Request) {
+		putTag = chi.URLParam(req, "ref")
+		putType = req.Header.Get("Content-Type")
+		putBody, _ = io.ReadAll(req.Body)
+		w.WriteHeader(http.StatusCreated)
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	client, err := NewOCITagClient(newTestConfig(addr), tally.NoopScope)
+	require.NoError(err)
+	defer closers.Close(client)
+
+	require.NoError(client.Upload(tag, tag, strings.NewReader(digest.String())))
+	require.Equal(strings.Split(tag, ":")[1], putTag)
+	require.Equal("application/vnd.docker.distribution.manifest.v2+json", putType)
+	require.Equal(manifest, putBody)
+}
+
+func TestOCITagUploadManifestNotFound(t *testing.T) {
+	require := require.New(t)
+
+	tag := core.TagFixture()
+	namespace := strings.Split(tag, ":")[0]
+
+	r := chi.NewRouter()
+	r.Get(fmt.Sprintf("/v2/%s/manifests/{ref}", namespace), func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Get(fmt.Sprintf("/v2/%s/blobs/{digest}", namespace), func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	client, err := NewOCITagClient(newTestConfig(addr), tally.NoopScope)
+	require.NoError(err)
+	defer closers.Close(client)
+
+	err = client.Upload(tag, tag, bytes.NewReader([]byte(core.DigestFixture().String())))
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+}
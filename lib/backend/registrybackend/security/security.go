@@ -49,6 +49,10 @@ type Config struct {
 	BasicAuth              *types.AuthConfig  `yaml:"basic"`
 	RemoteCredentialsStore string             `yaml:"credsStore"`
 	EnableHTTPFallback     bool               `yaml:"enableHTTPFallback"`
+
+	// Anonymous requests anonymous bearer tokens from registries which
+	// require them even for public repositories, e.g. Docker Hub.
+	Anonymous bool `yaml:"anonymous"`
 }
 
 // Authenticator creates send options to authenticate requests to registry
@@ -123,7 +127,7 @@ func (a *authenticator) Authenticate(repo string) ([]httputil.SendOption, error)
 }
 
 func (a *authenticator) shouldAuth() bool {
-	return a.config.BasicAuth != nil || a.config.RemoteCredentialsStore != ""
+	return a.config.BasicAuth != nil || a.config.RemoteCredentialsStore != "" || a.config.Anonymous
 }
 
 func (a *authenticator) transport(repo string) (http.RoundTripper, error) {
@@ -155,11 +155,30 @@ func (c *TagClient) Download(namespace, name string, dst io.Writer) error {
 	return nil
 }
 
+// DownloadRange downloads a range of the manifest digest of tag name. The
+// digest is computed from the whole manifest, so it is resolved in full and
+// then sliced.
+func (c *TagClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return backend.FallbackDownloadRange(c, namespace, name, offset, length, dst)
+}
+
 // Upload is not supported as users can push directly to registry.
 func (c *TagClient) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// UploadStream is not supported as users can push directly to registry.
+func (c *TagClient) UploadStream(namespace, name string, src io.Reader) error {
+	return errors.New("not supported")
+}
+
+// Delete is not supported as users can delete directly from registry.
+func (c *TagClient) Delete(namespace, name string) error {
+	return errors.New("not supported")
+}
+
 // List is not supported as users can list directly from registry.
 func (c *TagClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
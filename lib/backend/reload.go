@@ -0,0 +1,128 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"io"
+	"sync"
+
+	"github.com/uber/kraken/core"
+)
+
+// reloadableClient forwards operations to a client which is replaced when
+// credentials are reloaded. Middlewares wrap the reloadableClient rather than
+// the replaced clients, so their state survives reloads. Replaced clients are
+// closed once the operations they are serving have finished.
+type reloadableClient struct {
+	mu      sync.Mutex
+	current *refCountedClient
+}
+
+type refCountedClient struct {
+	Client
+	refs    int
+	retired bool
+}
+
+func newReloadableClient(c Client) *reloadableClient {
+	return &reloadableClient{current: &refCountedClient{Client: c}}
+}
+
+func (c *reloadableClient) acquire() *refCountedClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current.refs++
+	return c.current
+}
+
+func (c *reloadableClient) release(rc *refCountedClient) {
+	c.mu.Lock()
+	rc.refs--
+	idle := rc.retired && rc.refs == 0
+	c.mu.Unlock()
+	if idle {
+		closeClient(rc.Client)
+	}
+}
+
+// swap replaces the current client with next. The replaced client is closed
+// immediately if idle, else by the last operation using it.
+func (c *reloadableClient) swap(next Client) {
+	c.mu.Lock()
+	prev := c.current
+	c.current = &refCountedClient{Client: next}
+	prev.retired = true
+	idle := prev.refs == 0
+	c.mu.Unlock()
+	if idle {
+		closeClient(prev.Client)
+	}
+}
+
+// client returns the current client.
+func (c *reloadableClient) client() Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current.Client
+}
+
+func (c *reloadableClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	rc := c.acquire()
+	defer c.release(rc)
+	return rc.Stat(namespace, name)
+}
+
+func (c *reloadableClient) Upload(namespace, name string, src io.Reader) error {
+	rc := c.acquire()
+	defer c.release(rc)
+	return rc.Upload(namespace, name, src)
+}
+
+func (c *reloadableClient) UploadStream(namespace, name string, src io.Reader) error {
+	rc := c.acquire()
+	defer c.release(rc)
+	return rc.UploadStream(namespace, name, src)
+}
+
+func (c *reloadableClient) Download(namespace, name string, dst io.Writer) error {
+	rc := c.acquire()
+	defer c.release(rc)
+	return rc.Download(namespace, name, dst)
+}
+
+func (c *reloadableClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	rc := c.acquire()
+	defer c.release(rc)
+	return rc.DownloadRange(namespace, name, offset, length, dst)
+}
+
+func (c *reloadableClient) Delete(namespace, name string) error {
+	rc := c.acquire()
+	defer c.release(rc)
+	return rc.Delete(namespace, name)
+}
+
+func (c *reloadableClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	rc := c.acquire()
+	defer c.release(rc)
+	return rc.List(prefix, opts...)
+}
+
+// Close closes the current client. Clients replaced by earlier reloads are
+// still closed once idle.
+func (c *reloadableClient) Close() error {
+	return c.client().Close()
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package replicatedbackend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/mirror"
+	"github.com/uber/kraken/localdb"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/rwutil"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+const _replicated = "replicated"
+
+func init() {
+	backend.Register(_replicated, &factory{})
+}
+
+type factory struct{}
+
+func (f *factory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, logger *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal replicated config")
+	}
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal replicated config")
+	}
+	return NewClient(config, masterAuthConfig, stats, logger)
+}
+
+type replica struct {
+	name   string
+	client backend.Client
+}
+
+// Client implements a backend.Client which writes blobs to a primary backend
+// and copies them to mirror backends in the background. Copies are persisted
+// and retried until they succeed. Reads are served by the primary, failing
+// over to mirrors in configured order when the primary errors.
+type Client struct {
+	primary   backend.Client
+	mirrors   []replica
+	retry     persistedretry.Manager
+	db        *sqlx.DB
+	stats     tally.Scope
+	closeOnce sync.Once
+}
+
+// NewClient creates a new Client.
+func NewClient(
+	config Config,
+	masterAuthConfig backend.AuthConfig,
+	stats tally.Scope,
+	logger *zap.SugaredLogger) (*Client, error) {
+
+	if config.Database.Source == "" {
+		return nil, errors.New("invalid config: database source required")
+	}
+	if len(config.Mirrors) == 0 {
+		return nil, errors.New("invalid config: at least one mirror required")
+	}
+	names := make(map[string]bool)
+	for _, m := range config.Mirrors {
+		if m.Name == "" {
+			return nil, errors.New("invalid config: mirror name required")
+		}
+		if names[m.Name] {
+			return nil, fmt.Errorf("invalid config: duplicate mirror %s", m.Name)
+		}
+		names[m.Name] = true
+	}
+
+	primary, err := backend.NewClient(config.Primary, masterAuthConfig, stats, logger)
+	if err != nil {
+		return nil, fmt.Errorf("primary: %s", err)
+	}
+	var mirrors []replica
+	for _, m := range config.Mirrors {
+		c, err := backend.NewClient(m.Backend, masterAuthConfig, stats, logger)
+		if err != nil {
+			closeAll(primary, mirrors)
+			return nil, fmt.Errorf("mirror %s: %s", m.Name, err)
+		}
+		mirrors = append(mirrors, replica{m.Name, c})
+	}
+	db, err := localdb.New(config.Database)
+	if err != nil {
+		closeAll(primary, mirrors)
+		return nil, fmt.Errorf("localdb: %s", err)
+	}
+	client, err := newClient(config, primary, mirrors, db, stats)
+	if err != nil {
+		closeAll(primary, mirrors)
+		db.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func newClient(
+	config Config,
+	primary backend.Client,
+	mirrors []replica,
+	db *sqlx.DB,
+	stats tally.Scope) (*Client, error) {
+
+	stats = stats.Tagged(map[string]string{
+		"module": "replicatedbackend",
+	})
+
+	clients := make(map[string]backend.Client)
+	for _, m := range mirrors {
+		clients[m.name] = m.client
+	}
+	retry, err := persistedretry.NewManager(
+		config.Retry, stats, mirror.NewStore(db), mirror.NewExecutor(stats, primary, clients))
+	if err != nil {
+		return nil, fmt.Errorf("mirror retry manager: %s", err)
+	}
+	return &Client{
+		primary: primary,
+		mirrors: mirrors,
+		retry:   retry,
+		db:      db,
+		stats:   stats,
+	}, nil
+}
+
+func closeAll(primary backend.Client, mirrors []replica) {
+	primary.Close()
+	for _, m := range mirrors {
+		m.client.Close()
+	}
+}
+
+// failover logs and counts a read served by m after the primary failed.
+func (c *Client) failover(m replica, op string, err error) {
+	c.stats.Tagged(map[string]string{
+		"mirror": m.name,
+		"op":     op,
+	}).Counter("failovers").Inc(1)
+	log.With("mirror", m.name, "op", op).Warnf("Primary backend failed, served by mirror: %s", err)
+}
+
+// Stat returns blob info for name from the primary, or from the first mirror
+// which has name if the primary fails.
+func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
+	info, err := c.primary.Stat(namespace, name)
+	if err == nil || err == backenderrors.ErrBlobNotFound {
+		return info, err
+	}
+	for _, m := range c.mirrors {
+		if info, merr := m.client.Stat(namespace, name); merr == nil {
+			c.failover(m, "stat", err)
+			return info, nil
+		}
+	}
+	return nil, err
+}
+
+// Download downloads name from the primary into dst. If the primary fails
+// before writing any data, mirrors are tried in order.
+func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	return c.download("download", dst, func(client backend.Client, w io.Writer) error {
+		return client.Download(namespace, name, w)
+	})
+}
+
+// DownloadRange downloads a range of name into dst like Download.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return c.download("download_range", dst, func(client backend.Client, w io.Writer) error {
+		return client.DownloadRange(namespace, name, offset, length, w)
+	})
+}
+
+func (c *Client) download(
+	op string, dst io.Writer, f func(client backend.Client, w io.Writer) error) error {
+
+	cw := rwutil.NewCountingWriter(dst)
+	err := f(c.primary, cw)
+	if err == nil || err == backenderrors.ErrBlobNotFound || cw.N() > 0 {
+		// Partial data cannot be retracted from dst, so there is no failover
+		// once the primary has written to it.
+		return err
+	}
+	for _, m := range c.mirrors {
+		merr := f(m.client, cw)
+		if merr == nil {
+			c.failover(m, op, err)
+			return nil
+		}
+		if cw.N() > 0 {
+			return fmt.Errorf("mirror %s: %s", m.name, merr)
+		}
+	}
+	return err
+}
+
+// Upload uploads src to the primary and schedules copies of name to all
+// mirrors. Upload succeeds once the primary has name and the copies are
+// persisted.
+func (c *Client) Upload(namespace, name string, src io.Reader) error {
+	if err := c.primary.Upload(namespace, name, src); err != nil {
+		return err
+	}
+	return c.scheduleCopies(namespace, name)
+}
+
+// UploadStream streams src to the primary and schedules copies of name to all
+// mirrors, which are copied from the primary.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	if err := c.primary.UploadStream(namespace, name, src); err != nil {
+		return err
+	}
+	return c.scheduleCopies(namespace, name)
+}
+
+func (c *Client) scheduleCopies(namespace, name string) error {
+	for _, m := range c.mirrors {
+		if err := c.retry.Add(mirror.NewTask(namespace, name, m.name)); err != nil {
+			return fmt.Errorf("add copy to mirror %s: %s", m.name, err)
+		}
+	}
+	return nil
+}
+
+// Delete deletes name from the primary and all mirrors. Pending copies of name
+// are dropped once they find it missing from the primary.
+func (c *Client) Delete(namespace, name string) error {
+	if err := c.primary.Delete(namespace, name); err != nil && err != backenderrors.ErrBlobNotFound {
+		return err
+	}
+	for _, m := range c.mirrors {
+		if err := m.client.Delete(namespace, name); err != nil && err != backenderrors.ErrBlobNotFound {
+			return fmt.Errorf("delete from mirror %s: %s", m.name, err)
+		}
+	}
+	return nil
+}
+
+// List lists names with prefix from the primary, or from the first mirror
+// which succeeds if the primary fails. Mirrors may lag behind the primary.
+func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	result, err := c.primary.List(prefix, opts...)
+	if err == nil {
+		return result, nil
+	}
+	for _, m := range c.mirrors {
+		if result, merr := m.client.List(prefix, opts...); merr == nil {
+			c.failover(m, "list", err)
+			return result, nil
+		}
+	}
+	return nil, err
+}
+
+// Close stops mirror copies and closes all backends. Pending copies resume
+// when a Client is next created with the same database.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.retry.Close()
+		closeAll(c.primary, c.mirrors)
+		c.db.Close()
+	})
+	return nil
+}
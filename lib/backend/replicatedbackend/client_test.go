@@ -0,0 +1,253 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package replicatedbackend
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/localdb"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+type clientMocks struct {
+	primary *mockbackend.MockClient
+	mirrorA *mockbackend.MockClient
+	mirrorB *mockbackend.MockClient
+}
+
+func newClientMocks(t *testing.T) (*Client, *clientMocks, func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	ctrl := gomock.NewController(t)
+	cleanup.Add(ctrl.Finish)
+
+	db, c := localdb.Fixture(t)
+	cleanup.Add(c)
+
+	mocks := &clientMocks{
+		primary: mockbackend.NewMockClient(ctrl),
+		mirrorA: mockbackend.NewMockClient(ctrl),
+		mirrorB: mockbackend.NewMockClient(ctrl),
+	}
+	client, err := newClient(Config{
+		Retry: persistedretry.Config{
+			PollRetriesInterval: 100 * time.Millisecond,
+			RetryInterval:       100 * time.Millisecond,
+		},
+	}, mocks.primary, []replica{
+		{"a", mocks.mirrorA},
+		{"b", mocks.mirrorB},
+	}, db, tally.NoopScope)
+	require.NoError(t, err)
+
+	return client, mocks, func() {
+		// Stop mirror copies before tearing down the mocks and database.
+		client.retry.Close()
+		cleanup.Run()
+	}
+}
+
+func writeContent(content []byte) func(string, string, io.Writer) error {
+	return func(namespace, name string, dst io.Writer) error {
+		_, err := dst.Write(content)
+		return err
+	}
+}
+
+func TestClientUploadCopiesToMirrors(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	ns := core.NamespaceFixture()
+	name := blob.Digest.Hex()
+
+	mocks.primary.EXPECT().Upload(ns, name, mockutil.MatchReader(blob.Content)).Return(nil)
+	mocks.primary.EXPECT().Download(ns, name, gomock.Any()).DoAndReturn(writeContent(blob.Content)).Times(2)
+
+	done := make(chan struct{}, 2)
+	signal := func(string, string, io.Reader) { done <- struct{}{} }
+
+	mocks.mirrorA.EXPECT().Stat(ns, name).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.mirrorA.EXPECT().Upload(ns, name, mockutil.MatchReader(blob.Content)).Do(signal).Return(nil)
+	mocks.mirrorB.EXPECT().Stat(ns, name).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.mirrorB.EXPECT().Upload(ns, name, mockutil.MatchReader(blob.Content)).Do(signal).Return(nil)
+
+	require.NoError(client.Upload(ns, name, bytes.NewReader(blob.Content)))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			require.FailNow("timed out waiting for mirror copies")
+		}
+	}
+}
+
+func TestClientUploadRetriesFailedMirror(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	ns := core.NamespaceFixture()
+	name := blob.Digest.Hex()
+
+	mocks.primary.EXPECT().Upload(ns, name, gomock.Any()).Return(nil)
+	mocks.primary.EXPECT().Download(ns, name, gomock.Any()).DoAndReturn(writeContent(blob.Content)).AnyTimes()
+
+	done := make(chan struct{})
+
+	mocks.mirrorA.EXPECT().Stat(ns, name).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.mirrorA.EXPECT().Upload(ns, name, gomock.Any()).Return(nil)
+	mocks.mirrorB.EXPECT().Stat(ns, name).Return(nil, backenderrors.ErrBlobNotFound).Times(2)
+	gomock.InOrder(
+		mocks.mirrorB.EXPECT().Upload(ns, name, gomock.Any()).Return(errors.New("some error")),
+		mocks.mirrorB.EXPECT().Upload(ns, name, mockutil.MatchReader(blob.Content)).Do(
+			func(string, string, io.Reader) { close(done) }).Return(nil),
+	)
+
+	require.NoError(client.Upload(ns, name, bytes.NewReader(blob.Content)))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for mirror retry")
+	}
+}
+
+func TestClientUploadPrimaryFailure(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.primary.EXPECT().Upload("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+	require.Error(client.Upload("ns", "name", bytes.NewReader(nil)))
+}
+
+func TestClientStatFailover(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	info := core.NewBlobInfo(10)
+
+	mocks.primary.EXPECT().Stat("ns", "name").Return(nil, errors.New("some error"))
+	mocks.mirrorA.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.mirrorB.EXPECT().Stat("ns", "name").Return(info, nil)
+
+	result, err := client.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(info, result)
+}
+
+func TestClientStatNotFoundDoesNotFailover(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.primary.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound)
+
+	_, err := client.Stat("ns", "name")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+}
+
+func TestClientDownloadFailover(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.primary.EXPECT().Download("ns", "name", gomock.Any()).Return(errors.New("some error"))
+	mocks.mirrorA.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(writeContent([]byte("data")))
+
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", "name", &b))
+	require.Equal("data", b.String())
+}
+
+func TestClientDownloadNoFailoverAfterPartialWrite(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.primary.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			dst.Write([]byte("da"))
+			return errors.New("connection reset")
+		})
+
+	var b bytes.Buffer
+	require.Error(client.Download("ns", "name", &b))
+}
+
+func TestClientDownloadAllFail(t *testing.T) {
+	require := require.New(t)
+
+	client, mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	primaryErr := errors.New("primary error")
+
+	mocks.primary.EXPECT().Download("ns", "name", gomock.Any()).Return(primaryErr)
+	mocks.mirrorA.EXPECT().Download("ns", "name", gomock.Any()).Return(errors.New("some error"))
+	mocks.mirrorB.EXPECT().Download("ns", "name", gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	require.Equal(primaryErr, client.Download("ns", "name", &bytes.Buffer{}))
+}
+
+func TestNewClientInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config Config
+	}{
+		{"no database", Config{Mirrors: []MirrorConfig{{Name: "a"}}}},
+		{"no mirrors", Config{Database: localdb.Config{Source: "/tmp/db"}}},
+		{"unnamed mirror", Config{
+			Database: localdb.Config{Source: "/tmp/db"},
+			Mirrors:  []MirrorConfig{{}},
+		}},
+		{"duplicate mirror", Config{
+			Database: localdb.Config{Source: "/tmp/db"},
+			Mirrors:  []MirrorConfig{{Name: "a"}, {Name: "a"}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewClient(test.config, nil, tally.NoopScope, nil)
+			require.Error(t, err)
+		})
+	}
+}
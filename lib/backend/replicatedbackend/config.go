@@ -0,0 +1,46 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package replicatedbackend
+
+import (
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/localdb"
+)
+
+// Config defines a primary backend replicated to a list of mirror backends.
+type Config struct {
+	// Primary is the storage of record. It is configured like any other
+	// backend, e.g. {s3: {...}}.
+	Primary map[string]interface{} `yaml:"primary"`
+
+	// Mirrors receive copies of every blob uploaded to Primary, and serve
+	// reads when Primary fails.
+	Mirrors []MirrorConfig `yaml:"mirrors"`
+
+	// Database persists mirror copies which have yet to succeed, so they
+	// survive restarts.
+	Database localdb.Config `yaml:"database"`
+
+	// Retry configures the execution and retry of mirror copies.
+	Retry persistedretry.Config `yaml:"retry"`
+}
+
+// MirrorConfig defines a single mirror backend.
+type MirrorConfig struct {
+	// Name identifies the mirror in pending copies and metrics. Renaming a
+	// mirror drops its pending copies.
+	Name string `yaml:"name"`
+
+	Backend map[string]interface{} `yaml:"backend"`
+}
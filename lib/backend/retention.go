@@ -0,0 +1,47 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"errors"
+	"time"
+)
+
+// RetentionConfig defines how long blobs of a namespace may stay cached on
+// origins once they are in the storage of record. Retention is enforced even
+// when disk is not full, and blobs deleted from the backend are evicted from
+// cache. A zero RetentionConfig disables retention.
+type RetentionConfig struct {
+	// MaxAge evicts cached blobs older than MaxAge.
+	MaxAge time.Duration `yaml:"max_age"`
+
+	// MaxVersions evicts all but the MaxVersions most recently cached blobs of
+	// the namespace.
+	MaxVersions int `yaml:"max_versions"`
+}
+
+// Enabled returns whether c defines a retention policy.
+func (c RetentionConfig) Enabled() bool {
+	return c.MaxAge > 0 || c.MaxVersions > 0
+}
+
+func (c RetentionConfig) validate() error {
+	if c.MaxAge < 0 {
+		return errors.New("max_age must not be negative")
+	}
+	if c.MaxVersions < 0 {
+		return errors.New("max_versions must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/rwutil"
+
+	"github.com/cenkalti/backoff"
+	"github.com/uber-go/tally"
+)
+
+// retryClient retries failed operations of the wrapped Client with backoff.
+type retryClient struct {
+	Client
+	config  httputil.ExponentialBackOffConfig
+	retries tally.Counter
+}
+
+// WithRetry returns a Middleware which retries failed operations according to
+// config. Uploads are only retried if src implements io.Seeker, and downloads
+// are only retried if nothing was written to dst yet.
+func WithRetry(config httputil.ExponentialBackOffConfig, stats tally.Scope) Middleware {
+	config.Enabled = true
+	return func(c Client) Client {
+		return &retryClient{c, config, stats.Counter("backend_retries")}
+	}
+}
+
+// isPermanent returns true if err will not go away by retrying.
+func isPermanent(err error) bool {
+	if err == backenderrors.ErrBlobNotFound || err == ErrCircuitOpen {
+		return true
+	}
+	var statusErr httputil.StatusError
+	return errors.As(err, &statusErr) && !httputil.IsRetryable(statusErr)
+}
+
+func (c *retryClient) retry(op string, name string, f func() error) error {
+	return backoff.RetryNotify(func() error {
+		err := f()
+		if err != nil && isPermanent(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, c.config.Build(), func(err error, next time.Duration) {
+		c.retries.Inc(1)
+		log.With("op", op, "name", name, "next", next).Warnf("Backend operation failed, will retry: %s", err)
+	})
+}
+
+func (c *retryClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	var info *core.BlobInfo
+	err := c.retry("stat", name, func() (err error) {
+		info, err = c.Client.Stat(namespace, name)
+		return err
+	})
+	return info, err
+}
+
+func (c *retryClient) Upload(namespace, name string, src io.Reader) error {
+	s, ok := src.(io.Seeker)
+	if !ok {
+		return c.Client.Upload(namespace, name, src)
+	}
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return c.Client.Upload(namespace, name, src)
+	}
+	attempt := 0
+	return c.retry("upload", name, func() error {
+		if attempt > 0 {
+			if _, err := s.Seek(start, io.SeekStart); err != nil {
+				return backoff.Permanent(fmt.Errorf("rewind src: %s", err))
+			}
+		}
+		attempt++
+		return c.Client.Upload(namespace, name, src)
+	})
+}
+
+// UploadStream is never retried, since streams cannot be rewound.
+func (c *retryClient) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Client.UploadStream(namespace, name, src)
+}
+
+func (c *retryClient) Download(namespace, name string, dst io.Writer) error {
+	w := rwutil.NewCountingWriter(dst)
+	return c.retry("download", name, func() error {
+		err := c.Client.Download(namespace, name, w)
+		if err != nil && w.N() > 0 {
+			// dst is already partially written.
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+}
+
+func (c *retryClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	w := rwutil.NewCountingWriter(dst)
+	return c.retry("download_range", name, func() error {
+		err := c.Client.DownloadRange(namespace, name, offset, length, w)
+		if err != nil && w.N() > 0 {
+			// dst is already partially written.
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+}
+
+func (c *retryClient) Delete(namespace, name string) error {
+	return c.retry("delete", name, func() error {
+		return c.Client.Delete(namespace, name)
+	})
+}
+
+func (c *retryClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	var result *ListResult
+	err := c.retry("list", prefix, func() (err error) {
+		result, err = c.Client.List(prefix, opts...)
+		return err
+	})
+	return result, err
+}
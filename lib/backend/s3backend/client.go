@@ -17,7 +17,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
+	"time"
 
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
@@ -30,7 +32,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"go.uber.org/zap"
@@ -75,6 +79,8 @@ type Client struct {
 	pather namepath.Pather
 	stats  tally.Scope
 	s3     S3
+
+	uploader *multipartUploader
 }
 
 // Option allows setting optional Client parameters.
@@ -93,15 +99,18 @@ func NewClient(
 	if config.Username == "" {
 		return nil, errors.New("invalid config: username required")
 	}
-	if config.Region == "" {
-		return nil, errors.New("invalid config: region required")
-	}
 	if config.Bucket == "" {
 		return nil, errors.New("invalid config: bucket required")
 	}
 	if !path.IsAbs(config.RootDirectory) {
 		return nil, errors.New("invalid config: root_directory must be absolute path")
 	}
+	if err := config.validateEndpoint(); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+	if err := config.validateUploadOptions(); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
 
 	pather, err := namepath.New(config.RootDirectory, config.NamePath)
 	if err != nil {
@@ -129,29 +138,58 @@ func NewClient(
 		awsConfig = awsConfig.WithS3ForcePathStyle(config.S3ForcePathStyle)
 	}
 
+	if config.customTLS() {
+		tlsConfig, err := config.TLS.BuildClient()
+		if err != nil {
+			return nil, fmt.Errorf("build tls config: %s", err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		awsConfig = awsConfig.WithHTTPClient(&http.Client{Transport: transport})
+	}
+
 	sess, err := session.NewSession(awsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("create AWS session: %s", err)
 	}
 	api := s3.New(sess)
+	if config.BucketKeyEnabled {
+		api.Handlers.Build.PushBack(setBucketKeyHeader)
+	}
+	if config.SignatureVersion == _signatureV2 {
+		api.Handlers.Sign.RemoveByName(v4.SignRequestHandler.Name)
+		api.Handlers.Sign.PushBackNamed(request.NamedHandler{
+			Name: "kraken.SignV2",
+			Fn:   newV2Signer(config.Bucket, time.Now),
+		})
+	}
 
 	downloader := s3manager.NewDownloaderWithClient(api, func(d *s3manager.Downloader) {
 		d.PartSize = config.DownloadPartSize
 		d.Concurrency = config.DownloadConcurrency
 	})
 
-	uploader := s3manager.NewUploaderWithClient(api, func(u *s3manager.Uploader) {
-		u.PartSize = config.UploadPartSize
-		u.Concurrency = config.UploadConcurrency
-	})
-
-	client := &Client{config, pather, stats, join{api, downloader, uploader}}
+	client := &Client{config: config, pather: pather, stats: stats, s3: join{api, downloader}}
 	for _, opt := range opts {
 		opt(client)
 	}
+	client.uploader = newMultipartUploader(client.s3, config)
 	return client, nil
 }
 
+// _bucketKeyHeader enables S3 Bucket Keys for KMS encrypted objects. It is set
+// on the raw request since the SDK version in use predates the parameter.
+const _bucketKeyHeader = "X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"
+
+// setBucketKeyHeader is a request handler which enables S3 Bucket Keys on
+// requests which create objects.
+func setBucketKeyHeader(r *request.Request) {
+	switch r.Operation.Name {
+	case "PutObject", "CreateMultipartUpload", "CopyObject":
+		r.HTTPRequest.Header.Set(_bucketKeyHeader, "true")
+	}
+}
+
 // Stat returns blob info for name.
 func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
 	path, err := c.pather.BlobPath(name)
@@ -211,21 +249,54 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return nil
 }
 
-// Upload uploads src to a configured bucket.
-func (c *Client) Upload(namespace, name string, src io.Reader) error {
+// DownloadRange downloads length bytes of name starting at offset from a
+// configured bucket using a byte range request, and writes the data to dst.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
 	path, err := c.pather.BlobPath(name)
 	if err != nil {
 		return fmt.Errorf("blob path: %s", err)
 	}
-	input := &s3manager.UploadInput{
+
+	// Ranged downloads write from offset zero of the io.WriterAt, so dst is
+	// never upcast. Ranges are bounded by length, which caps the buffer.
+	buf := rwutil.NewCappedBuffer(int(length))
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(c.config.Bucket),
 		Key:    aws.String(path),
-		Body:   src,
+		Range:  aws.String(backend.RangeHeader(offset, length)),
 	}
-	_, err = c.s3.Upload(input, func(u *s3manager.Uploader) {
-		u.LeavePartsOnError = false // Delete the parts if the upload fails.
-	})
-	return err
+	n, err := c.s3.Download(buf, input)
+	if err != nil {
+		if isNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	if err := backend.CheckRangeLength(length, n); err != nil {
+		return err
+	}
+	return buf.DrainInto(dst)
+}
+
+// Upload uploads src to a configured bucket. Large blobs are uploaded as
+// multiple parts in parallel, streamed from src.
+func (c *Client) Upload(namespace, name string, src io.Reader) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	return c.uploader.upload(path, src)
+}
+
+// UploadStream uploads src as name. Parts are read from src as they are
+// uploaded, so the length of src need not be known upfront.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Upload(namespace, name, src)
 }
 
 func isNotFound(err error) bool {
@@ -233,6 +304,19 @@ func isNotFound(err error) bool {
 	return ok && (awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound")
 }
 
+// Delete deletes name from the configured bucket.
+func (c *Client) Delete(namespace, name string) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	_, err = c.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(path),
+	})
+	return err
+}
+
 // List lists names with start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	// For whatever reason, the S3 list API does not accept an absolute path
@@ -15,6 +15,11 @@ package s3backend
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
 	"testing"
 
 	"github.com/uber-go/tally"
@@ -22,13 +27,14 @@ import (
 	"github.com/uber/kraken/lib/backend"
 	mocks3backend "github.com/uber/kraken/mocks/lib/backend/s3backend"
 	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/mockutil"
 	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/rwutil"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -158,7 +164,7 @@ func TestClientDownloadWithBuffer(t *testing.T) {
 	require.Equal(data, []byte(w))
 }
 
-func TestClientUpload(t *testing.T) {
+func TestClientDownloadRange(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newClientMocks(t)
@@ -167,18 +173,266 @@ func TestClientUpload(t *testing.T) {
 	client := mocks.new()
 	defer closers.Close(client)
 
-	data := bytes.NewReader(randutil.Text(32))
+	data := randutil.Text(16)
 
-	mocks.s3.EXPECT().Upload(
-		&s3manager.UploadInput{
+	mocks.s3.EXPECT().Download(
+		mockutil.MatchWriterAt(data),
+		&s3.GetObjectInput{
 			Bucket: aws.String("test-bucket"),
 			Key:    aws.String("/root/test"),
-			Body:   data,
+			Range:  aws.String("bytes=32-47"),
 		},
-		gomock.Any(),
-	).Return(nil, nil)
+	).Return(int64(len(data)), nil)
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 32, 16, &b))
+	require.Equal(data, b.Bytes())
+}
+
+func TestClientUpload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+	defer closers.Close(client)
 
-	require.NoError(client.Upload(core.NamespaceFixture(), "test", data))
+	data := randutil.Text(32)
+
+	mocks.s3.EXPECT().PutObject(gomock.Any()).DoAndReturn(
+		func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			require.Equal("test-bucket", *input.Bucket)
+			require.Equal("/root/test", *input.Key)
+			b, err := io.ReadAll(input.Body)
+			require.NoError(err)
+			require.Equal(data, b)
+			return &s3.PutObjectOutput{}, nil
+		})
+
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+}
+
+// expectMultipartUpload mocks a successful multipart upload and returns the
+// uploaded content once the upload is complete.
+func (m *clientMocks) expectMultipartUpload(t *testing.T, numParts int) func() []byte {
+	var mu sync.Mutex
+	parts := make(map[int64][]byte)
+
+	m.s3.EXPECT().CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+	}).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil)
+
+	m.s3.EXPECT().UploadPart(gomock.Any()).DoAndReturn(
+		func(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+			b, err := io.ReadAll(input.Body)
+			require.NoError(t, err)
+			mu.Lock()
+			defer mu.Unlock()
+			parts[*input.PartNumber] = b
+			return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", *input.PartNumber))}, nil
+		}).Times(numParts)
+
+	var completed []*s3.CompletedPart
+	for i := 1; i <= numParts; i++ {
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       aws.String(fmt.Sprintf("etag-%d", i)),
+			PartNumber: aws.Int64(int64(i)),
+		})
+	}
+	m.s3.EXPECT().CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("test-bucket"),
+		Key:             aws.String("/root/test"),
+		UploadId:        aws.String("upload-id"),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	}).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	return func() []byte {
+		var b []byte
+		for i := 1; i <= numParts; i++ {
+			b = append(b, parts[int64(i)]...)
+		}
+		return b
+	}
+}
+
+func TestClientUploadMultipart(t *testing.T) {
+	tests := []struct {
+		desc string
+		wrap func([]byte) io.Reader
+	}{
+		{"reader at", func(b []byte) io.Reader { return bytes.NewReader(b) }},
+		{"stream", func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) }},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newClientMocks(t)
+			defer cleanup()
+
+			mocks.config.UploadPartSize = 10
+			mocks.config.UploadConcurrency = 2
+			client := mocks.new()
+			defer closers.Close(client)
+
+			data := randutil.Text(25)
+			uploaded := mocks.expectMultipartUpload(t, 3)
+
+			require.NoError(client.Upload(core.NamespaceFixture(), "test", test.wrap(data)))
+			require.Equal(data, uploaded())
+		})
+	}
+}
+
+func TestClientUploadMultipartAbortsOnError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.config.UploadPartSize = 10
+	client := mocks.new()
+	defer closers.Close(client)
+
+	mocks.s3.EXPECT().CreateMultipartUpload(gomock.Any()).Return(
+		&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil)
+	mocks.s3.EXPECT().UploadPart(gomock.Any()).Return(nil, errors.New("some error")).MinTimes(1)
+	mocks.s3.EXPECT().AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String("test-bucket"),
+		Key:      aws.String("/root/test"),
+		UploadId: aws.String("upload-id"),
+	}).Return(&s3.AbortMultipartUploadOutput{}, nil)
+
+	require.Error(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(randutil.Text(50))))
+}
+
+func TestClientUploadOptions(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.config.UploadPartSize = 10
+	mocks.config.ServerSideEncryption = "aws:kms"
+	mocks.config.SSEKMSKeyID = "key-id"
+	mocks.config.ACL = "bucket-owner-full-control"
+	mocks.config.StorageClass = "INTELLIGENT_TIERING"
+	client := mocks.new()
+	defer closers.Close(client)
+
+	mocks.s3.EXPECT().PutObject(gomock.Any()).DoAndReturn(
+		func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			require.Equal("aws:kms", aws.StringValue(input.ServerSideEncryption))
+			require.Equal("key-id", aws.StringValue(input.SSEKMSKeyId))
+			require.Equal("bucket-owner-full-control", aws.StringValue(input.ACL))
+			require.Equal("INTELLIGENT_TIERING", aws.StringValue(input.StorageClass))
+			return &s3.PutObjectOutput{}, nil
+		})
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(randutil.Text(5))))
+
+	mocks.s3.EXPECT().CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               aws.String("test-bucket"),
+		Key:                  aws.String("/root/test"),
+		ServerSideEncryption: aws.String("aws:kms"),
+		SSEKMSKeyId:          aws.String("key-id"),
+		ACL:                  aws.String("bucket-owner-full-control"),
+		StorageClass:         aws.String("INTELLIGENT_TIERING"),
+	}).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil)
+	mocks.s3.EXPECT().UploadPart(gomock.Any()).Return(
+		&s3.UploadPartOutput{ETag: aws.String("etag")}, nil).Times(2)
+	mocks.s3.EXPECT().CompleteMultipartUpload(gomock.Any()).Return(
+		&s3.CompleteMultipartUploadOutput{}, nil)
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(randutil.Text(20))))
+}
+
+func TestNewClientInvalidUploadOptions(t *testing.T) {
+	tests := []struct {
+		desc   string
+		update func(*Config)
+	}{
+		{"unknown encryption", func(c *Config) { c.ServerSideEncryption = "rot13" }},
+		{"kms key without kms", func(c *Config) {
+			c.ServerSideEncryption = "AES256"
+			c.SSEKMSKeyID = "key-id"
+		}},
+		{"bucket key without kms", func(c *Config) { c.BucketKeyEnabled = true }},
+		{"unknown acl", func(c *Config) { c.ACL = "everyone" }},
+		{"unknown storage class", func(c *Config) { c.StorageClass = "COLD" }},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newClientMocks(t)
+			defer cleanup()
+
+			test.update(&mocks.config)
+			_, err := NewClient(mocks.config, mocks.userAuth, tally.NoopScope, WithS3(mocks.s3))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNewClientEndpointOptions(t *testing.T) {
+	tests := []struct {
+		desc   string
+		update func(*Config)
+		valid  bool
+	}{
+		{"region-less endpoint", func(c *Config) {
+			c.Region = ""
+			c.Endpoint = "http://minio:9000"
+			c.S3ForcePathStyle = true
+		}, true},
+		{"signature v2", func(c *Config) { c.SignatureVersion = "v2" }, true},
+		{"no region or endpoint", func(c *Config) { c.Region = "" }, false},
+		{"unknown signature version", func(c *Config) { c.SignatureVersion = "v3" }, false},
+		{"missing ca", func(c *Config) {
+			c.TLS.CAs = []httputil.Secret{{Path: "/does/not/exist.pem"}}
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newClientMocks(t)
+			defer cleanup()
+
+			test.update(&mocks.config)
+			_, err := NewClient(mocks.config, mocks.userAuth, tally.NoopScope, WithS3(mocks.s3))
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigApplyDefaultsEndpoint(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Endpoint: "http://ceph-rgw:7480"}
+	config.applyDefaults()
+	require.Equal(_defaultRegion, config.Region)
+	require.Equal(_signatureV4, config.SignatureVersion)
+	require.True(config.DisableSSL)
+}
+
+func TestSetBucketKeyHeader(t *testing.T) {
+	for op, expected := range map[string]string{
+		"PutObject":             "true",
+		"CreateMultipartUpload": "true",
+		"UploadPart":            "",
+		"GetObject":             "",
+	} {
+		t.Run(op, func(t *testing.T) {
+			r := &request.Request{
+				Operation:   &request.Operation{Name: op},
+				HTTPRequest: &http.Request{Header: http.Header{}},
+			}
+			setBucketKeyHeader(r)
+			require.Equal(t, expected, r.HTTPRequest.Header.Get(_bucketKeyHeader))
+		})
+	}
 }
 
 func TestClientList(t *testing.T) {
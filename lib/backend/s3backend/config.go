@@ -14,9 +14,16 @@
 package s3backend
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/c2h5oh/datasize"
 
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 // Config defines s3 connection specific
@@ -29,13 +36,25 @@ type Config struct {
 	DisableSSL       bool   `yaml:"disable_ssl"`      // use clear HTTP when talking to endpoint
 	S3ForcePathStyle bool   `yaml:"force_path_style"` // use path style instead of DNS style
 
+	// TLS configures custom root CAs and client certificates used to talk to
+	// endpoint, e.g. for on-prem gateways with an internal CA.
+	TLS httputil.TLSConfig `yaml:"tls"`
+
+	// SignatureVersion selects the request signing algorithm, either "v4"
+	// (default) or "v2" for legacy S3-compatible gateways.
+	SignatureVersion string `yaml:"signature_version"`
+
 	RootDirectory    string `yaml:"root_directory"`     // S3 root directory for docker images
-	UploadPartSize   int64  `yaml:"upload_part_size"`   // part size s3 manager uses for upload
+	UploadPartSize   int64  `yaml:"upload_part_size"`   // part size of multipart uploads
 	DownloadPartSize int64  `yaml:"download_part_size"` // part size s3 manager uses for download
 
-	UploadConcurrency   int `yaml:"upload_concurrency"`   // # of concurrent go-routines s3 manager uses for upload
+	UploadConcurrency   int `yaml:"upload_concurrency"`   // # of parts uploaded in parallel
 	DownloadConcurrency int `yaml:"download_concurrency"` // # of concurrent go-routines s3 manager uses for download
 
+	// UploadBandwidth caps upload bandwidth per second across all parts of
+	// all uploads. Unlimited if zero.
+	UploadBandwidth datasize.ByteSize `yaml:"upload_bandwidth"`
+
 	// ListMaxKeys sets the max keys returned per page.
 	ListMaxKeys int `yaml:"list_max_keys"`
 
@@ -45,6 +64,25 @@ type Config struct {
 
 	// NamePath identifies which namepath.Pather to use.
 	NamePath string `yaml:"name_path"`
+
+	// ServerSideEncryption encrypts uploaded objects with either S3 managed
+	// keys ("AES256") or KMS keys ("aws:kms"). Bucket defaults apply if empty.
+	ServerSideEncryption string `yaml:"server_side_encryption"`
+
+	// SSEKMSKeyID is the KMS key used with "aws:kms" encryption. The AWS
+	// managed key of the account is used if empty.
+	SSEKMSKeyID string `yaml:"sse_kms_key_id"`
+
+	// BucketKeyEnabled enables S3 Bucket Keys for "aws:kms" encryption, which
+	// reduces the number of requests made to KMS.
+	BucketKeyEnabled bool `yaml:"bucket_key_enabled"`
+
+	// ACL is the canned ACL of uploaded objects, e.g. "bucket-owner-full-control".
+	ACL string `yaml:"acl"`
+
+	// StorageClass is the storage class of uploaded objects, e.g. "STANDARD_IA"
+	// or "INTELLIGENT_TIERING". Defaults to "STANDARD".
+	StorageClass string `yaml:"storage_class"`
 }
 
 // UserAuthConfig defines authentication configuration overlayed by Langley.
@@ -60,7 +98,97 @@ type AuthConfig struct {
 	} `yaml:"s3"`
 }
 
+var (
+	_serverSideEncryptions = []string{
+		s3.ServerSideEncryptionAes256,
+		s3.ServerSideEncryptionAwsKms,
+	}
+	_acls = []string{
+		s3.ObjectCannedACLPrivate,
+		s3.ObjectCannedACLPublicRead,
+		s3.ObjectCannedACLPublicReadWrite,
+		s3.ObjectCannedACLAuthenticatedRead,
+		s3.ObjectCannedACLAwsExecRead,
+		s3.ObjectCannedACLBucketOwnerRead,
+		s3.ObjectCannedACLBucketOwnerFullControl,
+	}
+	_storageClasses = []string{
+		s3.StorageClassStandard,
+		s3.StorageClassReducedRedundancy,
+		s3.StorageClassStandardIa,
+		s3.StorageClassOnezoneIa,
+		s3.StorageClassIntelligentTiering,
+		s3.StorageClassGlacier,
+		s3.StorageClassDeepArchive,
+	}
+)
+
+const (
+	_signatureV2 = "v2"
+	_signatureV4 = "v4"
+
+	// _defaultRegion is used for S3-compatible endpoints, such as MinIO and
+	// Ceph RGW, which do not have a notion of regions.
+	_defaultRegion = "us-east-1"
+)
+
+func oneOf(v string, values []string) bool {
+	for _, value := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEndpoint validates the options used to connect to the S3 endpoint.
+func (c Config) validateEndpoint() error {
+	if c.Region == "" && c.Endpoint == "" {
+		return errors.New("region required")
+	}
+	if c.SignatureVersion != _signatureV2 && c.SignatureVersion != _signatureV4 {
+		return fmt.Errorf("signature_version must be one of %v", []string{_signatureV2, _signatureV4})
+	}
+	return nil
+}
+
+// customTLS returns whether TLS overrides the default transport settings.
+func (c Config) customTLS() bool {
+	return len(c.TLS.CAs) > 0 || c.TLS.Client.Cert.Path != "" || c.TLS.Name != ""
+}
+
+// validateUploadOptions validates the options applied to uploaded objects.
+func (c Config) validateUploadOptions() error {
+	if c.ServerSideEncryption != "" && !oneOf(c.ServerSideEncryption, _serverSideEncryptions) {
+		return fmt.Errorf("server_side_encryption must be one of %v", _serverSideEncryptions)
+	}
+	if c.ServerSideEncryption != s3.ServerSideEncryptionAwsKms {
+		if c.SSEKMSKeyID != "" {
+			return errors.New("sse_kms_key_id requires aws:kms server_side_encryption")
+		}
+		if c.BucketKeyEnabled {
+			return errors.New("bucket_key_enabled requires aws:kms server_side_encryption")
+		}
+	}
+	if c.ACL != "" && !oneOf(c.ACL, _acls) {
+		return fmt.Errorf("acl must be one of %v", _acls)
+	}
+	if c.StorageClass != "" && !oneOf(c.StorageClass, _storageClasses) {
+		return fmt.Errorf("storage_class must be one of %v", _storageClasses)
+	}
+	return nil
+}
+
 func (c *Config) applyDefaults() {
+	if c.Region == "" && c.Endpoint != "" {
+		c.Region = _defaultRegion
+	}
+	if c.SignatureVersion == "" {
+		c.SignatureVersion = _signatureV4
+	}
+	if strings.HasPrefix(c.Endpoint, "http://") {
+		c.DisableSSL = true
+	}
 	if c.UploadPartSize == 0 {
 		c.UploadPartSize = backend.DefaultPartSize
 	}
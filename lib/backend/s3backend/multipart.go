@@ -0,0 +1,318 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package s3backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// _maxParts is the maximum number of parts S3 accepts in a multipart upload.
+const _maxParts = 10000
+
+// sizedReaderAt is implemented by readers which know their size and can be
+// read at arbitrary offsets, such as store file readers. Parts of such readers
+// are uploaded straight from the source without buffering.
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// part is a single part of a multipart upload.
+type part struct {
+	num  int64
+	body io.ReadSeeker
+	size int64
+
+	// buf is the pooled buffer backing body, if any.
+	buf *[]byte
+}
+
+// partSource splits an upload into parts. next returns io.EOF once all parts
+// have been returned.
+type partSource interface {
+	next() (*part, error)
+}
+
+// sectionSource returns parts as sections of a sizedReaderAt.
+type sectionSource struct {
+	r        sizedReaderAt
+	partSize int64
+	num      int64
+}
+
+func (s *sectionSource) next() (*part, error) {
+	off := s.num * s.partSize
+	if off >= s.r.Size() && !(s.num == 0 && s.r.Size() == 0) {
+		return nil, io.EOF
+	}
+	s.num++
+	size := s.r.Size() - off
+	if size > s.partSize {
+		size = s.partSize
+	}
+	return &part{num: s.num, body: io.NewSectionReader(s.r, off, size), size: size}, nil
+}
+
+// bufferSource reads parts of a plain reader into pooled buffers.
+type bufferSource struct {
+	r    io.Reader
+	pool *sync.Pool
+	num  int64
+	done bool
+}
+
+func (s *bufferSource) next() (*part, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	buf := s.pool.Get().(*[]byte)
+	n, err := io.ReadFull(s.r, *buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		s.done = true
+		if n == 0 && s.num > 0 {
+			s.pool.Put(buf)
+			return nil, io.EOF
+		}
+	} else if err != nil {
+		s.pool.Put(buf)
+		return nil, err
+	}
+	s.num++
+	b := (*buf)[:n]
+	return &part{num: s.num, body: bytes.NewReader(b), size: int64(n), buf: buf}, nil
+}
+
+// multipartUploader uploads blobs to S3 in parts, streaming from the source
+// reader. At most concurrency parts are in flight at once, so memory usage is
+// bounded by concurrency * partSize regardless of blob size.
+type multipartUploader struct {
+	s3          S3
+	bucket      string
+	partSize    int64
+	concurrency int
+
+	// Caps upload bandwidth in bytes per second. Nil if unlimited.
+	limiter *rate.Limiter
+
+	// Options of uploaded objects. Nil if unset.
+	sse          *string
+	sseKMSKeyID  *string
+	acl          *string
+	storageClass *string
+
+	bufs sync.Pool
+}
+
+func newMultipartUploader(s3 S3, config Config) *multipartUploader {
+	u := &multipartUploader{
+		s3:          s3,
+		bucket:      config.Bucket,
+		partSize:    config.UploadPartSize,
+		concurrency: config.UploadConcurrency,
+
+		sse:          optionalString(config.ServerSideEncryption),
+		sseKMSKeyID:  optionalString(config.SSEKMSKeyID),
+		acl:          optionalString(config.ACL),
+		storageClass: optionalString(config.StorageClass),
+	}
+	if config.UploadBandwidth > 0 {
+		bps := int(config.UploadBandwidth.Bytes())
+		u.limiter = rate.NewLimiter(rate.Limit(bps), bps)
+	}
+	u.bufs.New = func() interface{} {
+		b := make([]byte, u.partSize)
+		return &b
+	}
+	return u
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func (u *multipartUploader) newPartSource(src io.Reader) partSource {
+	if r, ok := src.(sizedReaderAt); ok {
+		partSize := u.partSize
+		// Grow parts of very large blobs to stay within the S3 part limit.
+		if minPartSize := (r.Size() + _maxParts - 1) / _maxParts; minPartSize > partSize {
+			partSize = minPartSize
+		}
+		return &sectionSource{r: r, partSize: partSize}
+	}
+	return &bufferSource{r: src, pool: &u.bufs}
+}
+
+// upload uploads src to key. Blobs which fit into a single part are uploaded
+// with a single PutObject request.
+func (u *multipartUploader) upload(key string, src io.Reader) error {
+	parts := u.newPartSource(src)
+	first, err := parts.next()
+	if err != nil {
+		return fmt.Errorf("read part: %s", err)
+	}
+	if first.size < u.partSize {
+		defer u.release(first)
+		if err := u.wait(context.Background(), first.size); err != nil {
+			return err
+		}
+		_, err := u.s3.PutObject(&s3.PutObjectInput{
+			Bucket:               aws.String(u.bucket),
+			Key:                  aws.String(key),
+			Body:                 first.body,
+			ServerSideEncryption: u.sse,
+			SSEKMSKeyId:          u.sseKMSKeyID,
+			ACL:                  u.acl,
+			StorageClass:         u.storageClass,
+		})
+		return err
+	}
+
+	output, err := u.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(u.bucket),
+		Key:                  aws.String(key),
+		ServerSideEncryption: u.sse,
+		SSEKMSKeyId:          u.sseKMSKeyID,
+		ACL:                  u.acl,
+		StorageClass:         u.storageClass,
+	})
+	if err != nil {
+		u.release(first)
+		return fmt.Errorf("create multipart upload: %s", err)
+	}
+	completed, err := u.uploadParts(key, output.UploadId, first, parts)
+	if err != nil {
+		// Delete the parts if the upload fails.
+		if _, abortErr := u.s3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(u.bucket),
+			Key:      aws.String(key),
+			UploadId: output.UploadId,
+		}); abortErr != nil {
+			log.With("key", key).Errorf("Error aborting multipart upload: %s", abortErr)
+		}
+		return err
+	}
+	if _, err := u.s3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(key),
+		UploadId:        output.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	}); err != nil {
+		return fmt.Errorf("complete multipart upload: %s", err)
+	}
+	return nil
+}
+
+func (u *multipartUploader) uploadParts(
+	key string, uploadID *string, first *part, parts partSource) ([]*s3.CompletedPart, error) {
+
+	var mu sync.Mutex
+	var completed []*s3.CompletedPart
+
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(u.concurrency)
+
+	var readErr error
+	for p := first; p != nil; {
+		if p.num > _maxParts {
+			u.release(p)
+			readErr = errors.New("upload exceeds maximum number of parts")
+			break
+		}
+		p := p
+		g.Go(func() error {
+			defer u.release(p)
+			if err := u.wait(ctx, p.size); err != nil {
+				return err
+			}
+			output, err := u.s3.UploadPart(&s3.UploadPartInput{
+				Bucket:     aws.String(u.bucket),
+				Key:        aws.String(key),
+				UploadId:   uploadID,
+				PartNumber: aws.Int64(p.num),
+				Body:       p.body,
+			})
+			if err != nil {
+				return fmt.Errorf("upload part %d: %s", p.num, err)
+			}
+			mu.Lock()
+			completed = append(completed, &s3.CompletedPart{
+				ETag:       output.ETag,
+				PartNumber: aws.Int64(p.num),
+			})
+			mu.Unlock()
+			return nil
+		})
+		if ctx.Err() != nil {
+			break
+		}
+		next, err := parts.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			readErr = fmt.Errorf("read part: %s", err)
+			break
+		}
+		p = next
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return *completed[i].PartNumber < *completed[j].PartNumber
+	})
+	return completed, nil
+}
+
+// wait blocks until n bytes of upload bandwidth are available.
+func (u *multipartUploader) wait(ctx context.Context, n int64) error {
+	if u.limiter == nil {
+		return nil
+	}
+	for n > 0 {
+		c := n
+		if burst := int64(u.limiter.Burst()); c > burst {
+			c = burst
+		}
+		if err := u.limiter.WaitN(ctx, int(c)); err != nil {
+			return fmt.Errorf("wait for bandwidth: %s", err)
+		}
+		n -= c
+	}
+	return nil
+}
+
+func (u *multipartUploader) release(p *part) {
+	if p.buf != nil {
+		u.bufs.Put(p.buf)
+	}
+}
@@ -30,9 +30,14 @@ type S3 interface {
 		input *s3.GetObjectInput,
 		options ...func(*s3manager.Downloader)) (n int64, err error)
 
-	Upload(
-		input *s3manager.UploadInput,
-		options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
+	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+
+	CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error)
 
 	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
 }
@@ -40,7 +45,6 @@ type S3 interface {
 type join struct {
 	s3iface.S3API
 	*s3manager.Downloader
-	*s3manager.Uploader
 }
 
 var _ S3 = (*join)(nil)
@@ -0,0 +1,147 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package s3backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// _v2SubResources are the query parameters included in the canonical resource
+// of signature version 2 requests.
+var _v2SubResources = map[string]bool{
+	"acl":                          true,
+	"delete":                       true,
+	"lifecycle":                    true,
+	"location":                     true,
+	"logging":                      true,
+	"notification":                 true,
+	"partNumber":                   true,
+	"policy":                       true,
+	"requestPayment":               true,
+	"response-cache-control":       true,
+	"response-content-disposition": true,
+	"response-content-encoding":    true,
+	"response-content-language":    true,
+	"response-content-type":        true,
+	"response-expires":             true,
+	"torrent":                      true,
+	"uploadId":                     true,
+	"uploads":                      true,
+	"versionId":                    true,
+	"versioning":                   true,
+	"versions":                     true,
+	"website":                      true,
+}
+
+// newV2Signer returns a request handler which signs S3 requests against bucket
+// using signature version 2, which some S3-compatible gateways still require
+// in place of version 4.
+func newV2Signer(bucket string, now func() time.Time) func(*request.Request) {
+	return func(r *request.Request) {
+		if r.Config.Credentials == credentials.AnonymousCredentials {
+			return
+		}
+		creds, err := r.Config.Credentials.Get()
+		if err != nil {
+			r.Error = err
+			return
+		}
+		req := r.HTTPRequest
+		req.Header.Del("X-Amz-Date")
+		req.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+		if creds.SessionToken != "" {
+			req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+		}
+		mac := hmac.New(sha1.New, []byte(creds.SecretAccessKey))
+		mac.Write([]byte(stringToSignV2(req, bucket)))
+		signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		req.Header.Set("Authorization", "AWS "+creds.AccessKeyID+":"+signature)
+	}
+}
+
+// stringToSignV2 returns the string signed for req under signature version 2.
+func stringToSignV2(req *http.Request, bucket string) string {
+	var b strings.Builder
+	b.WriteString(req.Method + "\n")
+	b.WriteString(req.Header.Get("Content-MD5") + "\n")
+	b.WriteString(req.Header.Get("Content-Type") + "\n")
+	b.WriteString(req.Header.Get("Date") + "\n")
+	b.WriteString(canonicalAmzHeadersV2(req.Header))
+	b.WriteString(canonicalResourceV2(req.URL, bucket))
+	return b.String()
+}
+
+// canonicalAmzHeadersV2 returns the sorted, lower-cased x-amz-* headers of h,
+// one per line.
+func canonicalAmzHeadersV2(h http.Header) string {
+	var keys []string
+	values := make(map[string]string)
+	for k, v := range h {
+		lk := strings.ToLower(k)
+		if !strings.HasPrefix(lk, "x-amz-") {
+			continue
+		}
+		keys = append(keys, lk)
+		values[lk] = strings.Join(v, ",")
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + ":" + strings.TrimSpace(values[k]) + "\n")
+	}
+	return b.String()
+}
+
+// canonicalResourceV2 returns the bucket qualified path of u followed by any
+// signed sub-resources. Virtual-hosted style requests carry the bucket in the
+// host, so it is prepended to the path.
+func canonicalResourceV2(u *url.URL, bucket string) string {
+	resource := u.EscapedPath()
+	if resource == "" {
+		resource = "/"
+	}
+	if strings.HasPrefix(u.Host, bucket+".") {
+		resource = "/" + bucket + resource
+	}
+	query := u.Query()
+	var keys []string
+	for k := range query {
+		if _v2SubResources[k] {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return resource
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		if v := query.Get(k); v != "" {
+			params = append(params, k+"="+v)
+		} else {
+			params = append(params, k)
+		}
+	}
+	return resource + "?" + strings.Join(params, "&")
+}
@@ -0,0 +1,415 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sftpbackend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/pkg/sftp"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/yaml.v2"
+)
+
+const _sftp = "sftp"
+
+func init() {
+	backend.Register(_sftp, &factory{})
+}
+
+type factory struct{}
+
+func (f *factory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal sftp config")
+	}
+	authConfBytes, err := yaml.Marshal(masterAuthConfig[_sftp])
+	if err != nil {
+		return nil, errors.New("marshal sftp auth config")
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal sftp config")
+	}
+	var userAuth UserAuthConfig
+	if err := yaml.Unmarshal(authConfBytes, &userAuth); err != nil {
+		return nil, errors.New("unmarshal sftp auth config")
+	}
+
+	return NewClient(config, userAuth, stats)
+}
+
+// Client implements a backend.Client for SFTP servers.
+type Client struct {
+	config Config
+	pather namepath.Pather
+	stats  tally.Scope
+	dial   Dialer
+	pool   *pool
+}
+
+// Option allows setting optional Client parameters.
+type Option func(*Client)
+
+// WithDialer configures a Client with a custom Dialer.
+func WithDialer(dial Dialer) Option {
+	return func(c *Client) { c.dial = dial }
+}
+
+// NewClient creates a new Client for SFTP.
+func NewClient(
+	config Config, userAuth UserAuthConfig, stats tally.Scope, opts ...Option) (*Client, error) {
+
+	config.applyDefaults()
+	if config.Username == "" {
+		return nil, errors.New("invalid config: username required")
+	}
+	if !path.IsAbs(config.RootDirectory) {
+		return nil, errors.New("invalid config: root_directory must be absolute path")
+	}
+
+	pather, err := namepath.New(config.RootDirectory, config.NamePath)
+	if err != nil {
+		return nil, fmt.Errorf("namepath: %s", err)
+	}
+
+	client := &Client{
+		config: config,
+		pather: pather,
+		stats:  stats,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if client.dial == nil {
+		auth, ok := userAuth[config.Username]
+		if !ok {
+			return nil, errors.New("auth not configured for username")
+		}
+		sshConfig, err := newSSHConfig(config, auth)
+		if err != nil {
+			return nil, err
+		}
+		client.dial = func() (*sftp.Client, io.Closer, error) {
+			return dialSSH(config.Address, sshConfig)
+		}
+	}
+	client.pool = newPool(config.PoolSize, client.dial)
+
+	return client, nil
+}
+
+func newSSHConfig(config Config, auth AuthConfig) (*ssh.ClientConfig, error) {
+	if config.Address == "" {
+		return nil, errors.New("invalid config: address required")
+	}
+	if auth.SFTP.User == "" {
+		return nil, errors.New("invalid auth config: user required")
+	}
+	if auth.SFTP.PrivateKey == "" {
+		return nil, errors.New("invalid auth config: private_key required")
+	}
+	signer, err := parsePrivateKey([]byte(auth.SFTP.PrivateKey), auth.SFTP.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth config: parse private key: %s", err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case config.KnownHosts != "":
+		hostKeyCallback, err = knownhosts.New(config.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: known_hosts: %s", err)
+		}
+	case config.InsecureIgnoreHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, errors.New("invalid config: known_hosts required")
+	}
+
+	return &ssh.ClientConfig{
+		User:            auth.SFTP.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         config.DialTimeout,
+	}, nil
+}
+
+func parsePrivateKey(key []byte, passphrase string) (ssh.Signer, error) {
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(key)
+}
+
+func dialSSH(addr string, config *ssh.ClientConfig) (*sftp.Client, io.Closer, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	sshClient, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ssh dial: %s", err)
+	}
+	sc, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, nil, fmt.Errorf("sftp session: %s", err)
+	}
+	return sc, sshClient, nil
+}
+
+// do runs f with a pooled SFTP session.
+func (c *Client) do(f func(sc *sftp.Client) error) error {
+	conn, err := c.pool.get()
+	if err != nil {
+		return fmt.Errorf("connect: %s", err)
+	}
+	err = f(conn.sftp)
+	c.pool.put(conn, err)
+	return err
+}
+
+// Stat returns blob info for name.
+func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("blob path: %s", err)
+	}
+	var info os.FileInfo
+	if err := c.do(func(sc *sftp.Client) (err error) {
+		info, err = sc.Stat(p)
+		return err
+	}); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, backenderrors.ErrBlobNotFound
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, backenderrors.ErrBlobNotFound
+	}
+	return core.NewBlobInfo(info.Size()), nil
+}
+
+// Download downloads the content of name and writes the data to dst.
+func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	err = c.do(func(sc *sftp.Client) error {
+		f, err := sc.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = f.WriteTo(dst)
+		return err
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return backenderrors.ErrBlobNotFound
+	}
+	return err
+}
+
+// DownloadRange downloads length bytes of name starting at offset into dst.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	err = c.do(func(sc *sftp.Client) error {
+		f, err := sc.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("seek: %w", err)
+		}
+		n, err := io.CopyN(dst, f, length)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return backend.CheckRangeLength(length, n)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return backenderrors.ErrBlobNotFound
+	}
+	return err
+}
+
+// Upload uploads src as name. Data is written to a temporary file next to the
+// blob and renamed into place, so readers never observe a partial blob.
+func (c *Client) Upload(namespace, name string, src io.Reader) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	tmp := path.Join(path.Dir(p), fmt.Sprintf(".%s.%s", path.Base(p), uuid.NewV4().String()))
+
+	return c.do(func(sc *sftp.Client) error {
+		if err := sc.MkdirAll(path.Dir(p)); err != nil {
+			return fmt.Errorf("mkdir: %w", err)
+		}
+		if err := writeFile(sc, tmp, src); err != nil {
+			sc.Remove(tmp)
+			return fmt.Errorf("write %s: %w", tmp, err)
+		}
+		if err := rename(sc, tmp, p); err != nil {
+			sc.Remove(tmp)
+			return fmt.Errorf("rename: %w", err)
+		}
+		return nil
+	})
+}
+
+// UploadStream uploads src as name. src is written to the server as it is
+// read, so its length need not be known upfront.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Upload(namespace, name, src)
+}
+
+// Delete deletes name.
+func (c *Client) Delete(namespace, name string) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	if err := c.do(func(sc *sftp.Client) error {
+		return sc.Remove(p)
+	}); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func writeFile(sc *sftp.Client, p string, src io.Reader) error {
+	f, err := sc.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := f.ReadFrom(src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rename renames oldname to newname, replacing newname if it exists. Servers
+// without the posix-rename extension fall back to remove and rename, which
+// briefly exposes a missing blob but never a partial one.
+func rename(sc *sftp.Client, oldname, newname string) error {
+	if _, ok := sc.HasExtension("posix-rename@openssh.com"); ok {
+		return sc.PosixRename(oldname, newname)
+	}
+	if err := sc.Rename(oldname, newname); err == nil {
+		return nil
+	}
+	if err := sc.Remove(newname); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return sc.Rename(oldname, newname)
+}
+
+// List lists names under the prefix directory. SFTP has no native pagination,
+// so all names are listed and paginated results are sliced in name order,
+// with the last returned name as continuation token.
+func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	options := backend.DefaultListOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	var names []string
+	root := path.Join(c.pather.BasePath(), prefix)
+	if err := c.do(func(sc *sftp.Client) error {
+		names = nil
+		w := sc.Walk(root)
+		for w.Step() {
+			if err := w.Err(); err != nil {
+				return err
+			}
+			if w.Stat().IsDir() || strings.HasPrefix(path.Base(w.Path()), ".") {
+				// Skip directories and in-flight uploads.
+				continue
+			}
+			name, err := c.pather.NameFromBlobPath(w.Path())
+			if err != nil {
+				log.With("path", w.Path()).Errorf("Error converting blob path into name: %s", err)
+				continue
+			}
+			names = append(names, name)
+		}
+		return nil
+	}); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &backend.ListResult{}, nil
+		}
+		return nil, err
+	}
+	sort.Strings(names)
+
+	if !options.Paginated {
+		return &backend.ListResult{Names: names}, nil
+	}
+	start := sort.SearchStrings(names, options.ContinuationToken)
+	if start < len(names) && names[start] == options.ContinuationToken {
+		start++
+	}
+	end := start + options.MaxKeys
+	if end >= len(names) {
+		return &backend.ListResult{Names: names[start:]}, nil
+	}
+	return &backend.ListResult{
+		Names:             names[start:end],
+		ContinuationToken: names[end-1],
+	}, nil
+}
+
+// Close closes all idle SFTP sessions.
+func (c *Client) Close() error {
+	c.pool.close()
+	return nil
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sftpbackend
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// newTestDialer returns a Dialer which serves every session from the same
+// in-memory filesystem over pipes, and a function returning the number of
+// sessions dialed.
+func newTestDialer() (Dialer, func() int) {
+	handlers := sftp.InMemHandler()
+	var mu sync.Mutex
+	var dials int
+	dial := func() (*sftp.Client, io.Closer, error) {
+		mu.Lock()
+		dials++
+		mu.Unlock()
+
+		cr, sw := io.Pipe()
+		sr, cw := io.Pipe()
+		server := sftp.NewRequestServer(pipeConn{sr, sw}, handlers)
+		go server.Serve()
+		sc, err := sftp.NewClientPipe(cr, cw)
+		if err != nil {
+			server.Close()
+			return nil, nil, err
+		}
+		return sc, server, nil
+	}
+	return dial, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return dials
+	}
+}
+
+func newTestClient(t *testing.T, dial Dialer) *Client {
+	config := Config{
+		Username:      "test-user",
+		RootDirectory: "/root",
+		NamePath:      "identity",
+	}
+	c, err := NewClient(config, UserAuthConfig{}, tally.NoopScope, WithDialer(dial))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func privateKeyFixture(t *testing.T) string {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(block))
+}
+
+func TestClientFactory(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Username:              "test-user",
+		Address:               "localhost:22",
+		NamePath:              "identity",
+		RootDirectory:         "/root",
+		InsecureIgnoreHostKey: true,
+	}
+	var auth AuthConfig
+	auth.SFTP.User = "kraken"
+	auth.SFTP.PrivateKey = privateKeyFixture(t)
+	masterAuth := backend.AuthConfig{_sftp: UserAuthConfig{"test-user": auth}}
+	f := factory{}
+	_, err := f.Create(config, masterAuth, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+}
+
+func TestNewClientConfigErrors(t *testing.T) {
+	var auth AuthConfig
+	auth.SFTP.User = "kraken"
+	auth.SFTP.PrivateKey = privateKeyFixture(t)
+
+	var badKey AuthConfig
+	badKey.SFTP.User = "kraken"
+	badKey.SFTP.PrivateKey = "not a key"
+
+	config := Config{
+		Username:      "test-user",
+		Address:       "localhost:22",
+		NamePath:      "identity",
+		RootDirectory: "/root",
+	}
+	tests := []struct {
+		desc   string
+		config func(Config) Config
+		auth   AuthConfig
+	}{
+		{
+			"missing known hosts",
+			func(c Config) Config { return c },
+			auth,
+		}, {
+			"relative root directory",
+			func(c Config) Config {
+				c.InsecureIgnoreHostKey = true
+				c.RootDirectory = "root"
+				return c
+			},
+			auth,
+		}, {
+			"invalid private key",
+			func(c Config) Config {
+				c.InsecureIgnoreHostKey = true
+				return c
+			},
+			badKey,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewClient(
+				test.config(config), UserAuthConfig{"test-user": test.auth}, tally.NoopScope)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestClientUploadDownload(t *testing.T) {
+	require := require.New(t)
+
+	dial, _ := newTestDialer()
+	client := newTestClient(t, dial)
+
+	_, err := client.Stat(core.NamespaceFixture(), "a/b/test")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	data := randutil.Text(64)
+	require.NoError(client.Upload(core.NamespaceFixture(), "a/b/test", bytes.NewReader(data)))
+
+	info, err := client.Stat(core.NamespaceFixture(), "a/b/test")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(64), info)
+
+	var b bytes.Buffer
+	require.NoError(client.Download(core.NamespaceFixture(), "a/b/test", &b))
+	require.Equal(data, b.Bytes())
+
+	require.Equal(backenderrors.ErrBlobNotFound,
+		client.Download(core.NamespaceFixture(), "a/b/missing", &b))
+}
+
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	dial, _ := newTestDialer()
+	client := newTestClient(t, dial)
+
+	data := randutil.Text(64)
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 16, 8, &b))
+	require.Equal(data[16:24], b.Bytes())
+
+	// Ranges past the end of the blob are rejected.
+	b.Reset()
+	err := client.DownloadRange(core.NamespaceFixture(), "test", 60, 8, &b)
+	require.True(errors.Is(err, backend.ErrShortRange))
+
+	require.Equal(backenderrors.ErrBlobNotFound,
+		client.DownloadRange(core.NamespaceFixture(), "missing", 0, 8, &b))
+}
+
+func TestClientUploadOverwrites(t *testing.T) {
+	require := require.New(t)
+
+	dial, _ := newTestDialer()
+	client := newTestClient(t, dial)
+
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(randutil.Text(64))))
+
+	data := randutil.Text(32)
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+
+	var b bytes.Buffer
+	require.NoError(client.Download(core.NamespaceFixture(), "test", &b))
+	require.Equal(data, b.Bytes())
+
+	// No temporary files are left behind.
+	result, err := client.List("")
+	require.NoError(err)
+	require.Equal([]string{"test"}, result.Names)
+}
+
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	dial, _ := newTestDialer()
+	client := newTestClient(t, dial)
+
+	require.NoError(client.Upload(core.NamespaceFixture(), "a/b/test", bytes.NewReader(randutil.Text(64))))
+	require.NoError(client.Delete(core.NamespaceFixture(), "a/b/test"))
+
+	_, err := client.Stat(core.NamespaceFixture(), "a/b/test")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	require.Equal(backenderrors.ErrBlobNotFound, client.Delete(core.NamespaceFixture(), "a/b/test"))
+}
+
+func TestClientReusesSessions(t *testing.T) {
+	require := require.New(t)
+
+	dial, dials := newTestDialer()
+	client := newTestClient(t, dial)
+
+	for i := 0; i < 10; i++ {
+		_, err := client.Stat(core.NamespaceFixture(), "missing")
+		require.Equal(backenderrors.ErrBlobNotFound, err)
+	}
+	require.Equal(1, dials())
+}
+
+func TestClientList(t *testing.T) {
+	require := require.New(t)
+
+	dial, _ := newTestDialer()
+	client := newTestClient(t, dial)
+
+	names := []string{"test/a", "test/b/c", "test/b/d", "test/e"}
+	for _, name := range names {
+		require.NoError(client.Upload(core.NamespaceFixture(), name, bytes.NewReader(randutil.Text(8))))
+	}
+	require.NoError(client.Upload(core.NamespaceFixture(), "other", bytes.NewReader(randutil.Text(8))))
+
+	result, err := client.List("test")
+	require.NoError(err)
+	require.Equal(names, result.Names)
+
+	result, err = client.List("test", backend.ListWithPagination(), backend.ListWithMaxKeys(3))
+	require.NoError(err)
+	require.Equal(names[:3], result.Names)
+	require.Equal("test/b/d", result.ContinuationToken)
+
+	result, err = client.List("test",
+		backend.ListWithPagination(),
+		backend.ListWithMaxKeys(3),
+		backend.ListWithContinuationToken(result.ContinuationToken))
+	require.NoError(err)
+	require.Equal(names[3:], result.Names)
+	require.Equal("", result.ContinuationToken)
+
+	result, err = client.List("missing")
+	require.NoError(err)
+	require.Empty(result.Names)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sftpbackend
+
+import "time"
+
+// Config defines SFTP server connection parameters.
+type Config struct {
+	// Username selects credentials from UserAuthConfig.
+	Username string `yaml:"username"`
+
+	// Address is the host:port of the SSH server.
+	Address string `yaml:"address"`
+
+	RootDirectory string `yaml:"root_directory"` // Root directory for docker images on the server
+
+	// NamePath identifies which namepath.Pather to use.
+	NamePath string `yaml:"name_path"`
+
+	// KnownHosts is the path to a known_hosts file used to verify the server's
+	// host key. Required unless InsecureIgnoreHostKey is set.
+	KnownHosts string `yaml:"known_hosts"`
+
+	// InsecureIgnoreHostKey disables host key verification. Only intended for
+	// testing.
+	InsecureIgnoreHostKey bool `yaml:"insecure_ignore_host_key"`
+
+	// PoolSize is the maximum number of SSH connections kept open to the server.
+	PoolSize int `yaml:"pool_size"`
+
+	// DialTimeout bounds establishing a new SSH connection.
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+}
+
+// UserAuthConfig defines authentication configuration overlayed by Langley.
+// Each key is the username of the credentials.
+type UserAuthConfig map[string]AuthConfig
+
+// AuthConfig matches Langley format.
+type AuthConfig struct {
+	SFTP struct {
+		// User is the SSH login user.
+		User string `yaml:"user"`
+
+		// PrivateKey is a PEM encoded SSH private key.
+		PrivateKey string `yaml:"private_key"`
+
+		// Passphrase decrypts PrivateKey, if encrypted.
+		Passphrase string `yaml:"passphrase"`
+	} `yaml:"sftp"`
+}
+
+func (c *Config) applyDefaults() {
+	if c.PoolSize == 0 {
+		c.PoolSize = 4
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = 30 * time.Second
+	}
+}
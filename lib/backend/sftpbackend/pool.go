@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sftpbackend
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/pkg/sftp"
+)
+
+// conn is a pooled SFTP session along with the transport it runs over.
+type conn struct {
+	sftp      *sftp.Client
+	transport io.Closer
+}
+
+func (c *conn) close() {
+	c.sftp.Close()
+	if c.transport != nil {
+		c.transport.Close()
+	}
+}
+
+// Dialer establishes a new SFTP session. The returned io.Closer, if non-nil,
+// is closed after the session.
+type Dialer func() (*sftp.Client, io.Closer, error)
+
+// pool bounds the number of concurrent SFTP sessions and keeps idle sessions
+// open for reuse.
+type pool struct {
+	dial Dialer
+	sem  chan struct{}
+	idle chan *conn
+}
+
+func newPool(size int, dial Dialer) *pool {
+	return &pool{
+		dial: dial,
+		sem:  make(chan struct{}, size),
+		idle: make(chan *conn, size),
+	}
+}
+
+// get returns an idle session, or dials a new one if none are idle. Blocks
+// while size sessions are in use.
+func (p *pool) get() (*conn, error) {
+	p.sem <- struct{}{}
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+	sc, transport, err := p.dial()
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	return &conn{sc, transport}, nil
+}
+
+// put returns c to the pool. err is the result of the last operation on c,
+// and c is discarded if err may have left the session unusable.
+func (p *pool) put(c *conn, err error) {
+	defer func() { <-p.sem }()
+
+	if isSessionError(err) {
+		c.close()
+		return
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.close()
+	}
+}
+
+// close closes all idle sessions.
+func (p *pool) close() {
+	for {
+		select {
+		case c := <-p.idle:
+			c.close()
+		default:
+			return
+		}
+	}
+}
+
+// isSessionError returns true if err is not a status reported by the server,
+// i.e. the session itself may be broken.
+func isSessionError(err error) bool {
+	if err == nil ||
+		errors.Is(err, os.ErrNotExist) ||
+		errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	var statusErr *sftp.StatusError
+	return !errors.As(err, &statusErr)
+}
@@ -241,6 +241,20 @@ func (c *Client) Download(namespace string, name string, dst io.Writer) error {
 	return err
 }
 
+// DownloadRange gets a range of the data from the active backend and writes it
+// to the output writer.
+func (c *Client) DownloadRange(
+	namespace string, name string, offset, length int64, dst io.Writer) error {
+
+	return c.active.DownloadRange(namespace, name, offset, length, dst)
+}
+
+// UploadStream upserts the data into the backend. src is spooled first, since
+// it is uploaded to both the active and the shadow backend.
+func (c *Client) UploadStream(namespace string, name string, src io.Reader) error {
+	return backend.FallbackUploadStream(c, namespace, name, src)
+}
+
 // Upload upserts the data into the backend.
 func (c *Client) Upload(namespace string, name string, src io.Reader) error {
 	rs, ok := src.(io.ReadSeeker)
@@ -267,6 +281,14 @@ func (c *Client) Upload(namespace string, name string, src io.Reader) error {
 	return nil
 }
 
+// Delete deletes name from both backends, failing if either delete fails.
+func (c *Client) Delete(namespace string, name string) error {
+	if err := c.active.Delete(namespace, name); err != nil {
+		return err
+	}
+	return c.shadow.Delete(namespace, name)
+}
+
 // List lists names with start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	res, err := c.active.List(prefix, opts...)
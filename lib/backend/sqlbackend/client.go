@@ -190,6 +190,20 @@ func (c *Client) Download(_, name string, dst io.Writer) error {
 	return nil
 }
 
+// DownloadRange downloads a range of the tag value of name. Tag values are
+// short, so the row is read in full and sliced.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return backend.FallbackDownloadRange(c, namespace, name, offset, length, dst)
+}
+
+// UploadStream upserts the tag into the database. Tags are small, so src is
+// read into memory as with Upload.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Upload(namespace, name, src)
+}
+
 // Upload upserts the tag into the database.
 func (c *Client) Upload(_, name string, src io.Reader) error {
 	repo, tag, err := decomposeDockerTag(name)
@@ -223,6 +237,28 @@ func (c *Client) Upload(_, name string, src io.Reader) error {
 	return nil
 }
 
+// Delete deletes the tag from the database.
+func (c *Client) Delete(_, name string) error {
+	repo, tag, err := decomposeDockerTag(name)
+	if err != nil {
+		return fmt.Errorf("tag path: %s. Err was %s", name, err)
+	}
+
+	res := c.db.
+		Where(Tag{Repository: repo, Tag: tag}).
+		Delete(Tag{})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return backenderrors.ErrBlobNotFound
+	}
+
+	return nil
+}
+
 // List lists names with start with prefix.
 func (c *Client) List(prefix string, _ ...backend.ListOption) (*backend.ListResult, error) {
 
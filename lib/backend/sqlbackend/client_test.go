@@ -191,6 +191,24 @@ func TestUploadBadTagName(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDelete(t *testing.T) {
+	sqlClient := newClient()
+	defer closers.Close(sqlClient)
+	tag := generateSingleTag(sqlClient, "hulk", "smash")
+	other := generateSingleTag(sqlClient, "hulk", "calm")
+
+	name := fmt.Sprintf("%s:%s", tag.Repository, tag.Tag)
+	assert.NoError(t, sqlClient.Delete("", name))
+
+	_, err := sqlClient.Stat("", name)
+	assert.EqualError(t, err, backenderrors.ErrBlobNotFound.Error())
+
+	_, err = sqlClient.Stat("", fmt.Sprintf("%s:%s", other.Repository, other.Tag))
+	assert.NoError(t, err)
+
+	assert.EqualError(t, sqlClient.Delete("", name), backenderrors.ErrBlobNotFound.Error())
+}
+
 func TestListCatalog(t *testing.T) {
 	sqlClient := newClient()
 	defer closers.Close(sqlClient)
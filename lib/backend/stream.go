@@ -0,0 +1,42 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uber/kraken/utils/closers"
+)
+
+// FallbackUploadStream implements Client.UploadStream for clients which must
+// know the length of src, or be able to rewind it, before uploading. src is
+// spooled to a temporary file, which is then uploaded with Upload.
+func FallbackUploadStream(c Client, namespace, name string, src io.Reader) error {
+	f, err := os.CreateTemp("", "kraken-upload-")
+	if err != nil {
+		return fmt.Errorf("create spool file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer closers.Close(f)
+
+	if _, err := io.Copy(f, src); err != nil {
+		return fmt.Errorf("spool src: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek spool file: %s", err)
+	}
+	return c.Upload(namespace, name, f)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/uber/kraken/lib/backend"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackUploadStream(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var spool string
+	client := mockbackend.NewMockClient(ctrl)
+	client.EXPECT().Upload("ns", "name", gomock.Any()).DoAndReturn(
+		func(namespace, name string, src io.Reader) error {
+			f, ok := src.(*os.File)
+			require.True(ok)
+			spool = f.Name()
+			b, err := io.ReadAll(src)
+			require.NoError(err)
+			require.Equal("some blob", string(b))
+			return nil
+		})
+
+	// Hide the concrete type of the source, as a producer of unknown length would.
+	src := struct{ io.Reader }{strings.NewReader("some blob")}
+	require.NoError(FallbackUploadStream(client, "ns", "name", src))
+
+	_, err := os.Stat(spool)
+	require.True(os.IsNotExist(err))
+}
+
+func TestFallbackUploadStreamUploadError(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := mockbackend.NewMockClient(ctrl)
+	client.EXPECT().Upload("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+	require.Error(FallbackUploadStream(client, "ns", "name", strings.NewReader("some blob")))
+}
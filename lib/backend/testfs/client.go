@@ -113,6 +113,25 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return err
 }
 
+// UploadStream uploads src to name using chunked transfer encoding.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return c.Upload(namespace, name, src)
+}
+
+// Delete deletes name.
+func (c *Client) Delete(namespace, name string) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("pather: %s", err)
+	}
+	_, err = httputil.Delete(
+		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p))
+	if httputil.IsNotFound(err) {
+		return backenderrors.ErrBlobNotFound
+	}
+	return err
+}
+
 // Download downloads name to dst.
 func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	p, err := c.pather.BlobPath(name)
@@ -134,6 +153,14 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return nil
 }
 
+// DownloadRange downloads a range of name into dst via the testfs download
+// endpoint.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return backend.FallbackDownloadRange(c, namespace, name, offset, length, dst)
+}
+
 // List lists names starting with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	options := backend.DefaultListOptions()
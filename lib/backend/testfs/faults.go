@@ -0,0 +1,188 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package testfs
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Faults defines failures which a Server injects into file operations, so
+// retry, repair and timeout paths can be exercised deterministically. Faults
+// can be changed at runtime through the /faults admin endpoint, e.g.
+//
+//	curl -X POST 'localhost:<port>/faults?fail_count=3&error_status=503'
+//	curl -X DELETE localhost:<port>/faults
+type Faults struct {
+	// FailCount fails the next FailCount requests with ErrorStatus.
+	FailCount int `json:"fail_count"`
+
+	// ErrorRate is the probability in [0, 1] that a request fails with
+	// ErrorStatus.
+	ErrorRate float64 `json:"error_rate"`
+
+	// ErrorStatus is the status of injected failures. Defaults to 500.
+	ErrorStatus int `json:"error_status"`
+
+	// Latency delays every request.
+	Latency time.Duration `json:"latency"`
+
+	// TruncateRate is the probability in [0, 1] that a download only returns
+	// half of the file, while still advertising its full length.
+	TruncateRate float64 `json:"truncate_rate"`
+
+	// Seed seeds the random source ErrorRate and TruncateRate are sampled
+	// from, so sequences of failures are reproducible.
+	Seed int64 `json:"seed"`
+}
+
+func (f Faults) applyDefaults() Faults {
+	if f.ErrorStatus == 0 {
+		f.ErrorStatus = http.StatusInternalServerError
+	}
+	return f
+}
+
+func (f Faults) validate() error {
+	if f.FailCount < 0 {
+		return errors.New("fail_count must not be negative")
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return errors.New("error_rate must be within [0, 1]")
+	}
+	if f.TruncateRate < 0 || f.TruncateRate > 1 {
+		return errors.New("truncate_rate must be within [0, 1]")
+	}
+	if f.ErrorStatus < 400 || f.ErrorStatus > 599 {
+		return errors.New("error_status must be a 4xx or 5xx status")
+	}
+	if f.Latency < 0 {
+		return errors.New("latency must not be negative")
+	}
+	return nil
+}
+
+// parseFaults parses Faults from the query arguments of r.
+func parseFaults(r *http.Request) (Faults, error) {
+	var f Faults
+	query := r.URL.Query()
+	var err error
+	if v := query.Get("fail_count"); v != "" {
+		if f.FailCount, err = strconv.Atoi(v); err != nil {
+			return f, errors.New("invalid fail_count")
+		}
+	}
+	if v := query.Get("error_rate"); v != "" {
+		if f.ErrorRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return f, errors.New("invalid error_rate")
+		}
+	}
+	if v := query.Get("error_status"); v != "" {
+		if f.ErrorStatus, err = strconv.Atoi(v); err != nil {
+			return f, errors.New("invalid error_status")
+		}
+	}
+	if v := query.Get("latency"); v != "" {
+		if f.Latency, err = time.ParseDuration(v); err != nil {
+			return f, errors.New("invalid latency")
+		}
+	}
+	if v := query.Get("truncate_rate"); v != "" {
+		if f.TruncateRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return f, errors.New("invalid truncate_rate")
+		}
+	}
+	if v := query.Get("seed"); v != "" {
+		if f.Seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, errors.New("invalid seed")
+		}
+	}
+	return f, nil
+}
+
+// faultInjector decides which faults to inject into each request.
+type faultInjector struct {
+	sync.Mutex
+	faults Faults
+	rand   *rand.Rand
+}
+
+func newFaultInjector() *faultInjector {
+	return &faultInjector{rand: rand.New(rand.NewSource(0))}
+}
+
+func (i *faultInjector) set(f Faults) error {
+	f = f.applyDefaults()
+	if err := f.validate(); err != nil {
+		return err
+	}
+	i.Lock()
+	defer i.Unlock()
+	i.faults = f
+	i.rand = rand.New(rand.NewSource(f.Seed))
+	return nil
+}
+
+func (i *faultInjector) get() Faults {
+	i.Lock()
+	defer i.Unlock()
+	return i.faults
+}
+
+// next returns the latency and error status, if any, to inject into the next
+// request.
+func (i *faultInjector) next() (latency time.Duration, status int) {
+	i.Lock()
+	defer i.Unlock()
+
+	if i.faults.FailCount > 0 {
+		i.faults.FailCount--
+		return i.faults.Latency, i.faults.ErrorStatus
+	}
+	if i.faults.ErrorRate > 0 && i.rand.Float64() < i.faults.ErrorRate {
+		return i.faults.Latency, i.faults.ErrorStatus
+	}
+	return i.faults.Latency, 0
+}
+
+// truncate returns whether the next download should be truncated.
+func (i *faultInjector) truncate() bool {
+	i.Lock()
+	defer i.Unlock()
+
+	return i.faults.TruncateRate > 0 && i.rand.Float64() < i.faults.TruncateRate
+}
+
+// middleware injects latency and failures into requests served by next.
+func (i *faultInjector) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		latency, status := i.next()
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if status != 0 {
+			http.Error(w, "injected fault", status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
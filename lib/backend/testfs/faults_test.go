@@ -0,0 +1,150 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package testfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newFaultsFixture(t *testing.T) (*Server, string, *Client) {
+	s := NewServer()
+	t.Cleanup(s.Cleanup)
+
+	addr, stop := testutil.StartServer(s.Handler())
+	t.Cleanup(stop)
+
+	c, err := NewClient(Config{Addr: addr, NamePath: namepath.Identity}, tally.NoopScope)
+	require.NoError(t, err)
+	t.Cleanup(func() { closers.Close(c) })
+
+	return s, addr, c
+}
+
+func TestFaultsFailCount(t *testing.T) {
+	require := require.New(t)
+
+	s, _, c := newFaultsFixture(t)
+
+	blob := core.NewBlobFixture()
+	ns := core.NamespaceFixture()
+	require.NoError(c.Upload(ns, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	require.NoError(s.SetFaults(Faults{FailCount: 2, ErrorStatus: http.StatusServiceUnavailable}))
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Stat(ns, blob.Digest.Hex())
+		require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+	}
+	_, err := c.Stat(ns, blob.Digest.Hex())
+	require.NoError(err)
+}
+
+func TestFaultsErrorRate(t *testing.T) {
+	require := require.New(t)
+
+	s, _, c := newFaultsFixture(t)
+
+	blob := core.NewBlobFixture()
+	ns := core.NamespaceFixture()
+	require.NoError(c.Upload(ns, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	require.NoError(s.SetFaults(Faults{ErrorRate: 1}))
+
+	_, err := c.Stat(ns, blob.Digest.Hex())
+	require.True(httputil.IsStatus(err, http.StatusInternalServerError))
+
+	// Same seed, same sequence of failures.
+	sample := func() []bool {
+		require.NoError(s.SetFaults(Faults{ErrorRate: 0.5, Seed: 7}))
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := c.Stat(ns, blob.Digest.Hex())
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+	require.Equal(sample(), sample())
+}
+
+func TestFaultsLatency(t *testing.T) {
+	require := require.New(t)
+
+	s, _, c := newFaultsFixture(t)
+
+	require.NoError(s.SetFaults(Faults{Latency: 100 * time.Millisecond}))
+
+	start := time.Now()
+	_, err := c.Stat(core.NamespaceFixture(), core.DigestFixture().Hex())
+	require.Error(err)
+	require.True(time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestFaultsTruncate(t *testing.T) {
+	require := require.New(t)
+
+	s, _, c := newFaultsFixture(t)
+
+	blob := core.SizedBlobFixture(1024, 256)
+	ns := core.NamespaceFixture()
+	require.NoError(c.Upload(ns, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	require.NoError(s.SetFaults(Faults{TruncateRate: 1}))
+
+	var b bytes.Buffer
+	require.Error(c.Download(ns, blob.Digest.Hex(), &b))
+	require.True(b.Len() < len(blob.Content))
+}
+
+func TestFaultsAdminEndpoint(t *testing.T) {
+	require := require.New(t)
+
+	s, addr, _ := newFaultsFixture(t)
+
+	_, err := httputil.Post(fmt.Sprintf(
+		"http://%s/faults?fail_count=3&error_status=503&latency=1s", addr))
+	require.NoError(err)
+	require.Equal(Faults{
+		FailCount:   3,
+		ErrorStatus: 503,
+		Latency:     time.Second,
+	}, s.Faults())
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/faults", addr))
+	require.NoError(err)
+	defer closers.Close(resp.Body)
+	var f Faults
+	require.NoError(json.NewDecoder(resp.Body).Decode(&f))
+	require.Equal(s.Faults(), f)
+
+	_, err = httputil.Post(fmt.Sprintf("http://%s/faults?error_rate=2", addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/faults", addr))
+	require.NoError(err)
+	require.Equal(Faults{ErrorStatus: http.StatusInternalServerError}, s.Faults())
+}
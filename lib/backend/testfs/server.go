@@ -35,7 +35,8 @@ import (
 // Server provides HTTP endpoints for operating on files on disk.
 type Server struct {
 	sync.RWMutex
-	dir string
+	dir    string
+	faults *faultInjector
 }
 
 // NewServer creates a new Server.
@@ -44,20 +45,37 @@ func NewServer() *Server {
 	if err != nil {
 		panic(err)
 	}
-	return &Server{dir: dir}
+	return &Server{dir: dir, faults: newFaultInjector()}
 }
 
 // Handler returns an HTTP handler for s.
 func (s *Server) Handler() http.Handler {
 	r := chi.NewRouter()
 	r.Get("/health", s.healthHandler)
-	r.Head("/files/*", handler.Wrap(s.statHandler))
-	r.Get("/files/*", handler.Wrap(s.downloadHandler))
-	r.Post("/files/*", handler.Wrap(s.uploadHandler))
-	r.Get("/list/*", handler.Wrap(s.listHandler))
+	r.Get("/faults", handler.Wrap(s.getFaultsHandler))
+	r.Post("/faults", handler.Wrap(s.setFaultsHandler))
+	r.Delete("/faults", handler.Wrap(s.clearFaultsHandler))
+	r.Group(func(r chi.Router) {
+		r.Use(s.faults.middleware)
+		r.Head("/files/*", handler.Wrap(s.statHandler))
+		r.Get("/files/*", handler.Wrap(s.downloadHandler))
+		r.Post("/files/*", handler.Wrap(s.uploadHandler))
+		r.Delete("/files/*", handler.Wrap(s.deleteHandler))
+		r.Get("/list/*", handler.Wrap(s.listHandler))
+	})
 	return r
 }
 
+// SetFaults replaces the faults s injects into file operations.
+func (s *Server) SetFaults(f Faults) error {
+	return s.faults.set(f)
+}
+
+// Faults returns the faults s currently injects into file operations.
+func (s *Server) Faults() Faults {
+	return s.faults.get()
+}
+
 // Cleanup cleans up the underlying directory of s.
 func (s *Server) Cleanup() {
 	err := os.RemoveAll(s.dir)
@@ -104,6 +122,20 @@ func (s *Server) downloadHandler(w http.ResponseWriter, r *http.Request) error {
 		}
 		return handler.Errorf("open: %s", err)
 	}
+	defer closers.Close(f)
+
+	if s.faults.truncate() {
+		info, err := f.Stat()
+		if err != nil {
+			return handler.Errorf("stat: %s", err)
+		}
+		// Advertise the full length, so clients observe an unexpected EOF.
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		if _, err := io.CopyN(w, f, info.Size()/2); err != nil {
+			return handler.Errorf("copy: %s", err)
+		}
+		return nil
+	}
 	if _, err := io.Copy(w, f); err != nil {
 		return handler.Errorf("copy: %s", err)
 	}
@@ -131,6 +163,21 @@ func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+func (s *Server) deleteHandler(w http.ResponseWriter, r *http.Request) error {
+	s.Lock()
+	defer s.Unlock()
+
+	name := r.URL.Path[len("/files/"):]
+
+	if err := os.Remove(s.path(name)); err != nil {
+		if os.IsNotExist(err) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("remove: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 	s.RLock()
 	defer s.RUnlock()
@@ -165,6 +212,33 @@ func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+func (s *Server) getFaultsHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.Faults()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) setFaultsHandler(w http.ResponseWriter, r *http.Request) error {
+	f, err := parseFaults(r)
+	if err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+	}
+	if err := s.SetFaults(f); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+	}
+	log.With("faults", f).Info("Set testfs faults")
+	return nil
+}
+
+func (s *Server) clearFaultsHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := s.SetFaults(Faults{}); err != nil {
+		return handler.Errorf("%s", err)
+	}
+	log.Info("Cleared testfs faults")
+	return nil
+}
+
 // path normalizes some file or directory entry into a path.
 func (s *Server) path(entry string) string {
 	// Allows listing tags by repo.
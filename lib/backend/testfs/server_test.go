@@ -55,6 +55,13 @@ func TestServerBlob(t *testing.T) {
 	info, err := c.Stat(ns, blob.Digest.Hex())
 	require.NoError(err)
 	require.Equal(int64(len(blob.Content)), info.Size)
+
+	require.NoError(c.Delete(ns, blob.Digest.Hex()))
+
+	_, err = c.Stat(ns, blob.Digest.Hex())
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	require.Equal(backenderrors.ErrBlobNotFound, c.Delete(ns, blob.Digest.Hex()))
 }
 
 func TestServerTag(t *testing.T) {
@@ -25,12 +25,24 @@ import (
 // ThrottledClient is a backend client with speed limit.
 type ThrottledClient struct {
 	Client
-	bandwidth *bandwidth.Limiter
+	bandwidth *bandwidth.Limiter // Limits of this backend. May be nil.
+	global    *bandwidth.Limiter // Limits shared by all backends. May be nil.
 }
 
-// throttle wraps client with bandwidth limits.
-func throttle(client Client, bandwidth *bandwidth.Limiter) *ThrottledClient {
-	return &ThrottledClient{client, bandwidth}
+// throttle wraps client with per-backend and global bandwidth limits, either of
+// which may be nil.
+func throttle(client Client, bandwidth, global *bandwidth.Limiter) *ThrottledClient {
+	return &ThrottledClient{client, bandwidth, global}
+}
+
+func (c *ThrottledClient) limiters() []*bandwidth.Limiter {
+	var limiters []*bandwidth.Limiter
+	for _, l := range []*bandwidth.Limiter{c.bandwidth, c.global} {
+		if l != nil {
+			limiters = append(limiters, l)
+		}
+	}
+	return limiters
 }
 
 type sizer interface {
@@ -40,43 +52,67 @@ type sizer interface {
 // Ensure that we can get size from file store readers.
 var _ sizer = (store.FileReader)(nil)
 
-// Upload uploads src into name.
+// Upload uploads src into name. Sized sources reserve bandwidth upfront, so
+// backends can still use any io.ReaderAt or io.Seeker which src implements.
+// Other sources are throttled as they are read.
 func (c *ThrottledClient) Upload(namespace, name string, src io.Reader) error {
-	if s, ok := src.(sizer); ok {
-		// Only throttle if the src implements a Size method.
-		if err := c.bandwidth.ReserveEgress(s.Size()); err != nil {
-			log.With("name", name).Errorf("Error reserving egress: %s", err)
-			// Ignore error.
+	for _, l := range c.limiters() {
+		if s, ok := src.(sizer); ok {
+			if err := l.WaitEgress(s.Size()); err != nil {
+				log.With("name", name).Errorf("Error reserving egress: %s", err)
+				// Ignore error.
+			}
+		} else {
+			src = l.EgressReader(src)
 		}
 	}
 	return c.Client.Upload(namespace, name, src)
 }
 
-// Download downloads name into dst.
-func (c *ThrottledClient) Download(namespace, name string, dst io.Writer) error {
-	info, err := c.Stat(namespace, name)
-	if err != nil {
-		return err
+// UploadStream uploads src into name, throttled as src is read.
+func (c *ThrottledClient) UploadStream(namespace, name string, src io.Reader) error {
+	for _, l := range c.limiters() {
+		src = l.EgressReader(src)
 	}
-	if err := c.bandwidth.ReserveIngress(info.Size); err != nil {
-		log.With("name", name).Errorf("Error reserving ingress: %s", err)
-		// Ignore error.
+	return c.Client.UploadStream(namespace, name, src)
+}
+
+// Download downloads name into dst, throttled as dst is written.
+func (c *ThrottledClient) Download(namespace, name string, dst io.Writer) error {
+	for _, l := range c.limiters() {
+		dst = l.IngressWriter(dst)
 	}
 	return c.Client.Download(namespace, name, dst)
 }
 
-func (c *ThrottledClient) adjustBandwidth(denominator int) error {
-	return c.bandwidth.Adjust(denominator)
+// DownloadRange downloads a range of name into dst, throttled as dst is
+// written.
+func (c *ThrottledClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	for _, l := range c.limiters() {
+		dst = l.IngressWriter(dst)
+	}
+	return c.Client.DownloadRange(namespace, name, offset, length, dst)
+}
+
+func (c *ThrottledClient) limiter() *bandwidth.Limiter {
+	if c.bandwidth != nil {
+		return c.bandwidth
+	}
+	return c.global
 }
 
-// EgressLimit returns egress limit.
+// EgressLimit returns egress limit of the backend, or the global limit if the
+// backend has no limits of its own.
 func (c *ThrottledClient) EgressLimit() int64 {
-	return c.bandwidth.EgressLimit()
+	return c.limiter().EgressLimit()
 }
 
-// IngressLimit returns ingress limit.
+// IngressLimit returns ingress limit of the backend, or the global limit if
+// the backend has no limits of its own.
 func (c *ThrottledClient) IngressLimit() int64 {
-	return c.bandwidth.IngressLimit()
+	return c.limiter().IngressLimit()
 }
 
 // BandwidthWatcher is a hashring.Watcher which adjusts bandwidth on throttled
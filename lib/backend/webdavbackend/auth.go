@@ -0,0 +1,208 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdavbackend
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// authorizer adds authorization to requests.
+type authorizer interface {
+	// authorize sets the Authorization header of a method request to uri.
+	authorize(method, uri string, headers map[string]string) error
+
+	// reject is called when a request is rejected with 401, and returns
+	// whether the request may be retried.
+	reject(resp *http.Response) bool
+}
+
+func newAuthorizer(auth AuthConfig) (authorizer, error) {
+	a := auth.WebDAV
+	switch a.Scheme {
+	case "", "basic":
+		return &basicAuth{a.Username, a.Password}, nil
+	case "digest":
+		return &digestAuth{username: a.Username, password: a.Password}, nil
+	default:
+		return nil, fmt.Errorf("unsupported auth scheme %q", a.Scheme)
+	}
+}
+
+// noAuth sends requests unauthenticated.
+type noAuth struct{}
+
+func (noAuth) authorize(method, uri string, headers map[string]string) error { return nil }
+
+func (noAuth) reject(resp *http.Response) bool { return false }
+
+// basicAuth implements HTTP basic authentication.
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a *basicAuth) authorize(method, uri string, headers map[string]string) error {
+	creds := base64.StdEncoding.EncodeToString([]byte(a.username + ":" + a.password))
+	headers["Authorization"] = "Basic " + creds
+	return nil
+}
+
+func (a *basicAuth) reject(resp *http.Response) bool { return false }
+
+// digestChallenge is a parsed WWW-Authenticate digest challenge.
+type digestChallenge struct {
+	realm  string
+	nonce  string
+	opaque string
+	qop    bool
+}
+
+// digestAuth implements HTTP digest authentication (RFC 2617) with MD5. The
+// challenge is learned from the first rejected request and reused until the
+// server rejects it again, e.g. once the nonce goes stale.
+type digestAuth struct {
+	username string
+	password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        int
+}
+
+func (a *digestAuth) authorize(method, uri string, headers map[string]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c := a.challenge
+	if c == nil {
+		// Send the request unauthenticated to learn the challenge.
+		return nil
+	}
+
+	ha1 := md5Hex(a.username + ":" + c.realm + ":" + a.password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, a.username),
+		fmt.Sprintf(`realm="%s"`, c.realm),
+		fmt.Sprintf(`nonce="%s"`, c.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		"algorithm=MD5",
+	}
+	if c.qop {
+		a.nc++
+		nc := fmt.Sprintf("%08x", a.nc)
+		cnonce, err := randomHex(8)
+		if err != nil {
+			return fmt.Errorf("cnonce: %s", err)
+		}
+		response := md5Hex(strings.Join([]string{ha1, c.nonce, nc, cnonce, "auth", ha2}, ":"))
+		fields = append(fields,
+			"qop=auth",
+			"nc="+nc,
+			fmt.Sprintf(`cnonce="%s"`, cnonce),
+			fmt.Sprintf(`response="%s"`, response))
+	} else {
+		fields = append(fields, fmt.Sprintf(`response="%s"`, md5Hex(ha1+":"+c.nonce+":"+ha2)))
+	}
+	if c.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, c.opaque))
+	}
+	headers["Authorization"] = "Digest " + strings.Join(fields, ", ")
+	return nil
+}
+
+func (a *digestAuth) reject(resp *http.Response) bool {
+	c, err := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.challenge = c
+	a.nc = 0
+	return true
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	const prefix = "Digest "
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errors.New("not a digest challenge")
+	}
+	params := make(map[string]string)
+	for _, field := range splitParams(header[len(prefix):]) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+	}
+	if params["nonce"] == "" {
+		return nil, errors.New("challenge missing nonce")
+	}
+	if alg := params["algorithm"]; alg != "" && !strings.EqualFold(alg, "MD5") {
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	c := &digestChallenge{
+		realm:  params["realm"],
+		nonce:  params["nonce"],
+		opaque: params["opaque"],
+	}
+	for _, qop := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			c.qop = true
+		}
+	}
+	return c, nil
+}
+
+// splitParams splits s on commas which are not within quotes.
+func splitParams(s string) []string {
+	var fields []string
+	var quoted bool
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, s[start:])
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
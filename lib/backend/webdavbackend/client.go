@@ -0,0 +1,481 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdavbackend
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+const _webdav = "webdav"
+
+func init() {
+	backend.Register(_webdav, &factory{})
+}
+
+type factory struct{}
+
+func (f *factory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return nil, errors.New("marshal webdav config")
+	}
+	authConfBytes, err := yaml.Marshal(masterAuthConfig[_webdav])
+	if err != nil {
+		return nil, errors.New("marshal webdav auth config")
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return nil, errors.New("unmarshal webdav config")
+	}
+	var userAuth UserAuthConfig
+	if err := yaml.Unmarshal(authConfBytes, &userAuth); err != nil {
+		return nil, errors.New("unmarshal webdav auth config")
+	}
+
+	return NewClient(config, userAuth, stats)
+}
+
+// _statusMultiStatus is the WebDAV 207 Multi-Status response code.
+const _statusMultiStatus = 207
+
+const _propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/></D:prop></D:propfind>`
+
+// Client implements a backend.Client for WebDAV servers.
+type Client struct {
+	config    Config
+	pather    namepath.Pather
+	stats     tally.Scope
+	endpoint  *url.URL
+	auth      authorizer
+	transport http.RoundTripper
+
+	// Collections which are known to exist, so uploads can skip MKCOL.
+	collections sync.Map
+}
+
+// NewClient creates a new Client for WebDAV.
+func NewClient(config Config, userAuth UserAuthConfig, stats tally.Scope) (*Client, error) {
+	config.applyDefaults()
+	if config.Endpoint == "" {
+		return nil, errors.New("invalid config: endpoint required")
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: parse endpoint: %s", err)
+	}
+	if !path.IsAbs(config.RootDirectory) {
+		return nil, errors.New("invalid config: root_directory must be absolute path")
+	}
+
+	pather, err := namepath.New(config.RootDirectory, config.NamePath)
+	if err != nil {
+		return nil, fmt.Errorf("namepath: %s", err)
+	}
+
+	var auth authorizer = noAuth{}
+	if config.Username != "" {
+		a, ok := userAuth[config.Username]
+		if !ok {
+			return nil, errors.New("auth not configured for username")
+		}
+		if auth, err = newAuthorizer(a); err != nil {
+			return nil, fmt.Errorf("invalid auth config: %s", err)
+		}
+	}
+
+	var transport http.RoundTripper
+	if endpoint.Scheme == "https" {
+		tlsConfig, err := config.TLS.BuildClient()
+		if err != nil {
+			return nil, fmt.Errorf("build tls config: %s", err)
+		}
+		if tlsConfig != nil {
+			transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+	}
+
+	return &Client{
+		config:    config,
+		pather:    pather,
+		stats:     stats,
+		endpoint:  endpoint,
+		auth:      auth,
+		transport: transport,
+	}, nil
+}
+
+// resourceURL returns the URL of the resource at path p.
+func (c *Client) resourceURL(p string) *url.URL {
+	u := *c.endpoint
+	u.Path = path.Join("/", u.Path, p)
+	return &u
+}
+
+// send sends an authorized request. Requests rejected with 401 are retried
+// once if the authorizer learned a new challenge and body can be rewound.
+func (c *Client) send(
+	method string, u *url.URL, body io.Reader, headers map[string]string, accepted ...int) (*http.Response, error) {
+
+	for attempt := 0; ; attempt++ {
+		h := map[string]string{}
+		for k, v := range headers {
+			h[k] = v
+		}
+		if err := c.auth.authorize(method, u.RequestURI(), h); err != nil {
+			return nil, fmt.Errorf("authorize: %s", err)
+		}
+		opts := []httputil.SendOption{
+			httputil.SendHeaders(h),
+			httputil.SendTimeout(c.config.Timeout),
+			httputil.SendAcceptedCodes(append(accepted, http.StatusUnauthorized)...),
+		}
+		if c.transport != nil {
+			opts = append(opts, httputil.SendTransport(c.transport))
+		}
+		if body != nil {
+			opts = append(opts, httputil.SendBody(body))
+		}
+		resp, err := httputil.Send(method, u.String(), opts...)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+		statusErr := httputil.NewStatusError(resp)
+		closers.Close(resp.Body)
+		if attempt > 0 || !c.auth.reject(resp) || !rewind(body) {
+			return nil, statusErr
+		}
+	}
+}
+
+// rewind seeks body back to the start so it can be resent.
+func rewind(body io.Reader) bool {
+	if body == nil {
+		return true
+	}
+	s, ok := body.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := s.Seek(0, io.SeekStart)
+	return err == nil
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// resource is a single resource of a PROPFIND response.
+type resource struct {
+	path       string
+	collection bool
+	size       int64
+}
+
+// propfind returns the resources at p with given depth.
+func (c *Client) propfind(p string, depth int) ([]resource, error) {
+	resp, err := c.send(
+		"PROPFIND",
+		c.resourceURL(p),
+		strings.NewReader(_propfindBody),
+		map[string]string{
+			"Depth":        strconv.Itoa(depth),
+			"Content-Type": "application/xml",
+		},
+		_statusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("decode multistatus: %s", err)
+	}
+	var resources []resource
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("parse href %q: %s", r.Href, err)
+		}
+		res := resource{path: href.Path}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				res.collection = true
+			}
+			if ps.Prop.ContentLength != "" {
+				if res.size, err = strconv.ParseInt(ps.Prop.ContentLength, 10, 64); err != nil {
+					return nil, fmt.Errorf("parse content length: %s", err)
+				}
+			}
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// Stat returns blob info for name.
+func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("blob path: %s", err)
+	}
+	resources, err := c.propfind(p, 0)
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, backenderrors.ErrBlobNotFound
+		}
+		return nil, err
+	}
+	if len(resources) != 1 || resources[0].collection {
+		return nil, backenderrors.ErrBlobNotFound
+	}
+	return core.NewBlobInfo(resources[0].size), nil
+}
+
+// Download downloads the content of name and writes the data to dst.
+func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	resp, err := c.send("GET", c.resourceURL(p), nil, nil, http.StatusOK)
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer closers.Close(resp.Body)
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return fmt.Errorf("copy: %s", err)
+	}
+	return nil
+}
+
+// DownloadRange downloads length bytes of name starting at offset using an
+// HTTP Range request. Servers which ignore the Range header reply with the
+// whole resource, which is skipped to the range.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := backend.ValidateRange(offset, length); err != nil {
+		return err
+	}
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	resp, err := c.send(
+		"GET", c.resourceURL(p), nil,
+		map[string]string{"Range": backend.RangeHeader(offset, length)},
+		http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer closers.Close(resp.Body)
+
+	if resp.StatusCode == http.StatusPartialContent {
+		offset = 0
+	}
+	if err := backend.CopyRange(dst, resp.Body, offset, length); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	return nil
+}
+
+// Upload uploads src as name, creating any missing parent collections.
+func (c *Client) Upload(namespace, name string, src io.Reader) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	if err := c.mkcolAll(path.Dir(p)); err != nil {
+		return err
+	}
+	resp, err := c.send(
+		"PUT", c.resourceURL(p), src,
+		map[string]string{"Content-Type": "application/octet-stream"},
+		http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+// Delete deletes name.
+func (c *Client) Delete(namespace, name string) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	resp, err := c.send(
+		"DELETE", c.resourceURL(p), nil, nil,
+		http.StatusOK, http.StatusAccepted, http.StatusNoContent)
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+// UploadStream uploads src as name. Requests rejected by the first
+// authentication challenge are resent, which requires a rewindable body, so
+// src is spooled first.
+func (c *Client) UploadStream(namespace, name string, src io.Reader) error {
+	return backend.FallbackUploadStream(c, namespace, name, src)
+}
+
+// mkcolAll creates collection dir along with any missing parents.
+func (c *Client) mkcolAll(dir string) error {
+	if dir == "/" || dir == "." {
+		return nil
+	}
+	if _, ok := c.collections.Load(dir); ok {
+		return nil
+	}
+	if err := c.mkcolAll(path.Dir(dir)); err != nil {
+		return err
+	}
+	// 405 Method Not Allowed means the collection already exists.
+	resp, err := c.send(
+		"MKCOL", c.resourceURL(dir), nil, nil,
+		http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return fmt.Errorf("mkcol %s: %s", dir, err)
+	}
+	closers.Close(resp.Body)
+	c.collections.Store(dir, true)
+	return nil
+}
+
+// List lists names under the prefix directory. WebDAV has no native pagination,
+// so all names are listed and paginated results are sliced in name order,
+// with the last returned name as continuation token.
+func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	options := backend.DefaultListOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	var names []string
+	if err := c.walk(path.Join(c.pather.BasePath(), prefix), func(p string) {
+		name, err := c.pather.NameFromBlobPath(p)
+		if err != nil {
+			log.With("path", p).Errorf("Error converting blob path into name: %s", err)
+			return
+		}
+		names = append(names, name)
+	}); err != nil {
+		if httputil.IsNotFound(err) {
+			return &backend.ListResult{}, nil
+		}
+		return nil, err
+	}
+	sort.Strings(names)
+
+	if !options.Paginated {
+		return &backend.ListResult{Names: names}, nil
+	}
+	start := sort.SearchStrings(names, options.ContinuationToken)
+	if start < len(names) && names[start] == options.ContinuationToken {
+		start++
+	}
+	end := start + options.MaxKeys
+	if end >= len(names) {
+		return &backend.ListResult{Names: names[start:]}, nil
+	}
+	return &backend.ListResult{
+		Names:             names[start:end],
+		ContinuationToken: names[end-1],
+	}, nil
+}
+
+// walk calls f with the path of every non-collection resource under dir.
+func (c *Client) walk(dir string, f func(p string)) error {
+	resources, err := c.propfind(dir, 1)
+	if err != nil {
+		return err
+	}
+	base := c.endpoint.Path
+	for _, r := range resources {
+		p := path.Clean("/" + strings.TrimPrefix(r.path, base))
+		if p == path.Clean(dir) {
+			continue
+		}
+		if r.collection {
+			if err := c.walk(p, f); err != nil {
+				return err
+			}
+			continue
+		}
+		f(p)
+	}
+	return nil
+}
+
+// Close closes the client and releases any held resources.
+func (c *Client) Close() error {
+	return nil
+}
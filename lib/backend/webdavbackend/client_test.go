@@ -0,0 +1,262 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdavbackend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/webdav"
+)
+
+func newWebDAVHandler() http.Handler {
+	return &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+// withBasicAuth rejects requests without the given basic auth credentials.
+func withBasicAuth(h http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// withDigestAuth rejects requests without valid digest auth credentials. The
+// nonce is rotated after maxUses requests.
+func withDigestAuth(h http.Handler, username, password string, maxUses int) http.Handler {
+	var nonce int
+	var uses int
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		challenge := func() {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Digest realm="test", nonce="nonce%d", qop="auth,auth-int", opaque="xyz", algorithm=MD5`, nonce))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Digest ") {
+			challenge()
+			return
+		}
+		params := make(map[string]string)
+		for _, field := range splitParams(header[len("Digest "):]) {
+			kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+		ha1 := md5Hex(username + ":test:" + password)
+		ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+		expected := md5Hex(strings.Join(
+			[]string{ha1, params["nonce"], params["nc"], params["cnonce"], "auth", ha2}, ":"))
+		if params["nonce"] != fmt.Sprintf("nonce%d", nonce) ||
+			params["uri"] != r.URL.RequestURI() ||
+			params["opaque"] != "xyz" ||
+			params["response"] != expected {
+			challenge()
+			return
+		}
+		uses++
+		if uses == maxUses {
+			nonce++
+			uses = 0
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newTestClient(t *testing.T, h http.Handler, auth *AuthConfig) *Client {
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	config := Config{
+		Endpoint:      server.URL + "/dav",
+		RootDirectory: "/root",
+		NamePath:      "identity",
+	}
+	userAuth := UserAuthConfig{}
+	if auth != nil {
+		config.Username = "test-user"
+		userAuth["test-user"] = *auth
+	}
+	c, err := NewClient(config, userAuth, tally.NoopScope)
+	require.NoError(t, err)
+	return c
+}
+
+func TestClientFactory(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Username:      "test-user",
+		Endpoint:      "https://localhost/dav",
+		NamePath:      "identity",
+		RootDirectory: "/root",
+	}
+	var auth AuthConfig
+	auth.WebDAV.Username = "user"
+	auth.WebDAV.Password = "pass"
+	masterAuth := backend.AuthConfig{_webdav: UserAuthConfig{"test-user": auth}}
+	f := factory{}
+	_, err := f.Create(config, masterAuth, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+}
+
+func TestClientUploadDownload(t *testing.T) {
+	var basic AuthConfig
+	basic.WebDAV.Username = "user"
+	basic.WebDAV.Password = "pass"
+
+	digest := basic
+	digest.WebDAV.Scheme = "digest"
+
+	tests := []struct {
+		desc    string
+		handler http.Handler
+		auth    *AuthConfig
+	}{
+		{"no auth", newWebDAVHandler(), nil},
+		{"basic auth", withBasicAuth(newWebDAVHandler(), "user", "pass"), &basic},
+		{"digest auth", withDigestAuth(newWebDAVHandler(), "user", "pass", 3), &digest},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			client := newTestClient(t, test.handler, test.auth)
+
+			_, err := client.Stat(core.NamespaceFixture(), "a/b/test")
+			require.Equal(backenderrors.ErrBlobNotFound, err)
+
+			data := randutil.Text(64)
+			require.NoError(client.Upload(core.NamespaceFixture(), "a/b/test", bytes.NewReader(data)))
+
+			info, err := client.Stat(core.NamespaceFixture(), "a/b/test")
+			require.NoError(err)
+			require.Equal(core.NewBlobInfo(64), info)
+
+			var b bytes.Buffer
+			require.NoError(client.Download(core.NamespaceFixture(), "a/b/test", &b))
+			require.Equal(data, b.Bytes())
+
+			require.Equal(backenderrors.ErrBlobNotFound,
+				client.Download(core.NamespaceFixture(), "a/b/missing", &b))
+
+			require.NoError(client.Delete(core.NamespaceFixture(), "a/b/test"))
+			_, err = client.Stat(core.NamespaceFixture(), "a/b/test")
+			require.Equal(backenderrors.ErrBlobNotFound, err)
+			require.Equal(backenderrors.ErrBlobNotFound,
+				client.Delete(core.NamespaceFixture(), "a/b/test"))
+		})
+	}
+}
+
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	client := newTestClient(t, newWebDAVHandler(), nil)
+
+	data := randutil.Text(64)
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 16, 8, &b))
+	require.Equal(data[16:24], b.Bytes())
+
+	err := client.DownloadRange(core.NamespaceFixture(), "test", 60, 8, &b)
+	require.True(errors.Is(err, backend.ErrShortRange))
+
+	require.Error(client.DownloadRange(core.NamespaceFixture(), "test", 64, 8, &b))
+
+	require.Equal(backenderrors.ErrBlobNotFound,
+		client.DownloadRange(core.NamespaceFixture(), "missing", 0, 8, &b))
+}
+
+func TestClientBasicAuthRejected(t *testing.T) {
+	require := require.New(t)
+
+	var auth AuthConfig
+	auth.WebDAV.Username = "user"
+	auth.WebDAV.Password = "wrong"
+	client := newTestClient(t, withBasicAuth(newWebDAVHandler(), "user", "pass"), &auth)
+
+	_, err := client.Stat(core.NamespaceFixture(), "test")
+	require.Error(err)
+	require.NotEqual(backenderrors.ErrBlobNotFound, err)
+}
+
+func TestClientList(t *testing.T) {
+	require := require.New(t)
+
+	client := newTestClient(t, newWebDAVHandler(), nil)
+
+	names := []string{"test/a", "test/b/c", "test/b/d", "test/e"}
+	for _, name := range names {
+		require.NoError(client.Upload(core.NamespaceFixture(), name, bytes.NewReader(randutil.Text(8))))
+	}
+	require.NoError(client.Upload(core.NamespaceFixture(), "other", bytes.NewReader(randutil.Text(8))))
+
+	result, err := client.List("test")
+	require.NoError(err)
+	require.Equal(names, result.Names)
+
+	result, err = client.List("test", backend.ListWithPagination(), backend.ListWithMaxKeys(3))
+	require.NoError(err)
+	require.Equal(names[:3], result.Names)
+	require.Equal("test/b/d", result.ContinuationToken)
+
+	result, err = client.List("test",
+		backend.ListWithPagination(),
+		backend.ListWithMaxKeys(3),
+		backend.ListWithContinuationToken(result.ContinuationToken))
+	require.NoError(err)
+	require.Equal(names[3:], result.Names)
+	require.Equal("", result.ContinuationToken)
+
+	result, err = client.List("missing")
+	require.NoError(err)
+	require.Empty(result.Names)
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	require := require.New(t)
+
+	c, err := parseDigestChallenge(`Digest realm="a, b", nonce="n", qop="auth", opaque="o"`)
+	require.NoError(err)
+	require.Equal(&digestChallenge{realm: "a, b", nonce: "n", opaque: "o", qop: true}, c)
+
+	_, err = parseDigestChallenge(`Basic realm="a"`)
+	require.Error(err)
+
+	_, err = parseDigestChallenge(`Digest realm="a", nonce="n", algorithm=SHA-256`)
+	require.Error(err)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdavbackend
+
+import (
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// Config defines WebDAV server connection parameters.
+type Config struct {
+	// Username selects credentials from UserAuthConfig. Requests are not
+	// authenticated if empty.
+	Username string `yaml:"username"`
+
+	// Endpoint is the base URL of the WebDAV collection, e.g.
+	// https://artifactory.example.com/artifactory/kraken.
+	Endpoint string `yaml:"endpoint"`
+
+	RootDirectory string `yaml:"root_directory"` // Root directory for docker images under Endpoint
+
+	// NamePath identifies which namepath.Pather to use.
+	NamePath string `yaml:"name_path"`
+
+	// TLS configures client certificates and CAs for https endpoints.
+	TLS httputil.TLSConfig `yaml:"tls"`
+
+	// Timeout bounds each request made to the server.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// UserAuthConfig defines authentication configuration overlayed by Langley.
+// Each key is the username of the credentials.
+type UserAuthConfig map[string]AuthConfig
+
+// AuthConfig matches Langley format.
+type AuthConfig struct {
+	WebDAV struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+
+		// Scheme is either "basic" or "digest". Defaults to "basic".
+		Scheme string `yaml:"scheme"`
+	} `yaml:"webdav"`
+}
+
+func (c *Config) applyDefaults() {
+	if c.Timeout == 0 {
+		c.Timeout = 15 * time.Minute
+	}
+}
@@ -20,4 +20,10 @@ type Config struct {
 	// Limits the size of blobs which origin will accept. A 0 size limit means
 	// blob size is unbounded.
 	SizeLimit datasize.ByteSize `yaml:"size_limit"`
+
+	// Blobs at least this large are downloaded piece by piece into a resumable
+	// upload, so a download interrupted by an origin restart continues from
+	// the pieces already on disk instead of starting over. A 0 threshold
+	// disables resumable downloads.
+	ResumableThreshold datasize.ByteSize `yaml:"resumable_threshold"`
 }
@@ -14,8 +14,10 @@
 package blobrefresh
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/uber/kraken/core"
@@ -23,6 +25,7 @@ import (
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/metainfogen"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/utils/dedup"
 	"github.com/uber/kraken/utils/log"
 
@@ -106,7 +109,7 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 	id := namespace + ":" + d.Hex()
 	err = r.requests.Start(id, func() error {
 		start := time.Now()
-		pieceLength := r.metaInfoGenerator.GetPieceLength(int64(size))
+		pieceLength := r.metaInfoGenerator.GetPieceLength(namespace, int64(size))
 		err := r.download(client, namespace, d, size.Bytes(), pieceLength)
 		if err != nil {
 			return err
@@ -136,8 +139,59 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 }
 
 func (r *Refresher) download(client backend.Client, namespace string, d core.Digest, size uint64, pieceLength int64) error {
+	if r.config.ResumableThreshold > 0 && size >= r.config.ResumableThreshold.Bytes() {
+		return r.downloadResumable(client, namespace, d, int64(size), pieceLength)
+	}
 	name := d.Hex()
+	// Record the namespace so origins can enforce its retention policy.
 	return r.cas.WriteBlobToCacheWithMetaInfo(name, size, func(w store.FileReadWriter) error {
 		return client.Download(namespace, name, w)
-	}, pieceLength)
+	}, pieceLength, metadata.NewNamespace(namespace))
+}
+
+// downloadResumable downloads the blob piece by piece into a resumable upload.
+// Pieces which were already written before a restart are not downloaded again.
+func (r *Refresher) downloadResumable(
+	client backend.Client, namespace string, d core.Digest, size, pieceLength int64) error {
+
+	err := r.cas.CreateResumableUpload(d, size, pieceLength)
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("create resumable upload: %s", err)
+	}
+	ranges, err := r.cas.ResumeUpload(d)
+	if err != nil {
+		return fmt.Errorf("resume upload: %s", err)
+	}
+	if len(ranges) > 0 {
+		r.stats.Counter("resumed_downloads").Inc(1)
+	}
+	written := func(off int64) bool {
+		for _, br := range ranges {
+			if off >= br.Offset && off < br.Offset+br.Length {
+				return true
+			}
+		}
+		return false
+	}
+
+	name := d.Hex()
+	var buf bytes.Buffer
+	for off, i := int64(0), 0; off < size; off, i = off+pieceLength, i+1 {
+		if written(off) {
+			continue
+		}
+		n := pieceLength
+		if off+n > size {
+			n = size - off
+		}
+		buf.Reset()
+		if err := client.DownloadRange(namespace, name, off, n, &buf); err != nil {
+			return err
+		}
+		if err := r.cas.WriteUploadPiece(d, i, buf.Bytes()); err != nil {
+			return fmt.Errorf("write piece %d: %s", i, err)
+		}
+	}
+	// Record the namespace so origins can enforce its retention policy.
+	return r.cas.CommitResumableUpload(d, metadata.NewNamespace(namespace))
 }
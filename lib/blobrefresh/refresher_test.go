@@ -102,6 +102,65 @@ func TestRefresh(t *testing.T) {
 	var tm metadata.TorrentMeta
 	require.NoError(mocks.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
 	require.Equal(blob.MetaInfo, tm.MetaInfo)
+
+	var ns metadata.Namespace
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return mocks.cas.GetCacheFileMetadata(blob.Digest.Hex(), &ns) == nil
+	}))
+	require.Equal(namespace, ns.Value)
+}
+
+func TestRefreshResumesInterruptedDownload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	mocks.config.ResumableThreshold = 1
+
+	refresher := mocks.new()
+
+	namespace := core.TagFixture()
+	client := mocks.newClient(namespace)
+
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+
+	// Simulate a download which was interrupted after the first half.
+	require.NoError(mocks.cas.CreateResumableUpload(blob.Digest, blob.Length(), _testPieceLength))
+	for i := 0; i < 5; i++ {
+		piece := blob.Content[i*_testPieceLength : (i+1)*_testPieceLength]
+		require.NoError(mocks.cas.WriteUploadPiece(blob.Digest, i, piece))
+	}
+
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
+	for i := 5; i < 10; i++ {
+		off := int64(i * _testPieceLength)
+		client.EXPECT().DownloadRange(
+			namespace, blob.Digest.Hex(), off, int64(_testPieceLength), gomock.Any()).DoAndReturn(
+			func(namespace, name string, offset, length int64, dst io.Writer) error {
+				_, err := dst.Write(blob.Content[offset : offset+length])
+				return err
+			})
+	}
+
+	require.NoError(refresher.Refresh(namespace, blob.Digest))
+
+	var ns metadata.Namespace
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return mocks.cas.GetCacheFileMetadata(blob.Digest.Hex(), &ns) == nil
+	}))
+	require.Equal(namespace, ns.Value)
+
+	f, err := mocks.cas.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer closers.Close(f)
+	result, err := io.ReadAll(f)
+	require.NoError(err)
+	require.Equal(string(blob.Content), string(result))
+
+	var tm metadata.TorrentMeta
+	require.NoError(mocks.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.MetaInfo, tm.MetaInfo)
 }
 
 func TestRefreshSizeLimitError(t *testing.T) {
@@ -0,0 +1,161 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package delta
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/closers"
+)
+
+// Blob is a locally cached blob.
+type Blob interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// Opener opens the locally cached blob of d.
+type Opener func(d core.Digest) (Blob, error)
+
+type location struct {
+	digest core.Digest
+	offset int64
+	length int64
+}
+
+// Catalog tracks the chunks of recently downloaded blobs, such that new blobs
+// can be partially assembled from the chunks they share with them.
+type Catalog struct {
+	config Config
+
+	mu      sync.Mutex
+	blobs   []core.Digest // Oldest first.
+	indexes map[core.Digest]*Index
+	chunks  map[string]location
+}
+
+// NewCatalog creates a new Catalog.
+func NewCatalog(config Config) *Catalog {
+	return &Catalog{
+		config:  config.applyDefaults(),
+		indexes: make(map[core.Digest]*Index),
+		chunks:  make(map[string]location),
+	}
+}
+
+// Add makes the chunks of the blob of d available, evicting the oldest blob
+// if the catalog is full. The blob need not be cached yet, since reads from
+// blobs which are not cached simply fail.
+func (c *Catalog) Add(d core.Digest, idx *Index) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.indexes[d]; ok {
+		return
+	}
+	for len(c.blobs) >= c.config.MaxBlobs {
+		c.evictOldest()
+	}
+	c.blobs = append(c.blobs, d)
+	c.indexes[d] = idx
+	for _, chunk := range idx.Chunks {
+		c.chunks[chunk.Sum] = location{d, chunk.Offset, chunk.Length}
+	}
+}
+
+func (c *Catalog) evictOldest() {
+	d := c.blobs[0]
+	c.blobs = c.blobs[1:]
+	for _, chunk := range c.indexes[d].Chunks {
+		if loc, ok := c.chunks[chunk.Sum]; ok && loc.digest == d {
+			delete(c.chunks, chunk.Sum)
+		}
+	}
+	delete(c.indexes, d)
+}
+
+func (c *Catalog) locate(sum string) (location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	loc, ok := c.chunks[sum]
+	return loc, ok
+}
+
+// Read returns the range [start, end) of the blob described by target,
+// assembled from the chunks of cataloged blobs. Returns an error if any chunk
+// overlapping the range is not available locally.
+func (c *Catalog) Read(target *Index, start, end int64, open Opener) ([]byte, error) {
+	chunks := target.Overlapping(start, end)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("range [%d, %d) not indexed", start, end)
+	}
+	if last := chunks[len(chunks)-1]; last.Offset+last.Length < end {
+		return nil, fmt.Errorf("range [%d, %d) exceeds index", start, end)
+	}
+	locs := make([]location, len(chunks))
+	for i, chunk := range chunks {
+		loc, ok := c.locate(chunk.Sum)
+		if !ok {
+			return nil, fmt.Errorf("chunk %s not found", chunk.Sum)
+		}
+		locs[i] = loc
+	}
+
+	blobs := make(map[core.Digest]Blob)
+	defer func() {
+		for _, b := range blobs {
+			closers.Close(b)
+		}
+	}()
+
+	result := make([]byte, end-start)
+	for i, chunk := range chunks {
+		loc := locs[i]
+		b, ok := blobs[loc.digest]
+		if !ok {
+			var err error
+			b, err = open(loc.digest)
+			if err != nil {
+				return nil, fmt.Errorf("open %s: %s", loc.digest, err)
+			}
+			blobs[loc.digest] = b
+		}
+		// Only the part of the chunk which overlaps the range is read.
+		lo := maxInt64(chunk.Offset, start)
+		hi := minInt64(chunk.Offset+chunk.Length, end)
+		dst := result[lo-start : hi-start]
+		if _, err := b.ReadAt(dst, loc.offset+(lo-chunk.Offset)); err != nil {
+			return nil, fmt.Errorf("read chunk %s from %s: %s", chunk.Sum, loc.digest, err)
+		}
+	}
+	return result, nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
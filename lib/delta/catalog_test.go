@@ -0,0 +1,117 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+)
+
+type bufferBlob struct {
+	*bytes.Reader
+}
+
+func (b bufferBlob) Close() error { return nil }
+
+func opener(blobs map[core.Digest][]byte) Opener {
+	return func(d core.Digest) (Blob, error) {
+		b, ok := blobs[d]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return bufferBlob{bytes.NewReader(b)}, nil
+	}
+}
+
+func TestCatalogRead(t *testing.T) {
+	require := require.New(t)
+
+	config := indexConfigFixture()
+
+	// The target blob replaces the middle of the source blob.
+	source := randutil.Blob(64 * 1024)
+	target := make([]byte, len(source))
+	copy(target, source)
+	copy(target[32*1024:], randutil.Blob(1024))
+
+	sourceIdx, err := BuildIndex(bytes.NewReader(source), config)
+	require.NoError(err)
+	targetIdx, err := BuildIndex(bytes.NewReader(target), config)
+	require.NoError(err)
+
+	d := core.DigestFixture()
+	c := NewCatalog(Config{Enabled: true})
+	c.Add(d, sourceIdx)
+	open := opener(map[core.Digest][]byte{d: source})
+
+	b, err := c.Read(targetIdx, 0, 16*1024, open)
+	require.NoError(err)
+	require.Equal(target[:16*1024], b)
+
+	b, err = c.Read(targetIdx, 56*1024, int64(len(target)), open)
+	require.NoError(err)
+	require.Equal(target[56*1024:], b)
+
+	_, err = c.Read(targetIdx, 30*1024, 34*1024, open)
+	require.Error(err)
+}
+
+func TestCatalogReadMissingBlob(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Blob(16 * 1024)
+	idx, err := BuildIndex(bytes.NewReader(blob), indexConfigFixture())
+	require.NoError(err)
+
+	c := NewCatalog(Config{Enabled: true})
+	c.Add(core.DigestFixture(), idx)
+
+	_, err = c.Read(idx, 0, int64(len(blob)), opener(nil))
+	require.Error(err)
+}
+
+func TestCatalogEvictsOldestBlob(t *testing.T) {
+	require := require.New(t)
+
+	config := indexConfigFixture()
+	blobs := make(map[core.Digest][]byte)
+	var digests []core.Digest
+	var indexes []*Index
+	c := NewCatalog(Config{Enabled: true, MaxBlobs: 2})
+	for i := 0; i < 3; i++ {
+		blob := randutil.Blob(8 * 1024)
+		idx, err := BuildIndex(bytes.NewReader(blob), config)
+		require.NoError(err)
+		d := core.DigestFixture()
+		blobs[d] = blob
+		digests = append(digests, d)
+		indexes = append(indexes, idx)
+		c.Add(d, idx)
+	}
+	open := opener(blobs)
+
+	_, err := c.Read(indexes[0], 0, 8*1024, open)
+	require.Error(err)
+	for i := 1; i < 3; i++ {
+		b, err := c.Read(indexes[i], 0, 8*1024, open)
+		require.NoError(err)
+		require.Equal(blobs[digests[i]], b)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package delta
+
+import (
+	"errors"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// IndexConfig defines how blobs are split into content-defined chunks. Chunk
+// boundaries depend only on content and IndexConfig, so all indexes which are
+// compared against each other must be built with the same IndexConfig.
+type IndexConfig struct {
+	// Enabled builds chunk indexes for blobs.
+	Enabled bool `yaml:"enabled"`
+
+	MinChunkSize datasize.ByteSize `yaml:"min_chunk_size"`
+
+	// AvgChunkSize must be a power of two.
+	AvgChunkSize datasize.ByteSize `yaml:"avg_chunk_size"`
+
+	MaxChunkSize datasize.ByteSize `yaml:"max_chunk_size"`
+}
+
+func (c IndexConfig) applyDefaults() IndexConfig {
+	if c.MinChunkSize == 0 {
+		c.MinChunkSize = 16 * datasize.KB
+	}
+	if c.AvgChunkSize == 0 {
+		c.AvgChunkSize = 64 * datasize.KB
+	}
+	if c.MaxChunkSize == 0 {
+		c.MaxChunkSize = 256 * datasize.KB
+	}
+	return c
+}
+
+func (c IndexConfig) validate() error {
+	if c.AvgChunkSize&(c.AvgChunkSize-1) != 0 {
+		return errors.New("avg_chunk_size must be a power of two")
+	}
+	if c.MinChunkSize > c.AvgChunkSize || c.AvgChunkSize > c.MaxChunkSize {
+		return errors.New("chunk sizes must satisfy min <= avg <= max")
+	}
+	return nil
+}
+
+// Config defines delta transfer of blobs on agents.
+type Config struct {
+	// Enabled assembles pieces of new blobs from chunks of similar blobs which
+	// are already cached locally, before downloading the remaining pieces.
+	Enabled bool `yaml:"enabled"`
+
+	// MaxBlobs is the number of most recently downloaded blobs whose chunks
+	// are available for delta transfer.
+	MaxBlobs int `yaml:"max_blobs"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.MaxBlobs == 0 {
+		c.MaxBlobs = 1000
+	}
+	return c
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// _gear maps bytes to random values for the gear rolling hash. It must never
+// change, else chunk boundaries of new indexes will not match those of
+// existing indexes.
+var _gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed.
+	x := uint64(0x6b72616b656e)
+	for i := range _gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		_gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunk is a content-defined range of a blob.
+type Chunk struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+
+	// Sum is the hex sha256 of the chunk content.
+	Sum string `json:"sum"`
+}
+
+// Index describes a blob as a sequence of content-defined chunks. Blobs which
+// share content share chunks, regardless of where the shared content is
+// located within each blob.
+type Index struct {
+	Chunks []Chunk `json:"chunks"`
+}
+
+// BuildIndex splits the blob read from r into chunks per config.
+func BuildIndex(r io.Reader, config IndexConfig) (*Index, error) {
+	config = config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+	min := int(config.MinChunkSize)
+	max := int(config.MaxChunkSize)
+	// Boundaries are found where the top log2(avg) bits of the hash are zero,
+	// which occurs once every avg bytes on average.
+	mask := ^uint64(0) << uint(64-bits.TrailingZeros64(uint64(config.AvgChunkSize)))
+
+	idx := &Index{}
+	br := bufio.NewReaderSize(r, max)
+	buf := make([]byte, 0, max)
+	var offset int64
+	var fp uint64
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read: %s", err)
+		}
+		buf = append(buf, b)
+		fp = (fp << 1) + _gear[b]
+		if (len(buf) >= min && fp&mask == 0) || len(buf) >= max {
+			idx.add(offset, buf)
+			offset += int64(len(buf))
+			buf = buf[:0]
+			fp = 0
+		}
+	}
+	if len(buf) > 0 {
+		idx.add(offset, buf)
+	}
+	return idx, nil
+}
+
+func (idx *Index) add(offset int64, b []byte) {
+	sum := sha256.Sum256(b)
+	idx.Chunks = append(idx.Chunks, Chunk{
+		Offset: offset,
+		Length: int64(len(b)),
+		Sum:    hex.EncodeToString(sum[:]),
+	})
+}
+
+// Length returns the length of the indexed blob.
+func (idx *Index) Length() int64 {
+	if len(idx.Chunks) == 0 {
+		return 0
+	}
+	last := idx.Chunks[len(idx.Chunks)-1]
+	return last.Offset + last.Length
+}
+
+// Overlapping returns the chunks which overlap the range [start, end).
+func (idx *Index) Overlapping(start, end int64) []Chunk {
+	i := sort.Search(len(idx.Chunks), func(i int) bool {
+		c := idx.Chunks[i]
+		return c.Offset+c.Length > start
+	})
+	j := i
+	for j < len(idx.Chunks) && idx.Chunks[j].Offset < end {
+		j++
+	}
+	return idx.Chunks[i:j]
+}
+
+// Serialize converts idx to json.
+func (idx *Index) Serialize() ([]byte, error) {
+	return json.Marshal(idx)
+}
+
+// DeserializeIndex reconstructs an Index from json.
+func DeserializeIndex(b []byte) (*Index, error) {
+	var idx Index
+	if err := json.Unmarshal(b, &idx); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	return &idx, nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package delta
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/utils/randutil"
+)
+
+func indexConfigFixture() IndexConfig {
+	return IndexConfig{
+		Enabled:      true,
+		MinChunkSize: 256,
+		AvgChunkSize: 1024,
+		MaxChunkSize: 4096,
+	}
+}
+
+func sums(idx *Index) map[string]bool {
+	m := make(map[string]bool)
+	for _, c := range idx.Chunks {
+		m[c.Sum] = true
+	}
+	return m
+}
+
+func TestBuildIndex(t *testing.T) {
+	require := require.New(t)
+
+	config := indexConfigFixture()
+	blob := randutil.Blob(256 * 1024)
+
+	idx, err := BuildIndex(bytes.NewReader(blob), config)
+	require.NoError(err)
+	require.Equal(int64(len(blob)), idx.Length())
+
+	var offset int64
+	for i, c := range idx.Chunks {
+		require.Equal(offset, c.Offset)
+		require.True(c.Length <= int64(config.MaxChunkSize))
+		if i < len(idx.Chunks)-1 {
+			require.True(c.Length >= int64(config.MinChunkSize))
+		}
+		offset += c.Length
+	}
+}
+
+func TestBuildIndexSharesChunksAfterInsertion(t *testing.T) {
+	require := require.New(t)
+
+	config := indexConfigFixture()
+	blob := randutil.Blob(256 * 1024)
+	modified := append(randutil.Blob(100), blob...)
+
+	idx1, err := BuildIndex(bytes.NewReader(blob), config)
+	require.NoError(err)
+	idx2, err := BuildIndex(bytes.NewReader(modified), config)
+	require.NoError(err)
+
+	s1 := sums(idx1)
+	var shared int
+	for _, c := range idx2.Chunks {
+		if s1[c.Sum] {
+			shared++
+		}
+	}
+	// Chunk boundaries resynchronize shortly after the insertion.
+	require.True(shared >= len(idx2.Chunks)-5)
+}
+
+func TestBuildIndexInvalidConfig(t *testing.T) {
+	config := indexConfigFixture()
+	config.AvgChunkSize = 1000
+	_, err := BuildIndex(bytes.NewReader(randutil.Blob(1024)), config)
+	require.Error(t, err)
+}
+
+func TestIndexOverlapping(t *testing.T) {
+	require := require.New(t)
+
+	idx := &Index{Chunks: []Chunk{
+		{Offset: 0, Length: 10, Sum: "a"},
+		{Offset: 10, Length: 10, Sum: "b"},
+		{Offset: 20, Length: 10, Sum: "c"},
+	}}
+	require.Equal(idx.Chunks[0:1], idx.Overlapping(0, 10))
+	require.Equal(idx.Chunks[0:2], idx.Overlapping(5, 15))
+	require.Equal(idx.Chunks[1:3], idx.Overlapping(10, 30))
+	require.Empty(idx.Overlapping(30, 40))
+}
+
+func TestIndexSerialization(t *testing.T) {
+	require := require.New(t)
+
+	idx, err := BuildIndex(bytes.NewReader(randutil.Blob(16*1024)), indexConfigFixture())
+	require.NoError(err)
+
+	b, err := idx.Serialize()
+	require.NoError(err)
+	result, err := DeserializeIndex(b)
+	require.NoError(err)
+	require.Equal(idx, result)
+}
@@ -105,14 +105,10 @@ func (b *blobs) getCacheReaderHelper(
 		return nil, fmt.Errorf("get layer digest %s: %s", path, err)
 	}
 
-	r, err := b.transferer.Download(repo, digest)
+	r, err := b.transferer.DownloadRange(repo, digest, offset)
 	if err != nil {
 		return nil, fmt.Errorf("transferer download: %w", err)
 	}
-
-	if _, err := r.Seek(offset, 0); err != nil {
-		return nil, fmt.Errorf("seek: %s", err)
-	}
 	return r, nil
 }
 
@@ -72,5 +72,19 @@ func (c Config) Build(parameters configuration.Parameters) (*registry.Registry,
 			"disable": true,
 		},
 	}
+	if parameters["constructor"] == _rw {
+		// Copy the middleware config to not modify the caller's.
+		middleware := make(map[string][]configuration.Middleware)
+		for k, v := range c.Docker.Middleware {
+			middleware[k] = append([]configuration.Middleware(nil), v...)
+		}
+		middleware["repository"] = append(middleware["repository"], configuration.Middleware{
+			Name: _tagPolicyMiddleware,
+			Options: configuration.Parameters{
+				"transferer": parameters["transferer"],
+			},
+		})
+		c.Docker.Middleware = middleware
+	}
 	return registry.NewRegistry(context.Background(), &c.Docker)
 }
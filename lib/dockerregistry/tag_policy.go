@@ -0,0 +1,109 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/distribution"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	repositorymiddleware "github.com/docker/distribution/registry/middleware/repository"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/uber/kraken/build-index/tagpolicy"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
+)
+
+// _tagPolicyMiddleware is the name of the repository middleware which rejects
+// manifest puts violating tag policies. Errors of the storage driver are
+// reported as unknown errors by the registry, so violations are checked
+// before the manifest is stored to surface them as registry errors.
+const _tagPolicyMiddleware = "kraken_tag_policy"
+
+func init() {
+	if err := repositorymiddleware.Register(_tagPolicyMiddleware, newTagPolicyRepository); err != nil {
+		panic(err)
+	}
+}
+
+func newTagPolicyRepository(
+	ctx context.Context,
+	repository distribution.Repository,
+	options map[string]interface{}) (distribution.Repository, error) {
+
+	transferer, ok := options["transferer"].(transfer.ImageTransferer)
+	if !ok {
+		return nil, fmt.Errorf("expected transferer option to be transfer.ImageTransferer, got %T", options["transferer"])
+	}
+	return &tagPolicyRepository{repository, transferer}, nil
+}
+
+type tagPolicyRepository struct {
+	distribution.Repository
+	transferer transfer.ImageTransferer
+}
+
+func (r *tagPolicyRepository) Manifests(
+	ctx context.Context,
+	options ...distribution.ManifestServiceOption) (distribution.ManifestService, error) {
+
+	ms, err := r.Repository.Manifests(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &tagPolicyManifests{ms, r.Named().Name(), r.transferer}, nil
+}
+
+type tagPolicyManifests struct {
+	distribution.ManifestService
+	repo       string
+	transferer transfer.ImageTransferer
+}
+
+func (m *tagPolicyManifests) Put(
+	ctx context.Context,
+	manifest distribution.Manifest,
+	options ...distribution.ManifestServiceOption) (digest.Digest, error) {
+
+	for _, option := range options {
+		if o, ok := option.(distribution.WithTagOption); ok {
+			if err := m.checkTag(o.Tag, manifest); err != nil {
+				return "", err
+			}
+		}
+	}
+	return m.ManifestService.Put(ctx, manifest, options...)
+}
+
+// checkTag returns a TAG_INVALID registry error if tagging manifest violates
+// the policy of the tag.
+func (m *tagPolicyManifests) checkTag(tag string, manifest distribution.Manifest) error {
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return fmt.Errorf("manifest payload: %s", err)
+	}
+	d, err := core.NewDigester().FromBytes(payload)
+	if err != nil {
+		return fmt.Errorf("digest manifest: %s", err)
+	}
+	err = m.transferer.CheckTag(fmt.Sprintf("%s:%s", m.repo, tag), d)
+	var v *tagpolicy.Violation
+	if errors.As(err, &v) {
+		return v2.ErrorCodeTagInvalid.WithMessage(v.Error())
+	}
+	return err
+}
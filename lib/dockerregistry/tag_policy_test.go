@@ -0,0 +1,105 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerregistry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/build-index/tagpolicy"
+	"github.com/uber/kraken/core"
+	mocktransfer "github.com/uber/kraken/mocks/lib/dockerregistry/transfer"
+)
+
+type testManifest struct {
+	payload []byte
+}
+
+func (m testManifest) References() []distribution.Descriptor { return nil }
+
+func (m testManifest) Payload() (string, []byte, error) {
+	return "application/vnd.docker.distribution.manifest.v2+json", m.payload, nil
+}
+
+type testManifestService struct {
+	distribution.ManifestService
+	puts int
+}
+
+func (s *testManifestService) Put(
+	ctx context.Context,
+	manifest distribution.Manifest,
+	options ...distribution.ManifestServiceOption) (digest.Digest, error) {
+
+	s.puts++
+	return "", nil
+}
+
+func TestTagPolicyManifestsPut(t *testing.T) {
+	manifest := testManifest{[]byte("manifest")}
+	d, err := core.NewDigester().FromBytes(manifest.payload)
+	require.NoError(t, err)
+
+	violation := &tagpolicy.Violation{Reason: tagpolicy.ReasonImmutable, Tag: "repo:v1"}
+
+	tests := []struct {
+		desc     string
+		options  []distribution.ManifestServiceOption
+		checkErr error
+		checks   int
+		puts     int
+	}{
+		{"untagged", nil, nil, 0, 1},
+		{"allowed", []distribution.ManifestServiceOption{distribution.WithTag("v1")}, nil, 1, 1},
+		{
+			"violation",
+			[]distribution.ManifestServiceOption{distribution.WithTag("v1")},
+			fmt.Errorf("check tag policy: %w", violation),
+			1,
+			0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			transferer := mocktransfer.NewMockImageTransferer(ctrl)
+			transferer.EXPECT().CheckTag("repo:v1", d).Return(test.checkErr).Times(test.checks)
+
+			ms := &testManifestService{}
+			m := &tagPolicyManifests{ms, "repo", transferer}
+
+			_, err := m.Put(context.Background(), manifest, test.options...)
+			if test.checkErr != nil {
+				e, ok := err.(errcode.Error)
+				require.True(ok, "expected errcode.Error, got %v", err)
+				require.Equal(v2.ErrorCodeTagInvalid, e.Code)
+			} else {
+				require.NoError(err)
+			}
+			require.Equal(test.puts, ms.puts)
+		})
+	}
+}
@@ -16,6 +16,7 @@ package transfer
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/uber-go/tally"
@@ -84,6 +85,19 @@ func (t *ReadOnlyTransferer) Download(namespace string, d core.Digest) (store.Fi
 	return f, nil
 }
 
+// DownloadRange downloads blobs as torrent and returns a reader positioned at
+// offset. Pieces are distributed across the swarm, so the whole blob must be
+// downloaded regardless of the range requested.
+func (t *ReadOnlyTransferer) DownloadRange(
+	namespace string, d core.Digest, offset int64) (io.ReadCloser, error) {
+
+	f, err := t.Download(namespace, d)
+	if err != nil {
+		return nil, err
+	}
+	return seekBlob(f, offset)
+}
+
 // Upload uploads blobs to a torrent network.
 func (t *ReadOnlyTransferer) Upload(namespace string, d core.Digest, blob store.FileReader) error {
 	return errors.New("unsupported operation")
@@ -108,6 +122,11 @@ func (t *ReadOnlyTransferer) PutTag(tag string, d core.Digest) error {
 	return errors.New("not supported")
 }
 
+// CheckTag is not supported.
+func (t *ReadOnlyTransferer) CheckTag(tag string, d core.Digest) error {
+	return errors.New("not supported")
+}
+
 // ListTags is not supported.
 func (t *ReadOnlyTransferer) ListTags(prefix string) ([]string, error) {
 	return nil, errors.New("not supported")
@@ -15,6 +15,7 @@ package transfer
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/uber/kraken/build-index/tagclient"
@@ -127,6 +128,38 @@ func (t *ReadWriteTransferer) downloadFromOrigin(namespace string, d core.Digest
 	return blob, nil
 }
 
+// DownloadRange returns a reader of the blob of d starting at offset. Reads
+// from the start of a blob which is not cached locally download it into the
+// file store as Download does. Reads from later offsets, e.g. resumed pulls,
+// are streamed from the origin cluster instead, so bytes the client already
+// has are not transferred again. Since the stream is only requested once the
+// reader is returned, origin errors surface when reading.
+func (t *ReadWriteTransferer) DownloadRange(
+	namespace string, d core.Digest, offset int64) (io.ReadCloser, error) {
+
+	blob, err := t.cas.GetCacheFileReader(d.Hex())
+	if err == nil {
+		return seekBlob(blob, offset)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("get cache file: %s", err)
+	}
+	if offset == 0 {
+		return t.downloadFromOrigin(namespace, d)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		err := t.originCluster.DownloadBlobRange(namespace, d, offset, -1, pw)
+		if err == blobclient.ErrBlobNotFound {
+			err = ErrBlobNotFound
+		} else if err != nil {
+			err = fmt.Errorf("origin: %s", err)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
 // Upload uploads blob to the origin cluster.
 func (t *ReadWriteTransferer) Upload(
 	namespace string, d core.Digest, blob store.FileReader,
@@ -162,6 +195,15 @@ func (t *ReadWriteTransferer) PutTag(tag string, d core.Digest) error {
 	return nil
 }
 
+// CheckTag checks whether putting tag to d would violate the policy of tag.
+// Violations wrap *tagpolicy.Violation.
+func (t *ReadWriteTransferer) CheckTag(tag string, d core.Digest) error {
+	if err := t.tags.CheckPolicy(tag, d); err != nil {
+		return fmt.Errorf("check tag policy: %w", err)
+	}
+	return nil
+}
+
 // ListTags lists all tags with prefix.
 func (t *ReadWriteTransferer) ListTags(prefix string) ([]string, error) {
 	return t.tags.List(prefix)
@@ -17,6 +17,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"os"
 	"testing"
 
 	"github.com/uber/kraken/build-index/tagclient"
@@ -24,6 +25,7 @@ import (
 	"github.com/uber/kraken/lib/store"
 	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
 	mockblobclient "github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/dockerutil"
 	"github.com/uber/kraken/utils/mockutil"
 	"github.com/uber/kraken/utils/testutil"
@@ -83,6 +85,78 @@ func TestReadWriteTransfererDownloadCachesBlob(t *testing.T) {
 	}
 }
 
+func TestReadWriteTransfererDownloadRangeFromCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	namespace := "docker/test-image"
+	blob := core.NewBlobFixture()
+
+	require.NoError(mocks.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	r, err := transferer.DownloadRange(namespace, blob.Digest, 100)
+	require.NoError(err)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content[100:], b)
+}
+
+func TestReadWriteTransfererDownloadRangeStreamsFromOrigin(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	namespace := "docker/test-image"
+	blob := core.NewBlobFixture()
+
+	mocks.originCluster.EXPECT().DownloadBlobRange(
+		namespace, blob.Digest, int64(100), int64(-1), gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+			_, err := dst.Write(blob.Content[offset:])
+			return err
+		})
+
+	r, err := transferer.DownloadRange(namespace, blob.Digest, 100)
+	require.NoError(err)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content[100:], b)
+
+	// Partial reads are not cached.
+	_, err = mocks.cas.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestReadWriteTransfererDownloadRangeNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	namespace := "docker/test-image"
+	blob := core.NewBlobFixture()
+
+	mocks.originCluster.EXPECT().DownloadBlobRange(
+		namespace, blob.Digest, int64(100), int64(-1), gomock.Any()).Return(blobclient.ErrBlobNotFound)
+
+	r, err := transferer.DownloadRange(namespace, blob.Digest, 100)
+	require.NoError(err)
+	defer r.Close()
+	_, err = io.ReadAll(r)
+	require.Equal(ErrBlobNotFound, err)
+}
+
 func TestReadWriteTransfererGetTag(t *testing.T) {
 	require := require.New(t)
 
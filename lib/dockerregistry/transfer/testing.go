@@ -15,6 +15,7 @@ package transfer
 
 import (
 	"fmt"
+	"io"
 	"path"
 	"strings"
 
@@ -56,6 +57,16 @@ func (t *testTransferer) Download(namespace string, d core.Digest) (store.FileRe
 	return t.cas.GetCacheFileReader(d.Hex())
 }
 
+func (t *testTransferer) DownloadRange(
+	namespace string, d core.Digest, offset int64) (io.ReadCloser, error) {
+
+	f, err := t.cas.GetCacheFileReader(d.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return seekBlob(f, offset)
+}
+
 func (t *testTransferer) Upload(namespace string, d core.Digest, blob store.FileReader) error {
 	return t.cas.CreateCacheFile(d.Hex(), blob)
 }
@@ -81,6 +92,10 @@ func (t *testTransferer) PutTag(tag string, d core.Digest) error {
 	return nil
 }
 
+func (t *testTransferer) CheckTag(tag string, d core.Digest) error {
+	return nil
+}
+
 func (t *testTransferer) ListTags(prefix string) ([]string, error) {
 	prefix = path.Join(t.tagPather.BasePath(), prefix)
 	var tags []string
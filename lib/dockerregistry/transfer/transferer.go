@@ -14,6 +14,9 @@
 package transfer
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 )
@@ -22,9 +25,20 @@ import (
 type ImageTransferer interface {
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	Download(namespace string, d core.Digest) (store.FileReader, error)
+	DownloadRange(namespace string, d core.Digest, offset int64) (io.ReadCloser, error)
 	Upload(namespace string, d core.Digest, blob store.FileReader) error
 
 	GetTag(tag string) (core.Digest, error)
 	PutTag(tag string, d core.Digest) error
+	CheckTag(tag string, d core.Digest) error
 	ListTags(prefix string) ([]string, error)
 }
+
+// seekBlob positions blob at offset, closing it on failure.
+func seekBlob(blob store.FileReader, offset int64) (io.ReadCloser, error) {
+	if _, err := blob.Seek(offset, io.SeekStart); err != nil {
+		blob.Close()
+		return nil, fmt.Errorf("seek: %s", err)
+	}
+	return blob, nil
+}
@@ -45,6 +45,7 @@ type Watcher interface {
 // to be healthy (see Locations).
 type Ring interface {
 	Locations(d core.Digest) []string
+	ReplicaLocations(d core.Digest, replicas int) []string
 	Contains(addr string) bool
 	Monitor(stop <-chan struct{})
 	Refresh()
@@ -94,6 +95,14 @@ func New(
 // the first address which owns d (regardless of health). As such, Locations
 // always returns a non-empty list.
 func (r *ring) Locations(d core.Digest) []string {
+	return r.ReplicaLocations(d, r.config.MaxReplica)
+}
+
+// ReplicaLocations is like Locations, but with a replica set of size replicas
+// instead of the configured max replica count. Since replica sets are ordered
+// by rendezvous hash, smaller replica sets of d are always prefixes of larger
+// ones.
+func (r *ring) ReplicaLocations(d core.Digest, replicas int) []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -108,7 +117,7 @@ func (r *ring) Locations(d core.Digest) []string {
 	}
 
 	var locs []string
-	for i := 0; i < len(nodes) && (len(locs) == 0 || i < r.config.MaxReplica); i++ {
+	for i := 0; i < len(nodes) && (len(locs) == 0 || i < replicas); i++ {
 		addr := nodes[i].Label
 		if r.healthy.Has(addr) {
 			locs = append(locs, addr)
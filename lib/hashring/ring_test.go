@@ -165,6 +165,29 @@ func TestRingLocationsReturnsFirstHostWhenAllHostsUnhealthy(t *testing.T) {
 	}
 }
 
+func TestRingReplicaLocations(t *testing.T) {
+	require := require.New(t)
+
+	r := New(
+		Config{MaxReplica: 3},
+		hostlist.Fixture(addrsFixture(6)...),
+		healthcheck.IdentityFilter{})
+
+	for i := 0; i < 100; i++ {
+		d := core.DigestFixture()
+
+		locs := r.Locations(d)
+		require.Len(locs, 3)
+		require.Equal(locs, r.ReplicaLocations(d, 3))
+
+		// Replica sets of other sizes share the same order.
+		require.Equal(locs[:2], r.ReplicaLocations(d, 2))
+		require.Equal(locs, r.ReplicaLocations(d, 5)[:3])
+		require.Len(r.ReplicaLocations(d, 5), 5)
+		require.Len(r.ReplicaLocations(d, 10), 6)
+	}
+}
+
 func TestRingContains(t *testing.T) {
 	require := require.New(t)
 
@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -139,8 +140,14 @@ func getLocalNames() (stringset.Set, error) {
 			return nil, fmt.Errorf("addrs of %v: %s", i, err)
 		}
 		for _, addr := range addrs {
-			ip := net.ParseIP(addr.String()).To4()
-			if ip == nil {
+			var ip net.IP
+			switch v := addr.(type) {
+			case *net.IPNet:
+				ip = v.IP
+			case *net.IPAddr:
+				ip = v.IP
+			}
+			if ip == nil || ip.IsLoopback() {
 				continue
 			}
 			result.Add(ip.String())
@@ -160,15 +167,13 @@ func getLocalNames() (stringset.Set, error) {
 func attachPortIfMissing(names stringset.Set, port int) (stringset.Set, error) {
 	result := make(stringset.Set)
 	for name := range names {
-		parts := strings.Split(name, ":")
-		switch len(parts) {
-		case 1:
-			// Name is in 'host' format -- attach port.
-			name = fmt.Sprintf("%s:%d", parts[0], port)
-		case 2:
-			// No-op, name is already in "ip:port" format.
-		default:
-			return nil, fmt.Errorf("invalid name format: %s, expected 'host' or 'ip:port'", name)
+		if _, _, err := net.SplitHostPort(name); err != nil {
+			// Name is in 'host' format -- attach port. Bare ipv6 addresses
+			// contain colons, and are bracketed by JoinHostPort.
+			if strings.Contains(name, ":") && net.ParseIP(name) == nil {
+				return nil, fmt.Errorf("invalid name format: %s, expected 'host' or 'ip:port'", name)
+			}
+			name = net.JoinHostPort(name, strconv.Itoa(port))
 		}
 		result.Add(name)
 	}
@@ -38,6 +38,12 @@ func TestAttachPortIfMissing(t *testing.T) {
 	require.Equal(t, stringset.New("x:7", "y:5", "z:7"), addrs)
 }
 
+func TestAttachPortIfMissingIPv6(t *testing.T) {
+	addrs, err := attachPortIfMissing(stringset.New("fd00::1", "[fd00::2]:5"), 7)
+	require.NoError(t, err)
+	require.Equal(t, stringset.New("[fd00::1]:7", "[fd00::2]:5"), addrs)
+}
+
 func TestAttachPortIfMissingError(t *testing.T) {
 	_, err := attachPortIfMissing(stringset.New("a:b:c"), 7)
 	require.Error(t, err)
@@ -0,0 +1,83 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package kafkarest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// ContentType is the content type of the v2 Kafka REST API for json records.
+const ContentType = "application/vnd.kafka.json.v2+json"
+
+// Record is a Kafka record whose value is encoded as json.
+type Record struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+type produceRequest struct {
+	Records []Record `json:"records"`
+}
+
+// Producer produces records to a Kafka topic through a Kafka REST proxy, which
+// avoids a native Kafka client.
+type Producer struct {
+	url     string
+	timeout time.Duration
+}
+
+// NewProducer creates a Producer which produces to topic through restProxy.
+// restProxy defaults to http if it has no scheme.
+func NewProducer(restProxy, topic string, timeout time.Duration) (*Producer, error) {
+	if restProxy == "" {
+		return nil, errors.New("no rest proxy supplied")
+	}
+	if topic == "" {
+		return nil, errors.New("no topic supplied")
+	}
+	if !strings.Contains(restProxy, "://") {
+		restProxy = "http://" + restProxy
+	}
+	return &Producer{
+		url:     fmt.Sprintf("%s/topics/%s", strings.TrimSuffix(restProxy, "/"), url.PathEscape(topic)),
+		timeout: timeout,
+	}, nil
+}
+
+// Produce produces records in a single request.
+func (p *Producer) Produce(records ...Record) error {
+	b, err := json.Marshal(produceRequest{records})
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	resp, err := httputil.Post(
+		p.url,
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendHeaders(map[string]string{"Content-Type": ContentType}),
+		httputil.SendTimeout(p.timeout))
+	if err != nil {
+		return err
+	}
+	closers.Close(resp.Body)
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package kafkarest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProducerProduce(t *testing.T) {
+	require := require.New(t)
+
+	var path, contentType string
+	var body []byte
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		contentType = r.Header.Get("Content-Type")
+		b, err := io.ReadAll(r.Body)
+		require.NoError(err)
+		body = b
+	}))
+	defer stop()
+
+	// The scheme of the proxy is optional, and topics are escaped.
+	p, err := NewProducer(addr+"/", "a/b", time.Second)
+	require.NoError(err)
+
+	require.NoError(p.Produce(Record{"k1", "v1"}, Record{"k2", 2}))
+
+	require.Equal("/topics/a%2Fb", path)
+	require.Equal(ContentType, contentType)
+	require.JSONEq(`{"records": [{"key": "k1", "value": "v1"}, {"key": "k2", "value": 2}]}`, string(body))
+}
+
+func TestProducerError(t *testing.T) {
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer stop()
+
+	p, err := NewProducer("http://"+addr, "topic", time.Second)
+	require.NoError(t, err)
+
+	require.Error(t, p.Produce(Record{"k", json.RawMessage(`{}`)}))
+}
+
+func TestNewProducerInvalidConfig(t *testing.T) {
+	_, err := NewProducer("", "topic", time.Second)
+	require.Error(t, err)
+
+	_, err = NewProducer("localhost:8082", "", time.Second)
+	require.Error(t, err)
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metainfogen
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ErrQueueFull is returned when no more background jobs can be queued.
+var ErrQueueFull = errors.New("metainfo generation queue is full")
+
+// Job states.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+)
+
+// JobStatus reports the progress of a background metainfo generation job.
+type JobStatus struct {
+	Digest    core.Digest `json:"digest"`
+	Namespace string      `json:"namespace"`
+	State     string      `json:"state"`
+	QueuedAt  time.Time   `json:"queued_at"`
+	Size      int64       `json:"size"`
+	Hashed    int64       `json:"hashed"`
+}
+
+// Job is a background metainfo generation job.
+type Job struct {
+	namespace   string
+	d           core.Digest
+	pieceLength int64
+	size        int64
+	queuedAt    time.Time
+	running     atomic.Bool
+	hashed      atomic.Int64
+	done        chan struct{}
+	err         error
+}
+
+func newDoneJob() *Job {
+	j := &Job{done: make(chan struct{})}
+	close(j.done)
+	return j
+}
+
+// Done returns a channel which is closed once the metainfo is generated or
+// generation failed.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Err returns the error which failed the job. Must only be called once Done
+// is closed.
+func (j *Job) Err() error {
+	return j.err
+}
+
+// Status returns the progress of the job.
+func (j *Job) Status() JobStatus {
+	state := JobQueued
+	if j.running.Load() {
+		state = JobRunning
+	}
+	return JobStatus{
+		Digest:    j.d,
+		Namespace: j.namespace,
+		State:     state,
+		QueuedAt:  j.queuedAt,
+		Size:      j.size,
+		Hashed:    j.hashed.Load(),
+	}
+}
+
+// jobPool runs background metainfo generation jobs on a bounded number of
+// workers, deduplicating jobs per blob.
+type jobPool struct {
+	config AsyncConfig
+	g      *Generator
+	queue  chan *Job
+
+	mu   sync.Mutex
+	jobs map[core.Digest]*Job
+}
+
+func newJobPool(config AsyncConfig, g *Generator) *jobPool {
+	p := &jobPool{
+		config: config,
+		g:      g,
+		queue:  make(chan *Job, config.QueueSize),
+		jobs:   make(map[core.Digest]*Job),
+	}
+	for i := 0; i < config.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *jobPool) start(namespace string, d core.Digest, pieceLength int64) (*Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if j, ok := p.jobs[d]; ok {
+		return j, nil
+	}
+	// Jobs are removed only after their metainfo is written, so metainfo
+	// which exists now was generated by a job which just finished.
+	var tm metadata.TorrentMeta
+	if err := p.g.cas.GetCacheFileMetadata(d.Hex(), &tm); err == nil {
+		return newDoneJob(), nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("get metainfo: %s", err)
+	}
+	info, err := p.g.cas.GetCacheFileStat(d.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("cache stat: %s", err)
+	}
+	if pieceLength == 0 {
+		pieceLength = p.g.GetPieceLength(namespace, info.Size())
+	}
+	j := &Job{
+		namespace:   namespace,
+		d:           d,
+		pieceLength: pieceLength,
+		size:        info.Size(),
+		queuedAt:    time.Now(),
+		done:        make(chan struct{}),
+	}
+	select {
+	case p.queue <- j:
+	default:
+		return nil, ErrQueueFull
+	}
+	p.jobs[d] = j
+	return j, nil
+}
+
+func (p *jobPool) work() {
+	for j := range p.queue {
+		j.running.Store(true)
+		start := time.Now()
+		j.err = p.g.generate(j.d, j.pieceLength, &j.hashed)
+		if j.err != nil {
+			log.With("namespace", j.namespace, "digest", j.d.Hex()).Errorf(
+				"Failed to generate metainfo in background: %s", j.err)
+		} else {
+			log.With(
+				"namespace", j.namespace,
+				"digest", j.d.Hex(),
+				"size", j.size,
+				"duration", time.Since(start)).Info("Generated metainfo in background")
+		}
+		p.mu.Lock()
+		delete(p.jobs, j.d)
+		p.mu.Unlock()
+		close(j.done)
+	}
+}
+
+func (p *jobPool) statuses() []JobStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(p.jobs))
+	for _, j := range p.jobs {
+		statuses = append(statuses, j.Status())
+	}
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].QueuedAt.Before(statuses[k].QueuedAt)
+	})
+	return statuses
+}
+
+// Async returns true if metainfo for blobs of size bytes should be generated
+// by a background job via Start.
+func (g *Generator) Async(size int64) bool {
+	return g.async != nil && size >= int64(g.async.config.SizeThreshold)
+}
+
+// Start queues a background job which generates metainfo for the blob of d in
+// namespace, with pieceLength if non-zero. Returns the pending job of d if it
+// already has one, or a done job if its metainfo exists. Returns ErrQueueFull
+// if too many jobs are pending.
+func (g *Generator) Start(namespace string, d core.Digest, pieceLength int64) (*Job, error) {
+	if g.async == nil {
+		return nil, errors.New("background generation is disabled")
+	}
+	if pieceLength < 0 || pieceLength > maxPieceLength {
+		return nil, fmt.Errorf("invalid piece length: %d", pieceLength)
+	}
+	return g.async.start(namespace, d, pieceLength)
+}
+
+// Jobs returns the status of pending background jobs, oldest first.
+func (g *Generator) Jobs() []JobStatus {
+	if g.async == nil {
+		return nil
+	}
+	return g.async.statuses()
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metainfogen
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartGeneratesMetaInfoInBackground(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator, err := New(Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10},
+		Async:        AsyncConfig{SizeThreshold: 50},
+	}, cas)
+	require.NoError(err)
+
+	require.False(generator.Async(49))
+	require.True(generator.Async(50))
+
+	blob := core.SizedBlobFixture(100, 10)
+
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	job, err := generator.Start(core.NamespaceFixture(), blob.Digest, 0)
+	require.NoError(err)
+
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		require.FailNow("job did not finish")
+	}
+	require.NoError(job.Err())
+	require.Equal(int64(100), job.Status().Hashed)
+	require.Empty(generator.Jobs())
+
+	var tm metadata.TorrentMeta
+	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.MetaInfo, tm.MetaInfo)
+
+	// Metainfo already exists, so no job is queued.
+	job, err = generator.Start(core.NamespaceFixture(), blob.Digest, 0)
+	require.NoError(err)
+	select {
+	case <-job.Done():
+	default:
+		require.FailNow("job is not done")
+	}
+}
+
+func TestStartWithPieceLength(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator, err := New(Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10},
+		Async:        AsyncConfig{SizeThreshold: 1},
+	}, cas)
+	require.NoError(err)
+
+	blob := core.SizedBlobFixture(100, 25)
+
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	job, err := generator.Start(core.NamespaceFixture(), blob.Digest, 25)
+	require.NoError(err)
+	<-job.Done()
+	require.NoError(job.Err())
+
+	var tm metadata.TorrentMeta
+	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.MetaInfo, tm.MetaInfo)
+}
+
+func TestStartBlobNotCached(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator, err := New(Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10},
+		Async:        AsyncConfig{SizeThreshold: 1},
+	}, cas)
+	require.NoError(err)
+
+	_, err = generator.Start(core.NamespaceFixture(), core.DigestFixture(), 0)
+	require.Error(err)
+}
+
+func TestStartDisabled(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator := Fixture(cas, 10)
+
+	require.False(generator.Async(1 << 40))
+
+	_, err := generator.Start(core.NamespaceFixture(), core.DigestFixture(), 0)
+	require.Error(err)
+	require.Empty(generator.Jobs())
+}
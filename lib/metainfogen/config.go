@@ -15,14 +15,67 @@ package metainfogen
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"sort"
 
 	"github.com/c2h5oh/datasize"
+
+	"github.com/uber/kraken/lib/delta"
 )
 
+// maxPieceLength is the largest supported piece length, since piece payload
+// lengths are sent as 32 bit integers.
+const maxPieceLength = math.MaxInt32
+
 // Config defines Generator configuration.
 type Config struct {
 	PieceLengths map[datasize.ByteSize]datasize.ByteSize `yaml:"piece_lengths"`
+
+	// NamespacePieceLengths override PieceLengths for blobs of matching
+	// namespaces, e.g. to use larger pieces for huge model blobs.
+	NamespacePieceLengths []NamespacePieceLengthConfig `yaml:"namespace_piece_lengths"`
+
+	// ChunkIndex configures content-defined chunk indexes, which agents use
+	// to assemble blobs from similar blobs they already have.
+	ChunkIndex delta.IndexConfig `yaml:"chunk_index"`
+
+	// Async configures background metainfo generation for large blobs.
+	Async AsyncConfig `yaml:"async"`
+}
+
+// AsyncConfig defines background metainfo generation configuration.
+type AsyncConfig struct {
+	// SizeThreshold is the blob size from which metainfo is generated by a
+	// background job instead of while the request which cached the blob waits.
+	// A 0 threshold disables background generation.
+	SizeThreshold datasize.ByteSize `yaml:"size_threshold"`
+
+	// Workers is the number of jobs which hash blobs concurrently.
+	Workers int `yaml:"workers"`
+
+	// QueueSize is the number of jobs which may wait for a worker.
+	QueueSize int `yaml:"queue_size"`
+}
+
+func (c AsyncConfig) applyDefaults() AsyncConfig {
+	if c.Workers == 0 {
+		c.Workers = 2
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 64
+	}
+	return c
+}
+
+// NamespacePieceLengthConfig defines the piece lengths of blobs of namespaces
+// matching Namespace.
+type NamespacePieceLengthConfig struct {
+	// Namespace is a regular expression. Only the first matching config
+	// applies to a namespace.
+	Namespace string `yaml:"namespace"`
+
+	PieceLengths map[datasize.ByteSize]datasize.ByteSize `yaml:"piece_lengths"`
 }
 
 type rangeConfig struct {
@@ -56,6 +109,10 @@ func newPieceLengthConfig(
 	}
 	var ranges []rangeConfig
 	for fileSize, pieceLength := range pieceLengthByFileSize {
+		if pieceLength == 0 || pieceLength > maxPieceLength {
+			return nil, fmt.Errorf(
+				"piece length %s out of range (0, %s]", pieceLength, datasize.ByteSize(maxPieceLength))
+		}
 		ranges = append(ranges, rangeConfig{
 			fileSize:    int64(fileSize),
 			pieceLength: int64(pieceLength),
@@ -36,3 +36,16 @@ func TestPieceLengthConfig(t *testing.T) {
 	require.Equal(int64(8*datasize.MB), plConfig.get(int64(4*datasize.GB)))
 	require.Equal(int64(8*datasize.MB), plConfig.get(int64(8*datasize.GB)))
 }
+
+func TestPieceLengthConfigOutOfRange(t *testing.T) {
+	require := require.New(t)
+
+	_, err := newPieceLengthConfig(map[datasize.ByteSize]datasize.ByteSize{0: 0})
+	require.Error(err)
+
+	_, err = newPieceLengthConfig(map[datasize.ByteSize]datasize.ByteSize{0: 2 * datasize.GB})
+	require.Error(err)
+
+	_, err = newPieceLengthConfig(map[datasize.ByteSize]datasize.ByteSize{0: 16 * datasize.MB})
+	require.NoError(err)
+}
@@ -16,17 +16,30 @@ package metainfogen
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"regexp"
+	"sync/atomic"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/closers"
 )
 
 // Generator wraps static piece length configuration in order to determinstically
 // generate metainfo.
 type Generator struct {
+	pieceLengthConfig     *pieceLengthConfig
+	namespacePieceLengths []namespacePieceLengthConfig
+	chunkIndexConfig      delta.IndexConfig
+	cas                   *store.CAStore
+	async                 *jobPool
+}
+
+type namespacePieceLengthConfig struct {
+	regexp            *regexp.Regexp
 	pieceLengthConfig *pieceLengthConfig
-	cas               *store.CAStore
 }
 
 // New creates a new Generator.
@@ -35,32 +48,101 @@ func New(config Config, cas *store.CAStore) (*Generator, error) {
 	if err != nil {
 		return nil, fmt.Errorf("piece length config: %s", err)
 	}
-	return &Generator{plConfig, cas}, nil
+	var nplConfigs []namespacePieceLengthConfig
+	for _, c := range config.NamespacePieceLengths {
+		re, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: regexp: %s", c.Namespace, err)
+		}
+		npl, err := newPieceLengthConfig(c.PieceLengths)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: piece length config: %s", c.Namespace, err)
+		}
+		nplConfigs = append(nplConfigs, namespacePieceLengthConfig{re, npl})
+	}
+	g := &Generator{
+		pieceLengthConfig:     plConfig,
+		namespacePieceLengths: nplConfigs,
+		chunkIndexConfig:      config.ChunkIndex,
+		cas:                   cas,
+	}
+	if config.Async.SizeThreshold > 0 {
+		g.async = newJobPool(config.Async.applyDefaults(), g)
+	}
+	return g, nil
 }
 
-// Generate generates metainfo for the blob of d and writes it to disk.
-func (g *Generator) Generate(d core.Digest) error {
+// Generate generates metainfo for the blob of d in namespace and writes it to
+// disk.
+func (g *Generator) Generate(namespace string, d core.Digest) error {
 	info, err := g.cas.GetCacheFileStat(d.Hex())
 	if err != nil {
 		return fmt.Errorf("cache stat: %s", err)
 	}
+	return g.generate(d, g.GetPieceLength(namespace, info.Size()), nil)
+}
+
+// GenerateWithPieceLength generates metainfo with pieceLength for the blob of
+// d and writes it to disk. Used to match metainfo generated by other origins,
+// which may have used a different piece length than this origin would.
+func (g *Generator) GenerateWithPieceLength(d core.Digest, pieceLength int64) error {
+	if pieceLength <= 0 || pieceLength > maxPieceLength {
+		return fmt.Errorf("invalid piece length: %d", pieceLength)
+	}
+	return g.generate(d, pieceLength, nil)
+}
+
+// generate hashes the blob of d into metainfo with pieceLength. If hashed is
+// not nil, it is updated with the number of bytes hashed so far.
+func (g *Generator) generate(d core.Digest, pieceLength int64, hashed *atomic.Int64) error {
 	f, err := g.cas.GetCacheFileReader(d.Hex())
 	if err != nil {
 		return fmt.Errorf("get cache file: %s", err)
 	}
-	pieceLength := g.pieceLengthConfig.get(info.Size())
-	mi, err := core.NewMetaInfo(d, f, pieceLength)
+	defer closers.Close(f)
+	var r io.Reader = f
+	if hashed != nil {
+		r = &countingReader{f, hashed}
+	}
+	mi, err := core.NewMetaInfo(d, r, pieceLength)
 	if err != nil {
 		return fmt.Errorf("create metainfo: %s", err)
 	}
 	if _, err := g.cas.SetCacheFileMetadata(d.Hex(), metadata.NewTorrentMeta(mi)); err != nil {
 		return fmt.Errorf("set metainfo: %s", err)
 	}
+	if g.chunkIndexConfig.Enabled {
+		if err := g.generateChunkIndex(d); err != nil {
+			return fmt.Errorf("generate chunk index: %s", err)
+		}
+	}
 	return nil
 }
 
-// Get the piece length for the blob
-func (g *Generator) GetPieceLength(size int64) int64 {
+func (g *Generator) generateChunkIndex(d core.Digest) error {
+	f, err := g.cas.GetCacheFileReader(d.Hex())
+	if err != nil {
+		return fmt.Errorf("get cache file: %s", err)
+	}
+	defer closers.Close(f)
+	idx, err := delta.BuildIndex(f, g.chunkIndexConfig)
+	if err != nil {
+		return fmt.Errorf("build: %s", err)
+	}
+	if _, err := g.cas.SetCacheFileMetadata(d.Hex(), metadata.NewChunkIndex(idx)); err != nil {
+		return fmt.Errorf("set metadata: %s", err)
+	}
+	return nil
+}
+
+// GetPieceLength returns the piece length for a blob of size bytes in
+// namespace.
+func (g *Generator) GetPieceLength(namespace string, size int64) int64 {
+	for _, c := range g.namespacePieceLengths {
+		if c.regexp.MatchString(namespace) {
+			return c.pieceLengthConfig.get(size)
+		}
+	}
 	return g.pieceLengthConfig.get(size)
 }
 
@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
 
@@ -44,13 +45,109 @@ func TestGenerate(t *testing.T) {
 
 	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
 
-	require.NoError(generator.Generate(blob.Digest))
+	require.NoError(generator.Generate(core.NamespaceFixture(), blob.Digest))
 
 	var tm metadata.TorrentMeta
 	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
 	require.Equal(blob.MetaInfo, tm.MetaInfo)
 }
 
+func TestGenerateNamespacePieceLengths(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator, err := New(Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10},
+		NamespacePieceLengths: []NamespacePieceLengthConfig{{
+			Namespace:    "models/.*",
+			PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10, 50: 25},
+		}},
+	}, cas)
+	require.NoError(err)
+
+	require.Equal(int64(10), generator.GetPieceLength("models/foo", 49))
+	require.Equal(int64(25), generator.GetPieceLength("models/foo", 50))
+	require.Equal(int64(10), generator.GetPieceLength("images/foo", 50))
+
+	blob := core.SizedBlobFixture(100, 25)
+
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	require.NoError(generator.Generate("models/foo", blob.Digest))
+
+	var tm metadata.TorrentMeta
+	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.MetaInfo, tm.MetaInfo)
+}
+
+func TestGenerateWithPieceLength(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator, err := New(Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10},
+	}, cas)
+	require.NoError(err)
+
+	blob := core.SizedBlobFixture(100, 25)
+
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	require.NoError(generator.GenerateWithPieceLength(blob.Digest, 25))
+
+	var tm metadata.TorrentMeta
+	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.MetaInfo, tm.MetaInfo)
+
+	require.Error(generator.GenerateWithPieceLength(blob.Digest, 0))
+}
+
+func TestNewInvalidNamespacePieceLengths(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	_, err := New(Config{
+		PieceLengths:          map[datasize.ByteSize]datasize.ByteSize{0: 10},
+		NamespacePieceLengths: []NamespacePieceLengthConfig{{Namespace: "("}},
+	}, cas)
+	require.Error(err)
+
+	_, err = New(Config{
+		PieceLengths:          map[datasize.ByteSize]datasize.ByteSize{0: 10},
+		NamespacePieceLengths: []NamespacePieceLengthConfig{{Namespace: ".*"}},
+	}, cas)
+	require.Error(err)
+}
+
+func TestGenerateChunkIndex(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator, err := New(Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 1024},
+		ChunkIndex:   delta.IndexConfig{Enabled: true},
+	}, cas)
+	require.NoError(err)
+
+	blob := core.SizedBlobFixture(1024*1024, 1024)
+
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	require.NoError(generator.Generate(core.NamespaceFixture(), blob.Digest))
+
+	var ci metadata.ChunkIndex
+	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &ci))
+	require.Equal(int64(len(blob.Content)), ci.Index.Length())
+}
+
 func TestGenerateFromBuffer(t *testing.T) {
 	require := require.New(t)
 
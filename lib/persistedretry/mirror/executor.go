@@ -0,0 +1,110 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Executor executes mirror tasks by copying blobs from the primary backend
+// to the mirror backend named by each task.
+type Executor struct {
+	stats   tally.Scope
+	primary backend.Client
+	mirrors map[string]backend.Client
+}
+
+// NewExecutor creates a new Executor.
+func NewExecutor(
+	stats tally.Scope,
+	primary backend.Client,
+	mirrors map[string]backend.Client) *Executor {
+
+	stats = stats.Tagged(map[string]string{
+		"module": "mirrorexecutor",
+	})
+
+	return &Executor{stats, primary, mirrors}
+}
+
+// Name returns the executor name.
+func (e *Executor) Name() string {
+	return "mirror"
+}
+
+// Exec copies the blob of r from the primary backend to r's mirror.
+func (e *Executor) Exec(r persistedretry.Task) error {
+	t, ok := r.(*Task)
+	if !ok {
+		return fmt.Errorf("expected *Task, got %T", r)
+	}
+	start := time.Now()
+
+	mirror, ok := e.mirrors[t.Mirror]
+	if !ok {
+		log.With(
+			"namespace", t.Namespace,
+			"name", t.Name,
+			"mirror", t.Mirror).Info("Dropping copy to unconfigured mirror")
+		return nil
+	}
+	if _, err := mirror.Stat(t.Namespace, t.Name); err == nil {
+		// Blob already mirrored, no-op.
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "kraken-mirror-")
+	if err != nil {
+		return fmt.Errorf("create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := e.primary.Download(t.Namespace, t.Name, f); err != nil {
+		if err == backenderrors.ErrBlobNotFound {
+			// Nothing we can do about this but make noise and drop the task.
+			e.stats.Counter("missing_blobs").Inc(1)
+			log.With(
+				"namespace", t.Namespace,
+				"name", t.Name).Error("Blob missing from primary backend, dropping mirror copy")
+			return nil
+		}
+		return fmt.Errorf("download from primary: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek: %s", err)
+	}
+	if err := mirror.Upload(t.Namespace, t.Name, f); err != nil {
+		return fmt.Errorf("upload to mirror %s: %s", t.Mirror, err)
+	}
+	log.With(
+		"namespace", t.Namespace,
+		"name", t.Name,
+		"mirror", t.Mirror).Info("Copied blob to mirror backend")
+
+	// We don't want to time noops nor errors.
+	e.stats.Tagged(t.Tags()).Timer("copy").Record(time.Since(start))
+	e.stats.Tagged(t.Tags()).Timer("lifetime").Record(time.Since(t.CreatedAt))
+
+	return nil
+}
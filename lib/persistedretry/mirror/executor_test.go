@@ -0,0 +1,117 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mirror
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	mockbackend "github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/mockutil"
+)
+
+type executorMocks struct {
+	primary *mockbackend.MockClient
+	mirror  *mockbackend.MockClient
+}
+
+func newExecutor(t *testing.T) (*Executor, *executorMocks, func()) {
+	ctrl := gomock.NewController(t)
+	mocks := &executorMocks{
+		primary: mockbackend.NewMockClient(ctrl),
+		mirror:  mockbackend.NewMockClient(ctrl),
+	}
+	e := NewExecutor(tally.NoopScope, mocks.primary, map[string]backend.Client{
+		"a": mocks.mirror,
+	})
+	return e, mocks, ctrl.Finish
+}
+
+func TestExec(t *testing.T) {
+	require := require.New(t)
+
+	executor, mocks, cleanup := newExecutor(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	task := NewTask("ns", blob.Digest.Hex(), "a")
+
+	mocks.mirror.EXPECT().Stat("ns", task.Name).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.primary.EXPECT().Download("ns", task.Name, gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			_, err := dst.Write(blob.Content)
+			return err
+		})
+	mocks.mirror.EXPECT().Upload("ns", task.Name, mockutil.MatchReader(blob.Content)).Return(nil)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecNoopWhenAlreadyMirrored(t *testing.T) {
+	require := require.New(t)
+
+	executor, mocks, cleanup := newExecutor(t)
+	defer cleanup()
+
+	task := NewTask("ns", "name", "a")
+
+	mocks.mirror.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(1), nil)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecNoopWhenMirrorNotConfigured(t *testing.T) {
+	require := require.New(t)
+
+	executor, _, cleanup := newExecutor(t)
+	defer cleanup()
+
+	require.NoError(executor.Exec(NewTask("ns", "name", "unknown")))
+}
+
+func TestExecNoopWhenPrimaryMissingBlob(t *testing.T) {
+	require := require.New(t)
+
+	executor, mocks, cleanup := newExecutor(t)
+	defer cleanup()
+
+	task := NewTask("ns", "name", "a")
+
+	mocks.mirror.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.primary.EXPECT().Download("ns", "name", gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecUploadFailure(t *testing.T) {
+	require := require.New(t)
+
+	executor, mocks, cleanup := newExecutor(t)
+	defer cleanup()
+
+	task := NewTask("ns", "name", "a")
+
+	mocks.mirror.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.primary.EXPECT().Download("ns", "name", gomock.Any()).Return(nil)
+	mocks.mirror.EXPECT().Upload("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+	require.Error(executor.Exec(task))
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mirror
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/localdb"
+)
+
+func TestStoreAddAndGet(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture(t)
+	defer cleanup()
+
+	store := NewStore(db)
+
+	a := NewTask("ns", "name", "a")
+	b := NewTask("ns", "name", "b")
+
+	require.NoError(store.AddPending(a))
+	require.NoError(store.AddFailed(b))
+	require.Equal(persistedretry.ErrTaskExists, store.AddPending(a))
+
+	pending, err := store.GetPending()
+	require.NoError(err)
+	require.Len(pending, 1)
+	require.Equal("a", pending[0].(*Task).Mirror)
+
+	failed, err := store.GetFailed()
+	require.NoError(err)
+	require.Len(failed, 1)
+	require.Equal("b", failed[0].(*Task).Mirror)
+}
+
+func TestStoreMarkFailedAndPending(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture(t)
+	defer cleanup()
+
+	store := NewStore(db)
+
+	task := NewTask("ns", "name", "a")
+	require.NoError(store.AddPending(task))
+
+	require.NoError(store.MarkFailed(task))
+	require.Equal(1, task.Failures)
+
+	failed, err := store.GetFailed()
+	require.NoError(err)
+	require.Len(failed, 1)
+	require.Equal(1, failed[0].GetFailures())
+
+	require.NoError(store.MarkPending(task))
+
+	pending, err := store.GetPending()
+	require.NoError(err)
+	require.Len(pending, 1)
+
+	require.Equal(persistedretry.ErrTaskNotFound, store.MarkPending(NewTask("ns", "name", "b")))
+}
+
+func TestStoreRemoveAndFind(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture(t)
+	defer cleanup()
+
+	store := NewStore(db)
+
+	a := NewTask("ns", "name", "a")
+	b := NewTask("ns", "name", "b")
+	require.NoError(store.AddPending(a))
+	require.NoError(store.AddPending(b))
+	require.NoError(store.AddPending(NewTask("ns", "other", "a")))
+
+	tasks, err := store.Find(NewNameQuery("name"))
+	require.NoError(err)
+	require.Len(tasks, 2)
+
+	require.NoError(store.Remove(a))
+
+	tasks, err = store.Find(NewNameQuery("name"))
+	require.NoError(err)
+	require.Len(tasks, 1)
+	require.Equal("b", tasks[0].(*Task).Mirror)
+}
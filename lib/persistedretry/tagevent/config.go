@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import "time"
+
+// Config defines the sinks which tag events are delivered to.
+type Config struct {
+	Sinks []SinkConfig `yaml:"sinks"`
+}
+
+// SinkConfig defines a sink of tag events. Exactly one of Webhook and Kafka
+// must be set.
+type SinkConfig struct {
+	// Name identifies the sink in pending deliveries, and must be unique.
+	Name string `yaml:"name"`
+
+	// Namespace is a regexp of the tags whose events are delivered to the
+	// sink. Empty matches all tags.
+	Namespace string `yaml:"namespace"`
+
+	Webhook *WebhookConfig `yaml:"webhook"`
+	Kafka   *KafkaConfig   `yaml:"kafka"`
+}
+
+// WebhookConfig defines a sink which posts each event as JSON to an HTTP
+// endpoint.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+func (c WebhookConfig) applyDefaults() WebhookConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// KafkaConfig defines a sink which produces each event to a Kafka topic
+// through a Kafka REST proxy. Events are keyed by tag, such that events of
+// the same tag are ordered within their partition.
+type KafkaConfig struct {
+	RESTProxy string        `yaml:"rest_proxy"`
+	Topic     string        `yaml:"topic"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+func (c KafkaConfig) applyDefaults() KafkaConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
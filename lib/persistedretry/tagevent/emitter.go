@@ -0,0 +1,49 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"fmt"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/persistedretry"
+)
+
+// Emitter adds tasks which deliver the events of tags to their sinks.
+type Emitter struct {
+	sinks   *Sinks
+	cluster string
+	manager persistedretry.Manager
+}
+
+// NewEmitter creates a new Emitter of events which happen on cluster.
+func NewEmitter(sinks *Sinks, cluster string, manager persistedretry.Manager) *Emitter {
+	return &Emitter{sinks, cluster, manager}
+}
+
+// Enabled returns whether any sink receives events of tag.
+func (e *Emitter) Enabled(tag string) bool {
+	return len(e.sinks.Match(tag)) > 0
+}
+
+// Emit adds a task per sink which receives events of tag.
+func (e *Emitter) Emit(typ EventType, tag string, d core.Digest, replicated bool) error {
+	for _, sink := range e.sinks.Match(tag) {
+		task := NewTask(sink, typ, tag, d, e.cluster, replicated)
+		if err := e.manager.Add(task); err != nil {
+			return fmt.Errorf("add task for sink %s: %s", sink, err)
+		}
+	}
+	return nil
+}
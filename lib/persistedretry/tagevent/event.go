@@ -0,0 +1,54 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"strings"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// EventType describes the change of a tag.
+type EventType string
+
+// Event types.
+const (
+	Created EventType = "created"
+	Updated EventType = "updated"
+	Deleted EventType = "deleted"
+)
+
+// Event is delivered to sinks when a tag changes.
+type Event struct {
+	Type      EventType   `json:"type"`
+	Namespace string      `json:"namespace"`
+	Tag       string      `json:"tag"`
+	Digest    core.Digest `json:"digest"`
+
+	// Cluster is the build-index cluster the change was made on. Replicated
+	// is set if the change was replicated to Cluster from a remote cluster.
+	Cluster    string `json:"cluster"`
+	Replicated bool   `json:"replicated"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// namespace returns the repository of tag, i.e. its name before the version.
+func namespace(tag string) string {
+	if i := strings.LastIndex(tag, ":"); i != -1 {
+		return tag[:i]
+	}
+	return tag
+}
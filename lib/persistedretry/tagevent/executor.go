@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Executor executes tag event tasks by sending their events to the sink
+// named by each task.
+type Executor struct {
+	stats tally.Scope
+	sinks *Sinks
+}
+
+// NewExecutor creates a new Executor.
+func NewExecutor(stats tally.Scope, sinks *Sinks) *Executor {
+	stats = stats.Tagged(map[string]string{
+		"module": "tageventexecutor",
+	})
+	return &Executor{stats, sinks}
+}
+
+// Name returns the executor name.
+func (e *Executor) Name() string {
+	return "tagevent"
+}
+
+// Exec sends the event of r to r's sink.
+func (e *Executor) Exec(r persistedretry.Task) error {
+	t, ok := r.(*Task)
+	if !ok {
+		return fmt.Errorf("expected *Task, got %T", r)
+	}
+	start := time.Now()
+
+	sink, ok := e.sinks.Get(t.Sink)
+	if !ok {
+		log.With("tag", t.Tag, "sink", t.Sink).Info("Dropping event of unconfigured sink")
+		return nil
+	}
+	if err := sink.Send(t.Event()); err != nil {
+		return fmt.Errorf("send to sink %s: %s", t.Sink, err)
+	}
+
+	e.stats.Tagged(t.Tags()).Timer("send").Record(time.Since(start))
+	e.stats.Tagged(t.Tags()).Timer("lifetime").Record(time.Since(t.CreatedAt))
+
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+)
+
+func TestExecWebhook(t *testing.T) {
+	require := require.New(t)
+
+	events := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("secret", r.Header.Get("Authorization"))
+		var e Event
+		require.NoError(json.NewDecoder(r.Body).Decode(&e))
+		events <- e
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sinks, err := NewSinks(Config{Sinks: []SinkConfig{{
+		Name: "cd",
+		Webhook: &WebhookConfig{
+			URL:     server.URL,
+			Headers: map[string]string{"Authorization": "secret"},
+		},
+	}}})
+	require.NoError(err)
+	executor := NewExecutor(tally.NoopScope, sinks)
+
+	task := NewTask("cd", Created, "prod/repo:v1", core.DigestFixture(), "zone1", false)
+	require.NoError(executor.Exec(task))
+
+	e := <-events
+	require.Equal(Created, e.Type)
+	require.Equal("prod/repo", e.Namespace)
+	require.Equal("prod/repo:v1", e.Tag)
+	require.Equal(task.Digest, e.Digest)
+	require.Equal("zone1", e.Cluster)
+}
+
+func TestExecKafka(t *testing.T) {
+	require := require.New(t)
+
+	records := make(chan kafkaRecord, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/topics/tags", r.URL.Path)
+		require.Equal("application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		var req kafkaProduceRequest
+		require.NoError(json.NewDecoder(r.Body).Decode(&req))
+		require.Len(req.Records, 1)
+		records <- req.Records[0]
+	}))
+	defer server.Close()
+
+	sinks, err := NewSinks(Config{Sinks: []SinkConfig{{
+		Name:  "kafka",
+		Kafka: &KafkaConfig{RESTProxy: server.URL, Topic: "tags"},
+	}}})
+	require.NoError(err)
+	executor := NewExecutor(tally.NoopScope, sinks)
+
+	task := NewTask("kafka", Deleted, "prod/repo:v1", core.DigestFixture(), "zone1", true)
+	require.NoError(executor.Exec(task))
+
+	record := <-records
+	require.Equal("prod/repo:v1", record.Key)
+	require.Equal(Deleted, record.Value.Type)
+	require.True(record.Value.Replicated)
+}
+
+func TestExecSinkFailure(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sinks, err := NewSinks(Config{Sinks: []SinkConfig{{
+		Name:    "cd",
+		Webhook: &WebhookConfig{URL: server.URL},
+	}}})
+	require.NoError(err)
+	executor := NewExecutor(tally.NoopScope, sinks)
+
+	require.Error(executor.Exec(
+		NewTask("cd", Updated, core.TagFixture(), core.DigestFixture(), "zone1", false)))
+}
+
+func TestExecNoopWhenSinkNotConfigured(t *testing.T) {
+	require := require.New(t)
+
+	sinks, err := NewSinks(Config{})
+	require.NoError(err)
+	executor := NewExecutor(tally.NoopScope, sinks)
+
+	require.NoError(executor.Exec(
+		NewTask("unknown", Created, core.TagFixture(), core.DigestFixture(), "zone1", false)))
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/uber/kraken/lib/kafkarest"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// Sink delivers tag events.
+type Sink interface {
+	Send(Event) error
+}
+
+type sink struct {
+	Sink
+	name      string
+	namespace *regexp.Regexp
+}
+
+// Sinks routes tag events to configured sinks.
+type Sinks struct {
+	sinks []*sink
+}
+
+// NewSinks creates Sinks from config.
+func NewSinks(config Config) (*Sinks, error) {
+	var sinks []*sink
+	names := make(map[string]bool)
+	for _, c := range config.Sinks {
+		if c.Name == "" {
+			return nil, errors.New("sink name is empty")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate sink %s", c.Name)
+		}
+		names[c.Name] = true
+		ns, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: namespace regexp: %s", c.Name, err)
+		}
+		var s Sink
+		switch {
+		case c.Webhook != nil && c.Kafka == nil:
+			s = newWebhookSink(*c.Webhook)
+		case c.Kafka != nil && c.Webhook == nil:
+			s, err = newKafkaSink(*c.Kafka)
+			if err != nil {
+				return nil, fmt.Errorf("sink %s: kafka: %s", c.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("sink %s: exactly one of webhook and kafka must be set", c.Name)
+		}
+		sinks = append(sinks, &sink{s, c.Name, ns})
+	}
+	return &Sinks{sinks}, nil
+}
+
+// Match returns the names of the sinks which receive events of tag.
+func (s *Sinks) Match(tag string) []string {
+	var names []string
+	for _, sink := range s.sinks {
+		if sink.namespace.MatchString(tag) {
+			names = append(names, sink.name)
+		}
+	}
+	return names
+}
+
+// Get returns the sink of name.
+func (s *Sinks) Get(name string) (Sink, bool) {
+	for _, sink := range s.sinks {
+		if sink.name == name {
+			return sink.Sink, true
+		}
+	}
+	return nil, false
+}
+
+type webhookSink struct {
+	config WebhookConfig
+}
+
+func newWebhookSink(config WebhookConfig) *webhookSink {
+	return &webhookSink{config.applyDefaults()}
+}
+
+// Send posts e as JSON to the webhook. Any 2XX response is a success.
+func (s *webhookSink) Send(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	for k, v := range s.config.Headers {
+		headers[k] = v
+	}
+	resp, err := httputil.Post(
+		s.config.URL,
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendHeaders(headers),
+		httputil.SendTimeout(s.config.Timeout),
+		httputil.SendAcceptedCodes(
+			http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type kafkaSink struct {
+	producer *kafkarest.Producer
+}
+
+func newKafkaSink(config KafkaConfig) (*kafkaSink, error) {
+	config = config.applyDefaults()
+	p, err := kafkarest.NewProducer(config.RESTProxy, config.Topic, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaSink{p}, nil
+}
+
+// Send produces e to the topic of the sink, keyed by its tag.
+func (s *kafkaSink) Send(e Event) error {
+	return s.producer.Produce(kafkarest.Record{Key: e.Tag, Value: e})
+}
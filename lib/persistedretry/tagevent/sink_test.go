@@ -0,0 +1,61 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSinksErrors(t *testing.T) {
+	webhook := &WebhookConfig{URL: "http://localhost:8080"}
+	kafka := &KafkaConfig{RESTProxy: "http://localhost:8082", Topic: "tags"}
+
+	tests := []struct {
+		desc  string
+		sinks []SinkConfig
+	}{
+		{"empty name", []SinkConfig{{Webhook: webhook}}},
+		{"duplicate name", []SinkConfig{{Name: "a", Webhook: webhook}, {Name: "a", Kafka: kafka}}},
+		{"invalid namespace", []SinkConfig{{Name: "a", Namespace: "(", Webhook: webhook}}},
+		{"no sink", []SinkConfig{{Name: "a"}}},
+		{"both sinks", []SinkConfig{{Name: "a", Webhook: webhook, Kafka: kafka}}},
+		{"no kafka topic", []SinkConfig{{Name: "a", Kafka: &KafkaConfig{RESTProxy: "localhost:8082"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewSinks(Config{Sinks: test.sinks})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSinksMatch(t *testing.T) {
+	require := require.New(t)
+
+	sinks, err := NewSinks(Config{Sinks: []SinkConfig{
+		{Name: "all", Webhook: &WebhookConfig{URL: "http://localhost:8080"}},
+		{Name: "prod", Namespace: "^prod/.*", Kafka: &KafkaConfig{RESTProxy: "localhost:8082", Topic: "tags"}},
+	}})
+	require.NoError(err)
+
+	require.Equal([]string{"all", "prod"}, sinks.Match("prod/repo:v1"))
+	require.Equal([]string{"all"}, sinks.Match("dev/repo:v1"))
+
+	_, ok := sinks.Get("prod")
+	require.True(ok)
+	_, ok = sinks.Get("unknown")
+	require.False(ok)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/localdb"
+)
+
+func TestStoreAddAndGet(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture(t)
+	defer cleanup()
+
+	store := NewStore(db)
+
+	tag := core.TagFixture()
+	a := NewTask("a", Created, tag, core.DigestFixture(), "zone1", false)
+	b := NewTask("a", Updated, tag, core.DigestFixture(), "zone1", true)
+
+	require.NoError(store.AddPending(a))
+	require.NoError(store.AddFailed(b))
+	require.NotEqual(a.ID, b.ID)
+	require.Equal(persistedretry.ErrTaskExists, store.AddPending(a))
+
+	pending, err := store.GetPending()
+	require.NoError(err)
+	require.Len(pending, 1)
+	require.Equal(a.ID, pending[0].(*Task).ID)
+	require.Equal(a.Tag, pending[0].(*Task).Tag)
+	require.Equal("zone1", pending[0].(*Task).Cluster)
+
+	failed, err := store.GetFailed()
+	require.NoError(err)
+	require.Len(failed, 1)
+	require.Equal(b.Digest, failed[0].(*Task).Digest)
+	require.Equal(Updated, failed[0].(*Task).Type)
+	require.True(failed[0].(*Task).Replicated)
+}
+
+func TestStoreMarkFailedAndPending(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture(t)
+	defer cleanup()
+
+	store := NewStore(db)
+
+	task := NewTask("a", Deleted, core.TagFixture(), core.DigestFixture(), "zone1", false)
+	require.NoError(store.AddPending(task))
+
+	require.NoError(store.MarkFailed(task))
+	require.Equal(1, task.Failures)
+
+	failed, err := store.GetFailed()
+	require.NoError(err)
+	require.Len(failed, 1)
+	require.Equal(1, failed[0].GetFailures())
+
+	require.NoError(store.MarkPending(task))
+
+	pending, err := store.GetPending()
+	require.NoError(err)
+	require.Len(pending, 1)
+
+	require.NoError(store.Remove(task))
+	require.Equal(persistedretry.ErrTaskNotFound, store.MarkPending(task))
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// Task contains information to deliver a tag event to a sink.
+type Task struct {
+	ID          int64       `db:"id"`
+	Sink        string      `db:"sink"`
+	Type        EventType   `db:"type"`
+	Tag         string      `db:"tag"`
+	Digest      core.Digest `db:"digest"`
+	Cluster     string      `db:"cluster"`
+	Replicated  bool        `db:"replicated"`
+	CreatedAt   time.Time   `db:"created_at"`
+	LastAttempt time.Time   `db:"last_attempt"`
+	Failures    int         `db:"failures"`
+}
+
+// NewTask creates a new Task.
+func NewTask(
+	sink string,
+	typ EventType,
+	tag string,
+	d core.Digest,
+	cluster string,
+	replicated bool) *Task {
+
+	return &Task{
+		Sink:       sink,
+		Type:       typ,
+		Tag:        tag,
+		Digest:     d,
+		Cluster:    cluster,
+		Replicated: replicated,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// Event returns the event delivered by t.
+func (t *Task) Event() Event {
+	return Event{
+		Type:       t.Type,
+		Namespace:  namespace(t.Tag),
+		Tag:        t.Tag,
+		Digest:     t.Digest,
+		Cluster:    t.Cluster,
+		Replicated: t.Replicated,
+		Timestamp:  t.CreatedAt,
+	}
+}
+
+func (t *Task) String() string {
+	return fmt.Sprintf("tagevent.Task(sink=%s, type=%s, tag=%s)", t.Sink, t.Type, t.Tag)
+}
+
+// GetLastAttempt returns when t was last attempted.
+func (t *Task) GetLastAttempt() time.Time {
+	return t.LastAttempt
+}
+
+// GetFailures returns the number of times t has failed.
+func (t *Task) GetFailures() int {
+	return t.Failures
+}
+
+// Ready always returns true.
+func (t *Task) Ready() bool {
+	return true
+}
+
+// Tags tags metrics with the sink of t.
+func (t *Task) Tags() map[string]string {
+	return map[string]string{
+		"sink": t.Sink,
+	}
+}
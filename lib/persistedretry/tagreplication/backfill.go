@@ -0,0 +1,134 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrBackfillNotFound is returned when a backfill is not found.
+var ErrBackfillNotFound = errors.New("backfill not found")
+
+// Backfill statuses.
+const (
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// Backfill is the progress of replicating the existing tags of a prefix to a
+// remote build-index, e.g. one added after the tags were pushed. Tags are
+// listed in pages, and ContinuationToken is the page the backfill resumes
+// from.
+type Backfill struct {
+	Destination       string    `db:"destination" json:"destination"`
+	Prefix            string    `db:"prefix" json:"prefix"`
+	Pattern           string    `db:"pattern" json:"pattern"`
+	ContinuationToken string    `db:"continuation_token" json:"continuation_token"`
+	Replicated        int       `db:"replicated" json:"replicated"`
+	Deferred          int       `db:"deferred" json:"deferred"`
+	Skipped           int       `db:"skipped" json:"skipped"`
+	Failed            int       `db:"failed" json:"failed"`
+	Status            string    `db:"status" json:"status"`
+	Error             string    `db:"error" json:"error,omitempty"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// NewBackfill creates a new running Backfill.
+func NewBackfill(destination, prefix, pattern string) *Backfill {
+	now := time.Now()
+	return &Backfill{
+		Destination: destination,
+		Prefix:      prefix,
+		Pattern:     pattern,
+		Status:      BackfillRunning,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// BackfillStore stores backfills.
+type BackfillStore struct {
+	db *sqlx.DB
+}
+
+// NewBackfillStore creates a new BackfillStore.
+func NewBackfillStore(db *sqlx.DB) *BackfillStore {
+	return &BackfillStore{db}
+}
+
+// Put creates b, or replaces the backfill of the same destination and prefix.
+func (s *BackfillStore) Put(b *Backfill) error {
+	_, err := s.db.NamedExec(`
+		INSERT OR REPLACE INTO tag_backfill (
+			destination,
+			prefix,
+			pattern,
+			continuation_token,
+			replicated,
+			deferred,
+			skipped,
+			failed,
+			status,
+			error,
+			created_at,
+			updated_at
+		) VALUES (
+			:destination,
+			:prefix,
+			:pattern,
+			:continuation_token,
+			:replicated,
+			:deferred,
+			:skipped,
+			:failed,
+			:status,
+			:error,
+			:created_at,
+			:updated_at
+		)
+	`, b)
+	return err
+}
+
+// Get returns the backfill of prefix to destination.
+func (s *BackfillStore) Get(destination, prefix string) (*Backfill, error) {
+	var b Backfill
+	err := s.db.Get(&b, `
+		SELECT * FROM tag_backfill
+		WHERE destination=? AND prefix=?
+	`, destination, prefix)
+	if err == sql.ErrNoRows {
+		return nil, ErrBackfillNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// List returns all backfills.
+func (s *BackfillStore) List() ([]*Backfill, error) {
+	var backfills []*Backfill
+	err := s.db.Select(&backfills, `
+		SELECT * FROM tag_backfill
+		ORDER BY created_at
+	`)
+	return backfills, err
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/localdb"
+)
+
+func TestBackfillStorePutAndGet(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture(t)
+	defer cleanup()
+
+	store := NewBackfillStore(db)
+
+	_, err := store.Get("remote", "prod/")
+	require.Equal(ErrBackfillNotFound, err)
+
+	b := NewBackfill("remote", "prod/", "^prod/.*:v.*")
+	require.NoError(store.Put(b))
+
+	b.ContinuationToken = "token"
+	b.Replicated = 3
+	b.Skipped = 1
+	require.NoError(store.Put(b))
+
+	result, err := store.Get("remote", "prod/")
+	require.NoError(err)
+	require.Equal("^prod/.*:v.*", result.Pattern)
+	require.Equal("token", result.ContinuationToken)
+	require.Equal(3, result.Replicated)
+	require.Equal(1, result.Skipped)
+	require.Equal(BackfillRunning, result.Status)
+}
+
+func TestBackfillStoreList(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture(t)
+	defer cleanup()
+
+	store := NewBackfillStore(db)
+
+	require.NoError(store.Put(NewBackfill("a", "prod/", "")))
+	require.NoError(store.Put(NewBackfill("b", "prod/", "")))
+	require.NoError(store.Put(NewBackfill("a", "dev/", "")))
+
+	backfills, err := store.List()
+	require.NoError(err)
+	require.Len(backfills, 3)
+}
@@ -18,8 +18,10 @@ import (
 	"time"
 
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagpolicy"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/log"
 
 	"github.com/uber-go/tally"
 )
@@ -50,7 +52,8 @@ func (e *Executor) Name() string {
 }
 
 // Exec replicates a tag's blob dependencies to the task's remote origin
-// cluster, then replicates the tag to the remote build-index.
+// cluster, then replicates the tag to the remote build-index. Tombstone tasks
+// replicate the deletion of the tag to the remote build-index instead.
 func (e *Executor) Exec(r persistedretry.Task) error {
 	t, ok := r.(*Task)
 	if !ok {
@@ -59,6 +62,14 @@ func (e *Executor) Exec(r persistedretry.Task) error {
 	start := time.Now()
 	remoteTagClient := e.tagClientProvider.Provide(t.Destination)
 
+	if t.Tombstone() {
+		if err := remoteTagClient.ReplicateDelete(t.Tag, t.Digest, t.DeletedAt); err != nil {
+			return fmt.Errorf("replicate delete: %s", err)
+		}
+		e.stats.Timer("replicate_delete").Record(time.Since(start))
+		return nil
+	}
+
 	if ok, err := remoteTagClient.Has(t.Tag); err == nil && ok {
 		// Remote index already has the tag, therefore dependencies have already
 		// been replicated, and the remote has also replicated the tag. No-op.
@@ -78,7 +89,19 @@ func (e *Executor) Exec(r persistedretry.Task) error {
 	// Put tag and triggers replication on the remote client.
 	// Replication will call Exec n^2 times but some will return early
 	// if remote has the tag already.
-	if err := remoteTagClient.PutAndReplicate(t.Tag, t.Digest); err != nil {
+	if err := remoteTagClient.ReplicatePut(t.Tag, t.Digest, t.CreatedAt); err != nil {
+		if err == tagclient.ErrTagDeleted {
+			// The remote deleted the tag after this replication was
+			// created, so the deletion wins.
+			e.stats.Counter("superseded_by_tombstone").Inc(1)
+			return nil
+		}
+		if v, ok := err.(*tagpolicy.Violation); ok {
+			// Retrying cannot succeed until the remote policy changes.
+			log.With("tag", t.Tag, "dest", t.Destination).Errorf("Dropping tag replication: %s", v)
+			e.stats.Counter("policy_violations").Inc(1)
+			return nil
+		}
 		return fmt.Errorf("put and replicate tag: %s", err)
 	}
 
@@ -15,10 +15,13 @@ package tagreplication
 
 import (
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagpolicy"
 	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
 	mockblobclient "github.com/uber/kraken/mocks/origin/blobclient"
 )
@@ -70,12 +73,76 @@ func TestExecutor(t *testing.T) {
 			task.Tag, task.Dependencies[1], _testRemoteOrigin).Return(nil),
 		mocks.originCluster.EXPECT().ReplicateToRemote(
 			task.Tag, task.Dependencies[2], _testRemoteOrigin).Return(nil),
-		tagClient.EXPECT().PutAndReplicate(task.Tag, task.Digest).Return(nil),
+		tagClient.EXPECT().ReplicatePut(task.Tag, task.Digest, task.CreatedAt).Return(nil),
 	)
 
 	require.NoError(executor.Exec(task))
 }
 
+func TestExecutorNoopsWhenRemoteDeletedTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.new()
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+	task.Dependencies = nil
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().Has(task.Tag).Return(false, nil),
+		tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil),
+		tagClient.EXPECT().ReplicatePut(
+			task.Tag, task.Digest, task.CreatedAt).Return(tagclient.ErrTagDeleted),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorDropsPolicyViolations(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.new()
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+	task.Dependencies = nil
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().Has(task.Tag).Return(false, nil),
+		tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil),
+		tagClient.EXPECT().ReplicatePut(task.Tag, task.Digest, task.CreatedAt).Return(
+			&tagpolicy.Violation{Reason: tagpolicy.ReasonImmutable, Tag: task.Tag}),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorTombstone(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.new()
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+	tombstone := NewTombstoneTask(task.Tag, task.Digest, task.Destination, time.Now())
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().ReplicateDelete(
+			tombstone.Tag, tombstone.Digest, tombstone.DeletedAt).Return(nil),
+	)
+
+	require.NoError(executor.Exec(tombstone))
+}
+
 func TestExecutorNoopsWhenTagAlreadyReplicated(t *testing.T) {
 	require := require.New(t)
 
@@ -52,6 +52,16 @@ func (rs Remotes) Valid(tag, addr string) bool {
 	return false
 }
 
+// Has returns true if addr is configured for any namespace.
+func (rs Remotes) Has(addr string) bool {
+	for _, r := range rs {
+		if r.addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
 // RemotesConfig defines remote replication configuration which specifies which
 // namespaces should be replicated to certain build-indexes.
 //
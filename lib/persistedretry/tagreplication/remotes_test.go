@@ -68,3 +68,15 @@ func TestRemotesValid(t *testing.T) {
 			"Tag: %s, Addr: %s", test.tag, test.addr)
 	}
 }
+
+func TestRemotesHas(t *testing.T) {
+	require := require.New(t)
+
+	remotes, err := RemotesConfig{
+		"a": []string{"foo/.*"},
+	}.Build()
+	require.NoError(err)
+
+	require.True(remotes.Has("a"))
+	require.False(remotes.Has("b"))
+}
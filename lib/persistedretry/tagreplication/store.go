@@ -117,31 +117,40 @@ func (s *Store) Find(query interface{}) ([]persistedretry.Task, error) {
 }
 
 func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
+	t, ok := r.(*Task)
+	if !ok {
+		return fmt.Errorf("expected *Task, got %T", r)
+	}
+	insert := "INSERT"
+	if t.Tombstone() {
+		// Tombstones supersede any pending replication of the same tag.
+		insert = "INSERT OR REPLACE"
+	}
 	query := fmt.Sprintf(`
-		INSERT INTO replicate_tag_task (
+		%s INTO replicate_tag_task (
 			tag,
 			digest,
 			dependencies,
 			destination,
+			created_at,
 			last_attempt,
 			failures,
 			delay,
+			deleted_at,
 			status
 		) VALUES (
 			:tag,
 			:digest,
 			:dependencies,
 			:destination,
+			:created_at,
 			:last_attempt,
 			:failures,
 			:delay,
+			:deleted_at,
 			%q
 		)
-	`, status)
-	t, ok := r.(*Task)
-	if !ok {
-		return fmt.Errorf("expected *Task, got %T", r)
-	}
+	`, insert, status)
 	_, err := s.db.NamedExec(query, t)
 	if se, ok := err.(sqlite3.Error); ok {
 		if se.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
@@ -154,7 +163,7 @@ func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
 func (s *Store) selectStatus(status string) ([]persistedretry.Task, error) {
 	var tasks []*Task
 	err := s.db.Select(&tasks, `
-		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay
+		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay, deleted_at
 		FROM replicate_tag_task
 		WHERE status=?`, status)
 	if err != nil {
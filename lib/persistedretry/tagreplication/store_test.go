@@ -73,6 +73,10 @@ func checkTask(t *testing.T, expected *Task, result persistedretry.Task) {
 	expectedCopy.LastAttempt = time.Time{}
 	resultCopy.LastAttempt = time.Time{}
 
+	require.True(t, expectedCopy.DeletedAt.Equal(resultCopy.DeletedAt))
+	expectedCopy.DeletedAt = time.Time{}
+	resultCopy.DeletedAt = time.Time{}
+
 	require.Equal(t, expectedCopy, resultCopy)
 }
 
@@ -181,6 +185,23 @@ func TestAddPendingTwiceReturnsErrTaskExists(t *testing.T) {
 	require.Equal(persistedretry.ErrTaskExists, store.AddPending(task))
 }
 
+func TestAddPendingTombstoneReplacesTask(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new()
+
+	task := TaskFixture()
+	tombstone := NewTombstoneTask(task.Tag, task.Digest, task.Destination, time.Now())
+
+	require.NoError(store.AddPending(task))
+	require.NoError(store.AddPending(tombstone))
+
+	checkPending(t, store, tombstone)
+}
+
 func TestAddFailed(t *testing.T) {
 	require := require.New(t)
 
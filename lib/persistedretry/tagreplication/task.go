@@ -21,7 +21,8 @@ import (
 )
 
 // Task contains information to replicate a tag and its dependencies to a
-// remote destination.
+// remote destination. Tombstone tasks instead replicate the deletion of a tag,
+// so that the deletion wins over replications of the tag arriving late.
 type Task struct {
 	Tag          string          `db:"tag"`
 	Digest       core.Digest     `db:"digest"`
@@ -31,6 +32,10 @@ type Task struct {
 	LastAttempt  time.Time       `db:"last_attempt"`
 	Failures     int             `db:"failures"`
 	Delay        time.Duration   `db:"delay"`
+
+	// DeletedAt is set on tombstone tasks to when the tag was deleted, in
+	// which case Digest is the digest the tag pointed to.
+	DeletedAt time.Time `db:"deleted_at"`
 }
 
 // NewTask creates a new Task.
@@ -51,7 +56,33 @@ func NewTask(
 	}
 }
 
+// NewTombstoneTask creates a new Task which replicates the deletion of tag,
+// which pointed to d, at deletedAt.
+func NewTombstoneTask(
+	tag string,
+	d core.Digest,
+	destination string,
+	deletedAt time.Time) *Task {
+
+	return &Task{
+		Tag:          tag,
+		Digest:       d,
+		Dependencies: core.DigestList{},
+		Destination:  destination,
+		CreatedAt:    time.Now(),
+		DeletedAt:    deletedAt,
+	}
+}
+
+// Tombstone returns whether t replicates the deletion of a tag.
+func (t *Task) Tombstone() bool {
+	return !t.DeletedAt.IsZero()
+}
+
 func (t *Task) String() string {
+	if t.Tombstone() {
+		return fmt.Sprintf("tagreplication.Task(tag=%s, dest=%s, tombstone)", t.Tag, t.Destination)
+	}
 	return fmt.Sprintf("tagreplication.Task(tag=%s, dest=%s)", t.Tag, t.Destination)
 }
 
@@ -29,6 +29,7 @@ import (
 
 // FileStore defines store operations required for write-back.
 type FileStore interface {
+	GetCacheFileMetadata(name string, md metadata.Metadata) error
 	DeleteCacheFileMetadata(name string, md metadata.Metadata) error
 	GetCacheFileReader(name string) (store.FileReader, error)
 }
@@ -107,6 +108,16 @@ func (e *Executor) upload(t *Task) error {
 	}
 	defer closers.Close(f)
 
+	// Files are persisted until they are written back. Files whose persist
+	// metadata was removed no longer need it, e.g. deleted tags.
+	if err := e.fs.GetCacheFileMetadata(t.Name, &metadata.Persist{}); err != nil {
+		if os.IsNotExist(err) {
+			log.With("name", t.Name).Info("Dropping writeback of file which is no longer persisted")
+			return nil
+		}
+		return fmt.Errorf("get persist metadata: %s", err)
+	}
+
 	if err := client.Upload(t.Namespace, t.Name, f); err != nil {
 		return fmt.Errorf("upload: %s", err)
 	}
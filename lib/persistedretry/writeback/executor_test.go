@@ -140,6 +140,26 @@ func TestExecNoopWhenFileMissing(t *testing.T) {
 	require.NoError(executor.Exec(task))
 }
 
+func TestExecNoopWhenFileNotPersisted(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	require.NoError(mocks.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	task := NewTask(core.TagFixture(), blob.Digest.Hex(), 0)
+
+	client := mocks.client(task.Namespace)
+	client.EXPECT().Stat(task.Namespace, blob.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+
+	executor := mocks.new()
+
+	require.NoError(executor.Exec(task))
+}
+
 func TestExecNoopWhenNamespaceNotFound(t *testing.T) {
 	require := require.New(t)
 
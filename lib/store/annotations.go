@@ -0,0 +1,98 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+// AnnotatedFile is a cache file with annotations.
+type AnnotatedFile struct {
+	Name        string
+	Annotations map[string]string
+}
+
+// AnnotateCacheFile merges values into the annotations of the cache file of
+// name, removing annotations whose value is empty, and returns the resulting
+// annotations. Returns an error wrapping metadata.ErrInvalidAnnotations if
+// values exceed annotation limits, or os.ErrNotExist if the file is not in the
+// cache.
+func (s *CAStore) AnnotateCacheFile(name string, values map[string]string) (map[string]string, error) {
+	s.annotationsMu.Lock()
+	defer s.annotationsMu.Unlock()
+
+	// Metadata lookups do not distinguish missing files from missing
+	// metadata.
+	if _, err := s.cacheStore.GetCacheFileStat(name); err != nil {
+		return nil, err
+	}
+	a := new(metadata.Annotations)
+	if err := s.cacheStore.GetCacheFileMetadata(name, a); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("get annotations: %s", err)
+	}
+	if err := a.Update(values); err != nil {
+		return nil, err
+	}
+	if len(a.Values) == 0 {
+		if err := s.cacheStore.DeleteCacheFileMetadata(name, a); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("delete annotations: %s", err)
+		}
+		return a.Values, nil
+	}
+	if _, err := s.cacheStore.SetCacheFileMetadata(name, a); err != nil {
+		return nil, fmt.Errorf("set annotations: %s", err)
+	}
+	return a.Values, nil
+}
+
+// GetCacheFileAnnotations returns the annotations of the cache file of name,
+// which are empty if the file was never annotated. Returns os.ErrNotExist if
+// the file is not in the cache.
+func (s *CAStore) GetCacheFileAnnotations(name string) (map[string]string, error) {
+	if _, err := s.cacheStore.GetCacheFileStat(name); err != nil {
+		return nil, err
+	}
+	a := metadata.NewAnnotations(nil)
+	if err := s.cacheStore.GetCacheFileMetadata(name, a); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("get annotations: %s", err)
+	}
+	return a.Values, nil
+}
+
+// FindAnnotatedCacheFiles returns the cache files annotated with key, sorted by
+// name. If value is not empty, only files whose annotation of key equals value
+// are returned.
+func (s *CAStore) FindAnnotatedCacheFiles(key, value string) ([]AnnotatedFile, error) {
+	var found []AnnotatedFile
+	if err := s.cacheStore.WalkCacheFiles(func(name string, info os.FileInfo) error {
+		var a metadata.Annotations
+		if err := s.cacheStore.GetCacheFileMetadata(name, &a); err != nil {
+			return nil
+		}
+		v, ok := a.Values[key]
+		if !ok || (value != "" && v != value) {
+			return nil
+		}
+		found = append(found, AnnotatedFile{Name: name, Annotations: a.Values})
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("walk cache files: %s", err)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found, nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+func TestAnnotateCacheFile(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+	require.NoError(s.CreateCacheFile(name, bytes.NewReader(blob.Content)))
+
+	values, err := s.GetCacheFileAnnotations(name)
+	require.NoError(err)
+	require.Empty(values)
+
+	values, err = s.AnnotateCacheFile(name, map[string]string{"build_id": "1", "source": "a"})
+	require.NoError(err)
+	require.Equal(map[string]string{"build_id": "1", "source": "a"}, values)
+
+	values, err = s.AnnotateCacheFile(name, map[string]string{"build_id": "2", "source": ""})
+	require.NoError(err)
+	require.Equal(map[string]string{"build_id": "2"}, values)
+
+	values, err = s.GetCacheFileAnnotations(name)
+	require.NoError(err)
+	require.Equal(map[string]string{"build_id": "2"}, values)
+
+	_, err = s.AnnotateCacheFile(name, map[string]string{"bad key": "1"})
+	require.ErrorIs(err, metadata.ErrInvalidAnnotations)
+}
+
+func TestAnnotateCacheFileNotFound(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	name := core.DigestFixture().Hex()
+	_, err = s.AnnotateCacheFile(name, map[string]string{"a": "1"})
+	require.True(os.IsNotExist(err))
+	_, err = s.GetCacheFileAnnotations(name)
+	require.True(os.IsNotExist(err))
+}
+
+func TestFindAnnotatedCacheFiles(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	blobs := []*core.BlobFixture{core.NewBlobFixture(), core.NewBlobFixture(), core.NewBlobFixture()}
+	for _, blob := range blobs {
+		require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+	_, err = s.AnnotateCacheFile(blobs[0].Digest.Hex(), map[string]string{"build_id": "1"})
+	require.NoError(err)
+	_, err = s.AnnotateCacheFile(blobs[1].Digest.Hex(), map[string]string{"build_id": "2"})
+	require.NoError(err)
+
+	files, err := s.FindAnnotatedCacheFiles("build_id", "2")
+	require.NoError(err)
+	require.Equal([]AnnotatedFile{{
+		Name:        blobs[1].Digest.Hex(),
+		Annotations: map[string]string{"build_id": "2"},
+	}}, files)
+
+	files, err = s.FindAnnotatedCacheFiles("build_id", "")
+	require.NoError(err)
+	require.Len(files, 2)
+}
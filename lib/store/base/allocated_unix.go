@@ -0,0 +1,34 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package base
+
+import (
+	"os"
+	"syscall"
+)
+
+// AllocatedBytes returns the number of bytes actually allocated on disk for
+// the file described by info, which is smaller than its size for sparse files.
+// Falls back to the file size if the block count is unavailable.
+func AllocatedBytes(info os.FileInfo) int64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.Size()
+	}
+	// Blocks is always counted in 512-byte units, regardless of block size.
+	return int64(st.Blocks) * 512
+}
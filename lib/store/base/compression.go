@@ -0,0 +1,179 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/closers"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// _compressionMagic prefixes the data of compressed files. It tells apart
+// compressed data from plain data left behind with stale Compressed metadata
+// by a crash, even for blobs which are zstd archives themselves.
+const _compressionMagic = "KRKNZST1"
+
+// Compression errors.
+var (
+	ErrFileCompressed         = errors.New("file is compressed")
+	ErrCompressionUnsupported = errors.New("compression of encrypted files is not supported")
+)
+
+// Compress replaces the data of the file with its zstd compressed form, and
+// records the uncompressed size in Compressed metadata. The metadata is
+// written before the data is replaced, so a crash in between leaves plain
+// data which Decompress recognizes.
+func (entry *localFileEntry) Compress() error {
+	if entry.cipher != nil {
+		return ErrCompressionUnsupported
+	}
+	if entry.hasMetadata(metadata.GetCompressedSuffix()) {
+		return nil
+	}
+	path := entry.GetPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".zst.tmp"
+	if err := compressFile(path, tmpPath, entry.durability.syncData()); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("compress: %s", err)
+	}
+	if _, err := entry.SetMetadata(metadata.NewCompressed(info.Size())); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("set compressed metadata: %s", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		entry.DeleteMetadata(metadata.NewCompressed(0))
+		return err
+	}
+	if entry.durability.syncData() {
+		return syncPath(filepath.Dir(path))
+	}
+	return nil
+}
+
+// Decompress restores the plain data of a compressed file. It is a no-op for
+// files which are not compressed.
+func (entry *localFileEntry) Decompress() error {
+	if !entry.hasMetadata(metadata.GetCompressedSuffix()) {
+		return nil
+	}
+	path := entry.GetPath()
+	tmpPath := path + ".tmp"
+	compressed, err := decompressFile(path, tmpPath, entry.durability.syncData())
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("decompress: %s", err)
+	}
+	if compressed {
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		if entry.durability.syncData() {
+			if err := syncPath(filepath.Dir(path)); err != nil {
+				return err
+			}
+		}
+	}
+	return entry.DeleteMetadata(metadata.NewCompressed(0))
+}
+
+func compressFile(sourcePath, targetPath string, sync bool) error {
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer closers.Close(src)
+
+	dst, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0775)
+	if err != nil {
+		return err
+	}
+	defer closers.Close(dst)
+
+	if _, err := io.WriteString(dst, _compressionMagic); err != nil {
+		return err
+	}
+	zw, err := zstd.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if sync {
+		return dst.Sync()
+	}
+	return nil
+}
+
+// decompressFile writes the plain data of sourcePath to targetPath. Returns
+// false without writing anything if sourcePath is not compressed.
+func decompressFile(sourcePath, targetPath string, sync bool) (bool, error) {
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return false, err
+	}
+	defer closers.Close(src)
+
+	magic := make([]byte, len(_compressionMagic))
+	if _, err := io.ReadFull(src, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	if !bytes.Equal(magic, []byte(_compressionMagic)) {
+		return false, nil
+	}
+
+	zr, err := zstd.NewReader(src)
+	if err != nil {
+		return false, err
+	}
+	defer zr.Close()
+
+	dst, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0775)
+	if err != nil {
+		return false, err
+	}
+	defer closers.Close(dst)
+
+	if _, err := io.Copy(dst, zr); err != nil {
+		return false, err
+	}
+	if sync {
+		if err := dst.Sync(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"os"
+	"sync"
+)
+
+// DiskUsageHook is called with the new byte count of a state whenever it
+// changes. It must not call back into the FileStore.
+type DiskUsageHook func(state FileState, bytes int64)
+
+// FileUsage is the number of bytes used by a file.
+type FileUsage struct {
+	Name string
+	Size int64
+}
+
+type diskUsageEntry struct {
+	state FileState
+	size  int64
+}
+
+// diskUsage maintains a running byte count per state, so usage can be queried
+// without walking the state directories.
+type diskUsage struct {
+	sync.Mutex
+
+	states  map[FileState]int64
+	entries map[string]diskUsageEntry
+	total   int64
+	hook    DiskUsageHook
+
+	// Optional callback invoked after usage is updated, without holding lock.
+	afterSet func()
+}
+
+func newDiskUsage() *diskUsage {
+	return &diskUsage{
+		states:  make(map[FileState]int64),
+		entries: make(map[string]diskUsageEntry),
+	}
+}
+
+func (u *diskUsage) setHook(hook DiskUsageHook) {
+	u.Lock()
+	defer u.Unlock()
+
+	u.hook = hook
+}
+
+func (u *diskUsage) get(state FileState) int64 {
+	u.Lock()
+	defer u.Unlock()
+
+	return u.states[state]
+}
+
+func (u *diskUsage) getTotal() int64 {
+	u.Lock()
+	defer u.Unlock()
+
+	return u.total
+}
+
+// lookup returns the size of name if it is accounted in state.
+func (u *diskUsage) lookup(name string, state FileState) (int64, bool) {
+	u.Lock()
+	defer u.Unlock()
+
+	e, ok := u.entries[name]
+	if !ok || e.state != state {
+		return 0, false
+	}
+	return e.size, true
+}
+
+// set accounts name as size bytes in state, replacing any previous record.
+func (u *diskUsage) set(name string, state FileState, size int64) {
+	u.Lock()
+	changed := make(map[FileState]int64)
+	if prev, ok := u.entries[name]; ok {
+		u.states[prev.state] -= prev.size
+		u.total -= prev.size
+		changed[prev.state] = u.states[prev.state]
+	}
+	u.states[state] += size
+	u.total += size
+	changed[state] = u.states[state]
+	u.entries[name] = diskUsageEntry{state, size}
+	hook := u.hook
+	u.Unlock()
+
+	u.notify(hook, changed)
+	if u.afterSet != nil {
+		u.afterSet()
+	}
+}
+
+// setFromDisk accounts name with the current size of the file at path. Files
+// which cannot be stat'd are dropped from accounting.
+func (u *diskUsage) setFromDisk(name string, state FileState, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		u.remove(name)
+		return
+	}
+	u.set(name, state, info.Size())
+}
+
+// refresh re-reads the size of name if it is still accounted in state.
+func (u *diskUsage) refresh(name string, state FileState, path string) {
+	u.Lock()
+	prev, ok := u.entries[name]
+	u.Unlock()
+	if !ok || prev.state != state {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	u.set(name, state, info.Size())
+}
+
+// remove drops name from accounting.
+func (u *diskUsage) remove(name string) {
+	u.Lock()
+	prev, ok := u.entries[name]
+	if !ok {
+		u.Unlock()
+		return
+	}
+	delete(u.entries, name)
+	u.states[prev.state] -= prev.size
+	u.total -= prev.size
+	changed := map[FileState]int64{prev.state: u.states[prev.state]}
+	hook := u.hook
+	u.Unlock()
+
+	u.notify(hook, changed)
+}
+
+func (u *diskUsage) notify(hook DiskUsageHook, changed map[FileState]int64) {
+	if hook == nil {
+		return
+	}
+	for state, bytes := range changed {
+		hook(state, bytes)
+	}
+}
+
+// usageTrackingReadWriter refreshes disk usage of a file once it is closed,
+// since writes may have changed its size.
+type usageTrackingReadWriter struct {
+	FileReadWriter
+
+	refresh func()
+}
+
+func (rw *usageTrackingReadWriter) Close() error {
+	defer rw.refresh()
+	return rw.FileReadWriter.Close()
+}
+
+func (rw *usageTrackingReadWriter) Cancel() error {
+	defer rw.refresh()
+	return rw.FileReadWriter.Cancel()
+}
+
+func (rw *usageTrackingReadWriter) Commit() error {
+	defer rw.refresh()
+	return rw.FileReadWriter.Commit()
+}
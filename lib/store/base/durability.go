@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"fmt"
+	"os"
+)
+
+// Durability decides which writes are fsync'ed to disk before they are
+// considered done, trading write latency for crash consistency.
+type Durability string
+
+const (
+	// DurabilityNone leaves flushing to the OS. Default.
+	DurabilityNone Durability = "none"
+
+	// DurabilityMetadata fsyncs metadata files and their parent directories.
+	DurabilityMetadata Durability = "metadata"
+
+	// DurabilityAlways additionally fsyncs data files and their parent
+	// directories whenever they are committed, created or moved, so a file
+	// that survives power loss is never truncated.
+	DurabilityAlways Durability = "always"
+)
+
+// Validate returns an error if d is not a known durability. Empty means
+// DurabilityNone.
+func (d Durability) Validate() error {
+	switch d {
+	case "", DurabilityNone, DurabilityMetadata, DurabilityAlways:
+		return nil
+	}
+	return fmt.Errorf("unknown durability %q", string(d))
+}
+
+// UnmarshalYAML rejects unknown durabilities when configs are loaded.
+func (d *Durability) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if err := Durability(s).Validate(); err != nil {
+		return err
+	}
+	*d = Durability(s)
+	return nil
+}
+
+func (d Durability) syncMetadata() bool {
+	return d == DurabilityMetadata || d == DurabilityAlways
+}
+
+func (d Durability) syncData() bool {
+	return d == DurabilityAlways
+}
+
+// syncPath fsyncs the file or directory at path. Directories are skipped on
+// platforms which cannot sync them.
+func syncPath(path string) error {
+	if !_canSyncDir {
+		if info, err := os.Stat(path); err != nil {
+			return err
+		} else if info.IsDir() {
+			return nil
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeFile writes b to filePath, like os.WriteFile. If sync is set, the file
+// is fsync'ed before it is closed.
+func writeFile(filePath string, b []byte, sync bool) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0775)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
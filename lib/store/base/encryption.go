@@ -0,0 +1,323 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+)
+
+// _encryptionMagic prefixes the header of encrypted files, followed by a
+// random file id.
+const _encryptionMagic = "KRKNENC2"
+
+const _encryptionFileIDSize = 16
+
+const _encryptionHeaderSize = int64(len(_encryptionMagic) + _encryptionFileIDSize)
+
+// _encryptionChunkSize is the size of plaintext sealed under one nonce.
+const _encryptionChunkSize = 64 * 1024
+
+// _encryptionNonceSize and _encryptionTagSize are the sizes of the AES-GCM
+// nonce and tag stored in front of and behind each chunk.
+const (
+	_encryptionNonceSize = 12
+	_encryptionTagSize   = 16
+	_encryptionOverhead  = _encryptionNonceSize + _encryptionTagSize
+)
+
+// _encryptionLockStripes is the number of locks serializing access to chunks.
+const _encryptionLockStripes = 64
+
+// Cipher encrypts file contents at rest with AES-GCM. Files are split into
+// fixed-size chunks, each sealed under a fresh random nonce which is stored
+// with its tag in front of the chunk, so pieces can be read and written at
+// arbitrary offsets without rewriting the whole file. The random file id from
+// the header and the chunk index are authenticated with every chunk, so
+// chunks cannot be swapped within or between files.
+//
+// Chunks which were never written, e.g. of sparse files created with a fixed
+// size, consist of zeros on disk and read as zeros.
+type Cipher struct {
+	aead  cipher.AEAD
+	locks [_encryptionLockStripes]sync.RWMutex
+}
+
+// NewCipher creates a Cipher from a 16, 24 or 32 byte AES key.
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes: %s", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("gcm: %s", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// writeHeader writes a new encryption header to the front of f.
+func (c *Cipher) writeHeader(f *os.File) error {
+	header := make([]byte, _encryptionHeaderSize)
+	copy(header, _encryptionMagic)
+	if _, err := io.ReadFull(rand.Reader, header[len(_encryptionMagic):]); err != nil {
+		return fmt.Errorf("generate file id: %s", err)
+	}
+	_, err := f.WriteAt(header, 0)
+	return err
+}
+
+// readHeader returns the file id of f. Returns ok=false if f is not
+// encrypted, which is the case for files written before encryption was
+// enabled.
+func readHeader(f *os.File) (id []byte, ok bool, err error) {
+	header := make([]byte, _encryptionHeaderSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if !bytes.Equal(header[:len(_encryptionMagic)], []byte(_encryptionMagic)) {
+		return nil, false, nil
+	}
+	return header[len(_encryptionMagic):], true, nil
+}
+
+// encryptedSize returns the size on disk of an encrypted file holding size
+// bytes of plaintext.
+func encryptedSize(size int64) int64 {
+	chunks := (size + _encryptionChunkSize - 1) / _encryptionChunkSize
+	return _encryptionHeaderSize + size + chunks*_encryptionOverhead
+}
+
+// plaintextSize is the inverse of encryptedSize.
+func plaintextSize(size int64) int64 {
+	size -= _encryptionHeaderSize
+	if size <= 0 {
+		return 0
+	}
+	n := size / (_encryptionChunkSize + _encryptionOverhead)
+	rem := size % (_encryptionChunkSize + _encryptionOverhead)
+	if rem > _encryptionOverhead {
+		rem -= _encryptionOverhead
+	} else {
+		rem = 0
+	}
+	return n*_encryptionChunkSize + rem
+}
+
+// lock returns the lock guarding chunk i of the file at path.
+func (c *Cipher) lock(path string, i int64) *sync.RWMutex {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	binary.Write(h, binary.BigEndian, i)
+	return &c.locks[h.Sum32()%_encryptionLockStripes]
+}
+
+// encryptedReadWriter transparently decrypts reads and encrypts writes of
+// a file with an encryption header. Offsets are relative to the plaintext.
+type encryptedReadWriter struct {
+	*localFileReadWriter
+
+	cipher *Cipher
+	id     []byte
+	offset int64
+}
+
+// file overrides localFileReadWriter.file, since the file holds ciphertext.
+func (rw *encryptedReadWriter) file() (*os.File, bool) {
+	return nil, false
+}
+
+// additionalData authenticates the file id and position of chunk i.
+func (rw *encryptedReadWriter) additionalData(i int64) []byte {
+	ad := make([]byte, len(rw.id)+8)
+	copy(ad, rw.id)
+	binary.BigEndian.PutUint64(ad[len(rw.id):], uint64(i))
+	return ad
+}
+
+// readChunk decrypts chunk i, which holds n bytes of plaintext, into dst.
+// Must be called with the lock of the chunk held.
+func (rw *encryptedReadWriter) readChunk(i int64, n int, dst []byte) error {
+	b := make([]byte, _encryptionOverhead+n)
+	off := _encryptionHeaderSize + i*(_encryptionChunkSize+_encryptionOverhead)
+	if _, err := rw.localFileReadWriter.ReadAt(b, off); err != nil {
+		return fmt.Errorf("read chunk %d: %s", i, err)
+	}
+	if isZero(b) {
+		// Never written.
+		clear(dst[:n])
+		return nil
+	}
+	nonce := b[:_encryptionNonceSize]
+	if _, err := rw.cipher.aead.Open(
+		dst[:0], nonce, b[_encryptionNonceSize:], rw.additionalData(i)); err != nil {
+		return fmt.Errorf("decrypt chunk %d: %s", i, err)
+	}
+	return nil
+}
+
+// writeChunk seals plaintext as chunk i under a new nonce. Must be called
+// with the lock of the chunk held.
+func (rw *encryptedReadWriter) writeChunk(i int64, plaintext []byte) error {
+	b := make([]byte, _encryptionNonceSize, _encryptionOverhead+len(plaintext))
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return fmt.Errorf("generate nonce: %s", err)
+	}
+	b = rw.cipher.aead.Seal(b, b, plaintext, rw.additionalData(i))
+	off := _encryptionHeaderSize + i*(_encryptionChunkSize+_encryptionOverhead)
+	if _, err := rw.localFileReadWriter.WriteAt(b, off); err != nil {
+		return fmt.Errorf("write chunk %d: %s", i, err)
+	}
+	return nil
+}
+
+// updateChunk replaces bytes of chunk i starting at offset with p, and
+// reseals the chunk with its plaintext extended to size bytes of the file.
+// The file previously held oldSize bytes of plaintext.
+func (rw *encryptedReadWriter) updateChunk(i int64, p []byte, offset, oldSize, size int64) error {
+	start := i * _encryptionChunkSize
+	end := min(start+_encryptionChunkSize, size)
+	plaintext := make([]byte, end-start)
+
+	l := rw.cipher.lock(rw.descriptor.Name(), i)
+	l.Lock()
+	defer l.Unlock()
+
+	// Keep existing content unless it is overwritten completely.
+	if start < oldSize && (offset > start || offset+int64(len(p)) < end) {
+		n := int(min(end, oldSize) - start)
+		if err := rw.readChunk(i, n, plaintext); err != nil {
+			return err
+		}
+	}
+	copy(plaintext[offset-start:], p)
+	return rw.writeChunk(i, plaintext)
+}
+
+func (rw *encryptedReadWriter) Read(p []byte) (int, error) {
+	n, err := rw.ReadAt(p, rw.offset)
+	rw.offset += int64(n)
+	return n, err
+}
+
+func (rw *encryptedReadWriter) ReadAt(p []byte, offset int64) (int, error) {
+	size := rw.Size()
+	if offset >= size {
+		return 0, io.EOF
+	}
+	end := min(offset+int64(len(p)), size)
+	buf := make([]byte, _encryptionChunkSize)
+	for pos := offset; pos < end; {
+		i := pos / _encryptionChunkSize
+		start := i * _encryptionChunkSize
+		n := int(min(start+_encryptionChunkSize, size) - start)
+
+		l := rw.cipher.lock(rw.descriptor.Name(), i)
+		l.RLock()
+		err := rw.readChunk(i, n, buf)
+		l.RUnlock()
+		if err != nil {
+			return int(pos - offset), err
+		}
+		pos += int64(copy(p[pos-offset:end-offset], buf[pos-start:n]))
+	}
+	if n := int(end - offset); n < len(p) {
+		return n, io.EOF
+	}
+	return len(p), nil
+}
+
+func (rw *encryptedReadWriter) Write(p []byte) (int, error) {
+	n, err := rw.WriteAt(p, rw.offset)
+	rw.offset += int64(n)
+	return n, err
+}
+
+func (rw *encryptedReadWriter) WriteAt(p []byte, offset int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	oldSize := rw.Size()
+	end := offset + int64(len(p))
+	size := max(oldSize, end)
+
+	// If the file grows, its last chunk was sealed with fewer bytes than it
+	// holds now. Chunks in between which are not written read as zeros.
+	if last := oldSize / _encryptionChunkSize; size > oldSize &&
+		oldSize%_encryptionChunkSize != 0 && last < offset/_encryptionChunkSize {
+		if err := rw.updateChunk(last, nil, oldSize, oldSize, size); err != nil {
+			return 0, err
+		}
+	}
+
+	for pos := offset; pos < end; {
+		i := pos / _encryptionChunkSize
+		next := min((i+1)*_encryptionChunkSize, end)
+		if err := rw.updateChunk(i, p[pos-offset:next-offset], pos, oldSize, size); err != nil {
+			return int(pos - offset), err
+		}
+		pos = next
+	}
+	return len(p), nil
+}
+
+func (rw *encryptedReadWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rw.offset
+	case io.SeekEnd:
+		offset += rw.Size()
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	rw.offset = offset
+	return offset, nil
+}
+
+// sizedFileInfo overrides the size of a FileInfo, for files whose content
+// size differs from their size on disk.
+type sizedFileInfo struct {
+	os.FileInfo
+
+	size int64
+}
+
+func (info sizedFileInfo) Size() int64 {
+	return info.size
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptedStoreFixture(t *testing.T) FileStore {
+	c, err := NewCipher(randutil.Blob(32))
+	require.NoError(t, err)
+	return NewCASFileStoreWithLRUConfig(LRUConfig{Cipher: c}, clock.NewMock())
+}
+
+func TestEncryptedFileStoreRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	store := encryptedStoreFixture(t)
+	name := core.DigestFixture().Hex()
+	content := randutil.Blob(1000)
+
+	require.NoError(store.NewFileOp().CreateFile(name, state, 0))
+	w, err := store.NewFileOp().AcceptState(state).GetFileReadWriter(name, 0, 0)
+	require.NoError(err)
+	_, err = w.Write(content)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	info, err := store.NewFileOp().AcceptState(state).GetFileStat(name)
+	require.NoError(err)
+	require.Equal(int64(len(content)), info.Size())
+
+	// Content on disk is encrypted.
+	path, err := store.NewFileOp().AcceptState(state).GetFilePath(name)
+	require.NoError(err)
+	raw, err := os.ReadFile(path)
+	require.NoError(err)
+	require.Len(raw, int(encryptedSize(int64(len(content)))))
+	require.NotContains(string(raw), string(content[:100]))
+
+	r, err := store.NewFileOp().AcceptState(state).GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+	result, err := io.ReadAll(r)
+	require.NoError(err)
+	require.Equal(content, result)
+
+	// Random access at offsets which are not block aligned.
+	p := make([]byte, 100)
+	_, err = r.ReadAt(p, 17)
+	require.NoError(err)
+	require.Equal(content[17:117], p)
+
+	_, err = r.Seek(333, io.SeekStart)
+	require.NoError(err)
+	_, err = io.ReadFull(r, p)
+	require.NoError(err)
+	require.Equal(content[333:433], p)
+}
+
+func TestEncryptedFileStoreWriteAt(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	store := encryptedStoreFixture(t)
+	name := core.DigestFixture().Hex()
+	content := randutil.Blob(256)
+
+	// Write out of order, as pieces are.
+	require.NoError(store.NewFileOp().CreateFile(name, state, int64(len(content))))
+	w, err := store.NewFileOp().AcceptState(state).GetFileReadWriter(name, 0, 0)
+	require.NoError(err)
+	_, err = w.WriteAt(content[100:], 100)
+	require.NoError(err)
+	_, err = w.WriteAt(content[:100], 0)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	r, err := store.NewFileOp().AcceptState(state).GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+	result, err := io.ReadAll(r)
+	require.NoError(err)
+	require.Equal(content, result)
+}
+
+func TestEncryptedFileStoreReadsUnencryptedFiles(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	name := core.DigestFixture().Hex()
+	content := randutil.Blob(64)
+
+	plain := NewCASFileStore(clock.NewMock())
+	require.NoError(plain.NewFileOp().CreateFile(name, state, 0))
+	w, err := plain.NewFileOp().AcceptState(state).GetFileReadWriter(name, 0, 0)
+	require.NoError(err)
+	_, err = w.Write(content)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	store := encryptedStoreFixture(t)
+
+	info, err := store.NewFileOp().AcceptState(state).GetFileStat(name)
+	require.NoError(err)
+	require.Equal(int64(len(content)), info.Size())
+
+	r, err := store.NewFileOp().AcceptState(state).GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+	result, err := io.ReadAll(r)
+	require.NoError(err)
+	require.Equal(content, result)
+}
+
+func TestEncryptedFileStoreAppendAcrossChunks(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	store := encryptedStoreFixture(t)
+	name := core.DigestFixture().Hex()
+	content := randutil.Blob(3*_encryptionChunkSize + 123)
+
+	// Appends which end in the middle of chunks, as uploads do.
+	require.NoError(store.NewFileOp().CreateFile(name, state, 0))
+	w, err := store.NewFileOp().AcceptState(state).GetFileReadWriter(name, 0, 0)
+	require.NoError(err)
+	for _, part := range [][]byte{content[:1000], content[1000:70000], content[70000:]} {
+		_, err = w.Write(part)
+		require.NoError(err)
+	}
+	require.NoError(w.Close())
+
+	info, err := store.NewFileOp().AcceptState(state).GetFileStat(name)
+	require.NoError(err)
+	require.Equal(int64(len(content)), info.Size())
+
+	r, err := store.NewFileOp().AcceptState(state).GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+	result, err := io.ReadAll(r)
+	require.NoError(err)
+	require.True(bytes.Equal(content, result))
+
+	// Reads spanning chunk boundaries.
+	p := make([]byte, 1000)
+	_, err = r.ReadAt(p, _encryptionChunkSize-500)
+	require.NoError(err)
+	require.Equal(content[_encryptionChunkSize-500:_encryptionChunkSize+500], p)
+}
+
+func TestEncryptedFileStoreDetectsTampering(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	store := encryptedStoreFixture(t)
+	name := core.DigestFixture().Hex()
+	content := randutil.Blob(2 * _encryptionChunkSize)
+
+	require.NoError(store.NewFileOp().CreateFile(name, state, int64(len(content))))
+	w, err := store.NewFileOp().AcceptState(state).GetFileReadWriter(name, 0, 0)
+	require.NoError(err)
+	_, err = w.Write(content)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	path, err := store.NewFileOp().AcceptState(state).GetFilePath(name)
+	require.NoError(err)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(err)
+	defer f.Close()
+
+	// Flip one bit of the second chunk.
+	b := make([]byte, 1)
+	off := encryptedSize(_encryptionChunkSize) + 100
+	_, err = f.ReadAt(b, off)
+	require.NoError(err)
+	b[0] ^= 1
+	_, err = f.WriteAt(b, off)
+	require.NoError(err)
+
+	r, err := store.NewFileOp().AcceptState(state).GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+
+	p := make([]byte, 100)
+	_, err = r.ReadAt(p, 0)
+	require.NoError(err)
+	require.Equal(content[:100], p)
+
+	_, err = r.ReadAt(p, _encryptionChunkSize)
+	require.Error(err)
+}
@@ -34,3 +34,37 @@ func IsFileStateError(err error) bool {
 	_, ok := err.(*FileStateError)
 	return ok
 }
+
+// ChecksumMismatchError occurs when the content of a file does not hash to
+// the digest encoded in its name.
+type ChecksumMismatchError struct {
+	Name     string
+	Computed string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch on %s: computed %s", e.Name, e.Computed)
+}
+
+// IsChecksumMismatchError returns true if the param is of ChecksumMismatchError type.
+func IsChecksumMismatchError(err error) bool {
+	_, ok := err.(*ChecksumMismatchError)
+	return ok
+}
+
+// FileInUseError occurs when deleting a file which still has open readers or
+// writers.
+type FileInUseError struct {
+	Name string
+	Refs int
+}
+
+func (e *FileInUseError) Error() string {
+	return fmt.Sprintf("file %s is in use by %d readers or writers", e.Name, e.Refs)
+}
+
+// IsFileInUseError returns true if the param is of FileInUseError type.
+func IsFileInUseError(err error) bool {
+	_, ok := err.(*FileInUseError)
+	return ok
+}
@@ -17,7 +17,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -32,6 +34,7 @@ import (
 // FileEntry errors.
 var (
 	ErrFilePersisted = errors.New("file is persisted")
+	ErrFilePinned    = errors.New("file is pinned")
 	ErrInvalidName   = errors.New("invalid name")
 )
 
@@ -64,6 +67,10 @@ type FileEntryFactory interface {
 
 	// ListNames lists all file entry names in state.
 	ListNames(state FileState) ([]string, error)
+
+	// WalkNames calls fn for every file entry name in state, without loading
+	// all names into memory. Stops and returns the first error from fn.
+	WalkNames(state FileState, fn func(name string) error) error
 }
 
 // FileEntry manages one file and its metadata.
@@ -77,9 +84,14 @@ type FileEntry interface {
 	Create(targetState FileState, len int64) error
 	Reload() error
 	MoveFrom(targetState FileState, sourcePath string) error
+	ReplaceFrom(sourcePath string) error
 	Move(targetState FileState) error
 	LinkTo(targetPath string) error
+	CopyTo(targetState FileState) error
+	Compress() error
+	Decompress() error
 	Delete() error
+	MoveToTrash(trash *Trash) error
 
 	GetReader(readPartSize int) (FileReader, error)
 	GetReadWriter(readPartSize, writePartSize int) (FileReadWriter, error)
@@ -91,6 +103,7 @@ type FileEntry interface {
 	SetMetadataAt(md metadata.Metadata, b []byte, offset int64) (updated bool, err error)
 	GetOrSetMetadata(md metadata.Metadata) error
 	DeleteMetadata(md metadata.Metadata) error
+	CommitMetadataTxn(txn *MetadataTxn) error
 
 	RangeMetadata(f func(md metadata.Metadata) error) error
 }
@@ -100,22 +113,29 @@ var _ FileEntryFactory = (*casFileEntryFactory)(nil)
 var _ FileEntry = (*localFileEntry)(nil)
 
 // localFileEntryFactory initializes localFileEntry obj.
-type localFileEntryFactory struct{}
+type localFileEntryFactory struct {
+	durability Durability
+	cipher     *Cipher
+}
 
 // NewLocalFileEntryFactory is the constructor for localFileEntryFactory.
 func NewLocalFileEntryFactory() FileEntryFactory {
 	return &localFileEntryFactory{}
 }
 
-// Create initializes and returns a FileEntry object.
+// Create initializes and returns a FileEntry object. Names are slash
+// separated on every platform.
 func (f *localFileEntryFactory) Create(name string, state FileState) (FileEntry, error) {
-	if name != filepath.Clean(name) {
+	if name != path.Clean(name) {
 		return nil, ErrInvalidName
 	}
 	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasPrefix(name, "../") {
 		return nil, ErrInvalidName
 	}
-	return newLocalFileEntry(state, name, f.GetRelativePath(name)), nil
+	if filepath.Separator != '/' && strings.ContainsRune(name, filepath.Separator) {
+		return nil, ErrInvalidName
+	}
+	return newLocalFileEntry(state, name, f.GetRelativePath(name), f.durability, f.cipher), nil
 }
 
 // GetRelativePath returns name because file entries are stored flat under state directory.
@@ -125,8 +145,11 @@ func (f *localFileEntryFactory) GetRelativePath(name string) string {
 
 // ListNames returns the names of all entries in state's directory.
 func (f *localFileEntryFactory) ListNames(state FileState) ([]string, error) {
-	var names []string
+	return listNames(f, state)
+}
 
+// WalkNames calls fn with the names of all entries in state's directory.
+func (f *localFileEntryFactory) WalkNames(state FileState, fn func(name string) error) error {
 	var readNames func(string) error
 	readNames = func(dir string) error {
 		infos, err := os.ReadDir(dir)
@@ -148,21 +171,24 @@ func (f *localFileEntryFactory) ListNames(state FileState) ([]string, error) {
 				if err != nil {
 					return err
 				}
-				names = append(names, name)
+				if err := fn(filepath.ToSlash(name)); err != nil {
+					return err
+				}
 			}
 		}
 		return nil
 	}
 
-	err := readNames(state.GetDirectory())
-
-	return names, err
+	return readNames(state.GetDirectory())
 }
 
 // casFileEntryFactory initializes localFileEntry obj.
 // It uses the first few bytes of file digest (which is also used as file name) as shard ID.
 // For every byte, one more level of directories will be created.
-type casFileEntryFactory struct{}
+type casFileEntryFactory struct {
+	durability Durability
+	cipher     *Cipher
+}
 
 // NewCASFileEntryFactory is the constructor for casFileEntryFactory.
 func NewCASFileEntryFactory() FileEntryFactory {
@@ -172,7 +198,7 @@ func NewCASFileEntryFactory() FileEntryFactory {
 // Create initializes and returns a FileEntry object.
 // TODO: verify name.
 func (f *casFileEntryFactory) Create(name string, state FileState) (FileEntry, error) {
-	return newLocalFileEntry(state, name, f.GetRelativePath(name)), nil
+	return newLocalFileEntry(state, name, f.GetRelativePath(name), f.durability, f.cipher), nil
 }
 
 // GetRelativePath returns content-addressable file path under state directory.
@@ -185,16 +211,19 @@ func (f *casFileEntryFactory) GetRelativePath(name string) string {
 	for i := 0; i < int(DefaultShardIDLength) && i < len(name)/2; i++ {
 		// (1 byte = 2 char of file name assumming file name is in HEX)
 		dirName := name[i*2 : i*2+2]
-		filePath = filepath.Join(filePath, dirName)
+		filePath = filepath.Join(filePath, foldCase(dirName))
 	}
 
-	return filepath.Join(filePath, name, DefaultDataFileName)
+	return filepath.Join(filePath, foldCase(name), DefaultDataFileName)
 }
 
 // ListNames returns the names of all entries within the shards of state.
 func (f *casFileEntryFactory) ListNames(state FileState) ([]string, error) {
-	var names []string
+	return listNames(f, state)
+}
 
+// WalkNames calls fn with the names of all entries within the shards of state.
+func (f *casFileEntryFactory) WalkNames(state FileState, fn func(name string) error) error {
 	var readNames func(string, int) error
 	readNames = func(dir string, depth int) error {
 		infos, err := os.ReadDir(dir)
@@ -203,7 +232,9 @@ func (f *casFileEntryFactory) ListNames(state FileState) ([]string, error) {
 		}
 		for _, info := range infos {
 			if depth == 0 {
-				names = append(names, info.Name())
+				if err := fn(info.Name()); err != nil {
+					return err
+				}
 			} else {
 				if !info.IsDir() {
 					continue
@@ -216,8 +247,16 @@ func (f *casFileEntryFactory) ListNames(state FileState) ([]string, error) {
 		return nil
 	}
 
-	err := readNames(state.GetDirectory(), DefaultShardIDLength)
+	return readNames(state.GetDirectory(), DefaultShardIDLength)
+}
 
+// listNames collects all names walked by f in state.
+func listNames(f FileEntryFactory, state FileState) ([]string, error) {
+	var names []string
+	err := f.WalkNames(state, func(name string) error {
+		names = append(names, name)
+		return nil
+	})
 	return names, err
 }
 
@@ -227,20 +266,30 @@ type localFileEntry struct {
 
 	state            FileState
 	name             string
-	relativeDataPath string        // Relative path to data file.
-	metadata         stringset.Set // Metadata is identified by suffix.
+	relativeDataPath string // Relative path to data file.
+	durability       Durability
+	cipher           *Cipher // Encrypts file content at rest if set.
+
+	// Ref counts are persisted as metadata while the entry is only read
+	// locked, so metadata is guarded separately.
+	metadataMu sync.Mutex
+	metadata   stringset.Set // Metadata is identified by suffix.
 }
 
 func newLocalFileEntry(
 	state FileState,
 	name string,
 	relativeDataPath string,
+	durability Durability,
+	cipher *Cipher,
 ) *localFileEntry {
 	return &localFileEntry{
 		state:            state,
 		name:             name,
 		relativeDataPath: relativeDataPath,
 		metadata:         make(stringset.Set),
+		durability:       durability,
+		cipher:           cipher,
 	}
 }
 
@@ -259,9 +308,35 @@ func (entry *localFileEntry) GetPath() string {
 	return filepath.Join(entry.state.GetDirectory(), entry.relativeDataPath)
 }
 
-// GetStat returns a FileInfo describing the named file.
+// GetStat returns a FileInfo describing the named file. The size of encrypted
+// files is the size of their plaintext, and compressed files report their uncompressed
+// size.
 func (entry *localFileEntry) GetStat() (os.FileInfo, error) {
-	return os.Stat(entry.GetPath())
+	info, err := os.Stat(entry.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if entry.hasMetadata(metadata.GetCompressedSuffix()) {
+		var c metadata.Compressed
+		if err := entry.GetMetadata(&c); err != nil {
+			return nil, fmt.Errorf("get compressed metadata: %s", err)
+		}
+		return sizedFileInfo{info, c.Size}, nil
+	}
+	if entry.cipher == nil {
+		return info, nil
+	}
+	f, err := os.Open(entry.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	defer closers.Close(f)
+	if _, ok, err := readHeader(f); err != nil {
+		return nil, fmt.Errorf("read encryption header: %s", err)
+	} else if ok {
+		return sizedFileInfo{info, plaintextSize(info.Size())}, nil
+	}
+	return info, nil
 }
 
 // Create creates a file on disk.
@@ -293,8 +368,15 @@ func (entry *localFileEntry) Create(targetState FileState, size int64) error {
 	}
 	defer closers.Close(f)
 
-	// Change size.
-	err = f.Truncate(size)
+	// Change size. Truncate extends the file without writing any data, so the
+	// file stays sparse and no disk space is consumed until it is written to.
+	if entry.cipher != nil {
+		err = entry.cipher.writeHeader(f)
+		size = encryptedSize(size)
+	}
+	if err == nil {
+		err = f.Truncate(size)
+	}
 	if err != nil {
 		// Try to delete file.
 		removeErr := os.RemoveAll(filepath.Dir(targetPath))
@@ -304,7 +386,13 @@ func (entry *localFileEntry) Create(targetState FileState, size int64) error {
 		return err
 	}
 
-	return f.Close()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if entry.durability.syncData() {
+		return syncPath(filepath.Dir(targetPath))
+	}
+	return nil
 }
 
 // Reload tries to reload a file that doesn't exist in memory from disk.
@@ -315,6 +403,11 @@ func (entry *localFileEntry) Reload() error {
 		return err
 	}
 
+	// Clean up metadata transaction interrupted by a crash.
+	if err := entry.recoverMetadataTxn(); err != nil {
+		return fmt.Errorf("recover metadata txn: %s", err)
+	}
+
 	// Load metadata.
 	files, err := os.ReadDir(filepath.Dir(entry.GetPath()))
 	if err != nil {
@@ -323,7 +416,7 @@ func (entry *localFileEntry) Reload() error {
 	for _, currFile := range files {
 		// Glob could return the data file itself, and directories.
 		// Verify it's actually a metadata file.
-		if currFile.Name() != DefaultDataFileName {
+		if currFile.Name() != DefaultDataFileName && !currFile.IsDir() {
 			md := metadata.CreateFromSuffix(currFile.Name())
 			if md != nil {
 				// Add metadata
@@ -365,13 +458,55 @@ func (entry *localFileEntry) MoveFrom(targetState FileState, sourcePath string)
 		return err
 	}
 
+	// Flush data before it becomes visible under its final path, otherwise a
+	// crash could leave a truncated file in place.
+	if entry.durability.syncData() {
+		if err := syncPath(sourcePath); err != nil {
+			return fmt.Errorf("sync source: %s", err)
+		}
+	}
+
 	// Move data.
-	return os.Rename(sourcePath, targetPath)
+	if err := os.Rename(sourcePath, targetPath); err != nil {
+		return err
+	}
+	if entry.durability.syncData() {
+		return syncPath(filepath.Dir(targetPath))
+	}
+	return nil
 }
 
 // Move moves file to target dir under the same name, moves all metadata that's `movable`, and
 // updates state in memory.
 // If for any reason the target path already exists, it will be overwritten.
+// ReplaceFrom atomically replaces the data of the file with an unmanaged file.
+// Metadata is kept, except Compressed since the new data is not compressed.
+func (entry *localFileEntry) ReplaceFrom(sourcePath string) error {
+	targetPath := entry.GetPath()
+
+	// Verify the source file exists.
+	if _, err := os.Stat(sourcePath); err != nil {
+		// Return os.ErrNotExist.
+		return err
+	}
+
+	if entry.durability.syncData() {
+		if err := syncPath(sourcePath); err != nil {
+			return fmt.Errorf("sync source: %s", err)
+		}
+	}
+	if err := os.Rename(sourcePath, targetPath); err != nil {
+		return err
+	}
+	if err := entry.DeleteMetadata(&metadata.Compressed{}); err != nil {
+		return fmt.Errorf("delete compressed metadata: %s", err)
+	}
+	if entry.durability.syncData() {
+		return syncPath(filepath.Dir(targetPath))
+	}
+	return nil
+}
+
 func (entry *localFileEntry) Move(targetState FileState) error {
 	sourcePath := entry.GetPath()
 	targetPath := filepath.Join(targetState.GetDirectory(), entry.relativeDataPath)
@@ -394,7 +529,7 @@ func (entry *localFileEntry) Move(targetState FileState) error {
 			if err != nil {
 				return err
 			}
-			if _, err := compareAndWriteFile(targetMetadataPath, bytes); err != nil {
+			if _, err := compareAndWriteFile(targetMetadataPath, bytes, entry.durability.syncMetadata()); err != nil {
 				return err
 			}
 		}
@@ -404,10 +539,21 @@ func (entry *localFileEntry) Move(targetState FileState) error {
 		return err
 	}
 
+	if entry.durability.syncData() {
+		if err := syncPath(sourcePath); err != nil {
+			return fmt.Errorf("sync source: %s", err)
+		}
+	}
+
 	// Move data. This could be a slow operation if source and target are not on the same FS.
 	if err := os.Rename(sourcePath, targetPath); err != nil {
 		return err
 	}
+	if entry.durability.syncData() {
+		if err := syncPath(filepath.Dir(targetPath)); err != nil {
+			return fmt.Errorf("sync target dir: %s", err)
+		}
+	}
 
 	// Update parent dir in memory.
 	entry.state = targetState
@@ -424,11 +570,87 @@ func (entry *localFileEntry) LinkTo(targetPath string) error {
 	}
 
 	// Move data.
-	return os.Link(entry.GetPath(), targetPath)
+	return linkFile(entry.GetPath(), targetPath)
+}
+
+// CopyTo creates an independent copy of the file and its movable metadata
+// under targetState, without changing the state of entry. Data is cloned if
+// the filesystem supports it, and copied otherwise.
+func (entry *localFileEntry) CopyTo(targetState FileState) error {
+	targetPath := filepath.Join(targetState.GetDirectory(), entry.relativeDataPath)
+	if _, err := os.Stat(targetPath); err == nil {
+		return os.ErrExist
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), DefaultDirPermission); err != nil {
+		return err
+	}
+
+	// Copy metadata first, so the data file never shows up without it.
+	performCopy := func(md metadata.Metadata) error {
+		if md.Movable() {
+			b, err := os.ReadFile(entry.getMetadataPath(md))
+			if err != nil {
+				return err
+			}
+			targetMetadataPath := filepath.Join(filepath.Dir(targetPath), md.GetSuffix())
+			if _, err := compareAndWriteFile(targetMetadataPath, b, entry.durability.syncMetadata()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := entry.RangeMetadata(performCopy); err != nil {
+		return err
+	}
+
+	// Copy data into a temp file, which is renamed in place once complete.
+	tmpPath := targetPath + ".tmp"
+	if err := copyFile(entry.GetPath(), tmpPath, entry.durability.syncData()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, targetPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if entry.durability.syncData() {
+		return syncPath(filepath.Dir(targetPath))
+	}
+	return nil
+}
+
+// copyFile copies sourcePath to targetPath, cloning data blocks if possible.
+func copyFile(sourcePath, targetPath string, sync bool) error {
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer closers.Close(src)
+
+	dst, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0775)
+	if err != nil {
+		return err
+	}
+	if err := cloneFile(dst, src); err != nil {
+		// Not supported by the filesystem, or across mounts. Fall back to a
+		// full copy.
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+	}
+	if sync {
+		if err := dst.Sync(); err != nil {
+			dst.Close()
+			return err
+		}
+	}
+	return dst.Close()
 }
 
 // Delete removes file and all of its metedata files from disk. If persist
-// metadata is present and true, delete returns ErrFilePersisted.
+// metadata is present and true, delete returns ErrFilePersisted. If the file
+// is pinned, delete returns ErrFilePinned.
 func (entry *localFileEntry) Delete() error {
 	var persist metadata.Persist
 	if err := entry.GetMetadata(&persist); err != nil {
@@ -440,13 +662,51 @@ func (entry *localFileEntry) Delete() error {
 			return ErrFilePersisted
 		}
 	}
+	if err := entry.checkPinned(); err != nil {
+		return err
+	}
 
 	// Remove files.
 	return os.RemoveAll(filepath.Dir(entry.GetPath()))
 }
 
-// GetReader returns a FileReader object for read operations.
+// MoveToTrash moves file and all of its metadata files into trash. If persist
+// metadata is present and true, returns ErrFilePersisted. If the file is
+// pinned, returns ErrFilePinned.
+func (entry *localFileEntry) MoveToTrash(trash *Trash) error {
+	var persist metadata.Persist
+	if err := entry.GetMetadata(&persist); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("get persist metadata: %s", err)
+		}
+	} else if persist.Value {
+		return ErrFilePersisted
+	}
+	if err := entry.checkPinned(); err != nil {
+		return err
+	}
+	return trash.put(entry.name, filepath.Dir(entry.GetPath()))
+}
+
+// checkPinned returns ErrFilePinned if any namespace pinned the file.
+func (entry *localFileEntry) checkPinned() error {
+	var pin metadata.Pin
+	if err := entry.GetMetadata(&pin); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("get pin metadata: %s", err)
+		}
+	} else if pin.Pinned() {
+		return ErrFilePinned
+	}
+	return nil
+}
+
+// GetReader returns a FileReader object for read operations. Returns
+// ErrFileCompressed if the file must be decompressed first.
 func (entry *localFileEntry) GetReader(readPartSize int) (FileReader, error) {
+	if entry.hasMetadata(metadata.GetCompressedSuffix()) {
+		return nil, ErrFileCompressed
+	}
 	f, err := os.OpenFile(entry.GetPath(), os.O_RDONLY, 0775)
 	if err != nil {
 		return nil, err
@@ -457,11 +717,15 @@ func (entry *localFileEntry) GetReader(readPartSize int) (FileReader, error) {
 		descriptor:   f,
 		readPartSize: readPartSize,
 	}
-	return reader, nil
+	return entry.maybeDecrypt(reader)
 }
 
 // GetReadWriter returns a FileReadWriter object for read/write operations.
+// Returns ErrFileCompressed if the file must be decompressed first.
 func (entry *localFileEntry) GetReadWriter(readPartSize, writePartSize int) (FileReadWriter, error) {
+	if entry.hasMetadata(metadata.GetCompressedSuffix()) {
+		return nil, ErrFileCompressed
+	}
 	f, err := os.OpenFile(entry.GetPath(), os.O_RDWR, 0775)
 	if err != nil {
 		return nil, err
@@ -473,7 +737,25 @@ func (entry *localFileEntry) GetReadWriter(readPartSize, writePartSize int) (Fil
 		readPartSize:  readPartSize,
 		writePartSize: writePartSize,
 	}
-	return readWriter, nil
+	return entry.maybeDecrypt(readWriter)
+}
+
+// maybeDecrypt wraps rw to transparently encrypt and decrypt content, if the
+// file has an encryption header. Files written before encryption was enabled
+// are returned as is.
+func (entry *localFileEntry) maybeDecrypt(rw *localFileReadWriter) (FileReadWriter, error) {
+	if entry.cipher == nil {
+		return rw, nil
+	}
+	id, ok, err := readHeader(rw.descriptor)
+	if err != nil {
+		rw.close()
+		return nil, fmt.Errorf("read encryption header: %s", err)
+	}
+	if !ok {
+		return rw, nil
+	}
+	return &encryptedReadWriter{localFileReadWriter: rw, cipher: entry.cipher, id: id}, nil
 }
 
 func (entry *localFileEntry) getMetadataPath(md metadata.Metadata) string {
@@ -488,7 +770,7 @@ func (entry *localFileEntry) AddMetadata(md metadata.Metadata) error {
 	if _, err := os.Stat(filePath); err != nil {
 		return err
 	}
-	entry.metadata.Add(md.GetSuffix())
+	entry.addMetadata(md.GetSuffix())
 	return nil
 }
 
@@ -510,9 +792,9 @@ func (entry *localFileEntry) SetMetadata(md metadata.Metadata) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("marshal metadata: %s", err)
 	}
-	updated, err := compareAndWriteFile(filePath, b)
+	updated, err := compareAndWriteFile(filePath, b, entry.durability.syncMetadata())
 	if err == nil {
-		entry.metadata.Add(md.GetSuffix())
+		entry.addMetadata(md.GetSuffix())
 	}
 	return updated, err
 }
@@ -539,13 +821,18 @@ func (entry *localFileEntry) SetMetadataAt(
 	if _, err := f.WriteAt(b, offset); err != nil {
 		return false, err
 	}
+	if entry.durability.syncMetadata() {
+		if err := f.Sync(); err != nil {
+			return false, err
+		}
+	}
 	return true, nil
 }
 
 // GetOrSetMetadata writes b under metadata md if md has not been initialized yet.
 // If the given metadata is not initialized, md is overwritten.
 func (entry *localFileEntry) GetOrSetMetadata(md metadata.Metadata) error {
-	if entry.metadata.Has(md.GetSuffix()) {
+	if entry.hasMetadata(md.GetSuffix()) {
 		return entry.GetMetadata(md)
 	}
 	b, err := md.Serialize()
@@ -553,10 +840,10 @@ func (entry *localFileEntry) GetOrSetMetadata(md metadata.Metadata) error {
 		return fmt.Errorf("marshal metadata: %s", err)
 	}
 	filePath := filepath.Join(filepath.Dir(entry.GetPath()), md.GetSuffix())
-	if _, err := compareAndWriteFile(filePath, b); err != nil {
+	if _, err := compareAndWriteFile(filePath, b, entry.durability.syncMetadata()); err != nil {
 		return err
 	}
-	entry.metadata.Add(md.GetSuffix())
+	entry.addMetadata(md.GetSuffix())
 	return nil
 }
 
@@ -565,14 +852,18 @@ func (entry *localFileEntry) DeleteMetadata(md metadata.Metadata) error {
 	filePath := entry.getMetadataPath(md)
 
 	// Remove from map no matter if the actual metadata file is removed from disk.
-	defer entry.metadata.Remove(md.GetSuffix())
+	defer entry.removeMetadata(md.GetSuffix())
 
 	return os.RemoveAll(filePath)
 }
 
 // RangeMetadata loops through all metadata and applies function f, until an error happens.
 func (entry *localFileEntry) RangeMetadata(f func(md metadata.Metadata) error) error {
-	for suffix := range entry.metadata {
+	entry.metadataMu.Lock()
+	suffixes := entry.metadata.ToSlice()
+	entry.metadataMu.Unlock()
+
+	for _, suffix := range suffixes {
 		md := metadata.CreateFromSuffix(suffix)
 		if md == nil {
 			return fmt.Errorf("cannot create metadata from suffix %s", suffix)
@@ -584,10 +875,31 @@ func (entry *localFileEntry) RangeMetadata(f func(md metadata.Metadata) error) e
 	return nil
 }
 
+func (entry *localFileEntry) hasMetadata(suffix string) bool {
+	entry.metadataMu.Lock()
+	defer entry.metadataMu.Unlock()
+
+	return entry.metadata.Has(suffix)
+}
+
+func (entry *localFileEntry) addMetadata(suffix string) {
+	entry.metadataMu.Lock()
+	defer entry.metadataMu.Unlock()
+
+	entry.metadata.Add(suffix)
+}
+
+func (entry *localFileEntry) removeMetadata(suffix string) {
+	entry.metadataMu.Lock()
+	defer entry.metadataMu.Unlock()
+
+	entry.metadata.Remove(suffix)
+}
+
 // compareAndWriteFile updates file with given bytes and returns true only if the file is updated
-// correctly.
+// correctly. If sync is set, updates are fsync'ed, including the parent dir of new files.
 // It returns false if error happened or file already contains desired content.
-func compareAndWriteFile(filePath string, b []byte) (bool, error) {
+func compareAndWriteFile(filePath string, b []byte, sync bool) (bool, error) {
 	// Check existence.
 	fs, err := os.Stat(filePath)
 	if err != nil && !os.IsNotExist(err) {
@@ -599,9 +911,14 @@ func compareAndWriteFile(filePath string, b []byte) (bool, error) {
 			return false, err
 		}
 
-		if err := os.WriteFile(filePath, b, 0775); err != nil {
+		if err := writeFile(filePath, b, sync); err != nil {
 			return false, err
 		}
+		if sync {
+			if err := syncPath(filepath.Dir(filePath)); err != nil {
+				return false, err
+			}
+		}
 		return true, nil
 	}
 
@@ -629,5 +946,10 @@ func compareAndWriteFile(filePath string, b []byte) (bool, error) {
 	if _, err := f.WriteAt(b, 0); err != nil {
 		return false, err
 	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			return false, err
+		}
+	}
 	return true, nil
 }
@@ -180,6 +180,8 @@ func TestFileEntry(t *testing.T) {
 		testSetMetadataAt,
 		testGetOrSetMetadata,
 		testDeleteMetadata,
+		testCommitMetadataTxn,
+		testReloadRecoversMetadataTxn,
 		testRangeMetadata,
 	}
 
@@ -576,6 +578,90 @@ func testDeleteMetadata(require *require.Assertions, bundle *fileEntryTestBundle
 	require.True(os.IsNotExist(err))
 }
 
+func testCommitMetadataTxn(require *require.Assertions, bundle *fileEntryTestBundle) {
+	fe := bundle.entry
+
+	m1 := getMockMetadataOne()
+	m1.content = randutil.Blob(8)
+	_, err := fe.SetMetadata(m1)
+	require.NoError(err)
+
+	m2 := getMockMetadataTwo()
+	m2.content = randutil.Blob(8)
+	m3 := getMockMetadataMovable()
+	m3.content = randutil.Blob(8)
+
+	txn := &MetadataTxn{}
+	txn.Delete(m1)
+	txn.Set(m2)
+	txn.Set(m3)
+	require.NoError(fe.CommitMetadataTxn(txn))
+
+	err = fe.GetMetadata(getMockMetadataOne())
+	require.True(os.IsNotExist(err))
+
+	result2 := getMockMetadataTwo()
+	require.NoError(fe.GetMetadata(result2))
+	require.Equal(m2.content, result2.content)
+
+	result3 := getMockMetadataMovable()
+	require.NoError(fe.GetMetadata(result3))
+	require.Equal(m3.content, result3.content)
+
+	var result []metadata.Metadata
+	require.NoError(fe.RangeMetadata(func(md metadata.Metadata) error {
+		result = append(result, md)
+		return nil
+	}))
+	require.ElementsMatch([]metadata.Metadata{getMockMetadataTwo(), getMockMetadataMovable()}, result)
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(fe.GetPath()), _metadataTxnDir))
+	require.True(os.IsNotExist(err))
+}
+
+func testReloadRecoversMetadataTxn(require *require.Assertions, bundle *fileEntryTestBundle) {
+	fe := bundle.entry
+	require.NoError(fe.Create(bundle.state1, 1))
+	dir := filepath.Dir(fe.GetPath())
+
+	m1 := getMockMetadataOne()
+	m1.content = randutil.Blob(8)
+	_, err := fe.SetMetadata(m1)
+	require.NoError(err)
+
+	// Simulate a crash after commit point.
+	txnDir := filepath.Join(dir, _metadataTxnDir)
+	require.NoError(os.MkdirAll(txnDir, DefaultDirPermission))
+	m2 := getMockMetadataTwo()
+	m2.content = randutil.Blob(8)
+	require.NoError(os.WriteFile(filepath.Join(txnDir, m2.GetSuffix()), m2.content, 0775))
+	require.NoError(os.WriteFile(
+		filepath.Join(txnDir, _metadataTxnDeletes), []byte(m1.GetSuffix()+"\n"), 0775))
+
+	// Simulate an uncommitted txn.
+	tmpDir := filepath.Join(dir, _metadataTxnTmpDir)
+	require.NoError(os.MkdirAll(tmpDir, DefaultDirPermission))
+	m3 := getMockMetadataMovable()
+	require.NoError(os.WriteFile(filepath.Join(tmpDir, m3.GetSuffix()), randutil.Blob(8), 0775))
+
+	reloaded, err := NewLocalFileEntryFactory().Create(fe.GetName(), bundle.state1)
+	require.NoError(err)
+	require.NoError(reloaded.Reload())
+
+	err = reloaded.GetMetadata(getMockMetadataOne())
+	require.True(os.IsNotExist(err))
+	result2 := getMockMetadataTwo()
+	require.NoError(reloaded.GetMetadata(result2))
+	require.Equal(m2.content, result2.content)
+	err = reloaded.GetMetadata(getMockMetadataMovable())
+	require.True(os.IsNotExist(err))
+
+	_, err = os.Stat(txnDir)
+	require.True(os.IsNotExist(err))
+	_, err = os.Stat(tmpDir)
+	require.True(os.IsNotExist(err))
+}
+
 func testRangeMetadata(require *require.Assertions, bundle *fileEntryTestBundle) {
 	fe := bundle.entry
 
@@ -0,0 +1,46 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package base
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFileEntryFactoryRejectsBackslashes(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	_, err := NewLocalFileEntryFactory().Create(`foo\bar`, state)
+	require.Equal(ErrInvalidName, err)
+}
+
+func TestCASFileEntryFactoryFoldsCase(t *testing.T) {
+	require := require.New(t)
+
+	name := core.DigestFixture().Hex()
+	factory := NewCASFileEntryFactory()
+	require.Equal(
+		factory.GetRelativePath(name),
+		factory.GetRelativePath(strings.ToUpper(name)))
+}
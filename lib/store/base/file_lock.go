@@ -0,0 +1,35 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrFileLocked is returned by TryLockFile if the file is locked by another
+// holder.
+var ErrFileLocked = errors.New("file is locked")
+
+// FileLock is an exclusive advisory lock on a file, shared with other
+// processes operating on the same directory.
+type FileLock struct {
+	f *os.File
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	// Closing the file releases the flock as well.
+	return l.f.Close()
+}
@@ -15,7 +15,9 @@ package base
 
 import (
 	"container/list"
+	"fmt"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -32,11 +34,53 @@ type FileMap interface {
 	LoadForWrite(name string, f func(string, FileEntry)) bool
 	LoadForRead(name string, f func(string, FileEntry)) bool
 	LoadForPeek(name string, f func(string, FileEntry)) bool
+	LoadForMaintenance(name string, f func(string, FileEntry)) bool
 	Delete(name string, f func(string, FileEntry) bool) bool
 }
 
 var _ FileMap = (*lruFileMap)(nil)
 
+// ReplacementPolicy decides which entry a LRU FileMap evicts first.
+type ReplacementPolicy string
+
+const (
+	// PolicyLRU evicts the least recently accessed entry.
+	PolicyLRU ReplacementPolicy = "lru"
+
+	// PolicySLRU is segmented LRU. Entries accessed again after being added
+	// are promoted to a protected segment, and entries which were never
+	// re-accessed are evicted first. This prevents one-off entries from
+	// flushing frequently used ones.
+	PolicySLRU ReplacementPolicy = "slru"
+)
+
+// Validate returns an error if p is not a known policy. An empty policy
+// selects the default.
+func (p ReplacementPolicy) Validate() error {
+	switch p {
+	case "", PolicyLRU, PolicySLRU:
+		return nil
+	}
+	return fmt.Errorf("unknown replacement policy %q", string(p))
+}
+
+// UnmarshalYAML rejects unknown policies when configs are loaded.
+func (p *ReplacementPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if err := ReplacementPolicy(s).Validate(); err != nil {
+		return err
+	}
+	*p = ReplacementPolicy(s)
+	return nil
+}
+
+// _protectedRatio is the max fraction of entries held by the protected segment
+// under PolicySLRU.
+const _protectedRatio = 0.8
+
 type fileEntryWithAccessTime struct {
 	sync.RWMutex
 
@@ -44,6 +88,9 @@ type fileEntryWithAccessTime struct {
 
 	// The last time that LoadForWrite/LoadForRead is called on the entry.
 	lastAccessTime time.Time
+
+	// Whether the entry is in the protected segment. Only used by PolicySLRU.
+	protected bool
 }
 
 // lruFileMap implements FileMap interface, with an optional max capacity, and
@@ -61,19 +108,57 @@ type lruFileMap struct {
 	timeResolution time.Duration
 	queue          *list.List
 	elements       map[string]*list.Element
+
+	// Optional callback invoked after an entry is evicted and deleted.
+	onEvict func(name string)
+
+	// Optional check for entries which must not be evicted, e.g. because they
+	// have open readers or writers. inUseLocally must not do any disk I/O,
+	// since it is called with the map locked. inUse is called with only the
+	// entry locked before eviction.
+	inUse        func(name string, fe FileEntry) bool
+	inUseLocally func(name string) bool
+
+	// Byte limit of the LRU map. Set maxBytes to 0 to disable size based
+	// eviction. usedBytes reports the current size of all entries.
+	maxBytes  int64
+	usedBytes func() int64
+
+	// Replacement policy. Under PolicySLRU, queue holds the probationary
+	// segment and protected holds the protected segment.
+	policy    ReplacementPolicy
+	protected *list.List
+
+	// If set, LAT updates are only recorded in memory and persisted in
+	// batches every flushInterval and on stop, instead of on every update.
+	flushInterval time.Duration
+	dirty         map[string]*fileEntryWithAccessTime
+	stopOnce      sync.Once
+	stopc         chan struct{}
+	wg            sync.WaitGroup
+
+	// Set when entries reloaded from disk were appended to queue out of
+	// order. queue is sorted by LAT once before the next eviction.
+	unsorted bool
 }
 
 // NewLRUFileMap creates a new LRU map given capacity.
 func NewLRUFileMap(size int, clk clock.Clock) FileMap {
-	m := &lruFileMap{
+	return newLRUFileMap(size, clk, nil)
+}
+
+func newLRUFileMap(size int, clk clock.Clock, onEvict func(name string)) *lruFileMap {
+	return &lruFileMap{
 		size:           size,
 		clk:            clk,
 		timeResolution: time.Minute * 5,
 		queue:          list.New(),
 		elements:       make(map[string]*list.Element),
+		onEvict:        onEvict,
+		policy:         PolicyLRU,
+		protected:      list.New(),
+		dirty:          make(map[string]*fileEntryWithAccessTime),
 	}
-
-	return m
 }
 
 // NewLATFileMap creates a new file map that tracks last access time, but no
@@ -85,14 +170,50 @@ func NewLATFileMap(clk clock.Clock) FileMap {
 		timeResolution: time.Minute * 5,
 		queue:          list.New(),
 		elements:       make(map[string]*list.Element),
+		policy:         PolicyLRU,
+		protected:      list.New(),
+		dirty:          make(map[string]*fileEntryWithAccessTime),
 	}
 
 	return m
 }
 
+// segment returns the list holding e.
+func (fm *lruFileMap) segment(e *fileEntryWithAccessTime) *list.List {
+	if e.protected {
+		return fm.protected
+	}
+	return fm.queue
+}
+
+// len returns the number of entries in the map.
+func (fm *lruFileMap) len() int {
+	return fm.queue.Len() + fm.protected.Len()
+}
+
+// promote moves a re-accessed entry into the protected segment under
+// PolicySLRU. If the protected segment grows too large, its least recently
+// accessed entry is demoted back to the probationary segment.
+func (fm *lruFileMap) promote(name string, e *fileEntryWithAccessTime) {
+	if fm.policy != PolicySLRU || e.protected {
+		return
+	}
+	fm.queue.Remove(fm.elements[name])
+	e.protected = true
+	fm.elements[name] = fm.protected.PushFront(e)
+
+	if float64(fm.protected.Len()) > _protectedRatio*float64(fm.len()) {
+		oldest := fm.protected.Back()
+		demoted := fm.protected.Remove(oldest).(*fileEntryWithAccessTime)
+		demoted.protected = false
+		fm.elements[demoted.fe.GetName()] = fm.queue.PushFront(demoted)
+	}
+}
+
+// get looks up name without changing its position. Only accesses recorded
+// by touch affect eviction order.
 func (fm *lruFileMap) get(name string) (*fileEntryWithAccessTime, bool) {
 	if element, ok := fm.elements[name]; ok {
-		fm.queue.MoveToFront(element)
 		entry, ok := element.Value.(*fileEntryWithAccessTime)
 		return entry, ok
 	}
@@ -114,35 +235,148 @@ func (fm *lruFileMap) syncGetAndTouch(name string) (*fileEntryWithAccessTime, bo
 	if !ok {
 		return nil, false
 	}
+	fm.touch(name, e)
+
+	return e, true
+}
+
+// touch records an access of e, moving it to the front of its segment. Must
+// be called with fm locked.
+func (fm *lruFileMap) touch(name string, e *fileEntryWithAccessTime) {
+	fm.segment(e).MoveToFront(fm.elements[name])
 
 	// Update last access time.
 	t := fm.clk.Now()
-	if t.Sub(e.lastAccessTime) >= fm.timeResolution {
+	if t.Sub(e.lastAccessTime) < fm.timeResolution {
 		// Only update if new timestamp is <timeResolution> newer than previous
-		// value.
-		e.lastAccessTime = t
+		// value. Accesses within timeResolution of each other, e.g. those
+		// which happen while an entry is being created, are not considered
+		// repeated use for promotion either.
+		return
+	}
+	fm.promote(name, e)
+	e.lastAccessTime = t
+	if fm.flushInterval > 0 {
+		fm.dirty[name] = e
+	} else {
 		_, err := e.fe.SetMetadata(metadata.NewLastAccessTime(t))
 		if err != nil {
 			log.Desugar().Error("Error setting metadata", zap.String("name", e.fe.GetName()), zap.Error(err))
 		}
 	}
+}
 
-	return e, true
+// start persists batched LAT updates every flushInterval in the background.
+// No-op if flushInterval is not set.
+func (fm *lruFileMap) start() {
+	if fm.flushInterval <= 0 {
+		return
+	}
+	fm.stopc = make(chan struct{})
+	ticker := fm.clk.Ticker(fm.flushInterval)
+	fm.wg.Add(1)
+	go func() {
+		defer fm.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fm.flush()
+			case <-fm.stopc:
+				return
+			}
+		}
+	}()
+}
+
+// stop terminates the background flush and persists any pending LAT updates.
+func (fm *lruFileMap) stop() {
+	fm.stopOnce.Do(func() {
+		if fm.stopc != nil {
+			close(fm.stopc)
+			fm.wg.Wait()
+		}
+		fm.flush()
+	})
+}
+
+// flush persists all batched LAT updates.
+func (fm *lruFileMap) flush() {
+	fm.Lock()
+	dirty := fm.dirty
+	fm.dirty = make(map[string]*fileEntryWithAccessTime)
+	fm.Unlock()
+
+	for name, e := range dirty {
+		e.Lock()
+		// Make sure the entry was not deleted or overwritten in the meantime.
+		fm.Lock()
+		ne, ok := fm.elements[name]
+		lat := e.lastAccessTime
+		fm.Unlock()
+		if ok && ne.Value.(*fileEntryWithAccessTime) == e {
+			if _, err := e.fe.SetMetadata(metadata.NewLastAccessTime(lat)); err != nil {
+				log.Desugar().Error("Error setting metadata", zap.String("name", name), zap.Error(err))
+			}
+		}
+		e.Unlock()
+	}
 }
 
+// add inserts e into the probationary segment. New entries are most recently
+// accessed and go to the front. Entries reloaded from disk with an older
+// access time are appended in constant time, and the segment is sorted once
+// before the next eviction instead of on every reload.
 func (fm *lruFileMap) add(name string, e *fileEntryWithAccessTime) bool {
-	if _, ok := fm.elements[name]; !ok {
-		element := fm.queue.PushFront(e)
-		fm.elements[name] = element
+	if _, ok := fm.elements[name]; ok {
+		return false
+	}
+	front := fm.queue.Front()
+	if front == nil || !e.lastAccessTime.Before(front.Value.(*fileEntryWithAccessTime).lastAccessTime) {
+		fm.elements[name] = fm.queue.PushFront(e)
 		return true
 	}
-	return false
+	fm.elements[name] = fm.queue.PushBack(e)
+	fm.unsorted = true
+	return true
 }
 
+// sortQueue orders the probationary segment by descending last access time if
+// entries were appended out of order.
+func (fm *lruFileMap) sortQueue() {
+	if !fm.unsorted {
+		return
+	}
+	fm.unsorted = false
+	elements := make([]*list.Element, 0, fm.queue.Len())
+	for e := fm.queue.Front(); e != nil; e = e.Next() {
+		elements = append(elements, e)
+	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		return elements[i].Value.(*fileEntryWithAccessTime).lastAccessTime.After(
+			elements[j].Value.(*fileEntryWithAccessTime).lastAccessTime)
+	})
+	for _, e := range elements {
+		fm.queue.MoveToBack(e)
+	}
+}
+
+// getOldest returns the next entry to evict, skipping entries in use. Under
+// PolicySLRU, entries in the probationary segment are evicted before protected
+// ones.
 func (fm *lruFileMap) getOldest() (*fileEntryWithAccessTime, bool) {
-	if e := fm.queue.Back(); e != nil {
-		entry, ok := e.Value.(*fileEntryWithAccessTime)
-		return entry, ok
+	fm.sortQueue()
+	for _, l := range []*list.List{fm.queue, fm.protected} {
+		for e := l.Back(); e != nil; e = e.Prev() {
+			entry, ok := e.Value.(*fileEntryWithAccessTime)
+			if !ok {
+				continue
+			}
+			if fm.inUseLocally != nil && fm.inUseLocally(entry.fe.GetName()) {
+				continue
+			}
+			return entry, true
+		}
 	}
 	return nil, false
 }
@@ -150,8 +384,11 @@ func (fm *lruFileMap) getOldest() (*fileEntryWithAccessTime, bool) {
 func (fm *lruFileMap) remove(name string) (*fileEntryWithAccessTime, bool) {
 	if e, ok := fm.elements[name]; ok {
 		delete(fm.elements, name)
-		fm.queue.Remove(e)
+		delete(fm.dirty, name)
 		entry, ok := e.Value.(*fileEntryWithAccessTime)
+		if ok {
+			fm.segment(entry).Remove(e)
+		}
 		return entry, ok
 	}
 	return nil, false
@@ -164,10 +401,33 @@ func (fm *lruFileMap) syncRemove(name string) (*fileEntryWithAccessTime, bool) {
 	return fm.remove(name)
 }
 
+// exceedsCapacity returns true if either the entry count limit or the byte
+// limit is exceeded. The most recent entry is never evicted for exceeding the
+// byte limit, so a single blob larger than the limit can still be stored.
+func (fm *lruFileMap) exceedsCapacity() bool {
+	if fm.size > 0 && fm.len() > fm.size {
+		return true
+	}
+	if fm.maxBytes > 0 && fm.len() > 1 && fm.usedBytes() > fm.maxBytes {
+		return true
+	}
+	return false
+}
+
+// evictIfNeeded removes least recently accessed entries until the map is
+// within capacity.
+func (fm *lruFileMap) evictIfNeeded() {
+	for {
+		if _, ok := fm.syncRemoveOldestIfNeeded(); !ok {
+			return
+		}
+	}
+}
+
 func (fm *lruFileMap) syncRemoveOldestIfNeeded() (e *fileEntryWithAccessTime, ok bool) {
 	// Verify if size limit was defined and exceeded.
 	fm.Lock()
-	if fm.size <= 0 || fm.queue.Len() <= fm.size {
+	if !fm.exceedsCapacity() {
 		defer fm.Unlock()
 		return nil, false
 	}
@@ -190,8 +450,15 @@ func (fm *lruFileMap) syncRemoveOldestIfNeeded() (e *fileEntryWithAccessTime, ok
 		return nil, false
 	}
 
+	// The entry may have been opened before the lock was acquired.
+	if fm.inUse != nil && fm.inUse(name, e.fe) {
+		return nil, false
+	}
+
 	if err := e.fe.Delete(); err != nil {
 		log.With("name", e.fe.GetName()).Errorf("Error deleting evicted entry: %s", err)
+	} else if fm.onEvict != nil {
+		fm.onEvict(name)
 	}
 
 	// Remove from map while the entry lock is still being held.
@@ -200,6 +467,24 @@ func (fm *lruFileMap) syncRemoveOldestIfNeeded() (e *fileEntryWithAccessTime, ok
 	return e, true
 }
 
+// namesByAccessTime returns the names of all entries in eviction order, i.e.
+// least recently accessed first.
+func (fm *lruFileMap) namesByAccessTime() []string {
+	fm.Lock()
+	defer fm.Unlock()
+
+	fm.sortQueue()
+	names := make([]string, 0, fm.len())
+	for _, l := range []*list.List{fm.queue, fm.protected} {
+		for e := l.Back(); e != nil; e = e.Prev() {
+			if entry, ok := e.Value.(*fileEntryWithAccessTime); ok {
+				names = append(names, entry.fe.GetName())
+			}
+		}
+	}
+	return names
+}
+
 // Contains returns true if the given key is stored in the map.
 func (fm *lruFileMap) Contains(name string) bool {
 	fm.Lock()
@@ -227,27 +512,15 @@ func (fm *lruFileMap) TryStore(name string, entry FileEntry, f func(string, File
 
 	fm.Lock()
 	// Verify if it's already in the map.
-	if _, ok := fm.get(name); ok {
+	if existing, ok := fm.get(name); ok {
 		defer fm.Unlock()
 
-		// Update last access time.
-		t := fm.clk.Now()
-		if t.Sub(e.lastAccessTime) >= fm.timeResolution {
-			// Only update if new timestamp is <timeResolution> newer than
-			// previous value.
-			e.lastAccessTime = t
-			_, err := e.fe.SetMetadata(metadata.NewLastAccessTime(t))
-			if err != nil {
-				log.Desugar().Error("Error setting metadata", zap.String("name", e.fe.GetName()), zap.Error(err))
-			}
-		}
+		// Update last access time of the existing entry.
+		fm.touch(name, existing)
 
 		return false
 	}
 
-	// Add new entry to map.
-	fm.add(name, e)
-
 	lat := metadata.NewLastAccessTime(fm.clk.Now())
 	if err := e.fe.GetMetadata(lat); err != nil {
 		// Set LAT if it doesn't exist on disk or cannot be read.
@@ -260,6 +533,10 @@ func (fm *lruFileMap) TryStore(name string, entry FileEntry, f func(string, File
 	}
 	e.lastAccessTime = lat.Time
 
+	// Add new entry to map. LAT must be known beforehand, so entries reloaded
+	// from disk are placed according to their persisted access order.
+	fm.add(name, e)
+
 	fm.Unlock()
 
 	if !f(name, e.fe) {
@@ -351,6 +628,31 @@ func (fm *lruFileMap) LoadForPeek(name string, f func(string, FileEntry)) bool {
 	return true
 }
 
+// LoadForMaintenance looks up the value of key k and executes f under the
+// protection of Lock, without updating its last access time. Meant for
+// background jobs which modify entries, so they don't appear recently used.
+func (fm *lruFileMap) LoadForMaintenance(name string, f func(string, FileEntry)) bool {
+	e, ok := fm.syncGet(name)
+	if !ok {
+		return false
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	// Now that we have the entry lock, make sure k was not deleted or
+	// overwritten.
+	if ne, ok := fm.syncGet(name); !ok {
+		return false
+	} else if ne != e {
+		return false
+	}
+
+	f(name, e.fe)
+
+	return true
+}
+
 // Delete deletes the given key from the Map.
 // It also executes f under the protection of Lock.
 // If f returns false, abort before key deletion.
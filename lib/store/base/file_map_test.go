@@ -28,6 +28,7 @@ import (
 
 	"github.com/andres-erbsen/clock"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 func TestFileMapTryStore(t *testing.T) {
@@ -345,6 +346,156 @@ func TestLRUFileMapSizeLimit(t *testing.T) {
 	require.False(fm.Contains(names[0]))
 }
 
+func TestSizeLRUFileStoreEvictsByBytes(t *testing.T) {
+	require := require.New(t)
+	bundle, cleanup := fileStoreSizeLRUFixture(100)
+	defer cleanup()
+
+	store := bundle.store
+	state := bundle.state2
+
+	create := func(name string, size int64) {
+		require.NoError(store.NewFileOp().CreateFile(name, state, size))
+	}
+
+	// Fixture file of 5 bytes plus two files of 40 bytes fit within limit.
+	create("small_1", 40)
+	create("small_2", 40)
+	require.True(store.fileMap.Contains("small_1"))
+	require.True(store.fileMap.Contains("small_2"))
+	require.Equal(int64(85), store.usage.getTotal())
+
+	// A large file evicts least recently accessed entries until total size is
+	// back within limit.
+	create("large", 60)
+	require.False(store.fileMap.Contains(bundle.files[bundle.state1]))
+	require.False(store.fileMap.Contains("small_1"))
+	require.True(store.fileMap.Contains("small_2"))
+	require.True(store.fileMap.Contains("large"))
+	require.Equal(int64(100), store.usage.getTotal())
+
+	// A single file larger than the limit is kept.
+	create("huge", 1000)
+	require.True(store.fileMap.Contains("huge"))
+	require.False(store.fileMap.Contains("small_2"))
+	require.False(store.fileMap.Contains("large"))
+	require.Equal(int64(1000), store.usage.getTotal())
+}
+
+func TestLRUFileMapRebuildsOrderFromLastAccessTime(t *testing.T) {
+	require := require.New(t)
+	bundle, cleanup := fileStoreFixture(func(clk clock.Clock) *localFileStore {
+		return newLocalFileStore(NewLocalFileEntryFactory(), LRUConfig{Size: 4}, clk)
+	})
+	defer cleanup()
+
+	clk := bundle.clk.(*clock.Mock)
+	state := bundle.state2
+
+	// Create files with increasing access times.
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		clk.Add(time.Hour)
+		require.NoError(bundle.store.NewFileOp().CreateFile(name, state, 1))
+	}
+
+	// Reload in an order different from access order.
+	bundle.recreateStore()
+	store := bundle.store
+	for _, name := range []string{"c", "a", "b"} {
+		_, err := store.NewFileOp().AcceptState(state).GetFileStat(name)
+		require.NoError(err)
+	}
+
+	// Each new file evicts the least recently accessed file before restart.
+	clk.Add(time.Hour)
+	require.NoError(store.NewFileOp().CreateFile("d", state, 1))
+	require.NoError(store.NewFileOp().CreateFile("e", state, 1))
+	require.False(store.fileMap.Contains("a"))
+	require.True(store.fileMap.Contains("b"))
+	require.NoError(store.NewFileOp().CreateFile("f", state, 1))
+	require.False(store.fileMap.Contains("b"))
+	require.True(store.fileMap.Contains("c"))
+}
+
+func TestLRUFileMapSkipsReferencedEntriesOnEviction(t *testing.T) {
+	require := require.New(t)
+	bundle, cleanup := fileStoreLRUFixture(2)
+	defer cleanup()
+
+	store := bundle.store
+	clk := bundle.clk.(*clock.Mock)
+	state := bundle.state2
+
+	clk.Add(time.Hour)
+	require.NoError(store.NewFileOp().CreateFile("a", state, 1))
+	r, err := store.NewFileOp().AcceptState(state).GetFileReader("a", 0)
+	require.NoError(err)
+
+	// "a" is the least recently accessed file, but has an open reader.
+	clk.Add(time.Hour)
+	require.NoError(store.NewFileOp().CreateFile("b", state, 1))
+	require.True(store.fileMap.Contains("a"))
+	require.False(store.fileMap.Contains(bundle.files[bundle.state1]))
+
+	clk.Add(time.Hour)
+	require.NoError(store.NewFileOp().CreateFile("c", state, 1))
+	require.True(store.fileMap.Contains("a"))
+	require.False(store.fileMap.Contains("b"))
+
+	require.NoError(r.Close())
+	clk.Add(time.Hour)
+	require.NoError(store.NewFileOp().CreateFile("d", state, 1))
+	require.False(store.fileMap.Contains("a"))
+	require.True(store.fileMap.Contains("c"))
+}
+
+func TestLRUFileMapBatchesLastAccessTimeUpdates(t *testing.T) {
+	require := require.New(t)
+	bundle, cleanup := fileStoreFixture(func(clk clock.Clock) *localFileStore {
+		return newLocalFileStore(
+			NewLocalFileEntryFactory(), LRUConfig{Size: 100, LATFlushInterval: time.Hour}, clk)
+	})
+	defer cleanup()
+
+	store := bundle.store
+	clk := bundle.clk.(*clock.Mock)
+	state := bundle.state2
+
+	t0 := clk.Now()
+	require.NoError(store.NewFileOp().CreateFile("a", state, 1))
+
+	readLAT := func() time.Time {
+		var lat metadata.LastAccessTime
+		require.NoError(store.NewFileOp().AcceptState(state).GetFileMetadata("a", &lat))
+		return lat.Time
+	}
+
+	read := func() {
+		r, err := store.NewFileOp().AcceptState(state).GetFileReader("a", 0)
+		require.NoError(err)
+		require.NoError(r.Close())
+	}
+
+	// Update is held in memory until flush interval elapses.
+	clk.Add(10 * time.Minute)
+	read()
+	t1 := clk.Now()
+	require.Equal(t0.Truncate(time.Second), readLAT())
+
+	clk.Add(50 * time.Minute)
+	require.Eventually(func() bool {
+		return readLAT().Equal(t1.Truncate(time.Second))
+	}, time.Second, 10*time.Millisecond)
+
+	// Pending updates are persisted on close.
+	clk.Add(10 * time.Minute)
+	read()
+	require.Equal(t1.Truncate(time.Second), readLAT())
+	store.Close()
+	require.Equal(clk.Now().Truncate(time.Second), readLAT())
+}
+
 func TestLRUCreateLastAccessTimeOnCreateFile(t *testing.T) {
 	require := require.New(t)
 	bundle, cleanup := fileStoreLRUFixture(100)
@@ -495,3 +646,14 @@ func TestLRUKeepLastAccessTimeOnPeek(t *testing.T) {
 	require.NoError(store.NewFileOp().AcceptState(s1).GetFileMetadata(fn, &lat))
 	require.Equal(t0.Truncate(time.Second), lat.Time)
 }
+
+func TestReplacementPolicyUnmarshalYAML(t *testing.T) {
+	for _, policy := range []ReplacementPolicy{PolicyLRU, PolicySLRU} {
+		var p ReplacementPolicy
+		require.NoError(t, yaml.Unmarshal([]byte(policy), &p))
+		require.Equal(t, policy, p)
+	}
+
+	var p ReplacementPolicy
+	require.Error(t, yaml.Unmarshal([]byte("lfu"), &p))
+}
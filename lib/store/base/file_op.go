@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/uber/kraken/lib/store/metadata"
 )
@@ -30,6 +31,9 @@ const (
 	_lockLevelRead
 	// lockLevelWrite indicates lock for read.
 	_lockLevelWrite
+	// lockLevelMaintenance indicates lock for write, without updating access
+	// time.
+	_lockLevelMaintenance
 )
 
 // FileOp performs one file or metadata operation on FileStore, given a list of
@@ -37,15 +41,27 @@ const (
 type FileOp interface {
 	AcceptState(state FileState) FileOp
 	GetAcceptableStates() map[FileState]interface{}
+	VerifyDigest() FileOp
+	StreamingRead(threshold int64) FileOp
+	Readahead(pool *BufferPool) FileOp
 
 	CreateFile(name string, createState FileState, len int64) error
 	MoveFileFrom(name string, createState FileState, sourcePath string) error
+	ReplaceFileFrom(name string, createState FileState, sourcePath string) error
 	MoveFile(name string, goalState FileState) error
 	LinkFileTo(name string, targetPath string) error
+	CopyFile(name string, targetState FileState) error
+	CompressFile(name string) error
+	DecompressFile(name string) error
 	DeleteFile(name string) error
+	DeleteIfUnreferenced(name string, force bool) error
+
+	LockFile(name string) (*FileLock, error)
+	TryLockFile(name string) (*FileLock, error)
 
 	GetFilePath(name string) (string, error)
 	GetFileStat(name string) (os.FileInfo, error)
+	GetFileRefCount(name string) (int, error)
 
 	GetFileReader(name string, readPartSize int) (FileReader, error)
 	GetFileReadWriter(name string, readPartSize, writePartSize int) (FileReadWriter, error)
@@ -55,6 +71,7 @@ type FileOp interface {
 	SetFileMetadataAt(name string, md metadata.Metadata, b []byte, offset int64) (bool, error)
 	GetOrSetFileMetadata(name string, md metadata.Metadata) error
 	DeleteFileMetadata(name string, md metadata.Metadata) error
+	WithMetadataTxn(name string, f func(txn *MetadataTxn) error) error
 
 	RangeFileMetadata(name string, f func(metadata.Metadata) error) error
 
@@ -70,6 +87,17 @@ var _ FileOp = (*localFileOp)(nil)
 type localFileOp struct {
 	s      *localFileStore
 	states map[FileState]interface{} // Set of states that's acceptable.
+
+	// If set, readers returned by GetFileReader verify content against name.
+	verifyDigest bool
+
+	// If positive, readers returned by GetFileReader for files of at least
+	// this size are opened for streaming, bypassing the page cache on close.
+	streamingThreshold int64
+
+	// If set, readers and writers prefetch the range following each ReadAt
+	// into buffers from this pool.
+	readaheadPool *BufferPool
 }
 
 // NewLocalFileOp inits a new FileOp obj.
@@ -91,6 +119,29 @@ func (op *localFileOp) GetAcceptableStates() map[FileState]interface{} {
 	return op.states
 }
 
+// VerifyDigest makes GetFileReader return readers which validate the sha256
+// of the file content against its name as it is read sequentially. Only
+// applicable to files named by their hex sha256 digest.
+func (op *localFileOp) VerifyDigest() FileOp {
+	op.verifyDigest = true
+	return op
+}
+
+// StreamingRead makes GetFileReader advise the kernel that files of at least
+// threshold bytes are read sequentially once, so their pages are dropped from
+// the page cache after the reader is closed. No-op on non-linux platforms.
+func (op *localFileOp) StreamingRead(threshold int64) FileOp {
+	op.streamingThreshold = threshold
+	return op
+}
+
+// Readahead makes GetFileReader and GetFileReadWriter prefetch the range
+// following each ReadAt in the background, into buffers of pool.
+func (op *localFileOp) Readahead(pool *BufferPool) FileOp {
+	op.readaheadPool = pool
+	return op
+}
+
 // verifyStateHelper verifies file is in one of the acceptable states.
 func (op *localFileOp) verifyStateHelper(name string, entry FileEntry) error {
 	currState := entry.GetState()
@@ -134,6 +185,9 @@ func (op *localFileOp) reloadFileEntryHelper(name string) (reloaded bool, err er
 		if stored := op.s.fileMap.TryStore(name, fileEntry, func(name string, entry FileEntry) bool {
 			// Verify the file is still on disk.
 			err = entry.Reload()
+			if err == nil {
+				op.s.index.load(name, entry)
+			}
 			return err == nil
 		}); err != nil {
 			if os.IsNotExist(err) {
@@ -146,6 +200,7 @@ func (op *localFileOp) reloadFileEntryHelper(name string) (reloaded bool, err er
 			// that the entry would be deleted before this function returns.
 			return true, nil
 		}
+		op.s.usage.setFromDisk(name, state, fileEntry.GetPath())
 		return true, nil
 	}
 	return false, os.ErrNotExist
@@ -180,6 +235,13 @@ func (op *localFileOp) lockHelper(
 			}
 			f(name, entry)
 		})
+	case _lockLevelMaintenance:
+		loaded = op.s.fileMap.LoadForMaintenance(name, func(name string, entry FileEntry) {
+			if err = op.verifyStateHelper(name, entry); err != nil {
+				return
+			}
+			f(name, entry)
+		})
 	}
 	if !loaded {
 		return os.ErrNotExist
@@ -261,6 +323,7 @@ func (op *localFileOp) createFileHelper(
 		}
 		return os.ErrExist
 	}
+	op.s.usage.setFromDisk(name, targetState, newEntry.GetPath())
 
 	return nil
 }
@@ -269,6 +332,7 @@ func (op *localFileOp) createFileHelper(
 // If file exists and is in an acceptable state, returns os.ErrExist.
 // If file exists but not in an acceptable state, returns FileStateError.
 func (op *localFileOp) CreateFile(name string, targetState FileState, len int64) (err error) {
+	defer op.observe("create_file", time.Now(), &err)
 	return op.createFileHelper(name, targetState, "", len)
 }
 
@@ -276,18 +340,55 @@ func (op *localFileOp) CreateFile(name string, targetState FileState, len int64)
 // If file exists and is in an acceptable state, returns os.ErrExist.
 // If file exists but not in an acceptable state, returns FileStateError.
 func (op *localFileOp) MoveFileFrom(name string, targetState FileState, sourcePath string) (err error) {
+	defer op.observe("move_file_from", time.Now(), &err)
 	return op.createFileHelper(name, targetState, sourcePath, -1)
 }
 
+// ReplaceFileFrom moves an unmanaged file into file store, atomically replacing
+// the data of the file if it exists, such that readers never observe a missing
+// or partially written file. Metadata of a replaced file is kept.
+// If file exists but not in an acceptable state, returns FileStateError.
+func (op *localFileOp) ReplaceFileFrom(name string, targetState FileState, sourcePath string) (err error) {
+	defer op.observe("replace_file_from", time.Now(), &err)
+	var targetPath string
+	loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
+		if entry.GetState() != targetState {
+			err = &FileStateError{
+				Op:    "ReplaceFileFrom",
+				State: entry.GetState(),
+				Name:  name,
+				Msg:   fmt.Sprintf("desired state: %v", targetState),
+			}
+			return
+		}
+		if err = entry.ReplaceFrom(sourcePath); err == nil {
+			targetPath = entry.GetPath()
+			op.s.index.load(name, entry)
+		}
+	})
+	if os.IsNotExist(loadErr) {
+		return op.createFileHelper(name, targetState, sourcePath, -1)
+	} else if loadErr != nil {
+		return loadErr
+	}
+	if err == nil {
+		// Update usage outside of entry lock, since it may trigger eviction.
+		op.s.usage.setFromDisk(name, targetState, targetPath)
+	}
+	return err
+}
+
 // MoveFile moves a file to a different directory and updates its state
 // accordingly, and moves all metadata that's `movable`.
 func (op *localFileOp) MoveFile(name string, targetState FileState) (err error) {
+	defer op.observe("move_file", time.Now(), &err)
 	if _, err = op.reloadFileEntryHelper(name); err != nil {
 		return err
 	}
 
 	// Verify that the file is not in target state, and is currently in one of
 	// the acceptable states.
+	var targetPath string
 	loaded := op.s.fileMap.LoadForWrite(name, func(name string, entry FileEntry) {
 		currState := entry.GetState()
 		if currState == targetState {
@@ -297,7 +398,11 @@ func (op *localFileOp) MoveFile(name string, targetState FileState) (err error)
 		for state := range op.states {
 			if currState == state {
 				// File is in one of the acceptable states. Perform move.
-				err = entry.Move(targetState)
+				if err = entry.Move(targetState); err == nil {
+					targetPath = entry.GetPath()
+					// Metadata which is not movable was dropped.
+					op.s.index.load(name, entry)
+				}
 				return
 			}
 		}
@@ -311,11 +416,16 @@ func (op *localFileOp) MoveFile(name string, targetState FileState) (err error)
 	if !loaded {
 		return os.ErrNotExist
 	}
+	if err == nil {
+		// Update usage outside of entry lock, since it may trigger eviction.
+		op.s.usage.setFromDisk(name, targetState, targetPath)
+	}
 	return err
 }
 
 // LinkFileTo create a hardlink to an unmanaged path.
 func (op *localFileOp) LinkFileTo(name string, targetPath string) (err error) {
+	defer op.observe("link_file_to", time.Now(), &err)
 	if loadErr := op.lockHelper(name, _lockLevelRead, func(name string, entry FileEntry) {
 		err = entry.LinkTo(targetPath)
 	}); loadErr != nil {
@@ -324,10 +434,114 @@ func (op *localFileOp) LinkFileTo(name string, targetPath string) (err error) {
 	return err
 }
 
-// DeleteFile removes a file from disk and file map.
+// CopyFile creates an independent copy of a file, along with its movable
+// metadata, under targetState. The copy is not tracked by the store, and the
+// file itself stays in its current state. Unlike LinkFileTo, this works
+// across mounts.
+// If file is already in targetState, or a copy exists there, returns
+// os.ErrExist.
+func (op *localFileOp) CopyFile(name string, targetState FileState) (err error) {
+	defer op.observe("copy_file", time.Now(), &err)
+	if loadErr := op.lockHelper(name, _lockLevelRead, func(name string, entry FileEntry) {
+		if entry.GetState() == targetState {
+			err = os.ErrExist
+			return
+		}
+		err = entry.CopyTo(targetState)
+	}); loadErr != nil {
+		return loadErr
+	}
+	return err
+}
+
+// CompressFile compresses the data of a file in place, without updating its
+// access time. Files with open readers or writers are skipped with
+// FileInUseError.
+func (op *localFileOp) CompressFile(name string) (err error) {
+	defer op.observe("compress_file", time.Now(), &err)
+	var state FileState
+	var path string
+	if loadErr := op.lockHelper(name, _lockLevelMaintenance, func(name string, entry FileEntry) {
+		if refs := op.s.refs.get(name, entry); refs > 0 {
+			err = &FileInUseError{Name: name, Refs: refs}
+			return
+		}
+		err = entry.Compress()
+		state, path = entry.GetState(), entry.GetPath()
+		op.s.index.load(name, entry)
+	}); loadErr != nil {
+		return loadErr
+	}
+	if err == nil {
+		op.s.usage.refresh(name, state, path)
+	}
+	return err
+}
+
+// DecompressFile restores the plain data of a compressed file. It is a no-op
+// for files which are not compressed.
+func (op *localFileOp) DecompressFile(name string) (err error) {
+	defer op.observe("decompress_file", time.Now(), &err)
+	var state FileState
+	var path string
+	if loadErr := op.lockHelper(name, _lockLevelMaintenance, func(name string, entry FileEntry) {
+		err = entry.Decompress()
+		state, path = entry.GetState(), entry.GetPath()
+		op.s.index.load(name, entry)
+	}); loadErr != nil {
+		return loadErr
+	}
+	if err == nil {
+		op.s.usage.refresh(name, state, path)
+	}
+	return err
+}
+
+// LockFile blocks until it acquires an exclusive advisory lock on a file.
+// Unlike the in-memory entry locks, the lock is flock based, so it excludes
+// other processes operating on the same directory. The lock is bound to the
+// current data file, and does not survive the file being moved or replaced.
+func (op *localFileOp) LockFile(name string) (*FileLock, error) {
+	return op.lockFile(name, true)
+}
+
+// TryLockFile is like LockFile, but returns ErrFileLocked instead of blocking
+// if the file is already locked.
+func (op *localFileOp) TryLockFile(name string) (*FileLock, error) {
+	return op.lockFile(name, false)
+}
+
+func (op *localFileOp) lockFile(name string, block bool) (*FileLock, error) {
+	var f *os.File
+	var err error
+	if loadErr := op.lockHelper(name, _lockLevelPeek, func(name string, entry FileEntry) {
+		f, err = os.Open(entry.GetPath())
+	}); loadErr != nil {
+		return nil, loadErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Acquire outside of the entry lock, since it may block on other
+	// processes.
+	if err := flock(f, block); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileLock{f}, nil
+}
+
+// DeleteFile removes a file from disk and file map. If the store has a Trash,
+// the file is moved there instead.
 func (op *localFileOp) DeleteFile(name string) (err error) {
+	defer op.observe("delete_file", time.Now(), &err)
 	if loadErr := op.deleteHelper(name, func(name string, entry FileEntry) bool {
-		err = entry.Delete()
+		err = op.deleteEntry(entry)
+		if err == nil {
+			op.s.usage.remove(name)
+			op.s.index.remove(name)
+		}
+		op.s.refs.drop(name)
 		// Return true so the entry would be removed from map regardless.
 		return true
 	}); loadErr != nil {
@@ -336,6 +550,49 @@ func (op *localFileOp) DeleteFile(name string) (err error) {
 	return err
 }
 
+// DeleteIfUnreferenced deletes a file unless it has open readers or writers,
+// in which case FileInUseError is returned. If force is set, the file is
+// deleted regardless, which is meant for garbage collection.
+func (op *localFileOp) DeleteIfUnreferenced(name string, force bool) (err error) {
+	defer op.observe("delete_if_unreferenced", time.Now(), &err)
+	if loadErr := op.deleteHelper(name, func(name string, entry FileEntry) bool {
+		if refs := op.s.refs.get(name, entry); refs > 0 && !force {
+			err = &FileInUseError{Name: name, Refs: refs}
+			return false
+		}
+		err = op.deleteEntry(entry)
+		if err == nil {
+			op.s.usage.remove(name)
+			op.s.index.remove(name)
+		}
+		op.s.refs.drop(name)
+		// Return true so the entry would be removed from map regardless.
+		return true
+	}); loadErr != nil {
+		return loadErr
+	}
+	return err
+}
+
+// deleteEntry moves entry into trash if the store has one, or removes it
+// otherwise.
+func (op *localFileOp) deleteEntry(entry FileEntry) error {
+	if op.s.trash != nil {
+		return entry.MoveToTrash(op.s.trash)
+	}
+	return entry.Delete()
+}
+
+// GetFileRefCount returns the number of open readers and writers of a file.
+func (op *localFileOp) GetFileRefCount(name string) (refs int, err error) {
+	if loadErr := op.lockHelper(name, _lockLevelPeek, func(name string, entry FileEntry) {
+		refs = op.s.refs.get(name, entry)
+	}); loadErr != nil {
+		return 0, loadErr
+	}
+	return refs, nil
+}
+
 // GetFilePath returns full path for a file.
 func (op *localFileOp) GetFilePath(name string) (path string, err error) {
 	if loadErr := op.lockHelper(name, _lockLevelPeek, func(name string, entry FileEntry) {
@@ -348,6 +605,7 @@ func (op *localFileOp) GetFilePath(name string) (path string, err error) {
 
 // GetFileStat returns FileInfo for a file.
 func (op *localFileOp) GetFileStat(name string) (info os.FileInfo, err error) {
+	defer op.observe("get_file_stat", time.Now(), &err)
 	if loadErr := op.lockHelper(name, _lockLevelPeek, func(name string, entry FileEntry) {
 		info, err = entry.GetStat()
 	}); loadErr != nil {
@@ -356,10 +614,43 @@ func (op *localFileOp) GetFileStat(name string) (info os.FileInfo, err error) {
 	return info, err
 }
 
-// GetFileReader returns a FileReader object for read operations.
+// GetFileReader returns a FileReader object for read operations. If VerifyDigest
+// was set, reading to EOF returns ChecksumMismatchError on corrupt content.
+// Compressed files are decompressed first.
 func (op *localFileOp) GetFileReader(name string, readPartSize int) (r FileReader, err error) {
+	defer op.observe("get_file_reader", time.Now(), &err)
+	r, err = op.getFileReader(name, readPartSize)
+	if err == ErrFileCompressed {
+		if err := op.DecompressFile(name); err != nil {
+			return nil, err
+		}
+		r, err = op.getFileReader(name, readPartSize)
+	}
+	if err != nil || !op.verifyDigest {
+		return r, err
+	}
+	vr, err := newVerifyingReader(r, name)
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("verifying reader: %s", err)
+	}
+	return vr, nil
+}
+
+func (op *localFileOp) getFileReader(name string, readPartSize int) (r FileReader, err error) {
 	if loadErr := op.lockHelper(name, _lockLevelRead, func(name string, entry FileEntry) {
 		r, err = entry.GetReader(readPartSize)
+		if err == nil && op.streamingThreshold > 0 {
+			if lr, ok := r.(interface{ adviseStreaming() }); ok && r.Size() >= op.streamingThreshold {
+				lr.adviseStreaming()
+			}
+		}
+		if err == nil {
+			r = &refCountedReader{r, op.s.refs.acquire(name, entry)}
+			if op.readaheadPool != nil {
+				r = newReadaheadReader(r, op.readaheadPool)
+			}
+		}
 	}); loadErr != nil {
 		return nil, loadErr
 	}
@@ -367,9 +658,32 @@ func (op *localFileOp) GetFileReader(name string, readPartSize int) (r FileReade
 }
 
 // GetFileReadWriter returns a FileReadWriter object for read/write operations.
+// Compressed files are decompressed first.
 func (op *localFileOp) GetFileReadWriter(name string, readPartSize, writePartSize int) (w FileReadWriter, err error) {
+	defer op.observe("get_file_read_writer", time.Now(), &err)
+	w, err = op.getFileReadWriter(name, readPartSize, writePartSize)
+	if err == ErrFileCompressed {
+		if err := op.DecompressFile(name); err != nil {
+			return nil, err
+		}
+		w, err = op.getFileReadWriter(name, readPartSize, writePartSize)
+	}
+	return w, err
+}
+
+func (op *localFileOp) getFileReadWriter(name string, readPartSize, writePartSize int) (w FileReadWriter, err error) {
 	if loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
 		w, err = entry.GetReadWriter(readPartSize, writePartSize)
+		if err == nil {
+			state, path := entry.GetState(), entry.GetPath()
+			w = &usageTrackingReadWriter{w, func() {
+				op.s.usage.refresh(name, state, path)
+			}}
+			w = &refCountedReadWriter{w, op.s.refs.acquire(name, entry)}
+			if op.readaheadPool != nil {
+				w = newReadaheadReadWriter(w, op.readaheadPool)
+			}
+		}
 	}); loadErr != nil {
 		return nil, loadErr
 	}
@@ -378,6 +692,7 @@ func (op *localFileOp) GetFileReadWriter(name string, readPartSize, writePartSiz
 
 // GetFileMetadata loads metadata assocciated with the file.
 func (op *localFileOp) GetFileMetadata(name string, md metadata.Metadata) (err error) {
+	defer op.observe("get_file_metadata", time.Now(), &err)
 	if loadErr := op.lockHelper(name, _lockLevelPeek, func(name string, entry FileEntry) {
 		err = entry.GetMetadata(md)
 	}); loadErr != nil {
@@ -388,8 +703,12 @@ func (op *localFileOp) GetFileMetadata(name string, md metadata.Metadata) (err e
 
 // SetFileMetadata creates or overwrites metadata assocciate with the file.
 func (op *localFileOp) SetFileMetadata(name string, md metadata.Metadata) (updated bool, err error) {
+	defer op.observe("set_file_metadata", time.Now(), &err)
 	if loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
 		updated, err = entry.SetMetadata(md)
+		if err == nil {
+			op.s.index.set(name, md)
+		}
 	}); loadErr != nil {
 		return false, loadErr
 	}
@@ -400,8 +719,12 @@ func (op *localFileOp) SetFileMetadata(name string, md metadata.Metadata) (updat
 func (op *localFileOp) SetFileMetadataAt(
 	name string, md metadata.Metadata, b []byte, offset int64) (updated bool, err error) {
 
+	defer op.observe("set_file_metadata_at", time.Now(), &err)
 	if loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
 		updated, err = entry.SetMetadataAt(md, b, offset)
+		if err == nil && op.s.index.indexed(md.GetSuffix()) {
+			op.s.index.load(name, entry)
+		}
 	}); loadErr != nil {
 		return false, loadErr
 	}
@@ -410,8 +733,12 @@ func (op *localFileOp) SetFileMetadataAt(
 
 // GetOrSetFileMetadata see localFileEntryInternal.
 func (op *localFileOp) GetOrSetFileMetadata(name string, md metadata.Metadata) (err error) {
+	defer op.observe("get_or_set_file_metadata", time.Now(), &err)
 	if loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
 		err = entry.GetOrSetMetadata(md)
+		if err == nil {
+			op.s.index.set(name, md)
+		}
 	}); loadErr != nil {
 		return loadErr
 	}
@@ -420,8 +747,32 @@ func (op *localFileOp) GetOrSetFileMetadata(name string, md metadata.Metadata) (
 
 // DeleteFileMetadata deletes metadata of the specified type for a file.
 func (op *localFileOp) DeleteFileMetadata(name string, md metadata.Metadata) (err error) {
+	defer op.observe("delete_file_metadata", time.Now(), &err)
 	loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
 		err = entry.DeleteMetadata(md)
+		if err == nil || os.IsNotExist(err) {
+			op.s.index.unset(name, md)
+		}
+	})
+	if loadErr != nil {
+		return loadErr
+	}
+	return err
+}
+
+// WithMetadataTxn calls f to collect metadata changes for a file, and applies
+// them atomically. If f returns an error, nothing is written.
+func (op *localFileOp) WithMetadataTxn(name string, f func(txn *MetadataTxn) error) (err error) {
+	defer op.observe("with_metadata_txn", time.Now(), &err)
+	loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
+		txn := &MetadataTxn{}
+		if err = f(txn); err != nil {
+			return
+		}
+		err = entry.CommitMetadataTxn(txn)
+		if err == nil {
+			op.s.index.load(name, entry)
+		}
 	})
 	if loadErr != nil {
 		return loadErr
@@ -431,6 +782,7 @@ func (op *localFileOp) DeleteFileMetadata(name string, md metadata.Metadata) (er
 
 // RangeFileMetadata loops through all metadata of one file and applies function f, until an error happens.
 func (op *localFileOp) RangeFileMetadata(name string, f func(md metadata.Metadata) error) (err error) {
+	defer op.observe("range_file_metadata", time.Now(), &err)
 	loadErr := op.lockHelper(name, _lockLevelWrite, func(name string, entry FileEntry) {
 		err = entry.RangeMetadata(f)
 	})
@@ -452,6 +804,14 @@ func (op *localFileOp) ListNames() ([]string, error) {
 	return names, nil
 }
 
+// observe reports the latency and result of operation to the op hook of the
+// store, if any.
+func (op *localFileOp) observe(operation string, start time.Time, err *error) {
+	if hook := op.s.opHook.Load(); hook != nil {
+		(*hook)(operation, time.Since(start), *err)
+	}
+}
+
 func (op *localFileOp) String() string {
 	var dirs []string
 	for state := range op.states {
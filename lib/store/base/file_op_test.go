@@ -14,6 +14,8 @@
 package base
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"log"
 	"os"
@@ -24,9 +26,11 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
 )
 
 // These tests should pass for all FileStore/FileOp implementations
@@ -40,6 +44,10 @@ func TestFileOp(t *testing.T) {
 		{"LocalFileStoreLRU", func() (storeBundle *fileStoreTestBundle, cleanup func()) {
 			return fileStoreLRUFixture(2)
 		}},
+		{"LocalFileStoreSizeLRU", func() (storeBundle *fileStoreTestBundle, cleanup func()) {
+			return fileStoreSizeLRUFixture(1024)
+		}},
+		{"LocalFileStoreDurable", fileStoreDurableFixture},
 	}
 
 	tests := []func(require *require.Assertions, storeBundle *fileStoreTestBundle){
@@ -48,12 +56,21 @@ func TestFileOp(t *testing.T) {
 		testReloadFileEntry,
 		testMoveFile,
 		testLinkFileTo,
+		testCopyFile,
+		testCompressFile,
+		testLockFile,
 		testDeleteFile,
+		testDeleteIfUnreferenced,
 		testGetFileReader,
+		testGetFileReaderVerifyDigest,
+		testGetFileReaderStreamingRead,
 		testGetFileReadWriter,
 		testGetOrSetFileMetadataConcurrently,
 		testSetFileMetadataAtConcurrently,
 		testDeleteFileMetadata,
+		testWithMetadataTxn,
+		testDiskUsage,
+		testOpHook,
 	}
 
 	for _, store := range stores {
@@ -264,6 +281,136 @@ func testLinkFileTo(require *require.Assertions, storeBundle *fileStoreTestBundl
 	require.NoError(err)
 }
 
+func testCopyFile(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	s2 := storeBundle.state2
+	s3 := storeBundle.state3
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+	partSize := 100
+
+	rw, err := store.NewFileOp().AcceptState(s1).GetFileReadWriter(fn, partSize, partSize)
+	require.NoError(err)
+	_, err = rw.Write([]byte("test\n"))
+	require.NoError(err)
+	require.NoError(rw.Close())
+	_, err = store.NewFileOp().AcceptState(s1).SetFileMetadata(fn, getMockMetadataMovable())
+	require.NoError(err)
+
+	// Copying into the current state fails.
+	require.Equal(os.ErrExist, store.NewFileOp().AcceptState(s1).CopyFile(fn, s1))
+
+	// Copying from a state which is not accepted fails.
+	err = store.NewFileOp().AcceptState(s3).CopyFile(fn, s2)
+	require.True(IsFileStateError(err))
+
+	require.NoError(store.NewFileOp().AcceptState(s1).CopyFile(fn, s2))
+	copyPath := filepath.Join(s2.GetDirectory(), store.fileEntryFactory.GetRelativePath(fn))
+	data, err := os.ReadFile(copyPath)
+	require.NoError(err)
+	require.Equal("test\n", string(data))
+	_, err = os.Stat(filepath.Join(filepath.Dir(copyPath), getMockMetadataMovable().GetSuffix()))
+	require.NoError(err)
+
+	// Original stays in place, and is independent of the copy.
+	require.NoError(os.WriteFile(copyPath, []byte("copy\n"), 0775))
+	r, err := store.NewFileOp().AcceptState(s1).GetFileReader(fn, partSize)
+	require.NoError(err)
+	data, err = io.ReadAll(r)
+	require.NoError(err)
+	require.Equal("test\n", string(data))
+	require.NoError(r.Close())
+
+	// Copy already exists.
+	require.Equal(os.ErrExist, store.NewFileOp().AcceptState(s1).CopyFile(fn, s2))
+}
+
+func testCompressFile(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+	content := bytes.Repeat([]byte("compressible\n"), 1000)
+
+	rw, err := store.NewFileOp().AcceptState(s1).GetFileReadWriter(fn, 0, 0)
+	require.NoError(err)
+	_, err = rw.Write(content)
+	require.NoError(err)
+	require.NoError(rw.Close())
+
+	// Files with open readers are not compressed.
+	r, err := store.NewFileOp().AcceptState(s1).GetFileReader(fn, 0)
+	require.NoError(err)
+	require.True(IsFileInUseError(store.NewFileOp().AcceptState(s1).CompressFile(fn)))
+	require.NoError(r.Close())
+
+	require.NoError(store.NewFileOp().AcceptState(s1).CompressFile(fn))
+	path, err := store.NewFileOp().AcceptState(s1).GetFilePath(fn)
+	require.NoError(err)
+	raw, err := os.Stat(path)
+	require.NoError(err)
+	require.True(raw.Size() < int64(len(content)))
+
+	// Stat reports the uncompressed size.
+	info, err := store.NewFileOp().AcceptState(s1).GetFileStat(fn)
+	require.NoError(err)
+	require.Equal(int64(len(content)), info.Size())
+
+	// Reading decompresses the file.
+	r, err = store.NewFileOp().AcceptState(s1).GetFileReader(fn, 0)
+	require.NoError(err)
+	data, err := io.ReadAll(r)
+	require.NoError(err)
+	require.NoError(r.Close())
+	require.Equal(content, data)
+	raw, err = os.Stat(path)
+	require.NoError(err)
+	require.Equal(int64(len(content)), raw.Size())
+	require.True(os.IsNotExist(
+		store.NewFileOp().AcceptState(s1).GetFileMetadata(fn, metadata.NewCompressed(0))))
+}
+
+func testLockFile(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+
+	l, err := store.NewFileOp().AcceptState(s1).TryLockFile(fn)
+	require.NoError(err)
+
+	_, err = store.NewFileOp().AcceptState(s1).TryLockFile(fn)
+	require.Equal(ErrFileLocked, err)
+
+	locked := make(chan *FileLock)
+	go func() {
+		l, err := store.NewFileOp().AcceptState(s1).LockFile(fn)
+		require.NoError(err)
+		locked <- l
+	}()
+	select {
+	case <-locked:
+		require.FailNow("lock acquired while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(l.Unlock())
+	require.NoError((<-locked).Unlock())
+
+	_, err = store.NewFileOp().AcceptState(s1).TryLockFile(core.DigestFixture().Hex())
+	require.True(os.IsNotExist(err))
+}
+
 func testDeleteFile(require *require.Assertions, storeBundle *fileStoreTestBundle) {
 	store := storeBundle.store
 
@@ -354,6 +501,68 @@ func testGetFileReader(require *require.Assertions, storeBundle *fileStoreTestBu
 	require.NoError(reader.Close())
 }
 
+func testGetFileReaderVerifyDigest(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+
+	// Fixture file content does not match its name.
+	reader, err := store.NewFileOp().AcceptState(s1).VerifyDigest().GetFileReader(fn, 100 /*readPartSize */)
+	require.NoError(err)
+	_, err = io.ReadAll(reader)
+	require.True(IsChecksumMismatchError(err))
+	require.NoError(reader.Close())
+
+	// File named after the digest of its content passes verification.
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+	require.NoError(store.NewFileOp().CreateFile(name, s1, 0))
+	readWriter, err := store.NewFileOp().AcceptState(s1).GetFileReadWriter(name, 100 /*readPartSize */, 100 /*writePartSize*/)
+	require.NoError(err)
+	_, err = readWriter.Write(blob.Content)
+	require.NoError(err)
+	require.NoError(readWriter.Close())
+
+	reader, err = store.NewFileOp().AcceptState(s1).VerifyDigest().GetFileReader(name, 100 /*readPartSize */)
+	require.NoError(err)
+	data, err := io.ReadAll(reader)
+	require.NoError(err)
+	require.Equal(blob.Content, data)
+
+	// Seeking back to the origin restarts verification.
+	_, err = reader.Seek(0, io.SeekStart)
+	require.NoError(err)
+	data, err = io.ReadAll(reader)
+	require.NoError(err)
+	require.Equal(blob.Content, data)
+	require.NoError(reader.Close())
+}
+
+func testGetFileReaderStreamingRead(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+
+	// Fixture file is 5 bytes long, so thresholds on both sides of it are
+	// exercised.
+	for _, threshold := range []int64{1, 5, 6} {
+		reader, err := store.NewFileOp().AcceptState(s1).StreamingRead(threshold).GetFileReader(fn, 100 /*readPartSize */)
+		require.NoError(err)
+		data, err := io.ReadAll(reader)
+		require.NoError(err)
+		require.Len(data, 5)
+		require.NoError(reader.Close())
+	}
+}
+
 func testGetFileReadWriter(require *require.Assertions, storeBundle *fileStoreTestBundle) {
 	store := storeBundle.store
 
@@ -476,6 +685,55 @@ func testSetFileMetadataAtConcurrently(require *require.Assertions, storeBundle
 	}
 }
 
+func testDeleteIfUnreferenced(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+
+	r, err := store.NewFileOp().AcceptState(s1).GetFileReader(fn, 100 /*readPartSize */)
+	require.NoError(err)
+	rw, err := store.NewFileOp().AcceptState(s1).GetFileReadWriter(fn, 100 /*readPartSize*/, 100 /*writePartSize*/)
+	require.NoError(err)
+
+	refs, err := store.NewFileOp().AcceptState(s1).GetFileRefCount(fn)
+	require.NoError(err)
+	require.Equal(2, refs)
+
+	err = store.NewFileOp().AcceptState(s1).DeleteIfUnreferenced(fn, false)
+	require.True(IsFileInUseError(err))
+	_, err = store.NewFileOp().AcceptState(s1).GetFileStat(fn)
+	require.NoError(err)
+
+	// Closing twice only drops one reference.
+	require.NoError(r.Close())
+	require.Error(r.Close())
+	refs, err = store.NewFileOp().AcceptState(s1).GetFileRefCount(fn)
+	require.NoError(err)
+	require.Equal(1, refs)
+
+	require.NoError(rw.Commit())
+	refs, err = store.NewFileOp().AcceptState(s1).GetFileRefCount(fn)
+	require.NoError(err)
+	require.Equal(0, refs)
+
+	require.NoError(store.NewFileOp().AcceptState(s1).DeleteIfUnreferenced(fn, false))
+	_, err = store.NewFileOp().AcceptState(s1).GetFileStat(fn)
+	require.True(os.IsNotExist(err))
+
+	// Force deletes files in use.
+	require.NoError(store.NewFileOp().CreateFile(fn, s1, 5))
+	r, err = store.NewFileOp().AcceptState(s1).GetFileReader(fn, 100 /*readPartSize */)
+	require.NoError(err)
+	require.NoError(store.NewFileOp().AcceptState(s1).DeleteIfUnreferenced(fn, true))
+	_, err = store.NewFileOp().AcceptState(s1).GetFileStat(fn)
+	require.True(os.IsNotExist(err))
+	require.NoError(r.Close())
+}
+
 func testDeleteFileMetadata(require *require.Assertions, storeBundle *fileStoreTestBundle) {
 	store := storeBundle.store
 
@@ -499,3 +757,117 @@ func testDeleteFileMetadata(require *require.Assertions, storeBundle *fileStoreT
 	require.NoError(store.NewFileOp().AcceptState(s1).DeleteFileMetadata(fn, m))
 	require.Error(store.NewFileOp().AcceptState(s1).GetFileMetadata(fn, m))
 }
+
+func testWithMetadataTxn(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+
+	m1 := getMockMetadataOne()
+	m1.content = []byte("foo")
+	_, err := store.NewFileOp().AcceptState(s1).SetFileMetadata(fn, m1)
+	require.NoError(err)
+
+	// Nothing is written if f fails.
+	m2 := getMockMetadataTwo()
+	m2.content = []byte("bar")
+	txnErr := errors.New("some error")
+	require.Equal(txnErr, store.NewFileOp().AcceptState(s1).WithMetadataTxn(fn, func(txn *MetadataTxn) error {
+		txn.Delete(m1)
+		txn.Set(m2)
+		return txnErr
+	}))
+	require.NoError(store.NewFileOp().AcceptState(s1).GetFileMetadata(fn, getMockMetadataOne()))
+	require.Error(store.NewFileOp().AcceptState(s1).GetFileMetadata(fn, getMockMetadataTwo()))
+
+	require.NoError(store.NewFileOp().AcceptState(s1).WithMetadataTxn(fn, func(txn *MetadataTxn) error {
+		txn.Delete(m1)
+		txn.Set(m2)
+		return nil
+	}))
+	require.Error(store.NewFileOp().AcceptState(s1).GetFileMetadata(fn, getMockMetadataOne()))
+	result := getMockMetadataTwo()
+	require.NoError(store.NewFileOp().AcceptState(s1).GetFileMetadata(fn, result))
+	require.Equal(m2.content, result.content)
+}
+
+func testOpHook(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+
+	type call struct {
+		operation string
+		err       error
+	}
+	var mu sync.Mutex
+	var calls []call
+	store.SetOpHook(func(operation string, latency time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call{operation, err})
+	})
+
+	_, err := store.NewFileOp().AcceptState(s1).GetFileStat(fn)
+	require.NoError(err)
+	_, err = store.NewFileOp().AcceptState(s1).GetFileStat(core.DigestFixture().Hex())
+	require.True(os.IsNotExist(err))
+	require.NoError(store.NewFileOp().AcceptState(s1).DeleteFile(fn))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(calls, 3)
+	require.Equal(call{"get_file_stat", nil}, calls[0])
+	require.Equal("get_file_stat", calls[1].operation)
+	require.True(os.IsNotExist(calls[1].err))
+	require.Equal(call{"delete_file", nil}, calls[2])
+}
+
+func testDiskUsage(require *require.Assertions, storeBundle *fileStoreTestBundle) {
+	store := storeBundle.store
+
+	s1 := storeBundle.state1
+	s2 := storeBundle.state2
+	fn, ok := storeBundle.files[s1]
+	if !ok {
+		log.Fatal("file not found in state1")
+	}
+
+	var mu sync.Mutex
+	hookUsage := make(map[FileState]int64)
+	store.SetDiskUsageHook(func(state FileState, bytes int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		hookUsage[state] = bytes
+	})
+
+	require.Equal(int64(5), store.DiskUsage(s1))
+	require.Equal(int64(0), store.DiskUsage(s2))
+
+	// Writes are accounted once the writer is closed.
+	rw, err := store.NewFileOp().AcceptState(s1).GetFileReadWriter(fn, 0, 0)
+	require.NoError(err)
+	_, err = rw.Write(make([]byte, 10))
+	require.NoError(err)
+	require.NoError(rw.Close())
+	require.Equal(int64(10), store.DiskUsage(s1))
+
+	require.NoError(store.NewFileOp().AcceptState(s1).MoveFile(fn, s2))
+	require.Equal(int64(0), store.DiskUsage(s1))
+	require.Equal(int64(10), store.DiskUsage(s2))
+
+	require.NoError(store.NewFileOp().AcceptState(s2).DeleteFile(fn))
+	require.Equal(int64(0), store.DiskUsage(s2))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(map[FileState]int64{s1: 0, s2: 0}, hookUsage)
+}
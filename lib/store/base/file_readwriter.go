@@ -16,6 +16,8 @@ package base
 import (
 	"io"
 	"os"
+
+	"github.com/uber/kraken/utils/log"
 )
 
 // FileReader provides read operation on a file.
@@ -44,12 +46,35 @@ type localFileReadWriter struct {
 	descriptor    *os.File
 	writePartSize int
 	readPartSize  int
+
+	// If set, cached pages of the file are dropped on close.
+	dropCache bool
+}
+
+// adviseStreaming hints the kernel to read the file ahead sequentially and
+// drops its pages from the page cache once the reader is closed. Best effort.
+func (readWriter *localFileReadWriter) adviseStreaming() {
+	if err := adviseSequential(readWriter.descriptor); err != nil {
+		log.With("path", readWriter.descriptor.Name()).Warnf("Error advising sequential read: %s", err)
+	}
+	readWriter.dropCache = true
 }
 
 func (readWriter *localFileReadWriter) close() error {
+	if readWriter.dropCache {
+		if err := adviseDontNeed(readWriter.descriptor); err != nil {
+			log.With("path", readWriter.descriptor.Name()).Warnf("Error dropping cached pages: %s", err)
+		}
+	}
 	return readWriter.descriptor.Close()
 }
 
+// file implements directReader. Reads split into parts must go through
+// readWriter.
+func (readWriter localFileReadWriter) file() (*os.File, bool) {
+	return readWriter.descriptor, readWriter.readPartSize == 0
+}
+
 // Close closes underlying OS.File object.
 func (readWriter localFileReadWriter) Close() error {
 	return readWriter.close()
@@ -167,7 +192,14 @@ func (readWriter localFileReadWriter) Cancel() error {
 }
 
 // Commit is supposed to flush all content for buffered writer.
-// In this implementation all writes write to the file directly through syscall.
+// In this implementation all writes write to the file directly through syscall,
+// which are fsync'ed under DurabilityAlways.
 func (readWriter localFileReadWriter) Commit() error {
+	if readWriter.entry.durability.syncData() {
+		if err := readWriter.descriptor.Sync(); err != nil {
+			readWriter.close()
+			return err
+		}
+	}
 	return readWriter.close()
 }
@@ -14,49 +14,153 @@
 package base
 
 import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/kraken/lib/store/metadata"
+
 	"github.com/andres-erbsen/clock"
 )
 
 // FileStore manages files and their metadata. Actual operations are done through FileOp.
 type FileStore interface {
 	NewFileOp() FileOp
+
+	// DiskUsage returns the number of bytes used by files in state.
+	DiskUsage(state FileState) int64
+
+	// SetDiskUsageHook registers hook to be called whenever usage of a state
+	// changes, e.g. to export metrics.
+	SetDiskUsageHook(hook DiskUsageHook)
+
+	// ListByAccessTime returns the sizes of files in state, least recently
+	// accessed first. Like DiskUsage, only files loaded into memory are
+	// listed, and nothing is read from disk.
+	ListByAccessTime(state FileState) []FileUsage
+
+	// SetOpHook registers hook to be called after every FileOp operation,
+	// e.g. to export latency metrics.
+	SetOpHook(hook OpHook)
+
+	// ListNames returns the names of all files in state.
+	ListNames(state FileState) ([]string, error)
+
+	// Walk calls fn for every file in state, loading each into memory if
+	// needed. Files deleted during the walk are skipped. Stops and returns the
+	// first error from fn.
+	Walk(state FileState, fn func(name string, info os.FileInfo) error) error
+
+	// Find returns the names of files with metadata of type md for which
+	// predicate returns true, without reading from disk. Only metadata types
+	// listed in LRUConfig.IndexedMetadata can be queried, and only files
+	// loaded into memory, e.g. by Walk, are considered.
+	Find(md metadata.Metadata, predicate func(name string, md metadata.Metadata) bool) ([]string, error)
+
+	// Close stops background goroutines and persists pending last access
+	// time updates.
+	Close()
 }
 
 // localFileStore manages all agent files on local disk.
 type localFileStore struct {
 	fileEntryFactory FileEntryFactory
 	fileMap          FileMap
+	usage            *diskUsage
+	refs             *refCounter
+	index            *metadataIndex
+	trash            *Trash
+	opHook           atomic.Pointer[OpHook]
 }
 
-// NewLocalFileStore initializes and returns a new FileStore.
-func NewLocalFileStore(clk clock.Clock) FileStore {
-	m := NewLATFileMap(clk)
+// OpHook is called with the name, latency and result of a FileOp operation.
+type OpHook func(operation string, latency time.Duration, err error)
+
+// LRUConfig defines the limits, replacement policy, durability and encryption
+// of a LRU FileStore.
+type LRUConfig struct {
+	// Max number of entries. 0 means no limit.
+	Size int
+	// Max total bytes of entries. 0 means no limit.
+	MaxBytes int64
+	// Defaults to PolicyLRU.
+	Policy ReplacementPolicy
+	// If set, last access time updates are persisted in batches at most once
+	// per interval to limit IO. 0 persists every update immediately.
+	LATFlushInterval time.Duration
+	// Which writes are fsync'ed. Defaults to DurabilityNone.
+	Durability Durability
+	// If set, content of newly created files is encrypted at rest.
+	Cipher *Cipher
+	// If set, deleted files are moved into Trash instead of being removed.
+	// Evicted files are always removed.
+	Trash *Trash
+	// Suffixes of metadata types to index in memory for Find. Last access
+	// time is updated by the store itself and cannot be indexed.
+	IndexedMetadata []string
+}
+
+// newLocalFileStore creates a localFileStore backed by an LRU map with given
+// limits. Zero config disables eviction.
+func newLocalFileStore(factory FileEntryFactory, config LRUConfig, clk clock.Clock) *localFileStore {
+	usage := newDiskUsage()
+	index := newMetadataIndex(config.IndexedMetadata)
+	m := newLRUFileMap(config.Size, clk, func(name string) {
+		usage.remove(name)
+		index.remove(name)
+	})
+	refs := newRefCounter()
+	m.inUse = func(name string, fe FileEntry) bool {
+		return refs.get(name, fe) > 0
+	}
+	m.inUseLocally = func(name string) bool {
+		return refs.getLocal(name) > 0
+	}
+	if config.MaxBytes > 0 {
+		m.maxBytes = config.MaxBytes
+		m.usedBytes = usage.getTotal
+		usage.afterSet = m.evictIfNeeded
+	}
+	if config.Policy != "" {
+		m.policy = config.Policy
+	}
+	m.flushInterval = config.LATFlushInterval
+	m.start()
 	return &localFileStore{
-		fileEntryFactory: NewLocalFileEntryFactory(),
+		fileEntryFactory: factory,
 		fileMap:          m,
+		usage:            usage,
+		refs:             refs,
+		index:            index,
+		trash:            config.Trash,
+	}
+}
+
+// Close stops background goroutines and persists pending last access time
+// updates.
+func (s *localFileStore) Close() {
+	if m, ok := s.fileMap.(*lruFileMap); ok {
+		m.stop()
 	}
 }
 
+// NewLocalFileStore initializes and returns a new FileStore.
+func NewLocalFileStore(clk clock.Clock) FileStore {
+	return newLocalFileStore(NewLocalFileEntryFactory(), LRUConfig{}, clk)
+}
+
 // NewCASFileStore initializes and returns a new Content-Addressable FileStore.
 // It uses the first few bytes of file digest (which is also used as file name)
 // as shard ID.
 // For every byte, one more level of directories will be created.
 func NewCASFileStore(clk clock.Clock) FileStore {
-	m := NewLATFileMap(clk)
-	return &localFileStore{
-		fileEntryFactory: NewCASFileEntryFactory(),
-		fileMap:          m,
-	}
+	return newLocalFileStore(NewCASFileEntryFactory(), LRUConfig{}, clk)
 }
 
 // NewLRUFileStore initializes and returns a new LRU FileStore.
 // When size exceeds limit, the least recently accessed entry will be removed.
 func NewLRUFileStore(size int, clk clock.Clock) FileStore {
-	m := NewLRUFileMap(size, clk)
-	return &localFileStore{
-		fileEntryFactory: NewLocalFileEntryFactory(),
-		fileMap:          m,
-	}
+	return newLocalFileStore(NewLocalFileEntryFactory(), LRUConfig{Size: size}, clk)
 }
 
 // NewCASFileStoreWithLRUMap initializes and returns a new Content-Addressable
@@ -66,14 +170,97 @@ func NewLRUFileStore(size int, clk clock.Clock) FileStore {
 // objects in a LRU FileStore.
 // When size exceeds limit, the least recently accessed entry will be removed.
 func NewCASFileStoreWithLRUMap(size int, clk clock.Clock) FileStore {
-	m := NewLRUFileMap(size, clk)
-	return &localFileStore{
-		fileEntryFactory: NewCASFileEntryFactory(),
-		fileMap:          m,
-	}
+	return newLocalFileStore(NewCASFileEntryFactory(), LRUConfig{Size: size}, clk)
+}
+
+// NewSizeLRUFileStore initializes and returns a new LRU FileStore which is
+// limited by the total bytes of its files instead of the number of entries.
+// When total size exceeds maxBytes, least recently accessed entries will be
+// removed until it no longer does.
+func NewSizeLRUFileStore(maxBytes int64, clk clock.Clock) FileStore {
+	return newLocalFileStore(NewLocalFileEntryFactory(), LRUConfig{MaxBytes: maxBytes}, clk)
+}
+
+// NewCASFileStoreWithLRUConfig initializes and returns a new
+// Content-Addressable FileStore, which stores objects in a LRU map with the
+// limits and replacement policy in config.
+func NewCASFileStoreWithLRUConfig(config LRUConfig, clk clock.Clock) FileStore {
+	factory := &casFileEntryFactory{durability: config.Durability, cipher: config.Cipher}
+	return newLocalFileStore(factory, config, clk)
+}
+
+// NewLocalFileStoreWithLRUConfig initializes and returns a new FileStore,
+// which stores objects in a LRU map with the limits and replacement policy in
+// config.
+func NewLocalFileStoreWithLRUConfig(config LRUConfig, clk clock.Clock) FileStore {
+	factory := &localFileEntryFactory{durability: config.Durability, cipher: config.Cipher}
+	return newLocalFileStore(factory, config, clk)
 }
 
 // NewFileOp contructs a new FileOp object.
 func (s *localFileStore) NewFileOp() FileOp {
 	return NewLocalFileOp(s)
 }
+
+// DiskUsage returns the number of bytes used by files in state. Only files
+// which have been loaded into memory, i.e. created or accessed since startup,
+// are accounted for.
+func (s *localFileStore) DiskUsage(state FileState) int64 {
+	return s.usage.get(state)
+}
+
+// SetDiskUsageHook registers hook to be called whenever usage of a state
+// changes.
+func (s *localFileStore) SetDiskUsageHook(hook DiskUsageHook) {
+	s.usage.setHook(hook)
+}
+
+// ListByAccessTime returns the sizes of files in state, least recently
+// accessed first.
+func (s *localFileStore) ListByAccessTime(state FileState) []FileUsage {
+	m, ok := s.fileMap.(*lruFileMap)
+	if !ok {
+		return nil
+	}
+	var files []FileUsage
+	for _, name := range m.namesByAccessTime() {
+		if size, ok := s.usage.lookup(name, state); ok {
+			files = append(files, FileUsage{name, size})
+		}
+	}
+	return files
+}
+
+// SetOpHook registers hook to be called after every FileOp operation.
+func (s *localFileStore) SetOpHook(hook OpHook) {
+	s.opHook.Store(&hook)
+}
+
+// ListNames returns the names of all files in state.
+func (s *localFileStore) ListNames(state FileState) ([]string, error) {
+	return s.fileEntryFactory.ListNames(state)
+}
+
+// Walk calls fn for every file in state. It streams names from disk, so
+// callers can enumerate large states without listing every name upfront.
+func (s *localFileStore) Walk(state FileState, fn func(name string, info os.FileInfo) error) error {
+	return s.fileEntryFactory.WalkNames(state, func(name string) error {
+		info, err := s.NewFileOp().AcceptState(state).GetFileStat(name)
+		if err != nil {
+			// File was deleted or moved since it was listed.
+			if os.IsNotExist(err) || IsFileStateError(err) {
+				return nil
+			}
+			return err
+		}
+		return fn(name, info)
+	})
+}
+
+// Find returns the names of files with indexed metadata of type md for which
+// predicate returns true.
+func (s *localFileStore) Find(
+	md metadata.Metadata, predicate func(name string, md metadata.Metadata) bool) ([]string, error) {
+
+	return s.index.find(md, predicate)
+}
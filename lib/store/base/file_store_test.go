@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestFileStoreWalk(t *testing.T) {
+	require := require.New(t)
+
+	bundle, cleanup := fileStoreCASFixture()
+	defer cleanup()
+
+	store := bundle.store
+	state := bundle.state2
+
+	expected := map[string]int64{}
+	for i := 0; i < 10; i++ {
+		name := core.DigestFixture().Hex()
+		require.NoError(store.NewFileOp().CreateFile(name, state, int64(i)))
+		expected[name] = int64(i)
+	}
+
+	names, err := store.ListNames(state)
+	require.NoError(err)
+	require.Len(names, len(expected))
+
+	// Recreate store so entries must be reloaded from disk.
+	bundle.recreateStore()
+	store = bundle.store
+
+	walked := map[string]int64{}
+	require.NoError(store.Walk(state, func(name string, info os.FileInfo) error {
+		walked[name] = info.Size()
+		return nil
+	}))
+	require.Equal(expected, walked)
+
+	// Walk stops on first error.
+	stopErr := errors.New("stop")
+	var count int
+	require.Equal(stopErr, store.Walk(state, func(name string, info os.FileInfo) error {
+		count++
+		return stopErr
+	}))
+	require.Equal(1, count)
+}
+
+func TestFileStoreListByAccessTime(t *testing.T) {
+	require := require.New(t)
+
+	bundle, cleanup := fileStoreDefaultFixture()
+	defer cleanup()
+
+	store := bundle.store
+	op := store.NewFileOp()
+
+	// Delete the file created by the fixture.
+	require.NoError(op.AcceptState(bundle.state1).DeleteFile(bundle.files[bundle.state1]))
+
+	require.NoError(op.CreateFile("a", bundle.state1, 1))
+	require.NoError(op.CreateFile("b", bundle.state1, 2))
+	require.NoError(op.CreateFile("c", bundle.state1, 3))
+	require.NoError(op.CreateFile("other", bundle.state2, 4))
+
+	r, err := op.AcceptState(bundle.state1).GetFileReader("a", 0)
+	require.NoError(err)
+	require.NoError(r.Close())
+
+	require.Equal(
+		[]FileUsage{{"b", 2}, {"c", 3}, {"a", 1}},
+		store.ListByAccessTime(bundle.state1))
+
+	require.NoError(op.AcceptState(bundle.state1).DeleteFile("c"))
+	require.Equal(
+		[]FileUsage{{"b", 2}, {"a", 1}},
+		store.ListByAccessTime(bundle.state1))
+}
+
+func TestDurabilityUnmarshalYAML(t *testing.T) {
+	for _, d := range []Durability{DurabilityNone, DurabilityMetadata, DurabilityAlways} {
+		var result Durability
+		require.NoError(t, yaml.Unmarshal([]byte(d), &result))
+		require.Equal(t, d, result)
+	}
+
+	var result Durability
+	require.Error(t, yaml.Unmarshal([]byte("sometimes"), &result))
+}
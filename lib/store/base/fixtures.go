@@ -166,6 +166,28 @@ func fileStoreLRUFixture(size int) (*fileStoreTestBundle, func()) {
 	})
 }
 
+func fileStoreSizeLRUFixture(maxBytes int64) (*fileStoreTestBundle, func()) {
+	return fileStoreFixture(func(clk clock.Clock) *localFileStore {
+		store := NewSizeLRUFileStore(maxBytes, clk)
+		localStore, ok := store.(*localFileStore)
+		if !ok {
+			panic(fmt.Sprintf("expected *localFileStore, got %T", store))
+		}
+		return localStore
+	})
+}
+
+func fileStoreDurableFixture() (*fileStoreTestBundle, func()) {
+	return fileStoreFixture(func(clk clock.Clock) *localFileStore {
+		store := NewCASFileStoreWithLRUConfig(LRUConfig{Durability: DurabilityAlways}, clk)
+		localStore, ok := store.(*localFileStore)
+		if !ok {
+			panic(fmt.Sprintf("expected *localFileStore, got %T", store))
+		}
+		return localStore
+	})
+}
+
 func fileStoreFixture(
 	createStore func(clk clock.Clock) *localFileStore) (*fileStoreTestBundle, func()) {
 
@@ -0,0 +1,43 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package base
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// _canSyncDir is true if directories can be fsync'ed to persist entries.
+const _canSyncDir = true
+
+// linkFile creates a hardlink at dst to src.
+func linkFile(src, dst string) error {
+	return os.Link(src, dst)
+}
+
+// foldCase returns the on-disk form of a CAS path component. Filesystems are
+// assumed case-sensitive.
+func foldCase(s string) string {
+	return s
+}
+
+// isCrossDeviceError returns true if err is caused by renaming across
+// filesystems.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package base
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// _canSyncDir is false since windows does not support fsync'ing directories.
+// Renames are persisted by the filesystem journal instead.
+const _canSyncDir = false
+
+// linkFile creates a hardlink at dst to src. Falls back to copying src, since
+// not every windows filesystem supports hardlinks.
+func linkFile(src, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+	return copyFile(src, dst, false)
+}
+
+// foldCase returns the on-disk form of a CAS path component. Windows
+// filesystems are case-insensitive, so paths are lowercased to keep digests
+// which only differ in case in the same directory.
+func foldCase(s string) string {
+	return strings.ToLower(s)
+}
+
+// isCrossDeviceError returns true if err is caused by renaming across
+// volumes.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+// ErrMetadataNotIndexed is returned by Find for metadata types which are not
+// indexed by the store.
+var ErrMetadataNotIndexed = errors.New("metadata is not indexed")
+
+// metadataIndex maintains the content of selected metadata types per file, so
+// files can be queried by metadata without reading every metadata file from
+// disk. Only files loaded into memory are indexed.
+type metadataIndex struct {
+	sync.RWMutex
+
+	// Suffix -> name -> serialized metadata.
+	values map[string]map[string][]byte
+}
+
+func newMetadataIndex(suffixes []string) *metadataIndex {
+	values := make(map[string]map[string][]byte)
+	for _, suffix := range suffixes {
+		values[suffix] = make(map[string][]byte)
+	}
+	return &metadataIndex{values: values}
+}
+
+func (idx *metadataIndex) indexed(suffix string) bool {
+	_, ok := idx.values[suffix]
+	return ok
+}
+
+// set records md of name, if its type is indexed.
+func (idx *metadataIndex) set(name string, md metadata.Metadata) {
+	if !idx.indexed(md.GetSuffix()) {
+		return
+	}
+	b, err := md.Serialize()
+	if err != nil {
+		return
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.values[md.GetSuffix()][name] = b
+}
+
+// unset drops metadata of type md of name.
+func (idx *metadataIndex) unset(name string, md metadata.Metadata) {
+	if !idx.indexed(md.GetSuffix()) {
+		return
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+
+	delete(idx.values[md.GetSuffix()], name)
+}
+
+// load re-reads all indexed metadata of name from entry. Must be called with
+// the entry locked.
+func (idx *metadataIndex) load(name string, entry FileEntry) {
+	if len(idx.values) == 0 {
+		return
+	}
+	loaded := make(map[string][]byte)
+	for suffix := range idx.values {
+		md := metadata.CreateFromSuffix(suffix)
+		if md == nil {
+			continue
+		}
+		if err := entry.GetMetadata(md); err != nil {
+			continue
+		}
+		b, err := md.Serialize()
+		if err != nil {
+			continue
+		}
+		loaded[suffix] = b
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+
+	for suffix, values := range idx.values {
+		if b, ok := loaded[suffix]; ok {
+			values[name] = b
+		} else {
+			delete(values, name)
+		}
+	}
+}
+
+// remove drops all metadata of name.
+func (idx *metadataIndex) remove(name string) {
+	if len(idx.values) == 0 {
+		return
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+
+	for _, values := range idx.values {
+		delete(values, name)
+	}
+}
+
+// find returns the names of files with metadata of type md for which predicate
+// returns true.
+func (idx *metadataIndex) find(
+	md metadata.Metadata, predicate func(name string, md metadata.Metadata) bool) ([]string, error) {
+
+	suffix := md.GetSuffix()
+	if !idx.indexed(suffix) {
+		return nil, ErrMetadataNotIndexed
+	}
+
+	// Copy so predicate runs without holding the lock.
+	idx.RLock()
+	values := make(map[string][]byte, len(idx.values[suffix]))
+	for name, b := range idx.values[suffix] {
+		values[name] = b
+	}
+	idx.RUnlock()
+
+	var names []string
+	for name, b := range values {
+		md := metadata.CreateFromSuffix(suffix)
+		if md == nil {
+			return nil, fmt.Errorf("no metadata factory for suffix %s", suffix)
+		}
+		if err := md.Deserialize(b); err != nil {
+			continue
+		}
+		if predicate(name, md) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func isPersisted(name string, md metadata.Metadata) bool {
+	return md.(*metadata.Persist).Value
+}
+
+func TestFindIndexedMetadata(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	suffix := metadata.NewPersist(false).GetSuffix()
+	config := LRUConfig{IndexedMetadata: []string{suffix}}
+	store := NewCASFileStoreWithLRUConfig(config, clock.New())
+
+	names := []string{core.DigestFixture().Hex(), core.DigestFixture().Hex(), core.DigestFixture().Hex()}
+	for _, name := range names {
+		require.NoError(store.NewFileOp().CreateFile(name, state, 0))
+	}
+	op := store.NewFileOp().AcceptState(state)
+	_, err := op.SetFileMetadata(names[0], metadata.NewPersist(true))
+	require.NoError(err)
+	_, err = op.SetFileMetadata(names[1], metadata.NewPersist(true))
+	require.NoError(err)
+	_, err = op.SetFileMetadata(names[2], metadata.NewPersist(false))
+	require.NoError(err)
+
+	found, err := store.Find(metadata.NewPersist(false), isPersisted)
+	require.NoError(err)
+	expected := []string{names[0], names[1]}
+	sort.Strings(expected)
+	sort.Strings(found)
+	require.Equal(expected, found)
+
+	require.NoError(op.DeleteFileMetadata(names[0], metadata.NewPersist(false)))
+	_, err = op.SetFileMetadata(names[1], metadata.NewPersist(false))
+	require.NoError(err)
+	found, err = store.Find(metadata.NewPersist(false), isPersisted)
+	require.NoError(err)
+	require.Empty(found)
+
+	_, err = op.SetFileMetadata(names[2], metadata.NewPersist(true))
+	require.NoError(err)
+	found, err = store.Find(metadata.NewPersist(false), isPersisted)
+	require.NoError(err)
+	require.Equal([]string{names[2]}, found)
+
+	// Files loaded from disk are indexed.
+	reloaded := NewCASFileStoreWithLRUConfig(config, clock.New())
+	require.NoError(reloaded.Walk(state, func(string, os.FileInfo) error { return nil }))
+	found, err = reloaded.Find(metadata.NewPersist(false), isPersisted)
+	require.NoError(err)
+	require.Equal([]string{names[2]}, found)
+
+	// Deleted files are dropped from the index.
+	require.NoError(op.DeleteFile(names[1]))
+	found, err = store.Find(metadata.NewPersist(false), func(string, metadata.Metadata) bool {
+		return true
+	})
+	require.NoError(err)
+	require.Equal([]string{names[2]}, found)
+}
+
+func TestFindMetadataNotIndexed(t *testing.T) {
+	require := require.New(t)
+
+	store := NewCASFileStore(clock.New())
+	_, err := store.Find(metadata.NewPersist(false), isPersisted)
+	require.Equal(ErrMetadataNotIndexed, err)
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+const (
+	// _metadataTxnTmpDir holds metadata of a transaction still being written.
+	// It is discarded on reload.
+	_metadataTxnTmpDir = ".txn.tmp"
+	// _metadataTxnDir holds metadata of a committed transaction which has not
+	// been fully applied yet. It is rolled forward on reload.
+	_metadataTxnDir = ".txn"
+	// _metadataTxnDeletes lists suffixes of metadata deleted by a transaction.
+	_metadataTxnDeletes = ".deletes"
+)
+
+// MetadataTxn collects metadata changes which are applied to a file all
+// together or not at all.
+type MetadataTxn struct {
+	sets    []metadata.Metadata
+	deletes []metadata.Metadata
+}
+
+// Set creates or overwrites md as part of the transaction.
+func (txn *MetadataTxn) Set(md metadata.Metadata) {
+	txn.sets = append(txn.sets, md)
+}
+
+// Delete deletes metadata of md's type as part of the transaction.
+func (txn *MetadataTxn) Delete(md metadata.Metadata) {
+	txn.deletes = append(txn.deletes, md)
+}
+
+// CommitMetadataTxn applies all changes in txn atomically. Changes are first
+// written into a temporary directory, which is renamed to mark the transaction
+// as committed before its content is moved in place. A crash before the rename
+// discards the transaction, a crash after it is rolled forward by Reload.
+func (entry *localFileEntry) CommitMetadataTxn(txn *MetadataTxn) error {
+	dir := filepath.Dir(entry.GetPath())
+	tmpDir := filepath.Join(dir, _metadataTxnTmpDir)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return fmt.Errorf("remove stale txn: %s", err)
+	}
+	if err := os.MkdirAll(tmpDir, DefaultDirPermission); err != nil {
+		return err
+	}
+	for _, md := range txn.sets {
+		b, err := md.Serialize()
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return fmt.Errorf("marshal metadata: %s", err)
+		}
+		if err := writeFile(filepath.Join(tmpDir, md.GetSuffix()), b, entry.durability.syncMetadata()); err != nil {
+			os.RemoveAll(tmpDir)
+			return err
+		}
+	}
+	var deletes bytes.Buffer
+	for _, md := range txn.deletes {
+		fmt.Fprintln(&deletes, md.GetSuffix())
+	}
+	if err := writeFile(filepath.Join(tmpDir, _metadataTxnDeletes), deletes.Bytes(), entry.durability.syncMetadata()); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if entry.durability.syncMetadata() {
+		if err := syncPath(tmpDir); err != nil {
+			os.RemoveAll(tmpDir)
+			return fmt.Errorf("sync txn: %s", err)
+		}
+	}
+
+	// Commit point.
+	if err := os.Rename(tmpDir, filepath.Join(dir, _metadataTxnDir)); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("commit txn: %s", err)
+	}
+	if entry.durability.syncMetadata() {
+		if err := syncPath(dir); err != nil {
+			return fmt.Errorf("sync commit: %s", err)
+		}
+	}
+	return entry.applyMetadataTxn()
+}
+
+// recoverMetadataTxn discards uncommitted transactions and rolls forward
+// committed ones left behind by a crash.
+func (entry *localFileEntry) recoverMetadataTxn() error {
+	dir := filepath.Dir(entry.GetPath())
+	if err := os.RemoveAll(filepath.Join(dir, _metadataTxnTmpDir)); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, _metadataTxnDir)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return entry.applyMetadataTxn()
+}
+
+// applyMetadataTxn moves content of a committed transaction in place. It is
+// idempotent, so it can be safely retried after a crash.
+func (entry *localFileEntry) applyMetadataTxn() error {
+	dir := filepath.Dir(entry.GetPath())
+	txnDir := filepath.Join(dir, _metadataTxnDir)
+
+	b, err := os.ReadFile(filepath.Join(txnDir, _metadataTxnDeletes))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		suffix := strings.TrimSpace(scanner.Text())
+		if suffix == "" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, suffix)); err != nil {
+			return err
+		}
+		entry.removeMetadata(suffix)
+	}
+
+	files, err := os.ReadDir(txnDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, f := range files {
+		if f.Name() == _metadataTxnDeletes {
+			continue
+		}
+		if err := os.Rename(filepath.Join(txnDir, f.Name()), filepath.Join(dir, f.Name())); err != nil {
+			return err
+		}
+		entry.addMetadata(f.Name())
+	}
+	if entry.durability.syncMetadata() {
+		if err := syncPath(dir); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(txnDir)
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"io"
+	"sync"
+)
+
+// BufferPool pools fixed size buffers used to read files ahead.
+type BufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewBufferPool creates a new BufferPool of buffers of size bytes.
+func NewBufferPool(size int) *BufferPool {
+	p := &BufferPool{size: size}
+	p.pool.New = func() interface{} {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+func (p *BufferPool) get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+func (p *BufferPool) put(b []byte) {
+	p.pool.Put(&b)
+}
+
+// readaheadWindow is a range of a file which is being or has been read into
+// buf. n and err must not be accessed before done is closed.
+type readaheadWindow struct {
+	offset int64
+	buf    []byte
+	n      int
+	err    error
+	done   chan struct{}
+}
+
+func (w *readaheadWindow) covers(offset int64) bool {
+	return offset >= w.offset && offset < w.offset+int64(len(w.buf))
+}
+
+// readahead serves reads from a window of the file prefetched in the
+// background, starting where the previous read ended. Pieces are read in
+// chunks, so the next chunk is read from disk while the previous one is being
+// sent, instead of after.
+type readahead struct {
+	r    io.ReaderAt
+	pool *BufferPool
+
+	// Offset of Read and Write calls, which like those of the underlying
+	// file are not safe for concurrent use.
+	offset int64
+
+	mu     sync.Mutex
+	window *readaheadWindow
+	closed bool
+}
+
+func newReadahead(r io.ReaderAt, pool *BufferPool) *readahead {
+	return &readahead{r: r, pool: pool}
+}
+
+func (ra *readahead) readAt(p []byte, offset int64) (int, error) {
+	end := offset + int64(len(p))
+
+	ra.mu.Lock()
+	w := ra.window
+	ra.mu.Unlock()
+
+	if w != nil && w.covers(offset) && end <= w.offset+int64(len(w.buf)) {
+		<-w.done
+		ra.mu.Lock()
+		if ra.window == w && end <= w.offset+int64(w.n) && (w.err == nil || w.err == io.EOF) {
+			n := copy(p, w.buf[offset-w.offset:])
+			ra.mu.Unlock()
+			ra.prefetch(end)
+			return n, nil
+		}
+		ra.mu.Unlock()
+	}
+
+	n, err := ra.r.ReadAt(p, offset)
+	if err == nil {
+		ra.prefetch(end)
+	}
+	return n, err
+}
+
+// read reads up to len(p) bytes at the current offset.
+func (ra *readahead) read(p []byte) (int, error) {
+	n, err := ra.readAt(p, ra.offset)
+	ra.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// seek sets the current offset, keeping the offset of s in sync.
+func (ra *readahead) seek(s io.Seeker, offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent {
+		offset, whence = ra.offset+offset, io.SeekStart
+	}
+	offset, err := s.Seek(offset, whence)
+	if err != nil {
+		return offset, err
+	}
+	ra.offset = offset
+	return offset, nil
+}
+
+// prefetch starts reading the window at offset, unless the current window
+// already covers it.
+func (ra *readahead) prefetch(offset int64) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	if ra.closed || (ra.window != nil && ra.window.covers(offset)) {
+		return
+	}
+	ra.releaseLocked()
+
+	w := &readaheadWindow{
+		offset: offset,
+		buf:    ra.pool.get(),
+		done:   make(chan struct{}),
+	}
+	ra.window = w
+	go func() {
+		w.n, w.err = ra.r.ReadAt(w.buf, w.offset)
+		close(w.done)
+	}()
+}
+
+// invalidate drops the current window, e.g. after the file was written to.
+func (ra *readahead) invalidate() {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	ra.releaseLocked()
+}
+
+// releaseLocked returns the buffer of the current window to the pool once its
+// read completes.
+func (ra *readahead) releaseLocked() {
+	if ra.window == nil {
+		return
+	}
+	w := ra.window
+	ra.window = nil
+	go func() {
+		<-w.done
+		ra.pool.put(w.buf)
+	}()
+}
+
+// close stops prefetching and waits for the in-flight read, so the underlying
+// file can be closed safely.
+func (ra *readahead) close() {
+	ra.mu.Lock()
+	w := ra.window
+	ra.window = nil
+	ra.closed = true
+	ra.mu.Unlock()
+
+	if w != nil {
+		<-w.done
+		ra.pool.put(w.buf)
+	}
+}
+
+// readaheadReader wraps a FileReader with readahead of reads.
+type readaheadReader struct {
+	FileReader
+	ra *readahead
+}
+
+func newReadaheadReader(r FileReader, pool *BufferPool) *readaheadReader {
+	return &readaheadReader{r, newReadahead(r, pool)}
+}
+
+// Read reads up to len(p) bytes, from the prefetched window if possible.
+func (r *readaheadReader) Read(p []byte) (int, error) {
+	return r.ra.read(p)
+}
+
+// ReadAt reads len(p) bytes at offset, from the prefetched window if possible.
+func (r *readaheadReader) ReadAt(p []byte, offset int64) (int, error) {
+	return r.ra.readAt(p, offset)
+}
+
+// Seek sets the offset for the next Read.
+func (r *readaheadReader) Seek(offset int64, whence int) (int64, error) {
+	return r.ra.seek(r.FileReader, offset, whence)
+}
+
+// Close closes the underlying reader.
+func (r *readaheadReader) Close() error {
+	r.ra.close()
+	return r.FileReader.Close()
+}
+
+// readaheadReadWriter wraps a FileReadWriter with readahead of reads. Writes
+// drop the prefetched window.
+type readaheadReadWriter struct {
+	FileReadWriter
+	ra *readahead
+}
+
+func newReadaheadReadWriter(w FileReadWriter, pool *BufferPool) *readaheadReadWriter {
+	return &readaheadReadWriter{w, newReadahead(w, pool)}
+}
+
+// Read reads up to len(p) bytes, from the prefetched window if possible.
+func (w *readaheadReadWriter) Read(p []byte) (int, error) {
+	return w.ra.read(p)
+}
+
+// ReadAt reads len(p) bytes at offset, from the prefetched window if possible.
+func (w *readaheadReadWriter) ReadAt(p []byte, offset int64) (int, error) {
+	return w.ra.readAt(p, offset)
+}
+
+// Seek sets the offset for the next Read or Write.
+func (w *readaheadReadWriter) Seek(offset int64, whence int) (int64, error) {
+	return w.ra.seek(w.FileReadWriter, offset, whence)
+}
+
+// Write writes p at the current offset.
+func (w *readaheadReadWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteAt(p, w.ra.offset)
+	w.ra.offset += int64(n)
+	return n, err
+}
+
+// WriteAt writes p at offset to the underlying writer.
+func (w *readaheadReadWriter) WriteAt(p []byte, offset int64) (int, error) {
+	// Invalidate after writing, so windows prefetched concurrently are
+	// dropped as well.
+	defer w.ra.invalidate()
+	return w.FileReadWriter.WriteAt(p, offset)
+}
+
+// Close closes the underlying writer.
+func (w *readaheadReadWriter) Close() error {
+	w.ra.close()
+	return w.FileReadWriter.Close()
+}
+
+// Cancel cancels the underlying writer.
+func (w *readaheadReadWriter) Cancel() error {
+	w.ra.close()
+	return w.FileReadWriter.Cancel()
+}
+
+// Commit commits the underlying writer.
+func (w *readaheadReadWriter) Commit() error {
+	w.ra.close()
+	return w.FileReadWriter.Commit()
+}
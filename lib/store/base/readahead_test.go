@@ -0,0 +1,139 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowReadWriter adds latency to every ReadAt, like a slow disk.
+type slowReadWriter struct {
+	FileReadWriter
+	latency time.Duration
+}
+
+func (w *slowReadWriter) ReadAt(p []byte, offset int64) (int, error) {
+	time.Sleep(w.latency)
+	return w.FileReadWriter.ReadAt(p, offset)
+}
+
+func bufferFixture(b []byte) *BufferReadWriter {
+	w := NewBufferReadWriter(uint64(len(b)))
+	if _, err := w.WriteAt(b, 0); err != nil {
+		panic(err)
+	}
+	return w
+}
+
+func TestReadaheadReaderRead(t *testing.T) {
+	require := require.New(t)
+
+	data := randutil.Text(10000)
+	r := newReadaheadReader(bufferFixture(data), NewBufferPool(1024))
+	defer r.Close()
+
+	_, err := r.Seek(100, io.SeekStart)
+	require.NoError(err)
+
+	var out bytes.Buffer
+	_, err = io.CopyBuffer(&out, r, make([]byte, 300))
+	require.NoError(err)
+	require.Equal(data[100:], out.Bytes())
+}
+
+func TestReadaheadReaderReadAt(t *testing.T) {
+	require := require.New(t)
+
+	data := randutil.Text(10000)
+	r := newReadaheadReader(bufferFixture(data), NewBufferPool(1024))
+	defer r.Close()
+
+	for _, offset := range []int64{0, 500, 1000, 5000, 5500, 200, 9500} {
+		p := make([]byte, 500)
+		n, err := r.ReadAt(p, offset)
+		require.NoError(err)
+		require.Equal(500, n)
+		require.Equal(data[offset:offset+500], p)
+	}
+
+	// Reads past the end return EOF.
+	p := make([]byte, 1000)
+	n, err := r.ReadAt(p, 9500)
+	require.Equal(io.EOF, err)
+	require.Equal(500, n)
+	require.Equal(data[9500:], p[:n])
+}
+
+func TestReadaheadReadWriterWriteDropsWindow(t *testing.T) {
+	require := require.New(t)
+
+	data := randutil.Text(4096)
+	w := newReadaheadReadWriter(bufferFixture(data), NewBufferPool(1024))
+	defer w.Close()
+
+	// Prefetches [512, 1536).
+	p := make([]byte, 512)
+	_, err := w.ReadAt(p, 0)
+	require.NoError(err)
+	<-w.ra.window.done
+
+	update := bytes.Repeat([]byte("x"), 512)
+	_, err = w.WriteAt(update, 512)
+	require.NoError(err)
+
+	_, err = w.ReadAt(p, 512)
+	require.NoError(err)
+	require.Equal(update, p)
+}
+
+func benchmarkPieceRead(b *testing.B, pool *BufferPool) {
+	const (
+		chunkSize = 16 * 1024
+		size      = 64 * chunkSize
+		latency   = 200 * time.Microsecond
+	)
+	data := randutil.Text(size)
+	chunk := make([]byte, chunkSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var r FileReader = &slowReadWriter{bufferFixture(data), latency}
+		if pool != nil {
+			r = newReadaheadReader(r, pool)
+		}
+		for offset := int64(0); offset < size; offset += chunkSize {
+			if _, err := r.ReadAt(chunk, offset); err != nil {
+				b.Fatal(err)
+			}
+			// Sending the chunk to a peer.
+			time.Sleep(latency)
+		}
+		r.Close()
+	}
+}
+
+func BenchmarkPieceReadUnbuffered(b *testing.B) {
+	benchmarkPieceRead(b, nil)
+}
+
+func BenchmarkPieceReadReadahead(b *testing.B) {
+	benchmarkPieceRead(b, NewBufferPool(256*1024))
+}
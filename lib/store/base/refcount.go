@@ -0,0 +1,210 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+)
+
+// fileRefs counts the open readers and writers of one file.
+type fileRefs struct {
+	n     int
+	entry FileEntry
+}
+
+// _numPersistLocks is the number of locks serializing persisting ref counts.
+const _numPersistLocks = 64
+
+// refCounter tracks open readers and writers per file name, so deletes and
+// eviction can be deferred while a file is in use. Counts of this process are
+// kept in memory. Whether this process holds any reference to a file is
+// persisted as metadata.RefCount when its count changes between zero and one,
+// so it is visible to other processes sharing the store directory. Persisted
+// counts of processes which are no longer running, including previous runs of
+// this one, are ignored.
+type refCounter struct {
+	sync.Mutex
+
+	pid  int
+	refs map[string]*fileRefs
+
+	// persistLocks serialize persisting the counts of the same name, outside
+	// of the lock of the refCounter.
+	persistLocks [_numPersistLocks]sync.Mutex
+}
+
+func newRefCounter() *refCounter {
+	return &refCounter{pid: os.Getpid(), refs: make(map[string]*fileRefs)}
+}
+
+// acquire increments the count of name and returns a function which
+// decrements it. Calling release more than once has no effect.
+func (c *refCounter) acquire(name string, entry FileEntry) (release func()) {
+	c.Lock()
+	r, ok := c.refs[name]
+	if !ok {
+		r = &fileRefs{}
+		c.refs[name] = r
+	}
+	r.n++
+	r.entry = entry
+	first := r.n == 1
+	c.Unlock()
+
+	if first {
+		c.persist(name, entry)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.Lock()
+			r.n--
+			// r may have been dropped, and name re-acquired since.
+			last := r.n == 0 && c.refs[name] == r
+			if last {
+				delete(c.refs, name)
+			}
+			c.Unlock()
+
+			if last {
+				c.persist(name, r.entry)
+			}
+		})
+	}
+}
+
+// persist writes whether this process holds any reference to name to disk.
+// The current count is read with the persist lock of name held, so the last
+// call persists the latest count even if calls for the same name race.
+func (c *refCounter) persist(name string, entry FileEntry) {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	l := &c.persistLocks[h.Sum32()%_numPersistLocks]
+	l.Lock()
+	defer l.Unlock()
+
+	c.Lock()
+	r, ok := c.refs[name]
+	if ok {
+		entry = r.entry
+	}
+	c.Unlock()
+
+	var err error
+	if ok && r.n > 0 {
+		_, err = entry.SetMetadata(metadata.NewRefCount(c.pid, 1))
+	} else {
+		err = entry.DeleteMetadata(metadata.NewRefCount(c.pid, 0))
+	}
+	// The file may have been deleted by another process.
+	if err != nil && !os.IsNotExist(err) {
+		log.With("name", name).Errorf("Error persisting ref count: %s", err)
+	}
+}
+
+// getLocal returns the number of open readers and writers of name in this
+// process. Does no disk I/O.
+func (c *refCounter) getLocal(name string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	if r, ok := c.refs[name]; ok {
+		return r.n
+	}
+	return 0
+}
+
+// get returns the number of open readers and writers of name in this process,
+// plus the persisted counts of all other running processes.
+func (c *refCounter) get(name string, entry FileEntry) int {
+	return c.getLocal(name) + c.getOthers(name, entry)
+}
+
+// getOthers sums the persisted counts of entry held by other processes.
+func (c *refCounter) getOthers(name string, entry FileEntry) int {
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(entry.GetPath()), metadata.RefCountGlob))
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, path := range paths {
+		md, ok := metadata.CreateFromSuffix(filepath.Base(path)).(*metadata.RefCount)
+		if !ok || md.PID == c.pid || !processAlive(md.PID) {
+			continue
+		}
+		if err := entry.GetMetadata(md); err != nil {
+			if !os.IsNotExist(err) {
+				log.With("name", name).Errorf("Error reading ref count: %s", err)
+			}
+			continue
+		}
+		n += md.N
+	}
+	return n
+}
+
+// drop forgets all references of name. Outstanding release functions no
+// longer affect the count of a file re-created under the same name.
+func (c *refCounter) drop(name string) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.refs, name)
+}
+
+// refCountedReader releases its reference once closed.
+type refCountedReader struct {
+	FileReader
+
+	release func()
+}
+
+func (r *refCountedReader) Close() error {
+	defer r.release()
+	return r.FileReader.Close()
+}
+
+func (r *refCountedReader) file() (*os.File, bool) {
+	return directFile(r.FileReader)
+}
+
+// refCountedReadWriter releases its reference once closed, cancelled or
+// committed.
+type refCountedReadWriter struct {
+	FileReadWriter
+
+	release func()
+}
+
+func (rw *refCountedReadWriter) Close() error {
+	defer rw.release()
+	return rw.FileReadWriter.Close()
+}
+
+func (rw *refCountedReadWriter) Cancel() error {
+	defer rw.release()
+	return rw.FileReadWriter.Cancel()
+}
+
+func (rw *refCountedReadWriter) Commit() error {
+	defer rw.release()
+	return rw.FileReadWriter.Commit()
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/lib/store/metadata"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefCountIncludesOtherRunningProcesses(t *testing.T) {
+	require := require.New(t)
+	bundle, cleanup := fileStoreDefaultFixture()
+	defer cleanup()
+
+	op := bundle.store.NewFileOp().AcceptState(bundle.state1)
+	fn := bundle.files[bundle.state1]
+
+	r, err := op.GetFileReader(fn, 0)
+	require.NoError(err)
+	defer r.Close()
+
+	// References of running processes count, those of exited ones do not.
+	_, err = op.SetFileMetadata(fn, metadata.NewRefCount(os.Getppid(), 2))
+	require.NoError(err)
+	_, err = op.SetFileMetadata(fn, metadata.NewRefCount(math.MaxInt32, 5))
+	require.NoError(err)
+
+	refs, err := op.GetFileRefCount(fn)
+	require.NoError(err)
+	require.Equal(3, refs)
+	require.True(IsFileInUseError(op.DeleteIfUnreferenced(fn, false)))
+}
+
+func TestRefCountIsPersisted(t *testing.T) {
+	require := require.New(t)
+	bundle, cleanup := fileStoreDefaultFixture()
+	defer cleanup()
+
+	op := bundle.store.NewFileOp().AcceptState(bundle.state1)
+	fn := bundle.files[bundle.state1]
+
+	r, err := op.GetFileReader(fn, 0)
+	require.NoError(err)
+
+	rc := metadata.NewRefCount(os.Getpid(), 0)
+	require.NoError(op.GetFileMetadata(fn, rc))
+	require.Equal(1, rc.N)
+
+	require.NoError(r.Close())
+	require.True(os.IsNotExist(op.GetFileMetadata(fn, rc)))
+}
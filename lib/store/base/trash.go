@@ -0,0 +1,109 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// Trash holds deleted entries until they are purged. Each trashed entry is a
+// directory named "<escaped name>.<deletion unix nanos>" containing the data
+// file and its metadata, so moving it back into its state directory under its
+// original relative path undeletes it.
+type Trash struct {
+	dir string
+	clk clock.Clock
+}
+
+// TrashedFile is a deleted entry held in Trash.
+type TrashedFile struct {
+	Name      string
+	Path      string
+	DeletedAt time.Time
+}
+
+// NewTrash creates a new Trash under dir.
+func NewTrash(dir string, clk clock.Clock) (*Trash, error) {
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return nil, fmt.Errorf("mkdir: %s", err)
+	}
+	return &Trash{dir, clk}, nil
+}
+
+// put moves the entry directory of name into the trash. If the trash is on a
+// different filesystem, the entry is removed immediately instead.
+func (t *Trash) put(name, entryDir string) error {
+	target := filepath.Join(t.dir, fmt.Sprintf("%s.%d", url.PathEscape(name), t.clk.Now().UnixNano()))
+	if err := os.Rename(entryDir, target); err != nil {
+		if isCrossDeviceError(err) {
+			return os.RemoveAll(entryDir)
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns all trashed entries, oldest deletion first.
+func (t *Trash) List() ([]TrashedFile, error) {
+	infos, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []TrashedFile
+	for _, info := range infos {
+		f, ok := parseTrashedFile(t.dir, info.Name())
+		if !ok {
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].DeletedAt.Before(files[j].DeletedAt)
+	})
+	return files, nil
+}
+
+// Purge permanently removes f.
+func (t *Trash) Purge(f TrashedFile) error {
+	return os.RemoveAll(f.Path)
+}
+
+func parseTrashedFile(dir, base string) (TrashedFile, bool) {
+	i := strings.LastIndex(base, ".")
+	if i < 0 {
+		return TrashedFile{}, false
+	}
+	name, err := url.PathUnescape(base[:i])
+	if err != nil {
+		return TrashedFile{}, false
+	}
+	nanos, err := strconv.ParseInt(base[i+1:], 10, 64)
+	if err != nil {
+		return TrashedFile{}, false
+	}
+	return TrashedFile{
+		Name:      name,
+		Path:      filepath.Join(dir, base),
+		DeletedAt: time.Unix(0, nanos),
+	}, true
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteFileMovesToTrash(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	trashDir, err := os.MkdirTemp("/tmp", "trash")
+	require.NoError(err)
+	defer os.RemoveAll(trashDir)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	trash, err := NewTrash(trashDir, clk)
+	require.NoError(err)
+
+	store := NewCASFileStoreWithLRUConfig(LRUConfig{Trash: trash}, clk)
+	name := core.DigestFixture().Hex()
+	require.NoError(store.NewFileOp().CreateFile(name, state, 5))
+	_, err = store.NewFileOp().AcceptState(state).SetFileMetadata(name, getMockMetadataMovable())
+	require.NoError(err)
+	path, err := store.NewFileOp().AcceptState(state).GetFilePath(name)
+	require.NoError(err)
+
+	require.NoError(store.NewFileOp().AcceptState(state).DeleteFile(name))
+	_, err = store.NewFileOp().AcceptState(state).GetFileStat(name)
+	require.True(os.IsNotExist(err))
+
+	files, err := trash.List()
+	require.NoError(err)
+	require.Len(files, 1)
+	require.Equal(name, files[0].Name)
+	require.Equal(clk.Now().UnixNano(), files[0].DeletedAt.UnixNano())
+
+	// Moving the trashed entry back restores the file and its metadata.
+	require.NoError(os.Rename(files[0].Path, filepath.Dir(path)))
+	_, err = store.NewFileOp().AcceptState(state).GetFileStat(name)
+	require.NoError(err)
+	require.NoError(store.NewFileOp().AcceptState(state).GetFileMetadata(name, getMockMetadataMovable()))
+
+	require.NoError(store.NewFileOp().AcceptState(state).DeleteFile(name))
+	files, err = trash.List()
+	require.NoError(err)
+	require.Len(files, 1)
+	require.NoError(trash.Purge(files[0]))
+	files, err = trash.List()
+	require.NoError(err)
+	require.Empty(files)
+}
+
+func TestTrashEscapesNames(t *testing.T) {
+	require := require.New(t)
+
+	state, _, _, cleanup := fileStatesFixture()
+	defer cleanup()
+
+	trashDir, err := os.MkdirTemp("/tmp", "trash")
+	require.NoError(err)
+	defer os.RemoveAll(trashDir)
+
+	clk := clock.NewMock()
+	trash, err := NewTrash(trashDir, clk)
+	require.NoError(err)
+
+	store := NewLocalFileStoreWithLRUConfig(LRUConfig{Trash: trash}, clk)
+	name := "dir/file.txt"
+	require.NoError(store.NewFileOp().CreateFile(name, state, 5))
+	require.NoError(store.NewFileOp().AcceptState(state).DeleteFile(name))
+
+	files, err := trash.List()
+	require.NoError(err)
+	require.Len(files, 1)
+	require.Equal(name, files[0].Name)
+}
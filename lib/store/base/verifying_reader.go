@@ -0,0 +1,89 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/uber/kraken/core"
+)
+
+// verifyingReader wraps a FileReader and hashes content as it is read
+// sequentially. Once EOF is reached, the computed sha256 is compared against
+// the digest the file is named after.
+//
+// Verification is only possible for sequential reads from the beginning of the
+// file. Seeking back to the origin restarts verification; seeking anywhere
+// else disables it for the lifetime of the reader. ReadAt does not affect
+// verification.
+type verifyingReader struct {
+	FileReader
+
+	expected core.Digest
+	hash     hash.Hash
+	offset   int64
+	disabled bool
+}
+
+func newVerifyingReader(r FileReader, name string) (*verifyingReader, error) {
+	expected, err := core.NewSHA256DigestFromHex(name)
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{
+		FileReader: r,
+		expected:   expected,
+		hash:       sha256.New(),
+	}, nil
+}
+
+// Read reads up to len(p) bytes and feeds them into the running hash. On EOF,
+// returns ChecksumMismatchError if the content does not match its name.
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.FileReader.Read(p)
+	if r.disabled {
+		return n, err
+	}
+	r.hash.Write(p[:n])
+	r.offset += int64(n)
+	if err == io.EOF {
+		if computed := hex.EncodeToString(r.hash.Sum(nil)); computed != r.expected.Hex() {
+			return n, &ChecksumMismatchError{
+				Name:     r.expected.Hex(),
+				Computed: computed,
+			}
+		}
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read. See verifyingReader for how seeking
+// affects verification.
+func (r *verifyingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.FileReader.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if pos == 0 {
+		r.hash.Reset()
+		r.offset = 0
+		r.disabled = false
+	} else if pos != r.offset {
+		r.disabled = true
+	}
+	return pos, nil
+}
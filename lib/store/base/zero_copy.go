@@ -0,0 +1,53 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"io"
+	"os"
+)
+
+// directReader is implemented by FileReaders whose reads are equivalent to
+// reading their underlying file directly.
+type directReader interface {
+	// file returns the underlying file, or false if its content must pass
+	// through the reader, e.g. to be decrypted.
+	file() (*os.File, bool)
+}
+
+func directFile(r FileReader) (*os.File, bool) {
+	if d, ok := r.(directReader); ok {
+		return d.file()
+	}
+	return nil, false
+}
+
+// CopyN copies n bytes from the current offset of r to w, and like io.CopyN
+// returns io.EOF if r has fewer bytes. If r reads its file directly, i.e. its
+// content is not verified, decrypted or read ahead, and w is a TCP connection
+// or an HTTP response on one, the kernel copies the data with sendfile instead
+// of passing it through user space.
+func CopyN(w io.Writer, r FileReader, n int64) (int64, error) {
+	var src io.Reader = r
+	if f, ok := directFile(r); ok {
+		src = f
+	}
+	// Wrapping the file in a LimitedReader hides its WriteTo, so io.Copy
+	// defers to the ReadFrom of w, which uses sendfile for files.
+	written, err := io.Copy(w, io.LimitReader(src, n))
+	if written < n && err == nil {
+		err = io.EOF
+	}
+	return written, err
+}
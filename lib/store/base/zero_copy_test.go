@@ -0,0 +1,143 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func zeroCopyFixture(t *testing.T, store FileStore, content []byte) (FileOp, string) {
+	state, _, _, cleanup := fileStatesFixture()
+	t.Cleanup(cleanup)
+
+	op := store.NewFileOp().AcceptState(state)
+	name := core.DigestFixture().Hex()
+	require.NoError(t, store.NewFileOp().CreateFile(name, state, 0))
+	w, err := op.GetFileReadWriter(name, 0, 0)
+	require.NoError(t, err)
+	_, err = w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return op, name
+}
+
+// copyOverTCP copies n bytes of r over a TCP connection, and returns the
+// received bytes.
+func copyOverTCP(t *testing.T, r FileReader, n int64) []byte {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan []byte)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		b, _ := io.ReadAll(conn)
+		received <- b
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	written, err := CopyN(conn, r, n)
+	require.NoError(t, err)
+	require.Equal(t, n, written)
+	require.NoError(t, conn.Close())
+	return <-received
+}
+
+func TestCopyNDirect(t *testing.T) {
+	require := require.New(t)
+
+	content := randutil.Blob(100000)
+	op, name := zeroCopyFixture(t, NewCASFileStoreWithLRUConfig(LRUConfig{}, clock.NewMock()), content)
+
+	r, err := op.GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+
+	_, ok := directFile(r)
+	require.True(ok)
+
+	_, err = r.Seek(1000, io.SeekStart)
+	require.NoError(err)
+	require.Equal(content[1000:51000], copyOverTCP(t, r, 50000))
+
+	// The offset of the reader advances past the copied bytes.
+	var out bytes.Buffer
+	_, err = io.Copy(&out, r)
+	require.NoError(err)
+	require.Equal(content[51000:], out.Bytes())
+}
+
+func TestCopyNReadParts(t *testing.T) {
+	require := require.New(t)
+
+	content := randutil.Blob(1000)
+	op, name := zeroCopyFixture(t, NewCASFileStoreWithLRUConfig(LRUConfig{}, clock.NewMock()), content)
+
+	r, err := op.GetFileReader(name, 64)
+	require.NoError(err)
+	defer r.Close()
+
+	_, ok := directFile(r)
+	require.False(ok)
+
+	require.Equal(content, copyOverTCP(t, r, int64(len(content))))
+}
+
+func TestCopyNEncrypted(t *testing.T) {
+	require := require.New(t)
+
+	content := randutil.Blob(1000)
+	op, name := zeroCopyFixture(t, encryptedStoreFixture(t), content)
+
+	r, err := op.GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+
+	_, ok := directFile(r)
+	require.False(ok)
+
+	require.Equal(content, copyOverTCP(t, r, int64(len(content))))
+}
+
+func TestCopyNShortFile(t *testing.T) {
+	require := require.New(t)
+
+	content := randutil.Blob(1000)
+	op, name := zeroCopyFixture(t, NewCASFileStoreWithLRUConfig(LRUConfig{}, clock.NewMock()), content)
+
+	r, err := op.GetFileReader(name, 0)
+	require.NoError(err)
+	defer r.Close()
+
+	var out bytes.Buffer
+	n, err := CopyN(&out, r, 2000)
+	require.Equal(io.EOF, err)
+	require.Equal(int64(1000), n)
+	require.Equal(content, out.Bytes())
+}
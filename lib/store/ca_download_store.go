@@ -14,6 +14,7 @@
 package store
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -23,6 +24,10 @@ import (
 	"github.com/uber/kraken/lib/store/metadata"
 )
 
+// ErrFileEncrypted is returned when requesting the path of a file in a store
+// which encrypts files at rest, since the file on disk is not the content.
+var ErrFileEncrypted = errors.New("file is encrypted at rest")
+
 // CADownloadStore allows simultaneously downloading and uploading
 // content-adddressable files.
 type CADownloadStore struct {
@@ -32,6 +37,8 @@ type CADownloadStore struct {
 	cleanup       *cleanupManager
 	readPartSize  int
 	writePartSize int
+	readahead     *base.BufferPool
+	encrypted     bool
 }
 
 // NewCADownloadStore creates a new CADownloadStore.
@@ -46,7 +53,17 @@ func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADow
 		}
 	}
 
-	backend := base.NewCASFileStore(clock.New())
+	if err := config.Durability.Validate(); err != nil {
+		return nil, err
+	}
+
+	cipher, err := config.Encryption.cipher()
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %s", err)
+	}
+
+	backend := base.NewCASFileStoreWithLRUConfig(
+		base.LRUConfig{Cipher: cipher, Durability: config.Durability}, clock.New())
 	downloadState := base.NewFileState(config.DownloadDir)
 	cacheState := base.NewFileState(config.CacheDir)
 
@@ -63,6 +80,11 @@ func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADow
 		config.CacheCleanup,
 		backend.NewFileOp().AcceptState(cacheState))
 
+	var readahead *base.BufferPool
+	if config.ReadaheadSize > 0 {
+		readahead = base.NewBufferPool(int(config.ReadaheadSize))
+	}
+
 	return &CADownloadStore{
 		backend:       backend,
 		downloadState: downloadState,
@@ -70,12 +92,15 @@ func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADow
 		cleanup:       cleanup,
 		readPartSize:  config.ReadPartSize,
 		writePartSize: config.WritePartSize,
+		readahead:     readahead,
+		encrypted:     cipher != nil,
 	}, nil
 }
 
 // Close terminates all goroutines started by s.
 func (s *CADownloadStore) Close() {
 	s.cleanup.stop()
+	s.backend.Close()
 }
 
 // CreateDownloadFile creates an empty download file initialized with length.
@@ -128,9 +153,13 @@ type CADownloadStoreScope struct {
 }
 
 func (s *CADownloadStore) states() *CADownloadStoreScope {
+	op := s.backend.NewFileOp()
+	if s.readahead != nil {
+		op = op.Readahead(s.readahead)
+	}
 	return &CADownloadStoreScope{
 		store: s,
-		op:    s.backend.NewFileOp(),
+		op:    op,
 	}
 }
 
@@ -169,6 +198,35 @@ func (a *CADownloadStoreScope) GetFileStat(name string) (os.FileInfo, error) {
 	return a.op.GetFileStat(name)
 }
 
+// GetFileAllocatedBytes returns the number of bytes name occupies on disk.
+// Download files are created sparse, so this grows as pieces are written
+// rather than matching the file length upfront.
+func (a *CADownloadStoreScope) GetFileAllocatedBytes(name string) (int64, error) {
+	info, err := a.op.GetFileStat(name)
+	if err != nil {
+		return 0, err
+	}
+	return base.AllocatedBytes(info), nil
+}
+
+// GetFilePath returns the path at which the content of name can be read
+// directly from disk, decompressing the file first if needed. Returns
+// ErrFileEncrypted if the store encrypts files at rest.
+func (a *CADownloadStoreScope) GetFilePath(name string) (string, error) {
+	if a.store.encrypted {
+		return "", ErrFileEncrypted
+	}
+	if err := a.op.DecompressFile(name); err != nil {
+		return "", err
+	}
+	return a.op.GetFilePath(name)
+}
+
+// ListNames returns the names of all files in scope.
+func (a *CADownloadStoreScope) ListNames() ([]string, error) {
+	return a.op.ListNames()
+}
+
 // DeleteFile deletes name.
 func (a *CADownloadStoreScope) DeleteFile(name string) error {
 	return a.op.DeleteFile(name)
@@ -49,3 +49,68 @@ func TestCADownloadStoreDownloadAndDeleteFiles(t *testing.T) {
 		require.True(os.IsNotExist(err))
 	}
 }
+
+func TestCADownloadStoreCreateDownloadFileIsSparse(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CADownloadStoreFixture()
+	defer cleanup()
+
+	name := core.DigestFixture().Hex()
+	length := int64(1 << 30)
+	require.NoError(s.CreateDownloadFile(name, length))
+
+	info, err := s.Download().GetFileStat(name)
+	require.NoError(err)
+	require.Equal(length, info.Size())
+
+	allocated, err := s.Download().GetFileAllocatedBytes(name)
+	require.NoError(err)
+	require.True(allocated < length, "expected sparse file, got %d allocated bytes", allocated)
+
+	w, err := s.GetDownloadFileReadWriter(name)
+	require.NoError(err)
+	_, err = w.WriteAt(make([]byte, 1<<20), 0)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	written, err := s.Download().GetFileAllocatedBytes(name)
+	require.NoError(err)
+	require.True(written > allocated)
+}
+
+func TestCADownloadStoreGetFilePathAndListNames(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CADownloadStoreFixture()
+	defer cleanup()
+
+	cached := core.DigestFixture().Hex()
+	require.NoError(s.CreateDownloadFile(cached, 5))
+	w, err := s.GetDownloadFileReadWriter(cached)
+	require.NoError(err)
+	_, err = w.Write([]byte("hello"))
+	require.NoError(err)
+	require.NoError(w.Close())
+	require.NoError(s.MoveDownloadFileToCache(cached))
+
+	downloading := core.DigestFixture().Hex()
+	require.NoError(s.CreateDownloadFile(downloading, 1))
+
+	path, err := s.Cache().GetFilePath(cached)
+	require.NoError(err)
+	b, err := os.ReadFile(path)
+	require.NoError(err)
+	require.Equal("hello", string(b))
+
+	_, err = s.Cache().GetFilePath(downloading)
+	require.True(s.InDownloadError(err))
+
+	names, err := s.Cache().ListNames()
+	require.NoError(err)
+	require.Equal([]string{cached}, names)
+
+	names, err = s.Any().ListNames()
+	require.NoError(err)
+	require.ElementsMatch([]string{cached, downloading}, names)
+}
@@ -16,20 +16,17 @@ package store
 import (
 	"bytes"
 	"container/list"
+	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"os"
-	"path"
 	"sync"
 	"time"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/docker/distribution/uuid"
-	"github.com/spaolacci/murmur3"
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
-	"github.com/uber/kraken/lib/hrw"
 	"github.com/uber/kraken/lib/store/base"
 	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/utils/cache"
@@ -48,6 +45,9 @@ var drainDurationBuckets = append(
 type drainItem struct {
 	entry   *cache.MemoryEntry
 	retries int
+
+	// metadata is written alongside the entry once it reaches disk.
+	metadata []metadata.Metadata
 }
 
 type drain struct {
@@ -66,13 +66,32 @@ type CAStore struct {
 
 	*uploadStore
 	*cacheStore
-	cleanup *cleanupManager
+	cleanup   *cleanupManager
+	scrubber  *scrubber
+	compactor *compactor
+	janitor   *janitor
+	volumes   *volumeManager
+
+	// Buffers for readahead of cache files, if enabled.
+	readahead *base.BufferPool
 
 	memCache *cache.BlobMemoryCache
 
 	drain       *drain
 	ttlStopChan chan struct{}
 	ttlWg       sync.WaitGroup
+
+	// Serializes quota checks with commits into the cache.
+	quotaMu sync.Mutex
+
+	// Serializes read-modify-write of resumable upload progress.
+	uploadProgressMu sync.Mutex
+
+	// Serializes read-modify-write of pins.
+	pinMu sync.Mutex
+
+	// Serializes read-modify-write of annotations.
+	annotationsMu sync.Mutex
 }
 
 // NewCAStore creates a new CAStore.
@@ -88,21 +107,74 @@ func newCAStore(config CAStoreConfig, stats tally.Scope, clk clock.Clock) (*CASt
 		"module": "castore",
 	})
 
-	uploadStore, err := newUploadStore(config.UploadDir, config.ReadPartSize, config.WritePartSize)
+	if err := config.ReplacementPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Durability.Validate(); err != nil {
+		return nil, err
+	}
+
+	cipher, err := config.Encryption.cipher()
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %s", err)
+	}
+	if cipher != nil && config.Compaction.Enabled {
+		return nil, errors.New("compaction is not supported with encryption")
+	}
+
+	uploadStore, err := newUploadStore(
+		config.UploadDir, config.ReadPartSize, config.WritePartSize, cipher, config.Durability)
 	if err != nil {
 		return nil, fmt.Errorf("new upload store: %s", err)
 	}
 
-	cacheBackend := base.NewCASFileStoreWithLRUMap(config.Capacity, clk)
+	var trash *base.Trash
+	if config.Trash.Enabled {
+		config.Trash = config.Trash.applyDefaults(config.CacheDir)
+		trash, err = base.NewTrash(config.Trash.Dir, clk)
+		if err != nil {
+			return nil, fmt.Errorf("new trash: %s", err)
+		}
+	}
+
+	cacheBackend := base.NewCASFileStoreWithLRUConfig(base.LRUConfig{
+		Size:             config.Capacity,
+		MaxBytes:         int64(config.CapacityBytes),
+		Policy:           config.ReplacementPolicy,
+		LATFlushInterval: config.LastAccessTimeFlushInterval,
+		Durability:       config.Durability,
+		Cipher:           cipher,
+		Trash:            trash,
+		IndexedMetadata:  config.IndexedMetadata,
+	}, clk)
 	cacheStore, err := newCacheStore(config.CacheDir, cacheBackend, config.ReadPartSize)
 	if err != nil {
 		return nil, fmt.Errorf("new cache store: %s", err)
 	}
+	if len(config.IndexedMetadata) > 0 {
+		// Load all cache files, so the index covers files cached before
+		// restart.
+		if err := cacheStore.WalkCacheFiles(func(string, os.FileInfo) error { return nil }); err != nil {
+			return nil, fmt.Errorf("index cache files: %s", err)
+		}
+	}
 
-	if err := initCASVolumes(config.CacheDir, config.Volumes); err != nil {
-		return nil, fmt.Errorf("init cas volumes: %s", err)
+	var volumes *volumeManager
+	if len(config.Volumes) > 0 {
+		volumes, err = newVolumeManager(config.CacheDir, config.Volumes, config.VolumeHealth, clk, stats)
+		if err != nil {
+			return nil, fmt.Errorf("init cas volumes: %s", err)
+		}
+		if config.VolumeHealth.Enabled {
+			volumes.start()
+		}
 	}
 
+	uploadStore.backend.SetDiskUsageHook(diskUsageGauge(stats, "upload"))
+	cacheBackend.SetDiskUsageHook(diskUsageGauge(stats, "cache"))
+	uploadStore.backend.SetOpHook(fileOpMetrics(stats, "upload"))
+	cacheBackend.SetOpHook(fileOpMetrics(stats, "cache"))
+
 	cleanup, err := newCleanupManager(clk, stats)
 	if err != nil {
 		return nil, fmt.Errorf("new cleanup manager: %s", err)
@@ -117,6 +189,36 @@ func newCAStore(config CAStoreConfig, stats tally.Scope, clk clock.Clock) (*CASt
 		uploadStore: uploadStore,
 		cacheStore:  cacheStore,
 		cleanup:     cleanup,
+		volumes:     volumes,
+	}
+
+	if config.ReadaheadSize > 0 {
+		cas.readahead = base.NewBufferPool(int(config.ReadaheadSize))
+	}
+
+	if cas.quotaEnabled() {
+		if err := cas.initQuota(); err != nil {
+			return nil, fmt.Errorf("init quota: %s", err)
+		}
+	}
+
+	if config.Scrubber.Enabled {
+		scrubber, err := newScrubber(config.Scrubber, config.CacheDir, cacheStore.newFileOp(), clk, stats)
+		if err != nil {
+			return nil, fmt.Errorf("new scrubber: %s", err)
+		}
+		scrubber.start()
+		cas.scrubber = scrubber
+	}
+
+	if trash != nil {
+		cas.janitor = newJanitor(config.Trash, trash, clk, stats)
+		cas.janitor.start()
+	}
+
+	if config.Compaction.Enabled {
+		cas.compactor = newCompactor(config.Compaction, cacheStore.newFileOp(), clk, stats)
+		cas.compactor.start()
 	}
 
 	if config.MemoryCache.Enabled {
@@ -129,6 +231,28 @@ func newCAStore(config CAStoreConfig, stats tally.Scope, clk clock.Clock) (*CASt
 	return cas, nil
 }
 
+// diskUsageGauge returns a hook which reports disk usage of a state.
+func diskUsageGauge(stats tally.Scope, state string) base.DiskUsageHook {
+	gauge := stats.Tagged(map[string]string{"state": state}).Gauge("disk_usage")
+	return func(_ base.FileState, bytes int64) {
+		gauge.Update(float64(bytes))
+	}
+}
+
+// fileOpMetrics returns a hook which reports latency and errors of file
+// operations in a state. Missing and already existing files are expected
+// results, and not counted as errors.
+func fileOpMetrics(stats tally.Scope, state string) base.OpHook {
+	stats = stats.Tagged(map[string]string{"state": state})
+	return func(operation string, latency time.Duration, err error) {
+		scope := stats.Tagged(map[string]string{"operation": operation})
+		scope.Timer("file_op_latency").Record(latency)
+		if err != nil && !os.IsNotExist(err) && !os.IsExist(err) {
+			scope.Counter("file_op_errors").Inc(1)
+		}
+	}
+}
+
 func createMemoryCache(config *CAStoreConfig, stats tally.Scope) *cache.BlobMemoryCache {
 	return cache.NewBlobMemoryCache(cache.BlobMemoryCacheConfig{
 		MaxSize: config.MemoryCache.MaxSize,
@@ -165,7 +289,26 @@ func (s *CAStore) Close() {
 		s.ttlWg.Wait()
 	}
 
+	if s.scrubber != nil {
+		s.scrubber.stop()
+	}
+
+	if s.compactor != nil {
+		s.compactor.stop()
+	}
+
+	if s.janitor != nil {
+		s.janitor.stop()
+	}
+
+	if s.volumes != nil {
+		s.volumes.stop()
+	}
+
 	s.cleanup.stop()
+
+	s.uploadStore.backend.Close()
+	s.cacheStore.backend.Close()
 }
 
 // MoveUploadFileToCache commits uploadName as cacheName. Clients are expected
@@ -183,7 +326,23 @@ func (s *CAStore) MoveUploadFileToCache(uploadName, cacheName string) error {
 	}
 	defer closers.Close(f)
 	if err := s.verify(f, cacheName); err != nil {
-		return fmt.Errorf("verify digest: %s", err)
+		return fmt.Errorf("verify digest: %w", err)
+	}
+
+	if s.quotaEnabled() {
+		info, err := s.uploadStore.newFileOp().GetFileStat(uploadName)
+		if err != nil {
+			return fmt.Errorf("get file stat %s: %s", uploadName, err)
+		}
+		s.quotaMu.Lock()
+		defer s.quotaMu.Unlock()
+		// The move fails with os.ErrExist if the file is already cached, so
+		// there is nothing to reserve.
+		if !s.inCache(cacheName) {
+			if err := s.checkQuota(cacheName, info.Size()); err != nil {
+				return err
+			}
+		}
 	}
 
 	return s.cacheStore.newFileOp().MoveFileFrom(cacheName, s.cacheStore.state, uploadPath)
@@ -206,6 +365,18 @@ func (s *CAStore) WriteCacheFile(name string, write func(w FileReadWriter) error
 
 // this function writes cache file with an option to write metadata alongside
 func (s *CAStore) writeCacheFile(name string, write func(w FileReadWriter) error, addMetadata bool, pieceLength int64) error {
+	if s.quotaEnabled() && !s.config.EvictOnQuota && !s.inCache(name) {
+		// Fail fast if the cache is already full.
+		if usage := s.cacheStore.backend.DiskUsage(s.cacheStore.state); usage >= int64(s.config.Quota) {
+			s.stats.Counter("quota_exceeded").Inc(1)
+			return &QuotaExceededError{
+				Name:  name,
+				Usage: usage,
+				Quota: int64(s.config.Quota),
+			}
+		}
+	}
+
 	tmp := fmt.Sprintf("%s.%s", name, uuid.Generate().String())
 	if err := s.CreateUploadFile(tmp, 0); err != nil {
 		return fmt.Errorf("create upload file: %s", err)
@@ -222,7 +393,7 @@ func (s *CAStore) writeCacheFile(name string, write func(w FileReadWriter) error
 		return err
 	}
 	if err := s.MoveUploadFileToCache(tmp, name); err != nil && !os.IsExist(err) {
-		return fmt.Errorf("move upload file to cache: %s", err)
+		return fmt.Errorf("move upload file to cache: %w", err)
 	}
 	if addMetadata {
 		return s.generateMetadataFromFile(name, pieceLength)
@@ -232,14 +403,16 @@ func (s *CAStore) writeCacheFile(name string, write func(w FileReadWriter) error
 
 // WriteBlobToCacheWithMetaInfo writes a blob and its metadata to disk,
 // potentially going through a write-through memory cache, if memory is available.
+// Any additional mds are written once the blob reaches disk.
 func (s *CAStore) WriteBlobToCacheWithMetaInfo(
 	name string,
 	size uint64,
 	write func(w FileReadWriter) error,
-	pieceLength int64) error {
+	pieceLength int64,
+	mds ...metadata.Metadata) error {
 	if s.config.MemoryCache.Enabled && s.memCache.TryReserve(size) {
 		log.With("name", name, "size", size).Debug("successfully reserved cache")
-		err := s.addToMemoryCache(name, write, size, pieceLength)
+		err := s.addToMemoryCache(name, write, size, pieceLength, mds)
 		if err == nil {
 			return nil
 		}
@@ -247,7 +420,19 @@ func (s *CAStore) WriteBlobToCacheWithMetaInfo(
 		s.memCache.ReleaseReservation(size)
 	}
 	addMetadata := true
-	return s.writeCacheFile(name, write, addMetadata, pieceLength)
+	if err := s.writeCacheFile(name, write, addMetadata, pieceLength); err != nil {
+		return err
+	}
+	return s.setCacheFileMetadata(name, mds)
+}
+
+func (s *CAStore) setCacheFileMetadata(name string, mds []metadata.Metadata) error {
+	for _, md := range mds {
+		if _, err := s.SetCacheFileMetadata(name, md); err != nil {
+			return fmt.Errorf("write metadata %s: %s", md.GetSuffix(), err)
+		}
+	}
+	return nil
 }
 
 // CheckInMemCache returns true if the blob is present in memcache
@@ -261,6 +446,7 @@ func (s *CAStore) addToMemoryCache(
 	write func(w FileReadWriter) error,
 	size uint64,
 	pieceLength int64,
+	mds []metadata.Metadata,
 ) error {
 	tmpWriter := base.NewBufferReadWriter(size)
 
@@ -289,8 +475,9 @@ func (s *CAStore) addToMemoryCache(
 	log.With("name", name, "size", entry.Size(), "cap", cap(data)).Debug("successfully added to cache")
 
 	s.addItemForDiskSync(&drainItem{
-		entry:   entry,
-		retries: 0,
+		entry:    entry,
+		retries:  0,
+		metadata: mds,
 	})
 	return nil
 }
@@ -334,6 +521,23 @@ func (s *CAStore) addItemForDiskSync(item *drainItem) {
 
 // verify verifies that name is a valid SHA256 digest, and checks if the given
 // blob content matches the digset unless explicitly skipped.
+// DigestMismatchError occurs when moving a file into the cache whose content
+// does not hash to its name.
+type DigestMismatchError struct {
+	Expected core.Digest
+	Computed core.Digest
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("computed digest %s doesn't match expected value %s", e.Computed, e.Expected)
+}
+
+// IsDigestMismatchError returns true if err is, or wraps, a DigestMismatchError.
+func IsDigestMismatchError(err error) bool {
+	var e *DigestMismatchError
+	return errors.As(err, &e)
+}
+
 func (s *CAStore) verify(r io.Reader, name string) error {
 	// Verify that expected name is a valid SHA256 digest.
 	expected, err := core.NewSHA256DigestFromHex(name)
@@ -348,7 +552,7 @@ func (s *CAStore) verify(r io.Reader, name string) error {
 			return fmt.Errorf("calculate digest: %s", err)
 		}
 		if computed != expected {
-			return fmt.Errorf("computed digest %s doesn't match expected value %s", computed, expected)
+			return &DigestMismatchError{Expected: expected, Computed: computed}
 		}
 	}
 	return nil
@@ -418,12 +622,13 @@ func (s *CAStore) drainNext() {
 		return
 	}
 
-	err := s.writeDrainItemToDisk(item.entry)
+	err := s.writeDrainItemToDisk(item.entry, item.metadata)
 	if err != nil {
 		if item.retries < s.config.MemoryCache.DrainMaxRetries {
 			s.addItemForDiskSync(&drainItem{
-				entry:   item.entry,
-				retries: item.retries + 1,
+				entry:    item.entry,
+				retries:  item.retries + 1,
+				metadata: item.metadata,
 			})
 			return
 		}
@@ -436,7 +641,7 @@ func (s *CAStore) drainNext() {
 	s.memCache.Remove(item.entry.Name)
 }
 
-func (s *CAStore) writeDrainItemToDisk(entry *cache.MemoryEntry) error {
+func (s *CAStore) writeDrainItemToDisk(entry *cache.MemoryEntry, mds []metadata.Metadata) error {
 	if err := s.WriteCacheFile(entry.Name, func(w FileReadWriter) error {
 		_, err := w.Write(entry.Data)
 		return err
@@ -449,7 +654,7 @@ func (s *CAStore) writeDrainItemToDisk(entry *cache.MemoryEntry) error {
 		return fmt.Errorf("write metadata: %s", err)
 	}
 
-	return nil
+	return s.setCacheFileMetadata(entry.Name, mds)
 }
 
 // GetCacheFileReader overrides cacheStore.GetCacheFileReader to check
@@ -461,7 +666,17 @@ func (s *CAStore) GetCacheFileReader(name string) (FileReader, error) {
 		}
 	}
 
-	return s.cacheStore.GetCacheFileReader(name)
+	op := s.cacheStore.newFileOp()
+	if s.config.VerifyCacheReads {
+		op = op.VerifyDigest()
+	}
+	if s.config.StreamingReadThreshold > 0 {
+		op = op.StreamingRead(int64(s.config.StreamingReadThreshold))
+	}
+	if s.readahead != nil {
+		op = op.Readahead(s.readahead)
+	}
+	return op.GetFileReader(name, s.cacheStore.readPartSize)
 }
 
 // GetCacheFileMetadata overrides cacheStore.GetCacheFileMetadata to serve
@@ -542,39 +757,3 @@ func (f *memoryFileInfo) Mode() os.FileMode  { return os.ModePerm }
 func (f *memoryFileInfo) ModTime() time.Time { return f.modTime }
 func (f *memoryFileInfo) IsDir() bool        { return false }
 func (f *memoryFileInfo) Sys() interface{}   { return nil }
-
-func initCASVolumes(dir string, volumes []Volume) error {
-	if len(volumes) == 0 {
-		return nil
-	}
-
-	rendezvousHash := hrw.NewRendezvousHash(
-		func() hash.Hash { return murmur3.New64() },
-		hrw.UInt64ToFloat64)
-
-	for _, v := range volumes {
-		if _, err := os.Stat(v.Location); err != nil {
-			return fmt.Errorf("verify volume: %s", err)
-		}
-		rendezvousHash.AddNode(v.Location, v.Weight)
-	}
-
-	// Create 256 symlinks under dir.
-	for subdirIndex := 0; subdirIndex < 256; subdirIndex++ {
-		subdirName := fmt.Sprintf("%02X", subdirIndex)
-		nodes := rendezvousHash.GetOrderedNodes(subdirName, 1)
-		if len(nodes) != 1 {
-			return fmt.Errorf("calculate volume for subdir: %s", subdirName)
-		}
-		sourcePath := path.Join(nodes[0].Label, path.Base(dir), subdirName)
-		if err := os.MkdirAll(sourcePath, 0775); err != nil {
-			return fmt.Errorf("volume source path: %s", err)
-		}
-		targetPath := path.Join(dir, subdirName)
-		if err := createOrUpdateSymlink(sourcePath, targetPath); err != nil {
-			return fmt.Errorf("symlink to volume: %s", err)
-		}
-	}
-
-	return nil
-}
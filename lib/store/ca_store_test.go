@@ -158,6 +158,17 @@ func TestCAStoreInitVolumesAfterChangingVolumes(t *testing.T) {
 	require.True(float32(n4)/256 > float32(0.15))
 }
 
+func TestCAStoreRejectsUnknownDurability(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	config.Durability = "sometimes"
+	_, err := NewCAStore(config, tally.NoopScope)
+	require.Error(err)
+}
+
 func TestCAStoreCreateUploadFileAndMoveToCache(t *testing.T) {
 	require := require.New(t)
 
@@ -218,6 +229,7 @@ func TestCAStoreCreateUploadFileAndMoveToCacheFailure(t *testing.T) {
 	dst := core.DigestFixture().Hex()
 	err = s.MoveUploadFileToCache(src, dst)
 	require.EqualError(err, fmt.Sprintf("verify digest: computed digest sha256:%s doesn't match expected value sha256:%s", digest.Hex(), dst))
+	require.True(IsDigestMismatchError(err))
 	_, err = os.Stat(path.Join(config.UploadDir, src[:2], src[2:4], src))
 	require.True(os.IsNotExist(err))
 	_, err = os.Stat(path.Join(config.CacheDir, dst[:2], dst[2:4], dst))
@@ -243,6 +255,109 @@ func TestCAStoreCreateCacheFile(t *testing.T) {
 	require.NoError(err)
 	require.Equal(s1, string(b2))
 }
+
+func TestCAStoreIndexesCacheFilesOnStartup(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+	config.IndexedMetadata = []string{metadata.NewPersist(true).GetSuffix()}
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	_, err = s.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewPersist(true))
+	require.NoError(err)
+	s.Close()
+
+	s, err = NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	names, err := s.FindCacheFiles(&metadata.Persist{}, func(name string, md metadata.Metadata) bool {
+		return md.(*metadata.Persist).Value
+	})
+	require.NoError(err)
+	require.Equal([]string{blob.Digest.Hex()}, names)
+}
+
+func TestCAStoreQuota(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+	config.Quota = 150
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	blob1 := core.SizedBlobFixture(100, 10)
+	require.NoError(s.CreateCacheFile(blob1.Digest.Hex(), bytes.NewReader(blob1.Content)))
+
+	blob2 := core.SizedBlobFixture(100, 10)
+	err = s.CreateCacheFile(blob2.Digest.Hex(), bytes.NewReader(blob2.Content))
+	require.Error(err)
+	require.True(IsQuotaExceededError(err))
+
+	_, err = s.GetCacheFileStat(blob1.Digest.Hex())
+	require.NoError(err)
+	_, err = s.GetCacheFileStat(blob2.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestCAStoreQuotaIgnoresCachedFiles(t *testing.T) {
+	for _, evict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("evict=%t", evict), func(t *testing.T) {
+			require := require.New(t)
+
+			config, cleanup := CAStoreConfigFixture()
+			defer cleanup()
+			config.Quota = 100
+			config.EvictOnQuota = evict
+
+			s, err := NewCAStore(config, tally.NoopScope)
+			require.NoError(err)
+			defer s.Close()
+
+			blob := core.SizedBlobFixture(100, 10)
+			require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+			// The cache is full, but writing the same blob again adds no bytes.
+			require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+			_, err = s.GetCacheFileStat(blob.Digest.Hex())
+			require.NoError(err)
+		})
+	}
+}
+
+func TestCAStoreQuotaEvict(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+	config.Quota = 150
+	config.EvictOnQuota = true
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	blob1 := core.SizedBlobFixture(100, 10)
+	require.NoError(s.CreateCacheFile(blob1.Digest.Hex(), bytes.NewReader(blob1.Content)))
+
+	blob2 := core.SizedBlobFixture(100, 10)
+	require.NoError(s.CreateCacheFile(blob2.Digest.Hex(), bytes.NewReader(blob2.Content)))
+
+	_, err = s.GetCacheFileStat(blob1.Digest.Hex())
+	require.True(os.IsNotExist(err))
+	_, err = s.GetCacheFileStat(blob2.Digest.Hex())
+	require.NoError(err)
+}
+
 func TestCAStoreConfig_WithMemoryCache(t *testing.T) {
 	require := require.New(t)
 
@@ -889,6 +1004,64 @@ func TestCAStore_DrainWorkers(t *testing.T) {
 	}
 }
 
+func TestCAStore_WriteBlobToCacheWithMetaInfo_Metadata(t *testing.T) {
+	tests := []struct {
+		name              string
+		memoryCacheConfig MemoryCacheConfig
+	}{
+		{
+			name: "drained from memory cache",
+			memoryCacheConfig: MemoryCacheConfig{
+				Enabled:      true,
+				MaxSize:      1024 * 1024,
+				DrainWorkers: 1,
+				TTL:          time.Hour,
+			},
+		},
+		{
+			name: "written to disk",
+			memoryCacheConfig: MemoryCacheConfig{
+				Enabled: false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CAStoreConfig{
+				UploadDir:   t.TempDir(),
+				CacheDir:    t.TempDir(),
+				MemoryCache: tt.memoryCacheConfig,
+			}
+
+			mockClock := clock.NewMock()
+			cas, err := newCAStore(config, tally.NoopScope, mockClock)
+			require.NoError(t, err)
+			defer cas.Close()
+
+			blob := core.SizedBlobFixture(1024, 256)
+
+			require.NoError(t, cas.WriteBlobToCacheWithMetaInfo(
+				blob.Digest.Hex(),
+				uint64(len(blob.Content)),
+				func(w FileReadWriter) error {
+					_, err := w.Write(blob.Content)
+					return err
+				},
+				256*1024,
+				metadata.NewNamespace("foo"),
+			))
+
+			var ns metadata.Namespace
+			require.NoError(t, testutil.PollUntilTrue(500*time.Millisecond, func() bool {
+				mockClock.Add(100 * time.Millisecond)
+				return cas.GetCacheFileMetadata(blob.Digest.Hex(), &ns) == nil
+			}))
+			require.Equal(t, "foo", ns.Value)
+		})
+	}
+}
+
 func TestCAStore_GetCacheFileReader(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -69,6 +69,20 @@ func (s *cacheStore) ListCacheFiles() ([]string, error) {
 	return s.newFileOp().ListNames()
 }
 
+// WalkCacheFiles calls fn for every cache file on disk, without listing all
+// names upfront.
+func (s *cacheStore) WalkCacheFiles(fn func(name string, info os.FileInfo) error) error {
+	return s.backend.Walk(s.state, fn)
+}
+
+// FindCacheFiles returns the names of cache files with metadata of type md for
+// which predicate returns true. md must be indexed.
+func (s *cacheStore) FindCacheFiles(
+	md metadata.Metadata, predicate func(name string, md metadata.Metadata) bool) ([]string, error) {
+
+	return s.backend.Find(md, predicate)
+}
+
 func (s *cacheStore) newFileOp() base.FileOp {
 	return s.backend.NewFileOp().AcceptState(s.state)
 }
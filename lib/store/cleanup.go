@@ -104,18 +104,21 @@ func (m *cleanupManager) addJob(tag string, config CleanupConfig, op base.FileOp
 
 	ticker := m.clk.Ticker(config.Interval)
 
-	usageGauge := m.stats.Tagged(map[string]string{"job": tag}).Gauge("disk_usage")
+	jobStats := m.stats.Tagged(map[string]string{"job": tag})
+	usageGauge := jobStats.Gauge("disk_usage")
+	pinnedGauge := jobStats.Gauge("pinned_disk_usage")
 
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
 				log.Debugf("Performing cleanup of %s", op)
-				usage, err := m.cleanup(op, config, cachedInAgentPolicy)
+				usage, pinned, err := m.cleanup(op, config, cachedInAgentPolicy)
 				if err != nil {
 					log.Errorf("Error scanning %s: %s", op, err)
 				}
 				usageGauge.Update(float64(usage))
+				pinnedGauge.Update(float64(pinned))
 			case <-m.stopc:
 				ticker.Stop()
 				return
@@ -182,13 +185,14 @@ func forSureInAgent(f fInfo) bool {
 	return accessDownloadDiff(f) > 45*time.Minute
 }
 
-// cleanup cleans op from idle or expired files and returns its size BEFORE cleanup.
+// cleanup cleans op from idle or expired files and returns its size BEFORE
+// cleanup, along with the size of pinned files, which are never cleaned up.
 // It works in one of two possible modes:
 //  1. tti + ttl based cleanup - the default.
 //  2. aggressive cleanup - triggered on high disk usage. By default, it is ttl- and threshold-based.
 //     However, it can also be custom policy- and threshold-based, when a `customPolicy` and a `config.AggressiveLowerThreshold` are provided.
 //     Then the cache is cleaned until the lower threshold is reached, prioritizing blobs for deletion based on the `customPolicy`, which is a fn passed to [slices.SortFunc].
-func (m *cleanupManager) cleanup(op base.FileOp, config CleanupConfig, customPolicy func(a, b fInfo) int) (usage int64, err error) {
+func (m *cleanupManager) cleanup(op base.FileOp, config CleanupConfig, customPolicy func(a, b fInfo) int) (usage, pinned int64, err error) {
 	shouldAggro := m.shouldAggro(op, config, diskspaceutil.Usage)
 	customPolicyBasedCleanup := shouldAggro && customPolicy != nil && config.AggressiveLowerThreshold != 0
 
@@ -206,14 +210,14 @@ func (m *cleanupManager) cleanup(op base.FileOp, config CleanupConfig, customPol
 	return m.ttlBasedCleanup(op, config.TTI, ttl, lowerThreshold, diskspaceutil.Usage)
 }
 
-func (m *cleanupManager) customPolicyBasedCleanup(op base.FileOp, config CleanupConfig, customPolicy func(a, b fInfo) int, diskUsageFn diskUsageFn) (usage int64, err error) {
+func (m *cleanupManager) customPolicyBasedCleanup(op base.FileOp, config CleanupConfig, customPolicy func(a, b fInfo) int, diskUsageFn diskUsageFn) (usage, pinned int64, err error) {
 	names, err := op.ListNames()
 	if err != nil {
-		return 0, fmt.Errorf("list names: %s", err)
+		return 0, 0, fmt.Errorf("list names: %s", err)
 	}
 
 	var fInfos []fInfo
-	var totalUsage int64
+	var totalUsage, pinnedUsage int64
 	for _, name := range names {
 		fStat, err := op.GetFileStat(name)
 		if err != nil {
@@ -226,6 +230,10 @@ func (m *cleanupManager) customPolicyBasedCleanup(op base.FileOp, config Cleanup
 			size:         fStat.Size(),
 		}
 		totalUsage += fStat.Size()
+		if isPinned(op, name) {
+			pinnedUsage += fStat.Size()
+			continue
+		}
 
 		var accessTime metadata.LastAccessTime
 		err = op.GetFileMetadata(name, &accessTime)
@@ -244,7 +252,7 @@ func (m *cleanupManager) customPolicyBasedCleanup(op base.FileOp, config Cleanup
 
 	dInfo, err := diskUsageFn()
 	if err != nil {
-		return 0, fmt.Errorf("get disk usage info %s: %s", op, err)
+		return 0, 0, fmt.Errorf("get disk usage info %s: %s", op, err)
 	}
 
 	minBytes := dInfo.TotalBytes * uint64(config.AggressiveLowerThreshold) / 100
@@ -254,19 +262,19 @@ func (m *cleanupManager) customPolicyBasedCleanup(op base.FileOp, config Cleanup
 		if remainDeleteBytes <= 0 {
 			break
 		}
-		err := op.DeleteFile(file.name)
-		if err != nil && err != base.ErrFilePersisted {
+		err := op.DeleteIfUnreferenced(file.name, false)
+		if err != nil && err != base.ErrFilePersisted && err != base.ErrFilePinned && !base.IsFileInUseError(err) {
 			log.With("name", file.name).Errorf("Error deleting expired file: %s", err)
 		}
 		if err == nil {
 			remainDeleteBytes -= file.size
 		}
 	}
-	return totalUsage, nil
+	return totalUsage, pinnedUsage, nil
 }
 
 func (m *cleanupManager) ttlBasedCleanup(
-	op base.FileOp, tti time.Duration, ttl time.Duration, aggroUtilLowerThreshold int, diskUsageFn diskUsageFn) (scannedBytes int64, err error) {
+	op base.FileOp, tti time.Duration, ttl time.Duration, aggroUtilLowerThreshold int, diskUsageFn diskUsageFn) (scannedBytes, pinnedBytes int64, err error) {
 
 	var lowThresholdBytes uint64 = 0
 	respectLowThreshold := false
@@ -283,7 +291,7 @@ func (m *cleanupManager) ttlBasedCleanup(
 
 	names, err := op.ListNames()
 	if err != nil {
-		return 0, fmt.Errorf("list names: %s", err)
+		return 0, 0, fmt.Errorf("list names: %s", err)
 	}
 	for _, name := range names {
 		info, err := op.GetFileStat(name)
@@ -291,6 +299,11 @@ func (m *cleanupManager) ttlBasedCleanup(
 			log.With("name", name).Errorf("Error getting file stat: %s", err)
 			continue
 		}
+		if isPinned(op, name) {
+			pinnedBytes += info.Size()
+			scannedBytes += info.Size()
+			continue
+		}
 		ready, err := m.readyForDeletion(op, name, info, tti, ttl)
 		if err != nil {
 			log.With("name", name).Errorf("Error checking if file expired: %s", err)
@@ -298,13 +311,20 @@ func (m *cleanupManager) ttlBasedCleanup(
 
 		lowThresholdBreached := respectLowThreshold && ((dInfo.UsedBytes - uint64(scannedBytes)) <= lowThresholdBytes)
 		if ready && !lowThresholdBreached {
-			if err := op.DeleteFile(name); err != nil && err != base.ErrFilePersisted {
+			err := op.DeleteIfUnreferenced(name, false)
+			if err != nil && err != base.ErrFilePersisted && err != base.ErrFilePinned && !base.IsFileInUseError(err) {
 				log.With("name", name).Errorf("Error deleting expired file: %s", err)
 			}
 		}
 		scannedBytes += info.Size()
 	}
-	return scannedBytes, nil
+	return scannedBytes, pinnedBytes, nil
+}
+
+// isPinned returns true if any namespace pinned the file of name.
+func isPinned(op base.FileOp, name string) bool {
+	var pin metadata.Pin
+	return op.GetFileMetadata(name, &pin) == nil && pin.Pinned()
 }
 
 func (m *cleanupManager) readyForDeletion(
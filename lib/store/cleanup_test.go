@@ -113,7 +113,7 @@ func TestCleanupManagerDeleteIdleFiles(t *testing.T) {
 		require.NoError(op.CreateFile(name, state, 0))
 	}
 
-	_, err = m.cleanup(op, config, nil)
+	_, _, err = m.cleanup(op, config, nil)
 	require.NoError(err)
 
 	for _, name := range idle {
@@ -126,6 +126,43 @@ func TestCleanupManagerDeleteIdleFiles(t *testing.T) {
 	}
 }
 
+func TestCleanupManagerSkipsPinnedFiles(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	config := CleanupConfig{
+		TTI: 6 * time.Hour,
+		TTL: 24 * time.Hour,
+	}
+
+	m, err := newCleanupManager(clk, tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	state, op, cleanup := fileOpFixture(clk)
+	defer cleanup()
+
+	pinned := core.DigestFixture().Hex()
+	expired := core.DigestFixture().Hex()
+	require.NoError(op.CreateFile(pinned, state, 10))
+	require.NoError(op.CreateFile(expired, state, 20))
+	_, err = op.SetFileMetadata(pinned, metadata.NewPin("library/base"))
+	require.NoError(err)
+
+	clk.Add(config.TTL + 1)
+
+	usage, pinnedUsage, err := m.cleanup(op, config, nil)
+	require.NoError(err)
+	require.Equal(int64(30), usage)
+	require.Equal(int64(10), pinnedUsage)
+
+	_, err = op.GetFileStat(pinned)
+	require.NoError(err)
+	_, err = op.GetFileStat(expired)
+	require.True(os.IsNotExist(err))
+}
+
 func TestCleanupManagerDeleteExpiredFiles(t *testing.T) {
 	require := require.New(t)
 
@@ -151,7 +188,7 @@ func TestCleanupManagerDeleteExpiredFiles(t *testing.T) {
 		require.NoError(op.CreateFile(name, state, 0))
 	}
 
-	_, err = m.cleanup(op, config, nil)
+	_, _, err = m.cleanup(op, config, nil)
 	require.NoError(err)
 
 	for _, name := range names {
@@ -161,7 +198,7 @@ func TestCleanupManagerDeleteExpiredFiles(t *testing.T) {
 
 	clk.Add(config.TTL + 1)
 
-	_, err = m.cleanup(op, config, nil)
+	_, _, err = m.cleanup(op, config, nil)
 	require.NoError(err)
 
 	for _, name := range names {
@@ -207,7 +244,7 @@ func TestCleanupManagerSkipsPersistedFiles(t *testing.T) {
 
 	clk.Add(config.TTI + 1)
 
-	_, err = m.cleanup(op, config, nil)
+	_, _, err = m.cleanup(op, config, nil)
 	require.NoError(err)
 
 	for _, name := range idle {
@@ -240,7 +277,7 @@ func TestCleanupManageDiskUsage(t *testing.T) {
 		TTI: 1 * time.Hour,
 		TTL: 1 * time.Hour,
 	}
-	usage, err := m.cleanup(op, config, nil)
+	usage, _, err := m.cleanup(op, config, nil)
 	require.NoError(err)
 	require.Equal(int64(500), usage)
 }
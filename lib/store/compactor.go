@@ -0,0 +1,165 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// CompactionConfig defines configuration for compressing cache files which
+// have not been accessed for a while. Compressed files are decompressed
+// transparently on their next read.
+type CompactionConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"` // How often a compaction cycle runs.
+
+	// ColdAfter is how long a file must go unaccessed before it is compressed.
+	ColdAfter time.Duration `yaml:"cold_after"`
+
+	// Files smaller than MinSize are left uncompressed.
+	MinSize datasize.ByteSize `yaml:"min_size"`
+}
+
+func (c CompactionConfig) applyDefaults() CompactionConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Hour
+	}
+	if c.ColdAfter == 0 {
+		c.ColdAfter = 7 * 24 * time.Hour
+	}
+	return c
+}
+
+// compactor periodically compresses files in op whose last access time is
+// older than ColdAfter.
+type compactor struct {
+	config CompactionConfig
+	clk    clock.Clock
+	stats  tally.Scope
+	op     base.FileOp
+
+	stopOnce sync.Once
+	stopc    chan struct{}
+}
+
+func newCompactor(
+	config CompactionConfig, op base.FileOp, clk clock.Clock, stats tally.Scope) *compactor {
+
+	return &compactor{
+		config: config.applyDefaults(),
+		clk:    clk,
+		stats: stats.Tagged(map[string]string{
+			"module": "storecompactor",
+		}),
+		op:    op,
+		stopc: make(chan struct{}),
+	}
+}
+
+func (c *compactor) start() {
+	ticker := c.clk.Ticker(c.config.Interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.compact(); err != nil {
+					log.Errorf("Error compacting %s: %s", c.op, err)
+				}
+			case <-c.stopc:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (c *compactor) stop() {
+	c.stopOnce.Do(func() { close(c.stopc) })
+}
+
+// compact runs one compaction cycle.
+func (c *compactor) compact() error {
+	names, err := c.op.ListNames()
+	if err != nil {
+		return fmt.Errorf("list names: %s", err)
+	}
+	for _, name := range names {
+		select {
+		case <-c.stopc:
+			return nil
+		default:
+		}
+		c.compactFile(name)
+	}
+	return nil
+}
+
+func (c *compactor) compactFile(name string) {
+	cold, err := c.isCold(name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.With("name", name).Errorf("Error checking file for compaction: %s", err)
+			c.stats.Counter("compaction_errors").Inc(1)
+		}
+		return
+	}
+	if !cold {
+		return
+	}
+	if err := c.op.CompressFile(name); err != nil {
+		if !os.IsNotExist(err) && !base.IsFileInUseError(err) {
+			log.With("name", name).Errorf("Error compressing file: %s", err)
+			c.stats.Counter("compaction_errors").Inc(1)
+		}
+		return
+	}
+	c.stats.Counter("compressed").Inc(1)
+}
+
+// isCold returns true if name is uncompressed, large enough and has not been
+// accessed for ColdAfter.
+func (c *compactor) isCold(name string) (bool, error) {
+	if err := c.op.GetFileMetadata(name, metadata.NewCompressed(0)); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	info, err := c.op.GetFileStat(name)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() < int64(c.config.MinSize) {
+		return false, nil
+	}
+	var lat metadata.LastAccessTime
+	if err := c.op.GetFileMetadata(name, &lat); err != nil {
+		if os.IsNotExist(err) {
+			// Files which were never accessed are aged by their creation.
+			return c.clk.Now().Sub(info.ModTime()) >= c.config.ColdAfter, nil
+		}
+		return false, err
+	}
+	return c.clk.Now().Sub(lat.Time) >= c.config.ColdAfter, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestCompactorCompressesColdFiles(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	clk := clock.New()
+	config := CompactionConfig{ColdAfter: time.Hour}
+
+	cold := core.SizedBlobFixture(4096, 8)
+	require.NoError(s.CreateCacheFile(cold.Digest.Hex(), bytes.NewReader(cold.Content)))
+	_, err := s.cacheStore.newFileOp().SetFileMetadata(
+		cold.Digest.Hex(), metadata.NewLastAccessTime(clk.Now().Add(-2*time.Hour)))
+	require.NoError(err)
+
+	hot := core.SizedBlobFixture(4096, 8)
+	require.NoError(s.CreateCacheFile(hot.Digest.Hex(), bytes.NewReader(hot.Content)))
+	_, err = s.cacheStore.newFileOp().SetFileMetadata(
+		hot.Digest.Hex(), metadata.NewLastAccessTime(clk.Now()))
+	require.NoError(err)
+
+	c := newCompactor(config, s.cacheStore.newFileOp(), clk, tally.NoopScope)
+	require.NoError(c.compact())
+
+	require.NoError(s.GetCacheFileMetadata(cold.Digest.Hex(), metadata.NewCompressed(0)))
+	require.True(os.IsNotExist(s.GetCacheFileMetadata(hot.Digest.Hex(), metadata.NewCompressed(0))))
+
+	// Compaction does not refresh last access time.
+	var lat metadata.LastAccessTime
+	require.NoError(s.GetCacheFileMetadata(cold.Digest.Hex(), &lat))
+	require.True(clk.Now().Sub(lat.Time) > time.Hour)
+
+	r, err := s.GetCacheFileReader(cold.Digest.Hex())
+	require.NoError(err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(err)
+	require.Equal(cold.Content, data)
+	require.True(os.IsNotExist(s.GetCacheFileMetadata(cold.Digest.Hex(), metadata.NewCompressed(0))))
+}
+
+func TestCompactorSkipsSmallFiles(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	clk := clock.New()
+	config := CompactionConfig{ColdAfter: time.Hour, MinSize: 1024}
+
+	blob := core.SizedBlobFixture(256, 8)
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	_, err := s.cacheStore.newFileOp().SetFileMetadata(
+		blob.Digest.Hex(), metadata.NewLastAccessTime(clk.Now().Add(-2*time.Hour)))
+	require.NoError(err)
+
+	c := newCompactor(config, s.cacheStore.newFileOp(), clk, tally.NoopScope)
+	require.NoError(c.compact())
+
+	require.True(os.IsNotExist(s.GetCacheFileMetadata(blob.Digest.Hex(), metadata.NewCompressed(0))))
+}
@@ -15,6 +15,9 @@ package store
 
 import (
 	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/uber/kraken/lib/store/base"
 )
 
 // Volume - if provided, volumes are used to store the actual files.
@@ -37,20 +40,79 @@ type MemoryCacheConfig struct {
 
 // CAStoreConfig defines CAStore configuration.
 type CAStoreConfig struct {
-	UploadDir     string        `yaml:"upload_dir"`
-	CacheDir      string        `yaml:"cache_dir"`
-	Volumes       []Volume      `yaml:"volumes"`
-	Capacity      int           `yaml:"capacity"`
-	UploadCleanup CleanupConfig `yaml:"upload_cleanup"`
-	CacheCleanup  CleanupConfig `yaml:"cache_cleanup"`
+	UploadDir     string             `yaml:"upload_dir"`
+	CacheDir      string             `yaml:"cache_dir"`
+	Volumes       []Volume           `yaml:"volumes"`
+	VolumeHealth  VolumeHealthConfig `yaml:"volume_health"`
+	Capacity      int                `yaml:"capacity"`
+	UploadCleanup CleanupConfig      `yaml:"upload_cleanup"`
+	CacheCleanup  CleanupConfig      `yaml:"cache_cleanup"`
 	// Part size limit for each file read. 0 means no limit.
 	ReadPartSize int `yaml:"read_part_size"`
 	// Part size limit for each file write. 0 means no limit.
 	WritePartSize int `yaml:"write_part_size"`
 
+	// CapacityBytes limits the total size of cache files tracked by the LRU
+	// map. Once exceeded, least recently accessed files are evicted regardless
+	// of Capacity. 0 means no limit.
+	CapacityBytes datasize.ByteSize `yaml:"capacity_bytes"`
+
+	// ReplacementPolicy selects which cache files are evicted first once
+	// capacity is reached. Supports "lru" (default) and "slru".
+	ReplacementPolicy base.ReplacementPolicy `yaml:"replacement_policy"`
+
+	// LastAccessTimeFlushInterval batches last access time updates of cache
+	// files in memory and persists them once per interval and when the store
+	// is closed. 0 writes them through on every access.
+	LastAccessTimeFlushInterval time.Duration `yaml:"last_access_time_flush_interval"`
+
+	// Durability selects which upload and cache writes are fsync'ed: "none"
+	// (default), "metadata" or "always". "always" guarantees files which
+	// survive power loss are complete, at the cost of write latency.
+	Durability base.Durability `yaml:"durability"`
+
+	Scrubber ScrubberConfig `yaml:"scrubber"`
+
+	// IndexedMetadata lists suffixes of metadata types, e.g. "_persist", whose
+	// content is indexed in memory so cache files can be found by metadata
+	// without reading from disk. If set, all cache files are loaded into
+	// memory on startup to build the index.
+	IndexedMetadata []string `yaml:"indexed_metadata"`
+
+	// Trash delays the deletion of cache files.
+	Trash TrashConfig `yaml:"trash"`
+
+	// Compaction compresses cache files which have not been accessed for a
+	// while. Not supported together with Encryption.
+	Compaction CompactionConfig `yaml:"compaction"`
+
 	SkipHashVerification bool `yaml:"skip_hash_verification"`
 
+	// VerifyCacheReads verifies cache file content against its digest while
+	// it is being read, so on-disk corruption surfaces as a read error.
+	VerifyCacheReads bool `yaml:"verify_cache_reads"`
+
+	// StreamingReadThreshold opens cache files of at least this size for
+	// sequential reads and drops their pages from the OS page cache once the
+	// reader is closed, so streaming large blobs does not evict hot small
+	// blobs. Only effective on linux. 0 disables.
+	StreamingReadThreshold datasize.ByteSize `yaml:"streaming_read_threshold"`
+
+	// ReadaheadSize makes cache file readers prefetch this many bytes
+	// following each ReadAt in the background, so sequential piece reads
+	// overlap with sending the previous piece. 0 disables.
+	ReadaheadSize datasize.ByteSize `yaml:"readahead_size"`
+
 	MemoryCache MemoryCacheConfig `yaml:"memory_cache"`
+
+	// Quota limits the total size of cache files. 0 means no limit.
+	Quota datasize.ByteSize `yaml:"quota"`
+	// EvictOnQuota deletes least recently accessed cache files synchronously
+	// when Quota would be exceeded, instead of failing.
+	EvictOnQuota bool `yaml:"evict_on_quota"`
+
+	// Encryption encrypts upload and cache files at rest.
+	Encryption EncryptionConfig `yaml:"encryption"`
 }
 
 func (c CAStoreConfig) applyDefaults() CAStoreConfig {
@@ -82,6 +144,10 @@ type SimpleStoreConfig struct {
 	ReadPartSize int `yaml:"read_part_size"`
 	// Part size limit for each file write. 0 means no limit.
 	WritePartSize int `yaml:"write_part_size"`
+
+	// Durability selects which upload and cache writes are fsync'ed. See
+	// CAStoreConfig.Durability.
+	Durability base.Durability `yaml:"durability"`
 }
 
 // CADownloadStoreConfig defines CADownloadStore configuration.
@@ -95,4 +161,15 @@ type CADownloadStoreConfig struct {
 	ReadPartSize int `yaml:"read_part_size"`
 	// Part size limit for each file write. 0 means no limit.
 	WritePartSize int `yaml:"write_part_size"`
+
+	// ReadaheadSize makes download and cache file readers prefetch this many
+	// bytes following each ReadAt in the background. 0 disables.
+	ReadaheadSize datasize.ByteSize `yaml:"readahead_size"`
+
+	// Encryption encrypts download and cache files at rest.
+	Encryption EncryptionConfig `yaml:"encryption"`
+
+	// Durability selects which download and cache writes are fsync'ed. See
+	// CAStoreConfig.Durability.
+	Durability base.Durability `yaml:"durability"`
 }
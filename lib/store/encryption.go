@@ -0,0 +1,82 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/uber/kraken/lib/store/base"
+)
+
+// EncryptionConfig defines configuration for encrypting file contents at rest.
+// Files are still addressed by the digest of their plaintext.
+type EncryptionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// KeyFile contains a raw 16, 24 or 32 byte AES key.
+	KeyFile string `yaml:"key_file"`
+
+	// KeyProvider is the name of a provider registered via
+	// RegisterKeyProvider, e.g. one backed by an external KMS. Takes
+	// precedence over KeyFile.
+	KeyProvider string `yaml:"key_provider"`
+}
+
+// KeyProvider supplies the key used to encrypt file contents at rest.
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+var (
+	keyProvidersMu sync.RWMutex
+	keyProviders   = make(map[string]KeyProvider)
+)
+
+// RegisterKeyProvider makes p available to EncryptionConfig under name. It is
+// meant to be called during initialization, before any store is created.
+func RegisterKeyProvider(name string, p KeyProvider) {
+	keyProvidersMu.Lock()
+	defer keyProvidersMu.Unlock()
+
+	keyProviders[name] = p
+}
+
+// cipher returns the cipher configured by c, or nil if encryption is disabled.
+func (c EncryptionConfig) cipher() (*base.Cipher, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	var key []byte
+	var err error
+	switch {
+	case c.KeyProvider != "":
+		keyProvidersMu.RLock()
+		p, ok := keyProviders[c.KeyProvider]
+		keyProvidersMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown key provider %q", c.KeyProvider)
+		}
+		key, err = p.Key()
+	case c.KeyFile != "":
+		key, err = os.ReadFile(c.KeyFile)
+	default:
+		return nil, fmt.Errorf("no key_file or key_provider configured")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load key: %s", err)
+	}
+	return base.NewCipher(key)
+}
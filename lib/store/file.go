@@ -13,10 +13,20 @@
 // limitations under the License.
 package store
 
-import "github.com/uber/kraken/lib/store/base"
+import (
+	"io"
+
+	"github.com/uber/kraken/lib/store/base"
+)
 
 // FileReadWriter is a readable, writable file.
 type FileReadWriter = base.FileReadWriter
 
 // FileReader is a read-only file.
 type FileReader = base.FileReader
+
+// CopyN copies n bytes from r to w, without passing them through user space
+// where possible. See base.CopyN.
+func CopyN(w io.Writer, r FileReader, n int64) (int64, error) {
+	return base.CopyN(w, r, n)
+}
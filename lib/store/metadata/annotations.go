@@ -0,0 +1,137 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+const _annotationsSuffix = "_annotations"
+
+// Annotation limits. Annotations are stored alongside every replica of a
+// blob, so they must stay small.
+const (
+	MaxAnnotations           = 64
+	MaxAnnotationKeyLength   = 128
+	MaxAnnotationValueLength = 1024
+)
+
+// ErrInvalidAnnotations is returned when annotations exceed limits or have
+// malformed keys.
+var ErrInvalidAnnotations = errors.New("invalid annotations")
+
+var _annotationKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]*$`)
+
+func init() {
+	RegisterWithCodec(regexp.MustCompile(_annotationsSuffix), &annotationsFactory{}, JSONCodec{})
+}
+
+type annotationsFactory struct{}
+
+func (f annotationsFactory) Create(suffix string) Metadata {
+	return &Annotations{}
+}
+
+// Annotations are small key-value pairs attached to a blob, e.g. provenance,
+// build id or source registry.
+type Annotations struct {
+	Values map[string]string
+}
+
+// NewAnnotations creates a new Annotations.
+func NewAnnotations(values map[string]string) *Annotations {
+	m := &Annotations{Values: make(map[string]string)}
+	for k, v := range values {
+		m.Values[k] = v
+	}
+	return m
+}
+
+// Update sets the annotations of values, and removes the annotations whose
+// value is empty. Returns an error wrapping ErrInvalidAnnotations, and leaves
+// m unchanged, if a key or value is malformed or too many annotations would
+// be set.
+func (m *Annotations) Update(values map[string]string) error {
+	for k, v := range values {
+		if len(k) > MaxAnnotationKeyLength || !_annotationKeyRegexp.MatchString(k) {
+			return fmt.Errorf("%w: malformed key %q", ErrInvalidAnnotations, k)
+		}
+		if len(v) > MaxAnnotationValueLength {
+			return fmt.Errorf("%w: value of %q exceeds %d bytes", ErrInvalidAnnotations, k, MaxAnnotationValueLength)
+		}
+	}
+	n := len(m.Values)
+	for k, v := range values {
+		_, ok := m.Values[k]
+		if v == "" && ok {
+			n--
+		} else if v != "" && !ok {
+			n++
+		}
+	}
+	if n > MaxAnnotations {
+		return fmt.Errorf("%w: more than %d annotations", ErrInvalidAnnotations, MaxAnnotations)
+	}
+	if m.Values == nil {
+		m.Values = make(map[string]string)
+	}
+	for k, v := range values {
+		if v == "" {
+			delete(m.Values, k)
+		} else {
+			m.Values[k] = v
+		}
+	}
+	return nil
+}
+
+// Keys returns the sorted keys of m.
+func (m *Annotations) Keys() []string {
+	keys := make([]string, 0, len(m.Values))
+	for k := range m.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetSuffix returns a static suffix.
+func (m *Annotations) GetSuffix() string {
+	return _annotationsSuffix
+}
+
+// Movable is true.
+func (m *Annotations) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Annotations) Serialize() ([]byte, error) {
+	return Encode(m, 1, m.Values)
+}
+
+// Deserialize loads b into m.
+func (m *Annotations) Deserialize(b []byte) error {
+	m.Values = nil
+	if _, err := Decode(m, b, &m.Values); err != nil {
+		return err
+	}
+	if m.Values == nil {
+		m.Values = make(map[string]string)
+	}
+	return nil
+}
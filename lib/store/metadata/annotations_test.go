@@ -0,0 +1,73 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationsSerialization(t *testing.T) {
+	require := require.New(t)
+
+	a := NewAnnotations(map[string]string{
+		"build_id": "1234",
+		"source":   "docker.io/library/base",
+	})
+	b, err := a.Serialize()
+	require.NoError(err)
+
+	var result Annotations
+	require.NoError(result.Deserialize(b))
+	require.Equal(a.Values, result.Values)
+	require.Equal([]string{"build_id", "source"}, result.Keys())
+}
+
+func TestAnnotationsUpdate(t *testing.T) {
+	require := require.New(t)
+
+	var a Annotations
+	require.NoError(a.Update(map[string]string{"a": "1", "b": "2"}))
+	require.NoError(a.Update(map[string]string{"a": "", "c": "3"}))
+	require.Equal(map[string]string{"b": "2", "c": "3"}, a.Values)
+}
+
+func TestAnnotationsUpdateInvalid(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxAnnotations; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "v"
+	}
+	tests := []struct {
+		desc   string
+		values map[string]string
+	}{
+		{"empty key", map[string]string{"": "v"}},
+		{"malformed key", map[string]string{"foo bar": "v"}},
+		{"key too long", map[string]string{strings.Repeat("k", MaxAnnotationKeyLength+1): "v"}},
+		{"value too long", map[string]string{"k": strings.Repeat("v", MaxAnnotationValueLength+1)}},
+		{"too many", tooMany},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			a := NewAnnotations(map[string]string{"a": "1"})
+			require.ErrorIs(a.Update(test.values), ErrInvalidAnnotations)
+			require.Equal(map[string]string{"a": "1"}, a.Values)
+		})
+	}
+}
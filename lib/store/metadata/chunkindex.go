@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+
+	"github.com/uber/kraken/lib/delta"
+)
+
+const _chunkIndexSuffix = "_chunkindex"
+
+func init() {
+	Register(regexp.MustCompile(_chunkIndexSuffix), &chunkIndexFactory{})
+}
+
+type chunkIndexFactory struct{}
+
+func (f chunkIndexFactory) Create(suffix string) Metadata {
+	return &ChunkIndex{}
+}
+
+// ChunkIndex wraps the content-defined chunk index of a blob as metadata.
+type ChunkIndex struct {
+	Index *delta.Index
+}
+
+// NewChunkIndex returns a new ChunkIndex.
+func NewChunkIndex(idx *delta.Index) *ChunkIndex {
+	return &ChunkIndex{idx}
+}
+
+// GetSuffix returns a static suffix.
+func (m *ChunkIndex) GetSuffix() string {
+	return _chunkIndexSuffix
+}
+
+// Movable is true.
+func (m *ChunkIndex) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *ChunkIndex) Serialize() ([]byte, error) {
+	return m.Index.Serialize()
+}
+
+// Deserialize loads b into m.
+func (m *ChunkIndex) Deserialize(b []byte) error {
+	idx, err := delta.DeserializeIndex(b)
+	if err != nil {
+		return err
+	}
+	m.Index = idx
+	return nil
+}
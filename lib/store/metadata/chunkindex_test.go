@@ -0,0 +1,37 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/lib/delta"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkIndexSerialization(t *testing.T) {
+	require := require.New(t)
+
+	ci := NewChunkIndex(&delta.Index{Chunks: []delta.Chunk{
+		{Offset: 0, Length: 10, Sum: "a"},
+		{Offset: 10, Length: 5, Sum: "b"},
+	}})
+	b, err := ci.Serialize()
+	require.NoError(err)
+
+	var result ChunkIndex
+	require.NoError(result.Deserialize(b))
+	require.Equal(ci.Index, result.Index)
+}
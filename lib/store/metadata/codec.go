@@ -0,0 +1,170 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var _codecs = make(map[*regexp.Regexp]Codec)
+
+// Codec converts structured metadata values to and from bytes. Metadata types
+// which register a Codec can evolve their schema without hand-rolling a binary
+// format, by relying on the codec's own compatibility rules plus a version
+// number stored alongside the payload.
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+}
+
+// Codec errors.
+var (
+	ErrNoCodec         = errors.New("no codec registered")
+	ErrEmptyPayload    = errors.New("empty payload")
+	ErrNotProtoMessage = errors.New("value is not a proto.Message")
+)
+
+var _ Codec = JSONCodec{}
+var _ Codec = ProtoCodec{}
+var _ Codec = MsgpackCodec{}
+
+// RegisterWithCodec registers new Factory with corresponding suffix regexp, and
+// the Codec which Metadata created by factory uses for serialization.
+func RegisterWithCodec(suffix *regexp.Regexp, factory Factory, codec Codec) {
+	Register(suffix, factory)
+	_codecs[suffix] = codec
+}
+
+// GetCodec returns the Codec registered for suffix, or nil if the metadata type
+// uses a raw byte format.
+func GetCodec(suffix string) Codec {
+	for re, codec := range _codecs {
+		if re.MatchString(suffix) {
+			return codec
+		}
+	}
+	return nil
+}
+
+// Encode serializes v with the codec registered for md, prefixed by a single
+// schema version byte. Intended to be called from Metadata.Serialize.
+func Encode(md Metadata, version uint8, v interface{}) ([]byte, error) {
+	codec := GetCodec(md.GetSuffix())
+	if codec == nil {
+		return nil, ErrNoCodec
+	}
+	b, err := codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s marshal: %s", codec.Name(), err)
+	}
+	return append([]byte{version}, b...), nil
+}
+
+// Decode deserializes b, as produced by Encode, into v with the codec
+// registered for md. Returns the schema version b was written with, so callers
+// can migrate older payloads. Intended to be called from Metadata.Deserialize.
+func Decode(md Metadata, b []byte, v interface{}) (version uint8, err error) {
+	codec := GetCodec(md.GetSuffix())
+	if codec == nil {
+		return 0, ErrNoCodec
+	}
+	if len(b) == 0 {
+		return 0, ErrEmptyPayload
+	}
+	if err := codec.Unmarshal(b[1:], v); err != nil {
+		return 0, fmt.Errorf("%s unmarshal: %s", codec.Name(), err)
+	}
+	return b[0], nil
+}
+
+// JSONCodec serializes values as JSON.
+type JSONCodec struct{}
+
+// Name returns "json".
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+// Marshal converts v to JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal loads JSON b into v.
+func (JSONCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+// ProtoCodec serializes values in protobuf wire format. Values must implement
+// proto.Message.
+type ProtoCodec struct{}
+
+// Name returns "proto".
+func (ProtoCodec) Name() string {
+	return "proto"
+}
+
+// Marshal converts v to protobuf wire format.
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal loads protobuf b into v.
+func (ProtoCodec) Unmarshal(b []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(b, m)
+}
+
+// MsgpackCodec serializes values as MessagePack. Struct fields without a
+// msgpack tag are named by their json tag, so payloads can move between
+// JSONCodec and MsgpackCodec.
+type MsgpackCodec struct{}
+
+// Name returns "msgpack".
+func (MsgpackCodec) Name() string {
+	return "msgpack"
+}
+
+// Marshal converts v to MessagePack.
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal loads MessagePack b into v.
+func (MsgpackCodec) Unmarshal(b []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	_mockCodecSuffix        = "_mockcodec"
+	_mockMsgpackCodecSuffix = "_mockmsgpackcodec"
+)
+
+func init() {
+	RegisterWithCodec(regexp.MustCompile(_mockCodecSuffix), &mockCodecFactory{}, JSONCodec{})
+	RegisterWithCodec(regexp.MustCompile(_mockMsgpackCodecSuffix), &mockMsgpackCodecFactory{}, MsgpackCodec{})
+}
+
+type mockCodecFactory struct{}
+
+func (f mockCodecFactory) Create(suffix string) Metadata {
+	return &mockCodecMetadata{}
+}
+
+type mockCodecPayloadV1 struct {
+	Name string `json:"name"`
+}
+
+type mockCodecPayloadV2 struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// mockCodecMetadata stores a v2 payload and upgrades v1 payloads on read.
+type mockCodecMetadata struct {
+	Version uint8
+	Payload mockCodecPayloadV2
+}
+
+func (m *mockCodecMetadata) GetSuffix() string { return _mockCodecSuffix }
+func (m *mockCodecMetadata) Movable() bool     { return true }
+
+func (m *mockCodecMetadata) Serialize() ([]byte, error) {
+	return Encode(m, 2, &m.Payload)
+}
+
+func (m *mockCodecMetadata) Deserialize(b []byte) error {
+	v, err := Decode(m, b, &m.Payload)
+	if err != nil {
+		return err
+	}
+	m.Version = v
+	if v < 2 {
+		m.Payload.Count = 1
+	}
+	return nil
+}
+
+func TestCodecMetadataSerialization(t *testing.T) {
+	require := require.New(t)
+
+	md := CreateFromSuffix(_mockCodecSuffix)
+	require.NotNil(md)
+	require.Equal("json", GetCodec(md.GetSuffix()).Name())
+
+	m := md.(*mockCodecMetadata)
+	m.Payload = mockCodecPayloadV2{Name: "foo", Count: 3}
+	b, err := m.Serialize()
+	require.NoError(err)
+
+	var result mockCodecMetadata
+	require.NoError(result.Deserialize(b))
+	require.Equal(uint8(2), result.Version)
+	require.Equal(m.Payload, result.Payload)
+}
+
+func TestCodecMetadataSchemaEvolution(t *testing.T) {
+	require := require.New(t)
+
+	var m mockCodecMetadata
+	b, err := Encode(&m, 1, &mockCodecPayloadV1{Name: "foo"})
+	require.NoError(err)
+
+	require.NoError(m.Deserialize(b))
+	require.Equal(uint8(1), m.Version)
+	require.Equal(mockCodecPayloadV2{Name: "foo", Count: 1}, m.Payload)
+}
+
+func TestCodecErrors(t *testing.T) {
+	require := require.New(t)
+
+	_, err := Encode(NewPersist(true), 1, true)
+	require.Equal(ErrNoCodec, err)
+
+	var m mockCodecMetadata
+	require.Equal(ErrEmptyPayload, m.Deserialize(nil))
+}
+
+func TestProtoCodec(t *testing.T) {
+	require := require.New(t)
+
+	c := ProtoCodec{}
+	b, err := c.Marshal(&wrappers.StringValue{Value: "foo"})
+	require.NoError(err)
+
+	var result wrappers.StringValue
+	require.NoError(c.Unmarshal(b, &result))
+	require.Equal("foo", result.Value)
+
+	_, err = c.Marshal("foo")
+	require.Equal(ErrNotProtoMessage, err)
+}
+
+type mockMsgpackCodecFactory struct{}
+
+func (f mockMsgpackCodecFactory) Create(suffix string) Metadata {
+	return &mockMsgpackCodecMetadata{}
+}
+
+// mockMsgpackCodecMetadata stores the same payload as mockCodecMetadata with
+// MsgpackCodec.
+type mockMsgpackCodecMetadata struct {
+	mockCodecMetadata
+}
+
+func (m *mockMsgpackCodecMetadata) GetSuffix() string { return _mockMsgpackCodecSuffix }
+
+func TestMsgpackCodecMetadataSerialization(t *testing.T) {
+	require := require.New(t)
+
+	md := CreateFromSuffix(_mockMsgpackCodecSuffix)
+	require.NotNil(md)
+	require.Equal("msgpack", GetCodec(md.GetSuffix()).Name())
+
+	m := md.(*mockMsgpackCodecMetadata)
+	m.Payload = mockCodecPayloadV2{Name: "foo", Count: 3}
+	b, err := Encode(m, 2, &m.Payload)
+	require.NoError(err)
+
+	var result mockMsgpackCodecMetadata
+	v, err := Decode(&result, b, &result.Payload)
+	require.NoError(err)
+	require.Equal(uint8(2), v)
+	require.Equal(m.Payload, result.Payload)
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	require := require.New(t)
+
+	c := MsgpackCodec{}
+	b, err := c.Marshal(&mockCodecPayloadV2{Name: "foo", Count: 3})
+	require.NoError(err)
+
+	// Fields are named by their json tags.
+	var fields map[string]interface{}
+	require.NoError(c.Unmarshal(b, &fields))
+	require.Equal(map[string]interface{}{"name": "foo", "count": int8(3)}, fields)
+
+	// Unknown fields are ignored, so payloads can evolve.
+	var v1 mockCodecPayloadV1
+	require.NoError(c.Unmarshal(b, &v1))
+	require.Equal(mockCodecPayloadV1{Name: "foo"}, v1)
+
+	require.Error(c.Unmarshal([]byte{0xc1}, &v1))
+}
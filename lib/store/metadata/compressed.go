@@ -0,0 +1,72 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+	"strconv"
+)
+
+const _compressedSuffix = "_compressed"
+
+func init() {
+	Register(regexp.MustCompile(_compressedSuffix), &compressedFactory{})
+}
+
+type compressedFactory struct{}
+
+func (f compressedFactory) Create(suffix string) Metadata {
+	return &Compressed{}
+}
+
+// Compressed marks a blob whose data is stored compressed on disk.
+type Compressed struct {
+	// Size is the size of the uncompressed blob.
+	Size int64
+}
+
+// NewCompressed creates a new Compressed for a blob of given uncompressed size.
+func NewCompressed(size int64) *Compressed {
+	return &Compressed{size}
+}
+
+// GetCompressedSuffix returns the suffix of Compressed metadata.
+func GetCompressedSuffix() string {
+	return _compressedSuffix
+}
+
+// GetSuffix returns a static suffix.
+func (m *Compressed) GetSuffix() string {
+	return _compressedSuffix
+}
+
+// Movable is true.
+func (m *Compressed) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Compressed) Serialize() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.Size, 10)), nil
+}
+
+// Deserialize loads b into m.
+func (m *Compressed) Deserialize(b []byte) error {
+	v, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return err
+	}
+	m.Size = v
+	return nil
+}
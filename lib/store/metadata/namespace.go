@@ -0,0 +1,59 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import "regexp"
+
+const _namespaceSuffix = "_namespace"
+
+func init() {
+	Register(regexp.MustCompile(_namespaceSuffix), &namespaceFactory{})
+}
+
+type namespaceFactory struct{}
+
+func (f namespaceFactory) Create(suffix string) Metadata {
+	return &Namespace{}
+}
+
+// Namespace records the namespace a blob was cached under.
+type Namespace struct {
+	Value string
+}
+
+// NewNamespace creates a new Namespace.
+func NewNamespace(namespace string) *Namespace {
+	return &Namespace{namespace}
+}
+
+// GetSuffix returns a static suffix.
+func (m *Namespace) GetSuffix() string {
+	return _namespaceSuffix
+}
+
+// Movable is true.
+func (m *Namespace) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Namespace) Serialize() ([]byte, error) {
+	return []byte(m.Value), nil
+}
+
+// Deserialize loads b into m.
+func (m *Namespace) Deserialize(b []byte) error {
+	m.Value = string(b)
+	return nil
+}
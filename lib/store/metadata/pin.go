@@ -0,0 +1,103 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const _pinSuffix = "_pin"
+
+func init() {
+	Register(regexp.MustCompile(_pinSuffix), &pinFactory{})
+}
+
+type pinFactory struct{}
+
+func (f pinFactory) Create(suffix string) Metadata {
+	return &Pin{}
+}
+
+// Pin records the namespaces which pinned a blob. Pinned blobs are exempt from
+// eviction until every namespace unpins them.
+type Pin struct {
+	Namespaces []string
+}
+
+// NewPin creates a new Pin.
+func NewPin(namespaces ...string) *Pin {
+	p := &Pin{}
+	for _, ns := range namespaces {
+		p.Add(ns)
+	}
+	return p
+}
+
+// Pinned returns true if any namespace pinned the blob.
+func (m *Pin) Pinned() bool {
+	return len(m.Namespaces) > 0
+}
+
+// Add pins the blob for namespace. Returns false if namespace already pinned
+// the blob.
+func (m *Pin) Add(namespace string) bool {
+	i := sort.SearchStrings(m.Namespaces, namespace)
+	if i < len(m.Namespaces) && m.Namespaces[i] == namespace {
+		return false
+	}
+	m.Namespaces = append(m.Namespaces, "")
+	copy(m.Namespaces[i+1:], m.Namespaces[i:])
+	m.Namespaces[i] = namespace
+	return true
+}
+
+// Remove unpins the blob for namespace. Returns false if namespace had not
+// pinned the blob.
+func (m *Pin) Remove(namespace string) bool {
+	i := sort.SearchStrings(m.Namespaces, namespace)
+	if i == len(m.Namespaces) || m.Namespaces[i] != namespace {
+		return false
+	}
+	m.Namespaces = append(m.Namespaces[:i], m.Namespaces[i+1:]...)
+	return true
+}
+
+// GetSuffix returns a static suffix.
+func (m *Pin) GetSuffix() string {
+	return _pinSuffix
+}
+
+// Movable is true.
+func (m *Pin) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes. Namespaces cannot contain newlines, so they
+// are stored one per line.
+func (m *Pin) Serialize() ([]byte, error) {
+	return []byte(strings.Join(m.Namespaces, "\n")), nil
+}
+
+// Deserialize loads b into m.
+func (m *Pin) Deserialize(b []byte) error {
+	m.Namespaces = nil
+	for _, ns := range strings.Split(string(b), "\n") {
+		if ns != "" {
+			m.Add(ns)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinSerialization(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPin("uber-usi/labrat", "library/base")
+	b, err := p.Serialize()
+	require.NoError(err)
+
+	var result Pin
+	require.NoError(result.Deserialize(b))
+	require.Equal([]string{"library/base", "uber-usi/labrat"}, result.Namespaces)
+	require.True(result.Pinned())
+}
+
+func TestPinAddRemove(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPin()
+	require.False(p.Pinned())
+
+	require.True(p.Add("b"))
+	require.True(p.Add("a"))
+	require.False(p.Add("b"))
+	require.Equal([]string{"a", "b"}, p.Namespaces)
+
+	require.True(p.Remove("a"))
+	require.False(p.Remove("a"))
+	require.True(p.Pinned())
+	require.True(p.Remove("b"))
+	require.False(p.Pinned())
+}
+
+func TestPinDeserializeEmpty(t *testing.T) {
+	require := require.New(t)
+
+	var p Pin
+	require.NoError(p.Deserialize(nil))
+	require.False(p.Pinned())
+}
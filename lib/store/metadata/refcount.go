@@ -0,0 +1,79 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const _refCountSuffix = "_refcount_"
+
+// RefCountGlob matches the suffixes of RefCount of all processes.
+const RefCountGlob = _refCountSuffix + "*"
+
+func init() {
+	Register(regexp.MustCompile(_refCountSuffix+`\d+$`), &refCountFactory{})
+}
+
+type refCountFactory struct{}
+
+func (f refCountFactory) Create(suffix string) Metadata {
+	pid, err := strconv.Atoi(suffix[strings.LastIndex(suffix, _refCountSuffix)+len(_refCountSuffix):])
+	if err != nil {
+		return nil
+	}
+	return &RefCount{PID: pid}
+}
+
+// RefCount records the number of open readers and writers of a file held by
+// process PID. Every process writes its own RefCount, so that processes
+// sharing a store directory can tell whether a file is in use by others. The
+// store only persists whether the file is in use, i.e. N is 0 or 1.
+type RefCount struct {
+	PID int
+	N   int
+}
+
+// NewRefCount creates a new RefCount.
+func NewRefCount(pid, n int) *RefCount {
+	return &RefCount{pid, n}
+}
+
+// GetSuffix returns the suffix of m, which includes its pid.
+func (m *RefCount) GetSuffix() string {
+	return _refCountSuffix + strconv.Itoa(m.PID)
+}
+
+// Movable is true, since open descriptors follow a moved file.
+func (m *RefCount) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *RefCount) Serialize() ([]byte, error) {
+	return []byte(strconv.Itoa(m.N)), nil
+}
+
+// Deserialize loads b into m.
+func (m *RefCount) Deserialize(b []byte) error {
+	n, err := strconv.Atoi(string(b))
+	if err != nil {
+		return fmt.Errorf("parse ref count: %s", err)
+	}
+	m.N = n
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+
+	"github.com/willf/bitset"
+)
+
+const _uploadProgressSuffix = "_upload_progress"
+
+func init() {
+	RegisterWithCodec(regexp.MustCompile(_uploadProgressSuffix), &uploadProgressFactory{}, JSONCodec{})
+}
+
+type uploadProgressFactory struct{}
+
+func (f uploadProgressFactory) Create(suffix string) Metadata {
+	return &UploadProgress{}
+}
+
+type uploadProgressPayload struct {
+	Length      int64          `json:"length"`
+	PieceLength int64          `json:"piece_length"`
+	Complete    *bitset.BitSet `json:"complete"`
+	Sums        []uint32       `json:"sums"`
+}
+
+// UploadProgress records which pieces of an in-progress upload have been
+// written, along with a checksum of each written piece so the data can be
+// verified after a restart.
+type UploadProgress struct {
+	payload uploadProgressPayload
+}
+
+// NewUploadProgress creates a new UploadProgress for a blob of given length,
+// split into pieces of pieceLength, with no pieces complete.
+func NewUploadProgress(length, pieceLength int64) *UploadProgress {
+	p := &UploadProgress{uploadProgressPayload{
+		Length:      length,
+		PieceLength: pieceLength,
+	}}
+	n := p.NumPieces()
+	p.payload.Complete = bitset.New(uint(n))
+	p.payload.Sums = make([]uint32, n)
+	return p
+}
+
+// GetUploadProgressSuffix returns the suffix of UploadProgress metadata.
+func GetUploadProgressSuffix() string {
+	return _uploadProgressSuffix
+}
+
+// GetSuffix returns a static suffix.
+func (m *UploadProgress) GetSuffix() string {
+	return _uploadProgressSuffix
+}
+
+// Movable is false. Progress is meaningless once the upload is committed.
+func (m *UploadProgress) Movable() bool {
+	return false
+}
+
+// Serialize converts m to bytes.
+func (m *UploadProgress) Serialize() ([]byte, error) {
+	return Encode(m, 1, &m.payload)
+}
+
+// Deserialize loads b into m.
+func (m *UploadProgress) Deserialize(b []byte) error {
+	if _, err := Decode(m, b, &m.payload); err != nil {
+		return err
+	}
+	if m.payload.Complete == nil {
+		m.payload.Complete = bitset.New(uint(m.NumPieces()))
+	}
+	if len(m.payload.Sums) != m.NumPieces() {
+		m.payload.Sums = make([]uint32, m.NumPieces())
+		m.payload.Complete.ClearAll()
+	}
+	return nil
+}
+
+// Length returns the length of the blob being uploaded.
+func (m *UploadProgress) Length() int64 {
+	return m.payload.Length
+}
+
+// PieceLength returns the nominal length of each piece.
+func (m *UploadProgress) PieceLength() int64 {
+	return m.payload.PieceLength
+}
+
+// NumPieces returns the number of pieces in the blob.
+func (m *UploadProgress) NumPieces() int {
+	if m.payload.PieceLength <= 0 || m.payload.Length <= 0 {
+		return 0
+	}
+	return int((m.payload.Length + m.payload.PieceLength - 1) / m.payload.PieceLength)
+}
+
+// PieceOffset returns the byte offset of piece i.
+func (m *UploadProgress) PieceOffset(i int) int64 {
+	return int64(i) * m.payload.PieceLength
+}
+
+// PieceSize returns the length of piece i, which is only shorter than
+// PieceLength for the last piece.
+func (m *UploadProgress) PieceSize(i int) int64 {
+	if i == m.NumPieces()-1 {
+		return m.payload.Length - m.PieceOffset(i)
+	}
+	return m.payload.PieceLength
+}
+
+// MarkComplete marks piece i as written with checksum sum.
+func (m *UploadProgress) MarkComplete(i int, sum uint32) {
+	m.payload.Complete.Set(uint(i))
+	m.payload.Sums[i] = sum
+}
+
+// MarkIncomplete marks piece i as not written.
+func (m *UploadProgress) MarkIncomplete(i int) {
+	m.payload.Complete.Clear(uint(i))
+	m.payload.Sums[i] = 0
+}
+
+// Has returns whether piece i has been written.
+func (m *UploadProgress) Has(i int) bool {
+	return m.payload.Complete.Test(uint(i))
+}
+
+// Sum returns the checksum recorded for piece i.
+func (m *UploadProgress) Sum(i int) uint32 {
+	return m.payload.Sums[i]
+}
+
+// Done returns whether every piece has been written.
+func (m *UploadProgress) Done() bool {
+	return int(m.payload.Complete.Count()) == m.NumPieces()
+}
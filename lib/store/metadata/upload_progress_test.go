@@ -0,0 +1,51 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadProgressSerialization(t *testing.T) {
+	require := require.New(t)
+
+	p := NewUploadProgress(10, 4)
+	require.Equal(3, p.NumPieces())
+	require.Equal(int64(2), p.PieceSize(2))
+	p.MarkComplete(0, 7)
+	p.MarkComplete(2, 9)
+
+	md := CreateFromSuffix(_uploadProgressSuffix)
+	require.NotNil(md)
+
+	b, err := p.Serialize()
+	require.NoError(err)
+	require.NoError(md.Deserialize(b))
+
+	result := md.(*UploadProgress)
+	require.Equal(int64(10), result.Length())
+	require.Equal(int64(4), result.PieceLength())
+	require.True(result.Has(0))
+	require.False(result.Has(1))
+	require.True(result.Has(2))
+	require.Equal(uint32(9), result.Sum(2))
+	require.False(result.Done())
+
+	result.MarkComplete(1, 8)
+	require.True(result.Done())
+	result.MarkIncomplete(0)
+	require.False(result.Done())
+}
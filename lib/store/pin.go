@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+// PinnedFile is a cache file pinned by one or more namespaces.
+type PinnedFile struct {
+	Name       string
+	Namespaces []string
+	Size       int64
+}
+
+// PinCacheFile pins the cache file of name for namespace. Pinned files are
+// never evicted, until every namespace which pinned them unpins them. Returns
+// os.ErrNotExist if the file is not in the cache.
+func (s *CAStore) PinCacheFile(name, namespace string) error {
+	return s.updatePin(name, func(p *metadata.Pin) { p.Add(namespace) })
+}
+
+// UnpinCacheFile removes the pin of namespace from the cache file of name.
+// Unpinning a file which namespace did not pin is a no-op. Returns
+// os.ErrNotExist if the file is not in the cache.
+func (s *CAStore) UnpinCacheFile(name, namespace string) error {
+	return s.updatePin(name, func(p *metadata.Pin) { p.Remove(namespace) })
+}
+
+// updatePin applies f to the pin of name. Pin updates are serialized so
+// concurrent pins of different namespaces are not lost.
+func (s *CAStore) updatePin(name string, f func(*metadata.Pin)) error {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+
+	// Metadata lookups do not distinguish missing files from missing
+	// metadata.
+	if _, err := s.cacheStore.GetCacheFileStat(name); err != nil {
+		return err
+	}
+	pin := new(metadata.Pin)
+	if err := s.cacheStore.GetCacheFileMetadata(name, pin); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("get pin: %s", err)
+	}
+	f(pin)
+	if !pin.Pinned() {
+		if err := s.cacheStore.DeleteCacheFileMetadata(name, pin); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("delete pin: %s", err)
+		}
+		return nil
+	}
+	if _, err := s.cacheStore.SetCacheFileMetadata(name, pin); err != nil {
+		return fmt.Errorf("set pin: %s", err)
+	}
+	return nil
+}
+
+// ListPinnedCacheFiles returns all pinned cache files, sorted by name.
+func (s *CAStore) ListPinnedCacheFiles() ([]PinnedFile, error) {
+	var pinned []PinnedFile
+	if err := s.cacheStore.WalkCacheFiles(func(name string, info os.FileInfo) error {
+		var pin metadata.Pin
+		if err := s.cacheStore.GetCacheFileMetadata(name, &pin); err != nil || !pin.Pinned() {
+			return nil
+		}
+		pinned = append(pinned, PinnedFile{
+			Name:       name,
+			Namespaces: pin.Namespaces,
+			Size:       info.Size(),
+		})
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("walk cache files: %s", err)
+	}
+	sort.Slice(pinned, func(i, j int) bool { return pinned[i].Name < pinned[j].Name })
+	return pinned, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/base"
+)
+
+func TestPinCacheFilePreventsDeletion(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+	require.NoError(s.CreateCacheFile(name, bytes.NewReader(blob.Content)))
+
+	require.NoError(s.PinCacheFile(name, "a"))
+	require.NoError(s.PinCacheFile(name, "b"))
+	require.Equal(base.ErrFilePinned, s.DeleteCacheFile(name))
+
+	// The file stays pinned until every namespace unpins it.
+	require.NoError(s.UnpinCacheFile(name, "a"))
+	require.Equal(base.ErrFilePinned, s.DeleteCacheFile(name))
+
+	require.NoError(s.UnpinCacheFile(name, "b"))
+	require.NoError(s.DeleteCacheFile(name))
+}
+
+func TestPinCacheFileNotFound(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	name := core.DigestFixture().Hex()
+	require.True(os.IsNotExist(s.PinCacheFile(name, "a")))
+	require.True(os.IsNotExist(s.UnpinCacheFile(name, "a")))
+}
+
+func TestListPinnedCacheFiles(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	pinned := core.SizedBlobFixture(100, 10)
+	unpinned := core.SizedBlobFixture(200, 10)
+	for _, blob := range []*core.BlobFixture{pinned, unpinned} {
+		require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+	require.NoError(s.PinCacheFile(pinned.Digest.Hex(), "b"))
+	require.NoError(s.PinCacheFile(pinned.Digest.Hex(), "a"))
+	require.NoError(s.PinCacheFile(unpinned.Digest.Hex(), "a"))
+	require.NoError(s.UnpinCacheFile(unpinned.Digest.Hex(), "a"))
+
+	files, err := s.ListPinnedCacheFiles()
+	require.NoError(err)
+	require.Equal([]PinnedFile{{
+		Name:       pinned.Digest.Hex(),
+		Namespaces: []string{"a", "b"},
+		Size:       100,
+	}}, files)
+}
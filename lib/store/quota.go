@@ -0,0 +1,114 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/utils/log"
+)
+
+// QuotaExceededError occurs when adding a file to the cache would exceed the
+// configured quota.
+type QuotaExceededError struct {
+	Name  string
+	Size  int64
+	Usage int64
+	Quota int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf(
+		"adding %s (%d bytes) exceeds cache quota: usage %d bytes, quota %d bytes",
+		e.Name, e.Size, e.Usage, e.Quota)
+}
+
+// IsQuotaExceededError returns true if err is or wraps a QuotaExceededError.
+func IsQuotaExceededError(err error) bool {
+	var qerr *QuotaExceededError
+	return errors.As(err, &qerr)
+}
+
+// quotaEnabled returns true if a cache quota is configured.
+func (s *CAStore) quotaEnabled() bool {
+	return s.config.Quota > 0
+}
+
+// initQuota loads all cache files from disk so that their sizes are accounted
+// for by the cache backend.
+func (s *CAStore) initQuota() error {
+	if err := s.cacheStore.WalkCacheFiles(func(name string, info os.FileInfo) error {
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("walk cache files: %s", err)
+	}
+	return nil
+}
+
+// checkQuota ensures size bytes can be added to the cache. If the quota would
+// be exceeded and EvictOnQuota is set, least recently accessed cache files are
+// deleted synchronously to make room. Callers must hold quotaMu.
+func (s *CAStore) checkQuota(name string, size int64) error {
+	quota := int64(s.config.Quota)
+	usage := s.cacheStore.backend.DiskUsage(s.cacheStore.state)
+	if usage+size <= quota {
+		return nil
+	}
+	if s.config.EvictOnQuota {
+		s.evictForQuota(usage + size - quota)
+		usage = s.cacheStore.backend.DiskUsage(s.cacheStore.state)
+		if usage+size <= quota {
+			return nil
+		}
+	}
+	s.stats.Counter("quota_exceeded").Inc(1)
+	return &QuotaExceededError{
+		Name:  name,
+		Size:  size,
+		Usage: usage,
+		Quota: quota,
+	}
+}
+
+// evictForQuota deletes least recently accessed cache files until at least
+// target bytes have been freed. Candidates come from the in-memory usage index
+// of the cache backend, so no files are listed or read from disk.
+func (s *CAStore) evictForQuota(target int64) {
+	op := s.cacheStore.newFileOp()
+	var freed int64
+	for _, f := range s.cacheStore.backend.ListByAccessTime(s.cacheStore.state) {
+		if freed >= target {
+			break
+		}
+		if err := op.DeleteIfUnreferenced(f.Name, false); err != nil {
+			if !os.IsNotExist(err) && err != base.ErrFilePersisted &&
+				err != base.ErrFilePinned && !base.IsFileInUseError(err) {
+				log.With("name", f.Name).Errorf("Error evicting cache file: %s", err)
+			}
+			continue
+		}
+		freed += f.Size
+		s.stats.Counter("quota_evictions").Inc(1)
+	}
+}
+
+// inCache returns true if name is already committed to the cache, in which
+// case committing it again adds no bytes.
+func (s *CAStore) inCache(name string) bool {
+	_, err := s.cacheStore.newFileOp().GetFileStat(name)
+	return err == nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// PopulateFunc writes the content of the blob name into w. It is invoked on
+// cache misses, e.g. to download the blob from a backend. Should return an
+// error satisfying os.IsNotExist if the blob does not exist.
+type PopulateFunc func(name string, w FileReadWriter) error
+
+// ReadThroughStore wraps a CAStore and populates cache files on read misses.
+// Concurrent misses for the same name invoke the populate function only once,
+// and all wait for its result.
+type ReadThroughStore struct {
+	*CAStore
+	populate PopulateFunc
+	group    singleflight.Group
+}
+
+// NewReadThroughStore creates a new ReadThroughStore.
+func NewReadThroughStore(cas *CAStore, populate PopulateFunc) *ReadThroughStore {
+	return &ReadThroughStore{
+		CAStore:  cas,
+		populate: populate,
+	}
+}
+
+// GetCacheFileReader returns a FileReader for name. If name is not in the
+// cache, it is populated first.
+func (s *ReadThroughStore) GetCacheFileReader(name string) (FileReader, error) {
+	r, err := s.CAStore.GetCacheFileReader(name)
+	if err == nil || !os.IsNotExist(err) {
+		return r, err
+	}
+	if err := s.Populate(name); err != nil {
+		return nil, err
+	}
+	return s.CAStore.GetCacheFileReader(name)
+}
+
+// GetCacheFileStat returns a FileInfo for name. If name is not in the cache,
+// it is populated first.
+func (s *ReadThroughStore) GetCacheFileStat(name string) (os.FileInfo, error) {
+	info, err := s.CAStore.GetCacheFileStat(name)
+	if err == nil || !os.IsNotExist(err) {
+		return info, err
+	}
+	if err := s.Populate(name); err != nil {
+		return nil, err
+	}
+	return s.CAStore.GetCacheFileStat(name)
+}
+
+// Populate writes name into the cache using the populate function, unless
+// another goroutine is already populating it, in which case it waits for that
+// result instead. Content is written to upload state and committed to cache
+// once complete, so readers never observe partial files.
+func (s *ReadThroughStore) Populate(name string) error {
+	_, err, shared := s.group.Do(name, func() (interface{}, error) {
+		// A previous populate may have finished between the miss and now.
+		if _, err := s.CAStore.GetCacheFileStat(name); err == nil {
+			return nil, nil
+		}
+		s.stats.Counter("read_through_populates").Inc(1)
+		if err := s.WriteCacheFile(name, func(w FileReadWriter) error {
+			return s.populate(name, w)
+		}); err != nil {
+			if os.IsNotExist(err) {
+				return nil, err
+			}
+			s.stats.Counter("read_through_populate_errors").Inc(1)
+			return nil, fmt.Errorf("populate %s: %w", name, err)
+		}
+		return nil, nil
+	})
+	if shared {
+		s.stats.Counter("read_through_shared_populates").Inc(1)
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadThroughStorePopulatesOnMiss(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	var calls int32
+	release := make(chan struct{})
+	s := NewReadThroughStore(cas, func(name string, w FileReadWriter) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		_, err := io.Copy(w, bytes.NewReader(blob.Content))
+		return err
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := s.GetCacheFileReader(blob.Digest.Hex())
+			require.NoError(err)
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			require.NoError(err)
+			require.Equal(blob.Content, data)
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	require.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// Hits do not populate.
+	_, err := s.GetCacheFileStat(blob.Digest.Hex())
+	require.NoError(err)
+	require.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestReadThroughStorePopulateNotFound(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	s := NewReadThroughStore(cas, func(name string, w FileReadWriter) error {
+		return os.ErrNotExist
+	})
+
+	blob := core.NewBlobFixture()
+	_, err := s.GetCacheFileReader(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+
+	// Nothing is left behind in the cache.
+	_, err = cas.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
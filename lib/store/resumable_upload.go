@@ -0,0 +1,194 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/closers"
+)
+
+// ErrUploadIncomplete is returned when committing a resumable upload which
+// still has missing pieces.
+var ErrUploadIncomplete = errors.New("upload has missing pieces")
+
+// ByteRange is a contiguous range of bytes within a blob.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// resumableUploadName returns the upload file name of a resumable upload of d.
+// Unlike regular uploads, names are deterministic so the upload can be found
+// again after a restart.
+func resumableUploadName(d core.Digest) string {
+	return path.Join(_resumableUploadDir, d.Hex())
+}
+
+// CreateResumableUpload creates an upload file for blob d whose progress is
+// kept across restarts. Pieces are written with WriteUploadPiece. Returns
+// os.ErrExist if an upload of d is already in progress, in which case callers
+// should use ResumeUpload to find which pieces are still needed.
+//
+// Abandoned resumable uploads are removed by the regular upload cleanup.
+func (s *CAStore) CreateResumableUpload(d core.Digest, length, pieceLength int64) error {
+	if pieceLength <= 0 {
+		return fmt.Errorf("invalid piece length %d", pieceLength)
+	}
+	name := resumableUploadName(d)
+	if err := s.CreateUploadFile(name, length); err != nil {
+		return err
+	}
+	if err := s.SetUploadFileMetadata(name, metadata.NewUploadProgress(length, pieceLength)); err != nil {
+		s.deferDeleteUploadFile(name)()
+		return fmt.Errorf("set upload progress: %s", err)
+	}
+	return nil
+}
+
+// WriteUploadPiece writes piece i of the resumable upload of d, and records it
+// as complete along with its checksum.
+func (s *CAStore) WriteUploadPiece(d core.Digest, i int, data []byte) error {
+	name := resumableUploadName(d)
+	progress := new(metadata.UploadProgress)
+	if err := s.GetUploadFileMetadata(name, progress); err != nil {
+		return err
+	}
+	if i < 0 || i >= progress.NumPieces() {
+		return fmt.Errorf("invalid piece index %d: num pieces = %d", i, progress.NumPieces())
+	}
+	if int64(len(data)) != progress.PieceSize(i) {
+		return fmt.Errorf(
+			"invalid piece length: expected %d, got %d", progress.PieceSize(i), len(data))
+	}
+
+	w, err := s.GetUploadFileReadWriter(name)
+	if err != nil {
+		return fmt.Errorf("get upload writer: %s", err)
+	}
+	if _, err := w.WriteAt(data, progress.PieceOffset(i)); err != nil {
+		closers.Close(w)
+		return fmt.Errorf("write piece: %s", err)
+	}
+	if err := w.Commit(); err != nil {
+		return fmt.Errorf("commit piece: %s", err)
+	}
+
+	h := core.PieceHash()
+	h.Write(data)
+	sum := h.Sum32()
+
+	return s.updateUploadProgress(name, func(p *metadata.UploadProgress) {
+		p.MarkComplete(i, sum)
+	})
+}
+
+// ResumeUpload returns the byte ranges of the resumable upload of d which have
+// already been written, e.g. before a restart. Each complete piece is verified
+// against the checksum recorded when it was written, and pieces which fail
+// verification are marked incomplete. Returns os.ErrNotExist if there is no
+// resumable upload of d.
+func (s *CAStore) ResumeUpload(d core.Digest) ([]ByteRange, error) {
+	name := resumableUploadName(d)
+	progress := new(metadata.UploadProgress)
+	if err := s.GetUploadFileMetadata(name, progress); err != nil {
+		return nil, err
+	}
+
+	f, err := s.GetUploadFileReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("get upload reader: %s", err)
+	}
+	defer closers.Close(f)
+
+	var corrupt []int
+	var ranges []ByteRange
+	for i := 0; i < progress.NumPieces(); i++ {
+		if !progress.Has(i) {
+			continue
+		}
+		h := core.PieceHash()
+		r := io.NewSectionReader(f, progress.PieceOffset(i), progress.PieceSize(i))
+		if _, err := io.Copy(h, r); err != nil {
+			return nil, fmt.Errorf("read piece %d: %s", i, err)
+		}
+		if h.Sum32() != progress.Sum(i) {
+			corrupt = append(corrupt, i)
+			continue
+		}
+		off := progress.PieceOffset(i)
+		if n := len(ranges); n > 0 && ranges[n-1].Offset+ranges[n-1].Length == off {
+			ranges[n-1].Length += progress.PieceSize(i)
+		} else {
+			ranges = append(ranges, ByteRange{off, progress.PieceSize(i)})
+		}
+	}
+	if len(corrupt) > 0 {
+		s.stats.Counter("resume_upload_corrupt_pieces").Inc(int64(len(corrupt)))
+		err := s.updateUploadProgress(name, func(p *metadata.UploadProgress) {
+			for _, i := range corrupt {
+				p.MarkIncomplete(i)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ranges, nil
+}
+
+// CommitResumableUpload verifies the resumable upload of d and moves it into
+// the cache, generating metainfo with the piece length of the upload. Any
+// additional mds are written to the cache file. Returns ErrUploadIncomplete if
+// any piece is missing.
+func (s *CAStore) CommitResumableUpload(d core.Digest, mds ...metadata.Metadata) error {
+	name := resumableUploadName(d)
+	progress := new(metadata.UploadProgress)
+	if err := s.GetUploadFileMetadata(name, progress); err != nil {
+		return err
+	}
+	if !progress.Done() {
+		return ErrUploadIncomplete
+	}
+	if err := s.MoveUploadFileToCache(name, d.Hex()); err != nil && !os.IsExist(err) {
+		return err
+	}
+	if err := s.generateMetadataFromFile(d.Hex(), progress.PieceLength()); err != nil {
+		return err
+	}
+	return s.setCacheFileMetadata(d.Hex(), mds)
+}
+
+// updateUploadProgress applies f to the upload progress of name. Progress
+// updates are serialized so concurrent piece writes are not lost.
+func (s *CAStore) updateUploadProgress(name string, f func(*metadata.UploadProgress)) error {
+	s.uploadProgressMu.Lock()
+	defer s.uploadProgressMu.Unlock()
+
+	progress := new(metadata.UploadProgress)
+	if err := s.GetUploadFileMetadata(name, progress); err != nil {
+		return fmt.Errorf("get upload progress: %s", err)
+	}
+	f(progress)
+	if err := s.SetUploadFileMetadata(name, progress); err != nil {
+		return fmt.Errorf("set upload progress: %s", err)
+	}
+	return nil
+}
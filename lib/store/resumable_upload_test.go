@@ -0,0 +1,117 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestResumeUploadAcrossRestart(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(100, 10)
+	piece := func(i int) []byte { return blob.Content[i*10 : (i+1)*10] }
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	require.NoError(s.CreateResumableUpload(blob.Digest, blob.Length(), 10))
+	require.True(os.IsExist(s.CreateResumableUpload(blob.Digest, blob.Length(), 10)))
+	for _, i := range []int{0, 1, 2, 5} {
+		require.NoError(s.WriteUploadPiece(blob.Digest, i, piece(i)))
+	}
+	require.Equal(ErrUploadIncomplete, s.CommitResumableUpload(blob.Digest))
+
+	// Regular uploads are wiped on restart.
+	require.NoError(s.CreateUploadFile("foo", 0))
+	s.Close()
+
+	s, err = NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	_, err = s.GetUploadFileStat("foo")
+	require.True(os.IsNotExist(err))
+
+	ranges, err := s.ResumeUpload(blob.Digest)
+	require.NoError(err)
+	require.Equal([]ByteRange{{0, 30}, {50, 10}}, ranges)
+
+	for _, i := range []int{3, 4, 6, 7, 8, 9} {
+		require.NoError(s.WriteUploadPiece(blob.Digest, i, piece(i)))
+	}
+	require.NoError(s.CommitResumableUpload(blob.Digest))
+
+	r, err := s.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content, data)
+
+	_, err = s.ResumeUpload(blob.Digest)
+	require.True(os.IsNotExist(err))
+}
+
+func TestResumeUploadDropsCorruptPieces(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(30, 10)
+
+	require.NoError(s.CreateResumableUpload(blob.Digest, blob.Length(), 10))
+	require.NoError(s.WriteUploadPiece(blob.Digest, 0, blob.Content[:10]))
+	require.NoError(s.WriteUploadPiece(blob.Digest, 1, blob.Content[10:20]))
+
+	// Simulate a torn write.
+	w, err := s.GetUploadFileReadWriter(resumableUploadName(blob.Digest))
+	require.NoError(err)
+	_, err = w.WriteAt([]byte{^blob.Content[15]}, 15)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	ranges, err := s.ResumeUpload(blob.Digest)
+	require.NoError(err)
+	require.Equal([]ByteRange{{0, 10}}, ranges)
+
+	ranges, err = s.ResumeUpload(blob.Digest)
+	require.NoError(err)
+	require.Equal([]ByteRange{{0, 10}}, ranges)
+}
+
+func TestWriteUploadPieceInvalidLength(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(25, 10)
+
+	require.NoError(s.CreateResumableUpload(blob.Digest, blob.Length(), 10))
+	require.Error(s.WriteUploadPiece(blob.Digest, 2, blob.Content[10:20]))
+	require.Error(s.WriteUploadPiece(blob.Digest, 3, blob.Content[20:]))
+	require.NoError(s.WriteUploadPiece(blob.Digest, 2, blob.Content[20:]))
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// ScrubberConfig defines configuration for periodically verifying the content
+// of cache files against their digests.
+type ScrubberConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"` // How often a scrub cycle runs.
+
+	// Fraction of cache files re-hashed per cycle. Consecutive cycles resume
+	// where the previous one stopped, so every file is eventually scrubbed.
+	Fraction float64 `yaml:"fraction"`
+
+	// Corrupted files are moved under QuarantineDir for inspection. Defaults
+	// to a "quarantine" directory next to the cache directory.
+	QuarantineDir string `yaml:"quarantine_dir"`
+}
+
+func (c ScrubberConfig) applyDefaults(cacheDir string) ScrubberConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Hour
+	}
+	if c.Fraction <= 0 || c.Fraction > 1 {
+		c.Fraction = 0.01
+	}
+	if c.QuarantineDir == "" {
+		c.QuarantineDir = filepath.Join(filepath.Dir(filepath.Clean(cacheDir)), "quarantine")
+	}
+	return c
+}
+
+// scrubber periodically re-hashes a fraction of the files in op, and moves
+// files whose content does not match their name into quarantine.
+type scrubber struct {
+	config ScrubberConfig
+	clk    clock.Clock
+	stats  tally.Scope
+	op     base.FileOp
+
+	// Name of the last scrubbed file, where the next cycle resumes.
+	cursor string
+
+	stopOnce sync.Once
+	stopc    chan struct{}
+}
+
+func newScrubber(
+	config ScrubberConfig, cacheDir string, op base.FileOp, clk clock.Clock, stats tally.Scope) (*scrubber, error) {
+
+	config = config.applyDefaults(cacheDir)
+	if err := os.MkdirAll(config.QuarantineDir, 0775); err != nil {
+		return nil, fmt.Errorf("mkdir quarantine: %s", err)
+	}
+	return &scrubber{
+		config: config,
+		clk:    clk,
+		stats: stats.Tagged(map[string]string{
+			"module": "storescrubber",
+		}),
+		op:    op.VerifyDigest(),
+		stopc: make(chan struct{}),
+	}, nil
+}
+
+func (s *scrubber) start() {
+	ticker := s.clk.Ticker(s.config.Interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.scrub(); err != nil {
+					log.Errorf("Error scrubbing %s: %s", s.op, err)
+				}
+			case <-s.stopc:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *scrubber) stop() {
+	s.stopOnce.Do(func() { close(s.stopc) })
+}
+
+// scrub runs one scrub cycle.
+func (s *scrubber) scrub() error {
+	names, err := s.op.ListNames()
+	if err != nil {
+		return fmt.Errorf("list names: %s", err)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	start := sort.SearchStrings(names, s.cursor)
+	if start < len(names) && names[start] == s.cursor {
+		start++
+	}
+	n := int(math.Ceil(float64(len(names)) * s.config.Fraction))
+	for i := 0; i < n; i++ {
+		name := names[(start+i)%len(names)]
+		s.cursor = name
+		s.scrubFile(name)
+	}
+	return nil
+}
+
+func (s *scrubber) scrubFile(name string) {
+	err := s.verify(name)
+	if err == nil {
+		s.stats.Counter("scrubbed").Inc(1)
+		return
+	}
+	if !base.IsChecksumMismatchError(err) {
+		if !os.IsNotExist(err) {
+			log.With("name", name).Errorf("Error scrubbing file: %s", err)
+			s.stats.Counter("scrub_errors").Inc(1)
+		}
+		return
+	}
+	log.With("name", name).Errorf("Corrupted file found by scrubber: %s", err)
+	s.stats.Counter("corrupted").Inc(1)
+	if err := s.quarantine(name); err != nil {
+		log.With("name", name).Errorf("Error quarantining file: %s", err)
+		s.stats.Counter("quarantine_errors").Inc(1)
+	}
+}
+
+func (s *scrubber) verify(name string) error {
+	// Reading compressed files would decompress them, so they are skipped
+	// until they are accessed again.
+	if err := s.op.GetFileMetadata(name, metadata.NewCompressed(0)); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	r, err := s.op.GetFileReader(name, 0)
+	if err != nil {
+		return err
+	}
+	defer closers.Close(r)
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+// quarantine moves name out of the store into the quarantine directory, so it
+// can be fetched again.
+func (s *scrubber) quarantine(name string) error {
+	target := filepath.Join(s.config.QuarantineDir, fmt.Sprintf("%s.%d", name, s.clk.Now().Unix()))
+	if err := s.op.LinkFileTo(name, target); err != nil {
+		return fmt.Errorf("link: %s", err)
+	}
+	if err := s.op.DeleteFile(name); err != nil {
+		return fmt.Errorf("delete: %s", err)
+	}
+	return nil
+}
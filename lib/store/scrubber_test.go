@@ -0,0 +1,90 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestScrubberQuarantinesCorruptedFiles(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	good := core.NewBlobFixture()
+	require.NoError(s.CreateCacheFile(good.Digest.Hex(), bytes.NewReader(good.Content)))
+
+	bad := core.NewBlobFixture()
+	require.NoError(s.CreateCacheFile(bad.Digest.Hex(), bytes.NewReader(bad.Content)))
+	path, err := s.cacheStore.newFileOp().GetFilePath(bad.Digest.Hex())
+	require.NoError(err)
+	require.NoError(os.WriteFile(path, []byte("bit rot"), 0775))
+
+	quarantineDir, err := os.MkdirTemp("/tmp", "quarantine")
+	require.NoError(err)
+	defer os.RemoveAll(quarantineDir)
+
+	sc, err := newScrubber(ScrubberConfig{
+		Fraction:      1,
+		QuarantineDir: quarantineDir,
+	}, s.config.CacheDir, s.cacheStore.newFileOp(), clock.New(), tally.NoopScope)
+	require.NoError(err)
+
+	require.NoError(sc.scrub())
+
+	_, err = s.GetCacheFileStat(good.Digest.Hex())
+	require.NoError(err)
+	_, err = s.GetCacheFileStat(bad.Digest.Hex())
+	require.True(os.IsNotExist(err))
+
+	files, err := os.ReadDir(quarantineDir)
+	require.NoError(err)
+	require.Len(files, 1)
+}
+
+func TestScrubberResumesFromCursor(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		blob := core.NewBlobFixture()
+		require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+
+	sc, err := newScrubber(ScrubberConfig{
+		Fraction:      0.5,
+		QuarantineDir: s.config.CacheDir + "_quarantine",
+	}, s.config.CacheDir, s.cacheStore.newFileOp(), clock.New(), tally.NoopScope)
+	require.NoError(err)
+	defer os.RemoveAll(s.config.CacheDir + "_quarantine")
+
+	// Each cycle scrubs half of the files, so consecutive cycles stop at
+	// different files.
+	require.NoError(sc.scrub())
+	first := sc.cursor
+	require.NoError(sc.scrub())
+	require.NotEqual(first, sc.cursor)
+	require.Less(first, sc.cursor)
+}
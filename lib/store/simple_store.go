@@ -38,12 +38,18 @@ func NewSimpleStore(config SimpleStoreConfig, stats tally.Scope) (*SimpleStore,
 		"module": "simplestore",
 	})
 
-	uploadStore, err := newUploadStore(config.UploadDir, config.ReadPartSize, config.WritePartSize)
+	if err := config.Durability.Validate(); err != nil {
+		return nil, err
+	}
+
+	uploadStore, err := newUploadStore(
+		config.UploadDir, config.ReadPartSize, config.WritePartSize, nil, config.Durability)
 	if err != nil {
 		return nil, fmt.Errorf("new upload store: %s", err)
 	}
 
-	cacheBackend := base.NewLocalFileStore(clock.New())
+	cacheBackend := base.NewLocalFileStoreWithLRUConfig(
+		base.LRUConfig{Durability: config.Durability}, clock.New())
 	cacheStore, err := newCacheStore(config.CacheDir, cacheBackend, config.ReadPartSize)
 	if err != nil {
 		return nil, fmt.Errorf("new cache store: %s", err)
@@ -62,6 +68,9 @@ func NewSimpleStore(config SimpleStoreConfig, stats tally.Scope) (*SimpleStore,
 // Close terminates goroutines started by s.
 func (s *SimpleStore) Close() {
 	s.cleanup.stop()
+
+	s.uploadStore.backend.Close()
+	s.cacheStore.backend.Close()
 }
 
 // MoveUploadFileToCache commits uploadName as cacheName.
@@ -76,24 +85,54 @@ func (s *SimpleStore) MoveUploadFileToCache(uploadName, cacheName string) error
 
 // CreateCacheFile initializes a cache file for name from r.
 func (s *SimpleStore) CreateCacheFile(name string, r io.Reader) error {
-	tmp := fmt.Sprintf("%s.%s", name, uuid.Generate().String())
-	if err := s.CreateUploadFile(tmp, 0); err != nil {
-		return fmt.Errorf("create upload file: %s", err)
+	tmp, err := s.writeUploadFile(name, r)
+	if err != nil {
+		return err
+	}
+	defer s.deferDeleteUploadFile(tmp)()
+
+	if err := s.MoveUploadFileToCache(tmp, name); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("move upload file to cache: %s", err)
+	}
+	return nil
+}
+
+// ReplaceCacheFile atomically replaces the content of the cache file of name
+// with r, or creates it. Metadata of a replaced file is kept.
+func (s *SimpleStore) ReplaceCacheFile(name string, r io.Reader) error {
+	tmp, err := s.writeUploadFile(name, r)
+	if err != nil {
+		return err
 	}
 	defer s.deferDeleteUploadFile(tmp)()
 
+	uploadPath, err := s.uploadStore.newFileOp().GetFilePath(tmp)
+	if err != nil {
+		return fmt.Errorf("get upload path: %s", err)
+	}
+	if err := s.cacheStore.newFileOp().ReplaceFileFrom(name, s.cacheStore.state, uploadPath); err != nil {
+		return fmt.Errorf("replace cache file: %s", err)
+	}
+	return nil
+}
+
+// writeUploadFile writes r to a new upload file for name and returns the name
+// of the upload file.
+func (s *SimpleStore) writeUploadFile(name string, r io.Reader) (string, error) {
+	tmp := fmt.Sprintf("%s.%s", name, uuid.Generate().String())
+	if err := s.CreateUploadFile(tmp, 0); err != nil {
+		return "", fmt.Errorf("create upload file: %s", err)
+	}
 	w, err := s.GetUploadFileReadWriter(tmp)
 	if err != nil {
-		return fmt.Errorf("get upload writer: %s", err)
+		s.deferDeleteUploadFile(tmp)()
+		return "", fmt.Errorf("get upload writer: %s", err)
 	}
 	defer closers.Close(w)
 
 	if _, err := io.Copy(w, r); err != nil {
-		return fmt.Errorf("copy: %s", err)
-	}
-
-	if err := s.MoveUploadFileToCache(tmp, name); err != nil && !os.IsExist(err) {
-		return fmt.Errorf("move upload file to cache: %s", err)
+		s.deferDeleteUploadFile(tmp)()
+		return "", fmt.Errorf("copy: %s", err)
 	}
-	return nil
+	return tmp, nil
 }
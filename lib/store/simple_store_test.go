@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
 
 	"github.com/stretchr/testify/require"
 )
@@ -40,3 +41,41 @@ func TestSimpleStoreCreateCacheFile(t *testing.T) {
 	require.NoError(err)
 	require.Equal(d, string(result))
 }
+
+func TestSimpleStoreReplaceCacheFile(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := SimpleStoreFixture()
+	defer cleanup()
+
+	tag := core.TagFixture()
+	d1 := core.DigestFixture().String()
+	d2 := core.DigestFixture().String()
+
+	require.NoError(s.ReplaceCacheFile(tag, bytes.NewBufferString(d1)))
+	_, err := s.SetCacheFileMetadata(tag, metadata.NewPersist(true))
+	require.NoError(err)
+
+	// Open readers keep reading the replaced content.
+	f, err := s.GetCacheFileReader(tag)
+	require.NoError(err)
+	defer f.Close()
+
+	require.NoError(s.ReplaceCacheFile(tag, bytes.NewBufferString(d2)))
+
+	result, err := io.ReadAll(f)
+	require.NoError(err)
+	require.Equal(d1, string(result))
+
+	f2, err := s.GetCacheFileReader(tag)
+	require.NoError(err)
+	defer f2.Close()
+	result, err = io.ReadAll(f2)
+	require.NoError(err)
+	require.Equal(d2, string(result))
+
+	// Metadata is kept.
+	var p metadata.Persist
+	require.NoError(s.GetCacheFileMetadata(tag, &p))
+	require.True(p.Value)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
+)
+
+// TrashConfig defines configuration for delaying the deletion of cache files.
+// Deleted files are held in a trash directory for GracePeriod, during which
+// they can be restored by moving them back into the cache directory.
+type TrashConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Dir holds deleted files. Defaults to a "trash" directory next to the
+	// cache directory. Must be on the same filesystem as the cache, otherwise
+	// files are deleted immediately.
+	Dir string `yaml:"dir"`
+
+	// GracePeriod is how long deleted files are kept before being purged.
+	GracePeriod time.Duration `yaml:"grace_period"`
+
+	Interval time.Duration `yaml:"interval"` // How often a purge cycle runs.
+
+	// PurgeRate limits how many files are purged per second, so mass deletes
+	// do not saturate disk IO.
+	PurgeRate float64 `yaml:"purge_rate"`
+}
+
+func (c TrashConfig) applyDefaults(cacheDir string) TrashConfig {
+	if c.Dir == "" {
+		c.Dir = filepath.Join(filepath.Dir(filepath.Clean(cacheDir)), "trash")
+	}
+	if c.GracePeriod == 0 {
+		c.GracePeriod = 24 * time.Hour
+	}
+	if c.Interval == 0 {
+		c.Interval = 5 * time.Minute
+	}
+	if c.PurgeRate <= 0 {
+		c.PurgeRate = 100
+	}
+	return c
+}
+
+// janitor periodically purges files which have been in trash for longer than
+// the grace period.
+type janitor struct {
+	config  TrashConfig
+	clk     clock.Clock
+	stats   tally.Scope
+	trash   *base.Trash
+	limiter *rate.Limiter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newJanitor(config TrashConfig, trash *base.Trash, clk clock.Clock, stats tally.Scope) *janitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &janitor{
+		config: config,
+		clk:    clk,
+		stats: stats.Tagged(map[string]string{
+			"module": "storejanitor",
+		}),
+		trash:   trash,
+		limiter: rate.NewLimiter(rate.Limit(config.PurgeRate), 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (j *janitor) start() {
+	ticker := j.clk.Ticker(j.config.Interval)
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				if err := j.purge(); err != nil {
+					log.Errorf("Error purging trash: %s", err)
+				}
+			case <-j.ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (j *janitor) stop() {
+	j.cancel()
+	j.wg.Wait()
+}
+
+// purge runs one purge cycle.
+func (j *janitor) purge() error {
+	files, err := j.trash.List()
+	if err != nil {
+		return fmt.Errorf("list trash: %s", err)
+	}
+	j.stats.Gauge("trash_files").Update(float64(len(files)))
+
+	cutoff := j.clk.Now().Add(-j.config.GracePeriod)
+	for _, f := range files {
+		if f.DeletedAt.After(cutoff) {
+			// Files are sorted by deletion time.
+			break
+		}
+		if err := j.limiter.Wait(j.ctx); err != nil {
+			// Stopped.
+			return nil
+		}
+		if err := j.trash.Purge(f); err != nil {
+			log.With("name", f.Name).Errorf("Error purging file: %s", err)
+			j.stats.Counter("purge_errors").Inc(1)
+			continue
+		}
+		j.stats.Counter("purged").Inc(1)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJanitorPurgesTrashAfterGracePeriod(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	trashDir, err := os.MkdirTemp("/tmp", "trash")
+	require.NoError(err)
+	defer os.RemoveAll(trashDir)
+
+	config.Trash = TrashConfig{
+		Enabled:     true,
+		Dir:         trashDir,
+		GracePeriod: time.Hour,
+	}
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	s, c := CAStoreFixtureWithClock(config, clk)
+	defer c()
+
+	blob := core.NewBlobFixture()
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	require.NoError(s.DeleteCacheFile(blob.Digest.Hex()))
+
+	_, err = s.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+
+	require.NoError(s.janitor.purge())
+	files, err := os.ReadDir(trashDir)
+	require.NoError(err)
+	require.Len(files, 1)
+
+	clk.Add(time.Hour + time.Second)
+	require.NoError(s.janitor.purge())
+	files, err = os.ReadDir(trashDir)
+	require.NoError(err)
+	require.Empty(files)
+}
@@ -16,6 +16,7 @@ package store
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/uber/kraken/lib/store/base"
@@ -33,9 +34,14 @@ type uploadStore struct {
 	writePartSize int
 }
 
-func newUploadStore(dir string, readPartSize, writePartSize int) (*uploadStore, error) {
-	// Always wipe upload directory on startup.
-	if err := os.RemoveAll(dir); err != nil {
+// _resumableUploadDir holds uploads which survive restarts. See ResumeUpload.
+const _resumableUploadDir = "resumable"
+
+func newUploadStore(
+	dir string, readPartSize, writePartSize int, cipher *base.Cipher, durability base.Durability) (*uploadStore, error) {
+
+	// Always wipe upload directory on startup, except for resumable uploads.
+	if err := wipeUploadDir(dir); err != nil {
 		log.Errorf("Error removing upload directory: %s", err)
 	}
 
@@ -43,12 +49,33 @@ func newUploadStore(dir string, readPartSize, writePartSize int) (*uploadStore,
 		return nil, fmt.Errorf("mkdir: %s", err)
 	}
 	state := base.NewFileState(dir)
-	backend := base.NewLocalFileStore(clock.New())
+	backend := base.NewLocalFileStoreWithLRUConfig(
+		base.LRUConfig{Cipher: cipher, Durability: durability}, clock.New())
 	return &uploadStore{state, backend, readPartSize, writePartSize}, nil
 }
 
+// wipeUploadDir removes everything under dir except resumable uploads.
+func wipeUploadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == _resumableUploadDir && e.IsDir() {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *uploadStore) CreateUploadFile(name string, length int64) error {
-	return s.backend.NewFileOp().CreateFile(name, s.state, length)
+	return s.newFileOp().CreateFile(name, s.state, length)
 }
 
 func (s *uploadStore) GetUploadFileStat(name string) (os.FileInfo, error) {
@@ -19,7 +19,8 @@ import (
 )
 
 func createOrUpdateSymlink(sourcePath, targetPath string) error {
-	if _, err := os.Stat(targetPath); err == nil {
+	// Lstat, so dangling symlinks to a lost volume are updated too.
+	if _, err := os.Lstat(targetPath); err == nil {
 		if existingSource, err := os.Readlink(targetPath); err != nil {
 			return err
 		} else if existingSource != sourcePath {
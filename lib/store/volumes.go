@@ -0,0 +1,206 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/lib/hrw"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/spaolacci/murmur3"
+	"github.com/uber-go/tally"
+)
+
+const _volumeProbeFile = ".kraken_volume_probe"
+
+// VolumeHealthConfig defines configuration for probing volumes. Subdirectories
+// placed on a volume which keeps failing probes are moved to the next volume
+// in hash order, until the volume recovers.
+type VolumeHealthConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+
+	// Consecutive failed probes before a volume is considered unhealthy.
+	FailureThreshold int `yaml:"failure_threshold"`
+}
+
+func (c VolumeHealthConfig) applyDefaults() VolumeHealthConfig {
+	if c.Interval == 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = 3
+	}
+	return c
+}
+
+// volumeManager stripes the 256 top level shards of a CAS directory across
+// volumes using rendezvous hashing. Each shard is a symlink to a directory on
+// the volume it is placed on.
+type volumeManager struct {
+	dir     string
+	volumes []Volume
+	config  VolumeHealthConfig
+	clk     clock.Clock
+	stats   tally.Scope
+	hash    *hrw.RendezvousHash
+
+	mu        sync.Mutex
+	failures  map[string]int
+	unhealthy map[string]bool
+
+	stopOnce sync.Once
+	stopc    chan struct{}
+}
+
+func newVolumeManager(
+	dir string, volumes []Volume, config VolumeHealthConfig, clk clock.Clock, stats tally.Scope) (*volumeManager, error) {
+
+	rendezvousHash := hrw.NewRendezvousHash(
+		func() hash.Hash { return murmur3.New64() },
+		hrw.UInt64ToFloat64)
+
+	for _, v := range volumes {
+		if _, err := os.Stat(v.Location); err != nil {
+			return nil, fmt.Errorf("verify volume: %s", err)
+		}
+		rendezvousHash.AddNode(v.Location, v.Weight)
+	}
+
+	m := &volumeManager{
+		dir:     dir,
+		volumes: volumes,
+		config:  config.applyDefaults(),
+		clk:     clk,
+		stats: stats.Tagged(map[string]string{
+			"module": "storevolumes",
+		}),
+		hash:      rendezvousHash,
+		failures:  make(map[string]int),
+		unhealthy: make(map[string]bool),
+		stopc:     make(chan struct{}),
+	}
+	if err := m.place(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// place creates or updates the shard symlinks under dir. Each shard is placed
+// on the highest scoring healthy volume, so only shards of unhealthy volumes
+// move.
+func (m *volumeManager) place() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for subdirIndex := 0; subdirIndex < 256; subdirIndex++ {
+		subdirName := fmt.Sprintf("%02X", subdirIndex)
+		nodes := m.hash.GetOrderedNodes(subdirName, len(m.volumes))
+		if len(nodes) == 0 {
+			return fmt.Errorf("calculate volume for subdir: %s", subdirName)
+		}
+		// If every volume is unhealthy, keep the default placement.
+		location := nodes[0].Label
+		for _, node := range nodes {
+			if !m.unhealthy[node.Label] {
+				location = node.Label
+				break
+			}
+		}
+		sourcePath := path.Join(location, path.Base(m.dir), subdirName)
+		if err := os.MkdirAll(sourcePath, 0775); err != nil {
+			return fmt.Errorf("volume source path: %s", err)
+		}
+		targetPath := path.Join(m.dir, subdirName)
+		if err := createOrUpdateSymlink(sourcePath, targetPath); err != nil {
+			return fmt.Errorf("symlink to volume: %s", err)
+		}
+	}
+	return nil
+}
+
+func (m *volumeManager) start() {
+	ticker := m.clk.Ticker(m.config.Interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.check()
+			case <-m.stopc:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (m *volumeManager) stop() {
+	m.stopOnce.Do(func() { close(m.stopc) })
+}
+
+// check probes every volume once, and re-places shards if any volume became
+// unhealthy or recovered.
+func (m *volumeManager) check() {
+	var changed bool
+	for _, v := range m.volumes {
+		err := probeVolume(v.Location)
+
+		m.mu.Lock()
+		if err != nil {
+			m.failures[v.Location]++
+			if m.failures[v.Location] >= m.config.FailureThreshold && !m.unhealthy[v.Location] {
+				log.With("volume", v.Location).Errorf("Marking volume unhealthy: %s", err)
+				m.unhealthy[v.Location] = true
+				changed = true
+			}
+		} else {
+			m.failures[v.Location] = 0
+			if m.unhealthy[v.Location] {
+				log.With("volume", v.Location).Info("Volume recovered")
+				delete(m.unhealthy, v.Location)
+				changed = true
+			}
+		}
+		healthy := !m.unhealthy[v.Location]
+		m.mu.Unlock()
+
+		gauge := m.stats.Tagged(map[string]string{"volume": v.Location}).Gauge("healthy")
+		if healthy {
+			gauge.Update(1)
+		} else {
+			gauge.Update(0)
+		}
+	}
+	if changed {
+		if err := m.place(); err != nil {
+			log.Errorf("Error placing volumes: %s", err)
+		}
+	}
+}
+
+// probeVolume verifies location is writable.
+func probeVolume(location string) error {
+	p := path.Join(location, _volumeProbeFile)
+	if err := os.WriteFile(p, []byte{}, 0775); err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
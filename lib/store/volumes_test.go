@@ -0,0 +1,70 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func countLinksTo(require *require.Assertions, dir, volume string) int {
+	links, err := os.ReadDir(dir)
+	require.NoError(err)
+	var n int
+	for _, link := range links {
+		source, err := os.Readlink(path.Join(dir, link.Name()))
+		require.NoError(err)
+		if strings.HasPrefix(source, volume) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestVolumeManagerFailover(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	volume1 := t.TempDir()
+	volume2 := t.TempDir()
+
+	m, err := newVolumeManager(dir, []Volume{
+		{Location: volume1, Weight: 100},
+		{Location: volume2, Weight: 100},
+	}, VolumeHealthConfig{FailureThreshold: 2}, clock.NewMock(), tally.NoopScope)
+	require.NoError(err)
+
+	n1 := countLinksTo(require, dir, volume1)
+	require.True(n1 > 0)
+	require.Equal(256, n1+countLinksTo(require, dir, volume2))
+
+	// Volume1 disappears. Shards only move once the threshold is reached.
+	require.NoError(os.RemoveAll(volume1))
+	m.check()
+	require.Equal(n1, countLinksTo(require, dir, volume1))
+	m.check()
+	require.Equal(0, countLinksTo(require, dir, volume1))
+	require.Equal(256, countLinksTo(require, dir, volume2))
+
+	// Once volume1 recovers, its shards move back.
+	require.NoError(os.MkdirAll(volume1, 0775))
+	m.check()
+	require.Equal(n1, countLinksTo(require, dir, volume1))
+}
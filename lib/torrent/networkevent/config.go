@@ -13,8 +13,88 @@
 // limitations under the License.
 package networkevent
 
-// Config defines network event configuration.
+import "time"
+
+// Config defines network event configuration. Enabled only controls the event
+// log file: sinks are enabled separately, so events may be shipped to sinks
+// without logging them.
 type Config struct {
 	LogPath string `yaml:"log_path"`
 	Enabled bool   `yaml:"enabled"`
+
+	Kafka KafkaConfig `yaml:"kafka"`
+	OTLP  OTLPConfig  `yaml:"otlp"`
+}
+
+// BatchConfig defines how events are buffered before being shipped to a sink.
+type BatchConfig struct {
+
+	// Size is the max number of events sent in a single batch.
+	Size int `yaml:"size"`
+
+	// Interval is the max duration events are buffered before being sent.
+	Interval time.Duration `yaml:"interval"`
+
+	// QueueSize is the max number of events buffered while the sink is slow or
+	// unavailable. Events produced while the queue is full are dropped, so a
+	// slow sink never blocks the scheduler.
+	QueueSize int `yaml:"queue_size"`
+
+	// Timeout bounds sending a single batch.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c BatchConfig) applyDefaults() BatchConfig {
+	if c.Size == 0 {
+		c.Size = 500
+	}
+	if c.Interval == 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 10000
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// KafkaConfig defines shipping events to a Kafka topic through a Kafka REST
+// proxy, which avoids a native Kafka client in every agent.
+type KafkaConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// RESTProxy is the address of the Kafka REST proxy, e.g.
+	// http://kafka-rest:8082.
+	RESTProxy string `yaml:"rest_proxy"`
+
+	Topic string `yaml:"topic"`
+
+	Batch BatchConfig `yaml:"batch"`
+}
+
+// OTLPConfig defines shipping events as log records to an OTLP/HTTP logs
+// endpoint, e.g. an OpenTelemetry collector.
+type OTLPConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Endpoint is the url of the logs endpoint, e.g.
+	// http://otel-collector:4318/v1/logs.
+	Endpoint string `yaml:"endpoint"`
+
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string `yaml:"headers"`
+
+	// ServiceName is the service.name resource attribute of log records.
+	ServiceName string `yaml:"service_name"`
+
+	Batch BatchConfig `yaml:"batch"`
+}
+
+func (c OTLPConfig) applyDefaults() OTLPConfig {
+	if c.ServiceName == "" {
+		c.ServiceName = "kraken"
+	}
+	return c
 }
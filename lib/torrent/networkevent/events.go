@@ -38,12 +38,18 @@ const (
 	TorrentCancelled Name = "torrent_cancelled"
 )
 
+// SchemaVersion is the version of the Event schema. It must be incremented
+// whenever fields are removed or change meaning, so consumers can handle events
+// of old and new producers. Events without a version predate versioning.
+const SchemaVersion = 1
+
 // Event consolidates all possible event fields.
 type Event struct {
-	Name    Name      `json:"event"`
-	Torrent string    `json:"torrent"`
-	Self    string    `json:"self"`
-	Time    time.Time `json:"ts"`
+	Name          Name      `json:"event"`
+	Torrent       string    `json:"torrent"`
+	Self          string    `json:"self"`
+	Time          time.Time `json:"ts"`
+	SchemaVersion int       `json:"schema_version"`
 
 	// Optional fields.
 	Peer         string `json:"peer,omitempty"`
@@ -55,10 +61,11 @@ type Event struct {
 
 func baseEvent(name Name, h core.InfoHash, self core.PeerID) *Event {
 	return &Event{
-		Name:    name,
-		Torrent: h.String(),
-		Self:    self.String(),
-		Time:    time.Now(),
+		Name:          name,
+		Torrent:       h.String(),
+		Self:          self.String(),
+		Time:          time.Now(),
+		SchemaVersion: SchemaVersion,
 	}
 }
 
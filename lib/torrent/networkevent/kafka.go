@@ -0,0 +1,39 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import "github.com/uber/kraken/lib/kafkarest"
+
+// kafkaSink produces events to a Kafka topic through a Kafka REST proxy.
+// Records are keyed by torrent, so the events of a torrent are ordered.
+type kafkaSink struct {
+	producer *kafkarest.Producer
+}
+
+func newKafkaSink(config KafkaConfig) (*kafkaSink, error) {
+	p, err := kafkarest.NewProducer(
+		config.RESTProxy, config.Topic, config.Batch.applyDefaults().Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaSink{p}, nil
+}
+
+func (s *kafkaSink) send(events []*Event) error {
+	records := make([]kafkarest.Record, len(events))
+	for i, e := range events {
+		records[i] = kafkarest.Record{Key: e.Torrent, Value: e}
+	}
+	return s.producer.Produce(records...)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// _otlpScope is the instrumentation scope of network event log records.
+const _otlpScope = "github.com/uber/kraken/lib/torrent/networkevent"
+
+// The following types are the subset of the OTLP/HTTP json encoding of logs
+// which network events require.
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // int64 values are strings in json.
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{key, otlpAnyValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpKeyValue {
+	s := strconv.FormatInt(value, 10)
+	return otlpKeyValue{key, otlpAnyValue{IntValue: &s}}
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Body         otlpAnyValue   `json:"body"`
+	Attributes   []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+// otlpSink exports events as log records to an OTLP/HTTP logs endpoint. The
+// body of each record is the json encoded event, and the name, torrent and
+// schema version of the event are attributes, so collectors can route events
+// without parsing bodies.
+type otlpSink struct {
+	config OTLPConfig
+}
+
+func newOTLPSink(config OTLPConfig) (*otlpSink, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("no endpoint supplied")
+	}
+	return &otlpSink{config.applyDefaults()}, nil
+}
+
+func (s *otlpSink) send(events []*Event) error {
+	records := make([]otlpLogRecord, len(events))
+	for i, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("json: %s", err)
+		}
+		body := string(b)
+		records[i] = otlpLogRecord{
+			TimeUnixNano: strconv.FormatInt(e.Time.UnixNano(), 10),
+			Body:         otlpAnyValue{StringValue: &body},
+			Attributes: []otlpKeyValue{
+				otlpString("event.name", string(e.Name)),
+				otlpString("kraken.torrent", e.Torrent),
+				otlpString("kraken.peer_id", e.Self),
+				otlpInt("kraken.schema_version", int64(e.SchemaVersion)),
+			},
+		}
+	}
+	req := otlpRequest{
+		ResourceLogs: []otlpResourceLogs{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{otlpString("service.name", s.config.ServiceName)},
+			},
+			ScopeLogs: []otlpScopeLogs{{
+				Scope:      otlpScope{_otlpScope, strconv.Itoa(SchemaVersion)},
+				LogRecords: records,
+			}},
+		}},
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	for k, v := range s.config.Headers {
+		headers[k] = v
+	}
+	resp, err := httputil.Post(
+		s.config.Endpoint,
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendHeaders(headers),
+		httputil.SendTimeout(s.config.Batch.applyDefaults().Timeout))
+	if err != nil {
+		return err
+	}
+	closers.Close(resp.Body)
+	return nil
+}
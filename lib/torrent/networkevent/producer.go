@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/utils/log"
 )
 
@@ -29,11 +30,16 @@ type Producer interface {
 }
 
 type producer struct {
-	file *os.File
+	file  *os.File
+	sinks []*batcher
 }
 
 // NewProducer creates a new Producer.
-func NewProducer(config Config) (Producer, error) {
+func NewProducer(config Config, stats tally.Scope) (Producer, error) {
+	stats = stats.Tagged(map[string]string{
+		"module": "networkevent",
+	})
+
 	var f *os.File
 	if config.Enabled {
 		if config.LogPath == "" {
@@ -55,13 +61,33 @@ func NewProducer(config Config) (Producer, error) {
 			return nil, fmt.Errorf("open %d: %s", flag, err)
 		}
 	} else {
-		log.Warn("Kafka network events disabled")
+		log.Warn("Network event log disabled")
 	}
-	return &producer{f}, nil
+	p := &producer{file: f}
+	if config.Kafka.Enabled {
+		s, err := newKafkaSink(config.Kafka)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("kafka sink: %s", err)
+		}
+		p.sinks = append(p.sinks, newBatcher("kafka", config.Kafka.Batch, s, stats))
+	}
+	if config.OTLP.Enabled {
+		s, err := newOTLPSink(config.OTLP)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("otlp sink: %s", err)
+		}
+		p.sinks = append(p.sinks, newBatcher("otlp", config.OTLP.Batch, s, stats))
+	}
+	return p, nil
 }
 
 // Produce emits a network event.
 func (p *producer) Produce(e *Event) {
+	for _, s := range p.sinks {
+		s.add(e)
+	}
 	if p.file == nil {
 		return
 	}
@@ -77,8 +103,11 @@ func (p *producer) Produce(e *Event) {
 	}
 }
 
-// Close closes the producer.
+// Close closes the producer, sending all events queued for sinks.
 func (p *producer) Close() error {
+	for _, s := range p.sinks {
+		s.close()
+	}
 	if p.file == nil {
 		return nil
 	}
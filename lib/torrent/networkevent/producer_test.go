@@ -16,14 +16,43 @@ package networkevent
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/kafkarest"
+	"github.com/uber/kraken/utils/testutil"
 )
 
+type recordedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// recordRequests starts a server which records requests to path. Returns the
+// address of the server.
+func recordRequests(t *testing.T, path string) (string, <-chan recordedRequest) {
+	requests := make(chan recordedRequest, 16)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		requests <- recordedRequest{r.Header, b}
+	})
+	addr, stop := testutil.StartServer(mux)
+	t.Cleanup(stop)
+	return addr, requests
+}
+
 func TestProducerCreatesAndReusesFile(t *testing.T) {
 	require := require.New(t)
 
@@ -46,7 +75,7 @@ func TestProducerCreatesAndReusesFile(t *testing.T) {
 	}
 
 	// First producer should create the file.
-	p, err := NewProducer(config)
+	p, err := NewProducer(config, tally.NoopScope)
 	require.NoError(err)
 	for _, e := range events[:2] {
 		p.Produce(e)
@@ -54,7 +83,7 @@ func TestProducerCreatesAndReusesFile(t *testing.T) {
 	require.NoError(p.Close())
 
 	// Second producer should reuse the existing file.
-	p, err = NewProducer(config)
+	p, err = NewProducer(config, tally.NoopScope)
 	require.NoError(err)
 	for _, e := range events[2:] {
 		p.Produce(e)
@@ -86,8 +115,95 @@ func TestDisabledProducerNoops(t *testing.T) {
 	peer1 := core.PeerIDFixture()
 	peer2 := core.PeerIDFixture()
 
-	p, err := NewProducer(Config{})
+	p, err := NewProducer(Config{}, tally.NoopScope)
 	require.NoError(err)
 
 	p.Produce(ReceivePieceEvent(h, peer1, peer2, 1))
 }
+
+func TestProducerShipsEventsToKafka(t *testing.T) {
+	require := require.New(t)
+
+	addr, requests := recordRequests(t, "/topics/netevents")
+
+	p, err := NewProducer(Config{
+		Kafka: KafkaConfig{
+			Enabled:   true,
+			RESTProxy: addr,
+			Topic:     "netevents",
+		},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	events := eventsFixture(2)
+	for _, e := range events {
+		p.Produce(e)
+	}
+	require.NoError(p.Close())
+
+	r := <-requests
+	require.Equal(kafkarest.ContentType, r.header.Get("Content-Type"))
+	var body struct {
+		Records []struct {
+			Key   string `json:"key"`
+			Value *Event `json:"value"`
+		} `json:"records"`
+	}
+	require.NoError(json.Unmarshal(r.body, &body))
+	require.Len(body.Records, 2)
+	for i, r := range body.Records {
+		require.Equal(events[i].Torrent, r.Key)
+		require.Equal(SchemaVersion, r.Value.SchemaVersion)
+		require.Equal(
+			StripTimestamps([]*Event{events[i]}), StripTimestamps([]*Event{r.Value}))
+	}
+}
+
+func TestProducerShipsEventsToOTLP(t *testing.T) {
+	require := require.New(t)
+
+	addr, requests := recordRequests(t, "/v1/logs")
+
+	p, err := NewProducer(Config{
+		OTLP: OTLPConfig{
+			Enabled:     true,
+			Endpoint:    fmt.Sprintf("http://%s/v1/logs", addr),
+			Headers:     map[string]string{"Authorization": "secret"},
+			ServiceName: "kraken-agent",
+		},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	events := eventsFixture(2)
+	for _, e := range events {
+		p.Produce(e)
+	}
+	require.NoError(p.Close())
+
+	r := <-requests
+	require.Equal("secret", r.header.Get("Authorization"))
+	var body otlpRequest
+	require.NoError(json.Unmarshal(r.body, &body))
+	require.Len(body.ResourceLogs, 1)
+	require.Equal(
+		[]otlpKeyValue{otlpString("service.name", "kraken-agent")},
+		body.ResourceLogs[0].Resource.Attributes)
+	require.Len(body.ResourceLogs[0].ScopeLogs, 1)
+	records := body.ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(records, 2)
+	for i, r := range records {
+		e := new(Event)
+		require.NoError(json.Unmarshal([]byte(*r.Body.StringValue), e))
+		require.Equal(
+			StripTimestamps([]*Event{events[i]}), StripTimestamps([]*Event{e}))
+		require.Contains(r.Attributes, otlpString("event.name", string(ReceivePiece)))
+	}
+}
+
+func TestProducerRejectsInvalidSinkConfig(t *testing.T) {
+	_, err := NewProducer(Config{Kafka: KafkaConfig{Enabled: true}}, tally.NoopScope)
+	require.Error(t, err)
+
+	_, err = NewProducer(Config{OTLP: OTLPConfig{Enabled: true}}, tally.NoopScope)
+	require.Error(t, err)
+}
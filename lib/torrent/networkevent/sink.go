@@ -0,0 +1,120 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/utils/log"
+)
+
+// sink ships batches of events to an external system.
+type sink interface {
+	send(events []*Event) error
+}
+
+// batcher buffers events produced for a sink and sends them in batches from a
+// background goroutine.
+type batcher struct {
+	name   string
+	config BatchConfig
+	sink   sink
+	stats  tally.Scope
+
+	events    chan *Event
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func newBatcher(name string, config BatchConfig, s sink, stats tally.Scope) *batcher {
+	config = config.applyDefaults()
+	b := &batcher{
+		name:   name,
+		config: config,
+		sink:   s,
+		stats: stats.Tagged(map[string]string{
+			"sink": name,
+		}),
+		events: make(chan *Event, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return b
+}
+
+// add queues e for sending. Drops e if the queue is full.
+func (b *batcher) add(e *Event) {
+	select {
+	case b.events <- e:
+	default:
+		b.stats.Counter("network_events_dropped").Inc(1)
+	}
+}
+
+// close sends all queued events and stops the batcher.
+func (b *batcher) close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		b.wg.Wait()
+	})
+}
+
+func (b *batcher) loop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.config.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, b.config.Size)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := b.sink.send(batch); err != nil {
+			log.With("sink", b.name).Errorf("Error sending network events: %s", err)
+			b.stats.Counter("network_events_failed").Inc(int64(len(batch)))
+		} else {
+			b.stats.Counter("network_events_sent").Inc(int64(len(batch)))
+		}
+		batch = make([]*Event, 0, b.config.Size)
+	}
+	for {
+		select {
+		case e := <-b.events:
+			batch = append(batch, e)
+			if len(batch) >= b.config.Size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.done:
+			for {
+				select {
+				case e := <-b.events:
+					batch = append(batch, e)
+					if len(batch) >= b.config.Size {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	batches [][]*Event
+	unblock chan struct{} // If set, send blocks until unblock is closed.
+}
+
+func (s *fakeSink) send(events []*Event) error {
+	if s.unblock != nil {
+		<-s.unblock
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+func (s *fakeSink) getBatches() [][]*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([][]*Event(nil), s.batches...)
+}
+
+func eventsFixture(n int) []*Event {
+	h := core.InfoHashFixture()
+	self := core.PeerIDFixture()
+	peer := core.PeerIDFixture()
+
+	var events []*Event
+	for i := 0; i < n; i++ {
+		events = append(events, ReceivePieceEvent(h, self, peer, i))
+	}
+	return events
+}
+
+func TestBatcherSendsFullBatches(t *testing.T) {
+	require := require.New(t)
+
+	s := &fakeSink{}
+	b := newBatcher("fake", BatchConfig{Size: 2, Interval: time.Hour}, s, tally.NoopScope)
+
+	events := eventsFixture(5)
+	for _, e := range events {
+		b.add(e)
+	}
+	require.Eventually(func() bool {
+		return len(s.getBatches()) == 2
+	}, 5*time.Second, time.Millisecond)
+
+	// Closing sends the partial batch.
+	b.close()
+	require.Equal([][]*Event{events[:2], events[2:4], events[4:]}, s.getBatches())
+}
+
+func TestBatcherSendsPartialBatchesOnInterval(t *testing.T) {
+	require := require.New(t)
+
+	s := &fakeSink{}
+	b := newBatcher("fake", BatchConfig{Size: 10, Interval: 10 * time.Millisecond}, s, tally.NoopScope)
+	defer b.close()
+
+	events := eventsFixture(1)
+	b.add(events[0])
+
+	require.Eventually(func() bool {
+		return len(s.getBatches()) == 1
+	}, 5*time.Second, time.Millisecond)
+	require.Equal([][]*Event{events}, s.getBatches())
+}
+
+func TestBatcherDropsEventsWhenQueueIsFull(t *testing.T) {
+	require := require.New(t)
+
+	s := &fakeSink{unblock: make(chan struct{})}
+	b := newBatcher("fake", BatchConfig{Size: 1, QueueSize: 1}, s, tally.NoopScope)
+
+	events := eventsFixture(3)
+
+	// The first event is sent, which blocks the sink.
+	b.add(events[0])
+	require.Eventually(func() bool {
+		return len(b.events) == 0
+	}, 5*time.Second, time.Millisecond)
+
+	// The second event is queued and the third is dropped.
+	b.add(events[1])
+	b.add(events[2])
+
+	close(s.unblock)
+	b.close()
+	require.Equal([][]*Event{events[:1], events[1:2]}, s.getBatches())
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/uber/kraken/core"
+)
+
+// activeTorrent identifies a torrent which was active in the scheduler. The
+// pieces of the torrent are tracked by the torrent archive, so resuming the
+// torrent picks up from the pieces already on disk.
+type activeTorrent struct {
+	Namespace string      `json:"namespace"`
+	Digest    core.Digest `json:"digest"`
+}
+
+// activeTorrents persists the torrents active in the scheduler to a file, so
+// they can be resumed when the scheduler restarts. Not thread-safe: must only
+// be used from the event loop. All operations are no-ops if path is empty.
+type activeTorrents struct {
+	path     string
+	torrents map[core.InfoHash]activeTorrent
+}
+
+func newActiveTorrents(path string) *activeTorrents {
+	return &activeTorrents{
+		path:     path,
+		torrents: make(map[core.InfoHash]activeTorrent),
+	}
+}
+
+// load returns the torrents which were persisted to a.path. Returns no torrents
+// if the file does not exist.
+func (a *activeTorrents) load() ([]activeTorrent, error) {
+	if a.path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read file: %s", err)
+	}
+	var torrents []activeTorrent
+	if err := json.Unmarshal(b, &torrents); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	return torrents, nil
+}
+
+// add persists the torrent of h.
+func (a *activeTorrents) add(h core.InfoHash, namespace string, d core.Digest) error {
+	if a.path == "" {
+		return nil
+	}
+	a.torrents[h] = activeTorrent{namespace, d}
+	return a.save()
+}
+
+// remove stops persisting the torrent of h.
+func (a *activeTorrents) remove(h core.InfoHash) error {
+	if a.path == "" {
+		return nil
+	}
+	if _, ok := a.torrents[h]; !ok {
+		return nil
+	}
+	delete(a.torrents, h)
+	return a.save()
+}
+
+// save atomically replaces the contents of a.path with the active torrents.
+func (a *activeTorrents) save() error {
+	torrents := make([]activeTorrent, 0, len(a.torrents))
+	for _, t := range a.torrents {
+		torrents = append(torrents, t)
+	}
+	sort.Slice(torrents, func(i, j int) bool {
+		return torrents[i].Digest.String() < torrents[j].Digest.String()
+	})
+	b, err := json.Marshal(torrents)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0775); err != nil {
+		return fmt.Errorf("mkdir: %s", err)
+	}
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("write file: %s", err)
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveTorrentsAddAndRemove(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "state", "active_torrents.json")
+
+	a := newActiveTorrents(path)
+
+	torrents, err := a.load()
+	require.NoError(err)
+	require.Empty(torrents)
+
+	h1, d1 := core.InfoHashFixture(), core.DigestFixture()
+	h2, d2 := core.InfoHashFixture(), core.DigestFixture()
+
+	require.NoError(a.add(h1, "foo", d1))
+	require.NoError(a.add(h2, "bar", d2))
+
+	torrents, err = newActiveTorrents(path).load()
+	require.NoError(err)
+	require.ElementsMatch([]activeTorrent{{"foo", d1}, {"bar", d2}}, torrents)
+
+	require.NoError(a.remove(h1))
+	require.NoError(a.remove(core.InfoHashFixture()))
+
+	torrents, err = newActiveTorrents(path).load()
+	require.NoError(err)
+	require.Equal([]activeTorrent{{"bar", d2}}, torrents)
+}
+
+func TestActiveTorrentsDisabled(t *testing.T) {
+	require := require.New(t)
+
+	a := newActiveTorrents("")
+
+	require.NoError(a.add(core.InfoHashFixture(), "foo", core.DigestFixture()))
+
+	torrents, err := a.load()
+	require.NoError(err)
+	require.Empty(torrents)
+}
+
+func TestActiveTorrentsLoadInvalidFile(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "active_torrents.json")
+	require.NoError(os.WriteFile(path, []byte("not json"), 0644))
+
+	_, err := newActiveTorrents(path).load()
+	require.Error(err)
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package adaptive tunes the connection limits and pipeline depth of the
+// scheduler to the observed utilization and latency of the network, so the
+// same configuration performs well on hosts with different network capacity.
+package adaptive
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+)
+
+const (
+	// _increase is added to the scale of limits while the network is
+	// underutilized.
+	_increase = 0.1
+
+	// _decrease multiplies the scale of limits while the network is congested.
+	_decrease = 0.7
+
+	// _baselineWindow is the number of recent samples the baseline latency is
+	// the minimum of.
+	_baselineWindow = 12
+)
+
+// Config defines the configuration of a Controller. Limits are scaled together
+// between their minimum and maximum.
+type Config struct {
+
+	// Enabled enables adaptive limits. Static limits apply otherwise.
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is the interval in which limits are adjusted.
+	Interval time.Duration `yaml:"interval"`
+
+	// EgressBitsPerSec and IngressBitsPerSec are the capacity of the network.
+	// If unset, the capacity is the link speed of Interface.
+	EgressBitsPerSec  uint64 `yaml:"egress_bits_per_sec"`
+	IngressBitsPerSec uint64 `yaml:"ingress_bits_per_sec"`
+
+	// Interface is the network interface whose link speed is the capacity of
+	// the network, e.g. eth0. Only supported on Linux.
+	Interface string `yaml:"interface"`
+
+	// Limits are raised while utilization is below LowUtilization, and
+	// lowered while utilization is at least HighUtilization.
+	LowUtilization  float64 `yaml:"low_utilization"`
+	HighUtilization float64 `yaml:"high_utilization"`
+
+	// LatencyTolerance is the factor by which the latency of piece requests
+	// may exceed its recent minimum before the network is considered
+	// congested, regardless of utilization.
+	LatencyTolerance float64 `yaml:"latency_tolerance"`
+
+	MinConnsPerTorrent int `yaml:"min_conns_per_torrent"`
+	MaxConnsPerTorrent int `yaml:"max_conns_per_torrent"`
+
+	MinGlobalConns int `yaml:"min_global_conns"`
+	MaxGlobalConns int `yaml:"max_global_conns"`
+
+	MinPipelineLimit int `yaml:"min_pipeline_limit"`
+	MaxPipelineLimit int `yaml:"max_pipeline_limit"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Interval == 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.LowUtilization == 0 {
+		c.LowUtilization = 0.5
+	}
+	if c.HighUtilization == 0 {
+		c.HighUtilization = 0.9
+	}
+	if c.LatencyTolerance == 0 {
+		c.LatencyTolerance = 2
+	}
+	if c.MinConnsPerTorrent == 0 {
+		c.MinConnsPerTorrent = 2
+	}
+	if c.MaxConnsPerTorrent == 0 {
+		c.MaxConnsPerTorrent = 50
+	}
+	if c.MinGlobalConns == 0 {
+		c.MinGlobalConns = 20
+	}
+	if c.MaxGlobalConns == 0 {
+		c.MaxGlobalConns = 1000
+	}
+	if c.MinPipelineLimit == 0 {
+		c.MinPipelineLimit = 1
+	}
+	if c.MaxPipelineLimit == 0 {
+		c.MaxPipelineLimit = 16
+	}
+	return c
+}
+
+func (c Config) validate() error {
+	if c.LowUtilization >= c.HighUtilization {
+		return errors.New("low_utilization must be below high_utilization")
+	}
+	if c.LatencyTolerance < 1 {
+		return errors.New("latency_tolerance must be at least 1")
+	}
+	for _, r := range []struct {
+		name     string
+		min, max int
+	}{
+		{"conns_per_torrent", c.MinConnsPerTorrent, c.MaxConnsPerTorrent},
+		{"global_conns", c.MinGlobalConns, c.MaxGlobalConns},
+		{"pipeline_limit", c.MinPipelineLimit, c.MaxPipelineLimit},
+	} {
+		if r.min < 1 || r.min > r.max {
+			return fmt.Errorf("invalid %s range [%d, %d]", r.name, r.min, r.max)
+		}
+	}
+	return nil
+}
+
+// Limits are the limits a Controller sets.
+type Limits struct {
+	ConnsPerTorrent int
+	GlobalConns     int
+	PipelineLimit   int
+}
+
+// Sample is an observation of the scheduler.
+type Sample struct {
+
+	// Total piece bytes sent and received.
+	EgressBytes  int64
+	IngressBytes int64
+
+	// Latency is the mean latency of piece requests fulfilled since the last
+	// sample, or 0 if none were.
+	Latency time.Duration
+
+	// ConnsPerTorrent is the current per-torrent conn limit.
+	ConnsPerTorrent int
+
+	// Busy is whether any torrent is downloading or has peers. Limits are only
+	// raised while busy, since utilization of idle schedulers is low
+	// regardless of limits.
+	Busy bool
+}
+
+// Controller adjusts limits with additive increase and multiplicative decrease
+// of a scale in [0, 1], which interpolates each limit between its minimum and
+// maximum. Not thread-safe.
+type Controller struct {
+	config     Config
+	clk        clock.Clock
+	egressCap  float64
+	ingressCap float64
+
+	scale       float64
+	utilization float64
+	last        Sample
+	lastAt      time.Time
+	latencies   []time.Duration // Most recent last.
+}
+
+// New creates a new Controller.
+func New(config Config, clk clock.Clock) (*Controller, error) {
+	config = config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	egress, ingress := config.EgressBitsPerSec, config.IngressBitsPerSec
+	if (egress == 0 || ingress == 0) && config.Interface != "" {
+		speed, err := linkSpeed(config.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("link speed: %s", err)
+		}
+		if egress == 0 {
+			egress = speed
+		}
+		if ingress == 0 {
+			ingress = speed
+		}
+	}
+	if egress == 0 || ingress == 0 {
+		return nil, errors.New(
+			"network capacity unknown: set interface, or egress_bits_per_sec and ingress_bits_per_sec")
+	}
+	return &Controller{
+		config:     config,
+		clk:        clk,
+		egressCap:  float64(egress),
+		ingressCap: float64(ingress),
+	}, nil
+}
+
+// Interval returns the interval in which Update should be called.
+func (c *Controller) Interval() time.Duration {
+	return c.config.Interval
+}
+
+// Utilization returns the utilization of the network as of the last sample,
+// i.e. the greater of the egress and ingress rate relative to their capacity.
+func (c *Controller) Utilization() float64 {
+	return c.utilization
+}
+
+// Update adjusts limits based on s, and returns the new limits. The scale of
+// limits is initialized from the conn limit of the first sample.
+func (c *Controller) Update(s Sample) Limits {
+	now := c.clk.Now()
+	if c.lastAt.IsZero() {
+		c.scale = position(
+			s.ConnsPerTorrent, c.config.MinConnsPerTorrent, c.config.MaxConnsPerTorrent)
+		c.last, c.lastAt = s, now
+		return c.Limits()
+	}
+	elapsed := now.Sub(c.lastAt).Seconds()
+	if elapsed <= 0 {
+		return c.Limits()
+	}
+	egress := float64(s.EgressBytes-c.last.EgressBytes) * 8 / elapsed
+	ingress := float64(s.IngressBytes-c.last.IngressBytes) * 8 / elapsed
+	c.utilization = math.Max(egress/c.egressCap, ingress/c.ingressCap)
+	c.last, c.lastAt = s, now
+
+	congested := c.utilization >= c.config.HighUtilization
+	if s.Latency > 0 {
+		if b := c.baseline(); b > 0 && float64(s.Latency) > float64(b)*c.config.LatencyTolerance {
+			congested = true
+		}
+		c.latencies = append(c.latencies, s.Latency)
+		if len(c.latencies) > _baselineWindow {
+			c.latencies = c.latencies[1:]
+		}
+	}
+
+	switch {
+	case congested:
+		c.scale *= _decrease
+	case s.Busy && c.utilization < c.config.LowUtilization:
+		c.scale = math.Min(1, c.scale+_increase)
+	}
+	return c.Limits()
+}
+
+// Limits returns the current limits.
+func (c *Controller) Limits() Limits {
+	return Limits{
+		ConnsPerTorrent: c.interpolate(c.config.MinConnsPerTorrent, c.config.MaxConnsPerTorrent),
+		GlobalConns:     c.interpolate(c.config.MinGlobalConns, c.config.MaxGlobalConns),
+		PipelineLimit:   c.interpolate(c.config.MinPipelineLimit, c.config.MaxPipelineLimit),
+	}
+}
+
+// baseline returns the minimum of recent latencies.
+func (c *Controller) baseline() time.Duration {
+	var b time.Duration
+	for _, l := range c.latencies {
+		if b == 0 || l < b {
+			b = l
+		}
+	}
+	return b
+}
+
+func (c *Controller) interpolate(lo, hi int) int {
+	return lo + int(math.Round(c.scale*float64(hi-lo)))
+}
+
+// position returns the scale at which n is interpolated between lo and hi.
+func position(n, lo, hi int) float64 {
+	if n <= lo {
+		return 0
+	}
+	if n >= hi {
+		return 1
+	}
+	return float64(n-lo) / float64(hi-lo)
+}
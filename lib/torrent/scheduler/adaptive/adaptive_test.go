@@ -0,0 +1,127 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package adaptive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// 1000 bytes per second in both directions.
+func configFixture() Config {
+	return Config{
+		EgressBitsPerSec:  8000,
+		IngressBitsPerSec: 8000,
+	}
+}
+
+func TestNewRequiresCapacity(t *testing.T) {
+	_, err := New(Config{}, clock.NewMock())
+	require.Error(t, err)
+}
+
+func TestNewRejectsInvalidRanges(t *testing.T) {
+	config := configFixture()
+	config.MinConnsPerTorrent = 10
+	config.MaxConnsPerTorrent = 5
+
+	_, err := New(config, clock.NewMock())
+	require.Error(t, err)
+}
+
+func TestControllerRaisesLimitsWhileUnderutilized(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	c, err := New(configFixture(), clk)
+	require.NoError(err)
+
+	require.Equal(Limits{2, 20, 1}, c.Update(Sample{ConnsPerTorrent: 2, Busy: true}))
+
+	clk.Add(time.Second)
+	require.Equal(Limits{7, 118, 3}, c.Update(Sample{EgressBytes: 100, Busy: true}))
+	require.InDelta(0.1, c.Utilization(), 0.001)
+}
+
+func TestControllerHoldsLimitsWhileIdle(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	c, err := New(configFixture(), clk)
+	require.NoError(err)
+
+	limits := c.Update(Sample{ConnsPerTorrent: 2})
+
+	clk.Add(time.Second)
+	require.Equal(limits, c.Update(Sample{}))
+}
+
+func TestControllerLowersLimitsWhileSaturated(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	c, err := New(configFixture(), clk)
+	require.NoError(err)
+
+	require.Equal(Limits{50, 1000, 16}, c.Update(Sample{ConnsPerTorrent: 50, Busy: true}))
+
+	clk.Add(time.Second)
+	require.Equal(Limits{36, 706, 12}, c.Update(Sample{IngressBytes: 950, Busy: true}))
+}
+
+func TestControllerLowersLimitsWhenLatencyInflates(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	c, err := New(configFixture(), clk)
+	require.NoError(err)
+
+	c.Update(Sample{ConnsPerTorrent: 26, Busy: true})
+
+	clk.Add(time.Second)
+	raised := c.Update(Sample{Latency: 100 * time.Millisecond, Busy: true})
+
+	clk.Add(time.Second)
+	lowered := c.Update(Sample{Latency: 300 * time.Millisecond, Busy: true})
+	require.True(lowered.ConnsPerTorrent < raised.ConnsPerTorrent)
+}
+
+func TestLinkSpeed(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	defer func(orig string) { _sysClassNet = orig }(_sysClassNet)
+	_sysClassNet = dir
+
+	require.NoError(os.MkdirAll(filepath.Join(dir, "eth0"), 0755))
+	require.NoError(os.WriteFile(filepath.Join(dir, "eth0", "speed"), []byte("1000\n"), 0644))
+	require.NoError(os.MkdirAll(filepath.Join(dir, "veth0"), 0755))
+	require.NoError(os.WriteFile(filepath.Join(dir, "veth0", "speed"), []byte("-1\n"), 0644))
+
+	speed, err := linkSpeed("eth0")
+	require.NoError(err)
+	require.Equal(uint64(1000*1000*1000), speed)
+
+	_, err = linkSpeed("veth0")
+	require.Error(err)
+
+	c, err := New(Config{Interface: "eth0"}, clock.NewMock())
+	require.NoError(err)
+	require.Equal(float64(speed), c.egressCap)
+}
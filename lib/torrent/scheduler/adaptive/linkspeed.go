@@ -0,0 +1,42 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package adaptive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// _sysClassNet is where Linux exposes the attributes of network interfaces.
+var _sysClassNet = "/sys/class/net"
+
+// linkSpeed returns the link speed of iface in bits per second.
+func linkSpeed(iface string) (uint64, error) {
+	b, err := os.ReadFile(filepath.Join(_sysClassNet, iface, "speed"))
+	if err != nil {
+		return 0, fmt.Errorf("read speed: %s", err)
+	}
+	mbps, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse speed: %s", err)
+	}
+	if mbps <= 0 {
+		// Virtual interfaces report -1.
+		return 0, fmt.Errorf("speed of %s is unknown", iface)
+	}
+	return uint64(mbps) * 1000 * 1000, nil
+}
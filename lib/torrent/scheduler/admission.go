@@ -0,0 +1,214 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+// ErrDownloadQueueFull is returned when a download cannot be queued because too
+// many downloads of the same priority are already queued.
+var ErrDownloadQueueFull = errors.New("download queue is full")
+
+// Priority is the priority class of a download. Queued downloads of lower
+// values are admitted first.
+type Priority int
+
+const (
+	// PriorityInteractive is for downloads which clients are waiting on, e.g.
+	// image pulls.
+	PriorityInteractive Priority = iota
+
+	// PriorityPreheat is for downloads of blobs which will likely be pulled
+	// soon.
+	PriorityPreheat
+
+	// PriorityReplication is for background replication of blobs.
+	PriorityReplication
+
+	numPriorities
+)
+
+var _priorityNames = [numPriorities]string{"interactive", "preheat", "replication"}
+
+// ParsePriority parses the name of a priority class.
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range _priorityNames {
+		if name == s {
+			return Priority(p), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q", s)
+}
+
+func (p Priority) String() string {
+	if p < 0 || p >= numPriorities {
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+	return _priorityNames[p]
+}
+
+// AdmissionConfig defines the configuration for admission control of
+// downloads. All limits are unlimited if 0.
+type AdmissionConfig struct {
+
+	// MaxConcurrentDownloads limits the number of downloads across all
+	// priority classes. Once the limit is reached, downloads are queued and
+	// admitted in priority order.
+	MaxConcurrentDownloads int `yaml:"max_concurrent_downloads"`
+
+	Interactive PriorityClassConfig `yaml:"interactive"`
+	Preheat     PriorityClassConfig `yaml:"preheat"`
+	Replication PriorityClassConfig `yaml:"replication"`
+}
+
+// PriorityClassConfig defines the limits of a single priority class.
+type PriorityClassConfig struct {
+
+	// MaxConcurrent limits the number of downloads of the class.
+	MaxConcurrent int `yaml:"max_concurrent"`
+
+	// MaxQueued limits the number of downloads of the class waiting to be
+	// admitted. Downloads beyond the limit fail with ErrDownloadQueueFull.
+	MaxQueued int `yaml:"max_queued"`
+}
+
+type admissionClass struct {
+	priority Priority
+	config   PriorityClassConfig
+	active   int
+	waiting  *list.List // Of chan struct{}, closed once admitted.
+}
+
+// admissionQueue admits downloads subject to global and per-class concurrency
+// limits. Downloads of a class are admitted in FIFO order.
+type admissionQueue struct {
+	maxActive int
+	stats     tally.Scope
+
+	mu      sync.Mutex // Protects the following fields:
+	active  int
+	classes [numPriorities]*admissionClass
+}
+
+func newAdmissionQueue(config AdmissionConfig, stats tally.Scope) *admissionQueue {
+	q := &admissionQueue{
+		maxActive: config.MaxConcurrentDownloads,
+		stats:     stats,
+	}
+	for p, c := range [numPriorities]PriorityClassConfig{
+		config.Interactive, config.Preheat, config.Replication} {
+
+		q.classes[p] = &admissionClass{
+			priority: Priority(p),
+			config:   c,
+			waiting:  list.New(),
+		}
+	}
+	return q
+}
+
+// acquire blocks until a download of priority p is admitted. The returned
+// function must be called once the download finishes. Returns
+// ErrSchedulerStopped if done is closed before the download is admitted.
+func (q *admissionQueue) acquire(p Priority, done <-chan struct{}) (func(), error) {
+	if p < 0 || p >= numPriorities {
+		return nil, fmt.Errorf("invalid priority: %d", p)
+	}
+	stats := q.stats.Tagged(map[string]string{"priority": p.String()})
+
+	q.mu.Lock()
+	c := q.classes[p]
+	if c.waiting.Len() == 0 && q.admissible(c) {
+		q.admit(c)
+		q.mu.Unlock()
+		return func() { q.release(c) }, nil
+	}
+	if c.config.MaxQueued > 0 && c.waiting.Len() >= c.config.MaxQueued {
+		q.mu.Unlock()
+		stats.Counter("download_queue_rejections").Inc(1)
+		return nil, ErrDownloadQueueFull
+	}
+	admitted := make(chan struct{})
+	e := c.waiting.PushBack(admitted)
+	q.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-admitted:
+		stats.Timer("download_queue_time").Record(time.Since(start))
+		return func() { q.release(c) }, nil
+	case <-done:
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-admitted:
+			// Admitted concurrently, so hand the slot to the next download.
+			q.releaseLocked(c)
+		default:
+			c.waiting.Remove(e)
+		}
+		return nil, ErrSchedulerStopped
+	}
+}
+
+func (q *admissionQueue) admissible(c *admissionClass) bool {
+	if q.maxActive > 0 && q.active >= q.maxActive {
+		return false
+	}
+	return c.config.MaxConcurrent == 0 || c.active < c.config.MaxConcurrent
+}
+
+func (q *admissionQueue) admit(c *admissionClass) {
+	c.active++
+	q.active++
+}
+
+func (q *admissionQueue) release(c *admissionClass) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.releaseLocked(c)
+}
+
+// releaseLocked frees the slot of a download of c and admits queued downloads,
+// highest priority first.
+func (q *admissionQueue) releaseLocked(c *admissionClass) {
+	c.active--
+	q.active--
+	for _, c := range q.classes {
+		for c.waiting.Len() > 0 && q.admissible(c) {
+			q.admit(c)
+			close(c.waiting.Remove(c.waiting.Front()).(chan struct{}))
+		}
+	}
+}
+
+// emitStats emits the number of active and queued downloads of each class.
+func (q *admissionQueue) emitStats() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, c := range q.classes {
+		stats := q.stats.Tagged(map[string]string{"priority": c.priority.String()})
+		stats.Gauge("active_downloads").Update(float64(c.active))
+		stats.Gauge("queued_downloads").Update(float64(c.waiting.Len()))
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type acquireResult struct {
+	release func()
+	err     error
+}
+
+// acquireAsync acquires p in the background once queued downloads of p are
+// observed to increase, so callers may rely on the queue order.
+func acquireAsync(
+	t *testing.T, q *admissionQueue, p Priority, done <-chan struct{}) <-chan acquireResult {
+
+	n := numQueued(q, p)
+	result := make(chan acquireResult, 1)
+	go func() {
+		release, err := q.acquire(p, done)
+		result <- acquireResult{release, err}
+	}()
+	require.Eventually(t, func() bool {
+		return numQueued(q, p) == n+1
+	}, 5*time.Second, time.Millisecond)
+	return result
+}
+
+func numQueued(q *admissionQueue, p Priority) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.classes[p].waiting.Len()
+}
+
+func requireAdmitted(t *testing.T, result <-chan acquireResult) func() {
+	select {
+	case r := <-result:
+		require.NoError(t, r.err)
+		return r.release
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for admission")
+		return nil
+	}
+}
+
+func requireNotAdmitted(t *testing.T, result <-chan acquireResult) {
+	select {
+	case <-result:
+		require.FailNow(t, "unexpected admission")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range []Priority{PriorityInteractive, PriorityPreheat, PriorityReplication} {
+		result, err := ParsePriority(p.String())
+		require.NoError(err)
+		require.Equal(p, result)
+	}
+
+	_, err := ParsePriority("urgent")
+	require.Error(err)
+}
+
+func TestAdmissionQueueClassLimit(t *testing.T) {
+	require := require.New(t)
+
+	q := newAdmissionQueue(AdmissionConfig{
+		Preheat: PriorityClassConfig{MaxConcurrent: 1},
+	}, tally.NoopScope)
+	done := make(chan struct{})
+
+	release, err := q.acquire(PriorityPreheat, done)
+	require.NoError(err)
+
+	queued := acquireAsync(t, q, PriorityPreheat, done)
+	requireNotAdmitted(t, queued)
+
+	// Other classes are not limited by preheat downloads.
+	interactiveRelease, err := q.acquire(PriorityInteractive, done)
+	require.NoError(err)
+	interactiveRelease()
+
+	release()
+	requireAdmitted(t, queued)()
+}
+
+func TestAdmissionQueueAdmitsHigherPriorityFirst(t *testing.T) {
+	require := require.New(t)
+
+	q := newAdmissionQueue(AdmissionConfig{
+		MaxConcurrentDownloads: 1,
+	}, tally.NoopScope)
+	done := make(chan struct{})
+
+	release, err := q.acquire(PriorityReplication, done)
+	require.NoError(err)
+
+	replication := acquireAsync(t, q, PriorityReplication, done)
+	preheat := acquireAsync(t, q, PriorityPreheat, done)
+	interactive := acquireAsync(t, q, PriorityInteractive, done)
+
+	release()
+	release = requireAdmitted(t, interactive)
+	requireNotAdmitted(t, preheat)
+
+	release()
+	release = requireAdmitted(t, preheat)
+	requireNotAdmitted(t, replication)
+
+	release()
+	requireAdmitted(t, replication)()
+}
+
+func TestAdmissionQueueFull(t *testing.T) {
+	require := require.New(t)
+
+	q := newAdmissionQueue(AdmissionConfig{
+		Preheat: PriorityClassConfig{MaxConcurrent: 1, MaxQueued: 1},
+	}, tally.NoopScope)
+	done := make(chan struct{})
+
+	release, err := q.acquire(PriorityPreheat, done)
+	require.NoError(err)
+
+	queued := acquireAsync(t, q, PriorityPreheat, done)
+
+	_, err = q.acquire(PriorityPreheat, done)
+	require.Equal(ErrDownloadQueueFull, err)
+
+	release()
+	requireAdmitted(t, queued)()
+}
+
+func TestAdmissionQueueStopped(t *testing.T) {
+	require := require.New(t)
+
+	q := newAdmissionQueue(AdmissionConfig{
+		MaxConcurrentDownloads: 1,
+	}, tally.NoopScope)
+	done := make(chan struct{})
+
+	release, err := q.acquire(PriorityInteractive, done)
+	require.NoError(err)
+
+	queued := acquireAsync(t, q, PriorityInteractive, done)
+
+	close(done)
+
+	select {
+	case r := <-queued:
+		require.Equal(ErrSchedulerStopped, r.err)
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for queued download to fail")
+	}
+	require.Equal(0, numQueued(q, PriorityInteractive))
+
+	release()
+}
+
+func TestAdmissionQueueInvalidPriority(t *testing.T) {
+	q := newAdmissionQueue(AdmissionConfig{}, tally.NoopScope)
+
+	_, err := q.acquire(numPriorities, make(chan struct{}))
+	require.Error(t, err)
+}
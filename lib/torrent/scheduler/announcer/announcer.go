@@ -85,12 +85,21 @@ func Default(
 }
 
 // Announce announces through the underlying client and returns the resulting
-// peer handout. Updates the announce interval if it has changed.
+// peer handout. Updates the announce interval if it has changed, or backs off
+// if the tracker throttled the announce.
 func (a *Announcer) Announce(
-	d core.Digest, h core.InfoHash, complete bool) ([]*core.PeerInfo, error) {
+	namespace string, d core.Digest, h core.InfoHash, complete bool) ([]*core.PeerInfo, error) {
 
-	peers, interval, err := a.client.Announce(d, h, complete, announceclient.V2)
+	peers, interval, err := a.client.Announce(namespace, d, h, complete, announceclient.V3)
 	if err != nil {
+		if retryAfter, ok := announceclient.RetryAfter(err); ok {
+			if retryAfter > a.config.MaxInterval {
+				retryAfter = a.config.MaxInterval
+			}
+			if retryAfter > time.Duration(a.interval.Load()) {
+				a.setInterval(retryAfter)
+			}
+		}
 		return nil, err
 	}
 	if interval == 0 {
@@ -103,11 +112,15 @@ func (a *Announcer) Announce(
 		// mistake in the central authority which will become impossible to correct.
 		interval = a.config.DefaultInterval
 	}
+	a.setInterval(interval)
+	return peers, nil
+}
+
+func (a *Announcer) setInterval(interval time.Duration) {
 	if a.interval.Swap(int64(interval)) != int64(interval) {
 		// Note: updated interval will take effect after next tick.
 		a.logger.Infof("Announce interval updated to %s", interval)
 	}
-	return peers, nil
 }
 
 // Ticker emits AnnounceTick events at the current announce interval, which may be
@@ -15,12 +15,14 @@ package announcer
 
 import (
 	"errors"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/uber/kraken/core"
 	mockannounceclient "github.com/uber/kraken/mocks/tracker/announceclient"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
 	"go.uber.org/zap"
 
 	"github.com/andres-erbsen/clock"
@@ -92,14 +94,15 @@ func TestAnnouncerAnnounceUpdatesInterval(t *testing.T) {
 	mocks.clk.Add(config.DefaultInterval)
 	mocks.events.expectTick(t)
 
+	namespace := core.TagFixture()
 	d := core.DigestFixture()
 	hash := core.InfoHashFixture()
 	interval := 10 * time.Second
 	peers := []*core.PeerInfo{core.PeerInfoFixture()}
 
-	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(peers, interval, nil)
+	mocks.client.EXPECT().Announce(namespace, d, hash, false, announceclient.V3).Return(peers, interval, nil)
 
-	result, err := announcer.Announce(d, hash, false)
+	result, err := announcer.Announce(namespace, d, hash, false)
 	require.NoError(err)
 	require.Equal(peers, result)
 
@@ -125,12 +128,54 @@ func TestAnnouncerAnnounceErr(t *testing.T) {
 
 	go announcer.Ticker(nil)
 
+	namespace := core.TagFixture()
 	d := core.DigestFixture()
 	hash := core.InfoHashFixture()
 	err := errors.New("some error")
 
-	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(nil, time.Duration(0), err)
+	mocks.client.EXPECT().Announce(namespace, d, hash, false, announceclient.V3).Return(nil, time.Duration(0), err)
 
-	_, aErr := announcer.Announce(d, hash, false)
+	_, aErr := announcer.Announce(namespace, d, hash, false)
 	require.Equal(err, aErr)
 }
+
+func TestAnnouncerAnnounceThrottledBacksOff(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newAnnouncerMocks(t)
+	defer cleanup()
+
+	config := Config{DefaultInterval: 5 * time.Second, MaxInterval: time.Minute}
+
+	announcer := mocks.newAnnouncer(config)
+
+	go announcer.Ticker(nil)
+
+	mocks.clk.Add(config.DefaultInterval)
+	mocks.events.expectTick(t)
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+	hash := core.InfoHashFixture()
+	retryAfter := 20 * time.Second
+	err := httputil.StatusError{
+		Status: http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": []string{"20"}},
+	}
+
+	mocks.client.EXPECT().Announce(namespace, d, hash, false, announceclient.V3).Return(nil, time.Duration(0), err)
+
+	_, aErr := announcer.Announce(namespace, d, hash, false)
+	require.Equal(err, aErr)
+
+	mocks.clk.Add(config.DefaultInterval)
+	mocks.events.expectTick(t)
+
+	// Timer should have been reset to the retry after interval now.
+
+	mocks.clk.Add(config.DefaultInterval)
+	mocks.events.expectNoTick(t)
+
+	mocks.clk.Add(retryAfter - config.DefaultInterval)
+	mocks.events.expectTick(t)
+}
@@ -16,10 +16,14 @@ package scheduler
 import (
 	"time"
 
+	"github.com/uber/kraken/lib/delta"
+	"github.com/uber/kraken/lib/torrent/scheduler/adaptive"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
 	"github.com/uber/kraken/utils/log"
+
+	"github.com/c2h5oh/datasize"
 )
 
 // Config is the Scheduler configuration.
@@ -54,12 +58,37 @@ type Config struct {
 
 	ProbeTimeout time.Duration `yaml:"probe_timeout"`
 
+	// ActiveTorrentsFile is the path of the file active torrents are persisted
+	// to, so that downloads are resumed and completed torrents are seeded again
+	// immediately after a restart. Active torrents are not persisted if empty.
+	ActiveTorrentsFile string `yaml:"active_torrents_file"`
+
+	// Admission configures the download queue, which limits concurrent
+	// downloads by priority class.
+	Admission AdmissionConfig `yaml:"admission"`
+
+	// PEX configures peer exchange, where connected peers gossip the peers
+	// they are connected to for the same torrent.
+	PEX PEXConfig `yaml:"pex"`
+
+	// WebSeed configures fetching pieces over HTTP when the swarm is slow or
+	// has no peers. Only supported by agents.
+	WebSeed WebSeedConfig `yaml:"webseed"`
+
+	// Adaptive configures tuning conn limits and pipeline depth to the
+	// utilization and latency of the network, instead of the static limits of
+	// ConnState and Dispatch.
+	Adaptive adaptive.Config `yaml:"adaptive"`
+
 	ConnState connstate.Config `yaml:"connstate"`
 
 	Conn conn.Config `yaml:"conn"`
 
 	Dispatch dispatch.Config `yaml:"dispatch"`
 
+	// Delta is only supported by agents.
+	Delta delta.Config `yaml:"delta"`
+
 	TorrentLog log.Config `yaml:"torrentlog"`
 	Log        log.Config `yaml:"log"`
 }
@@ -86,5 +115,79 @@ func (c Config) applyDefaults() Config {
 	if c.ProbeTimeout == 0 {
 		c.ProbeTimeout = 3 * time.Second
 	}
+	c.PEX = c.PEX.applyDefaults()
+	c.WebSeed = c.WebSeed.applyDefaults()
+	return c
+}
+
+// PEXConfig defines the configuration for peer exchange.
+type PEXConfig struct {
+
+	// Enabled enables sending and receiving PEX messages. PEX messages
+	// received while disabled are ignored.
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is the interval in which peers are gossiped to each conn. PEX
+	// messages received from a peer more often than half of the interval are
+	// dropped.
+	Interval time.Duration `yaml:"interval"`
+
+	// MaxPeers limits the number of peers gossiped in a single PEX message.
+	// Peers beyond the limit are ignored when received.
+	MaxPeers int `yaml:"max_peers"`
+}
+
+func (c PEXConfig) applyDefaults() PEXConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Minute
+	}
+	if c.MaxPeers == 0 {
+		c.MaxPeers = 25
+	}
+	return c
+}
+
+// WebSeedConfig defines the configuration for fetching pieces of torrents from
+// a web seed, i.e. directly from origins over HTTP.
+type WebSeedConfig struct {
+
+	// Enabled enables fetching pieces from the web seed.
+	Enabled bool `yaml:"enabled"`
+
+	// Addr is the address of the origin cluster which pieces are fetched from,
+	// e.g. a DNS name or load balancer.
+	Addr string `yaml:"addr"`
+
+	// Interval is the interval in which the throughput of each downloading
+	// torrent is checked. Torrents younger than the interval never use the
+	// web seed, which gives the swarm a chance to serve them first.
+	Interval time.Duration `yaml:"interval"`
+
+	// MinThroughput is the download rate per second below which missing
+	// pieces of a torrent are fetched from the web seed. Torrents without any
+	// peers always use the web seed.
+	MinThroughput datasize.ByteSize `yaml:"min_throughput"`
+
+	// MaxPieces limits the number of pieces of a single torrent which are
+	// fetched from the web seed at once.
+	MaxPieces int `yaml:"max_pieces"`
+
+	// Timeout is the timeout of fetching a single piece.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c WebSeedConfig) applyDefaults() WebSeedConfig {
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.MinThroughput == 0 {
+		c.MinThroughput = datasize.MB
+	}
+	if c.MaxPieces == 0 {
+		c.MaxPieces = 4
+	}
+	if c.Timeout == 0 {
+		c.Timeout = time.Minute
+	}
 	return c
 }
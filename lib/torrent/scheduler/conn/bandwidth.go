@@ -0,0 +1,281 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/bandwidth"
+
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// NamespaceBandwidthConfig caps the bandwidth used by torrents of namespaces
+// matching Namespace.
+type NamespaceBandwidthConfig struct {
+	// Namespace is a regular expression. Only the first matching config
+	// applies to a namespace.
+	Namespace string `yaml:"namespace" json:"namespace"`
+
+	// Share is the fraction, in (0, 1], of the egress and ingress bandwidth
+	// which torrents of matching namespaces may use.
+	Share float64 `yaml:"share" json:"share"`
+}
+
+// NamespaceWeightConfig sets the weight of torrents of namespaces matching
+// Namespace when egress bandwidth is shared among torrents.
+type NamespaceWeightConfig struct {
+	// Namespace is a regular expression. Only the first matching config
+	// applies to a namespace.
+	Namespace string `yaml:"namespace"`
+
+	// Weight is relative to the default weight of 1.
+	Weight float64 `yaml:"weight"`
+}
+
+type namespaceWeight struct {
+	regexp *regexp.Regexp
+	weight float64
+}
+
+type namespaceLimiter struct {
+	regexp  *regexp.Regexp
+	share   float64
+	limiter *bandwidth.Limiter
+}
+
+// bandwidthAllocator partitions bandwidth among namespaces. Every reservation
+// is limited by the total bandwidth, and additionally by the share of the
+// namespace the reservation is made for, if any. Namespaces without a share
+// are only limited by the total bandwidth. Total egress bandwidth is shared
+// fairly among torrents, and among the peers of each torrent.
+type bandwidthAllocator struct {
+	config  bandwidth.Config
+	total   *bandwidth.Limiter
+	fair    *fairQueue
+	weights []namespaceWeight
+	stats   tally.Scope
+	logger  *zap.SugaredLogger
+
+	// Total piece bytes sent and received.
+	egressBytes  *atomic.Int64
+	ingressBytes *atomic.Int64
+
+	mu         sync.RWMutex // Protects namespaces.
+	namespaces []*namespaceLimiter
+}
+
+func newBandwidthAllocator(
+	config bandwidth.Config,
+	namespaces []NamespaceBandwidthConfig,
+	weights []NamespaceWeightConfig,
+	stats tally.Scope,
+	logger *zap.SugaredLogger) (*bandwidthAllocator, error) {
+
+	total, err := bandwidth.NewLimiter(config, bandwidth.WithLogger(logger))
+	if err != nil {
+		return nil, err
+	}
+	a := &bandwidthAllocator{
+		config:       config,
+		total:        total,
+		stats:        stats,
+		logger:       logger,
+		egressBytes:  atomic.NewInt64(0),
+		ingressBytes: atomic.NewInt64(0),
+	}
+	if total.Enabled() {
+		a.fair = newFairQueue(total)
+	}
+	for _, w := range weights {
+		if w.Weight <= 0 {
+			return nil, fmt.Errorf("namespace weight %s: weight must be positive", w.Namespace)
+		}
+		re, err := regexp.Compile(w.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace weight %s: regexp: %s", w.Namespace, err)
+		}
+		a.weights = append(a.weights, namespaceWeight{re, w.Weight})
+	}
+	if len(namespaces) > 0 {
+		if err := a.set(namespaces); err != nil {
+			return nil, fmt.Errorf("namespaces: %s", err)
+		}
+	}
+	return a, nil
+}
+
+// set replaces the namespace shares. Limiters of namespaces which were already
+// configured are updated in place, so in-flight reservations are preserved.
+// Either all shares are replaced or none are: every config is validated, and
+// limiters of new namespaces are created, before any existing limiter changes.
+func (a *bandwidthAllocator) set(configs []NamespaceBandwidthConfig) error {
+	if !a.total.Enabled() {
+		return errors.New("bandwidth limits disabled")
+	}
+	res := make([]*regexp.Regexp, len(configs))
+	seen := make(map[string]bool)
+	for i, c := range configs {
+		if c.Share <= 0 || c.Share > 1 {
+			return fmt.Errorf("namespace %s: share must be in (0, 1]", c.Namespace)
+		}
+		if seen[c.Namespace] {
+			return fmt.Errorf("namespace %s: duplicate namespace", c.Namespace)
+		}
+		seen[c.Namespace] = true
+		re, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return fmt.Errorf("namespace %s: regexp: %s", c.Namespace, err)
+		}
+		res[i] = re
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	existing := make(map[string]*bandwidth.Limiter)
+	for _, n := range a.namespaces {
+		existing[n.regexp.String()] = n.limiter
+	}
+	egress := a.total.EgressBitsPerSec()
+	ingress := a.total.IngressBitsPerSec()
+
+	namespaces := make([]*namespaceLimiter, len(configs))
+	var updated []int
+	for i, c := range configs {
+		l, ok := existing[c.Namespace]
+		if ok {
+			updated = append(updated, i)
+		} else {
+			config := a.config
+			config.EgressBitsPerSec = shareOf(egress, c.Share)
+			config.IngressBitsPerSec = shareOf(ingress, c.Share)
+			var err error
+			l, err = bandwidth.NewLimiter(config, bandwidth.WithLogger(a.logger))
+			if err != nil {
+				return fmt.Errorf("namespace %s: %s", c.Namespace, err)
+			}
+		}
+		namespaces[i] = &namespaceLimiter{res[i], c.Share, l}
+	}
+	// SetLimits only fails for disabled limiters or zero limits, which are
+	// ruled out above since the total limiter is enabled and shares are
+	// positive.
+	for _, i := range updated {
+		c := configs[i]
+		if err := namespaces[i].limiter.SetLimits(
+			shareOf(egress, c.Share), shareOf(ingress, c.Share)); err != nil {
+			return fmt.Errorf("namespace %s: %s", c.Namespace, err)
+		}
+	}
+	a.namespaces = namespaces
+	return nil
+}
+
+// get returns the current namespace shares.
+func (a *bandwidthAllocator) get() []NamespaceBandwidthConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	configs := make([]NamespaceBandwidthConfig, len(a.namespaces))
+	for i, n := range a.namespaces {
+		configs[i] = NamespaceBandwidthConfig{n.regexp.String(), n.share}
+	}
+	return configs
+}
+
+func (a *bandwidthAllocator) limiter(namespace string) *bandwidth.Limiter {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, n := range a.namespaces {
+		if n.regexp.MatchString(namespace) {
+			return n.limiter
+		}
+	}
+	return nil
+}
+
+func (a *bandwidthAllocator) weight(namespace string) float64 {
+	for _, w := range a.weights {
+		if w.regexp.MatchString(namespace) {
+			return w.weight
+		}
+	}
+	return 1
+}
+
+// reserveEgress blocks until egress bandwidth for nbytes is available to
+// peerID for the torrent of h in namespace.
+func (a *bandwidthAllocator) reserveEgress(
+	namespace string, h core.InfoHash, peerID core.PeerID, nbytes int64) error {
+
+	if l := a.limiter(namespace); l != nil {
+		if err := l.ReserveEgress(nbytes); err != nil {
+			return fmt.Errorf("namespace: %s", err)
+		}
+	}
+	if a.fair == nil {
+		return a.total.ReserveEgress(nbytes)
+	}
+	if err := a.fair.reserve(h, peerID, a.weight(namespace), nbytes); err != nil {
+		return err
+	}
+	a.torrentStats(h).Counter("egress_allocated_bytes").Inc(nbytes)
+	return nil
+}
+
+// consumedEgress records that nbytes of egress bandwidth allocated to the
+// torrent of h were used.
+func (a *bandwidthAllocator) consumedEgress(h core.InfoHash, nbytes int64) {
+	a.egressBytes.Add(nbytes)
+	if a.fair == nil {
+		return
+	}
+	a.torrentStats(h).Counter("egress_consumed_bytes").Inc(nbytes)
+}
+
+// consumedIngress records that nbytes of ingress bandwidth were used.
+func (a *bandwidthAllocator) consumedIngress(nbytes int64) {
+	a.ingressBytes.Add(nbytes)
+}
+
+func (a *bandwidthAllocator) torrentStats(h core.InfoHash) tally.Scope {
+	return a.stats.Tagged(map[string]string{"torrent": h.Hex()})
+}
+
+// reserveIngress blocks until ingress bandwidth for nbytes is available to
+// namespace.
+func (a *bandwidthAllocator) reserveIngress(namespace string, nbytes int64) error {
+	if l := a.limiter(namespace); l != nil {
+		if err := l.ReserveIngress(nbytes); err != nil {
+			return fmt.Errorf("namespace: %s", err)
+		}
+	}
+	return a.total.ReserveIngress(nbytes)
+}
+
+func shareOf(bps uint64, share float64) uint64 {
+	n := uint64(float64(bps) * share)
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
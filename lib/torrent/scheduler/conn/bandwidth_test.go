@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/bandwidth"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func bandwidthAllocatorFixture(namespaces []NamespaceBandwidthConfig) (*bandwidthAllocator, error) {
+	return newBandwidthAllocator(bandwidth.Config{
+		EgressBitsPerSec:  1000,
+		IngressBitsPerSec: 2000,
+		TokenSize:         1,
+		Enable:            true,
+	}, namespaces, nil, tally.NoopScope, zap.NewNop().Sugar())
+}
+
+func TestBandwidthAllocatorNamespaceLimits(t *testing.T) {
+	require := require.New(t)
+
+	a, err := bandwidthAllocatorFixture([]NamespaceBandwidthConfig{
+		{Namespace: "prod/.*", Share: 0.8},
+		{Namespace: ".*", Share: 0.2},
+	})
+	require.NoError(err)
+
+	prod := a.limiter("prod/foo")
+	require.NotNil(prod)
+	require.Equal(int64(800), prod.EgressLimit())
+	require.Equal(int64(1600), prod.IngressLimit())
+
+	batch := a.limiter("batch/foo")
+	require.NotNil(batch)
+	require.Equal(int64(200), batch.EgressLimit())
+	require.Equal(int64(400), batch.IngressLimit())
+
+	require.NoError(a.reserveEgress("prod/foo", core.InfoHashFixture(), core.PeerIDFixture(), 1))
+	require.NoError(a.reserveIngress("batch/foo", 1))
+}
+
+func TestBandwidthAllocatorSet(t *testing.T) {
+	require := require.New(t)
+
+	a, err := bandwidthAllocatorFixture(nil)
+	require.NoError(err)
+	require.Nil(a.limiter("batch/foo"))
+
+	require.NoError(a.set([]NamespaceBandwidthConfig{{Namespace: "batch/.*", Share: 0.5}}))
+	l := a.limiter("batch/foo")
+	require.Equal(int64(500), l.EgressLimit())
+	require.Nil(a.limiter("prod/foo"))
+
+	// Existing limiters are updated in place.
+	require.NoError(a.set([]NamespaceBandwidthConfig{{Namespace: "batch/.*", Share: 0.1}}))
+	require.True(l == a.limiter("batch/foo"))
+	require.Equal(int64(100), l.EgressLimit())
+	require.Equal([]NamespaceBandwidthConfig{{Namespace: "batch/.*", Share: 0.1}}, a.get())
+
+	// Invalid shares leave the current shares unchanged.
+	require.Error(a.set([]NamespaceBandwidthConfig{{Namespace: "prod/.*", Share: 1.5}}))
+	require.Error(a.set([]NamespaceBandwidthConfig{{Namespace: "(", Share: 0.5}}))
+	require.Equal([]NamespaceBandwidthConfig{{Namespace: "batch/.*", Share: 0.1}}, a.get())
+
+	// Existing limiters are not updated if any other share is invalid.
+	require.Error(a.set([]NamespaceBandwidthConfig{
+		{Namespace: "batch/.*", Share: 0.5},
+		{Namespace: "prod/.*", Share: 1.5},
+	}))
+	require.Error(a.set([]NamespaceBandwidthConfig{
+		{Namespace: "batch/.*", Share: 0.5},
+		{Namespace: "batch/.*", Share: 0.2},
+	}))
+	require.Equal(int64(100), l.EgressLimit())
+	require.Equal([]NamespaceBandwidthConfig{{Namespace: "batch/.*", Share: 0.1}}, a.get())
+
+	require.NoError(a.set(nil))
+	require.Nil(a.limiter("batch/foo"))
+}
+
+func TestBandwidthAllocatorDisabled(t *testing.T) {
+	require := require.New(t)
+
+	_, err := newBandwidthAllocator(
+		bandwidth.Config{}, []NamespaceBandwidthConfig{{Namespace: ".*", Share: 0.5}},
+		nil, tally.NoopScope, zap.NewNop().Sugar())
+	require.Error(err)
+
+	a, err := newBandwidthAllocator(
+		bandwidth.Config{}, nil, nil, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+	require.NoError(a.reserveEgress("foo", core.InfoHashFixture(), core.PeerIDFixture(), 1<<30))
+	require.Error(a.set([]NamespaceBandwidthConfig{{Namespace: ".*", Share: 0.5}}))
+}
+
+func TestBandwidthAllocatorNamespaceWeights(t *testing.T) {
+	require := require.New(t)
+
+	a, err := newBandwidthAllocator(bandwidth.Config{
+		EgressBitsPerSec:  1000,
+		IngressBitsPerSec: 1000,
+		TokenSize:         1,
+		Enable:            true,
+	}, nil, []NamespaceWeightConfig{
+		{Namespace: "prod/.*", Weight: 4},
+	}, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+
+	require.Equal(4.0, a.weight("prod/foo"))
+	require.Equal(1.0, a.weight("batch/foo"))
+
+	_, err = newBandwidthAllocator(bandwidth.Config{}, nil, []NamespaceWeightConfig{
+		{Namespace: ".*", Weight: 0},
+	}, tally.NoopScope, zap.NewNop().Sugar())
+	require.Error(err)
+}
@@ -38,6 +38,18 @@ type Config struct {
 	ReceiverBufferSize int `yaml:"receiver_buffer_size"`
 
 	Bandwidth bandwidth.Config `yaml:"bandwidth"`
+
+	// NamespaceBandwidth caps the share of Bandwidth used by torrents of
+	// matching namespaces, so that e.g. large dataset distributions cannot
+	// starve image pulls.
+	NamespaceBandwidth []NamespaceBandwidthConfig `yaml:"namespace_bandwidth"`
+
+	// NamespaceWeights sets the weights of torrents when egress bandwidth is
+	// shared among them. Torrents of namespaces without a weight have weight 1.
+	NamespaceWeights []NamespaceWeightConfig `yaml:"namespace_weights"`
+
+	// TLS encrypts and mutually authenticates connections between peers.
+	TLS TLSConfig `yaml:"tls"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -56,5 +68,6 @@ func (c Config) applyDefaults() Config {
 	if c.Bandwidth.IngressBitsPerSec == 0 {
 		c.Bandwidth.IngressBitsPerSec = 300 * 8 * memsize.Mbit
 	}
+	c.TLS = c.TLS.applyDefaults()
 	return c
 }
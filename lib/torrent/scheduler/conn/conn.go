@@ -31,7 +31,6 @@ import (
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/lib/torrent/storage/piecereader"
-	"github.com/uber/kraken/utils/bandwidth"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/memsize"
 )
@@ -51,7 +50,8 @@ type Conn struct {
 	infoHash    core.InfoHash
 	createdAt   time.Time
 	localPeerID core.PeerID
-	bandwidth   *bandwidth.Limiter
+	namespace   string
+	bandwidth   *bandwidthAllocator
 
 	events Events
 
@@ -69,6 +69,11 @@ type Conn struct {
 	sender   chan *Message
 	receiver chan *Message
 
+	// cancelled holds pieces whose requests the remote peer cancelled. Queued
+	// payloads of cancelled pieces are dropped instead of sent.
+	cancelMu  sync.Mutex
+	cancelled map[int]bool
+
 	// The following fields orchestrate the closing of the connection:
 	closed *atomic.Bool
 	done   chan struct{}  // Signals to readLoop / writeLoop to exit.
@@ -82,12 +87,13 @@ func newConn(
 	stats tally.Scope,
 	clk clock.Clock,
 	networkEvents networkevent.Producer,
-	bandwidth *bandwidth.Limiter,
+	bandwidth *bandwidthAllocator,
 	events Events,
 	nc net.Conn,
 	localPeerID core.PeerID,
 	remotePeerID core.PeerID,
 	info *storage.TorrentInfo,
+	namespace string,
 	openedByRemote bool,
 	logger *zap.SugaredLogger) (*Conn, error) {
 
@@ -102,6 +108,7 @@ func newConn(
 		infoHash:       info.InfoHash(),
 		createdAt:      clk.Now(),
 		localPeerID:    localPeerID,
+		namespace:      namespace,
 		bandwidth:      bandwidth,
 		events:         events,
 		nc:             nc,
@@ -112,6 +119,7 @@ func newConn(
 		openedByRemote: openedByRemote,
 		sender:         make(chan *Message, config.SenderBufferSize),
 		receiver:       make(chan *Message, config.ReceiverBufferSize),
+		cancelled:      make(map[int]bool),
 		closed:         atomic.NewBool(false),
 		done:           make(chan struct{}),
 		logger:         logger,
@@ -192,7 +200,7 @@ func (c *Conn) IsClosed() bool {
 }
 
 func (c *Conn) readPayload(length int32) ([]byte, error) {
-	if err := c.bandwidth.ReserveIngress(int64(length)); err != nil {
+	if err := c.bandwidth.reserveIngress(c.namespace, int64(length)); err != nil {
 		c.log().Errorf("Error reserving ingress bandwidth for piece payload: %s", err)
 		return nil, fmt.Errorf("ingress bandwidth: %s", err)
 	}
@@ -200,6 +208,7 @@ func (c *Conn) readPayload(length int32) ([]byte, error) {
 	if _, err := io.ReadFull(c.nc, payload); err != nil {
 		return nil, err
 	}
+	c.bandwidth.consumedIngress(int64(length))
 	c.countBandwidth("ingress", int64(8*length))
 	return payload, nil
 }
@@ -209,6 +218,12 @@ func (c *Conn) readMessage() (*Message, error) {
 	if err != nil {
 		return nil, fmt.Errorf("read message: %s", err)
 	}
+	switch p2pMessage.Type {
+	case p2p.Message_PIECE_REQUEST:
+		c.setCancelled(int(p2pMessage.PieceRequest.Index), false)
+	case p2p.Message_CANCEL_PIECE:
+		c.setCancelled(int(p2pMessage.CancelPiece.Index), true)
+	}
 	var pr storage.PieceReader
 	if p2pMessage.Type == p2p.Message_PIECE_PAYLOAD {
 		// For payload messages, we must read the actual payload to the connection
@@ -251,12 +266,14 @@ func (c *Conn) readLoop() {
 func (c *Conn) sendPiecePayload(pr storage.PieceReader) error {
 	defer closers.Close(pr)
 
-	if err := c.bandwidth.ReserveEgress(int64(pr.Length())); err != nil {
+	if err := c.bandwidth.reserveEgress(
+		c.namespace, c.infoHash, c.peerID, int64(pr.Length())); err != nil {
 		// TODO(codyg): This is bad. Consider alerting here.
 		c.log().Errorf("Error reserving egress bandwidth for piece payload: %s", err)
 		return fmt.Errorf("egress bandwidth: %s", err)
 	}
 	n, err := io.Copy(c.nc, pr)
+	c.bandwidth.consumedEgress(c.infoHash, n)
 	if err != nil {
 		return fmt.Errorf("copy to socket: %s", err)
 	}
@@ -264,7 +281,36 @@ func (c *Conn) sendPiecePayload(pr storage.PieceReader) error {
 	return nil
 }
 
+func (c *Conn) setCancelled(i int, cancelled bool) {
+	c.cancelMu.Lock()
+	defer c.cancelMu.Unlock()
+
+	if cancelled {
+		c.cancelled[i] = true
+	} else {
+		delete(c.cancelled, i)
+	}
+}
+
+// takeCancelled returns whether the request for piece i was cancelled, and
+// resets its cancellation.
+func (c *Conn) takeCancelled(i int) bool {
+	c.cancelMu.Lock()
+	defer c.cancelMu.Unlock()
+
+	cancelled := c.cancelled[i]
+	delete(c.cancelled, i)
+	return cancelled
+}
+
 func (c *Conn) sendMessage(msg *Message) error {
+	if msg.Message.Type == p2p.Message_PIECE_PAYLOAD &&
+		c.takeCancelled(int(msg.Message.PiecePayload.Index)) {
+
+		closers.Close(msg.Payload)
+		c.stats.Counter("cancelled_piece_payloads").Inc(1)
+		return nil
+	}
 	if err := sendMessage(c.nc, msg.Message); err != nil {
 		return fmt.Errorf("send message: %s", err)
 	}
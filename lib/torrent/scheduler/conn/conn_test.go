@@ -18,6 +18,10 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/gen/go/proto/p2p"
+	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/lib/torrent/storage/piecereader"
 )
 
 func TestConnClose(t *testing.T) {
@@ -40,3 +44,30 @@ func TestConnClose(t *testing.T) {
 
 	require.True(c.IsClosed())
 }
+
+func TestConnDropsCancelledPiecePayloads(t *testing.T) {
+	require := require.New(t)
+
+	local, remote, cleanup := PipeFixture(Config{}, storage.TorrentInfoFixture(1, 1))
+	defer cleanup()
+
+	require.NoError(remote.Send(NewCancelPieceMessage(0)))
+	msg := <-local.Receiver()
+	require.Equal(p2p.Message_CANCEL_PIECE, msg.Message.Type)
+
+	require.NoError(local.Send(NewPiecePayloadMessage(0, piecereader.NewBuffer([]byte{1}))))
+	require.NoError(local.Send(NewAnnouncePieceMessage(0)))
+
+	// The payload was dropped, so the announce is received first.
+	msg = <-remote.Receiver()
+	require.Equal(p2p.Message_ANNOUCE_PIECE, msg.Message.Type)
+
+	// Requesting the piece again resets the cancellation.
+	require.NoError(remote.Send(NewPieceRequestMessage(0, 1)))
+	msg = <-local.Receiver()
+	require.Equal(p2p.Message_PIECE_REQUEST, msg.Message.Type)
+
+	require.NoError(local.Send(NewPiecePayloadMessage(0, piecereader.NewBuffer([]byte{1}))))
+	msg = <-remote.Receiver()
+	require.Equal(p2p.Message_PIECE_PAYLOAD, msg.Message.Type)
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"math"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/bandwidth"
+)
+
+// fairQueue grants the egress bandwidth of a limiter using hierarchical
+// start-time fair queuing: first among torrents in proportion to their
+// weights, then equally among the peers of each torrent. Bandwidth is granted
+// one piece at a time, so a torrent with many queued pieces cannot delay the
+// pieces of other torrents by more than its fair share.
+type fairQueue struct {
+	limiter *bandwidth.Limiter
+
+	mu       sync.Mutex
+	running  bool    // Whether grantLoop is running.
+	vtime    float64 // Start tag of the last granted torrent.
+	torrents map[core.InfoHash]*torrentQueue
+}
+
+type torrentQueue struct {
+	weight float64
+	finish float64
+	vtime  float64 // Start tag of the last granted peer.
+	peers  map[core.PeerID]*peerQueue
+	queued int
+}
+
+type peerQueue struct {
+	finish   float64
+	requests []*egressRequest
+}
+
+type egressRequest struct {
+	nbytes  int64
+	granted chan error
+}
+
+func newFairQueue(limiter *bandwidth.Limiter) *fairQueue {
+	return &fairQueue{
+		limiter:  limiter,
+		torrents: make(map[core.InfoHash]*torrentQueue),
+	}
+}
+
+// reserve blocks until egress bandwidth for nbytes is granted to peerID for
+// the torrent of h.
+func (q *fairQueue) reserve(h core.InfoHash, peerID core.PeerID, weight float64, nbytes int64) error {
+	q.mu.Lock()
+	r := q.enqueue(h, peerID, weight, nbytes)
+	if !q.running {
+		q.running = true
+		go q.grantLoop()
+	}
+	q.mu.Unlock()
+
+	return <-r.granted
+}
+
+// enqueue adds a request for nbytes to the queue of peerID for the torrent of
+// h. Caller must hold q.mu.
+func (q *fairQueue) enqueue(
+	h core.InfoHash, peerID core.PeerID, weight float64, nbytes int64) *egressRequest {
+
+	r := &egressRequest{nbytes, make(chan error, 1)}
+	t, ok := q.torrents[h]
+	if !ok {
+		t = &torrentQueue{peers: make(map[core.PeerID]*peerQueue)}
+		q.torrents[h] = t
+	}
+	t.weight = weight
+	p, ok := t.peers[peerID]
+	if !ok {
+		p = &peerQueue{}
+		t.peers[peerID] = p
+	}
+	p.requests = append(p.requests, r)
+	t.queued++
+	return r
+}
+
+// grantLoop grants requests in fair order until none are queued. Since the
+// limiter blocks until bandwidth is available, requests are granted no faster
+// than the limiter allows.
+func (q *fairQueue) grantLoop() {
+	for {
+		q.mu.Lock()
+		r := q.next()
+		if r == nil {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+
+		r.granted <- q.limiter.ReserveEgress(r.nbytes)
+	}
+}
+
+// next dequeues the request with the smallest start tag, first among
+// torrents, then among the peers of the selected torrent. Idle queues are
+// kept until they have no service ahead of the virtual time, so a flow which
+// was just served cannot regain priority by briefly going idle. Caller must
+// hold q.mu.
+func (q *fairQueue) next() *egressRequest {
+	var t *torrentQueue
+	tstart := math.Inf(1)
+	for h, tq := range q.torrents {
+		if tq.queued == 0 {
+			if tq.finish <= q.vtime {
+				delete(q.torrents, h)
+			}
+			continue
+		}
+		if s := math.Max(tq.finish, q.vtime); s < tstart {
+			t, tstart = tq, s
+		}
+	}
+	if t == nil {
+		return nil
+	}
+
+	var p *peerQueue
+	pstart := math.Inf(1)
+	for id, pq := range t.peers {
+		if len(pq.requests) == 0 {
+			if pq.finish <= t.vtime {
+				delete(t.peers, id)
+			}
+			continue
+		}
+		if s := math.Max(pq.finish, t.vtime); s < pstart {
+			p, pstart = pq, s
+		}
+	}
+
+	r := p.requests[0]
+	p.requests = p.requests[1:]
+	t.queued--
+
+	n := float64(r.nbytes)
+	q.vtime = tstart
+	t.finish = tstart + n/t.weight
+	t.vtime = pstart
+	p.finish = pstart + n
+
+	return r
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/bandwidth"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFairQueueSharesAmongTorrents(t *testing.T) {
+	require := require.New(t)
+
+	q := newFairQueue(nil)
+
+	hot := core.InfoHashFixture()
+	cold := core.InfoHashFixture()
+
+	// The hot torrent has many peers with many queued pieces, the cold torrent
+	// a single peer.
+	granted := make(map[*egressRequest]core.InfoHash)
+	for i := 0; i < 4; i++ {
+		p := core.PeerIDFixture()
+		for j := 0; j < 4; j++ {
+			granted[q.enqueue(hot, p, 1, 10)] = hot
+		}
+	}
+	p := core.PeerIDFixture()
+	for i := 0; i < 4; i++ {
+		granted[q.enqueue(cold, p, 1, 10)] = cold
+	}
+
+	var order []core.InfoHash
+	for i := 0; i < 8; i++ {
+		order = append(order, granted[q.next()])
+	}
+	var hots, colds int
+	for _, h := range order {
+		if h == hot {
+			hots++
+		} else {
+			colds++
+		}
+	}
+	require.Equal(4, hots)
+	require.Equal(4, colds)
+}
+
+func TestFairQueueWeights(t *testing.T) {
+	require := require.New(t)
+
+	q := newFairQueue(nil)
+
+	heavy := core.InfoHashFixture()
+	light := core.InfoHashFixture()
+
+	granted := make(map[*egressRequest]core.InfoHash)
+	p := core.PeerIDFixture()
+	for i := 0; i < 12; i++ {
+		granted[q.enqueue(heavy, p, 3, 10)] = heavy
+		granted[q.enqueue(light, p, 1, 10)] = light
+	}
+
+	var heavies int
+	for i := 0; i < 8; i++ {
+		if granted[q.next()] == heavy {
+			heavies++
+		}
+	}
+	require.Equal(6, heavies)
+}
+
+func TestFairQueueSharesAmongPeers(t *testing.T) {
+	require := require.New(t)
+
+	q := newFairQueue(nil)
+
+	h := core.InfoHashFixture()
+	greedy := core.PeerIDFixture()
+	other := core.PeerIDFixture()
+
+	granted := make(map[*egressRequest]core.PeerID)
+	for i := 0; i < 8; i++ {
+		granted[q.enqueue(h, greedy, 1, 10)] = greedy
+	}
+	granted[q.enqueue(h, other, 1, 10)] = other
+
+	// The other peer is served within the first two grants despite queueing
+	// behind the greedy peer.
+	require.Contains([]core.PeerID{granted[q.next()], granted[q.next()]}, other)
+}
+
+func TestFairQueueIdleTorrentDoesNotRegainPriority(t *testing.T) {
+	require := require.New(t)
+
+	q := newFairQueue(nil)
+
+	a := core.InfoHashFixture()
+	b := core.InfoHashFixture()
+	p := core.PeerIDFixture()
+
+	// Torrent a consumes bandwidth alone, then goes idle.
+	q.enqueue(a, p, 1, 100)
+	require.NotNil(q.next())
+	require.Nil(q.next())
+
+	// Torrent b arrives before a returns, so b is served first.
+	rb := q.enqueue(b, p, 1, 10)
+	q.enqueue(a, p, 1, 10)
+	require.True(rb == q.next())
+}
+
+func TestFairQueueReserve(t *testing.T) {
+	require := require.New(t)
+
+	l, err := bandwidth.NewLimiter(bandwidth.Config{
+		EgressBitsPerSec:  1 << 30,
+		IngressBitsPerSec: 1 << 30,
+		TokenSize:         1,
+		Enable:            true,
+	}, bandwidth.WithLogger(zap.NewNop().Sugar()))
+	require.NoError(err)
+
+	q := newFairQueue(l)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(q.reserve(core.InfoHashFixture(), core.PeerIDFixture(), 1, 100))
+		}()
+	}
+	wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	require.Nil(q.next())
+}
@@ -1,7 +1,6 @@
 package conn
 
 import (
-	"fmt"
 	"net"
 	"strconv"
 	"time"
@@ -63,7 +62,7 @@ func (p *FakePeer) PeerID() core.PeerID {
 
 // Addr returns the ip:port of the peer.
 func (p *FakePeer) Addr() string {
-	return fmt.Sprintf("%s:%d", p.ip, p.port)
+	return net.JoinHostPort(p.ip, strconv.Itoa(p.port))
 }
 
 // PeerInfo returns the peers' PeerInfo.
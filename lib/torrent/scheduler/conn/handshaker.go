@@ -24,7 +24,6 @@ import (
 	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/storage"
-	"github.com/uber/kraken/utils/bandwidth"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/willf/bitset"
 	"go.uber.org/zap"
@@ -188,10 +187,12 @@ type Handshaker struct {
 	config        Config
 	stats         tally.Scope
 	clk           clock.Clock
-	bandwidth     *bandwidth.Limiter
+	bandwidth     *bandwidthAllocator
 	networkEvents networkevent.Producer
 	peerID        core.PeerID
 	events        Events
+	tls           *peerTLS
+	network       Network
 }
 
 // NewHandshaker creates a new Handshaker.
@@ -202,7 +203,8 @@ func NewHandshaker(
 	networkEvents networkevent.Producer,
 	peerID core.PeerID,
 	events Events,
-	logger *zap.SugaredLogger) (*Handshaker, error) {
+	logger *zap.SugaredLogger,
+	options ...HandshakerOption) (*Handshaker, error) {
 
 	config = config.applyDefaults()
 
@@ -210,12 +212,18 @@ func NewHandshaker(
 		"module": "conn",
 	})
 
-	bl, err := bandwidth.NewLimiter(config.Bandwidth, bandwidth.WithLogger(logger))
+	bl, err := newBandwidthAllocator(
+		config.Bandwidth, config.NamespaceBandwidth, config.NamespaceWeights, stats, logger)
 	if err != nil {
 		return nil, fmt.Errorf("bandwidth: %s", err)
 	}
 
-	return &Handshaker{
+	tls, err := newPeerTLS(config.TLS, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
+
+	h := &Handshaker{
 		config:        config,
 		stats:         stats,
 		clk:           clk,
@@ -223,16 +231,49 @@ func NewHandshaker(
 		networkEvents: networkEvents,
 		peerID:        peerID,
 		events:        events,
-	}, nil
+		tls:           tls,
+		network:       TCP,
+	}
+	for _, opt := range options {
+		opt(h)
+	}
+	return h, nil
+}
+
+// SetNamespaceBandwidth replaces the namespace bandwidth shares. The new
+// shares apply to established connections as well.
+func (h *Handshaker) SetNamespaceBandwidth(configs []NamespaceBandwidthConfig) error {
+	return h.bandwidth.set(configs)
+}
+
+// Traffic returns the total number of piece bytes sent and received over all
+// conns established by h.
+func (h *Handshaker) Traffic() (egress, ingress int64) {
+	return h.bandwidth.egressBytes.Load(), h.bandwidth.ingressBytes.Load()
+}
+
+// NamespaceBandwidth returns the current namespace bandwidth shares.
+func (h *Handshaker) NamespaceBandwidth() []NamespaceBandwidthConfig {
+	return h.bandwidth.get()
 }
 
 // Accept upgrades a raw network connection opened by a remote peer into a
 // PendingConn.
 func (h *Handshaker) Accept(nc net.Conn) (*PendingConn, error) {
+	if h.tls != nil {
+		var err error
+		nc, err = h.tls.serverConn(nc, h.config.HandshakeTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %s", err)
+		}
+	}
 	hs, err := h.readHandshake(nc)
 	if err != nil {
 		return nil, fmt.Errorf("read handshake: %s", err)
 	}
+	if err := verifyPeerID(nc, hs.peerID); err != nil {
+		return nil, fmt.Errorf("tls: %s", err)
+	}
 	return &PendingConn{hs, nc}, nil
 }
 
@@ -248,7 +289,7 @@ func (h *Handshaker) Establish(
 	if err := h.sendHandshake(pc.nc, info, remoteBitfields, ""); err != nil {
 		return nil, fmt.Errorf("send handshake: %s", err)
 	}
-	c, err := h.newConn(pc.nc, pc.handshake.peerID, info, true)
+	c, err := h.newConn(pc.nc, pc.handshake.peerID, info, pc.handshake.namespace, true)
 	if err != nil {
 		return nil, fmt.Errorf("new conn: %s", err)
 	}
@@ -265,9 +306,9 @@ func (h *Handshaker) Initialize(
 	remoteBitfields RemoteBitfields,
 	namespace string) (*HandshakeResult, error) {
 
-	nc, err := net.DialTimeout("tcp", addr, h.config.HandshakeTimeout)
+	nc, err := h.dial(peerID, addr)
 	if err != nil {
-		return nil, fmt.Errorf("dial: %s", err)
+		return nil, err
 	}
 	r, err := h.fullHandshake(nc, peerID, info, remoteBitfields, namespace)
 	if err != nil {
@@ -277,6 +318,35 @@ func (h *Handshaker) Initialize(
 	return r, nil
 }
 
+// dial opens a connection to peerID at addr, encrypted if TLS is enabled.
+func (h *Handshaker) dial(peerID core.PeerID, addr string) (net.Conn, error) {
+	nc, err := h.network.DialTimeout(addr, h.config.HandshakeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %s", err)
+	}
+	if h.tls == nil {
+		return nc, nil
+	}
+	tc, err := h.tls.clientConn(nc, h.config.HandshakeTimeout)
+	if err == nil {
+		err = verifyPeerID(tc, peerID)
+	}
+	if err != nil {
+		closers.Close(nc)
+		if h.tls.mode == TLSRequired {
+			return nil, fmt.Errorf("tls: %s", err)
+		}
+		// The remote peer may not support TLS, so fall back to plaintext.
+		h.stats.Counter("tls_fallbacks").Inc(1)
+		nc, err = h.network.DialTimeout(addr, h.config.HandshakeTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("dial: %s", err)
+		}
+		return nc, nil
+	}
+	return tc, nil
+}
+
 func (h *Handshaker) sendHandshake(
 	nc net.Conn,
 	info *storage.TorrentInfo,
@@ -327,7 +397,7 @@ func (h *Handshaker) fullHandshake(
 	if hs.peerID != peerID {
 		return nil, errors.New("unexpected peer id")
 	}
-	c, err := h.newConn(nc, peerID, info, false)
+	c, err := h.newConn(nc, peerID, info, namespace, false)
 	if err != nil {
 		return nil, fmt.Errorf("new conn: %s", err)
 	}
@@ -338,6 +408,7 @@ func (h *Handshaker) newConn(
 	nc net.Conn,
 	peerID core.PeerID,
 	info *storage.TorrentInfo,
+	namespace string,
 	openedByRemote bool) (*Conn, error) {
 
 	return newConn(
@@ -351,6 +422,7 @@ func (h *Handshaker) newConn(
 		h.peerID,
 		peerID,
 		info,
+		namespace,
 		openedByRemote,
 		zap.NewNop().Sugar())
 }
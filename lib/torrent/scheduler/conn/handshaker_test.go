@@ -71,6 +71,7 @@ func TestHandshakerSetsConnFieldsProperly(t *testing.T) {
 		require.NoError(err)
 		require.Equal(h2.peerID, c.PeerID())
 		require.Equal(info.InfoHash(), c.InfoHash())
+		require.Equal(namespace, c.namespace)
 		require.True(c.CreatedAt().After(start))
 	}()
 
@@ -82,6 +83,7 @@ func TestHandshakerSetsConnFieldsProperly(t *testing.T) {
 		require.NoError(err)
 		require.Equal(h1.peerID, r.Conn.PeerID())
 		require.Equal(info.InfoHash(), r.Conn.InfoHash())
+		require.Equal(namespace, r.Conn.namespace)
 		require.True(r.Conn.CreatedAt().After(start))
 		require.Equal(info.Bitfield(), r.Bitfield)
 		require.Equal(remoteBitfields, r.RemoteBitfields)
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/torrent/storage"
 )
@@ -87,6 +88,18 @@ func NewAnnouncePieceMessage(index int) *Message {
 	}
 }
 
+// NewCancelPieceMessage returns a Message for cancelling a piece request.
+func NewCancelPieceMessage(index int) *Message {
+	return &Message{
+		Message: &p2p.Message{
+			Type: p2p.Message_CANCEL_PIECE,
+			CancelPiece: &p2p.CancelPieceMessage{
+				Index: int32(index),
+			},
+		},
+	}
+}
+
 // NewCompleteMessage returns a Message for a completed torrent.
 func NewCompleteMessage() *Message {
 	return &Message{
@@ -96,6 +109,29 @@ func NewCompleteMessage() *Message {
 	}
 }
 
+// NewPexMessage returns a Message for gossiping peers.
+func NewPexMessage(peers []*core.PeerInfo) *Message {
+	pexPeers := make([]*p2p.PexPeer, len(peers))
+	for i, p := range peers {
+		pexPeers[i] = &p2p.PexPeer{
+			PeerID:   p.PeerID.String(),
+			Ip:       p.IP,
+			Port:     int32(p.Port),
+			Origin:   p.Origin,
+			Complete: p.Complete,
+			AltIP:    p.AltIP,
+		}
+	}
+	return &Message{
+		Message: &p2p.Message{
+			Type: p2p.Message_PEX,
+			Pex: &p2p.PexMessage{
+				Peers: pexPeers,
+			},
+		},
+	}
+}
+
 func sendMessage(nc net.Conn, msg *p2p.Message) error {
 	data, err := proto.Marshal(msg)
 	if err != nil {
@@ -0,0 +1,47 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"net"
+	"time"
+)
+
+// Network opens and accepts the network connections of peers. Peers use TCP,
+// while simulations replace it with an in-memory network.
+type Network interface {
+	Listen(addr string) (net.Listener, error)
+	DialTimeout(addr string, timeout time.Duration) (net.Conn, error)
+}
+
+// TCP is the Network of real peers.
+var TCP Network = tcpNetwork{}
+
+type tcpNetwork struct{}
+
+func (tcpNetwork) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+func (tcpNetwork) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", addr, timeout)
+}
+
+// HandshakerOption overrides the defaults of a Handshaker.
+type HandshakerOption func(*Handshaker)
+
+// WithNetwork makes a Handshaker dial peers over n instead of TCP.
+func WithNetwork(n Network) HandshakerOption {
+	return func(h *Handshaker) { h.network = n }
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// TLS modes.
+const (
+	// TLSDisabled only accepts and opens plaintext connections.
+	TLSDisabled = "disabled"
+
+	// TLSOpportunistic accepts both TLS and plaintext connections, and opens
+	// TLS connections, falling back to plaintext if the remote peer does not
+	// support TLS.
+	TLSOpportunistic = "opportunistic"
+
+	// TLSRequired only accepts and opens TLS connections.
+	TLSRequired = "required"
+)
+
+// tlsRecordTypeHandshake is the first byte of every TLS connection. It can
+// never be the first byte of a plaintext connection, since messages that long
+// exceed maxMessageSize.
+const tlsRecordTypeHandshake = 0x16
+
+// TLSConfig defines encryption and mutual authentication of connections
+// between peers. Every peer presents a certificate whose common name is its
+// peer id, signed by one of CAs.
+type TLSConfig struct {
+	Mode string `yaml:"mode"`
+
+	Cert string   `yaml:"cert"`
+	Key  string   `yaml:"key"`
+	CAs  []string `yaml:"cas"`
+}
+
+func (c TLSConfig) applyDefaults() TLSConfig {
+	if c.Mode == "" {
+		c.Mode = TLSDisabled
+	}
+	return c
+}
+
+// peerTLS encrypts and authenticates connections between peers.
+type peerTLS struct {
+	mode   string
+	server *tls.Config
+	client *tls.Config
+}
+
+// newPeerTLS returns nil if TLS is disabled.
+func newPeerTLS(config TLSConfig, peerID core.PeerID) (*peerTLS, error) {
+	switch config.Mode {
+	case TLSDisabled:
+		return nil, nil
+	case TLSOpportunistic, TLSRequired:
+	default:
+		return nil, fmt.Errorf("invalid mode: %s", config.Mode)
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+	if err != nil {
+		return nil, fmt.Errorf("load x509 key pair: %s", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse cert: %s", err)
+	}
+	if leaf.Subject.CommonName != peerID.String() {
+		return nil, fmt.Errorf(
+			"cert common name %s does not match peer id %s", leaf.Subject.CommonName, peerID)
+	}
+	pool := x509.NewCertPool()
+	for _, path := range config.CAs {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read ca: %s", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certs in ca %s", path)
+		}
+	}
+	return &peerTLS{
+		mode: config.Mode,
+		server: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		},
+		client: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			// Peers are identified by peer id rather than hostname, so the
+			// chain is verified by verifyChain and the identity by
+			// verifyPeerID once the remote peer id is known.
+			InsecureSkipVerify:    true,
+			VerifyPeerCertificate: verifyChain(pool),
+			MinVersion:            tls.VersionTLS12,
+		},
+	}, nil
+}
+
+func verifyChain(pool *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no certs")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("parse cert: %s", err)
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err
+	}
+}
+
+// verifyPeerID checks that nc is authenticated as peerID, if nc is a TLS
+// connection.
+func verifyPeerID(nc net.Conn, peerID core.PeerID) error {
+	tc, ok := nc.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("no peer certs")
+	}
+	if certs[0].Subject.CommonName != peerID.String() {
+		return fmt.Errorf(
+			"cert common name %s does not match peer id %s", certs[0].Subject.CommonName, peerID)
+	}
+	return nil
+}
+
+// peekedConn is a net.Conn whose first bytes were peeked.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// serverConn upgrades an incoming connection to TLS if the remote peer started a
+// TLS handshake.
+func (p *peerTLS) serverConn(nc net.Conn, timeout time.Duration) (net.Conn, error) {
+	if err := nc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("set read deadline: %s", err)
+	}
+	r := bufio.NewReader(nc)
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("peek: %s", err)
+	}
+	pc := &peekedConn{nc, r}
+	if b[0] != tlsRecordTypeHandshake {
+		if p.mode == TLSRequired {
+			return nil, errors.New("plaintext connections not allowed")
+		}
+		return pc, nil
+	}
+	return p.handshake(tls.Server(pc, p.server), timeout)
+}
+
+// clientConn upgrades an outgoing connection to TLS.
+func (p *peerTLS) clientConn(nc net.Conn, timeout time.Duration) (net.Conn, error) {
+	return p.handshake(tls.Client(nc, p.client), timeout)
+}
+
+func (p *peerTLS) handshake(tc *tls.Conn, timeout time.Duration) (net.Conn, error) {
+	if err := tc.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("set deadline: %s", err)
+	}
+	if err := tc.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls handshake: %s", err)
+	}
+	return tc, nil
+}
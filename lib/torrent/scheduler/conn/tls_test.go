@@ -0,0 +1,265 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/storage"
+)
+
+type testCA struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kraken-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(
+		path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return &testCA{dir, cert, key, path}
+}
+
+// config returns a TLSConfig with a certificate for peerID signed by ca.
+func (ca *testCA) config(t *testing.T, mode string, peerID core.PeerID) TLSConfig {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: peerID.String()},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(ca.dir, peerID.String()+".pem")
+	keyPath := filepath.Join(ca.dir, peerID.String()+".key")
+	require.NoError(t, os.WriteFile(
+		certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(
+		keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return TLSConfig{Mode: mode, Cert: certPath, Key: keyPath, CAs: []string{ca.path}}
+}
+
+func tlsHandshakerFixture(t *testing.T, config TLSConfig, peerID core.PeerID) *Handshaker {
+	c := ConfigFixture()
+	c.TLS = config
+	h, err := NewHandshaker(
+		c,
+		tally.NewTestScope("", nil),
+		clock.New(),
+		networkevent.NewTestProducer(),
+		peerID,
+		noopEvents{},
+		zap.NewNop().Sugar())
+	require.NoError(t, err)
+	return h
+}
+
+// tlsHandshake connects local to remote, and returns the established conns.
+func tlsHandshake(t *testing.T, local, remote *Handshaker) (*Conn, *Conn, error, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	info := storage.TorrentInfoFixture(4, 1)
+
+	type result struct {
+		c   *Conn
+		err error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		nc, err := l.Accept()
+		if err != nil {
+			accepted <- result{nil, err}
+			return
+		}
+		pc, err := remote.Accept(nc)
+		if err != nil {
+			nc.Close()
+			accepted <- result{nil, err}
+			return
+		}
+		c, err := remote.Establish(pc, info, RemoteBitfields{})
+		accepted <- result{c, err}
+	}()
+
+	var lc *Conn
+	r, lerr := local.Initialize(remote.peerID, l.Addr().String(), info, RemoteBitfields{}, "")
+	if lerr == nil {
+		lc = r.Conn
+	}
+	rr := <-accepted
+	return lc, rr.c, lerr, rr.err
+}
+
+func isTLS(c *Conn) bool {
+	_, ok := c.nc.(*tls.Conn)
+	return ok
+}
+
+func TestHandshakerTLSRequired(t *testing.T) {
+	require := require.New(t)
+
+	ca := newTestCA(t)
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	h1 := tlsHandshakerFixture(t, ca.config(t, TLSRequired, p1), p1)
+	h2 := tlsHandshakerFixture(t, ca.config(t, TLSRequired, p2), p2)
+
+	c1, c2, err1, err2 := tlsHandshake(t, h1, h2)
+	require.NoError(err1)
+	require.NoError(err2)
+	require.True(isTLS(c1))
+	require.True(isTLS(c2))
+}
+
+func TestHandshakerTLSRequiredRejectsPlaintext(t *testing.T) {
+	require := require.New(t)
+
+	ca := newTestCA(t)
+	p2 := core.PeerIDFixture()
+
+	h1 := HandshakerFixture(ConfigFixture())
+	h2 := tlsHandshakerFixture(t, ca.config(t, TLSRequired, p2), p2)
+
+	_, _, _, err := tlsHandshake(t, h1, h2)
+	require.Error(err)
+}
+
+func TestHandshakerTLSOpportunistic(t *testing.T) {
+	require := require.New(t)
+
+	ca := newTestCA(t)
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	h1 := tlsHandshakerFixture(t, ca.config(t, TLSOpportunistic, p1), p1)
+	h2 := tlsHandshakerFixture(t, ca.config(t, TLSOpportunistic, p2), p2)
+	plain := HandshakerFixture(ConfigFixture())
+
+	// Both peers support TLS.
+	c1, c2, err1, err2 := tlsHandshake(t, h1, h2)
+	require.NoError(err1)
+	require.NoError(err2)
+	require.True(isTLS(c1))
+	require.True(isTLS(c2))
+
+	// Falls back to plaintext if the remote peer does not support TLS. The
+	// first connection fails on the remote peer, the retry succeeds.
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(err)
+	defer l.Close()
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			pc, err := plain.Accept(nc)
+			if err != nil {
+				nc.Close()
+				continue
+			}
+			plain.Establish(pc, storage.TorrentInfoFixture(4, 1), RemoteBitfields{})
+		}
+	}()
+	r, err := h1.Initialize(plain.peerID, l.Addr().String(), storage.TorrentInfoFixture(4, 1), RemoteBitfields{}, "")
+	require.NoError(err)
+	require.False(isTLS(r.Conn))
+
+	// Accepts plaintext connections.
+	c1, c2, err1, err2 = tlsHandshake(t, plain, h2)
+	require.NoError(err1)
+	require.NoError(err2)
+	require.False(isTLS(c1))
+	require.False(isTLS(c2))
+}
+
+func TestHandshakerTLSRejectsMismatchedPeerID(t *testing.T) {
+	require := require.New(t)
+
+	ca := newTestCA(t)
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	h1 := tlsHandshakerFixture(t, ca.config(t, TLSRequired, p1), p1)
+	h2 := tlsHandshakerFixture(t, ca.config(t, TLSRequired, p2), p2)
+
+	// h1 expects a different peer at h2's address.
+	h2.peerID = core.PeerIDFixture()
+	_, _, err, _ := tlsHandshake(t, h1, h2)
+	require.Error(err)
+}
+
+func TestNewHandshakerTLSCertMustMatchPeerID(t *testing.T) {
+	ca := newTestCA(t)
+
+	c := ConfigFixture()
+	c.TLS = ca.config(t, TLSRequired, core.PeerIDFixture())
+	_, err := NewHandshaker(
+		c,
+		tally.NewTestScope("", nil),
+		clock.New(),
+		networkevent.NewTestProducer(),
+		core.PeerIDFixture(),
+		noopEvents{},
+		zap.NewNop().Sugar())
+	require.Error(t, err)
+}
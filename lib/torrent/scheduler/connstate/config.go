@@ -22,6 +22,10 @@ type Config struct {
 	// Scheduler will maintain at once for each torrent.
 	MaxOpenConnectionsPerTorrent int `yaml:"max_open_conn"`
 
+	// MaxGlobalConnections is the maximum number of connections which a
+	// Scheduler will maintain at once across all torrents. Unlimited if 0.
+	MaxGlobalConnections int `yaml:"max_global_conn"`
+
 	// MaxMutualConnections is the maximum number of mutual connections a peer
 	// can have and still connect with us.
 	MaxMutualConnections int `yaml:"max_mutual_conn"`
@@ -32,6 +36,9 @@ type Config struct {
 
 	// BlacklistDuration is the duration a connection will remain blacklisted.
 	BlacklistDuration time.Duration `yaml:"blacklist_duration"`
+
+	// Reputation configures the scoring and banning of misbehaving peers.
+	Reputation ReputationConfig `yaml:"reputation"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -0,0 +1,241 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package connstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// Offense enumerates peer misbehaviors which penalize the reputation of peers.
+type Offense int
+
+const (
+	// OffenseInvalidPiece occurs when a peer sends a piece which fails hash
+	// verification.
+	OffenseInvalidPiece Offense = iota
+
+	// OffenseTimeout occurs when a peer does not send a requested piece before
+	// the request times out.
+	OffenseTimeout
+
+	// OffenseSlowTransfer occurs when a peer sends a requested piece, but only
+	// after most of the request timeout elapsed.
+	OffenseSlowTransfer
+)
+
+func (o Offense) String() string {
+	switch o {
+	case OffenseInvalidPiece:
+		return "invalid_piece"
+	case OffenseTimeout:
+		return "timeout"
+	case OffenseSlowTransfer:
+		return "slow_transfer"
+	default:
+		return fmt.Sprintf("Offense(%d)", int(o))
+	}
+}
+
+// ReputationConfig defines the configuration of peer reputation. Each offense
+// adds a penalty to the offending peer, and penalties decay over time. Peers
+// with penalties of at least BanThreshold are banned: conns to and from them
+// are rejected for all torrents.
+type ReputationConfig struct {
+
+	// File is the path penalties are persisted to, so bad peers remain banned
+	// across restarts. Penalties are not persisted if empty.
+	File string `yaml:"file"`
+
+	// HalfLife is the duration in which penalties decay by half.
+	HalfLife time.Duration `yaml:"half_life"`
+
+	// BanThreshold is the penalty at which peers are banned.
+	BanThreshold float64 `yaml:"ban_threshold"`
+
+	InvalidPiecePenalty float64 `yaml:"invalid_piece_penalty"`
+	TimeoutPenalty      float64 `yaml:"timeout_penalty"`
+	SlowTransferPenalty float64 `yaml:"slow_transfer_penalty"`
+}
+
+func (c ReputationConfig) applyDefaults() ReputationConfig {
+	if c.HalfLife == 0 {
+		c.HalfLife = time.Hour
+	}
+	if c.BanThreshold == 0 {
+		c.BanThreshold = 100
+	}
+	if c.InvalidPiecePenalty == 0 {
+		c.InvalidPiecePenalty = 25
+	}
+	if c.TimeoutPenalty == 0 {
+		c.TimeoutPenalty = 5
+	}
+	if c.SlowTransferPenalty == 0 {
+		c.SlowTransferPenalty = 1
+	}
+	return c
+}
+
+func (c ReputationConfig) penalty(o Offense) float64 {
+	switch o {
+	case OffenseInvalidPiece:
+		return c.InvalidPiecePenalty
+	case OffenseTimeout:
+		return c.TimeoutPenalty
+	case OffenseSlowTransfer:
+		return c.SlowTransferPenalty
+	default:
+		return 0
+	}
+}
+
+// _minPenalty is the penalty below which peers are forgotten.
+const _minPenalty = 0.01
+
+// _reputationSaveInterval throttles persisting penalties on offenses.
+const _reputationSaveInterval = 10 * time.Second
+
+// PeerReputation is the penalty of a peer as of UpdatedAt.
+type PeerReputation struct {
+	PeerID    core.PeerID `json:"peer_id"`
+	Penalty   float64     `json:"penalty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Banned    bool        `json:"banned"`
+}
+
+// reputation tracks the penalties of peers. Not thread-safe.
+type reputation struct {
+	config    ReputationConfig
+	penalties map[core.PeerID]PeerReputation
+	lastSave  time.Time
+}
+
+func newReputation(config ReputationConfig) *reputation {
+	return &reputation{
+		config:    config.applyDefaults(),
+		penalties: make(map[core.PeerID]PeerReputation),
+	}
+}
+
+// penalty returns the decayed penalty of peerID as of now.
+func (r *reputation) penalty(peerID core.PeerID, now time.Time) float64 {
+	p, ok := r.penalties[peerID]
+	if !ok {
+		return 0
+	}
+	elapsed := now.Sub(p.UpdatedAt)
+	if elapsed <= 0 {
+		return p.Penalty
+	}
+	return p.Penalty * math.Exp2(-float64(elapsed)/float64(r.config.HalfLife))
+}
+
+func (r *reputation) banned(peerID core.PeerID, now time.Time) bool {
+	return r.penalty(peerID, now) >= r.config.BanThreshold
+}
+
+// penalize adds the penalty of o to peerID. Returns the new penalty.
+func (r *reputation) penalize(peerID core.PeerID, o Offense, now time.Time) float64 {
+	p := r.penalty(peerID, now) + r.config.penalty(o)
+	r.penalties[peerID] = PeerReputation{
+		PeerID:    peerID,
+		Penalty:   p,
+		UpdatedAt: now,
+	}
+	return p
+}
+
+// snapshot returns the decayed penalties of all peers which are not forgotten.
+func (r *reputation) snapshot(now time.Time) []PeerReputation {
+	var peers []PeerReputation
+	for peerID := range r.penalties {
+		p := r.penalty(peerID, now)
+		if p < _minPenalty {
+			delete(r.penalties, peerID)
+			continue
+		}
+		peers = append(peers, PeerReputation{
+			PeerID:    peerID,
+			Penalty:   p,
+			UpdatedAt: now,
+			Banned:    p >= r.config.BanThreshold,
+		})
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].PeerID.LessThan(peers[j].PeerID)
+	})
+	return peers
+}
+
+// load restores penalties persisted to the reputation file. No-ops if the file
+// does not exist.
+func (r *reputation) load() error {
+	if r.config.File == "" {
+		return nil
+	}
+	b, err := os.ReadFile(r.config.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read file: %s", err)
+	}
+	var peers []PeerReputation
+	if err := json.Unmarshal(b, &peers); err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	for _, p := range peers {
+		r.penalties[p.PeerID] = p
+	}
+	return nil
+}
+
+// save atomically replaces the reputation file with the current penalties.
+func (r *reputation) save(now time.Time) error {
+	if r.config.File == "" {
+		return nil
+	}
+	r.lastSave = now
+	b, err := json.Marshal(r.snapshot(now))
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.config.File), 0775); err != nil {
+		return fmt.Errorf("mkdir: %s", err)
+	}
+	tmp := r.config.File + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("write file: %s", err)
+	}
+	if err := os.Rename(tmp, r.config.File); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+	return nil
+}
+
+// maybeSave saves penalties if they were not saved recently.
+func (r *reputation) maybeSave(now time.Time) error {
+	if now.Sub(r.lastSave) < _reputationSaveInterval {
+		return nil
+	}
+	return r.save(now)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package connstate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+)
+
+func TestStatePenalizeBansPeer(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Reputation: ReputationConfig{
+			BanThreshold:        10,
+			InvalidPiecePenalty: 6,
+		},
+	}
+	s := testState(config, clock.NewMock())
+
+	p := core.PeerIDFixture()
+
+	s.Penalize(p, OffenseInvalidPiece)
+	require.False(s.Banned(p))
+
+	s.Penalize(p, OffenseInvalidPiece)
+	require.True(s.Banned(p))
+}
+
+func TestStatePenaltiesDecay(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Reputation: ReputationConfig{
+			HalfLife:       time.Hour,
+			BanThreshold:   10,
+			TimeoutPenalty: 16,
+		},
+	}
+	clk := clock.NewMock()
+	s := testState(config, clk)
+
+	p := core.PeerIDFixture()
+
+	s.Penalize(p, OffenseTimeout)
+	require.True(s.Banned(p))
+
+	clk.Add(time.Hour)
+
+	require.False(s.Banned(p))
+	require.InDelta(8, s.ReputationSnapshot()[0].Penalty, 0.001)
+}
+
+func TestStateBannedWithBlacklistDisabled(t *testing.T) {
+	config := Config{
+		DisableBlacklist: true,
+		Reputation: ReputationConfig{
+			BanThreshold: 1,
+		},
+	}
+	s := testState(config, clock.NewMock())
+
+	p := core.PeerIDFixture()
+	s.Penalize(p, OffenseInvalidPiece)
+
+	require.False(t, s.Banned(p))
+}
+
+func TestStateSortByReputation(t *testing.T) {
+	require := require.New(t)
+
+	s := testState(Config{}, clock.NewMock())
+
+	good1 := core.PeerInfoFixture()
+	good2 := core.PeerInfoFixture()
+	slow := core.PeerInfoFixture()
+	malicious := core.PeerInfoFixture()
+
+	s.Penalize(slow.PeerID, OffenseSlowTransfer)
+	s.Penalize(malicious.PeerID, OffenseInvalidPiece)
+
+	peers := []*core.PeerInfo{malicious, good1, slow, good2}
+	s.SortByReputation(peers)
+
+	require.Equal([]*core.PeerInfo{good1, good2, slow, malicious}, peers)
+}
+
+func TestStateReputationPersistence(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Reputation: ReputationConfig{
+			File:         filepath.Join(t.TempDir(), "reputation", "reputation.json"),
+			BanThreshold: 10,
+		},
+	}
+	clk := clock.NewMock()
+	clk.Set(time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	s := testState(config, clk)
+
+	banned := core.PeerIDFixture()
+	for i := 0; i < 2; i++ {
+		s.Penalize(banned, OffenseInvalidPiece)
+	}
+	slow := core.PeerIDFixture()
+	s.Penalize(slow, OffenseSlowTransfer)
+
+	require.NoError(s.SaveReputation())
+
+	restarted := testState(config, clk)
+	require.True(restarted.Banned(banned))
+	require.False(restarted.Banned(slow))
+	require.Equal(s.ReputationSnapshot(), restarted.ReputationSnapshot())
+}
+
+func TestStateReputationNotPersistedWithoutFile(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := testState(Config{}, clk)
+
+	p := core.PeerIDFixture()
+	s.Penalize(p, OffenseInvalidPiece)
+	require.NoError(s.SaveReputation())
+
+	require.Empty(testState(Config{}, clk).ReputationSnapshot())
+}
@@ -15,6 +15,7 @@ package connstate
 
 import (
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/andres-erbsen/clock"
@@ -27,11 +28,13 @@ import (
 // State errors.
 var (
 	ErrTorrentAtCapacity       = errors.New("torrent is at capacity")
+	ErrAtGlobalCapacity        = errors.New("all torrents are at capacity")
 	ErrConnAlreadyPending      = errors.New("conn is already pending")
 	ErrConnAlreadyActive       = errors.New("conn is already active")
 	ErrConnClosed              = errors.New("conn is closed")
 	ErrInvalidActiveTransition = errors.New("conn must be pending to transition to active")
 	ErrTooManyMutualConns      = errors.New("conn has too many mutual connections")
+	ErrPeerBanned              = errors.New("peer is banned")
 
 	// This should NEVER happen.
 	errUnknownStatus = errors.New("invariant violation: unknown status")
@@ -75,7 +78,9 @@ func (e *blacklistEntry) Remaining(now time.Time) time.Duration {
 // blacklisted. Pending connections are unestablished connections which "reserve"
 // connection capacity until they are done handshaking. Active connections are
 // established connections. Blacklisted connections are failed connections which
-// should be skipped in each peer handout.
+// should be skipped in each peer handout. Additionally, State tracks the
+// reputation of peers, such that connections to and from banned peers can be
+// skipped.
 //
 // Note, State is NOT thread-safe. Synchronization must be provided by the client.
 type State struct {
@@ -86,10 +91,13 @@ type State struct {
 	logger      *zap.SugaredLogger
 
 	// All pending or active conns. These count towards conn capacity.
-	conns map[core.InfoHash]map[core.PeerID]entry
+	conns    map[core.InfoHash]map[core.PeerID]entry
+	numConns int
 
 	// All blacklisted conns. These do not count towards conn capacity.
 	blacklist map[connKey]*blacklistEntry
+
+	reputation *reputation
 }
 
 // New creates a new State.
@@ -102,7 +110,7 @@ func New(
 ) *State {
 	config = config.applyDefaults()
 
-	return &State{
+	s := &State{
 		config:      config,
 		clk:         clk,
 		netevents:   netevents,
@@ -110,7 +118,12 @@ func New(
 		logger:      logger,
 		conns:       make(map[core.InfoHash]map[core.PeerID]entry),
 		blacklist:   make(map[connKey]*blacklistEntry),
+		reputation:  newReputation(config.Reputation),
+	}
+	if err := s.reputation.load(); err != nil {
+		s.log().Errorf("Error loading peer reputation: %s", err)
 	}
+	return s
 }
 
 // ActiveConns returns a list of all active connections.
@@ -138,7 +151,20 @@ func (s *State) Saturated(h core.InfoHash) bool {
 			active++
 		}
 	}
-	return active == s.config.MaxOpenConnectionsPerTorrent
+	return active >= s.config.MaxOpenConnectionsPerTorrent
+}
+
+// SetLimits replaces the per-torrent and global conn limits, where a global
+// limit of 0 is unlimited. Existing conns are not closed when limits are
+// lowered, but no new conns are added until the conns fall below the limits.
+func (s *State) SetLimits(perTorrent, global int) {
+	s.config.MaxOpenConnectionsPerTorrent = perTorrent
+	s.config.MaxGlobalConnections = global
+}
+
+// Limits returns the per-torrent and global conn limits.
+func (s *State) Limits() (perTorrent, global int) {
+	return s.config.MaxOpenConnectionsPerTorrent, s.config.MaxGlobalConnections
 }
 
 // Blacklist blacklists peerID/h for the configured BlacklistDuration.
@@ -176,12 +202,56 @@ func (s *State) ClearBlacklist(h core.InfoHash) {
 	}
 }
 
+// Penalize lowers the reputation of peerID for committing o, and bans peerID
+// once its penalty reaches the ban threshold.
+func (s *State) Penalize(peerID core.PeerID, o Offense) {
+	wasBanned := s.Banned(peerID)
+	p := s.reputation.penalize(peerID, o, s.clk.Now())
+	if !wasBanned && s.Banned(peerID) {
+		s.log("peer", peerID).Warnf("Peer banned with penalty %.2f after %s", p, o)
+	}
+	if err := s.reputation.maybeSave(s.clk.Now()); err != nil {
+		s.log().Errorf("Error saving peer reputation: %s", err)
+	}
+}
+
+// Banned returns true if peerID is banned due to bad reputation.
+func (s *State) Banned(peerID core.PeerID) bool {
+	if s.config.DisableBlacklist {
+		return false
+	}
+	return s.reputation.banned(peerID, s.clk.Now())
+}
+
+// SortByReputation sorts peers by reputation, best first. Peers of equal
+// reputation retain their order.
+func (s *State) SortByReputation(peers []*core.PeerInfo) {
+	now := s.clk.Now()
+	sort.SliceStable(peers, func(i, j int) bool {
+		return s.reputation.penalty(peers[i].PeerID, now) < s.reputation.penalty(peers[j].PeerID, now)
+	})
+}
+
+// ReputationSnapshot returns the reputation of all peers which were penalized
+// recently.
+func (s *State) ReputationSnapshot() []PeerReputation {
+	return s.reputation.snapshot(s.clk.Now())
+}
+
+// SaveReputation persists the reputation of peers.
+func (s *State) SaveReputation() error {
+	return s.reputation.save(s.clk.Now())
+}
+
 // AddPending sets the connection for peerID/h as pending and reserves capacity
 // for it.
 func (s *State) AddPending(peerID core.PeerID, h core.InfoHash, neighbors []core.PeerID) error {
-	if len(s.conns[h]) == s.config.MaxOpenConnectionsPerTorrent {
+	if len(s.conns[h]) >= s.config.MaxOpenConnectionsPerTorrent {
 		return ErrTorrentAtCapacity
 	}
+	if s.config.MaxGlobalConnections > 0 && s.numConns >= s.config.MaxGlobalConnections {
+		return ErrAtGlobalCapacity
+	}
 	switch s.get(h, peerID).status {
 	case _uninit:
 		if s.numMutualConns(h, neighbors) > s.config.MaxMutualConnections {
@@ -289,6 +359,9 @@ func (s *State) put(h core.InfoHash, peerID core.PeerID, e entry) {
 		peers = make(map[core.PeerID]entry)
 		s.conns[h] = peers
 	}
+	if _, ok := peers[peerID]; !ok {
+		s.numConns++
+	}
 	peers[peerID] = e
 }
 
@@ -297,6 +370,9 @@ func (s *State) delete(h core.InfoHash, peerID core.PeerID) {
 	if !ok {
 		return
 	}
+	if _, ok := peers[peerID]; ok {
+		s.numConns--
+	}
 	delete(peers, peerID)
 	if len(peers) == 0 {
 		delete(s.conns, h)
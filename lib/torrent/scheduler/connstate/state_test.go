@@ -122,6 +122,44 @@ func TestStateAddPendingReservesCapacity(t *testing.T) {
 	require.Equal(ErrTorrentAtCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
 }
 
+func TestStateAddPendingReservesGlobalCapacity(t *testing.T) {
+	require := require.New(t)
+
+	s := testState(Config{MaxGlobalConnections: 2}, clock.New())
+
+	p1 := core.PeerIDFixture()
+	h1 := core.InfoHashFixture()
+
+	require.NoError(s.AddPending(p1, h1, nil))
+	require.NoError(s.AddPending(core.PeerIDFixture(), core.InfoHashFixture(), nil))
+	require.Equal(ErrAtGlobalCapacity, s.AddPending(core.PeerIDFixture(), core.InfoHashFixture(), nil))
+
+	s.DeletePending(p1, h1)
+	require.NoError(s.AddPending(core.PeerIDFixture(), core.InfoHashFixture(), nil))
+}
+
+func TestStateSetLimits(t *testing.T) {
+	require := require.New(t)
+
+	s := testState(Config{MaxOpenConnectionsPerTorrent: 3}, clock.New())
+
+	h := core.InfoHashFixture()
+
+	require.NoError(s.AddPending(core.PeerIDFixture(), h, nil))
+	require.NoError(s.AddPending(core.PeerIDFixture(), h, nil))
+
+	// Lowering limits below the current conns rejects new conns.
+	s.SetLimits(1, 0)
+	require.Equal(ErrTorrentAtCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
+
+	s.SetLimits(5, 2)
+	require.Equal(ErrAtGlobalCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
+
+	perTorrent, global := s.Limits()
+	require.Equal(5, perTorrent)
+	require.Equal(2, global)
+}
+
 func TestStateDeletePendingAllowsFutureAddPending(t *testing.T) {
 	require := require.New(t)
 
@@ -15,16 +15,19 @@ package scheduler
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
 	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
 	"github.com/uber/kraken/lib/torrent/storage/originstorage"
+	"github.com/uber/kraken/lib/torrent/webseed"
 	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/tracker/metainfoclient"
 
@@ -42,9 +45,19 @@ func NewAgentScheduler(
 	announceClient announceclient.Client,
 	tls *tls.Config) (ReloadableScheduler, error) {
 
+	if config.WebSeed.Enabled && config.WebSeed.Addr == "" {
+		return nil, errors.New("webseed: addr required")
+	}
+
+	var archiveOpts []agentstorage.Option
+	if config.Delta.Enabled {
+		archiveOpts = append(archiveOpts, agentstorage.WithDelta(delta.NewCatalog(config.Delta)))
+	}
+
 	s, err := newScheduler(
 		config,
-		agentstorage.NewTorrentArchive(stats, cads, metainfoclient.New(trackers, tls)),
+		agentstorage.NewTorrentArchive(
+			stats, cads, metainfoclient.New(trackers, tls), archiveOpts...),
 		stats,
 		pctx,
 		announceClient,
@@ -52,6 +65,9 @@ func NewAgentScheduler(
 	if err != nil {
 		return nil, fmt.Errorf("new scheduler: %s", err)
 	}
+	if s.config.WebSeed.Enabled {
+		s.webSeed = webseed.NewOriginSource(s.config.WebSeed.Addr, s.config.WebSeed.Timeout, tls)
+	}
 
 	aq := func() announcequeue.Queue { return announcequeue.New() }
 	rs := makeReloadable(s, aq)
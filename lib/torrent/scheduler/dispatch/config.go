@@ -20,6 +20,8 @@ import (
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch/piecerequest"
 	"github.com/uber/kraken/utils/memsize"
 	"github.com/uber/kraken/utils/timeutil"
+
+	"github.com/c2h5oh/datasize"
 )
 
 // Config defines the configuration for piece dispatch.
@@ -37,6 +39,11 @@ type Config struct {
 	// from a peer.
 	PieceRequestPolicy string `yaml:"piece_request_policy"`
 
+	// SizedPieceRequestPolicies override PieceRequestPolicy by torrent size,
+	// e.g. to request the rarest pieces first only for large blobs pushed to
+	// many peers at once.
+	SizedPieceRequestPolicies []SizedPieceRequestPolicy `yaml:"sized_piece_request_policies"`
+
 	// PipelineLimit limits the total number of requests can be sent to a peer
 	// at the same time.
 	PipelineLimit int `yaml:"pipeline_limit"`
@@ -47,6 +54,26 @@ type Config struct {
 	EndgameThreshold int `yaml:"endgame_threshold"`
 
 	DisableEndgame bool `yaml:"disable_endgame"`
+
+	// Superseed enables superseeding of complete torrents: instead of
+	// advertising all pieces, only up to PipelineLimit pieces which are not yet
+	// well replicated are advertised to each peer at a time, and a new piece is
+	// advertised once a previous one is announced by another peer. Intended
+	// for origins, to reduce their egress when many peers download the same
+	// blob at once.
+	Superseed bool `yaml:"superseed"`
+
+	// SuperseedOfferTimeout is the duration after which a piece advertised
+	// while superseeding is replaced, even if no other peer announced it.
+	// Defaults to twice the piece request timeout.
+	SuperseedOfferTimeout time.Duration `yaml:"superseed_offer_timeout"`
+}
+
+// SizedPieceRequestPolicy selects the piece request policy of torrents of at
+// least MinSize.
+type SizedPieceRequestPolicy struct {
+	MinSize datasize.ByteSize `yaml:"min_size"`
+	Policy  string            `yaml:"policy"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -73,3 +100,17 @@ func (c Config) calcPieceRequestTimeout(maxPieceLength int64) time.Duration {
 	d := time.Duration(math.Ceil(n))
 	return timeutil.MaxDuration(d, c.PieceRequestMinTimeout)
 }
+
+// pieceRequestPolicy returns the piece request policy for a torrent of size
+// bytes. The sized policy with the largest MinSize not exceeding size applies.
+func (c Config) pieceRequestPolicy(size int64) string {
+	policy := c.PieceRequestPolicy
+	var minSize datasize.ByteSize
+	for _, p := range c.SizedPieceRequestPolicies {
+		if int64(p.MinSize) <= size && p.MinSize >= minSize {
+			policy = p.Policy
+			minSize = p.MinSize
+		}
+	}
+	return policy
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
+	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch/piecerequest"
 	"github.com/uber/kraken/lib/torrent/scheduler/torrentlog"
 	"github.com/uber/kraken/lib/torrent/storage"
@@ -44,6 +45,9 @@ var (
 type Events interface {
 	DispatcherComplete(*Dispatcher)
 	PeerRemoved(core.PeerID, core.InfoHash)
+	PexReceived(core.PeerID, core.InfoHash, []*core.PeerInfo)
+	PeerMisbehaved(core.PeerID, connstate.Offense)
+	TorrentCorrupt(core.InfoHash)
 }
 
 // Messages defines a subset of conn.Conn methods which Dispatcher requires to
@@ -70,6 +74,12 @@ type Dispatcher struct {
 	netevents             networkevent.Producer
 	pieceRequestTimeout   time.Duration
 	pieceRequestManager   *piecerequest.Manager
+	superseeder           *superseeder // Nil if superseeding is disabled.
+	integrity             *integrityTracker
+	webSeed               *webSeedPieces
+	latencyMu             sync.Mutex // Protects latency and numLatencies.
+	latency               time.Duration
+	numLatencies          int
 	pendingPiecesDoneOnce sync.Once
 	pendingPiecesDone     chan struct{}
 	completeOnce          sync.Once
@@ -125,11 +135,20 @@ func newDispatcher(
 
 	pieceRequestTimeout := config.calcPieceRequestTimeout(t.MaxPieceLength())
 	pieceRequestManager, err := piecerequest.NewManager(
-		clk, pieceRequestTimeout, config.PieceRequestPolicy, config.PipelineLimit)
+		clk, pieceRequestTimeout, config.pieceRequestPolicy(t.Length()), config.PipelineLimit)
 	if err != nil {
 		return nil, fmt.Errorf("piece request manager: %s", err)
 	}
 
+	var ss *superseeder
+	if config.Superseed {
+		timeout := config.SuperseedOfferTimeout
+		if timeout == 0 {
+			timeout = 2 * pieceRequestTimeout
+		}
+		ss = newSuperseeder(clk, timeout, config.PipelineLimit, t.NumPieces())
+	}
+
 	return &Dispatcher{
 		config:              config,
 		stats:               stats,
@@ -141,6 +160,9 @@ func newDispatcher(
 		netevents:           netevents,
 		pieceRequestTimeout: pieceRequestTimeout,
 		pieceRequestManager: pieceRequestManager,
+		superseeder:         ss,
+		integrity:           newIntegrityTracker(t.NumPieces()),
+		webSeed:             newWebSeedPieces(),
 		pendingPiecesDone:   make(chan struct{}),
 		events:              events,
 		logger:              logger,
@@ -163,6 +185,29 @@ func (d *Dispatcher) Length() int64 {
 	return d.torrent.Length()
 }
 
+// BytesDownloaded returns the number of bytes of d's torrent which are
+// downloaded.
+func (d *Dispatcher) BytesDownloaded() int64 {
+	return d.torrent.BytesDownloaded()
+}
+
+// SetPipelineLimit replaces the limit of pending piece requests per peer.
+func (d *Dispatcher) SetPipelineLimit(n int) {
+	d.pieceRequestManager.SetPipelineLimit(n)
+}
+
+// TakePieceLatency returns the total latency and the number of piece requests
+// which were fulfilled since the last call, where the latency of a request is
+// the duration between sending the request and receiving the piece.
+func (d *Dispatcher) TakePieceLatency() (time.Duration, int) {
+	d.latencyMu.Lock()
+	defer d.latencyMu.Unlock()
+
+	latency, n := d.latency, d.numLatencies
+	d.latency, d.numLatencies = 0, 0
+	return latency, n
+}
+
 // Stat returns d's TorrentInfo.
 func (d *Dispatcher) Stat() *storage.TorrentInfo {
 	return d.torrent.Stat()
@@ -173,6 +218,20 @@ func (d *Dispatcher) Complete() bool {
 	return d.torrent.Complete()
 }
 
+// PrioritizeRange requests the pieces overlapping [offset, offset+length) of
+// d's torrent before any other pieces, in order, so a reader can stream the
+// range while the torrent is still downloading.
+func (d *Dispatcher) PrioritizeRange(offset, length int64) error {
+	if offset < 0 || length <= 0 || offset+length > d.torrent.Length() {
+		return fmt.Errorf(
+			"range [%d, %d) out of bounds of length %d", offset, offset+length, d.torrent.Length())
+	}
+	pieceLength := d.torrent.MaxPieceLength()
+	d.pieceRequestManager.Prioritize(
+		int(offset/pieceLength), int((offset+length-1)/pieceLength)+1)
+	return nil
+}
+
 // CreatedAt returns when d was created.
 func (d *Dispatcher) CreatedAt() time.Time {
 	return d.createdAt
@@ -253,6 +312,9 @@ func (d *Dispatcher) AddPeer(
 		return err
 	}
 	go func() {
+		if d.superseeding() {
+			d.advertise(p)
+		}
 		if _, err := d.maybeRequestMorePieces(p); err != nil {
 			d.log("peer", p).Errorf("Error requesting pieces: %s", err)
 		}
@@ -289,6 +351,10 @@ func (d *Dispatcher) addPeer(
 func (d *Dispatcher) removePeer(p *peer) error {
 	d.peers.Delete(p.id)
 	d.pieceRequestManager.ClearPeer(p.id)
+	if d.superseeder != nil {
+		d.superseeder.removePeer(p.id)
+	}
+	d.integrity.removePeer(p.id)
 
 	for _, i := range p.bitfield.GetAllSet() {
 		d.numPeersByPiece.Decrement(int(i))
@@ -354,6 +420,9 @@ func (d *Dispatcher) complete() {
 			// are now useless.
 			d.log("peer", p).Info("Closing connection to completed peer")
 			p.messages.Close()
+		} else if d.superseeder != nil {
+			// Only advertise pieces which the swarm lacks.
+			d.advertise(p)
 		} else {
 			// Notify in-progress peers that we have completed the torrent and
 			// all pieces are available.
@@ -411,6 +480,7 @@ func (d *Dispatcher) maybeRequestMorePieces(p *peer) (bool, error) {
 }
 
 func (d *Dispatcher) maybeSendPieceRequests(p *peer, pieceCandidates *bitset.BitSet) (bool, error) {
+	pieceCandidates = d.integrity.excludeCorrupt(p.id, pieceCandidates)
 	pieces, err := d.pieceRequestManager.ReservePieces(p.id, pieceCandidates, d.numPeersByPiece, d.endgame())
 	if err != nil {
 		return false, err
@@ -440,27 +510,14 @@ func (d *Dispatcher) resendFailedPieceRequests() {
 
 	var sent int
 	for _, r := range failedRequests {
-		d.peers.Range(func(k, v interface{}) bool {
-			p, ok := v.(*peer)
-			if !ok {
-				panic(fmt.Sprintf("dispatcher: stored value is not *peer: %T", v))
-			}
-			if (r.Status == piecerequest.StatusExpired || r.Status == piecerequest.StatusInvalid) &&
-				r.PeerID == p.id {
-				// Do not resend to the same peer for expired or invalid requests.
-				return true
-			}
-
-			b := d.torrent.Bitfield()
-			candidates := p.bitfield.Intersection(b.Complement())
-			if candidates.Test(uint(r.Piece)) {
-				nb := bitset.New(b.Len()).Set(uint(r.Piece))
-				if sent, err := d.maybeSendPieceRequests(p, nb); sent && err == nil {
-					return false
-				}
-			}
-			return true
+		ok := d.resendPieceRequest(r.Piece, func(p *peer) bool {
+			// Do not resend to the same peer for expired or invalid requests.
+			return (r.Status == piecerequest.StatusExpired || r.Status == piecerequest.StatusInvalid) &&
+				r.PeerID == p.id
 		})
+		if ok {
+			sent++
+		}
 	}
 
 	unsent := len(failedRequests) - sent
@@ -469,10 +526,46 @@ func (d *Dispatcher) resendFailedPieceRequests() {
 	}
 }
 
+// resendPieceRequest requests piece i from the first peer which has it, unless
+// skip returns true for the peer. Returns whether the request was sent.
+func (d *Dispatcher) resendPieceRequest(i int, skip func(*peer) bool) bool {
+	var sent bool
+	d.peers.Range(func(k, v interface{}) bool {
+		p, ok := v.(*peer)
+		if !ok {
+			panic(fmt.Sprintf("dispatcher: stored value is not *peer: %T", v))
+		}
+		if skip(p) {
+			return true
+		}
+
+		b := d.torrent.Bitfield()
+		candidates := p.bitfield.Intersection(b.Complement())
+		if candidates.Test(uint(i)) {
+			nb := bitset.New(b.Len()).Set(uint(i))
+			if ok, err := d.maybeSendPieceRequests(p, nb); ok && err == nil {
+				sent = true
+				return false
+			}
+		}
+		return true
+	})
+	return sent
+}
+
+// reportExpiredPieceRequests penalizes peers which did not send requested
+// pieces in time.
+func (d *Dispatcher) reportExpiredPieceRequests() {
+	for _, r := range d.pieceRequestManager.GetNewlyExpiredRequests() {
+		d.events.PeerMisbehaved(r.PeerID, connstate.OffenseTimeout)
+	}
+}
+
 func (d *Dispatcher) watchPendingPieceRequests() {
 	for {
 		select {
 		case <-d.clk.After(d.pieceRequestTimeout / 2):
+			d.reportExpiredPieceRequests()
 			d.resendFailedPieceRequests()
 		case <-d.pendingPiecesDone:
 			return
@@ -510,6 +603,8 @@ func (d *Dispatcher) dispatch(p *peer, msg *conn.Message) error {
 		d.handleBitfield(p, msg.Message.Bitfield)
 	case p2p.Message_COMPLETE:
 		d.handleComplete(p)
+	case p2p.Message_PEX:
+		d.handlePex(p, msg.Message.Pex)
 	default:
 		return fmt.Errorf("unknown message type: %d", msg.Message.Type)
 	}
@@ -521,6 +616,8 @@ func (d *Dispatcher) handleError(p *peer, msg *p2p.ErrorMessage) {
 	case p2p.ErrorMessage_PIECE_REQUEST_FAILED:
 		d.log().Errorf("Piece request failed: %s", msg.Error)
 		d.pieceRequestManager.MarkInvalid(p.id, int(msg.Index))
+	case p2p.ErrorMessage_PIECE_CORRUPT:
+		d.handlePieceCorrupt(p, int(msg.Index))
 	}
 }
 
@@ -536,6 +633,10 @@ func (d *Dispatcher) handleAnnouncePiece(p *peer, msg *p2p.AnnouncePieceMessage)
 	if _, err := d.maybeRequestMorePieces(p); err != nil {
 		d.log("peer", p).Errorf("Error requesting more pieces: %s", err)
 	}
+
+	if d.superseeding() {
+		d.readvertise(d.superseeder.confirm(i))
+	}
 }
 
 func (d *Dispatcher) isFullPiece(i, offset, length int) bool {
@@ -574,6 +675,57 @@ func (d *Dispatcher) handlePieceRequest(p *peer, msg *p2p.PieceRequestMessage) {
 	p.bitfield.Set(uint(i), true)
 }
 
+// handleInvalidPiece records that p sent a copy of piece i which failed hash
+// verification, reports the corruption to p, and re-requests piece i from a
+// different peer.
+func (d *Dispatcher) handleInvalidPiece(p *peer, i int) {
+	offenders := d.integrity.recordFailure(p.id, i)
+
+	d.stats.Counter("invalid_pieces").Inc(1)
+	d.torrentlog.PieceIntegrityFailure(
+		d.torrent.Digest(), d.torrent.InfoHash(), p.id,
+		i, d.torrent.MaxPieceLength()*int64(i), d.torrent.PieceLength(i), offenders)
+	d.events.PeerMisbehaved(p.id, connstate.OffenseInvalidPiece)
+
+	msg := conn.NewErrorMessage(i, p2p.ErrorMessage_PIECE_CORRUPT, storage.ErrInvalidPiece)
+	if err := p.messages.Send(msg); err != nil {
+		d.log("peer", p).Errorf("Error sending piece corrupt message: %s", err)
+	}
+
+	resent := d.resendPieceRequest(i, func(pp *peer) bool {
+		return d.integrity.sentCorrupt(pp.id, i)
+	})
+	if !resent {
+		d.log("piece", i).Infof(
+			"Nowhere to resend corrupt piece, %d peers sent corrupt copies", len(offenders))
+	}
+}
+
+// handlePieceCorrupt verifies local piece i after p reported that our copy of
+// piece i failed hash verification. If our copy is corrupt, the torrent must
+// be repaired, since every peer we send piece i to will reject it.
+func (d *Dispatcher) handlePieceCorrupt(p *peer, i int) {
+	if i < 0 || i >= d.torrent.NumPieces() {
+		d.log("peer", p).Errorf("Piece corrupt report out of bounds: %d", i)
+		return
+	}
+	if !d.torrent.HasPiece(i) || !d.integrity.startVerify(i) {
+		return
+	}
+	if err := d.torrent.VerifyPiece(i); err != nil {
+		if err != storage.ErrInvalidPiece {
+			d.log("piece", i).Errorf("Error verifying piece: %s", err)
+			return
+		}
+		d.log("peer", p, "piece", i).Error("Local piece is corrupt")
+		d.stats.Counter("corrupt_local_pieces").Inc(1)
+		d.torrentlog.LocalPieceCorrupt(
+			d.torrent.Digest(), d.torrent.InfoHash(), p.id,
+			i, d.torrent.MaxPieceLength()*int64(i), d.torrent.PieceLength(i))
+		d.events.TorrentCorrupt(d.torrent.InfoHash())
+	}
+}
+
 func (d *Dispatcher) handlePiecePayload(
 	p *peer, msg *p2p.PiecePayloadMessage, payload storage.PieceReader) {
 
@@ -590,6 +742,9 @@ func (d *Dispatcher) handlePiecePayload(
 		if err != storage.ErrPieceComplete {
 			d.log("peer", p, "piece", i).Errorf("Error writing piece payload: %s", err)
 			d.pieceRequestManager.MarkInvalid(p.id, i)
+			if err == storage.ErrInvalidPiece {
+				d.handleInvalidPiece(p, i)
+			}
 		} else {
 			p.pstats.incrementDuplicatePiecesReceived()
 		}
@@ -601,22 +756,43 @@ func (d *Dispatcher) handlePiecePayload(
 
 	p.pstats.incrementGoodPiecesReceived()
 	p.touchLastGoodPieceReceived()
-	if d.torrent.Complete() {
-		d.complete()
+
+	// Requests which expired were already penalized as timeouts.
+	age, ok := d.pieceRequestManager.RequestAge(p.id, i)
+	if ok && age > d.pieceRequestTimeout/2 && age <= d.pieceRequestTimeout {
+		d.events.PeerMisbehaved(p.id, connstate.OffenseSlowTransfer)
+	}
+	if ok {
+		d.latencyMu.Lock()
+		d.latency += age
+		d.numLatencies++
+		d.latencyMu.Unlock()
 	}
 
-	d.pieceRequestManager.Clear(i)
+	d.pieceWritten(p.id, i)
 
 	if _, err := d.maybeRequestMorePieces(p); err != nil {
 		d.log("peer", p).Errorf("Error requesting more pieces: %s", err)
 	}
+}
+
+// pieceWritten completes the torrent if piece i was its last missing piece,
+// resolves the requests of piece i, and announces piece i to all peers except
+// the peer it was received from.
+func (d *Dispatcher) pieceWritten(from core.PeerID, i int) {
+	if d.torrent.Complete() {
+		d.complete()
+	}
+
+	d.cancelPieceRequests(from, i)
+	d.pieceRequestManager.Clear(i)
 
 	d.peers.Range(func(k, v interface{}) bool {
 		peerID, ok := k.(core.PeerID)
 		if !ok {
 			panic(fmt.Sprintf("dispatcher: stored key is not core.PeerID: %T", k))
 		}
-		if peerID == p.id {
+		if peerID == from {
 			return true
 		}
 		pp, ok := v.(*peer)
@@ -632,10 +808,33 @@ func (d *Dispatcher) handlePiecePayload(
 	})
 }
 
+// cancelPieceRequests cancels requests for piece i to peers other than from,
+// which may exist in endgame or after a request expired.
+func (d *Dispatcher) cancelPieceRequests(from core.PeerID, i int) {
+	for _, peerID := range d.pieceRequestManager.PendingPeers(i) {
+		if peerID == from {
+			continue
+		}
+		v, ok := d.peers.Load(peerID)
+		if !ok {
+			continue
+		}
+		pp, ok := v.(*peer)
+		if !ok {
+			panic(fmt.Sprintf("dispatcher: stored value is not *peer: %T", v))
+		}
+		if err := pp.messages.Send(conn.NewCancelPieceMessage(i)); err != nil {
+			d.log("peer", pp).Errorf("Error sending cancel piece message: %s", err)
+			continue
+		}
+		d.stats.Counter("piece_requests_cancelled").Inc(1)
+	}
+}
+
 func (d *Dispatcher) handleCancelPiece(p *peer, msg *p2p.CancelPieceMessage) {
-	// No-op: cancelling not supported because all received messages are synchronized,
-	// therefore if we receive a cancel it is already too late -- we've already read
-	// the piece.
+	// No-op: received messages are synchronized, so by the time we handle a
+	// cancel, the payload is already queued on the connection. Conn drops
+	// cancelled payloads which have not been written yet.
 }
 
 func (d *Dispatcher) handleBitfield(p *peer, msg *p2p.BitfieldMessage) {
@@ -654,6 +853,74 @@ func (d *Dispatcher) handleComplete(p *peer) {
 	}
 }
 
+// handlePex forwards the peers gossiped by p, which are filtered and rate
+// limited by the receiver of the event.
+func (d *Dispatcher) handlePex(p *peer, msg *p2p.PexMessage) {
+	var peers []*core.PeerInfo
+	for _, pp := range msg.GetPeers() {
+		peerID, err := core.NewPeerID(pp.PeerID)
+		if err != nil {
+			d.log("peer", p).Infof("Ignoring pex peer with invalid id: %s", err)
+			continue
+		}
+		info := core.NewPeerInfo(peerID, pp.Ip, int(pp.Port), pp.Origin, pp.Complete)
+		info.AltIP = pp.AltIP
+		peers = append(peers, info)
+	}
+	d.events.PexReceived(p.id, d.torrent.InfoHash(), peers)
+}
+
+func (d *Dispatcher) superseeding() bool {
+	return d.superseeder != nil && d.torrent.Complete()
+}
+
+// advertise announces pieces to p which are not yet well replicated in the
+// swarm, while superseeding.
+func (d *Dispatcher) advertise(p *peer) {
+	pieces := d.superseeder.offer(
+		p.id, func(i int) bool { return p.bitfield.Has(uint(i)) }, d.numPeersByPiece)
+	for _, i := range pieces {
+		if err := p.messages.Send(conn.NewAnnouncePieceMessage(i)); err != nil {
+			d.log("peer", p).Errorf("Error sending announce piece message: %s", err)
+			return
+		}
+	}
+	d.stats.Counter("superseed_offers").Inc(int64(len(pieces)))
+
+	if d.superseeder.startWatching() {
+		go d.watchSuperseedOffers()
+	}
+}
+
+func (d *Dispatcher) readvertise(peerIDs []core.PeerID) {
+	for _, peerID := range peerIDs {
+		v, ok := d.peers.Load(peerID)
+		if !ok {
+			continue
+		}
+		p, ok := v.(*peer)
+		if !ok {
+			panic(fmt.Sprintf("dispatcher: stored value is not *peer: %T", v))
+		}
+		d.advertise(p)
+	}
+}
+
+// watchSuperseedOffers replaces expired offers until all offers are resolved.
+func (d *Dispatcher) watchSuperseedOffers() {
+	for {
+		<-d.clk.After(d.superseeder.timeout / 2)
+		expired := d.superseeder.expire()
+		if len(expired) > 0 {
+			d.stats.Counter("superseed_expired_offers").Inc(int64(len(expired)))
+		}
+		d.readvertise(expired)
+		if d.superseeder.stopWatching() {
+			return
+		}
+	}
+}
+
 func (d *Dispatcher) log(args ...interface{}) *zap.SugaredLogger {
 	args = append(args, "torrent", d.torrent)
 	return d.logger.With(args...)
@@ -24,6 +24,8 @@ import (
 	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
+	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch/piecerequest"
 	"github.com/uber/kraken/lib/torrent/scheduler/torrentlog"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
@@ -33,6 +35,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 	"github.com/willf/bitset"
@@ -107,6 +110,21 @@ func hasComplete(messages Messages) bool {
 	return false
 }
 
+func corruptPieceReports(messages Messages) []int {
+	var ps []int
+	m, ok := messages.(*mockMessages)
+	if !ok {
+		panic(fmt.Sprintf("expected *mockMessages, got %T", messages))
+	}
+	for _, msg := range m.sent {
+		if msg.Message.Type == p2p.Message_ERROR &&
+			msg.Message.Error.Code == p2p.ErrorMessage_PIECE_CORRUPT {
+			ps = append(ps, int(msg.Message.Error.Index))
+		}
+	}
+	return ps
+}
+
 func closed(messages Messages) bool {
 	m, ok := messages.(*mockMessages)
 	if !ok {
@@ -121,6 +139,12 @@ func (e noopEvents) DispatcherComplete(*Dispatcher) {}
 
 func (e noopEvents) PeerRemoved(core.PeerID, core.InfoHash) {}
 
+func (e noopEvents) PexReceived(core.PeerID, core.InfoHash, []*core.PeerInfo) {}
+
+func (e noopEvents) PeerMisbehaved(core.PeerID, connstate.Offense) {}
+
+func (e noopEvents) TorrentCorrupt(core.InfoHash) {}
+
 func testDispatcher(config Config, clk clock.Clock, t storage.Torrent) *Dispatcher {
 	d, err := newDispatcher(
 		config,
@@ -311,6 +335,32 @@ func TestDispatcherCalcPieceRequestTimeout(t *testing.T) {
 	}
 }
 
+func TestDispatcherPieceRequestPolicyBySize(t *testing.T) {
+	config := Config{
+		PieceRequestPolicy: piecerequest.DefaultPolicy,
+		SizedPieceRequestPolicies: []SizedPieceRequestPolicy{
+			{MinSize: datasize.GB, Policy: "large"},
+			{MinSize: datasize.MB, Policy: piecerequest.RarestFirstPolicy},
+		},
+	}
+
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{0, piecerequest.DefaultPolicy},
+		{int64(datasize.MB) - 1, piecerequest.DefaultPolicy},
+		{int64(datasize.MB), piecerequest.RarestFirstPolicy},
+		{int64(datasize.GB) - 1, piecerequest.RarestFirstPolicy},
+		{int64(datasize.GB), "large"},
+	}
+	for _, test := range tests {
+		t.Run(memsize.Format(uint64(test.size)), func(t *testing.T) {
+			require.Equal(t, test.expected, config.pieceRequestPolicy(test.size))
+		})
+	}
+}
+
 func TestDispatcherEndgame(t *testing.T) {
 	require := require.New(t)
 
@@ -341,6 +391,58 @@ func TestDispatcherEndgame(t *testing.T) {
 	require.Equal(map[int]int{0: 1}, numRequestsPerPiece(p2.messages))
 }
 
+func cancelledPieces(messages Messages) []int {
+	var ps []int
+	m, ok := messages.(*mockMessages)
+	if !ok {
+		panic(fmt.Sprintf("expected *mockMessages, got %T", messages))
+	}
+	for _, msg := range m.sent {
+		if msg.Message.Type == p2p.Message_CANCEL_PIECE {
+			ps = append(ps, int(msg.Message.CancelPiece.Index))
+		}
+	}
+	return ps
+}
+
+func TestDispatcherEndgameCancelsDuplicateRequests(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		PipelineLimit:    1,
+		EndgameThreshold: 2,
+	}
+
+	blob := core.SizedBlobFixture(2, 1)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	d := testDispatcher(config, clock.NewMock(), torrent)
+
+	p1, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true, false), newMockMessages())
+	require.NoError(err)
+	p2, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true, false), newMockMessages())
+	require.NoError(err)
+	p3, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(false, true), newMockMessages())
+	require.NoError(err)
+
+	for _, p := range []*peer{p1, p2, p3} {
+		_, err = d.maybeRequestMorePieces(p)
+		require.NoError(err)
+	}
+	require.Equal(map[int]int{0: 1}, numRequestsPerPiece(p1.messages))
+	require.Equal(map[int]int{0: 1}, numRequestsPerPiece(p2.messages))
+
+	msg := conn.NewPiecePayloadMessage(0, piecereader.NewBuffer(blob.Content[0:1]))
+	require.NoError(d.dispatch(p1, msg))
+
+	// Only the duplicate request for piece 0 is cancelled.
+	require.Empty(cancelledPieces(p1.messages))
+	require.Equal([]int{0}, cancelledPieces(p2.messages))
+	require.Empty(cancelledPieces(p3.messages))
+}
+
 func TestDispatcherHandlePiecePayloadAnnouncesPiece(t *testing.T) {
 	require := require.New(t)
 
@@ -497,3 +599,241 @@ func TestDispatcherPeerPieceCounts(t *testing.T) {
 	require.Equal(1, d.numPeersByPiece.Get(1))
 	require.Equal(2, d.numPeersByPiece.Get(2))
 }
+
+func TestDispatcherSuperseed(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(4, 1)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	for i := 0; i < torrent.NumPieces(); i++ {
+		require.NoError(torrent.WritePiece(piecereader.NewBuffer(blob.Content[i:i+1]), i))
+	}
+
+	d := testDispatcher(Config{PipelineLimit: 1, Superseed: true}, clock.NewMock(), torrent)
+
+	empty := bitsetutil.FromBools(false, false, false, false)
+
+	p1, err := d.addPeer(core.PeerIDFixture(), empty, newMockMessages())
+	require.NoError(err)
+	d.advertise(p1)
+
+	p2, err := d.addPeer(core.PeerIDFixture(), empty, newMockMessages())
+	require.NoError(err)
+	d.advertise(p2)
+
+	// Each peer is offered a different piece.
+	require.Equal([]int{0}, announcedPieces(p1.messages))
+	require.Equal([]int{1}, announcedPieces(p2.messages))
+
+	require.NoError(d.dispatch(p1, conn.NewPieceRequestMessage(0, 1)))
+
+	// No new piece is offered until another peer confirms that p1 shared the
+	// offered piece.
+	require.Equal([]int{0}, announcedPieces(p1.messages))
+
+	require.NoError(d.dispatch(p2, conn.NewAnnouncePieceMessage(0)))
+
+	require.Equal([]int{0, 2}, announcedPieces(p1.messages))
+	require.Equal([]int{1}, announcedPieces(p2.messages))
+}
+
+type pexRecordingEvents struct {
+	noopEvents
+	peerID core.PeerID
+	peers  []*core.PeerInfo
+}
+
+func (e *pexRecordingEvents) PexReceived(
+	peerID core.PeerID, h core.InfoHash, peers []*core.PeerInfo) {
+
+	e.peerID = peerID
+	e.peers = peers
+}
+
+func TestDispatcherHandlePexForwardsPeers(t *testing.T) {
+	require := require.New(t)
+
+	torrent, cleanup := agentstorage.TorrentFixture(core.SizedBlobFixture(1, 1).MetaInfo)
+	defer cleanup()
+
+	d := testDispatcher(Config{}, clock.NewMock(), torrent)
+	events := &pexRecordingEvents{}
+	d.events = events
+
+	p, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(false), newMockMessages())
+	require.NoError(err)
+
+	peer := core.PeerInfoFixture()
+	peer.AltIP = "::1"
+
+	msg := conn.NewPexMessage([]*core.PeerInfo{peer})
+	msg.Message.Pex.Peers = append(msg.Message.Pex.Peers, &p2p.PexPeer{PeerID: "invalid"})
+
+	require.NoError(d.dispatch(p, msg))
+
+	require.Equal(p.id, events.peerID)
+	require.Equal([]*core.PeerInfo{peer}, events.peers)
+}
+
+type offenseRecordingEvents struct {
+	noopEvents
+	offenses map[core.PeerID][]connstate.Offense
+}
+
+func newOffenseRecordingEvents() *offenseRecordingEvents {
+	return &offenseRecordingEvents{offenses: make(map[core.PeerID][]connstate.Offense)}
+}
+
+func (e *offenseRecordingEvents) PeerMisbehaved(peerID core.PeerID, o connstate.Offense) {
+	e.offenses[peerID] = append(e.offenses[peerID], o)
+}
+
+func TestDispatcherPenalizesInvalidPieces(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(1, 1)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	d := testDispatcher(Config{}, clock.NewMock(), torrent)
+	events := newOffenseRecordingEvents()
+	d.events = events
+
+	p, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true), newMockMessages())
+	require.NoError(err)
+
+	invalid := []byte{blob.Content[0] + 1}
+	require.NoError(d.dispatch(p, conn.NewPiecePayloadMessage(0, piecereader.NewBuffer(invalid))))
+
+	require.Equal([]connstate.Offense{connstate.OffenseInvalidPiece}, events.offenses[p.id])
+	require.False(torrent.Complete())
+}
+
+func TestDispatcherPenalizesSlowAndExpiredPieceRequests(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(2, 1)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	clk := clock.NewMock()
+
+	d := testDispatcher(Config{PipelineLimit: 1}, clk, torrent)
+	events := newOffenseRecordingEvents()
+	d.events = events
+
+	slow, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true, false), newMockMessages())
+	require.NoError(err)
+	_, err = d.maybeRequestMorePieces(slow)
+	require.NoError(err)
+
+	unresponsive, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(false, true), newMockMessages())
+	require.NoError(err)
+	_, err = d.maybeRequestMorePieces(unresponsive)
+	require.NoError(err)
+
+	clk.Add(d.pieceRequestTimeout * 3 / 4)
+
+	require.NoError(d.dispatch(
+		slow, conn.NewPiecePayloadMessage(0, piecereader.NewBuffer(blob.Content[0:1]))))
+
+	require.Equal([]connstate.Offense{connstate.OffenseSlowTransfer}, events.offenses[slow.id])
+
+	clk.Add(d.pieceRequestTimeout)
+
+	d.reportExpiredPieceRequests()
+	d.reportExpiredPieceRequests()
+
+	require.Equal([]connstate.Offense{connstate.OffenseTimeout}, events.offenses[unresponsive.id])
+}
+
+func TestDispatcherRerequestsInvalidPiecesFromDifferentPeers(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(2, 1)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	d := testDispatcher(Config{}, clock.NewMock(), torrent)
+
+	p1, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true, true), newMockMessages())
+	require.NoError(err)
+	_, err = d.maybeRequestMorePieces(p1)
+	require.NoError(err)
+
+	p2, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true, true), newMockMessages())
+	require.NoError(err)
+
+	invalid := []byte{blob.Content[0] + 1}
+	require.NoError(d.dispatch(p1, conn.NewPiecePayloadMessage(0, piecereader.NewBuffer(invalid))))
+
+	// The corruption is reported to p1, and piece 0 is requested from p2.
+	require.Equal([]int{0}, corruptPieceReports(p1.messages))
+	require.Equal(map[int]int{0: 1}, numRequestsPerPiece(p2.messages))
+
+	// Piece 0 is never requested from p1 again.
+	require.Equal([]int{0}, d.pieceRequestManager.PendingPieces(p2.id))
+	d.pieceRequestManager.ClearPeer(p2.id)
+	_, err = d.maybeRequestMorePieces(p1)
+	require.NoError(err)
+	require.Equal(1, numRequestsPerPiece(p1.messages)[0])
+}
+
+type corruptTorrent struct {
+	storage.Torrent
+}
+
+func (t corruptTorrent) VerifyPiece(int) error { return storage.ErrInvalidPiece }
+
+type corruptRecordingEvents struct {
+	noopEvents
+	corrupt []core.InfoHash
+}
+
+func (e *corruptRecordingEvents) TorrentCorrupt(h core.InfoHash) {
+	e.corrupt = append(e.corrupt, h)
+}
+
+func TestDispatcherHandlePieceCorruptVerifiesLocalPiece(t *testing.T) {
+	tests := []struct {
+		description string
+		torrent     func(storage.Torrent) storage.Torrent
+		expected    int
+	}{
+		{"valid", func(t storage.Torrent) storage.Torrent { return t }, 0},
+		{"corrupt", func(t storage.Torrent) storage.Torrent { return corruptTorrent{t} }, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+
+			blob := core.SizedBlobFixture(1, 1)
+
+			torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+			defer cleanup()
+
+			require.NoError(torrent.WritePiece(piecereader.NewBuffer(blob.Content), 0))
+
+			d := testDispatcher(Config{}, clock.NewMock(), test.torrent(torrent))
+			events := &corruptRecordingEvents{}
+			d.events = events
+
+			p, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(false), newMockMessages())
+			require.NoError(err)
+
+			report := conn.NewErrorMessage(0, p2p.ErrorMessage_PIECE_CORRUPT, storage.ErrInvalidPiece)
+
+			// Repeated reports only verify the piece once.
+			require.NoError(d.dispatch(p, report))
+			require.NoError(d.dispatch(p, report))
+
+			require.Len(events.corrupt, test.expected)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dispatch
+
+import (
+	"sync"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/willf/bitset"
+)
+
+// integrityTracker records which peers sent pieces failing hash verification,
+// so corrupt pieces are re-requested from different peers, and which pieces
+// were verified after remote peers reported receiving corrupt copies of them.
+type integrityTracker struct {
+	numPieces int
+
+	mu       sync.Mutex                     // Protects the following fields:
+	failures map[int][]core.PeerID          // Peers which sent corrupt copies of each piece.
+	corrupt  map[core.PeerID]*bitset.BitSet // Pieces each peer sent corrupt copies of.
+	verified *bitset.BitSet
+}
+
+func newIntegrityTracker(numPieces int) *integrityTracker {
+	return &integrityTracker{
+		numPieces: numPieces,
+		failures:  make(map[int][]core.PeerID),
+		corrupt:   make(map[core.PeerID]*bitset.BitSet),
+		verified:  bitset.New(uint(numPieces)),
+	}
+}
+
+// recordFailure records that peerID sent a corrupt copy of piece i. Returns all
+// peers which sent corrupt copies of piece i so far.
+func (t *integrityTracker) recordFailure(peerID core.PeerID, i int) []core.PeerID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.corrupt[peerID]
+	if !ok {
+		b = bitset.New(uint(t.numPieces))
+		t.corrupt[peerID] = b
+	}
+	if !b.Test(uint(i)) {
+		b.Set(uint(i))
+		t.failures[i] = append(t.failures[i], peerID)
+	}
+	return append([]core.PeerID(nil), t.failures[i]...)
+}
+
+// sentCorrupt returns whether peerID sent a corrupt copy of piece i.
+func (t *integrityTracker) sentCorrupt(peerID core.PeerID, i int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.corrupt[peerID]
+	return ok && b.Test(uint(i))
+}
+
+// excludeCorrupt returns the pieces of candidates which peerID did not send
+// corrupt copies of.
+func (t *integrityTracker) excludeCorrupt(peerID core.PeerID, candidates *bitset.BitSet) *bitset.BitSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.corrupt[peerID]
+	if !ok {
+		return candidates
+	}
+	return candidates.Difference(b)
+}
+
+// removePeer forgets which pieces peerID sent corrupt copies of, so the pieces
+// may be requested from peerID again if it reconnects, e.g. after repairing its
+// torrent.
+func (t *integrityTracker) removePeer(peerID core.PeerID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.corrupt, peerID)
+}
+
+// startVerify returns true if the caller should verify local piece i, i.e. if
+// piece i was not verified yet. Bounds the disk reads remote peers may cause
+// by reporting corrupt pieces.
+func (t *integrityTracker) startVerify(i int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.verified.Test(uint(i)) {
+		return false
+	}
+	t.verified.Set(uint(i))
+	return true
+}
@@ -50,6 +50,9 @@ type Request struct {
 	Status Status
 
 	sentAt time.Time
+
+	// Whether the request was returned by GetNewlyExpiredRequests.
+	expiryReported bool
 }
 
 // Manager encapsulates thread-safe piece request bookkeeping. It is not responsible
@@ -66,6 +69,10 @@ type Manager struct {
 
 	policy        pieceSelectionPolicy
 	pipelineLimit int
+
+	// priority holds pieces which are requested in order before any pieces
+	// selected by policy.
+	priority *bitset.BitSet
 }
 
 // NewManager creates a new Manager.
@@ -81,6 +88,7 @@ func NewManager(
 		clock:          clk,
 		timeout:        timeout,
 		pipelineLimit:  pipelineLimit,
+		priority:       bitset.New(0),
 	}
 
 	switch policy {
@@ -88,6 +96,8 @@ func NewManager(
 		m.policy = newDefaultPolicy()
 	case RarestFirstPolicy:
 		m.policy = newRarestFirstPolicy()
+	case SequentialPolicy:
+		m.policy = newSequentialPolicy()
 	default:
 		return nil, fmt.Errorf("invalid piece selection policy: %s", policy)
 	}
@@ -113,10 +123,21 @@ func (m *Manager) ReservePieces(
 	}
 
 	valid := func(pieceIdx int) bool { return m.validRequest(peerID, pieceIdx, allowDuplicates) }
-	pieces, err := m.policy.selectPieces(quota, valid, pieceCandidates, numPeersByPiece)
+
+	// Prioritized pieces are selected first, in order.
+	pieces, err := newSequentialPolicy().selectPieces(
+		quota, valid, pieceCandidates.Intersection(m.priority), numPeersByPiece)
 	if err != nil {
 		return nil, err
 	}
+	if len(pieces) < quota {
+		rest, err := m.policy.selectPieces(
+			quota-len(pieces), valid, pieceCandidates.Difference(m.priority), numPeersByPiece)
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, rest...)
+	}
 
 	// Set as pending in requests map.
 	for _, i := range pieces {
@@ -146,6 +167,17 @@ func (m *Manager) MarkInvalid(peerID core.PeerID, i int) {
 	m.markStatus(peerID, i, StatusInvalid)
 }
 
+// Prioritize requests pieces [start, end) before any other pieces, in order.
+// Prioritized pieces are no longer prioritized once cleared.
+func (m *Manager) Prioritize(start, end int) {
+	m.Lock()
+	defer m.Unlock()
+
+	for i := start; i < end; i++ {
+		m.priority.Set(uint(i))
+	}
+}
+
 // Clear deletes the piece request for piece i. Should be used for freeing up
 // unneeded request bookkeeping.
 func (m *Manager) Clear(i int) {
@@ -153,6 +185,7 @@ func (m *Manager) Clear(i int) {
 	defer m.Unlock()
 
 	delete(m.requests, i)
+	m.priority.Clear(uint(i))
 
 	for peerID, pm := range m.requestsByPeer {
 		delete(pm, i)
@@ -178,6 +211,21 @@ func (m *Manager) PendingPieces(peerID core.PeerID) []int {
 	return pieces
 }
 
+// PendingPeers returns the peers with pending requests for piece i, including
+// expired requests, which may still be answered.
+func (m *Manager) PendingPeers(i int) []core.PeerID {
+	m.RLock()
+	defer m.RUnlock()
+
+	var peers []core.PeerID
+	for _, r := range m.requests[i] {
+		if r.Status == StatusPending {
+			peers = append(peers, r.PeerID)
+		}
+	}
+	return peers
+}
+
 // ClearPeer deletes all piece requests for peerID.
 func (m *Manager) ClearPeer(peerID core.PeerID) {
 	m.Lock()
@@ -221,6 +269,50 @@ func (m *Manager) GetFailedRequests() []Request {
 	return failed
 }
 
+// GetNewlyExpiredRequests returns a copy of all pending requests which expired
+// since the last call, such that each expired request is only returned once.
+func (m *Manager) GetNewlyExpiredRequests() []Request {
+	m.Lock()
+	defer m.Unlock()
+
+	var expired []Request
+	for _, rs := range m.requests {
+		for _, r := range rs {
+			if r.Status == StatusPending && m.expired(r) && !r.expiryReported {
+				r.expiryReported = true
+				expired = append(expired, Request{
+					Piece:  r.Piece,
+					PeerID: r.PeerID,
+					Status: StatusExpired,
+				})
+			}
+		}
+	}
+	return expired
+}
+
+// RequestAge returns the duration since piece i was requested from peerID.
+// Returns false if piece i was not requested from peerID.
+func (m *Manager) RequestAge(peerID core.PeerID, i int) (time.Duration, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	r, ok := m.requestsByPeer[peerID][i]
+	if !ok {
+		return 0, false
+	}
+	return m.clock.Now().Sub(r.sentAt), true
+}
+
+// SetPipelineLimit replaces the limit of pending requests per peer. Requests
+// which are already pending are unaffected.
+func (m *Manager) SetPipelineLimit(n int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.pipelineLimit = n
+}
+
 func (m *Manager) validRequest(peerID core.PeerID, pieceIdx int, allowDuplicates bool) bool {
 	for _, r := range m.requests[pieceIdx] {
 		if r.Status == StatusPending && !m.expired(r) {
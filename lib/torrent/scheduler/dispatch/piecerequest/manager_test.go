@@ -62,6 +62,27 @@ func TestManagerPipelineLimit(t *testing.T) {
 	require.Len(m.PendingPieces(peerID), 3)
 }
 
+func TestManagerSetPipelineLimit(t *testing.T) {
+	require := require.New(t)
+
+	m := newManager(clock.NewMock(), 5*time.Second, DefaultPolicy, 1)
+
+	peerID := core.PeerIDFixture()
+	candidates := bitsetutil.FromBools(true, true, true, true)
+
+	pieces, err := m.ReservePieces(peerID, candidates, countsFromInts(0, 0, 0, 0), false)
+	require.NoError(err)
+	require.Len(pieces, 1)
+
+	m.SetPipelineLimit(3)
+
+	pieces, err = m.ReservePieces(peerID, candidates, countsFromInts(0, 0, 0, 0), false)
+	require.NoError(err)
+	require.Len(pieces, 2)
+
+	require.Len(m.PendingPieces(peerID), 3)
+}
+
 func TestManagerReserveExpiredRequest(t *testing.T) {
 	require := require.New(t)
 
@@ -203,6 +224,69 @@ func TestManagerGetFailedRequests(t *testing.T) {
 	require.Contains(failed, Request{Piece: 2, PeerID: p2, Status: StatusExpired})
 }
 
+func TestManagerGetNewlyExpiredRequests(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	timeout := 5 * time.Second
+
+	m := newManager(clk, timeout, DefaultPolicy, 1)
+
+	p0 := core.PeerIDFixture()
+	p1 := core.PeerIDFixture()
+
+	pieces, err := m.ReservePieces(p0, bitsetutil.FromBools(true, false),
+		countsFromInts(0, 0), false)
+	require.NoError(err)
+	require.Equal([]int{0}, pieces)
+
+	require.Empty(m.GetNewlyExpiredRequests())
+
+	clk.Add(timeout + 1) // Expires p0's request.
+
+	pieces, err = m.ReservePieces(p1, bitsetutil.FromBools(false, true),
+		countsFromInts(0, 0), false)
+	require.NoError(err)
+	require.Equal([]int{1}, pieces)
+
+	require.Equal(
+		[]Request{{Piece: 0, PeerID: p0, Status: StatusExpired}},
+		m.GetNewlyExpiredRequests())
+
+	// Expired requests are only returned once.
+	require.Empty(m.GetNewlyExpiredRequests())
+
+	clk.Add(timeout + 1) // Expires p1's request.
+
+	require.Equal(
+		[]Request{{Piece: 1, PeerID: p1, Status: StatusExpired}},
+		m.GetNewlyExpiredRequests())
+}
+
+func TestManagerRequestAge(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+
+	m := newManager(clk, 5*time.Second, DefaultPolicy, 1)
+
+	peerID := core.PeerIDFixture()
+
+	_, ok := m.RequestAge(peerID, 0)
+	require.False(ok)
+
+	pieces, err := m.ReservePieces(peerID, bitsetutil.FromBools(true),
+		countsFromInts(0), false)
+	require.NoError(err)
+	require.Equal([]int{0}, pieces)
+
+	clk.Add(time.Second)
+
+	age, ok := m.RequestAge(peerID, 0)
+	require.True(ok)
+	require.Equal(time.Second, age)
+}
+
 func TestManagerClear(t *testing.T) {
 	require := require.New(t)
 
@@ -277,6 +361,29 @@ func TestManagerReservePiecesAllowDuplicate(t *testing.T) {
 	require.Equal([]int{0}, pieces)
 }
 
+func TestManagerPendingPeers(t *testing.T) {
+	require := require.New(t)
+
+	m := newManager(clock.NewMock(), 5*time.Second, DefaultPolicy, 2)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	for _, p := range []core.PeerID{p1, p2} {
+		pieces, err := m.ReservePieces(p, bitsetutil.FromBools(true),
+			countsFromInts(0), true)
+		require.NoError(err)
+		require.Equal([]int{0}, pieces)
+	}
+	require.ElementsMatch([]core.PeerID{p1, p2}, m.PendingPeers(0))
+
+	m.MarkInvalid(p1, 0)
+	require.Equal([]core.PeerID{p2}, m.PendingPeers(0))
+
+	m.Clear(0)
+	require.Empty(m.PendingPeers(0))
+}
+
 func TestManagerClearWhenAllowedDuplicates(t *testing.T) {
 	require := require.New(t)
 
@@ -406,3 +513,47 @@ func TestRarestFirstPolicy(t *testing.T) {
 	require.NoError(err)
 	require.Empty(pieces)
 }
+
+func TestSequentialPolicy(t *testing.T) {
+	require := require.New(t)
+
+	m := newManager(clock.NewMock(), 5*time.Second, SequentialPolicy, 2)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	pieces, err := m.ReservePieces(p1, bitsetutil.FromBools(false, true, true, true),
+		countsFromInts(0, 0, 0, 0), false)
+	require.NoError(err)
+	require.Equal([]int{1, 2}, pieces)
+
+	pieces, err = m.ReservePieces(p2, bitsetutil.FromBools(true, true, true, true),
+		countsFromInts(0, 0, 0, 0), false)
+	require.NoError(err)
+	require.Equal([]int{0, 3}, pieces)
+}
+
+func TestManagerPrioritize(t *testing.T) {
+	require := require.New(t)
+
+	m := newManager(clock.NewMock(), 5*time.Second, RarestFirstPolicy, 3)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	m.Prioritize(2, 4)
+
+	// Prioritized pieces are selected in order before the rarest piece.
+	pieces, err := m.ReservePieces(p1, bitsetutil.FromBools(true, true, true, true, true),
+		countsFromInts(1, 2, 3, 3, 4), false)
+	require.NoError(err)
+	require.Equal([]int{2, 3, 0}, pieces)
+
+	// Cleared pieces are no longer prioritized.
+	m.Clear(2)
+	m.ClearPeer(p1)
+	pieces, err = m.ReservePieces(p2, bitsetutil.FromBools(true, true, true, true, true),
+		countsFromInts(1, 2, 3, 3, 4), false)
+	require.NoError(err)
+	require.Equal([]int{3, 0, 1}, pieces)
+}
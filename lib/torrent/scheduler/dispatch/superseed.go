@@ -0,0 +1,175 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dispatch
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/syncutil"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// superseeder decides which pieces of a complete torrent to advertise to each
+// peer. Instead of advertising all pieces, each peer is offered a few pieces
+// which are not yet well replicated in the swarm. A new piece is offered to a
+// peer once a piece offered to it is announced by any peer, which confirms
+// that the piece made it into the swarm, or once the offer times out.
+type superseeder struct {
+	clk     clock.Clock
+	timeout time.Duration
+	limit   int
+
+	mu       sync.Mutex // Protects the following fields:
+	offers   map[core.PeerID]map[int]time.Time
+	numGiven []int // Number of times each piece was offered.
+	watching bool  // Whether watchOffers is running.
+}
+
+func newSuperseeder(clk clock.Clock, timeout time.Duration, limit, numPieces int) *superseeder {
+	return &superseeder{
+		clk:      clk,
+		timeout:  timeout,
+		limit:    limit,
+		offers:   make(map[core.PeerID]map[int]time.Time),
+		numGiven: make([]int, numPieces),
+	}
+}
+
+// offer returns new pieces to advertise to peerID, up to the offer limit.
+// Pieces with the least peers which have them are offered first.
+func (s *superseeder) offer(
+	peerID core.PeerID, has func(int) bool, numPeersByPiece syncutil.Counters) []int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offered, ok := s.offers[peerID]
+	if !ok {
+		offered = make(map[int]time.Time)
+		s.offers[peerID] = offered
+	}
+	n := s.limit - len(offered)
+	if n <= 0 {
+		return nil
+	}
+	var candidates []int
+	for i := range s.numGiven {
+		if _, ok := offered[i]; ok || has(i) {
+			continue
+		}
+		candidates = append(candidates, i)
+	}
+	replication := func(i int) int {
+		return numPeersByPiece.Get(i) + s.numGiven[i]
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return replication(candidates[a]) < replication(candidates[b])
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	now := s.clk.Now()
+	for _, i := range candidates {
+		offered[i] = now
+		s.numGiven[i]++
+	}
+	return candidates
+}
+
+// confirm resolves the offers of piece i, since some peer announced it. Returns
+// the peers which are due new offers.
+func (s *superseeder) confirm(i int) []core.PeerID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var peers []core.PeerID
+	for peerID, offered := range s.offers {
+		if _, ok := offered[i]; ok {
+			delete(offered, i)
+			peers = append(peers, peerID)
+		}
+	}
+	return peers
+}
+
+// expire resolves offers older than the offer timeout, so peers which cannot
+// share pieces with the rest of the swarm are not starved. Returns the peers
+// which are due new offers.
+func (s *superseeder) expire() []core.PeerID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var peers []core.PeerID
+	for peerID, offered := range s.offers {
+		var expired bool
+		for i, t := range offered {
+			if s.clk.Now().Sub(t) >= s.timeout {
+				delete(offered, i)
+				expired = true
+			}
+		}
+		if expired {
+			peers = append(peers, peerID)
+		}
+	}
+	return peers
+}
+
+// pending returns whether any offers are unresolved.
+func (s *superseeder) pending() bool {
+	for _, offered := range s.offers {
+		if len(offered) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// startWatching returns true if the caller should start watching offers for
+// expiry, i.e. if there are unresolved offers and nobody is watching them.
+func (s *superseeder) startWatching() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watching || !s.pending() {
+		return false
+	}
+	s.watching = true
+	return true
+}
+
+// stopWatching returns true if the caller should stop watching offers, i.e. if
+// all offers are resolved.
+func (s *superseeder) stopWatching() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending() {
+		return false
+	}
+	s.watching = false
+	return true
+}
+
+// removePeer drops the offers of peerID.
+func (s *superseeder) removePeer(peerID core.PeerID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.offers, peerID)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/syncutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuperseederOffersLeastReplicatedPieces(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := newSuperseeder(clk, time.Minute, 2, 4)
+
+	numPeersByPiece := syncutil.NewCounters(4)
+	numPeersByPiece.Set(0, 3)
+
+	hasNone := func(int) bool { return false }
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	require.Equal([]int{1, 2}, s.offer(p1, hasNone, numPeersByPiece))
+
+	// Offers are limited per peer.
+	require.Empty(s.offer(p1, hasNone, numPeersByPiece))
+
+	// Pieces already offered to other peers are less preferred.
+	require.Equal([]int{3, 1}, s.offer(p2, hasNone, numPeersByPiece))
+
+	// Pieces which the peer has are never offered.
+	p3 := core.PeerIDFixture()
+	require.Equal([]int{0}, s.offer(p3, func(i int) bool { return i != 0 }, numPeersByPiece))
+
+	require.ElementsMatch([]core.PeerID{p1, p2}, s.confirm(1))
+	require.Empty(s.confirm(1))
+}
+
+func TestSuperseederExpiresOffers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := newSuperseeder(clk, time.Minute, 1, 4)
+
+	numPeersByPiece := syncutil.NewCounters(4)
+	hasNone := func(int) bool { return false }
+
+	p := core.PeerIDFixture()
+
+	require.Equal([]int{0}, s.offer(p, hasNone, numPeersByPiece))
+	require.True(s.startWatching())
+	require.False(s.startWatching())
+
+	require.Empty(s.expire())
+	require.False(s.stopWatching())
+
+	clk.Add(time.Minute)
+
+	require.Equal([]core.PeerID{p}, s.expire())
+	require.True(s.stopWatching())
+
+	s.offer(p, hasNone, numPeersByPiece)
+	s.removePeer(p)
+	require.False(s.startWatching())
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dispatch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/lib/torrent/storage/piecereader"
+)
+
+// webSeedPieces tracks the pieces being fetched from a web seed.
+type webSeedPieces struct {
+	mu     sync.Mutex
+	pieces map[int]bool
+}
+
+func newWebSeedPieces() *webSeedPieces {
+	return &webSeedPieces{pieces: make(map[int]bool)}
+}
+
+// ReserveWebSeedPieces reserves missing pieces to fetch from a web seed, such
+// that at most n pieces are being fetched at once. Pieces which the least peers
+// have are reserved first, so the web seed fills the gaps of the swarm.
+func (d *Dispatcher) ReserveWebSeedPieces(n int) []int {
+	d.webSeed.mu.Lock()
+	defer d.webSeed.mu.Unlock()
+
+	n -= len(d.webSeed.pieces)
+	if n <= 0 {
+		return nil
+	}
+	var candidates []int
+	for _, i := range d.torrent.MissingPieces() {
+		if !d.webSeed.pieces[i] {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return d.numPeersByPiece.Get(candidates[a]) < d.numPeersByPiece.Get(candidates[b])
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	for _, i := range candidates {
+		d.webSeed.pieces[i] = true
+	}
+	return candidates
+}
+
+// WriteWebSeedPiece fetches piece i, which must be reserved, and writes it to
+// the torrent. fetch must write the byte range of piece i within the blob to
+// dst. Pieces fetched from a web seed are announced to peers like pieces
+// received from peers. Releases the reservation of piece i.
+func (d *Dispatcher) WriteWebSeedPiece(
+	i int, fetch func(offset, length int64, dst io.Writer) error) error {
+
+	defer func() {
+		d.webSeed.mu.Lock()
+		delete(d.webSeed.pieces, i)
+		d.webSeed.mu.Unlock()
+	}()
+
+	var b bytes.Buffer
+	if err := fetch(d.torrent.MaxPieceLength()*int64(i), d.torrent.PieceLength(i), &b); err != nil {
+		return fmt.Errorf("fetch: %s", err)
+	}
+	if err := d.torrent.WritePiece(piecereader.NewBuffer(b.Bytes()), i); err != nil {
+		if err == storage.ErrPieceComplete {
+			// Received from a peer in the meantime.
+			return nil
+		}
+		return fmt.Errorf("write piece: %s", err)
+	}
+	d.stats.Counter("web_seed_pieces").Inc(1)
+
+	d.pieceWritten(core.PeerID{}, i)
+
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler/adaptive"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
@@ -116,6 +117,20 @@ func (l *liftedEventLoop) PeerRemoved(peerID core.PeerID, h core.InfoHash) {
 	l.send(peerRemovedEvent{peerID, h})
 }
 
+func (l *liftedEventLoop) PexReceived(
+	peerID core.PeerID, h core.InfoHash, peers []*core.PeerInfo) {
+
+	l.send(pexEvent{peerID, h, peers})
+}
+
+func (l *liftedEventLoop) PeerMisbehaved(peerID core.PeerID, o connstate.Offense) {
+	l.send(peerMisbehavedEvent{peerID, o})
+}
+
+func (l *liftedEventLoop) TorrentCorrupt(h core.InfoHash) {
+	l.send(torrentCorruptEvent{h})
+}
+
 func (l *liftedEventLoop) AnnounceTick() {
 	l.send(announceTickEvent{})
 }
@@ -143,6 +158,14 @@ type incomingHandshakeEvent struct {
 // to the scheduler's pending connections and asynchronously attempts to establish
 // the connection.
 func (e incomingHandshakeEvent) apply(s *state) {
+	if s.conns.Banned(e.pc.PeerID()) {
+		s.log("peer", e.pc.PeerID(), "hash", e.pc.InfoHash()).Info(
+			"Rejecting incoming handshake from banned peer")
+		s.sched.torrentlog.IncomingConnectionReject(
+			e.pc.Digest(), e.pc.InfoHash(), e.pc.PeerID(), connstate.ErrPeerBanned)
+		e.pc.Close()
+		return
+	}
 	peerNeighbors := make([]core.PeerID, len(e.pc.RemoteBitfields()))
 	var i int
 	for peerID := range e.pc.RemoteBitfields() {
@@ -211,15 +234,20 @@ type outgoingConnEvent struct {
 	c        *conn.Conn
 	bitfield *bitset.BitSet
 	info     *storage.TorrentInfo
+	peer     *core.PeerInfo
 }
 
 // apply transitions a fully-handshaked outgoing conn from pending to active.
+// The peer of the conn may then be gossiped via PEX.
 func (e outgoingConnEvent) apply(s *state) {
 	if err := s.addOutgoingConn(e.c, e.bitfield, e.info); err != nil {
 		s.log("conn", e.c).Errorf("Error adding outgoing conn: %s", err)
 		e.c.Close()
 		return
 	}
+	if ctrl, ok := s.torrentControls[e.info.InfoHash()]; ok && e.peer != nil {
+		ctrl.pexPeers[e.peer.PeerID] = e.peer
+	}
 	s.log("conn", e.c).Infof("Added outgoing conn with %d%% downloaded", e.info.PercentDownloaded())
 }
 
@@ -247,7 +275,7 @@ func (e announceTickEvent) apply(s *state) {
 			continue
 		}
 		go s.sched.announce(
-			ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+			ctrl.namespace, ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
 		break
 	}
 	// Re-enqueue any torrents we pulled off and ignored, else we would never
@@ -265,8 +293,7 @@ type announceResultEvent struct {
 }
 
 // apply selects new peers returned via an announce response to open connections to
-// if there is capacity. These connections are added to the scheduler's pending
-// connections and handshaked asynchronously.
+// if there is capacity.
 //
 // Also marks the dispatcher as ready to announce again.
 func (e announceResultEvent) apply(s *state) {
@@ -280,23 +307,7 @@ func (e announceResultEvent) apply(s *state) {
 		// Torrent is already complete, don't open any new connections.
 		return
 	}
-	for _, p := range e.peers {
-		if p.PeerID == s.sched.pctx.PeerID {
-			// Tracker may return our own peer.
-			continue
-		}
-		if s.conns.Blacklisted(p.PeerID, e.infoHash) {
-			continue
-		}
-		if err := s.conns.AddPending(p.PeerID, e.infoHash, nil); err != nil {
-			if err == connstate.ErrTorrentAtCapacity {
-				break
-			}
-			continue
-		}
-		go s.sched.initializeOutgoingHandshake(
-			p, ctrl.dispatcher.Stat(), ctrl.dispatcher.RemoteBitfields(), ctrl.namespace)
-	}
+	s.addPendingPeers(ctrl, e.peers)
 }
 
 // announceErrEvent occurs when an announce request fails.
@@ -337,7 +348,61 @@ func (e newTorrentEvent) apply(s *state) {
 	ctrl.errors = append(ctrl.errors, e.errc)
 
 	// Immediately announce new torrents.
-	go s.sched.announce(ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+	go s.sched.announce(
+		ctrl.namespace, ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+}
+
+// resumeTorrentEvent occurs when a torrent which was active before the
+// scheduler restarted is resumed.
+type resumeTorrentEvent struct {
+	namespace string
+	torrent   storage.Torrent
+}
+
+// apply begins seeding / leeching a resumed torrent.
+func (e resumeTorrentEvent) apply(s *state) {
+	if _, ok := s.torrentControls[e.torrent.InfoHash()]; ok {
+		return
+	}
+	ctrl, err := s.addTorrent(e.namespace, e.torrent, false)
+	if err != nil {
+		s.log("torrent", e.torrent).Errorf("Error resuming torrent: %s", err)
+		return
+	}
+	s.log("torrent", e.torrent).Info("Resumed torrent")
+	if !ctrl.dispatcher.Complete() {
+		go s.sched.announce(
+			ctrl.namespace, ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+	}
+}
+
+// seedTorrentEvent occurs when a complete blob is registered for seeding.
+type seedTorrentEvent struct {
+	namespace string
+	torrent   storage.Torrent
+	errc      chan error
+}
+
+// apply begins seeding a complete torrent and announces it, so peers can
+// discover the torrent without waiting for its turn in the announce queue.
+func (e seedTorrentEvent) apply(s *state) {
+	ctrl, ok := s.torrentControls[e.torrent.InfoHash()]
+	if !ok {
+		var err error
+		ctrl, err = s.addTorrent(e.namespace, e.torrent, false)
+		if err != nil {
+			e.errc <- err
+			return
+		}
+		s.log("torrent", e.torrent).Info("Added torrent for seeding")
+	}
+	if !ctrl.dispatcher.Complete() {
+		e.errc <- ErrTorrentIncomplete
+		return
+	}
+	e.errc <- nil
+
+	go s.sched.announce(ctrl.namespace, ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), true)
 }
 
 // dispatcherCompleteEvent occurs when a dispatcher finishes downloading its torrent.
@@ -374,17 +439,246 @@ func (e dispatcherCompleteEvent) apply(s *state) {
 	s.sched.netevents.Produce(networkevent.TorrentCompleteEvent(infoHash, s.sched.pctx.PeerID))
 
 	// Immediately announce completed torrents.
-	go s.sched.announce(ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), true)
+	go s.sched.announce(ctrl.namespace, ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), true)
 }
 
 // peerRemovedEvent occurs when a dispatcher removes a peer with a closed
-// connection. Currently is a no-op.
+// connection.
 type peerRemovedEvent struct {
 	peerID   core.PeerID
 	infoHash core.InfoHash
 }
 
-func (e peerRemovedEvent) apply(s *state) {}
+// apply stops gossiping the removed peer.
+func (e peerRemovedEvent) apply(s *state) {
+	ctrl, ok := s.torrentControls[e.infoHash]
+	if !ok {
+		return
+	}
+	delete(ctrl.pexPeers, e.peerID)
+	delete(ctrl.pexReceived, e.peerID)
+}
+
+// pexEvent occurs when a connected peer gossips peers via PEX.
+type pexEvent struct {
+	peerID   core.PeerID
+	infoHash core.InfoHash
+	peers    []*core.PeerInfo
+}
+
+// apply opens connections to the gossiped peers if there is capacity, like
+// peers returned via an announce response. PEX messages are dropped if PEX is
+// disabled or if the peer gossips more often than allowed.
+func (e pexEvent) apply(s *state) {
+	config := s.sched.config.PEX
+	if !config.Enabled {
+		return
+	}
+	ctrl, ok := s.torrentControls[e.infoHash]
+	if !ok {
+		return
+	}
+	now := s.sched.clock.Now()
+	if last, ok := ctrl.pexReceived[e.peerID]; ok && now.Sub(last) < config.Interval/2 {
+		s.sched.stats.Counter("pex_messages_dropped").Inc(1)
+		return
+	}
+	ctrl.pexReceived[e.peerID] = now
+	s.sched.stats.Counter("pex_messages_received").Inc(1)
+	if ctrl.dispatcher.Complete() {
+		// Torrent is already complete, don't open any new connections.
+		return
+	}
+	peers := e.peers
+	if len(peers) > config.MaxPeers {
+		peers = peers[:config.MaxPeers]
+	}
+	s.addPendingPeers(ctrl, peers)
+}
+
+// peerMisbehavedEvent occurs when a dispatcher observes a peer misbehaving.
+type peerMisbehavedEvent struct {
+	peerID  core.PeerID
+	offense connstate.Offense
+}
+
+// apply penalizes the peer, and closes all conns to the peer if it is banned
+// as a result.
+func (e peerMisbehavedEvent) apply(s *state) {
+	s.sched.stats.Tagged(map[string]string{
+		"offense": e.offense.String(),
+	}).Counter("peer_offenses").Inc(1)
+
+	s.conns.Penalize(e.peerID, e.offense)
+	if !s.conns.Banned(e.peerID) {
+		return
+	}
+	for _, c := range s.conns.ActiveConns() {
+		if c.PeerID() == e.peerID {
+			s.log("conn", c).Info("Closing conn to banned peer")
+			c.Close()
+		}
+	}
+}
+
+// torrentCorruptEvent occurs when a dispatcher finds that a local piece of its
+// torrent is corrupt.
+type torrentCorruptEvent struct {
+	infoHash core.InfoHash
+}
+
+// apply removes the corrupt torrent and deletes it from disk, then stats the
+// torrent in the background. On origins, stat-ing a deleted torrent re-fetches
+// the blob from the storage backend.
+func (e torrentCorruptEvent) apply(s *state) {
+	ctrl, ok := s.torrentControls[e.infoHash]
+	if !ok {
+		return
+	}
+	namespace := ctrl.namespace
+	d := ctrl.dispatcher.Digest()
+
+	s.log("hash", e.infoHash).Error("Removing corrupt torrent")
+	s.sched.stats.Counter("corrupt_torrents").Inc(1)
+
+	if ctrl.dispatcher.Complete() {
+		// Incomplete torrents are torn down and deleted by removeTorrent.
+		ctrl.dispatcher.TearDown()
+		if err := s.sched.torrentArchive.DeleteTorrent(d); err != nil {
+			s.log("hash", e.infoHash).Errorf("Error deleting corrupt torrent: %s", err)
+		}
+	}
+	s.removeTorrent(e.infoHash, ErrTorrentCorrupt)
+
+	go func() {
+		if _, err := s.sched.torrentArchive.Stat(namespace, d); err != nil {
+			s.sched.log("namespace", namespace, "name", d.Hex()).Infof(
+				"Stat of corrupt torrent after deletion: %s", err)
+		}
+	}()
+}
+
+// webSeedTickEvent occurs periodically to fetch pieces from the web seed.
+type webSeedTickEvent struct{}
+
+// apply fetches missing pieces from the web seed for downloading torrents which
+// have no peers, or whose download rate since the last tick is below the
+// minimum throughput.
+func (e webSeedTickEvent) apply(s *state) {
+	config := s.sched.config.WebSeed
+	if !config.Enabled || s.sched.webSeed == nil {
+		return
+	}
+	now := s.sched.clock.Now()
+	for h, ctrl := range s.torrentControls {
+		if ctrl.dispatcher.Complete() {
+			continue
+		}
+		downloaded := ctrl.dispatcher.BytesDownloaded()
+		elapsed := now.Sub(ctrl.webSeedCheckedAt)
+		rate := float64(downloaded-ctrl.webSeedBytes) / elapsed.Seconds()
+		first := ctrl.webSeedCheckedAt.IsZero()
+		ctrl.webSeedBytes = downloaded
+		ctrl.webSeedCheckedAt = now
+
+		if first || elapsed <= 0 || now.Sub(ctrl.dispatcher.CreatedAt()) < config.Interval {
+			// Give the swarm a chance to serve new torrents.
+			continue
+		}
+		if !ctrl.dispatcher.Empty() && rate >= float64(config.MinThroughput) {
+			continue
+		}
+		pieces := ctrl.dispatcher.ReserveWebSeedPieces(config.MaxPieces)
+		if len(pieces) == 0 {
+			continue
+		}
+		s.log("hash", h, "rate", rate).Debugf("Fetching %d pieces from web seed", len(pieces))
+		for _, i := range pieces {
+			go s.sched.fetchWebSeedPiece(ctrl.namespace, ctrl.dispatcher, i)
+		}
+	}
+}
+
+// adaptiveTickEvent occurs periodically to adjust conn limits and pipeline depth
+// to the network.
+type adaptiveTickEvent struct{}
+
+// apply samples the traffic and piece request latency of all torrents, and
+// applies the limits of the adaptive controller. Lowered limits do not close
+// existing conns or cancel pending requests, they only take effect as conns
+// close and requests complete.
+func (e adaptiveTickEvent) apply(s *state) {
+	if s.sched.adaptive == nil {
+		return
+	}
+	var latency time.Duration
+	var n int
+	var busy bool
+	for _, ctrl := range s.torrentControls {
+		l, k := ctrl.dispatcher.TakePieceLatency()
+		latency += l
+		n += k
+		if !ctrl.dispatcher.Complete() || !ctrl.dispatcher.Empty() {
+			busy = true
+		}
+	}
+	egress, ingress := s.sched.handshaker.Traffic()
+	perTorrent, _ := s.conns.Limits()
+	sample := adaptive.Sample{
+		EgressBytes:     egress,
+		IngressBytes:    ingress,
+		ConnsPerTorrent: perTorrent,
+		Busy:            busy,
+	}
+	if n > 0 {
+		sample.Latency = latency / time.Duration(n)
+	}
+	limits := s.sched.adaptive.Update(sample)
+
+	s.conns.SetLimits(limits.ConnsPerTorrent, limits.GlobalConns)
+	if limits.PipelineLimit != s.pipelineLimit {
+		s.pipelineLimit = limits.PipelineLimit
+		for _, ctrl := range s.torrentControls {
+			ctrl.dispatcher.SetPipelineLimit(limits.PipelineLimit)
+		}
+	}
+
+	s.sched.stats.Gauge("network_utilization").Update(s.sched.adaptive.Utilization())
+	s.sched.stats.Gauge("adaptive_conns_per_torrent").Update(float64(limits.ConnsPerTorrent))
+	s.sched.stats.Gauge("adaptive_global_conns").Update(float64(limits.GlobalConns))
+	s.sched.stats.Gauge("adaptive_pipeline_limit").Update(float64(limits.PipelineLimit))
+}
+
+// pexTickEvent occurs periodically to gossip peers via PEX.
+type pexTickEvent struct{}
+
+// apply sends the peers of each torrent to every conn of the torrent, excluding
+// the remote peer of the conn itself.
+func (e pexTickEvent) apply(s *state) {
+	for _, c := range s.conns.ActiveConns() {
+		ctrl, ok := s.torrentControls[c.InfoHash()]
+		if !ok {
+			continue
+		}
+		var peers []*core.PeerInfo
+		for peerID, p := range ctrl.pexPeers {
+			if len(peers) == s.sched.config.PEX.MaxPeers {
+				break
+			}
+			if peerID != c.PeerID() {
+				peers = append(peers, p)
+			}
+		}
+		if len(peers) == 0 {
+			continue
+		}
+		if err := c.Send(conn.NewPexMessage(peers)); err != nil {
+			s.log("conn", c).Infof("Error sending pex message: %s", err)
+			continue
+		}
+		s.sched.stats.Counter("pex_messages_sent").Inc(1)
+	}
+}
 
 // preemptionTickEvent occurs periodically to preempt unneeded conns and remove
 // idle torrentControls.
@@ -440,6 +734,15 @@ type emitStatsEvent struct{}
 
 func (e emitStatsEvent) apply(s *state) {
 	s.sched.stats.Gauge("torrents").Update(float64(len(s.torrentControls)))
+	s.sched.admission.emitStats()
+}
+
+type reputationSnapshotEvent struct {
+	result chan []connstate.PeerReputation
+}
+
+func (e reputationSnapshotEvent) apply(s *state) {
+	e.result <- s.conns.ReputationSnapshot()
 }
 
 type blacklistSnapshotEvent struct {
@@ -468,6 +771,25 @@ func (e removeTorrentEvent) apply(s *state) {
 	e.errc <- s.sched.torrentArchive.DeleteTorrent(e.digest)
 }
 
+// prioritizeRangeEvent occurs when a range of a torrent is prioritized via
+// scheduler API.
+type prioritizeRangeEvent struct {
+	digest core.Digest
+	offset int64
+	length int64
+	errc   chan error
+}
+
+func (e prioritizeRangeEvent) apply(s *state) {
+	for _, ctrl := range s.torrentControls {
+		if ctrl.dispatcher.Digest() == e.digest {
+			e.errc <- ctrl.dispatcher.PrioritizeRange(e.offset, e.length)
+			return
+		}
+	}
+	e.errc <- ErrTorrentNotFound
+}
+
 // probeEvent occurs when a probe is manually requested via scheduler API.
 // The event loop is unbuffered, so if a probe can be successfully sent, then
 // the event loop is healthy.
@@ -491,5 +813,8 @@ func (e shutdownEvent) apply(s *state) {
 			errc <- ErrSchedulerStopped
 		}
 	}
+	if err := s.conns.SaveReputation(); err != nil {
+		s.log().Errorf("Error saving peer reputation: %s", err)
+	}
 	s.sched.eventLoop.stop()
 }
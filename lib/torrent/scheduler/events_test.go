@@ -14,15 +14,20 @@
 package scheduler
 
 import (
+	"bytes"
+	"io"
 	"testing"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler/adaptive"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
@@ -101,7 +106,7 @@ func newStateMocks(t *testing.T) (*stateMocks, func()) {
 	return mocks, cleanup.Run
 }
 
-func (m *stateMocks) newState(config Config) *state {
+func (m *stateMocks) newState(config Config, options ...option) *state {
 	sched, err := newScheduler(
 		config,
 		m.torrentArchive,
@@ -109,7 +114,7 @@ func (m *stateMocks) newState(config Config) *state {
 		core.PeerContextFixture(),
 		m.announceClient,
 		networkevent.NewTestProducer(),
-		withEventLoop(m.eventLoop))
+		append([]option{withEventLoop(m.eventLoop)}, options...)...)
 	if err != nil {
 		panic(err)
 	}
@@ -148,10 +153,11 @@ func TestAnnounceTickEvent(t *testing.T) {
 	// First torrent should announce.
 	mocks.announceClient.EXPECT().
 		Announce(
+			_testNamespace,
 			ctrls[0].dispatcher.Digest(),
 			ctrls[0].dispatcher.InfoHash(),
 			false,
-			announceclient.V2).
+			announceclient.V3).
 		Return(nil, time.Second, nil)
 
 	announceTickEvent{}.apply(state)
@@ -193,10 +199,11 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 	// torrent.
 	mocks.announceClient.EXPECT().
 		Announce(
+			_testNamespace,
 			empty.dispatcher.Digest(),
 			empty.dispatcher.InfoHash(),
 			false,
-			announceclient.V2).
+			announceclient.V3).
 		Return(nil, time.Second, nil)
 
 	announceTickEvent{}.apply(state)
@@ -225,10 +232,11 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 
 	mocks.announceClient.EXPECT().
 		Announce(
+			_testNamespace,
 			full.dispatcher.Digest(),
 			full.dispatcher.InfoHash(),
 			false,
-			announceclient.V2).
+			announceclient.V3).
 		Return(nil, time.Second, nil)
 
 	announceTickEvent{}.apply(state)
@@ -238,3 +246,293 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 		infoHash: full.dispatcher.InfoHash(),
 	})
 }
+
+func TestPexEventLimitsGossipedPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		PEX: PEXConfig{
+			Enabled:  true,
+			MaxPeers: 1,
+		},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+
+	h := ctrl.dispatcher.InfoHash()
+	sender := core.PeerIDFixture()
+
+	// Unreachable peers, so handshakes fail immediately.
+	var peers []*core.PeerInfo
+	for i := 0; i < 3; i++ {
+		peers = append(peers, core.NewPeerInfo(core.PeerIDFixture(), "127.0.0.1", 1, false, false))
+	}
+
+	pexEvent{sender, h, peers[:2]}.apply(state)
+
+	// The second peer is beyond the limit of gossiped peers.
+	require.Equal(connstate.ErrConnAlreadyPending, state.conns.AddPending(peers[0].PeerID, h, nil))
+	require.NoError(state.conns.AddPending(peers[1].PeerID, h, nil))
+
+	// The sender gossips again too soon.
+	pexEvent{sender, h, peers[2:]}.apply(state)
+
+	require.NoError(state.conns.AddPending(peers[2].PeerID, h, nil))
+}
+
+func TestPexEventIgnoredWhenDisabled(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+
+	h := ctrl.dispatcher.InfoHash()
+	p := core.NewPeerInfo(core.PeerIDFixture(), "127.0.0.1", 1, false, false)
+
+	pexEvent{core.PeerIDFixture(), h, []*core.PeerInfo{p}}.apply(state)
+
+	require.NoError(state.conns.AddPending(p.PeerID, h, nil))
+}
+
+func TestPexTickEventGossipsPeersOfOutgoingConns(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		PEX: PEXConfig{
+			Enabled: true,
+		},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+
+	info := ctrl.dispatcher.Stat()
+
+	var remotes []*conn.Conn
+	var peers []*core.PeerInfo
+	for i := 0; i < 2; i++ {
+		remote, c, cleanup := conn.PipeFixture(conn.Config{}, info)
+		defer cleanup()
+
+		p := core.PeerInfoFixture()
+		p.PeerID = c.PeerID()
+
+		require.NoError(state.conns.AddPending(c.PeerID(), c.InfoHash(), nil))
+		outgoingConnEvent{c, info.Bitfield(), info, p}.apply(state)
+
+		remotes = append(remotes, remote)
+		peers = append(peers, p)
+	}
+
+	pexTickEvent{}.apply(state)
+
+	// Each peer is gossiped to the other peer, but not to itself.
+	for i, remote := range remotes {
+		select {
+		case msg := <-remote.Receiver():
+			require.Equal(p2p.Message_PEX, msg.Message.Type)
+			require.Len(msg.Message.Pex.Peers, 1)
+			require.Equal(peers[1-i].PeerID.String(), msg.Message.Pex.Peers[0].PeerID)
+			require.Equal(peers[1-i].IP, msg.Message.Pex.Peers[0].Ip)
+		case <-time.After(5 * time.Second):
+			require.FailNow("timed out waiting for pex message")
+		}
+	}
+}
+
+func TestPeerMisbehavedEventClosesConnsToBannedPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	// Penalties must not decay between offenses.
+	clk := clock.NewMock()
+
+	state := mocks.newState(Config{
+		ConnState: connstate.Config{
+			Reputation: connstate.ReputationConfig{
+				BanThreshold:        10,
+				SlowTransferPenalty: 5,
+			},
+		},
+	}, withClock(clk))
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+
+	info := ctrl.dispatcher.Stat()
+
+	_, c, cleanup := conn.PipeFixture(conn.Config{}, info)
+	defer cleanup()
+
+	p := core.PeerInfoFixture()
+	p.PeerID = c.PeerID()
+
+	require.NoError(state.conns.AddPending(c.PeerID(), c.InfoHash(), nil))
+	outgoingConnEvent{c, info.Bitfield(), info, p}.apply(state)
+
+	peerMisbehavedEvent{c.PeerID(), connstate.OffenseSlowTransfer}.apply(state)
+	require.False(c.IsClosed())
+
+	peerMisbehavedEvent{c.PeerID(), connstate.OffenseSlowTransfer}.apply(state)
+	require.True(c.IsClosed())
+}
+
+func TestAddPendingPeersSkipsBannedPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		ConnState: connstate.Config{
+			Reputation: connstate.ReputationConfig{
+				BanThreshold: 1,
+			},
+		},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+
+	h := ctrl.dispatcher.InfoHash()
+
+	// Unreachable peers, so handshakes fail immediately.
+	peer := core.NewPeerInfo(core.PeerIDFixture(), "127.0.0.1", 1, false, false)
+	origin := core.NewPeerInfo(core.PeerIDFixture(), "127.0.0.1", 1, true, true)
+
+	state.conns.Penalize(peer.PeerID, connstate.OffenseInvalidPiece)
+	state.conns.Penalize(origin.PeerID, connstate.OffenseInvalidPiece)
+
+	state.addPendingPeers(ctrl, []*core.PeerInfo{peer, origin})
+
+	// Origins are never banned.
+	require.NoError(state.conns.AddPending(peer.PeerID, h, nil))
+	require.Equal(connstate.ErrConnAlreadyPending, state.conns.AddPending(origin.PeerID, h, nil))
+}
+
+func TestTorrentCorruptEventRemovesTorrent(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{})
+
+	torrent := mocks.newTorrent()
+
+	ctrl, err := state.addTorrent(_testNamespace, torrent, true)
+	require.NoError(err)
+
+	errc := make(chan error, 1)
+	ctrl.errors = append(ctrl.errors, errc)
+
+	torrentCorruptEvent{torrent.InfoHash()}.apply(state)
+
+	require.Equal(ErrTorrentCorrupt, <-errc)
+	require.NotContains(state.torrentControls, torrent.InfoHash())
+
+	_, err = mocks.torrentArchive.Stat(_testNamespace, torrent.Digest())
+	require.Error(err)
+}
+
+// blobSource is a webseed.Source which serves the content of a single blob.
+type blobSource struct {
+	blob *core.BlobFixture
+}
+
+func (s blobSource) DownloadRange(
+	namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+
+	_, err := io.Copy(dst, bytes.NewReader(s.blob.Content[offset:offset+length]))
+	return err
+}
+
+func TestWebSeedTickEventFetchesPiecesOfTorrentsWithoutPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	config := Config{
+		WebSeed: WebSeedConfig{
+			Enabled:   true,
+			Addr:      "origin:80",
+			MaxPieces: 4,
+		},
+	}
+	state := mocks.newState(config, withClock(clk))
+
+	blob := core.SizedBlobFixture(32, 8)
+	state.sched.webSeed = blobSource{blob}
+
+	mocks.metainfoClient.EXPECT().
+		Download(_testNamespace, blob.Digest).
+		Return(blob.MetaInfo, nil)
+	torrent, err := mocks.torrentArchive.CreateTorrent(_testNamespace, blob.Digest)
+	require.NoError(err)
+
+	ctrl, err := state.addTorrent(_testNamespace, torrent, true)
+	require.NoError(err)
+
+	// The first tick only records the baseline download rate.
+	webSeedTickEvent{}.apply(state)
+	clk.Add(state.sched.config.WebSeed.Interval)
+	require.Equal(int64(0), ctrl.dispatcher.BytesDownloaded())
+
+	webSeedTickEvent{}.apply(state)
+	require.Eventually(func() bool {
+		return ctrl.dispatcher.Complete()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestAdaptiveTickEventRaisesLimitsOfIdleNetwork(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	clk := clock.NewMock()
+
+	state := mocks.newState(Config{
+		Adaptive: adaptive.Config{
+			Enabled:           true,
+			EgressBitsPerSec:  8000,
+			IngressBitsPerSec: 8000,
+		},
+		ConnState: connstate.Config{MaxOpenConnectionsPerTorrent: 10},
+	}, withClock(clk))
+
+	_, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+
+	// The first tick starts from the static limits.
+	adaptiveTickEvent{}.apply(state)
+	perTorrent, global := state.conns.Limits()
+	require.Equal(10, perTorrent)
+	require.Equal(state.sched.adaptive.Limits().GlobalConns, global)
+	require.Equal(state.sched.adaptive.Limits().PipelineLimit, state.pipelineLimit)
+
+	// The torrent is downloading without any traffic, so limits are raised.
+	clk.Add(5 * time.Second)
+	adaptiveTickEvent{}.apply(state)
+	raised, _ := state.conns.Limits()
+	require.True(raised > perTorrent)
+	require.Equal(state.sched.adaptive.Limits().PipelineLimit, state.pipelineLimit)
+}
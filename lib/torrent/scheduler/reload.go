@@ -59,6 +59,7 @@ func (rs *reloadableScheduler) reload(config Config) error {
 	if err != nil {
 		return fmt.Errorf("create new scheduler: %s", err)
 	}
+	n.webSeed = s.webSeed
 	rs.scheduler = n
 
 	if err := rs.start(rs.aq()); err != nil {
@@ -16,22 +16,28 @@ package scheduler
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
+	"github.com/willf/bitset"
 	"go.uber.org/zap"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler/adaptive"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcer"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
 	"github.com/uber/kraken/lib/torrent/scheduler/torrentlog"
 	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/lib/torrent/webseed"
 	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/log"
@@ -43,6 +49,8 @@ var (
 	ErrSchedulerStopped  = errors.New("scheduler has been stopped")
 	ErrTorrentTimeout    = errors.New("torrent timed out")
 	ErrTorrentRemoved    = errors.New("torrent manually removed")
+	ErrTorrentCorrupt    = errors.New("torrent is corrupt")
+	ErrTorrentIncomplete = errors.New("torrent is not complete")
 	ErrSendEventTimedOut = errors.New("event loop send timed out")
 )
 
@@ -50,9 +58,15 @@ var (
 type Scheduler interface {
 	Stop()
 	Download(namespace string, d core.Digest) error
+	DownloadWithPriority(namespace string, d core.Digest, p Priority) error
 	BlacklistSnapshot() ([]connstate.BlacklistedConn, error)
+	ReputationSnapshot() ([]connstate.PeerReputation, error)
 	RemoveTorrent(d core.Digest) error
+	Seed(namespace string, d core.Digest) error
 	Probe() error
+	PrioritizeRange(d core.Digest, offset, length int64) error
+	NamespaceBandwidth() []conn.NamespaceBandwidthConfig
+	SetNamespaceBandwidth(configs []conn.NamespaceBandwidthConfig) error
 }
 
 // scheduler manages global state for the peer. This includes:
@@ -67,16 +81,28 @@ type scheduler struct {
 	config         Config
 	clock          clock.Clock
 	torrentArchive storage.TorrentArchive
+	activeTorrents *activeTorrents
+	admission      *admissionQueue
 	stats          tally.Scope
 
 	handshaker *conn.Handshaker
 
 	eventLoop *liftedEventLoop
 
+	network  conn.Network
 	listener net.Listener
 
 	preemptionTick <-chan time.Time
 	emitStatsTick  <-chan time.Time
+	pexTick        <-chan time.Time
+	webSeedTick    <-chan time.Time
+	adaptiveTick   <-chan time.Time
+
+	// Nil if adaptive limits are disabled.
+	adaptive *adaptive.Controller
+
+	// Nil if the web seed is not configured.
+	webSeed webseed.Source
 
 	// TODO(codyg): We only need this hold on this reference for reloading the scheduler...
 	announceClient announceclient.Client
@@ -100,6 +126,7 @@ type scheduler struct {
 type schedOverrides struct {
 	clock     clock.Clock
 	eventLoop eventLoop
+	network   conn.Network
 }
 
 type option func(*schedOverrides)
@@ -112,6 +139,10 @@ func withEventLoop(l eventLoop) option {
 	return func(o *schedOverrides) { o.eventLoop = l }
 }
 
+func withNetwork(n conn.Network) option {
+	return func(o *schedOverrides) { o.network = n }
+}
+
 // newScheduler creates and starts a scheduler.
 func newScheduler(
 	config Config,
@@ -139,6 +170,7 @@ func newScheduler(
 	overrides := schedOverrides{
 		clock:     clock.New(),
 		eventLoop: newEventLoop(),
+		network:   conn.TCP,
 	}
 	for _, opt := range options {
 		opt(&overrides)
@@ -151,8 +183,29 @@ func newScheduler(
 		preemptionTick = overrides.clock.Tick(config.PreemptionInterval)
 	}
 
+	var pexTick <-chan time.Time
+	if config.PEX.Enabled {
+		pexTick = overrides.clock.Tick(config.PEX.Interval)
+	}
+
+	var webSeedTick <-chan time.Time
+	if config.WebSeed.Enabled {
+		webSeedTick = overrides.clock.Tick(config.WebSeed.Interval)
+	}
+
+	var adaptiveController *adaptive.Controller
+	var adaptiveTick <-chan time.Time
+	if config.Adaptive.Enabled {
+		adaptiveController, err = adaptive.New(config.Adaptive, overrides.clock)
+		if err != nil {
+			return nil, fmt.Errorf("adaptive: %s", err)
+		}
+		adaptiveTick = overrides.clock.Tick(adaptiveController.Interval())
+	}
+
 	handshaker, err := conn.NewHandshaker(
-		config.Conn, stats, overrides.clock, netevents, pctx.PeerID, eventLoop, slogger)
+		config.Conn, stats, overrides.clock, netevents, pctx.PeerID, eventLoop, slogger,
+		conn.WithNetwork(overrides.network))
 	if err != nil {
 		return nil, fmt.Errorf("conn: %s", err)
 	}
@@ -167,11 +220,18 @@ func newScheduler(
 		config:         config,
 		clock:          overrides.clock,
 		torrentArchive: ta,
+		activeTorrents: newActiveTorrents(config.ActiveTorrentsFile),
+		admission:      newAdmissionQueue(config.Admission, stats),
 		stats:          stats,
 		handshaker:     handshaker,
 		eventLoop:      eventLoop,
+		network:        overrides.network,
 		preemptionTick: preemptionTick,
 		emitStatsTick:  overrides.clock.Tick(config.EmitStatsInterval),
+		pexTick:        pexTick,
+		webSeedTick:    webSeedTick,
+		adaptiveTick:   adaptiveTick,
+		adaptive:       adaptiveController,
 		announceClient: announceClient,
 		announcer:      announcer.Default(announceClient, eventLoop, overrides.clock, slogger),
 		netevents:      netevents,
@@ -196,10 +256,10 @@ func newScheduler(
 // "unstarted" scheduler in certain cases.
 func (s *scheduler) start(aq announcequeue.Queue) error {
 	s.log().Infof(
-		"Scheduler starting as peer %s on addr %s:%d",
-		s.pctx.PeerID, s.pctx.IP, s.pctx.Port)
+		"Scheduler starting as peer %s on addr %s",
+		s.pctx.PeerID, net.JoinHostPort(s.pctx.IP, strconv.Itoa(s.pctx.Port)))
 
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.pctx.Port))
+	l, err := s.network.Listen(fmt.Sprintf(":%d", s.pctx.Port))
 	if err != nil {
 		return err
 	}
@@ -211,9 +271,37 @@ func (s *scheduler) start(aq announcequeue.Queue) error {
 	go s.tickerLoop()
 	go s.announceLoop()
 
+	go s.resumeActiveTorrents()
+
 	return nil
 }
 
+// resumeActiveTorrents adds the torrents which were active when the scheduler
+// last stopped.
+func (s *scheduler) resumeActiveTorrents() {
+	torrents, err := s.activeTorrents.load()
+	if err != nil {
+		s.log().Errorf("Error loading active torrents: %s", err)
+		return
+	}
+	if len(torrents) > 0 {
+		s.log().Infof("Resuming %d active torrents", len(torrents))
+	}
+	for _, at := range torrents {
+		t, err := s.torrentArchive.CreateTorrent(at.Namespace, at.Digest)
+		if err != nil {
+			s.log("namespace", at.Namespace, "digest", at.Digest).Errorf(
+				"Error resuming torrent: %s", err)
+			s.stats.Counter("resume_torrent_errors").Inc(1)
+			continue
+		}
+		if !s.eventLoop.send(resumeTorrentEvent{at.Namespace, t}) {
+			return
+		}
+		s.stats.Counter("resumed_torrents").Inc(1)
+	}
+}
+
 // Stop shuts down the scheduler.
 func (s *scheduler) Stop() {
 	s.stopOnce.Do(func() {
@@ -233,7 +321,15 @@ func (s *scheduler) Stop() {
 }
 
 // doDownload schedules a blob for download, returning only once it's downloaded.
-func (s *scheduler) doDownload(namespace string, d core.Digest) (size int64, err error) {
+func (s *scheduler) doDownload(
+	namespace string, d core.Digest, p Priority) (size int64, err error) {
+
+	release, err := s.admission.acquire(p, s.done)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
 	t, err := s.torrentArchive.CreateTorrent(namespace, d)
 	if err != nil {
 		if err == storage.ErrNotFound {
@@ -253,8 +349,14 @@ func (s *scheduler) doDownload(namespace string, d core.Digest) (size int64, err
 // Download downloads the torrent given metainfo. Once the torrent is downloaded,
 // it will begin seeding asynchronously.
 func (s *scheduler) Download(namespace string, d core.Digest) error {
+	return s.DownloadWithPriority(namespace, d, PriorityInteractive)
+}
+
+// DownloadWithPriority downloads the torrent given metainfo once admitted by
+// the download queue, in which downloads are admitted by priority p.
+func (s *scheduler) DownloadWithPriority(namespace string, d core.Digest, p Priority) error {
 	start := time.Now()
-	size, err := s.doDownload(namespace, d)
+	size, err := s.doDownload(namespace, d, p)
 	if err != nil {
 		var errTag string
 		switch err {
@@ -266,6 +368,10 @@ func (s *scheduler) Download(namespace string, d core.Digest) error {
 			errTag = "scheduler_stopped"
 		case ErrTorrentRemoved:
 			errTag = "removed"
+		case ErrDownloadQueueFull:
+			errTag = "queue_full"
+		case ErrTorrentCorrupt:
+			errTag = "corrupt"
 		default:
 			errTag = "unknown"
 		}
@@ -290,6 +396,16 @@ func (s *scheduler) BlacklistSnapshot() ([]connstate.BlacklistedConn, error) {
 	return <-result, nil
 }
 
+// ReputationSnapshot returns a snapshot of the reputation of recently
+// penalized peers.
+func (s *scheduler) ReputationSnapshot() ([]connstate.PeerReputation, error) {
+	result := make(chan []connstate.PeerReputation)
+	if !s.eventLoop.send(reputationSnapshotEvent{result}) {
+		return nil, ErrSchedulerStopped
+	}
+	return <-result, nil
+}
+
 // RemoveTorrent forcibly stops leeching / seeding torrent for d and removes
 // the torrent from disk.
 func (s *scheduler) RemoveTorrent(d core.Digest) error {
@@ -301,11 +417,60 @@ func (s *scheduler) RemoveTorrent(d core.Digest) error {
 	return <-errc
 }
 
+// Seed begins seeding the blob of d, which must already be complete on disk,
+// without downloading anything, and immediately announces it to the tracker.
+// Useful for hosts whose caches were populated outside of Kraken. Returns
+// ErrTorrentNotFound if the tracker has no metainfo for d, and
+// ErrTorrentIncomplete if the blob is not complete on disk.
+func (s *scheduler) Seed(namespace string, d core.Digest) error {
+	t, err := s.torrentArchive.CreateTorrent(namespace, d)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return ErrTorrentNotFound
+		}
+		return fmt.Errorf("create torrent: %s", err)
+	}
+	if !t.Complete() {
+		return ErrTorrentIncomplete
+	}
+
+	// Buffer size of 1 so sends do not block.
+	errc := make(chan error, 1)
+	if !s.eventLoop.send(seedTorrentEvent{namespace, t, errc}) {
+		return ErrSchedulerStopped
+	}
+	return <-errc
+}
+
+// PrioritizeRange downloads the pieces of the in-progress torrent for d which
+// overlap [offset, offset+length) before any other pieces, so the range can be
+// read while the torrent is still downloading.
+func (s *scheduler) PrioritizeRange(d core.Digest, offset, length int64) error {
+	// Buffer size of 1 so sends do not block.
+	errc := make(chan error, 1)
+	if !s.eventLoop.send(prioritizeRangeEvent{d, offset, length, errc}) {
+		return ErrSchedulerStopped
+	}
+	return <-errc
+}
+
 // Probe verifies that the scheduler event loop is running and unblocked.
 func (s *scheduler) Probe() error {
 	return s.eventLoop.sendTimeout(probeEvent{}, s.config.ProbeTimeout)
 }
 
+// NamespaceBandwidth returns the current bandwidth shares of namespaces.
+func (s *scheduler) NamespaceBandwidth() []conn.NamespaceBandwidthConfig {
+	return s.handshaker.NamespaceBandwidth()
+}
+
+// SetNamespaceBandwidth replaces the bandwidth shares of namespaces without
+// restarting the scheduler. Shares are reset to the configured shares when the
+// scheduler is reloaded.
+func (s *scheduler) SetNamespaceBandwidth(configs []conn.NamespaceBandwidthConfig) error {
+	return s.handshaker.SetNamespaceBandwidth(configs)
+}
+
 func (s *scheduler) runEventLoop(aq announcequeue.Queue) {
 	defer s.wg.Done()
 
@@ -346,12 +511,32 @@ func (s *scheduler) tickerLoop() {
 			s.eventLoop.send(preemptionTickEvent{})
 		case <-s.emitStatsTick:
 			s.eventLoop.send(emitStatsEvent{})
+		case <-s.pexTick:
+			s.eventLoop.send(pexTickEvent{})
+		case <-s.webSeedTick:
+			s.eventLoop.send(webSeedTickEvent{})
+		case <-s.adaptiveTick:
+			s.eventLoop.send(adaptiveTickEvent{})
 		case <-s.done:
 			return
 		}
 	}
 }
 
+// fetchWebSeedPiece fetches piece i of the torrent of d from the web seed.
+func (s *scheduler) fetchWebSeedPiece(namespace string, d *dispatch.Dispatcher, i int) {
+	start := s.clock.Now()
+	err := d.WriteWebSeedPiece(i, func(offset, length int64, dst io.Writer) error {
+		return s.webSeed.DownloadRange(namespace, d.Digest(), offset, length, dst)
+	})
+	if err != nil {
+		s.log("hash", d.InfoHash(), "piece", i).Infof("Error fetching piece from web seed: %s", err)
+		s.stats.Counter("web_seed_errors").Inc(1)
+		return
+	}
+	s.stats.Timer("web_seed_piece_time").Record(s.clock.Now().Sub(start))
+}
+
 // announceLoop runs the announcer ticker.
 func (s *scheduler) announceLoop() {
 	defer s.wg.Done()
@@ -359,8 +544,8 @@ func (s *scheduler) announceLoop() {
 	s.announcer.Ticker(s.done)
 }
 
-func (s *scheduler) announce(d core.Digest, h core.InfoHash, complete bool) {
-	peers, err := s.announcer.Announce(d, h, complete)
+func (s *scheduler) announce(namespace string, d core.Digest, h core.InfoHash, complete bool) {
+	peers, err := s.announcer.Announce(namespace, d, h, complete)
 	if err != nil {
 		if err != announceclient.ErrDisabled {
 			s.eventLoop.send(announceErrEvent{h, err})
@@ -386,7 +571,7 @@ func (s *scheduler) establishIncomingHandshake(pc *conn.PendingConn, rb conn.Rem
 		s.failIncomingHandshake(pc, fmt.Errorf("torrent stat: %s", err))
 		return
 	}
-	c, err := s.handshaker.Establish(pc, info, rb)
+	c, err := s.handshaker.Establish(pc, s.handshakeInfo(info), rb)
 	if err != nil {
 		s.failIncomingHandshake(pc, fmt.Errorf("establish handshake: %s", err))
 		return
@@ -400,8 +585,8 @@ func (s *scheduler) establishIncomingHandshake(pc *conn.PendingConn, rb conn.Rem
 func (s *scheduler) initializeOutgoingHandshake(
 	p *core.PeerInfo, info *storage.TorrentInfo, rb conn.RemoteBitfields, namespace string) {
 
-	addr := fmt.Sprintf("%s:%d", p.IP, p.Port)
-	result, err := s.handshaker.Initialize(p.PeerID, addr, info, rb, namespace)
+	addr := p.DialAddr(s.pctx)
+	result, err := s.handshaker.Initialize(p.PeerID, addr, s.handshakeInfo(info), rb, namespace)
 	if err != nil {
 		s.log(
 			"peer", p.PeerID,
@@ -412,7 +597,18 @@ func (s *scheduler) initializeOutgoingHandshake(
 		return
 	}
 	s.torrentlog.OutgoingConnectionAccept(info.Digest(), info.InfoHash(), p.PeerID)
-	s.eventLoop.send(outgoingConnEvent{result.Conn, result.Bitfield, info})
+	s.eventLoop.send(outgoingConnEvent{result.Conn, result.Bitfield, info, p})
+}
+
+// handshakeInfo returns the torrent info to send to remote peers in handshakes.
+// Superseeded torrents are advertised with no pieces, and the dispatcher
+// advertises individual pieces once the conn is established.
+func (s *scheduler) handshakeInfo(info *storage.TorrentInfo) *storage.TorrentInfo {
+	b := info.Bitfield()
+	if !s.config.Dispatch.Superseed || !b.All() {
+		return info
+	}
+	return info.WithBitfield(bitset.New(b.Len()))
 }
 
 func (s *scheduler) log(args ...interface{}) *zap.SugaredLogger {
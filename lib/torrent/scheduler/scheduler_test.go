@@ -15,6 +15,7 @@ package scheduler
 
 import (
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -22,6 +23,7 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
 	"github.com/uber/kraken/lib/torrent/storage/piecereader"
@@ -383,7 +385,7 @@ func TestPullInactiveTorrent(t *testing.T) {
 	// Force announce the scheduler for this torrent to simulate a peer which
 	// is registered in tracker but does not have the torrent in memory.
 	ac := announceclient.New(seeder.pctx, hashring.NoopPassiveRing(hostlist.Fixture(mocks.trackerAddr)), nil)
-	_, _, err := ac.Announce(blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V1)
+	_, _, err := ac.Announce(namespace, blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V1)
 	require.NoError(err)
 
 	leecher := mocks.newPeer(config)
@@ -427,6 +429,40 @@ func TestSchedulerReload(t *testing.T) {
 	download()
 }
 
+func TestSchedulerResumesActiveTorrents(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := configFixture()
+	config.ActiveTorrentsFile = filepath.Join(t.TempDir(), "active_torrents.json")
+
+	p := mocks.newPeer(config)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	p.writeTorrent(namespace, blob)
+	require.NoError(p.scheduler.Download(namespace, blob.Digest))
+
+	p.scheduler.Stop()
+
+	w := newEventWatcher()
+
+	s, err := newScheduler(
+		config, p.torrentArchive, p.stats, p.pctx, p.scheduler.announceClient, p.testProducer,
+		withEventLoop(w))
+	require.NoError(err)
+	require.NoError(s.start(announcequeue.New()))
+	defer s.Stop()
+
+	w.waitFor(t, resumeTorrentEvent{})
+}
+
 func TestSchedulerRemoveTorrent(t *testing.T) {
 	require := require.New(t)
 
@@ -456,6 +492,80 @@ func TestSchedulerRemoveTorrent(t *testing.T) {
 	require.True(os.IsNotExist(err))
 }
 
+func TestSchedulerPrioritizeRange(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	w := newEventWatcher()
+
+	p := mocks.newPeer(configFixture(), withEventLoop(w))
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	require.Equal(ErrTorrentNotFound, p.scheduler.PrioritizeRange(blob.Digest, 0, 1))
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	errc := make(chan error)
+	go func() { errc <- p.scheduler.Download(namespace, blob.Digest) }()
+
+	w.waitFor(t, newTorrentEvent{})
+
+	require.NoError(p.scheduler.PrioritizeRange(blob.Digest, 0, 1))
+	require.Error(p.scheduler.PrioritizeRange(blob.Digest, 0, blob.Length()+1))
+
+	require.NoError(p.scheduler.RemoveTorrent(blob.Digest))
+	require.Equal(ErrTorrentRemoved, <-errc)
+}
+
+func TestSchedulerSeedPreloadedBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := configFixture()
+
+	seeder := mocks.newPeer(config)
+	leecher := mocks.newPeer(config)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil).Times(2)
+
+	// Populate the cache of the seeder directly, as if it was restored from a
+	// snapshot, so the seeder has no torrent metadata for the blob.
+	require.NoError(store.RunDownload(seeder.cads, blob.Digest, blob.Content))
+
+	require.NoError(seeder.scheduler.Seed(namespace, blob.Digest))
+
+	require.NoError(leecher.scheduler.Download(namespace, blob.Digest))
+	leecher.checkTorrent(t, namespace, blob)
+}
+
+func TestSchedulerSeedMissingBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	p := mocks.newPeer(configFixture())
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	require.Equal(ErrTorrentIncomplete, p.scheduler.Seed(namespace, blob.Digest))
+}
+
 func TestSchedulerProbe(t *testing.T) {
 	require := require.New(t)
 
@@ -0,0 +1,353 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package simnet implements an in-memory network for simulating swarms. Time on
+// the network is driven by a clock, so with a mock clock, slow and lossy links
+// are simulated without waiting on them.
+package simnet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// _retransmitTimeout is the delay of writes lost on a link, after which they
+// are retransmitted. Matches the minimum retransmission timeout of TCP.
+const _retransmitTimeout = 200 * time.Millisecond
+
+// ErrConnRefused is returned when dialing an address nobody listens on.
+var ErrConnRefused = errors.New("connection refused")
+
+// LinkConfig defines the link which connects a host to the network. Data sent
+// between two hosts traverses the links of both hosts.
+type LinkConfig struct {
+
+	// Latency is the one-way latency of the link.
+	Latency time.Duration `yaml:"latency"`
+
+	// Loss is the probability, in [0, 1], that a write is lost on the link.
+	// Lost writes are retransmitted after a timeout, which delays all
+	// subsequent writes of the connection like in TCP.
+	Loss float64 `yaml:"loss"`
+
+	// BitsPerSec is the bandwidth of the link, which is shared by all
+	// connections of the host. Unlimited if 0.
+	BitsPerSec uint64 `yaml:"bits_per_sec"`
+}
+
+// Network connects hosts in memory. Hosts are identified by the port they
+// listen on, so every host must listen on a distinct port and the hosts of
+// addresses are ignored.
+type Network struct {
+	clk clock.Clock
+
+	mu        sync.Mutex // Protects the following fields, and the queues of hosts.
+	rand      *rand.Rand
+	listeners map[string]*listener
+}
+
+// New creates a new Network whose time is driven by clk. Lost writes are drawn
+// from a random source seeded with seed.
+func New(clk clock.Clock, seed int64) *Network {
+	return &Network{
+		clk:       clk,
+		rand:      rand.New(rand.NewSource(seed)),
+		listeners: make(map[string]*listener),
+	}
+}
+
+// Host is a host on a Network. Implements conn.Network.
+type Host struct {
+	network *Network
+	link    LinkConfig
+
+	// Times at which the egress and ingress queues of the link drain.
+	egressFree  time.Time
+	ingressFree time.Time
+}
+
+// Host adds a new host which is connected to n via link.
+func (n *Network) Host(link LinkConfig) *Host {
+	return &Host{network: n, link: link}
+}
+
+// Listen listens for connections to the port of addr.
+func (h *Host) Listen(addr string) (net.Listener, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("split host port: %s", err)
+	}
+	n := h.network
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.listeners[port]; ok {
+		return nil, fmt.Errorf("port %s already in use", port)
+	}
+	l := &listener{
+		network: n,
+		host:    h,
+		port:    port,
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+	}
+	n.listeners[port] = l
+	return l, nil
+}
+
+// DialTimeout opens a connection to the host listening on the port of addr.
+// Connections are established immediately, so timeout is ignored.
+func (h *Host) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("split host port: %s", err)
+	}
+	n := h.network
+
+	n.mu.Lock()
+	l, ok := n.listeners[port]
+	n.mu.Unlock()
+	if !ok {
+		return nil, ErrConnRefused
+	}
+
+	out := newPipe(n, h, l.host)
+	in := newPipe(n, l.host, h)
+	local := &conn{local: simAddr("dialer"), remote: simAddr(addr), in: in, out: out}
+	remote := &conn{local: simAddr(addr), remote: simAddr("dialer"), in: out, out: in}
+
+	select {
+	case l.conns <- remote:
+		return local, nil
+	case <-l.done:
+		return nil, ErrConnRefused
+	}
+}
+
+// transmit queues size bytes on the links from src to dst, and returns the
+// time at which they arrive at dst.
+func (n *Network) transmit(src, dst *Host, size int) time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	start := n.clk.Now()
+	for _, t := range []time.Time{src.egressFree, dst.ingressFree} {
+		if t.After(start) {
+			start = t
+		}
+	}
+	end := start.Add(transmitTime(size, src.link.BitsPerSec, dst.link.BitsPerSec))
+	src.egressFree = end
+	dst.ingressFree = end
+
+	arrival := end.Add(src.link.Latency + dst.link.Latency)
+	if n.rand.Float64() < 1-(1-src.link.Loss)*(1-dst.link.Loss) {
+		arrival = arrival.Add(_retransmitTimeout)
+	}
+	return arrival
+}
+
+// transmitTime returns the duration of sending size bytes over links of the
+// given bandwidths, where 0 is unlimited.
+func transmitTime(size int, bitsPerSec ...uint64) time.Duration {
+	var slowest uint64
+	for _, b := range bitsPerSec {
+		if b > 0 && (slowest == 0 || b < slowest) {
+			slowest = b
+		}
+	}
+	if slowest == 0 {
+		return 0
+	}
+	return time.Duration(float64(size) * 8 / float64(slowest) * float64(time.Second))
+}
+
+type simAddr string
+
+func (a simAddr) Network() string { return "simnet" }
+func (a simAddr) String() string  { return string(a) }
+
+type listener struct {
+	network   *Network
+	host      *Host
+	port      string
+	conns     chan net.Conn
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+
+		l.network.mu.Lock()
+		delete(l.network.listeners, l.port)
+		l.network.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return simAddr(net.JoinHostPort("", l.port))
+}
+
+// conn is one end of a connection. Deadlines are not supported, since peers
+// set them relative to the wall clock instead of the clock of the network.
+type conn struct {
+	local  simAddr
+	remote simAddr
+	in     *pipe
+	out    *pipe
+}
+
+func (c *conn) Read(b []byte) (int, error)  { return c.in.read(b) }
+func (c *conn) Write(b []byte) (int, error) { return c.out.write(b) }
+
+func (c *conn) Close() error {
+	c.in.closeRead()
+	c.out.closeWrite()
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr                { return c.local }
+func (c *conn) RemoteAddr() net.Addr               { return c.remote }
+func (c *conn) SetDeadline(t time.Time) error      { return nil }
+func (c *conn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *conn) SetWriteDeadline(t time.Time) error { return nil }
+
+type segment struct {
+	data    []byte
+	arrival time.Time
+}
+
+// pipe carries the data of a connection from src to dst. Writes never block:
+// they are queued on the links and become readable once they arrive.
+type pipe struct {
+	network *Network
+	src     *Host
+	dst     *Host
+
+	mu          sync.Mutex // Protects the following fields.
+	cond        *sync.Cond
+	buf         bytes.Buffer // Arrived data.
+	inFlight    []segment    // In order of arrival.
+	lastArrival time.Time
+	readClosed  bool
+	writeClosed bool
+}
+
+func newPipe(n *Network, src, dst *Host) *pipe {
+	p := &pipe{network: n, src: src, dst: dst}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *pipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.readClosed || p.writeClosed {
+		return 0, io.ErrClosedPipe
+	}
+	arrival := p.network.transmit(p.src, p.dst, len(b))
+	if arrival.Before(p.lastArrival) {
+		// Data arrives in order, even if earlier writes were lost.
+		arrival = p.lastArrival
+	}
+	p.lastArrival = arrival
+	p.inFlight = append(p.inFlight, segment{append([]byte(nil), b...), arrival})
+
+	if delay := arrival.Sub(p.network.clk.Now()); delay > 0 {
+		p.network.clk.AfterFunc(delay, p.deliver)
+	} else {
+		p.deliverLocked()
+	}
+	return len(b), nil
+}
+
+// deliver makes segments which arrived readable.
+func (p *pipe) deliver() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.deliverLocked()
+}
+
+func (p *pipe) deliverLocked() {
+	now := p.network.clk.Now()
+	var n int
+	for _, s := range p.inFlight {
+		if s.arrival.After(now) {
+			break
+		}
+		if !p.readClosed {
+			p.buf.Write(s.data)
+		}
+		n++
+	}
+	p.inFlight = p.inFlight[n:]
+	p.cond.Broadcast()
+}
+
+func (p *pipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.readClosed {
+			return 0, io.ErrClosedPipe
+		}
+		if p.buf.Len() > 0 {
+			return p.buf.Read(b)
+		}
+		if p.writeClosed && len(p.inFlight) == 0 {
+			return 0, io.EOF
+		}
+		p.cond.Wait()
+	}
+}
+
+func (p *pipe) closeRead() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.readClosed = true
+	p.buf.Reset()
+	p.cond.Broadcast()
+}
+
+func (p *pipe) closeWrite() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.writeClosed = true
+	p.cond.Broadcast()
+}
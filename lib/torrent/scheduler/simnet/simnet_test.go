@@ -0,0 +1,154 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package simnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func connect(t *testing.T, client, server *Host) (net.Conn, net.Conn) {
+	require := require.New(t)
+
+	l, err := server.Listen(":8000")
+	require.NoError(err)
+	t.Cleanup(func() { l.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	c, err := client.DialTimeout("localhost:8000", time.Second)
+	require.NoError(err)
+	return c, <-accepted
+}
+
+// readAsync reads n bytes from c in the background.
+func readAsync(c net.Conn, n int) <-chan []byte {
+	result := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(c, b); err == nil {
+			result <- b
+		}
+	}()
+	return result
+}
+
+func requireNotReceived(t *testing.T, result <-chan []byte) {
+	select {
+	case <-result:
+		require.FailNow(t, "data arrived early")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func requireReceived(t *testing.T, expected string, result <-chan []byte) {
+	select {
+	case b := <-result:
+		require.Equal(t, expected, string(b))
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for data")
+	}
+}
+
+func TestConnDeliversWritesAfterLatencyOfBothLinks(t *testing.T) {
+	clk := clock.NewMock()
+	n := New(clk, 0)
+
+	client, server := connect(
+		t, n.Host(LinkConfig{Latency: 30 * time.Millisecond}), n.Host(LinkConfig{Latency: 20 * time.Millisecond}))
+
+	_, err := client.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	result := readAsync(server, 5)
+	clk.Add(49 * time.Millisecond)
+	requireNotReceived(t, result)
+
+	clk.Add(time.Millisecond)
+	requireReceived(t, "hello", result)
+}
+
+func TestConnLimitedBySlowestLink(t *testing.T) {
+	clk := clock.NewMock()
+	n := New(clk, 0)
+
+	// 1000 bytes per second.
+	client, server := connect(t, n.Host(LinkConfig{BitsPerSec: 8000}), n.Host(LinkConfig{}))
+
+	_, err := server.Write(make([]byte, 100))
+	require.NoError(t, err)
+
+	result := readAsync(client, 100)
+	clk.Add(99 * time.Millisecond)
+	requireNotReceived(t, result)
+
+	clk.Add(time.Millisecond)
+	requireReceived(t, string(make([]byte, 100)), result)
+}
+
+func TestConnRetransmitsLostWrites(t *testing.T) {
+	clk := clock.NewMock()
+	n := New(clk, 0)
+
+	client, server := connect(t, n.Host(LinkConfig{Loss: 1}), n.Host(LinkConfig{}))
+
+	_, err := client.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	result := readAsync(server, 5)
+	clk.Add(_retransmitTimeout - time.Millisecond)
+	requireNotReceived(t, result)
+
+	clk.Add(time.Millisecond)
+	requireReceived(t, "hello", result)
+}
+
+func TestConnReadsEOFAfterRemoteClose(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	n := New(clk, 0)
+
+	client, server := connect(t, n.Host(LinkConfig{Latency: time.Millisecond}), n.Host(LinkConfig{}))
+
+	_, err := client.Write([]byte("hello"))
+	require.NoError(err)
+	require.NoError(client.Close())
+
+	clk.Add(time.Millisecond)
+
+	b, err := io.ReadAll(server)
+	require.NoError(err)
+	require.Equal("hello", string(b))
+
+	_, err = server.Write([]byte("bye"))
+	require.Equal(io.ErrClosedPipe, err)
+}
+
+func TestDialRefusedWithoutListener(t *testing.T) {
+	n := New(clock.NewMock(), 0)
+
+	_, err := n.Host(LinkConfig{}).DialTimeout("localhost:8000", time.Second)
+	require.Equal(t, ErrConnRefused, err)
+}
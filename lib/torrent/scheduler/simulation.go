@@ -0,0 +1,405 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
+	"github.com/uber/kraken/lib/torrent/scheduler/simnet"
+	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
+	"github.com/uber/kraken/lib/torrent/storage/piecereader"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/metainfoclient"
+)
+
+const _simulationNamespace = "simulation"
+
+// SimulationConfig defines a swarm to simulate. All peers of the swarm run
+// real schedulers, but their connections are in-memory and all timers run on a
+// virtual clock, so swarms can be simulated faster than real time.
+type SimulationConfig struct {
+
+	// Scheduler is the configuration of all peers. Bandwidth limits of conns
+	// are disabled, since the bandwidth of peers is limited by their links.
+	Scheduler Config `yaml:"scheduler"`
+
+	// Seeders is the number of origins which have the blob when the
+	// simulation starts.
+	Seeders int `yaml:"seeders"`
+
+	// Leechers is the number of agents which download the blob.
+	Leechers int `yaml:"leechers"`
+
+	SeederLink  simnet.LinkConfig `yaml:"seeder_link"`
+	LeecherLink simnet.LinkConfig `yaml:"leecher_link"`
+
+	BlobSize    datasize.ByteSize `yaml:"blob_size"`
+	PieceLength datasize.ByteSize `yaml:"piece_length"`
+
+	// AnnounceInterval is the announce interval the tracker hands out.
+	AnnounceInterval time.Duration `yaml:"announce_interval"`
+
+	// MaxPeers limits the number of peers the tracker hands out per announce.
+	// Origins are handed out first.
+	MaxPeers int `yaml:"max_peers"`
+
+	// Runs is the number of times the swarm is simulated. Each run uses a
+	// different seed, derived from Seed.
+	Runs int   `yaml:"runs"`
+	Seed int64 `yaml:"seed"`
+
+	// Step is the duration by which the virtual clock advances at once.
+	// Smaller steps are more accurate, but slower to simulate.
+	Step time.Duration `yaml:"step"`
+
+	// Timeout is the virtual duration after which downloads which did not
+	// complete are counted as failed.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c SimulationConfig) applyDefaults() SimulationConfig {
+	if c.Seeders == 0 {
+		c.Seeders = 1
+	}
+	if c.Leechers == 0 {
+		c.Leechers = 10
+	}
+	if c.BlobSize == 0 {
+		c.BlobSize = 16 * datasize.MB
+	}
+	if c.PieceLength == 0 {
+		c.PieceLength = datasize.MB
+	}
+	if c.AnnounceInterval == 0 {
+		c.AnnounceInterval = 3 * time.Second
+	}
+	if c.MaxPeers == 0 {
+		c.MaxPeers = 50
+	}
+	if c.Runs == 0 {
+		c.Runs = 1
+	}
+	if c.Step == 0 {
+		c.Step = 10 * time.Millisecond
+	}
+	if c.Timeout == 0 {
+		c.Timeout = time.Hour
+	}
+	c.Scheduler.Conn.Bandwidth.Enable = false
+	return c
+}
+
+// SimulationReport summarizes the virtual time-to-completion of the downloads
+// of all runs of a simulation.
+type SimulationReport struct {
+	Downloads int             `json:"downloads"`
+	Failures  int             `json:"failures"`
+	Times     []time.Duration `json:"times"` // Of successful downloads, sorted.
+}
+
+// Percentile returns the time by which the fraction q of successful downloads
+// completed. Returns 0 if no downloads succeeded.
+func (r *SimulationReport) Percentile(q float64) time.Duration {
+	if len(r.Times) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(r.Times)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return r.Times[i]
+}
+
+func (r *SimulationReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "downloads: %d, failures: %d\n", r.Downloads, r.Failures)
+	for _, q := range []float64{0.5, 0.9, 0.99, 1} {
+		fmt.Fprintf(&b, "p%g: %s\n", q*100, r.Percentile(q))
+	}
+	return b.String()
+}
+
+// Simulate runs the simulation of config and reports the time-to-completion of
+// downloads.
+//
+// Randomness of the simulation, i.e. the blob, the peer handouts of the tracker
+// and lost writes, is derived from the seed of each run. However, goroutines of
+// peers still run in real time between steps of the virtual clock, so results
+// of runs with the same seed vary slightly.
+func Simulate(config SimulationConfig) (*SimulationReport, error) {
+	config = config.applyDefaults()
+
+	report := &SimulationReport{}
+	for run := 0; run < config.Runs; run++ {
+		times, failures, err := simulateRun(config, config.Seed+int64(run))
+		if err != nil {
+			return nil, fmt.Errorf("run %d: %s", run, err)
+		}
+		report.Downloads += config.Leechers
+		report.Failures += failures
+		report.Times = append(report.Times, times...)
+	}
+	sort.Slice(report.Times, func(i, j int) bool {
+		return report.Times[i] < report.Times[j]
+	})
+	return report, nil
+}
+
+type simulationResult struct {
+	elapsed time.Duration
+	err     error
+}
+
+// simulateRun simulates the swarm of config once. Returns the times of the
+// successful downloads, and the number of failed downloads.
+func simulateRun(config SimulationConfig, seed int64) ([]time.Duration, int, error) {
+	dir, err := os.MkdirTemp("", "kraken-simulation-")
+	if err != nil {
+		return nil, 0, fmt.Errorf("mkdir temp: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	blob, err := simulationBlob(seed, int64(config.BlobSize), int64(config.PieceLength))
+	if err != nil {
+		return nil, 0, fmt.Errorf("blob: %s", err)
+	}
+	metaInfoClient := metainfoclient.NewTestClient()
+	if err := metaInfoClient.Upload(blob.MetaInfo); err != nil {
+		return nil, 0, fmt.Errorf("upload metainfo: %s", err)
+	}
+
+	clk := clock.NewMock()
+	network := simnet.New(clk, seed)
+	tracker := newSimulationTracker(seed, config.AnnounceInterval, config.MaxPeers)
+
+	var peers []*scheduler
+	var stores []*store.CADownloadStore
+	defer func() {
+		for _, s := range peers {
+			s.Stop()
+		}
+		for _, cads := range stores {
+			cads.Close()
+		}
+	}()
+	for i := 0; i < config.Seeders+config.Leechers; i++ {
+		origin := i < config.Seeders
+		link := config.LeecherLink
+		if origin {
+			link = config.SeederLink
+		}
+		peerID, err := core.HashedPeerID(fmt.Sprintf("peer-%d", i))
+		if err != nil {
+			return nil, 0, fmt.Errorf("peer id: %s", err)
+		}
+		pctx := core.PeerContext{
+			IP:     "127.0.0.1",
+			Port:   10000 + i,
+			PeerID: peerID,
+			Zone:   "simulation",
+			Origin: origin,
+		}
+		cads, err := store.NewCADownloadStore(store.CADownloadStoreConfig{
+			DownloadDir: filepath.Join(dir, peerID.String(), "download"),
+			CacheDir:    filepath.Join(dir, peerID.String(), "cache"),
+		}, tally.NoopScope)
+		if err != nil {
+			return nil, 0, fmt.Errorf("ca download store: %s", err)
+		}
+		stores = append(stores, cads)
+
+		ta := agentstorage.NewTorrentArchive(tally.NoopScope, cads, metaInfoClient)
+		if origin {
+			if err := writeSimulationBlob(ta, blob); err != nil {
+				return nil, 0, fmt.Errorf("write blob: %s", err)
+			}
+		}
+		netevents, err := networkevent.NewProducer(networkevent.Config{}, tally.NoopScope)
+		if err != nil {
+			return nil, 0, fmt.Errorf("network event producer: %s", err)
+		}
+		s, err := newScheduler(
+			config.Scheduler, ta, tally.NoopScope, pctx, tracker.client(pctx), netevents,
+			withClock(clk), withNetwork(network.Host(link)))
+		if err != nil {
+			return nil, 0, fmt.Errorf("new scheduler: %s", err)
+		}
+		if err := s.start(announcequeue.New()); err != nil {
+			return nil, 0, fmt.Errorf("start scheduler: %s", err)
+		}
+		peers = append(peers, s)
+	}
+
+	// Seed the blob, which completes immediately since seeders have it.
+	for _, s := range peers[:config.Seeders] {
+		if err := s.Download(_simulationNamespace, blob.Digest); err != nil {
+			return nil, 0, fmt.Errorf("seed: %s", err)
+		}
+	}
+
+	start := clk.Now()
+	results := make(chan simulationResult, config.Leechers)
+	for _, s := range peers[config.Seeders:] {
+		go func(s *scheduler) {
+			err := s.Download(_simulationNamespace, blob.Digest)
+			results <- simulationResult{clk.Now().Sub(start), err}
+		}(s)
+	}
+
+	var times []time.Duration
+	var failures int
+	for len(times)+failures < config.Leechers {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				failures++
+			} else {
+				times = append(times, r.elapsed)
+			}
+			continue
+		default:
+		}
+		if clk.Now().Sub(start) >= config.Timeout {
+			failures = config.Leechers - len(times)
+			break
+		}
+		clk.Add(config.Step)
+	}
+	return times, failures, nil
+}
+
+// simulationBlob generates a blob whose content is derived from seed.
+func simulationBlob(seed, size, pieceLength int64) (*core.BlobFixture, error) {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(content)
+	d, err := core.NewDigester().FromBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("digest: %s", err)
+	}
+	mi, err := core.NewMetaInfo(d, bytes.NewReader(content), pieceLength)
+	if err != nil {
+		return nil, fmt.Errorf("metainfo: %s", err)
+	}
+	return &core.BlobFixture{Content: content, Digest: d, MetaInfo: mi}, nil
+}
+
+func writeSimulationBlob(ta *agentstorage.TorrentArchive, blob *core.BlobFixture) error {
+	t, err := ta.CreateTorrent(_simulationNamespace, blob.Digest)
+	if err != nil {
+		return fmt.Errorf("create torrent: %s", err)
+	}
+	for i := 0; i < t.NumPieces(); i++ {
+		start := int64(i) * blob.MetaInfo.PieceLength()
+		end := start + t.PieceLength(i)
+		if err := t.WritePiece(piecereader.NewBuffer(blob.Content[start:end]), i); err != nil {
+			return fmt.Errorf("write piece %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// simulationTracker is an in-memory tracker for simulations.
+type simulationTracker struct {
+	interval time.Duration
+	maxPeers int
+
+	mu    sync.Mutex // Protects the following fields.
+	rand  *rand.Rand
+	peers map[core.InfoHash]map[core.PeerID]*core.PeerInfo
+}
+
+func newSimulationTracker(seed int64, interval time.Duration, maxPeers int) *simulationTracker {
+	return &simulationTracker{
+		interval: interval,
+		maxPeers: maxPeers,
+		rand:     rand.New(rand.NewSource(seed)),
+		peers:    make(map[core.InfoHash]map[core.PeerID]*core.PeerInfo),
+	}
+}
+
+// client returns an announceclient.Client which announces as pctx.
+func (t *simulationTracker) client(pctx core.PeerContext) announceclient.Client {
+	return simulationAnnounceClient{t, pctx}
+}
+
+// announce registers peer for the torrent of h, and hands out other peers of
+// the torrent, origins first.
+func (t *simulationTracker) announce(h core.InfoHash, peer *core.PeerInfo) []*core.PeerInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	swarm, ok := t.peers[h]
+	if !ok {
+		swarm = make(map[core.PeerID]*core.PeerInfo)
+		t.peers[h] = swarm
+	}
+	swarm[peer.PeerID] = peer
+
+	var others []*core.PeerInfo
+	for _, p := range swarm {
+		if p.PeerID != peer.PeerID {
+			others = append(others, p)
+		}
+	}
+	// Map iteration order is random, so sort before shuffling to keep handouts
+	// derived from the seed.
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].PeerID.LessThan(others[j].PeerID)
+	})
+	t.rand.Shuffle(len(others), func(i, j int) {
+		others[i], others[j] = others[j], others[i]
+	})
+	sort.SliceStable(others, func(i, j int) bool {
+		return others[i].Origin && !others[j].Origin
+	})
+	if len(others) > t.maxPeers {
+		others = others[:t.maxPeers]
+	}
+	return others
+}
+
+type simulationAnnounceClient struct {
+	tracker *simulationTracker
+	pctx    core.PeerContext
+}
+
+func (c simulationAnnounceClient) CheckReadiness() error {
+	return nil
+}
+
+func (c simulationAnnounceClient) Announce(
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	complete bool,
+	version int) ([]*core.PeerInfo, time.Duration, error) {
+
+	return c.tracker.announce(h, core.PeerInfoFromContext(c.pctx, complete)), c.tracker.interval, nil
+}
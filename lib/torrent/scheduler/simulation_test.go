@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/lib/torrent/scheduler/simnet"
+)
+
+func TestSimulate(t *testing.T) {
+	require := require.New(t)
+
+	report, err := Simulate(SimulationConfig{
+		Scheduler:   configFixture(),
+		Seeders:     1,
+		Leechers:    4,
+		SeederLink:  simnet.LinkConfig{Latency: 5 * time.Millisecond},
+		LeecherLink: simnet.LinkConfig{Latency: 5 * time.Millisecond, BitsPerSec: 8 * 1024 * 1024},
+		BlobSize:    256 * datasize.KB,
+		PieceLength: 32 * datasize.KB,
+		Runs:        2,
+		Timeout:     5 * time.Minute,
+	})
+	require.NoError(err)
+
+	require.Equal(8, report.Downloads)
+	require.Equal(0, report.Failures)
+	require.Len(report.Times, 8)
+
+	// 256KB at 1MB/s takes at least 250ms.
+	require.True(report.Percentile(0) >= 250*time.Millisecond)
+	require.Equal(report.Times[len(report.Times)-1], report.Percentile(1))
+}
+
+func TestSimulationReportPercentile(t *testing.T) {
+	require := require.New(t)
+
+	report := &SimulationReport{}
+	require.Equal(time.Duration(0), report.Percentile(0.5))
+
+	for i := 1; i <= 10; i++ {
+		report.Times = append(report.Times, time.Duration(i)*time.Second)
+	}
+	require.Equal(time.Second, report.Percentile(0))
+	require.Equal(5*time.Second, report.Percentile(0.5))
+	require.Equal(9*time.Second, report.Percentile(0.9))
+	require.Equal(10*time.Second, report.Percentile(1))
+}
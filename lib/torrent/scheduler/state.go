@@ -16,6 +16,7 @@ package scheduler
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/torrent/networkevent"
@@ -35,6 +36,18 @@ type torrentControl struct {
 	dispatcher   *dispatch.Dispatcher
 	errors       []chan error
 	localRequest bool
+
+	// Peers of outgoing conns, which are gossiped via PEX. Peers of incoming
+	// conns are not gossiped, since the address they listen on is unknown.
+	pexPeers map[core.PeerID]*core.PeerInfo
+
+	// Last time a PEX message was received from each peer.
+	pexReceived map[core.PeerID]time.Time
+
+	// Bytes downloaded as of the last web seed tick, from which the download
+	// rate of the torrent is measured.
+	webSeedBytes     int64
+	webSeedCheckedAt time.Time
 }
 
 // state is a superset of scheduler, which includes protected state which can
@@ -52,6 +65,9 @@ type state struct {
 	torrentControls map[core.InfoHash]*torrentControl
 	conns           *connstate.State
 	announceQueue   announcequeue.Queue
+
+	// pipelineLimit overrides the pipeline limit of dispatchers if non-zero.
+	pipelineLimit int
 }
 
 func newState(s *scheduler, aq announcequeue.Queue) *state {
@@ -69,8 +85,12 @@ func newState(s *scheduler, aq announcequeue.Queue) *state {
 func (s *state) addTorrent(
 	namespace string, t storage.Torrent, localRequest bool) (*torrentControl, error) {
 
+	dispatchConfig := s.sched.config.Dispatch
+	if s.pipelineLimit > 0 {
+		dispatchConfig.PipelineLimit = s.pipelineLimit
+	}
 	d, err := dispatch.New(
-		s.sched.config.Dispatch,
+		dispatchConfig,
 		s.sched.stats,
 		s.sched.clock,
 		s.sched.netevents,
@@ -86,6 +106,8 @@ func (s *state) addTorrent(
 		namespace:    namespace,
 		dispatcher:   d,
 		localRequest: localRequest,
+		pexPeers:     make(map[core.PeerID]*core.PeerInfo),
+		pexReceived:  make(map[core.PeerID]time.Time),
 	}
 	s.announceQueue.Add(t.InfoHash())
 	s.sched.netevents.Produce(networkevent.AddTorrentEvent(
@@ -94,6 +116,9 @@ func (s *state) addTorrent(
 		t.Bitfield(),
 		s.sched.config.ConnState.MaxOpenConnectionsPerTorrent))
 	s.torrentControls[t.InfoHash()] = ctrl
+	if err := s.sched.activeTorrents.add(t.InfoHash(), namespace, t.Digest()); err != nil {
+		s.log("torrent", t).Errorf("Error persisting active torrent: %s", err)
+	}
 	return ctrl, nil
 }
 
@@ -116,6 +141,9 @@ func (s *state) removeTorrent(h core.InfoHash, err error) {
 		}
 	}
 	delete(s.torrentControls, h)
+	if err := s.sched.activeTorrents.remove(h); err != nil {
+		s.log("hash", h).Errorf("Error persisting active torrent removal: %s", err)
+	}
 }
 
 // addOutgoingConn adds a conn, initialized by us, to state. The conn must already
@@ -135,6 +163,38 @@ func (s *state) addOutgoingConn(c *conn.Conn, b *bitset.BitSet, info *storage.To
 	return nil
 }
 
+// addPendingPeers opens conns to peers of ctrl's torrent if there is capacity.
+// These connections are added to the scheduler's pending connections and
+// handshaked asynchronously.
+func (s *state) addPendingPeers(ctrl *torrentControl, peers []*core.PeerInfo) {
+	h := ctrl.dispatcher.InfoHash()
+
+	// Prefer connecting to peers with better reputation.
+	peers = append([]*core.PeerInfo(nil), peers...)
+	s.conns.SortByReputation(peers)
+
+	for _, p := range peers {
+		if p.PeerID == s.sched.pctx.PeerID {
+			// Tracker may return our own peer.
+			continue
+		}
+		if s.conns.Blacklisted(p.PeerID, h) {
+			continue
+		}
+		if !p.Origin && s.conns.Banned(p.PeerID) {
+			continue
+		}
+		if err := s.conns.AddPending(p.PeerID, h, nil); err != nil {
+			if err == connstate.ErrTorrentAtCapacity || err == connstate.ErrAtGlobalCapacity {
+				break
+			}
+			continue
+		}
+		go s.sched.initializeOutgoingHandshake(
+			p, ctrl.dispatcher.Stat(), ctrl.dispatcher.RemoteBitfields(), ctrl.namespace)
+	}
+}
+
 // addIncomingConn adds a conn, initialized by a remote peer, to state. The conn
 // must already be in a pending state. Initializes a torrent control if not
 // present.
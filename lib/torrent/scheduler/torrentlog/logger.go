@@ -152,6 +152,53 @@ func (l *Logger) DownloadFailure(namespace string, d core.Digest, size int64, er
 		zap.Error(err))
 }
 
+// PieceIntegrityFailure logs a piece received from a remote peer which failed
+// hash verification. Offenders are all peers which sent corrupt copies of the
+// piece so far.
+func (l *Logger) PieceIntegrityFailure(
+	d core.Digest,
+	infoHash core.InfoHash,
+	remotePeerID core.PeerID,
+	piece int,
+	offset int64,
+	length int64,
+	offenders []core.PeerID) {
+
+	offenderIDs := make([]string, len(offenders))
+	for i, peerID := range offenders {
+		offenderIDs[i] = peerID.String()
+	}
+	l.zap.Warn(
+		"Piece integrity failure",
+		zap.String("name", d.Hex()),
+		zap.String("info_hash", infoHash.String()),
+		zap.String("remote_peer_id", remotePeerID.String()),
+		zap.Int("piece", piece),
+		zap.Int64("offset", offset),
+		zap.Int64("length", length),
+		zap.Strings("offenders", offenderIDs))
+}
+
+// LocalPieceCorrupt logs a local piece which failed hash verification after a
+// remote peer reported receiving a corrupt copy of it.
+func (l *Logger) LocalPieceCorrupt(
+	d core.Digest,
+	infoHash core.InfoHash,
+	remotePeerID core.PeerID,
+	piece int,
+	offset int64,
+	length int64) {
+
+	l.zap.Error(
+		"Local piece corrupt",
+		zap.String("name", d.Hex()),
+		zap.String("info_hash", infoHash.String()),
+		zap.String("remote_peer_id", remotePeerID.String()),
+		zap.Int("piece", piece),
+		zap.Int64("offset", offset),
+		zap.Int64("length", length))
+}
+
 // SeederSummaries logs a summary of the pieces requested and received from peers for a torrent.
 func (l *Logger) SeederSummaries(
 	d core.Digest,
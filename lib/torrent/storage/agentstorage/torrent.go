@@ -190,7 +190,7 @@ func (t *Torrent) writePiece(src storage.PieceReader, pi int) error {
 		return fmt.Errorf("copy: %s", err)
 	}
 	if h.Sum32() != t.metaInfo.GetPieceSum(pi) {
-		return errors.New("invalid piece sum")
+		return storage.ErrInvalidPiece
 	}
 
 	if err := t.markPieceComplete(pi); err != nil {
@@ -232,6 +232,9 @@ func (t *Torrent) WritePiece(src storage.PieceReader, pi int) error {
 	if err := t.writePiece(src, pi); err != nil {
 		// Allow other threads to write this piece since we mysteriously failed.
 		piece.markEmpty()
+		if err == storage.ErrInvalidPiece {
+			return err
+		}
 		return fmt.Errorf("write piece: %s", err)
 	}
 
@@ -269,6 +272,16 @@ func (t *Torrent) GetPieceReader(pi int) (storage.PieceReader, error) {
 	return piecereader.NewFileReader(t.getFileOffset(pi), t.PieceLength(pi), &opener{t}), nil
 }
 
+// VerifyPiece returns storage.ErrInvalidPiece if the content of piece pi on
+// disk does not match its piece sum.
+func (t *Torrent) VerifyPiece(pi int) error {
+	r, err := t.GetPieceReader(pi)
+	if err != nil {
+		return err
+	}
+	return storage.VerifyPiece(r, t.metaInfo.GetPieceSum(pi))
+}
+
 // HasPiece returns if piece pi is complete.
 func (t *Torrent) HasPiece(pi int) bool {
 	piece, err := t.getPiece(pi)
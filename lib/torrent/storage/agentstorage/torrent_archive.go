@@ -21,10 +21,13 @@ import (
 	"github.com/willf/bitset"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/lib/torrent/storage/piecereader"
 	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/utils/log"
 )
 
 // TorrentArchive is capable of initializing torrents in the download directory
@@ -33,19 +36,34 @@ type TorrentArchive struct {
 	stats          tally.Scope
 	cads           *store.CADownloadStore
 	metaInfoClient metainfoclient.Client
+	delta          *delta.Catalog
+}
+
+// Option allows setting optional TorrentArchive parameters.
+type Option func(*TorrentArchive)
+
+// WithDelta configures a TorrentArchive to assemble pieces of new torrents
+// from chunks of similar blobs in catalog.
+func WithDelta(catalog *delta.Catalog) Option {
+	return func(a *TorrentArchive) { a.delta = catalog }
 }
 
 // NewTorrentArchive creates a new TorrentArchive.
 func NewTorrentArchive(
 	stats tally.Scope,
 	cads *store.CADownloadStore,
-	mic metainfoclient.Client) *TorrentArchive {
+	mic metainfoclient.Client,
+	opts ...Option) *TorrentArchive {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "agenttorrentarchive",
 	})
 
-	return &TorrentArchive{stats, cads, mic}
+	a := &TorrentArchive{stats: stats, cads: cads, metaInfoClient: mic}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // Stat returns TorrentInfo for the given digest. Returns os.ErrNotExist if the
@@ -57,7 +75,19 @@ func (a *TorrentArchive) Stat(namespace string, d core.Digest) (*storage.Torrent
 	}
 	var psm pieceStatusMetadata
 	if err := a.cads.Any().GetMetadata(d.Hex(), &psm); err != nil {
-		return nil, err
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		// Blobs which were added to the cache without a torrent, e.g. preloaded
+		// blobs, have no piece statuses but are complete.
+		if _, err := a.cads.Cache().GetFileStat(d.Hex()); err != nil {
+			return nil, err
+		}
+		b := bitset.New(uint(tm.MetaInfo.NumPieces()))
+		for i := 0; i < tm.MetaInfo.NumPieces(); i++ {
+			b.Set(uint(i))
+		}
+		return storage.NewTorrentInfo(tm.MetaInfo, b), nil
 	}
 	b := bitset.New(uint(len(psm.pieces)))
 	for i, p := range psm.pieces {
@@ -73,6 +103,7 @@ func (a *TorrentArchive) Stat(namespace string, d core.Digest) (*storage.Torrent
 // if no metainfo was found.
 func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage.Torrent, error) {
 	var tm metadata.TorrentMeta
+	var created bool
 	if err := a.cads.Any().GetMetadata(d.Hex(), &tm); os.IsNotExist(err) {
 		downloadTimer := a.stats.Timer("metainfo_download").Start()
 		mi, err := a.metaInfoClient.Download(namespace, d)
@@ -94,6 +125,7 @@ func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage
 			!a.cads.InDownloadError(createErr) && !a.cads.InCacheError(createErr) {
 			return nil, fmt.Errorf("create download file: %s", createErr)
 		}
+		created = createErr == nil
 		tm.MetaInfo = mi
 		if err := a.cads.Any().GetOrSetMetadata(d.Hex(), &tm); err != nil {
 			return nil, fmt.Errorf("get or set metainfo: %s", err)
@@ -105,9 +137,54 @@ func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage
 	if err != nil {
 		return nil, fmt.Errorf("initialize torrent: %s", err)
 	}
+	if created && a.delta != nil {
+		a.applyDelta(namespace, t)
+	}
 	return t, nil
 }
 
+// applyDelta writes the pieces of t which can be assembled from chunks of
+// similar blobs, and makes the chunks of t available to future torrents.
+func (a *TorrentArchive) applyDelta(namespace string, t *Torrent) {
+	d := t.Digest()
+	idx, err := a.metaInfoClient.DownloadChunkIndex(namespace, d)
+	if err != nil {
+		if err != metainfoclient.ErrChunkIndexNotFound {
+			log.With("digest", d.Hex()).Errorf("Error downloading chunk index: %s", err)
+		}
+		return
+	}
+	if idx.Length() != t.Length() {
+		log.With("digest", d.Hex()).Errorf(
+			"Chunk index length %d does not match torrent length %d", idx.Length(), t.Length())
+		return
+	}
+
+	timer := a.stats.Timer("delta_assemble").Start()
+	var assembled int64
+	for _, pi := range t.MissingPieces() {
+		start := t.getFileOffset(pi)
+		b, err := a.delta.Read(idx, start, start+t.PieceLength(pi), a.openCacheFile)
+		if err != nil {
+			// Chunks of this piece are not available locally.
+			continue
+		}
+		if err := t.WritePiece(piecereader.NewBuffer(b), pi); err != nil {
+			log.With("digest", d.Hex(), "piece", pi).Errorf("Error writing assembled piece: %s", err)
+			continue
+		}
+		assembled++
+	}
+	timer.Stop()
+	a.stats.Counter("delta_pieces").Inc(assembled)
+
+	a.delta.Add(d, idx)
+}
+
+func (a *TorrentArchive) openCacheFile(d core.Digest) (delta.Blob, error) {
+	return a.cads.Cache().GetFileReader(d.Hex())
+}
+
 // GetTorrent returns a Torrent for an existing metainfo / file on disk. Ignores namespace.
 func (a *TorrentArchive) GetTorrent(namespace string, d core.Digest) (storage.Torrent, error) {
 	var tm metadata.TorrentMeta
@@ -14,11 +14,13 @@
 package agentstorage
 
 import (
+	"bytes"
 	"os"
 	"sync"
 	"testing"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/lib/torrent/storage"
@@ -26,6 +28,7 @@ import (
 	mockmetainfoclient "github.com/uber/kraken/mocks/tracker/metainfoclient"
 	"github.com/uber/kraken/tracker/metainfoclient"
 	"github.com/uber/kraken/utils/bitsetutil"
+	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/golang/mock/gomock"
@@ -81,6 +84,32 @@ func TestTorrentArchiveStatBitfield(t *testing.T) {
 	require.Equal(int64(1), info.MaxPieceLength())
 }
 
+func TestTorrentArchiveStatPreloadedBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newArchiveMocks(t)
+	defer cleanup()
+
+	archive := mocks.new()
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(4, 1)
+	mi := blob.MetaInfo
+
+	// Blob is in the cache without piece statuses.
+	require.NoError(store.RunDownload(mocks.cads, mi.Digest(), blob.Content))
+
+	mocks.metaInfoClient.EXPECT().Download(namespace, mi.Digest()).Return(mi, nil).Times(1)
+
+	tor, err := archive.CreateTorrent(namespace, mi.Digest())
+	require.NoError(err)
+	require.True(tor.Complete())
+
+	info, err := archive.Stat(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(bitsetutil.FromBools(true, true, true, true), info.Bitfield())
+}
+
 func TestTorrentArchiveStatNotExist(t *testing.T) {
 	require := require.New(t)
 
@@ -124,6 +153,67 @@ func TestTorrentArchiveCreateTorrent(t *testing.T) {
 	require.NotNil(tor)
 }
 
+func deltaBlobFixture(content []byte, pieceLength int64) *core.BlobFixture {
+	d, err := core.NewDigester().FromBytes(content)
+	if err != nil {
+		panic(err)
+	}
+	mi, err := core.NewMetaInfo(d, bytes.NewReader(content), pieceLength)
+	if err != nil {
+		panic(err)
+	}
+	return core.CustomBlobFixture(content, d, mi)
+}
+
+func TestTorrentArchiveCreateTorrentAppliesDelta(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newArchiveMocks(t)
+	defer cleanup()
+
+	archive := NewTorrentArchive(
+		tally.NoopScope, mocks.cads, mocks.metaInfoClient,
+		WithDelta(delta.NewCatalog(delta.Config{Enabled: true})))
+
+	namespace := core.TagFixture()
+	indexConfig := delta.IndexConfig{
+		Enabled:      true,
+		MinChunkSize: 256,
+		AvgChunkSize: 1024,
+		MaxChunkSize: 4096,
+	}
+
+	// The target blob replaces the middle of the source blob.
+	source := deltaBlobFixture(randutil.Text(64*1024), 4*1024)
+	content := make([]byte, len(source.Content))
+	copy(content, source.Content)
+	copy(content[32*1024:], randutil.Text(1024))
+	target := deltaBlobFixture(content, 4*1024)
+
+	for _, blob := range []*core.BlobFixture{source, target} {
+		idx, err := delta.BuildIndex(bytes.NewReader(blob.Content), indexConfig)
+		require.NoError(err)
+		mocks.metaInfoClient.EXPECT().Download(namespace, blob.Digest).Return(blob.MetaInfo, nil)
+		mocks.metaInfoClient.EXPECT().DownloadChunkIndex(namespace, blob.Digest).Return(idx, nil)
+	}
+
+	tor, err := archive.CreateTorrent(namespace, source.Digest)
+	require.NoError(err)
+	require.Len(tor.MissingPieces(), tor.NumPieces())
+	for i := 0; i < tor.NumPieces(); i++ {
+		start := int64(i) * 4 * 1024
+		require.NoError(tor.WritePiece(
+			piecereader.NewBuffer(source.Content[start:start+tor.PieceLength(i)]), i))
+	}
+	require.True(tor.Complete())
+
+	tor, err = archive.CreateTorrent(namespace, target.Digest)
+	require.NoError(err)
+	require.True(tor.HasPiece(0))
+	require.False(tor.HasPiece(8))
+	require.True(tor.HasPiece(tor.NumPieces() - 1))
+}
+
 func TestTorrentArchiveCreateTorrentNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -120,6 +120,28 @@ func TestTorrentWriteComplete(t *testing.T) {
 	require.Equal(storage.ErrPieceComplete, tor.WritePiece(piecereader.NewBuffer(blob.Content[:1]), 0))
 }
 
+func TestTorrentWriteInvalidPiece(t *testing.T) {
+	require := require.New(t)
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(1, 1)
+
+	prepareStore(cads, blob.MetaInfo)
+
+	tor, err := NewTorrent(cads, blob.MetaInfo)
+	require.NoError(err)
+
+	invalid := []byte{blob.Content[0] + 1}
+	require.Equal(storage.ErrInvalidPiece, tor.WritePiece(piecereader.NewBuffer(invalid), 0))
+	require.False(tor.Complete())
+
+	// The piece may be written again once the invalid write failed.
+	require.NoError(tor.WritePiece(piecereader.NewBuffer(blob.Content), 0))
+	require.True(tor.Complete())
+}
+
 func TestTorrentWriteMultiplePieceConcurrent(t *testing.T) {
 	require := require.New(t)
 
@@ -124,6 +124,16 @@ func (t *Torrent) GetPieceReader(pi int) (storage.PieceReader, error) {
 	return piecereader.NewFileReader(t.getFileOffset(pi), t.PieceLength(pi), &opener{t}), nil
 }
 
+// VerifyPiece returns storage.ErrInvalidPiece if the content of piece pi on
+// disk does not match its piece sum.
+func (t *Torrent) VerifyPiece(pi int) error {
+	r, err := t.GetPieceReader(pi)
+	if err != nil {
+		return err
+	}
+	return storage.VerifyPiece(r, t.metaInfo.GetPieceSum(pi))
+}
+
 // HasPiece returns if piece pi is complete.
 // For Torrent it's always true.
 func (t *Torrent) HasPiece(pi int) bool {
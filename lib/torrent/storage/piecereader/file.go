@@ -45,22 +45,45 @@ func NewFileReader(offset, length int64, opener Opener) *FileReader {
 	}
 }
 
+func (r *FileReader) open() (store.FileReader, error) {
+	f, err := r.opener.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open: %s", err)
+	}
+	r.closer = f
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek: %s", err)
+	}
+	return f, nil
+}
+
 // Read reads a piece in p.
 func (r *FileReader) Read(p []byte) (int, error) {
 	if r.reader == nil {
-		f, err := r.opener.Open()
+		f, err := r.open()
 		if err != nil {
-			return 0, fmt.Errorf("open: %s", err)
-		}
-		if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
-			return 0, fmt.Errorf("seek: %s", err)
+			return 0, err
 		}
 		r.reader = io.LimitReader(f, r.length)
-		r.closer = f
 	}
 	return r.reader.Read(p)
 }
 
+// WriteTo writes the piece to w. Unless the piece was partially read already,
+// it is copied from the file to sockets without passing through user space.
+func (r *FileReader) WriteTo(w io.Writer) (int64, error) {
+	if r.reader != nil {
+		return io.Copy(w, r.reader)
+	}
+	f, err := r.open()
+	if err != nil {
+		return 0, err
+	}
+	n, err := store.CopyN(w, f, r.length)
+	r.reader = io.LimitReader(f, r.length-n)
+	return n, err
+}
+
 // Close closes the underlying file.
 func (r *FileReader) Close() error {
 	if r.closer == nil {
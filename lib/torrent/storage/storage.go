@@ -15,9 +15,11 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/closers"
 
 	"github.com/willf/bitset"
 )
@@ -29,6 +31,10 @@ var ErrNotFound = errors.New("torrent not found")
 // complete.
 var ErrPieceComplete = errors.New("piece is already complete")
 
+// ErrInvalidPiece occurs when Torrent cannot write a piece because its content
+// does not match the piece sum of the torrent.
+var ErrInvalidPiece = errors.New("invalid piece sum")
+
 // PieceReader defines operations for lazy piece reading.
 type PieceReader interface {
 	io.ReadCloser
@@ -54,6 +60,25 @@ type Torrent interface {
 
 	WritePiece(src PieceReader, piece int) error
 	GetPieceReader(piece int) (PieceReader, error)
+
+	// VerifyPiece re-reads a complete piece and returns ErrInvalidPiece if it
+	// does not match its piece sum.
+	VerifyPiece(piece int) error
+}
+
+// VerifyPiece reads src and returns ErrInvalidPiece if its piece sum does not
+// match sum. Closes src.
+func VerifyPiece(src PieceReader, sum uint32) error {
+	defer closers.Close(src)
+
+	h := core.PieceHash()
+	if _, err := io.Copy(h, src); err != nil {
+		return fmt.Errorf("read piece: %s", err)
+	}
+	if h.Sum32() != sum {
+		return ErrInvalidPiece
+	}
+	return nil
 }
 
 // TorrentArchive creates and open torrent file
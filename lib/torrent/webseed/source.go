@@ -0,0 +1,77 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package webseed fetches pieces of torrents over HTTP when the swarm cannot
+// provide them fast enough.
+package webseed
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// Source fetches byte ranges of blobs from outside of the swarm.
+type Source interface {
+	DownloadRange(namespace string, d core.Digest, offset, length int64, dst io.Writer) error
+}
+
+// OriginSource fetches byte ranges of blobs from the download endpoint of an
+// origin cluster using range requests. If an origin does not have the blob
+// cached, it starts downloading the blob from its storage backend and the
+// request fails with a 202 httputil.StatusError, so it should be retried later.
+type OriginSource struct {
+	addr    string
+	timeout time.Duration
+	tls     *tls.Config
+}
+
+// NewOriginSource creates a new OriginSource for the origin cluster at addr.
+func NewOriginSource(addr string, timeout time.Duration, tls *tls.Config) *OriginSource {
+	return &OriginSource{addr, timeout, tls}
+}
+
+// DownloadRange writes length bytes of the blob of d, starting at offset, to
+// dst.
+func (s *OriginSource) DownloadRange(
+	namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+
+	if offset < 0 || length <= 0 {
+		return fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	r, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", s.addr, url.PathEscape(namespace), d),
+		httputil.SendHeaders(map[string]string{
+			"Range": fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+		}),
+		httputil.SendAcceptedCodes(http.StatusPartialContent),
+		httputil.SendTimeout(s.timeout),
+		httputil.SendTLS(s.tls))
+	if err != nil {
+		return err
+	}
+	defer closers.Close(r.Body)
+
+	n, err := io.CopyN(dst, r.Body, length)
+	if err != nil {
+		return fmt.Errorf("copy body: read %d of %d bytes: %s", n, length, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webseed
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginSourceDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/namespace/foo%2Fbar/blobs/"+blob.Digest.String(), r.URL.EscapedPath())
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob.Content))
+	}))
+	defer server.Close()
+
+	s := NewOriginSource(strings.TrimPrefix(server.URL, "http://"), time.Second, nil)
+
+	var b bytes.Buffer
+	require.NoError(s.DownloadRange("foo/bar", blob.Digest, 2, 5, &b))
+	require.Equal(blob.Content[2:7], b.Bytes())
+}
+
+func TestOriginSourceDownloadRangeRequiresPartialContent(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(blob.Content)
+	}))
+	defer server.Close()
+
+	s := NewOriginSource(strings.TrimPrefix(server.URL, "http://"), time.Second, nil)
+
+	var b bytes.Buffer
+	require.Error(s.DownloadRange("foo", blob.Digest, 0, 5, &b))
+}
+
+func TestOriginSourceDownloadRangeInvalidRange(t *testing.T) {
+	s := NewOriginSource("localhost:0", time.Second, nil)
+
+	var b bytes.Buffer
+	require.Error(t, s.DownloadRange("foo", core.DigestFixture(), 0, 0, &b))
+}
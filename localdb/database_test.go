@@ -54,6 +54,7 @@ func TestNew(t *testing.T) {
 					WHERE type='table' AND name NOT LIKE 'goose_%'
 					ORDER BY name`)
 				require.NoError(t, err)
+				assert.Contains(t, tables, "mirror_task")
 				assert.Contains(t, tables, "replicate_tag_task")
 				assert.Contains(t, tables, "writeback_task")
 			},
@@ -0,0 +1,48 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+func init() {
+	goose.AddMigration(up00005, down00005)
+}
+
+func up00005(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS tagevent_task (
+			id           integer   PRIMARY KEY AUTOINCREMENT,
+			sink         text      NOT NULL,
+			type         text      NOT NULL,
+			tag          text      NOT NULL,
+			digest       blob      NOT NULL,
+			cluster      text      NOT NULL,
+			replicated   boolean   NOT NULL,
+			created_at   timestamp NOT NULL,
+			last_attempt timestamp NOT NULL,
+			status       text      NOT NULL,
+			failures     integer   NOT NULL
+		);
+	`)
+	return err
+}
+
+func down00005(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE tagevent_task;`)
+	return err
+}
@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	agentmodels "github.com/uber/kraken/agent/agentmodels"
 	core "github.com/uber/kraken/core"
 )
 
@@ -50,6 +51,21 @@ func (mr *MockClientMockRecorder) Download(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockClient)(nil).Download), arg0, arg1)
 }
 
+// GetPrefetch mocks base method
+func (m *MockClient) GetPrefetch(arg0 string) (*agentmodels.PrefetchStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPrefetch", arg0)
+	ret0, _ := ret[0].(*agentmodels.PrefetchStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPrefetch indicates an expected call of GetPrefetch
+func (mr *MockClientMockRecorder) GetPrefetch(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPrefetch", reflect.TypeOf((*MockClient)(nil).GetPrefetch), arg0)
+}
+
 // GetTag mocks base method
 func (m *MockClient) GetTag(arg0 string) (core.Digest, error) {
 	m.ctrl.T.Helper()
@@ -64,3 +80,32 @@ func (mr *MockClientMockRecorder) GetTag(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTag", reflect.TypeOf((*MockClient)(nil).GetTag), arg0)
 }
+
+// Prefetch mocks base method
+func (m *MockClient) Prefetch(arg0 agentmodels.PrefetchRequest) (*agentmodels.PrefetchStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prefetch", arg0)
+	ret0, _ := ret[0].(*agentmodels.PrefetchStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prefetch indicates an expected call of Prefetch
+func (mr *MockClientMockRecorder) Prefetch(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prefetch", reflect.TypeOf((*MockClient)(nil).Prefetch), arg0)
+}
+
+// Seed mocks base method
+func (m *MockClient) Seed(arg0 string, arg1 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Seed", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Seed indicates an expected call of Seed
+func (mr *MockClientMockRecorder) Seed(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seed", reflect.TypeOf((*MockClient)(nil).Seed), arg0, arg1)
+}
@@ -43,6 +43,20 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// CheckPolicy mocks base method.
+func (m *MockClient) CheckPolicy(tag string, d core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckPolicy", tag, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckPolicy indicates an expected call of CheckPolicy.
+func (mr *MockClientMockRecorder) CheckPolicy(tag, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckPolicy", reflect.TypeOf((*MockClient)(nil).CheckPolicy), tag, d)
+}
+
 // CheckReadiness mocks base method.
 func (m *MockClient) CheckReadiness() error {
 	m.ctrl.T.Helper()
@@ -57,6 +71,34 @@ func (mr *MockClientMockRecorder) CheckReadiness() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckReadiness", reflect.TypeOf((*MockClient)(nil).CheckReadiness))
 }
 
+// Delete mocks base method.
+func (m *MockClient) Delete(tag string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", tag)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockClientMockRecorder) Delete(tag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockClient)(nil).Delete), tag)
+}
+
+// DuplicateDelete mocks base method.
+func (m *MockClient) DuplicateDelete(tag string, deletedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DuplicateDelete", tag, deletedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DuplicateDelete indicates an expected call of DuplicateDelete.
+func (mr *MockClientMockRecorder) DuplicateDelete(tag, deletedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicateDelete", reflect.TypeOf((*MockClient)(nil).DuplicateDelete), tag, deletedAt)
+}
+
 // DuplicatePut mocks base method.
 func (m *MockClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
 	m.ctrl.T.Helper()
@@ -115,6 +157,21 @@ func (mr *MockClientMockRecorder) Has(tag interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Has", reflect.TypeOf((*MockClient)(nil).Has), tag)
 }
 
+// History mocks base method.
+func (m *MockClient) History(tag string) ([]tagmodels.Version, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", tag)
+	ret0, _ := ret[0].([]tagmodels.Version)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockClientMockRecorder) History(tag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockClient)(nil).History), tag)
+}
+
 // List mocks base method.
 func (m *MockClient) List(prefix string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -218,6 +275,21 @@ func (mr *MockClientMockRecorder) PutAndReplicate(tag, d interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAndReplicate", reflect.TypeOf((*MockClient)(nil).PutAndReplicate), tag, d)
 }
 
+// Reachable mocks base method.
+func (m *MockClient) Reachable() (*tagmodels.ReachableResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reachable")
+	ret0, _ := ret[0].(*tagmodels.ReachableResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reachable indicates an expected call of Reachable.
+func (mr *MockClientMockRecorder) Reachable() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reachable", reflect.TypeOf((*MockClient)(nil).Reachable))
+}
+
 // Replicate mocks base method.
 func (m *MockClient) Replicate(tag string) error {
 	m.ctrl.T.Helper()
@@ -231,3 +303,45 @@ func (mr *MockClientMockRecorder) Replicate(tag interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replicate", reflect.TypeOf((*MockClient)(nil).Replicate), tag)
 }
+
+// ReplicateDelete mocks base method.
+func (m *MockClient) ReplicateDelete(tag string, d core.Digest, deletedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicateDelete", tag, d, deletedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplicateDelete indicates an expected call of ReplicateDelete.
+func (mr *MockClientMockRecorder) ReplicateDelete(tag, d, deletedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicateDelete", reflect.TypeOf((*MockClient)(nil).ReplicateDelete), tag, d, deletedAt)
+}
+
+// ReplicatePut mocks base method.
+func (m *MockClient) ReplicatePut(tag string, d core.Digest, createdAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicatePut", tag, d, createdAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplicatePut indicates an expected call of ReplicatePut.
+func (mr *MockClientMockRecorder) ReplicatePut(tag, d, createdAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicatePut", reflect.TypeOf((*MockClient)(nil).ReplicatePut), tag, d, createdAt)
+}
+
+// Rollback mocks base method.
+func (m *MockClient) Rollback(tag string, d core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollback", tag, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rollback indicates an expected call of Rollback.
+func (mr *MockClientMockRecorder) Rollback(tag, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockClient)(nil).Rollback), tag, d)
+}
@@ -50,6 +50,20 @@ func (mr *MockFileStoreMockRecorder) CreateCacheFile(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCacheFile", reflect.TypeOf((*MockFileStore)(nil).CreateCacheFile), arg0, arg1)
 }
 
+// DeleteCacheFileMetadata mocks base method
+func (m *MockFileStore) DeleteCacheFileMetadata(arg0 string, arg1 metadata.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCacheFileMetadata", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCacheFileMetadata indicates an expected call of DeleteCacheFileMetadata
+func (mr *MockFileStoreMockRecorder) DeleteCacheFileMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCacheFileMetadata", reflect.TypeOf((*MockFileStore)(nil).DeleteCacheFileMetadata), arg0, arg1)
+}
+
 // GetCacheFileReader mocks base method
 func (m *MockFileStore) GetCacheFileReader(arg0 string) (base.FileReader, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +79,20 @@ func (mr *MockFileStoreMockRecorder) GetCacheFileReader(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheFileReader", reflect.TypeOf((*MockFileStore)(nil).GetCacheFileReader), arg0)
 }
 
+// ReplaceCacheFile mocks base method
+func (m *MockFileStore) ReplaceCacheFile(arg0 string, arg1 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceCacheFile", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceCacheFile indicates an expected call of ReplaceCacheFile
+func (mr *MockFileStoreMockRecorder) ReplaceCacheFile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceCacheFile", reflect.TypeOf((*MockFileStore)(nil).ReplaceCacheFile), arg0, arg1)
+}
+
 // SetCacheFileMetadata mocks base method
 func (m *MockFileStore) SetCacheFileMetadata(arg0 string, arg1 metadata.Metadata) (bool, error) {
 	m.ctrl.T.Helper()
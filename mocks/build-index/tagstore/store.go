@@ -9,6 +9,7 @@ import (
 	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	tagmodels "github.com/uber/kraken/build-index/tagmodels"
 	core "github.com/uber/kraken/core"
 )
 
@@ -35,6 +36,35 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method
+func (m *MockStore) Delete(arg0 string, arg1 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockStoreMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStore)(nil).Delete), arg0, arg1)
+}
+
+// DeletedAt mocks base method
+func (m *MockStore) DeletedAt(arg0 string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletedAt", arg0)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletedAt indicates an expected call of DeletedAt
+func (mr *MockStoreMockRecorder) DeletedAt(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletedAt", reflect.TypeOf((*MockStore)(nil).DeletedAt), arg0)
+}
+
 // Get mocks base method
 func (m *MockStore) Get(arg0 string) (core.Digest, error) {
 	m.ctrl.T.Helper()
@@ -50,6 +80,21 @@ func (mr *MockStoreMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStore)(nil).Get), arg0)
 }
 
+// History mocks base method
+func (m *MockStore) History(arg0 string) ([]tagmodels.Version, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", arg0)
+	ret0, _ := ret[0].([]tagmodels.Version)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History
+func (mr *MockStoreMockRecorder) History(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockStore)(nil).History), arg0)
+}
+
 // Put mocks base method
 func (m *MockStore) Put(arg0 string, arg1 core.Digest, arg2 time.Duration) error {
 	m.ctrl.T.Helper()
@@ -36,6 +36,20 @@ func (m *MockGCS) EXPECT() *MockGCSMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method
+func (m *MockGCS) Delete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockGCSMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockGCS)(nil).Delete), arg0)
+}
+
 // Download mocks base method
 func (m *MockGCS) Download(arg0 string, arg1 io.Writer) (int64, error) {
 	m.ctrl.T.Helper()
@@ -51,6 +65,21 @@ func (mr *MockGCSMockRecorder) Download(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockGCS)(nil).Download), arg0, arg1)
 }
 
+// DownloadRange mocks base method
+func (m *MockGCS) DownloadRange(arg0 string, arg1, arg2 int64, arg3 io.Writer) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadRange", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DownloadRange indicates an expected call of DownloadRange
+func (mr *MockGCSMockRecorder) DownloadRange(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadRange", reflect.TypeOf((*MockGCS)(nil).DownloadRange), arg0, arg1, arg2, arg3)
+}
+
 // GetObjectIterator mocks base method
 func (m *MockGCS) GetObjectIterator(arg0 string) iterator.Pageable {
 	m.ctrl.T.Helper()
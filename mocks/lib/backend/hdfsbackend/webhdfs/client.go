@@ -49,6 +49,20 @@ func (mr *MockClientMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockClient)(nil).Create), arg0, arg1)
 }
 
+// Delete mocks base method
+func (m *MockClient) Delete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockClientMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockClient)(nil).Delete), arg0)
+}
+
 // GetFileStatus mocks base method
 func (m *MockClient) GetFileStatus(arg0 string) (webhdfs.FileStatus, error) {
 	m.ctrl.T.Helper()
@@ -107,6 +121,20 @@ func (mr *MockClientMockRecorder) Open(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Open", reflect.TypeOf((*MockClient)(nil).Open), arg0, arg1)
 }
 
+// OpenRange mocks base method
+func (m *MockClient) OpenRange(arg0 string, arg1, arg2 int64, arg3 io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenRange", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// OpenRange indicates an expected call of OpenRange
+func (mr *MockClientMockRecorder) OpenRange(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenRange", reflect.TypeOf((*MockClient)(nil).OpenRange), arg0, arg1, arg2, arg3)
+}
+
 // Rename mocks base method
 func (m *MockClient) Rename(arg0, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -5,6 +5,7 @@
 package mocktransfer
 
 import (
+	io "io"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -35,6 +36,20 @@ func (m *MockImageTransferer) EXPECT() *MockImageTransfererMockRecorder {
 	return m.recorder
 }
 
+// CheckTag mocks base method
+func (m *MockImageTransferer) CheckTag(arg0 string, arg1 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckTag", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckTag indicates an expected call of CheckTag
+func (mr *MockImageTransfererMockRecorder) CheckTag(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckTag", reflect.TypeOf((*MockImageTransferer)(nil).CheckTag), arg0, arg1)
+}
+
 // Download mocks base method
 func (m *MockImageTransferer) Download(arg0 string, arg1 core.Digest) (base.FileReader, error) {
 	m.ctrl.T.Helper()
@@ -50,6 +65,21 @@ func (mr *MockImageTransfererMockRecorder) Download(arg0, arg1 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockImageTransferer)(nil).Download), arg0, arg1)
 }
 
+// DownloadRange mocks base method
+func (m *MockImageTransferer) DownloadRange(arg0 string, arg1 core.Digest, arg2 int64) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadRange", arg0, arg1, arg2)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DownloadRange indicates an expected call of DownloadRange
+func (mr *MockImageTransfererMockRecorder) DownloadRange(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadRange", reflect.TypeOf((*MockImageTransferer)(nil).DownloadRange), arg0, arg1, arg2)
+}
+
 // GetTag mocks base method
 func (m *MockImageTransferer) GetTag(arg0 string) (core.Digest, error) {
 	m.ctrl.T.Helper()
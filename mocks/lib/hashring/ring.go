@@ -85,3 +85,17 @@ func (mr *MockRingMockRecorder) Refresh() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockRing)(nil).Refresh))
 }
+
+// ReplicaLocations mocks base method
+func (m *MockRing) ReplicaLocations(arg0 core.Digest, arg1 int) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicaLocations", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// ReplicaLocations indicates an expected call of ReplicaLocations
+func (mr *MockRingMockRecorder) ReplicaLocations(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicaLocations", reflect.TypeOf((*MockRing)(nil).ReplicaLocations), arg0, arg1)
+}
@@ -10,6 +10,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
 	scheduler "github.com/uber/kraken/lib/torrent/scheduler"
+	conn "github.com/uber/kraken/lib/torrent/scheduler/conn"
 	connstate "github.com/uber/kraken/lib/torrent/scheduler/connstate"
 )
 
@@ -65,6 +66,48 @@ func (mr *MockReloadableSchedulerMockRecorder) Download(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockReloadableScheduler)(nil).Download), arg0, arg1)
 }
 
+// DownloadWithPriority mocks base method
+func (m *MockReloadableScheduler) DownloadWithPriority(arg0 string, arg1 core.Digest, arg2 scheduler.Priority) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadWithPriority", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DownloadWithPriority indicates an expected call of DownloadWithPriority
+func (mr *MockReloadableSchedulerMockRecorder) DownloadWithPriority(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadWithPriority", reflect.TypeOf((*MockReloadableScheduler)(nil).DownloadWithPriority), arg0, arg1, arg2)
+}
+
+// NamespaceBandwidth mocks base method
+func (m *MockReloadableScheduler) NamespaceBandwidth() []conn.NamespaceBandwidthConfig {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NamespaceBandwidth")
+	ret0, _ := ret[0].([]conn.NamespaceBandwidthConfig)
+	return ret0
+}
+
+// NamespaceBandwidth indicates an expected call of NamespaceBandwidth
+func (mr *MockReloadableSchedulerMockRecorder) NamespaceBandwidth() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NamespaceBandwidth", reflect.TypeOf((*MockReloadableScheduler)(nil).NamespaceBandwidth))
+}
+
+// PrioritizeRange mocks base method
+func (m *MockReloadableScheduler) PrioritizeRange(arg0 core.Digest, arg1, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PrioritizeRange", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PrioritizeRange indicates an expected call of PrioritizeRange
+func (mr *MockReloadableSchedulerMockRecorder) PrioritizeRange(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PrioritizeRange", reflect.TypeOf((*MockReloadableScheduler)(nil).PrioritizeRange), arg0, arg1, arg2)
+}
+
 // Probe mocks base method
 func (m *MockReloadableScheduler) Probe() error {
 	m.ctrl.T.Helper()
@@ -105,6 +148,49 @@ func (mr *MockReloadableSchedulerMockRecorder) RemoveTorrent(arg0 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveTorrent", reflect.TypeOf((*MockReloadableScheduler)(nil).RemoveTorrent), arg0)
 }
 
+// ReputationSnapshot mocks base method
+func (m *MockReloadableScheduler) ReputationSnapshot() ([]connstate.PeerReputation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReputationSnapshot")
+	ret0, _ := ret[0].([]connstate.PeerReputation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReputationSnapshot indicates an expected call of ReputationSnapshot
+func (mr *MockReloadableSchedulerMockRecorder) ReputationSnapshot() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReputationSnapshot", reflect.TypeOf((*MockReloadableScheduler)(nil).ReputationSnapshot))
+}
+
+// Seed mocks base method
+func (m *MockReloadableScheduler) Seed(arg0 string, arg1 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Seed", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Seed indicates an expected call of Seed
+func (mr *MockReloadableSchedulerMockRecorder) Seed(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seed", reflect.TypeOf((*MockReloadableScheduler)(nil).Seed), arg0, arg1)
+}
+
+// SetNamespaceBandwidth mocks base method
+func (m *MockReloadableScheduler) SetNamespaceBandwidth(arg0 []conn.NamespaceBandwidthConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetNamespaceBandwidth", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetNamespaceBandwidth indicates an expected call of SetNamespaceBandwidth
+func (mr *MockReloadableSchedulerMockRecorder) SetNamespaceBandwidth(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNamespaceBandwidth", reflect.TypeOf((*MockReloadableScheduler)(nil).SetNamespaceBandwidth), arg0)
+}
+
 // Stop mocks base method
 func (m *MockReloadableScheduler) Stop() {
 	m.ctrl.T.Helper()
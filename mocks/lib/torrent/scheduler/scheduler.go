@@ -9,6 +9,8 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	scheduler "github.com/uber/kraken/lib/torrent/scheduler"
+	conn "github.com/uber/kraken/lib/torrent/scheduler/conn"
 	connstate "github.com/uber/kraken/lib/torrent/scheduler/connstate"
 )
 
@@ -64,6 +66,48 @@ func (mr *MockSchedulerMockRecorder) Download(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockScheduler)(nil).Download), arg0, arg1)
 }
 
+// DownloadWithPriority mocks base method
+func (m *MockScheduler) DownloadWithPriority(arg0 string, arg1 core.Digest, arg2 scheduler.Priority) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadWithPriority", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DownloadWithPriority indicates an expected call of DownloadWithPriority
+func (mr *MockSchedulerMockRecorder) DownloadWithPriority(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadWithPriority", reflect.TypeOf((*MockScheduler)(nil).DownloadWithPriority), arg0, arg1, arg2)
+}
+
+// NamespaceBandwidth mocks base method
+func (m *MockScheduler) NamespaceBandwidth() []conn.NamespaceBandwidthConfig {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NamespaceBandwidth")
+	ret0, _ := ret[0].([]conn.NamespaceBandwidthConfig)
+	return ret0
+}
+
+// NamespaceBandwidth indicates an expected call of NamespaceBandwidth
+func (mr *MockSchedulerMockRecorder) NamespaceBandwidth() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NamespaceBandwidth", reflect.TypeOf((*MockScheduler)(nil).NamespaceBandwidth))
+}
+
+// PrioritizeRange mocks base method
+func (m *MockScheduler) PrioritizeRange(arg0 core.Digest, arg1, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PrioritizeRange", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PrioritizeRange indicates an expected call of PrioritizeRange
+func (mr *MockSchedulerMockRecorder) PrioritizeRange(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PrioritizeRange", reflect.TypeOf((*MockScheduler)(nil).PrioritizeRange), arg0, arg1, arg2)
+}
+
 // Probe mocks base method
 func (m *MockScheduler) Probe() error {
 	m.ctrl.T.Helper()
@@ -92,6 +136,49 @@ func (mr *MockSchedulerMockRecorder) RemoveTorrent(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveTorrent", reflect.TypeOf((*MockScheduler)(nil).RemoveTorrent), arg0)
 }
 
+// ReputationSnapshot mocks base method
+func (m *MockScheduler) ReputationSnapshot() ([]connstate.PeerReputation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReputationSnapshot")
+	ret0, _ := ret[0].([]connstate.PeerReputation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReputationSnapshot indicates an expected call of ReputationSnapshot
+func (mr *MockSchedulerMockRecorder) ReputationSnapshot() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReputationSnapshot", reflect.TypeOf((*MockScheduler)(nil).ReputationSnapshot))
+}
+
+// Seed mocks base method
+func (m *MockScheduler) Seed(arg0 string, arg1 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Seed", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Seed indicates an expected call of Seed
+func (mr *MockSchedulerMockRecorder) Seed(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seed", reflect.TypeOf((*MockScheduler)(nil).Seed), arg0, arg1)
+}
+
+// SetNamespaceBandwidth mocks base method
+func (m *MockScheduler) SetNamespaceBandwidth(arg0 []conn.NamespaceBandwidthConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetNamespaceBandwidth", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetNamespaceBandwidth indicates an expected call of SetNamespaceBandwidth
+func (mr *MockSchedulerMockRecorder) SetNamespaceBandwidth(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNamespaceBandwidth", reflect.TypeOf((*MockScheduler)(nil).SetNamespaceBandwidth), arg0)
+}
+
 // Stop mocks base method
 func (m *MockScheduler) Stop() {
 	m.ctrl.T.Helper()
@@ -16,6 +16,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	delta "github.com/uber/kraken/lib/delta"
 )
 
 // MockClient is a mock of Client interface.
@@ -56,6 +57,20 @@ func (mr *MockClientMockRecorder) Addr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Addr", reflect.TypeOf((*MockClient)(nil).Addr))
 }
 
+// AnnotateBlobLocal mocks base method.
+func (m *MockClient) AnnotateBlobLocal(namespace string, d core.Digest, values map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AnnotateBlobLocal", namespace, d, values)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnnotateBlobLocal indicates an expected call of AnnotateBlobLocal.
+func (mr *MockClientMockRecorder) AnnotateBlobLocal(namespace, d, values any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnnotateBlobLocal", reflect.TypeOf((*MockClient)(nil).AnnotateBlobLocal), namespace, d, values)
+}
+
 // CheckReadiness mocks base method.
 func (m *MockClient) CheckReadiness() error {
 	m.ctrl.T.Helper()
@@ -98,6 +113,20 @@ func (mr *MockClientMockRecorder) DownloadBlob(namespace, d, dst any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadBlob", reflect.TypeOf((*MockClient)(nil).DownloadBlob), namespace, d, dst)
 }
 
+// DownloadBlobRange mocks base method.
+func (m *MockClient) DownloadBlobRange(namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadBlobRange", namespace, d, offset, length, dst)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DownloadBlobRange indicates an expected call of DownloadBlobRange.
+func (mr *MockClientMockRecorder) DownloadBlobRange(namespace, d, offset, length, dst any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadBlobRange", reflect.TypeOf((*MockClient)(nil).DownloadBlobRange), namespace, d, offset, length, dst)
+}
+
 // DuplicateUploadBlob mocks base method.
 func (m *MockClient) DuplicateUploadBlob(namespace string, d core.Digest, blob io.Reader, delay time.Duration) error {
 	m.ctrl.T.Helper()
@@ -126,6 +155,36 @@ func (mr *MockClientMockRecorder) ForceCleanup(ttl any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceCleanup", reflect.TypeOf((*MockClient)(nil).ForceCleanup), ttl)
 }
 
+// GetAnnotations mocks base method.
+func (m *MockClient) GetAnnotations(namespace string, d core.Digest) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAnnotations", namespace, d)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAnnotations indicates an expected call of GetAnnotations.
+func (mr *MockClientMockRecorder) GetAnnotations(namespace, d any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAnnotations", reflect.TypeOf((*MockClient)(nil).GetAnnotations), namespace, d)
+}
+
+// GetChunkIndex mocks base method.
+func (m *MockClient) GetChunkIndex(namespace string, d core.Digest) (*delta.Index, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChunkIndex", namespace, d)
+	ret0, _ := ret[0].(*delta.Index)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChunkIndex indicates an expected call of GetChunkIndex.
+func (mr *MockClientMockRecorder) GetChunkIndex(namespace, d any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChunkIndex", reflect.TypeOf((*MockClient)(nil).GetChunkIndex), namespace, d)
+}
+
 // GetMetaInfo mocks base method.
 func (m *MockClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
 	m.ctrl.T.Helper()
@@ -185,6 +244,20 @@ func (mr *MockClientMockRecorder) OverwriteMetaInfo(d, pieceLength any) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OverwriteMetaInfo", reflect.TypeOf((*MockClient)(nil).OverwriteMetaInfo), d, pieceLength)
 }
 
+// PinBlobLocal mocks base method.
+func (m *MockClient) PinBlobLocal(namespace string, d core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PinBlobLocal", namespace, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PinBlobLocal indicates an expected call of PinBlobLocal.
+func (mr *MockClientMockRecorder) PinBlobLocal(namespace, d any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PinBlobLocal", reflect.TypeOf((*MockClient)(nil).PinBlobLocal), namespace, d)
+}
+
 // PrefetchBlob mocks base method.
 func (m *MockClient) PrefetchBlob(namespace string, d core.Digest) error {
 	m.ctrl.T.Helper()
@@ -244,17 +317,31 @@ func (mr *MockClientMockRecorder) StatLocal(namespace, d any) *gomock.Call {
 }
 
 // TransferBlob mocks base method.
-func (m *MockClient) TransferBlob(d core.Digest, blob io.Reader) error {
+func (m *MockClient) TransferBlob(namespace string, d core.Digest, blob io.Reader, pieceLength int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "TransferBlob", d, blob)
+	ret := m.ctrl.Call(m, "TransferBlob", namespace, d, blob, pieceLength)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // TransferBlob indicates an expected call of TransferBlob.
-func (mr *MockClientMockRecorder) TransferBlob(d, blob any) *gomock.Call {
+func (mr *MockClientMockRecorder) TransferBlob(namespace, d, blob, pieceLength any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferBlob", reflect.TypeOf((*MockClient)(nil).TransferBlob), namespace, d, blob, pieceLength)
+}
+
+// UnpinBlobLocal mocks base method.
+func (m *MockClient) UnpinBlobLocal(namespace string, d core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnpinBlobLocal", namespace, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnpinBlobLocal indicates an expected call of UnpinBlobLocal.
+func (mr *MockClientMockRecorder) UnpinBlobLocal(namespace, d any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferBlob", reflect.TypeOf((*MockClient)(nil).TransferBlob), d, blob)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnpinBlobLocal", reflect.TypeOf((*MockClient)(nil).UnpinBlobLocal), namespace, d)
 }
 
 // UploadBlob mocks base method.
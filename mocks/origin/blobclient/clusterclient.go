@@ -15,6 +15,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	delta "github.com/uber/kraken/lib/delta"
 )
 
 // MockClusterClient is a mock of ClusterClient interface.
@@ -69,6 +70,35 @@ func (mr *MockClusterClientMockRecorder) DownloadBlob(namespace, d, dst any) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadBlob", reflect.TypeOf((*MockClusterClient)(nil).DownloadBlob), namespace, d, dst)
 }
 
+// DownloadBlobRange mocks base method.
+func (m *MockClusterClient) DownloadBlobRange(namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadBlobRange", namespace, d, offset, length, dst)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DownloadBlobRange indicates an expected call of DownloadBlobRange.
+func (mr *MockClusterClientMockRecorder) DownloadBlobRange(namespace, d, offset, length, dst any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadBlobRange", reflect.TypeOf((*MockClusterClient)(nil).DownloadBlobRange), namespace, d, offset, length, dst)
+}
+
+// GetChunkIndex mocks base method.
+func (m *MockClusterClient) GetChunkIndex(namespace string, d core.Digest) (*delta.Index, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChunkIndex", namespace, d)
+	ret0, _ := ret[0].(*delta.Index)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChunkIndex indicates an expected call of GetChunkIndex.
+func (mr *MockClusterClientMockRecorder) GetChunkIndex(namespace, d any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChunkIndex", reflect.TypeOf((*MockClusterClient)(nil).GetChunkIndex), namespace, d)
+}
+
 // GetMetaInfo mocks base method.
 func (m *MockClusterClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
 	m.ctrl.T.Helper()
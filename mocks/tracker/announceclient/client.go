@@ -41,9 +41,9 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 }
 
 // Announce mocks base method.
-func (m *MockClient) Announce(d core.Digest, h core.InfoHash, complete bool, version int) ([]*core.PeerInfo, time.Duration, error) {
+func (m *MockClient) Announce(namespace string, d core.Digest, h core.InfoHash, complete bool, version int) ([]*core.PeerInfo, time.Duration, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Announce", d, h, complete, version)
+	ret := m.ctrl.Call(m, "Announce", namespace, d, h, complete, version)
 	ret0, _ := ret[0].([]*core.PeerInfo)
 	ret1, _ := ret[1].(time.Duration)
 	ret2, _ := ret[2].(error)
@@ -51,9 +51,9 @@ func (m *MockClient) Announce(d core.Digest, h core.InfoHash, complete bool, ver
 }
 
 // Announce indicates an expected call of Announce.
-func (mr *MockClientMockRecorder) Announce(d, h, complete, version interface{}) *MockClientAnnounceCall {
+func (mr *MockClientMockRecorder) Announce(namespace, d, h, complete, version interface{}) *MockClientAnnounceCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Announce", reflect.TypeOf((*MockClient)(nil).Announce), d, h, complete, version)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Announce", reflect.TypeOf((*MockClient)(nil).Announce), namespace, d, h, complete, version)
 	return &MockClientAnnounceCall{Call: call}
 }
 
@@ -69,13 +69,13 @@ func (c *MockClientAnnounceCall) Return(arg0 []*core.PeerInfo, arg1 time.Duratio
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockClientAnnounceCall) Do(f func(core.Digest, core.InfoHash, bool, int) ([]*core.PeerInfo, time.Duration, error)) *MockClientAnnounceCall {
+func (c *MockClientAnnounceCall) Do(f func(string, core.Digest, core.InfoHash, bool, int) ([]*core.PeerInfo, time.Duration, error)) *MockClientAnnounceCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockClientAnnounceCall) DoAndReturn(f func(core.Digest, core.InfoHash, bool, int) ([]*core.PeerInfo, time.Duration, error)) *MockClientAnnounceCall {
+func (c *MockClientAnnounceCall) DoAndReturn(f func(string, core.Digest, core.InfoHash, bool, int) ([]*core.PeerInfo, time.Duration, error)) *MockClientAnnounceCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -9,6 +9,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	delta "github.com/uber/kraken/lib/delta"
 )
 
 // MockClient is a mock of Client interface
@@ -48,3 +49,18 @@ func (mr *MockClientMockRecorder) Download(arg0, arg1 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockClient)(nil).Download), arg0, arg1)
 }
+
+// DownloadChunkIndex mocks base method
+func (m *MockClient) DownloadChunkIndex(arg0 string, arg1 core.Digest) (*delta.Index, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadChunkIndex", arg0, arg1)
+	ret0, _ := ret[0].(*delta.Index)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DownloadChunkIndex indicates an expected call of DownloadChunkIndex
+func (mr *MockClientMockRecorder) DownloadChunkIndex(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadChunkIndex", reflect.TypeOf((*MockClient)(nil).DownloadChunkIndex), arg0, arg1)
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// BalancerConfig defines client-side load balancing of origin requests. When
+// enabled, origins are ordered by their observed health instead of by their
+// fixed hash ring order: origins with a high error rate or latency are moved
+// to the back of the list.
+type BalancerConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Decay is the weight given to each new observation in the latency and
+	// error rate moving averages.
+	Decay float64 `yaml:"decay"`
+
+	// MaxErrorRate is the error rate above which an origin is unhealthy.
+	MaxErrorRate float64 `yaml:"max_error_rate"`
+
+	// SlowFactor is the multiple of the fastest origin's latency above which
+	// an origin is unhealthy.
+	SlowFactor float64 `yaml:"slow_factor"`
+
+	// TTL is how long observations of an origin are kept after its last
+	// request.
+	TTL time.Duration `yaml:"ttl"`
+
+	Hedge HedgeConfig `yaml:"hedge"`
+}
+
+// HedgeConfig defines hedged Stat and DownloadBlob requests. A hedged request
+// is sent to the next origin if the previous origin has not responded within
+// Delay, and the first response wins.
+type HedgeConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Delay       time.Duration `yaml:"delay"`
+	MaxRequests int           `yaml:"max_requests"`
+}
+
+func (c BalancerConfig) applyDefaults() BalancerConfig {
+	if c.Decay == 0 {
+		c.Decay = 0.2
+	}
+	if c.MaxErrorRate == 0 {
+		c.MaxErrorRate = 0.5
+	}
+	if c.SlowFactor == 0 {
+		c.SlowFactor = 3
+	}
+	if c.TTL == 0 {
+		c.TTL = 30 * time.Second
+	}
+	if c.Hedge.Delay == 0 {
+		c.Hedge.Delay = 200 * time.Millisecond
+	}
+	if c.Hedge.MaxRequests == 0 {
+		c.Hedge.MaxRequests = 2
+	}
+	return c
+}
+
+// originHealth tracks moving averages of an origin's latency and error rate.
+type originHealth struct {
+	latency   time.Duration
+	errorRate float64
+	updated   time.Time
+}
+
+// balancer orders origins by their observed health.
+type balancer struct {
+	config BalancerConfig
+	clk    clock.Clock
+
+	mu      sync.Mutex
+	origins map[string]*originHealth
+}
+
+func newBalancer(config BalancerConfig, clk clock.Clock) *balancer {
+	return &balancer{
+		config:  config.applyDefaults(),
+		clk:     clk,
+		origins: make(map[string]*originHealth),
+	}
+}
+
+// observe records a request to addr which took latency and returned err.
+// Only network errors and 5XX responses count against the origin: 404s and
+// 202s are normal responses.
+func (b *balancer) observe(addr string, latency time.Duration, err error) {
+	var failed float64
+	if isFailure(err) {
+		failed = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clk.Now()
+	h, ok := b.origins[addr]
+	if !ok || now.Sub(h.updated) > b.config.TTL {
+		b.origins[addr] = &originHealth{latency: latency, errorRate: failed, updated: now}
+		return
+	}
+	if failed == 0 {
+		// Failed requests often return early, so their latency is not
+		// representative.
+		h.latency += time.Duration(b.config.Decay * float64(latency-h.latency))
+	}
+	h.errorRate += b.config.Decay * (failed - h.errorRate)
+	h.updated = now
+}
+
+// order stably partitions clients into healthy and unhealthy origins,
+// preserving the resolved order within each partition. Origins without recent
+// observations are considered healthy.
+func (b *balancer) order(clients []Client) []Client {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clk.Now()
+	health := make([]*originHealth, len(clients))
+	var fastest time.Duration
+	for i, c := range clients {
+		h, ok := b.origins[c.Addr()]
+		if !ok || now.Sub(h.updated) > b.config.TTL {
+			continue
+		}
+		health[i] = h
+		if h.errorRate <= b.config.MaxErrorRate && (fastest == 0 || h.latency < fastest) {
+			fastest = h.latency
+		}
+	}
+
+	var healthy, unhealthy []Client
+	for i, c := range clients {
+		h := health[i]
+		if h != nil && (h.errorRate > b.config.MaxErrorRate ||
+			(fastest > 0 && float64(h.latency) > b.config.SlowFactor*float64(fastest))) {
+			unhealthy = append(unhealthy, c)
+		} else {
+			healthy = append(healthy, c)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// isFailure returns whether err indicates an unhealthy origin.
+func isFailure(err error) bool {
+	if httputil.IsNetworkError(err) {
+		return true
+	}
+	serr, ok := err.(httputil.StatusError)
+	return ok && serr.Status >= http.StatusInternalServerError
+}
+
+// balancedResolver orders resolved clients by health, and wraps them to
+// observe their requests.
+type balancedResolver struct {
+	resolver ClientResolver
+	balancer *balancer
+}
+
+func (r *balancedResolver) Resolve(d core.Digest) ([]Client, error) {
+	clients, err := r.resolver.Resolve(d)
+	if err != nil {
+		return nil, err
+	}
+	observed := make([]Client, len(clients))
+	for i, c := range clients {
+		observed[i] = &observedClient{c, r.balancer}
+	}
+	return r.balancer.order(observed), nil
+}
+
+// observedClient reports the latency and errors of read requests to a
+// balancer.
+type observedClient struct {
+	Client
+	balancer *balancer
+}
+
+func (c *observedClient) observe(start time.Time, err error) {
+	c.balancer.observe(c.Addr(), c.balancer.clk.Now().Sub(start), err)
+}
+
+func (c *observedClient) Stat(namespace string, d core.Digest) (*core.BlobInfo, error) {
+	start := c.balancer.clk.Now()
+	bi, err := c.Client.Stat(namespace, d)
+	c.observe(start, err)
+	return bi, err
+}
+
+func (c *observedClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	start := c.balancer.clk.Now()
+	mi, err := c.Client.GetMetaInfo(namespace, d)
+	c.observe(start, err)
+	return mi, err
+}
+
+func (c *observedClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
+	w := c.firstByteWriter(dst)
+	err := c.Client.DownloadBlob(namespace, d, w)
+	w.observe(err)
+	return err
+}
+
+func (c *observedClient) DownloadBlobRange(
+	namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+
+	w := c.firstByteWriter(dst)
+	err := c.Client.DownloadBlobRange(namespace, d, offset, length, w)
+	w.observe(err)
+	return err
+}
+
+func (c *observedClient) firstByteWriter(dst io.Writer) *firstByteWriter {
+	return &firstByteWriter{Writer: dst, client: c, start: c.balancer.clk.Now()}
+}
+
+// firstByteWriter observes download latency as the time to the first byte,
+// so large blobs do not look like slow origins.
+type firstByteWriter struct {
+	io.Writer
+	client   *observedClient
+	start    time.Time
+	observed bool
+}
+
+func (w *firstByteWriter) Write(p []byte) (int, error) {
+	if !w.observed {
+		w.observed = true
+		w.client.observe(w.start, nil)
+	}
+	return w.Writer.Write(p)
+}
+
+// observe records the result of a download which wrote nothing, or failed
+// after writing.
+func (w *firstByteWriter) observe(err error) {
+	if !w.observed || isFailure(err) {
+		w.observed = true
+		w.client.observe(w.start, err)
+	}
+}
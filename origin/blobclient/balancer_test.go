@@ -0,0 +1,183 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+func clientAddrs(clients []Client) []string {
+	var addrs []string
+	for _, c := range clients {
+		addrs = append(addrs, c.Addr())
+	}
+	return addrs
+}
+
+func TestBalancerOrder(t *testing.T) {
+	clients := []Client{New("a"), New("b"), New("c")}
+
+	tests := []struct {
+		name    string
+		observe func(b *balancer)
+		want    []string
+	}{
+		{
+			name:    "no observations keeps resolved order",
+			observe: func(b *balancer) {},
+			want:    []string{"a", "b", "c"},
+		}, {
+			name: "failing origin moves to back",
+			observe: func(b *balancer) {
+				b.observe("a", time.Millisecond, httputil.NetworkError{})
+				b.observe("b", time.Millisecond, nil)
+			},
+			want: []string{"b", "c", "a"},
+		}, {
+			name: "server errors count as failures",
+			observe: func(b *balancer) {
+				b.observe("a", time.Millisecond, httputil.StatusError{Status: 503})
+			},
+			want: []string{"b", "c", "a"},
+		}, {
+			name: "client errors do not count as failures",
+			observe: func(b *balancer) {
+				b.observe("a", time.Millisecond, httputil.StatusError{Status: 404})
+				b.observe("a", time.Millisecond, ErrBlobNotFound)
+			},
+			want: []string{"a", "b", "c"},
+		}, {
+			name: "slow origin moves to back",
+			observe: func(b *balancer) {
+				b.observe("a", time.Second, nil)
+				b.observe("b", 10*time.Millisecond, nil)
+				b.observe("c", 20*time.Millisecond, nil)
+			},
+			want: []string{"b", "c", "a"},
+		}, {
+			name: "unhealthy origins keep resolved order",
+			observe: func(b *balancer) {
+				b.observe("a", time.Millisecond, httputil.NetworkError{})
+				b.observe("b", time.Millisecond, httputil.NetworkError{})
+			},
+			want: []string{"c", "a", "b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBalancer(BalancerConfig{Enabled: true}, clock.NewMock())
+			test.observe(b)
+			require.Equal(t, test.want, clientAddrs(b.order(clients)))
+		})
+	}
+}
+
+func TestBalancerRecovers(t *testing.T) {
+	require := require.New(t)
+
+	clients := []Client{New("a"), New("b")}
+	b := newBalancer(BalancerConfig{Enabled: true}, clock.NewMock())
+
+	b.observe("a", time.Millisecond, httputil.NetworkError{})
+	require.Equal([]string{"b", "a"}, clientAddrs(b.order(clients)))
+
+	// The error rate decays with successful requests.
+	for i := 0; i < 4; i++ {
+		b.observe("a", time.Millisecond, nil)
+	}
+	require.Equal([]string{"a", "b"}, clientAddrs(b.order(clients)))
+}
+
+func TestBalancerForgetsStaleObservations(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clients := []Client{New("a"), New("b")}
+	b := newBalancer(BalancerConfig{Enabled: true, TTL: time.Minute}, clk)
+
+	b.observe("a", time.Millisecond, httputil.NetworkError{})
+	require.Equal([]string{"b", "a"}, clientAddrs(b.order(clients)))
+
+	clk.Add(2 * time.Minute)
+	require.Equal([]string{"a", "b"}, clientAddrs(b.order(clients)))
+}
+
+func TestHedgerSendsHedgeAfterDelay(t *testing.T) {
+	require := require.New(t)
+
+	h := &hedger{HedgeConfig{Delay: 10 * time.Millisecond, MaxRequests: 2}}
+	clients := []Client{New("slow"), New("fast")}
+
+	var winner string
+	err := h.do(clients, func(client Client, done <-chan struct{}) error {
+		if client.Addr() == "slow" {
+			<-done
+			return errHedgeLost
+		}
+		winner = client.Addr()
+		return nil
+	}, func(error) bool { return false })
+	require.NoError(err)
+	require.Equal("fast", winner)
+}
+
+func TestHedgerFailsOverImmediately(t *testing.T) {
+	require := require.New(t)
+
+	h := &hedger{HedgeConfig{Delay: time.Hour, MaxRequests: 2}}
+	clients := []Client{New("a"), New("b")}
+
+	err := h.do(clients, func(client Client, done <-chan struct{}) error {
+		if client.Addr() == "a" {
+			return httputil.NetworkError{}
+		}
+		return nil
+	}, func(error) bool { return false })
+	require.NoError(err)
+}
+
+func TestHedgerStopsOnPermanentError(t *testing.T) {
+	require := require.New(t)
+
+	h := &hedger{HedgeConfig{Delay: time.Hour, MaxRequests: 2}}
+	clients := []Client{New("a"), New("b")}
+
+	var requests []string
+	err := h.do(clients, func(client Client, done <-chan struct{}) error {
+		requests = append(requests, client.Addr())
+		return ErrBlobNotFound
+	}, func(err error) bool { return err == ErrBlobNotFound })
+	require.Equal(ErrBlobNotFound, err)
+	require.Equal([]string{"a"}, requests)
+}
+
+func TestHedgerAllOriginsFail(t *testing.T) {
+	require := require.New(t)
+
+	h := &hedger{HedgeConfig{Delay: time.Hour, MaxRequests: 2}}
+	clients := []Client{New("a"), New("b")}
+
+	err := h.do(clients, func(client Client, done <-chan struct{}) error {
+		return errors.New("some error")
+	}, func(error) bool { return false })
+	require.Error(err)
+	require.Contains(err.Error(), "all origins unavailable")
+}
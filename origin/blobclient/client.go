@@ -14,6 +14,7 @@
 package blobclient
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -29,12 +30,17 @@ import (
 	"github.com/uber/kraken/utils/closers"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/memsize"
 )
 
 var _ Client = &HTTPClient{}
 
+// _metaInfoWait is how long GetMetaInfo asks origins to wait for metainfo
+// generated in the background, within the request timeout.
+const _metaInfoWait = 10 * time.Second
+
 // Client provides a wrapper around all Server HTTP endpoints.
 type Client interface {
 	Addr() string
@@ -42,20 +48,28 @@ type Client interface {
 	CheckReadiness() error
 	Locations(d core.Digest) ([]string, error)
 	DeleteBlob(d core.Digest) error
-	TransferBlob(d core.Digest, blob io.Reader) error
+	TransferBlob(namespace string, d core.Digest, blob io.Reader, pieceLength int64) error
 
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	StatLocal(namespace string, d core.Digest) (*core.BlobInfo, error)
 
 	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
+	GetChunkIndex(namespace string, d core.Digest) (*delta.Index, error)
 
 	UploadBlob(namespace string, d core.Digest, blob io.Reader) error
 	DuplicateUploadBlob(namespace string, d core.Digest, blob io.Reader, delay time.Duration) error
 
 	DownloadBlob(namespace string, d core.Digest, dst io.Writer) error
+	DownloadBlobRange(namespace string, d core.Digest, offset, length int64, dst io.Writer) error
 	PrefetchBlob(namespace string, d core.Digest) error
 
+	PinBlobLocal(namespace string, d core.Digest) error
+	UnpinBlobLocal(namespace string, d core.Digest) error
+
+	GetAnnotations(namespace string, d core.Digest) (map[string]string, error)
+	AnnotateBlobLocal(namespace string, d core.Digest, values map[string]string) error
+
 	ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) error
 
 	GetPeerContext() (core.PeerContext, error)
@@ -65,9 +79,10 @@ type Client interface {
 
 // HTTPClient defines the Client implementation.
 type HTTPClient struct {
-	addr      string
-	chunkSize uint64
-	tls       *tls.Config
+	addr              string
+	chunkSize         uint64
+	uploadConcurrency int
+	tls               *tls.Config
 }
 
 // Option allows setting optional HTTPClient parameters.
@@ -78,6 +93,13 @@ func WithChunkSize(s uint64) Option {
 	return func(c *HTTPClient) { c.chunkSize = s }
 }
 
+// WithUploadConcurrency configures an HTTPClient to upload up to n chunks of a
+// blob in parallel, over separate connections. Only blobs which support random
+// access, i.e. implement io.ReaderAt and io.Seeker, are uploaded in parallel.
+func WithUploadConcurrency(n int) Option {
+	return func(c *HTTPClient) { c.uploadConcurrency = n }
+}
+
 // WithTLS configures an HTTPClient with tls configuration.
 func WithTLS(tls *tls.Config) Option {
 	return func(c *HTTPClient) { c.tls = tls }
@@ -86,8 +108,9 @@ func WithTLS(tls *tls.Config) Option {
 // New returns a new HTTPClient scoped to addr.
 func New(addr string, opts ...Option) *HTTPClient {
 	c := &HTTPClient{
-		addr:      addr,
-		chunkSize: 32 * memsize.MB,
+		addr:              addr,
+		chunkSize:         32 * memsize.MB,
+		uploadConcurrency: 1,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -180,17 +203,22 @@ func (c *HTTPClient) DeleteBlob(d core.Digest) error {
 }
 
 // TransferBlob uploads a blob to a single origin server. Unlike its cousin UploadBlob,
-// TransferBlob is an internal API which does not replicate the blob.
-func (c *HTTPClient) TransferBlob(d core.Digest, blob io.Reader) error {
-	tc := newTransferClient(c.addr, c.tls)
-	return runChunkedUpload(tc, d, blob, int64(c.chunkSize))
+// TransferBlob is an internal API which does not replicate the blob. If
+// pieceLength is non-zero, the origin server generates metainfo for the blob
+// with pieceLength instead of its configured piece length. namespace may be
+// empty if the namespace of the blob is unknown.
+func (c *HTTPClient) TransferBlob(
+	namespace string, d core.Digest, blob io.Reader, pieceLength int64) error {
+
+	tc := newTransferClient(c.addr, namespace, pieceLength, c.tls)
+	return runChunkedUpload(tc, d, blob, int64(c.chunkSize), c.uploadConcurrency)
 }
 
 // UploadBlob uploads and replicates blob to the origin cluster, asynchronously
 // backing the blob up to the remote storage configured for namespace.
 func (c *HTTPClient) UploadBlob(namespace string, d core.Digest, blob io.Reader) error {
 	uc := newUploadClient(c.addr, namespace, _publicUpload, 0, c.tls)
-	return runChunkedUpload(uc, d, blob, int64(c.chunkSize))
+	return runChunkedUpload(uc, d, blob, int64(c.chunkSize), c.uploadConcurrency)
 }
 
 // DuplicateUploadBlob duplicates an blob upload request, which will attempt to
@@ -199,7 +227,7 @@ func (c *HTTPClient) DuplicateUploadBlob(
 	namespace string, d core.Digest, blob io.Reader, delay time.Duration,
 ) error {
 	uc := newUploadClient(c.addr, namespace, _duplicateUpload, delay, c.tls)
-	return runChunkedUpload(uc, d, blob, int64(c.chunkSize))
+	return runChunkedUpload(uc, d, blob, int64(c.chunkSize), c.uploadConcurrency)
 }
 
 // DownloadBlob downloads blob for d. If the blob of d is not available yet
@@ -220,6 +248,35 @@ func (c *HTTPClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer
 	return nil
 }
 
+// DownloadBlobRange downloads length bytes of the blob of d, starting at offset.
+// If length is negative, the rest of the blob after offset is downloaded. Has
+// the same 202 and 404 semantics as DownloadBlob. If offset lies beyond the
+// end of the blob, returns a 416 httputil.StatusError.
+func (c *HTTPClient) DownloadBlobRange(
+	namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+
+	if offset < 0 || length == 0 {
+		return fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	rng := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		rng += strconv.FormatInt(offset+length-1, 10)
+	}
+	r, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", c.addr, url.PathEscape(namespace), d),
+		httputil.SendHeaders(map[string]string{"Range": rng}),
+		httputil.SendAcceptedCodes(http.StatusPartialContent),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return err
+	}
+	defer closers.Close(r.Body)
+	if _, err := io.Copy(dst, r.Body); err != nil {
+		return fmt.Errorf("copy body: %s", err)
+	}
+	return nil
+}
+
 // PrefetchBlob is an asynchronous, idempotent operation that preheats the origin's cache with the given blob.
 // If the blob is not present, it is downloaded asynchronously. If the blob is present, this is a no-op.
 func (c *HTTPClient) PrefetchBlob(namespace string, d core.Digest) error {
@@ -234,6 +291,63 @@ func (c *HTTPClient) PrefetchBlob(namespace string, d core.Digest) error {
 	return nil
 }
 
+// PinBlobLocal pins the blob of d for namespace on the origin only, exempting it
+// from eviction. If the blob is not cached yet, the origin downloads it from
+// the storage backend and returns 202 httputil.StatusError, indicating that
+// the request should be retried later.
+func (c *HTTPClient) PinBlobLocal(namespace string, d core.Digest) error {
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/pin?local=true",
+			c.addr, url.PathEscape(namespace), d),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
+// UnpinBlobLocal removes the pin of namespace from the blob of d on the origin
+// only.
+func (c *HTTPClient) UnpinBlobLocal(namespace string, d core.Digest) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/pin?local=true",
+			c.addr, url.PathEscape(namespace), d),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
+// GetAnnotations returns the annotations of the blob of d cached on the origin.
+// Returns a 404 httputil.StatusError if the origin does not have the blob.
+func (c *HTTPClient) GetAnnotations(namespace string, d core.Digest) (map[string]string, error) {
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/annotations",
+			c.addr, url.PathEscape(namespace), d),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return nil, err
+	}
+	defer closers.Close(resp.Body)
+	var values map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return values, nil
+}
+
+// AnnotateBlobLocal merges values into the annotations of the blob of d on the
+// origin only. Annotations with empty values are removed. If the blob is not
+// cached yet, the origin downloads it from the storage backend and returns 202
+// httputil.StatusError, indicating that the request should be retried later.
+func (c *HTTPClient) AnnotateBlobLocal(namespace string, d core.Digest, values map[string]string) error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	_, err = httputil.Patch(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/annotations?local=true",
+			c.addr, url.PathEscape(namespace), d),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
 // ReplicateToRemote replicates the blob of d to a remote origin cluster. If the
 // blob of d is not available yet, returns 202 httputil.StatusError, indicating
 // that the request should be retried later.
@@ -248,11 +362,12 @@ func (c *HTTPClient) ReplicateToRemote(namespace string, d core.Digest, remoteDN
 // GetMetaInfo returns metainfo for d. If the blob of d is not available yet
 // (i.e. still downloading), returns a 202 httputil.StatusError, indicating that
 // the request should be retried later. If no blob exists for d, returns a 404
-// httputil.StatusError.
+// httputil.StatusError. Waits a while for metainfo which the origin is
+// generating in the background before returning 202.
 func (c *HTTPClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
 	r, err := httputil.Get(
-		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/metainfo",
-			c.addr, url.PathEscape(namespace), d),
+		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/metainfo?wait=%s",
+			c.addr, url.PathEscape(namespace), d, _metaInfoWait),
 		httputil.SendTimeout(15*time.Second),
 		httputil.SendTLS(c.tls))
 	if err != nil {
@@ -270,6 +385,29 @@ func (c *HTTPClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInf
 	return mi, nil
 }
 
+// GetChunkIndex returns the chunk index of d. Returns a 404
+// httputil.StatusError if the blob of d is not cached or has no chunk index.
+func (c *HTTPClient) GetChunkIndex(namespace string, d core.Digest) (*delta.Index, error) {
+	r, err := httputil.Get(
+		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/chunkindex",
+			c.addr, url.PathEscape(namespace), d),
+		httputil.SendTimeout(15*time.Second),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return nil, err
+	}
+	defer closers.Close(r.Body)
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %s", err)
+	}
+	idx, err := delta.DeserializeIndex(raw)
+	if err != nil {
+		return nil, fmt.Errorf("deserialize chunk index: %s", err)
+	}
+	return idx, nil
+}
+
 // OverwriteMetaInfo overwrites existing metainfo for d with new metainfo
 // configured with pieceLength. Primarily intended for benchmarking purposes.
 func (c *HTTPClient) OverwriteMetaInfo(d core.Digest, pieceLength int64) error {
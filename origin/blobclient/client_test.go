@@ -23,12 +23,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/memsize"
 )
 
@@ -501,6 +503,106 @@ func TestDownloadBlob(t *testing.T) {
 	}
 }
 
+func TestDownloadBlobRange(t *testing.T) {
+	content := []byte("0123456789")
+
+	tests := []struct {
+		name      string
+		offset    int64
+		length    int64
+		status    int
+		wantRange string
+		wantErr   bool
+	}{
+		{
+			name:      "bounded range",
+			offset:    2,
+			length:    3,
+			status:    http.StatusPartialContent,
+			wantRange: "bytes=2-4",
+		},
+		{
+			name:      "rest of blob",
+			offset:    7,
+			length:    -1,
+			status:    http.StatusPartialContent,
+			wantRange: "bytes=7-",
+		},
+		{
+			name:      "range ignored",
+			offset:    2,
+			length:    3,
+			status:    http.StatusOK,
+			wantRange: "bytes=2-4",
+			wantErr:   true,
+		},
+		{
+			name:      "range not satisfiable",
+			offset:    20,
+			length:    -1,
+			status:    http.StatusRequestedRangeNotSatisfiable,
+			wantRange: "bytes=20-",
+			wantErr:   true,
+		},
+		{
+			name:      "accepted status (blob still downloading)",
+			offset:    2,
+			length:    3,
+			status:    http.StatusAccepted,
+			wantRange: "bytes=2-4",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			d := core.DigestFixture()
+			namespace := "test-namespace"
+
+			client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(fmt.Sprintf("/namespace/%s/blobs/%s", namespace, d), r.URL.Path)
+				require.Equal(tt.wantRange, r.Header.Get("Range"))
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusPartialContent {
+					end := int64(len(content))
+					if tt.length > 0 {
+						end = tt.offset + tt.length
+					}
+					_, err := w.Write(content[tt.offset:end])
+					require.NoError(err)
+				}
+			})
+
+			var buf bytes.Buffer
+			err := client.DownloadBlobRange(namespace, d, tt.offset, tt.length, &buf)
+			if tt.wantErr {
+				require.Error(err)
+				if tt.status != http.StatusOK {
+					require.True(httputil.IsStatus(err, tt.status))
+				}
+			} else {
+				require.NoError(err)
+				end := int64(len(content))
+				if tt.length > 0 {
+					end = tt.offset + tt.length
+				}
+				require.Equal(content[tt.offset:end], buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestDownloadBlobRangeInvalidRange(t *testing.T) {
+	require := require.New(t)
+
+	client := New("localhost:0")
+	d := core.DigestFixture()
+
+	require.Error(client.DownloadBlobRange("test-namespace", d, -1, 10, io.Discard))
+	require.Error(client.DownloadBlobRange("test-namespace", d, 0, 0, io.Discard))
+}
+
 func TestPrefetchBlob(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -877,7 +979,7 @@ func TestTransferBlob(t *testing.T) {
 				}
 			}, WithChunkSize(uint64(len(tt.content)+1)))
 
-			err := client.TransferBlob(d, bytes.NewReader(tt.content))
+			err := client.TransferBlob("test-namespace", d, bytes.NewReader(tt.content), 0)
 			if tt.wantErr {
 				require.Error(err)
 				if tt.errContain != "" {
@@ -953,6 +1055,77 @@ func TestUploadBlob(t *testing.T) {
 		require.NoError(err)
 		require.Equal(5, patchCount) // 49 bytes / 10 bytes per chunk = 5 chunks
 	})
+
+	t.Run("parallel chunked upload assembles chunks by offset", func(t *testing.T) {
+		require := require.New(t)
+		d := core.DigestFixture()
+		namespace := "test-namespace"
+		content := []byte("test blob content that is longer than chunk size")
+		uploadID := "upload-012"
+
+		var mu sync.Mutex
+		assembled := make([]byte, len(content))
+		var patchCount int
+
+		client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/uploads"):
+				w.Header().Set("Location", uploadID)
+				w.WriteHeader(http.StatusOK)
+
+			case r.Method == http.MethodPatch:
+				var start, stop int
+				_, err := fmt.Sscanf(r.Header.Get("Content-Range"), "%d-%d", &start, &stop)
+				require.NoError(err)
+				chunk, err := io.ReadAll(r.Body)
+				require.NoError(err)
+				require.Len(chunk, stop-start)
+				mu.Lock()
+				copy(assembled[start:], chunk)
+				patchCount++
+				mu.Unlock()
+				w.WriteHeader(http.StatusOK)
+
+			case r.Method == http.MethodPut:
+				mu.Lock()
+				require.Equal(content, assembled)
+				mu.Unlock()
+				w.WriteHeader(http.StatusOK)
+			}
+		}, WithChunkSize(10), WithUploadConcurrency(3))
+
+		err := client.UploadBlob(namespace, d, bytes.NewReader(content))
+		require.NoError(err)
+		require.Equal(5, patchCount)
+	})
+
+	t.Run("parallel chunked upload fails on patch error", func(t *testing.T) {
+		require := require.New(t)
+		d := core.DigestFixture()
+		content := []byte("test blob content that is longer than chunk size")
+		var committed bool
+
+		client := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				w.Header().Set("Location", "upload-345")
+				w.WriteHeader(http.StatusOK)
+			case http.MethodPatch:
+				if strings.HasPrefix(r.Header.Get("Content-Range"), "20-") {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			case http.MethodPut:
+				committed = true
+				w.WriteHeader(http.StatusOK)
+			}
+		}, WithChunkSize(10), WithUploadConcurrency(3))
+
+		err := client.UploadBlob("test-namespace", d, bytes.NewReader(content))
+		require.True(httputil.IsStatus(err, http.StatusInternalServerError))
+		require.False(committed)
+	})
 }
 
 func TestDuplicateUploadBlob(t *testing.T) {
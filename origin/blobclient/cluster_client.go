@@ -22,14 +22,17 @@ import (
 	"sync"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/cenkalti/backoff"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/rwutil"
 )
 
 // Locations queries cluster for the locations of d.
@@ -84,8 +87,10 @@ type ClusterClient interface {
 	CheckReadiness() error
 	UploadBlob(namespace string, d core.Digest, blob io.ReadSeeker) error
 	DownloadBlob(namespace string, d core.Digest, dst io.Writer) error
+	DownloadBlobRange(namespace string, d core.Digest, offset, length int64, dst io.Writer) error
 	PrefetchBlob(namespace string, d core.Digest) error
 	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetChunkIndex(namespace string, d core.Digest) (*delta.Index, error)
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
 	Owners(d core.Digest) ([]core.PeerContext, error)
@@ -94,11 +99,37 @@ type ClusterClient interface {
 
 type clusterClient struct {
 	resolver ClientResolver
+	balancer *balancer
+	hedger   *hedger
+}
+
+// ClusterOption allows setting optional clusterClient parameters.
+type ClusterOption func(*clusterClient)
+
+// WithBalancer configures a ClusterClient to prefer healthy origins and,
+// optionally, hedge Stat and DownloadBlob requests.
+func WithBalancer(config BalancerConfig) ClusterOption {
+	return func(c *clusterClient) {
+		if !config.Enabled {
+			return
+		}
+		c.balancer = newBalancer(config, clock.New())
+		if c.balancer.config.Hedge.Enabled {
+			c.hedger = &hedger{c.balancer.config.Hedge}
+		}
+	}
 }
 
 // NewClusterClient returns a new ClusterClient.
-func NewClusterClient(r ClientResolver) ClusterClient {
-	return &clusterClient{r}
+func NewClusterClient(r ClientResolver, opts ...ClusterOption) ClusterClient {
+	c := &clusterClient{resolver: r}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.balancer != nil {
+		c.resolver = &balancedResolver{r, c.balancer}
+	}
+	return c
 }
 
 // defaultPollBackOff returns the default backoff used on Poll operations.
@@ -179,6 +210,22 @@ func (c *clusterClient) GetMetaInfo(namespace string, d core.Digest) (mi *core.M
 	return mi, err
 }
 
+// GetChunkIndex returns the chunk index of d from the first replica which has
+// it.
+func (c *clusterClient) GetChunkIndex(namespace string, d core.Digest) (idx *delta.Index, err error) {
+	clients, err := c.resolver.Resolve(d)
+	if err != nil {
+		return nil, fmt.Errorf("resolve clients: %s", err)
+	}
+	for _, client := range clients {
+		idx, err = client.GetChunkIndex(namespace, d)
+		if err == nil {
+			break
+		}
+	}
+	return idx, err
+}
+
 // Stat checks availability of a blob in the cluster.
 func (c *clusterClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo, err error) {
 	clients, err := c.resolver.Resolve(d)
@@ -186,7 +233,13 @@ func (c *clusterClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo
 		return nil, fmt.Errorf("resolve clients: %s", err)
 	}
 
-	shuffle(clients)
+	if c.balancer == nil {
+		// Without health information, spread load evenly.
+		shuffle(clients)
+	}
+	if c.hedger != nil {
+		return c.hedgedStat(clients, namespace, d)
+	}
 	for _, client := range clients {
 		bi, err = client.Stat(namespace, d)
 		if err != nil {
@@ -198,6 +251,39 @@ func (c *clusterClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo
 	return bi, err
 }
 
+func (c *clusterClient) hedgedStat(
+	clients []Client, namespace string, d core.Digest) (*core.BlobInfo, error) {
+
+	var mu sync.Mutex
+	var bi *core.BlobInfo
+	var lastErr error
+	err := c.hedger.do(clients, func(client Client, done <-chan struct{}) error {
+		info, err := client.Stat(namespace, d)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			lastErr = err
+		} else if bi == nil {
+			bi = info
+		}
+		return err
+	}, func(error) bool {
+		// Like Stat, try every origin before giving up on ErrBlobNotFound.
+		return false
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		if lastErr != nil {
+			// Return the last error as is, so callers can check for
+			// ErrBlobNotFound.
+			return nil, lastErr
+		}
+		return nil, err
+	}
+	return bi, nil
+}
+
 // OverwriteMetaInfo overwrites existing metainfo for d with new metainfo configured
 // with pieceLength on every origin server. Returns error if any origin was unable
 // to overwrite metainfo. Primarly intended for benchmarking purposes.
@@ -217,11 +303,76 @@ func (c *clusterClient) OverwriteMetaInfo(d core.Digest, pieceLength int64) erro
 
 // DownloadBlob pulls a blob from the origin cluster.
 func (c *clusterClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
+	var err error
+	if c.hedger != nil {
+		err = c.hedgedPoll(d, dst, func(client Client, w io.Writer) error {
+			return client.DownloadBlob(namespace, d, w)
+		})
+	} else {
+		err = Poll(c.resolver, c.defaultPollBackOff(), d, func(client Client) error {
+			return client.DownloadBlob(namespace, d, dst)
+		})
+	}
+	if httputil.IsNotFound(err) {
+		err = ErrBlobNotFound
+	}
+	return err
+}
+
+// hedgedPoll is like Poll, but hedges requests which are slow to respond. The
+// first request to write claims dst, after which no other origin is tried.
+func (c *clusterClient) hedgedPoll(
+	d core.Digest, dst io.Writer, makeRequest func(client Client, w io.Writer) error) error {
+
+	clients, err := c.resolver.Resolve(d)
+	if err != nil {
+		return fmt.Errorf("resolve clients: %s", err)
+	}
+	hw := &hedgedWriter{dst: dst}
+	err = c.hedger.do(clients, func(client Client, done <-chan struct{}) error {
+		w := hw.writer(client)
+		err := pollClient(client, c.defaultPollBackOff(), done, func(client Client) error {
+			return makeRequest(client, w)
+		})
+		if err != nil {
+			if mine, other := hw.owned(client); mine {
+				return claimedError{err}
+			} else if other {
+				return errHedgeLost
+			}
+		}
+		return err
+	}, func(err error) bool {
+		_, ok := err.(claimedError)
+		return ok || isPermanent(err)
+	})
+	if cerr, ok := err.(claimedError); ok {
+		return cerr.error
+	}
+	return err
+}
+
+// DownloadBlobRange pulls a byte range of a blob from the origin cluster. See
+// Client.DownloadBlobRange for more details. If an origin fails mid-transfer,
+// the next origin resumes after the bytes already written to dst.
+func (c *clusterClient) DownloadBlobRange(
+	namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+
+	w := rwutil.NewCountingWriter(dst)
 	err := Poll(c.resolver, c.defaultPollBackOff(), d, func(client Client) error {
-		return client.DownloadBlob(namespace, d, dst)
+		remaining := length
+		if length > 0 {
+			remaining -= w.N()
+			if remaining == 0 {
+				return nil
+			}
+		}
+		return client.DownloadBlobRange(namespace, d, offset+w.N(), remaining, w)
 	})
 	if httputil.IsNotFound(err) {
 		err = ErrBlobNotFound
+	} else if httputil.IsStatus(err, http.StatusRequestedRangeNotSatisfiable) {
+		err = ErrRangeNotSatisfiable
 	}
 	return err
 }
@@ -322,32 +473,49 @@ func Poll(
 		return fmt.Errorf("resolve clients: %s", err)
 	}
 	var errs []error
-ORIGINS:
 	for _, client := range clients {
 		b.Reset()
-	POLL:
-		for {
-			if err := makeRequest(client); err != nil {
-				if serr, ok := err.(httputil.StatusError); ok {
-					if serr.Status == http.StatusAccepted {
-						d := b.NextBackOff()
-						if d == backoff.Stop {
-							break POLL // Backoff timed out.
-						}
-						time.Sleep(d)
-						continue POLL
-					}
-					if serr.Status < 500 {
-						return err
-					}
-				}
-				errs = append(errs, fmt.Errorf("origin %s: %s", client.Addr(), err))
-				continue ORIGINS
-			}
+		err := pollClient(client, b, nil, makeRequest)
+		if err == nil {
 			return nil // Success!
 		}
-		errs = append(errs,
-			fmt.Errorf("origin %s: backoff timed out on 202 responses", client.Addr()))
+		if isPermanent(err) {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("origin %s: %s", client.Addr(), err))
 	}
 	return fmt.Errorf("all origins unavailable: %s", errutil.Join(errs))
 }
+
+// errPollTimedOut is returned when an origin responds 202 until the poll
+// backoff times out.
+var errPollTimedOut = errors.New("backoff timed out on 202 responses")
+
+// pollClient makes requests to client until it stops responding 202, the
+// backoff times out, or done is closed.
+func pollClient(
+	client Client, b backoff.BackOff, done <-chan struct{}, makeRequest func(Client) error) error {
+
+	for {
+		err := makeRequest(client)
+		if !httputil.IsAccepted(err) {
+			return err
+		}
+		d := b.NextBackOff()
+		if d == backoff.Stop {
+			return errPollTimedOut
+		}
+		select {
+		case <-time.After(d):
+		case <-done:
+			return errHedgeLost
+		}
+	}
+}
+
+// isPermanent returns true if err from one origin means the request would
+// fail on every origin.
+func isPermanent(err error) bool {
+	serr, ok := err.(httputil.StatusError)
+	return ok && serr.Status < 500
+}
@@ -17,3 +17,7 @@ import "errors"
 
 // ErrBlobNotFound is returned when a blob is not found on origin.
 var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrRangeNotSatisfiable is returned when a requested byte range lies beyond
+// the end of a blob.
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
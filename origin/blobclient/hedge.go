@@ -0,0 +1,148 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/errutil"
+)
+
+// errHedgeLost is returned by hedged requests which lost to another request.
+var errHedgeLost = errors.New("lost to hedged request")
+
+// hedger sends requests to multiple origins when the preferred origin is slow.
+type hedger struct {
+	config HedgeConfig
+}
+
+// do sends request to clients in order until one succeeds, or one fails with
+// an error for which permanent returns true. If a request has not finished
+// within the hedge delay, the next client is sent the request as well, with at
+// most MaxRequests in flight. Failed requests fail over to the next client
+// immediately. The done channel passed to request is closed once do returns,
+// so requests which lost can stop early.
+func (h *hedger) do(
+	clients []Client,
+	request func(client Client, done <-chan struct{}) error,
+	permanent func(error) bool) error {
+
+	if len(clients) == 0 {
+		return errors.New("no origins")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	type result struct {
+		client Client
+		err    error
+	}
+	// Buffered so requests which lost never block.
+	results := make(chan result, len(clients))
+	var next, inflight int
+	send := func() {
+		client := clients[next]
+		next++
+		inflight++
+		go func() {
+			results <- result{client, request(client, done)}
+		}()
+	}
+
+	send()
+	timer := time.NewTimer(h.config.Delay)
+	defer timer.Stop()
+
+	var errs []error
+	for inflight > 0 {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				return nil
+			}
+			if r.err == errHedgeLost {
+				continue
+			}
+			if permanent(r.err) {
+				return r.err
+			}
+			errs = append(errs, fmt.Errorf("origin %s: %s", r.client.Addr(), r.err))
+			if next < len(clients) {
+				send()
+			}
+		case <-timer.C:
+			if next < len(clients) && inflight < h.config.MaxRequests {
+				send()
+			}
+			timer.Reset(h.config.Delay)
+		}
+	}
+	return fmt.Errorf("all origins unavailable: %s", errutil.Join(errs))
+}
+
+// hedgedWriter lets the first of several hedged downloads to write claim dst.
+// Writes from every other download fail with errHedgeLost.
+type hedgedWriter struct {
+	dst io.Writer
+
+	mu    sync.Mutex
+	owner Client
+}
+
+func (w *hedgedWriter) claim(client Client) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.owner == nil {
+		w.owner = client
+	}
+	return w.owner == client
+}
+
+// owned returns whether client has claimed dst, or whether another client
+// has.
+func (w *hedgedWriter) owned(client Client) (mine, other bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.owner != nil && w.owner == client, w.owner != nil && w.owner != client
+}
+
+// writer returns the io.Writer client must download into.
+func (w *hedgedWriter) writer(client Client) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		if !w.claim(client) {
+			return 0, errHedgeLost
+		}
+		return w.dst.Write(p)
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// claimedError wraps an error of a hedged download which had already written
+// to dst, and thus cannot fail over to another origin.
+type claimedError struct {
+	error
+}
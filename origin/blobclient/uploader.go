@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/uber/kraken/core"
@@ -34,13 +36,48 @@ type uploader interface {
 	commit(d core.Digest, uid string) error
 }
 
-func runChunkedUpload(u uploader, d core.Digest, blob io.Reader, chunkSize int64) error {
-	if err := runChunkedUploadHelper(u, d, blob, chunkSize); err != nil && !httputil.IsConflict(err) {
+// runChunkedUpload uploads blob in chunks of chunkSize. If blob supports random
+// access, up to concurrency chunks are uploaded in parallel.
+func runChunkedUpload(
+	u uploader, d core.Digest, blob io.Reader, chunkSize int64, concurrency int) error {
+
+	var err error
+	if r, size, ok := sectionReader(blob); ok && concurrency > 1 && size > chunkSize {
+		err = runParallelChunkedUploadHelper(u, d, r, size, chunkSize, concurrency)
+	} else {
+		err = runChunkedUploadHelper(u, d, blob, chunkSize)
+	}
+	if err != nil && !httputil.IsConflict(err) {
 		return err
 	}
 	return nil
 }
 
+// sectionReader returns the remainder of blob as an io.ReaderAt, if blob
+// supports random access. The read offset of blob is left unchanged.
+func sectionReader(blob io.Reader) (r io.ReaderAt, size int64, ok bool) {
+	ra, ok := blob.(io.ReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+	s, ok := blob.(io.Seeker)
+	if !ok {
+		return nil, 0, false
+	}
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, false
+	}
+	if _, err := s.Seek(pos, io.SeekStart); err != nil {
+		return nil, 0, false
+	}
+	return io.NewSectionReader(ra, pos, end-pos), end - pos, true
+}
+
 func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize int64) error {
 	uid, err := u.start(d)
 	if err != nil {
@@ -66,14 +103,71 @@ func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize
 	return u.commit(d, uid)
 }
 
+// runParallelChunkedUploadHelper uploads chunks of blob over up to concurrency
+// connections. The origin assembles chunks by offset, and verifies the digest
+// of the assembled blob on commit.
+func runParallelChunkedUploadHelper(
+	u uploader, d core.Digest, blob io.ReaderAt, size, chunkSize int64, concurrency int) error {
+
+	uid, err := u.start(d)
+	if err != nil {
+		return err
+	}
+
+	offsets := make(chan int64)
+	// Buffered so workers never block after failing.
+	errc := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range offsets {
+				stop := min(start+chunkSize, size)
+				chunk := io.NewSectionReader(blob, start, stop-start)
+				if err := u.patch(d, uid, start, stop, chunk); err != nil {
+					errc <- err
+					return
+				}
+			}
+		}()
+	}
+
+SEND:
+	for start := int64(0); start < size; start += chunkSize {
+		select {
+		case offsets <- start:
+		case err = <-errc:
+			break SEND
+		}
+	}
+	close(offsets)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errc:
+		default:
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return u.commit(d, uid)
+}
+
 // transferClient executes chunked uploads for internal blob transfers.
 type transferClient struct {
-	addr string
-	tls  *tls.Config
+	addr        string
+	namespace   string
+	pieceLength int64
+	tls         *tls.Config
 }
 
-func newTransferClient(addr string, tls *tls.Config) *transferClient {
-	return &transferClient{addr, tls}
+func newTransferClient(
+	addr, namespace string, pieceLength int64, tls *tls.Config) *transferClient {
+
+	return &transferClient{addr, namespace, pieceLength, tls}
 }
 
 func (c *transferClient) start(d core.Digest) (uid string, err error) {
@@ -104,8 +198,19 @@ func (c *transferClient) patch(
 }
 
 func (c *transferClient) commit(d core.Digest, uid string) error {
+	u := fmt.Sprintf("http://%s/internal/blobs/%s/uploads/%s", c.addr, d, uid)
+	q := make(url.Values)
+	if c.namespace != "" {
+		q.Set("namespace", c.namespace)
+	}
+	if c.pieceLength > 0 {
+		q.Set("piece_length", strconv.FormatInt(c.pieceLength, 10))
+	}
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
 	_, err := httputil.Put(
-		fmt.Sprintf("http://%s/internal/blobs/%s/uploads/%s", c.addr, d, uid),
+		u,
 		httputil.SendTimeout(15*time.Minute),
 		httputil.SendTLS(c.tls))
 	return err
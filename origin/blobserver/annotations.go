@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// AnnotatedBlob is a blob with annotations cached on an origin.
+type AnnotatedBlob struct {
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// getAnnotationsHandler returns the annotations of a blob cached on this
+// origin.
+func (s *Server) getAnnotationsHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	values, err := s.cas.GetCacheFileAnnotations(d.Hex())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("get cache file annotations: %s", err)
+	}
+	return json.NewEncoder(w).Encode(values)
+}
+
+// annotateBlobHandler merges the annotations in the request body into the
+// annotations of a blob on every origin which owns it. Annotations with empty
+// values are removed. Owners which do not have the blob cached download it from
+// the storage backend first, in which case "202 Accepted" is returned and the
+// request should be retried. If the local query arg is set, the blob is only
+// annotated on this origin.
+func (s *Server) annotateBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, d, local, err := parseLocalParams(r)
+	if err != nil {
+		return err
+	}
+	var values map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		return handler.Errorf("json decode: %s", err).Status(http.StatusBadRequest)
+	}
+	// Rejects malformed annotations before any owner is annotated.
+	if err := new(metadata.Annotations).Update(values); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+	}
+	if local {
+		return s.annotateBlobLocal(namespace, d, values)
+	}
+	return s.applyToOwners(namespace, d,
+		func() error { return s.annotateBlobLocal(namespace, d, values) },
+		func(c blobclient.Client) error { return c.AnnotateBlobLocal(namespace, d, values) })
+}
+
+// listAnnotatedBlobsHandler lists the blobs cached on this origin which are
+// annotated with the key query arg, and if the value query arg is set, whose
+// annotation of key equals value.
+func (s *Server) listAnnotatedBlobsHandler(w http.ResponseWriter, r *http.Request) error {
+	key := httputil.GetQueryArg(r, "key", "")
+	if key == "" {
+		return handler.Errorf("query arg `key` required").Status(http.StatusBadRequest)
+	}
+	files, err := s.cas.FindAnnotatedCacheFiles(key, httputil.GetQueryArg(r, "value", ""))
+	if err != nil {
+		return handler.Errorf("find annotated cache files: %s", err)
+	}
+	blobs := []AnnotatedBlob{}
+	for _, f := range files {
+		blobs = append(blobs, AnnotatedBlob{
+			Digest:      f.Name,
+			Annotations: f.Annotations,
+		})
+	}
+	return json.NewEncoder(w).Encode(blobs)
+}
+
+func (s *Server) annotateBlobLocal(namespace string, d core.Digest, values map[string]string) error {
+	if _, err := s.cas.AnnotateCacheFile(d.Hex(), values); err != nil {
+		if os.IsNotExist(err) {
+			log.With("namespace", namespace, "digest", d.Hex()).
+				Info("Blob to annotate not in cache, initiating download from backend")
+			return s.startRemoteBlobDownload(namespace, d, false)
+		}
+		if errors.Is(err, metadata.ErrInvalidAnnotations) {
+			return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+		}
+		return handler.Errorf("annotate cache file: %s", err)
+	}
+	log.With("namespace", namespace, "digest", d.Hex()).Info("Annotated blob")
+	return nil
+}
+
+// transferAnnotations copies the annotations of the blob of d to an origin
+// the blob was transferred to, so annotations are replicated with the blob.
+func (s *Server) transferAnnotations(namespace string, d core.Digest, client blobclient.Client) error {
+	var a metadata.Annotations
+	if err := s.cas.GetCacheFileMetadata(d.Hex(), &a); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(a.Values) == 0 {
+		return nil
+	}
+	return client.AnnotateBlobLocal(namespace, d, a.Values)
+}
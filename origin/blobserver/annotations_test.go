@@ -0,0 +1,156 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+func (s *testServer) annotate(namespace string, d core.Digest, values map[string]string) error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = httputil.Patch(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/annotations",
+			s.addr, url.PathEscape(namespace), d),
+		httputil.SendBody(bytes.NewReader(b)))
+	return err
+}
+
+func (s *testServer) findAnnotated(key, value string) ([]AnnotatedBlob, error) {
+	resp, err := httputil.Get(fmt.Sprintf(
+		"http://%s/annotations?key=%s&value=%s", s.addr, url.QueryEscape(key), url.QueryEscape(value)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var blobs []AnnotatedBlob
+	if err := json.NewDecoder(resp.Body).Decode(&blobs); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+func TestAnnotateBlobAppliesToAllOwners(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingSomeReplica()
+	cp := newTestClientProvider()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	namespace := core.TagFixture()
+	blob := computeBlobForHosts(ring, s1.host, s2.host)
+	s1.cacheBlob(namespace, blob)
+	s2.cacheBlob(namespace, blob)
+
+	require.NoError(s1.annotate(namespace, blob.Digest, map[string]string{
+		"build_id": "1234",
+		"source":   "docker.io",
+	}))
+
+	for _, host := range []string{master1, master2} {
+		values, err := cp.Provide(host).GetAnnotations(namespace, blob.Digest)
+		require.NoError(err)
+		require.Equal(map[string]string{"build_id": "1234", "source": "docker.io"}, values)
+	}
+
+	blobs, err := s2.findAnnotated("build_id", "1234")
+	require.NoError(err)
+	require.Equal([]AnnotatedBlob{{
+		Digest:      blob.Digest.Hex(),
+		Annotations: map[string]string{"build_id": "1234", "source": "docker.io"},
+	}}, blobs)
+
+	require.NoError(s2.annotate(namespace, blob.Digest, map[string]string{"source": ""}))
+
+	values, err := cp.Provide(master1).GetAnnotations(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(map[string]string{"build_id": "1234"}, values)
+}
+
+func TestAnnotateBlobRejectsInvalidAnnotations(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+	s.cacheBlob(namespace, blob)
+
+	err := s.annotate(namespace, blob.Digest, map[string]string{"bad key": "1"})
+	require.True(httputil.IsStatus(err, 400))
+
+	values, err := cp.Provide(master1).GetAnnotations(namespace, blob.Digest)
+	require.NoError(err)
+	require.Empty(values)
+}
+
+func TestGetAnnotationsNotFound(t *testing.T) {
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	_, err := cp.Provide(master1).GetAnnotations(core.TagFixture(), core.DigestFixture())
+	require.True(t, httputil.IsNotFound(err))
+}
+
+func TestRepairReplicationTransfersAnnotations(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+	s3 := newTestServer(t, master3, ring, cp)
+	defer s3.cleanup()
+
+	namespace := core.TagFixture()
+	s1.backendClient(namespace, false)
+	require.NoError(s1.backendManager.SetReplicas(namespace, 3))
+
+	blob := computeBlobForHosts(ring, master1)
+	s1.cacheBlob(namespace, blob)
+	require.NoError(cp.Provide(master1).AnnotateBlobLocal(
+		namespace, blob.Digest, map[string]string{"build_id": "1234"}))
+
+	require.NoError(s1.server.repairReplication())
+
+	for _, host := range []string{master2, master3} {
+		values, err := cp.Provide(host).GetAnnotations(namespace, blob.Digest)
+		require.NoError(err)
+		require.Equal(map[string]string{"build_id": "1234"}, values)
+	}
+}
@@ -161,6 +161,43 @@ func TestPollSkipsOriginOnNetworkErrors(t *testing.T) {
 	}))
 }
 
+func TestClusterClientDownloadBlobRangeResumesOnNextOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+	cc := blobclient.NewClusterClient(mockResolver)
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+
+	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{mockClient1, mockClient2}, nil)
+
+	// The first origin fails after writing part of the range.
+	mockClient1.EXPECT().Addr().Return("client1").AnyTimes()
+	mockClient1.EXPECT().DownloadBlobRange(namespace, blob.Digest, int64(2), int64(10), gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+			_, err := dst.Write(blob.Content[2:6])
+			require.NoError(err)
+			return httputil.NetworkError{}
+		})
+	mockClient2.EXPECT().DownloadBlobRange(namespace, blob.Digest, int64(6), int64(6), gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, offset, length int64, dst io.Writer) error {
+			_, err := dst.Write(blob.Content[6:12])
+			require.NoError(err)
+			return nil
+		})
+
+	var buf bytes.Buffer
+	require.NoError(cc.DownloadBlobRange(namespace, blob.Digest, 2, 10, &buf))
+	require.Equal(blob.Content[2:12], buf.Bytes())
+}
+
 func TestPollSkipsOriginOnRetryableError(t *testing.T) {
 	require := require.New(t)
 
@@ -261,3 +298,93 @@ func TestClusterClientStatContinueWhenNotFound(t *testing.T) {
 	require.NotNil(bi)
 	require.Equal(int64(256), bi.Size)
 }
+
+func TestClusterClientBalancerPrefersHealthyOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(
+		mockResolver, blobclient.WithBalancer(blobclient.BalancerConfig{Enabled: true}))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	mockClient1.EXPECT().Addr().Return("client1").AnyTimes()
+	mockClient2.EXPECT().Addr().Return("client2").AnyTimes()
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{mockClient1, mockClient2}, nil).Times(2)
+
+	gomock.InOrder(
+		mockClient1.EXPECT().Stat(namespace, blob.Digest).Return(nil, httputil.NetworkError{}),
+		mockClient2.EXPECT().Stat(namespace, blob.Digest).Return(core.NewBlobInfo(256), nil),
+		// The failed origin is tried last on subsequent requests.
+		mockClient2.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+			func(namespace string, d core.Digest, dst io.Writer) error {
+				_, err := dst.Write(blob.Content)
+				return err
+			}),
+	)
+
+	bi, err := cc.Stat(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(int64(256), bi.Size)
+
+	var buf bytes.Buffer
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, &buf))
+	require.Equal(blob.Content, buf.Bytes())
+}
+
+func TestClusterClientHedgedDownloadBlob(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithBalancer(blobclient.BalancerConfig{
+		Enabled: true,
+		Hedge: blobclient.HedgeConfig{
+			Enabled: true,
+			Delay:   10 * time.Millisecond,
+		},
+	}))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	mockClient1.EXPECT().Addr().Return("client1").AnyTimes()
+	mockClient2.EXPECT().Addr().Return("client2").AnyTimes()
+	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{mockClient1, mockClient2}, nil)
+
+	// The first origin is stuck until the hedged request to the second origin
+	// has won, after which its writes are rejected.
+	release := make(chan struct{})
+	stuck := make(chan error, 1)
+	mockClient1.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			<-release
+			_, err := dst.Write(blob.Content)
+			stuck <- err
+			return err
+		})
+	mockClient2.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			_, err := dst.Write(blob.Content)
+			return err
+		})
+
+	var buf bytes.Buffer
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, &buf))
+	close(release)
+	require.Error(<-stuck)
+	require.Equal(blob.Content, buf.Bytes())
+}
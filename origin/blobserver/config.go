@@ -16,6 +16,7 @@ package blobserver
 import (
 	"time"
 
+	"github.com/uber/kraken/utils/bandwidth"
 	"github.com/uber/kraken/utils/listener"
 )
 
@@ -23,11 +24,80 @@ import (
 type Config struct {
 	Listener                  listener.Config `yaml:"listener"`
 	DuplicateWriteBackStagger time.Duration   `yaml:"duplicate_write_back_stagger"`
+
+	// RetentionInterval is how often cached blobs are checked against the
+	// retention policies of their backends.
+	RetentionInterval time.Duration `yaml:"retention_interval"`
+
+	// ReplicationRepairInterval is how often cached blobs are checked against
+	// the replica sets of their namespaces.
+	ReplicationRepairInterval time.Duration `yaml:"replication_repair_interval"`
+
+	GC GCConfig `yaml:"gc"`
+
+	// TransferBandwidth limits the egress of blobs transferred to other
+	// origins by replication repair, drains and rebalances.
+	TransferBandwidth bandwidth.Config `yaml:"transfer_bandwidth"`
+
+	Rebalance RebalanceConfig `yaml:"rebalance"`
+}
+
+// RebalanceConfig defines how blobs are migrated to their owners after the
+// hash ring changes.
+type RebalanceConfig struct {
+	// Concurrency is the number of cached blobs rebalanced in parallel.
+	Concurrency int `yaml:"concurrency"`
+}
+
+func (c RebalanceConfig) applyDefaults() RebalanceConfig {
+	if c.Concurrency == 0 {
+		c.Concurrency = 4
+	}
+	return c
+}
+
+// GCConfig defines garbage collection of cached blobs which are not reachable
+// from any live tag, according to build-index.
+type GCConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is how often unreachable blobs are swept.
+	Interval time.Duration `yaml:"interval"`
+
+	// GracePeriod protects blobs which were uploaded shortly before
+	// build-index marked reachable digests, but were tagged after.
+	GracePeriod time.Duration `yaml:"grace_period"`
+
+	// Namespaces are regular expressions of the namespaces whose blobs are
+	// collected. Blobs of other namespaces, e.g. generic blobs which are never
+	// tagged, are never collected.
+	Namespaces []string `yaml:"namespaces"`
+
+	// DryRun reports unreachable blobs without deleting them.
+	DryRun bool `yaml:"dry_run"`
+}
+
+func (c GCConfig) applyDefaults() GCConfig {
+	if c.Interval == 0 {
+		c.Interval = 6 * time.Hour
+	}
+	if c.GracePeriod == 0 {
+		c.GracePeriod = 24 * time.Hour
+	}
+	return c
 }
 
 func (c Config) applyDefaults() Config {
 	if c.DuplicateWriteBackStagger == 0 {
 		c.DuplicateWriteBackStagger = 30 * time.Minute
 	}
+	if c.RetentionInterval == 0 {
+		c.RetentionInterval = 10 * time.Minute
+	}
+	if c.ReplicationRepairInterval == 0 {
+		c.ReplicationRepairInterval = 10 * time.Minute
+	}
+	c.GC = c.GC.applyDefaults()
+	c.Rebalance = c.Rebalance.applyDefaults()
 	return c
 }
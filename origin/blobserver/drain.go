@@ -0,0 +1,205 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// Drain states.
+const (
+	_drainServing  = "serving"
+	_drainDraining = "draining"
+	_drainDrained  = "drained"
+)
+
+// DrainStatus reports the progress of draining an origin.
+type DrainStatus struct {
+	State string `json:"state"`
+
+	// Total is the number of cached blobs to hand off.
+	Total int `json:"total"`
+
+	// HandedOff is the number of blobs held by all of their new owners.
+	HandedOff int `json:"handed_off"`
+
+	// Failed is the number of blobs which could not be handed off.
+	Failed int `json:"failed"`
+
+	Error string `json:"error,omitempty"`
+}
+
+type drainer struct {
+	mu     sync.Mutex
+	status DrainStatus
+}
+
+func newDrainer() *drainer {
+	return &drainer{status: DrainStatus{State: _drainServing}}
+}
+
+func (d *drainer) get() DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// start resets the drain status and returns true, unless a drain is already in
+// progress.
+func (d *drainer) start() (DrainStatus, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.status.State == _drainDraining {
+		return d.status, false
+	}
+	d.status = DrainStatus{State: _drainDraining}
+	return d.status, true
+}
+
+func (d *drainer) update(f func(*DrainStatus)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f(&d.status)
+}
+
+func (d *drainer) draining() bool {
+	return d.get().State != _drainServing
+}
+
+// startDrainHandler marks the origin as leaving the cluster and starts handing
+// off its cached blobs to their new owners. Starting a drain which already
+// finished runs another pass, e.g. to hand off blobs which failed.
+func (s *Server) startDrainHandler(w http.ResponseWriter, r *http.Request) error {
+	status, ok := s.drainer.start()
+	if ok {
+		log.Info("Starting drain")
+		go s.drain()
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return json.NewEncoder(w).Encode(status)
+}
+
+// getDrainHandler reports the progress of draining the origin.
+func (s *Server) getDrainHandler(w http.ResponseWriter, r *http.Request) error {
+	return json.NewEncoder(w).Encode(s.drainer.get())
+}
+
+// drain hands off every cached blob to the origins which own it once this
+// origin leaves the hash ring. While draining, the origin fails health checks
+// so other origins remove it from their hash rings.
+func (s *Server) drain() {
+	names, err := s.cas.ListCacheFiles()
+	if err != nil {
+		log.Errorf("Error draining: list cache files: %s", err)
+		s.drainer.update(func(status *DrainStatus) {
+			status.State = _drainDrained
+			status.Error = fmt.Sprintf("list cache files: %s", err)
+		})
+		return
+	}
+	s.drainer.update(func(status *DrainStatus) { status.Total = len(names) })
+	for _, name := range names {
+		err := s.handOff(name)
+		if err != nil {
+			log.With("digest", name).Errorf("Error handing off blob: %s", err)
+			s.stats.Counter("drain_failures").Inc(1)
+		} else {
+			s.stats.Counter("drain_handoffs").Inc(1)
+		}
+		s.drainer.update(func(status *DrainStatus) {
+			if err != nil {
+				status.Failed++
+			} else {
+				status.HandedOff++
+			}
+		})
+	}
+	status := s.drainer.get()
+	log.With("handed_off", status.HandedOff, "failed", status.Failed).Info("Drain finished")
+	s.drainer.update(func(status *DrainStatus) { status.State = _drainDrained })
+}
+
+// handOff writes back the blob of name if it was not yet persisted, and
+// transfers it to its new owners. Owners which already have the blob reject
+// the transfer before any data is sent, so only blobs uniquely held by this
+// origin are streamed.
+func (s *Server) handOff(name string) error {
+	d, err := core.NewSHA256DigestFromHex(name)
+	if err != nil {
+		return fmt.Errorf("parse digest: %s", err)
+	}
+	if _, err := s.cas.GetCacheFileStat(name); os.IsNotExist(err) {
+		// Evicted since listed.
+		return nil
+	}
+	if err := s.syncWriteBack(name); err != nil {
+		return err
+	}
+	var ns metadata.Namespace
+	if err := s.cas.GetCacheFileMetadata(name, &ns); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("store: %s", err)
+	}
+	var pin metadata.Pin
+	if err := s.cas.GetCacheFileMetadata(name, &pin); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("store: %s", err)
+	}
+	owners := s.drainOwners(ns.Value, d)
+	if len(owners) == 0 {
+		return errors.New("no other origins in hash ring")
+	}
+	var errs []error
+	for _, owner := range owners {
+		client := s.clientProvider.Provide(owner)
+		if err := s.transferToReplica(ns.Value, d, client); err != nil {
+			errs = append(errs, fmt.Errorf("origin %s: %s", owner, err))
+			continue
+		}
+		// Pins move with the blob, so pinned blobs stay pinned on their
+		// new owners.
+		for _, pns := range pin.Namespaces {
+			if err := client.PinBlobLocal(pns, d); err != nil {
+				errs = append(errs, fmt.Errorf("origin %s: pin: %s", owner, err))
+			}
+		}
+	}
+	return errutil.Join(errs)
+}
+
+// drainOwners returns the replica set of the blob of d under namespace without
+// this origin.
+func (s *Server) drainOwners(namespace string, d core.Digest) []string {
+	locs := s.replicas(namespace, d)
+	if !stringset.FromSlice(locs).Has(s.addr) {
+		// Health checks already removed this origin from the hash ring.
+		return locs
+	}
+	var owners []string
+	for _, addr := range s.hashRing.ReplicaLocations(d, len(locs)+1) {
+		if addr != s.addr {
+			owners = append(owners, addr)
+		}
+	}
+	return owners
+}
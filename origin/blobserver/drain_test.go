@@ -0,0 +1,181 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/writeback"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func (s *testServer) startDrain() (DrainStatus, error) {
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/drain", s.addr),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusAccepted))
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	defer resp.Body.Close()
+	var status DrainStatus
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
+
+func (s *testServer) drainStatus() (DrainStatus, error) {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/drain", s.addr))
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	defer resp.Body.Close()
+	var status DrainStatus
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
+
+func (s *testServer) waitForDrain(t *testing.T) DrainStatus {
+	var status DrainStatus
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		var err error
+		status, err = s.drainStatus()
+		return err == nil && status.State == _drainDrained
+	}))
+	return status
+}
+
+func TestDrainHandsOffBlobsToNewOwners(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+	s3 := newTestServer(t, master3, ring, cp)
+	defer s3.cleanup()
+
+	namespace := core.TagFixture()
+	servers := map[string]*testServer{master2: s2, master3: s3}
+
+	var blobs []*core.BlobFixture
+	for i := 0; i < 3; i++ {
+		blob := computeBlobForHosts(ring, master1)
+		s1.cacheBlob(namespace, blob)
+		blobs = append(blobs, blob)
+	}
+
+	status, err := s1.drainStatus()
+	require.NoError(err)
+	require.Equal(_drainServing, status.State)
+
+	_, err = s1.startDrain()
+	require.NoError(err)
+
+	status = s1.waitForDrain(t)
+	require.Equal(DrainStatus{State: _drainDrained, Total: 3, HandedOff: 3}, status)
+
+	for _, blob := range blobs {
+		owner := ring.ReplicaLocations(blob.Digest, 2)[1]
+		require.True(servers[owner].hasBlob(blob))
+		var ns metadata.Namespace
+		require.NoError(servers[owner].cas.GetCacheFileMetadata(blob.Digest.Hex(), &ns))
+		require.Equal(namespace, ns.Value)
+	}
+}
+
+func TestDrainFailsHealthChecks(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/health", s1.addr))
+	require.NoError(err)
+
+	_, err = s1.startDrain()
+	require.NoError(err)
+	s1.waitForDrain(t)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/health", s1.addr))
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+}
+
+func TestDrainWritesBackPersistedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+	s3 := newTestServer(t, master3, ring, cp)
+	defer s3.cleanup()
+
+	namespace := core.TagFixture()
+	blob := computeBlobForHosts(ring, master1)
+	s1.cacheBlob(namespace, blob)
+	_, err := s1.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewPersist(true))
+	require.NoError(err)
+
+	task := writeback.NewTask(namespace, blob.Digest.Hex(), 0)
+	s1.writeBackManager.EXPECT().Find(
+		writeback.NewNameQuery(blob.Digest.Hex())).Return([]persistedretry.Task{task}, nil)
+	s1.writeBackManager.EXPECT().SyncExec(task).Return(nil)
+
+	_, err = s1.startDrain()
+	require.NoError(err)
+
+	status := s1.waitForDrain(t)
+	require.Equal(1, status.HandedOff)
+}
+
+func TestDrainReportsBlobsWhichFailedToHandOff(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	// master1 is the only origin, so blobs have no other owners.
+	ring := hashring.New(
+		hashring.Config{MaxReplica: 1}, hostlist.Fixture(master1), healthcheck.IdentityFilter{})
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	s1.cacheBlob(core.TagFixture(), core.NewBlobFixture())
+
+	_, err := s1.startDrain()
+	require.NoError(err)
+
+	status := s1.waitForDrain(t)
+	require.Equal(1, status.Total)
+	require.Equal(1, status.Failed)
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// GC states.
+const (
+	_gcIdle    = "idle"
+	_gcRunning = "running"
+	_gcDone    = "done"
+)
+
+// GCStatus reports the progress of the last garbage collection of cached blobs
+// unreachable from live tags.
+type GCStatus struct {
+	State      string    `json:"state"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// MarkedAt is when build-index started marking the reachable digests
+	// used by the sweep.
+	MarkedAt time.Time `json:"marked_at"`
+
+	// Reachable is the number of digests reachable from live tags.
+	Reachable int `json:"reachable"`
+
+	// Scanned is the number of cached blobs checked.
+	Scanned int `json:"scanned"`
+
+	// Swept is the number of unreachable blobs deleted, or which would have
+	// been deleted in a dry run.
+	Swept      int   `json:"swept"`
+	SweptBytes int64 `json:"swept_bytes"`
+
+	// Failed is the number of unreachable blobs which could not be deleted.
+	Failed int `json:"failed"`
+
+	DryRun bool   `json:"dry_run"`
+	Error  string `json:"error,omitempty"`
+}
+
+type collector struct {
+	mu     sync.Mutex
+	status GCStatus
+}
+
+func newCollector() *collector {
+	return &collector{status: GCStatus{State: _gcIdle}}
+}
+
+func (c *collector) get() GCStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// start resets the gc status and returns true, unless a gc is already in
+// progress.
+func (c *collector) start(now time.Time, dryRun bool) (GCStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status.State == _gcRunning {
+		return c.status, false
+	}
+	c.status = GCStatus{State: _gcRunning, StartedAt: now, DryRun: dryRun}
+	return c.status, true
+}
+
+func (c *collector) update(f func(*GCStatus)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(&c.status)
+}
+
+// CollectGarbage periodically sweeps cached blobs unreachable from live tags,
+// until stop is closed. Noop if garbage collection is disabled.
+func (s *Server) CollectGarbage(stop <-chan struct{}) {
+	if !s.config.GC.Enabled {
+		return
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.clk.After(s.config.GC.Interval):
+			if _, ok := s.collector.start(s.clk.Now(), s.config.GC.DryRun); ok {
+				s.collectGarbage()
+			}
+		}
+	}
+}
+
+// startGCHandler starts sweeping cached blobs unreachable from live tags.
+func (s *Server) startGCHandler(w http.ResponseWriter, r *http.Request) error {
+	if !s.config.GC.Enabled {
+		return handler.Errorf("gc disabled").Status(http.StatusNotFound)
+	}
+	status, ok := s.collector.start(s.clk.Now(), s.config.GC.DryRun)
+	if ok {
+		log.Info("Starting gc")
+		go s.collectGarbage()
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return json.NewEncoder(w).Encode(status)
+}
+
+// getGCHandler reports the result of the last gc.
+func (s *Server) getGCHandler(w http.ResponseWriter, r *http.Request) error {
+	return json.NewEncoder(w).Encode(s.collector.get())
+}
+
+// collectGarbage deletes cached blobs of the collected namespaces which are
+// not reachable from any live tag, and were cached before build-index marked
+// reachable digests by more than the grace period. Blobs which have not been
+// written back yet, or are pinned, are never collected.
+func (s *Server) collectGarbage() {
+	err := s.sweep()
+	if err != nil {
+		log.Errorf("Error collecting garbage: %s", err)
+		s.stats.Counter("gc_failures").Inc(1)
+	}
+	s.collector.update(func(status *GCStatus) {
+		status.State = _gcDone
+		status.FinishedAt = s.clk.Now()
+		if err != nil {
+			status.Error = err.Error()
+		}
+	})
+	status := s.collector.get()
+	log.With(
+		"scanned", status.Scanned,
+		"swept", status.Swept,
+		"swept_bytes", status.SweptBytes,
+		"failed", status.Failed,
+		"dry_run", status.DryRun).Info("GC finished")
+}
+
+func (s *Server) sweep() error {
+	reachable, err := s.tagClient.Reachable()
+	if err != nil {
+		return fmt.Errorf("get reachable digests: %s", err)
+	}
+	if len(reachable.Digests) == 0 {
+		// Most likely a misconfiguration of build-index, which would
+		// otherwise collect every blob.
+		return errors.New("no reachable digests")
+	}
+	live := make(stringset.Set, len(reachable.Digests))
+	for _, d := range reachable.Digests {
+		live.Add(d.Hex())
+	}
+	cutoff := reachable.MarkedAt
+	if now := s.clk.Now(); now.Before(cutoff) {
+		cutoff = now
+	}
+	cutoff = cutoff.Add(-s.config.GC.GracePeriod)
+
+	s.collector.update(func(status *GCStatus) {
+		status.MarkedAt = reachable.MarkedAt
+		status.Reachable = len(reachable.Digests)
+	})
+
+	namespaces, err := cachedNamespaces(s.cas)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingWriteBack(s.cas)
+	if err != nil {
+		return err
+	}
+	for name, namespace := range namespaces {
+		size, swept, err := s.sweepBlob(name, namespace, live, pending, cutoff)
+		if err != nil {
+			log.With("digest", name).Errorf("Error sweeping blob: %s", err)
+		} else if swept {
+			s.stats.Counter("gc_swept").Inc(1)
+			s.stats.Counter("gc_swept_bytes").Inc(size)
+		}
+		s.collector.update(func(status *GCStatus) {
+			status.Scanned++
+			if err != nil {
+				status.Failed++
+			} else if swept {
+				status.Swept++
+				status.SweptBytes += size
+			}
+		})
+	}
+	return nil
+}
+
+// sweepBlob deletes the blob of name in namespace if it is unreachable and
+// collectable. Blobs pending write-back are never swept. Returns the size of
+// the blob and whether it was swept.
+func (s *Server) sweepBlob(
+	name, namespace string,
+	live, pending stringset.Set,
+	cutoff time.Time) (size int64, swept bool, err error) {
+
+	if live.Has(name) || !s.collectsNamespace(namespace) {
+		return 0, false, nil
+	}
+	if pending.Has(name) || s.pinned(name) {
+		return 0, false, nil
+	}
+	info, err := s.cas.GetCacheFileStat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("store: %s", err)
+	}
+	if !info.ModTime().Before(cutoff) {
+		return 0, false, nil
+	}
+	if s.config.GC.DryRun {
+		log.With("namespace", namespace, "digest", name).Info("Would sweep unreachable blob")
+		return info.Size(), true, nil
+	}
+	if err := s.cas.DeleteCacheFile(name); err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("delete cache file: %s", err)
+	}
+	log.With("namespace", namespace, "digest", name).Info("Swept unreachable blob")
+	return info.Size(), true, nil
+}
+
+func compileNamespaces(namespaces []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, ns := range namespaces {
+		re, err := regexp.Compile(ns)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %s", ns, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func (s *Server) collectsNamespace(namespace string) bool {
+	for _, re := range s.gcNamespaces {
+		if re.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func (s *testServer) enableGC(config GCConfig) {
+	config.Enabled = true
+	s.server.config.GC = config.applyDefaults()
+	namespaces, err := compileNamespaces(config.Namespaces)
+	if err != nil {
+		panic(err)
+	}
+	s.server.gcNamespaces = namespaces
+}
+
+func (s *testServer) startGC() (GCStatus, error) {
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/gc", s.addr),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusAccepted))
+	if err != nil {
+		return GCStatus{}, err
+	}
+	defer resp.Body.Close()
+	var status GCStatus
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
+
+func (s *testServer) gcStatus() (GCStatus, error) {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/gc", s.addr))
+	if err != nil {
+		return GCStatus{}, err
+	}
+	defer resp.Body.Close()
+	var status GCStatus
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
+
+func (s *testServer) runGC(t *testing.T) GCStatus {
+	_, err := s.startGC()
+	require.NoError(t, err)
+	var status GCStatus
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		var err error
+		status, err = s.gcStatus()
+		return err == nil && status.State == _gcDone
+	}))
+	return status
+}
+
+func TestGCSweepsUnreachableBlobs(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	s.enableGC(GCConfig{
+		GracePeriod: time.Hour,
+		Namespaces:  []string{regexp.QuoteMeta(namespace)},
+	})
+
+	live := core.NewBlobFixture()
+	s.cacheBlob(namespace, live)
+
+	dead := core.NewBlobFixture()
+	s.cacheBlob(namespace, dead)
+
+	pinned := core.NewBlobFixture()
+	s.cacheBlob(namespace, pinned)
+	require.NoError(s.cas.PinCacheFile(pinned.Digest.Hex(), namespace))
+
+	other := core.NewBlobFixture()
+	s.cacheBlob(core.TagFixture(), other)
+
+	s.clk.Add(2 * time.Hour)
+
+	s.tagClient.EXPECT().Reachable().Return(&tagmodels.ReachableResponse{
+		MarkedAt: s.clk.Now(),
+		Digests:  core.DigestList{live.Digest},
+	}, nil)
+
+	status := s.runGC(t)
+	require.Empty(status.Error)
+	require.Equal(1, status.Reachable)
+	require.Equal(4, status.Scanned)
+	require.Equal(1, status.Swept)
+	require.Equal(int64(len(dead.Content)), status.SweptBytes)
+	require.Equal(0, status.Failed)
+
+	require.True(s.hasBlob(live))
+	require.False(s.hasBlob(dead))
+	require.True(s.hasBlob(pinned))
+	require.True(s.hasBlob(other))
+}
+
+func TestGCKeepsBlobsWithinGracePeriod(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	s.enableGC(GCConfig{
+		GracePeriod: time.Hour,
+		Namespaces:  []string{".*"},
+	})
+
+	blob := core.NewBlobFixture()
+	s.cacheBlob(namespace, blob)
+
+	// The blob may have been tagged right after build-index started marking.
+	s.tagClient.EXPECT().Reachable().Return(&tagmodels.ReachableResponse{
+		MarkedAt: s.clk.Now(),
+		Digests:  core.DigestList{core.DigestFixture()},
+	}, nil)
+
+	status := s.runGC(t)
+	require.Equal(0, status.Swept)
+	require.True(s.hasBlob(blob))
+}
+
+func TestGCDryRun(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	s.enableGC(GCConfig{
+		GracePeriod: time.Hour,
+		Namespaces:  []string{".*"},
+		DryRun:      true,
+	})
+
+	blob := core.NewBlobFixture()
+	s.cacheBlob(namespace, blob)
+
+	s.clk.Add(2 * time.Hour)
+
+	s.tagClient.EXPECT().Reachable().Return(&tagmodels.ReachableResponse{
+		MarkedAt: s.clk.Now(),
+		Digests:  core.DigestList{core.DigestFixture()},
+	}, nil)
+
+	status := s.runGC(t)
+	require.True(status.DryRun)
+	require.Equal(1, status.Swept)
+	require.True(s.hasBlob(blob))
+}
+
+func TestGCRefusesEmptyReachableSet(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	s.enableGC(GCConfig{Namespaces: []string{".*"}})
+
+	blob := core.NewBlobFixture()
+	s.cacheBlob(core.TagFixture(), blob)
+
+	s.clk.Add(48 * time.Hour)
+
+	s.tagClient.EXPECT().Reachable().Return(&tagmodels.ReachableResponse{
+		MarkedAt: s.clk.Now(),
+	}, nil)
+
+	status := s.runGC(t)
+	require.NotEmpty(status.Error)
+	require.Equal(0, status.Swept)
+	require.True(s.hasBlob(blob))
+}
+
+func TestStartGCDisabled(t *testing.T) {
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	_, err := s.startGC()
+	require.True(t, httputil.IsNotFound(err))
+}
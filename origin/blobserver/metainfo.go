@@ -0,0 +1,109 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/metainfogen"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// _maxMetaInfoWait caps how long metainfo requests wait for background
+// generation, so long polls are not cut off by client timeouts.
+const _maxMetaInfoWait = 30 * time.Second
+
+// generateMetaInfo generates metainfo for the cached blob of d, with
+// pieceLength if non-zero. Metainfo of large blobs is generated by a background
+// job, so the request which cached the blob does not wait for it to be hashed.
+func (s *Server) generateMetaInfo(namespace string, d core.Digest, pieceLength int64) error {
+	info, err := s.cas.GetCacheFileStat(d.Hex())
+	if err != nil {
+		return fmt.Errorf("cache stat: %s", err)
+	}
+	if !s.metaInfoGenerator.Async(info.Size()) {
+		if pieceLength > 0 {
+			return s.metaInfoGenerator.GenerateWithPieceLength(d, pieceLength)
+		}
+		return s.metaInfoGenerator.Generate(namespace, d)
+	}
+	if _, err := s.metaInfoGenerator.Start(namespace, d, pieceLength); err != nil {
+		if err != metainfogen.ErrQueueFull {
+			return fmt.Errorf("start job: %s", err)
+		}
+		// The job is started again by the first metainfo request.
+		log.With("namespace", namespace, "digest", d.Hex()).Warn("Metainfo generation queue is full, deferring")
+	}
+	return nil
+}
+
+// awaitMetaInfo starts background metainfo generation for the cached blob of d
+// if not pending yet, and waits up to wait for the metainfo. Returns a "202
+// Accepted" error reporting the progress of generation if the metainfo is not
+// ready in time.
+func (s *Server) awaitMetaInfo(namespace string, d core.Digest, wait time.Duration) ([]byte, error) {
+	job, err := s.metaInfoGenerator.Start(namespace, d, 0)
+	if err == metainfogen.ErrQueueFull {
+		return nil, handler.Errorf("%s", err).Status(http.StatusServiceUnavailable)
+	} else if err != nil {
+		return nil, handler.Errorf("start metainfo generation: %s", err)
+	}
+	if !waitDone(job.Done(), min(wait, _maxMetaInfoWait)) {
+		status := job.Status()
+		return nil, handler.Errorf(
+			"generating metainfo: %s, hashed %d of %d bytes",
+			status.State, status.Hashed, status.Size).Status(http.StatusAccepted)
+	}
+	if err := job.Err(); err != nil {
+		return nil, handler.Errorf("generate metainfo: %s", err)
+	}
+	var tm metadata.TorrentMeta
+	if err := s.cas.GetCacheFileMetadata(d.Hex(), &tm); err != nil {
+		return nil, handler.Errorf("get cache metadata: %s", err)
+	}
+	return tm.Serialize()
+}
+
+// waitDone returns true if done is closed within timeout.
+func waitDone(done <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-done:
+		return true
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// getMetaInfoJobsHandler reports the progress of pending background metainfo
+// generation jobs.
+func (s *Server) getMetaInfoJobsHandler(w http.ResponseWriter, r *http.Request) error {
+	jobs := s.metaInfoGenerator.Jobs()
+	if jobs == nil {
+		jobs = []metainfogen.JobStatus{}
+	}
+	return json.NewEncoder(w).Encode(jobs)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/metainfogen"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// enableAsyncMetaInfo makes s generate metainfo of all blobs in the
+// background.
+func (s *testServer) enableAsyncMetaInfo() {
+	mg, err := metainfogen.New(metainfogen.Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 4},
+		Async:        metainfogen.AsyncConfig{SizeThreshold: 1},
+	}, s.cas)
+	if err != nil {
+		panic(err)
+	}
+	s.server.metaInfoGenerator = mg
+}
+
+func TestGetMetaInfoWaitsForBackgroundGeneration(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+	s.enableAsyncMetaInfo()
+
+	blob := core.SizedBlobFixture(64, 4)
+	namespace := core.TagFixture()
+
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	mi, err := cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestTransferBlobGeneratesMetaInfoInBackground(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+	s.enableAsyncMetaInfo()
+
+	blob := core.SizedBlobFixture(64, 8)
+	namespace := core.TagFixture()
+
+	require.NoError(cp.Provide(master1).TransferBlob(
+		namespace, blob.Digest, bytes.NewReader(blob.Content), 8))
+
+	mi, err := cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestGetMetaInfoJobs(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+	s.enableAsyncMetaInfo()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/metainfo/jobs", s.addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var jobs []metainfogen.JobStatus
+	require.NoError(json.NewDecoder(resp.Body).Decode(&jobs))
+	require.Empty(jobs)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// PinnedBlob is a blob pinned on an origin.
+type PinnedBlob struct {
+	Digest     string   `json:"digest"`
+	Namespaces []string `json:"namespaces"`
+	Size       int64    `json:"size"`
+}
+
+// PinnedBlobs lists the blobs pinned on an origin. Bytes is the disk space
+// used by pinned blobs, which cannot be reclaimed by eviction.
+type PinnedBlobs struct {
+	Blobs []PinnedBlob `json:"blobs"`
+	Bytes int64        `json:"bytes"`
+}
+
+// pinBlobHandler pins a blob for a namespace on every origin which owns it,
+// exempting the blob from eviction. Owners which do not have the blob cached
+// download it from the storage backend first, in which case "202 Accepted" is
+// returned and the request should be retried. If the local query arg is set,
+// the blob is only pinned on this origin.
+func (s *Server) pinBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, d, local, err := parseLocalParams(r)
+	if err != nil {
+		return err
+	}
+	if local {
+		return s.pinBlobLocal(namespace, d)
+	}
+	return s.applyToOwners(namespace, d,
+		func() error { return s.pinBlobLocal(namespace, d) },
+		func(c blobclient.Client) error { return c.PinBlobLocal(namespace, d) })
+}
+
+// unpinBlobHandler removes the pin of a namespace from a blob on every origin
+// which owns it. If the local query arg is set, the blob is only unpinned on
+// this origin.
+func (s *Server) unpinBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, d, local, err := parseLocalParams(r)
+	if err != nil {
+		return err
+	}
+	if local {
+		return s.unpinBlobLocal(namespace, d)
+	}
+	return s.applyToOwners(namespace, d,
+		func() error { return s.unpinBlobLocal(namespace, d) },
+		func(c blobclient.Client) error { return c.UnpinBlobLocal(namespace, d) })
+}
+
+// listPinnedBlobsHandler lists the blobs pinned on this origin, for audit.
+func (s *Server) listPinnedBlobsHandler(w http.ResponseWriter, r *http.Request) error {
+	files, err := s.cas.ListPinnedCacheFiles()
+	if err != nil {
+		return handler.Errorf("list pinned cache files: %s", err)
+	}
+	pinned := PinnedBlobs{Blobs: []PinnedBlob{}}
+	for _, f := range files {
+		pinned.Blobs = append(pinned.Blobs, PinnedBlob{
+			Digest:     f.Name,
+			Namespaces: f.Namespaces,
+			Size:       f.Size,
+		})
+		pinned.Bytes += f.Size
+	}
+	return json.NewEncoder(w).Encode(pinned)
+}
+
+func parseLocalParams(r *http.Request) (namespace string, d core.Digest, local bool, err error) {
+	namespace, err = httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return "", core.Digest{}, false, err
+	}
+	d, err = httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return "", core.Digest{}, false, err
+	}
+	local, err = strconv.ParseBool(httputil.GetQueryArg(r, "local", "false"))
+	if err != nil {
+		return "", core.Digest{}, false, handler.Errorf("parse arg `local` as bool: %s", err).
+			Status(http.StatusBadRequest)
+	}
+	return namespace, d, local, nil
+}
+
+func (s *Server) pinBlobLocal(namespace string, d core.Digest) error {
+	if err := s.cas.PinCacheFile(d.Hex(), namespace); err != nil {
+		if os.IsNotExist(err) {
+			log.With("namespace", namespace, "digest", d.Hex()).
+				Info("Blob to pin not in cache, initiating download from backend")
+			return s.startRemoteBlobDownload(namespace, d, false)
+		}
+		return handler.Errorf("pin cache file: %s", err)
+	}
+	log.With("namespace", namespace, "digest", d.Hex()).Info("Pinned blob")
+	return nil
+}
+
+func (s *Server) unpinBlobLocal(namespace string, d core.Digest) error {
+	if err := s.cas.UnpinCacheFile(d.Hex(), namespace); err != nil {
+		if os.IsNotExist(err) {
+			// Blobs which are not cached are not pinned either.
+			return nil
+		}
+		return handler.Errorf("unpin cache file: %s", err)
+	}
+	log.With("namespace", namespace, "digest", d.Hex()).Info("Unpinned blob")
+	return nil
+}
+
+// applyToOwners applies local to this origin if it owns the blob of d, and
+// remote to every other owner, concurrently. If any owner does not have the
+// blob, "404 Not Found" takes precedence over "202 Accepted", which takes
+// precedence over "400 Bad Request" and other errors.
+func (s *Server) applyToOwners(
+	namespace string, d core.Digest, local func() error, remote func(blobclient.Client) error) error {
+
+	var mu sync.Mutex
+	var errs []error
+	statuses := make(map[int]bool)
+
+	var wg sync.WaitGroup
+	for _, addr := range s.replicas(namespace, d) {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			var err error
+			if addr == s.addr {
+				err = local()
+			} else {
+				err = remote(s.clientProvider.Provide(addr))
+			}
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("origin %s: %s", addr, err))
+			statuses[errStatus(err)] = true
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+
+	switch {
+	case len(errs) == 0:
+		return nil
+	case statuses[http.StatusNotFound]:
+		return handler.ErrorStatus(http.StatusNotFound)
+	case statuses[http.StatusAccepted]:
+		return handler.ErrorStatus(http.StatusAccepted)
+	case statuses[http.StatusBadRequest]:
+		return handler.Errorf("%s", errutil.Join(errs)).Status(http.StatusBadRequest)
+	default:
+		return handler.Errorf("%s", errutil.Join(errs))
+	}
+}
+
+// errStatus returns the HTTP status of err, which is either returned by a
+// handler of this origin or by a client of another origin.
+func errStatus(err error) int {
+	switch e := err.(type) {
+	case *handler.Error:
+		return e.GetStatus()
+	case httputil.StatusError:
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// pinned returns true if any namespace pinned the blob of name.
+func (s *Server) pinned(name string) bool {
+	var pin metadata.Pin
+	return s.cas.GetCacheFileMetadata(name, &pin) == nil && pin.Pinned()
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func (s *testServer) pinURL(namespace string, d core.Digest) string {
+	return fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s/pin", s.addr, url.PathEscape(namespace), d)
+}
+
+func (s *testServer) pin(namespace string, d core.Digest) error {
+	_, err := httputil.Post(s.pinURL(namespace, d))
+	return err
+}
+
+func (s *testServer) unpin(namespace string, d core.Digest) error {
+	_, err := httputil.Delete(s.pinURL(namespace, d))
+	return err
+}
+
+func (s *testServer) listPins() (PinnedBlobs, error) {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/pins", s.addr))
+	if err != nil {
+		return PinnedBlobs{}, err
+	}
+	defer resp.Body.Close()
+	var pinned PinnedBlobs
+	if err := json.NewDecoder(resp.Body).Decode(&pinned); err != nil {
+		return PinnedBlobs{}, err
+	}
+	return pinned, nil
+}
+
+func TestPinBlobAppliesToAllOwners(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingSomeReplica()
+	cp := newTestClientProvider()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	namespace := core.TagFixture()
+	blob := computeBlobForHosts(ring, s1.host, s2.host)
+	s1.cacheBlob(namespace, blob)
+	s2.cacheBlob(namespace, blob)
+
+	require.NoError(s1.pin(namespace, blob.Digest))
+	require.True(s1.server.pinned(blob.Digest.Hex()))
+	require.True(s2.server.pinned(blob.Digest.Hex()))
+
+	pinned, err := s2.listPins()
+	require.NoError(err)
+	require.Equal(PinnedBlobs{
+		Blobs: []PinnedBlob{{
+			Digest:     blob.Digest.Hex(),
+			Namespaces: []string{namespace},
+			Size:       int64(len(blob.Content)),
+		}},
+		Bytes: int64(len(blob.Content)),
+	}, pinned)
+
+	require.NoError(s2.unpin(namespace, blob.Digest))
+	require.False(s1.server.pinned(blob.Digest.Hex()))
+	require.False(s2.server.pinned(blob.Digest.Hex()))
+
+	pinned, err = s1.listPins()
+	require.NoError(err)
+	require.Empty(pinned.Blobs)
+}
+
+func TestPinBlobDownloadsMissingBlobFromBackend(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+
+	s := newTestServer(t, master1, ring, newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	blob := computeBlobForHosts(ring, s.host)
+
+	client := s.backendClient(namespace, false)
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(blob.Info(), nil).AnyTimes()
+	client.EXPECT().Download(
+		namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	require.True(httputil.IsAccepted(s.pin(namespace, blob.Digest)))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return !httputil.IsAccepted(s.pin(namespace, blob.Digest))
+	}))
+	require.True(s.server.pinned(blob.Digest.Hex()))
+}
+
+func TestPinnedBlobIsNotEvicted(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	ring := hashRingNoReplica()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	s.backendClient(namespace, false)
+	require.NoError(s.backendManager.SetRetention(namespace, backend.RetentionConfig{MaxAge: time.Hour}))
+
+	blob := computeBlobForHosts(ring, s.host)
+	s.cacheBlob(namespace, blob)
+
+	require.NoError(cp.Provide(master1).PinBlobLocal(namespace, blob.Digest))
+
+	require.True(httputil.IsConflict(cp.Provide(master1).DeleteBlob(blob.Digest)))
+
+	s.clk.Add(2 * time.Hour)
+
+	require.NoError(s.server.enforceRetention())
+	require.True(s.hasBlob(blob))
+
+	require.NoError(cp.Provide(master1).UnpinBlobLocal(namespace, blob.Digest))
+
+	require.NoError(s.server.enforceRetention())
+	require.False(s.hasBlob(blob))
+}
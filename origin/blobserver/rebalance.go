@@ -0,0 +1,251 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// Rebalance states.
+const (
+	_rebalanceIdle        = "idle"
+	_rebalanceRebalancing = "rebalancing"
+	_rebalanceDone        = "done"
+)
+
+// RebalanceStatus reports the progress of migrating cached blobs to the
+// origins which own them under the current hash ring.
+type RebalanceStatus struct {
+	State      string    `json:"state"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// Total is the number of cached blobs to check.
+	Total int `json:"total"`
+
+	// Scanned is the number of cached blobs checked so far.
+	Scanned int `json:"scanned"`
+
+	// Moved is the number of blobs transferred to owners missing them, and
+	// MovedBytes their total size.
+	Moved      int   `json:"moved"`
+	MovedBytes int64 `json:"moved_bytes"`
+
+	// Failed is the number of blobs which could not be transferred to all of
+	// their owners.
+	Failed int `json:"failed"`
+
+	Error string `json:"error,omitempty"`
+}
+
+type rebalancer struct {
+	mu     sync.Mutex
+	status RebalanceStatus
+}
+
+func newRebalancer() *rebalancer {
+	return &rebalancer{status: RebalanceStatus{State: _rebalanceIdle}}
+}
+
+func (r *rebalancer) get() RebalanceStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// start resets the rebalance status and returns true, unless a rebalance is
+// already in progress.
+func (r *rebalancer) start(now time.Time) (RebalanceStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.State == _rebalanceRebalancing {
+		return r.status, false
+	}
+	r.status = RebalanceStatus{State: _rebalanceRebalancing, StartedAt: now}
+	return r.status, true
+}
+
+func (r *rebalancer) update(f func(*RebalanceStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.status)
+}
+
+// startRebalanceHandler starts transferring cached blobs to the owners which
+// are missing them under the current hash ring, e.g. origins which were just
+// added to the cluster. Rebalances must be started on every origin.
+func (s *Server) startRebalanceHandler(w http.ResponseWriter, r *http.Request) error {
+	status, ok := s.rebalancer.start(s.clk.Now())
+	if ok {
+		log.Info("Starting rebalance")
+		go s.rebalance()
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return json.NewEncoder(w).Encode(status)
+}
+
+// getRebalanceHandler reports the progress of the last rebalance.
+func (s *Server) getRebalanceHandler(w http.ResponseWriter, r *http.Request) error {
+	return json.NewEncoder(w).Encode(s.rebalancer.get())
+}
+
+func (s *Server) rebalance() {
+	names, err := s.cas.ListCacheFiles()
+	if err != nil {
+		log.Errorf("Error rebalancing: list cache files: %s", err)
+		s.rebalancer.update(func(status *RebalanceStatus) {
+			status.State = _rebalanceDone
+			status.FinishedAt = s.clk.Now()
+			status.Error = fmt.Sprintf("list cache files: %s", err)
+		})
+		return
+	}
+	s.rebalancer.update(func(status *RebalanceStatus) { status.Total = len(names) })
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Rebalance.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range work {
+				s.rebalanceBlobAndRecord(name)
+			}
+		}()
+	}
+	for _, name := range names {
+		work <- name
+	}
+	close(work)
+	wg.Wait()
+
+	s.rebalancer.update(func(status *RebalanceStatus) {
+		status.State = _rebalanceDone
+		status.FinishedAt = s.clk.Now()
+	})
+	status := s.rebalancer.get()
+	log.With(
+		"moved", status.Moved,
+		"moved_bytes", status.MovedBytes,
+		"failed", status.Failed).Info("Rebalance finished")
+}
+
+func (s *Server) rebalanceBlobAndRecord(name string) {
+	size, moved, err := s.rebalanceBlob(name)
+	if err != nil {
+		log.With("digest", name).Errorf("Error rebalancing blob: %s", err)
+		s.stats.Counter("rebalance_failures").Inc(1)
+	} else if moved {
+		s.stats.Counter("rebalance_moves").Inc(1)
+		s.stats.Counter("rebalance_moved_bytes").Inc(size)
+	}
+	s.rebalancer.update(func(status *RebalanceStatus) {
+		status.Scanned++
+		if err != nil {
+			status.Failed++
+		} else if moved {
+			status.Moved++
+			status.MovedBytes += size
+		}
+	})
+}
+
+// rebalanceBlob transfers the blob of name to its owners which are missing it.
+// Every origin which has the blob rebalances it, so only the holder ranked
+// first by the hash ring transfers it, and owners receive each blob once.
+// Returns the size of the blob and whether it was transferred.
+func (s *Server) rebalanceBlob(name string) (size int64, moved bool, err error) {
+	d, err := core.NewSHA256DigestFromHex(name)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse digest: %s", err)
+	}
+	info, err := s.cas.GetCacheFileStat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Evicted since listed.
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("store: %s", err)
+	}
+	var ns metadata.Namespace
+	if err := s.cas.GetCacheFileMetadata(name, &ns); err != nil && !os.IsNotExist(err) {
+		return 0, false, fmt.Errorf("store: %s", err)
+	}
+
+	holders := stringset.New(s.addr)
+	var missing []string
+	for _, owner := range s.replicas(ns.Value, d) {
+		if owner == s.addr {
+			continue
+		}
+		has, err := s.hasLocal(owner, ns.Value, d)
+		if err != nil {
+			return 0, false, fmt.Errorf("stat owner %s: %s", owner, err)
+		}
+		if has {
+			holders.Add(owner)
+		} else {
+			missing = append(missing, owner)
+		}
+	}
+	if len(missing) == 0 {
+		return 0, false, nil
+	}
+	for _, addr := range s.hashRing.ReplicaLocations(d, math.MaxInt32) {
+		if addr == s.addr {
+			break
+		}
+		has := holders.Has(addr)
+		if !has && !slices.Contains(missing, addr) {
+			if has, err = s.hasLocal(addr, ns.Value, d); err != nil {
+				return 0, false, fmt.Errorf("stat origin %s: %s", addr, err)
+			}
+		}
+		if has {
+			// addr is ranked before this origin and transfers the blob.
+			return 0, false, nil
+		}
+	}
+	for _, owner := range missing {
+		if err := s.transferToReplica(ns.Value, d, s.clientProvider.Provide(owner)); err != nil {
+			return 0, false, fmt.Errorf("transfer to %s: %s", owner, err)
+		}
+		log.With("namespace", ns.Value, "digest", name, "owner", owner).Info("Rebalanced blob")
+	}
+	return info.Size(), true, nil
+}
+
+// hasLocal returns true if the origin at addr has the blob of d cached.
+func (s *Server) hasLocal(addr, namespace string, d core.Digest) (bool, error) {
+	if _, err := s.clientProvider.Provide(addr).StatLocal(namespace, d); err != nil {
+		if err == blobclient.ErrBlobNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
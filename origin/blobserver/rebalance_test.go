@@ -0,0 +1,120 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func (s *testServer) rebalanceStatus() (RebalanceStatus, error) {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/rebalance", s.addr))
+	if err != nil {
+		return RebalanceStatus{}, err
+	}
+	defer resp.Body.Close()
+	var status RebalanceStatus
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
+
+func (s *testServer) runRebalance(t *testing.T) RebalanceStatus {
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/rebalance", s.addr),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusAccepted))
+	require.NoError(t, err)
+	var status RebalanceStatus
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		var err error
+		status, err = s.rebalanceStatus()
+		return err == nil && status.State == _rebalanceDone
+	}))
+	return status
+}
+
+func TestRebalanceMovesBlobsToNewOwners(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+	s3 := newTestServer(t, master3, ring, cp)
+	defer s3.cleanup()
+
+	namespace := core.TagFixture()
+
+	// master1 owns the blob, but only master2 has it, e.g. because master1
+	// was just added to the cluster.
+	blob := computeBlobForHosts(ring, master1)
+	s2.cacheBlob(namespace, blob)
+
+	status := s2.runRebalance(t)
+	require.Empty(status.Error)
+	require.Equal(1, status.Total)
+	require.Equal(1, status.Scanned)
+	require.Equal(1, status.Moved)
+	require.Equal(int64(len(blob.Content)), status.MovedBytes)
+	require.Equal(0, status.Failed)
+
+	require.True(s1.hasBlob(blob))
+	require.True(s2.hasBlob(blob))
+	require.False(s3.hasBlob(blob))
+
+	// Owners which have the blob are skipped.
+	status = s2.runRebalance(t)
+	require.Equal(0, status.Moved)
+}
+
+func TestRebalanceOnlyMovesFromFirstRankedHolder(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	servers := make(map[string]*testServer)
+	for _, host := range []string{master1, master2, master3} {
+		s := newTestServer(t, host, ring, cp)
+		defer s.cleanup()
+		servers[host] = s
+	}
+
+	namespace := core.TagFixture()
+
+	blob := computeBlobForHosts(ring, master3)
+	order := ring.ReplicaLocations(blob.Digest, 3)
+	require.Equal(master3, order[0])
+	first, second := servers[order[1]], servers[order[2]]
+	first.cacheBlob(namespace, blob)
+	second.cacheBlob(namespace, blob)
+
+	status := second.runRebalance(t)
+	require.Equal(0, status.Moved)
+	require.False(servers[master3].hasBlob(blob))
+
+	status = first.runRebalance(t)
+	require.Equal(1, status.Moved)
+	require.True(servers[master3].hasBlob(blob))
+}
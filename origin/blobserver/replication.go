@@ -0,0 +1,138 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// RepairReplication periodically converges the replication of cached blobs
+// with the replica sets of their namespaces, until stop is closed.
+func (s *Server) RepairReplication(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.clk.After(s.config.ReplicationRepairInterval):
+			if err := s.repairReplication(); err != nil {
+				log.Errorf("Error repairing replication: %s", err)
+			}
+		}
+	}
+}
+
+// repairReplication converges cached blobs with the replica sets of their
+// namespaces, which change when replica counts are reconfigured or origins
+// join or leave the ring. The first origin of a replica set transfers the blob
+// to replicas missing it, and origins outside of the replica set evict the
+// blob once every replica has it. Blobs of unknown namespace are skipped.
+func (s *Server) repairReplication() error {
+	if s.drainer.draining() {
+		// Draining origins hand off all of their blobs instead.
+		return nil
+	}
+	namespaces, err := cachedNamespaces(s.cas)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingWriteBack(s.cas)
+	if err != nil {
+		return err
+	}
+	for name, namespace := range namespaces {
+		d, err := core.NewSHA256DigestFromHex(name)
+		if err != nil {
+			log.With("digest", name).Errorf("Error parsing cached blob digest: %s", err)
+			continue
+		}
+		replicas := s.replicas(namespace, d)
+		if replicas[0] == s.addr {
+			s.repairReplicas(namespace, d, replicas[1:])
+		} else if !stringset.FromSlice(replicas).Has(s.addr) && !pending.Has(name) {
+			s.evictReplica(namespace, d, replicas)
+		}
+	}
+	return nil
+}
+
+// repairReplicas transfers the blob of d to the replicas which do not have it.
+func (s *Server) repairReplicas(namespace string, d core.Digest, replicas []string) {
+	for _, replica := range replicas {
+		client := s.clientProvider.Provide(replica)
+		_, err := client.StatLocal(namespace, d)
+		if err == nil {
+			continue
+		}
+		if err != blobclient.ErrBlobNotFound {
+			log.With("namespace", namespace, "digest", d.Hex(), "replica", replica).
+				Errorf("Error checking replica: %s", err)
+			s.stats.Counter("replication_repair_errors").Inc(1)
+			continue
+		}
+		if err := s.transferToReplica(namespace, d, client); err != nil {
+			log.With("namespace", namespace, "digest", d.Hex(), "replica", replica).
+				Errorf("Error repairing replica: %s", err)
+			s.stats.Counter("replication_repair_errors").Inc(1)
+			continue
+		}
+		s.stats.Counter("replication_repairs").Inc(1)
+		log.With("namespace", namespace, "digest", d.Hex(), "replica", replica).
+			Info("Repaired under-replicated blob")
+	}
+}
+
+func (s *Server) transferToReplica(
+	namespace string, d core.Digest, client blobclient.Client) error {
+
+	f, err := s.cas.GetCacheFileReader(d.Hex())
+	if err != nil {
+		return fmt.Errorf("get cache reader: %s", err)
+	}
+	defer closers.Close(f)
+	blob := s.transferLimiter.EgressReader(f)
+	if err := client.TransferBlob(namespace, d, blob, s.transferPieceLength(d)); err != nil {
+		return fmt.Errorf("transfer blob: %s", err)
+	}
+	if err := s.transferAnnotations(namespace, d, client); err != nil {
+		return fmt.Errorf("transfer annotations: %s", err)
+	}
+	return nil
+}
+
+// evictReplica evicts the blob of d, which is cached outside of its replica
+// set and written back. Blobs are only evicted once every replica has them, so
+// over-replicated blobs are never under-replicated in between.
+func (s *Server) evictReplica(namespace string, d core.Digest, replicas []string) {
+	if s.pinned(d.Hex()) {
+		return
+	}
+	for _, replica := range replicas {
+		if _, err := s.clientProvider.Provide(replica).StatLocal(namespace, d); err != nil {
+			return
+		}
+	}
+	if err := s.cas.DeleteCacheFile(d.Hex()); err != nil && !os.IsNotExist(err) {
+		log.With("namespace", namespace, "digest", d.Hex()).Errorf("Error evicting over-replicated blob: %s", err)
+		return
+	}
+	s.stats.Counter("replication_evictions").Inc(1)
+	log.With("namespace", namespace, "digest", d.Hex()).Info("Evicted over-replicated blob")
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+func TestRepairReplicationTransfersToMissingReplicas(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+	s3 := newTestServer(t, master3, ring, cp)
+	defer s3.cleanup()
+
+	namespace := core.TagFixture()
+	s1.backendClient(namespace, false)
+	require.NoError(s1.backendManager.SetReplicas(namespace, 3))
+
+	blob := computeBlobForHosts(ring, master1)
+	s1.cacheBlob(namespace, blob)
+
+	require.NoError(s1.server.repairReplication())
+
+	for _, s := range []*testServer{s2, s3} {
+		require.True(s.hasBlob(blob))
+		var ns metadata.Namespace
+		require.NoError(s.cas.GetCacheFileMetadata(blob.Digest.Hex(), &ns))
+		require.Equal(namespace, ns.Value)
+	}
+}
+
+func TestRepairReplicationOnlyRepairsFromFirstReplica(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+	s3 := newTestServer(t, master3, ring, cp)
+	defer s3.cleanup()
+
+	namespace := core.TagFixture()
+	s2.backendClient(namespace, false)
+	require.NoError(s2.backendManager.SetReplicas(namespace, 3))
+
+	// master2 has the blob but is not the first replica, so it leaves the
+	// repair to master1.
+	blob := computeBlobForHosts(ring, master1)
+	s2.cacheBlob(namespace, blob)
+
+	require.NoError(s2.server.repairReplication())
+
+	require.False(s1.hasBlob(blob))
+	require.False(s3.hasBlob(blob))
+}
+
+func TestRepairReplicationEvictsOverReplicatedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingMaxReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	namespace := core.TagFixture()
+	s2.backendClient(namespace, false)
+	require.NoError(s2.backendManager.SetReplicas(namespace, 1))
+
+	blob := computeBlobForHosts(hashRingNoReplica(), master1)
+	s2.cacheBlob(namespace, blob)
+
+	// The only replica does not have the blob yet.
+	require.NoError(s2.server.repairReplication())
+	require.True(s2.hasBlob(blob))
+
+	s1.cacheBlob(namespace, blob)
+
+	require.NoError(s2.server.repairReplication())
+	require.False(s2.hasBlob(blob))
+}
+
+func TestRepairReplicationDoesNotEvictBlobsPendingWriteBack(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingMaxReplica()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	namespace := core.TagFixture()
+	s2.backendClient(namespace, false)
+	require.NoError(s2.backendManager.SetReplicas(namespace, 1))
+
+	blob := computeBlobForHosts(hashRingNoReplica(), master1)
+	s1.cacheBlob(namespace, blob)
+	s2.cacheBlob(namespace, blob)
+	_, err := s2.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewPersist(true))
+	require.NoError(err)
+
+	require.NoError(s2.server.repairReplication())
+	require.True(s2.hasBlob(blob))
+}
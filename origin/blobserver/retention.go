@@ -0,0 +1,139 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Reasons for evicting a blob under a retention policy.
+const (
+	_retentionMaxAge      = "max_age"
+	_retentionMaxVersions = "max_versions"
+	_retentionDeleted     = "deleted_from_backend"
+)
+
+type cachedBlob struct {
+	name    string
+	modTime time.Time
+}
+
+// EnforceRetention periodically evicts cached blobs which violate the
+// retention policy of their namespace, until stop is closed.
+func (s *Server) EnforceRetention(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.clk.After(s.config.RetentionInterval):
+			if err := s.enforceRetention(); err != nil {
+				log.Errorf("Error enforcing retention: %s", err)
+			}
+		}
+	}
+}
+
+// enforceRetention evicts cached blobs of namespaces with a retention policy
+// which are older than the policy's max age, exceed the policy's max versions,
+// or were deleted from the storage of record. Blobs which have not been
+// written back yet, or are pinned, are never evicted.
+func (s *Server) enforceRetention() error {
+	namespaces, err := cachedNamespaces(s.cas)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingWriteBack(s.cas)
+	if err != nil {
+		return err
+	}
+	blobs := make(map[string][]cachedBlob)
+	for name, namespace := range namespaces {
+		if !s.backends.GetRetention(namespace).Enabled() {
+			continue
+		}
+		if pending.Has(name) || s.pinned(name) {
+			continue
+		}
+		info, err := s.cas.GetCacheFileStat(name)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.With("digest", name).Errorf("Error reading cache file stat: %s", err)
+			}
+			continue
+		}
+		blobs[namespace] = append(blobs[namespace], cachedBlob{name, info.ModTime()})
+	}
+	for namespace, nsBlobs := range blobs {
+		s.enforceNamespaceRetention(namespace, s.backends.GetRetention(namespace), nsBlobs)
+	}
+	return nil
+}
+
+func (s *Server) enforceNamespaceRetention(
+	namespace string, policy backend.RetentionConfig, blobs []cachedBlob) {
+
+	// Newest first, so versions beyond the limit are the oldest ones.
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].modTime.After(blobs[j].modTime)
+	})
+	now := s.clk.Now()
+	for i, b := range blobs {
+		var reason string
+		switch {
+		case policy.MaxAge > 0 && now.Sub(b.modTime) > policy.MaxAge:
+			reason = _retentionMaxAge
+		case policy.MaxVersions > 0 && i >= policy.MaxVersions:
+			reason = _retentionMaxVersions
+		default:
+			deleted, err := s.deletedFromBackend(namespace, b.name)
+			if err != nil {
+				log.With("namespace", namespace, "digest", b.name).Errorf("Error checking backend for retention: %s", err)
+				continue
+			}
+			if !deleted {
+				continue
+			}
+			reason = _retentionDeleted
+		}
+		if err := s.cas.DeleteCacheFile(b.name); err != nil && !os.IsNotExist(err) {
+			log.With("namespace", namespace, "digest", b.name).Errorf("Error evicting blob for retention: %s", err)
+			continue
+		}
+		s.stats.Tagged(map[string]string{
+			"reason": reason,
+		}).Counter("retention_evictions").Inc(1)
+		log.With("namespace", namespace, "digest", b.name, "reason", reason).Info("Evicted blob for retention")
+	}
+}
+
+func (s *Server) deletedFromBackend(namespace, name string) (bool, error) {
+	client, err := s.backends.GetClient(namespace)
+	if err != nil {
+		return false, fmt.Errorf("get backend client: %s", err)
+	}
+	if _, err := client.Stat(namespace, name); err != nil {
+		if err == backenderrors.ErrBlobNotFound {
+			return true, nil
+		}
+		return false, fmt.Errorf("stat: %s", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/persistedretry/writeback"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+// cacheBlob caches blob as if it were downloaded from the backend of namespace.
+func (s *testServer) cacheBlob(namespace string, blob *core.BlobFixture) {
+	if err := s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)); err != nil {
+		panic(err)
+	}
+	if _, err := s.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewNamespace(namespace)); err != nil {
+		panic(err)
+	}
+}
+
+func (s *testServer) hasBlob(blob *core.BlobFixture) bool {
+	_, err := s.cas.GetCacheFileStat(blob.Digest.Hex())
+	return err == nil
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	client := s.backendClient(namespace, false)
+	require.NoError(s.backendManager.SetRetention(namespace, backend.RetentionConfig{MaxAge: time.Hour}))
+
+	blob := core.NewBlobFixture()
+	s.cacheBlob(namespace, blob)
+
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(blob.Info(), nil)
+
+	require.NoError(s.server.enforceRetention())
+	require.True(s.hasBlob(blob))
+
+	s.clk.Add(2 * time.Hour)
+
+	require.NoError(s.server.enforceRetention())
+	require.False(s.hasBlob(blob))
+}
+
+func TestRetentionMaxVersions(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	client := s.backendClient(namespace, false)
+	require.NoError(s.backendManager.SetRetention(namespace, backend.RetentionConfig{MaxVersions: 2}))
+
+	var blobs []*core.BlobFixture
+	for i := 0; i < 3; i++ {
+		blob := core.NewBlobFixture()
+		s.cacheBlob(namespace, blob)
+		blobs = append(blobs, blob)
+	}
+
+	client.EXPECT().Stat(namespace, gomock.Any()).Return(core.NewBlobInfo(1), nil).Times(2)
+
+	require.NoError(s.server.enforceRetention())
+
+	var kept int
+	for _, blob := range blobs {
+		if s.hasBlob(blob) {
+			kept++
+		}
+	}
+	require.Equal(2, kept)
+}
+
+func TestRetentionEvictsBlobsDeletedFromBackend(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	client := s.backendClient(namespace, false)
+	require.NoError(s.backendManager.SetRetention(namespace, backend.RetentionConfig{MaxAge: time.Hour}))
+
+	deleted := core.NewBlobFixture()
+	s.cacheBlob(namespace, deleted)
+
+	kept := core.NewBlobFixture()
+	s.cacheBlob(namespace, kept)
+
+	client.EXPECT().Stat(namespace, deleted.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+	client.EXPECT().Stat(namespace, kept.Digest.Hex()).Return(kept.Info(), nil)
+
+	require.NoError(s.server.enforceRetention())
+	require.False(s.hasBlob(deleted))
+	require.True(s.hasBlob(kept))
+}
+
+func TestRetentionIgnoresNamespacesWithoutPolicy(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	s.backendClient(namespace, false)
+
+	blob := core.NewBlobFixture()
+	s.cacheBlob(namespace, blob)
+
+	s.clk.Add(24 * time.Hour)
+
+	require.NoError(s.server.enforceRetention())
+	require.True(s.hasBlob(blob))
+}
+
+func TestRetentionSkipsBlobsPendingWriteBack(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+	s.backendClient(namespace, false)
+	require.NoError(s.backendManager.SetRetention(namespace, backend.RetentionConfig{MaxAge: time.Hour}))
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	require.NoError(cp.Provide(s.host).UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content)))
+
+	var ns metadata.Namespace
+	require.NoError(s.cas.GetCacheFileMetadata(blob.Digest.Hex(), &ns))
+	require.Equal(namespace, ns.Value)
+
+	s.clk.Add(2 * time.Hour)
+
+	require.NoError(s.server.enforceRetention())
+	require.True(s.hasBlob(blob))
+}
@@ -15,11 +15,12 @@ package blobserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,6 +29,7 @@ import (
 	"github.com/andres-erbsen/clock"
 	"github.com/go-chi/chi"
 	"github.com/uber-go/tally"
+	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
@@ -40,6 +42,7 @@ import (
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/bandwidth"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/handler"
@@ -65,6 +68,14 @@ type Server struct {
 	metaInfoGenerator *metainfogen.Generator
 	uploader          *uploader
 	writeBackManager  persistedretry.Manager
+	drainer           *drainer
+	rebalancer        *rebalancer
+	transferLimiter   *bandwidth.Limiter
+
+	// For garbage collection of blobs unreachable from live tags.
+	tagClient    tagclient.Client
+	gcNamespaces []*regexp.Regexp
+	collector    *collector
 
 	// This is an unfortunate coupling between the p2p client and the blob server.
 	// Tracker queries the origin cluster to discover which origins can seed
@@ -88,9 +99,22 @@ func New(
 	blobRefresher *blobrefresh.Refresher,
 	metaInfoGenerator *metainfogen.Generator,
 	writeBackManager persistedretry.Manager,
+	tagClient tagclient.Client,
 ) (*Server, error) {
 	config = config.applyDefaults()
 
+	if config.GC.Enabled && tagClient == nil {
+		return nil, errors.New("gc enabled without build-index client")
+	}
+	gcNamespaces, err := compileNamespaces(config.GC.Namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("gc: %s", err)
+	}
+	transferLimiter, err := bandwidth.NewLimiter(config.TransferBandwidth)
+	if err != nil {
+		return nil, fmt.Errorf("transfer bandwidth: %s", err)
+	}
+
 	stats = stats.Tagged(map[string]string{
 		"module": "blobserver",
 	})
@@ -110,6 +134,12 @@ func New(
 		metaInfoGenerator: metaInfoGenerator,
 		uploader:          newUploader(cas),
 		writeBackManager:  writeBackManager,
+		drainer:           newDrainer(),
+		rebalancer:        newRebalancer(),
+		transferLimiter:   transferLimiter,
+		tagClient:         tagClient,
+		gcNamespaces:      gcNamespaces,
+		collector:         newCollector(),
 		pctx:              pctx,
 	}, nil
 }
@@ -140,10 +170,32 @@ func (s *Server) Handler() http.Handler {
 	r.Get("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.downloadBlobHandler))
 	r.Post("/namespace/{namespace}/blobs/{digest}/prefetch", handler.Wrap(s.prefetchBlobHandler))
 
+	r.Post("/namespace/{namespace}/blobs/{digest}/pin", handler.Wrap(s.pinBlobHandler))
+	r.Delete("/namespace/{namespace}/blobs/{digest}/pin", handler.Wrap(s.unpinBlobHandler))
+	r.Get("/pins", handler.Wrap(s.listPinnedBlobsHandler))
+
+	r.Get("/namespace/{namespace}/blobs/{digest}/annotations", handler.Wrap(s.getAnnotationsHandler))
+	r.Patch("/namespace/{namespace}/blobs/{digest}/annotations", handler.Wrap(s.annotateBlobHandler))
+	r.Get("/annotations", handler.Wrap(s.listAnnotatedBlobsHandler))
+
 	r.Post("/namespace/{namespace}/blobs/{digest}/remote/{remote}", handler.Wrap(s.replicateToRemoteHandler))
 
 	r.Post("/forcecleanup", handler.Wrap(s.forceCleanupHandler))
 
+	r.Get("/drain", handler.Wrap(s.getDrainHandler))
+	r.Post("/drain", handler.Wrap(s.startDrainHandler))
+
+	r.Get("/rebalance", handler.Wrap(s.getRebalanceHandler))
+	r.Post("/rebalance", handler.Wrap(s.startRebalanceHandler))
+
+	r.Get("/gc", handler.Wrap(s.getGCHandler))
+
+	r.Get("/metainfo/jobs", handler.Wrap(s.getMetaInfoJobsHandler))
+	r.Post("/gc", handler.Wrap(s.startGCHandler))
+
+	r.Get("/backends/bandwidth", handler.Wrap(s.getBackendBandwidthHandler))
+	r.Post("/backends/bandwidth", handler.Wrap(s.setBackendBandwidthHandler))
+
 	// Internal endpoints:
 
 	r.Post("/internal/blobs/{digest}/uploads", handler.Wrap(s.startTransferHandler))
@@ -159,6 +211,7 @@ func (s *Server) Handler() http.Handler {
 	r.Head("/internal/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.statHandler))
 
 	r.Get("/internal/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
+	r.Get("/internal/namespace/{namespace}/blobs/{digest}/chunkindex", handler.Wrap(s.getChunkIndexHandler))
 
 	r.Put(
 		"/internal/duplicate/namespace/{namespace}/blobs/{digest}/uploads/{uid}",
@@ -176,6 +229,11 @@ func (s *Server) ListenAndServe(h http.Handler) error {
 }
 
 func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.drainer.draining() {
+		// Fail health checks so other origins remove this one from their
+		// hash rings.
+		return handler.Errorf("draining").Status(http.StatusServiceUnavailable)
+	}
 	_, err := fmt.Fprintln(w, "OK")
 	return err
 }
@@ -257,13 +315,16 @@ func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return err
 	}
+	if r.Header.Get("Range") != "" {
+		return s.downloadBlobRange(namespace, d, w, r)
+	}
 	log.With("namespace", namespace, "digest", d.Hex()).Info("Starting blob download")
+	w.Header().Set("Accept-Ranges", "bytes")
 	if err := s.downloadBlob(namespace, d, w); err != nil {
 		log.With("namespace", namespace, "digest", d.Hex(), "error", err).
 			Debug("downloadBlob returned non-nil error")
 		return err
 	}
-	setOctetStreamContentType(w)
 	log.With("namespace", namespace, "digest", d.Hex()).Info("Successfully downloaded blob")
 	return nil
 }
@@ -388,8 +449,17 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	if err != nil {
 		return err
 	}
+	// Clients may wait for metainfo which is being generated in the
+	// background instead of polling.
+	var wait time.Duration
+	if w := r.URL.Query().Get("wait"); w != "" {
+		wait, err = time.ParseDuration(w)
+		if err != nil {
+			return handler.Errorf("invalid wait argument: %s", err).Status(http.StatusBadRequest)
+		}
+	}
 	log.With("namespace", namespace, "digest", d.Hex()).Debug("Getting metainfo")
-	raw, err := s.getMetaInfo(namespace, d)
+	raw, err := s.getMetaInfo(namespace, d, wait)
 	if err != nil {
 		log.With("namespace", namespace, "digest", d.Hex(), "error", err).
 			Debug("getMetaInfo returned non-nil error")
@@ -444,11 +514,15 @@ func (s *Server) overwriteMetaInfo(d core.Digest, pieceLength int64) error {
 // getMetaInfo returns metainfo for d. If no blob exists under d, a download of
 // the blob from the storage backend configured for namespace will be initiated.
 // This download is asynchronous and getMetaInfo will immediately return a
-// "202 Accepted" server error.
-func (s *Server) getMetaInfo(namespace string, d core.Digest) ([]byte, error) {
+// "202 Accepted" server error. If the blob is cached but its metainfo is being
+// generated in the background, getMetaInfo waits up to wait for it.
+func (s *Server) getMetaInfo(namespace string, d core.Digest, wait time.Duration) ([]byte, error) {
 	var tm metadata.TorrentMeta
 	err := s.cas.GetCacheFileMetadata(d.Hex(), &tm)
 	if os.IsNotExist(err) {
+		if info, err := s.cas.GetCacheFileStat(d.Hex()); err == nil && s.metaInfoGenerator.Async(info.Size()) {
+			return s.awaitMetaInfo(namespace, d, wait)
+		}
 		log.With("namespace", namespace, "digest", d.Hex()).Debug("Metainfo not found in cache, initiating blob download")
 		return nil, s.startRemoteBlobDownload(namespace, d, true)
 	}
@@ -460,15 +534,41 @@ func (s *Server) getMetaInfo(namespace string, d core.Digest) ([]byte, error) {
 	return tm.Serialize()
 }
 
+// getChunkIndexHandler returns the chunk index of d. Unlike metainfo, chunk
+// indexes are never generated on demand, so blobs which are not cached or were
+// cached before chunk indexes were enabled return 404.
+func (s *Server) getChunkIndexHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	var ci metadata.ChunkIndex
+	if err := s.cas.GetCacheFileMetadata(d.Hex(), &ci); err != nil {
+		if os.IsNotExist(err) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("get cache metadata: %s", err)
+	}
+	b, err := ci.Serialize()
+	if err != nil {
+		return handler.Errorf("serialize chunk index: %s", err)
+	}
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("write response: %s", err)
+	}
+	return nil
+}
+
 type localReplicationHook struct {
-	server *Server
+	server    *Server
+	namespace string
 }
 
 func (h *localReplicationHook) Run(d core.Digest) {
 	start := time.Now()
 	log.With("digest", d.Hex()).Info("Starting local replication")
 	timer := h.server.metrics.replicateBlobTimer.Start()
-	if err := h.server.replicateBlobLocally(d); err != nil {
+	if err := h.server.replicateBlobLocally(h.namespace, d); err != nil {
 		// Don't return error here as we only want to cache storage backend errors.
 		duration := time.Since(start)
 		log.With("digest", d.Hex(), "duration_s", duration.Seconds()).Errorf("Error replicating remote blob: %s", err)
@@ -486,7 +586,7 @@ func (s *Server) startRemoteBlobDownload(
 	log.With("namespace", namespace, "digest", d.Hex(), "replicate_locally", replicateLocally).Info("Initiating remote blob download")
 	var hooks []blobrefresh.PostHook
 	if replicateLocally {
-		hooks = append(hooks, &localReplicationHook{s})
+		hooks = append(hooks, &localReplicationHook{s, namespace})
 	}
 	err := s.blobRefresher.Refresh(namespace, d, hooks...)
 	switch err {
@@ -505,22 +605,24 @@ func (s *Server) startRemoteBlobDownload(
 	}
 }
 
-func (s *Server) replicateBlobLocally(d core.Digest) error {
+func (s *Server) replicateBlobLocally(namespace string, d core.Digest) error {
 	fi, err := s.cas.GetCacheFileStat(d.Hex())
 	var blobSize int64
 	if err == nil {
 		blobSize = fi.Size()
 	}
 
+	pieceLength := s.transferPieceLength(d)
+
 	log.With("digest", d.Hex(), "size_bytes", blobSize).Debug("Starting replication to local replicas")
-	return s.applyToReplicas(d, func(i int, client blobclient.Client) error {
+	return s.applyToReplicas(namespace, d, func(i int, client blobclient.Client) error {
 		start := time.Now()
 		f, err := s.cas.GetCacheFileReader(d.Hex())
 		if err != nil {
 			log.With("digest", d.Hex(), "replica", client.Addr()).Errorf("Failed to get cache reader: %s", err)
 			return fmt.Errorf("get cache reader: %s", err)
 		}
-		if err := client.TransferBlob(d, f); err != nil {
+		if err := client.TransferBlob(namespace, d, f, pieceLength); err != nil {
 			duration := time.Since(start)
 			log.With("digest", d.Hex(), "replica", client.Addr(), "size_bytes", blobSize, "duration_s", duration.Seconds()).Errorf("Failed to transfer blob: %s", err)
 			return fmt.Errorf("transfer blob: %s", err)
@@ -531,10 +633,33 @@ func (s *Server) replicateBlobLocally(d core.Digest) error {
 	})
 }
 
+// transferPieceLength returns the piece length of the metainfo of d, or 0 if d
+// has no metainfo yet. Replicas generate metainfo with the same piece length
+// as ours, since their piece length policies may differ.
+func (s *Server) transferPieceLength(d core.Digest) int64 {
+	var tm metadata.TorrentMeta
+	if err := s.cas.GetCacheFileMetadata(d.Hex(), &tm); err != nil {
+		return 0
+	}
+	return tm.MetaInfo.PieceLength()
+}
+
+// replicas returns the origins which cache the blob of d under namespace, in
+// hash ring order. The size of the replica set is configured per namespace by
+// backends, and defaults to the max replica count of the hash ring.
+func (s *Server) replicas(namespace string, d core.Digest) []string {
+	if n := s.backends.GetReplicas(namespace); n > 0 {
+		return s.hashRing.ReplicaLocations(d, n)
+	}
+	return s.hashRing.Locations(d)
+}
+
 // applyToReplicas applies f to the replicas of d concurrently in random order,
 // not including the current origin. Passes the index of the iteration to f.
-func (s *Server) applyToReplicas(d core.Digest, f func(i int, c blobclient.Client) error) error {
-	replicas := stringset.FromSlice(s.hashRing.Locations(d))
+func (s *Server) applyToReplicas(
+	namespace string, d core.Digest, f func(i int, c blobclient.Client) error) error {
+
+	replicas := stringset.FromSlice(s.replicas(namespace, d))
 	replicas.Remove(s.addr)
 
 	var mu sync.Mutex
@@ -563,7 +688,10 @@ func (s *Server) applyToReplicas(d core.Digest, f func(i int, c blobclient.Clien
 // download of the blob from the storage backend configured for namespace will
 // be initiated. This download is asynchronous and downloadBlob will immediately
 // return a "202 Accepted" handler error.
-func (s *Server) downloadBlob(namespace string, d core.Digest, dst io.Writer) error {
+// downloadBlob writes the blob of d to w. The blob is copied with sendfile
+// where possible, since origins spend most of their CPU copying blobs during
+// mass distribution.
+func (s *Server) downloadBlob(namespace string, d core.Digest, w http.ResponseWriter) error {
 	f, err := s.cas.GetCacheFileReader(d.Hex())
 	if os.IsNotExist(err) {
 		log.With("namespace", namespace, "digest", d.Hex()).
@@ -577,7 +705,11 @@ func (s *Server) downloadBlob(namespace string, d core.Digest, dst io.Writer) er
 	}
 	defer closers.Close(f)
 
-	if _, err := io.Copy(dst, f); err != nil {
+	// Without a known length and type, the response would sniff and chunk the
+	// blob in user space instead of handing the file to the kernel.
+	w.Header().Set("Content-Length", strconv.FormatInt(f.Size(), 10))
+	setOctetStreamContentType(w)
+	if _, err := store.CopyN(w, f, f.Size()); err != nil {
 		log.With("namespace", namespace, "digest", d.Hex(), "error", fmt.Sprintf("Failed to copy blob data: %s", err)).
 			Error("Download blob failure")
 		return handler.Errorf("copy blob: %s", err)
@@ -585,6 +717,29 @@ func (s *Server) downloadBlob(namespace string, d core.Digest, dst io.Writer) er
 	return nil
 }
 
+// downloadBlobRange serves the ranges of the blob of d requested by r, e.g. to
+// agents fetching pieces from origins as a web seed or to resumed registry
+// pulls. Satisfiable ranges are served with 206, and ranges starting beyond
+// the end of the blob are rejected with 416. Since blobs are content
+// addressed, the digest doubles as a strong ETag for If-Range requests.
+func (s *Server) downloadBlobRange(
+	namespace string, d core.Digest, w http.ResponseWriter, r *http.Request) error {
+
+	f, err := s.cas.GetCacheFileReader(d.Hex())
+	if os.IsNotExist(err) {
+		return s.startRemoteBlobDownload(namespace, d, true)
+	}
+	if err != nil {
+		return handler.Errorf("get cache file: %s", err)
+	}
+	defer closers.Close(f)
+
+	setOctetStreamContentType(w)
+	w.Header().Set("ETag", fmt.Sprintf("%q", d.String()))
+	http.ServeContent(w, r, "", time.Time{}, f)
+	return nil
+}
+
 func (s *Server) prefetchBlob(namespace string, d core.Digest) error {
 	f, err := s.cas.GetCacheFileReader(d.Hex())
 	if os.IsNotExist(err) {
@@ -605,6 +760,9 @@ func (s *Server) prefetchBlob(namespace string, d core.Digest) error {
 }
 
 func (s *Server) deleteBlob(d core.Digest) error {
+	if s.pinned(d.Hex()) {
+		return handler.Errorf("blob is pinned").Status(http.StatusConflict)
+	}
 	if err := s.cas.DeleteCacheFile(d.Hex()); err != nil {
 		if os.IsNotExist(err) {
 			log.With("digest", d.Hex()).Warn("Attempted to delete non-existent blob")
@@ -675,12 +833,29 @@ func (s *Server) commitTransferHandler(w http.ResponseWriter, r *http.Request) e
 	if err != nil {
 		return err
 	}
+	// The sender passes the namespace of the blob if known, so the blob is
+	// subject to the replication and retention policies of its namespace.
+	namespace := r.URL.Query().Get("namespace")
+	// The sender passes the piece length of its metainfo, so all origins
+	// generate the same metainfo regardless of their piece length policies.
+	var pieceLength int64
+	if pl := r.URL.Query().Get("piece_length"); pl != "" {
+		pieceLength, err = strconv.ParseInt(pl, 10, 64)
+		if err != nil {
+			return handler.Errorf("invalid piece_length argument: %s", err).Status(http.StatusBadRequest)
+		}
+	}
 	log.With("digest", d.Hex(), "uid", uid).Info("Committing internal transfer upload")
 	if err := s.uploader.commit(d, uid); err != nil {
 		log.With("digest", d.Hex(), "uid", uid).Errorf("Failed to commit upload: %s", err)
 		return err
 	}
-	if err := s.metaInfoGenerator.Generate(d); err != nil {
+	if namespace != "" {
+		if _, err := s.cas.SetCacheFileMetadata(d.Hex(), metadata.NewNamespace(namespace)); err != nil {
+			return handler.Errorf("set namespace metadata: %s", err)
+		}
+	}
+	if err := s.generateMetaInfo(namespace, d, pieceLength); err != nil {
 		log.With("digest", d.Hex(), "uid", uid).Errorf("Failed to generate metainfo: %s", err)
 		return handler.Errorf("generate metainfo: %s", err)
 	}
@@ -787,7 +962,7 @@ func (s *Server) commitClusterUploadHandler(w http.ResponseWriter, r *http.Reque
 
 	replicateStart := time.Now()
 	log.With("namespace", namespace, "digest", d.Hex(), "size_bytes", blobSize).Debug("Replicating upload to other origins")
-	err = s.applyToReplicas(d, func(i int, client blobclient.Client) error {
+	err = s.applyToReplicas(namespace, d, func(i int, client blobclient.Client) error {
 		replicaStart := time.Now()
 		delay := s.config.DuplicateWriteBackStagger * time.Duration(i+1)
 		f, err := s.cas.GetCacheFileReader(d.Hex())
@@ -854,12 +1029,16 @@ func (s *Server) writeBack(namespace string, d core.Digest, delay time.Duration)
 		log.With("namespace", namespace, "digest", d.Hex()).Errorf("Failed to set persist metadata: %s", err)
 		return handler.Errorf("set persist metadata: %s", err)
 	}
+	if _, err := s.cas.SetCacheFileMetadata(d.Hex(), metadata.NewNamespace(namespace)); err != nil {
+		log.With("namespace", namespace, "digest", d.Hex()).Errorf("Failed to set namespace metadata: %s", err)
+		return handler.Errorf("set namespace metadata: %s", err)
+	}
 	task := writeback.NewTask(namespace, d.Hex(), delay)
 	if err := s.writeBackManager.Add(task); err != nil {
 		log.With("namespace", namespace, "digest", d.Hex()).Errorf("Failed to add write-back task: %s", err)
 		return handler.Errorf("add write-back task: %s", err)
 	}
-	if err := s.metaInfoGenerator.Generate(d); err != nil {
+	if err := s.generateMetaInfo(namespace, d, 0); err != nil {
 		log.With("namespace", namespace, "digest", d.Hex()).Errorf("Failed to generate metainfo during write-back: %s", err)
 		return handler.Errorf("generate metainfo: %s", err)
 	}
@@ -903,6 +1082,42 @@ func (s *Server) forceCleanupHandler(w http.ResponseWriter, r *http.Request) err
 	})
 }
 
+func (s *Server) getBackendBandwidthHandler(w http.ResponseWriter, r *http.Request) error {
+	limits := s.backends.BandwidthLimits()
+	if limits == nil {
+		limits = []backend.BandwidthLimit{}
+	}
+	return json.NewEncoder(w).Encode(limits)
+}
+
+func (s *Server) setBackendBandwidthHandler(w http.ResponseWriter, r *http.Request) error {
+	// Note, this API is intended to be executed manually (i.e. curl), hence the
+	// query arguments. An empty namespace sets the global limits.
+
+	query := r.URL.Query()
+	var bps [2]uint64
+	for i, arg := range []string{"egress_bits_per_sec", "ingress_bits_per_sec"} {
+		raw := query.Get(arg)
+		if raw == "" {
+			return handler.Errorf("query arg %s required", arg).Status(http.StatusBadRequest)
+		}
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return handler.Errorf("invalid %s: %s", arg, err).Status(http.StatusBadRequest)
+		}
+		bps[i] = v
+	}
+	namespace := query.Get("namespace")
+	if err := s.backends.SetBandwidth(namespace, bps[0], bps[1]); err != nil {
+		if err == backend.ErrNamespaceNotFound {
+			return handler.Errorf("no bandwidth limits configured for namespace %q", namespace).
+				Status(http.StatusNotFound)
+		}
+		return handler.Errorf("set bandwidth: %s", err).Status(http.StatusBadRequest)
+	}
+	return nil
+}
+
 func (s *Server) maybeDelete(name string, ttl time.Duration) (deleted bool, err error) {
 	d, err := core.NewSHA256DigestFromHex(name)
 	if err != nil {
@@ -912,33 +1127,20 @@ func (s *Server) maybeDelete(name string, ttl time.Duration) (deleted bool, err
 	if err != nil {
 		return false, fmt.Errorf("store: %s", err)
 	}
+	if s.pinned(name) {
+		return false, nil
+	}
 	expired := s.clk.Now().Sub(info.ModTime()) > ttl
-	owns := stringset.FromSlice(s.hashRing.Locations(d)).Has(s.addr)
+	var ns metadata.Namespace
+	if err := s.cas.GetCacheFileMetadata(name, &ns); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("store: %s", err)
+	}
+	owns := stringset.FromSlice(s.replicas(ns.Value, d)).Has(s.addr)
 	if expired || !owns {
 		log.With("digest", name, "expired", expired, "owns", owns).Debug("Candidate for cleanup")
 		// Ensure file is backed up properly before deleting.
-		var pm metadata.Persist
-		if err := s.cas.GetCacheFileMetadata(name, &pm); err != nil && !os.IsNotExist(err) {
-			return false, fmt.Errorf("store: %s", err)
-		}
-		if pm.Value {
-			// Note: It is possible that no writeback tasks exist, but the file
-			// is persisted. We classify this as a leaked file which is safe to
-			// delete.
-			log.With("digest", name).Debug("File has persist metadata, executing write-back before cleanup")
-			tasks, err := s.writeBackManager.Find(writeback.NewNameQuery(name))
-			if err != nil {
-				return false, fmt.Errorf("find writeback tasks: %s", err)
-			}
-			for _, task := range tasks {
-				if err := s.writeBackManager.SyncExec(task); err != nil {
-					log.With("digest", name).Errorf("Failed to execute write-back during cleanup: %s", err)
-					return false, fmt.Errorf("writeback: %s", err)
-				}
-			}
-			if err := s.cas.DeleteCacheFileMetadata(name, &metadata.Persist{}); err != nil {
-				return false, fmt.Errorf("delete persist: %s", err)
-			}
+		if err := s.syncWriteBack(name); err != nil {
+			return false, err
 		}
 		if err := s.cas.DeleteCacheFile(name); err != nil {
 			return false, fmt.Errorf("delete: %s", err)
@@ -948,3 +1150,33 @@ func (s *Server) maybeDelete(name string, ttl time.Duration) (deleted bool, err
 	}
 	return false, nil
 }
+
+// syncWriteBack synchronously executes pending write-back tasks of the blob of
+// name, so the blob is persisted in its backend when syncWriteBack returns.
+func (s *Server) syncWriteBack(name string) error {
+	var pm metadata.Persist
+	if err := s.cas.GetCacheFileMetadata(name, &pm); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("store: %s", err)
+	}
+	if !pm.Value {
+		return nil
+	}
+	// Note: It is possible that no writeback tasks exist, but the file
+	// is persisted. We classify this as a leaked file which is safe to
+	// delete.
+	log.With("digest", name).Debug("File has persist metadata, executing write-back")
+	tasks, err := s.writeBackManager.Find(writeback.NewNameQuery(name))
+	if err != nil {
+		return fmt.Errorf("find writeback tasks: %s", err)
+	}
+	for _, task := range tasks {
+		if err := s.writeBackManager.SyncExec(task); err != nil {
+			log.With("digest", name).Errorf("Failed to execute write-back: %s", err)
+			return fmt.Errorf("writeback: %s", err)
+		}
+	}
+	if err := s.cas.DeleteCacheFileMetadata(name, &metadata.Persist{}); err != nil {
+		return fmt.Errorf("delete persist: %s", err)
+	}
+	return nil
+}
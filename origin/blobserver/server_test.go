@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -29,6 +30,7 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store/metadata"
@@ -184,7 +186,7 @@ func TestStatHandlerReturnSize(t *testing.T) {
 	blob := core.SizedBlobFixture(256, 8)
 	namespace := core.TagFixture()
 
-	require.NoError(client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	require.NoError(client.TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0))
 
 	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
 
@@ -206,7 +208,7 @@ func TestPrefetchHandler(t *testing.T) {
 	blob := core.SizedBlobFixture(256, 8)
 	namespace := core.TagFixture()
 
-	require.NoError(client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	require.NoError(client.TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0))
 
 	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
 
@@ -248,6 +250,56 @@ func TestDownloadBlobInvalidParam(t *testing.T) {
 	}
 }
 
+func TestDownloadBlobRange(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	require.NoError(client.TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0))
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s",
+			s.addr, url.PathEscape(namespace), blob.Digest),
+		httputil.SendHeaders(map[string]string{"Range": "bytes=16-31"}),
+		httputil.SendAcceptedCodes(http.StatusPartialContent))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal(blob.Content[16:32], b)
+}
+
+func TestDownloadBlobRangeThroughClient(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	require.NoError(client.TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0))
+
+	var buf bytes.Buffer
+	require.NoError(client.DownloadBlobRange(namespace, blob.Digest, 200, -1, &buf))
+	require.Equal(blob.Content[200:], buf.Bytes())
+
+	err := client.DownloadBlobRange(namespace, blob.Digest, 256, -1, io.Discard)
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusRequestedRangeNotSatisfiable))
+}
+
 func TestDownloadBlobNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -282,7 +334,7 @@ func TestDeleteBlob(t *testing.T) {
 	blob := core.NewBlobFixture()
 	namespace := core.TagFixture()
 
-	require.NoError(client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	require.NoError(client.TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0))
 
 	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
 
@@ -394,6 +446,32 @@ func TestGetMetaInfoBlobNotFound(t *testing.T) {
 	require.Nil(mi)
 }
 
+func TestGetChunkIndex(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	_, err := cp.Provide(master1).GetChunkIndex(namespace, blob.Digest)
+	require.True(httputil.IsNotFound(err))
+
+	idx, err := delta.BuildIndex(bytes.NewReader(blob.Content), delta.IndexConfig{})
+	require.NoError(err)
+	_, err = s.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewChunkIndex(idx))
+	require.NoError(err)
+
+	result, err := cp.Provide(master1).GetChunkIndex(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(idx, result)
+}
+
 func TestGetMetaInfoInvalidParam(t *testing.T) {
 	digest := core.DigestFixture()
 
@@ -439,7 +517,7 @@ func TestTransferBlob(t *testing.T) {
 	blob := core.NewBlobFixture()
 	namespace := core.TagFixture()
 
-	err := cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	err := cp.Provide(master1).TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0)
 	require.NoError(err)
 	ensureHasBlob(t, cp.Provide(master1), namespace, blob)
 
@@ -448,11 +526,29 @@ func TestTransferBlob(t *testing.T) {
 	require.NoError(s.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
 
 	// Pushing again should be a no-op.
-	err = cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	err = cp.Provide(master1).TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0)
 	require.NoError(err)
 	ensureHasBlob(t, cp.Provide(master1), namespace, blob)
 }
 
+func TestTransferBlobWithPieceLength(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	// The server is configured with 4 byte pieces.
+	blob := core.SizedBlobFixture(256, 16)
+
+	require.NoError(cp.Provide(master1).TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 16))
+
+	var tm metadata.TorrentMeta
+	require.NoError(s.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.MetaInfo, tm.MetaInfo)
+}
+
 func TestTransferBlobInvalidParam(t *testing.T) {
 	t.Run("StartInvalidDigest", func(t *testing.T) {
 		require := require.New(t)
@@ -553,7 +649,7 @@ func TestTransferBlobSmallChunkSize(t *testing.T) {
 
 	client := blobclient.New(s.addr, blobclient.WithChunkSize(13))
 
-	err := client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	err := client.TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0)
 	require.NoError(err)
 	ensureHasBlob(t, client, namespace, blob)
 }
@@ -569,7 +665,7 @@ func TestOverwriteMetainfo(t *testing.T) {
 	blob := core.NewBlobFixture()
 	namespace := core.TagFixture()
 
-	err := cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	err := cp.Provide(master1).TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0)
 	require.NoError(err)
 
 	mi, err := cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
@@ -595,7 +691,7 @@ func TestReplicateToRemote(t *testing.T) {
 	blob := core.NewBlobFixture()
 	namespace := core.TagFixture()
 
-	require.NoError(cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	require.NoError(cp.Provide(master1).TransferBlob(backend.NoopNamespace, blob.Digest, bytes.NewReader(blob.Content), 0))
 
 	remote := "remote:80"
 
@@ -734,6 +830,64 @@ func TestUploadBlobRetriesWriteBackFailure(t *testing.T) {
 	require.Error(cp.Provide(s.host).DeleteBlob(blob.Digest))
 }
 
+func TestUploadBlobParallelChunks(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	client := blobclient.New(s.addr, blobclient.WithChunkSize(7), blobclient.WithUploadConcurrency(4))
+	require.NoError(client.UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content)))
+
+	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
+}
+
+func TestCommitUploadWithMissingChunksFails(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	base := fmt.Sprintf("http://%s/namespace/%s/blobs/%s/uploads",
+		s.addr, url.PathEscape(namespace), blob.Digest)
+	resp, err := httputil.Post(base)
+	require.NoError(err)
+	uid := resp.Header.Get("Location")
+
+	// Only the second half of the blob is uploaded.
+	half := int64(len(blob.Content) / 2)
+	_, err = httputil.Patch(
+		fmt.Sprintf("%s/%s", base, uid),
+		httputil.SendBody(bytes.NewReader(blob.Content[half:])),
+		httputil.SendHeaders(map[string]string{
+			"Content-Range": fmt.Sprintf("%d-%d", half, len(blob.Content)),
+		}))
+	require.NoError(err)
+
+	_, err = httputil.Put(fmt.Sprintf("%s/%s", base, uid))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = cp.Provide(s.host).StatLocal(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+}
+
 func TestUploadBlobResilientToDuplicationFailure(t *testing.T) {
 	require := require.New(t)
 
@@ -870,3 +1024,27 @@ func TestForceCleanupWriteBackFailures(t *testing.T) {
 
 	ensureHasBlob(t, client, namespace, blob)
 }
+
+func TestBackendBandwidth(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/backends/bandwidth", s.addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal("[]\n", string(b))
+
+	_, err = httputil.Post(fmt.Sprintf(
+		"http://%s/backends/bandwidth?egress_bits_per_sec=100&ingress_bits_per_sec=100", s.addr))
+	require.True(httputil.IsNotFound(err))
+
+	_, err = httputil.Post(fmt.Sprintf(
+		"http://%s/backends/bandwidth?egress_bits_per_sec=100", s.addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/metainfogen"
 	"github.com/uber/kraken/lib/store"
+	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
 	mockbackend "github.com/uber/kraken/mocks/lib/backend"
 	mockpersistedretry "github.com/uber/kraken/mocks/lib/persistedretry"
 	mockblobclient "github.com/uber/kraken/mocks/origin/blobclient"
@@ -91,6 +92,7 @@ func (p *testClientProvider) Provide(host string) blobclient.Client {
 // testServer is a convenience wrapper around the underlying components of a
 // Server and faciliates restarting Servers with new configuration.
 type testServer struct {
+	server           *Server
 	ctrl             *gomock.Controller
 	host             string
 	addr             string
@@ -100,6 +102,7 @@ type testServer struct {
 	pctx             core.PeerContext
 	backendManager   *backend.Manager
 	writeBackManager *mockpersistedretry.MockManager
+	tagClient        *mocktagclient.MockClient
 	clk              *clock.Mock
 	cleanup          func()
 }
@@ -117,13 +120,21 @@ func newTestServer(
 
 	pctx := core.PeerContextFixture()
 
-	cas, c := store.CAStoreFixture()
+	casConfig, c := store.CAStoreConfigFixture()
 	cleanup.Add(c)
+	casConfig.IndexedMetadata = IndexedMetadata
+	cas, err := store.NewCAStore(casConfig, tally.NoopScope)
+	if err != nil {
+		panic(err)
+	}
+	cleanup.Add(cas.Close)
 
 	bm := backend.ManagerFixture()
 
 	writeBackManager := mockpersistedretry.NewMockManager(ctrl)
 
+	tagClient := mocktagclient.NewMockClient(ctrl)
+
 	mg := metainfogen.Fixture(cas, 4)
 
 	br := blobrefresh.New(blobrefresh.Config{}, tally.NoopScope, cas, bm, mg)
@@ -133,7 +144,7 @@ func newTestServer(
 
 	s, err := New(
 		Config{}, tally.NoopScope, clk, host, ring, cas, cp, clusterProvider, pctx,
-		bm, br, mg, writeBackManager)
+		bm, br, mg, writeBackManager, tagClient)
 	if err != nil {
 		panic(err)
 	}
@@ -144,6 +155,7 @@ func newTestServer(
 	cp.register(host, blobclient.New(addr, blobclient.WithChunkSize(16)))
 
 	return &testServer{
+		server:           s,
 		ctrl:             ctrl,
 		host:             host,
 		addr:             addr,
@@ -153,6 +165,7 @@ func newTestServer(
 		pctx:             pctx,
 		backendManager:   bm,
 		writeBackManager: writeBackManager,
+		tagClient:        tagClient,
 		clk:              clk,
 		cleanup:          cleanup.Run,
 	}
@@ -62,6 +62,11 @@ func (u *uploader) patch(
 		log.With("digest", d.Hex(), "uid", uid).Debug("Blob already exists, cannot patch upload")
 		return handler.ErrorStatus(http.StatusConflict)
 	}
+	if end < start {
+		return handler.Errorf("invalid range %d-%d", start, end).Status(http.StatusBadRequest)
+	}
+	// Chunks may be patched concurrently and in any order, each at its own
+	// offset. The assembled blob is verified against d on commit.
 	f, err := u.cas.GetUploadFileReadWriter(uid)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -96,6 +101,12 @@ func (u *uploader) commit(d core.Digest, uid string) error {
 			log.With("digest", d.Hex(), "uid", uid).Debug("Blob already exists in cache")
 			return handler.ErrorStatus(http.StatusConflict)
 		}
+		if store.IsDigestMismatchError(err) {
+			// Retrying the commit, or uploading to another origin, cannot
+			// succeed, since chunks were missing or corrupt.
+			log.With("digest", d.Hex(), "uid", uid).Warnf("Upload failed verification: %s", err)
+			return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+		}
 		log.With("digest", d.Hex(), "uid", uid).Errorf("Failed to move upload file to cache: %s", err)
 		return handler.Errorf("move upload file to cache: %s", err)
 	}
@@ -14,6 +14,7 @@
 package blobserver
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
@@ -21,9 +22,19 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/stringset"
 )
 
+// IndexedMetadata lists the suffixes of metadata types which the CAStore of a
+// Server must index, so GC, retention and replication repair find cached blobs
+// without reading the metadata of every blob from disk.
+var IndexedMetadata = []string{
+	metadata.NewNamespace("").GetSuffix(),
+	metadata.NewPersist(false).GetSuffix(),
+}
+
 // parseContentRange parses start / end integers from a Content-Range header.
 func parseContentRange(h http.Header) (start, end int64, err error) {
 	contentRange := h.Get("Content-Range")
@@ -64,6 +75,31 @@ func blobExists(cas *store.CAStore, d core.Digest) (bool, error) {
 	return true, nil
 }
 
+// cachedNamespaces returns the namespace of every cached blob by name. Blobs
+// of unknown namespace are omitted.
+func cachedNamespaces(cas *store.CAStore) (map[string]string, error) {
+	namespaces := make(map[string]string)
+	if _, err := cas.FindCacheFiles(&metadata.Namespace{}, func(name string, md metadata.Metadata) bool {
+		namespaces[name] = md.(*metadata.Namespace).Value
+		return false
+	}); err != nil {
+		return nil, fmt.Errorf("find namespaces: %s", err)
+	}
+	return namespaces, nil
+}
+
+// pendingWriteBack returns the names of cached blobs which have not been
+// written back to the storage of record yet.
+func pendingWriteBack(cas *store.CAStore) (stringset.Set, error) {
+	names, err := cas.FindCacheFiles(&metadata.Persist{}, func(name string, md metadata.Metadata) bool {
+		return md.(*metadata.Persist).Value
+	})
+	if err != nil {
+		return nil, fmt.Errorf("find persisted: %s", err)
+	}
+	return stringset.FromSlice(names), nil
+}
+
 func setUploadLocation(w http.ResponseWriter, uid string) {
 	w.Header().Set("Location", uid)
 }
@@ -17,9 +17,12 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 
+	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
@@ -32,6 +35,7 @@ import (
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
@@ -52,6 +56,7 @@ import (
 // Flags defines origin CLI flags.
 type Flags struct {
 	PeerIP             string
+	PeerAltIP          string
 	PeerPort           int
 	BlobServerHostName string
 	BlobServerPort     int
@@ -66,6 +71,9 @@ func ParseFlags() *Flags {
 	var flags Flags
 	flag.StringVar(
 		&flags.PeerIP, "peer-ip", "", "ip which peer will announce itself as")
+	flag.StringVar(
+		&flags.PeerAltIP, "peer-alt-ip", "",
+		"optional ip of the other ip family which dual-stack peer will also announce itself as")
 	flag.IntVar(
 		&flags.PeerPort, "peer-port", 0, "port which peer will announce itself as")
 	flag.StringVar(
@@ -180,6 +188,7 @@ func Run(flags *Flags, opts ...Option) {
 		flags.PeerIP = localIP
 	}
 
+	config.CAStore.IndexedMetadata = append(config.CAStore.IndexedMetadata, blobserver.IndexedMetadata...)
 	cas, err := store.NewCAStore(config.CAStore, stats)
 	if err != nil {
 		log.Fatalf("Failed to create castore: %s", err)
@@ -190,12 +199,18 @@ func Run(flags *Flags, opts ...Option) {
 	if err != nil {
 		log.Fatalf("Failed to create peer context: %s", err)
 	}
+	if flags.PeerAltIP != "" {
+		if err := pctx.SetAltIP(flags.PeerAltIP); err != nil {
+			log.Fatalf("Failed to set peer alt ip: %s", err)
+		}
+	}
 
 	backendManager, err := backend.NewManager(config.BackendManager, config.Backends, config.Auth, stats)
 	if err != nil {
 		log.Fatalf("Error creating backend manager: %s", err)
 	}
 	defer closers.Close(backendManager)
+	go backendManager.WatchCredentials(nil)
 
 	localDB, err := localdb.New(config.LocalDB)
 	if err != nil {
@@ -218,7 +233,7 @@ func Run(flags *Flags, opts ...Option) {
 
 	blobRefresher := blobrefresh.New(config.BlobRefresh, stats, cas, backendManager, metaInfoGenerator)
 
-	netevents, err := networkevent.NewProducer(config.NetworkEvent)
+	netevents, err := networkevent.NewProducer(config.NetworkEvent, stats)
 	if err != nil {
 		log.Fatalf("Error creating network event producer: %s", err)
 	}
@@ -248,7 +263,7 @@ func Run(flags *Flags, opts ...Option) {
 		hashring.WithWatcher(backend.NewBandwidthWatcher(backendManager)))
 	go hashRing.Monitor(nil)
 
-	addr := fmt.Sprintf("%s:%d", hostname, flags.BlobServerPort)
+	addr := net.JoinHostPort(hostname, strconv.Itoa(flags.BlobServerPort))
 	if !hashRing.Contains(addr) {
 		// When DNS is used for hash ring membership, the members will be IP
 		// addresses instead of hostnames.
@@ -256,7 +271,7 @@ func Run(flags *Flags, opts ...Option) {
 		if err != nil {
 			log.Fatalf("Error getting local ip: %s", err)
 		}
-		addr = fmt.Sprintf("%s:%d", ip, flags.BlobServerPort)
+		addr = net.JoinHostPort(ip, strconv.Itoa(flags.BlobServerPort))
 		if !hashRing.Contains(addr) {
 			log.Fatalf(
 				"Neither %s nor %s (port %d) found in hash ring",
@@ -264,6 +279,16 @@ func Run(flags *Flags, opts ...Option) {
 		}
 	}
 
+	// Build-index is only required to collect blobs unreachable from live tags.
+	var tagClient tagclient.Client
+	if config.BlobServer.GC.Enabled {
+		buildIndexes, err := config.BuildIndex.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
+		if err != nil {
+			log.Fatalf("Error building build-index host list: %s", err)
+		}
+		tagClient = tagclient.NewClusterClient(buildIndexes, tls)
+	}
+
 	server, err := blobserver.New(
 		config.BlobServer,
 		stats,
@@ -277,10 +302,14 @@ func Run(flags *Flags, opts ...Option) {
 		backendManager,
 		blobRefresher,
 		metaInfoGenerator,
-		writeBackManager)
+		writeBackManager,
+		tagClient)
 	if err != nil {
 		log.Fatalf("Error initializing blob server: %s", err)
 	}
+	go server.EnforceRetention(nil)
+	go server.RepairReplication(nil)
+	go server.CollectGarbage(nil)
 
 	h := addTorrentDebugEndpoints(server.Handler(), sched)
 
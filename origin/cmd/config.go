@@ -25,6 +25,7 @@ import (
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
@@ -53,6 +54,7 @@ type Config struct {
 	Backends       []backend.Config         `yaml:"backends"`
 	Auth           backend.AuthConfig       `yaml:"auth"`
 	BlobRefresh    blobrefresh.Config       `yaml:"blobrefresh"`
+	BuildIndex     upstream.ActiveConfig    `yaml:"build_index"`
 	LocalDB        localdb.Config           `yaml:"localdb"`
 	WriteBack      persistedretry.Config    `yaml:"writeback"`
 	Nginx          nginx.Config             `yaml:"nginx"`
@@ -156,8 +156,10 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building origin host list: %s", err)
 	}
 
-	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originCluster := blobclient.NewClusterClient(r)
+	r := blobclient.NewClientResolver(blobclient.NewProvider(
+		blobclient.WithTLS(tls),
+		blobclient.WithUploadConcurrency(config.OriginUploadConcurrency)), origins)
+	originCluster := blobclient.NewClusterClient(r, blobclient.WithBalancer(config.OriginBalancer))
 
 	buildIndexes, err := config.BuildIndex.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
 	if err != nil {
@@ -19,6 +19,7 @@ import (
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/proxy/proxyserver"
 	"github.com/uber/kraken/proxy/registryoverride"
 	"github.com/uber/kraken/utils/httputil"
@@ -28,14 +29,19 @@ import (
 
 // Config defines proxy configuration
 type Config struct {
-	CAStore          store.CAStoreConfig     `yaml:"castore"`
-	Registry         dockerregistry.Config   `yaml:"registry"`
-	BuildIndex       upstream.ActiveConfig   `yaml:"build_index"`
-	Origin           upstream.ActiveConfig   `yaml:"origin"`
-	ZapLogging       zap.Config              `yaml:"zap"`
-	Metrics          metrics.Config          `yaml:"metrics"`
-	RegistryOverride registryoverride.Config `yaml:"registryoverride"`
-	Server           proxyserver.Config      `yaml:"server"`
-	Nginx            nginx.Config            `yaml:"nginx"`
-	TLS              httputil.TLSConfig      `yaml:"tls"`
+	CAStore          store.CAStoreConfig       `yaml:"castore"`
+	Registry         dockerregistry.Config     `yaml:"registry"`
+	BuildIndex       upstream.ActiveConfig     `yaml:"build_index"`
+	Origin           upstream.ActiveConfig     `yaml:"origin"`
+	OriginBalancer   blobclient.BalancerConfig `yaml:"origin_balancer"`
+	ZapLogging       zap.Config                `yaml:"zap"`
+	Metrics          metrics.Config            `yaml:"metrics"`
+	RegistryOverride registryoverride.Config   `yaml:"registryoverride"`
+	Server           proxyserver.Config        `yaml:"server"`
+	Nginx            nginx.Config              `yaml:"nginx"`
+	TLS              httputil.TLSConfig        `yaml:"tls"`
+
+	// OriginUploadConcurrency is the number of chunks of a blob pushed to
+	// origins in parallel. Defaults to 1.
+	OriginUploadConcurrency int `yaml:"origin_upload_concurrency"`
 }
@@ -0,0 +1,120 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uber/kraken/origin/blobserver"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/osutil"
+)
+
+// rebalance starts rebalancing every origin, since every origin which holds a
+// blob must take part in moving it, and waits until all of them are done.
+func main() {
+	hostFile := flag.String("f", "", "host file")
+	hostStr := flag.String("hosts", "", "comma-separated hosts")
+	port := flag.Int("port", 15002, "origin blob server port")
+	interval := flag.Duration("interval", 10*time.Second, "progress polling interval")
+	flag.Parse()
+
+	if (*hostFile != "" && *hostStr != "") || (*hostFile == "" && *hostStr == "") {
+		panic("must set either -f or -hosts")
+	}
+	if *port == 0 {
+		panic("-port must be non-zero")
+	}
+
+	var hosts []string
+	if *hostFile != "" {
+		f, err := os.Open(*hostFile)
+		if err != nil {
+			panic(err)
+		}
+		hosts, err = osutil.ReadLines(f)
+		if err != nil {
+			panic(err)
+		}
+	} else if *hostStr != "" {
+		hosts = strings.Split(*hostStr, ",")
+	}
+
+	var addrs []string
+	for _, host := range hosts {
+		addr := fmt.Sprintf("%s:%d", host, *port)
+		if _, err := httputil.Post(
+			fmt.Sprintf("http://%s/rebalance", addr),
+			httputil.SendAcceptedCodes(http.StatusOK, http.StatusAccepted),
+			httputil.SendTimeout(10*time.Second)); err != nil {
+			fmt.Printf("%s: start rebalance: %s\n", addr, err)
+			os.Exit(1)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	for {
+		time.Sleep(*interval)
+		done := true
+		var failed int
+		for _, addr := range addrs {
+			status, err := getStatus(addr)
+			if err != nil {
+				fmt.Printf("%s: get status: %s\n", addr, err)
+				done = false
+				continue
+			}
+			fmt.Printf("%s: %s, scanned %d/%d, moved %d (%d bytes), failed %d\n",
+				addr, status.State, status.Scanned, status.Total,
+				status.Moved, status.MovedBytes, status.Failed)
+			if status.State != "done" {
+				done = false
+			}
+			failed += status.Failed
+			if status.Error != "" {
+				fmt.Printf("%s: error: %s\n", addr, status.Error)
+				failed++
+			}
+		}
+		if done {
+			if failed > 0 {
+				fmt.Println("Rebalance finished with failures, check origin logs")
+				os.Exit(1)
+			}
+			fmt.Println("Rebalance finished")
+			return
+		}
+	}
+}
+
+func getStatus(addr string) (blobserver.RebalanceStatus, error) {
+	var status blobserver.RebalanceStatus
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/rebalance", addr),
+		httputil.SendTimeout(10*time.Second))
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("json decode: %s", err)
+	}
+	return status, nil
+}
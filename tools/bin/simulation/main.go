@@ -0,0 +1,62 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/configutil"
+)
+
+// Simulates a swarm downloading a single blob and reports the distribution of
+// the time-to-completion of downloads. See scheduler.SimulationConfig for the
+// configuration of the swarm.
+func main() {
+	configFile := flag.String("config", "", "simulation config file")
+	runs := flag.Int("runs", 0, "number of runs, overrides the config file")
+	seed := flag.Int64("seed", 0, "seed of the first run, overrides the config file")
+	jsonOutput := flag.Bool("json", false, "print the report as json")
+	flag.Parse()
+
+	if *configFile == "" {
+		panic("-config required")
+	}
+
+	var config scheduler.SimulationConfig
+	if err := configutil.Load(*configFile, &config); err != nil {
+		panic(err)
+	}
+	if *runs != 0 {
+		config.Runs = *runs
+	}
+	if *seed != 0 {
+		config.Seed = *seed
+	}
+
+	report, err := scheduler.Simulate(config)
+	if err != nil {
+		panic(err)
+	}
+	if *jsonOutput {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			panic(err)
+		}
+		return
+	}
+	fmt.Print(report)
+}
@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/uber/kraken/core"
@@ -38,6 +40,16 @@ type Request struct {
 	Digest   *core.Digest   `json:"digest"` // Optional (for now).
 	InfoHash core.InfoHash  `json:"info_hash"`
 	Peer     *core.PeerInfo `json:"peer"`
+
+	// Namespace of the torrent, which the tracker rate limits announces by.
+	// Optional, since older agents do not send it.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Cursor identifies the peer handout last received for the torrent by
+	// incremental announces. The response is a diff against the handout if
+	// the tracker still has it, else a full handout. Zero requests a full
+	// handout.
+	Cursor uint64 `json:"cursor,omitempty"`
 }
 
 // GetDigest is a backwards compatible accessor of the request digest.
@@ -56,40 +68,93 @@ func (r *Request) GetDigest() (core.Digest, error) {
 type Response struct {
 	Peers    []*core.PeerInfo `json:"peers"`
 	Interval time.Duration    `json:"interval"`
+
+	// Fields of incremental announces. If Incremental is set, Added and Removed
+	// describe the handout relative to the handout of the request cursor, and
+	// Peers is empty. Cursor identifies the resulting handout.
+	Incremental bool             `json:"incremental,omitempty"`
+	Added       []*core.PeerInfo `json:"added,omitempty"`
+	Removed     []core.PeerID    `json:"removed,omitempty"`
+	Cursor      uint64           `json:"cursor,omitempty"`
 }
 
 // Client defines a client for announcing and getting peers.
 type Client interface {
 	CheckReadiness() error
 	Announce(
+		namespace string,
 		d core.Digest,
 		h core.InfoHash,
 		complete bool,
 		version int) ([]*core.PeerInfo, time.Duration, error)
 }
 
+// _handoutTTL is how long the handouts of incremental announces are kept for
+// torrents which are no longer announced.
+const _handoutTTL = 10 * time.Minute
+
+// handout is the peer handout last received for a torrent.
+type handout struct {
+	cursor    uint64
+	peers     []*core.PeerInfo
+	updatedAt time.Time
+}
+
 type client struct {
 	pctx core.PeerContext
 	ring hashring.PassiveRing
 	tls  *tls.Config
+
+	mu        sync.Mutex // Protects the following fields:
+	handouts  map[core.InfoHash]*handout
+	lastPurge time.Time
 }
 
 // New creates a new client.
 func New(pctx core.PeerContext, ring hashring.PassiveRing, tls *tls.Config) Client {
-	return &client{pctx, ring, tls}
+	return &client{
+		pctx:     pctx,
+		ring:     ring,
+		tls:      tls,
+		handouts: make(map[core.InfoHash]*handout),
+	}
 }
 
 // Announce versionss.
 const (
 	V1 = 1
 	V2 = 2
+
+	// V3 announces incrementally: the tracker only returns changes to the
+	// peer handout since the last announce, which the client merges into the
+	// previous handout, along with an interval adjusted to swarm health.
+	// Falls back to V2 if the tracker does not support V3.
+	V3 = 3
 )
 
 func getEndpoint(version int, addr string, h core.InfoHash) (method, url string) {
-	if version == V1 {
+	switch version {
+	case V1:
 		return "GET", fmt.Sprintf("http://%s/announce", addr)
+	case V3:
+		return "POST", fmt.Sprintf("http://%s/announce/%s/incremental", addr, h.String())
+	default:
+		return "POST", fmt.Sprintf("http://%s/announce/%s", addr, h.String())
+	}
+}
+
+// RetryAfter returns the interval after which an announce throttled by the
+// tracker with err may be retried. Returns false if err is not a throttle.
+func RetryAfter(err error) (time.Duration, bool) {
+	statusErr, ok := err.(httputil.StatusError)
+	if !ok || statusErr.Status != http.StatusTooManyRequests {
+		return 0, false
 	}
-	return "POST", fmt.Sprintf("http://%s/announce/%s", addr, h.String())
+	seconds, err := strconv.Atoi(statusErr.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, true
+	}
+	return time.Duration(seconds) * time.Second, true
 }
 
 func (c *client) CheckReadiness() error {
@@ -108,19 +173,92 @@ func (c *client) CheckReadiness() error {
 // downloaded bytes. Returns a list of all other peers announcing for said torrent,
 // sorted by priority, and the interval for the next announce.
 func (c *client) Announce(
+	namespace string,
 	d core.Digest,
 	h core.InfoHash,
 	complete bool,
 	version int) (peers []*core.PeerInfo, interval time.Duration, err error) {
 
+	if version != V3 {
+		resp, err := c.send(namespace, d, h, complete, version, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		return resp.Peers, resp.Interval, nil
+	}
+	resp, err := c.send(namespace, d, h, complete, V3, c.cursor(h))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			// Tracker does not support incremental announces.
+			return c.Announce(namespace, d, h, complete, V2)
+		}
+		return nil, 0, err
+	}
+	return c.merge(h, resp), resp.Interval, nil
+}
+
+// cursor returns the cursor of the last handout received for h.
+func (c *client) cursor(h core.InfoHash) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.handouts[h]; ok {
+		return p.cursor
+	}
+	return 0
+}
+
+// merge applies the incremental announce response resp to the last handout
+// received for h, and returns the resulting handout.
+func (c *client) merge(h core.InfoHash, resp *Response) []*core.PeerInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastPurge) >= _handoutTTL {
+		for k, p := range c.handouts {
+			if now.Sub(p.updatedAt) >= _handoutTTL {
+				delete(c.handouts, k)
+			}
+		}
+		c.lastPurge = now
+	}
+
+	peers := resp.Peers
+	if resp.Incremental {
+		var prev []*core.PeerInfo
+		if p, ok := c.handouts[h]; ok {
+			prev = p.peers
+		}
+		peers = ApplyPeerDiff(prev, resp.Added, resp.Removed)
+	}
+	if resp.Cursor == 0 {
+		delete(c.handouts, h)
+	} else {
+		c.handouts[h] = &handout{resp.Cursor, peers, now}
+	}
+	// Copy, since callers may modify the returned slice.
+	return append([]*core.PeerInfo(nil), peers...)
+}
+
+func (c *client) send(
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	complete bool,
+	version int,
+	cursor uint64) (*Response, error) {
+
 	body, err := json.Marshal(&Request{
-		Name:     d.Hex(), // For backwards compatability. TODO(codyg): Remove.
-		Digest:   &d,
-		InfoHash: h,
-		Peer:     core.PeerInfoFromContext(c.pctx, complete),
+		Name:      d.Hex(), // For backwards compatability. TODO(codyg): Remove.
+		Digest:    &d,
+		InfoHash:  h,
+		Peer:      core.PeerInfoFromContext(c.pctx, complete),
+		Namespace: namespace,
+		Cursor:    cursor,
 	})
 	if err != nil {
-		return nil, 0, fmt.Errorf("marshal request: %s", err)
+		return nil, fmt.Errorf("marshal request: %s", err)
 	}
 	var httpResp *http.Response
 	for _, addr := range c.ring.Locations(d) {
@@ -132,20 +270,29 @@ func (c *client) Announce(
 			httputil.SendTimeout(10*time.Second),
 			httputil.SendTLS(c.tls))
 		if err != nil {
-			if httputil.IsNetworkError(err) {
+			if unavailable(err) {
+				// Fail over to the next tracker which owns d.
 				c.ring.Failed(addr)
 				continue
 			}
-			return nil, 0, err
+			return nil, err
 		}
 		defer closers.Close(httpResp.Body)
 		var resp Response
 		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
-			return nil, 0, fmt.Errorf("decode response: %s", err)
+			return nil, fmt.Errorf("decode response: %s", err)
 		}
-		return resp.Peers, resp.Interval, nil
+		return &resp, nil
 	}
-	return nil, 0, err
+	return nil, err
+}
+
+// unavailable returns whether err indicates that a tracker cannot serve
+// announces, e.g. because it is down behind nginx. Throttled announces do not
+// fail over, since they are retried later.
+func unavailable(err error) bool {
+	return httputil.IsNetworkError(err) ||
+		(httputil.IsRetryable(err) && !httputil.IsStatus(err, http.StatusTooManyRequests))
 }
 
 // DisabledClient rejects all announces. Suitable for origin peers which should
@@ -163,7 +310,11 @@ func (c DisabledClient) CheckReadiness() error {
 
 // Announce always returns error.
 func (c DisabledClient) Announce(
-	d core.Digest, h core.InfoHash, complete bool, version int) ([]*core.PeerInfo, time.Duration, error) {
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	complete bool,
+	version int) ([]*core.PeerInfo, time.Duration, error) {
 
 	return nil, 0, ErrDisabled
 }
@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"reflect"
+
+	"github.com/uber/kraken/core"
+)
+
+// DiffPeers returns the peers which must be added to and removed from prev to
+// arrive at next. Peers whose fields changed are included in added.
+func DiffPeers(prev, next []*core.PeerInfo) (added []*core.PeerInfo, removed []core.PeerID) {
+	prevByID := make(map[core.PeerID]*core.PeerInfo, len(prev))
+	for _, p := range prev {
+		prevByID[p.PeerID] = p
+	}
+	nextIDs := make(map[core.PeerID]bool, len(next))
+	for _, p := range next {
+		nextIDs[p.PeerID] = true
+		if q, ok := prevByID[p.PeerID]; !ok || !reflect.DeepEqual(q, p) {
+			added = append(added, p)
+		}
+	}
+	for _, p := range prev {
+		if !nextIDs[p.PeerID] {
+			removed = append(removed, p.PeerID)
+		}
+	}
+	return added, removed
+}
+
+// ApplyPeerDiff returns a new slice of peers with removed peers dropped and
+// added peers appended. Added peers replace existing peers of the same id.
+func ApplyPeerDiff(
+	peers []*core.PeerInfo, added []*core.PeerInfo, removed []core.PeerID) []*core.PeerInfo {
+
+	drop := make(map[core.PeerID]bool, len(added)+len(removed))
+	for _, id := range removed {
+		drop[id] = true
+	}
+	for _, p := range added {
+		drop[p.PeerID] = true
+	}
+	result := make([]*core.PeerInfo, 0, len(peers)+len(added))
+	for _, p := range peers {
+		if !drop[p.PeerID] {
+			result = append(result, p)
+		}
+	}
+	return append(result, added...)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPeers(t *testing.T) {
+	require := require.New(t)
+
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+	p3 := core.PeerInfoFixture()
+	p2Complete := *p2
+	p2Complete.Complete = true
+
+	added, removed := DiffPeers(
+		[]*core.PeerInfo{p1, p2},
+		[]*core.PeerInfo{&p2Complete, p3})
+
+	require.Equal([]*core.PeerInfo{&p2Complete, p3}, added)
+	require.Equal([]core.PeerID{p1.PeerID}, removed)
+}
+
+func TestDiffPeersUnchanged(t *testing.T) {
+	require := require.New(t)
+
+	p1 := core.PeerInfoFixture()
+	p1Copy := *p1
+
+	added, removed := DiffPeers([]*core.PeerInfo{p1}, []*core.PeerInfo{&p1Copy})
+	require.Empty(added)
+	require.Empty(removed)
+}
+
+func TestDiffPeersLabelsChanged(t *testing.T) {
+	require := require.New(t)
+
+	p1 := core.PeerInfoFixture()
+	p1.Labels = map[string]string{"zone": "zone1"}
+	p1Moved := *p1
+	p1Moved.Labels = map[string]string{"zone": "zone2"}
+
+	added, removed := DiffPeers([]*core.PeerInfo{p1}, []*core.PeerInfo{&p1Moved})
+	require.Equal([]*core.PeerInfo{&p1Moved}, added)
+	require.Empty(removed)
+}
+
+func TestApplyPeerDiffInvertsDiffPeers(t *testing.T) {
+	require := require.New(t)
+
+	var prev, next []*core.PeerInfo
+	for i := 0; i < 10; i++ {
+		p := core.PeerInfoFixture()
+		if i < 7 {
+			prev = append(prev, p)
+		}
+		if i >= 3 {
+			q := *p
+			q.Complete = i%2 == 0
+			next = append(next, &q)
+		}
+	}
+	added, removed := DiffPeers(prev, next)
+
+	require.ElementsMatch(next, ApplyPeerDiff(prev, added, removed))
+}
@@ -14,16 +14,23 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
+	"os"
+	"strconv"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
+	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracker/metainfostore"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -31,6 +38,7 @@ import (
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/netutil"
 	"go.uber.org/zap"
 )
 
@@ -145,16 +153,38 @@ func Run(flags *Flags, opts ...Option) {
 	originStore := originstore.New(
 		config.OriginStore, clock.New(), origins, blobclient.NewProvider(blobclient.WithTLS(tls)))
 
-	policy, err := peerhandoutpolicy.NewPriorityPolicy(stats, config.PeerHandoutPolicy.Priority)
+	policy, err := peerhandoutpolicy.New(stats, config.PeerHandoutPolicy)
 	if err != nil {
 		log.Fatalf("Could not load peer handout policy: %s", err)
 	}
 
 	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originCluster := blobclient.NewClusterClient(r)
+	originCluster := blobclient.NewClusterClient(r, blobclient.WithBalancer(config.OriginBalancer))
 
-	server := trackerserver.New(
-		config.TrackerServer, stats, policy, peerStore, originStore, originCluster)
+	metaInfoStore, err := metainfostore.New(config.MetaInfoStore, clock.New(), stats, originCluster)
+	if err != nil {
+		log.Fatalf("Could not create MetaInfoStore: %s", err)
+	}
+
+	var serverOpts []trackerserver.Option
+	if config.Cluster.DNS != "" || len(config.Cluster.Static) > 0 {
+		if config.PeerStore.Shared() {
+			log.Info("Peer store is shared between trackers, rebalancing disabled")
+		} else {
+			ring, self, err := trackerRing(config, flags.Port, tls)
+			if err != nil {
+				log.Fatalf("Error building tracker hash ring: %s", err)
+			}
+			log.Infof("Rebalancing enabled as tracker %s", self)
+			serverOpts = append(serverOpts, trackerserver.WithRebalancing(ring, self, tls))
+		}
+	}
+
+	server, err := trackerserver.New(
+		config.TrackerServer, stats, policy, peerStore, originStore, metaInfoStore, originCluster, serverOpts...)
+	if err != nil {
+		log.Fatalf("Error creating tracker server: %s", err)
+	}
 	go func() {
 		log.Fatal(server.ListenAndServe())
 	}()
@@ -166,3 +196,35 @@ func Run(flags *Flags, opts ...Option) {
 			config.TrackerServer.Listener.Net, config.TrackerServer.Listener.Addr)},
 		nginx.WithTLS(config.TLS)))
 }
+
+// trackerRing returns the hash ring of trackers, and the address of the local
+// tracker in the ring.
+func trackerRing(config Config, port int, tls *tls.Config) (hashring.Ring, string, error) {
+	cluster, err := hostlist.New(config.Cluster)
+	if err != nil {
+		return nil, "", fmt.Errorf("cluster: %s", err)
+	}
+	ring := hashring.New(
+		config.HashRing, cluster, healthcheck.NewFilter(config.HealthCheck, healthcheck.Default(tls)))
+	go ring.Monitor(nil)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, "", fmt.Errorf("hostname: %s", err)
+	}
+	addr := net.JoinHostPort(hostname, strconv.Itoa(port))
+	if ring.Contains(addr) {
+		return ring, addr, nil
+	}
+	// When DNS is used for hash ring membership, the members will be IP
+	// addresses instead of hostnames.
+	ip, err := netutil.GetLocalIP()
+	if err != nil {
+		return nil, "", fmt.Errorf("get local ip: %s", err)
+	}
+	addr = net.JoinHostPort(ip, strconv.Itoa(port))
+	if ring.Contains(addr) {
+		return ring, addr, nil
+	}
+	return nil, "", fmt.Errorf("neither %s nor %s (port %d) found in hash ring", hostname, ip, port)
+}
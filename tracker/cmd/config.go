@@ -16,9 +16,14 @@ package cmd
 import (
 	"go.uber.org/zap"
 
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracker/metainfostore"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -28,13 +33,22 @@ import (
 
 // Config defines tracker configuration.
 type Config struct {
-	ZapLogging        zap.Config               `yaml:"zap"`
-	PeerStore         peerstore.Config         `yaml:"peerstore"`
-	OriginStore       originstore.Config       `yaml:"originstore"`
-	TrackerServer     trackerserver.Config     `yaml:"trackerserver"`
-	PeerHandoutPolicy peerhandoutpolicy.Config `yaml:"peerhandoutpolicy"`
-	Origin            upstream.ActiveConfig    `yaml:"origin"`
-	Metrics           metrics.Config           `yaml:"metrics"`
-	Nginx             nginx.Config             `yaml:"nginx"`
-	TLS               httputil.TLSConfig       `yaml:"tls"`
+	ZapLogging        zap.Config                `yaml:"zap"`
+	PeerStore         peerstore.Config          `yaml:"peerstore"`
+	OriginStore       originstore.Config        `yaml:"originstore"`
+	MetaInfoStore     metainfostore.Config      `yaml:"metainfostore"`
+	TrackerServer     trackerserver.Config      `yaml:"trackerserver"`
+	PeerHandoutPolicy peerhandoutpolicy.Config  `yaml:"peerhandoutpolicy"`
+	Origin            upstream.ActiveConfig     `yaml:"origin"`
+	OriginBalancer    blobclient.BalancerConfig `yaml:"origin_balancer"`
+	Metrics           metrics.Config            `yaml:"metrics"`
+	Nginx             nginx.Config              `yaml:"nginx"`
+	TLS               httputil.TLSConfig        `yaml:"tls"`
+
+	// Cluster lists the trackers of the hash ring agents announce to. If set
+	// and the peer store is local, trackers hand off peers of torrents they no
+	// longer own to the owners. HashRing must match the hash ring of agents.
+	Cluster     hostlist.Config          `yaml:"cluster"`
+	HashRing    hashring.Config          `yaml:"hashring"`
+	HealthCheck healthcheck.FilterConfig `yaml:"healthcheck"`
 }
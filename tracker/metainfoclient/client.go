@@ -24,6 +24,7 @@ import (
 
 	"github.com/cenkalti/backoff"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/httputil"
@@ -32,11 +33,14 @@ import (
 // Client errors.
 var (
 	ErrNotFound = errors.New("metainfo not found")
+
+	ErrChunkIndexNotFound = errors.New("chunk index not found")
 )
 
 // Client defines operations on torrent metainfo.
 type Client interface {
 	Download(namespace string, d core.Digest) (*core.MetaInfo, error)
+	DownloadChunkIndex(namespace string, d core.Digest) (*delta.Index, error)
 }
 
 type client struct {
@@ -92,3 +96,39 @@ func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, erro
 	}
 	return nil, err
 }
+
+// DownloadChunkIndex returns the chunk index of d. Returns ErrChunkIndexNotFound
+// if d has no chunk index.
+func (c *client) DownloadChunkIndex(namespace string, d core.Digest) (*delta.Index, error) {
+	var resp *http.Response
+	var err error
+	for _, addr := range c.ring.Locations(d) {
+		resp, err = httputil.Get(
+			fmt.Sprintf(
+				"http://%s/namespace/%s/blobs/%s/chunkindex",
+				addr, url.PathEscape(namespace), d),
+			httputil.SendTimeout(10*time.Second),
+			httputil.SendTLS(c.tls))
+		if err != nil {
+			if httputil.IsNetworkError(err) {
+				c.ring.Failed(addr)
+				continue
+			}
+			if httputil.IsNotFound(err) {
+				return nil, ErrChunkIndexNotFound
+			}
+			return nil, err
+		}
+		defer closers.Close(resp.Body)
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %s", err)
+		}
+		idx, err := delta.DeserializeIndex(b)
+		if err != nil {
+			return nil, fmt.Errorf("deserialize chunk index: %s", err)
+		}
+		return idx, nil
+	}
+	return nil, err
+}
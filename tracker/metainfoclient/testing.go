@@ -18,6 +18,7 @@ import (
 	"sync"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 )
 
 // TestClient is a thread-safe, in-memory client for simulating downloads.
@@ -53,3 +54,8 @@ func (c *TestClient) Download(namespace string, d core.Digest) (*core.MetaInfo,
 	}
 	return mi, nil
 }
+
+// DownloadChunkIndex always returns ErrChunkIndexNotFound.
+func (c *TestClient) DownloadChunkIndex(namespace string, d core.Digest) (*delta.Index, error) {
+	return nil, ErrChunkIndexNotFound
+}
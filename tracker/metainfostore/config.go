@@ -0,0 +1,69 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metainfostore
+
+import "time"
+
+// Config defines Store configuration.
+type Config struct {
+	// TTL is how long metainfo is served without being refreshed.
+	TTL time.Duration `yaml:"ttl"`
+
+	// MaxStale is how long metainfo is served after its TTL while it is
+	// refreshed in the background, e.g. while origins are unavailable.
+	MaxStale time.Duration `yaml:"max_stale"`
+
+	// NotFoundTTL is how long blobs which origins do not have are cached as
+	// not found.
+	NotFoundTTL time.Duration `yaml:"not_found_ttl"`
+
+	// ErrorTTL is how long other errors of origins are cached, and how long
+	// refreshes of stale metainfo are not retried after failing.
+	ErrorTTL time.Duration `yaml:"error_ttl"`
+
+	// Namespaces overrides the TTLs of namespaces matching the Namespace
+	// regexp. Only the first matching entry applies, and zero TTLs default to
+	// the TTLs above.
+	Namespaces []NamespaceConfig `yaml:"namespaces"`
+
+	// MaxEntries bounds the number of cached entries. Metainfo of further
+	// blobs is not cached until others expire.
+	MaxEntries int `yaml:"max_entries"`
+}
+
+// NamespaceConfig defines the TTLs of namespaces.
+type NamespaceConfig struct {
+	Namespace   string        `yaml:"namespace"`
+	TTL         time.Duration `yaml:"ttl"`
+	MaxStale    time.Duration `yaml:"max_stale"`
+	NotFoundTTL time.Duration `yaml:"not_found_ttl"`
+}
+
+func (c *Config) applyDefaults() {
+	if c.TTL == 0 {
+		c.TTL = 5 * time.Minute
+	}
+	if c.MaxStale == 0 {
+		c.MaxStale = 24 * time.Hour
+	}
+	if c.NotFoundTTL == 0 {
+		c.NotFoundTTL = 10 * time.Second
+	}
+	if c.ErrorTTL == 0 {
+		c.ErrorTTL = time.Second
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 100000
+	}
+}
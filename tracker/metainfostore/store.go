@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metainfostore
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Store is a local cache of metainfo in front of the origin cluster which is
+// resilient to origin unavailability. Stale metainfo is served while it is
+// refreshed in the background, so announces are not blocked on origins.
+type Store interface {
+	// GetMetaInfo returns the metainfo of d. Returns the error of origins if
+	// no metainfo of d is cached.
+	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+}
+
+type ttls struct {
+	ttl         time.Duration
+	maxStale    time.Duration
+	notFoundTTL time.Duration
+}
+
+type namespaceTTLs struct {
+	re *regexp.Regexp
+	ttls
+}
+
+type key struct {
+	namespace string
+	d         core.Digest
+}
+
+// entry caches either the metainfo of a blob, or the error origins returned
+// for it.
+type entry struct {
+	mi         *core.MetaInfo
+	fetchedAt  time.Time
+	err        error
+	errorUntil time.Time // Errors are cached, and refreshes are not retried, until then.
+}
+
+// fetch is an in-flight request to origins, shared by concurrent callers.
+type fetch struct {
+	done chan struct{}
+	mi   *core.MetaInfo
+	err  error
+}
+
+type store struct {
+	config     Config
+	clk        clock.Clock
+	stats      tally.Scope
+	cluster    blobclient.ClusterClient
+	defaults   ttls
+	namespaces []namespaceTTLs
+
+	mu        sync.Mutex // Protects the following fields:
+	entries   map[key]*entry
+	fetches   map[key]*fetch
+	lastPurge time.Time
+}
+
+// New creates a new Store.
+func New(
+	config Config,
+	clk clock.Clock,
+	stats tally.Scope,
+	cluster blobclient.ClusterClient) (Store, error) {
+
+	config.applyDefaults()
+	defaults := ttls{config.TTL, config.MaxStale, config.NotFoundTTL}
+	var namespaces []namespaceTTLs
+	for _, n := range config.Namespaces {
+		re, err := regexp.Compile(n.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("regexp %q: %s", n.Namespace, err)
+		}
+		t := ttls{n.TTL, n.MaxStale, n.NotFoundTTL}
+		if t.ttl == 0 {
+			t.ttl = defaults.ttl
+		}
+		if t.maxStale == 0 {
+			t.maxStale = defaults.maxStale
+		}
+		if t.notFoundTTL == 0 {
+			t.notFoundTTL = defaults.notFoundTTL
+		}
+		namespaces = append(namespaces, namespaceTTLs{re, t})
+	}
+	return &store{
+		config: config,
+		clk:    clk,
+		stats: stats.Tagged(map[string]string{
+			"module": "metainfostore",
+		}),
+		cluster:    cluster,
+		defaults:   defaults,
+		namespaces: namespaces,
+		entries:    make(map[key]*entry),
+		fetches:    make(map[key]*fetch),
+		lastPurge:  clk.Now(),
+	}, nil
+}
+
+func (s *store) ttls(namespace string) ttls {
+	for _, n := range s.namespaces {
+		if n.re.MatchString(namespace) {
+			return n.ttls
+		}
+	}
+	return s.defaults
+}
+
+func (s *store) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	k := key{namespace, d}
+	t := s.ttls(namespace)
+
+	s.mu.Lock()
+	now := s.clk.Now()
+	if now.Sub(s.lastPurge) >= s.config.TTL {
+		s.purge(now)
+	}
+	if e, ok := s.entries[k]; ok {
+		if e.mi != nil {
+			age := now.Sub(e.fetchedAt)
+			if age < t.ttl {
+				s.mu.Unlock()
+				s.count("fresh")
+				return e.mi, nil
+			}
+			if age < t.ttl+t.maxStale {
+				if !now.Before(e.errorUntil) {
+					s.startFetch(k)
+				}
+				s.mu.Unlock()
+				s.count("stale")
+				return e.mi, nil
+			}
+		} else if now.Before(e.errorUntil) {
+			s.mu.Unlock()
+			s.count("error")
+			return nil, e.err
+		}
+	}
+	f := s.startFetch(k)
+	s.mu.Unlock()
+
+	s.count("miss")
+	<-f.done
+	return f.mi, f.err
+}
+
+func (s *store) count(result string) {
+	s.stats.Tagged(map[string]string{
+		"result": result,
+	}).Counter("get_metainfo").Inc(1)
+}
+
+// startFetch fetches the metainfo of k from origins in the background, unless
+// it is already being fetched. Must be called with s.mu held.
+func (s *store) startFetch(k key) *fetch {
+	if f, ok := s.fetches[k]; ok {
+		return f
+	}
+	f := &fetch{done: make(chan struct{})}
+	s.fetches[k] = f
+	go s.fetch(k, f)
+	return f
+}
+
+func (s *store) fetch(k key, f *fetch) {
+	f.mi, f.err = s.cluster.GetMetaInfo(k.namespace, k.d)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.fetches, k)
+	defer close(f.done)
+
+	now := s.clk.Now()
+	t := s.ttls(k.namespace)
+	e, ok := s.entries[k]
+	if !ok && len(s.entries) >= s.config.MaxEntries {
+		s.stats.Counter("full").Inc(1)
+		return
+	}
+	switch {
+	case f.err == nil:
+		s.entries[k] = &entry{mi: f.mi, fetchedAt: now}
+	case httputil.IsNotFound(f.err):
+		s.entries[k] = &entry{err: f.err, errorUntil: now.Add(t.notFoundTTL)}
+	case ok && e.mi != nil && now.Sub(e.fetchedAt) < t.ttl+t.maxStale:
+		// Keep serving stale metainfo, and back off refreshing it.
+		log.With("namespace", k.namespace, "digest", k.d).Infof(
+			"Error refreshing stale metainfo: %s", f.err)
+		s.stats.Counter("refresh_errors").Inc(1)
+		e.errorUntil = now.Add(s.config.ErrorTTL)
+	default:
+		s.entries[k] = &entry{err: f.err, errorUntil: now.Add(s.config.ErrorTTL)}
+	}
+}
+
+// purge evicts expired entries. Must be called with s.mu held.
+func (s *store) purge(now time.Time) {
+	for k, e := range s.entries {
+		if e.mi != nil {
+			t := s.ttls(k.namespace)
+			if now.Sub(e.fetchedAt) < t.ttl+t.maxStale {
+				continue
+			}
+		} else if now.Before(e.errorUntil) {
+			continue
+		}
+		delete(s.entries, k)
+	}
+	s.lastPurge = now
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metainfostore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	mockblobclient "github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+type storeMocks struct {
+	clk     *clock.Mock
+	cluster *mockblobclient.MockClusterClient
+}
+
+func newStoreMocks(t *testing.T) (*storeMocks, func()) {
+	ctrl := gomock.NewController(t)
+	return &storeMocks{
+		clk:     clock.NewMock(),
+		cluster: mockblobclient.NewMockClusterClient(ctrl),
+	}, ctrl.Finish
+}
+
+func (m *storeMocks) new(t *testing.T, config Config) *store {
+	s, err := New(config, m.clk, tally.NoopScope, m.cluster)
+	require.NoError(t, err)
+	return s.(*store)
+}
+
+// waitForFetches waits until background fetches of s are applied.
+func waitForFetches(t *testing.T, s *store) {
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.fetches) == 0
+	}))
+}
+
+func TestGetMetaInfoCachesMetaInfo(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	s := mocks.new(t, Config{TTL: time.Minute})
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.cluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	for i := 0; i < 3; i++ {
+		result, err := s.GetMetaInfo(namespace, mi.Digest())
+		require.NoError(err)
+		require.Equal(mi, result)
+	}
+}
+
+func TestGetMetaInfoServesStaleWhileRefreshing(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	s := mocks.new(t, Config{TTL: time.Minute, MaxStale: time.Hour})
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.cluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	_, err := s.GetMetaInfo(namespace, mi.Digest())
+	require.NoError(err)
+
+	mocks.clk.Add(time.Minute)
+
+	refreshed := core.MetaInfoFixture()
+	release := make(chan struct{})
+	mocks.cluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).DoAndReturn(
+		func(string, core.Digest) (*core.MetaInfo, error) {
+			<-release
+			return refreshed, nil
+		})
+
+	// Stale metainfo is served without waiting for the refresh.
+	for i := 0; i < 3; i++ {
+		result, err := s.GetMetaInfo(namespace, mi.Digest())
+		require.NoError(err)
+		require.Equal(mi, result)
+	}
+
+	close(release)
+	waitForFetches(t, s)
+
+	result, err := s.GetMetaInfo(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(refreshed, result)
+}
+
+func TestGetMetaInfoServesStaleWhileOriginsUnavailable(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	s := mocks.new(t, Config{TTL: time.Minute, MaxStale: time.Hour, ErrorTTL: 5 * time.Second})
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.cluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	_, err := s.GetMetaInfo(namespace, mi.Digest())
+	require.NoError(err)
+
+	mocks.clk.Add(time.Minute)
+
+	// Failed refreshes are not retried until the error TTL passes.
+	mocks.cluster.EXPECT().GetMetaInfo(
+		namespace, mi.Digest()).Return(nil, httputil.StatusError{Status: 503}).Times(2)
+
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			result, err := s.GetMetaInfo(namespace, mi.Digest())
+			require.NoError(err)
+			require.Equal(mi, result)
+			waitForFetches(t, s)
+		}
+		mocks.clk.Add(5 * time.Second)
+	}
+
+	// Metainfo is no longer served after max stale.
+	mocks.clk.Add(time.Hour)
+
+	mocks.cluster.EXPECT().GetMetaInfo(
+		namespace, mi.Digest()).Return(nil, httputil.StatusError{Status: 503})
+
+	_, err = s.GetMetaInfo(namespace, mi.Digest())
+	require.True(httputil.IsStatus(err, 503))
+}
+
+func TestGetMetaInfoCachesNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	s := mocks.new(t, Config{NotFoundTTL: 10 * time.Second})
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.cluster.EXPECT().GetMetaInfo(
+		namespace, mi.Digest()).Return(nil, httputil.StatusError{Status: 404})
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetMetaInfo(namespace, mi.Digest())
+		require.True(httputil.IsNotFound(err))
+	}
+
+	mocks.clk.Add(10 * time.Second)
+
+	mocks.cluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	result, err := s.GetMetaInfo(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+}
+
+func TestGetMetaInfoNamespaceTTLs(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	s := mocks.new(t, Config{
+		TTL:      time.Hour,
+		MaxStale: time.Nanosecond,
+		Namespaces: []NamespaceConfig{{
+			Namespace: "^mutable/.*",
+			TTL:       time.Minute,
+		}},
+	})
+
+	mi1 := core.MetaInfoFixture()
+	mi2 := core.MetaInfoFixture()
+
+	mocks.cluster.EXPECT().GetMetaInfo("mutable/a", mi1.Digest()).Return(mi1, nil).Times(2)
+	mocks.cluster.EXPECT().GetMetaInfo("immutable/a", mi2.Digest()).Return(mi2, nil).Times(1)
+
+	for i := 0; i < 2; i++ {
+		_, err := s.GetMetaInfo("mutable/a", mi1.Digest())
+		require.NoError(err)
+		_, err = s.GetMetaInfo("immutable/a", mi2.Digest())
+		require.NoError(err)
+		mocks.clk.Add(2 * time.Minute)
+	}
+}
+
+func TestGetMetaInfoDeduplicatesConcurrentMisses(t *testing.T) {
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	s := mocks.new(t, Config{})
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+	err := errors.New("some error")
+
+	release := make(chan struct{})
+	mocks.cluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).DoAndReturn(
+		func(string, core.Digest) (*core.MetaInfo, error) {
+			<-release
+			return nil, err
+		})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, getErr := s.GetMetaInfo(namespace, mi.Digest())
+			require.Equal(t, err, getErr)
+		}()
+	}
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.fetches) == 1
+	}))
+	close(release)
+	wg.Wait()
+}
+
+func TestNewInvalidNamespace(t *testing.T) {
+	_, err := New(Config{Namespaces: []NamespaceConfig{{Namespace: "("}}}, clock.NewMock(), tally.NoopScope, nil)
+	require.Error(t, err)
+}
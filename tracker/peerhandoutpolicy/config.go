@@ -16,4 +16,23 @@ package peerhandoutpolicy
 // Config defines configuration for the peer handout policy.
 type Config struct {
 	Priority string `yaml:"priority"`
+
+	// MinSeederRatio is the minimum fraction of handed out peers which are
+	// seeders, i.e. origins or peers which announced as complete, if enough
+	// seeders are known. Disabled if 0.
+	MinSeederRatio float64 `yaml:"min_seeder_ratio"`
+
+	// CandidateMultiplier is the number of candidate peers sampled per
+	// handout slot while MinSeederRatio or Locality is enabled, so seeders
+	// and nearby peers are likely to be sampled even if they are rare in large
+	// swarms.
+	CandidateMultiplier int `yaml:"candidate_multiplier"`
+
+	Locality LocalityConfig `yaml:"locality"`
+}
+
+func (c *Config) applyDefaults() {
+	if c.CandidateMultiplier == 0 {
+		c.CandidateMultiplier = 4
+	}
 }
@@ -0,0 +1,283 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// LocalityConfig defines the configuration of locality-aware peer selection.
+// Peers are scored by their network distance to the announcing peer, based on
+// their labels, and closer peers are handed out first.
+type LocalityConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Labels are the location labels peers are compared on, from the broadest
+	// to the narrowest. The distance between two peers is the number of labels
+	// after the longest prefix of labels they share.
+	Labels []string `yaml:"labels"`
+
+	// RemoteLabel is the label which peers must differ on to be considered
+	// remote, e.g. "zone" for cross-zone peers.
+	RemoteLabel string `yaml:"remote_label"`
+
+	// MinRemoteRatio is the fraction of handed out peers which are reserved
+	// for remote seeders, so swarms of different zones do not partition.
+	MinRemoteRatio float64 `yaml:"min_remote_ratio"`
+
+	// LabelTTL is how long the labels announced by peers are remembered.
+	// Peer stores do not persist labels, so labels of peers in handouts are
+	// looked up from their announces.
+	LabelTTL time.Duration `yaml:"label_ttl"`
+
+	// Mapping labels peers which do not announce labels, e.g. origins.
+	Mapping LocalityMappingConfig `yaml:"mapping"`
+}
+
+func (c *LocalityConfig) applyDefaults() {
+	if len(c.Labels) == 0 {
+		c.Labels = []string{"region", "zone", "rack"}
+	}
+	if c.RemoteLabel == "" {
+		c.RemoteLabel = "zone"
+	}
+	if c.MinRemoteRatio == 0 {
+		c.MinRemoteRatio = 0.2
+	}
+	if c.LabelTTL == 0 {
+		c.LabelTTL = time.Hour
+	}
+	c.Mapping.applyDefaults()
+}
+
+// LocalityMappingConfig maps peer ips to labels. Static CIDRs take precedence
+// over the mapping service.
+type LocalityMappingConfig struct {
+	CIDRs []CIDRLabels `yaml:"cidrs"`
+
+	// URL of a mapping service, which is queried with GET <url>?ip=<ip> and
+	// replies with a JSON object of labels.
+	URL string `yaml:"url"`
+
+	// CacheTTL is how long replies of the mapping service are cached.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *LocalityMappingConfig) applyDefaults() {
+	if c.CacheTTL == 0 {
+		c.CacheTTL = 10 * time.Minute
+	}
+	if c.Timeout == 0 {
+		c.Timeout = time.Second
+	}
+}
+
+// CIDRLabels labels all peers within CIDR.
+type CIDRLabels struct {
+	CIDR   string            `yaml:"cidr"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+type cidrLabels struct {
+	net    *net.IPNet
+	labels map[string]string
+}
+
+type cachedLabels struct {
+	labels    map[string]string
+	expiresAt time.Time
+}
+
+// localityResolver resolves the labels of peers and the distances between
+// them.
+type localityResolver struct {
+	config LocalityConfig
+	clk    clock.Clock
+	cidrs  []cidrLabels
+
+	mu        sync.Mutex // Protects the following fields:
+	byPeer    map[core.PeerID]cachedLabels
+	byIP      map[string]cachedLabels
+	lastPurge time.Time
+}
+
+func newLocalityResolver(config LocalityConfig, clk clock.Clock) (*localityResolver, error) {
+	config.applyDefaults()
+	if config.MinRemoteRatio < 0 || config.MinRemoteRatio > 1 {
+		return nil, fmt.Errorf("invalid min remote ratio %f: must be within [0, 1]", config.MinRemoteRatio)
+	}
+	var remote bool
+	for _, l := range config.Labels {
+		remote = remote || l == config.RemoteLabel
+	}
+	if !remote {
+		return nil, fmt.Errorf("remote label %q not in labels", config.RemoteLabel)
+	}
+	var cidrs []cidrLabels
+	for _, c := range config.Mapping.CIDRs {
+		_, n, err := net.ParseCIDR(c.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("parse cidr: %s", err)
+		}
+		cidrs = append(cidrs, cidrLabels{n, c.Labels})
+	}
+	return &localityResolver{
+		config: config,
+		clk:    clk,
+		cidrs:  cidrs,
+		byPeer: make(map[core.PeerID]cachedLabels),
+		byIP:   make(map[string]cachedLabels),
+	}, nil
+}
+
+// learn remembers the labels announced by peer.
+func (r *localityResolver) learn(peer *core.PeerInfo) {
+	if len(peer.Labels) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clk.Now()
+	if now.Sub(r.lastPurge) >= r.config.LabelTTL {
+		for id, c := range r.byPeer {
+			if !now.Before(c.expiresAt) {
+				delete(r.byPeer, id)
+			}
+		}
+		for ip, c := range r.byIP {
+			if !now.Before(c.expiresAt) {
+				delete(r.byIP, ip)
+			}
+		}
+		r.lastPurge = now
+	}
+	r.byPeer[peer.PeerID] = cachedLabels{peer.Labels, now.Add(r.config.LabelTTL)}
+}
+
+// labels returns the labels of peer, in order of precedence: the labels peer
+// carries, the labels it last announced, the static CIDR mapping, and the
+// mapping service. Returns nil if peer cannot be labeled.
+func (r *localityResolver) labels(peer *core.PeerInfo) map[string]string {
+	if len(peer.Labels) > 0 {
+		return peer.Labels
+	}
+	r.mu.Lock()
+	c, ok := r.byPeer[peer.PeerID]
+	r.mu.Unlock()
+	if ok && r.clk.Now().Before(c.expiresAt) {
+		return c.labels
+	}
+	ip := net.ParseIP(peer.IP)
+	if ip != nil {
+		for _, c := range r.cidrs {
+			if c.net.Contains(ip) {
+				return c.labels
+			}
+		}
+	}
+	if r.config.Mapping.URL == "" {
+		return nil
+	}
+	return r.lookup(peer.IP)
+}
+
+// lookup queries the mapping service for the labels of ip. Failures are
+// cached like replies, so an unavailable service does not stall handouts.
+func (r *localityResolver) lookup(ip string) map[string]string {
+	r.mu.Lock()
+	c, ok := r.byIP[ip]
+	r.mu.Unlock()
+	if ok && r.clk.Now().Before(c.expiresAt) {
+		return c.labels
+	}
+
+	labels, err := r.query(ip)
+	if err != nil {
+		log.With("ip", ip).Infof("Error looking up peer locality: %s", err)
+	}
+
+	r.mu.Lock()
+	r.byIP[ip] = cachedLabels{labels, r.clk.Now().Add(r.config.Mapping.CacheTTL)}
+	r.mu.Unlock()
+
+	return labels
+}
+
+func (r *localityResolver) query(ip string) (map[string]string, error) {
+	u, err := url.Parse(r.config.Mapping.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %s", err)
+	}
+	q := u.Query()
+	q.Set("ip", ip)
+	u.RawQuery = q.Encode()
+
+	resp, err := httputil.Get(u.String(), httputil.SendTimeout(r.config.Mapping.Timeout))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var labels map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&labels); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	return labels, nil
+}
+
+// distance returns the number of labels after the longest prefix of labels a
+// and b share. Missing labels never match.
+func (r *localityResolver) distance(a, b map[string]string) int {
+	for i, l := range r.config.Labels {
+		va, vb := a[l], b[l]
+		if va == "" || va != vb {
+			return len(r.config.Labels) - i
+		}
+	}
+	return 0
+}
+
+// remote returns whether a and b differ on the remote label or on any broader
+// label both of them carry, or whether either lacks the remote label. Broader
+// labels are compared too since e.g. zone names are only unique within a
+// region, but a missing broader label is unknown rather than different.
+func (r *localityResolver) remote(a, b map[string]string) bool {
+	va, vb := a[r.config.RemoteLabel], b[r.config.RemoteLabel]
+	if va == "" || va != vb {
+		return true
+	}
+	for _, l := range r.config.Labels {
+		if l == r.config.RemoteLabel {
+			break
+		}
+		va, vb := a[l], b[l]
+		if va != "" && vb != "" && va != vb {
+			return true
+		}
+	}
+	return false
+}
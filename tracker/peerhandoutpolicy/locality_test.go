@@ -0,0 +1,257 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+)
+
+func localityResolverFixture(t *testing.T, config LocalityConfig) (*localityResolver, *clock.Mock) {
+	clk := clock.NewMock()
+	r, err := newLocalityResolver(config, clk)
+	require.NoError(t, err)
+	return r, clk
+}
+
+func zoneLabels(region, zone, rack string) map[string]string {
+	return map[string]string{"region": region, "zone": zone, "rack": rack}
+}
+
+func TestLocalityDistance(t *testing.T) {
+	r, _ := localityResolverFixture(t, LocalityConfig{})
+
+	src := zoneLabels("us", "us-1", "r1")
+	tests := []struct {
+		desc     string
+		labels   map[string]string
+		distance int
+		remote   bool
+	}{
+		{"same rack", zoneLabels("us", "us-1", "r1"), 0, false},
+		{"same zone", zoneLabels("us", "us-1", "r2"), 1, false},
+		{"same region", zoneLabels("us", "us-2", "r1"), 2, true},
+		{"other region", zoneLabels("eu", "us-1", "r1"), 3, true},
+		{"unknown region", map[string]string{"zone": "us-1", "rack": "r1"}, 3, false},
+		{"unknown zone", map[string]string{"region": "us", "rack": "r1"}, 2, true},
+		{"unlabeled", nil, 3, true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+			require.Equal(test.distance, r.distance(src, test.labels))
+			require.Equal(test.remote, r.remote(src, test.labels))
+		})
+	}
+}
+
+func TestNewLocalityResolverInvalidConfig(t *testing.T) {
+	for _, config := range []LocalityConfig{
+		{MinRemoteRatio: 1.5},
+		{Labels: []string{"region"}, RemoteLabel: "zone"},
+		{Mapping: LocalityMappingConfig{CIDRs: []CIDRLabels{{CIDR: "10.0.0.0"}}}},
+	} {
+		_, err := newLocalityResolver(config, clock.NewMock())
+		require.Error(t, err)
+	}
+}
+
+func TestLocalityLabelsLearnedFromAnnounce(t *testing.T) {
+	require := require.New(t)
+
+	r, clk := localityResolverFixture(t, LocalityConfig{LabelTTL: time.Minute})
+
+	announced := core.PeerInfoFixture()
+	announced.Labels = zoneLabels("us", "us-1", "r1")
+	r.learn(announced)
+
+	// Peers returned by peer stores do not carry labels.
+	stored := core.NewPeerInfo(
+		announced.PeerID, announced.IP, announced.Port, announced.Origin, announced.Complete)
+	require.Equal(announced.Labels, r.labels(stored))
+
+	clk.Add(time.Minute)
+	require.Nil(r.labels(stored))
+}
+
+func TestLocalityLabelsFromCIDRs(t *testing.T) {
+	require := require.New(t)
+
+	labels := zoneLabels("us", "us-1", "r1")
+	r, _ := localityResolverFixture(t, LocalityConfig{
+		Mapping: LocalityMappingConfig{
+			CIDRs: []CIDRLabels{{CIDR: "10.1.0.0/16", Labels: labels}},
+		},
+	})
+
+	p := core.PeerInfoFixture()
+	p.IP = "10.1.2.3"
+	require.Equal(labels, r.labels(p))
+
+	p.IP = "10.2.2.3"
+	require.Nil(r.labels(p))
+}
+
+func TestLocalityLabelsFromMappingService(t *testing.T) {
+	require := require.New(t)
+
+	labels := zoneLabels("us", "us-1", "r1")
+	var queries int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		if r.URL.Query().Get("ip") != "10.1.2.3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(labels)
+	}))
+	defer server.Close()
+
+	r, clk := localityResolverFixture(t, LocalityConfig{
+		Mapping: LocalityMappingConfig{URL: server.URL, CacheTTL: time.Minute},
+	})
+
+	p := core.PeerInfoFixture()
+	p.IP = "10.1.2.3"
+	require.Equal(labels, r.labels(p))
+	require.Equal(labels, r.labels(p))
+	require.Equal(1, queries)
+
+	// Failures are cached too.
+	q := core.PeerInfoFixture()
+	q.IP = "10.2.2.3"
+	require.Nil(r.labels(q))
+	require.Nil(r.labels(q))
+	require.Equal(2, queries)
+
+	clk.Add(time.Minute)
+	require.Equal(labels, r.labels(p))
+	require.Equal(3, queries)
+}
+
+func localityPolicyFixture(t *testing.T, config Config) *PriorityPolicy {
+	config.Priority = _completenessPolicy
+	config.Locality.Enabled = true
+	p, err := New(tally.NoopScope, config)
+	require.NoError(t, err)
+	return p
+}
+
+func labeledPeersFixture(n int, complete bool, labels map[string]string) []*core.PeerInfo {
+	peers := peersFixture(n, complete, false)
+	for _, p := range peers {
+		p.Labels = labels
+	}
+	return peers
+}
+
+func countZone(peers []*core.PeerInfo, zone string) int {
+	var n int
+	for _, p := range peers {
+		if p.Labels["zone"] == zone {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSelectPeersPrefersNearbyPeers(t *testing.T) {
+	require := require.New(t)
+
+	policy := localityPolicyFixture(t, Config{
+		Locality: LocalityConfig{MinRemoteRatio: 0.2},
+	})
+
+	src := core.PeerInfoFixture()
+	src.Labels = zoneLabels("us", "us-1", "r1")
+
+	var candidates []*core.PeerInfo
+	candidates = append(candidates, labeledPeersFixture(20, true, zoneLabels("us", "us-2", "r1"))...)
+	candidates = append(candidates, labeledPeersFixture(20, false, zoneLabels("us", "us-1", "r2"))...)
+
+	selected := policy.SelectPeers(src, candidates, 10)
+	require.Len(selected, 10)
+
+	// 20% of slots are reserved for remote seeders, and the remaining slots
+	// are filled with same-zone peers.
+	require.Equal(2, countZone(selected, "us-2"))
+	require.Equal(8, countZone(selected, "us-1"))
+}
+
+func TestSelectPeersLearnsLabelsOfStoredPeers(t *testing.T) {
+	require := require.New(t)
+
+	policy := localityPolicyFixture(t, Config{
+		Locality: LocalityConfig{MinRemoteRatio: 0.1},
+	})
+
+	src := core.PeerInfoFixture()
+	src.Labels = zoneLabels("us", "us-1", "r1")
+
+	near := labeledPeersFixture(5, false, zoneLabels("us", "us-1", "r1"))
+	for _, p := range near {
+		policy.Learn(p)
+	}
+	var candidates []*core.PeerInfo
+	candidates = append(candidates, peersFixture(20, false, false)...)
+	for _, p := range near {
+		candidates = append(candidates,
+			core.NewPeerInfo(p.PeerID, p.IP, p.Port, p.Origin, p.Complete))
+	}
+
+	selected := policy.SelectPeers(src, candidates, 5)
+	require.Len(selected, 5)
+
+	var ids []core.PeerID
+	for _, p := range near {
+		ids = append(ids, p.PeerID)
+	}
+	var selectedIDs []core.PeerID
+	for _, p := range selected {
+		selectedIDs = append(selectedIDs, p.PeerID)
+	}
+	require.ElementsMatch(ids, selectedIDs)
+}
+
+func TestSelectPeersLocalityWithMinSeederRatio(t *testing.T) {
+	require := require.New(t)
+
+	policy := localityPolicyFixture(t, Config{
+		MinSeederRatio: 0.5,
+		Locality:       LocalityConfig{MinRemoteRatio: 0.2},
+	})
+
+	src := core.PeerInfoFixture()
+	src.Labels = zoneLabels("us", "us-1", "r1")
+
+	var candidates []*core.PeerInfo
+	candidates = append(candidates, labeledPeersFixture(20, false, zoneLabels("us", "us-1", "r1"))...)
+	candidates = append(candidates, labeledPeersFixture(20, true, zoneLabels("us", "us-2", "r1"))...)
+
+	selected := policy.SelectPeers(src, candidates, 10)
+	require.Len(selected, 10)
+
+	// Remote seeders count towards the seeder ratio.
+	require.Equal(5, countSeeders(selected))
+	require.Equal(5, countZone(selected, "us-2"))
+}
@@ -15,8 +15,10 @@ package peerhandoutpolicy
 
 import (
 	"fmt"
+	"math"
 	"sort"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 
 	"github.com/uber/kraken/core"
@@ -37,6 +39,31 @@ type assignmentPolicy interface {
 type PriorityPolicy struct {
 	stats  tally.Scope
 	policy assignmentPolicy
+
+	minSeederRatio      float64
+	candidateMultiplier int
+	locality            *localityResolver // Nil if disabled.
+}
+
+// New returns a PriorityPolicy configured by config.
+func New(stats tally.Scope, config Config) (*PriorityPolicy, error) {
+	config.applyDefaults()
+	if config.MinSeederRatio < 0 || config.MinSeederRatio > 1 {
+		return nil, fmt.Errorf("invalid min seeder ratio %f: must be within [0, 1]", config.MinSeederRatio)
+	}
+	p, err := NewPriorityPolicy(stats, config.Priority)
+	if err != nil {
+		return nil, err
+	}
+	p.minSeederRatio = config.MinSeederRatio
+	p.candidateMultiplier = config.CandidateMultiplier
+	if config.Locality.Enabled {
+		p.locality, err = newLocalityResolver(config.Locality, clock.New())
+		if err != nil {
+			return nil, fmt.Errorf("locality: %s", err)
+		}
+	}
+	return p, nil
 }
 
 // NewPriorityPolicy returns a PriorityPolicy that assigns priorities using the given priority policy.
@@ -63,6 +90,13 @@ func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolic
 // SortPeers returns the given list of peers sorted by the priority assigned to them
 // by the priorityPolicy. Excludes the source peer from the list.
 func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo) []*core.PeerInfo {
+	return p.sortPeers(source, peers, nil)
+}
+
+// sortPeers sorts peers like SortPeers. Peers of equal priority are sorted by
+// distance, if non-nil.
+func (p *PriorityPolicy) sortPeers(
+	source *core.PeerInfo, peers []*core.PeerInfo, distance map[*core.PeerInfo]int) []*core.PeerInfo {
 
 	peerPriorities := make([]*peerPriorityInfo, 0, len(peers))
 	for k := 0; k < len(peers); k++ {
@@ -74,7 +108,11 @@ func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo
 	}
 
 	sort.Slice(peerPriorities, func(i, j int) bool {
-		return peerPriorities[i].priority < peerPriorities[j].priority
+		a, b := peerPriorities[i], peerPriorities[j]
+		if a.priority != b.priority || distance == nil {
+			return a.priority < b.priority
+		}
+		return distance[a.peer] < distance[b.peer]
 	})
 
 	priorityCounts := make(map[string]int)
@@ -93,3 +131,114 @@ func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo
 
 	return peers
 }
+
+// Learn records the labels announced by peer, so peer can be located when it
+// is handed out to other peers.
+func (p *PriorityPolicy) Learn(peer *core.PeerInfo) {
+	if p.locality != nil {
+		p.locality.learn(peer)
+	}
+}
+
+// NumCandidates returns the number of candidate peers to sample for a handout
+// of limit peers.
+func (p *PriorityPolicy) NumCandidates(limit int) int {
+	if p.minSeederRatio == 0 && p.locality == nil {
+		return limit
+	}
+	return limit * p.candidateMultiplier
+}
+
+func isSeeder(peer *core.PeerInfo) bool {
+	return peer.Origin || peer.Complete
+}
+
+// SelectPeers returns at most limit peers selected from candidates, sorted
+// like SortPeers. Excludes the source peer.
+//
+// If locality is enabled, peers closest to source are preferred, and the
+// minimum remote ratio of slots is reserved for remote seeders. At least the
+// minimum seeder ratio of the selected peers are seeders, if enough seeders
+// are among candidates. Peer seeders are preferred to origins, to offload
+// origins.
+//
+// If neither the seeder ratio nor locality is enabled, all candidates are
+// returned.
+func (p *PriorityPolicy) SelectPeers(
+	source *core.PeerInfo, candidates []*core.PeerInfo, limit int) []*core.PeerInfo {
+
+	if p.minSeederRatio == 0 && p.locality == nil {
+		return p.SortPeers(source, candidates)
+	}
+
+	order := make([]*core.PeerInfo, 0, len(candidates))
+	for _, c := range candidates {
+		if c != source && c.PeerID != source.PeerID {
+			order = append(order, c)
+		}
+	}
+	var distance map[*core.PeerInfo]int
+	var remote map[*core.PeerInfo]bool
+	if p.locality != nil {
+		distance = make(map[*core.PeerInfo]int, len(order))
+		remote = make(map[*core.PeerInfo]bool, len(order))
+		src := p.locality.labels(source)
+		for _, c := range order {
+			labels := p.locality.labels(c)
+			distance[c] = p.locality.distance(src, labels)
+			remote[c] = p.locality.remote(src, labels)
+		}
+		// Stable, so peers remain in random order within each distance.
+		sort.SliceStable(order, func(i, j int) bool {
+			return distance[order[i]] < distance[order[j]]
+		})
+	}
+
+	n := len(order)
+	if n > limit {
+		n = limit
+	}
+	selected := make([]*core.PeerInfo, 0, n)
+	chosen := make(map[*core.PeerInfo]bool, n)
+	// pick selects at most k peers matching f, in order of preference.
+	pick := func(k int, f func(*core.PeerInfo) bool) int {
+		var picked int
+		for _, c := range order {
+			if picked == k || len(selected) == n {
+				break
+			}
+			if !chosen[c] && f(c) {
+				selected = append(selected, c)
+				chosen[c] = true
+				picked++
+			}
+		}
+		return picked
+	}
+
+	if p.locality != nil {
+		k := int(math.Ceil(p.locality.config.MinRemoteRatio * float64(n)))
+		k -= pick(k, func(c *core.PeerInfo) bool { return remote[c] && isSeeder(c) && !c.Origin })
+		pick(k, func(c *core.PeerInfo) bool { return remote[c] && c.Origin })
+	}
+	if p.minSeederRatio > 0 {
+		k := int(math.Ceil(p.minSeederRatio*float64(n))) - countSeeders(selected)
+		k -= pick(k, func(c *core.PeerInfo) bool { return isSeeder(c) && !c.Origin })
+		if k -= pick(k, func(c *core.PeerInfo) bool { return c.Origin }); k > 0 {
+			p.stats.Counter("seeder_shortfall").Inc(1)
+		}
+	}
+	pick(n, func(*core.PeerInfo) bool { return true })
+
+	return p.sortPeers(source, selected, distance)
+}
+
+func countSeeders(peers []*core.PeerInfo) int {
+	var n int
+	for _, p := range peers {
+		if isSeeder(p) {
+			n++
+		}
+	}
+	return n
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/uber/kraken/core"
 
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func TestPriorityPolicyRemoveSource(t *testing.T) {
@@ -39,3 +40,85 @@ func TestPriorityPolicyRemoveSource(t *testing.T) {
 		require.NotEqual(src, sorted[k])
 	}
 }
+
+func selectPolicyFixture(t *testing.T, ratio float64) *PriorityPolicy {
+	p, err := New(tally.NoopScope, Config{Priority: _completenessPolicy, MinSeederRatio: ratio})
+	require.NoError(t, err)
+	return p
+}
+
+func peersFixture(n int, complete, origin bool) []*core.PeerInfo {
+	peers := make([]*core.PeerInfo, n)
+	for i := range peers {
+		peers[i] = core.PeerInfoFixture()
+		peers[i].Complete = complete
+		peers[i].Origin = origin
+	}
+	return peers
+}
+
+func TestSelectPeersEnforcesMinSeederRatio(t *testing.T) {
+	require := require.New(t)
+
+	policy := selectPolicyFixture(t, 0.5)
+
+	// Seeders are rare among candidates.
+	candidates := append(peersFixture(36, false, false), peersFixture(6, true, false)...)
+	candidates = append(candidates, peersFixture(2, true, true)...)
+
+	selected := policy.SelectPeers(core.PeerInfoFixture(), candidates, 10)
+	require.Len(selected, 10)
+	require.Equal(5, countSeeders(selected))
+
+	// Peer seeders are preferred to origins.
+	for _, p := range selected {
+		require.False(p.Origin)
+	}
+}
+
+func TestSelectPeersSeederShortfall(t *testing.T) {
+	require := require.New(t)
+
+	policy := selectPolicyFixture(t, 0.8)
+
+	candidates := append(peersFixture(20, false, false), peersFixture(1, true, true)...)
+
+	selected := policy.SelectPeers(core.PeerInfoFixture(), candidates, 10)
+	require.Len(selected, 10)
+	require.Equal(1, countSeeders(selected))
+	require.True(selected[0].Origin)
+}
+
+func TestSelectPeersExcludesSource(t *testing.T) {
+	require := require.New(t)
+
+	policy := selectPolicyFixture(t, 0.5)
+
+	src := core.PeerInfoFixture()
+	src.Complete = true
+	// The peer store returns copies of the source peer.
+	srcCopy := *src
+
+	candidates := append(peersFixture(3, false, false), &srcCopy)
+
+	selected := policy.SelectPeers(src, candidates, 10)
+	require.Len(selected, 3)
+	for _, p := range selected {
+		require.NotEqual(src.PeerID, p.PeerID)
+	}
+}
+
+func TestSelectPeersDisabledReturnsAllCandidates(t *testing.T) {
+	require := require.New(t)
+
+	policy := selectPolicyFixture(t, 0)
+	require.Equal(10, policy.NumCandidates(10))
+
+	candidates := peersFixture(20, false, false)
+	require.Len(policy.SelectPeers(core.PeerInfoFixture(), candidates, 10), 20)
+}
+
+func TestNewInvalidMinSeederRatio(t *testing.T) {
+	_, err := New(tally.NoopScope, Config{Priority: _defaultPolicy, MinSeederRatio: 1.5})
+	require.Error(t, err)
+}
@@ -15,15 +15,28 @@ package peerstore
 
 import (
 	"time"
+
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/listener"
 )
 
 // Config defines Store configuration.
 //
-// NOTE: By default, the LocalStore implementation is used. Redis configuration
-// is ignored unless RedisConfig.Enabled is true.
+// NOTE: By default, the LocalStore implementation is used. Redis, etcd and
+// gossip configuration is ignored unless enabled. Redis takes precedence over
+// etcd, which takes precedence over gossip.
 type Config struct {
-	Local LocalConfig `yaml:"local"`
-	Redis RedisConfig `yaml:"redis"`
+	Local  LocalConfig  `yaml:"local"`
+	Redis  RedisConfig  `yaml:"redis"`
+	Etcd   EtcdConfig   `yaml:"etcd"`
+	Gossip GossipConfig `yaml:"gossip"`
+}
+
+// Shared returns whether the configured store shares peers between trackers,
+// as opposed to the local store.
+func (c Config) Shared() bool {
+	return c.Redis.Enabled || c.Etcd.Enabled || c.Gossip.Enabled
 }
 
 // LocalConfig defines LocalStore configuration.
@@ -38,10 +51,17 @@ func (c *LocalConfig) applyDefaults() {
 }
 
 // RedisConfig defines RedisStore configuration.
+//
+// By default, RedisStore connects to the single Redis instance at Addr. If
+// Cluster is true, Addrs are seed nodes of a Redis Cluster. Else if
+// SentinelMaster is set, Addrs are Sentinels which monitor the master.
 // TODO(evelynl94): rename
 type RedisConfig struct {
 	Enabled           bool          `yaml:"enabled"`
 	Addr              string        `yaml:"addr"`
+	Cluster           bool          `yaml:"cluster"`
+	Addrs             []string      `yaml:"addrs"`
+	SentinelMaster    string        `yaml:"sentinel_master"`
 	DialTimeout       time.Duration `yaml:"dial_timeout"`
 	ReadTimeout       time.Duration `yaml:"read_timeout"`
 	WriteTimeout      time.Duration `yaml:"write_timeout"`
@@ -78,3 +98,106 @@ func (c *RedisConfig) applyDefaults() {
 		c.IdleConnTimeout = 60 * time.Second
 	}
 }
+
+// EtcdConfig defines EtcdStore configuration.
+type EtcdConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Endpoints are the client URLs of etcd members, e.g.
+	// "https://etcd-0:2379". Requests fail over to the next endpoint once an
+	// endpoint is unreachable.
+	Endpoints []string `yaml:"endpoints"`
+
+	// TLS configures client certificates and CAs for https endpoints.
+	TLS httputil.TLSConfig `yaml:"tls"`
+
+	// Prefix is prepended to all keys written by the store.
+	Prefix string `yaml:"prefix"`
+
+	// TTL is the minimum duration peers are retained after their last
+	// announce.
+	TTL time.Duration `yaml:"ttl"`
+
+	// LeaseInterval is how often a new lease is granted. All peers announcing
+	// within the same interval share a lease, which bounds the number of
+	// leases regardless of the number of peers. Peers expire at most
+	// LeaseInterval after TTL.
+	LeaseInterval time.Duration `yaml:"lease_interval"`
+
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *EtcdConfig) applyDefaults() {
+	if c.Prefix == "" {
+		c.Prefix = "/kraken/peerstore"
+	}
+	if c.TTL == 0 {
+		c.TTL = time.Hour
+	}
+	if c.LeaseInterval == 0 {
+		c.LeaseInterval = time.Minute
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+}
+
+// GossipConfig defines GossipStore configuration.
+type GossipConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Cluster lists the gossip addrs of all tracker instances, including the
+	// local instance.
+	Cluster hostlist.Config `yaml:"cluster"`
+
+	// Listener is the address gossip is served on.
+	Listener listener.Config `yaml:"listener"`
+
+	// AdvertiseAddr is the addr of the local instance within Cluster. If
+	// empty, the member of Cluster which resolves to the local machine is
+	// used.
+	AdvertiseAddr string `yaml:"advertise_addr"`
+
+	// Replicas is the number of instances each torrent is replicated to.
+	Replicas int `yaml:"replicas"`
+
+	// TTL is the duration peers are retained after their last announce.
+	TTL time.Duration `yaml:"ttl"`
+
+	// GossipInterval is the interval at which updates are pushed to other
+	// instances.
+	GossipInterval time.Duration `yaml:"gossip_interval"`
+
+	// AntiEntropyInterval is the interval at which instances compare and
+	// repair the torrents they both own.
+	AntiEntropyInterval time.Duration `yaml:"anti_entropy_interval"`
+
+	// MaxBatchSize limits the number of torrents pushed per request.
+	MaxBatchSize int `yaml:"max_batch_size"`
+
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *GossipConfig) applyDefaults() {
+	if c.Listener.Net == "" {
+		c.Listener.Net = "tcp"
+	}
+	if c.Replicas == 0 {
+		c.Replicas = 3
+	}
+	if c.TTL == 0 {
+		c.TTL = time.Hour
+	}
+	if c.GossipInterval == 0 {
+		c.GossipInterval = 500 * time.Millisecond
+	}
+	if c.AntiEntropyInterval == 0 {
+		c.AntiEntropyInterval = 30 * time.Second
+	}
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = 1000
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+}
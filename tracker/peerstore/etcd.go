@@ -0,0 +1,268 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// EtcdStore is a Store backed by etcd. Peers are written under
+// "<prefix>/<infohash>/<peer id>" and attached to a lease, so etcd expires
+// peers which stop announcing. Talks to etcd through its v3 JSON gateway.
+type EtcdStore struct {
+	config    EtcdConfig
+	clk       clock.Clock
+	transport http.RoundTripper
+
+	mu       sync.Mutex // Protects endpoint.
+	endpoint int        // Index of the endpoint which last succeeded.
+
+	leaseMu   sync.Mutex // Protects the following fields:
+	lease     int64
+	leaseTime time.Time
+}
+
+// NewEtcdStore creates a new EtcdStore.
+func NewEtcdStore(config EtcdConfig, clk clock.Clock) (*EtcdStore, error) {
+	config.applyDefaults()
+
+	if len(config.Endpoints) == 0 {
+		return nil, errors.New("invalid config: missing endpoints")
+	}
+	var transport http.RoundTripper
+	for _, e := range config.Endpoints {
+		if strings.HasPrefix(e, "https://") {
+			tls, err := config.TLS.BuildClient()
+			if err != nil {
+				return nil, fmt.Errorf("build tls config: %s", err)
+			}
+			if tls != nil {
+				transport = &http.Transport{TLSClientConfig: tls}
+			}
+			break
+		}
+	}
+	s := &EtcdStore{
+		config:    config,
+		clk:       clk,
+		transport: transport,
+	}
+
+	// Ensure we can connect to etcd.
+	if err := s.call("/v3/maintenance/status", struct{}{}, nil); err != nil {
+		return nil, fmt.Errorf("etcd status: %s", err)
+	}
+	return s, nil
+}
+
+// Close implements Store.
+func (s *EtcdStore) Close() {}
+
+func (s *EtcdStore) peerPrefix(h core.InfoHash) string {
+	return fmt.Sprintf("%s/%s/", s.config.Prefix, h.Hex())
+}
+
+// prefixRangeEnd returns the end of the key range of all keys with prefix.
+func prefixRangeEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// All keys.
+	return []byte{0}
+}
+
+type etcdPutRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,string"`
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end"`
+}
+
+type etcdRangeResponse struct {
+	KVs []struct {
+		Value []byte `json:"value"`
+	} `json:"kvs"`
+}
+
+type etcdLeaseGrantRequest struct {
+	TTL int64 `json:"TTL,string"`
+}
+
+type etcdLeaseGrantResponse struct {
+	ID int64 `json:"ID,string"`
+}
+
+// call posts req to path of the etcd gateway and decodes the response into
+// resp, if non-nil. Endpoints are tried in order, starting with the endpoint
+// which last succeeded, until one is reachable.
+func (s *EtcdStore) call(path string, req, resp interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	s.mu.Lock()
+	start := s.endpoint
+	s.mu.Unlock()
+
+	n := len(s.config.Endpoints)
+	for i := 0; i < n; i++ {
+		e := (start + i) % n
+		r, err := httputil.Post(
+			strings.TrimSuffix(s.config.Endpoints[e], "/")+path,
+			httputil.SendBody(bytes.NewReader(b)),
+			httputil.SendTimeout(s.config.Timeout),
+			httputil.SendTransport(s.transport))
+		if err != nil {
+			if httputil.IsNetworkError(err) && i < n-1 {
+				log.Infof("Etcd endpoint %s unreachable, failing over: %s", s.config.Endpoints[e], err)
+				continue
+			}
+			return err
+		}
+		defer r.Body.Close()
+
+		s.mu.Lock()
+		s.endpoint = e
+		s.mu.Unlock()
+
+		if resp == nil {
+			return nil
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("read body: %s", err)
+		}
+		if err := json.Unmarshal(body, resp); err != nil {
+			return fmt.Errorf("json: %s", err)
+		}
+		return nil
+	}
+	return errors.New("no endpoints")
+}
+
+// currentLease returns the lease peers are attached to, granting a new lease
+// once the current lease is older than the lease interval. The TTL of leases
+// covers the lease interval, so peers are retained at least TTL after they
+// announce.
+func (s *EtcdStore) currentLease() (int64, error) {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	now := s.clk.Now()
+	if s.lease != 0 && now.Sub(s.leaseTime) < s.config.LeaseInterval {
+		return s.lease, nil
+	}
+	ttl := int64(math.Ceil((s.config.TTL + s.config.LeaseInterval).Seconds()))
+	var resp etcdLeaseGrantResponse
+	if err := s.call("/v3/lease/grant", etcdLeaseGrantRequest{ttl}, &resp); err != nil {
+		return 0, fmt.Errorf("grant lease: %s", err)
+	}
+	s.lease, s.leaseTime = resp.ID, now
+	return s.lease, nil
+}
+
+// resetLease forces a new lease to be granted, unless lease was already
+// replaced.
+func (s *EtcdStore) resetLease(lease int64) {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	if s.lease == lease {
+		s.lease = 0
+	}
+}
+
+func isLeaseNotFound(err error) bool {
+	serr, ok := err.(httputil.StatusError)
+	return ok && strings.Contains(serr.ResponseDump, "lease not found")
+}
+
+// UpdatePeer writes p to etcd, attached to the current lease.
+func (s *EtcdStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	req := etcdPutRequest{
+		Key:   []byte(s.peerPrefix(h) + p.PeerID.String()),
+		Value: []byte(serializePeer(p)),
+	}
+	// Retry once if the lease expired or was revoked, e.g. after etcd was
+	// restored from a snapshot.
+	for i := 0; ; i++ {
+		lease, err := s.currentLease()
+		if err != nil {
+			return err
+		}
+		req.Lease = lease
+		err = s.call("/v3/kv/put", req, nil)
+		if err == nil {
+			return nil
+		}
+		if i == 0 && isLeaseNotFound(err) {
+			s.resetLease(lease)
+			continue
+		}
+		return fmt.Errorf("put: %s", err)
+	}
+}
+
+// GetPeers returns at most n random peers announcing for h.
+func (s *EtcdStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+	prefix := s.peerPrefix(h)
+	req := etcdRangeRequest{
+		Key:      []byte(prefix),
+		RangeEnd: prefixRangeEnd(prefix),
+	}
+	var resp etcdRangeResponse
+	if err := s.call("/v3/kv/range", req, &resp); err != nil {
+		return nil, fmt.Errorf("range: %s", err)
+	}
+	var peers []*core.PeerInfo
+	for _, i := range rand.Perm(len(resp.KVs)) {
+		if len(peers) == n {
+			break
+		}
+		v := string(resp.KVs[i].Value)
+		id, complete, err := deserializePeer(v)
+		if err != nil {
+			log.Errorf("Error deserializing peer %q: %s", v, err)
+			continue
+		}
+		p := core.NewPeerInfo(id.peerID, id.ip, id.port, false, complete)
+		p.AltIP = id.altIP
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEtcd implements the parts of the etcd v3 JSON gateway used by EtcdStore.
+// Leases expire according to clk.
+type fakeEtcd struct {
+	clk clock.Clock
+
+	mu        sync.Mutex
+	kvs       map[string]fakeEtcdValue
+	leases    map[int64]time.Time // Expiry of each lease.
+	numGrants int
+}
+
+type fakeEtcdValue struct {
+	value []byte
+	lease int64
+}
+
+func newFakeEtcd(clk clock.Clock) *fakeEtcd {
+	return &fakeEtcd{
+		clk:    clk,
+		kvs:    make(map[string]fakeEtcdValue),
+		leases: make(map[int64]time.Time),
+	}
+}
+
+// expireLocked deletes expired leases and their keys.
+func (e *fakeEtcd) expireLocked() {
+	for id, expiry := range e.leases {
+		if !e.clk.Now().Before(expiry) {
+			delete(e.leases, id)
+		}
+	}
+	for k, v := range e.kvs {
+		if _, ok := e.leases[v.lease]; !ok {
+			delete(e.kvs, k)
+		}
+	}
+}
+
+func (e *fakeEtcd) revokeAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leases = make(map[int64]time.Time)
+}
+
+func (e *fakeEtcd) grants() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.numGrants
+}
+
+func (e *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.expireLocked()
+
+	var resp interface{} = struct{}{}
+	switch r.URL.Path {
+	case "/v3/maintenance/status":
+	case "/v3/lease/grant":
+		var req etcdLeaseGrantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.numGrants++
+		id := int64(e.numGrants)
+		e.leases[id] = e.clk.Now().Add(time.Duration(req.TTL) * time.Second)
+		resp = etcdLeaseGrantResponse{id}
+	case "/v3/kv/put":
+		var req etcdPutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := e.leases[req.Lease]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"etcdserver: requested lease not found","code":5}`))
+			return
+		}
+		e.kvs[string(req.Key)] = fakeEtcdValue{req.Value, req.Lease}
+	case "/v3/kv/range":
+		var req etcdRangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var rangeResp etcdRangeResponse
+		for k, v := range e.kvs {
+			if k >= string(req.Key) && k < string(req.RangeEnd) {
+				rangeResp.KVs = append(rangeResp.KVs, struct {
+					Value []byte `json:"value"`
+				}{v.value})
+			}
+		}
+		resp = rangeResp
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func etcdStoreFixture(t *testing.T, clk clock.Clock) (*EtcdStore, *fakeEtcd) {
+	e := newFakeEtcd(clk)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	s, err := NewEtcdStore(EtcdConfig{
+		Endpoints:     []string{server.URL},
+		TTL:           time.Minute,
+		LeaseInterval: 10 * time.Second,
+	}, clk)
+	require.NoError(t, err)
+	return s, e
+}
+
+func TestEtcdStoreGetPeersPopulatesPeerInfoFields(t *testing.T) {
+	require := require.New(t)
+
+	s, _ := etcdStoreFixture(t, clock.NewMock())
+
+	h := core.InfoHashFixture()
+
+	p := core.PeerInfoFixture()
+	p.Complete = true
+	p.AltIP = "fd00::1"
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestEtcdStoreGetPeersLimit(t *testing.T) {
+	require := require.New(t)
+
+	s, _ := etcdStoreFixture(t, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	for i := 0; i < 10; i++ {
+		require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	}
+	// Peers of other torrents are not returned.
+	require.NoError(s.UpdatePeer(core.InfoHashFixture(), core.PeerInfoFixture()))
+
+	for _, n := range []int{0, 3, 10, 20} {
+		peers, err := s.GetPeers(h, n)
+		require.NoError(err)
+		if n > 10 {
+			require.Len(peers, 10)
+		} else {
+			require.Len(peers, n)
+		}
+	}
+}
+
+func TestEtcdStoreUpdatesPeer(t *testing.T) {
+	require := require.New(t)
+
+	s, _ := etcdStoreFixture(t, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p))
+	p.Complete = true
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestEtcdStoreSharesLeasesWithinInterval(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s, e := etcdStoreFixture(t, clk)
+
+	h := core.InfoHashFixture()
+	for i := 0; i < 5; i++ {
+		require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	}
+	require.Equal(1, e.grants())
+
+	clk.Add(10 * time.Second)
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	require.Equal(2, e.grants())
+}
+
+func TestEtcdStorePeerExpiration(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s, _ := etcdStoreFixture(t, clk)
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p1))
+	require.NoError(s.UpdatePeer(h, p2))
+
+	clk.Add(time.Minute)
+
+	// Re-announcing moves p2 to a new lease.
+	require.NoError(s.UpdatePeer(h, p2))
+
+	// Peers are retained at least TTL after they announce.
+	peers, err := s.GetPeers(h, 10)
+	require.NoError(err)
+	require.Len(peers, 2)
+
+	clk.Add(10 * time.Second)
+
+	peers, err = s.GetPeers(h, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p2}, peers)
+}
+
+func TestEtcdStoreRegrantsRevokedLease(t *testing.T) {
+	require := require.New(t)
+
+	s, e := etcdStoreFixture(t, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p))
+	e.revokeAll()
+	require.NoError(s.UpdatePeer(h, p))
+	require.Equal(2, e.grants())
+
+	peers, err := s.GetPeers(h, 10)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestEtcdStoreFailsOverEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	server := httptest.NewServer(newFakeEtcd(clock.NewMock()))
+	defer server.Close()
+
+	s, err := NewEtcdStore(EtcdConfig{
+		Endpoints: []string{unreachable.URL, server.URL},
+	}, clock.NewMock())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestNewEtcdStoreErrors(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewEtcdStore(EtcdConfig{}, clock.New())
+	require.Error(err)
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	_, err = NewEtcdStore(EtcdConfig{Endpoints: []string{unreachable.URL}}, clock.New())
+	require.Error(err)
+}
+
+func TestPrefixRangeEnd(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal([]byte("/kraken/peerstore/abd"), prefixRangeEnd("/kraken/peerstore/abc"))
+	require.Equal([]byte("b"), prefixRangeEnd("a\xff"))
+	require.Equal([]byte{0}, prefixRangeEnd("\xff"))
+}
@@ -0,0 +1,568 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/hrw"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/go-chi/chi"
+)
+
+// gossipPeer is a peer replicated between trackers. Replicas of the same peer
+// are resolved by keeping the latest version, i.e. the greatest UpdatedAt.
+type gossipPeer struct {
+	PeerID    string `json:"peer_id"`
+	IP        string `json:"ip"`
+	Port      int    `json:"port"`
+	AltIP     string `json:"alt_ip,omitempty"`
+	Complete  bool   `json:"complete"`
+	UpdatedAt int64  `json:"updated_at"` // Unix nanoseconds.
+}
+
+// gossipEntry is the peer set of a torrent, or updates to it.
+type gossipEntry struct {
+	InfoHash string       `json:"info_hash"`
+	Peers    []gossipPeer `json:"peers"`
+}
+
+// gossipSyncRequest carries a checksum of each peer set owned by both the
+// sender and receiver, keyed by infohash.
+type gossipSyncRequest struct {
+	From      string            `json:"from"`
+	Checksums map[string]uint64 `json:"checksums"`
+}
+
+// gossipSyncResponse carries the peer sets of the receiver which differ from
+// the sender, and the infohashes the receiver wants the peer sets of.
+type gossipSyncResponse struct {
+	Entries []gossipEntry `json:"entries"`
+	Want    []string      `json:"want"`
+}
+
+// GossipStore is a Store which keeps peers in memory and replicates them
+// between tracker instances. Each torrent is owned by a few instances selected
+// by rendezvous hashing on its infohash. Updates are pushed to the other owners
+// of the torrent in batches, and owners periodically compare peer sets to
+// repair updates lost to failures or membership changes.
+type GossipStore struct {
+	config  GossipConfig
+	clk     clock.Clock
+	self    string
+	members hostlist.List
+
+	server   *http.Server
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex // Protects the following fields:
+	torrents map[core.InfoHash]map[string]gossipPeer
+	outbox   map[string]map[core.InfoHash]map[string]gossipPeer // By addr.
+	addrs    stringset.Set
+	hash     *hrw.RendezvousHash
+}
+
+// NewGossipStore creates a new GossipStore and starts serving gossip.
+func NewGossipStore(config GossipConfig, clk clock.Clock) (*GossipStore, error) {
+	config.applyDefaults()
+
+	if config.Listener.Addr == "" {
+		return nil, errors.New("invalid config: missing listener addr")
+	}
+	members, err := hostlist.New(config.Cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: %s", err)
+	}
+	self := config.AdvertiseAddr
+	if self == "" {
+		self, err = resolveLocalAddr(config.Listener.Addr, members)
+		if err != nil {
+			return nil, fmt.Errorf("resolve local addr: %s", err)
+		}
+	}
+	l, err := net.Listen(config.Listener.Net, config.Listener.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %s", err)
+	}
+	s := newGossipStore(config, clk, self, members)
+	s.serve(l)
+	return s, nil
+}
+
+// resolveLocalAddr returns the member of the cluster which is the local
+// machine.
+func resolveLocalAddr(listenAddr string, members hostlist.List) (string, error) {
+	_, portStr, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", fmt.Errorf("listener addr: %s", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", fmt.Errorf("listener port: %s", err)
+	}
+	remote, err := hostlist.StripLocal(members, port)
+	if err != nil {
+		return "", err
+	}
+	local := members.Resolve().Sub(remote.Resolve())
+	if len(local) != 1 {
+		return "", fmt.Errorf(
+			"expected exactly one local member, found %d: set advertise_addr", len(local))
+	}
+	return local.ToSlice()[0], nil
+}
+
+func newGossipStore(
+	config GossipConfig, clk clock.Clock, self string, members hostlist.List) *GossipStore {
+
+	return &GossipStore{
+		config:   config,
+		clk:      clk,
+		self:     self,
+		members:  members,
+		stop:     make(chan struct{}),
+		torrents: make(map[core.InfoHash]map[string]gossipPeer),
+		outbox:   make(map[string]map[core.InfoHash]map[string]gossipPeer),
+	}
+}
+
+// serve serves gossip on l and starts the gossip loops.
+func (s *GossipStore) serve(l net.Listener) {
+	r := chi.NewRouter()
+	r.Post("/gossip/push", handler.Wrap(s.pushHandler))
+	r.Post("/gossip/sync", handler.Wrap(s.syncHandler))
+	s.server = &http.Server{Handler: r}
+
+	log.Infof("Starting gossip peer store on %s as %s", l.Addr(), s.self)
+	go func() {
+		if err := s.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Error serving gossip: %s", err)
+		}
+	}()
+
+	s.refreshMembers()
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// Close implements Store.
+func (s *GossipStore) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		if s.server != nil {
+			s.server.Close()
+		}
+		s.wg.Wait()
+	})
+}
+
+func (s *GossipStore) loop() {
+	defer s.wg.Done()
+
+	gossip := s.clk.Ticker(s.config.GossipInterval)
+	defer gossip.Stop()
+	antiEntropy := s.clk.Ticker(s.config.AntiEntropyInterval)
+	defer antiEntropy.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-gossip.C:
+			s.refreshMembers()
+			s.expire()
+			s.flush()
+		case <-antiEntropy.C:
+			s.antiEntropy()
+		}
+	}
+}
+
+// refreshMembers rebuilds the hash of members if membership changed. The local
+// instance is always a member.
+func (s *GossipStore) refreshMembers() {
+	addrs := s.members.Resolve()
+	addrs.Add(s.self)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hash != nil && stringset.Equal(s.addrs, addrs) {
+		return
+	}
+	hash := hrw.NewRendezvousHash(hrw.Murmur3Hash, hrw.UInt64ToFloat64)
+	for addr := range addrs {
+		hash.AddNode(addr, 100)
+	}
+	s.addrs, s.hash = addrs, hash
+}
+
+// ownersLocked returns the instances which own the torrent of h.
+func (s *GossipStore) ownersLocked(h core.InfoHash) []string {
+	nodes := s.hash.GetOrderedNodes(h.Hex(), s.config.Replicas)
+	owners := make([]string, len(nodes))
+	for i, n := range nodes {
+		owners[i] = n.Label
+	}
+	return owners
+}
+
+func (s *GossipStore) ownsLocked(h core.InfoHash, addr string) bool {
+	for _, o := range s.ownersLocked(h) {
+		if o == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *GossipStore) expired(p gossipPeer) bool {
+	return s.clk.Now().Sub(time.Unix(0, p.UpdatedAt)) >= s.config.TTL
+}
+
+// mergeLocked merges p into the peer set of h. Returns whether p is newer than
+// the current version of the peer.
+func (s *GossipStore) mergeLocked(h core.InfoHash, p gossipPeer) bool {
+	if s.expired(p) {
+		return false
+	}
+	peers, ok := s.torrents[h]
+	if !ok {
+		peers = make(map[string]gossipPeer)
+		s.torrents[h] = peers
+	}
+	if cur, ok := peers[p.PeerID]; ok && cur.UpdatedAt >= p.UpdatedAt {
+		return false
+	}
+	peers[p.PeerID] = p
+	return true
+}
+
+// UpdatePeer implements Store.
+func (s *GossipStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+	gp := gossipPeer{
+		PeerID:    p.PeerID.String(),
+		IP:        p.IP,
+		Port:      p.Port,
+		AltIP:     p.AltIP,
+		Complete:  p.Complete,
+		UpdatedAt: s.clk.Now().UnixNano(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.mergeLocked(h, gp) {
+		return nil
+	}
+	for _, addr := range s.ownersLocked(h) {
+		if addr == s.self {
+			continue
+		}
+		torrents, ok := s.outbox[addr]
+		if !ok {
+			torrents = make(map[core.InfoHash]map[string]gossipPeer)
+			s.outbox[addr] = torrents
+		}
+		peers, ok := torrents[h]
+		if !ok {
+			peers = make(map[string]gossipPeer)
+			torrents[h] = peers
+		}
+		peers[gp.PeerID] = gp
+	}
+	return nil
+}
+
+// GetPeers implements Store.
+func (s *GossipStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var peers []*core.PeerInfo
+	for _, p := range s.torrents[h] {
+		if len(peers) == n {
+			break
+		}
+		if s.expired(p) {
+			continue
+		}
+		peerID, err := core.NewPeerID(p.PeerID)
+		if err != nil {
+			log.Errorf("Error parsing gossiped peer id %q: %s", p.PeerID, err)
+			continue
+		}
+		info := core.NewPeerInfo(peerID, p.IP, p.Port, false, p.Complete)
+		info.AltIP = p.AltIP
+		peers = append(peers, info)
+	}
+	// Map iteration is not uniformly random, so shuffle the selection.
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	return peers, nil
+}
+
+// expire deletes expired peers.
+func (s *GossipStore) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for h, peers := range s.torrents {
+		for id, p := range peers {
+			if s.expired(p) {
+				delete(peers, id)
+			}
+		}
+		if len(peers) == 0 {
+			delete(s.torrents, h)
+		}
+	}
+}
+
+func toEntries(torrents map[core.InfoHash]map[string]gossipPeer) []gossipEntry {
+	entries := make([]gossipEntry, 0, len(torrents))
+	for h, peers := range torrents {
+		e := gossipEntry{InfoHash: h.Hex()}
+		for _, p := range peers {
+			e.Peers = append(e.Peers, p)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// flush pushes queued updates to other owners. Updates which fail to push are
+// dropped, since anti-entropy repairs them.
+func (s *GossipStore) flush() {
+	s.mu.Lock()
+	outbox := s.outbox
+	s.outbox = make(map[string]map[core.InfoHash]map[string]gossipPeer)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for addr, torrents := range outbox {
+		wg.Add(1)
+		go func(addr string, entries []gossipEntry) {
+			defer wg.Done()
+			if err := s.push(addr, entries); err != nil {
+				log.Infof("Error pushing gossip to %s: %s", addr, err)
+			}
+		}(addr, toEntries(torrents))
+	}
+	wg.Wait()
+}
+
+// push sends entries to addr in batches.
+func (s *GossipStore) push(addr string, entries []gossipEntry) error {
+	for len(entries) > 0 {
+		n := s.config.MaxBatchSize
+		if n > len(entries) {
+			n = len(entries)
+		}
+		if err := s.post(addr, "/gossip/push", entries[:n], nil); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+func (s *GossipStore) post(addr, path string, req, resp interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	r, err := httputil.Post(
+		fmt.Sprintf("http://%s%s", addr, path),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendTimeout(s.config.Timeout))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if resp != nil {
+		if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+			return fmt.Errorf("decode response: %s", err)
+		}
+	}
+	return nil
+}
+
+// mergeEntries merges gossiped entries into the local store.
+func (s *GossipStore) mergeEntries(entries []gossipEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range entries {
+		h, err := core.NewInfoHashFromHex(e.InfoHash)
+		if err != nil {
+			return fmt.Errorf("parse infohash: %s", err)
+		}
+		for _, p := range e.Peers {
+			s.mergeLocked(h, p)
+		}
+	}
+	return nil
+}
+
+func (s *GossipStore) pushHandler(w http.ResponseWriter, r *http.Request) error {
+	var entries []gossipEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		return handler.Errorf("json: %s", err).Status(http.StatusBadRequest)
+	}
+	if err := s.mergeEntries(entries); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+	}
+	return nil
+}
+
+// checksumLocked returns an order-independent checksum of the unexpired
+// versions of peers.
+func (s *GossipStore) checksumLocked(peers map[string]gossipPeer) uint64 {
+	var sum uint64
+	for _, p := range peers {
+		if s.expired(p) {
+			continue
+		}
+		f := fnv.New64a()
+		fmt.Fprintf(f, "%s:%d", p.PeerID, p.UpdatedAt)
+		sum ^= f.Sum64()
+	}
+	return sum
+}
+
+// sharedTorrentsLocked returns the torrents owned by both the local instance
+// and addr.
+func (s *GossipStore) sharedTorrentsLocked(addr string) []core.InfoHash {
+	var hs []core.InfoHash
+	for h := range s.torrents {
+		if s.ownsLocked(h, s.self) && s.ownsLocked(h, addr) {
+			hs = append(hs, h)
+		}
+	}
+	return hs
+}
+
+func (s *GossipStore) syncHandler(w http.ResponseWriter, r *http.Request) error {
+	var req gossipSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("json: %s", err).Status(http.StatusBadRequest)
+	}
+	var resp gossipSyncResponse
+
+	s.mu.Lock()
+	differ := make(map[core.InfoHash]map[string]gossipPeer)
+	for hex, sum := range req.Checksums {
+		h, err := core.NewInfoHashFromHex(hex)
+		if err != nil {
+			s.mu.Unlock()
+			return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+		}
+		peers := s.torrents[h]
+		if s.checksumLocked(peers) == sum {
+			continue
+		}
+		resp.Want = append(resp.Want, hex)
+		if len(peers) > 0 {
+			differ[h] = peers
+		}
+	}
+	// Torrents the sender has no peers for.
+	for _, h := range s.sharedTorrentsLocked(req.From) {
+		if _, ok := req.Checksums[h.Hex()]; !ok {
+			differ[h] = s.torrents[h]
+		}
+	}
+	resp.Entries = toEntries(differ)
+	s.mu.Unlock()
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	return nil
+}
+
+// antiEntropy compares the torrents owned by both the local instance and each
+// other member, and exchanges the peer sets which differ.
+func (s *GossipStore) antiEntropy() {
+	s.mu.Lock()
+	var remotes []string
+	for addr := range s.addrs {
+		if addr != s.self {
+			remotes = append(remotes, addr)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, addr := range remotes {
+		if err := s.sync(addr); err != nil {
+			log.Infof("Error syncing gossip with %s: %s", addr, err)
+		}
+	}
+}
+
+func (s *GossipStore) sync(addr string) error {
+	req := gossipSyncRequest{From: s.self, Checksums: make(map[string]uint64)}
+	s.mu.Lock()
+	for _, h := range s.sharedTorrentsLocked(addr) {
+		req.Checksums[h.Hex()] = s.checksumLocked(s.torrents[h])
+	}
+	s.mu.Unlock()
+
+	var resp gossipSyncResponse
+	if err := s.post(addr, "/gossip/sync", req, &resp); err != nil {
+		return fmt.Errorf("sync: %s", err)
+	}
+	if err := s.mergeEntries(resp.Entries); err != nil {
+		return fmt.Errorf("merge: %s", err)
+	}
+	want := make(map[core.InfoHash]map[string]gossipPeer)
+	s.mu.Lock()
+	for _, hex := range resp.Want {
+		h, err := core.NewInfoHashFromHex(hex)
+		if err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("parse infohash: %s", err)
+		}
+		if peers, ok := s.torrents[h]; ok {
+			want[h] = peers
+		}
+	}
+	entries := toEntries(want)
+	s.mu.Unlock()
+
+	if err := s.push(addr, entries); err != nil {
+		return fmt.Errorf("push: %s", err)
+	}
+	return nil
+}
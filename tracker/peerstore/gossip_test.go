@@ -0,0 +1,218 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hostlist"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// gossipClusterFixture starts n GossipStores which gossip with each other.
+// Gossip is driven manually by tests.
+func gossipClusterFixture(t *testing.T, n, replicas int, clk clock.Clock) []*GossipStore {
+	var listeners []net.Listener
+	var addrs []string
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listeners = append(listeners, l)
+		addrs = append(addrs, l.Addr().String())
+	}
+	config := GossipConfig{
+		Replicas: replicas,
+		TTL:      time.Minute,
+		// Disable background gossip, which tests drive manually.
+		GossipInterval:      time.Hour,
+		AntiEntropyInterval: time.Hour,
+	}
+	config.applyDefaults()
+
+	var stores []*GossipStore
+	for i, l := range listeners {
+		s := newGossipStore(config, clk, addrs[i], hostlist.Fixture(addrs...))
+		s.serve(l)
+		t.Cleanup(s.Close)
+		stores = append(stores, s)
+	}
+	return stores
+}
+
+func requirePeers(t *testing.T, s *GossipStore, h core.InfoHash, expected ...*core.PeerInfo) {
+	peers, err := s.GetPeers(h, len(expected)+1)
+	require.NoError(t, err)
+	require.ElementsMatch(t, expected, peers)
+}
+
+func TestGossipStoreReplicatesUpdates(t *testing.T) {
+	stores := gossipClusterFixture(t, 3, 3, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	p.AltIP = "fd00::1"
+
+	require.NoError(t, stores[0].UpdatePeer(h, p))
+	stores[0].flush()
+
+	for _, s := range stores {
+		requirePeers(t, s, h, p)
+	}
+}
+
+func TestGossipStoreReplicatesOnlyToOwners(t *testing.T) {
+	require := require.New(t)
+
+	stores := gossipClusterFixture(t, 4, 2, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	stores[0].mu.Lock()
+	owners := stores[0].ownersLocked(h)
+	stores[0].mu.Unlock()
+	require.Len(owners, 2)
+
+	require.NoError(stores[0].UpdatePeer(h, p))
+	stores[0].flush()
+
+	for _, s := range stores {
+		var owner bool
+		for _, o := range owners {
+			owner = owner || o == s.self
+		}
+		if owner || s == stores[0] {
+			requirePeers(t, s, h, p)
+		} else {
+			requirePeers(t, s, h)
+		}
+	}
+}
+
+func TestGossipStoreLatestVersionWins(t *testing.T) {
+	clk := clock.NewMock()
+	stores := gossipClusterFixture(t, 2, 2, clk)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(t, stores[0].UpdatePeer(h, p))
+
+	clk.Add(time.Second)
+
+	completed := *p
+	completed.Complete = true
+	require.NoError(t, stores[1].UpdatePeer(h, &completed))
+
+	stores[1].flush()
+	stores[0].flush()
+
+	for _, s := range stores {
+		requirePeers(t, s, h, &completed)
+	}
+}
+
+func TestGossipStoreAntiEntropyRepairsLostUpdates(t *testing.T) {
+	stores := gossipClusterFixture(t, 2, 2, clock.NewMock())
+
+	h1 := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	require.NoError(t, stores[0].UpdatePeer(h1, p1))
+
+	h2 := core.InfoHashFixture()
+	p2 := core.PeerInfoFixture()
+	require.NoError(t, stores[1].UpdatePeer(h2, p2))
+
+	// Both peer sets differ on the same torrent.
+	p3 := core.PeerInfoFixture()
+	p4 := core.PeerInfoFixture()
+	require.NoError(t, stores[0].UpdatePeer(h2, p3))
+	require.NoError(t, stores[1].UpdatePeer(h1, p4))
+
+	// Drop all pushes.
+	for _, s := range stores {
+		s.mu.Lock()
+		s.outbox = make(map[string]map[core.InfoHash]map[string]gossipPeer)
+		s.mu.Unlock()
+	}
+
+	stores[0].antiEntropy()
+
+	for _, s := range stores {
+		requirePeers(t, s, h1, p1, p4)
+		requirePeers(t, s, h2, p2, p3)
+	}
+}
+
+func TestGossipStorePeerExpiration(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	stores := gossipClusterFixture(t, 2, 2, clk)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(stores[0].UpdatePeer(h, p))
+	stores[0].flush()
+
+	clk.Add(time.Minute)
+
+	for _, s := range stores {
+		requirePeers(t, s, h)
+
+		s.expire()
+		s.mu.Lock()
+		require.Empty(s.torrents)
+		s.mu.Unlock()
+	}
+
+	// Expired peers are not resurrected by gossip.
+	require.NoError(stores[1].mergeEntries([]gossipEntry{{
+		InfoHash: h.Hex(),
+		Peers:    []gossipPeer{{PeerID: p.PeerID.String(), IP: p.IP, Port: p.Port}},
+	}}))
+	requirePeers(t, stores[1], h)
+}
+
+func TestGossipStoreGetPeersLimit(t *testing.T) {
+	require := require.New(t)
+
+	stores := gossipClusterFixture(t, 1, 1, clock.NewMock())
+
+	h := core.InfoHashFixture()
+	for i := 0; i < 10; i++ {
+		require.NoError(stores[0].UpdatePeer(h, core.PeerInfoFixture()))
+	}
+	for _, n := range []int{0, 3, 10} {
+		peers, err := stores[0].GetPeers(h, n)
+		require.NoError(err)
+		require.Len(peers, n)
+	}
+}
+
+func TestNewGossipStoreInvalidConfig(t *testing.T) {
+	_, err := NewGossipStore(GossipConfig{
+		Cluster: hostlist.Config{Static: []string{"localhost:7000"}},
+	}, clock.New())
+	require.Error(t, err)
+
+	_, err = NewGossipStore(GossipConfig{}, clock.New())
+	require.Error(t, err)
+}
@@ -57,6 +57,7 @@ type peerEntry struct {
 	id        core.PeerID
 	ip        string
 	port      int
+	altIP     string
 	complete  bool
 	expiresAt time.Time
 }
@@ -110,7 +111,9 @@ func (s *LocalStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 		// Note, we elect to return slightly expired entries rather than iterate
 		// until we find n valid entries.
 		e := g.peerList[i]
-		result = append(result, core.NewPeerInfo(e.id, e.ip, e.port, false /* origin */, e.complete))
+		p := core.NewPeerInfo(e.id, e.ip, e.port, false /* origin */, e.complete)
+		p.AltIP = e.altIP
+		result = append(result, p)
 	}
 	return result, nil
 }
@@ -129,6 +132,7 @@ func (s *LocalStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
 	e.id = p.PeerID
 	e.ip = p.IP
 	e.port = p.Port
+	e.altIP = p.AltIP
 	e.complete = p.Complete
 	e.expiresAt = s.clk.Now().Add(s.config.TTL)
 
@@ -14,13 +14,11 @@
 package peerstore
 
 import (
-	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/uber/kraken/core"
-	"github.com/uber/kraken/utils/closers"
 	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/randutil"
 
@@ -28,47 +26,86 @@ import (
 	"github.com/gomodule/redigo/redis"
 )
 
-func peerSetKey(h core.InfoHash, window int64) string {
-	return fmt.Sprintf("peerset:%s:%d", h.String(), window)
-}
-
+// serializePeer encodes p as "pid:ip:port:complete", with an additional
+// ":altip" suffix for dual-stack peers. IPv6 ips are bracketed.
 func serializePeer(p *core.PeerInfo) string {
 	var completeBit int
 	if p.Complete {
 		completeBit = 1
 	}
-	return fmt.Sprintf("%s:%s:%d:%d", p.PeerID.String(), p.IP, p.Port, completeBit)
+	s := fmt.Sprintf("%s:%s:%d:%d", p.PeerID.String(), bracketIP(p.IP), p.Port, completeBit)
+	if p.AltIP != "" {
+		s += ":" + bracketIP(p.AltIP)
+	}
+	return s
 }
 
 type peerIdentity struct {
 	peerID core.PeerID
 	ip     string
 	port   int
+	altIP  string
 }
 
 func deserializePeer(s string) (id peerIdentity, complete bool, err error) {
-	parts := strings.Split(s, ":")
-	if len(parts) != 4 {
-		return id, false, fmt.Errorf("invalid peer encoding: expected 'pid:ip:port:complete'")
+	parts := splitUnbracketed(s)
+	if len(parts) != 4 && len(parts) != 5 {
+		return id, false, fmt.Errorf("invalid peer encoding: expected 'pid:ip:port:complete[:altip]'")
 	}
 	peerID, err := core.NewPeerID(parts[0])
 	if err != nil {
 		return id, false, fmt.Errorf("parse peer id: %s", err)
 	}
-	ip := parts[1]
+	ip := unbracketIP(parts[1])
 	port, err := strconv.Atoi(parts[2])
 	if err != nil {
 		return id, false, fmt.Errorf("parse port: %s", err)
 	}
-	id = peerIdentity{peerID, ip, port}
+	id = peerIdentity{peerID: peerID, ip: ip, port: port}
 	complete = parts[3] == "1"
+	if len(parts) == 5 {
+		id.altIP = unbracketIP(parts[4])
+	}
 	return id, complete, nil
 }
 
-// RedisStore is a Store backed by Redis.
+func bracketIP(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]"
+	}
+	return ip
+}
+
+func unbracketIP(ip string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+}
+
+// splitUnbracketed splits s on colons which are not within brackets.
+func splitUnbracketed(s string) []string {
+	var parts []string
+	var bracketed bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			bracketed = true
+		case ']':
+			bracketed = false
+		case ':':
+			if !bracketed {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// RedisStore is a Store backed by Redis. Supports single Redis instances,
+// Redis Cluster and Sentinel-monitored masters.
 type RedisStore struct {
 	config RedisConfig
-	pool   *redis.Pool
+	client redisClient
 	clk    clock.Clock
 }
 
@@ -76,42 +113,28 @@ type RedisStore struct {
 func NewRedisStore(config RedisConfig, clk clock.Clock) (*RedisStore, error) {
 	config.applyDefaults()
 
-	if config.Addr == "" {
-		return nil, errors.New("invalid config: missing addr")
-	}
-
-	s := &RedisStore{
-		config: config,
-		pool: &redis.Pool{
-			Dial: func() (redis.Conn, error) {
-				// TODO Add options
-				return redis.Dial(
-					"tcp",
-					config.Addr,
-					redis.DialConnectTimeout(config.DialTimeout),
-					redis.DialReadTimeout(config.ReadTimeout),
-					redis.DialWriteTimeout(config.WriteTimeout))
-			},
-			MaxIdle:     config.MaxIdleConns,
-			MaxActive:   config.MaxActiveConns,
-			IdleTimeout: config.IdleConnTimeout,
-			Wait:        true,
-		},
-		clk: clk,
-	}
-
-	// Ensure we can connect to Redis.
-	c, err := s.pool.Dial()
+	client, err := newRedisClient(config, redisDialer(config))
 	if err != nil {
-		return nil, fmt.Errorf("dial redis: %s", err)
+		return nil, err
 	}
-	closers.Close(c)
-
-	return s, nil
+	return &RedisStore{config, client, clk}, nil
 }
 
 // Close implements Store.
-func (s *RedisStore) Close() {}
+func (s *RedisStore) Close() {
+	s.client.close()
+}
+
+// peerSetKey returns the key of the peer set of h in window. In cluster mode,
+// the infohash is hash-tagged so all windows of h live on the same shard.
+// Single instance keys are not hash-tagged so they remain stable across
+// upgrades.
+func (s *RedisStore) peerSetKey(h core.InfoHash, window int64) string {
+	if s.config.Cluster {
+		return fmt.Sprintf("peerset:{%s}:%d", h.String(), window)
+	}
+	return fmt.Sprintf("peerset:%s:%d", h.String(), window)
+}
 
 func (s *RedisStore) curPeerSetWindow() int64 {
 	t := s.clk.Now().Unix()
@@ -129,38 +152,38 @@ func (s *RedisStore) peerSetWindows() []int64 {
 
 // UpdatePeer writes p to Redis with a TTL.
 func (s *RedisStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
-	c := s.pool.Get()
-	defer closers.Close(c)
-
 	w := s.curPeerSetWindow()
 	expireAt := w + int64(s.config.PeerSetWindowSize.Seconds())*int64(s.config.MaxPeerSetWindows)
 
 	// Add p to the current window.
-	k := peerSetKey(h, w)
+	k := s.peerSetKey(h, w)
 
-	if err := c.Send("SADD", k, serializePeer(p)); err != nil {
-		return fmt.Errorf("send SADD: %s", err)
-	}
-	if err := c.Send("EXPIREAT", k, expireAt); err != nil {
-		return fmt.Errorf("send EXPIREAT: %s", err)
-	}
-	if err := c.Flush(); err != nil {
-		return fmt.Errorf("flush: %s", err)
-	}
-	if _, err := c.Receive(); err != nil {
-		return fmt.Errorf("SADD: %s", err)
-	}
-	if _, err := c.Receive(); err != nil {
-		return fmt.Errorf("EXPIREAT: %s", err)
+	err := s.client.do(k, func(c redis.Conn) error {
+		if err := c.Send("SADD", k, serializePeer(p)); err != nil {
+			return err
+		}
+		if err := c.Send("EXPIREAT", k, expireAt); err != nil {
+			return err
+		}
+		if err := c.Flush(); err != nil {
+			return err
+		}
+		// Drain both replies before returning, so the conn may be reused.
+		_, saddErr := c.Receive()
+		_, expireErr := c.Receive()
+		if saddErr != nil {
+			return saddErr
+		}
+		return expireErr
+	})
+	if err != nil {
+		return fmt.Errorf("update peer set: %s", err)
 	}
 	return nil
 }
 
 // GetPeers returns at most n PeerInfos associated with h.
 func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
-	c := s.pool.Get()
-	defer closers.Close(c)
-
 	// Try to sample n peers from each window in randomized order until we have
 	// collected n distinct peers. This achieves random sampling across multiple
 	// windows.
@@ -174,8 +197,13 @@ func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 	selected := make(map[peerIdentity]bool)
 
 	for i := 0; len(selected) < n && i < len(windows); i++ {
-		k := peerSetKey(h, windows[i])
-		result, err := redis.Strings(c.Do("SRANDMEMBER", k, n-len(selected)))
+		k := s.peerSetKey(h, windows[i])
+		var result []string
+		err := s.client.do(k, func(c redis.Conn) error {
+			var err error
+			result, err = redis.Strings(c.Do("SRANDMEMBER", k, n-len(selected)))
+			return err
+		})
 		if err == redis.ErrNil {
 			continue
 		} else if err != nil {
@@ -194,6 +222,7 @@ func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 	var peers []*core.PeerInfo
 	for id, complete := range selected {
 		p := core.NewPeerInfo(id.peerID, id.ip, id.port, false, complete)
+		p.AltIP = id.altIP
 		peers = append(peers, p)
 	}
 	return peers, nil
@@ -0,0 +1,495 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisClient runs commands against the Redis node which serves a key.
+type redisClient interface {
+	// do runs f with a connection to the node serving key. f may be retried
+	// on another node if the topology of the deployment changed, so f must
+	// return errors of commands as is.
+	do(key string, f func(c redis.Conn) error) error
+
+	close()
+}
+
+type dialFunc func(addr string) (redis.Conn, error)
+
+func newRedisClient(config RedisConfig, dial dialFunc) (redisClient, error) {
+	switch {
+	case config.Cluster:
+		return newClusterClient(config, dial)
+	case config.SentinelMaster != "":
+		return newSentinelClient(config, dial)
+	default:
+		return newSingleClient(config, dial)
+	}
+}
+
+func redisDialer(config RedisConfig) dialFunc {
+	return func(addr string) (redis.Conn, error) {
+		return redis.Dial(
+			"tcp",
+			addr,
+			redis.DialConnectTimeout(config.DialTimeout),
+			redis.DialReadTimeout(config.ReadTimeout),
+			redis.DialWriteTimeout(config.WriteTimeout))
+	}
+}
+
+func newPool(config RedisConfig, dial dialFunc, addr string) *redis.Pool {
+	return &redis.Pool{
+		Dial:        func() (redis.Conn, error) { return dial(addr) },
+		MaxIdle:     config.MaxIdleConns,
+		MaxActive:   config.MaxActiveConns,
+		IdleTimeout: config.IdleConnTimeout,
+		Wait:        true,
+	}
+}
+
+// isConnError returns true if err is caused by a broken connection rather
+// than by a command.
+func isConnError(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// singleClient sends all commands to a single Redis instance.
+type singleClient struct {
+	pool *redis.Pool
+}
+
+func newSingleClient(config RedisConfig, dial dialFunc) (*singleClient, error) {
+	if config.Addr == "" {
+		return nil, errors.New("invalid config: missing addr")
+	}
+	pool := newPool(config, dial, config.Addr)
+
+	// Ensure we can connect to Redis.
+	c, err := pool.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("dial redis: %s", err)
+	}
+	closers.Close(c)
+
+	return &singleClient{pool}, nil
+}
+
+func (c *singleClient) do(key string, f func(c redis.Conn) error) error {
+	conn := c.pool.Get()
+	defer closers.Close(conn)
+
+	return f(conn)
+}
+
+func (c *singleClient) close() {
+	closers.Close(c.pool)
+}
+
+// sentinelClient sends all commands to the master of a Redis deployment
+// monitored by Sentinels. Once the master fails over, i.e. commands fail
+// because the master is unreachable or was demoted to a replica, the new
+// master is resolved through the Sentinels and the command is retried.
+type sentinelClient struct {
+	config RedisConfig
+	dial   dialFunc
+
+	mu     sync.Mutex // Protects the following fields:
+	pool   *redis.Pool
+	master string
+}
+
+func newSentinelClient(config RedisConfig, dial dialFunc) (*sentinelClient, error) {
+	if len(config.Addrs) == 0 {
+		return nil, errors.New("invalid config: missing sentinel addrs")
+	}
+	c := &sentinelClient{config: config, dial: dial}
+	if err := c.reset(nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// resolveMaster returns the address of the current master, according to the
+// first reachable Sentinel.
+func (c *sentinelClient) resolveMaster() (string, error) {
+	var errs []error
+	for _, addr := range c.config.Addrs {
+		conn, err := c.dial(addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dial sentinel %s: %s", addr, err))
+			continue
+		}
+		reply, err := redis.Strings(
+			conn.Do("SENTINEL", "get-master-addr-by-name", c.config.SentinelMaster))
+		closers.Close(conn)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sentinel %s: %s", addr, err))
+			continue
+		}
+		if len(reply) != 2 {
+			errs = append(errs, fmt.Errorf("sentinel %s: unexpected reply %v", addr, reply))
+			continue
+		}
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+	return "", fmt.Errorf("resolve master: %s", errutil.Join(errs))
+}
+
+// reset connects to the current master. No-ops if the pool was already reset
+// since stale was in use, so concurrent failures only reset once.
+func (c *sentinelClient) reset(stale *redis.Pool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pool != stale {
+		return nil
+	}
+	master, err := c.resolveMaster()
+	if err != nil {
+		return err
+	}
+	pool := newPool(c.config, c.dial, master)
+	conn, err := pool.Dial()
+	if err != nil {
+		return fmt.Errorf("dial master %s: %s", master, err)
+	}
+	closers.Close(conn)
+
+	if c.pool != nil {
+		log.Infof("Redis master failed over from %s to %s", c.master, master)
+		closers.Close(c.pool)
+	}
+	c.pool, c.master = pool, master
+	return nil
+}
+
+func (c *sentinelClient) getPool() *redis.Pool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pool
+}
+
+func (c *sentinelClient) do(key string, f func(c redis.Conn) error) error {
+	pool := c.getPool()
+	err := c.run(pool, f)
+	if err == nil || !(isConnError(err) || strings.HasPrefix(err.Error(), "READONLY")) {
+		return err
+	}
+	if err := c.reset(pool); err != nil {
+		return fmt.Errorf("reset master: %s", err)
+	}
+	return c.run(c.getPool(), f)
+}
+
+func (c *sentinelClient) run(pool *redis.Pool, f func(c redis.Conn) error) error {
+	conn := pool.Get()
+	defer closers.Close(conn)
+
+	return f(conn)
+}
+
+func (c *sentinelClient) close() {
+	closers.Close(c.getPool())
+}
+
+const (
+	_numClusterSlots = 16384
+
+	// _maxRedirects bounds the redirects followed by a single command, which
+	// protects against redirect loops while the cluster is resharding.
+	_maxRedirects = 5
+
+	// _minClusterRefreshInterval throttles reloading the slots of the cluster
+	// while nodes are unreachable.
+	_minClusterRefreshInterval = time.Second
+)
+
+// hashSlot returns the cluster slot of key. If key contains a hash tag, i.e. a
+// non-empty substring between the first '{' and the following '}', only the
+// hash tag is hashed, so keys with the same hash tag share a slot.
+func hashSlot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key) % _numClusterSlots)
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// slotRange is a range of cluster slots served by the master at addr.
+type slotRange struct {
+	start, end int
+	addr       string
+}
+
+// parseClusterSlots parses the reply of CLUSTER SLOTS.
+func parseClusterSlots(reply []interface{}) ([]slotRange, error) {
+	var ranges []slotRange
+	for _, r := range reply {
+		fields, err := redis.Values(r, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid slot range: expected at least 3 fields, got %d", len(fields))
+		}
+		start, err := redis.Int(fields[0], nil)
+		if err != nil {
+			return nil, fmt.Errorf("start: %s", err)
+		}
+		end, err := redis.Int(fields[1], nil)
+		if err != nil {
+			return nil, fmt.Errorf("end: %s", err)
+		}
+		master, err := redis.Values(fields[2], nil)
+		if err != nil {
+			return nil, fmt.Errorf("master: %s", err)
+		}
+		if len(master) < 2 {
+			return nil, errors.New("invalid master: expected ip and port")
+		}
+		ip, err := redis.String(master[0], nil)
+		if err != nil {
+			return nil, fmt.Errorf("master ip: %s", err)
+		}
+		port, err := redis.Int(master[1], nil)
+		if err != nil {
+			return nil, fmt.Errorf("master port: %s", err)
+		}
+		if start < 0 || end >= _numClusterSlots || start > end {
+			return nil, fmt.Errorf("invalid slot range [%d, %d]", start, end)
+		}
+		ranges = append(ranges, slotRange{start, end, net.JoinHostPort(ip, strconv.Itoa(port))})
+	}
+	return ranges, nil
+}
+
+// clusterClient sends commands to the masters of a Redis Cluster which serve
+// the slots of their keys, with a connection pool per master. Slots are
+// loaded from the cluster on startup, and MOVED and ASK redirects are followed
+// as the cluster reshards or fails over.
+type clusterClient struct {
+	config RedisConfig
+	dial   dialFunc
+
+	mu          sync.Mutex // Protects the following fields:
+	slots       [_numClusterSlots]string
+	pools       map[string]*redis.Pool
+	lastRefresh time.Time
+}
+
+func newClusterClient(config RedisConfig, dial dialFunc) (*clusterClient, error) {
+	if len(config.Addrs) == 0 {
+		return nil, errors.New("invalid config: missing cluster addrs")
+	}
+	c := &clusterClient{
+		config: config,
+		dial:   dial,
+		pools:  make(map[string]*redis.Pool),
+	}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// refresh reloads the slots of the cluster from the first reachable node,
+// trying known masters before the configured seed nodes.
+func (c *clusterClient) refresh() error {
+	c.mu.Lock()
+	addrs := make([]string, 0, len(c.pools)+len(c.config.Addrs))
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.lastRefresh = time.Now()
+	c.mu.Unlock()
+	addrs = append(addrs, c.config.Addrs...)
+
+	var errs []error
+	for _, addr := range addrs {
+		ranges, err := c.loadSlots(addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load slots from %s: %s", addr, err))
+			continue
+		}
+		c.mu.Lock()
+		for i := range c.slots {
+			c.slots[i] = ""
+		}
+		for _, r := range ranges {
+			for i := r.start; i <= r.end; i++ {
+				c.slots[i] = r.addr
+			}
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("refresh cluster slots: %s", errutil.Join(errs))
+}
+
+func (c *clusterClient) loadSlots(addr string) ([]slotRange, error) {
+	conn, err := c.dial(addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %s", err)
+	}
+	defer closers.Close(conn)
+
+	reply, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterSlots(reply)
+}
+
+// maybeRefresh refreshes slots unless they were refreshed recently.
+func (c *clusterClient) maybeRefresh() {
+	c.mu.Lock()
+	recent := time.Since(c.lastRefresh) < _minClusterRefreshInterval
+	c.mu.Unlock()
+	if recent {
+		return
+	}
+	if err := c.refresh(); err != nil {
+		log.Errorf("Error refreshing redis cluster slots: %s", err)
+	}
+}
+
+// master returns the address of the master serving slot.
+func (c *clusterClient) master(slot int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.slots[slot]
+}
+
+func (c *clusterClient) setMaster(slot int, addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.slots[slot] = addr
+}
+
+func (c *clusterClient) getPool(addr string) *redis.Pool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pools[addr]
+	if !ok {
+		p = newPool(c.config, c.dial, addr)
+		c.pools[addr] = p
+	}
+	return p
+}
+
+// parseRedirect parses MOVED and ASK errors, which redirect the command to
+// the master at addr.
+func parseRedirect(err error) (kind, addr string, ok bool) {
+	e, isRedisErr := err.(redis.Error)
+	if !isRedisErr {
+		return "", "", false
+	}
+	fields := strings.Fields(string(e))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", "", false
+	}
+	return fields[0], fields[2], true
+}
+
+func (c *clusterClient) do(key string, f func(c redis.Conn) error) error {
+	slot := hashSlot(key)
+	addr := c.master(slot)
+	if addr == "" {
+		c.maybeRefresh()
+		if addr = c.master(slot); addr == "" {
+			return fmt.Errorf("no master serves slot %d", slot)
+		}
+	}
+	var asking bool
+	for i := 0; i < _maxRedirects; i++ {
+		err := c.run(addr, asking, f)
+		if err != nil && isConnError(err) {
+			// The master may have failed over.
+			c.maybeRefresh()
+			return err
+		}
+		kind, target, ok := parseRedirect(err)
+		if !ok {
+			return err
+		}
+		if kind == "MOVED" {
+			// The slot was permanently moved to target.
+			c.setMaster(slot, target)
+		}
+		addr, asking = target, kind == "ASK"
+	}
+	return fmt.Errorf("too many redirects for slot %d", slot)
+}
+
+func (c *clusterClient) run(addr string, asking bool, f func(c redis.Conn) error) error {
+	conn := c.getPool(addr).Get()
+	defer closers.Close(conn)
+
+	if asking {
+		if _, err := conn.Do("ASKING"); err != nil {
+			return err
+		}
+	}
+	return f(conn)
+}
+
+func (c *clusterClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range c.pools {
+		closers.Close(p)
+	}
+}
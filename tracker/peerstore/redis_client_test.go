@@ -0,0 +1,396 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/alicebob/miniredis"
+	"github.com/andres-erbsen/clock"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn is a redis.Conn which replies to commands with handler.
+type fakeConn struct {
+	handler func(cmd string, args ...interface{}) (interface{}, error)
+	pending [][]interface{}
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Err() error { return nil }
+
+func (c *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		return nil, nil
+	}
+	return c.handler(cmd, args...)
+}
+
+func (c *fakeConn) Send(cmd string, args ...interface{}) error {
+	c.pending = append(c.pending, append([]interface{}{cmd}, args...))
+	return nil
+}
+
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, io.EOF
+	}
+	cmd := c.pending[0]
+	c.pending = c.pending[1:]
+	return c.handler(cmd[0].(string), cmd[1:]...)
+}
+
+// fakeDialer dials fake conns for addrs with handlers, and real conns for all
+// other addrs.
+func fakeDialer(
+	handlers map[string]func(string, ...interface{}) (interface{}, error)) dialFunc {
+
+	return func(addr string) (redis.Conn, error) {
+		if h, ok := handlers[addr]; ok {
+			return &fakeConn{handler: h}, nil
+		}
+		return redis.Dial("tcp", addr)
+	}
+}
+
+func clusterSlotsReply(start, end int, addr string) []interface{} {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		panic(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		panic(err)
+	}
+	return []interface{}{
+		[]interface{}{int64(start), int64(end), []interface{}{[]byte(host), int64(p)}},
+	}
+}
+
+// clusterSeedHandler is a cluster node which assigns all slots to addr.
+func clusterSeedHandler(addr string) func(string, ...interface{}) (interface{}, error) {
+	return func(cmd string, args ...interface{}) (interface{}, error) {
+		if cmd == "CLUSTER" {
+			return clusterSlotsReply(0, _numClusterSlots-1, addr), nil
+		}
+		return nil, fmt.Errorf("unexpected command %s", cmd)
+	}
+}
+
+func redisConfigFixtureWithAddr(addr string) RedisConfig {
+	c := RedisConfig{
+		Addr:              addr,
+		PeerSetWindowSize: 30 * time.Second,
+		MaxPeerSetWindows: 4,
+	}
+	c.applyDefaults()
+	return c
+}
+
+func TestCRC16(t *testing.T) {
+	require.Equal(t, uint16(0x31C3), crc16("123456789"))
+}
+
+func TestHashSlot(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected int
+	}{
+		{"foo", 12182},
+		{"{foo}:bar", 12182},
+		{"baz:{foo}", 12182},
+		{"{foo}{bar}", 12182},
+		// Empty hash tags hash the whole key.
+		{"{}foo", int(crc16("{}foo") % _numClusterSlots)},
+		{"foo{", int(crc16("foo{") % _numClusterSlots)},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			require.Equal(t, test.expected, hashSlot(test.key))
+		})
+	}
+}
+
+func TestParseClusterSlots(t *testing.T) {
+	require := require.New(t)
+
+	ranges, err := parseClusterSlots(clusterSlotsReply(0, 100, "10.0.0.1:6379"))
+	require.NoError(err)
+	require.Equal([]slotRange{{0, 100, "10.0.0.1:6379"}}, ranges)
+
+	_, err = parseClusterSlots(clusterSlotsReply(100, 0, "10.0.0.1:6379"))
+	require.Error(err)
+
+	_, err = parseClusterSlots([]interface{}{[]interface{}{int64(0)}})
+	require.Error(err)
+}
+
+func TestRedisStoreClusterKeysAreHashTagged(t *testing.T) {
+	require := require.New(t)
+
+	m, err := miniredis.Run()
+	require.NoError(err)
+	defer m.Close()
+
+	config := redisConfigFixtureWithAddr("")
+	config.Cluster = true
+	config.Addrs = []string{"seed:7000"}
+
+	client, err := newClusterClient(config, fakeDialer(
+		map[string]func(string, ...interface{}) (interface{}, error){
+			"seed:7000": clusterSeedHandler(m.Addr()),
+		}))
+	require.NoError(err)
+
+	s := &RedisStore{config, client, clock.New()}
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+
+	for _, w := range s.peerSetWindows() {
+		require.Equal(hashSlot(h.String()), hashSlot(s.peerSetKey(h, w)))
+	}
+	require.True(m.Exists(s.peerSetKey(h, s.curPeerSetWindow())))
+}
+
+func TestClusterClientFollowsMovedRedirect(t *testing.T) {
+	require := require.New(t)
+
+	m, err := miniredis.Run()
+	require.NoError(err)
+	defer m.Close()
+
+	var stale int
+	config := redisConfigFixtureWithAddr("")
+	config.Cluster = true
+	config.Addrs = []string{"seed:7000"}
+
+	client, err := newClusterClient(config, fakeDialer(
+		map[string]func(string, ...interface{}) (interface{}, error){
+			"seed:7000": clusterSeedHandler("10.0.0.1:7001"),
+			"10.0.0.1:7001": func(cmd string, args ...interface{}) (interface{}, error) {
+				stale++
+				return nil, redis.Error(fmt.Sprintf("MOVED %d %s", hashSlot("foo"), m.Addr()))
+			},
+		}))
+	require.NoError(err)
+	defer client.close()
+
+	for i := 0; i < 2; i++ {
+		err := client.do("foo", func(c redis.Conn) error {
+			_, err := c.Do("SET", "foo", "bar")
+			return err
+		})
+		require.NoError(err)
+	}
+
+	// The slot was moved after the first redirect.
+	require.Equal(1, stale)
+	require.Equal(m.Addr(), client.master(hashSlot("foo")))
+	v, err := m.Get("foo")
+	require.NoError(err)
+	require.Equal("bar", v)
+}
+
+func TestClusterClientFollowsAskRedirect(t *testing.T) {
+	require := require.New(t)
+
+	var asked bool
+	var cmds []string
+	config := redisConfigFixtureWithAddr("")
+	config.Cluster = true
+	config.Addrs = []string{"seed:7000"}
+
+	client, err := newClusterClient(config, fakeDialer(
+		map[string]func(string, ...interface{}) (interface{}, error){
+			"seed:7000": clusterSeedHandler("10.0.0.1:7001"),
+			"10.0.0.1:7001": func(cmd string, args ...interface{}) (interface{}, error) {
+				return nil, redis.Error(fmt.Sprintf("ASK %d 10.0.0.2:7002", hashSlot("foo")))
+			},
+			"10.0.0.2:7002": func(cmd string, args ...interface{}) (interface{}, error) {
+				cmds = append(cmds, cmd)
+				if cmd == "ASKING" {
+					asked = true
+					return "OK", nil
+				}
+				if !asked {
+					return nil, redis.Error(fmt.Sprintf("MOVED %d 10.0.0.1:7001", hashSlot("foo")))
+				}
+				return "OK", nil
+			},
+		}))
+	require.NoError(err)
+	defer client.close()
+
+	err = client.do("foo", func(c redis.Conn) error {
+		_, err := c.Do("SET", "foo", "bar")
+		return err
+	})
+	require.NoError(err)
+	require.Equal([]string{"ASKING", "SET"}, cmds)
+
+	// ASK redirects do not move the slot.
+	require.Equal("10.0.0.1:7001", client.master(hashSlot("foo")))
+}
+
+func TestClusterClientTooManyRedirects(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixtureWithAddr("")
+	config.Cluster = true
+	config.Addrs = []string{"seed:7000"}
+
+	client, err := newClusterClient(config, fakeDialer(
+		map[string]func(string, ...interface{}) (interface{}, error){
+			"seed:7000": clusterSeedHandler("10.0.0.1:7001"),
+			"10.0.0.1:7001": func(cmd string, args ...interface{}) (interface{}, error) {
+				return nil, redis.Error(fmt.Sprintf("MOVED %d 10.0.0.1:7001", hashSlot("foo")))
+			},
+		}))
+	require.NoError(err)
+	defer client.close()
+
+	err = client.do("foo", func(c redis.Conn) error {
+		_, err := c.Do("GET", "foo")
+		return err
+	})
+	require.Error(err)
+}
+
+func TestNewClusterClientUnreachableSeeds(t *testing.T) {
+	config := redisConfigFixtureWithAddr("")
+	config.Cluster = true
+	config.Addrs = []string{"127.0.0.1:0"}
+
+	_, err := newClusterClient(config, fakeDialer(nil))
+	require.Error(t, err)
+}
+
+// sentinelHandler is a Sentinel which reports the master at *master.
+func sentinelHandler(master *string) func(string, ...interface{}) (interface{}, error) {
+	return func(cmd string, args ...interface{}) (interface{}, error) {
+		host, port, err := net.SplitHostPort(*master)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{[]byte(host), []byte(port)}, nil
+	}
+}
+
+func TestSentinelClientResolvesMaster(t *testing.T) {
+	require := require.New(t)
+
+	m, err := miniredis.Run()
+	require.NoError(err)
+	defer m.Close()
+
+	master := m.Addr()
+	config := redisConfigFixtureWithAddr("")
+	config.SentinelMaster = "kraken"
+	config.Addrs = []string{"127.0.0.1:0", "sentinel:26379"}
+
+	client, err := newSentinelClient(config, fakeDialer(
+		map[string]func(string, ...interface{}) (interface{}, error){
+			"sentinel:26379": sentinelHandler(&master),
+		}))
+	require.NoError(err)
+
+	s := &RedisStore{config, client, clock.New()}
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+
+	// Single instance keys are not hash-tagged.
+	require.True(m.Exists(fmt.Sprintf("peerset:%s:%d", h, s.curPeerSetWindow())))
+}
+
+func TestSentinelClientFailsOver(t *testing.T) {
+	require := require.New(t)
+
+	m1, err := miniredis.Run()
+	require.NoError(err)
+
+	m2, err := miniredis.Run()
+	require.NoError(err)
+	defer m2.Close()
+
+	master := m1.Addr()
+	config := redisConfigFixtureWithAddr("")
+	config.SentinelMaster = "kraken"
+	config.Addrs = []string{"sentinel:26379"}
+
+	client, err := newSentinelClient(config, fakeDialer(
+		map[string]func(string, ...interface{}) (interface{}, error){
+			"sentinel:26379": sentinelHandler(&master),
+		}))
+	require.NoError(err)
+	defer client.close()
+
+	set := func(c redis.Conn) error {
+		_, err := c.Do("SET", "foo", "bar")
+		return err
+	}
+	require.NoError(client.do("foo", set))
+
+	m1.Close()
+	master = m2.Addr()
+
+	require.NoError(client.do("foo", set))
+
+	v, err := m2.Get("foo")
+	require.NoError(err)
+	require.Equal("bar", v)
+}
+
+func TestNewRedisStoreInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config RedisConfig
+	}{
+		{"missing addr", RedisConfig{}},
+		{"missing cluster addrs", RedisConfig{Cluster: true}},
+		{"missing sentinel addrs", RedisConfig{SentinelMaster: "kraken"}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewRedisStore(test.config, clock.New())
+			require.Error(t, err)
+		})
+	}
+}
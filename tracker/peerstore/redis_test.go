@@ -56,6 +56,38 @@ func TestRedisStoreGetPeersPopulatesPeerInfoFields(t *testing.T) {
 	require.Equal(peers, []*core.PeerInfo{p})
 }
 
+func TestRedisStoreGetPeersIPv6(t *testing.T) {
+	tests := []struct {
+		desc  string
+		ip    string
+		altIP string
+	}{
+		{"ipv6", "fd00::1", ""},
+		{"dual-stack ipv4", "10.0.0.1", "fd00::1"},
+		{"dual-stack ipv6", "fd00::1", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			s, err := NewRedisStore(redisConfigFixture(), clock.New())
+			require.NoError(err)
+
+			h := core.InfoHashFixture()
+
+			p := core.PeerInfoFixture()
+			p.IP = test.ip
+			p.AltIP = test.altIP
+
+			require.NoError(s.UpdatePeer(h, p))
+
+			peers, err := s.GetPeers(h, 1)
+			require.NoError(err)
+			require.Equal(peers, []*core.PeerInfo{p})
+		})
+	}
+}
+
 func TestRedisStoreGetPeersFromMultipleWindows(t *testing.T) {
 	require := require.New(t)
 
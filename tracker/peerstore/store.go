@@ -43,6 +43,22 @@ func New(config Config) (Store, error) {
 		}
 		return s, nil
 	}
+	if config.Etcd.Enabled {
+		log.Info("Etcd peer store enabled")
+		s, err := NewEtcdStore(config.Etcd, clock.New())
+		if err != nil {
+			return nil, fmt.Errorf("new etcd store: %s", err)
+		}
+		return s, nil
+	}
+	if config.Gossip.Enabled {
+		log.Info("Gossip peer store enabled")
+		s, err := NewGossipStore(config.Gossip, clock.New())
+		if err != nil {
+			return nil, fmt.Errorf("new gossip store: %s", err)
+		}
+		return s, nil
+	}
 	log.Info("Defaulting to local peer store")
 	return NewLocalStore(config.Local, clock.New()), nil
 }
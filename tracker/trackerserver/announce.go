@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/tracker/announceclient"
@@ -31,6 +32,9 @@ func (s *Server) announceHandlerV1(w http.ResponseWriter, r *http.Request) error
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return handler.Errorf("json decode request: %s", err)
 	}
+	if err := s.limitAnnounce(r, req); err != nil {
+		return err
+	}
 	d, err := req.GetDigest()
 	if err != nil {
 		return handler.Errorf("get request digest: %s", err)
@@ -58,6 +62,9 @@ func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		return handler.Errorf("json decode request: %s", err)
 	}
+	if err := s.limitAnnounce(r, req); err != nil {
+		return err
+	}
 	d, err := req.GetDigest()
 	if err != nil {
 		return handler.Errorf("get request digest: %s", err)
@@ -72,9 +79,46 @@ func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+// announceIncrementalHandler answers announces with the changes to the peer
+// handout of the requesting peer since its last announce.
+func (s *Server) announceIncrementalHandler(w http.ResponseWriter, r *http.Request) error {
+	infohash, err := httputil.ParseParam(r, "infohash")
+	if err != nil {
+		return err
+	}
+	h, err := core.NewInfoHashFromHex(infohash)
+	if err != nil {
+		return fmt.Errorf("parse infohash: %s", err)
+	}
+	req := new(announceclient.Request)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return handler.Errorf("json decode request: %s", err)
+	}
+	if err := s.limitAnnounce(r, req); err != nil {
+		return err
+	}
+	d, err := req.GetDigest()
+	if err != nil {
+		return handler.Errorf("get request digest: %s", err)
+	}
+	resp, err := s.announceIncremental(d, h, req.Peer, req.Cursor)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) announce(
 	d core.Digest, h core.InfoHash, peer *core.PeerInfo) (*announceclient.Response, error) {
 
+	s.swarms.record(d, h, peer)
+	s.policy.Learn(peer)
+	if s.rebalancer != nil {
+		s.rebalancer.record(d, h)
+	}
 	if err := s.peerStore.UpdatePeer(h, peer); err != nil {
 		log.With(
 			"hash", h,
@@ -99,7 +143,7 @@ func (s *Server) getPeerHandout(
 		return nil, nil
 	}
 	var errs []error
-	peers, err := s.peerStore.GetPeers(h, s.config.PeerHandoutLimit)
+	peers, err := s.peerStore.GetPeers(h, s.policy.NumCandidates(s.config.PeerHandoutLimit))
 	if err != nil {
 		errs = append(errs, fmt.Errorf("peer store: %s", err))
 	}
@@ -111,5 +155,56 @@ func (s *Server) getPeerHandout(
 	if len(peers) == 0 {
 		return nil, handler.Errorf("no peers available: %s", errutil.Join(errs))
 	}
-	return s.policy.SortPeers(peer, peers), nil
+	return s.policy.SelectPeers(peer, peers, s.config.PeerHandoutLimit), nil
+}
+
+func (s *Server) announceIncremental(
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	cursor uint64) (*announceclient.Response, error) {
+
+	full, err := s.announce(d, h, peer)
+	if err != nil {
+		return nil, err
+	}
+	k := handoutKey{h, peer.PeerID}
+	resp := &announceclient.Response{}
+	handoutType := "full"
+	prev, ok := s.handouts.get(k, cursor)
+	if ok {
+		handoutType = "diff"
+		resp.Incremental = true
+		resp.Added, resp.Removed = announceclient.DiffPeers(prev.peers, full.Peers)
+	} else {
+		resp.Peers = full.Peers
+	}
+	s.stats.Tagged(map[string]string{
+		"handout": handoutType,
+	}).Counter("incremental_announces").Inc(1)
+	resp.Interval = s.incrementalInterval(peer, full.Peers, prev, len(resp.Added)+len(resp.Removed) > 0)
+	resp.Cursor = s.handouts.put(k, full.Peers, resp.Interval)
+	return resp, nil
+}
+
+// incrementalInterval returns the interval until the next incremental announce
+// of peer. While the handout of a seeded swarm is unchanged, the interval
+// doubles up to the max announce interval, and any change resets it.
+func (s *Server) incrementalInterval(
+	peer *core.PeerInfo, peers []*core.PeerInfo, prev *handout, changed bool) time.Duration {
+
+	if peer.Complete || prev == nil || changed || !hasSeeder(peers) {
+		return s.config.AnnounceInterval
+	}
+	return min(2*prev.interval, s.config.MaxAnnounceInterval)
+}
+
+// hasSeeder returns true if any of peers is complete, including origins.
+func hasSeeder(peers []*core.PeerInfo) bool {
+	for _, p := range peers {
+		if p.Complete {
+			return true
+		}
+	}
+	return false
 }
@@ -24,10 +24,14 @@ import (
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/testutil"
 
+	"github.com/go-chi/chi"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func newAnnounceClient(pctx core.PeerContext, addr string) announceclient.Client {
@@ -76,7 +80,7 @@ func TestCheckReadiness(t *testing.T) {
 }
 
 func TestAnnounceSinglePeerResponse(t *testing.T) {
-	for _, version := range []int{announceclient.V1, announceclient.V2} {
+	for _, version := range []int{announceclient.V1, announceclient.V2, announceclient.V3} {
 		t.Run(fmt.Sprintf("V%d", version), func(t *testing.T) {
 			require := require.New(t)
 
@@ -102,7 +106,7 @@ func TestAnnounceSinglePeerResponse(t *testing.T) {
 				blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
 
 			result, interval, err := client.Announce(
-				blob.Digest, blob.MetaInfo.InfoHash(), false, version)
+				_testNamespace, blob.Digest, blob.MetaInfo.InfoHash(), false, version)
 			require.NoError(err)
 			require.Equal(peers, result)
 			require.Equal(config.AnnounceInterval, interval)
@@ -110,6 +114,132 @@ func TestAnnounceSinglePeerResponse(t *testing.T) {
 	}
 }
 
+func TestAnnounceIncremental(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		AnnounceInterval:    time.Second,
+		MaxAnnounceInterval: 3 * time.Second,
+	}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	pctx := core.PeerContextFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).AnyTimes()
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil).AnyTimes()
+
+	for _, step := range []struct {
+		peers    []*core.PeerInfo
+		interval time.Duration
+	}{
+		{[]*core.PeerInfo{seeder, p1}, time.Second},
+		// Interval backs off while the handout is unchanged.
+		{[]*core.PeerInfo{seeder, p1}, 2 * time.Second},
+		{[]*core.PeerInfo{seeder, p1}, 3 * time.Second},
+		// Any change resets the interval.
+		{[]*core.PeerInfo{seeder, p2}, time.Second},
+		// Swarms without seeders do not back off.
+		{[]*core.PeerInfo{p2}, time.Second},
+		{[]*core.PeerInfo{p2}, time.Second},
+	} {
+		mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(step.peers, nil)
+
+		result, interval, err := client.Announce(_testNamespace, blob.Digest, h, false, announceclient.V3)
+		require.NoError(err)
+		require.ElementsMatch(step.peers, result)
+		require.Equal(step.interval, interval)
+	}
+}
+
+func TestAnnounceIncrementalResponseContainsDiff(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := mocks.server()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+	p3 := core.PeerInfoFixture()
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).AnyTimes()
+	mocks.peerStore.EXPECT().UpdatePeer(h, peer).Return(nil).AnyTimes()
+
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{p1, p2}, nil)
+	resp, err := s.announceIncremental(blob.Digest, h, peer, 0)
+	require.NoError(err)
+	require.False(resp.Incremental)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, resp.Peers)
+	require.NotZero(resp.Cursor)
+
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{p2, p3}, nil)
+	resp, err = s.announceIncremental(blob.Digest, h, peer, resp.Cursor)
+	require.NoError(err)
+	require.True(resp.Incremental)
+	require.Empty(resp.Peers)
+	require.Equal([]*core.PeerInfo{p3}, resp.Added)
+	require.Equal([]core.PeerID{p1.PeerID}, resp.Removed)
+
+	// Unknown cursors receive full handouts.
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return([]*core.PeerInfo{p2, p3}, nil)
+	resp, err = s.announceIncremental(blob.Digest, h, peer, resp.Cursor+1)
+	require.NoError(err)
+	require.False(resp.Incremental)
+	require.ElementsMatch([]*core.PeerInfo{p2, p3}, resp.Peers)
+}
+
+func TestAnnounceIncrementalFallsBackToV2(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	s := mocks.server()
+
+	// Tracker which does not support incremental announces.
+	r := chi.NewRouter()
+	r.Post("/announce/{infohash}", handler.Wrap(s.announceHandlerV2))
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+
+	result, _, err := client.Announce(
+		_testNamespace, blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V3)
+	require.NoError(err)
+	require.Equal(peers, result)
+}
+
 func TestAnnounceUnavailablePeerStoreCanStillProvideOrigins(t *testing.T) {
 	require := require.New(t)
 
@@ -134,7 +264,7 @@ func TestAnnounceUnavailablePeerStoreCanStillProvideOrigins(t *testing.T) {
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
 
 	result, _, err := client.Announce(
-		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+		_testNamespace, blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
 	require.NoError(err)
 	require.Equal(origins, result)
 }
@@ -162,11 +292,52 @@ func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, errors.New("some error"))
 
 	result, _, err := client.Announce(
-		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+		_testNamespace, blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
 	require.NoError(err)
 	require.Equal(peers, result)
 }
 
+func TestAnnounceEnforcesMinSeederRatio(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{PeerHandoutLimit: 4})
+	defer cleanup()
+
+	policy, err := peerhandoutpolicy.New(tally.NoopScope, peerhandoutpolicy.Config{
+		Priority:            "completeness",
+		MinSeederRatio:      0.5,
+		CandidateMultiplier: 4,
+	})
+	require.NoError(err)
+	mocks.policy = policy
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	var peers []*core.PeerInfo
+	for i := 0; i < 16; i++ {
+		p := core.PeerInfoFixture()
+		p.Complete = i >= 14
+		peers = append(peers, p)
+	}
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(blob.MetaInfo.InfoHash(), 16).Return(peers, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	result, _, err := client.Announce(
+		_testNamespace, blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.NoError(err)
+	require.Len(result, 4)
+	require.ElementsMatch(peers[14:], result[:2])
+}
+
 func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
 	d := core.DigestFixture()
 	h := core.InfoHashFixture()
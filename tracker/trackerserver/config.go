@@ -29,6 +29,20 @@ type Config struct {
 
 	AnnounceInterval time.Duration `yaml:"announce_interval"`
 
+	// MaxAnnounceInterval bounds the intervals of incremental announces, which
+	// back off from AnnounceInterval while swarms are stable and seeded.
+	MaxAnnounceInterval time.Duration `yaml:"max_announce_interval"`
+
+	// HandoutTTL is how long peer handouts are remembered to answer
+	// incremental announces with diffs.
+	HandoutTTL time.Duration `yaml:"handout_ttl"`
+
+	SwarmStats SwarmStatsConfig `yaml:"swarm_stats"`
+
+	AnnounceRateLimit AnnounceRateLimitConfig `yaml:"announce_rate_limit"`
+
+	Rebalance RebalanceConfig `yaml:"rebalance"`
+
 	Listener listener.Config `yaml:"listener"`
 }
 
@@ -42,5 +56,11 @@ func (c Config) applyDefaults() Config {
 	if c.AnnounceInterval == 0 {
 		c.AnnounceInterval = 3 * time.Second
 	}
+	if c.MaxAnnounceInterval == 0 {
+		c.MaxAnnounceInterval = 30 * time.Second
+	}
+	if c.HandoutTTL == 0 {
+		c.HandoutTTL = 5 * time.Minute
+	}
 	return c
 }
@@ -16,8 +16,10 @@ package trackerserver
 import (
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 
+	"github.com/uber/kraken/tracker/metainfostore"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -29,7 +31,15 @@ func Fixture() *Server {
 	config := Config{
 		AnnounceInterval: 250 * time.Millisecond,
 	}
-	return New(
+	metaInfoStore, err := metainfostore.New(metainfostore.Config{}, clock.New(), tally.NoopScope, nil)
+	if err != nil {
+		panic(err)
+	}
+	s, err := New(
 		config, tally.NoopScope, policy,
-		peerstore.NewTestStore(), originstore.NewNoopStore(), nil)
+		peerstore.NewTestStore(), originstore.NewNoopStore(), metaInfoStore, nil)
+	if err != nil {
+		panic(err)
+	}
+	return s
 }
@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber/kraken/core"
+)
+
+// handoutKey identifies the peers handed out to a peer announcing a torrent.
+type handoutKey struct {
+	infoHash core.InfoHash
+	peerID   core.PeerID
+}
+
+// handout is the last peer handout of an incremental announce.
+type handout struct {
+	cursor    uint64
+	peers     []*core.PeerInfo
+	interval  time.Duration
+	expiresAt time.Time
+}
+
+// handoutStore remembers the last peer handouts of incremental announces, so
+// following announces can be answered with diffs. Handouts are not shared
+// between trackers, so peers which fail over to another tracker simply
+// receive a full handout.
+type handoutStore struct {
+	clk clock.Clock
+	ttl time.Duration
+
+	mu        sync.Mutex // Protects the following fields:
+	handouts  map[handoutKey]*handout
+	lastPurge time.Time
+}
+
+func newHandoutStore(clk clock.Clock, ttl time.Duration) *handoutStore {
+	return &handoutStore{
+		clk:      clk,
+		ttl:      ttl,
+		handouts: make(map[handoutKey]*handout),
+	}
+}
+
+// get returns the handout of k identified by cursor. Returns false if the
+// handout expired or was replaced by a later handout.
+func (s *handoutStore) get(k handoutKey, cursor uint64) (*handout, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.handouts[k]
+	if !ok || cursor == 0 || h.cursor != cursor || !s.clk.Now().Before(h.expiresAt) {
+		return nil, false
+	}
+	return h, true
+}
+
+// put replaces the handout of k, and returns the cursor of the new handout.
+func (s *handoutStore) put(k handoutKey, peers []*core.PeerInfo, interval time.Duration) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clk.Now()
+	if now.Sub(s.lastPurge) >= s.ttl {
+		for k, h := range s.handouts {
+			if !now.Before(h.expiresAt) {
+				delete(s.handouts, k)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	// Cursors are random, so cursors of handouts which were lost, e.g. when
+	// the tracker restarted, are not mistaken for new handouts.
+	var cursor uint64
+	for cursor == 0 {
+		cursor = rand.Uint64()
+	}
+	s.handouts[k] = &handout{cursor, peers, interval, now.Add(s.ttl)}
+	return cursor
+}
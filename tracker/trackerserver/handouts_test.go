@@ -0,0 +1,86 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/core"
+)
+
+func TestHandoutStoreGet(t *testing.T) {
+	require := require.New(t)
+
+	s := newHandoutStore(clock.NewMock(), time.Minute)
+
+	k := handoutKey{core.InfoHashFixture(), core.PeerIDFixture()}
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	cursor := s.put(k, peers, time.Second)
+
+	h, ok := s.get(k, cursor)
+	require.True(ok)
+	require.Equal(peers, h.peers)
+	require.Equal(time.Second, h.interval)
+
+	_, ok = s.get(k, cursor+1)
+	require.False(ok)
+
+	_, ok = s.get(k, 0)
+	require.False(ok)
+
+	_, ok = s.get(handoutKey{k.infoHash, core.PeerIDFixture()}, cursor)
+	require.False(ok)
+}
+
+func TestHandoutStoreReplacesHandouts(t *testing.T) {
+	require := require.New(t)
+
+	s := newHandoutStore(clock.NewMock(), time.Minute)
+
+	k := handoutKey{core.InfoHashFixture(), core.PeerIDFixture()}
+
+	first := s.put(k, nil, time.Second)
+	second := s.put(k, nil, time.Second)
+	require.NotEqual(first, second)
+
+	_, ok := s.get(k, first)
+	require.False(ok)
+	_, ok = s.get(k, second)
+	require.True(ok)
+}
+
+func TestHandoutStoreExpiresHandouts(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := newHandoutStore(clk, time.Minute)
+
+	k1 := handoutKey{core.InfoHashFixture(), core.PeerIDFixture()}
+	k2 := handoutKey{core.InfoHashFixture(), core.PeerIDFixture()}
+
+	c1 := s.put(k1, nil, time.Second)
+
+	clk.Add(time.Minute)
+
+	_, ok := s.get(k1, c1)
+	require.False(ok)
+
+	// Expired handouts are purged on puts.
+	s.put(k2, nil, time.Second)
+	require.Len(s.handouts, 1)
+}
@@ -32,7 +32,7 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	}
 
 	timer := s.stats.Timer("get_metainfo").Start()
-	mi, err := s.originCluster.GetMetaInfo(namespace, d)
+	mi, err := s.metaInfoStore.GetMetaInfo(namespace, d)
 	if err != nil {
 		if serr, ok := err.(httputil.StatusError); ok {
 			// Propagate errors received from origin.
@@ -52,3 +52,33 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	}
 	return nil
 }
+
+func (s *Server) getChunkIndexHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
+	}
+
+	idx, err := s.originCluster.GetChunkIndex(namespace, d)
+	if err != nil {
+		if serr, ok := err.(httputil.StatusError); ok {
+			// Propagate errors received from origin.
+			return handler.Errorf("origin: %s", serr.ResponseDump).Status(serr.Status)
+		}
+		return err
+	}
+
+	b, err := idx.Serialize()
+	if err != nil {
+		return fmt.Errorf("serialize chunk index: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("write response: %s", err)
+	}
+	return nil
+}
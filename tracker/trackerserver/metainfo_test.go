@@ -17,6 +17,7 @@ import (
 	"testing"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/delta"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/tracker/metainfoclient"
@@ -72,3 +73,46 @@ func TestGetMetaInfoHandlerPropagatesOriginError(t *testing.T) {
 	require.Error(err)
 	require.True(httputil.IsStatus(err, 599))
 }
+
+func TestGetChunkIndexHandlerFetchesFromOrigin(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+	idx := &delta.Index{Chunks: []delta.Chunk{{Offset: 0, Length: 10, Sum: "a"}}}
+
+	mocks.originCluster.EXPECT().GetChunkIndex(namespace, d).Return(idx, nil)
+
+	client := newMetaInfoClient(addr)
+
+	result, err := client.DownloadChunkIndex(namespace, d)
+	require.NoError(err)
+	require.Equal(idx, result)
+}
+
+func TestGetChunkIndexHandlerNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+
+	mocks.originCluster.EXPECT().GetChunkIndex(
+		namespace, d).Return(nil, httputil.StatusError{Status: 404})
+
+	client := newMetaInfoClient(addr)
+
+	_, err := client.DownloadChunkIndex(namespace, d)
+	require.Equal(metainfoclient.ErrChunkIndexNotFound, err)
+}
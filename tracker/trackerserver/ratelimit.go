@@ -0,0 +1,322 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// RateLimitConfig defines a token bucket which refills at QPS tokens per
+// second and holds at most Burst tokens. A zero QPS disables the limit.
+type RateLimitConfig struct {
+	QPS   float64 `yaml:"qps"`
+	Burst int     `yaml:"burst"`
+}
+
+func (c RateLimitConfig) applyDefaults(qps float64, burst int) RateLimitConfig {
+	if c.QPS == 0 {
+		c.QPS = qps
+	}
+	if c.Burst == 0 {
+		c.Burst = burst
+	}
+	return c
+}
+
+// NamespaceRateLimitConfig limits announces of torrents in namespaces matching
+// the Namespace regexp.
+type NamespaceRateLimitConfig struct {
+	Namespace string          `yaml:"namespace"`
+	Limit     RateLimitConfig `yaml:"limit"`
+}
+
+// AnnounceRateLimitConfig defines the rate limits of announces, which protect
+// the tracker from misbehaving agents, e.g. agents in a tight retry loop.
+// Announces must pass the limits of their peer id, ip and namespace, and
+// throttled announces are rejected with 429 and the interval after which they
+// may be retried.
+type AnnounceRateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	Peer RateLimitConfig `yaml:"peer"`
+	IP   RateLimitConfig `yaml:"ip"`
+
+	// Namespaces limits announces of all peers per namespace. Each namespace
+	// has its own bucket, limited by the first matching entry. Namespaces
+	// matching no entry, and announces of agents which do not send their
+	// namespace, are not limited.
+	Namespaces []NamespaceRateLimitConfig `yaml:"namespaces"`
+
+	// IdleTTL is how long the limits of peers, ips and namespaces which stopped
+	// announcing are remembered.
+	IdleTTL time.Duration `yaml:"idle_ttl"`
+
+	// TrustedProxies lists the ips or CIDRs of proxies, e.g. the nginx in front
+	// of the tracker, which are trusted to set X-Real-IP to the ip of their
+	// client. Announces from any other address are limited by their remote
+	// address, so clients cannot pick their ip bucket. Announces over a unix
+	// socket always come from a local proxy and are trusted.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+func (c AnnounceRateLimitConfig) applyDefaults() AnnounceRateLimitConfig {
+	c.Peer = c.Peer.applyDefaults(10, 50)
+	c.IP = c.IP.applyDefaults(20, 100)
+	c.Namespaces = append([]NamespaceRateLimitConfig(nil), c.Namespaces...)
+	for i := range c.Namespaces {
+		l := c.Namespaces[i].Limit
+		c.Namespaces[i].Limit = l.applyDefaults(0, int(math.Ceil(l.QPS)))
+	}
+	if c.IdleTTL == 0 {
+		c.IdleTTL = 10 * time.Minute
+	}
+	return c
+}
+
+// Kinds of announce rate limits.
+const (
+	_peerLimit      = "peer"
+	_ipLimit        = "ip"
+	_namespaceLimit = "namespace"
+)
+
+type namespaceLimit struct {
+	re    *regexp.Regexp
+	limit RateLimitConfig
+}
+
+type bucketKey struct {
+	kind  string
+	value string
+}
+
+type bucket struct {
+	limiter       *rate.Limiter
+	lastSeen      time.Time
+	lastThrottled time.Time
+}
+
+// announceLimiter rate limits announces with token buckets per peer id, ip
+// and namespace.
+type announceLimiter struct {
+	config     AnnounceRateLimitConfig
+	clk        clock.Clock
+	stats      tally.Scope
+	namespaces []namespaceLimit
+	proxies    []*net.IPNet
+
+	mu        sync.Mutex // Protects the following fields:
+	buckets   map[bucketKey]*bucket
+	lastPurge time.Time
+}
+
+func newAnnounceLimiter(
+	config AnnounceRateLimitConfig, clk clock.Clock, stats tally.Scope) (*announceLimiter, error) {
+
+	config = config.applyDefaults()
+	var namespaces []namespaceLimit
+	for _, n := range config.Namespaces {
+		re, err := regexp.Compile(n.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("regexp %q: %s", n.Namespace, err)
+		}
+		namespaces = append(namespaces, namespaceLimit{re, n.Limit})
+	}
+	var proxies []*net.IPNet
+	for _, p := range config.TrustedProxies {
+		n, err := parseTrustedProxy(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %s", p, err)
+		}
+		proxies = append(proxies, n)
+	}
+	return &announceLimiter{
+		config:     config,
+		clk:        clk,
+		stats:      stats,
+		namespaces: namespaces,
+		proxies:    proxies,
+		buckets:    make(map[bucketKey]*bucket),
+		lastPurge:  clk.Now(),
+	}, nil
+}
+
+// allow takes a token from the buckets of peerID, ip and namespace. If any
+// bucket is empty, no token is taken, and allow returns false and the interval
+// after which the announce may be retried.
+func (l *announceLimiter) allow(
+	peerID core.PeerID, ip, namespace string) (retryAfter time.Duration, ok bool) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clk.Now()
+	if now.Sub(l.lastPurge) >= l.config.IdleTTL {
+		l.purge(now)
+	}
+
+	type reservation struct {
+		kind string
+		b    *bucket
+		r    *rate.Reservation
+	}
+	var reservations []reservation
+	reserve := func(kind, value string, limit RateLimitConfig) {
+		if value == "" || limit.QPS <= 0 {
+			return
+		}
+		k := bucketKey{kind, value}
+		b, ok := l.buckets[k]
+		if !ok {
+			b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.QPS), limit.Burst)}
+			l.buckets[k] = b
+		}
+		b.lastSeen = now
+		reservations = append(reservations, reservation{kind, b, b.limiter.ReserveN(now, 1)})
+	}
+	reserve(_peerLimit, peerID.String(), l.config.Peer)
+	reserve(_ipLimit, ip, l.config.IP)
+	for _, n := range l.namespaces {
+		if n.re.MatchString(namespace) {
+			reserve(_namespaceLimit, namespace, n.limit)
+			break
+		}
+	}
+
+	for _, r := range reservations {
+		delay := r.r.DelayFrom(now)
+		if !r.r.OK() {
+			delay = rate.InfDuration
+		}
+		if delay <= 0 {
+			continue
+		}
+		r.b.lastThrottled = now
+		l.stats.Tagged(map[string]string{
+			"limit": r.kind,
+		}).Counter("announces_throttled").Inc(1)
+		if delay > retryAfter {
+			retryAfter = delay
+		}
+	}
+	if retryAfter > 0 {
+		for _, r := range reservations {
+			r.r.CancelAt(now)
+		}
+		return retryAfter, false
+	}
+	return 0, true
+}
+
+// purge evicts the buckets of peers, ips and namespaces which stopped
+// announcing, and reports the number of peers throttled recently. Must be
+// called with l.mu held.
+func (l *announceLimiter) purge(now time.Time) {
+	var throttled int
+	for k, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= l.config.IdleTTL {
+			delete(l.buckets, k)
+			continue
+		}
+		if k.kind == _peerLimit && now.Sub(b.lastThrottled) < l.config.IdleTTL {
+			throttled++
+		}
+	}
+	l.stats.Gauge("throttled_peers").Update(float64(throttled))
+	l.lastPurge = now
+}
+
+// parseTrustedProxy parses s as a CIDR, or as a single ip.
+func parseTrustedProxy(s string) (*net.IPNet, error) {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.New("invalid ip or cidr")
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// clientIP returns the ip of the client of r. X-Real-IP is only honoured if r
+// was sent by a trusted proxy, otherwise the remote address is used.
+func (l *announceLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// Requests over unix sockets have no remote ip, and can only come
+		// from a local proxy.
+		return r.Header.Get("X-Real-IP")
+	}
+	if ip := r.Header.Get("X-Real-IP"); ip != "" && l.trusted(host) {
+		return ip
+	}
+	return host
+}
+
+// trusted returns true if host is the ip of a trusted proxy.
+func (l *announceLimiter) trusted(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range l.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitAnnounce returns a 429 error if the announce req must be throttled.
+func (s *Server) limitAnnounce(r *http.Request, req *announceclient.Request) error {
+	if req.Peer == nil {
+		return handler.Errorf("no peer in request").Status(http.StatusBadRequest)
+	}
+	if s.limiter == nil {
+		return nil
+	}
+	retryAfter, ok := s.limiter.allow(req.Peer.PeerID, s.limiter.clientIP(r), req.Namespace)
+	if ok {
+		return nil
+	}
+	// Retry-After is in whole seconds, so round up to not invite retries which
+	// are throttled again.
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if retryAfter >= rate.InfDuration || seconds > int(s.config.MaxAnnounceInterval.Seconds()) {
+		seconds = int(s.config.MaxAnnounceInterval.Seconds())
+	}
+	return handler.Errorf("announce rate limit exceeded").
+		Status(http.StatusTooManyRequests).
+		Header("Retry-After", strconv.Itoa(seconds))
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func announceLimiterFixture(
+	t *testing.T, config AnnounceRateLimitConfig) (*announceLimiter, *clock.Mock, tally.TestScope) {
+
+	clk := clock.NewMock()
+	stats := tally.NewTestScope("", nil)
+	l, err := newAnnounceLimiter(config, clk, stats)
+	require.NoError(t, err)
+	return l, clk, stats
+}
+
+func TestAnnounceLimiterThrottlesPeer(t *testing.T) {
+	require := require.New(t)
+
+	l, clk, stats := announceLimiterFixture(t, AnnounceRateLimitConfig{
+		Peer: RateLimitConfig{QPS: 1, Burst: 2},
+	})
+
+	peer := core.PeerIDFixture()
+
+	for i := 0; i < 2; i++ {
+		_, ok := l.allow(peer, "10.0.0.1", _testNamespace)
+		require.True(ok)
+	}
+	retryAfter, ok := l.allow(peer, "10.0.0.1", _testNamespace)
+	require.False(ok)
+	require.Equal(time.Second, retryAfter)
+	require.Equal(int64(1), stats.Snapshot().Counters()["announces_throttled+limit=peer"].Value())
+
+	// Other peers are not throttled.
+	_, ok = l.allow(core.PeerIDFixture(), "10.0.0.2", _testNamespace)
+	require.True(ok)
+
+	clk.Add(time.Second)
+	_, ok = l.allow(peer, "10.0.0.1", _testNamespace)
+	require.True(ok)
+}
+
+func TestAnnounceLimiterThrottlesIP(t *testing.T) {
+	require := require.New(t)
+
+	l, _, _ := announceLimiterFixture(t, AnnounceRateLimitConfig{
+		IP: RateLimitConfig{QPS: 1, Burst: 1},
+	})
+
+	_, ok := l.allow(core.PeerIDFixture(), "10.0.0.1", _testNamespace)
+	require.True(ok)
+
+	// Peers sharing an ip share its limit.
+	_, ok = l.allow(core.PeerIDFixture(), "10.0.0.1", _testNamespace)
+	require.False(ok)
+}
+
+func TestAnnounceLimiterThrottlesNamespace(t *testing.T) {
+	require := require.New(t)
+
+	l, _, _ := announceLimiterFixture(t, AnnounceRateLimitConfig{
+		Namespaces: []NamespaceRateLimitConfig{{
+			Namespace: "batch/.*",
+			Limit:     RateLimitConfig{QPS: 1, Burst: 1},
+		}},
+	})
+
+	_, ok := l.allow(core.PeerIDFixture(), "10.0.0.1", "batch/a")
+	require.True(ok)
+	_, ok = l.allow(core.PeerIDFixture(), "10.0.0.2", "batch/a")
+	require.False(ok)
+
+	// Each namespace has its own bucket.
+	_, ok = l.allow(core.PeerIDFixture(), "10.0.0.3", "batch/b")
+	require.True(ok)
+
+	// Namespaces matching no entry, and unknown namespaces, are not limited.
+	for i := 0; i < 10; i++ {
+		_, ok = l.allow(core.PeerIDFixture(), "10.0.0.4", "prod/a")
+		require.True(ok)
+		_, ok = l.allow(core.PeerIDFixture(), "10.0.0.5", "")
+		require.True(ok)
+	}
+}
+
+func TestAnnounceLimiterThrottledAnnouncesTakeNoTokens(t *testing.T) {
+	require := require.New(t)
+
+	l, _, _ := announceLimiterFixture(t, AnnounceRateLimitConfig{
+		Peer: RateLimitConfig{QPS: 1, Burst: 1},
+		IP:   RateLimitConfig{QPS: 1, Burst: 2},
+	})
+
+	peer := core.PeerIDFixture()
+
+	_, ok := l.allow(peer, "10.0.0.1", _testNamespace)
+	require.True(ok)
+	_, ok = l.allow(peer, "10.0.0.1", _testNamespace)
+	require.False(ok)
+
+	// The throttled announce of peer did not drain the ip bucket.
+	_, ok = l.allow(core.PeerIDFixture(), "10.0.0.1", _testNamespace)
+	require.True(ok)
+}
+
+func TestAnnounceLimiterPurgesIdleBuckets(t *testing.T) {
+	require := require.New(t)
+
+	l, clk, stats := announceLimiterFixture(t, AnnounceRateLimitConfig{
+		Peer:    RateLimitConfig{QPS: 1, Burst: 1},
+		IdleTTL: time.Minute,
+	})
+
+	l.allow(core.PeerIDFixture(), "10.0.0.1", _testNamespace)
+
+	clk.Add(30 * time.Second)
+	peer := core.PeerIDFixture()
+	l.allow(peer, "10.0.0.2", _testNamespace)
+	_, ok := l.allow(peer, "10.0.0.2", _testNamespace)
+	require.False(ok)
+
+	clk.Add(30 * time.Second)
+	l.allow(core.PeerIDFixture(), "10.0.0.3", _testNamespace)
+	require.Equal(float64(1), stats.Snapshot().Gauges()["throttled_peers+"].Value())
+
+	// Buckets of the first peer and its ip are evicted.
+	require.Len(l.buckets, 4)
+}
+
+func TestAnnounceLimiterClientIP(t *testing.T) {
+	l, _, _ := announceLimiterFixture(t, AnnounceRateLimitConfig{
+		TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16", "::1"},
+	})
+
+	tests := []struct {
+		desc       string
+		remoteAddr string
+		realIP     string
+		expected   string
+	}{
+		{"no header", "10.0.0.2:1234", "", "10.0.0.2"},
+		{"untrusted remote", "10.0.0.2:1234", "10.0.0.3", "10.0.0.2"},
+		{"trusted ip", "10.0.0.1:1234", "10.0.0.3", "10.0.0.3"},
+		{"trusted cidr", "192.168.1.1:1234", "10.0.0.3", "10.0.0.3"},
+		{"trusted ipv6", "[::1]:1234", "10.0.0.3", "10.0.0.3"},
+		{"trusted without header", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"unix socket", "@", "10.0.0.3", "10.0.0.3"},
+		{"unix socket without header", "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "/announce", nil)
+			require.NoError(t, err)
+			r.RemoteAddr = test.remoteAddr
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			require.Equal(t, test.expected, l.clientIP(r))
+		})
+	}
+}
+
+func TestInvalidTrustedProxy(t *testing.T) {
+	_, err := newAnnounceLimiter(AnnounceRateLimitConfig{
+		TrustedProxies: []string{"nginx"},
+	}, clock.NewMock(), tally.NoopScope)
+	require.Error(t, err)
+}
+
+func TestInvalidNamespaceRateLimit(t *testing.T) {
+	_, err := newAnnounceLimiter(AnnounceRateLimitConfig{
+		Namespaces: []NamespaceRateLimitConfig{{Namespace: "("}},
+	}, clock.NewMock(), tally.NoopScope)
+	require.Error(t, err)
+}
+
+func TestAnnounceThrottledResponse(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		MaxAnnounceInterval: 30 * time.Second,
+		AnnounceRateLimit: AnnounceRateLimitConfig{
+			Enabled: true,
+			Peer:    RateLimitConfig{QPS: 0.1, Burst: 1},
+		},
+	}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(nil, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{core.OriginPeerInfoFixture()}, nil)
+
+	_, _, err := client.Announce(_testNamespace, blob.Digest, h, false, announceclient.V2)
+	require.NoError(err)
+
+	_, _, err = client.Announce(_testNamespace, blob.Digest, h, false, announceclient.V2)
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+	retryAfter, ok := announceclient.RetryAfter(err)
+	require.True(ok)
+	require.Equal(10*time.Second, retryAfter)
+}
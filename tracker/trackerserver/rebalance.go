@@ -0,0 +1,255 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/closers"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// RebalanceConfig defines the configuration of peer handoffs between trackers.
+// Agents announce torrents to the first healthy tracker which owns them in the
+// tracker hash ring. When trackers join or leave the ring, or become healthy
+// again, trackers hand off the peers of torrents they no longer own to the
+// new owners, so swarms are not split between trackers. Only needed if the
+// peer store is not shared between trackers.
+type RebalanceConfig struct {
+	// Interval is how often the ownership of torrents is checked.
+	Interval time.Duration `yaml:"interval"`
+
+	// TorrentTTL is how long torrents are tracked after their last announce.
+	TorrentTTL time.Duration `yaml:"torrent_ttl"`
+
+	// MaxPeers bounds the number of peers handed off per torrent.
+	MaxPeers int `yaml:"max_peers"`
+
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c RebalanceConfig) applyDefaults() RebalanceConfig {
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.TorrentTTL == 0 {
+		c.TorrentTTL = 5 * time.Minute
+	}
+	if c.MaxPeers == 0 {
+		c.MaxPeers = 1000
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+	return c
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithRebalancing enables handoffs of peers to the trackers which own their
+// torrents in ring. self is the address of the local tracker in ring.
+func WithRebalancing(ring hashring.Ring, self string, tls *tls.Config) Option {
+	return func(s *Server) {
+		s.rebalancer = newRebalancer(
+			s.config.Rebalance, clock.New(), s.stats, ring, self, s.peerStore, tls)
+	}
+}
+
+// handoffRequest hands off the peers of a torrent to the tracker which owns it.
+type handoffRequest struct {
+	Digest core.Digest      `json:"digest"`
+	Peers  []*core.PeerInfo `json:"peers"`
+}
+
+// trackedTorrent is a torrent whose peers are stored on the local tracker.
+type trackedTorrent struct {
+	d core.Digest
+
+	// owner is the tracker which should store the peers of the torrent. It
+	// is the local tracker until peers were handed off.
+	owner string
+
+	lastSeen time.Time
+}
+
+// rebalancer hands off the peers of torrents to the trackers which own them.
+type rebalancer struct {
+	config    RebalanceConfig
+	clk       clock.Clock
+	stats     tally.Scope
+	ring      hashring.Ring
+	self      string
+	peerStore peerstore.Store
+	tls       *tls.Config
+
+	mu       sync.Mutex // Protects the following fields:
+	torrents map[core.InfoHash]*trackedTorrent
+}
+
+func newRebalancer(
+	config RebalanceConfig,
+	clk clock.Clock,
+	stats tally.Scope,
+	ring hashring.Ring,
+	self string,
+	peerStore peerstore.Store,
+	tls *tls.Config) *rebalancer {
+
+	return &rebalancer{
+		config:    config.applyDefaults(),
+		clk:       clk,
+		stats:     stats,
+		ring:      ring,
+		self:      self,
+		peerStore: peerStore,
+		tls:       tls,
+		torrents:  make(map[core.InfoHash]*trackedTorrent),
+	}
+}
+
+// record tracks that peers of (d, h) were stored on the local tracker.
+func (r *rebalancer) record(d core.Digest, h core.InfoHash) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.torrents[h]
+	if !ok {
+		t = &trackedTorrent{d: d}
+		r.torrents[h] = t
+	}
+	t.owner = r.self
+	t.lastSeen = r.clk.Now()
+}
+
+// monitor rebalances at the configured interval. Blocks until stop is closed.
+func (r *rebalancer) monitor(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-r.clk.After(r.config.Interval):
+			r.rebalance()
+		}
+	}
+}
+
+// rebalance hands off the peers of torrents whose owner changed.
+func (r *rebalancer) rebalance() {
+	type move struct {
+		h     core.InfoHash
+		d     core.Digest
+		owner string
+	}
+	var moves []move
+
+	r.mu.Lock()
+	now := r.clk.Now()
+	for h, t := range r.torrents {
+		if now.Sub(t.lastSeen) >= r.config.TorrentTTL {
+			delete(r.torrents, h)
+			continue
+		}
+		owner := r.ring.Locations(t.d)[0]
+		if owner == t.owner {
+			continue
+		}
+		if owner == r.self {
+			// Peers were handed off, but ownership returned.
+			t.owner = owner
+			continue
+		}
+		moves = append(moves, move{h, t.d, owner})
+	}
+	r.mu.Unlock()
+
+	for _, m := range moves {
+		if err := r.handoff(m.h, m.d, m.owner); err != nil {
+			log.With("hash", m.h, "owner", m.owner).Errorf("Error handing off peers: %s", err)
+			r.stats.Counter("handoff_errors").Inc(1)
+			// Retried on the next rebalance.
+			continue
+		}
+		r.stats.Counter("handoffs").Inc(1)
+		r.mu.Lock()
+		if t, ok := r.torrents[m.h]; ok {
+			t.owner = m.owner
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *rebalancer) handoff(h core.InfoHash, d core.Digest, addr string) error {
+	peers, err := r.peerStore.GetPeers(h, r.config.MaxPeers)
+	if err != nil {
+		return fmt.Errorf("get peers: %s", err)
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(&handoffRequest{d, peers})
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/handoff/%s", addr, h),
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendTimeout(r.config.Timeout),
+		httputil.SendTLS(r.tls))
+	if err != nil {
+		return err
+	}
+	closers.Close(resp.Body)
+	return nil
+}
+
+// handoffHandler stores the peers handed off by another tracker.
+func (s *Server) handoffHandler(w http.ResponseWriter, r *http.Request) error {
+	infohash, err := httputil.ParseParam(r, "infohash")
+	if err != nil {
+		return err
+	}
+	h, err := core.NewInfoHashFromHex(infohash)
+	if err != nil {
+		return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+	}
+	var req handoffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("json decode request: %s", err).Status(http.StatusBadRequest)
+	}
+	for _, p := range req.Peers {
+		if err := s.peerStore.UpdatePeer(h, p); err != nil {
+			return handler.Errorf("update peer: %s", err)
+		}
+	}
+	if s.rebalancer != nil {
+		s.rebalancer.record(req.Digest, h)
+	}
+	s.stats.Counter("handoff_peers").Inc(int64(len(req.Peers)))
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+// fakeRing is a hashring.Ring where a single tracker owns all digests.
+type fakeRing struct {
+	owner string
+}
+
+func (r *fakeRing) Locations(d core.Digest) []string { return []string{r.owner} }
+func (r *fakeRing) ReplicaLocations(d core.Digest, replicas int) []string {
+	return []string{r.owner}
+}
+func (r *fakeRing) Contains(addr string) bool    { return addr == r.owner }
+func (r *fakeRing) Monitor(stop <-chan struct{}) {}
+func (r *fakeRing) Refresh()                     {}
+
+func TestRebalanceHandsOffPeersToNewOwner(t *testing.T) {
+	require := require.New(t)
+
+	// Tracker which gains ownership.
+	dst := Fixture()
+	addr, stop := testutil.StartServer(dst.Handler())
+	defer stop()
+
+	self := "localhost:0"
+	ring := &fakeRing{self}
+	clk := clock.NewMock()
+	src := peerstore.NewTestStore()
+	r := newRebalancer(RebalanceConfig{}, clk, tally.NoopScope, ring, self, src, nil)
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+	for _, p := range peers {
+		require.NoError(src.UpdatePeer(h, p))
+	}
+	r.record(blob.Digest, h)
+
+	// Nothing is handed off while the local tracker owns the torrent.
+	r.rebalance()
+	_, err := dst.peerStore.GetPeers(h, 10)
+	require.Error(err)
+
+	ring.owner = addr
+	r.rebalance()
+	result, err := dst.peerStore.GetPeers(h, 10)
+	require.NoError(err)
+	require.ElementsMatch(peers, result)
+	require.Equal(addr, r.torrents[h].owner)
+
+	// Announces return ownership to the local tracker until the next rebalance.
+	r.record(blob.Digest, h)
+	require.Equal(self, r.torrents[h].owner)
+}
+
+func TestRebalanceRetriesFailedHandoffs(t *testing.T) {
+	require := require.New(t)
+
+	ring := &fakeRing{"localhost:0"}
+	src := peerstore.NewTestStore()
+	r := newRebalancer(
+		RebalanceConfig{Timeout: time.Second}, clock.NewMock(), tally.NoopScope, ring, "localhost:0", src, nil)
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	require.NoError(src.UpdatePeer(h, core.PeerInfoFixture()))
+	r.record(blob.Digest, h)
+
+	// Unavailable owner.
+	ring.owner = "localhost:1"
+	r.rebalance()
+	require.Equal("localhost:0", r.torrents[h].owner)
+}
+
+func TestRebalanceForgetsExpiredTorrents(t *testing.T) {
+	require := require.New(t)
+
+	ring := &fakeRing{"localhost:0"}
+	clk := clock.NewMock()
+	r := newRebalancer(
+		RebalanceConfig{TorrentTTL: time.Minute}, clk, tally.NoopScope,
+		ring, "localhost:0", peerstore.NewTestStore(), nil)
+
+	blob := core.NewBlobFixture()
+	r.record(blob.Digest, blob.MetaInfo.InfoHash())
+
+	clk.Add(time.Minute)
+	r.rebalance()
+	require.Empty(r.torrents)
+}
+
+func TestAnnounceFailsOverToNextTracker(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	// Tracker which is down behind nginx.
+	downAddr, stopDown := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer stopDown()
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addr, downAddr))
+	var blob *core.BlobFixture
+	for {
+		blob = core.NewBlobFixture()
+		if ring.Locations(blob.Digest)[0] == downAddr {
+			break
+		}
+	}
+	pctx := core.PeerContextFixture()
+	client := announceclient.New(pctx, ring, nil)
+
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+
+	result, _, err := client.Announce(
+		_testNamespace, blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	require.NoError(err)
+	require.Equal(peers, result)
+}
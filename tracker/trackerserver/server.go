@@ -17,13 +17,16 @@ import (
 	"fmt"
 	"net/http"
 	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
+	"sync"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/go-chi/chi"
 	chimiddleware "github.com/go-chi/chi/middleware"
 	"github.com/uber-go/tally"
 
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracker/metainfostore"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -37,11 +40,21 @@ type Server struct {
 	config Config
 	stats  tally.Scope
 
-	peerStore   peerstore.Store
-	originStore originstore.Store
-	policy      *peerhandoutpolicy.PriorityPolicy
+	peerStore     peerstore.Store
+	originStore   originstore.Store
+	metaInfoStore metainfostore.Store
+	policy        *peerhandoutpolicy.PriorityPolicy
 
 	originCluster blobclient.ClusterClient
+
+	handouts *handoutStore
+	swarms   *swarmTracker
+	limiter  *announceLimiter // Nil if announces are not rate limited.
+
+	rebalancer *rebalancer // Nil if rebalancing is disabled.
+
+	stopOnce sync.Once
+	stop     chan struct{}
 }
 
 // New creates a new Server.
@@ -51,7 +64,9 @@ func New(
 	policy *peerhandoutpolicy.PriorityPolicy,
 	peerStore peerstore.Store,
 	originStore originstore.Store,
-	originCluster blobclient.ClusterClient) *Server {
+	metaInfoStore metainfostore.Store,
+	originCluster blobclient.ClusterClient,
+	opts ...Option) (*Server, error) {
 
 	config = config.applyDefaults()
 
@@ -59,14 +74,32 @@ func New(
 		"module": "trackerserver",
 	})
 
-	return &Server{
+	var limiter *announceLimiter
+	if config.AnnounceRateLimit.Enabled {
+		var err error
+		limiter, err = newAnnounceLimiter(config.AnnounceRateLimit, clock.New(), stats)
+		if err != nil {
+			return nil, fmt.Errorf("announce rate limit: %s", err)
+		}
+	}
+
+	s := &Server{
 		config:        config,
 		stats:         stats,
 		peerStore:     peerStore,
 		originStore:   originStore,
+		metaInfoStore: metaInfoStore,
 		policy:        policy,
 		originCluster: originCluster,
+		handouts:      newHandoutStore(clock.New(), config.HandoutTTL),
+		swarms:        newSwarmTracker(config.SwarmStats, clock.New()),
+		limiter:       limiter,
+		stop:          make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
 }
 
 // Handler an http handler for s.
@@ -81,7 +114,12 @@ func (s *Server) Handler() http.Handler {
 
 	r.Get("/announce", handler.Wrap(s.announceHandlerV1))
 	r.Post("/announce/{infohash}", handler.Wrap(s.announceHandlerV2))
+	r.Post("/announce/{infohash}/incremental", handler.Wrap(s.announceIncrementalHandler))
 	r.Get("/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
+	r.Get("/namespace/{namespace}/blobs/{digest}/chunkindex", handler.Wrap(s.getChunkIndexHandler))
+	r.Get("/swarms", handler.Wrap(s.getSwarmHealthHandler))
+	r.Get("/swarms/{infohash}", handler.Wrap(s.getSwarmStatsHandler))
+	r.Post("/handoff/{infohash}", handler.Wrap(s.handoffHandler))
 
 	r.Mount("/debug", chimiddleware.Profiler())
 
@@ -90,10 +128,20 @@ func (s *Server) Handler() http.Handler {
 
 // ListenAndServe is a blocking call which runs s.
 func (s *Server) ListenAndServe() error {
+	defer s.Close()
+
 	log.Infof("Starting tracker server on %s", s.config.Listener)
+	if s.rebalancer != nil {
+		go s.rebalancer.monitor(s.stop)
+	}
 	return listener.Serve(s.config.Listener, s.Handler())
 }
 
+// Close stops the background tasks of s.
+func (s *Server) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
 func (s *Server) readinessCheckHandler(w http.ResponseWriter, r *http.Request) error {
 	err := s.originCluster.CheckReadiness()
 	if err != nil {
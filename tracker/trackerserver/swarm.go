@@ -0,0 +1,319 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// SwarmStatsConfig defines the configuration of swarm statistics.
+type SwarmStatsConfig struct {
+
+	// PeerTTL is how long peers are counted after their last announce.
+	PeerTTL time.Duration `yaml:"peer_ttl"`
+
+	// CompletionWindow is the window completion rates are measured over.
+	CompletionWindow time.Duration `yaml:"completion_window"`
+
+	// MaxTorrents bounds the number of torrents statistics are kept for.
+	// Announces of further torrents are not counted until others expire.
+	MaxTorrents int `yaml:"max_torrents"`
+}
+
+func (c SwarmStatsConfig) applyDefaults() SwarmStatsConfig {
+	if c.PeerTTL == 0 {
+		c.PeerTTL = 5 * time.Minute
+	}
+	if c.CompletionWindow == 0 {
+		c.CompletionWindow = 10 * time.Minute
+	}
+	if c.MaxTorrents == 0 {
+		c.MaxTorrents = 100000
+	}
+	return c
+}
+
+// SwarmStats describes the composition of the swarm of a torrent, as observed
+// by the announces to a single tracker.
+type SwarmStats struct {
+	InfoHash string      `json:"info_hash"`
+	Digest   core.Digest `json:"digest"`
+	Peers    int         `json:"peers"`
+	Seeders  int         `json:"seeders"`
+	Leechers int         `json:"leechers"`
+
+	// Origins is the number of origins which seed the torrent. Only set by
+	// the per-torrent endpoint.
+	Origins int `json:"origins,omitempty"`
+
+	// PieceAvailability estimates the number of complete copies of the torrent
+	// distributed among peers. Seeders hold a full copy, and leechers are
+	// assumed to progress linearly over the average download duration of the
+	// swarm, so leechers only count once some peer completed.
+	PieceAvailability float64 `json:"piece_availability"`
+
+	// Completions is the number of peers which completed within the completion
+	// window, and CompletionsPerMinute the rate thereof.
+	Completions          int     `json:"completions"`
+	CompletionsPerMinute float64 `json:"completions_per_minute"`
+
+	// AvgDownloadDuration is the average duration between the first announce
+	// of peers and their completion. Zero if no peer completed.
+	AvgDownloadDuration time.Duration `json:"avg_download_duration"`
+
+	LastAnnounce time.Time `json:"last_announce"`
+}
+
+// SwarmHealth aggregates the swarms of all torrents announced to a tracker.
+type SwarmHealth struct {
+	Torrents             int     `json:"torrents"`
+	Peers                int     `json:"peers"`
+	Seeders              int     `json:"seeders"`
+	Leechers             int     `json:"leechers"`
+	CompletionsPerMinute float64 `json:"completions_per_minute"`
+
+	// Unseeded is the number of torrents with leechers but no seeding peers,
+	// which depend on origins to make progress.
+	Unseeded int `json:"unseeded"`
+
+	// Swarms lists the largest swarms, by number of peers.
+	Swarms []SwarmStats `json:"swarms"`
+}
+
+type swarmPeer struct {
+	complete  bool
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+type swarm struct {
+	digest      core.Digest
+	peers       map[core.PeerID]*swarmPeer
+	completions []time.Time // Ascending.
+
+	// Sum and count of download durations of completed peers.
+	downloadTime time.Duration
+	downloads    int
+
+	lastAnnounce time.Time
+}
+
+// swarmTracker records announces to measure the swarms of torrents.
+type swarmTracker struct {
+	config SwarmStatsConfig
+	clk    clock.Clock
+
+	mu        sync.Mutex // Protects the following fields:
+	swarms    map[core.InfoHash]*swarm
+	lastPurge time.Time
+}
+
+func newSwarmTracker(config SwarmStatsConfig, clk clock.Clock) *swarmTracker {
+	return &swarmTracker{
+		config: config.applyDefaults(),
+		clk:    clk,
+		swarms: make(map[core.InfoHash]*swarm),
+	}
+}
+
+// record records an announce of peer for the torrent of h.
+func (t *swarmTracker) record(d core.Digest, h core.InfoHash, peer *core.PeerInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clk.Now()
+	if now.Sub(t.lastPurge) >= t.config.PeerTTL {
+		t.purgeLocked(now)
+	}
+
+	s, ok := t.swarms[h]
+	if !ok {
+		if len(t.swarms) >= t.config.MaxTorrents {
+			return
+		}
+		s = &swarm{digest: d, peers: make(map[core.PeerID]*swarmPeer)}
+		t.swarms[h] = s
+	}
+	s.lastAnnounce = now
+
+	p, ok := s.peers[peer.PeerID]
+	if !ok {
+		p = &swarmPeer{complete: peer.Complete, firstSeen: now}
+		s.peers[peer.PeerID] = p
+	} else if peer.Complete && !p.complete {
+		// The peer completed since its last announce.
+		p.complete = true
+		s.completions = append(s.completions, now)
+		s.downloadTime += now.Sub(p.firstSeen)
+		s.downloads++
+	}
+	p.lastSeen = now
+}
+
+// purgeLocked drops expired peers and completions, and torrents without peers.
+func (t *swarmTracker) purgeLocked(now time.Time) {
+	for h, s := range t.swarms {
+		t.expireLocked(s, now)
+		if len(s.peers) == 0 {
+			delete(t.swarms, h)
+		}
+	}
+	t.lastPurge = now
+}
+
+func (t *swarmTracker) expireLocked(s *swarm, now time.Time) {
+	for id, p := range s.peers {
+		if now.Sub(p.lastSeen) >= t.config.PeerTTL {
+			delete(s.peers, id)
+		}
+	}
+	i := sort.Search(len(s.completions), func(i int) bool {
+		return now.Sub(s.completions[i]) < t.config.CompletionWindow
+	})
+	s.completions = s.completions[i:]
+}
+
+func (t *swarmTracker) statsLocked(h core.InfoHash, s *swarm, now time.Time) SwarmStats {
+	t.expireLocked(s, now)
+
+	stats := SwarmStats{
+		InfoHash:     h.Hex(),
+		Digest:       s.digest,
+		Completions:  len(s.completions),
+		LastAnnounce: s.lastAnnounce,
+	}
+	stats.CompletionsPerMinute = float64(len(s.completions)) / t.config.CompletionWindow.Minutes()
+	if s.downloads > 0 {
+		stats.AvgDownloadDuration = s.downloadTime / time.Duration(s.downloads)
+	}
+	for _, p := range s.peers {
+		stats.Peers++
+		if p.complete {
+			stats.Seeders++
+			stats.PieceAvailability++
+			continue
+		}
+		stats.Leechers++
+		if stats.AvgDownloadDuration > 0 {
+			progress := float64(now.Sub(p.firstSeen)) / float64(stats.AvgDownloadDuration)
+			if progress > 1 {
+				progress = 1
+			}
+			stats.PieceAvailability += progress
+		}
+	}
+	return stats
+}
+
+// stats returns the stats of the torrent of h, or false if no peers announced
+// it recently.
+func (t *swarmTracker) stats(h core.InfoHash) (SwarmStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.swarms[h]
+	if !ok {
+		return SwarmStats{}, false
+	}
+	stats := t.statsLocked(h, s, t.clk.Now())
+	if stats.Peers == 0 {
+		return SwarmStats{}, false
+	}
+	return stats, true
+}
+
+// health aggregates the stats of all torrents, and lists the limit largest
+// swarms.
+func (t *swarmTracker) health(limit int) SwarmHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clk.Now()
+	t.purgeLocked(now)
+
+	health := SwarmHealth{Swarms: []SwarmStats{}}
+	for h, s := range t.swarms {
+		stats := t.statsLocked(h, s, now)
+		health.Torrents++
+		health.Peers += stats.Peers
+		health.Seeders += stats.Seeders
+		health.Leechers += stats.Leechers
+		health.CompletionsPerMinute += stats.CompletionsPerMinute
+		if stats.Seeders == 0 && stats.Leechers > 0 {
+			health.Unseeded++
+		}
+		health.Swarms = append(health.Swarms, stats)
+	}
+	sort.Slice(health.Swarms, func(i, j int) bool {
+		a, b := health.Swarms[i], health.Swarms[j]
+		if a.Peers != b.Peers {
+			return a.Peers > b.Peers
+		}
+		return a.InfoHash < b.InfoHash
+	})
+	if len(health.Swarms) > limit {
+		health.Swarms = health.Swarms[:limit]
+	}
+	return health
+}
+
+func (s *Server) getSwarmStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	infohash, err := httputil.ParseParam(r, "infohash")
+	if err != nil {
+		return err
+	}
+	h, err := core.NewInfoHashFromHex(infohash)
+	if err != nil {
+		return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+	}
+	stats, ok := s.swarms.stats(h)
+	if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	origins, err := s.originStore.GetOrigins(stats.Digest)
+	if err != nil {
+		log.With("hash", h).Infof("Error getting origins of swarm: %s", err)
+	}
+	stats.Origins = len(origins)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		return fmt.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) getSwarmHealthHandler(w http.ResponseWriter, r *http.Request) error {
+	limit, err := strconv.Atoi(httputil.GetQueryArg(r, "limit", "100"))
+	if err != nil || limit < 0 {
+		return handler.Errorf("invalid limit").Status(http.StatusBadRequest)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.swarms.health(limit)); err != nil {
+		return fmt.Errorf("json encode: %s", err)
+	}
+	return nil
+}
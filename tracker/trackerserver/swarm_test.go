@@ -0,0 +1,211 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func peerFixture(complete bool) *core.PeerInfo {
+	p := core.PeerInfoFixture()
+	p.Complete = complete
+	return p
+}
+
+func TestSwarmTrackerStats(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := newSwarmTracker(SwarmStatsConfig{
+		PeerTTL:          time.Minute,
+		CompletionWindow: 2 * time.Minute,
+	}, clk)
+
+	d := core.DigestFixture()
+	h := core.InfoHashFixture()
+
+	seeder := peerFixture(true)
+	leecher1 := peerFixture(false)
+	leecher2 := peerFixture(false)
+
+	tracker.record(d, h, seeder)
+	tracker.record(d, h, leecher1)
+	tracker.record(d, h, leecher2)
+
+	stats, ok := tracker.stats(h)
+	require.True(ok)
+	require.Equal(d, stats.Digest)
+	require.Equal(3, stats.Peers)
+	require.Equal(1, stats.Seeders)
+	require.Equal(2, stats.Leechers)
+	require.Equal(0, stats.Completions)
+	// Leechers do not count towards availability until some peer completed.
+	require.Equal(1.0, stats.PieceAvailability)
+
+	clk.Add(20 * time.Second)
+
+	leecher1.Complete = true
+	tracker.record(d, h, leecher1)
+	tracker.record(d, h, leecher2)
+	tracker.record(d, h, seeder)
+
+	stats, ok = tracker.stats(h)
+	require.True(ok)
+	require.Equal(2, stats.Seeders)
+	require.Equal(1, stats.Leechers)
+	require.Equal(1, stats.Completions)
+	require.Equal(0.5, stats.CompletionsPerMinute)
+	require.Equal(20*time.Second, stats.AvgDownloadDuration)
+	// leecher2 is expected to be complete, since it joined alongside leecher1.
+	require.Equal(3.0, stats.PieceAvailability)
+	require.Equal(clk.Now(), stats.LastAnnounce)
+}
+
+func TestSwarmTrackerExpiry(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tracker := newSwarmTracker(SwarmStatsConfig{
+		PeerTTL:          time.Minute,
+		CompletionWindow: 2 * time.Minute,
+	}, clk)
+
+	d := core.DigestFixture()
+	h := core.InfoHashFixture()
+
+	p1 := peerFixture(false)
+	p2 := peerFixture(false)
+	tracker.record(d, h, p1)
+	tracker.record(d, h, p2)
+
+	clk.Add(30 * time.Second)
+	p1.Complete = true
+	tracker.record(d, h, p1)
+
+	clk.Add(45 * time.Second)
+
+	// p2 expired, but the completion of p1 is still within the window.
+	stats, ok := tracker.stats(h)
+	require.True(ok)
+	require.Equal(1, stats.Peers)
+	require.Equal(1, stats.Completions)
+
+	clk.Add(time.Minute)
+
+	_, ok = tracker.stats(h)
+	require.False(ok)
+	require.Equal(0, tracker.health(10).Torrents)
+}
+
+func TestSwarmTrackerMaxTorrents(t *testing.T) {
+	require := require.New(t)
+
+	tracker := newSwarmTracker(SwarmStatsConfig{MaxTorrents: 1}, clock.NewMock())
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	tracker.record(core.DigestFixture(), h1, peerFixture(false))
+	tracker.record(core.DigestFixture(), h2, peerFixture(false))
+
+	_, ok := tracker.stats(h1)
+	require.True(ok)
+	_, ok = tracker.stats(h2)
+	require.False(ok)
+}
+
+func TestSwarmTrackerHealth(t *testing.T) {
+	require := require.New(t)
+
+	tracker := newSwarmTracker(SwarmStatsConfig{}, clock.NewMock())
+
+	small := core.InfoHashFixture()
+	tracker.record(core.DigestFixture(), small, peerFixture(false))
+
+	large := core.InfoHashFixture()
+	tracker.record(core.DigestFixture(), large, peerFixture(true))
+	tracker.record(core.DigestFixture(), large, peerFixture(false))
+	tracker.record(core.DigestFixture(), large, peerFixture(false))
+
+	health := tracker.health(1)
+	require.Equal(2, health.Torrents)
+	require.Equal(4, health.Peers)
+	require.Equal(1, health.Seeders)
+	require.Equal(3, health.Leechers)
+	require.Equal(1, health.Unseeded)
+	require.Len(health.Swarms, 1)
+	require.Equal(large.Hex(), health.Swarms[0].InfoHash)
+}
+
+func TestSwarmStatsHandlers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	pctx := core.PeerContextFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, gomock.Any()).Return(nil)
+
+	_, _, err := client.Announce(_testNamespace, blob.Digest, h, true, announceclient.V2)
+	require.NoError(err)
+
+	origins := []*core.PeerInfo{core.OriginPeerInfoFixture(), core.OriginPeerInfoFixture()}
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/swarms/%s", addr, h.Hex()))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var stats SwarmStats
+	require.NoError(json.NewDecoder(resp.Body).Decode(&stats))
+	require.Equal(h.Hex(), stats.InfoHash)
+	require.Equal(blob.Digest, stats.Digest)
+	require.Equal(1, stats.Seeders)
+	require.Equal(2, stats.Origins)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/swarms/%s", addr, core.InfoHashFixture().Hex()))
+	require.True(httputil.IsNotFound(err))
+
+	resp, err = httputil.Get(fmt.Sprintf("http://%s/swarms?limit=10", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var health SwarmHealth
+	require.NoError(json.NewDecoder(resp.Body).Decode(&health))
+	require.Equal(1, health.Torrents)
+	require.Len(health.Swarms, 1)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/swarms?limit=foo", addr))
+	require.True(httputil.IsStatus(err, 400))
+}
@@ -17,14 +17,18 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/uber-go/tally"
 	mockblobclient "github.com/uber/kraken/mocks/origin/blobclient"
 	mockoriginstore "github.com/uber/kraken/mocks/tracker/originstore"
 	mockpeerstore "github.com/uber/kraken/mocks/tracker/peerstore"
+	"github.com/uber/kraken/tracker/metainfostore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 )
 
+const _testNamespace = "test-namespace"
+
 type serverMocks struct {
 	config        Config
 	policy        *peerhandoutpolicy.PriorityPolicy
@@ -46,12 +50,25 @@ func newServerMocks(t *testing.T, config Config) (*serverMocks, func()) {
 	}, ctrl.Finish
 }
 
-func (m *serverMocks) handler() http.Handler {
-	return New(
+func (m *serverMocks) server() *Server {
+	metaInfoStore, err := metainfostore.New(metainfostore.Config{}, clock.New(), m.stats, m.originCluster)
+	if err != nil {
+		panic(err)
+	}
+	s, err := New(
 		m.config,
 		m.stats,
 		m.policy,
 		m.peerStore,
 		m.originStore,
-		m.originCluster).Handler()
+		metaInfoStore,
+		m.originCluster)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (m *serverMocks) handler() http.Handler {
+	return m.server().Handler()
 }
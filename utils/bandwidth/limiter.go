@@ -16,6 +16,8 @@ package bandwidth
 import (
 	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/uber/kraken/utils/log"
@@ -47,10 +49,13 @@ func (c Config) applyDefaults() Config {
 
 // Limiter limits egress and ingress bandwidth via token-bucket rate limiter.
 type Limiter struct {
-	config  Config
 	egress  *rate.Limiter
 	ingress *rate.Limiter
 	logger  *zap.SugaredLogger
+
+	mu          sync.Mutex // Protects bits per sec in config, and denominator.
+	config      Config
+	denominator uint64
 }
 
 // Option allows setting optional parameters in Limiter.
@@ -66,8 +71,9 @@ func NewLimiter(config Config, opts ...Option) (*Limiter, error) {
 	config = config.applyDefaults()
 
 	l := &Limiter{
-		config: config,
-		logger: log.Default(),
+		config:      config,
+		denominator: 1,
+		logger:      log.Default(),
 	}
 	for _, opt := range opts {
 		opt(l)
@@ -136,15 +142,162 @@ func (l *Limiter) Adjust(denominator int) error {
 		return errors.New("denominator must be greater than 0")
 	}
 
-	ebps := max(l.config.EgressBitsPerSec/l.config.TokenSize/uint64(denominator), 1)
-	ibps := max(l.config.IngressBitsPerSec/l.config.TokenSize/uint64(denominator), 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.denominator = uint64(denominator)
+	l.apply()
+
+	return nil
+}
+
+// SetLimits replaces the configured egress and ingress bps. Any denominator
+// set by Adjust still applies to the new limits.
+func (l *Limiter) SetLimits(egressBitsPerSec, ingressBitsPerSec uint64) error {
+	if !l.config.Enable {
+		return errors.New("bandwidth limits disabled")
+	}
+	if egressBitsPerSec == 0 || ingressBitsPerSec == 0 {
+		return errors.New("bits per sec must be non-zero")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.config.EgressBitsPerSec = egressBitsPerSec
+	l.config.IngressBitsPerSec = ingressBitsPerSec
+
+	etps := max(egressBitsPerSec/l.config.TokenSize, 1)
+	itps := max(ingressBitsPerSec/l.config.TokenSize, 1)
+	l.egress.SetBurst(int(etps))
+	l.ingress.SetBurst(int(itps))
+	l.apply()
+
+	l.logger.Infof("Set egress bandwidth to %s/sec", memsize.BitFormat(egressBitsPerSec))
+	l.logger.Infof("Set ingress bandwidth to %s/sec", memsize.BitFormat(ingressBitsPerSec))
+
+	return nil
+}
+
+// apply sets the rate limits from the current config and denominator. Caller
+// must hold l.mu.
+func (l *Limiter) apply() {
+	ebps := max(l.config.EgressBitsPerSec/l.config.TokenSize/l.denominator, 1)
+	ibps := max(l.config.IngressBitsPerSec/l.config.TokenSize/l.denominator, 1)
 
 	l.egress.SetLimit(rate.Limit(ebps))
 	l.ingress.SetLimit(rate.Limit(ibps))
+}
 
+// reserveChunked reserves bandwidth for nbytes in pieces no larger than the
+// bucket of rl, so arbitrarily large transfers can be throttled.
+func (l *Limiter) reserveChunked(rl *rate.Limiter, nbytes int64) error {
+	if !l.config.Enable {
+		return nil
+	}
+	chunk := int64(uint64(rl.Burst()) * l.config.TokenSize / 8)
+	if chunk <= 0 {
+		chunk = 1
+	}
+	for nbytes > 0 {
+		n := nbytes
+		if n > chunk {
+			n = chunk
+		}
+		if err := l.reserve(rl, n); err != nil {
+			return err
+		}
+		nbytes -= n
+	}
 	return nil
 }
 
+type egressReader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *egressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if rerr := r.l.reserveChunked(r.l.egress, int64(n)); rerr != nil {
+			return n, rerr
+		}
+	}
+	return n, err
+}
+
+// EgressReader returns a reader which blocks until egress bandwidth is
+// available for the bytes read from r.
+func (l *Limiter) EgressReader(r io.Reader) io.Reader {
+	if !l.config.Enable {
+		return r
+	}
+	return &egressReader{r, l}
+}
+
+type ingressWriter struct {
+	w io.Writer
+	l *Limiter
+}
+
+func (w *ingressWriter) Write(p []byte) (int, error) {
+	if err := w.l.reserveChunked(w.l.ingress, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+type ingressWriterAt struct {
+	ingressWriter
+	wa io.WriterAt
+}
+
+func (w *ingressWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if err := w.l.reserveChunked(w.l.ingress, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return w.wa.WriteAt(p, off)
+}
+
+// IngressWriter returns a writer which blocks until ingress bandwidth is
+// available for the bytes written to w. The returned writer implements
+// io.WriterAt if w does.
+func (l *Limiter) IngressWriter(w io.Writer) io.Writer {
+	if !l.config.Enable {
+		return w
+	}
+	if wa, ok := w.(io.WriterAt); ok {
+		return &ingressWriterAt{ingressWriter{w, l}, wa}
+	}
+	return &ingressWriter{w, l}
+}
+
+// WaitEgress blocks until egress bandwidth for nbytes is available. Unlike
+// ReserveEgress, nbytes may be larger than the maximum egress bandwidth.
+func (l *Limiter) WaitEgress(nbytes int64) error {
+	return l.reserveChunked(l.egress, nbytes)
+}
+
+// Enabled returns whether l limits bandwidth.
+func (l *Limiter) Enabled() bool {
+	return l.config.Enable
+}
+
+// EgressBitsPerSec returns the configured egress bps, before any Adjust.
+func (l *Limiter) EgressBitsPerSec() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.config.EgressBitsPerSec
+}
+
+// IngressBitsPerSec returns the configured ingress bps, before any Adjust.
+func (l *Limiter) IngressBitsPerSec() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.config.IngressBitsPerSec
+}
+
 // EgressLimit returns the current egress limit.
 func (l *Limiter) EgressLimit() int64 {
 	return int64(l.egress.Limit())
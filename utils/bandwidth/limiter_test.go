@@ -14,6 +14,8 @@
 package bandwidth
 
 import (
+	"bytes"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -248,3 +250,68 @@ func TestLimiterAdjust(t *testing.T) {
 		require.Equal(c.ingress, l.IngressLimit())
 	}
 }
+
+func TestLimiterSetLimits(t *testing.T) {
+	require := require.New(t)
+
+	l, err := NewLimiter(Config{
+		EgressBitsPerSec:  50,
+		IngressBitsPerSec: 10,
+		TokenSize:         1,
+		Enable:            true,
+	})
+	require.NoError(err)
+
+	require.NoError(l.Adjust(2))
+	require.NoError(l.SetLimits(100, 40))
+	require.Equal(uint64(100), l.EgressBitsPerSec())
+	require.Equal(uint64(40), l.IngressBitsPerSec())
+
+	// Denominator still applies to new limits.
+	require.Equal(int64(50), l.EgressLimit())
+	require.Equal(int64(20), l.IngressLimit())
+
+	require.Error(l.SetLimits(0, 40))
+}
+
+func TestLimiterSetLimitsDisabled(t *testing.T) {
+	require := require.New(t)
+
+	l, err := NewLimiter(Config{})
+	require.NoError(err)
+	require.Error(l.SetLimits(100, 100))
+}
+
+func TestLimiterStreams(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	bps := uint64(800) // 100 bytes.
+
+	l, err := NewLimiter(Config{
+		EgressBitsPerSec:  bps,
+		IngressBitsPerSec: bps,
+		TokenSize:         8,
+		Enable:            true,
+	})
+	require.NoError(err)
+
+	// 300 bytes is larger than the bucket, and the bucket is initially full,
+	// so each transfer takes two seconds.
+	data := bytes.Repeat([]byte("a"), 300)
+
+	start := time.Now()
+	var b bytes.Buffer
+	_, err = io.Copy(&b, l.EgressReader(bytes.NewReader(data)))
+	require.NoError(err)
+	require.Equal(data, b.Bytes())
+	require.InDelta(2*time.Second, time.Since(start), float64(100*time.Millisecond))
+
+	start = time.Now()
+	b.Reset()
+	_, err = io.Copy(l.IngressWriter(&b), bytes.NewReader(data))
+	require.NoError(err)
+	require.Equal(data, b.Bytes())
+	require.InDelta(2*time.Second, time.Since(start), float64(100*time.Millisecond))
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/docker/distribution"
+	"github.com/uber/kraken/core"
+)
+
+const (
+	_ociArtifactManifestType = "application/vnd.oci.artifact.manifest.v1+json"
+
+	// EmptyMediaType is the media type of the empty descriptor, which OCI
+	// artifacts without configuration use as config.
+	EmptyMediaType = "application/vnd.oci.empty.v1+json"
+)
+
+// ArtifactManifest is an OCI artifact manifest, as pushed by ORAS before
+// artifacts were stored as image manifests with an artifactType.
+type ArtifactManifest struct {
+	MediaType    string                    `json:"mediaType"`
+	ArtifactType string                    `json:"artifactType"`
+	Blobs        []distribution.Descriptor `json:"blobs,omitempty"`
+	Subject      *distribution.Descriptor  `json:"subject,omitempty"`
+	Annotations  map[string]string         `json:"annotations,omitempty"`
+
+	canonical []byte
+}
+
+// References returns the blobs of the artifact. The subject is not a
+// reference, since it is a separate manifest which the artifact describes.
+func (m *ArtifactManifest) References() []distribution.Descriptor {
+	return m.Blobs
+}
+
+// Payload returns the media type and the raw bytes of the manifest.
+func (m *ArtifactManifest) Payload() (string, []byte, error) {
+	return m.MediaType, m.canonical, nil
+}
+
+// ParseArtifactManifest returns a parsed OCI artifact manifest and its digest.
+func ParseArtifactManifest(bytes []byte) (distribution.Manifest, core.Digest, error) {
+	m := &ArtifactManifest{}
+	if err := json.Unmarshal(bytes, m); err != nil {
+		return nil, core.Digest{}, fmt.Errorf("unmarshal artifact manifest: %s", err)
+	}
+	if m.MediaType != _ociArtifactManifestType {
+		return nil, core.Digest{}, fmt.Errorf(
+			"mediaType in artifact manifest should be '%s' not '%s'", _ociArtifactManifestType, m.MediaType)
+	}
+	if m.ArtifactType == "" {
+		return nil, core.Digest{}, errors.New("artifact manifest has no artifactType")
+	}
+	m.canonical = bytes
+	d, err := core.NewDigester().FromBytes(bytes)
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("digest: %s", err)
+	}
+	return m, d, nil
+}
+
+// GetArtifactType returns the artifact type of manifest, or an empty string if
+// manifest is an image. OCI image manifests without an artifactType are
+// artifacts if their config is not an image config, in which case the media
+// type of their config is the artifact type.
+func GetArtifactType(manifest distribution.Manifest) (string, error) {
+	if m, ok := manifest.(*ArtifactManifest); ok {
+		return m.ArtifactType, nil
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return "", fmt.Errorf("payload: %s", err)
+	}
+	if mediaType != _ociManifestType {
+		return "", nil
+	}
+	var m struct {
+		ArtifactType string                  `json:"artifactType"`
+		Config       distribution.Descriptor `json:"config"`
+	}
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return "", fmt.Errorf("unmarshal: %s", err)
+	}
+	if m.ArtifactType != "" {
+		return m.ArtifactType, nil
+	}
+	if m.Config.MediaType == _ociImageConfigType || m.Config.MediaType == _v2ImageConfigType {
+		return "", nil
+	}
+	return m.Config.MediaType, nil
+}
+
+// GetArtifactReferences returns the blobs referenced by an artifact manifest,
+// excluding the empty descriptor. Its data is inlined in the descriptor or
+// implied, so clients do not necessarily upload it.
+func GetArtifactReferences(manifest distribution.Manifest) ([]core.Digest, error) {
+	var refs []core.Digest
+	for _, desc := range manifest.References() {
+		if desc.MediaType == EmptyMediaType {
+			continue
+		}
+		d, err := core.ParseSHA256Digest(string(desc.Digest))
+		if err != nil {
+			return nil, fmt.Errorf("parse digest: %w", err)
+		}
+		refs = append(refs, d)
+	}
+	return refs, nil
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/uber/kraken/core"
 )
@@ -27,6 +28,11 @@ import (
 const (
 	_v2ManifestType     = "application/vnd.docker.distribution.manifest.v2+json"
 	_v2ManifestListType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	_ociManifestType    = "application/vnd.oci.image.manifest.v1+json"
+	_ociIndexType       = "application/vnd.oci.image.index.v1+json"
+
+	_v2ImageConfigType  = "application/vnd.docker.container.image.v1+json"
+	_ociImageConfigType = "application/vnd.oci.image.config.v1+json"
 )
 
 func ParseManifest(r io.Reader) (distribution.Manifest, core.Digest, error) {
@@ -41,7 +47,23 @@ func ParseManifest(r io.Reader) (distribution.Manifest, core.Digest, error) {
 	}
 
 	// Retry with v2 manifest list.
-	return ParseManifestV2List(b)
+	manifest, d, err = ParseManifestV2List(b)
+	if err == nil {
+		return manifest, d, err
+	}
+
+	// Retry with OCI image index, then OCI image manifest.
+	manifest, d, err = ParseManifestOCIIndex(b)
+	if err == nil {
+		return manifest, d, err
+	}
+	manifest, d, err = ParseManifestOCI(b)
+	if err == nil {
+		return manifest, d, err
+	}
+
+	// Retry with OCI artifact manifest.
+	return ParseArtifactManifest(b)
 }
 
 // ParseManifestV2 returns a parsed v2 manifest and its digest.
@@ -86,6 +108,57 @@ func ParseManifestV2List(bytes []byte) (distribution.Manifest, core.Digest, erro
 	return manifestList, d, nil
 }
 
+// ParseManifestOCI returns a parsed OCI image manifest and its digest.
+func ParseManifestOCI(bytes []byte) (distribution.Manifest, core.Digest, error) {
+	manifest, desc, err := distribution.UnmarshalManifest(_ociManifestType, bytes)
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("unmarshal oci manifest: %s", err)
+	}
+	deserializedManifest, ok := manifest.(*ocischema.DeserializedManifest)
+	if !ok {
+		return nil, core.Digest{}, errors.New("expected ocischema.DeserializedManifest")
+	}
+	version := deserializedManifest.SchemaVersion
+	if version != 2 {
+		return nil, core.Digest{}, fmt.Errorf("unsupported oci manifest version: %d", version)
+	}
+	if deserializedManifest.Config.Digest == "" {
+		return nil, core.Digest{}, errors.New("oci manifest has no config")
+	}
+	d, err := core.ParseSHA256Digest(string(desc.Digest))
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("parse digest: %s", err)
+	}
+	return manifest, d, nil
+}
+
+// ParseManifestOCIIndex returns a parsed OCI image index and its digest. Image
+// indexes are represented as manifest lists, which share their format.
+func ParseManifestOCIIndex(bytes []byte) (distribution.Manifest, core.Digest, error) {
+	index, desc, err := distribution.UnmarshalManifest(_ociIndexType, bytes)
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("unmarshal oci index: %s", err)
+	}
+	deserializedIndex, ok := index.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		return nil, core.Digest{}, errors.New("expected manifestlist.DeserializedManifestList")
+	}
+	version := deserializedIndex.SchemaVersion
+	if version != 2 {
+		return nil, core.Digest{}, fmt.Errorf("unsupported oci index version: %d", version)
+	}
+	// The media type is optional in OCI, so an image manifest without one
+	// would otherwise parse as an empty index.
+	if deserializedIndex.MediaType == "" && len(deserializedIndex.Manifests) == 0 {
+		return nil, core.Digest{}, errors.New("oci index has no manifests")
+	}
+	d, err := core.ParseSHA256Digest(string(desc.Digest))
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("parse digest: %s", err)
+	}
+	return index, d, nil
+}
+
 // GetManifestReferences returns a list of references by a V2 manifest
 func GetManifestReferences(manifest distribution.Manifest) ([]core.Digest, error) {
 	var refs []core.Digest
@@ -100,5 +173,6 @@ func GetManifestReferences(manifest distribution.Manifest) ([]core.Digest, error
 }
 
 func GetSupportedManifestTypes() string {
-	return fmt.Sprintf("%s,%s", _v2ManifestType, _v2ManifestListType)
+	return fmt.Sprintf("%s,%s,%s,%s,%s",
+		_v2ManifestType, _v2ManifestListType, _ociManifestType, _ociIndexType, _ociArtifactManifestType)
 }
@@ -1,10 +1,14 @@
 package dockerutil_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/dockerutil"
 )
 
@@ -88,3 +92,152 @@ func TestParseManifestV2List(t *testing.T) {
 		})
 	}
 }
+
+func TestParseManifestOCI(t *testing.T) {
+	require := require.New(t)
+
+	layers := core.DigestListFixture(3)
+	expected, b := dockerutil.OCIManifestFixture(layers[0], layers[1], layers[2])
+
+	manifest, d, err := dockerutil.ParseManifest(bytes.NewReader(b))
+	require.NoError(err)
+	require.Equal(expected, d)
+	_, ok := manifest.(*ocischema.DeserializedManifest)
+	require.True(ok)
+
+	refs, err := dockerutil.GetManifestReferences(manifest)
+	require.NoError(err)
+	require.Equal(layers, refs)
+}
+
+func TestParseManifestOCIIndex(t *testing.T) {
+	require := require.New(t)
+
+	manifests := core.DigestListFixture(2)
+	expected, b := dockerutil.OCIIndexFixture([]string{"linux/amd64", "linux/arm64/v8"}, manifests)
+
+	manifest, d, err := dockerutil.ParseManifest(bytes.NewReader(b))
+	require.NoError(err)
+	require.Equal(expected, d)
+	index, ok := manifest.(*manifestlist.DeserializedManifestList)
+	require.True(ok)
+	require.Len(index.Manifests, 2)
+	require.Equal("arm64", index.Manifests[1].Platform.Architecture)
+	require.Equal("v8", index.Manifests[1].Platform.Variant)
+}
+
+func TestParseManifestOCIIndexRejectsManifest(t *testing.T) {
+	require := require.New(t)
+
+	layers := core.DigestListFixture(3)
+	_, b := dockerutil.OCIManifestFixture(layers[0], layers[1], layers[2])
+
+	// Strip the optional media type, which must not make the manifest an index.
+	var m map[string]interface{}
+	require.NoError(json.Unmarshal(b, &m))
+	delete(m, "mediaType")
+	b, err := json.Marshal(m)
+	require.NoError(err)
+
+	_, _, err = dockerutil.ParseManifestOCIIndex(b)
+	require.Error(err)
+
+	manifest, _, err := dockerutil.ParseManifest(bytes.NewReader(b))
+	require.NoError(err)
+	_, ok := manifest.(*ocischema.DeserializedManifest)
+	require.True(ok)
+}
+
+func TestParseArtifactManifest(t *testing.T) {
+	require := require.New(t)
+
+	blobs := core.DigestListFixture(2)
+	expected, b := dockerutil.ArtifactManifestFixture("application/spdx+json", blobs...)
+
+	manifest, d, err := dockerutil.ParseManifest(bytes.NewReader(b))
+	require.NoError(err)
+	require.Equal(expected, d)
+
+	mediaType, payload, err := manifest.Payload()
+	require.NoError(err)
+	require.Equal("application/vnd.oci.artifact.manifest.v1+json", mediaType)
+	require.Equal(b, payload)
+
+	artifactType, err := dockerutil.GetArtifactType(manifest)
+	require.NoError(err)
+	require.Equal("application/spdx+json", artifactType)
+
+	refs, err := dockerutil.GetArtifactReferences(manifest)
+	require.NoError(err)
+	require.Equal(blobs, refs)
+}
+
+func TestGetArtifactType(t *testing.T) {
+	layers := core.DigestListFixture(3)
+	_, image := dockerutil.ManifestFixture(layers[0], layers[1], layers[2])
+	_, ociImage := dockerutil.OCIManifestFixture(layers[0], layers[1], layers[2])
+	_, artifact := dockerutil.ArtifactFixture("application/vnd.wasm.config.v0+json", layers[0])
+
+	// Helm charts have no artifactType, but a chart config.
+	var chart map[string]interface{}
+	require.NoError(t, json.Unmarshal(ociImage, &chart))
+	chart["config"].(map[string]interface{})["mediaType"] = "application/vnd.cncf.helm.config.v1+json"
+	helm, err := json.Marshal(chart)
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc     string
+		manifest []byte
+		expected string
+	}{
+		{"docker image", image, ""},
+		{"oci image", ociImage, ""},
+		{"artifact", artifact, "application/vnd.wasm.config.v0+json"},
+		{"config media type", helm, "application/vnd.cncf.helm.config.v1+json"},
+		{"manifest list", testManifestListBytes, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			manifest, _, err := dockerutil.ParseManifest(bytes.NewReader(test.manifest))
+			require.NoError(err)
+			artifactType, err := dockerutil.GetArtifactType(manifest)
+			require.NoError(err)
+			require.Equal(test.expected, artifactType)
+		})
+	}
+}
+
+func TestGetArtifactReferencesSkipsEmptyConfig(t *testing.T) {
+	require := require.New(t)
+
+	blobs := core.DigestListFixture(2)
+	_, b := dockerutil.ArtifactFixture("application/vnd.example+type", blobs...)
+
+	manifest, _, err := dockerutil.ParseManifest(bytes.NewReader(b))
+	require.NoError(err)
+
+	refs, err := dockerutil.GetManifestReferences(manifest)
+	require.NoError(err)
+	require.Len(refs, 3)
+
+	refs, err = dockerutil.GetArtifactReferences(manifest)
+	require.NoError(err)
+	require.Equal(blobs, refs)
+}
+
+func TestParsePlatform(t *testing.T) {
+	for _, s := range []string{"linux/amd64", "linux/arm64/v8"} {
+		t.Run(s, func(t *testing.T) {
+			_, err := dockerutil.ParsePlatform(s)
+			require.NoError(t, err)
+		})
+	}
+	for _, s := range []string{"", "linux", "linux/", "/amd64", "linux/arm64/v8/x"} {
+		t.Run(s, func(t *testing.T) {
+			_, err := dockerutil.ParsePlatform(s)
+			require.Error(t, err)
+		})
+	}
+}
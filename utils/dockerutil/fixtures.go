@@ -14,7 +14,9 @@
 package dockerutil
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/uber/kraken/core"
 )
@@ -50,3 +52,134 @@ func ManifestFixture(config core.Digest, layer1 core.Digest, layer2 core.Digest)
 
 	return d, raw
 }
+
+// OCIManifestFixture creates an OCI image manifest blob for testing purposes.
+func OCIManifestFixture(config core.Digest, layer1 core.Digest, layer2 core.Digest) (core.Digest, []byte) {
+	raw := []byte(fmt.Sprintf(`{
+	   "schemaVersion": 2,
+	   "mediaType": "application/vnd.oci.image.manifest.v1+json",
+	   "config": {
+		  "mediaType": "application/vnd.oci.image.config.v1+json",
+		  "size": 2940,
+		  "digest": "%s"
+	   },
+	   "layers": [
+		  {
+			 "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			 "size": 1902063,
+			 "digest": "%s"
+		  },
+		  {
+			 "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			 "size": 2345077,
+			 "digest": "%s"
+		  }
+	   ]
+	}`, config, layer1, layer2))
+
+	d, err := core.NewDigester().FromBytes(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return d, raw
+}
+
+// ManifestListFixture creates a manifest list blob for testing purposes, where
+// manifests[i] runs on platforms[i], e.g. "linux/arm64/v8".
+func ManifestListFixture(platforms []string, manifests []core.Digest) (core.Digest, []byte) {
+	return manifestListFixture(_v2ManifestListType, _v2ManifestType, platforms, manifests)
+}
+
+// OCIIndexFixture creates an OCI image index blob for testing purposes, where
+// manifests[i] runs on platforms[i], e.g. "linux/arm64/v8".
+func OCIIndexFixture(platforms []string, manifests []core.Digest) (core.Digest, []byte) {
+	return manifestListFixture(_ociIndexType, _ociManifestType, platforms, manifests)
+}
+
+func manifestListFixture(
+	mediaType, manifestType string, platforms []string, manifests []core.Digest) (core.Digest, []byte) {
+
+	type platform struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant,omitempty"`
+	}
+	type descriptor struct {
+		MediaType string   `json:"mediaType"`
+		Size      int      `json:"size"`
+		Digest    string   `json:"digest"`
+		Platform  platform `json:"platform"`
+	}
+	list := struct {
+		SchemaVersion int          `json:"schemaVersion"`
+		MediaType     string       `json:"mediaType"`
+		Manifests     []descriptor `json:"manifests"`
+	}{SchemaVersion: 2, MediaType: mediaType}
+
+	for i, d := range manifests {
+		parts := append(strings.Split(platforms[i], "/"), "", "")
+		list.Manifests = append(list.Manifests, descriptor{
+			MediaType: manifestType,
+			Size:      985,
+			Digest:    d.String(),
+			Platform:  platform{OS: parts[0], Architecture: parts[1], Variant: parts[2]},
+		})
+	}
+	return rawFixture(list)
+}
+
+// ArtifactFixture creates an OCI image manifest blob of an artifact of
+// artifactType with an empty config, as pushed by ORAS, for testing purposes.
+func ArtifactFixture(artifactType string, blobs ...core.Digest) (core.Digest, []byte) {
+	m := map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     _ociManifestType,
+		"artifactType":  artifactType,
+		"config": map[string]interface{}{
+			"mediaType": EmptyMediaType,
+			"size":      2,
+			"digest":    "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+			"data":      "e30=",
+		},
+		"layers": artifactBlobsFixture(blobs),
+	}
+	return rawFixture(m)
+}
+
+// ArtifactManifestFixture creates an OCI artifact manifest blob of an
+// artifact of artifactType for testing purposes.
+func ArtifactManifestFixture(artifactType string, blobs ...core.Digest) (core.Digest, []byte) {
+	m := map[string]interface{}{
+		"mediaType":    _ociArtifactManifestType,
+		"artifactType": artifactType,
+		"blobs":        artifactBlobsFixture(blobs),
+	}
+	return rawFixture(m)
+}
+
+func artifactBlobsFixture(blobs []core.Digest) []map[string]interface{} {
+	var descs []map[string]interface{}
+	for _, d := range blobs {
+		descs = append(descs, map[string]interface{}{
+			"mediaType": "application/octet-stream",
+			"size":      1024,
+			"digest":    d.String(),
+		})
+	}
+	return descs
+}
+
+func rawFixture(v interface{}) (core.Digest, []byte) {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	d, err := core.NewDigester().FromBytes(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return d, raw
+}
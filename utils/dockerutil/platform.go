@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+)
+
+// Platform identifies the platform images run on.
+type Platform struct {
+	OS           string
+	Architecture string
+	Variant      string
+}
+
+// ParsePlatform parses platforms formatted as "os/arch" or "os/arch/variant",
+// e.g. "linux/arm64/v8".
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("expected os/arch[/variant], got %q", s)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return Platform{}, fmt.Errorf("expected os/arch[/variant], got %q", s)
+		}
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// Match returns true if manifests of spec run on p. Platforms without a
+// variant match all variants of their architecture.
+func (p Platform) Match(spec manifestlist.PlatformSpec) bool {
+	if p.OS != spec.OS || p.Architecture != spec.Architecture {
+		return false
+	}
+	return p.Variant == "" || p.Variant == spec.Variant
+}
+
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Architecture
+	}
+	return p.OS + "/" + p.Architecture + "/" + p.Variant
+}
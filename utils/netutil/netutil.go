@@ -64,17 +64,48 @@ func GetIP(host string) (net.IP, error) {
 	return nil, errors.New("no ips found")
 }
 
-// GetLocalIP returns the ip address of the local machine.
+// GetLocalIP returns the ip address of the local machine. IPv4 addresses are
+// preferred, so ipv6 addresses are only returned on ipv6-only machines.
 func GetLocalIP() (string, error) {
+	v4, v6, err := getLocalIPs()
+	if err != nil {
+		return "", err
+	}
+	if v4 != "" {
+		return v4, nil
+	}
+	if v6 != "" {
+		return v6, nil
+	}
+	return "", errors.New("no ip found")
+}
+
+// GetLocalIPv6 returns the global unicast ipv6 address of the local machine.
+// Dual-stack peers announce it in addition to the ipv4 address.
+func GetLocalIPv6() (string, error) {
+	_, v6, err := getLocalIPs()
+	if err != nil {
+		return "", err
+	}
+	if v6 == "" {
+		return "", errors.New("no ipv6 found")
+	}
+	return v6, nil
+}
+
+// getLocalIPs returns the ipv4 and ipv6 addresses of the first supported
+// interface which has one.
+func getLocalIPs() (v4, v6 string, err error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		return "", fmt.Errorf("interfaces: %s", err)
+		return "", "", fmt.Errorf("interfaces: %s", err)
 	}
-	ips := map[string]string{}
+	ips4 := map[string]string{}
+	ips6 := map[string]string{}
 	for _, i := range ifaces {
 		addrs, err := i.Addrs()
 		if err != nil {
-			return "", fmt.Errorf("addrs: %s", err)
+			return "", "", fmt.Errorf("addrs: %s", err)
 		}
 		for _, addr := range addrs {
 			var ip net.IP
@@ -87,18 +118,24 @@ func GetLocalIP() (string, error) {
 			if ip == nil || ip.IsLoopback() {
 				continue
 			}
-			ip = ip.To4()
-			if ip == nil {
-				continue
+			if ip4 := ip.To4(); ip4 != nil {
+				if _, ok := ips4[i.Name]; !ok {
+					ips4[i.Name] = ip4.String()
+				}
+			} else if ip.IsGlobalUnicast() {
+				if _, ok := ips6[i.Name]; !ok {
+					ips6[i.Name] = ip.String()
+				}
 			}
-			ips[i.Name] = ip.String()
-			break
 		}
 	}
 	for _, i := range _supportedInterfaces {
-		if ip, ok := ips[i]; ok {
-			return ip, nil
+		if ip, ok := ips4[i]; ok && v4 == "" {
+			v4 = ip
+		}
+		if ip, ok := ips6[i]; ok && v6 == "" {
+			v6 = ip
 		}
 	}
-	return "", errors.New("no ip found")
+	return v4, v6, nil
 }
@@ -0,0 +1,40 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rwutil
+
+import "io"
+
+// CountingWriter counts the bytes written to the underlying writer, e.g. to
+// resume a failed download after the bytes already written.
+type CountingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// NewCountingWriter returns a CountingWriter which writes to w.
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w}
+}
+
+// Write writes p to the underlying writer.
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// N returns the number of bytes written so far.
+func (w *CountingWriter) N() int64 {
+	return w.n
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rwutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingWriter struct {
+	limit int
+}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return w.limit, errors.New("short write")
+	}
+	return len(p), nil
+}
+
+func TestCountingWriter(t *testing.T) {
+	require := require.New(t)
+
+	var b bytes.Buffer
+	w := NewCountingWriter(&b)
+	require.Equal(int64(0), w.N())
+
+	_, err := w.Write([]byte("hello "))
+	require.NoError(err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(err)
+
+	require.Equal(int64(11), w.N())
+	require.Equal("hello world", b.String())
+}
+
+func TestCountingWriterPartialWrite(t *testing.T) {
+	require := require.New(t)
+
+	w := NewCountingWriter(failingWriter{limit: 3})
+	n, err := w.Write([]byte("hello"))
+	require.Error(err)
+	require.Equal(3, n)
+	require.Equal(int64(3), w.N())
+}